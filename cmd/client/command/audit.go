@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// AuditCmd defines audit command.
+func AuditCmd() *cobra.Command {
+	var name, kind, user, namespace, since string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:     "audit",
+		Short:   "View the audit log of the configuration changes, the newest ones first",
+		Example: "egctl audit --name pipeline-demo --since 24h --limit 10",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			for k, v := range map[string]string{
+				"name":      name,
+				"kind":      kind,
+				"user":      user,
+				"namespace": namespace,
+				"since":     since,
+			} {
+				if v != "" {
+					query.Set(k, v)
+				}
+			}
+			if limit > 0 {
+				query.Set("limit", strconv.Itoa(limit))
+			}
+
+			u := makeURL(auditURL)
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Only show the changes of the object.")
+	cmd.Flags().StringVar(&kind, "kind", "", "Only show the changes of the objects of the kind.")
+	cmd.Flags().StringVar(&user, "by", "", "Only show the changes by the user, in the format of method:user, e.g. token:ci.")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Only show the changes of the objects in the namespace.")
+	cmd.Flags().StringVar(&since, "since", "", "Only show the changes since the time in RFC3339, or the duration before now, e.g. 24h.")
+	cmd.Flags().IntVar(&limit, "limit", 0, "Number of the changes to show at maximum, 0 means no limit.")
+
+	return cmd
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// CircuitBreakerCmd defines circuit breaker command.
+func CircuitBreakerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "circuit-breaker",
+		Short: "View and control the circuit breakers of Proxy filters",
+	}
+
+	cmd.AddCommand(listCircuitBreakersCmd())
+	cmd.AddCommand(circuitBreakerActionCmd("force-open", "Force open a circuit breaker in all members"))
+	cmd.AddCommand(circuitBreakerActionCmd("close", "Close a circuit breaker in all members"))
+	cmd.AddCommand(circuitBreakerActionCmd("reset", "Close a circuit breaker and discard the recorded results in all members"))
+	return cmd
+}
+
+func listCircuitBreakersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the circuit breaker states stored in the cluster of a Proxy filter",
+		Example: "egctl circuit-breaker list <pipeline> <filter>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 2 {
+				return nil
+			}
+			return fmt.Errorf("requires pipeline and filter name")
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(circuitBreakersURL, args[0], args[1]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func circuitBreakerActionCmd(action, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     action,
+		Short:   short,
+		Example: fmt.Sprintf("egctl circuit-breaker %s <pipeline> <filter> <pool>", action),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 3 {
+				return nil
+			}
+			return fmt.Errorf("requires pipeline, filter and pool name (main, mirror or candidate-N)")
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodPost, makeURL(circuitBreakerActionURL, args[0], args[1], args[2], action), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -19,9 +19,13 @@ package command
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/spf13/cobra"
@@ -32,6 +36,18 @@ type (
 	GlobalFlags struct {
 		Server       string
 		OutputFormat string
+		// User is the username and password of the admin APIs, which are
+		// separated by a colon.
+		User string
+		// Token is the bearer token of the admin APIs, a static token or
+		// an ID token.
+		Token string
+		// CACert verifies the certificate of the server, and Cert and Key
+		// are the client certificate, the server is accessed over TLS if
+		// any of them is set.
+		CACert string
+		Cert   string
+		Key    string
 	}
 
 	// APIErr is the standard return of error.
@@ -48,6 +64,12 @@ const (
 	apiURL = "/apis/v2"
 
 	healthURL = apiURL + "/healthz"
+	drainURL  = apiURL + "/drain"
+
+	logLevelsURL = apiURL + "/loglevels"
+
+	diagnosticsRuntimeURL = apiURL + "/diagnostics/runtime"
+	diagnosticsProfileURL = apiURL + "/diagnostics/profiles/%s"
 
 	membersURL = apiURL + "/status/members"
 	memberURL  = apiURL + "/status/members/%s"
@@ -59,14 +81,49 @@ const (
 	statusObjectURL  = apiURL + "/status/objects/%s"
 	statusObjectsURL = apiURL + "/status/objects"
 
+	validateURL = apiURL + "/validate"
+	applyURL    = apiURL + "/apply"
+
+	openAPIURL = apiURL + "/openapi/%s"
+
+	revisionsURL              = apiURL + "/revisions"
+	revisionsRollbackURL      = apiURL + "/revisions/%s/rollback"
+	objectRevisionsURL        = apiURL + "/objects/%s/revisions"
+	objectRevisionURL         = apiURL + "/objects/%s/revisions/%s"
+	objectRevisionDiffURL     = apiURL + "/objects/%s/revisions/%s/diff"
+	objectRevisionRollbackURL = apiURL + "/objects/%s/revisions/%s/rollback"
+
+	auditURL = apiURL + "/audit"
+
 	wasmCodeURL = apiURL + "/wasm/code"
 	wasmDataURL = apiURL + "/wasm/data/%s/%s"
 
+	circuitBreakersURL      = apiURL + "/circuitbreakers/%s/%s"
+	circuitBreakerActionURL = apiURL + "/circuitbreakers/%s/%s/%s/%s"
+
+	retryQueueURL            = apiURL + "/retryqueues/%s/%s"
+	retryQueueRequeueURL     = apiURL + "/retryqueues/%s/%s/requeue"
+	retryQueueItemURL        = apiURL + "/retryqueues/%s/%s/items/%s"
+	retryQueueItemRequeueURL = apiURL + "/retryqueues/%s/%s/items/%s/requeue"
+
+	maintenanceFlagsURL = apiURL + "/maintenance-flags"
+	maintenanceFlagURL  = apiURL + "/maintenance-flags/%s"
+
 	customDataKindURL     = apiURL + "/customdatakinds"
 	customDataKindItemURL = apiURL + "/customdatakinds/%s"
 	customDataURL         = apiURL + "/customdata/%s"
 	customDataItemURL     = apiURL + "/customdata/%s/%s"
 
+	tlsCertsURL = apiURL + "/tlscerts"
+	tlsCertURL  = apiURL + "/tlscerts/%s"
+
+	secretsURL = apiURL + "/secrets"
+	secretURL  = apiURL + "/secrets/%s"
+
+	consumersURL     = apiURL + "/consumers"
+	consumerURL      = apiURL + "/consumers/%s"
+	consumerUsageURL = apiURL + "/consumers/%s/usage"
+
 	profileURL      = apiURL + "/profile"
 	profileStartURL = apiURL + "/profile/start/%s"
 	profileStopURL  = apiURL + "/profile/stop"
@@ -115,7 +172,45 @@ const (
 )
 
 func makeURL(urlTemplate string, a ...interface{}) string {
-	return "http://" + CommandlineGlobalFlags.Server + fmt.Sprintf(urlTemplate, a...)
+	flags := &CommandlineGlobalFlags
+	server := flags.Server
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		if flags.CACert != "" || flags.Cert != "" {
+			server = "https://" + server
+		} else {
+			server = "http://" + server
+		}
+	}
+	return server + fmt.Sprintf(urlTemplate, a...)
+}
+
+// httpClient returns the client to access the admin APIs.
+func httpClient() (*http.Client, error) {
+	flags := &CommandlineGlobalFlags
+	if flags.CACert == "" && flags.Cert == "" {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if flags.CACert != "" {
+		pem, err := os.ReadFile(flags.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", flags.CACert)
+		}
+	}
+	if flags.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(flags.Cert, flags.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}, nil
 }
 
 func successfulStatusCode(code int) bool {
@@ -123,29 +218,57 @@ func successfulStatusCode(code int) bool {
 }
 
 func handleRequest(httpMethod string, url string, yamlBody []byte, cmd *cobra.Command) {
+	body := doRequest(httpMethod, url, yamlBody, cmd)
+	if len(body) != 0 {
+		printBody(body)
+	}
+}
+
+// doRequest sends the request and returns the response body, it exits if
+// the request failed.
+func doRequest(httpMethod string, url string, yamlBody []byte, cmd *cobra.Command) []byte {
+	body, err := sendRequest(httpMethod, url, yamlBody, cmd)
+	if err != nil {
+		ExitWithError(err)
+	}
+	return body
+}
+
+// sendRequest sends the request and returns the response body.
+func sendRequest(httpMethod string, url string, yamlBody []byte, cmd *cobra.Command) ([]byte, error) {
 	var jsonBody []byte
 	if yamlBody != nil {
 		var err error
 		jsonBody, err = codectool.YAMLToJSON(yamlBody)
 		if err != nil {
-			ExitWithErrorf("yaml %s to json failed: %v", yamlBody, err)
+			return nil, fmt.Errorf("yaml %s to json failed: %v", yamlBody, err)
 		}
 	}
 
 	req, err := http.NewRequest(httpMethod, url, bytes.NewReader(jsonBody))
 	if err != nil {
-		ExitWithError(err)
+		return nil, err
+	}
+	if user := CommandlineGlobalFlags.User; user != "" {
+		username, password, _ := strings.Cut(user, ":")
+		req.SetBasicAuth(username, password)
+	} else if token := CommandlineGlobalFlags.Token; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	client, err := httpClient()
 	if err != nil {
-		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %v", cmd.Short, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		ExitWithErrorf("%s failed: %v", cmd.Short, err)
+		return nil, fmt.Errorf("%s failed: %v", cmd.Short, err)
 	}
 
 	if !successfulStatusCode(resp.StatusCode) {
@@ -155,12 +278,10 @@ func handleRequest(httpMethod string, url string, yamlBody []byte, cmd *cobra.Co
 		if err == nil {
 			msg = apiErr.Message
 		}
-		ExitWithErrorf("%d: %s", apiErr.Code, msg)
+		return nil, fmt.Errorf("%d: %s", apiErr.Code, msg)
 	}
 
-	if len(body) != 0 {
-		printBody(body)
-	}
+	return body, nil
 }
 
 func printBody(body []byte) {
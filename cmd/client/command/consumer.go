@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// ConsumerCmd defines consumer command.
+func ConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "consumer",
+		Short: "View and change API consumers",
+	}
+
+	cmd.AddCommand(listConsumerCmd())
+	cmd.AddCommand(getConsumerCmd())
+	cmd.AddCommand(applyConsumerCmd())
+	cmd.AddCommand(deleteConsumerCmd())
+	cmd.AddCommand(usageConsumerCmd())
+
+	return cmd
+}
+
+func listConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List all consumers",
+		Example: "egctl consumer list",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(consumersURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a consumer",
+		Example: "egctl consumer get <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires consumer name to be retrieved")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(consumerURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func applyConsumerCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "apply",
+		Short:   "Create or update a consumer from a yaml file or stdin",
+		Example: "egctl consumer apply -f <consumer file>",
+		Run: func(cmd *cobra.Command, args []string) {
+			visitor := buildYAMLVisitor(specFile, cmd)
+			visitor.Visit(func(yamlDoc []byte) error {
+				handleRequest(http.MethodPut, makeURL(consumersURL), yamlDoc, cmd)
+				return nil
+			})
+			visitor.Close()
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the consumer.")
+
+	return cmd
+}
+
+func deleteConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a consumer and its usage",
+		Example: "egctl consumer delete <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires consumer name to be deleted")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(consumerURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func usageConsumerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "usage",
+		Short:   "Show the usage of a consumer",
+		Example: "egctl consumer usage <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires consumer name to be retrieved")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(consumerUsageURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
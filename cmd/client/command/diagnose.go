@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type diagnoseArchive struct {
+	dir  string
+	now  time.Time
+	tw   *tar.Writer
+	errs []string
+}
+
+// DiagnoseCmd defines diagnose command.
+func DiagnoseCmd() *cobra.Command {
+	var (
+		output   string
+		seconds  int
+		profiles []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "Bundle the profiles, member status and object specs into a support archive",
+		Example: `egctl diagnose
+egctl diagnose --output diagnose.tar.gz --seconds 30 --profiles cpu,heap,goroutine,block`,
+		Run: func(cmd *cobra.Command, args []string) {
+			now := time.Now()
+			dir := "easegress-diagnose-" + now.Format("20060102-150405")
+			if output == "" {
+				output = dir + ".tar.gz"
+			}
+			if err := diagnose(cmd, output, dir, now, seconds, profiles); err != nil {
+				ExitWithError(err)
+			}
+			fmt.Printf("support archive written to %s\n", output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Path of the archive, default is easegress-diagnose-<time>.tar.gz in the current directory.")
+	cmd.Flags().IntVar(&seconds, "seconds", 10, "Seconds to capture each of the cpu, block, mutex and trace profiles.")
+	cmd.Flags().StringSliceVar(&profiles, "profiles", []string{"cpu", "heap", "goroutine"},
+		"Profiles to capture, any of cpu, heap, allocs, goroutine, threadcreate, block, mutex and trace.")
+	return cmd
+}
+
+func diagnose(cmd *cobra.Command, output, dir string, now time.Time, seconds int, profiles []string) error {
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	a := &diagnoseArchive{dir: dir, now: now, tw: tar.NewWriter(gw)}
+
+	a.addYAML(cmd, "runtime.yaml", makeURL(diagnosticsRuntimeURL))
+	a.addYAML(cmd, "members.yaml", makeURL(membersURL))
+	a.addYAML(cmd, "objects.yaml", makeURL(objectsURL))
+	a.addYAML(cmd, "status.yaml", makeURL(statusObjectsURL))
+	a.addYAML(cmd, "loglevels.yaml", makeURL(logLevelsURL))
+
+	for _, kind := range profiles {
+		name, query := kind+".pprof", url.Values{}
+		switch kind {
+		case "cpu", "block", "mutex", "trace":
+			query.Set("seconds", strconv.Itoa(seconds))
+			if kind == "trace" {
+				name = "trace.out"
+			}
+		case "goroutine":
+			// the stacks of the goroutines are read directly
+			query.Set("debug", "2")
+			name = "goroutine.txt"
+		}
+		fmt.Fprintf(os.Stderr, "capturing %s profile...\n", kind)
+		u := makeURL(diagnosticsProfileURL, kind)
+		if len(query) != 0 {
+			u += "?" + query.Encode()
+		}
+		body, err := sendRequest(http.MethodPost, u, nil, cmd)
+		a.add(path.Join("profiles", name), body, err)
+	}
+
+	if len(a.errs) != 0 {
+		a.write("errors.txt", []byte(strings.Join(a.errs, "\n")+"\n"))
+	}
+
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// addYAML adds the response of the URL to the archive in YAML.
+func (a *diagnoseArchive) addYAML(cmd *cobra.Command, name, u string) {
+	body, err := sendRequest(http.MethodGet, u, nil, cmd)
+	if err == nil {
+		body, err = codectool.JSONToYAML(body)
+	}
+	a.add(name, body, err)
+}
+
+// add adds the file to the archive, the failures are recorded in
+// errors.txt of the archive, so that a partial archive is still useful.
+func (a *diagnoseArchive) add(name string, body []byte, err error) {
+	if err != nil {
+		a.errs = append(a.errs, fmt.Sprintf("%s: %v", name, err))
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return
+	}
+	a.write(name, body)
+}
+
+func (a *diagnoseArchive) write(name string, body []byte) {
+	hdr := &tar.Header{
+		Name:    path.Join(a.dir, name),
+		Mode:    0o644,
+		Size:    int64(len(body)),
+		ModTime: a.now,
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		ExitWithErrorf("write %s failed: %v", name, err)
+	}
+	if _, err := a.tw.Write(body); err != nil {
+		ExitWithErrorf("write %s failed: %v", name, err)
+	}
+}
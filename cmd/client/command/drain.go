@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// DrainCmd defines drain command.
+func DrainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drain",
+		Short: "Drain the member serving the admin API before terminating it",
+	}
+
+	cmd.AddCommand(startDrainingCmd())
+	cmd.AddCommand(drainStatusCmd())
+	cmd.AddCommand(stopDrainingCmd())
+	return cmd
+}
+
+func startDrainingCmd() *cobra.Command {
+	var timeout string
+	cmd := &cobra.Command{
+		Use:     "start",
+		Short:   "Put the member into the draining mode",
+		Example: "egctl drain start --timeout 60s",
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(drainURL)
+			if timeout != "" {
+				u += "?" + url.Values{"timeout": []string{timeout}}.Encode()
+			}
+			handleRequest(http.MethodPost, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&timeout, "timeout", "", "Time to wait for the in-flight requests and connections, default is the drain-timeout of the member.")
+	return cmd
+}
+
+func drainStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status",
+		Short:   "Show the progress of draining",
+		Example: "egctl drain status",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(drainURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func stopDrainingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "stop",
+		Short:   "Put the member back into serving",
+		Example: "egctl drain stop",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(drainURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
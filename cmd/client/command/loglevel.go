@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// LogLevelCmd defines log level command.
+func LogLevelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "loglevel",
+		Short: "View and change the log levels of the member serving the admin API",
+	}
+
+	cmd.AddCommand(getLogLevelsCmd())
+	cmd.AddCommand(setLogLevelsCmd())
+	return cmd
+}
+
+func getLogLevelsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Show the global log level and the levels of the modules",
+		Example: "egctl loglevel get",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(logLevelsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func setLogLevelsCmd() *cobra.Command {
+	var level string
+	var modules map[string]string
+	cmd := &cobra.Command{
+		Use:     "set",
+		Short:   "Change the global log level or the levels of the modules",
+		Example: "egctl loglevel set --modules proxy=debug,cluster=",
+		Run: func(cmd *cobra.Command, args []string) {
+			if level == "" && len(modules) == 0 {
+				ExitWithErrorf("at least one of --level and --modules is required")
+			}
+			body := codectool.MustMarshalJSON(map[string]interface{}{
+				"level":   level,
+				"modules": modules,
+			})
+			handleRequest(http.MethodPut, makeURL(logLevelsURL), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&level, "level", "", "The global level, one of debug, info, warn and error.")
+	cmd.Flags().StringToStringVar(&modules, "modules", nil, "Levels of the modules, an empty level makes the module follow the global level, the modules are api, cluster, proxy, mqtt and tracing.")
+	return cmd
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// MaintenanceCmd defines maintenance command.
+func MaintenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "View and control the maintenance flags used by MaintenanceMode filters",
+	}
+
+	cmd.AddCommand(listMaintenanceFlagsCmd())
+	cmd.AddCommand(turnOnMaintenanceFlagCmd())
+	cmd.AddCommand(turnOffMaintenanceFlagCmd())
+	return cmd
+}
+
+func listMaintenanceFlagsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the maintenance flags which are turned on",
+		Example: "egctl maintenance list",
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(maintenanceFlagsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func turnOnMaintenanceFlagCmd() *cobra.Command {
+	var reason string
+	cmd := &cobra.Command{
+		Use:     "on",
+		Short:   "Turn on a maintenance flag in all members",
+		Example: "egctl maintenance on <flag> --reason 'database upgrade'",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return nil
+			}
+			return fmt.Errorf("requires flag name")
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			body := codectool.MustMarshalJSON(map[string]string{"reason": reason})
+			handleRequest(http.MethodPut, makeURL(maintenanceFlagURL, args[0]), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&reason, "reason", "r", "", "The reason of the maintenance.")
+	return cmd
+}
+
+func turnOffMaintenanceFlagCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "off",
+		Short:   "Turn off a maintenance flag in all members",
+		Example: "egctl maintenance off <flag>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return nil
+			}
+			return fmt.Errorf("requires flag name")
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(maintenanceFlagURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -18,10 +18,13 @@
 package command
 
 import (
+	"bytes"
 	"errors"
 	"net/http"
 
 	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
 // ObjectCmd defines object command.
@@ -37,8 +40,10 @@ func ObjectCmd() *cobra.Command {
 	cmd.AddCommand(getObjectCmd())
 	cmd.AddCommand(createObjectCmd())
 	cmd.AddCommand(updateObjectCmd())
+	cmd.AddCommand(applyObjectsCmd())
 	cmd.AddCommand(deleteObjectCmd())
 	cmd.AddCommand(statusObjectCmd())
+	cmd.AddCommand(historyCmd())
 
 	return cmd
 }
@@ -57,13 +62,18 @@ func objectKindsCmd() *cobra.Command {
 
 func createObjectCmd() *cobra.Command {
 	var specFile string
+	var validateOnly bool
 	cmd := &cobra.Command{
 		Use:   "create",
 		Short: "Create an object from a yaml file or stdin",
 		Run: func(cmd *cobra.Command, args []string) {
 			visitor := buildSpecVisitor(specFile, cmd)
 			visitor.Visit(func(s *spec) error {
-				handleRequest(http.MethodPost, makeURL(objectsURL), []byte(s.doc), cmd)
+				if validateOnly {
+					handleRequest(http.MethodPost, makeURL(validateURL), []byte(s.doc), cmd)
+				} else {
+					handleRequest(http.MethodPost, makeURL(objectsURL), []byte(s.doc), cmd)
+				}
 				return nil
 			})
 			visitor.Close()
@@ -71,19 +81,25 @@ func createObjectCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the object.")
+	cmd.Flags().BoolVar(&validateOnly, "validate-only", false, "Validate the object, including the references to other objects, without creating it.")
 
 	return cmd
 }
 
 func updateObjectCmd() *cobra.Command {
 	var specFile string
+	var validateOnly bool
 	cmd := &cobra.Command{
 		Use:   "update",
 		Short: "Update an object from a yaml file or stdin",
 		Run: func(cmd *cobra.Command, args []string) {
 			visitor := buildSpecVisitor(specFile, cmd)
 			visitor.Visit(func(s *spec) error {
-				handleRequest(http.MethodPut, makeURL(objectURL, s.Name), []byte(s.doc), cmd)
+				if validateOnly {
+					handleRequest(http.MethodPost, makeURL(validateURL), []byte(s.doc), cmd)
+				} else {
+					handleRequest(http.MethodPut, makeURL(objectURL, s.Name), []byte(s.doc), cmd)
+				}
 				return nil
 			})
 			visitor.Close()
@@ -91,6 +107,36 @@ func updateObjectCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the object.")
+	cmd.Flags().BoolVar(&validateOnly, "validate-only", false, "Validate the object, including the references to other objects, without updating it.")
+
+	return cmd
+}
+
+func applyObjectsCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create or update all objects in a yaml file or stdin in one transaction",
+		Run: func(cmd *cobra.Command, args []string) {
+			var docs [][]byte
+			visitor := buildSpecVisitor(specFile, cmd)
+			visitor.Visit(func(s *spec) error {
+				doc, err := codectool.YAMLToJSON([]byte(s.doc))
+				if err != nil {
+					ExitWithErrorf("yaml %s to json failed: %v", s.doc, err)
+				}
+				docs = append(docs, doc)
+				return nil
+			})
+			visitor.Close()
+
+			body := append([]byte{'['}, bytes.Join(docs, []byte{','})...)
+			body = append(body, ']')
+			handleRequest(http.MethodPost, makeURL(applyURL), body, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the objects.")
 
 	return cmd
 }
@@ -196,3 +242,120 @@ func listStatusObjectsCmd() *cobra.Command {
 
 	return cmd
 }
+
+func historyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "View the revisions of objects and roll them back",
+	}
+
+	cmd.AddCommand(listRevisionsCmd())
+	cmd.AddCommand(getRevisionCmd())
+	cmd.AddCommand(diffRevisionCmd())
+	cmd.AddCommand(rollbackCmd())
+
+	return cmd
+}
+
+func listRevisionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the revisions of an object, or all objects if no name specified",
+		Example: "egctl object history list [<object_name>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return errors.New("requires at most one object name")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				handleRequest(http.MethodGet, makeURL(revisionsURL), nil, cmd)
+			} else {
+				handleRequest(http.MethodGet, makeURL(objectRevisionsURL, args[0]), nil, cmd)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func getRevisionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a revision of an object",
+		Example: "egctl object history get <object_name> <version>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return errors.New("requires object name and version")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(objectRevisionURL, args[0], args[1]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func diffRevisionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "diff",
+		Short:   "Show the difference of an object between two versions, the second one is the current version by default",
+		Example: "egctl object history diff <object_name> <version> [<to_version>]",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 && len(args) != 3 {
+				return errors.New("requires object name and one or two versions")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			url := makeURL(objectRevisionDiffURL, args[0], args[1])
+			if len(args) == 3 {
+				url += "?to=" + args[2]
+			}
+			handleRequest(http.MethodGet, url, nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func rollbackCmd() *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back an object, or all objects with --all, to a version",
+		Example: `egctl object history rollback <object_name> <version>
+egctl object history rollback --all <version>`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all && len(args) != 1 {
+				return errors.New("requires version")
+			}
+			if !all && len(args) != 2 {
+				return errors.New("requires object name and version")
+			}
+
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if all {
+				handleRequest(http.MethodPost, makeURL(revisionsRollbackURL, args[0]), nil, cmd)
+			} else {
+				handleRequest(http.MethodPost, makeURL(objectRevisionRollbackURL, args[0], args[1]), nil, cmd)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Roll back all objects having revisions.")
+
+	return cmd
+}
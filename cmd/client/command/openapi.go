@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// OpenAPICmd defines openapi command.
+func OpenAPICmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "openapi",
+		Short: "Generate the routes and validating pipelines of OpenAPI 3 documents",
+	}
+
+	cmd.AddCommand(applyOpenAPICmd())
+	return cmd
+}
+
+func applyOpenAPICmd() *cobra.Command {
+	var (
+		specFile string
+		port     uint16
+		servers  []string
+		dryRun   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "apply <name>",
+		Short: "Create or update the HTTPServer and the pipelines of an OpenAPI 3 document",
+		Example: `  # Route the operations of petstore.yaml on port 8080 to the servers of the document.
+  egctl openapi apply petstore -f petstore.yaml --port 8080
+
+  # Show the generated objects with the upstream server specified.
+  egctl openapi apply petstore -f petstore.yaml --port 8080 --server http://127.0.0.1:9095 --dry-run`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if specFile == "" {
+				ExitWithErrorf("--file is required")
+			}
+			doc, err := os.ReadFile(specFile)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			query := url.Values{}
+			query.Set("port", strconv.Itoa(int(port)))
+			query["server"] = servers
+			if dryRun {
+				query.Set("dryRun", "true")
+			}
+			handleRequest(http.MethodPost, makeURL(openAPIURL, args[0])+"?"+query.Encode(), doc, cmd)
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "The OpenAPI 3 document in yaml or json.")
+	cmd.Flags().Uint16Var(&port, "port", 0, "The port of the HTTPServer.")
+	cmd.Flags().StringArrayVar(&servers, "server", nil, "The URL of an upstream server, could be repeated, the servers of the document are used by default.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the generated objects without applying them.")
+	return cmd
+}
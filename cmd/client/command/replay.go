@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/logger"
+	_ "github.com/megaease/easegress/pkg/registry"
+	"github.com/megaease/easegress/pkg/tryout"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// ReplayCmd defines replay command.
+func ReplayCmd() *cobra.Command {
+	var (
+		harFile        string
+		target         string
+		specFile       string
+		host           string
+		rate           float64
+		concurrency    int
+		timeout        time.Duration
+		compareHeaders []string
+		ignoreBody     bool
+		ignoreFields   []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay the requests of a HAR file and compare the responses",
+		Example: `  # Replay the captured traffic against a new backend at 10 requests per second.
+  egctl replay --har capture.har --target http://10.0.0.2:8080 --rate 10
+
+  # Replay the captured traffic with a modified pipeline locally.
+  egctl replay --har capture.har -f pipeline.yaml --ignore-field data.updatedAt`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.InitNop()
+
+			har, err := os.ReadFile(harFile)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			opt := &tryout.ReplayOptions{
+				Target:         target,
+				Host:           host,
+				Rate:           rate,
+				Concurrency:    concurrency,
+				Timeout:        timeout,
+				CompareHeaders: compareHeaders,
+				IgnoreBody:     ignoreBody,
+				IgnoreFields:   ignoreFields,
+			}
+			if specFile != "" {
+				if opt.Pipeline, err = os.ReadFile(specFile); err != nil {
+					ExitWithErrorf("%s failed: %v", cmd.Short, err)
+				}
+			}
+
+			report, err := tryout.Replay(har, opt)
+			if err != nil {
+				ExitWithError(err)
+			}
+			printBody(codectool.MustMarshalJSON(report))
+
+			if report.Mismatched > 0 || report.Failed > 0 {
+				ExitWithError(fmt.Errorf("%d mismatched, %d failed", report.Mismatched, report.Failed))
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&harFile, "har", "", "The HAR file of the requests and recorded responses.")
+	cmd.Flags().StringVar(&target, "target", "", "The base URL to send the requests to, e.g. an HTTP server or an alternate backend.")
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying a pipeline to run the requests locally, instead of a target.")
+	cmd.Flags().StringVar(&host, "host", "", "Override the Host of the requests, the recorded Host is kept by default.")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "The number of requests sent per second, 0 means no limit.")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 1, "The maximum number of requests in flight.")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second, "The timeout of a request sent to the target.")
+	cmd.Flags().StringArrayVar(&compareHeaders, "compare-header", nil, "The name of a response header to compare, could be repeated.")
+	cmd.Flags().BoolVar(&ignoreBody, "ignore-body", false, "Do not compare the response bodies.")
+	cmd.Flags().StringArrayVar(&ignoreFields, "ignore-field", nil, "A field of JSON bodies not to compare, like 'data.updatedAt' or 'items[*].id', could be repeated.")
+	cmd.MarkFlagRequired("har")
+
+	return cmd
+}
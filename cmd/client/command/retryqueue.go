@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/cobra"
+)
+
+// RetryQueueCmd defines retry queue command.
+func RetryQueueCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retry-queue",
+		Short: "View and manage the queued requests of RetryQueue filters",
+	}
+
+	cmd.AddCommand(listRetryQueueCmd())
+	cmd.AddCommand(getRetryQueueItemCmd())
+	cmd.AddCommand(requeueRetryQueueCmd())
+	cmd.AddCommand(deleteRetryQueueItemCmd())
+	return cmd
+}
+
+func retryQueueArgs(n int, msg string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) == n {
+			return nil
+		}
+		return fmt.Errorf("requires %s", msg)
+	}
+}
+
+func listRetryQueueCmd() *cobra.Command {
+	var state string
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the items of a RetryQueue filter",
+		Example: "egctl retry-queue list <pipeline> <filter> [--state dead]",
+		Args:    retryQueueArgs(2, "pipeline and filter name"),
+
+		Run: func(cmd *cobra.Command, args []string) {
+			u := makeURL(retryQueueURL, args[0], args[1])
+			if state != "" {
+				u += "?state=" + url.QueryEscape(state)
+			}
+			handleRequest(http.MethodGet, u, nil, cmd)
+		},
+	}
+
+	cmd.Flags().StringVar(&state, "state", "", "List the items of the state only, pending or dead.")
+	return cmd
+}
+
+func getRetryQueueItemCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get an item of a RetryQueue filter",
+		Example: "egctl retry-queue get <pipeline> <filter> <id>",
+		Args:    retryQueueArgs(3, "pipeline, filter name and item id"),
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(retryQueueItemURL, args[0], args[1], args[2]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func requeueRetryQueueCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "requeue",
+		Short: "Requeue an item, or all the dead items if no id is given, of a RetryQueue filter",
+		Example: `egctl retry-queue requeue <pipeline> <filter>
+egctl retry-queue requeue <pipeline> <filter> <id>`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 2 || len(args) == 3 {
+				return nil
+			}
+			return fmt.Errorf("requires pipeline, filter name and optional item id")
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 3 {
+				handleRequest(http.MethodPost, makeURL(retryQueueItemRequeueURL, args[0], args[1], args[2]), nil, cmd)
+				return
+			}
+			handleRequest(http.MethodPost, makeURL(retryQueueRequeueURL, args[0], args[1]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func deleteRetryQueueItemCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete an item of a RetryQueue filter",
+		Example: "egctl retry-queue delete <pipeline> <filter> <id>",
+		Args:    retryQueueArgs(3, "pipeline, filter name and item id"),
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(retryQueueItemURL, args[0], args[1], args[2]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
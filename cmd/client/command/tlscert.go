@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+// TLSCertCmd defines TLS certificate command.
+func TLSCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tls-cert",
+		Short: "View and change TLS certificates stored in the cluster",
+	}
+
+	cmd.AddCommand(listTLSCertCmd())
+	cmd.AddCommand(getTLSCertCmd())
+	cmd.AddCommand(applyTLSCertCmd())
+	cmd.AddCommand(deleteTLSCertCmd())
+
+	return cmd
+}
+
+func listTLSCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List all TLS certificates",
+		Example: "egctl tls-cert list",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(tlsCertsURL), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func getTLSCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get a TLS certificate",
+		Example: "egctl tls-cert get <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires TLS certificate name to be retrieved")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodGet, makeURL(tlsCertURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
+
+func applyTLSCertCmd() *cobra.Command {
+	var specFile string
+	cmd := &cobra.Command{
+		Use:     "apply",
+		Short:   "Create or update a TLS certificate from a yaml file or stdin",
+		Example: "egctl tls-cert apply -f <certificate file>",
+		Run: func(cmd *cobra.Command, args []string) {
+			visitor := buildYAMLVisitor(specFile, cmd)
+			visitor.Visit(func(yamlDoc []byte) error {
+				handleRequest(http.MethodPut, makeURL(tlsCertsURL), yamlDoc, cmd)
+				return nil
+			})
+			visitor.Close()
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the certificate.")
+
+	return cmd
+}
+
+func deleteTLSCertCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete",
+		Short:   "Delete a TLS certificate",
+		Example: "egctl tls-cert delete <name>",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires TLS certificate name to be deleted")
+			}
+			return nil
+		},
+
+		Run: func(cmd *cobra.Command, args []string) {
+			handleRequest(http.MethodDelete, makeURL(tlsCertURL, args[0]), nil, cmd)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// topStat is the part of the HTTP statistics shown by top.
+	topStat struct {
+		M1    *float64 `json:"m1"`
+		M1Err float64  `json:"m1Err"`
+		P99   float64  `json:"p99"`
+	}
+
+	topObjectStatus struct {
+		Status struct {
+			topStat
+			State   string                     `json:"state"`
+			Error   string                     `json:"error"`
+			Filters map[string]json.RawMessage `json:"filters"`
+		} `json:"status"`
+	}
+
+	topProxyStatus struct {
+		MainPool       *topPoolStatus   `json:"mainPool"`
+		CandidatePools []*topPoolStatus `json:"candidatePools"`
+		MirrorPool     *topPoolStatus   `json:"mirrorPool"`
+	}
+
+	topPoolStatus struct {
+		Stat           *topStat `json:"stat"`
+		EjectedServers []struct {
+			URL string `json:"url"`
+		} `json:"ejectedServers"`
+	}
+
+	// topRow is a row of the top view, aggregated from all members.
+	topRow struct {
+		name    string
+		members int
+		rps     float64
+		errRPS  float64
+		p99     float64
+		state   string
+		ejected map[string]bool
+	}
+
+	topView struct {
+		servers  map[string]*topRow
+		backends map[string]*topRow
+	}
+)
+
+// TopCmd defines top command.
+func TopCmd() *cobra.Command {
+	var interval time.Duration
+	var once bool
+
+	cmd := &cobra.Command{
+		Use:   "top",
+		Short: "Display live traffic statistics of HTTP servers and backends",
+		Long: `Display live traffic statistics of HTTP servers and backends.
+
+The statistics are aggregated from all members: RPS is the one-minute rate of
+requests, ERR% is the percentage of failed requests in it, and P99 is the
+largest 99th percentile latency of the members. The backends are the server
+pools of the Proxy filters of pipelines, and HEALTH lists the servers ejected
+by the outlier detection.`,
+		Example: "egctl top --interval 5s",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			for {
+				body := doRequest(http.MethodGet, makeURL(statusObjectsURL), nil, cmd)
+				view := newTopView(body)
+				if !once {
+					// move the cursor to the top left and clear the screen.
+					fmt.Print("\033[H\033[2J")
+				}
+				fmt.Printf("egctl top - %s, refreshed every %s\n\n", time.Now().Format(time.RFC3339), interval)
+				view.render(os.Stdout)
+				if once {
+					return
+				}
+				time.Sleep(interval)
+			}
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "The interval to refresh the statistics.")
+	cmd.Flags().BoolVar(&once, "once", false, "Print the statistics once and exit.")
+
+	return cmd
+}
+
+func newTopView(body []byte) *topView {
+	statuses := map[string]*topObjectStatus{}
+	if err := codectool.UnmarshalJSON(body, &statuses); err != nil {
+		ExitWithErrorf("unmarshal status failed: %v", err)
+	}
+
+	v := &topView{servers: map[string]*topRow{}, backends: map[string]*topRow{}}
+	for key, s := range statuses {
+		// the key is namespace/name/member.
+		fields := strings.Split(key, "/")
+		if len(fields) != 3 {
+			continue
+		}
+		name := fields[1]
+		if ns := strings.TrimPrefix(fields[0], cluster.NamespacetrafficPrefix); ns != cluster.NamespaceDefault {
+			name = ns + "/" + name
+		}
+
+		switch {
+		case s.Status.Filters != nil:
+			v.addPipeline(name, s.Status.Filters)
+		case s.Status.M1 != nil:
+			row := v.row(v.servers, name)
+			row.add(&s.Status.topStat)
+			if row.state == "" || s.Status.State != "running" {
+				row.state = s.Status.State
+			}
+		}
+	}
+	return v
+}
+
+func (v *topView) row(rows map[string]*topRow, name string) *topRow {
+	row := rows[name]
+	if row == nil {
+		row = &topRow{name: name, ejected: map[string]bool{}}
+		rows[name] = row
+	}
+	return row
+}
+
+func (v *topView) addPipeline(name string, filters map[string]json.RawMessage) {
+	for filter, raw := range filters {
+		ps := &topProxyStatus{}
+		// ignore the filters other than Proxy.
+		if codectool.UnmarshalJSON(raw, ps) != nil || ps.MainPool == nil {
+			continue
+		}
+
+		prefix := name + "/" + filter + "/"
+		v.addPool(prefix+"main", ps.MainPool)
+		for i, pool := range ps.CandidatePools {
+			v.addPool(fmt.Sprintf("%scandidate-%d", prefix, i), pool)
+		}
+		if ps.MirrorPool != nil {
+			v.addPool(prefix+"mirror", ps.MirrorPool)
+		}
+	}
+}
+
+func (v *topView) addPool(name string, pool *topPoolStatus) {
+	if pool == nil || pool.Stat == nil {
+		return
+	}
+	row := v.row(v.backends, name)
+	row.add(pool.Stat)
+	for _, s := range pool.EjectedServers {
+		row.ejected[s.URL] = true
+	}
+}
+
+func (r *topRow) add(s *topStat) {
+	r.members++
+	if s.M1 != nil {
+		r.rps += *s.M1
+	}
+	r.errRPS += s.M1Err
+	if s.P99 > r.p99 {
+		r.p99 = s.P99
+	}
+}
+
+func (r *topRow) errPercent() float64 {
+	if r.rps == 0 {
+		return 0
+	}
+	return r.errRPS / r.rps * 100
+}
+
+func (r *topRow) health() string {
+	if len(r.ejected) == 0 {
+		return "ok"
+	}
+	urls := make([]string, 0, len(r.ejected))
+	for url := range r.ejected {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return "ejected: " + strings.Join(urls, ",")
+}
+
+// sortTopRows sorts the rows by RPS in descending order.
+func sortTopRows(rows map[string]*topRow) []*topRow {
+	result := make([]*topRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].rps != result[j].rps {
+			return result[i].rps > result[j].rps
+		}
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+func (v *topView) render(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SERVER\tMEMBERS\tSTATE\tRPS\tERR%\tP99(ms)")
+	for _, row := range sortTopRows(v.servers) {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.2f\t%.2f\t%.0f\n",
+			row.name, row.members, row.state, row.rps, row.errPercent(), row.p99)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "BACKEND\tMEMBERS\tHEALTH\tRPS\tERR%\tP99(ms)")
+	for _, row := range sortTopRows(v.backends) {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.2f\t%.2f\t%.0f\n",
+			row.name, row.members, row.health(), row.rps, row.errPercent(), row.p99)
+	}
+
+	tw.Flush()
+}
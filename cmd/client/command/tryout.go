@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/megaease/easegress/pkg/logger"
+	_ "github.com/megaease/easegress/pkg/registry"
+	"github.com/megaease/easegress/pkg/tryout"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// TryoutCmd defines tryout command.
+func TryoutCmd() *cobra.Command {
+	var (
+		specFile   string
+		method     string
+		url        string
+		headers    []string
+		data       string
+		dataFile   string
+		harFile    string
+		harEntry   int
+		mock       bool
+		mockStatus int
+		mockHeader []string
+		mockBody   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "tryout",
+		Short: "Run a pipeline locally with a sample request",
+		Example: `  # Run a pipeline with a GET request against the real backends.
+  egctl tryout -f pipeline.yaml --url http://localhost/users -H "X-Foo: bar"
+
+  # Run a pipeline with the first request of a HAR file against a mock backend.
+  egctl tryout -f pipeline.yaml --har requests.har --mock --mock-body '{"id": 1}'`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger.InitNop()
+
+			config, err := os.ReadFile(specFile)
+			if err != nil {
+				ExitWithErrorf("%s failed: %v", cmd.Short, err)
+			}
+
+			var req *http.Request
+			if harFile != "" {
+				har, err := os.ReadFile(harFile)
+				if err != nil {
+					ExitWithErrorf("%s failed: %v", cmd.Short, err)
+				}
+				if req, err = tryout.ReadHAR(har, harEntry); err != nil {
+					ExitWithError(err)
+				}
+			} else {
+				body := []byte(data)
+				if dataFile != "" {
+					if body, err = os.ReadFile(dataFile); err != nil {
+						ExitWithErrorf("%s failed: %v", cmd.Short, err)
+					}
+				}
+				if req, err = http.NewRequest(method, url, bytes.NewReader(body)); err != nil {
+					ExitWithError(err)
+				}
+				req.Header = parseHeaders(headers)
+			}
+			if req.RemoteAddr == "" {
+				req.RemoteAddr = "127.0.0.1:0"
+			}
+
+			opt := &tryout.Options{}
+			if mock {
+				opt.Mock = &tryout.MockBackend{
+					StatusCode: mockStatus,
+					Header:     parseHeaders(mockHeader),
+					Body:       []byte(mockBody),
+				}
+			}
+
+			report, err := tryout.Run(config, req, opt)
+			if err != nil {
+				ExitWithError(err)
+			}
+			printBody(codectool.MustMarshalJSON(report))
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "A yaml file specifying the pipeline.")
+	cmd.Flags().StringVar(&method, "method", http.MethodGet, "The method of the request.")
+	cmd.Flags().StringVar(&url, "url", "http://localhost/", "The URL of the request.")
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "A header of the request in the format of 'Name: Value', could be repeated.")
+	cmd.Flags().StringVarP(&data, "data", "d", "", "The body of the request.")
+	cmd.Flags().StringVar(&dataFile, "data-file", "", "A file containing the body of the request.")
+	cmd.Flags().StringVar(&harFile, "har", "", "A HAR file to read the request from, instead of the request flags.")
+	cmd.Flags().IntVar(&harEntry, "har-entry", 0, "The index of the entry in the HAR file.")
+	cmd.Flags().BoolVar(&mock, "mock", false, "Send the requests of the Proxy filters to a local mock backend instead of the real backends.")
+	cmd.Flags().IntVar(&mockStatus, "mock-status", http.StatusOK, "The status code of the responses of the mock backend.")
+	cmd.Flags().StringArrayVar(&mockHeader, "mock-header", nil, "A header of the responses of the mock backend in the format of 'Name: Value', could be repeated.")
+	cmd.Flags().StringVar(&mockBody, "mock-body", "", "The body of the responses of the mock backend.")
+	cmd.MarkFlagRequired("file")
+
+	return cmd
+}
+
+// parseHeaders parses the headers in the format of 'Name: Value'.
+func parseHeaders(headers []string) http.Header {
+	h := http.Header{}
+	for _, header := range headers {
+		kv := strings.SplitN(header, ":", 2)
+		if len(kv) != 2 {
+			ExitWithError(fmt.Errorf("invalid header %q, expecting 'Name: Value'", header))
+		}
+		h.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	return h
+}
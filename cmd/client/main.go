@@ -70,6 +70,12 @@ var exampleUsage = `  # List APIs.
 
   # Get object status
   egctl object status get <object_name>
+
+  # Display live traffic statistics.
+  egctl top
+
+  # Run a pipeline locally with a sample request.
+  egctl tryout -f <pipeline_spec.yaml> --url http://localhost/path --mock
 `
 
 func main() {
@@ -107,12 +113,26 @@ func main() {
 	rootCmd.AddCommand(
 		command.APICmd(),
 		command.HealthCmd(),
+		command.DrainCmd(),
+		command.LogLevelCmd(),
+		command.DiagnoseCmd(),
 		command.ObjectCmd(),
+		command.OpenAPICmd(),
+		command.AuditCmd(),
 		command.MemberCmd(),
 		command.WasmCmd(),
+		command.CircuitBreakerCmd(),
+		command.RetryQueueCmd(),
+		command.MaintenanceCmd(),
 		command.CustomDataKindCmd(),
 		command.CustomDataCmd(),
+		command.TLSCertCmd(),
+		command.SecretCmd(),
+		command.ConsumerCmd(),
 		command.ProfileCmd(),
+		command.TryoutCmd(),
+		command.ReplayCmd(),
+		command.TopCmd(),
 		completionCmd,
 	)
 
@@ -120,6 +140,16 @@ func main() {
 		"server", "localhost:2381", "The address of the Easegress endpoint")
 	rootCmd.PersistentFlags().StringVarP(&command.CommandlineGlobalFlags.OutputFormat,
 		"output", "o", "yaml", "Output format(json, yaml)")
+	rootCmd.PersistentFlags().StringVarP(&command.CommandlineGlobalFlags.User,
+		"user", "u", "", "The username and password of the admin APIs, in the format of username:password")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Token,
+		"token", "", "The bearer token of the admin APIs, a static token or an OIDC ID token")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.CACert,
+		"cacert", "", "The CA certificate file to verify the server, the server is accessed over TLS if set")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Cert,
+		"cert", "", "The client certificate file, the server is accessed over TLS if set")
+	rootCmd.PersistentFlags().StringVar(&command.CommandlineGlobalFlags.Key,
+		"key", "", "The private key file of the client certificate")
 
 	err := rootCmd.Execute()
 	if err != nil {
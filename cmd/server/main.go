@@ -26,6 +26,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/api"
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/secret"
 	"github.com/megaease/easegress/pkg/common"
 	"github.com/megaease/easegress/pkg/env"
 	"github.com/megaease/easegress/pkg/graceupdate"
@@ -78,6 +79,11 @@ func main() {
 		return
 	}
 
+	if opt.DrainTimeout != "" {
+		drainTimeout, _ := time.ParseDuration(opt.DrainTimeout)
+		graceupdate.SetDrainTimeout(drainTimeout)
+	}
+
 	// disable force-new-cluster for graceful update
 	if graceupdate.IsInherit() {
 		opt.ForceNewCluster = false
@@ -100,6 +106,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the secret store must be ready before creating the objects, whose
+	// specs may reference the secrets.
+	secretStore, err := secret.NewStore(cls, opt.SecretMasterKey)
+	if err != nil {
+		logger.Errorf("new secret store failed: %v", err)
+		os.Exit(1)
+	}
+	secret.SetGlobalStore(secretStore)
+
 	super := supervisor.MustNew(opt, cls)
 
 	apiServer := api.MustNewServer(opt, cls, super, profile)
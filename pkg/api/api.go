@@ -68,11 +68,11 @@ func RegisterAPIs(apiGroup *Group) {
 
 	_, exists := apis[apiGroup.Group]
 	if exists {
-		logger.Errorf("group %s existed", apiGroup.Group)
+		logger.API.Errorf("group %s existed", apiGroup.Group)
 	}
 	apis[apiGroup.Group] = apiGroup
 
-	logger.Infof("register api group %s", apiGroup.Group)
+	logger.API.Infof("register api group %s", apiGroup.Group)
 	apisChangeChan <- struct{}{}
 }
 
@@ -83,13 +83,13 @@ func UnregisterAPIs(group string) {
 
 	_, exists := apis[group]
 	if !exists {
-		logger.Errorf("group %s not found", group)
+		logger.API.Errorf("group %s not found", group)
 		return
 	}
 
 	delete(apis, group)
 
-	logger.Infof("unregister api group %s", group)
+	logger.API.Infof("unregister api group %s", group)
 	apisChangeChan <- struct{}{}
 }
 
@@ -100,11 +100,24 @@ func (s *Server) registerAPIs() {
 	group.Entries = append(group.Entries, s.listAPIEntries()...)
 	group.Entries = append(group.Entries, s.memberAPIEntries()...)
 	group.Entries = append(group.Entries, s.objectAPIEntries()...)
+	group.Entries = append(group.Entries, s.namespaceAPIEntries()...)
 	group.Entries = append(group.Entries, s.metadataAPIEntries()...)
 	group.Entries = append(group.Entries, s.healthAPIEntries()...)
+	group.Entries = append(group.Entries, s.drainAPIEntries()...)
+	group.Entries = append(group.Entries, s.logLevelsAPIEntries()...)
+	group.Entries = append(group.Entries, s.diagnosticsAPIEntries()...)
 	group.Entries = append(group.Entries, s.aboutAPIEntries()...)
 	group.Entries = append(group.Entries, s.customDataAPIEntries()...)
+	group.Entries = append(group.Entries, s.tlsCertAPIEntries()...)
+	group.Entries = append(group.Entries, s.secretAPIEntries()...)
+	group.Entries = append(group.Entries, s.consumerAPIEntries()...)
 	group.Entries = append(group.Entries, s.profileAPIEntries()...)
+	group.Entries = append(group.Entries, s.metricsAPIEntries()...)
+	group.Entries = append(group.Entries, s.validateAPIEntries()...)
+	group.Entries = append(group.Entries, s.revisionAPIEntries()...)
+	group.Entries = append(group.Entries, s.auditAPIEntries()...)
+	group.Entries = append(group.Entries, s.applyAPIEntries()...)
+	group.Entries = append(group.Entries, s.openAPIAPIEntries()...)
 
 	for _, fn := range appendAddonAPIs {
 		fn(s, group)
@@ -123,17 +136,6 @@ func (s *Server) listAPIEntries() []*Entry {
 	}
 }
 
-func (s *Server) healthAPIEntries() []*Entry {
-	return []*Entry{
-		{
-			// https://stackoverflow.com/a/43381061/1705845
-			Path:    "/healthz",
-			Method:  "GET",
-			Handler: func(w http.ResponseWriter, r *http.Request) { /* 200 by default */ },
-		},
-	}
-}
-
 func (s *Server) aboutAPIEntries() []*Entry {
 	return []*Entry{
 		{
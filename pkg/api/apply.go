@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// ApplyPath is the URL of the batch apply API.
+const ApplyPath = "/apply"
+
+const (
+	applyActionCreated   = "created"
+	applyActionUpdated   = "updated"
+	applyActionUnchanged = "unchanged"
+	applyActionDeleted   = "deleted"
+)
+
+type (
+	// ApplyResponse is the response of the batch apply API, the objects are
+	// in the dependency order, and the version is 0 if nothing changed.
+	ApplyResponse struct {
+		Version int64          `json:"version"`
+		Objects []*ApplyResult `json:"objects"`
+	}
+
+	// ApplyResult is the result of applying an object.
+	ApplyResult struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind"`
+		Action string `json:"action"`
+	}
+)
+
+func (s *Server) applyAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ApplyPath,
+			Method:  http.MethodPost,
+			Handler: s.applyObjects,
+		},
+	}
+}
+
+// readObjectSpecs reads a list of object specs.
+func (s *Server) readObjectSpecs(r *http.Request) ([]*supervisor.Spec, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	var docs []map[string]interface{}
+	if err := codectool.Unmarshal(body, &docs); err != nil {
+		return nil, fmt.Errorf("unmarshal body to a list of objects failed: %v", err)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no objects")
+	}
+	return s.newObjectSpecs(docs)
+}
+
+// newObjectSpecs creates the specs of a list of objects.
+func (s *Server) newObjectSpecs(docs []map[string]interface{}) ([]*supervisor.Spec, error) {
+	var errs []string
+	specs := make([]*supervisor.Spec, 0, len(docs))
+	names := make(map[string]bool)
+	for i, doc := range docs {
+		spec, err := s.super.NewSpec(string(codectool.MustMarshalJSON(doc)))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("object %d: %v", i, err))
+			continue
+		}
+		if names[spec.Name()] {
+			errs = append(errs, fmt.Sprintf("duplicated object name: %s", spec.Name()))
+			continue
+		}
+		names[spec.Name()] = true
+		specs = append(specs, spec)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return specs, nil
+}
+
+// sortByDependencies sorts the specs so that the objects referenced by an
+// object are before it, only the references between the specs are
+// considered.
+func sortByDependencies(specs []*supervisor.Spec) ([]*supervisor.Spec, error) {
+	byName := make(map[string]*supervisor.Spec, len(specs))
+	for _, spec := range specs {
+		byName[spec.Name()] = spec
+	}
+
+	// dependents maps an object to the objects referencing it.
+	dependents := make(map[string][]string)
+	inDegree := make(map[string]int)
+	for _, spec := range specs {
+		deps := make(map[string]bool)
+		for _, ref := range spec.References() {
+			if _, ok := byName[ref.Name]; !ok || deps[ref.Name] || ref.Name == spec.Name() {
+				continue
+			}
+			deps[ref.Name] = true
+			dependents[ref.Name] = append(dependents[ref.Name], spec.Name())
+			inDegree[spec.Name()]++
+		}
+	}
+
+	// Kahn's algorithm, the ready objects are sorted by names so that the
+	// result is stable.
+	var ready []string
+	for _, spec := range specs {
+		if inDegree[spec.Name()] == 0 {
+			ready = append(ready, spec.Name())
+		}
+	}
+	sort.Strings(ready)
+
+	sorted := make([]*supervisor.Spec, 0, len(specs))
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, byName[name])
+
+		var next []string
+		for _, d := range dependents[name] {
+			inDegree[d]--
+			if inDegree[d] == 0 {
+				next = append(next, d)
+			}
+		}
+		ready = append(ready, next...)
+		sort.Strings(ready)
+	}
+
+	if len(sorted) != len(specs) {
+		var cyclic []string
+		for _, spec := range specs {
+			if inDegree[spec.Name()] > 0 {
+				cyclic = append(cyclic, spec.Name())
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("cyclic references among objects: %s", strings.Join(cyclic, ", "))
+	}
+	return sorted, nil
+}
+
+// applyObjects creates or updates a list of objects in one transaction. All
+// the objects are validated first, including the references to each other
+// and the existing objects, and nothing is persisted if any of them fails.
+func (s *Server) applyObjects(w http.ResponseWriter, r *http.Request) {
+	specs, err := s.readObjectSpecs(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	s.applySpecs(w, r, specs, nil)
+}
+
+// applySpecs creates or updates the objects of the specs, and deletes the
+// objects returned by deletes in the same transaction. deletes is called
+// with the cluster lock held, and it could be nil.
+func (s *Server) applySpecs(w http.ResponseWriter, r *http.Request, specs []*supervisor.Spec, deletes func() []string) {
+	specs, err := sortByDependencies(specs)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	byName := make(map[string]*supervisor.Spec, len(specs))
+	for _, spec := range specs {
+		byName[spec.Name()] = spec
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	getObject := func(name string) *supervisor.Spec {
+		if spec, ok := byName[name]; ok {
+			return spec
+		}
+		return s._getObject(name)
+	}
+
+	var errs []string
+	var puts []*supervisor.Spec
+	resp := &ApplyResponse{}
+	for _, spec := range specs {
+		result := &ApplyResult{Name: spec.Name(), Kind: spec.Kind(), Action: applyActionCreated}
+		resp.Objects = append(resp.Objects, result)
+
+		if err := checkReferences(spec, getObject); err != nil {
+			errs = append(errs, err.Error())
+		}
+
+		existed := s._getObject(spec.Name())
+		switch {
+		case existed == nil:
+			puts = append(puts, spec)
+		case existed.Kind() != spec.Kind():
+			errs = append(errs, fmt.Sprintf("%s: different kinds: %s, %s", spec.Name(), existed.Kind(), spec.Kind()))
+		case existed.Equals(spec):
+			result.Action = applyActionUnchanged
+		default:
+			result.Action = applyActionUpdated
+			puts = append(puts, spec)
+		}
+	}
+
+	if len(errs) > 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s", strings.Join(errs, "; ")))
+		return
+	}
+
+	var deleted []string
+	if deletes != nil {
+		deleted = deletes()
+	}
+	for _, name := range deleted {
+		result := &ApplyResult{Name: name, Action: applyActionDeleted}
+		if existed := s._getObject(name); existed != nil {
+			result.Kind = existed.Kind()
+		}
+		resp.Objects = append(resp.Objects, result)
+	}
+
+	if len(puts) > 0 || len(deleted) > 0 {
+		resp.Version = s._applyObjects(r, puts, deleted)
+		s.setConfigVersion(w, resp.Version)
+	}
+	WriteBody(w, r, resp)
+}
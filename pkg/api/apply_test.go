@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	_ "github.com/megaease/easegress/pkg/object/grpcserver"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const applyServerYAML = `
+- kind: GRPCServer
+  name: server
+  port: 10080
+  rules:
+  - methods:
+    - backend: pipeline
+`
+
+const applyPipelineYAML = `
+- kind: Pipeline
+  name: pipeline
+  filters: []
+`
+
+func TestSortByDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	var specs []*supervisor.Spec
+	for _, yaml := range []string{applyServerYAML, applyPipelineYAML} {
+		var docs []map[string]interface{}
+		codectool.MustUnmarshal([]byte(yaml), &docs)
+		spec, err := supervisor.NewSpec(string(codectool.MustMarshalJSON(docs[0])))
+		assert.NoError(err)
+		specs = append(specs, spec)
+	}
+
+	sorted, err := sortByDependencies(specs)
+	assert.NoError(err)
+	assert.Equal("pipeline", sorted[0].Name())
+	assert.Equal("server", sorted[1].Name())
+}
+
+func TestApplyObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	s := &Server{cluster: c, super: supervisor.NewDefaultMock()}
+
+	apply := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.applyObjects(w, httptest.NewRequest("POST", ApplyPath, strings.NewReader(body)))
+		return w
+	}
+
+	// the pipeline referenced by the server is missing.
+	w := apply(applyServerYAML)
+	assert.Equal(400, w.Code)
+	assert.Contains(w.Body.String(), "pipeline")
+	assert.Empty(data)
+
+	// duplicated names.
+	w = apply(applyPipelineYAML + applyPipelineYAML)
+	assert.Equal(400, w.Code)
+	assert.Contains(w.Body.String(), "duplicated")
+
+	// the backend is not a pipeline, nothing is applied.
+	s._putObject(nil, newAccessLogSpec(t, "log", "/tmp/access.log"))
+	w = apply(strings.ReplaceAll(applyServerYAML, "backend: pipeline", "backend: log") + applyPipelineYAML)
+	assert.Equal(400, w.Code)
+	assert.Nil(s._getObject("pipeline"))
+
+	// the server is applied after the pipeline it references.
+	w = apply(applyServerYAML + applyPipelineYAML)
+	assert.Equal(200, w.Code, w.Body.String())
+
+	resp := &ApplyResponse{}
+	codectool.MustUnmarshal(w.Body.Bytes(), resp)
+	assert.Equal(int64(2), resp.Version)
+	assert.Equal([]*ApplyResult{
+		{Name: "pipeline", Kind: "Pipeline", Action: applyActionCreated},
+		{Name: "server", Kind: "GRPCServer", Action: applyActionCreated},
+	}, resp.Objects)
+	assert.NotNil(s._getObject("server"))
+	assert.Len(s._listRevisions("server"), 1)
+
+	// only the changed objects are updated.
+	w = apply(strings.ReplaceAll(applyServerYAML, "10080", "10081") + applyPipelineYAML)
+	assert.Equal(200, w.Code, w.Body.String())
+	resp = &ApplyResponse{}
+	codectool.MustUnmarshal(w.Body.Bytes(), resp)
+	assert.Equal(int64(3), resp.Version)
+	assert.Equal(applyActionUnchanged, resp.Objects[0].Action)
+	assert.Equal(applyActionUpdated, resp.Objects[1].Action)
+
+	// kind can not be changed.
+	w = apply(strings.ReplaceAll(applyPipelineYAML, "name: pipeline", "name: log"))
+	assert.Equal(400, w.Code)
+	assert.Contains(w.Body.String(), "different kinds")
+}
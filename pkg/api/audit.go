@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// AuditPrefix is the prefix of the audit log API.
+	AuditPrefix = "/audit"
+
+	auditOperationCreate = "create"
+	auditOperationUpdate = "update"
+	auditOperationDelete = "delete"
+
+	// auditUserSystem is the user of the changes not from the APIs, e.g.
+	// the changes of the controllers managing objects.
+	auditUserSystem = "system"
+
+	auditPurgeInterval = 10 * time.Minute
+)
+
+type (
+	// AuditEntry is an entry of the audit log, which records a change of
+	// an object.
+	AuditEntry struct {
+		Version int64  `json:"version"`
+		Time    string `json:"time"`
+		// User is the identity of the client in the form of method:user,
+		// "-" if the APIs are open to everyone.
+		User       string `json:"user"`
+		RemoteAddr string `json:"remoteAddr,omitempty"`
+		Operation  string `json:"operation"`
+		Name       string `json:"name"`
+		Kind       string `json:"kind,omitempty"`
+		Namespace  string `json:"namespace,omitempty"`
+		// Diff is the unified diff of the specs in YAML.
+		Diff string `json:"diff,omitempty"`
+	}
+
+	// auditSource is where a change comes from.
+	auditSource struct {
+		user       string
+		remoteAddr string
+	}
+
+	// auditFilter filters the audit entries, the zero values match all.
+	auditFilter struct {
+		name      string
+		kind      string
+		user      string
+		namespace string
+		since     time.Time
+		limit     int
+	}
+)
+
+func (s *Server) auditAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    AuditPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listAuditEntries,
+		},
+	}
+}
+
+func auditSourceOf(r *http.Request) *auditSource {
+	if r == nil {
+		return &auditSource{user: auditUserSystem}
+	}
+
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	return &auditSource{user: requestAuthOf(r).user(), remoteAddr: addr}
+}
+
+// _addAuditEntry adds the audit entry of the change of an object to kvs,
+// the spec is nil if the object is deleted.
+func (s *Server) _addAuditEntry(kvs map[string]*string, source *auditSource, entry *AuditEntry, spec *supervisor.Spec) {
+	entry.User, entry.RemoteAddr = source.user, source.remoteAddr
+	if entry.Namespace == "" {
+		entry.Namespace = s._getObjectNamespace(entry.Name)
+	}
+
+	var fromRev, toRev *ObjectRevision
+	existed := s._getObject(entry.Name)
+	if existed != nil {
+		entry.Kind = existed.Kind()
+		fromRev = &ObjectRevision{Spec: json.RawMessage(existed.JSONConfig())}
+	}
+	if spec != nil {
+		entry.Kind = spec.Kind()
+		toRev = &ObjectRevision{Spec: json.RawMessage(spec.JSONConfig())}
+	}
+
+	switch {
+	case spec == nil:
+		entry.Operation = auditOperationDelete
+	case existed == nil:
+		entry.Operation = auditOperationCreate
+	default:
+		entry.Operation = auditOperationUpdate
+	}
+	entry.Diff = diffRevisions(entry.Name, entry.Version-1, entry.Version, fromRev, toRev)
+
+	value := string(codectool.MustMarshalJSON(entry))
+	kvs[s.cluster.Layout().ConfigAuditKey(entry.Version, entry.Name)] = &value
+}
+
+func (s *Server) _getObjectNamespace(name string) string {
+	value, err := s.cluster.Get(s.cluster.Layout().ObjectNamespaceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// _listAuditEntries lists the audit entries matching the filter, the newest
+// ones first.
+func (s *Server) _listAuditEntries(filter *auditFilter) []*AuditEntry {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigAuditPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	entries := make([]*AuditEntry, 0, len(kvs))
+	for _, v := range kvs {
+		entry := &AuditEntry{}
+		err := codectool.UnmarshalJSON([]byte(v), entry)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to json failed: %v", v, err))
+		}
+		if filter.match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Version != entries[j].Version {
+			return entries[i].Version > entries[j].Version
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	if filter.limit > 0 && len(entries) > filter.limit {
+		entries = entries[:filter.limit]
+	}
+	return entries
+}
+
+func (f *auditFilter) match(entry *AuditEntry) bool {
+	if f.name != "" && entry.Name != f.name {
+		return false
+	}
+	if f.kind != "" && entry.Kind != f.kind {
+		return false
+	}
+	if f.user != "" && entry.User != f.user {
+		return false
+	}
+	if f.namespace != "" && entry.Namespace != f.namespace {
+		return false
+	}
+	if !f.since.IsZero() {
+		t, err := time.Parse(time.RFC3339, entry.Time)
+		if err != nil || t.Before(f.since) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAuditFilter parses the filter from the query parameters, since is
+// either a RFC3339 time or a duration before now.
+func parseAuditFilter(r *http.Request) (*auditFilter, error) {
+	q := r.URL.Query()
+	filter := &auditFilter{
+		name:      q.Get("name"),
+		kind:      q.Get("kind"),
+		user:      q.Get("user"),
+		namespace: q.Get("namespace"),
+	}
+
+	if v := q.Get("since"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			filter.since = time.Now().Add(-d)
+		} else if filter.since, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("invalid since %s", v)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %s", v)
+		}
+		filter.limit = limit
+	}
+
+	return filter, nil
+}
+
+func (s *Server) listAuditEntries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	WriteBody(w, r, s._listAuditEntries(filter))
+}
+
+// purgeAuditLog removes the audit entries exceeding the retention limits
+// periodically, only the leader does the job.
+func (s *Server) purgeAuditLog() {
+	maxAge, _ := time.ParseDuration(s.opt.AuditLogMaxAge)
+	if s.opt.AuditLogMaxEntries == 0 && maxAge == 0 {
+		return
+	}
+
+	for {
+		select {
+		case <-time.After(auditPurgeInterval):
+			if !s.cluster.IsLeader() {
+				continue
+			}
+			if err := s.purgeAuditEntries(s.opt.AuditLogMaxEntries, maxAge); err != nil {
+				logger.API.Errorf("failed to purge audit log: %v", err)
+			}
+
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// purgeAuditEntries removes the oldest audit entries exceeding maxEntries,
+// and the ones older than maxAge, 0 means no limit.
+func (s *Server) purgeAuditEntries(maxEntries int, maxAge time.Duration) error {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().ConfigAuditPrefix())
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	// the keys are sorted by versions.
+	sort.Strings(keys)
+
+	expired := 0
+	if maxEntries > 0 && len(keys) > maxEntries {
+		expired = len(keys) - maxEntries
+	}
+	if maxAge > 0 {
+		deadline := time.Now().Add(-maxAge)
+		for ; expired < len(keys); expired++ {
+			entry := &AuditEntry{}
+			if err := codectool.UnmarshalJSON([]byte(kvs[keys[expired]]), entry); err != nil {
+				break
+			}
+			t, err := time.Parse(time.RFC3339, entry.Time)
+			if err != nil || !t.Before(deadline) {
+				break
+			}
+		}
+	}
+
+	for _, key := range keys[:expired] {
+		if err := s.cluster.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestAuditLog(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	c.MockedDelete = func(key string) error {
+		delete(data, key)
+		return nil
+	}
+	s := &Server{cluster: c, super: supervisor.NewDefaultMock()}
+
+	r := httptest.NewRequest(http.MethodPost, "/apis/v2/objects", nil)
+	r.RemoteAddr = "192.168.1.1:1234"
+	r, ra := withRequestAuth(r)
+	ra.identity = &Identity{User: "alice", Method: authMethodToken}
+
+	s._putObject(r, newAccessLogSpec(t, "log", "/tmp/a.log"))
+	s._putObject(r, newAccessLogSpec(t, "log", "/tmp/b.log"))
+	s._putObject(nil, newAccessLogSpec(t, "other", "/tmp/c.log"))
+	s._deleteObject(r, "log")
+
+	entries := s._listAuditEntries(&auditFilter{})
+	assert.Len(entries, 4)
+	assert.Equal(int64(4), entries[0].Version)
+	assert.Equal(auditOperationDelete, entries[0].Operation)
+	assert.Equal("AccessLog", entries[0].Kind)
+	assert.Equal(auditUserSystem, entries[1].User)
+	assert.Empty(entries[1].RemoteAddr)
+
+	update := entries[2]
+	assert.Equal(auditOperationUpdate, update.Operation)
+	assert.Equal("token:alice", update.User)
+	assert.Equal("192.168.1.1", update.RemoteAddr)
+	assert.Contains(update.Diff, "-        filename: /tmp/a.log")
+	assert.Contains(update.Diff, "+        filename: /tmp/b.log")
+	assert.Equal(auditOperationCreate, entries[3].Operation)
+
+	entries = s._listAuditEntries(&auditFilter{name: "log", limit: 2})
+	assert.Len(entries, 2)
+	assert.Equal(int64(4), entries[0].Version)
+	assert.Equal(int64(2), entries[1].Version)
+	assert.Len(s._listAuditEntries(&auditFilter{user: "token:alice"}), 3)
+	assert.Empty(s._listAuditEntries(&auditFilter{since: time.Now().Add(time.Hour)}))
+
+	// API
+	w := httptest.NewRecorder()
+	s.listAuditEntries(w, httptest.NewRequest(http.MethodGet, "/apis/v2/audit?name=other&since=1h", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	entries = nil
+	codectool.MustUnmarshal(w.Body.Bytes(), &entries)
+	assert.Len(entries, 1)
+	assert.Equal("other", entries[0].Name)
+
+	for _, query := range []string{"limit=0", "since=yesterday"} {
+		w = httptest.NewRecorder()
+		s.listAuditEntries(w, httptest.NewRequest(http.MethodGet, "/apis/v2/audit?"+query, nil))
+		assert.Equal(http.StatusBadRequest, w.Code)
+	}
+
+	// retention
+	assert.NoError(s.purgeAuditEntries(3, 0))
+	entries = s._listAuditEntries(&auditFilter{})
+	assert.Len(entries, 3)
+	assert.Equal(int64(2), entries[2].Version)
+
+	old := &AuditEntry{Version: 1, Time: time.Now().Add(-2 * time.Hour).Format(time.RFC3339), Name: "old"}
+	data[c.Layout().ConfigAuditKey(1, "old")] = string(codectool.MustMarshalJSON(old))
+	assert.NoError(s.purgeAuditEntries(0, time.Hour))
+	entries = s._listAuditEntries(&auditFilter{})
+	assert.Len(entries, 3)
+	for _, e := range entries {
+		assert.NotEqual("old", e.Name)
+	}
+}
@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/util/oidc"
+)
+
+const (
+	// RoleAdmin is the built-in role which is allowed to call all APIs.
+	RoleAdmin = "admin"
+	// RoleReadOnly is the built-in role which is allowed to call the read
+	// APIs only.
+	RoleReadOnly = "read-only"
+
+	verbRead  = "read"
+	verbWrite = "write"
+
+	authMethodBasic = "basic"
+	authMethodToken = "token"
+	authMethodCert  = "cert"
+	authMethodOIDC  = "oidc"
+)
+
+type (
+	// Identity is the authenticated client of the admin APIs.
+	Identity struct {
+		User   string
+		Groups []string
+		// Method is how the client is authenticated, one of basic, token,
+		// cert and oidc.
+		Method string
+	}
+
+	// apiAuth authenticates and authorizes the clients of the admin APIs.
+	apiAuth struct {
+		adminUsers map[string]string
+		// tokens are indexed by the hashes of the tokens.
+		tokens       map[[sha256.Size]byte]*option.APIToken
+		oidcOpt      *option.APIOIDCOptions
+		oidcProvider *oidc.Provider
+		certEnabled  bool
+
+		roles      map[string][]*option.APIRoleRule
+		userRoles  map[string][]string
+		groupRoles map[string][]string
+	}
+
+	// requestAuth is the authentication result of a request, it is put in
+	// the context of the request by the API logger, so that the identity
+	// is logged.
+	requestAuth struct {
+		identity *Identity
+		// fullAccess is false if the identity is only allowed to access
+		// the objects of some kinds.
+		fullAccess bool
+	}
+
+	requestAuthKey struct{}
+)
+
+// verifiedPasswords caches the verified passwords, as bcrypt is too slow
+// to verify every request. The keys are the hashes of the bcrypt hashes
+// and the passwords, so the passwords are not kept in memory.
+var verifiedPasswords sync.Map
+
+func verifyPassword(hash, password string) bool {
+	key := sha256.Sum256([]byte(hash + "\x00" + password))
+	if _, ok := verifiedPasswords.Load(key); ok {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	verifiedPasswords.Store(key, struct{}{})
+	return true
+}
+
+// newAPIAuth creates an apiAuth, it returns nil if no authentication
+// method is configured, which means the APIs are open to everyone.
+func newAPIAuth(opt *option.Options) *apiAuth {
+	if opt == nil || (len(opt.APIAdminUsers) == 0 && !opt.APIAuth.Enabled()) {
+		return nil
+	}
+
+	auth := &apiAuth{
+		adminUsers:  opt.APIAdminUsers,
+		tokens:      map[[sha256.Size]byte]*option.APIToken{},
+		certEnabled: opt.APIAuth.ClientCAFile != "",
+		roles: map[string][]*option.APIRoleRule{
+			RoleAdmin:    {{Verbs: []string{verbRead, verbWrite}}},
+			RoleReadOnly: {{Verbs: []string{verbRead}}},
+		},
+		userRoles:  map[string][]string{},
+		groupRoles: map[string][]string{},
+	}
+
+	for _, t := range opt.APIAuth.Tokens {
+		auth.tokens[sha256.Sum256([]byte(t.Token))] = t
+	}
+	if o := opt.APIAuth.OIDC; o != nil {
+		auth.oidcOpt = o
+		client := &http.Client{Timeout: 10 * time.Second}
+		auth.oidcProvider = oidc.NewProvider(o.DiscoveryURL, client)
+	}
+
+	for _, r := range opt.APIAuth.Roles {
+		auth.roles[r.Name] = r.Rules
+	}
+	for _, b := range opt.APIAuth.RoleBindings {
+		for _, u := range b.Users {
+			auth.userRoles[u] = append(auth.userRoles[u], b.Role)
+		}
+		for _, g := range b.Groups {
+			auth.groupRoles[g] = append(auth.groupRoles[g], b.Role)
+		}
+	}
+
+	return auth
+}
+
+// authenticate returns the identity of the request, it returns nil if the
+// request is not authenticated.
+func (auth *apiAuth) authenticate(r *http.Request) *Identity {
+	if auth.certEnabled && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return &Identity{
+			User:   cert.Subject.CommonName,
+			Groups: cert.Subject.Organization,
+			Method: authMethodCert,
+		}
+	}
+
+	if user, password, ok := r.BasicAuth(); ok {
+		if hash, ok := auth.adminUsers[user]; ok && verifyPassword(hash, password) {
+			return &Identity{User: user, Method: authMethodBasic}
+		}
+		return nil
+	}
+
+	token := r.Header.Get("Authorization")
+	if len(token) < 7 || !strings.EqualFold(token[:7], "Bearer ") {
+		return nil
+	}
+	token = strings.TrimSpace(token[7:])
+
+	if t, ok := auth.tokens[sha256.Sum256([]byte(token))]; ok {
+		return &Identity{User: t.User, Groups: t.Groups, Method: authMethodToken}
+	}
+	if auth.oidcProvider != nil {
+		return auth.authenticateOIDC(token)
+	}
+	return nil
+}
+
+func (auth *apiAuth) authenticateOIDC(token string) *Identity {
+	claims, err := auth.oidcProvider.VerifyIDToken(token, auth.oidcOpt.ClientID, "")
+	if err != nil {
+		return nil
+	}
+
+	userClaim, groupsClaim := auth.oidcOpt.UsernameClaim, auth.oidcOpt.GroupsClaim
+	if userClaim == "" {
+		userClaim = "sub"
+	}
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	id := &Identity{Method: authMethodOIDC}
+	id.User, _ = claims[userClaim].(string)
+	if id.User == "" {
+		return nil
+	}
+	switch groups := claims[groupsClaim].(type) {
+	case string:
+		id.Groups = []string{groups}
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	}
+	return id
+}
+
+// rolesOf returns the roles of the identity, the cluster admins of the
+// basic authentication are admins.
+func (auth *apiAuth) rolesOf(id *Identity) []string {
+	if id.Method == authMethodBasic {
+		return []string{RoleAdmin}
+	}
+	roles := append([]string(nil), auth.userRoles[id.User]...)
+	for _, g := range id.Groups {
+		roles = append(roles, auth.groupRoles[g]...)
+	}
+	return roles
+}
+
+// allowed returns whether the identity is allowed to do verb on the
+// objects of kind, an empty kind means all the APIs.
+func (auth *apiAuth) allowed(id *Identity, verb, kind string) bool {
+	for _, role := range auth.rolesOf(id) {
+		for _, rule := range auth.roles[role] {
+			if !contains(rule.Verbs, verb) {
+				continue
+			}
+			if len(rule.Kinds) == 0 || (kind != "" && contains(rule.Kinds, kind)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowedSomeKinds returns whether the identity is allowed to do verb on
+// the objects of some kinds.
+func (auth *apiAuth) allowedSomeKinds(id *Identity, verb string) bool {
+	for _, role := range auth.rolesOf(id) {
+		for _, rule := range auth.roles[role] {
+			if contains(rule.Verbs, verb) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func verbOf(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return verbRead
+	default:
+		return verbWrite
+	}
+}
+
+// withRequestAuth returns the request with an empty requestAuth in its
+// context, and the requestAuth.
+func withRequestAuth(r *http.Request) (*http.Request, *requestAuth) {
+	ra := &requestAuth{}
+	return r.WithContext(context.WithValue(r.Context(), requestAuthKey{}, ra)), ra
+}
+
+func requestAuthOf(r *http.Request) *requestAuth {
+	ra, _ := r.Context().Value(requestAuthKey{}).(*requestAuth)
+	return ra
+}
+
+// user returns the user of the request for the logs, "-" means the user
+// is unknown.
+func (ra *requestAuth) user() string {
+	if ra == nil || ra.identity == nil {
+		return "-"
+	}
+	return ra.identity.Method + ":" + ra.identity.User
+}
+
+// kindAllowed returns whether the request is allowed to access the objects
+// of kind, it is checked by the object APIs as the identities may be only
+// allowed to access the objects of some kinds.
+func (s *Server) kindAllowed(r *http.Request, kind string) bool {
+	ra := requestAuthOf(r)
+	if s.auth == nil || ra == nil || ra.fullAccess || ra.identity == nil {
+		return true
+	}
+	return s.auth.allowed(ra.identity, verbOf(r.Method), kind)
+}
+
+// isNamespaceAdmin returns whether the request is from a client with the
+// full access, or an admin of the namespace.
+func (s *Server) isNamespaceAdmin(r *http.Request, namespace string) bool {
+	if s.auth == nil {
+		return true
+	}
+
+	ra := requestAuthOf(r)
+	if id := s.auth.authenticate(r); id != nil && s.auth.allowed(id, verbOf(r.Method), "") {
+		if ra != nil {
+			ra.identity, ra.fullAccess = id, true
+		}
+		return true
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	ns := s._getNamespace(namespace)
+	if ns == nil {
+		return false
+	}
+	hash, ok := ns.Admins[user]
+	if !ok || !verifyPassword(hash, password) {
+		return false
+	}
+	if ra != nil {
+		ra.identity = &Identity{User: namespace + "/" + user, Method: authMethodBasic}
+	}
+	return true
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="easegress"`)
+	HandleAPIError(w, r, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+}
+
+// trimAPIPrefix trims the version prefix of the path, ok is false if the
+// path is not an API.
+func trimAPIPrefix(path string) (string, bool) {
+	path = strings.TrimSuffix(path, "/")
+	switch {
+	case strings.HasPrefix(path, APIPrefixV1):
+		return path[len(APIPrefixV1):], true
+	case strings.HasPrefix(path, APIPrefixV2):
+		return path[len(APIPrefixV2):], true
+	}
+	return "", false
+}
+
+// isPublicPath returns whether the path is accessible without
+// authentication, which are the health probes, and the namespaced APIs
+// which authenticate the clients by themselves.
+func isPublicPath(path string) bool {
+	path, ok := trimAPIPrefix(path)
+	if !ok {
+		return false
+	}
+
+	if path == HealthzPath || path == ReadyzPath {
+		return true
+	}
+
+	// e.g. /namespaces/{namespace}/objects
+	if !strings.HasPrefix(path, NamespacePrefix+"/") {
+		return false
+	}
+	return strings.Contains(path[len(NamespacePrefix)+1:], "/")
+}
+
+// isObjectPath returns whether the path is an object API, which checks
+// the permissions of the kinds of the objects.
+func isObjectPath(path string) bool {
+	path, ok := trimAPIPrefix(path)
+	if !ok {
+		return false
+	}
+
+	for _, prefix := range []string{ObjectPrefix, StatusObjectPrefix} {
+		if path == prefix {
+			return true
+		}
+		if strings.HasPrefix(path, prefix+"/") && !strings.Contains(path[len(prefix)+1:], "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestIsObjectPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isObjectPath("/apis/v2/objects"))
+	assert.True(isObjectPath("/apis/v2/objects/pipeline/"))
+	assert.True(isObjectPath("/apis/v1/status/objects/pipeline"))
+	assert.False(isObjectPath("/apis/v2/objects/pipeline/revisions"))
+	assert.False(isObjectPath("/apis/v2/object-kinds"))
+	assert.False(isObjectPath("/objects"))
+}
+
+func TestAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := &option.Options{
+		APIAuth: option.APIAuthOptions{
+			ClientCAFile: "ca.pem",
+			Tokens: []*option.APIToken{
+				{User: "ci", Token: "ci-token", Groups: []string{"deployers"}},
+			},
+		},
+	}
+	auth := newAPIAuth(opt)
+	assert.NotNil(auth)
+	assert.Nil(newAPIAuth(&option.Options{}))
+
+	r := httptest.NewRequest(http.MethodGet, "/apis/v2/objects", nil)
+	assert.Nil(auth.authenticate(r))
+
+	r.Header.Set("Authorization", "Bearer bad-token")
+	assert.Nil(auth.authenticate(r))
+
+	r.Header.Set("Authorization", "bearer ci-token")
+	id := auth.authenticate(r)
+	assert.Equal(&Identity{User: "ci", Groups: []string{"deployers"}, Method: authMethodToken}, id)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"ops"}}}
+	r = httptest.NewRequest(http.MethodGet, "/apis/v2/objects", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	id = auth.authenticate(r)
+	assert.Equal(&Identity{User: "alice", Groups: []string{"ops"}, Method: authMethodCert}, id)
+}
+
+func TestAuthorize(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	c.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+
+	opt := &option.Options{
+		APIAuth: option.APIAuthOptions{
+			Tokens: []*option.APIToken{
+				{User: "root", Token: "root-token"},
+				{User: "viewer", Token: "viewer-token"},
+				{User: "ci", Token: "ci-token", Groups: []string{"deployers"}},
+				{User: "nobody", Token: "nobody-token"},
+			},
+			Roles: []*option.APIRole{{
+				Name: "deployer",
+				Rules: []*option.APIRoleRule{
+					{Verbs: []string{verbRead, verbWrite}, Kinds: []string{"Pipeline"}},
+				},
+			}},
+			RoleBindings: []*option.APIRoleBinding{
+				{Role: RoleAdmin, Users: []string{"root"}},
+				{Role: RoleReadOnly, Users: []string{"viewer"}},
+				{Role: "deployer", Groups: []string{"deployers"}},
+			},
+		},
+	}
+	s := &Server{opt: opt, cluster: c, super: supervisor.NewDefaultMock(), auth: newAPIAuth(opt)}
+	s._putObject(nil, newAccessLogSpec(t, "log", "/tmp/access.log"))
+
+	m := &dynamicMux{server: s}
+	router := chi.NewRouter()
+	router.Use(m.newAuthenticator)
+	for _, e := range append(s.objectAPIEntries(), s.healthAPIEntries()...) {
+		router.Method(e.Method, APIPrefixV2+e.Path, http.HandlerFunc(e.Handler))
+	}
+	router.Get(APIPrefixV2+"/kv", func(w http.ResponseWriter, r *http.Request) {})
+	request := func(user, method, path, body string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, APIPrefixV2+path, r)
+		if user != "" {
+			req.Header.Set("Authorization", "Bearer "+user+"-token")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	pipeline := "kind: Pipeline\nname: pipeline\nfilters: []"
+	assert.Equal(http.StatusUnauthorized, request("", http.MethodGet, "/objects", "").Code)
+	assert.Equal(http.StatusForbidden, request("nobody", http.MethodGet, "/objects", "").Code)
+
+	// read-only.
+	assert.Equal(http.StatusOK, request("viewer", http.MethodGet, "/objects/log", "").Code)
+	assert.Equal(http.StatusOK, request("viewer", http.MethodGet, "/kv", "").Code)
+	assert.Equal(http.StatusForbidden, request("viewer", http.MethodPost, "/objects", pipeline).Code)
+
+	// only pipelines.
+	assert.Equal(http.StatusCreated, request("ci", http.MethodPost, "/objects", pipeline).Code)
+	assert.Equal(http.StatusForbidden, request("ci", http.MethodGet, "/objects/log", "").Code)
+	assert.Equal(http.StatusForbidden, request("ci", http.MethodDelete, "/objects/log", "").Code)
+	assert.Equal(http.StatusForbidden, request("ci", http.MethodGet, "/kv", "").Code)
+	w := request("ci", http.MethodGet, "/objects", "")
+	var specs []map[string]interface{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &specs)
+	assert.Len(specs, 1)
+	assert.Equal("pipeline", specs[0]["name"])
+
+	// admin.
+	w = request("root", http.MethodGet, "/objects", "")
+	specs = nil
+	codectool.MustUnmarshal(w.Body.Bytes(), &specs)
+	assert.Len(specs, 2)
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+var poolKeyRegexp = regexp.MustCompile(`^(main|mirror|candidate-\d+)$`)
+
+// circuitBreakerActions maps the actions to the records of the circuit
+// breaker states.
+var circuitBreakerActions = map[string]resilience.CircuitBreakerRecord{
+	"force-open": {State: "ForceOpen"},
+	"close":      {State: "Closed"},
+	"reset":      {State: "Closed", Reset: true},
+}
+
+func (s *Server) listCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	if !s.isFilterExist(pipeline, filter, proxy.Kind) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	prefix := s.cluster.Layout().CircuitBreakerPrefix(pipeline, filter)
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	records := map[string]*resilience.CircuitBreakerRecord{}
+	for k, v := range kvs {
+		record := &resilience.CircuitBreakerRecord{}
+		if err := codectool.UnmarshalJSON([]byte(v), record); err != nil {
+			continue
+		}
+		records[k[len(prefix):]] = record
+	}
+
+	WriteBody(w, r, records)
+}
+
+func (s *Server) updateCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	pool := chi.URLParam(r, "pool")
+	action := chi.URLParam(r, "action")
+
+	if !s.isFilterExist(pipeline, filter, proxy.Kind) {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if !poolKeyRegexp.MatchString(pool) {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid pool %s, must be main, mirror or candidate-N", pool))
+		return
+	}
+	record, ok := circuitBreakerActions[action]
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid action %s, must be force-open, close or reset", action))
+		return
+	}
+
+	record.Time = time.Now().Format(time.RFC3339Nano)
+	key := s.cluster.Layout().CircuitBreakerPrefix(pipeline, filter) + pool
+	if err := s.cluster.Put(key, string(codectool.MustMarshalJSON(&record))); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func appendCircuitBreakerAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries, &Entry{
+		Path:    "/circuitbreakers/{pipeline}/{filter}",
+		Method:  http.MethodGet,
+		Handler: s.listCircuitBreakers,
+	}, &Entry{
+		Path:    "/circuitbreakers/{pipeline}/{filter}/{pool}/{action}",
+		Method:  http.MethodPost,
+		Handler: s.updateCircuitBreaker,
+	})
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendCircuitBreakerAPI)
+}
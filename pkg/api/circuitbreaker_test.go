@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	_ "github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestCircuitBreakerAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	c.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	s := &Server{cluster: c}
+
+	spec, err := supervisor.NewSpec(`
+kind: Pipeline
+name: pipeline
+filters:
+- kind: Proxy
+  name: proxy
+  pools:
+  - servers:
+    - url: http://127.0.0.1:9095
+`)
+	assert.NoError(err)
+	s._putObject(nil, spec)
+
+	router := chi.NewRouter()
+	group := &Group{}
+	appendCircuitBreakerAPI(s, group)
+	for _, e := range group.Entries {
+		router.Method(e.Method, e.Path, http.HandlerFunc(e.Handler))
+	}
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	assert.Equal(http.StatusNotFound, request(http.MethodGet, "/circuitbreakers/pipeline/other").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPost, "/circuitbreakers/pipeline/proxy/other/reset").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPost, "/circuitbreakers/pipeline/proxy/main/open").Code)
+
+	assert.Equal(http.StatusOK, request(http.MethodPost, "/circuitbreakers/pipeline/proxy/main/force-open").Code)
+	assert.Equal(http.StatusOK, request(http.MethodPost, "/circuitbreakers/pipeline/proxy/candidate-0/reset").Code)
+
+	w := request(http.MethodGet, "/circuitbreakers/pipeline/proxy")
+	assert.Equal(http.StatusOK, w.Code)
+	records := map[string]*resilience.CircuitBreakerRecord{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &records)
+	assert.Len(records, 2)
+	assert.Equal("ForceOpen", records["main"].State)
+	assert.Equal("Closed", records["candidate-0"].State)
+	assert.True(records["candidate-0"].Reset)
+}
@@ -18,9 +18,12 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
@@ -51,12 +54,68 @@ func (s *Server) _getVersion() int64 {
 	return version
 }
 
-func (s *Server) _plusOneVersion() int64 {
-	version := s._getVersion()
-	version++
-	value := fmt.Sprintf("%d", version)
+// _applyObjects puts and deletes the objects, records their revisions and
+// audit entries, and upgrades the config version in one transaction, it
+// returns the new config version. r is the request changing the objects,
+// it is nil for the changes not from the APIs.
+func (s *Server) _applyObjects(r *http.Request, puts []*supervisor.Spec, deletes []string) int64 {
+	return s._applyObjectsInNamespace(r, "", puts, deletes)
+}
 
-	err := s.cluster.Put(s.cluster.Layout().ConfigVersion(), value)
+// _applyObjectsInNamespace is like _applyObjects, and the put objects are
+// also assigned to the namespace if it is not empty. The namespaces of the
+// deleted objects are always deleted.
+func (s *Server) _applyObjectsInNamespace(r *http.Request, namespace string, puts []*supervisor.Spec, deletes []string) int64 {
+	layout := s.cluster.Layout()
+	version := s._getVersion() + 1
+	now := time.Now().Format(time.RFC3339)
+	source := auditSourceOf(r)
+
+	kvs := make(map[string]*string)
+	versionValue := strconv.FormatInt(version, 10)
+	kvs[layout.ConfigVersion()] = &versionValue
+
+	for _, spec := range puts {
+		value := spec.JSONConfig()
+		s._addAuditEntry(kvs, source, &AuditEntry{
+			Version:   version,
+			Time:      now,
+			Name:      spec.Name(),
+			Kind:      spec.Kind(),
+			Namespace: namespace,
+		}, spec)
+		kvs[layout.ConfigObjectKey(spec.Name())] = &value
+		if namespace != "" {
+			ns := namespace
+			kvs[layout.ObjectNamespaceKey(spec.Name())] = &ns
+		}
+		s._addRevision(kvs, &ObjectRevision{
+			Version: version,
+			Name:    spec.Name(),
+			Kind:    spec.Kind(),
+			Time:    now,
+			Spec:    json.RawMessage(value),
+		})
+	}
+
+	for _, name := range deletes {
+		s._addAuditEntry(kvs, source, &AuditEntry{
+			Version:   version,
+			Time:      now,
+			Name:      name,
+			Namespace: namespace,
+		}, nil)
+		kvs[layout.ConfigObjectKey(name)] = nil
+		kvs[layout.ObjectNamespaceKey(name)] = nil
+		s._addRevision(kvs, &ObjectRevision{
+			Version: version,
+			Name:    name,
+			Deleted: true,
+			Time:    now,
+		})
+	}
+
+	err := s.cluster.PutAndDelete(kvs)
 	if err != nil {
 		ClusterPanic(err)
 	}
@@ -100,19 +159,12 @@ func (s *Server) _listObjects() []*supervisor.Spec {
 	return specs
 }
 
-func (s *Server) _putObject(spec *supervisor.Spec) {
-	err := s.cluster.Put(s.cluster.Layout().ConfigObjectKey(spec.Name()),
-		spec.JSONConfig())
-	if err != nil {
-		ClusterPanic(err)
-	}
+func (s *Server) _putObject(r *http.Request, spec *supervisor.Spec) int64 {
+	return s._applyObjects(r, []*supervisor.Spec{spec}, nil)
 }
 
-func (s *Server) _deleteObject(name string) {
-	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectKey(name))
-	if err != nil {
-		ClusterPanic(err)
-	}
+func (s *Server) _deleteObject(r *http.Request, name string) int64 {
+	return s._applyObjects(r, nil, []string{name})
 }
 
 func (s *Server) _getStatusObject(name string) map[string]string {
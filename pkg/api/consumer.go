@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/cluster/consumer"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// ConsumerPrefix is the URL prefix of APIs for consumers
+	ConsumerPrefix = "/consumers"
+)
+
+func (s *Server) consumerAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ConsumerPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listConsumers,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getConsumer,
+		},
+		{
+			Path:    ConsumerPrefix,
+			Method:  http.MethodPut,
+			Handler: s.putConsumer,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteConsumer,
+		},
+		{
+			Path:    ConsumerPrefix + "/{name}/usage",
+			Method:  http.MethodGet,
+			Handler: s.getConsumerUsage,
+		},
+	}
+}
+
+// NOTE: the API keys are masked in the responses.
+func (s *Server) listConsumers(w http.ResponseWriter, r *http.Request) {
+	consumers, err := s.cs.List()
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	result := make([]*consumer.Consumer, 0, len(consumers))
+	for _, c := range consumers {
+		result = append(result, c.Masked())
+	}
+
+	WriteBody(w, r, result)
+}
+
+func (s *Server) getConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	c, err := s.cs.Get(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if c == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	WriteBody(w, r, c.Masked())
+}
+
+func (s *Server) putConsumer(w http.ResponseWriter, r *http.Request) {
+	c := &consumer.Consumer{}
+	codectool.MustDecode(r.Body, c)
+
+	if err := s.cs.Put(c); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+}
+
+func (s *Server) deleteConsumer(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := s.cs.Delete(name); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) getConsumerUsage(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	c, err := s.cs.Get(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if c == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	usage, err := s.cs.GetUsage(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	WriteBody(w, r, usage)
+}
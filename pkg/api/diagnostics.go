@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// DiagnosticsPrefix is the URL prefix of the diagnostics APIs, which
+	// diagnose the member serving the API only.
+	DiagnosticsPrefix = "/diagnostics"
+
+	// maxDiagnosticsSeconds is the longest window of a capture.
+	maxDiagnosticsSeconds = 300
+)
+
+type (
+	// RuntimeInfo is the runtime status of the member.
+	RuntimeInfo struct {
+		Member       string `json:"member"`
+		GoVersion    string `json:"goVersion"`
+		OS           string `json:"os"`
+		Arch         string `json:"arch"`
+		NumCPU       int    `json:"numCPU"`
+		GOMAXPROCS   int    `json:"gomaxprocs"`
+		NumGoroutine int    `json:"numGoroutine"`
+		NumCgoCall   int64  `json:"numCgoCall"`
+
+		HeapAlloc    uint64 `json:"heapAlloc"`
+		HeapInuse    uint64 `json:"heapInuse"`
+		HeapObjects  uint64 `json:"heapObjects"`
+		StackInuse   uint64 `json:"stackInuse"`
+		Sys          uint64 `json:"sys"`
+		NumGC        uint32 `json:"numGC"`
+		PauseTotalNs uint64 `json:"pauseTotalNs"`
+		LastGC       string `json:"lastGC,omitempty"`
+	}
+)
+
+// windowedProfiles are the profiles captured for a window of seconds, the
+// values are the default seconds. The others are snapshots.
+var windowedProfiles = map[string]int{
+	"cpu":   30,
+	"block": 30,
+	"mutex": 30,
+	"trace": 5,
+}
+
+// snapshotProfiles are the profiles written as snapshots.
+var snapshotProfiles = map[string]bool{
+	"heap":         true,
+	"allocs":       true,
+	"goroutine":    true,
+	"threadcreate": true,
+}
+
+// capturing guards the windowed captures, only one of them runs at a time
+// because they change the process wide profiling rates.
+var capturing int32
+
+func (s *Server) diagnosticsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    DiagnosticsPrefix + "/runtime",
+			Method:  http.MethodGet,
+			Handler: s.getRuntimeInfo,
+		},
+		{
+			// POST, as captures change the profiling rates of the process,
+			// and they need the write permission.
+			Path:    DiagnosticsPrefix + "/profiles/{kind}",
+			Method:  http.MethodPost,
+			Handler: s.captureProfile,
+		},
+	}
+}
+
+func (s *Server) getRuntimeInfo(w http.ResponseWriter, r *http.Request) {
+	ms := &runtime.MemStats{}
+	runtime.ReadMemStats(ms)
+
+	info := &RuntimeInfo{
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumGoroutine: runtime.NumGoroutine(),
+		NumCgoCall:   runtime.NumCgoCall(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		StackInuse:   ms.StackInuse,
+		Sys:          ms.Sys,
+		NumGC:        ms.NumGC,
+		PauseTotalNs: ms.PauseTotalNs,
+	}
+	if s.opt != nil {
+		info.Member = s.opt.Name
+	}
+	if ms.LastGC != 0 {
+		info.LastGC = time.Unix(0, int64(ms.LastGC)).Format(time.RFC3339)
+	}
+
+	WriteBody(w, r, info)
+}
+
+// captureProfile captures the profile of the kind, the windowed ones are
+// captured for the seconds in the query, and the snapshots are written in
+// the text format if the debug in the query is not zero.
+func (s *Server) captureProfile(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	query := r.URL.Query()
+
+	buff := &bytes.Buffer{}
+	filename := kind + ".pprof"
+	contentType := "application/octet-stream"
+
+	if seconds, ok := windowedProfiles[kind]; ok {
+		if v := query.Get("seconds"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxDiagnosticsSeconds {
+				HandleAPIError(w, r, http.StatusBadRequest,
+					fmt.Errorf("invalid seconds %s, must be in [1, %d]", v, maxDiagnosticsSeconds))
+				return
+			}
+			seconds = n
+		}
+
+		if !atomic.CompareAndSwapInt32(&capturing, 0, 1) {
+			HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("another capture is in progress"))
+			return
+		}
+		defer atomic.StoreInt32(&capturing, 0)
+
+		logger.API.Infof("capture %s profile for %ds", kind, seconds)
+		if err := s.captureWindow(r, kind, time.Duration(seconds)*time.Second, buff); err != nil {
+			HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("capture %s profile failed: %v", kind, err))
+			return
+		}
+		if kind == "trace" {
+			filename = "trace.out"
+		}
+	} else if snapshotProfiles[kind] {
+		debug := 0
+		if v := query.Get("debug"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid debug %s", v))
+				return
+			}
+			debug = n
+		}
+		if debug != 0 {
+			filename = kind + ".txt"
+			contentType = "text/plain; charset=utf-8"
+		}
+
+		if kind == "heap" {
+			// get up-to-date statistics
+			runtime.GC()
+		}
+		if err := pprof.Lookup(kind).WriteTo(buff, debug); err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("write %s profile failed: %v", kind, err))
+			return
+		}
+	} else {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("unknown profile %s", kind))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(buff.Bytes())
+}
+
+// captureWindow captures the windowed profile of the kind into buff, the
+// capture stops early if the client goes away or the server is closed.
+func (s *Server) captureWindow(r *http.Request, kind string, d time.Duration, buff *bytes.Buffer) error {
+	wait := func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+		case <-s.done:
+		}
+	}
+
+	switch kind {
+	case "cpu":
+		if err := pprof.StartCPUProfile(buff); err != nil {
+			return err
+		}
+		wait()
+		pprof.StopCPUProfile()
+		return nil
+	case "trace":
+		if err := trace.Start(buff); err != nil {
+			return err
+		}
+		wait()
+		trace.Stop()
+		return nil
+	case "block":
+		// The block profile is disabled by default, it is enabled during
+		// the window only, so the profile covers the windows of all the
+		// captures.
+		runtime.SetBlockProfileRate(1)
+		wait()
+		runtime.SetBlockProfileRate(0)
+	case "mutex":
+		fraction := runtime.SetMutexProfileFraction(1)
+		wait()
+		runtime.SetMutexProfileFraction(fraction)
+	}
+	return pprof.Lookup(kind).WriteTo(buff, 0)
+}
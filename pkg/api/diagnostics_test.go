@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestDiagnosticsAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Server{}
+	router := chi.NewRouter()
+	for _, e := range s.diagnosticsAPIEntries() {
+		router.Method(e.Method, e.Path, http.HandlerFunc(e.Handler))
+	}
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := request(http.MethodGet, "/diagnostics/runtime")
+	assert.Equal(http.StatusOK, w.Code)
+	info := &RuntimeInfo{}
+	assert.NoError(codectool.UnmarshalJSON(w.Body.Bytes(), info))
+	assert.NotEmpty(info.GoVersion)
+	assert.NotZero(info.NumGoroutine)
+
+	assert.Equal(http.StatusNotFound, request(http.MethodPost, "/diagnostics/profiles/unknown").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPost, "/diagnostics/profiles/cpu?seconds=0").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPost, "/diagnostics/profiles/cpu?seconds=301").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPost, "/diagnostics/profiles/goroutine?debug=x").Code)
+
+	// snapshots are gzipped protobufs, or texts if debug is set
+	w = request(http.MethodPost, "/diagnostics/profiles/heap")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal([]byte{0x1f, 0x8b}, w.Body.Bytes()[:2])
+	assert.Contains(w.Header().Get("Content-Disposition"), "heap.pprof")
+
+	w = request(http.MethodPost, "/diagnostics/profiles/goroutine?debug=2")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "TestDiagnosticsAPI")
+
+	w = request(http.MethodPost, "/diagnostics/profiles/cpu?seconds=1")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal([]byte{0x1f, 0x8b}, w.Body.Bytes()[:2])
+
+	w = request(http.MethodPost, "/diagnostics/profiles/trace?seconds=1")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.NotEmpty(w.Body.Bytes())
+	assert.Contains(w.Header().Get("Content-Disposition"), "trace.out")
+
+	// only one windowed capture at a time
+	atomic.StoreInt32(&capturing, 1)
+	assert.Equal(http.StatusConflict, request(http.MethodPost, "/diagnostics/profiles/block?seconds=1").Code)
+	atomic.StoreInt32(&capturing, 0)
+	assert.Equal(http.StatusOK, request(http.MethodPost, "/diagnostics/profiles/block?seconds=1").Code)
+}
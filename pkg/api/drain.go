@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+)
+
+// DrainPath is the URL of the drain API, which drains the member serving
+// the API only.
+const DrainPath = "/drain"
+
+func (s *Server) drainAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    DrainPath,
+			Method:  http.MethodGet,
+			Handler: s.getDrainStatus,
+		},
+		{
+			Path:    DrainPath,
+			Method:  http.MethodPost,
+			Handler: s.startDraining,
+		},
+		{
+			Path:    DrainPath,
+			Method:  http.MethodDelete,
+			Handler: s.stopDraining,
+		},
+	}
+}
+
+func (s *Server) getDrainStatus(w http.ResponseWriter, r *http.Request) {
+	WriteBody(w, r, graceupdate.GetDrainStatus())
+}
+
+// startDraining puts the member into the draining mode, the in-flight work
+// is waited for the timeout in the query, default is the drain-timeout of
+// the member.
+func (s *Server) startDraining(w http.ResponseWriter, r *http.Request) {
+	timeout := graceupdate.DrainTimeout()
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid timeout %s", v))
+			return
+		}
+		timeout = d
+	}
+	WriteBody(w, r, graceupdate.StartDraining(timeout))
+}
+
+func (s *Server) stopDraining(w http.ResponseWriter, r *http.Request) {
+	WriteBody(w, r, graceupdate.StopDraining())
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestDrainAPI(t *testing.T) {
+	assert := assert.New(t)
+	defer graceupdate.StopDraining()
+
+	s := &Server{}
+	status := func(w *httptest.ResponseRecorder) *graceupdate.DrainStatus {
+		ds := &graceupdate.DrainStatus{}
+		assert.NoError(codectool.UnmarshalJSON(w.Body.Bytes(), ds))
+		return ds
+	}
+
+	w := httptest.NewRecorder()
+	s.getDrainStatus(w, httptest.NewRequest(http.MethodGet, DrainPath, nil))
+	assert.Equal(graceupdate.DrainStateServing, status(w).State)
+	assert.NoError(checkDrain())
+
+	w = httptest.NewRecorder()
+	s.startDraining(w, httptest.NewRequest(http.MethodPost, DrainPath+"?timeout=abc", nil))
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.False(graceupdate.IsDraining())
+
+	w = httptest.NewRecorder()
+	s.startDraining(w, httptest.NewRequest(http.MethodPost, DrainPath+"?timeout=1m", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	ds := status(w)
+	assert.NotEqual(graceupdate.DrainStateServing, ds.State)
+	deadline, err := time.Parse(time.RFC3339, ds.Deadline)
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().Add(time.Minute), deadline, 2*time.Second)
+	assert.Error(checkDrain())
+
+	w = httptest.NewRecorder()
+	s.stopDraining(w, httptest.NewRequest(http.MethodDelete, DrainPath, nil))
+	assert.Equal(graceupdate.DrainStateServing, status(w).State)
+	assert.NoError(checkDrain())
+}
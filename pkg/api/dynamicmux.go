@@ -80,6 +80,7 @@ func (m *dynamicMux) reloadAPIs() {
 	router.Use(m.newAPILogger)
 	router.Use(m.newConfigVersionAttacher)
 	router.Use(m.newRecoverer)
+	router.Use(m.newAuthenticator)
 
 	for _, apiGroup := range apiGroups {
 		for _, api := range apiGroup.Entries {
@@ -115,7 +116,7 @@ func (m *dynamicMux) reloadAPIs() {
 				router.Trace(pathV1, api.Handler)
 				router.Trace(pathV2, api.Handler)
 			default:
-				logger.Errorf("BUG: group %s unsupported method: %s",
+				logger.API.Errorf("BUG: group %s unsupported method: %s",
 					apiGroup.Group, api.Method)
 			}
 		}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// HealthzPath is the URL of the liveness API.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the URL of the readiness API.
+	ReadyzPath = "/readyz"
+
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+
+	readinessProbeTimeout = 3 * time.Second
+)
+
+type (
+	// HealthStatus is the aggregated result of the health checks.
+	HealthStatus struct {
+		Status string         `json:"status"`
+		Member string         `json:"member"`
+		Checks []*HealthCheck `json:"checks"`
+	}
+
+	// HealthCheck is the result of a health check.
+	HealthCheck struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Error    string `json:"error,omitempty"`
+		Duration string `json:"duration"`
+	}
+
+	healthChecker struct {
+		name  string
+		check func() error
+	}
+)
+
+func (s *Server) healthAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			// https://stackoverflow.com/a/43381061/1705845
+			Path:    HealthzPath,
+			Method:  http.MethodGet,
+			Handler: s.healthz,
+		},
+		{
+			Path:    ReadyzPath,
+			Method:  http.MethodGet,
+			Handler: s.readyz,
+		},
+	}
+}
+
+// healthz is the liveness API, it only checks the local components, so that
+// the member is not restarted by an outage of the cluster.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealthStatus(w, s.runHealthCheckers([]*healthChecker{
+		{name: "trafficController", check: s.checkTrafficController},
+	}))
+}
+
+// readyz is the readiness API, it checks the cluster connection and the
+// readiness probes in addition, and fails while the member is draining.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	checkers := []*healthChecker{
+		{name: "etcd", check: s.checkCluster},
+		{name: "trafficController", check: s.checkTrafficController},
+		{name: "drain", check: checkDrain},
+	}
+	for _, u := range s.opt.ReadinessProbes {
+		u := u
+		checkers = append(checkers, &healthChecker{
+			name:  "probe:" + u,
+			check: func() error { return probeURL(u) },
+		})
+	}
+	s.writeHealthStatus(w, s.runHealthCheckers(checkers))
+}
+
+// runHealthCheckers runs the checkers concurrently.
+func (s *Server) runHealthCheckers(checkers []*healthChecker) *HealthStatus {
+	status := &HealthStatus{
+		Status: healthStatusOK,
+		Member: s.opt.Name,
+		Checks: make([]*HealthCheck, len(checkers)),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range checkers {
+		wg.Add(1)
+		go func(i int, c *healthChecker) {
+			defer wg.Done()
+
+			start := time.Now()
+			result := &HealthCheck{Name: c.name, Status: healthStatusOK}
+			if err := c.check(); err != nil {
+				result.Status, result.Error = healthStatusFail, err.Error()
+			}
+			result.Duration = time.Since(start).String()
+			status.Checks[i] = result
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, c := range status.Checks {
+		if c.Status != healthStatusOK {
+			status.Status = healthStatusFail
+		}
+	}
+	return status
+}
+
+func (s *Server) writeHealthStatus(w http.ResponseWriter, status *HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(codectool.MustMarshalJSON(status))
+}
+
+// checkCluster checks the connection to etcd by reading a key.
+func (s *Server) checkCluster() error {
+	_, err := s.cluster.Get(s.cluster.Layout().ClusterNameKey())
+	return err
+}
+
+func (s *Server) checkTrafficController() (err error) {
+	entity, exists := s.super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		return fmt.Errorf("traffic controller not found")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("get status of traffic controller failed: %v", r)
+		}
+	}()
+	entity.Instance().Status()
+	return nil
+}
+
+func checkDrain() error {
+	if graceupdate.IsDraining() {
+		return fmt.Errorf("member is draining")
+	}
+	return nil
+}
+
+// probeURL sends a GET request to the URL, the probe succeeds if the status
+// code of the response is less than 400.
+func probeURL(u string) error {
+	client := &http.Client{Timeout: readinessProbeTimeout}
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	return nil
+}
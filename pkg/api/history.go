@@ -0,0 +1,423 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// RevisionsPrefix is the prefix of the revision APIs.
+	RevisionsPrefix = "/revisions"
+
+	// maxObjectRevisions is the maximum number of revisions kept for an
+	// object, the oldest ones are removed.
+	maxObjectRevisions = 10
+)
+
+type (
+	// ObjectRevision is the state of an object after it was changed in a
+	// config version.
+	ObjectRevision struct {
+		Version int64  `json:"version"`
+		Name    string `json:"name"`
+		Kind    string `json:"kind,omitempty"`
+		// Created means the object did not exist before the revision.
+		Created bool            `json:"created,omitempty"`
+		Deleted bool            `json:"deleted,omitempty"`
+		Time    string          `json:"time,omitempty"`
+		Spec    json.RawMessage `json:"spec,omitempty"`
+	}
+
+	// ObjectDiff is the difference of an object between two versions, the
+	// To version is 0 for the current one.
+	ObjectDiff struct {
+		Name string `json:"name"`
+		From int64  `json:"from"`
+		To   int64  `json:"to"`
+		Diff string `json:"diff"`
+	}
+
+	// RollbackResponse is the response of the rollback APIs, the version is
+	// 0 if nothing changed.
+	RollbackResponse struct {
+		Version int64    `json:"version"`
+		Updated []string `json:"updated"`
+		Deleted []string `json:"deleted"`
+	}
+)
+
+func (s *Server) revisionAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    RevisionsPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listRevisions,
+		},
+		{
+			Path:    RevisionsPrefix + "/{version}/rollback",
+			Method:  http.MethodPost,
+			Handler: s.rollbackAll,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}" + RevisionsPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listObjectRevisions,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}" + RevisionsPrefix + "/{version}",
+			Method:  http.MethodGet,
+			Handler: s.getObjectRevision,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}" + RevisionsPrefix + "/{version}/diff",
+			Method:  http.MethodGet,
+			Handler: s.diffObjectRevision,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}" + RevisionsPrefix + "/{version}/rollback",
+			Method:  http.MethodPost,
+			Handler: s.rollbackObject,
+		},
+	}
+}
+
+// _addRevision adds the puts and deletes of the revision to kvs, and removes
+// the oldest revisions of the object exceeding the limit.
+func (s *Server) _addRevision(kvs map[string]*string, rev *ObjectRevision) {
+	layout := s.cluster.Layout()
+	existed := s._getObject(rev.Name)
+
+	prefix := layout.ConfigObjectHistoryPrefix(rev.Name)
+	values, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	keys := make([]string, 0, len(values)+2)
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if len(keys) == 0 && existed != nil {
+		// The object was created before its history is recorded, record
+		// its current spec as the base.
+		base := &ObjectRevision{
+			Version: rev.Version - 1,
+			Name:    rev.Name,
+			Kind:    existed.Kind(),
+			Spec:    json.RawMessage(existed.JSONConfig()),
+		}
+		key := layout.ConfigObjectHistoryKey(rev.Name, base.Version)
+		value := string(codectool.MustMarshalJSON(base))
+		kvs[key] = &value
+		keys = append(keys, key)
+	}
+
+	rev.Created = existed == nil && !rev.Deleted
+	if rev.Deleted && existed != nil {
+		rev.Kind = existed.Kind()
+	}
+
+	key := layout.ConfigObjectHistoryKey(rev.Name, rev.Version)
+	value := string(codectool.MustMarshalJSON(rev))
+	kvs[key] = &value
+	keys = append(keys, key)
+
+	for len(keys) > maxObjectRevisions {
+		kvs[keys[0]] = nil
+		keys = keys[1:]
+	}
+}
+
+// _listRevisions lists the revisions of the object sorted by versions, or
+// the revisions of all objects if the name is empty.
+func (s *Server) _listRevisions(name string) []*ObjectRevision {
+	prefix := s.cluster.Layout().ConfigHistoryPrefix()
+	if name != "" {
+		prefix = s.cluster.Layout().ConfigObjectHistoryPrefix(name)
+	}
+
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	revs := make([]*ObjectRevision, 0, len(kvs))
+	for _, v := range kvs {
+		rev := &ObjectRevision{}
+		err := codectool.UnmarshalJSON([]byte(v), rev)
+		if err != nil {
+			panic(fmt.Errorf("unmarshal %s to json failed: %v", v, err))
+		}
+		revs = append(revs, rev)
+	}
+
+	sort.Slice(revs, func(i, j int) bool {
+		if revs[i].Version != revs[j].Version {
+			return revs[i].Version < revs[j].Version
+		}
+		return revs[i].Name < revs[j].Name
+	})
+
+	return revs
+}
+
+// revisionAt returns the revision of an object in effect at the version,
+// the revisions must be sorted. It returns nil if the object did not exist,
+// and an error if the revision is no longer kept.
+func revisionAt(revs []*ObjectRevision, version int64) (*ObjectRevision, error) {
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].Version <= version {
+			return revs[i], nil
+		}
+	}
+
+	if len(revs) == 0 || revs[0].Created {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("revision of %s at version %d is not kept", revs[0].Name, version)
+}
+
+// revisionYAML returns the spec of the revision in YAML, it is empty if the
+// object did not exist.
+func revisionYAML(rev *ObjectRevision) string {
+	if rev == nil || rev.Deleted {
+		return ""
+	}
+	return string(codectool.MustJSONToYAML(rev.Spec))
+}
+
+func diffRevisions(name string, from, to int64, fromRev, toRev *ObjectRevision) string {
+	toFile := fmt.Sprintf("%s@%d", name, to)
+	if to == 0 {
+		toFile = name + "@current"
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(revisionYAML(fromRev)),
+		B:        difflib.SplitLines(revisionYAML(toRev)),
+		FromFile: fmt.Sprintf("%s@%d", name, from),
+		ToFile:   toFile,
+		Context:  3,
+	})
+	return diff
+}
+
+func parseVersion(r *http.Request, param string) (int64, error) {
+	value := chi.URLParam(r, param)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid version %s", value)
+	}
+	return version, nil
+}
+
+func (s *Server) listRevisions(w http.ResponseWriter, r *http.Request) {
+	revs := s._listRevisions("")
+	for _, rev := range revs {
+		rev.Spec = nil
+	}
+	WriteBody(w, r, revs)
+}
+
+func (s *Server) listObjectRevisions(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	revs := s._listRevisions(name)
+	if len(revs) == 0 {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("no revisions of %s", name))
+		return
+	}
+	for _, rev := range revs {
+		rev.Spec = nil
+	}
+	WriteBody(w, r, revs)
+}
+
+func (s *Server) getObjectRevision(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	version, err := parseVersion(r, "version")
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, rev := range s._listRevisions(name) {
+		if rev.Version == version {
+			WriteBody(w, r, rev)
+			return
+		}
+	}
+	HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("revision %d of %s not found", version, name))
+}
+
+// diffObjectRevision shows the difference of the object between the version
+// and the version in query parameter "to", which is the current version by
+// default.
+func (s *Server) diffObjectRevision(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	from, err := parseVersion(r, "version")
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var to int64
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || to <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid version %s", v))
+			return
+		}
+	}
+
+	revs := s._listRevisions(name)
+	if len(revs) == 0 {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("no revisions of %s", name))
+		return
+	}
+
+	fromRev, err := revisionAt(revs, from)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var toRev *ObjectRevision
+	if to == 0 {
+		if spec := s._getObject(name); spec != nil {
+			toRev = &ObjectRevision{Name: name, Spec: json.RawMessage(spec.JSONConfig())}
+		}
+	} else if toRev, err = revisionAt(revs, to); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	WriteBody(w, r, &ObjectDiff{
+		Name: name,
+		From: from,
+		To:   to,
+		Diff: diffRevisions(name, from, to, fromRev, toRev),
+	})
+}
+
+func (s *Server) rollbackObject(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	version, err := parseVersion(r, "version")
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	revs := s._listRevisions(name)
+	if len(revs) == 0 {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("no revisions of %s", name))
+		return
+	}
+
+	s.rollback(w, r, version, map[string][]*ObjectRevision{name: revs})
+}
+
+// rollbackAll rolls back all the objects having revisions to the version,
+// the objects without revisions are not changed.
+func (s *Server) rollbackAll(w http.ResponseWriter, r *http.Request) {
+	version, err := parseVersion(r, "version")
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	revsByName := make(map[string][]*ObjectRevision)
+	for _, rev := range s._listRevisions("") {
+		revsByName[rev.Name] = append(revsByName[rev.Name], rev)
+	}
+
+	s.rollback(w, r, version, revsByName)
+}
+
+// rollback rolls back the objects to the version in one transaction, the
+// caller must hold the lock.
+func (s *Server) rollback(w http.ResponseWriter, r *http.Request, version int64, revsByName map[string][]*ObjectRevision) {
+	if version > s._getVersion() {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("version %d not found", version))
+		return
+	}
+
+	names := make([]string, 0, len(revsByName))
+	for name := range revsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var puts []*supervisor.Spec
+	resp := &RollbackResponse{Updated: []string{}, Deleted: []string{}}
+	var errs []string
+	for _, name := range names {
+		rev, err := revisionAt(revsByName[name], version)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		existed := s._getObject(name)
+		if rev == nil || rev.Deleted {
+			if existed != nil {
+				resp.Deleted = append(resp.Deleted, name)
+			}
+			continue
+		}
+
+		spec, err := s.super.NewSpec(string(rev.Spec))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("revision %d of %s is invalid: %v", rev.Version, name, err))
+			continue
+		}
+		if existed == nil || !existed.Equals(spec) {
+			puts = append(puts, spec)
+			resp.Updated = append(resp.Updated, name)
+		}
+	}
+
+	if len(errs) > 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s", strings.Join(errs, "; ")))
+		return
+	}
+
+	if len(puts) > 0 || len(resp.Deleted) > 0 {
+		resp.Version = s._applyObjects(r, puts, resp.Deleted)
+		s.setConfigVersion(w, resp.Version)
+	}
+	WriteBody(w, r, resp)
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	_ "github.com/megaease/easegress/pkg/object/accesslog"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newAccessLogSpec(t *testing.T, name, filename string) *supervisor.Spec {
+	spec, err := supervisor.NewSpec(fmt.Sprintf(`
+kind: AccessLog
+name: %s
+sinks:
+- kind: file
+  file:
+    filename: %s
+`, name, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestRevisionAt(t *testing.T) {
+	assert := assert.New(t)
+
+	revs := []*ObjectRevision{
+		{Name: "a", Version: 3, Created: true},
+		{Name: "a", Version: 5},
+		{Name: "a", Version: 8, Deleted: true},
+	}
+
+	rev, err := revisionAt(revs, 2)
+	assert.NoError(err)
+	assert.Nil(rev)
+
+	rev, _ = revisionAt(revs, 3)
+	assert.Equal(int64(3), rev.Version)
+	rev, _ = revisionAt(revs, 7)
+	assert.Equal(int64(5), rev.Version)
+	rev, _ = revisionAt(revs, 10)
+	assert.True(rev.Deleted)
+
+	// the revisions before version 3 are removed.
+	revs[0].Created = false
+	_, err = revisionAt(revs, 2)
+	assert.Error(err)
+}
+
+func TestObjectHistory(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	s := &Server{cluster: c}
+
+	// an object created before the history is recorded.
+	spec := newAccessLogSpec(t, "log", "/tmp/1.log")
+	data[c.Layout().ConfigObjectKey("log")] = spec.JSONConfig()
+	data[c.Layout().ConfigVersion()] = "3"
+
+	assert.Equal(int64(4), s._putObject(nil, newAccessLogSpec(t, "log", "/tmp/2.log")))
+	assert.Equal(int64(5), s._putObject(nil, newAccessLogSpec(t, "other", "/tmp/3.log")))
+	assert.Equal(int64(6), s._deleteObject(nil, "log"))
+
+	revs := s._listRevisions("log")
+	assert.Len(revs, 3)
+	assert.Equal(int64(3), revs[0].Version)
+	assert.False(revs[0].Created)
+	assert.Equal(int64(4), revs[1].Version)
+	assert.True(revs[2].Deleted)
+	assert.Equal("AccessLog", revs[2].Kind)
+	assert.True(s._listRevisions("other")[0].Created)
+	assert.Len(s._listRevisions(""), 4)
+
+	diff := diffRevisions("log", 3, 4, revs[0], revs[1])
+	assert.Contains(diff, "-        filename: /tmp/1.log")
+	assert.Contains(diff, "+        filename: /tmp/2.log")
+
+	// roll back all objects to version 4.
+	revsByName := map[string][]*ObjectRevision{}
+	for _, rev := range s._listRevisions("") {
+		revsByName[rev.Name] = append(revsByName[rev.Name], rev)
+	}
+	w := httptest.NewRecorder()
+	s.rollback(w, httptest.NewRequest("POST", "/", nil), 4, revsByName)
+	assert.Equal(200, w.Code)
+
+	resp := &RollbackResponse{}
+	codectool.MustUnmarshal(w.Body.Bytes(), resp)
+	assert.Equal(&RollbackResponse{Version: 7, Updated: []string{"log"}, Deleted: []string{"other"}}, resp)
+	assert.Nil(s._getObject("other"))
+	assert.Contains(s._getObject("log").JSONConfig(), "/tmp/2.log")
+
+	// the revisions are bounded.
+	for i := 0; i < maxObjectRevisions*2; i++ {
+		s._putObject(nil, newAccessLogSpec(t, "log", fmt.Sprintf("/tmp/%d.log", i)))
+	}
+	revs = s._listRevisions("log")
+	assert.Len(revs, maxObjectRevisions)
+	assert.True(sort.SliceIsSorted(revs, func(i, j int) bool { return revs[i].Version < revs[j].Version }))
+
+	w = httptest.NewRecorder()
+	s.rollback(w, httptest.NewRequest("POST", "/", nil), 4, map[string][]*ObjectRevision{"log": revs})
+	assert.Equal(400, w.Code)
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/cluster/kvstore"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// KVPrefix is the URL prefix of APIs for the shared key-value store.
+	KVPrefix = "/kv"
+
+	// kvPurgeInterval is the interval to purge the expired keys.
+	kvPurgeInterval = time.Minute
+)
+
+// KVValue is the request body to set the value of a key, the key never
+// expires if TTL is empty.
+type KVValue struct {
+	Value string `json:"value"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+func (s *Server) listKVNamespaces(w http.ResponseWriter, r *http.Request) {
+	prefix := s.cluster.Layout().KVPrefix()
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	namespaces := map[string]struct{}{}
+	for k := range kvs {
+		if ns, _, ok := strings.Cut(strings.TrimPrefix(k, prefix), "/"); ok {
+			namespaces[ns] = struct{}{}
+		}
+	}
+
+	result := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		result = append(result, ns)
+	}
+	sort.Strings(result)
+
+	WriteBody(w, r, result)
+}
+
+func (s *Server) listKVEntries(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+
+	entries, err := kvstore.Namespace(s.cluster, namespace).List()
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	WriteBody(w, r, entries)
+}
+
+func (s *Server) getKV(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	key := chi.URLParam(r, "key")
+
+	value, ok, err := kvstore.Namespace(s.cluster, namespace).Get(key)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if !ok {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("key %s not found in namespace %s", key, namespace))
+		return
+	}
+
+	WriteBody(w, r, &KVValue{Value: value})
+}
+
+func (s *Server) setKV(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	key := chi.URLParam(r, "key")
+
+	v := &KVValue{}
+	if err := codectool.Decode(r.Body, v); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid value: %v", err))
+		return
+	}
+
+	var ttl time.Duration
+	if v.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v.TTL); err != nil || ttl <= 0 {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid ttl %s", v.TTL))
+			return
+		}
+	}
+
+	if err := kvstore.Namespace(s.cluster, namespace).Set(key, v.Value, ttl); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) deleteKV(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	key := chi.URLParam(r, "key")
+
+	store := kvstore.Namespace(s.cluster, namespace)
+	_, ok, err := store.Get(key)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if !ok {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("key %s not found in namespace %s", key, namespace))
+		return
+	}
+
+	if err := store.Delete(key); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// purgeExpiredKV purges the expired keys of the shared key-value store
+// periodically, only the leader does the job.
+func (s *Server) purgeExpiredKV() {
+	store := kvstore.NewStore(s.cluster, s.cluster.Layout().KVPrefix())
+	for {
+		select {
+		case <-time.After(kvPurgeInterval):
+			if !s.cluster.IsLeader() {
+				continue
+			}
+			if _, err := store.Purge(); err != nil {
+				logger.API.Errorf("failed to purge expired kv: %v", err)
+			}
+
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func appendKVAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries, &Entry{
+		Path:    KVPrefix,
+		Method:  http.MethodGet,
+		Handler: s.listKVNamespaces,
+	}, &Entry{
+		Path:    KVPrefix + "/{namespace}",
+		Method:  http.MethodGet,
+		Handler: s.listKVEntries,
+	}, &Entry{
+		Path:    KVPrefix + "/{namespace}/{key}",
+		Method:  http.MethodGet,
+		Handler: s.getKV,
+	}, &Entry{
+		Path:    KVPrefix + "/{namespace}/{key}",
+		Method:  http.MethodPut,
+		Handler: s.setKV,
+	}, &Entry{
+		Path:    KVPrefix + "/{namespace}/{key}",
+		Method:  http.MethodDelete,
+		Handler: s.deleteKV,
+	})
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendKVAPI)
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/cluster/kvstore"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestKVAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	c.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	c.MockedDelete = func(key string) error {
+		delete(data, key)
+		return nil
+	}
+	s := &Server{cluster: c}
+
+	router := chi.NewRouter()
+	group := &Group{}
+	appendKVAPI(s, group)
+	for _, e := range group.Entries {
+		router.Method(e.Method, e.Path, http.HandlerFunc(e.Handler))
+	}
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, r))
+		return w
+	}
+
+	assert.Equal(http.StatusNotFound, request(http.MethodGet, "/kv/demo/flag", "").Code)
+	assert.Equal(http.StatusNotFound, request(http.MethodDelete, "/kv/demo/flag", "").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPut, "/kv/demo/flag", "value: [").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPut, "/kv/demo/flag", `{"value": "on", "ttl": "abc"}`).Code)
+	assert.Equal(http.StatusOK, request(http.MethodPut, "/kv/demo/flag", `{"value": "on", "ttl": "1h"}`).Code)
+	assert.Equal(http.StatusOK, request(http.MethodPut, "/kv/other/count", `{"value": "3"}`).Code)
+
+	w := request(http.MethodGet, "/kv/demo/flag", "")
+	assert.Equal(http.StatusOK, w.Code)
+	v := &KVValue{}
+	codectool.MustUnmarshal(w.Body.Bytes(), v)
+	assert.Equal("on", v.Value)
+
+	w = request(http.MethodGet, "/kv", "")
+	var namespaces []string
+	codectool.MustUnmarshal(w.Body.Bytes(), &namespaces)
+	assert.Equal([]string{"demo", "other"}, namespaces)
+
+	w = request(http.MethodGet, "/kv/demo", "")
+	entries := map[string]*kvstore.Entry{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &entries)
+	assert.Len(entries, 1)
+	assert.Equal("on", entries["flag"].Value)
+	assert.NotZero(entries["flag"].ExpireAt)
+
+	assert.Equal(http.StatusOK, request(http.MethodDelete, "/kv/demo/flag", "").Code)
+	assert.NotContains(data, c.Layout().KVNamespacePrefix("demo")+"flag")
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// LogLevelsPath is the URL of the log levels API, which changes the log
+// levels of the member serving the API only.
+const LogLevelsPath = "/loglevels"
+
+func (s *Server) logLevelsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    LogLevelsPath,
+			Method:  http.MethodGet,
+			Handler: s.getLogLevels,
+		},
+		{
+			Path:    LogLevelsPath,
+			Method:  http.MethodPut,
+			Handler: s.updateLogLevels,
+		},
+	}
+}
+
+func (s *Server) getLogLevels(w http.ResponseWriter, r *http.Request) {
+	WriteBody(w, r, logger.GetLevels())
+}
+
+// updateLogLevels updates the global level if it is not empty and the
+// levels of the modules in the body, an empty level of a module makes it
+// follow the global level.
+func (s *Server) updateLogLevels(w http.ResponseWriter, r *http.Request) {
+	levels := &logger.Levels{}
+	if err := codectool.Decode(r.Body, levels); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid log levels: %v", err))
+		return
+	}
+
+	if err := logger.SetLevels(levels); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	logger.API.Infof("log levels updated: %+v", levels)
+	WriteBody(w, r, logger.GetLevels())
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestLogLevelsAPI(t *testing.T) {
+	assert := assert.New(t)
+	defer logger.SetLevels(&logger.Levels{Level: "info", Modules: map[string]string{"cluster": ""}})
+
+	s := &Server{}
+	levels := func(w *httptest.ResponseRecorder) *logger.Levels {
+		l := &logger.Levels{}
+		assert.NoError(codectool.UnmarshalJSON(w.Body.Bytes(), l))
+		return l
+	}
+
+	w := httptest.NewRecorder()
+	s.updateLogLevels(w, httptest.NewRequest(http.MethodPut, LogLevelsPath, strings.NewReader(`{"modules": {"cluster": "trace"}}`)))
+	assert.Equal(http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	s.updateLogLevels(w, httptest.NewRequest(http.MethodPut, LogLevelsPath, strings.NewReader(`{"modules": {"cluster": "debug"}}`)))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("debug", levels(w).Modules["cluster"])
+
+	w = httptest.NewRecorder()
+	s.getLogLevels(w, httptest.NewRequest(http.MethodGet, LogLevelsPath, nil))
+	l := levels(w)
+	assert.Equal("info", l.Level)
+	assert.Equal("debug", l.Modules["cluster"])
+	assert.Equal("", l.Modules["proxy"])
+}
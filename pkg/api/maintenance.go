@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/filters/maintenance"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// MaintenanceFlagPrefix is the URL prefix of APIs for maintenance flags.
+const MaintenanceFlagPrefix = "/maintenance-flags"
+
+func (s *Server) listMaintenanceFlags(w http.ResponseWriter, r *http.Request) {
+	prefix := s.cluster.Layout().MaintenanceFlagPrefix()
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	flags := map[string]*maintenance.Flag{}
+	for k, v := range kvs {
+		flag := &maintenance.Flag{}
+		if err := codectool.UnmarshalJSON([]byte(v), flag); err != nil {
+			continue
+		}
+		flags[k[len(prefix):]] = flag
+	}
+
+	WriteBody(w, r, flags)
+}
+
+func (s *Server) turnOnMaintenanceFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	flag := &maintenance.Flag{}
+	if r.ContentLength != 0 {
+		if err := codectool.Decode(r.Body, flag); err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid flag: %v", err))
+			return
+		}
+	}
+	flag.Time = time.Now().Format(time.RFC3339)
+
+	key := s.cluster.Layout().MaintenanceFlagKey(name)
+	if err := s.cluster.Put(key, string(codectool.MustMarshalJSON(flag))); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) turnOffMaintenanceFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	key := s.cluster.Layout().MaintenanceFlagKey(name)
+
+	value, err := s.cluster.Get(key)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("maintenance flag %s not found", name))
+		return
+	}
+
+	if err := s.cluster.Delete(key); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func appendMaintenanceAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries, &Entry{
+		Path:    MaintenanceFlagPrefix,
+		Method:  http.MethodGet,
+		Handler: s.listMaintenanceFlags,
+	}, &Entry{
+		Path:    MaintenanceFlagPrefix + "/{name}",
+		Method:  http.MethodPut,
+		Handler: s.turnOnMaintenanceFlag,
+	}, &Entry{
+		Path:    MaintenanceFlagPrefix + "/{name}",
+		Method:  http.MethodDelete,
+		Handler: s.turnOffMaintenanceFlag,
+	})
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendMaintenanceAPI)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/filters/maintenance"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMaintenanceAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	c.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	c.MockedDelete = func(key string) error {
+		delete(data, key)
+		return nil
+	}
+	s := &Server{cluster: c}
+
+	router := chi.NewRouter()
+	group := &Group{}
+	appendMaintenanceAPI(s, group)
+	for _, e := range group.Entries {
+		router.Method(e.Method, e.Path, http.HandlerFunc(e.Handler))
+	}
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, r))
+		return w
+	}
+
+	assert.Equal(http.StatusNotFound, request(http.MethodDelete, "/maintenance-flags/db", "").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodPut, "/maintenance-flags/db", "reason: [").Code)
+	assert.Equal(http.StatusOK, request(http.MethodPut, "/maintenance-flags/db", `{"reason": "upgrade"}`).Code)
+	assert.Equal(http.StatusOK, request(http.MethodPut, "/maintenance-flags/cache", "").Code)
+
+	w := request(http.MethodGet, "/maintenance-flags", "")
+	assert.Equal(http.StatusOK, w.Code)
+	flags := map[string]*maintenance.Flag{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &flags)
+	assert.Len(flags, 2)
+	assert.Equal("upgrade", flags["db"].Reason)
+	assert.NotEmpty(flags["cache"].Time)
+
+	assert.Equal(http.StatusOK, request(http.MethodDelete, "/maintenance-flags/db", "").Code)
+	assert.NotContains(data, c.Layout().MaintenanceFlagKey("db"))
+}
@@ -31,10 +31,11 @@ import (
 func (m *dynamicMux) newAPILogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		r, ra := withRequestAuth(r)
 
 		t1 := time.Now()
 		defer func() {
-			logger.APIAccess(r.Method, r.RemoteAddr, r.URL.Path, ww.Status(),
+			logger.APIAccess(r.Method, r.RemoteAddr, ra.user(), r.URL.Path, ww.Status(),
 				r.ContentLength, int64(ww.BytesWritten()),
 				t1, time.Since(t1))
 		}()
@@ -46,7 +47,7 @@ func (m *dynamicMux) newRecoverer(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rvr := recover(); rvr != nil && rvr != http.ErrAbortHandler {
-				logger.Errorf("recover from %s, err: %v, stack trace:\n%s\n",
+				logger.API.Errorf("recover from %s, err: %v, stack trace:\n%s\n",
 					r.URL.Path, rvr, debug.Stack())
 
 				if ce, ok := rvr.(clusterErr); ok {
@@ -69,3 +70,40 @@ func (m *dynamicMux) newConfigVersionAttacher(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// newAuthenticator authenticates the clients and checks their roles if
+// the authentication is enabled, except for the public APIs. The clients
+// which are only allowed to access the objects of some kinds are checked
+// by the object APIs further.
+func (m *dynamicMux) newAuthenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := m.server.auth
+		if auth == nil || isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ra := requestAuthOf(r)
+		if ra == nil {
+			r, ra = withRequestAuth(r)
+		}
+		id := auth.authenticate(r)
+		if id == nil {
+			unauthorized(w, r)
+			return
+		}
+		ra.identity = id
+
+		verb := verbOf(r.Method)
+		switch {
+		case auth.allowed(id, verb, ""):
+			ra.fullAccess = true
+		case isObjectPath(r.URL.Path) && auth.allowedSomeKinds(id, verb):
+		default:
+			HandleAPIError(w, r, http.StatusForbidden,
+				fmt.Errorf("%s is not allowed to %s %s", id.User, verb, r.URL.Path))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,461 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/megaease/easegress/pkg/common"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// NamespacePrefix is the URL prefix of APIs for namespaces.
+	NamespacePrefix = "/namespaces"
+
+	namespacedObjectPrefix       = NamespacePrefix + "/{namespace}" + ObjectPrefix
+	namespacedStatusObjectPrefix = NamespacePrefix + "/{namespace}" + StatusObjectPrefix
+)
+
+// Namespace is a namespace of the admin APIs, the admins of a namespace
+// could only manage the objects created in it, so that multiple teams
+// could share one cluster.
+type Namespace struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Admins maps the usernames of the admins to their passwords, the
+	// passwords are bcrypt hashed before being stored.
+	Admins map[string]string `json:"admins"`
+}
+
+// Validate validates Namespace.
+func (ns *Namespace) Validate() error {
+	if err := common.ValidateName(ns.Name); err != nil {
+		return fmt.Errorf("invalid name: %v", err)
+	}
+	if len(ns.Admins) == 0 {
+		return fmt.Errorf("no admins")
+	}
+	for user, password := range ns.Admins {
+		if user == "" || strings.Contains(user, ":") {
+			return fmt.Errorf("invalid username %q", user)
+		}
+		if password == "" {
+			return fmt.Errorf("empty password of %s", user)
+		}
+	}
+	return nil
+}
+
+// hashPasswords hashes the passwords which are not hashed yet.
+func (ns *Namespace) hashPasswords() error {
+	for user, password := range ns.Admins {
+		if _, err := bcrypt.Cost([]byte(password)); err == nil {
+			continue
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		ns.Admins[user] = string(hash)
+	}
+	return nil
+}
+
+func (s *Server) namespaceAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    NamespacePrefix,
+			Method:  http.MethodGet,
+			Handler: s.listNamespaces,
+		},
+		{
+			Path:    NamespacePrefix,
+			Method:  http.MethodPost,
+			Handler: s.createNamespace,
+		},
+		{
+			Path:    NamespacePrefix + "/{namespace}",
+			Method:  http.MethodGet,
+			Handler: s.getNamespace,
+		},
+		{
+			Path:    NamespacePrefix + "/{namespace}",
+			Method:  http.MethodPut,
+			Handler: s.updateNamespace,
+		},
+		{
+			Path:    NamespacePrefix + "/{namespace}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteNamespace,
+		},
+		{
+			Path:    namespacedObjectPrefix,
+			Method:  http.MethodGet,
+			Handler: s.namespaceAdmin(s.listNamespacedObjects),
+		},
+		{
+			Path:    namespacedObjectPrefix,
+			Method:  http.MethodPost,
+			Handler: s.namespaceAdmin(s.createNamespacedObject),
+		},
+		{
+			Path:    namespacedObjectPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.namespaceAdmin(s.getNamespacedObject),
+		},
+		{
+			Path:    namespacedObjectPrefix + "/{name}",
+			Method:  http.MethodPut,
+			Handler: s.namespaceAdmin(s.updateNamespacedObject),
+		},
+		{
+			Path:    namespacedObjectPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.namespaceAdmin(s.deleteNamespacedObject),
+		},
+		{
+			Path:    namespacedStatusObjectPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.namespaceAdmin(s.getNamespacedStatusObject),
+		},
+	}
+}
+
+func (s *Server) _getNamespace(name string) *Namespace {
+	value, err := s.cluster.Get(s.cluster.Layout().APINamespaceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	ns := &Namespace{}
+	if err = codectool.UnmarshalJSON([]byte(*value), ns); err != nil {
+		panic(fmt.Errorf("bad namespace(err: %v) from json: %s", err, *value))
+	}
+	return ns
+}
+
+func (s *Server) _putNamespace(ns *Namespace) {
+	value := string(codectool.MustMarshalJSON(ns))
+	if err := s.cluster.Put(s.cluster.Layout().APINamespaceKey(ns.Name), value); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// _listNamespacedObjects returns the names of the objects in the namespace.
+func (s *Server) _listNamespacedObjects(namespace string) []string {
+	prefix := s.cluster.Layout().ObjectNamespacePrefix()
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	var names []string
+	for k, v := range kvs {
+		if v == namespace {
+			names = append(names, strings.TrimPrefix(k, prefix))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// _getNamespacedObject returns the object if it is in the namespace.
+func (s *Server) _getNamespacedObject(namespace, name string) *supervisor.Spec {
+	value, err := s.cluster.Get(s.cluster.Layout().ObjectNamespaceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil || *value != namespace {
+		return nil
+	}
+	return s._getObject(name)
+}
+
+func (s *Server) readNamespace(r *http.Request) (*Namespace, error) {
+	ns := &Namespace{}
+	if err := codectool.Decode(r.Body, ns); err != nil {
+		return nil, fmt.Errorf("invalid namespace: %v", err)
+	}
+	if err := ns.Validate(); err != nil {
+		return nil, err
+	}
+	if name := chi.URLParam(r, "namespace"); name != "" && name != ns.Name {
+		return nil, fmt.Errorf("inconsistent name in url and spec")
+	}
+	return ns, nil
+}
+
+func (s *Server) listNamespaces(w http.ResponseWriter, r *http.Request) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().APINamespacePrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	namespaces := make([]*Namespace, 0, len(kvs))
+	for _, v := range kvs {
+		ns := &Namespace{}
+		if err := codectool.UnmarshalJSON([]byte(v), ns); err != nil {
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+
+	WriteBody(w, r, namespaces)
+}
+
+func (s *Server) createNamespace(w http.ResponseWriter, r *http.Request) {
+	ns, err := s.readNamespace(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = ns.hashPasswords(); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getNamespace(ns.Name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", ns.Name))
+		return
+	}
+	s._putNamespace(ns)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) getNamespace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "namespace")
+
+	ns := s._getNamespace(name)
+	if ns == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("namespace %s not found", name))
+		return
+	}
+
+	WriteBody(w, r, ns)
+}
+
+func (s *Server) updateNamespace(w http.ResponseWriter, r *http.Request) {
+	ns, err := s.readNamespace(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = ns.hashPasswords(); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getNamespace(ns.Name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("namespace %s not found", ns.Name))
+		return
+	}
+	s._putNamespace(ns)
+}
+
+func (s *Server) deleteNamespace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "namespace")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getNamespace(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("namespace %s not found", name))
+		return
+	}
+	if objects := s._listNamespacedObjects(name); len(objects) > 0 {
+		HandleAPIError(w, r, http.StatusConflict,
+			fmt.Errorf("namespace %s still has objects: %s", name, strings.Join(objects, ", ")))
+		return
+	}
+
+	if err := s.cluster.Delete(s.cluster.Layout().APINamespaceKey(name)); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+// namespaceAdmin only allows the clients with the full access and the
+// admins of the namespace to call next.
+func (s *Server) namespaceAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "namespace")
+		if !s.isNamespaceAdmin(r, name) {
+			unauthorized(w, r)
+			return
+		}
+		if s._getNamespace(name) == nil {
+			HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("namespace %s not found", name))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// readNamespacedObjectSpec reads the spec of an object in the namespace,
+// only the traffic gates and pipelines are allowed, and they could only
+// reference the objects in the same namespace.
+func (s *Server) readNamespacedObjectSpec(w http.ResponseWriter, r *http.Request) (*supervisor.Spec, error) {
+	spec, err := s.readObjectSpec(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch spec.Category() {
+	case supervisor.CategoryTrafficGate, supervisor.CategoryPipeline:
+	default:
+		return nil, fmt.Errorf("kind %s is not allowed in namespaces", spec.Kind())
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	err = checkReferences(spec, func(name string) *supervisor.Spec {
+		return s._getNamespacedObject(namespace, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func (s *Server) listNamespacedObjects(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+
+	var specs specList
+	for _, name := range s._listNamespacedObjects(namespace) {
+		if spec := s._getObject(name); spec != nil {
+			specs = append(specs, spec)
+		}
+	}
+
+	WriteBody(w, r, specs)
+}
+
+func (s *Server) createNamespacedObject(w http.ResponseWriter, r *http.Request) {
+	spec, err := s.readNamespacedObjectSpec(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	name := spec.Name()
+	namespace := chi.URLParam(r, "namespace")
+
+	s.Lock()
+	defer s.Unlock()
+
+	// the names of objects are unique in the cluster.
+	if s._getObject(name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("conflict name: %s", name))
+		return
+	}
+
+	version := s._applyObjectsInNamespace(r, namespace, []*supervisor.Spec{spec}, nil)
+	s.setConfigVersion(w, version)
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", r.URL.Path, name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) getNamespacedObject(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	spec := s._getNamespacedObject(namespace, name)
+	if spec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	WriteBody(w, r, spec)
+}
+
+func (s *Server) updateNamespacedObject(w http.ResponseWriter, r *http.Request) {
+	spec, err := s.readNamespacedObjectSpec(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	s.Lock()
+	defer s.Unlock()
+
+	existedSpec := s._getNamespacedObject(namespace, spec.Name())
+	if existedSpec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	if existedSpec.Kind() != spec.Kind() {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("different kinds: %s, %s",
+				existedSpec.Kind(), spec.Kind()))
+		return
+	}
+
+	version := s._applyObjectsInNamespace(r, namespace, []*supervisor.Spec{spec}, nil)
+	s.setConfigVersion(w, version)
+}
+
+func (s *Server) deleteNamespacedObject(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s._getNamespacedObject(namespace, name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	version := s._deleteObject(r, name)
+	s.setConfigVersion(w, version)
+}
+
+func (s *Server) getNamespacedStatusObject(w http.ResponseWriter, r *http.Request) {
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	if s._getNamespacedObject(namespace, name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	WriteBody(w, r, s._getStatusObject(name))
+}
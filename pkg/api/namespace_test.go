@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestIsPublicPath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isPublicPath("/apis/v2/healthz"))
+	assert.True(isPublicPath("/apis/v1/readyz/"))
+	assert.True(isPublicPath("/apis/v2/namespaces/team/objects"))
+	assert.True(isPublicPath("/apis/v2/namespaces/team/objects/pipeline"))
+	assert.False(isPublicPath("/apis/v2/namespaces"))
+	assert.False(isPublicPath("/apis/v2/namespaces/team"))
+	assert.False(isPublicPath("/apis/v2/objects"))
+	assert.False(isPublicPath("/healthz"))
+}
+
+func TestNamespaceAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	c.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	c.MockedDelete = func(key string) error {
+		delete(data, key)
+		return nil
+	}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("root-pass"), bcrypt.MinCost)
+	opt := &option.Options{APIAdminUsers: map[string]string{"root": string(hash)}}
+	s := &Server{opt: opt, cluster: c, super: supervisor.NewDefaultMock(), auth: newAPIAuth(opt)}
+
+	m := &dynamicMux{server: s}
+	router := chi.NewRouter()
+	router.Use(m.newAuthenticator)
+	for _, e := range append(s.objectAPIEntries(), s.namespaceAPIEntries()...) {
+		router.Method(e.Method, APIPrefixV2+e.Path, http.HandlerFunc(e.Handler))
+	}
+	request := func(user, method, path, body string) *httptest.ResponseRecorder {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, APIPrefixV2+path, r)
+		if user != "" {
+			req.SetBasicAuth(user, user+"-pass")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// only the cluster admins manage the namespaces.
+	assert.Equal(http.StatusUnauthorized, request("", http.MethodGet, "/objects", "").Code)
+	assert.Equal(http.StatusUnauthorized, request("", http.MethodPost, "/namespaces", `{"name": "a", "admins": {"alice": "alice-pass"}}`).Code)
+	assert.Equal(http.StatusBadRequest, request("root", http.MethodPost, "/namespaces", `{"name": "a"}`).Code)
+	assert.Equal(http.StatusCreated, request("root", http.MethodPost, "/namespaces", `{"name": "a", "admins": {"alice": "alice-pass"}}`).Code)
+	assert.Equal(http.StatusCreated, request("root", http.MethodPost, "/namespaces", `{"name": "b", "admins": {"bob": "bob-pass"}}`).Code)
+	assert.Equal(http.StatusConflict, request("root", http.MethodPost, "/namespaces", `{"name": "b", "admins": {"bob": "bob-pass"}}`).Code)
+	assert.Equal(http.StatusUnauthorized, request("alice", http.MethodGet, "/namespaces", "").Code)
+
+	w := request("root", http.MethodGet, "/namespaces/a", "")
+	assert.Equal(http.StatusOK, w.Code)
+	ns := &Namespace{}
+	codectool.MustUnmarshal(w.Body.Bytes(), ns)
+	assert.NotEqual("alice-pass", ns.Admins["alice"])
+
+	// the namespace admins manage the objects in their namespaces only.
+	pipeline := "kind: Pipeline\nname: pipeline-a\nfilters: []"
+	assert.Equal(http.StatusUnauthorized, request("bob", http.MethodPost, "/namespaces/a/objects", pipeline).Code)
+	assert.Equal(http.StatusCreated, request("alice", http.MethodPost, "/namespaces/a/objects", pipeline).Code)
+	assert.Equal(http.StatusConflict, request("bob", http.MethodPost, "/namespaces/b/objects", pipeline).Code)
+	assert.Equal(http.StatusNotFound, request("bob", http.MethodGet, "/namespaces/b/objects/pipeline-a", "").Code)
+	assert.Equal(http.StatusNotFound, request("bob", http.MethodDelete, "/namespaces/b/objects/pipeline-a", "").Code)
+	assert.Equal(http.StatusOK, request("alice", http.MethodGet, "/namespaces/a/objects/pipeline-a", "").Code)
+	assert.Equal(http.StatusOK, request("root", http.MethodGet, "/namespaces/a/objects/pipeline-a", "").Code)
+
+	// the objects could only reference the objects in the same namespace.
+	server := "kind: GRPCServer\nname: server-b\nport: 10080\nrules:\n- methods:\n  - backend: pipeline-a"
+	w = request("bob", http.MethodPost, "/namespaces/b/objects", server)
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "not found")
+
+	// only traffic gates and pipelines are allowed.
+	s._putObject(nil, newAccessLogSpec(t, "log", "/tmp/access.log"))
+	w = request("alice", http.MethodPut, "/namespaces/a/objects/log", s._getObject("log").JSONConfig())
+	assert.Equal(http.StatusBadRequest, w.Code)
+	assert.Contains(w.Body.String(), "not allowed")
+
+	w = request("alice", http.MethodGet, "/namespaces/a/objects", "")
+	var specs []map[string]interface{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &specs)
+	assert.Len(specs, 1)
+	assert.Equal("pipeline-a", specs[0]["name"])
+
+	// a namespace with objects can't be deleted.
+	assert.Equal(http.StatusConflict, request("root", http.MethodDelete, "/namespaces/a", "").Code)
+	assert.Equal(http.StatusOK, request("alice", http.MethodDelete, "/namespaces/a/objects/pipeline-a", "").Code)
+	assert.NotContains(data, c.Layout().ObjectNamespaceKey("pipeline-a"))
+	assert.Equal(http.StatusOK, request("root", http.MethodDelete, "/namespaces/a", "").Code)
+	assert.Equal(http.StatusUnauthorized, request("alice", http.MethodGet, "/namespaces/a/objects", "").Code)
+	assert.Equal(http.StatusNotFound, request("root", http.MethodGet, "/namespaces/a/objects", "").Code)
+}
@@ -22,6 +22,7 @@ import (
 	"io"
 	"net/http"
 	"sort"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
@@ -104,17 +105,29 @@ func (s *Server) readObjectSpec(w http.ResponseWriter, r *http.Request) (*superv
 	return spec, err
 }
 
-func (s *Server) upgradeConfigVersion(w http.ResponseWriter, r *http.Request) {
-	version := s._plusOneVersion()
+func (s *Server) setConfigVersion(w http.ResponseWriter, version int64) {
 	w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
 }
 
+// forbidKind responds 403 if the request is not allowed to access the
+// objects of kind, it returns whether the request is forbidden.
+func (s *Server) forbidKind(w http.ResponseWriter, r *http.Request, kind string) bool {
+	if s.kindAllowed(r, kind) {
+		return false
+	}
+	HandleAPIError(w, r, http.StatusForbidden, fmt.Errorf("not allowed to access %s", kind))
+	return true
+}
+
 func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 	spec, err := s.readObjectSpec(w, r)
 	if err != nil {
 		HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
 	}
+	if s.forbidKind(w, r, spec.Kind()) {
+		return
+	}
 
 	name := spec.Name()
 
@@ -127,8 +140,8 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
-	s.upgradeConfigVersion(w, r)
+	version := s._putObject(r, spec)
+	s.setConfigVersion(w, version)
 
 	w.WriteHeader(http.StatusCreated)
 	location := fmt.Sprintf("%s/%s", r.URL.Path, name)
@@ -146,9 +159,12 @@ func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
 		return
 	}
+	if s.forbidKind(w, r, spec.Kind()) {
+		return
+	}
 
-	s._deleteObject(name)
-	s.upgradeConfigVersion(w, r)
+	version := s._deleteObject(r, name)
+	s.setConfigVersion(w, version)
 }
 
 func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
@@ -161,6 +177,9 @@ func (s *Server) getObject(w http.ResponseWriter, r *http.Request) {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
 		return
 	}
+	if s.forbidKind(w, r, spec.Kind()) {
+		return
+	}
 
 	WriteBody(w, r, spec)
 }
@@ -171,6 +190,9 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
 	}
+	if s.forbidKind(w, r, spec.Kind()) {
+		return
+	}
 
 	name := spec.Name()
 
@@ -190,13 +212,18 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s._putObject(spec)
-	s.upgradeConfigVersion(w, r)
+	version := s._putObject(r, spec)
+	s.setConfigVersion(w, version)
 }
 
 func (s *Server) listObjects(w http.ResponseWriter, r *http.Request) {
 	// No need to lock.
-	specs := specList(s._listObjects())
+	var specs specList
+	for _, spec := range s._listObjects() {
+		if s.kindAllowed(r, spec.Kind()) {
+			specs = append(specs, spec)
+		}
+	}
 	// NOTE: Keep it consistent.
 	sort.Sort(specs)
 
@@ -212,6 +239,9 @@ func (s *Server) getStatusObject(w http.ResponseWriter, r *http.Request) {
 		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
 		return
 	}
+	if s.forbidKind(w, r, spec.Kind()) {
+		return
+	}
 
 	status := s._getStatusObject(name)
 
@@ -222,6 +252,18 @@ func (s *Server) listStatusObjects(w http.ResponseWriter, r *http.Request) {
 	// No need to lock.
 
 	status := s._listStatusObjects()
+	if ra := requestAuthOf(r); s.auth != nil && ra != nil && !ra.fullAccess {
+		allowed := map[string]bool{}
+		for _, spec := range s._listObjects() {
+			allowed[spec.Name()] = s.kindAllowed(r, spec.Kind())
+		}
+		// the keys are in the format of namespace/name/member.
+		for k := range status {
+			if parts := strings.Split(k, "/"); len(parts) < 2 || !allowed[parts[1]] {
+				delete(status, k)
+			}
+		}
+	}
 
 	WriteBody(w, r, status)
 }
@@ -256,3 +298,37 @@ func (s *Server) listObjectKinds(w http.ResponseWriter, r *http.Request) {
 
 	WriteBody(w, r, kinds)
 }
+
+func (s *Server) isFilterExist(pipeline, filter, kind string) bool {
+	spec := s._getObject(pipeline)
+	if spec == nil {
+		return false
+	}
+
+	rawSpec := spec.RawSpec()
+	var filters []interface{}
+	if f := rawSpec["filters"]; f != nil {
+		filters, _ = f.([]interface{})
+	}
+	if filters == nil {
+		return false
+	}
+
+	for i := range filters {
+		var name, k interface{}
+		switch f := filters[i].(type) {
+		case map[string]interface{}:
+			name, k = f["name"], f["kind"]
+		case map[interface{}]interface{}:
+			name, k = f["name"], f["kind"]
+		default:
+			continue
+		}
+
+		if name == filter && k == kind {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/util/openapi"
+)
+
+// OpenAPIPrefix is the URL prefix of the OpenAPI import API.
+const OpenAPIPrefix = "/openapi"
+
+func (s *Server) openAPIAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    OpenAPIPrefix + "/{name}",
+			Method:  http.MethodPost,
+			Handler: s.applyOpenAPI,
+		},
+	}
+}
+
+// applyOpenAPI generates the HTTPServer and the pipelines of the OpenAPI
+// document in the body, and applies them in one transaction. The pipelines
+// of the operations removed from the document since the last apply are
+// deleted, so that the routes are kept in sync with the document. The
+// generated objects are returned without being applied if dryRun is true.
+func (s *Server) applyOpenAPI(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	query := r.URL.Query()
+
+	port, err := strconv.ParseUint(query.Get("port"), 10, 16)
+	if err != nil || port == 0 {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid port %q", query.Get("port")))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	doc, err := openapi.Parse(body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	docs, err := openapi.Generate(doc, &openapi.GenerateOptions{
+		Name:    name,
+		Port:    uint16(port),
+		Servers: query["server"],
+	})
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	specs, err := s.newObjectSpecs(docs)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if dryRun, _ := strconv.ParseBool(query.Get("dryRun")); dryRun {
+		WriteBody(w, r, docs)
+		return
+	}
+
+	generated := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		generated[spec.Name()] = true
+	}
+	s.applySpecs(w, r, specs, func() []string {
+		return s._staleOpenAPIPipelines(name, generated)
+	})
+}
+
+// _staleOpenAPIPipelines returns the pipelines routed by the HTTPServer
+// generated from an OpenAPI document which are not generated any more.
+func (s *Server) _staleOpenAPIPipelines(name string, generated map[string]bool) []string {
+	server := s._getObject(name)
+	if server == nil {
+		return nil
+	}
+
+	var result []string
+	seen := map[string]bool{}
+	for _, backend := range openapi.Backends(server.RawSpec()) {
+		if generated[backend] || seen[backend] || !strings.HasPrefix(backend, name+"-") {
+			continue
+		}
+		// only the pipelines generated by the previous apply are deleted.
+		if spec := s._getObject(backend); spec != nil && spec.Kind() == "Pipeline" {
+			seen[backend] = true
+			result = append(result, backend)
+		}
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestApplyOpenAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _ := clustertest.NewMemoryCluster()
+	s := &Server{cluster: c, super: supervisor.NewDefaultMock()}
+
+	apply := func(query, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", OpenAPIPrefix+"/petstore?"+query, strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("name", "petstore")
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		s.applyOpenAPI(w, r)
+		return w
+	}
+
+	const doc = `{"openapi": "3.0.0", "paths": {"/pets": {"get": {}}}}`
+
+	w := apply("", doc)
+	assert.Equal(400, w.Code)
+	assert.Contains(w.Body.String(), "port")
+
+	w = apply("port=8080", `{"swagger": "2.0"}`)
+	assert.Equal(400, w.Code)
+	assert.Contains(w.Body.String(), "version")
+
+	// no upstream servers
+	w = apply("port=8080", doc)
+	assert.Equal(400, w.Code)
+	assert.Contains(w.Body.String(), "upstream")
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/filters/retryqueue"
+)
+
+// findRetryQueue returns the RetryQueue running on this member, it writes
+// the error and returns nil if not found.
+func findRetryQueue(w http.ResponseWriter, r *http.Request) *retryqueue.RetryQueue {
+	pipeline := chi.URLParam(r, "pipeline")
+	filter := chi.URLParam(r, "filter")
+	rq := retryqueue.Find(pipeline, filter)
+	if rq == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("retry queue %s/%s not found", pipeline, filter))
+	}
+	return rq
+}
+
+func (s *Server) listRetryQueueItems(w http.ResponseWriter, r *http.Request) {
+	rq := findRetryQueue(w, r)
+	if rq == nil {
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	if state != "" && state != retryqueue.StatePending && state != retryqueue.StateDead {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid state %s, must be pending or dead", state))
+		return
+	}
+
+	items, err := rq.Items(state)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("list items failed: %v", err))
+		return
+	}
+	WriteBody(w, r, items)
+}
+
+func (s *Server) getRetryQueueItem(w http.ResponseWriter, r *http.Request) {
+	rq := findRetryQueue(w, r)
+	if rq == nil {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	item, err := rq.Item(id)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("get item %s failed: %v", id, err))
+		return
+	}
+	if item == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("item %s not found", id))
+		return
+	}
+	WriteBody(w, r, item)
+}
+
+func (s *Server) deleteRetryQueueItem(w http.ResponseWriter, r *http.Request) {
+	rq := findRetryQueue(w, r)
+	if rq == nil {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	found, err := rq.DeleteItem(id)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("delete item %s failed: %v", id, err))
+		return
+	}
+	if !found {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("item %s not found", id))
+	}
+}
+
+func (s *Server) requeueRetryQueueItem(w http.ResponseWriter, r *http.Request) {
+	rq := findRetryQueue(w, r)
+	if rq == nil {
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	found, err := rq.Requeue(id)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("requeue item %s failed: %v", id, err))
+		return
+	}
+	if !found {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("item %s not found", id))
+	}
+}
+
+func (s *Server) requeueRetryQueueDeadItems(w http.ResponseWriter, r *http.Request) {
+	rq := findRetryQueue(w, r)
+	if rq == nil {
+		return
+	}
+
+	n, err := rq.RequeueDead()
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("requeue dead items failed: %v", err))
+		return
+	}
+	WriteBody(w, r, map[string]int{"requeued": n})
+}
+
+func appendRetryQueueAPI(s *Server, group *Group) {
+	group.Entries = append(group.Entries, &Entry{
+		Path:    "/retryqueues/{pipeline}/{filter}",
+		Method:  http.MethodGet,
+		Handler: s.listRetryQueueItems,
+	}, &Entry{
+		Path:    "/retryqueues/{pipeline}/{filter}/requeue",
+		Method:  http.MethodPost,
+		Handler: s.requeueRetryQueueDeadItems,
+	}, &Entry{
+		Path:    "/retryqueues/{pipeline}/{filter}/items/{id}",
+		Method:  http.MethodGet,
+		Handler: s.getRetryQueueItem,
+	}, &Entry{
+		Path:    "/retryqueues/{pipeline}/{filter}/items/{id}",
+		Method:  http.MethodDelete,
+		Handler: s.deleteRetryQueueItem,
+	}, &Entry{
+		Path:    "/retryqueues/{pipeline}/{filter}/items/{id}/requeue",
+		Method:  http.MethodPost,
+		Handler: s.requeueRetryQueueItem,
+	})
+}
+
+func init() {
+	appendAddonAPIs = append(appendAddonAPIs, appendRetryQueueAPI)
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/retryqueue"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestRetryQueueAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(fmt.Sprintf(`
+kind: RetryQueue
+name: rq
+url: http://127.0.0.1:1
+storage: local
+path: %s
+pollInterval: 1h
+`, filepath.Join(t.TempDir(), "queue.db"))), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(err)
+	filter := filters.Create(spec)
+	filter.Init()
+	defer filter.Close()
+
+	for i := 0; i < 2; i++ {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/hooks", strings.NewReader("event"))
+		req, _ := httpprot.NewRequest(stdr)
+		req.FetchPayload(0)
+		ctx := context.New(nil)
+		ctx.SetInputRequest(req)
+		filter.Handle(ctx)
+	}
+
+	s := &Server{}
+	router := chi.NewRouter()
+	group := &Group{}
+	appendRetryQueueAPI(s, group)
+	for _, e := range group.Entries {
+		router.Method(e.Method, e.Path, http.HandlerFunc(e.Handler))
+	}
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	assert.Equal(http.StatusNotFound, request(http.MethodGet, "/retryqueues/pipeline/other").Code)
+	assert.Equal(http.StatusBadRequest, request(http.MethodGet, "/retryqueues/pipeline/rq?state=other").Code)
+	assert.Equal(http.StatusNotFound, request(http.MethodGet, "/retryqueues/pipeline/rq/items/none").Code)
+	assert.Equal(http.StatusNotFound, request(http.MethodDelete, "/retryqueues/pipeline/rq/items/none").Code)
+	assert.Equal(http.StatusNotFound, request(http.MethodPost, "/retryqueues/pipeline/rq/items/none/requeue").Code)
+
+	w := request(http.MethodGet, "/retryqueues/pipeline/rq?state=pending")
+	assert.Equal(http.StatusOK, w.Code)
+	items := []*retryqueue.Item{}
+	codectool.MustUnmarshal(w.Body.Bytes(), &items)
+	assert.Len(items, 2)
+
+	id := items[0].ID
+	w = request(http.MethodGet, "/retryqueues/pipeline/rq/items/"+id)
+	assert.Equal(http.StatusOK, w.Code)
+	item := &retryqueue.Item{}
+	codectool.MustUnmarshal(w.Body.Bytes(), item)
+	assert.Equal("/hooks", item.URL)
+
+	assert.Equal(http.StatusOK, request(http.MethodPost, "/retryqueues/pipeline/rq/items/"+id+"/requeue").Code)
+	assert.Equal(http.StatusOK, request(http.MethodDelete, "/retryqueues/pipeline/rq/items/"+id).Code)
+
+	w = request(http.MethodPost, "/retryqueues/pipeline/rq/requeue")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"requeued":0`)
+
+	w = request(http.MethodGet, "/retryqueues/pipeline/rq")
+	codectool.MustUnmarshal(w.Body.Bytes(), &items)
+	assert.Len(items, 1)
+}
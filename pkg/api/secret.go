@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/cluster/secret"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// SecretPrefix is the URL prefix of APIs for secrets
+	SecretPrefix = "/secrets"
+)
+
+func (s *Server) secretAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    SecretPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listSecrets,
+		},
+		{
+			Path:    SecretPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getSecret,
+		},
+		{
+			Path:    SecretPrefix,
+			Method:  http.MethodPut,
+			Handler: s.putSecret,
+		},
+		{
+			Path:    SecretPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteSecret,
+		},
+	}
+}
+
+func secretStore(w http.ResponseWriter, r *http.Request) *secret.Store {
+	store := secret.GetGlobalStore()
+	if store == nil {
+		HandleAPIError(w, r, http.StatusServiceUnavailable, fmt.Errorf("secret store is not ready"))
+	}
+	return store
+}
+
+// NOTE: the values of the secrets are never returned by the APIs.
+func (s *Server) listSecrets(w http.ResponseWriter, r *http.Request) {
+	store := secretStore(w, r)
+	if store == nil {
+		return
+	}
+
+	secrets, err := store.List()
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	result := make([]*secret.Info, 0, len(secrets))
+	for _, sec := range secrets {
+		result = append(result, sec.Info())
+	}
+
+	WriteBody(w, r, result)
+}
+
+func (s *Server) getSecret(w http.ResponseWriter, r *http.Request) {
+	store := secretStore(w, r)
+	if store == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	sec, err := store.Get(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if sec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	WriteBody(w, r, sec.Info())
+}
+
+func (s *Server) putSecret(w http.ResponseWriter, r *http.Request) {
+	store := secretStore(w, r)
+	if store == nil {
+		return
+	}
+
+	sec := &secret.Secret{}
+	codectool.MustDecode(r.Body, sec)
+
+	if err := store.Put(sec); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+}
+
+func (s *Server) deleteSecret(w http.ResponseWriter, r *http.Request) {
+	store := secretStore(w, r)
+	if store == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := store.Delete(name); err != nil {
+		ClusterPanic(err)
+	}
+}
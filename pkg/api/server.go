@@ -19,12 +19,18 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/consumer"
 	"github.com/megaease/easegress/pkg/cluster/customdata"
+	"github.com/megaease/easegress/pkg/cluster/tlscert"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/option"
 	pprof "github.com/megaease/easegress/pkg/profile"
@@ -40,10 +46,11 @@ type (
 		cluster cluster.Cluster
 		super   *supervisor.Supervisor
 		cds     *customdata.Store
+		tcs     *tlscert.Store
+		cs      *consumer.Store
 		profile pprof.Profile
-
-		mutex      cluster.Mutex
-		mutexMutex sync.Mutex
+		auth    *apiAuth
+		done    chan struct{}
 	}
 
 	// Group is the API group
@@ -67,24 +74,49 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 		cluster: cls,
 		super:   super,
 		profile: profile,
+		auth:    newAPIAuth(opt),
+		done:    make(chan struct{}),
 	}
 	s.router = newDynamicMux(s)
 	s.server = http.Server{Addr: opt.APIAddr, Handler: s.router}
+	if caFile := opt.APIAuth.ClientCAFile; caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			logger.API.Errorf("load client ca file %s failed, client certificates are rejected: %v", caFile, err)
+			pool = x509.NewCertPool()
+		}
+		s.server.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+		}
+	}
 
 	_, err := s.getMutex()
 	if err != nil {
-		logger.Errorf("get cluster mutex %s failed: %v", lockKey, err)
+		logger.API.Errorf("get cluster mutex %s failed: %v", lockKey, err)
 	}
 
 	kindPrefix := cls.Layout().CustomDataKindPrefix()
 	dataPrefix := cls.Layout().CustomDataPrefix()
 	s.cds = customdata.NewStore(cls, kindPrefix, dataPrefix)
+	s.tcs = tlscert.NewStore(cls)
+	s.cs = consumer.NewStore(cls)
 
 	s.registerAPIs()
+	go s.purgeExpiredKV()
+	go s.purgeAuditLog()
 
 	go func() {
-		logger.Infof("api server running in %s", opt.APIAddr)
-		s.server.ListenAndServe()
+		logger.API.Infof("api server running in %s", opt.APIAddr)
+		var err error
+		if opt.APIAuth.TLSCertFile != "" {
+			err = s.server.ListenAndServeTLS(opt.APIAuth.TLSCertFile, opt.APIAuth.TLSKeyFile)
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logger.API.Errorf("api server failed: %v", err)
+		}
 	}()
 
 	return s
@@ -93,25 +125,46 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 // Close closes Server.
 func (s *Server) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
+	close(s.done)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	if err := s.server.Shutdown(ctx); err != nil {
-		logger.Errorf("gracefully shutdown the server failed: %v", err)
+		logger.API.Errorf("gracefully shutdown the server failed: %v", err)
 	}
 
 	s.router.close()
 
-	logger.Infof("server stopped")
+	logger.API.Infof("server stopped")
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return pool, nil
 }
 
+// clusterMutexes caches the mutexes of the clusters. They are shared by the
+// Server and the ObjectStores, because the mutexes with the same name created
+// from the same etcd session don't exclude each other.
+var (
+	clusterMutexes      = map[cluster.Cluster]cluster.Mutex{}
+	clusterMutexesMutex sync.Mutex
+)
+
 func (s *Server) getMutex() (cluster.Mutex, error) {
-	s.mutexMutex.Lock()
-	defer s.mutexMutex.Unlock()
+	clusterMutexesMutex.Lock()
+	defer clusterMutexesMutex.Unlock()
 
-	if s.mutex != nil {
-		return s.mutex, nil
+	if mutex := clusterMutexes[s.cluster]; mutex != nil {
+		return mutex, nil
 	}
 
 	mutex, err := s.cluster.Mutex(lockKey)
@@ -119,9 +172,9 @@ func (s *Server) getMutex() (cluster.Mutex, error) {
 		return nil, err
 	}
 
-	s.mutex = mutex
+	clusterMutexes[s.cluster] = mutex
 
-	return s.mutex, nil
+	return mutex, nil
 }
 
 // Lock locks cluster operations.
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+// ObjectStore reads and writes the objects like the object APIs, it is used
+// by the controllers managing objects, e.g. ConfigSync, so that their
+// changes are also serialized by the cluster lock, and recorded in the
+// config versions and revisions.
+type ObjectStore struct {
+	s *Server
+}
+
+// NewObjectStore creates an ObjectStore.
+func NewObjectStore(cls cluster.Cluster, super *supervisor.Supervisor) *ObjectStore {
+	return &ObjectStore{s: &Server{cluster: cls, super: super}}
+}
+
+// recoverClusterErr converts the panic of a cluster error to err.
+func recoverClusterErr(err *error) {
+	if r := recover(); r != nil {
+		ce, ok := r.(clusterErr)
+		if !ok {
+			panic(r)
+		}
+		*err = ce
+	}
+}
+
+// GetObject returns the object, it returns nil if the object doesn't exist.
+func (st *ObjectStore) GetObject(name string) (spec *supervisor.Spec, err error) {
+	defer recoverClusterErr(&err)
+	return st.s._getObject(name), nil
+}
+
+// ListObjects returns all the objects.
+func (st *ObjectStore) ListObjects() (specs []*supervisor.Spec, err error) {
+	defer recoverClusterErr(&err)
+	return st.s._listObjects(), nil
+}
+
+// Apply puts and deletes the objects in one transaction, and returns the new
+// config version.
+func (st *ObjectStore) Apply(puts []*supervisor.Spec, deletes []string) (version int64, err error) {
+	defer recoverClusterErr(&err)
+
+	st.s.Lock()
+	defer st.s.Unlock()
+
+	return st.s._applyObjects(nil, puts, deletes), nil
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/cluster/tlscert"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// TLSCertPrefix is the URL prefix of APIs for TLS certificates
+	TLSCertPrefix = "/tlscerts"
+)
+
+func (s *Server) tlsCertAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    TLSCertPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listTLSCerts,
+		},
+		{
+			Path:    TLSCertPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getTLSCert,
+		},
+		{
+			Path:    TLSCertPrefix,
+			Method:  http.MethodPut,
+			Handler: s.putTLSCert,
+		},
+		{
+			Path:    TLSCertPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteTLSCert,
+		},
+	}
+}
+
+// NOTE: the private keys are never returned by the APIs.
+func (s *Server) listTLSCerts(w http.ResponseWriter, r *http.Request) {
+	certs, err := s.tcs.List()
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	result := make([]*tlscert.Info, 0, len(certs))
+	for _, c := range certs {
+		info, err := c.Info()
+		if err != nil {
+			info = &tlscert.Info{Name: c.Name}
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	WriteBody(w, r, result)
+}
+
+func (s *Server) getTLSCert(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	c, err := s.tcs.Get(name)
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if c == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	info, err := c.Info()
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	WriteBody(w, r, info)
+}
+
+func (s *Server) putTLSCert(w http.ResponseWriter, r *http.Request) {
+	c := &tlscert.Cert{}
+	codectool.MustDecode(r.Body, c)
+
+	if _, err := c.Certificate(); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.tcs.Put(c); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+}
+
+func (s *Server) deleteTLSCert(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := s.tcs.Delete(name); err != nil {
+		ClusterPanic(err)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+// ValidatePath is the URL of the validation API.
+const ValidatePath = "/validate"
+
+// ValidateResponse is the response of a valid object spec.
+type ValidateResponse struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Valid bool   `json:"valid"`
+}
+
+func (s *Server) validateAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ValidatePath,
+			Method:  http.MethodPost,
+			Handler: s.validateObject,
+		},
+	}
+}
+
+// validateObject validates an object spec, including the references to the
+// other objects, without persisting it.
+func (s *Server) validateObject(w http.ResponseWriter, r *http.Request) {
+	spec, err := s.readObjectSpec(w, r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	// No need to lock, the result is only a hint.
+
+	if existed := s._getObject(spec.Name()); existed != nil && existed.Kind() != spec.Kind() {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("conflict with existing object %s of kind %s", spec.Name(), existed.Kind()))
+		return
+	}
+
+	if err := checkReferences(spec, s._getObject); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	WriteBody(w, r, &ValidateResponse{
+		Name:  spec.Name(),
+		Kind:  spec.Kind(),
+		Valid: true,
+	})
+}
+
+// checkReferences checks that the objects referenced by the spec exist and
+// are of the expected kinds, all the broken references are reported.
+func checkReferences(spec *supervisor.Spec, getObject func(name string) *supervisor.Spec) error {
+	var msgs []string
+	for _, ref := range spec.References() {
+		target := getObject(ref.Name)
+		switch {
+		case target == nil:
+			msgs = append(msgs, fmt.Sprintf("%s %s not found", ref.Kind, ref.Name))
+		case ref.Kind != "" && target.Kind() != ref.Kind:
+			msgs = append(msgs, fmt.Sprintf("%s is a %s rather than a %s", ref.Name, target.Kind(), ref.Kind))
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", spec.Name(), strings.Join(msgs, "; "))
+}
@@ -32,41 +32,6 @@ import (
 	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
-func (s *Server) isFilterExist(pipeline, filter, kind string) bool {
-	spec := s._getObject(pipeline)
-	if spec == nil {
-		return false
-	}
-
-	rawSpec := spec.RawSpec()
-	var filters []interface{}
-	if f := rawSpec["filters"]; f != nil {
-		filters, _ = f.([]interface{})
-	}
-	if filters == nil {
-		return false
-	}
-
-	for i := range filters {
-		f, _ := filters[i].(map[interface{}]interface{})
-		if f == nil {
-			continue
-		}
-
-		if n := f["name"]; n == nil || n != filter {
-			continue
-		}
-
-		if k := f["kind"]; k == nil || k != kind {
-			continue
-		}
-
-		return true
-	}
-
-	return false
-}
-
 func (s *Server) wasmReloadCode(w http.ResponseWriter, r *http.Request) {
 	key := s.cluster.Layout().WasmCodeEvent()
 	value := time.Now().Format(time.RFC3339Nano)
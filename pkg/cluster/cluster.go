@@ -54,6 +54,17 @@ const (
 	leaseTTL = clientv3.MaxLeaseTTL // 9000000000Second=285Year
 
 	minTTL = 5 // grant a new lease if the lease ttl is less than minTTL
+
+	// defaultSecondaryLeaseTTL is the TTL of the leases of secondary
+	// members, the stuff under the lease of a secondary member is removed
+	// once it is gone for the TTL.
+	defaultSecondaryLeaseTTL = 30 * time.Second
+
+	// secondaryHeartbeatInterval is the interval for heartbeat of secondary
+	// members, which is longer than the primary ones to reduce the load of
+	// the cluster with many secondary members, the lease keeps their
+	// statuses alive between heartbeats.
+	secondaryHeartbeatInterval = 30 * time.Second
 )
 
 type (
@@ -116,6 +127,8 @@ func (s *etcdStats) toEtcdStatus() *EtcdStatus {
 type cluster struct {
 	opt            *option.Options
 	requestTimeout time.Duration
+	// leaseTTL is the TTL of the lease in seconds.
+	leaseTTL int64
 
 	layout *Layout
 
@@ -156,9 +169,20 @@ func New(opt *option.Options) (Cluster, error) {
 	c := &cluster{
 		opt:            opt,
 		requestTimeout: requestTimeout,
+		leaseTTL:       leaseTTL,
 		members:        membersFile,
 		done:           make(chan struct{}),
 	}
+	if opt.ClusterRole == "secondary" {
+		ttl := defaultSecondaryLeaseTTL
+		if opt.Cluster.SecondaryLeaseTTL != "" {
+			ttl, err = time.ParseDuration(opt.Cluster.SecondaryLeaseTTL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secondary lease ttl: %v", err)
+			}
+		}
+		c.leaseTTL = int64(ttl / time.Second)
+	}
 
 	c.initLayout()
 
@@ -198,13 +222,13 @@ func (c *cluster) run() {
 	// NOTE: Try to be ready in first time synchronously.
 	// If it got failed, try it asynchronously.
 	if err := tryReady(); err != nil {
-		logger.Errorf("start cluster failed (%d retries): %v", tryTimes, err)
+		logger.Cluster.Errorf("start cluster failed (%d retries): %v", tryTimes, err)
 
 		for {
 			time.Sleep(HeartbeatInterval)
 			err := tryReady()
 			if err != nil {
-				logger.Errorf("failed start many times(%d), "+
+				logger.Cluster.Errorf("failed start many times(%d), "+
 					"start others if they're not online, "+
 					"otherwise purge this member, clean data directory "+
 					"and rejoin it back.", tryTimes)
@@ -214,7 +238,7 @@ func (c *cluster) run() {
 		}
 	}
 
-	logger.Infof("cluster is ready")
+	logger.Cluster.Infof("cluster is ready")
 
 	if c.opt.ClusterRole == "primary" {
 		go c.defrag()
@@ -258,7 +282,7 @@ func (c *cluster) getReady() error {
 		}
 	case <-timeout:
 		err := fmt.Errorf("start server timeout(%v)", waitServerTimeout)
-		logger.Errorf("%v", err)
+		logger.Cluster.Errorf("%v", err)
 		panic(err)
 	}
 
@@ -286,7 +310,7 @@ func (c *cluster) checkClusterName() error {
 		if c.opt.ClusterName != *value {
 			err := fmt.Errorf("cluster names mismatch, local(%s) != existed(%s)",
 				c.opt.ClusterName, *value)
-			logger.Errorf("%v", err)
+			logger.Cluster.Errorf("%v", err)
 			panic(err)
 		}
 	} else if c.opt.UseStandaloneEtcd {
@@ -328,7 +352,7 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 			endpoints = []string{c.members.self().PeerURL}
 		}
 	}
-	logger.Infof("client connect with endpoints: %v", endpoints)
+	logger.Cluster.Infof("client connect with endpoints: %v", endpoints)
 	client, err := clientv3.New(clientv3.Config{
 		Endpoints:            endpoints,
 		AutoSyncInterval:     autoSyncInterval,
@@ -342,7 +366,7 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 		return nil, fmt.Errorf("create client failed: %v", err)
 	}
 
-	logger.Infof("client is ready")
+	logger.Cluster.Infof("client is ready")
 
 	c.client = client
 
@@ -359,7 +383,7 @@ func (c *cluster) closeClient() {
 
 	err := c.client.Close()
 	if err != nil {
-		logger.Errorf("close client failed: %v", err)
+		logger.Cluster.Errorf("close client failed: %v", err)
 	}
 
 	c.client = nil
@@ -376,11 +400,29 @@ func (c *cluster) getLease() (clientv3.LeaseID, error) {
 	return *c.lease, nil
 }
 
+// keepAliveInterval returns the interval to keep the lease alive, which
+// is short enough for the lease of secondary members.
+func (c *cluster) keepAliveInterval() time.Duration {
+	interval := time.Duration(c.leaseTTL) * time.Second / 3
+	if interval > c.requestTimeout {
+		interval = c.requestTimeout
+	}
+	return interval
+}
+
 func (c *cluster) keepAliveLease() {
 	handleFailed := func() {
 		err := c.grantNewLease()
 		if err != nil {
-			logger.Errorf("grant new lease failed: %v", err)
+			logger.Cluster.Errorf("grant new lease failed: %v", err)
+			return
+		}
+
+		// The stuff under the old lease may be removed, so register the
+		// status again at once.
+		err = c.syncStatus()
+		if err != nil {
+			logger.Cluster.Errorf("sync status failed: %v", err)
 		}
 	}
 
@@ -388,16 +430,16 @@ func (c *cluster) keepAliveLease() {
 		select {
 		case <-c.done:
 			return
-		case <-time.After(c.requestTimeout):
+		case <-time.After(c.keepAliveInterval()):
 			client, err := c.getClient()
 			if err != nil {
-				logger.Errorf("get client failed: %v", err)
+				logger.Cluster.Errorf("get client failed: %v", err)
 				continue
 			}
 
 			leaseID, err := c.getLease()
 			if err != nil {
-				logger.Errorf("get lease failed: %v", err)
+				logger.Cluster.Errorf("get lease failed: %v", err)
 				handleFailed()
 				continue
 			}
@@ -408,7 +450,7 @@ func (c *cluster) keepAliveLease() {
 				return client.Lease.KeepAliveOnce(ctx, leaseID)
 			}()
 			if err != nil {
-				logger.Errorf("keep alive for lease %x failed: %v", leaseID, err)
+				logger.Cluster.Errorf("keep alive for lease %x failed: %v", leaseID, err)
 				handleFailed()
 				continue
 			}
@@ -426,7 +468,7 @@ func (c *cluster) initLease() error {
 	if leaseStr != nil {
 		leaseID, err = strToLease(*leaseStr)
 		if err != nil {
-			logger.Errorf("BUG: parse lease %s failed: %v", *leaseStr, err)
+			logger.Cluster.Errorf("BUG: parse lease %s failed: %v", *leaseStr, err)
 			return err
 		}
 	}
@@ -447,7 +489,7 @@ func (c *cluster) initLease() error {
 		}
 		// NOTE: Use existed lease.
 		c.lease = leaseID
-		logger.Infof("lease is ready(use existed one: %x)", *c.lease)
+		logger.Cluster.Infof("lease is ready(use existed one: %x)", *c.lease)
 		return nil
 
 	}
@@ -466,7 +508,7 @@ func (c *cluster) grantNewLease() error {
 	respGrant, err := func() (*clientv3.LeaseGrantResponse, error) {
 		ctx, cancel := c.requestContext()
 		defer cancel()
-		return client.Lease.Grant(ctx, leaseTTL)
+		return client.Lease.Grant(ctx, c.leaseTTL)
 	}()
 	if err != nil {
 		return err
@@ -494,14 +536,26 @@ func (c *cluster) grantNewLease() error {
 	lease := respGrant.ID
 	c.lease = &lease
 
-	logger.Infof("lease is ready (grant new one: %x)", *c.lease)
+	logger.Cluster.Infof("lease is ready (grant new one: %x)", *c.lease)
 
 	return nil
 }
 
+// isSessionAlive returns whether the session is alive, the session is
+// orphaned if its lease is expired, e.g. after a secondary member is
+// disconnected from the cluster for a while.
+func isSessionAlive(session *concurrency.Session) bool {
+	select {
+	case <-session.Done():
+		return false
+	default:
+		return true
+	}
+}
+
 func (c *cluster) getSession() (*concurrency.Session, error) {
 	c.sessionMutex.RLock()
-	if c.session != nil {
+	if c.session != nil && isSessionAlive(c.session) {
 		session := c.session
 		c.sessionMutex.RUnlock()
 		return session, nil
@@ -513,7 +567,12 @@ func (c *cluster) getSession() (*concurrency.Session, error) {
 
 	// DCL
 	if c.session != nil {
-		return c.session, nil
+		if isSessionAlive(c.session) {
+			return c.session, nil
+		}
+		logger.Cluster.Warnf("session is orphaned, create a new one")
+		c.session.Close()
+		c.session = nil
 	}
 
 	client, err := c.getClient()
@@ -534,7 +593,7 @@ func (c *cluster) getSession() (*concurrency.Session, error) {
 
 	c.session = session
 
-	logger.Infof("session is ready")
+	logger.Cluster.Infof("session is ready")
 
 	return session, nil
 }
@@ -549,7 +608,7 @@ func (c *cluster) closeSession() {
 
 	err := c.session.Close()
 	if err != nil {
-		logger.Errorf("close session failed: %v", err)
+		logger.Cluster.Errorf("close session failed: %v", err)
 	}
 
 	c.session = nil
@@ -581,7 +640,7 @@ func closeEtcdServer(s *embed.Etcd) {
 				peer.Close()
 			}
 		}
-		logger.Infof("hard stop server")
+		logger.Cluster.Infof("hard stop server")
 	}
 }
 
@@ -609,7 +668,7 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 		select {
 		case err, ok := <-s.Err():
 			if ok {
-				logger.Errorf("etcd server %s serve failed: %v",
+				logger.Cluster.Errorf("etcd server %s serve failed: %v",
 					c.server.Config().Name, err)
 				closeEtcdServer(s)
 			}
@@ -629,12 +688,12 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 				if err != nil {
 					err = fmt.Errorf("register cluster name %s failed: %v",
 						c.opt.ClusterName, err)
-					logger.Errorf("%v", err)
+					logger.Cluster.Errorf("%v", err)
 					panic(err)
 				}
 			}
 			go monitorServer(c.server)
-			logger.Infof("server is ready")
+			logger.Cluster.Infof("server is ready")
 			close(done)
 		case <-time.After(waitServerTimeout):
 			closeEtcdServer(server)
@@ -667,16 +726,26 @@ func (c *cluster) StartServer() (done, timeout chan struct{}, err error) {
 }
 
 func (c *cluster) heartbeat() {
+	interval := HeartbeatInterval
+	if c.opt.ClusterRole == "secondary" {
+		interval = secondaryHeartbeatInterval
+	}
+
 	for {
 		select {
-		case <-time.After(HeartbeatInterval):
+		case <-time.After(interval):
 			err := c.syncStatus()
 			if err != nil {
-				logger.Errorf("sync status failed: %v", err)
+				logger.Cluster.Errorf("sync status failed: %v", err)
+			}
+			// NOTE: Secondary members don't need the etcd members as the
+			// client syncs its endpoints by itself.
+			if c.opt.ClusterRole == "secondary" {
+				continue
 			}
 			err = c.updateMembers()
 			if err != nil {
-				logger.Errorf("update members failed: %v", err)
+				logger.Cluster.Errorf("update members failed: %v", err)
 			}
 		case <-c.done:
 			return
@@ -687,12 +756,12 @@ func (c *cluster) heartbeat() {
 func (c *cluster) runDefrag() time.Duration {
 	client, err := c.getClient()
 	if err != nil {
-		logger.Errorf("defrag failed: get client failed: %v", err)
+		logger.Cluster.Errorf("defrag failed: get client failed: %v", err)
 		return defragFailedInterval
 	}
 	defragmentURL, err := c.opt.GetFirstAdvertiseClientURL()
 	if err != nil {
-		logger.Errorf("defrag failed: %v", err)
+		logger.Cluster.Errorf("defrag failed: %v", err)
 		return defragNormalInterval // url is wrong
 	}
 	// NOTICE: It needs longer time than normal ones.
@@ -702,11 +771,11 @@ func (c *cluster) runDefrag() time.Duration {
 		return client.Defragment(ctx, defragmentURL)
 	}()
 	if err != nil {
-		logger.Errorf("defrag failed: %v", err)
+		logger.Cluster.Errorf("defrag failed: %v", err)
 		return defragFailedInterval
 	}
 
-	logger.Infof("defrag successfully")
+	logger.Cluster.Infof("defrag successfully")
 	return defragNormalInterval
 }
 
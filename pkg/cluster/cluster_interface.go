@@ -120,7 +120,7 @@ func getOpOption(op ClientOp) clientv3.OpOption {
 	case OpKeysOnly:
 		return clientv3.WithKeysOnly()
 	default:
-		logger.Errorf("unsupported client operation: %v", op)
+		logger.Cluster.Errorf("unsupported client operation: %v", op)
 		return nil
 	}
 }
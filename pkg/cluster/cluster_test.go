@@ -493,6 +493,19 @@ func TestInvalidConfig(t *testing.T) {
 	assert.NotNil(err)
 }
 
+func TestKeepAliveInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &cluster{requestTimeout: 10 * time.Second, leaseTTL: leaseTTL}
+	assert.Equal(10*time.Second, c.keepAliveInterval())
+
+	c.leaseTTL = int64(defaultSecondaryLeaseTTL / time.Second)
+	assert.Equal(10*time.Second, c.keepAliveInterval())
+
+	c.leaseTTL = 6
+	assert.Equal(2*time.Second, c.keepAliveInterval())
+}
+
 func TestRunDefrag(t *testing.T) {
 	assert := assert.New(t)
 	etcdDirName, err := ioutil.TempDir("", "cluster-test")
@@ -504,6 +517,7 @@ func TestRunDefrag(t *testing.T) {
 	cluster := &cluster{
 		opt:            opt,
 		requestTimeout: 1 * time.Second,
+		leaseTTL:       leaseTTL,
 		done:           make(chan struct{}),
 	}
 	cluster.initLayout()
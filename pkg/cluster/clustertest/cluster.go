@@ -260,7 +260,7 @@ func (stm *MockedSTM) Rev(key string) int64 {
 
 // Del implements STM.Del
 func (stm *MockedSTM) Del(key string) {
-	if stm.MockedRev != nil {
+	if stm.MockedDel != nil {
 		stm.MockedDel(key)
 	}
 }
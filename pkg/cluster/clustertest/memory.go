@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clustertest
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/cluster"
+)
+
+// memoryMutex is a cluster mutex which is local to the process.
+type memoryMutex struct {
+	sync.Mutex
+}
+
+func (m *memoryMutex) Lock() error {
+	m.Mutex.Lock()
+	return nil
+}
+
+func (m *memoryMutex) Unlock() error {
+	m.Mutex.Unlock()
+	return nil
+}
+
+// NewMemoryCluster returns a mocked cluster storing the data in the
+// returned map, which could be inspected and modified by the tests.
+func NewMemoryCluster() (*MockedCluster, map[string]string) {
+	data := make(map[string]string)
+	layout := &cluster.Layout{}
+	mutex := &memoryMutex{}
+
+	c := NewMockedCluster()
+	c.MockedLayout = func() *cluster.Layout { return layout }
+	c.MockedMutex = func(name string) (cluster.Mutex, error) { return mutex, nil }
+	c.MockedGet = func(key string) (*string, error) {
+		if v, ok := data[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	c.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		kvs := make(map[string]string)
+		for k, v := range data {
+			if strings.HasPrefix(k, prefix) {
+				kvs[k] = v
+			}
+		}
+		return kvs, nil
+	}
+	c.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	c.MockedPutAndDelete = func(kvs map[string]*string) error {
+		for k, v := range kvs {
+			if v == nil {
+				delete(data, k)
+			} else {
+				data[k] = *v
+			}
+		}
+		return nil
+	}
+	return c, data
+}
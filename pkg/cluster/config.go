@@ -107,7 +107,7 @@ func CreateStaticClusterEtcdConfig(opt *option.Options) (*embed.Config, error) {
 	}
 	ec.InitialCluster = opt.InitialClusterToString()
 
-	logger.Infof("etcd config: advertise-client-urls: %+v advertise-peer-urls: %+v init-cluster: %s cluster-state: %s force-new-cluster: %v",
+	logger.Cluster.Infof("etcd config: advertise-client-urls: %+v advertise-peer-urls: %+v init-cluster: %s cluster-state: %s force-new-cluster: %v",
 		ec.ACUrls, ec.APUrls,
 		ec.InitialCluster, ec.ClusterState, ec.ForceNewCluster)
 
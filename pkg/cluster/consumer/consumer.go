@@ -0,0 +1,370 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package consumer provides the storage of the API consumers in the
+// cluster. A consumer is identified by its API keys, JWT subjects or the
+// common names of its client certificates, and its usage is counted
+// cluster-wide.
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// dateFormat is the format of the dates of the usage, which are in UTC.
+const dateFormat = "2006-01-02"
+
+type (
+	// Consumer is a client of the APIs.
+	Consumer struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Plan is the name of the plan of the consumer, the plans are
+		// defined by the ConsumerQuota filters.
+		Plan string `json:"plan" jsonschema:"omitempty"`
+		// RequestsPerDay overrides the quota of the plan if it is not 0.
+		RequestsPerDay int64    `json:"requestsPerDay" jsonschema:"omitempty,minimum=0"`
+		APIKeys        []string `json:"apiKeys" jsonschema:"omitempty,uniqueItems=true"`
+		JWTSubjects    []string `json:"jwtSubjects" jsonschema:"omitempty,uniqueItems=true"`
+		// CertSubjects are the common names of the client certificates.
+		CertSubjects []string `json:"certSubjects" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Usage is the number of requests of a consumer.
+	Usage struct {
+		Name string `json:"name"`
+		// Date is the date of Today in UTC.
+		Date  string `json:"date"`
+		Today int64  `json:"today"`
+		Total int64  `json:"total"`
+	}
+
+	// Index finds the consumers by their identities.
+	Index struct {
+		apiKeys      map[string]*Consumer
+		jwtSubjects  map[string]*Consumer
+		certSubjects map[string]*Consumer
+	}
+
+	// Store defines the storage for consumers and their usage.
+	Store struct {
+		cluster     cluster.Cluster
+		prefix      string
+		usagePrefix string
+	}
+)
+
+// Validate validates the consumer.
+func (c *Consumer) Validate() error {
+	if c.Name == "" || strings.Contains(c.Name, "/") {
+		return fmt.Errorf("invalid consumer name %q", c.Name)
+	}
+	if len(c.APIKeys)+len(c.JWTSubjects)+len(c.CertSubjects) == 0 {
+		return fmt.Errorf("consumer %s has no API key, JWT subject or certificate subject", c.Name)
+	}
+	return nil
+}
+
+// Masked returns a copy of the consumer whose API keys are masked, only the
+// first 4 characters of the keys are kept.
+func (c *Consumer) Masked() *Consumer {
+	masked := *c
+	masked.APIKeys = make([]string, 0, len(c.APIKeys))
+	for _, k := range c.APIKeys {
+		if len(k) > 4 {
+			k = k[:4]
+		} else {
+			k = ""
+		}
+		masked.APIKeys = append(masked.APIKeys, k+"****")
+	}
+	return &masked
+}
+
+// Date returns the date of t in the format of the usage.
+func Date(t time.Time) string {
+	return t.UTC().Format(dateFormat)
+}
+
+// add adds n requests at the date, Today is reset if the date changes.
+func (u *Usage) add(date string, n int64) {
+	if u.Date != date {
+		u.Date, u.Today = date, 0
+	}
+	u.Today += n
+	u.Total += n
+}
+
+// NewIndex creates an index of the consumers. If an identity is shared by
+// several consumers, the first one in the order of names wins.
+func NewIndex(consumers []*Consumer) *Index {
+	sorted := make([]*Consumer, len(consumers))
+	copy(sorted, consumers)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	idx := &Index{
+		apiKeys:      map[string]*Consumer{},
+		jwtSubjects:  map[string]*Consumer{},
+		certSubjects: map[string]*Consumer{},
+	}
+	add := func(m map[string]*Consumer, keys []string, c *Consumer) {
+		for _, k := range keys {
+			if old := m[k]; old != nil {
+				logger.Cluster.Errorf("identity of consumer %s is used by consumer %s", c.Name, old.Name)
+				continue
+			}
+			m[k] = c
+		}
+	}
+	for _, c := range sorted {
+		add(idx.apiKeys, c.APIKeys, c)
+		add(idx.jwtSubjects, c.JWTSubjects, c)
+		add(idx.certSubjects, c.CertSubjects, c)
+	}
+	return idx
+}
+
+// ByAPIKey returns the consumer of the API key, nil if not found.
+func (idx *Index) ByAPIKey(key string) *Consumer {
+	return idx.apiKeys[key]
+}
+
+// ByJWTSubject returns the consumer of the JWT subject, nil if not found.
+func (idx *Index) ByJWTSubject(sub string) *Consumer {
+	return idx.jwtSubjects[sub]
+}
+
+// ByCertSubject returns the consumer of the common name of the client
+// certificate, nil if not found.
+func (idx *Index) ByCertSubject(cn string) *Consumer {
+	return idx.certSubjects[cn]
+}
+
+// Len returns the number of the consumers in the index.
+func (idx *Index) Len() int {
+	names := map[string]struct{}{}
+	for _, m := range []map[string]*Consumer{idx.apiKeys, idx.jwtSubjects, idx.certSubjects} {
+		for _, c := range m {
+			names[c.Name] = struct{}{}
+		}
+	}
+	return len(names)
+}
+
+// NewStore creates a new consumer store.
+func NewStore(cls cluster.Cluster) *Store {
+	return &Store{
+		cluster:     cls,
+		prefix:      cls.Layout().ConsumerPrefix(),
+		usagePrefix: cls.Layout().ConsumerUsagePrefix(),
+	}
+}
+
+func unmarshalConsumer(data []byte) (*Consumer, error) {
+	c := &Consumer{}
+	if err := codectool.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("BUG: unmarshal %s to json failed: %v", string(data), err)
+	}
+	return c, nil
+}
+
+// Get gets a consumer by its name, it returns nil if the consumer does not
+// exist.
+func (s *Store) Get(name string) (*Consumer, error) {
+	kv, err := s.cluster.GetRaw(s.prefix + name)
+	if err != nil {
+		return nil, err
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	return unmarshalConsumer(kv.Value)
+}
+
+// List lists all consumers sorted by their names.
+func (s *Store) List() ([]*Consumer, error) {
+	kvs, err := s.cluster.GetRawPrefix(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers := make([]*Consumer, 0, len(kvs))
+	for _, v := range kvs {
+		c, err := unmarshalConsumer(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+
+	return consumers, nil
+}
+
+// Put creates or updates a consumer, the identities of the consumer must
+// not be used by other consumers.
+func (s *Store) Put(c *Consumer) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	consumers, err := s.List()
+	if err != nil {
+		return err
+	}
+	others := make([]*Consumer, 0, len(consumers))
+	for _, other := range consumers {
+		if other.Name != c.Name {
+			others = append(others, other)
+		}
+	}
+	idx := NewIndex(others)
+	for _, k := range c.APIKeys {
+		if other := idx.ByAPIKey(k); other != nil {
+			return fmt.Errorf("API key is used by consumer %s", other.Name)
+		}
+	}
+	for _, sub := range c.JWTSubjects {
+		if other := idx.ByJWTSubject(sub); other != nil {
+			return fmt.Errorf("JWT subject %s is used by consumer %s", sub, other.Name)
+		}
+	}
+	for _, cn := range c.CertSubjects {
+		if other := idx.ByCertSubject(cn); other != nil {
+			return fmt.Errorf("certificate subject %s is used by consumer %s", cn, other.Name)
+		}
+	}
+
+	buf, err := codectool.MarshalJSON(c)
+	if err != nil {
+		return err
+	}
+	return s.cluster.Put(s.prefix+c.Name, string(buf))
+}
+
+// Delete deletes a consumer and its usage by its name.
+func (s *Store) Delete(name string) error {
+	if err := s.cluster.Delete(s.prefix + name); err != nil {
+		return err
+	}
+	return s.cluster.Delete(s.usagePrefix + name)
+}
+
+// GetUsage gets the usage of a consumer.
+func (s *Store) GetUsage(name string) (*Usage, error) {
+	kv, err := s.cluster.GetRaw(s.usagePrefix + name)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &Usage{Name: name}
+	if kv != nil {
+		if err := codectool.UnmarshalJSON(kv.Value, u); err != nil {
+			return nil, fmt.Errorf("BUG: unmarshal %s to json failed: %v", string(kv.Value), err)
+		}
+	}
+	u.add(Date(time.Now()), 0)
+	return u, nil
+}
+
+// AddUsage adds the number of requests to the usage of the consumers at
+// now in a transaction, and returns the usage of the consumers after the
+// addition. The usage is only read if the number is 0.
+func (s *Store) AddUsage(counts map[string]int64, now time.Time) (map[string]*Usage, error) {
+	date := Date(now)
+	var result map[string]*Usage
+
+	err := s.cluster.STM(func(stm concurrency.STM) error {
+		result = make(map[string]*Usage, len(counts))
+		for name, n := range counts {
+			key := s.usagePrefix + name
+			u := &Usage{Name: name}
+			if v := stm.Get(key); v != "" {
+				if err := codectool.UnmarshalJSON([]byte(v), u); err != nil {
+					logger.Cluster.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+					u = &Usage{Name: name}
+				}
+			}
+
+			u.add(date, n)
+			result[name] = u
+			if n == 0 {
+				continue
+			}
+
+			data, err := codectool.MarshalJSON(u)
+			if err != nil {
+				return err
+			}
+			stm.Put(key, string(data))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Watch watches the consumers, onChange is called with all of the
+// consumers when any of them changes.
+func (s *Store) Watch(ctx context.Context, onChange func([]*Consumer)) error {
+	syncer, err := s.cluster.Syncer(5 * time.Minute)
+	if err != nil {
+		return err
+	}
+
+	ch, err := syncer.SyncRawPrefix(s.prefix)
+	if err != nil {
+		syncer.Close()
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			syncer.Close()
+			return nil
+		case m := <-ch:
+			consumers := make([]*Consumer, 0, len(m))
+			for _, v := range m {
+				c, err := unmarshalConsumer(v.Value)
+				if err != nil {
+					logger.Cluster.Errorf("%v", err)
+					continue
+				}
+				consumers = append(consumers, c)
+			}
+			onChange(consumers)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+)
+
+func newTestStore(data map[string]string) *Store {
+	cls := clustertest.NewMockedCluster()
+	cls.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		if v, ok := data[key]; ok {
+			return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(v)}, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		result := map[string]*mvccpb.KeyValue{}
+		for k, v := range data {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)}
+			}
+		}
+		return result, nil
+	}
+	cls.MockedDelete = func(key string) error {
+		delete(data, key)
+		return nil
+	}
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		stm := &clustertest.MockedSTM{
+			MockedGet: func(key ...string) string {
+				return data[key[0]]
+			},
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) {
+				data[key] = val
+			},
+		}
+		return apply(stm)
+	}
+	return NewStore(cls)
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestStore(map[string]string{})
+
+	assert.Error(s.Put(&Consumer{Name: "a/b", APIKeys: []string{"key"}}))
+	assert.Error(s.Put(&Consumer{Name: "alice"}))
+
+	assert.NoError(s.Put(&Consumer{Name: "alice", Plan: "free", APIKeys: []string{"alice-key"}}))
+	assert.NoError(s.Put(&Consumer{Name: "bob", JWTSubjects: []string{"bob"}, CertSubjects: []string{"bob.example.com"}}))
+
+	// the identities can't be shared.
+	assert.Error(s.Put(&Consumer{Name: "carol", APIKeys: []string{"alice-key"}}))
+	assert.Error(s.Put(&Consumer{Name: "carol", JWTSubjects: []string{"bob"}}))
+	assert.Error(s.Put(&Consumer{Name: "carol", CertSubjects: []string{"bob.example.com"}}))
+	// but could be updated by the same consumer.
+	assert.NoError(s.Put(&Consumer{Name: "alice", Plan: "pro", APIKeys: []string{"alice-key"}}))
+
+	c, err := s.Get("alice")
+	assert.NoError(err)
+	assert.Equal("pro", c.Plan)
+	assert.Equal([]string{"alic****"}, c.Masked().APIKeys)
+	assert.Equal([]string{"alice-key"}, c.APIKeys)
+
+	c, err = s.Get("none")
+	assert.NoError(err)
+	assert.Nil(c)
+
+	consumers, err := s.List()
+	assert.NoError(err)
+	assert.Len(consumers, 2)
+	assert.Equal("alice", consumers[0].Name)
+
+	idx := NewIndex(consumers)
+	assert.Equal(2, idx.Len())
+	assert.Equal("alice", idx.ByAPIKey("alice-key").Name)
+	assert.Equal("bob", idx.ByJWTSubject("bob").Name)
+	assert.Equal("bob", idx.ByCertSubject("bob.example.com").Name)
+	assert.Nil(idx.ByAPIKey("bob"))
+
+	assert.NoError(s.Delete("bob"))
+	c, err = s.Get("bob")
+	assert.NoError(err)
+	assert.Nil(c)
+}
+
+func TestUsage(t *testing.T) {
+	assert := assert.New(t)
+
+	data := map[string]string{}
+	s := newTestStore(data)
+
+	day1 := time.Date(2022, 1, 1, 23, 0, 0, 0, time.UTC)
+	usage, err := s.AddUsage(map[string]int64{"alice": 3, "bob": 0}, day1)
+	assert.NoError(err)
+	assert.Equal(int64(3), usage["alice"].Today)
+	assert.Equal(int64(0), usage["bob"].Today)
+	assert.NotContains(data, s.usagePrefix+"bob")
+
+	usage, err = s.AddUsage(map[string]int64{"alice": 2}, day1)
+	assert.NoError(err)
+	assert.Equal(&Usage{Name: "alice", Date: "2022-01-01", Today: 5, Total: 5}, usage["alice"])
+
+	// Today is reset on the next day.
+	usage, err = s.AddUsage(map[string]int64{"alice": 1}, day1.Add(2*time.Hour))
+	assert.NoError(err)
+	assert.Equal(&Usage{Name: "alice", Date: "2022-01-02", Today: 1, Total: 6}, usage["alice"])
+
+	u, err := s.GetUsage("alice")
+	assert.NoError(err)
+	assert.Equal(Date(time.Now()), u.Date)
+	assert.Equal(int64(6), u.Total)
+
+	assert.NoError(s.Delete("alice"))
+	assert.NotContains(data, s.usagePrefix+"alice")
+}
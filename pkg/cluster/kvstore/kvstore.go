@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kvstore provides the key-value stores shared by all members of
+// the cluster, so that the filters could share small state, like feature
+// flags and counters. The keys are namespaced and could expire after a TTL.
+package kvstore
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// maxCacheEntries is the number of the cached entries to start dropping
+// the stale ones.
+const maxCacheEntries = 1024
+
+type (
+	// Store is a key-value namespace stored in the cluster. The values
+	// could be cached locally, so that the reads don't hit the cluster,
+	// at the cost of seeing the changes of other members with a delay.
+	Store struct {
+		cls    cluster.Cluster
+		prefix string
+
+		cacheTTL time.Duration
+		mutex    sync.Mutex
+		cache    map[string]*cacheEntry
+	}
+
+	// Entry is the value stored in the cluster.
+	Entry struct {
+		Value string `json:"value"`
+		// ExpireAt is the unix time in nanoseconds when the entry expires,
+		// zero means never.
+		ExpireAt int64 `json:"expireAt,omitempty"`
+	}
+
+	// cacheEntry is a cached entry, entry is nil if the key doesn't exist.
+	cacheEntry struct {
+		entry    *Entry
+		cachedAt time.Time
+	}
+)
+
+// NewStore creates a store of the keys under prefix.
+func NewStore(cls cluster.Cluster, prefix string) *Store {
+	return &Store{cls: cls, prefix: prefix}
+}
+
+// Namespace returns the store of a namespace of the shared key-value
+// store, which is also accessible by the REST API.
+func Namespace(cls cluster.Cluster, namespace string) *Store {
+	return NewStore(cls, cls.Layout().KVNamespacePrefix(namespace))
+}
+
+// WithCache caches the values locally for ttl, it returns the store.
+func (s *Store) WithCache(ttl time.Duration) *Store {
+	s.cacheTTL = ttl
+	if ttl > 0 {
+		s.cache = map[string]*cacheEntry{}
+	}
+	return s
+}
+
+// Expired returns whether the entry is expired at now.
+func (e *Entry) Expired(now time.Time) bool {
+	return e.ExpireAt > 0 && e.ExpireAt <= now.UnixNano()
+}
+
+// expireAt returns the expire time of a TTL.
+func expireAt(now time.Time, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return now.Add(ttl).UnixNano()
+}
+
+// parseEntry parses an entry, an invalid or expired entry is treated as
+// nonexistent.
+func parseEntry(s string, now time.Time) *Entry {
+	if s == "" {
+		return nil
+	}
+	e := &Entry{}
+	if codectool.UnmarshalJSON([]byte(s), e) != nil || e.Expired(now) {
+		return nil
+	}
+	return e
+}
+
+func (s *Store) cached(key string, now time.Time) (*cacheEntry, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ce, ok := s.cache[key]
+	if !ok || now.Sub(ce.cachedAt) >= s.cacheTTL {
+		return nil, false
+	}
+	return ce, true
+}
+
+func (s *Store) setCache(key string, e *Entry) {
+	if s.cache == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// drop the stale entries, so that the cache doesn't grow with the
+	// keys which are no longer read.
+	now := time.Now()
+	if len(s.cache) >= maxCacheEntries {
+		for k, ce := range s.cache {
+			if now.Sub(ce.cachedAt) >= s.cacheTTL {
+				delete(s.cache, k)
+			}
+		}
+	}
+	s.cache[key] = &cacheEntry{entry: e, cachedAt: now}
+}
+
+// Get returns the value of key, and whether the key exists.
+func (s *Store) Get(key string) (string, bool, error) {
+	now := time.Now()
+	if ce, ok := s.cached(key, now); ok {
+		if ce.entry == nil || ce.entry.Expired(now) {
+			return "", false, nil
+		}
+		return ce.entry.Value, true, nil
+	}
+
+	v, err := s.cls.Get(s.prefix + key)
+	if err != nil {
+		return "", false, err
+	}
+	var e *Entry
+	if v != nil {
+		e = parseEntry(*v, now)
+	}
+	s.setCache(key, e)
+	if e == nil {
+		return "", false, nil
+	}
+	return e.Value, true, nil
+}
+
+// Set sets the value of key, the key never expires if ttl is not positive.
+func (s *Store) Set(key, value string, ttl time.Duration) error {
+	e := &Entry{Value: value, ExpireAt: expireAt(time.Now(), ttl)}
+	data, err := codectool.MarshalJSON(e)
+	if err != nil {
+		return err
+	}
+	if err = s.cls.Put(s.prefix+key, string(data)); err != nil {
+		return err
+	}
+	s.setCache(key, e)
+	return nil
+}
+
+// Delete deletes key.
+func (s *Store) Delete(key string) error {
+	if err := s.cls.Delete(s.prefix + key); err != nil {
+		return err
+	}
+	s.setCache(key, nil)
+	return nil
+}
+
+// Incr adds delta to the integer value of key atomically and returns the
+// result. The TTL only applies when the key is created, so that the key
+// works as a fixed window counter.
+func (s *Store) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	var (
+		result int64
+		entry  *Entry
+	)
+
+	err := s.cls.STM(func(stm concurrency.STM) error {
+		now := time.Now()
+		e := parseEntry(stm.Get(s.prefix+key), now)
+		if e == nil {
+			e = &Entry{ExpireAt: expireAt(now, ttl)}
+		}
+
+		result, _ = strconv.ParseInt(e.Value, 10, 64)
+		result += delta
+		e.Value = strconv.FormatInt(result, 10)
+		data, err := codectool.MarshalJSON(e)
+		if err != nil {
+			return err
+		}
+		stm.Put(s.prefix+key, string(data))
+		entry = e
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.setCache(key, entry)
+	return result, nil
+}
+
+// List returns the entries which are not expired.
+func (s *Store) List() (map[string]*Entry, error) {
+	kvs, err := s.cls.GetPrefix(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make(map[string]*Entry, len(kvs))
+	for key, v := range kvs {
+		if !strings.HasPrefix(key, s.prefix) {
+			continue
+		}
+		if e := parseEntry(v, now); e != nil {
+			result[key[len(s.prefix):]] = e
+		}
+	}
+	return result, nil
+}
+
+// Purge deletes the expired keys, it returns the number of deleted keys.
+func (s *Store) Purge() (int, error) {
+	kvs, err := s.cls.GetPrefix(s.prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for key, v := range kvs {
+		if !strings.HasPrefix(key, s.prefix) || parseEntry(v, time.Now()) != nil {
+			continue
+		}
+
+		// check again in a transaction as the key may be updated after the
+		// read.
+		deleted := false
+		err = s.cls.STM(func(stm concurrency.STM) error {
+			deleted = parseEntry(stm.Get(key), time.Now()) == nil
+			if deleted {
+				stm.Del(key)
+			}
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		if deleted {
+			count++
+		}
+	}
+
+	return count, nil
+}
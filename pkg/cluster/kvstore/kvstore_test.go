@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kvstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+)
+
+func newTestStore() (*Store, map[string]string) {
+	kvs := map[string]string{}
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.MockedGet = func(key string) (*string, error) {
+		if v, ok := kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		result := map[string]string{}
+		for k, v := range kvs {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = v
+			}
+		}
+		return result, nil
+	}
+	cls.MockedPut = func(key, value string) error {
+		kvs[key] = value
+		return nil
+	}
+	cls.MockedDelete = func(key string) error {
+		delete(kvs, key)
+		return nil
+	}
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		stm := &clustertest.MockedSTM{
+			MockedGet: func(key ...string) string {
+				return kvs[key[0]]
+			},
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) {
+				kvs[key] = val
+			},
+			MockedDel: func(key string) {
+				delete(kvs, key)
+			},
+		}
+		return apply(stm)
+	}
+
+	return Namespace(cls, "demo"), kvs
+}
+
+func TestGetSetDelete(t *testing.T) {
+	assert := assert.New(t)
+
+	kv, kvs := newTestStore()
+
+	_, ok, err := kv.Get("k1")
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.NoError(kv.Set("k1", "v1", 0))
+	v, ok, err := kv.Get("k1")
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal("v1", v)
+	assert.Contains(kvs, "/kv/demo/k1")
+
+	assert.NoError(kv.Delete("k1"))
+	_, ok, _ = kv.Get("k1")
+	assert.False(ok)
+
+	// expired keys are treated as nonexistent.
+	assert.NoError(kv.Set("k2", "v2", time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	_, ok, _ = kv.Get("k2")
+	assert.False(ok)
+}
+
+func TestIncr(t *testing.T) {
+	assert := assert.New(t)
+
+	kv, _ := newTestStore()
+
+	n, err := kv.Incr("counter", 1, 50*time.Millisecond)
+	assert.NoError(err)
+	assert.Equal(int64(1), n)
+
+	n, err = kv.Incr("counter", 2, time.Hour)
+	assert.NoError(err)
+	assert.Equal(int64(3), n)
+
+	// the TTL is not extended by the later increments, the counter
+	// restarts after the window.
+	time.Sleep(60 * time.Millisecond)
+	n, err = kv.Incr("counter", 1, 50*time.Millisecond)
+	assert.NoError(err)
+	assert.Equal(int64(1), n)
+}
+
+func TestPurge(t *testing.T) {
+	assert := assert.New(t)
+
+	kv, kvs := newTestStore()
+	kv.Set("k1", "v1", time.Millisecond)
+	kv.Set("k2", "v2", 0)
+	kv.Set("k3", "v3", time.Minute)
+	kvs["/kv/other/k4"] = `{"value": "v4", "expireAt": 1}`
+	time.Sleep(2 * time.Millisecond)
+
+	n, err := kv.Purge()
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.Len(kvs, 3)
+	assert.NotContains(kvs, "/kv/demo/k1")
+}
+
+func TestList(t *testing.T) {
+	assert := assert.New(t)
+
+	kv, kvs := newTestStore()
+	kv.Set("k1", "v1", 0)
+	kv.Set("k2", "v2", time.Millisecond)
+	kvs["/kv/other/k3"] = `{"value": "v3"}`
+	time.Sleep(2 * time.Millisecond)
+
+	entries, err := kv.List()
+	assert.NoError(err)
+	assert.Len(entries, 1)
+	assert.Equal("v1", entries["k1"].Value)
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+
+	kv, kvs := newTestStore()
+	kv.WithCache(50 * time.Millisecond)
+
+	_, ok, err := kv.Get("k1")
+	assert.NoError(err)
+	assert.False(ok)
+
+	// the change of other members is seen after the cache expires.
+	kvs["/kv/demo/k1"] = `{"value": "v1"}`
+	_, ok, _ = kv.Get("k1")
+	assert.False(ok)
+	time.Sleep(60 * time.Millisecond)
+	v, ok, _ := kv.Get("k1")
+	assert.True(ok)
+	assert.Equal("v1", v)
+
+	// the local changes are seen immediately.
+	assert.NoError(kv.Set("k1", "v2", 0))
+	v, _, _ = kv.Get("k1")
+	assert.Equal("v2", v)
+	n, err := kv.Incr("k2", 3, 0)
+	assert.NoError(err)
+	assert.Equal(int64(3), n)
+	delete(kvs, "/kv/demo/k2")
+	v, ok, _ = kv.Get("k2")
+	assert.True(ok)
+	assert.Equal("3", v)
+	assert.NoError(kv.Delete("k1"))
+	_, ok, _ = kv.Get("k1")
+	assert.False(ok)
+}
@@ -31,18 +31,41 @@ const (
 	NamespaceSystemPrefix  = "eg-"
 	NamespacetrafficPrefix = "eg-traffic-"
 
-	leaseFormat          = "/leases/%s" //+memberName
-	statusMemberPrefix   = "/status/members/"
-	statusMemberFormat   = "/status/members/%s" // +memberName
-	statusObjectPrefix   = "/status/objects/"
-	statusObjectFormat   = "/status/objects/%s/%s/%s" // +namespace +objectName +memberName
-	configObjectPrefix   = "/config/objects/"
-	configObjectFormat   = "/config/objects/%s" // +objectName
-	configVersion        = "/config/version"
-	wasmCodeEvent        = "/wasm/code"
-	wasmDataPrefixFormat = "/wasm/data/%s/%s/" // + pipelineName + filterName
-	customDataKindPrefix = "/custom-data-kinds/"
-	customDataPrefix     = "/custom-data/"
+	leaseFormat             = "/leases/%s" //+memberName
+	statusMemberPrefix      = "/status/members/"
+	statusMemberFormat      = "/status/members/%s" // +memberName
+	statusObjectPrefix      = "/status/objects/"
+	statusObjectFormat      = "/status/objects/%s/%s/%s" // +namespace +objectName +memberName
+	configObjectPrefix      = "/config/objects/"
+	configObjectFormat      = "/config/objects/%s" // +objectName
+	configVersion           = "/config/version"
+	configHistoryPrefix     = "/config/objects-history/"
+	configHistoryFormat     = "/config/objects-history/%s/" // +objectName
+	configAuditPrefix       = "/config/audit/"
+	configAuditFormat       = "/config/audit/%020d/%s" // +version +objectName
+	configSyncFormat        = "/config-sync/%s"        // +configSyncName
+	federationFormat        = "/federation/%s"         // +federationControllerName
+	canaryFormat            = "/canary/%s"             // +canaryControllerName
+	wasmCodeEvent           = "/wasm/code"
+	wasmDataPrefixFormat    = "/wasm/data/%s/%s/"      // + pipelineName + filterName
+	wasmKVPrefixFormat      = "/wasm/kv/%s/"           // + namespace
+	rateLimiterPrefixFormat = "/ratelimiter/%s/%s/"    // + pipelineName + filterName
+	circuitBreakerFormat    = "/circuitbreaker/%s/%s/" // + pipelineName + filterName
+	retryQueueFormat        = "/retryqueue/%s/%s/"     // + pipelineName + filterName
+	kvPrefix                = "/kv/"
+	kvPrefixFormat          = "/kv/%s/" // + namespace
+	maintenanceFlagPrefix   = "/maintenance-flags/"
+	customDataKindPrefix    = "/custom-data-kinds/"
+	customDataPrefix        = "/custom-data/"
+	tlsCertPrefix           = "/tls-certs/"
+	secretPrefix            = "/secrets/data/"
+	secretMasterKey         = "/secrets/master-key"
+	consumerPrefix          = "/consumers/data/"
+	consumerUsagePrefix     = "/consumers/usage/"
+	apiNamespacePrefix      = "/api-namespaces/"
+	apiNamespaceFormat      = "/api-namespaces/%s" // +namespace
+	objectNamespacePrefix   = "/config/object-namespaces/"
+	objectNamespaceFormat   = "/config/object-namespaces/%s" // +objectName
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(primary or secondary ) will be rejected if it is configured a different cluster name
@@ -137,6 +160,50 @@ func (l *Layout) ConfigVersion() string {
 	return configVersion
 }
 
+// ConfigHistoryPrefix returns the prefix of the history of all objects.
+func (l *Layout) ConfigHistoryPrefix() string {
+	return configHistoryPrefix
+}
+
+// ConfigObjectHistoryPrefix returns the prefix of the history of an object.
+func (l *Layout) ConfigObjectHistoryPrefix(name string) string {
+	return fmt.Sprintf(configHistoryFormat, name)
+}
+
+// ConfigObjectHistoryKey returns the key of a revision of an object, the
+// version is padded so that the keys are sorted by versions.
+func (l *Layout) ConfigObjectHistoryKey(name string, version int64) string {
+	return fmt.Sprintf(configHistoryFormat+"%020d", name, version)
+}
+
+// ConfigAuditPrefix returns the prefix of the audit log of the config
+// changes.
+func (l *Layout) ConfigAuditPrefix() string {
+	return configAuditPrefix
+}
+
+// ConfigAuditKey returns the key of the audit entry of an object changed in
+// the version, the version is padded so that the keys are sorted by
+// versions.
+func (l *Layout) ConfigAuditKey(version int64, name string) string {
+	return fmt.Sprintf(configAuditFormat, version, name)
+}
+
+// ConfigSyncKey returns the key of the record of a ConfigSync.
+func (l *Layout) ConfigSyncKey(name string) string {
+	return fmt.Sprintf(configSyncFormat, name)
+}
+
+// FederationKey returns the key of the record of a FederationController.
+func (l *Layout) FederationKey(name string) string {
+	return fmt.Sprintf(federationFormat, name)
+}
+
+// CanaryKey returns the key of the progress of a CanaryController.
+func (l *Layout) CanaryKey(name string) string {
+	return fmt.Sprintf(canaryFormat, name)
+}
+
 // WasmCodeEvent returns the key of wasm code event
 func (l *Layout) WasmCodeEvent() string {
 	return wasmCodeEvent
@@ -147,6 +214,51 @@ func (l *Layout) WasmDataPrefix(pipeline string, name string) string {
 	return fmt.Sprintf(wasmDataPrefixFormat, pipeline, name)
 }
 
+// WasmKVPrefix returns the prefix of the shared key-value namespace of wasm
+func (l *Layout) WasmKVPrefix(namespace string) string {
+	return fmt.Sprintf(wasmKVPrefixFormat, namespace)
+}
+
+// KVPrefix returns the prefix of all the namespaces of the shared
+// key-value store.
+func (l *Layout) KVPrefix() string {
+	return kvPrefix
+}
+
+// KVNamespacePrefix returns the prefix of a namespace of the shared
+// key-value store.
+func (l *Layout) KVNamespacePrefix(namespace string) string {
+	return fmt.Sprintf(kvPrefixFormat, namespace)
+}
+
+// RateLimiterPrefix returns the prefix of the distributed rate limiters of
+// a RateLimiter filter.
+func (l *Layout) RateLimiterPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(rateLimiterPrefixFormat, pipeline, name)
+}
+
+// CircuitBreakerPrefix returns the prefix of the states of the circuit
+// breakers of a Proxy filter.
+func (l *Layout) CircuitBreakerPrefix(pipeline string, name string) string {
+	return fmt.Sprintf(circuitBreakerFormat, pipeline, name)
+}
+
+// RetryQueuePrefix returns the prefix of the queued requests of a
+// RetryQueue filter.
+func (l *Layout) RetryQueuePrefix(pipeline string, name string) string {
+	return fmt.Sprintf(retryQueueFormat, pipeline, name)
+}
+
+// MaintenanceFlagPrefix returns the prefix of the maintenance flags.
+func (l *Layout) MaintenanceFlagPrefix() string {
+	return maintenanceFlagPrefix
+}
+
+// MaintenanceFlagKey returns the key of a maintenance flag.
+func (l *Layout) MaintenanceFlagKey(name string) string {
+	return maintenanceFlagPrefix + name
+}
+
 // CustomDataPrefix returns the prefix of all custom data
 func (l *Layout) CustomDataPrefix() string {
 	return customDataPrefix
@@ -156,3 +268,50 @@ func (l *Layout) CustomDataPrefix() string {
 func (l *Layout) CustomDataKindPrefix() string {
 	return customDataKindPrefix
 }
+
+// TLSCertPrefix returns the prefix of the TLS certificates.
+func (l *Layout) TLSCertPrefix() string {
+	return tlsCertPrefix
+}
+
+// SecretPrefix returns the prefix of the secrets.
+func (l *Layout) SecretPrefix() string {
+	return secretPrefix
+}
+
+// SecretMasterKey returns the key of the master key of the secrets, which
+// exists only if the master key is not configured.
+func (l *Layout) SecretMasterKey() string {
+	return secretMasterKey
+}
+
+// ConsumerPrefix returns the prefix of the API consumers.
+func (l *Layout) ConsumerPrefix() string {
+	return consumerPrefix
+}
+
+// ConsumerUsagePrefix returns the prefix of the usage of the API consumers.
+func (l *Layout) ConsumerUsagePrefix() string {
+	return consumerUsagePrefix
+}
+
+// APINamespacePrefix returns the prefix of the namespaces of the admin APIs.
+func (l *Layout) APINamespacePrefix() string {
+	return apiNamespacePrefix
+}
+
+// APINamespaceKey returns the key of a namespace of the admin APIs.
+func (l *Layout) APINamespaceKey(namespace string) string {
+	return fmt.Sprintf(apiNamespaceFormat, namespace)
+}
+
+// ObjectNamespacePrefix returns the prefix of the namespaces of objects.
+func (l *Layout) ObjectNamespacePrefix() string {
+	return objectNamespacePrefix
+}
+
+// ObjectNamespaceKey returns the key of the namespace of an object, it
+// only exists for the objects created in a namespace.
+func (l *Layout) ObjectNamespaceKey(name string) string {
+	return fmt.Sprintf(objectNamespaceFormat, name)
+}
@@ -18,6 +18,7 @@
 package cluster
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -67,6 +68,15 @@ func TestLayout(t *testing.T) {
 		t.Error("WasmDataPrefix empty")
 	}
 
+	assert.Equal("/circuitbreaker/pipeline/proxy/", l.CircuitBreakerPrefix("pipeline", "proxy"))
+	assert.Equal("/maintenance-flags/db", l.MaintenanceFlagKey("db"))
+	assert.True(strings.HasPrefix(l.MaintenanceFlagKey("db"), l.MaintenanceFlagPrefix()))
+
+	assert.Equal("/config/objects-history/pipeline-1/00000000000000000012", l.ConfigObjectHistoryKey("pipeline-1", 12))
+	assert.True(strings.HasPrefix(l.ConfigObjectHistoryKey("pipeline-1", 12), l.ConfigObjectHistoryPrefix("pipeline-1")))
+	assert.True(strings.HasPrefix(l.ConfigObjectHistoryPrefix("pipeline-1"), l.ConfigHistoryPrefix()))
+	assert.Equal("/config-sync/gitops", l.ConfigSyncKey("gitops"))
+
 	assert.Equal(customDataPrefix, l.CustomDataPrefix())
 	assert.Equal(customDataKindPrefix, l.CustomDataKindPrefix())
 }
@@ -111,7 +111,7 @@ func (m *members) load() error {
 func (m *members) store() {
 	buff, err := codectool.MarshalJSON(m)
 	if err != nil {
-		logger.Errorf("BUG: get json of %#v failed: %v", m.KnownMembers, err)
+		logger.Cluster.Errorf("BUG: get json of %#v failed: %v", m.KnownMembers, err)
 	}
 	if bytes.Equal(m.lastBuff, buff) {
 		return
@@ -120,7 +120,7 @@ func (m *members) store() {
 	if m.fileExist() {
 		err := os.Rename(m.file, m.backupFile)
 		if err != nil {
-			logger.Errorf("rename %s to %s failed: %v",
+			logger.Cluster.Errorf("rename %s to %s failed: %v",
 				m.file, m.backupFile, err)
 			return
 		}
@@ -128,11 +128,11 @@ func (m *members) store() {
 
 	err = os.WriteFile(m.file, buff, 0o644)
 	if err != nil {
-		logger.Errorf("write file %s failed: %v", m.file, err)
+		logger.Cluster.Errorf("write file %s failed: %v", m.file, err)
 	} else {
 		m.lastBuff = buff
-		logger.Infof("store clusterMembers: %s", m.ClusterMembers)
-		logger.Infof("store knownMembers  : %s", m.KnownMembers)
+		logger.Cluster.Infof("store clusterMembers: %s", m.ClusterMembers)
+		logger.Cluster.Infof("store knownMembers  : %s", m.KnownMembers)
 	}
 }
 
@@ -156,7 +156,7 @@ func (m *members) _self() *member {
 	}
 
 	if m.opt.ClusterRole == "primary" {
-		logger.Errorf("BUG: can't get self from cluster members: %s "+
+		logger.Cluster.Errorf("BUG: can't get self from cluster members: %s "+
 			"knownMembers: %s", m.ClusterMembers, m.KnownMembers)
 	}
 
@@ -191,7 +191,7 @@ func (m *members) updateClusterMembers(pbMembers []*pb.Member) {
 
 	selfID := m._self().ID
 	if selfID != olderSelfID {
-		logger.Infof("self ID changed from %x to %x", olderSelfID, selfID)
+		logger.Cluster.Infof("self ID changed from %x to %x", olderSelfID, selfID)
 		m.selfIDChanged = true
 	}
 
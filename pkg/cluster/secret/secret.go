@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package secret provides the storage of the secrets in the cluster, the
+// secrets are encrypted by AES-GCM with the master key of the cluster, and
+// could be referenced by `$secret{name/key}` or `${secret:name/key}` in the
+// specs of filters.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const masterKeySize = 32
+
+type (
+	// Secret is a named group of sensitive values.
+	Secret struct {
+		Name string            `json:"name" jsonschema:"required"`
+		Data map[string]string `json:"data" jsonschema:"required"`
+	}
+
+	// Info is the information of a secret, which doesn't contain the values.
+	Info struct {
+		Name string   `json:"name"`
+		Keys []string `json:"keys"`
+	}
+
+	// Store defines the storage for secrets.
+	Store struct {
+		cluster cluster.Cluster
+		prefix  string
+		aead    cipher.AEAD
+	}
+)
+
+var (
+	globalStore atomic.Value
+
+	// refRegexp matches the secret references like $secret{name/key} and
+	// ${secret:name/key}, the latter is escaped by $${secret:name/key}.
+	refRegexp = regexp.MustCompile(`\$secret\{([^/{}]+)/([^{}]+)\}|\$?\$\{secret:([^/{}]+)/([^{}]+)\}`)
+)
+
+// Info returns the information of the secret.
+func (s *Secret) Info() *Info {
+	info := &Info{Name: s.Name, Keys: make([]string, 0, len(s.Data))}
+	for k := range s.Data {
+		info.Keys = append(info.Keys, k)
+	}
+	sort.Strings(info.Keys)
+	return info
+}
+
+// NewStore creates a new secret store. masterKey is the base64 encoded
+// AES-256 key, if it is empty, the one stored in the cluster is used, and
+// it is generated if not exist.
+func NewStore(cls cluster.Cluster, masterKey string) (*Store, error) {
+	var key []byte
+	var err error
+	if masterKey != "" {
+		key, err = base64.StdEncoding.DecodeString(masterKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key: %v", err)
+		}
+	} else {
+		key, err = loadOrCreateMasterKey(cls)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("invalid master key: must be %d bytes", masterKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		cluster: cls,
+		prefix:  cls.Layout().SecretPrefix(),
+		aead:    aead,
+	}, nil
+}
+
+// loadOrCreateMasterKey loads the master key from the cluster, or creates
+// one if not exist. The key in the cluster only protects the secrets from
+// the leakage of the backups or snapshots which don't contain it.
+func loadOrCreateMasterKey(cls cluster.Cluster) ([]byte, error) {
+	keyName := cls.Layout().SecretMasterKey()
+
+	var key []byte
+	err := cls.STM(func(s concurrency.STM) error {
+		if value := s.Get(keyName); value != "" {
+			k, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("invalid master key in cluster: %v", err)
+			}
+			key = k
+			return nil
+		}
+
+		key = make([]byte, masterKeySize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return err
+		}
+		s.Put(keyName, base64.StdEncoding.EncodeToString(key))
+		logger.Cluster.Warnf("secret master key is not configured, a random one is generated and stored in the cluster")
+		return nil
+	})
+	return key, err
+}
+
+func (s *Store) encrypt(secret *Secret) (string, error) {
+	plain, err := json.Marshal(secret.Data)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	// the name is authenticated to prevent the encrypted data from being
+	// copied to another secret.
+	sealed := s.aead.Seal(nonce, nonce, plain, []byte(secret.Name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Store) decrypt(name string, value []byte) (*Secret, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(value))
+	if err != nil {
+		return nil, fmt.Errorf("decode secret %s failed: %v", name, err)
+	}
+
+	size := s.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("decrypt secret %s failed: data too short", name)
+	}
+	plain, err := s.aead.Open(nil, sealed[:size], sealed[size:], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt secret %s failed: %v", name, err)
+	}
+
+	secret := &Secret{Name: name}
+	if err = json.Unmarshal(plain, &secret.Data); err != nil {
+		return nil, fmt.Errorf("unmarshal secret %s failed: %v", name, err)
+	}
+	return secret, nil
+}
+
+// Get gets a secret by its name, it returns nil if the secret does not
+// exist.
+func (s *Store) Get(name string) (*Secret, error) {
+	kv, err := s.cluster.GetRaw(s.prefix + name)
+	if err != nil {
+		return nil, err
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	return s.decrypt(name, kv.Value)
+}
+
+// List lists all secrets.
+func (s *Store) List() ([]*Secret, error) {
+	kvs, err := s.cluster.GetRawPrefix(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*Secret, 0, len(kvs))
+	for k, v := range kvs {
+		secret, err := s.decrypt(strings.TrimPrefix(k, s.prefix), v.Value)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+	return secrets, nil
+}
+
+// Put creates or updates a secret.
+func (s *Store) Put(secret *Secret) error {
+	if secret.Name == "" || strings.ContainsAny(secret.Name, "/{}") {
+		return fmt.Errorf("invalid secret name %q", secret.Name)
+	}
+	for k := range secret.Data {
+		if k == "" || strings.ContainsAny(k, "{}") {
+			return fmt.Errorf("invalid key %q of secret %s", k, secret.Name)
+		}
+	}
+
+	value, err := s.encrypt(secret)
+	if err != nil {
+		return err
+	}
+	return s.cluster.Put(s.prefix+secret.Name, value)
+}
+
+// Delete deletes a secret by its name.
+func (s *Store) Delete(name string) error {
+	return s.cluster.Delete(s.prefix + name)
+}
+
+// Resolve replaces the secret references in str with their values, which
+// are escaped by escape.
+func (s *Store) Resolve(str string, escape func(string) string) (string, error) {
+	var err error
+	secrets := map[string]*Secret{}
+
+	result := refRegexp.ReplaceAllStringFunc(str, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+
+		if strings.HasPrefix(ref, "$${") {
+			return ref[1:]
+		}
+		name, key := parseRef(ref)
+
+		secret, ok := secrets[name]
+		if !ok {
+			secret, err = s.Get(name)
+			if err != nil {
+				return ref
+			}
+			secrets[name] = secret
+		}
+
+		if secret == nil {
+			err = fmt.Errorf("secret %s not found", name)
+			return ref
+		}
+		value, ok := secret.Data[key]
+		if !ok {
+			err = fmt.Errorf("key %s not found in secret %s", key, name)
+			return ref
+		}
+		return escape(value)
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// ReferencedNames returns the names of the secrets referenced by str.
+func ReferencedNames(str string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, ref := range refRegexp.FindAllString(str, -1) {
+		if strings.HasPrefix(ref, "$${") {
+			continue
+		}
+		name, _ := parseRef(ref)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseRef returns the name and the key of the secret reference.
+func parseRef(ref string) (name, key string) {
+	m := refRegexp.FindStringSubmatch(ref)
+	if m[1] != "" {
+		return m[1], m[2]
+	}
+	return m[3], m[4]
+}
+
+// SetGlobalStore sets the global secret store, which is used to resolve
+// the secret references in the specs.
+func SetGlobalStore(s *Store) {
+	globalStore.Store(s)
+}
+
+// GetGlobalStore returns the global secret store, it returns nil if the
+// global store is not set.
+func GetGlobalStore() *Store {
+	if s := globalStore.Load(); s != nil {
+		return s.(*Store)
+	}
+	return nil
+}
+
+// ResolveJSON replaces the secret references in the strings of the JSON
+// document with their values by the global store. The document is returned
+// as is if the global store is not set.
+func ResolveJSON(data []byte) ([]byte, error) {
+	s := GetGlobalStore()
+	if s == nil || !refRegexp.Match(data) {
+		return data, nil
+	}
+
+	result, err := s.Resolve(string(data), func(value string) string {
+		buf := codectool.MustMarshalJSON(value)
+		// remove the quotes, as the references are in JSON strings.
+		return string(buf[1 : len(buf)-1])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result), nil
+}
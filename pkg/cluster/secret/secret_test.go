@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+)
+
+func newTestStore(t *testing.T, data map[string]string) *Store {
+	cls := clustertest.NewMockedCluster()
+	cls.MockedPut = func(key, value string) error {
+		data[key] = value
+		return nil
+	}
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		if v, ok := data[key]; ok {
+			return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(v)}, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		result := map[string]*mvccpb.KeyValue{}
+		for k, v := range data {
+			if strings.HasPrefix(k, prefix) {
+				result[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)}
+			}
+		}
+		return result, nil
+	}
+	cls.MockedDelete = func(key string) error {
+		delete(data, key)
+		return nil
+	}
+
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", masterKeySize)))
+	s, err := NewStore(cls, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore(t *testing.T) {
+	assert := assert.New(t)
+
+	data := map[string]string{}
+	s := newTestStore(t, data)
+
+	assert.Error(s.Put(&Secret{Name: "a/b"}))
+	assert.Error(s.Put(&Secret{Name: "jwt", Data: map[string]string{"{": "x"}}))
+
+	assert.NoError(s.Put(&Secret{Name: "jwt", Data: map[string]string{"key": "top-secret"}}))
+	assert.NoError(s.Put(&Secret{Name: "basic", Data: map[string]string{"user": "u", "password": "p"}}))
+
+	// the values are encrypted.
+	for _, v := range data {
+		assert.NotContains(v, "top-secret")
+	}
+
+	sec, err := s.Get("jwt")
+	assert.NoError(err)
+	assert.Equal("top-secret", sec.Data["key"])
+
+	sec, err = s.Get("none")
+	assert.NoError(err)
+	assert.Nil(sec)
+
+	secrets, err := s.List()
+	assert.NoError(err)
+	assert.Len(secrets, 2)
+	assert.Equal(&Info{Name: "basic", Keys: []string{"password", "user"}}, secrets[0].Info())
+
+	// the encrypted data can't be copied to another secret.
+	data[s.prefix+"copied"] = data[s.prefix+"jwt"]
+	_, err = s.Get("copied")
+	assert.Error(err)
+
+	assert.NoError(s.Delete("copied"))
+	sec, err = s.Get("copied")
+	assert.NoError(err)
+	assert.Nil(sec)
+
+	_, err = NewStore(clustertest.NewMockedCluster(), "bad key")
+	assert.Error(err)
+	_, err = NewStore(clustertest.NewMockedCluster(), base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(err)
+}
+
+func TestResolveJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	doc := []byte(`{"secret": "$secret{jwt/key}", "header": "Bearer $secret{jwt/key}"}`)
+
+	// the references are kept if there's no global store.
+	SetGlobalStore(nil)
+	result, err := ResolveJSON(doc)
+	assert.NoError(err)
+	assert.Equal(doc, result)
+
+	s := newTestStore(t, map[string]string{})
+	assert.NoError(s.Put(&Secret{Name: "jwt", Data: map[string]string{"key": `a"b`}}))
+	SetGlobalStore(s)
+	defer SetGlobalStore(nil)
+
+	result, err = ResolveJSON(doc)
+	assert.NoError(err)
+	assert.JSONEq(`{"secret": "a\"b", "header": "Bearer a\"b"}`, string(result))
+
+	_, err = ResolveJSON([]byte(`{"secret": "$secret{jwt/none}"}`))
+	assert.Error(err)
+	_, err = ResolveJSON([]byte(`{"secret": "$secret{none/key}"}`))
+	assert.Error(err)
+
+	result, err = ResolveJSON([]byte(`{"secret": "${secret:jwt/key}", "escaped": "$${secret:jwt/key}"}`))
+	assert.NoError(err)
+	assert.JSONEq(`{"secret": "a\"b", "escaped": "${secret:jwt/key}"}`, string(result))
+	_, err = ResolveJSON([]byte(`{"secret": "${secret:jwt/none}"}`))
+	assert.Error(err)
+}
+
+func TestReferencedNames(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(ReferencedNames(`{"secret": "plain"}`))
+	names := ReferencedNames(`{"a": "$secret{jwt/key}", "b": "$secret{db/user}:$secret{db/password}", "c": "$secret{jwt/key}"}`)
+	assert.Equal([]string{"jwt", "db"}, names)
+
+	names = ReferencedNames(`{"a": "${secret:jwt/key}", "b": "$${secret:db/user}"}`)
+	assert.Equal([]string{"jwt"}, names)
+}
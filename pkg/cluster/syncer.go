@@ -54,14 +54,14 @@ func (s *syncer) pull(key string, prefix bool) (map[string]*mvccpb.KeyValue, err
 	if prefix {
 		result, err := s.cluster.GetRawPrefix(key)
 		if err != nil {
-			logger.Errorf("failed to pull data for prefix %s: %v", key, err)
+			logger.Cluster.Errorf("failed to pull data for prefix %s: %v", key, err)
 		}
 		return result, err
 	}
 
 	kv, err := s.cluster.GetRaw(key)
 	if err != nil {
-		logger.Errorf("failed to pull data for key %s: %v", key, err)
+		logger.Cluster.Errorf("failed to pull data for key %s: %v", key, err)
 		return nil, err
 	}
 
@@ -79,8 +79,12 @@ func (s *syncer) watch(key string, prefix bool) (clientv3.Watcher, clientv3.Watc
 		opts = append(opts, clientv3.WithPrefix())
 	}
 	watcher := clientv3.NewWatcher(s.client)
-	watchChan := watcher.Watch(context.Background(), key, opts...)
-	logger.Debugf("watcher created for key %s (prefix: %v)", key, prefix)
+	// NOTE: The watcher is canceled if the member it connects to loses the
+	// leader, e.g. in a network partition, so that it is restarted on
+	// another member.
+	ctx := clientv3.WithRequireLeader(context.Background())
+	watchChan := watcher.Watch(ctx, key, opts...)
+	logger.Cluster.Debugf("watcher created for key %s (prefix: %v)", key, prefix)
 	return watcher, watchChan
 }
 
@@ -120,7 +124,9 @@ func isKeyValueEqual(kv1, kv2 *mvccpb.KeyValue) bool {
 
 func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.KeyValue)) {
 	watcher, watchChan := s.watch(key, prefix)
-	defer watcher.Close()
+	defer func() {
+		watcher.Close()
+	}()
 
 	ticker := time.NewTicker(s.pullInterval)
 	defer ticker.Stop()
@@ -130,7 +136,7 @@ func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.
 	pullCompareSend := func() {
 		newData, err := s.pull(key, prefix)
 		if err != nil {
-			logger.Errorf("pull data for key %s (prefix: %v) failed: %v", key, prefix, err)
+			logger.Cluster.Errorf("pull data for key %s (prefix: %v) failed: %v", key, prefix, err)
 			return
 		}
 		if !isDataEqual(data, newData) {
@@ -147,13 +153,25 @@ func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.
 			return
 
 		case <-ticker.C:
+			if watchChan == nil {
+				watcher, watchChan = s.watch(key, prefix)
+			}
 			pullCompareSend()
 
-		case resp := <-watchChan:
+		case resp, ok := <-watchChan:
+			if !ok {
+				// The watch channel is closed if the connection is lost,
+				// restart the watcher at the next pull instead of now to
+				// avoid a busy loop while the cluster is unavailable.
+				logger.Cluster.Debugf("watch key %s closed", key)
+				watcher.Close()
+				watchChan = nil
+				continue
+			}
 			if resp.Canceled {
 				// Etcd cancels a watcher when it cannot catch up with the progress of
 				// the key-value store. And no matter what happens, we restart the watcher.
-				logger.Debugf("watch key %s canceled: %v", key, resp.Err())
+				logger.Cluster.Debugf("watch key %s canceled: %v", key, resp.Err())
 				watcher.Close()
 				watcher, watchChan = s.watch(key, prefix)
 				continue
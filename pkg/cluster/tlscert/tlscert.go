@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tlscert provides the storage of the TLS certificates in the
+// cluster, which could be updated by the API and used by the servers
+// without restarting them.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// Cert is a TLS certificate stored in the cluster.
+	Cert struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Cert is the PEM encoded certificate chain, in plain text or
+		// base64 encoded.
+		Cert string `json:"cert" jsonschema:"required"`
+		// Key is the PEM encoded private key, in plain text or base64
+		// encoded.
+		Key string `json:"key" jsonschema:"required"`
+	}
+
+	// Info is the information of a certificate, which doesn't contain the
+	// private key.
+	Info struct {
+		Name      string    `json:"name"`
+		DNSNames  []string  `json:"dnsNames"`
+		NotBefore time.Time `json:"notBefore"`
+		NotAfter  time.Time `json:"notAfter"`
+	}
+
+	// Store defines the storage for TLS certificates.
+	Store struct {
+		cluster cluster.Cluster
+		prefix  string
+	}
+)
+
+func tryDecodeBase64Pem(pem string) []byte {
+	// The pem could in base64 encoding or plain text, see
+	// httpserver.tryDecodeBase64Pem for details.
+	d, err := base64.StdEncoding.DecodeString(pem)
+	if err == nil {
+		return d
+	}
+	return []byte(pem)
+}
+
+// Certificate parses the certificate into a tls.Certificate, the Leaf of
+// the result is always set.
+func (c *Cert) Certificate() (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(tryDecodeBase64Pem(c.Cert), tryDecodeBase64Pem(c.Key))
+	if err != nil {
+		return nil, fmt.Errorf("generate x509 key pair for %s failed: %v", c.Name, err)
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %s failed: %v", c.Name, err)
+	}
+	return &cert, nil
+}
+
+// Info returns the information of the certificate.
+func (c *Cert) Info() (*Info, error) {
+	cert, err := c.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	return &Info{
+		Name:      c.Name,
+		DNSNames:  cert.Leaf.DNSNames,
+		NotBefore: cert.Leaf.NotBefore,
+		NotAfter:  cert.Leaf.NotAfter,
+	}, nil
+}
+
+// NewStore creates a new TLS certificate store.
+func NewStore(cls cluster.Cluster) *Store {
+	return &Store{
+		cluster: cls,
+		prefix:  cls.Layout().TLSCertPrefix(),
+	}
+}
+
+func unmarshalCert(yamlConfig []byte) (*Cert, error) {
+	cert := &Cert{}
+	err := codectool.Unmarshal(yamlConfig, cert)
+	if err != nil {
+		return nil, fmt.Errorf("BUG: unmarshal %s to json failed: %v", string(yamlConfig), err)
+	}
+	return cert, nil
+}
+
+// Get gets a certificate by its name, it returns nil if the certificate
+// does not exist.
+func (s *Store) Get(name string) (*Cert, error) {
+	kv, err := s.cluster.GetRaw(s.prefix + name)
+	if err != nil {
+		return nil, err
+	}
+
+	if kv == nil {
+		return nil, nil
+	}
+
+	return unmarshalCert(kv.Value)
+}
+
+// List lists all certificates.
+func (s *Store) List() ([]*Cert, error) {
+	kvs, err := s.cluster.GetRawPrefix(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make([]*Cert, 0, len(kvs))
+	for _, v := range kvs {
+		cert, err := unmarshalCert(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// Put creates or updates a certificate.
+func (s *Store) Put(cert *Cert) error {
+	if cert.Name == "" || strings.Contains(cert.Name, "/") {
+		return fmt.Errorf("invalid certificate name %q", cert.Name)
+	}
+	if _, err := cert.Certificate(); err != nil {
+		return err
+	}
+
+	buf, err := codectool.MarshalJSON(cert)
+	if err != nil {
+		return err
+	}
+	return s.cluster.Put(s.prefix+cert.Name, string(buf))
+}
+
+// Delete deletes a certificate by its name.
+func (s *Store) Delete(name string) error {
+	return s.cluster.Delete(s.prefix + name)
+}
+
+// Watch watches the certificates, onChange is called with all of the
+// valid certificates, keyed by their names, when any of them changes.
+func (s *Store) Watch(ctx context.Context, onChange func(map[string]*tls.Certificate)) error {
+	syncer, err := s.cluster.Syncer(5 * time.Minute)
+	if err != nil {
+		return err
+	}
+
+	ch, err := syncer.SyncRawPrefix(s.prefix)
+	if err != nil {
+		syncer.Close()
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			syncer.Close()
+			return nil
+		case m := <-ch:
+			certs := make(map[string]*tls.Certificate, len(m))
+			for _, v := range m {
+				c, err := unmarshalCert(v.Value)
+				if err != nil {
+					logger.Cluster.Errorf("%v", err)
+					continue
+				}
+				cert, err := c.Certificate()
+				if err != nil {
+					logger.Cluster.Errorf("%v", err)
+					continue
+				}
+				certs[c.Name] = cert
+			}
+			onChange(certs)
+		}
+	}
+}
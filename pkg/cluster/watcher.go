@@ -65,7 +65,7 @@ func (w *watcher) Watch(key string) (<-chan *string, error) {
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Infof("watch key %s canceled: %v", key, resp.Err())
+					logger.Cluster.Infof("watch key %s canceled: %v", key, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -79,7 +79,7 @@ func (w *watcher) Watch(key string) (<-chan *string, error) {
 					case mvccpb.DELETE:
 						keyChan <- nil
 					default:
-						logger.Errorf("BUG: key %s received unknown event type %v",
+						logger.Cluster.Errorf("BUG: key %s received unknown event type %v",
 							key, event.Type)
 					}
 				}
@@ -106,7 +106,7 @@ func (w *watcher) WatchRaw(key string) (<-chan *clientv3.Event, error) {
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Infof("watch raw key %s canceled: %v", key, resp.Err())
+					logger.Cluster.Infof("watch raw key %s canceled: %v", key, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -119,7 +119,7 @@ func (w *watcher) WatchRaw(key string) (<-chan *clientv3.Event, error) {
 					case mvccpb.DELETE:
 						eventChan <- nil
 					default:
-						logger.Errorf("BUG: key %s received unknown event type %v",
+						logger.Cluster.Errorf("BUG: key %s received unknown event type %v",
 							key, event.Type)
 					}
 				}
@@ -147,7 +147,7 @@ func (w *watcher) WatchPrefix(prefix string) (<-chan map[string]*string, error)
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Errorf("watch prefix %s canceled: %v", prefix, resp.Err())
+					logger.Cluster.Errorf("watch prefix %s canceled: %v", prefix, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -165,7 +165,7 @@ func (w *watcher) WatchPrefix(prefix string) (<-chan map[string]*string, error)
 							string(event.Kv.Key): nil,
 						}
 					default:
-						logger.Errorf("BUG: prefix %s received unknown event type %v",
+						logger.Cluster.Errorf("BUG: prefix %s received unknown event type %v",
 							prefix, event.Type)
 					}
 				}
@@ -192,7 +192,7 @@ func (w *watcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Eve
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Errorf("watch raw prefix %s canceled: %v", prefix, resp.Err())
+					logger.Cluster.Errorf("watch raw prefix %s canceled: %v", prefix, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -209,7 +209,7 @@ func (w *watcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Eve
 							string(event.Kv.Key): nil,
 						}
 					default:
-						logger.Errorf("BUG: prefix %s received unknown event type %v",
+						logger.Cluster.Errorf("BUG: prefix %s received unknown event type %v",
 							prefix, event.Type)
 					}
 				}
@@ -243,7 +243,7 @@ func (w *watcher) WatchWithOp(key string, ops ...ClientOp) (<-chan map[string]*s
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Errorf("watch %s with ops %v canceled: %v", key, ops, resp.Err())
+					logger.Cluster.Errorf("watch %s with ops %v canceled: %v", key, ops, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -261,7 +261,7 @@ func (w *watcher) WatchWithOp(key string, ops ...ClientOp) (<-chan map[string]*s
 							string(event.Kv.Key): nil,
 						}
 					default:
-						logger.Errorf("BUG: key %s with ops %v received unknown event type %v",
+						logger.Cluster.Errorf("BUG: key %s with ops %v received unknown event type %v",
 							key, ops, event.Type)
 					}
 				}
@@ -277,6 +277,6 @@ func (w *watcher) Close() {
 
 	err := w.w.Close()
 	if err != nil {
-		logger.Errorf("close watcher failed: %v", err)
+		logger.Cluster.Errorf("close watcher failed: %v", err)
 	}
 }
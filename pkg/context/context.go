@@ -20,6 +20,7 @@ package context
 import (
 	"bytes"
 	"runtime/debug"
+	"sync"
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols"
@@ -40,26 +41,32 @@ type MuxMapper interface {
 	GetHandler(name string) (Handler, bool)
 }
 
+// requestRef is a reference of a request, a borrowed reference is created
+// by Fork, its request is owned by the parent context and is never closed
+// by the reference.
 type requestRef struct {
-	req     protocols.Request
-	counter int
+	req      protocols.Request
+	counter  int
+	borrowed bool
 }
 
 func (rr *requestRef) release() {
 	rr.counter--
-	if rr.counter == 0 {
+	if rr.counter == 0 && !rr.borrowed {
 		rr.req.Close()
 	}
 }
 
+// responseRef is a reference of a response, see requestRef for borrowed.
 type responseRef struct {
-	resp    protocols.Response
-	counter int
+	resp     protocols.Response
+	counter  int
+	borrowed bool
 }
 
 func (rr *responseRef) release() {
 	rr.counter--
-	if rr.counter == 0 {
+	if rr.counter == 0 && !rr.borrowed {
 		rr.resp.Close()
 	}
 }
@@ -77,25 +84,198 @@ type Context struct {
 
 	data        map[string]interface{}
 	finishFuncs []func()
+
+	streamResponse bool
+}
+
+// contextPool recycles the contexts released by Release.
+var contextPool = sync.Pool{
+	New: func() interface{} {
+		return &Context{
+			requests:  map[string]*requestRef{},
+			responses: map[string]*responseRef{},
+			data:      map[string]interface{}{},
+		}
+	},
 }
 
-// New creates a new Context.
+// New creates a new Context, it could be recycled by Release.
 func New(span tracing.Span) *Context {
-	ctx := &Context{
-		span:      span,
-		activeNs:  DefaultNamespace,
-		requests:  map[string]*requestRef{},
-		responses: map[string]*responseRef{},
-		data:      map[string]interface{}{},
-	}
+	ctx := contextPool.Get().(*Context)
+	ctx.span = span
+	ctx.activeNs = DefaultNamespace
 	return ctx
 }
 
+// Release resets ctx and puts it back to the pool for reuse. It must be
+// called after Finish, and ctx, as well as the maps returned by it, e.g.
+// the one of Data, must not be used after that. It is the caller's
+// responsibility to make sure no one holds ctx.
+func (ctx *Context) Release() {
+	for k := range ctx.requests {
+		delete(ctx.requests, k)
+	}
+	for k := range ctx.responses {
+		delete(ctx.responses, k)
+	}
+	for k := range ctx.data {
+		delete(ctx.data, k)
+	}
+
+	// clear the elements, so the closures could be garbage collected.
+	for i := range ctx.lazyTags {
+		ctx.lazyTags[i] = nil
+	}
+	ctx.lazyTags = ctx.lazyTags[:0]
+	for i := range ctx.finishFuncs {
+		ctx.finishFuncs[i] = nil
+	}
+	ctx.finishFuncs = ctx.finishFuncs[:0]
+
+	ctx.span = nil
+	ctx.activeNs = ""
+	ctx.streamResponse = false
+	contextPool.Put(ctx)
+}
+
+// Fork creates a child of ctx to run handlers concurrently with other
+// children. The child shares the span, the requests and the responses of
+// ctx, and has a copy of the data. The requests and responses are shared
+// by reference, so the handlers running on the child should not modify
+// them, but could set new ones, which are merged into ctx by Join.
+//
+// Fork and Join must be called in the goroutine of ctx, and the child must
+// not be finished, its finish functions are moved to ctx by Join. The child
+// could be released by Release after Join.
+func (ctx *Context) Fork() *Context {
+	child := contextPool.Get().(*Context)
+	child.span = ctx.span
+	child.activeNs = ctx.activeNs
+	child.streamResponse = ctx.streamResponse
+
+	// namespaces sharing a reference in ctx also share it in the child.
+	reqRefs := map[*requestRef]*requestRef{}
+	for ns, rr := range ctx.requests {
+		ref := reqRefs[rr]
+		if ref == nil {
+			ref = &requestRef{req: rr.req, borrowed: true}
+			reqRefs[rr] = ref
+		}
+		ref.counter++
+		child.requests[ns] = ref
+	}
+
+	respRefs := map[*responseRef]*responseRef{}
+	for ns, rr := range ctx.responses {
+		ref := respRefs[rr]
+		if ref == nil {
+			ref = &responseRef{resp: rr.resp, borrowed: true}
+			respRefs[rr] = ref
+		}
+		ref.counter++
+		child.responses[ns] = ref
+	}
+
+	for k, v := range ctx.data {
+		child.data[k] = v
+	}
+
+	return child
+}
+
+// Join merges a child created by Fork into ctx, the requests, responses,
+// data, tags and finish functions set by the child override or append to
+// those of ctx.
+func (ctx *Context) Join(child *Context) {
+	// borrowed references are merged first, so the requests and responses
+	// they refer to are not released by the owned ones.
+	for ns, rr := range child.requests {
+		if rr.borrowed {
+			ctx.shareRequest(ns, rr.req)
+		}
+	}
+	for ns, rr := range child.requests {
+		if rr.borrowed {
+			continue
+		}
+		if prev := ctx.requests[ns]; prev != nil {
+			prev.release()
+		}
+		ctx.requests[ns] = rr
+	}
+
+	for ns, rr := range child.responses {
+		if rr.borrowed {
+			ctx.shareResponse(ns, rr.resp)
+		}
+	}
+	for ns, rr := range child.responses {
+		if rr.borrowed {
+			continue
+		}
+		if prev := ctx.responses[ns]; prev != nil {
+			prev.release()
+		}
+		ctx.responses[ns] = rr
+	}
+
+	for k, v := range child.data {
+		ctx.data[k] = v
+	}
+	ctx.lazyTags = append(ctx.lazyTags, child.lazyTags...)
+	ctx.finishFuncs = append(ctx.finishFuncs, child.finishFuncs...)
+}
+
+// shareRequest makes namespace ns refer to req, which is a request of
+// another namespace of ctx.
+func (ctx *Context) shareRequest(ns string, req protocols.Request) {
+	prev := ctx.requests[ns]
+	if prev != nil && prev.req == req {
+		return
+	}
+	for _, rr := range ctx.requests {
+		if rr.req == req {
+			rr.counter++
+			if prev != nil {
+				prev.release()
+			}
+			ctx.requests[ns] = rr
+			return
+		}
+	}
+}
+
+// shareResponse makes namespace ns refer to resp, which is a response of
+// another namespace of ctx.
+func (ctx *Context) shareResponse(ns string, resp protocols.Response) {
+	prev := ctx.responses[ns]
+	if prev != nil && prev.resp == resp {
+		return
+	}
+	for _, rr := range ctx.responses {
+		if rr.resp == resp {
+			rr.counter++
+			if prev != nil {
+				prev.release()
+			}
+			ctx.responses[ns] = rr
+			return
+		}
+	}
+}
+
 // Span returns the span of this Context.
 func (ctx *Context) Span() tracing.Span {
 	return ctx.span
 }
 
+// SetSpan replaces the span of this Context, e.g. with a child span of
+// it, so that the spans created by the handlers are children of the new
+// one.
+func (ctx *Context) SetSpan(span tracing.Span) {
+	ctx.span = span
+}
+
 // AddTag add a tag to the Context.
 func (ctx *Context) AddTag(tag string) {
 	ctx.lazyTags = append(ctx.lazyTags, func() string { return tag })
@@ -197,7 +377,7 @@ func (ctx *Context) SetRequest(ns string, req protocols.Request) {
 		}
 		prev.release()
 	}
-	ctx.requests[ns] = &requestRef{req, 1}
+	ctx.requests[ns] = &requestRef{req: req, counter: 1}
 }
 
 // GetInputRequest returns the request of the input namespace.
@@ -300,7 +480,7 @@ func (ctx *Context) SetResponse(ns string, resp protocols.Response) {
 		}
 		prev.release()
 	}
-	ctx.responses[ns] = &responseRef{resp, 1}
+	ctx.responses[ns] = &responseRef{resp: resp, counter: 1}
 }
 
 // GetInputResponse returns the response of the input namespace.
@@ -338,6 +518,19 @@ func (ctx *Context) GetData(key string) interface{} {
 	return ctx.data[key]
 }
 
+// SetStreamResponse sets whether the responses could be streamed, i.e. no
+// one requires their full payloads.
+func (ctx *Context) SetStreamResponse(stream bool) {
+	ctx.streamResponse = stream
+}
+
+// StreamResponse returns whether the responses could be streamed, handlers
+// creating responses, e.g. the Proxy filter, should stream the payloads
+// unless they are configured otherwise.
+func (ctx *Context) StreamResponse() bool {
+	return ctx.streamResponse
+}
+
 // Tags joins all tags into a string and returns it.
 func (ctx *Context) Tags() string {
 	buf := bytes.Buffer{}
@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package adaptiveconcurrency implements the AdaptiveConcurrencyLimiter
+// filter, which limits the number of in-flight requests by a limit adjusted
+// dynamically by the latency of the backend.
+package adaptiveconcurrency
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of AdaptiveConcurrencyLimiter.
+	Kind = "AdaptiveConcurrencyLimiter"
+
+	resultLimited = "concurrencyLimited"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "AdaptiveConcurrencyLimiter limits the in-flight requests by a limit adjusted by the latency",
+	Results:     []string{resultLimited},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			InitialLimit: 20,
+			MinLimit:     1,
+			MaxLimit:     1000,
+			Tolerance:    1.5,
+			Smoothing:    0.2,
+			LongWindow:   600,
+			Window:       "1s",
+			RetryAfter:   "1s",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &AdaptiveConcurrencyLimiter{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*AdaptiveConcurrencyLimiter)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// AdaptiveConcurrencyLimiter is the filter AdaptiveConcurrencyLimiter.
+	AdaptiveConcurrencyLimiter struct {
+		spec *Spec
+
+		limiter    *gradientLimiter
+		retryAfter string
+
+		numOfRejected uint64
+	}
+
+	// Spec describes the AdaptiveConcurrencyLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		InitialLimit int `json:"initialLimit" jsonschema:"omitempty"`
+		MinLimit     int `json:"minLimit" jsonschema:"omitempty"`
+		MaxLimit     int `json:"maxLimit" jsonschema:"omitempty"`
+		// Tolerance is the ratio of the latency to the long-term latency
+		// tolerated before decreasing the limit.
+		Tolerance float64 `json:"tolerance" jsonschema:"omitempty"`
+		// Smoothing is the factor of the new limit, from 0 to 1, a smaller
+		// one makes the limit change slower.
+		Smoothing float64 `json:"smoothing" jsonschema:"omitempty"`
+		// LongWindow is the number of windows of the long-term latency.
+		LongWindow int `json:"longWindow" jsonschema:"omitempty"`
+		// Window is the interval to sample the latency and update the
+		// limit.
+		Window     string `json:"window" jsonschema:"omitempty,format=duration"`
+		RetryAfter string `json:"retryAfter" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of AdaptiveConcurrencyLimiter.
+	Status struct {
+		Limit         int    `json:"limit"`
+		InFlight      int    `json:"inFlight"`
+		ShortRTT      string `json:"shortRTT"`
+		LongRTT       string `json:"longRTT"`
+		NumOfRejected uint64 `json:"numOfRejected"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if s.MinLimit < 1 {
+		return fmt.Errorf("minLimit must be positive")
+	}
+	if s.MaxLimit < s.MinLimit {
+		return fmt.Errorf("maxLimit must not be less than minLimit")
+	}
+	if s.InitialLimit < s.MinLimit || s.InitialLimit > s.MaxLimit {
+		return fmt.Errorf("initialLimit must be between minLimit and maxLimit")
+	}
+	if s.Tolerance < 1 {
+		return fmt.Errorf("tolerance must not be less than 1")
+	}
+	if s.Smoothing <= 0 || s.Smoothing > 1 {
+		return fmt.Errorf("smoothing must be in (0, 1]")
+	}
+	if s.LongWindow < 1 {
+		return fmt.Errorf("longWindow must be positive")
+	}
+	if d, err := time.ParseDuration(s.Window); err != nil || d <= 0 {
+		return fmt.Errorf("invalid window %s", s.Window)
+	}
+	if d, err := time.ParseDuration(s.RetryAfter); err != nil || d < 0 {
+		return fmt.Errorf("invalid retryAfter %s", s.RetryAfter)
+	}
+	return nil
+}
+
+// Name returns the name of the AdaptiveConcurrencyLimiter filter instance.
+func (a *AdaptiveConcurrencyLimiter) Name() string {
+	return a.spec.Name()
+}
+
+// Kind returns the kind of AdaptiveConcurrencyLimiter.
+func (a *AdaptiveConcurrencyLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the AdaptiveConcurrencyLimiter.
+func (a *AdaptiveConcurrencyLimiter) Spec() filters.Spec {
+	return a.spec
+}
+
+// Init initializes AdaptiveConcurrencyLimiter.
+func (a *AdaptiveConcurrencyLimiter) Init() {
+	a.reload()
+}
+
+// Inherit inherits previous generation of AdaptiveConcurrencyLimiter. The
+// limit is learned again from the initial limit, as the spec may change.
+func (a *AdaptiveConcurrencyLimiter) Inherit(previousGeneration filters.Filter) {
+	a.reload()
+}
+
+func (a *AdaptiveConcurrencyLimiter) reload() {
+	a.limiter = newGradientLimiter(a.spec, time.Now())
+	d, _ := time.ParseDuration(a.spec.RetryAfter)
+	a.retryAfter = strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Handle limits the in-flight requests, the latency is measured from the
+// filter to the end of the response.
+func (a *AdaptiveConcurrencyLimiter) Handle(ctx *context.Context) string {
+	limiter := a.limiter
+	if !limiter.acquire() {
+		atomic.AddUint64(&a.numOfRejected, 1)
+		ctx.AddTag(a.Name() + ": concurrency limit exceeded")
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusServiceUnavailable)
+		resp.HTTPHeader().Set("Retry-After", a.retryAfter)
+		ctx.SetOutputResponse(resp)
+		return resultLimited
+	}
+
+	start := time.Now()
+	ctx.OnFinish(func() {
+		// The latencies of the failed requests are not sampled, as they
+		// could fail fast and make the limit grow.
+		rtt := time.Since(start)
+		resp, _ := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+		if resp == nil || resp.StatusCode() >= 500 {
+			rtt = -1
+		}
+		limiter.release(rtt, time.Now())
+	})
+	return ""
+}
+
+// Status returns status.
+func (a *AdaptiveConcurrencyLimiter) Status() interface{} {
+	s := a.limiter.status()
+	s.NumOfRejected = atomic.LoadUint64(&a.numOfRejected)
+	return s
+}
+
+// Close closes AdaptiveConcurrencyLimiter.
+func (a *AdaptiveConcurrencyLimiter) Close() {
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adaptiveconcurrency
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestLimiter(assert *assert.Assertions, yamlConfig string) *AdaptiveConcurrencyLimiter {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	a := kind.CreateInstance(spec).(*AdaptiveConcurrencyLimiter)
+	a.Init()
+	return a
+}
+
+func newTestContext() *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func defaultSpec() *Spec {
+	return kind.DefaultSpec().(*Spec)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(defaultSpec().Validate())
+	for _, fn := range []func(s *Spec){
+		func(s *Spec) { s.MinLimit = 0 },
+		func(s *Spec) { s.MaxLimit = 10 },
+		func(s *Spec) { s.InitialLimit = 2000 },
+		func(s *Spec) { s.Tolerance = 0.5 },
+		func(s *Spec) { s.Smoothing = 0 },
+		func(s *Spec) { s.LongWindow = 0 },
+		func(s *Spec) { s.Window = "0s" },
+		func(s *Spec) { s.RetryAfter = "x" },
+	} {
+		s := defaultSpec()
+		fn(s)
+		assert.Error(s.Validate())
+	}
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newTestLimiter(assert, `
+kind: AdaptiveConcurrencyLimiter
+name: limiter
+initialLimit: 2
+minLimit: 1
+retryAfter: 1500ms
+`)
+	defer a.Close()
+
+	ctx1, ctx2, ctx3 := newTestContext(), newTestContext(), newTestContext()
+	assert.Equal("", a.Handle(ctx1))
+	assert.Equal("", a.Handle(ctx2))
+	assert.Equal(resultLimited, a.Handle(ctx3))
+	resp := ctx3.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal("2", resp.HTTPHeader().Get("Retry-After"))
+
+	status := a.Status().(*Status)
+	assert.Equal(2, status.InFlight)
+	assert.Equal(uint64(1), status.NumOfRejected)
+
+	ctx1.Finish()
+	ctx3 = newTestContext()
+	assert.Equal("", a.Handle(ctx3))
+	ctx2.Finish()
+	ctx3.Finish()
+	assert.Equal(0, a.Status().(*Status).InFlight)
+}
+
+func TestGradientLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := defaultSpec()
+	spec.InitialLimit = 10
+	now := time.Now()
+	l := newGradientLimiter(spec, now)
+
+	// runs a window with n in-flight requests of the latency.
+	run := func(n int, rtt time.Duration) int {
+		for i := 0; i < n; i++ {
+			assert.True(l.acquire())
+		}
+		for i := 0; i < n-1; i++ {
+			l.release(rtt, now)
+		}
+		// the last one ends the window.
+		now = now.Add(time.Second)
+		l.release(rtt, now)
+		return l.status().Limit
+	}
+
+	// the limit grows while the latency is stable.
+	limit := 10
+	for i := 0; i < 5; i++ {
+		newLimit := run(limit, 10*time.Millisecond)
+		assert.True(newLimit >= limit)
+		limit = newLimit
+	}
+	assert.True(limit > 10)
+
+	// the limit doesn't grow if the traffic doesn't need it.
+	assert.Equal(limit, run(1, 10*time.Millisecond))
+
+	// the limit shrinks once the latency goes up.
+	for i := 0; i < 10; i++ {
+		newLimit := run(limit, 100*time.Millisecond)
+		assert.True(newLimit <= limit)
+		limit = newLimit
+	}
+	assert.True(limit < 10)
+
+	// the failed requests are not sampled.
+	assert.True(l.acquire())
+	now = now.Add(time.Second)
+	l.release(-1, now)
+	assert.Equal(limit, l.status().Limit)
+	assert.Equal(0, l.status().InFlight)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adaptiveconcurrency
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// gradientLimiter limits the number of in-flight requests by the gradient
+// algorithm of Netflix's concurrency-limits. At the end of every window,
+// the average latency of the window (the short RTT) is compared with the
+// exponential moving average of the latencies (the long RTT):
+//
+//	gradient = clamp(tolerance * longRTT / shortRTT, 0.5, 1)
+//	newLimit = limit * gradient + sqrt(limit)
+//	limit    = limit * (1 - smoothing) + newLimit * smoothing
+//
+// So the limit grows by the queue size, sqrt(limit), while the latency is
+// stable, and shrinks by up to half once the latency goes up.
+type gradientLimiter struct {
+	minLimit   float64
+	maxLimit   float64
+	tolerance  float64
+	smoothing  float64
+	longFactor float64
+	window     time.Duration
+
+	mutex       sync.Mutex
+	limit       float64
+	inFlight    int
+	maxInFlight int
+	windowStart time.Time
+	sum         time.Duration
+	samples     int
+	shortRTT    time.Duration
+	longRTT     float64
+}
+
+func newGradientLimiter(spec *Spec, now time.Time) *gradientLimiter {
+	window, _ := time.ParseDuration(spec.Window)
+	return &gradientLimiter{
+		minLimit:    float64(spec.MinLimit),
+		maxLimit:    float64(spec.MaxLimit),
+		tolerance:   spec.Tolerance,
+		smoothing:   spec.Smoothing,
+		longFactor:  2 / float64(spec.LongWindow+1),
+		window:      window,
+		limit:       float64(spec.InitialLimit),
+		windowStart: now,
+	}
+}
+
+// acquire returns false if the number of in-flight requests reaches the
+// limit, otherwise the caller must call release once the request is done.
+func (l *gradientLimiter) acquire() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	if l.inFlight > l.maxInFlight {
+		l.maxInFlight = l.inFlight
+	}
+	return true
+}
+
+// release releases an in-flight request, the rtt is sampled unless it is
+// negative, e.g. the request failed.
+func (l *gradientLimiter) release(rtt time.Duration, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inFlight--
+	if rtt >= 0 {
+		l.sum += rtt
+		l.samples++
+	}
+
+	if now.Sub(l.windowStart) < l.window {
+		return
+	}
+	if l.samples > 0 {
+		l.update(l.sum / time.Duration(l.samples))
+	}
+	l.windowStart = now
+	l.sum, l.samples = 0, 0
+	l.maxInFlight = l.inFlight
+}
+
+// update must be called with the lock held.
+func (l *gradientLimiter) update(shortRTT time.Duration) {
+	l.shortRTT = shortRTT
+	short := float64(shortRTT)
+	if short <= 0 {
+		return
+	}
+
+	if l.longRTT == 0 {
+		l.longRTT = short
+	} else {
+		l.longRTT = l.longRTT*(1-l.longFactor) + short*l.longFactor
+	}
+	// The long RTT recovers faster if the latency drops a lot, e.g. after
+	// the backend recovers from an incident.
+	if l.longRTT/short > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// Don't grow the limit if the traffic doesn't need it, otherwise it
+	// could grow without bound.
+	if float64(l.maxInFlight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.tolerance*l.longRTT/short))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	newLimit = l.limit*(1-l.smoothing) + newLimit*l.smoothing
+	l.limit = math.Max(l.minLimit, math.Min(l.maxLimit, newLimit))
+}
+
+func (l *gradientLimiter) status() *Status {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return &Status{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		ShortRTT: l.shortRTT.String(),
+		LongRTT:  time.Duration(l.longRTT).String(),
+	}
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package aggregator implements the Aggregator filter, which fans a request
+// out to several backends and merges their responses.
+package aggregator
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of Aggregator.
+	Kind = "Aggregator"
+
+	resultFailed   = "failed"
+	resultBuildErr = "buildErr"
+
+	defaultTimeout = 5 * time.Second
+	// 4MB
+	defaultMaxBodySize = 4 * 1024 * 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Aggregator fans a request out to several backends and merges their JSON responses.",
+	Results:     []string{resultFailed, resultBuildErr},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Aggregator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// All Aggregator instances use one globalClient in order to reuse
+// some resources such as keepalive connections.
+var globalClient = &http.Client{
+	// NOTE: The timeouts are set by the calls.
+	Timeout: 0,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 60 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          10240,
+		MaxIdleConnsPerHost:   512,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+type (
+	// Aggregator is filter Aggregator.
+	Aggregator struct {
+		spec     *Spec
+		template *template.Template
+		calls    []*call
+
+		numOfFailures int64
+	}
+
+	// Spec describes the Aggregator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Calls []*Call `json:"calls" jsonschema:"required,minItems=1"`
+		// Template builds the JSON body of the response from the results
+		// of the calls, the body is an object whose keys are the names of
+		// the calls and values are the bodies of the calls if it is empty.
+		Template string `json:"template" jsonschema:"omitempty"`
+		// MaxBodySize is the max size of the body of every call.
+		MaxBodySize int64 `json:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Call is a call to a backend.
+	Call struct {
+		Name   string `json:"name" jsonschema:"required"`
+		URL    string `json:"url" jsonschema:"required,format=uri"`
+		Method string `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		// ForwardHeaders are the headers of the request forwarded to the
+		// backend.
+		ForwardHeaders []string `json:"forwardHeaders" jsonschema:"omitempty"`
+		// ForwardQuery appends the query of the request to the URL.
+		ForwardQuery bool `json:"forwardQuery" jsonschema:"omitempty"`
+		// ForwardBody sends the body of the request to the backend.
+		ForwardBody bool   `json:"forwardBody" jsonschema:"omitempty"`
+		Timeout     string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// Optional calls don't fail the request when they fail, their
+		// bodies are Default, which is a JSON text, instead.
+		Optional bool   `json:"optional" jsonschema:"omitempty"`
+		Default  string `json:"default" jsonschema:"omitempty"`
+	}
+
+	// Result is the result of a call, which is accessible in the template
+	// by .calls.<name>.
+	Result struct {
+		StatusCode int
+		Header     http.Header
+		Body       interface{}
+		Error      string
+	}
+
+	// Status is the status of Aggregator.
+	Status struct {
+		NumOfFailures int64 `json:"numOfFailures"`
+	}
+
+	call struct {
+		spec        *Call
+		timeout     time.Duration
+		defaultBody interface{}
+	}
+)
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	names := map[string]struct{}{}
+	for _, c := range spec.Calls {
+		if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("duplicated call %s", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		if c.Default != "" && !json.Valid([]byte(c.Default)) {
+			return fmt.Errorf("call %s: default is not valid JSON", c.Name)
+		}
+	}
+
+	if spec.Template != "" {
+		if _, err := newTemplate(spec.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(sprig.TxtFuncMap()).Parse(text)
+}
+
+// Name returns the name of the Aggregator filter instance.
+func (a *Aggregator) Name() string {
+	return a.spec.Name()
+}
+
+// Kind returns the kind of Aggregator.
+func (a *Aggregator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Aggregator.
+func (a *Aggregator) Spec() filters.Spec {
+	return a.spec
+}
+
+// Init initializes Aggregator.
+func (a *Aggregator) Init() {
+	a.reload()
+}
+
+// Inherit inherits previous generation of Aggregator.
+func (a *Aggregator) Inherit(previousGeneration filters.Filter) {
+	a.Init()
+}
+
+func (a *Aggregator) reload() {
+	if a.spec.Template != "" {
+		a.template = template.Must(newTemplate(a.spec.Template))
+	}
+	if a.spec.MaxBodySize == 0 {
+		a.spec.MaxBodySize = defaultMaxBodySize
+	}
+
+	a.calls = make([]*call, 0, len(a.spec.Calls))
+	for _, c := range a.spec.Calls {
+		timeout := defaultTimeout
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil {
+				logger.Errorf("BUG: parse duration %s failed: %v", c.Timeout, err)
+			} else {
+				timeout = d
+			}
+		}
+		var defaultBody interface{}
+		if c.Default != "" {
+			if err := codectool.UnmarshalJSON([]byte(c.Default), &defaultBody); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", c.Default, err)
+			}
+		}
+		a.calls = append(a.calls, &call{spec: c, timeout: timeout, defaultBody: defaultBody})
+	}
+}
+
+// Handle calls the backends in parallel and merges their responses.
+func (a *Aggregator) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	results := make([]*Result, len(a.calls))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(a.calls))
+	for i, c := range a.calls {
+		go func(i int, c *call) {
+			defer wg.Done()
+			results[i] = a.do(req, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	calls := make(map[string]*Result, len(a.calls))
+	for i, c := range a.calls {
+		r := results[i]
+		if r.Error != "" {
+			atomic.AddInt64(&a.numOfFailures, 1)
+			ctx.AddTag(fmt.Sprintf("%s: call %s failed: %s", a.Name(), c.spec.Name, r.Error))
+			if !c.spec.Optional {
+				body, _ := codectool.MarshalJSON(map[string]string{
+					"error": fmt.Sprintf("call %s failed", c.spec.Name),
+				})
+				a.buildResponse(ctx, http.StatusBadGateway, body)
+				return resultFailed
+			}
+			r.Body = c.defaultBody
+		}
+		calls[c.spec.Name] = r
+	}
+
+	body, err := a.merge(req, calls)
+	if err != nil {
+		logger.Errorf("%s: build response failed: %v", a.Name(), err)
+		a.buildResponse(ctx, http.StatusInternalServerError, nil)
+		return resultBuildErr
+	}
+
+	a.buildResponse(ctx, http.StatusOK, body)
+	return ""
+}
+
+// do calls the backend, the error of the result is set if the call fails,
+// or the backend returns a non-2xx status code or an invalid JSON body.
+func (a *Aggregator) do(req *httpprot.Request, c *call) *Result {
+	result := &Result{}
+
+	url := c.spec.URL
+	if c.spec.ForwardQuery && req.URL().RawQuery != "" {
+		if strings.Contains(url, "?") {
+			url += "&" + req.URL().RawQuery
+		} else {
+			url += "?" + req.URL().RawQuery
+		}
+	}
+
+	var body io.Reader
+	if c.spec.ForwardBody && !req.IsStream() {
+		body = bytes.NewReader(req.RawPayload())
+	}
+
+	method := c.spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	timeoutCtx, cancel := stdcontext.WithTimeout(req.Context(), c.timeout)
+	defer cancel()
+
+	stdr, err := http.NewRequestWithContext(timeoutCtx, method, url, body)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, k := range c.spec.ForwardHeaders {
+		if v := req.HTTPHeader().Values(k); len(v) > 0 {
+			stdr.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	resp, err := globalClient.Do(stdr)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode, result.Header = resp.StatusCode, resp.Header
+	data, err := io.ReadAll(io.LimitReader(resp.Body, a.spec.MaxBodySize+1))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if int64(len(data)) > a.spec.MaxBodySize {
+		result.Error = fmt.Sprintf("body is larger than %dB", a.spec.MaxBodySize)
+		return result
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = fmt.Sprintf("not 2xx status code: %d", resp.StatusCode)
+		return result
+	}
+
+	if len(data) > 0 {
+		if err = codectool.UnmarshalJSON(data, &result.Body); err != nil {
+			result.Error = fmt.Sprintf("invalid JSON body: %v", err)
+		}
+	}
+	return result
+}
+
+// merge builds the body of the response from the results of the calls.
+func (a *Aggregator) merge(req *httpprot.Request, calls map[string]*Result) ([]byte, error) {
+	if a.template == nil {
+		bodies := make(map[string]interface{}, len(calls))
+		for name, r := range calls {
+			bodies[name] = r.Body
+		}
+		return codectool.MarshalJSON(bodies)
+	}
+
+	var buf bytes.Buffer
+	data := map[string]interface{}{
+		"request": req.ToBuilderRequest(context.DefaultNamespace),
+		"calls":   calls,
+	}
+	if err := a.template.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("result of template is not valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *Aggregator) buildResponse(ctx *context.Context, code int, body []byte) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+	if body != nil {
+		resp.HTTPHeader().Set("Content-Type", "application/json")
+		resp.SetPayload(body)
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Status returns status.
+func (a *Aggregator) Status() interface{} {
+	return &Status{NumOfFailures: atomic.LoadInt64(&a.numOfFailures)}
+}
+
+// Close closes Aggregator.
+func (a *Aggregator) Close() {}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aggregator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestAggregator(assert *assert.Assertions, yamlConfig string) *Aggregator {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	a := kind.CreateInstance(spec).(*Aggregator)
+	a.Init()
+	return a
+}
+
+func handle(assert *assert.Assertions, a *Aggregator) (string, *httpprot.Response) {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/profile?id=1", nil)
+	stdr.Header.Set("Authorization", "Bearer token")
+	req, _ := httpprot.NewRequest(stdr)
+	assert.NoError(req.FetchPayload(0))
+	ctx.SetInputRequest(req)
+
+	result := a.Handle(ctx)
+	return result, ctx.GetOutputResponse().(*httpprot.Response)
+}
+
+func newBackend() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"id": %s, "name": "alice"}`, r.URL.Query().Get("id"))
+	})
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[{"id": 10}]`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`hello`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Calls: []*Call{{Name: "a"}, {Name: "a"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Calls: []*Call{{Name: "a"}}, Template: "{{.calls"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Calls: []*Call{{Name: "a", Default: "{"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Calls: []*Call{{Name: "a"}, {Name: "b"}}, Template: "{{toJson .calls.a.Body}}"}
+	assert.NoError(spec.Validate())
+}
+
+func TestAggregate(t *testing.T) {
+	assert := assert.New(t)
+	backend := newBackend()
+	defer backend.Close()
+
+	yamlConfig := `
+kind: Aggregator
+name: aggregator
+calls:
+- name: user
+  url: %[1]s/users
+  forwardQuery: true
+- name: orders
+  url: %[1]s/orders
+  forwardHeaders: [Authorization]
+`
+	a := newTestAggregator(assert, fmt.Sprintf(yamlConfig, backend.URL))
+	result, resp := handle(assert, a)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	assert.JSONEq(`{"user": {"id": 1, "name": "alice"}, "orders": [{"id": 10}]}`, string(resp.RawPayload()))
+
+	// merge with template.
+	a = newTestAggregator(assert, fmt.Sprintf(yamlConfig+`
+template: |
+  {"name": {{toJson .calls.user.Body.name}}, "orderCount": {{len .calls.orders.Body}}, "path": "{{.request.URL.Path}}"}
+`, backend.URL))
+	result, resp = handle(assert, a)
+	assert.Equal("", result)
+	assert.JSONEq(`{"name": "alice", "orderCount": 1, "path": "/profile"}`, string(resp.RawPayload()))
+
+	// invalid JSON from template.
+	a = newTestAggregator(assert, fmt.Sprintf(yamlConfig+`
+template: "{{.calls.user.Body.name}}"
+`, backend.URL))
+	result, resp = handle(assert, a)
+	assert.Equal(resultBuildErr, result)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+}
+
+func TestPartialFailure(t *testing.T) {
+	assert := assert.New(t)
+	backend := newBackend()
+	defer backend.Close()
+
+	// the call fails without the Authorization header.
+	a := newTestAggregator(assert, fmt.Sprintf(`
+kind: Aggregator
+name: aggregator
+calls:
+- name: user
+  url: %[1]s/users
+  forwardQuery: true
+- name: orders
+  url: %[1]s/orders
+`, backend.URL))
+	result, resp := handle(assert, a)
+	assert.Equal(resultFailed, result)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+	assert.Contains(string(resp.RawPayload()), "orders")
+
+	// optional calls are replaced by their defaults.
+	a = newTestAggregator(assert, fmt.Sprintf(`
+kind: Aggregator
+name: aggregator
+calls:
+- name: user
+  url: %[1]s/users
+  forwardQuery: true
+- name: slow
+  url: %[1]s/slow
+  timeout: 50ms
+  optional: true
+  default: '{"fallback": true}'
+- name: text
+  url: %[1]s/text
+  optional: true
+`, backend.URL))
+	start := time.Now()
+	result, resp = handle(assert, a)
+	assert.Less(time.Since(start), 200*time.Millisecond)
+	assert.Equal("", result)
+	assert.JSONEq(`{"user": {"id": 1, "name": "alice"}, "slow": {"fallback": true}, "text": null}`, string(resp.RawPayload()))
+	assert.Equal(int64(2), a.Status().(*Status).NumOfFailures)
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bandwidthlimiter provides the BandwidthLimiter filter.
+package bandwidthlimiter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of BandwidthLimiter.
+	Kind = "BandwidthLimiter"
+
+	resultCanceled = "canceled"
+
+	// maxConsumers is the number of the consumers to trigger the cleanup
+	// of the idle ones.
+	maxConsumers = 65536
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "BandwidthLimiter limits the bytes per second of the request and response bodies of a route and its consumers",
+	Results:     []string{resultCanceled},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &BandwidthLimiter{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*BandwidthLimiter)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// BandwidthLimiter is the filter BandwidthLimiter.
+	BandwidthLimiter struct {
+		spec *Spec
+
+		route *buckets
+
+		mutex     sync.Mutex
+		consumers map[string]*buckets
+
+		uploadBytes   int64
+		downloadBytes int64
+	}
+
+	// Spec describes the BandwidthLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Route is the limits shared by all the requests handled by the
+		// filter, i.e. the route of the pipeline.
+		Route *Limits `json:"route,omitempty" jsonschema:"omitempty"`
+		// ConsumerHeader is the header of the consumer names of the
+		// requests, e.g. the consumerHeader of a ConsumerQuota, the
+		// requests without it are limited by Route only.
+		ConsumerHeader string `json:"consumerHeader,omitempty" jsonschema:"omitempty"`
+		// Consumer is the limits of each consumer.
+		Consumer *Limits `json:"consumer,omitempty" jsonschema:"omitempty"`
+		// Consumers are the limits of the specific consumers, which
+		// override Consumer.
+		Consumers map[string]*Limits `json:"consumers,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Limits are the bytes per second of the uploading and downloading,
+	// zero means no limit. Burst is the bytes transferred at full speed
+	// after idle, default is one second of the rate.
+	Limits struct {
+		UploadBytesPerSecond   int64 `json:"uploadBytesPerSecond,omitempty" jsonschema:"omitempty,minimum=0"`
+		DownloadBytesPerSecond int64 `json:"downloadBytesPerSecond,omitempty" jsonschema:"omitempty,minimum=0"`
+		Burst                  int64 `json:"burst,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Status is the status of BandwidthLimiter.
+	Status struct {
+		Consumers int `json:"consumers"`
+		// UploadBytes and DownloadBytes are the bytes limited by the
+		// filter.
+		UploadBytes   int64 `json:"uploadBytes"`
+		DownloadBytes int64 `json:"downloadBytes"`
+	}
+
+	// buckets are the upload and the download buckets of a route or a
+	// consumer, nil means no limit.
+	buckets struct {
+		upload   *bucket
+		download *bucket
+	}
+)
+
+func newBuckets(l *Limits, now time.Time) *buckets {
+	b := &buckets{}
+	if l == nil {
+		return b
+	}
+	if l.UploadBytesPerSecond > 0 {
+		b.upload = newBucket(l.UploadBytesPerSecond, l.Burst, now)
+	}
+	if l.DownloadBytesPerSecond > 0 {
+		b.download = newBucket(l.DownloadBytesPerSecond, l.Burst, now)
+	}
+	return b
+}
+
+// full returns whether the buckets are full, which are the same as the new
+// ones.
+func (b *buckets) full(now time.Time) bool {
+	return (b.upload == nil || b.upload.full(now)) && (b.download == nil || b.download.full(now))
+}
+
+// Name returns the name of the BandwidthLimiter filter instance.
+func (bl *BandwidthLimiter) Name() string {
+	return bl.spec.Name()
+}
+
+// Kind returns the kind of BandwidthLimiter.
+func (bl *BandwidthLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the BandwidthLimiter
+func (bl *BandwidthLimiter) Spec() filters.Spec {
+	return bl.spec
+}
+
+// Init initializes BandwidthLimiter.
+func (bl *BandwidthLimiter) Init() {
+	bl.reload()
+}
+
+// Inherit inherits previous generation of BandwidthLimiter.
+func (bl *BandwidthLimiter) Inherit(previousGeneration filters.Filter) {
+	bl.reload()
+}
+
+func (bl *BandwidthLimiter) reload() {
+	bl.route = newBuckets(bl.spec.Route, time.Now())
+	bl.consumers = map[string]*buckets{}
+}
+
+// RequiresBody implements filters.BodyRequirer. The bodies are limited as
+// streams, so they are not required.
+func (bl *BandwidthLimiter) RequiresBody() (request, response bool) {
+	return false, false
+}
+
+// Status returns status.
+func (bl *BandwidthLimiter) Status() interface{} {
+	bl.mutex.Lock()
+	consumers := len(bl.consumers)
+	bl.mutex.Unlock()
+
+	return &Status{
+		Consumers:     consumers,
+		UploadBytes:   atomic.LoadInt64(&bl.uploadBytes),
+		DownloadBytes: atomic.LoadInt64(&bl.downloadBytes),
+	}
+}
+
+// Close closes BandwidthLimiter.
+func (bl *BandwidthLimiter) Close() {
+}
+
+// getConsumer returns the buckets of the consumer, it returns nil if the
+// consumer is not limited.
+func (bl *BandwidthLimiter) getConsumer(name string) *buckets {
+	limits := bl.spec.Consumers[name]
+	if limits == nil {
+		limits = bl.spec.Consumer
+	}
+	if limits == nil {
+		return nil
+	}
+
+	now := time.Now()
+	bl.mutex.Lock()
+	defer bl.mutex.Unlock()
+
+	b := bl.consumers[name]
+	if b == nil {
+		if len(bl.consumers) >= maxConsumers {
+			for k, v := range bl.consumers {
+				if v.full(now) {
+					delete(bl.consumers, k)
+				}
+			}
+		}
+		b = newBuckets(limits, now)
+		bl.consumers[name] = b
+	}
+	return b
+}
+
+// Handle limits the response body if the context has a response, e.g. the
+// filter is after a Proxy, and the request body otherwise.
+func (bl *BandwidthLimiter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	all := []*buckets{bl.route}
+	if bl.spec.ConsumerHeader != "" {
+		if name := req.HTTPHeader().Get(bl.spec.ConsumerHeader); name != "" {
+			if b := bl.getConsumer(name); b != nil {
+				all = append(all, b)
+			}
+		}
+	}
+
+	if resp, _ := ctx.GetOutputResponse().(*httpprot.Response); resp != nil {
+		bs := collect(all, func(b *buckets) *bucket { return b.download })
+		if len(bs) == 0 {
+			return ""
+		}
+		// the response body is limited while the HTTPServer writes it to
+		// the client.
+		resp.SetPayload(newLimitedReader(req.Context(), resp.GetPayload(), bs, &bl.downloadBytes))
+		return ""
+	}
+
+	bs := collect(all, func(b *buckets) *bucket { return b.upload })
+	if len(bs) == 0 {
+		return ""
+	}
+
+	if req.IsStream() {
+		// the request body is limited while the Proxy reads it from the
+		// client.
+		req.SetPayload(newLimitedReader(req.Context(), req.GetPayload(), bs, &bl.uploadBytes))
+		return ""
+	}
+
+	// the body has been read, the request waits for the bandwidth it used.
+	size := len(req.RawPayload())
+	atomic.AddInt64(&bl.uploadBytes, int64(size))
+	if err := wait(req.Context(), bs, size); err != nil {
+		ctx.AddTag("bandwidthLimiter: " + err.Error())
+		return resultCanceled
+	}
+	return ""
+}
+
+func collect(all []*buckets, get func(b *buckets) *bucket) []*bucket {
+	var result []*bucket
+	for _, b := range all {
+		if v := get(b); v != nil {
+			result = append(result, v)
+		}
+	}
+	return result
+}
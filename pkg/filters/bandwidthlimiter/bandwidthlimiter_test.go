@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bandwidthlimiter
+
+import (
+	"bytes"
+	stdcontext "context"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+func newLimiter(t *testing.T, yamlSpec string) *BandwidthLimiter {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(t, err)
+
+	bl := kind.CreateInstance(spec).(*BandwidthLimiter)
+	bl.Init()
+	return bl
+}
+
+func newContext(t *testing.T, stdctx stdcontext.Context, consumer string, body []byte, stream bool) *context.Context {
+	stdr, _ := http.NewRequestWithContext(stdctx, http.MethodPost, "http://example.com/upload", bytes.NewReader(body))
+	if consumer != "" {
+		stdr.Header.Set("X-Consumer", consumer)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	if stream {
+		assert.NoError(t, req.FetchPayload(-1))
+	} else {
+		assert.NoError(t, req.FetchPayload(0))
+	}
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+const yamlSpec = `
+name: bandwidth
+kind: BandwidthLimiter
+route:
+  uploadBytesPerSecond: 1000000
+consumerHeader: X-Consumer
+consumer:
+  uploadBytesPerSecond: 1000
+  downloadBytesPerSecond: 1000
+  burst: 100
+consumers:
+  vip:
+    uploadBytesPerSecond: 1000000
+`
+
+func TestUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	bl := newLimiter(t, yamlSpec)
+	defer bl.Close()
+	body := bytes.Repeat([]byte("a"), 200)
+
+	// the vip consumer and the requests without consumers are limited by
+	// the route only.
+	for _, consumer := range []string{"", "vip"} {
+		start := time.Now()
+		ctx := newContext(t, stdcontext.Background(), consumer, body, false)
+		assert.Equal("", bl.Handle(ctx))
+		assert.Less(time.Since(start), 50*time.Millisecond)
+	}
+
+	// the buffered body waits for 100 bytes after the burst.
+	start := time.Now()
+	ctx := newContext(t, stdcontext.Background(), "alice", body, false)
+	assert.Equal("", bl.Handle(ctx))
+	assert.GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+
+	// the stream body is limited while reading.
+	ctx = newContext(t, stdcontext.Background(), "bob", body, true)
+	assert.Equal("", bl.Handle(ctx))
+	start = time.Now()
+	data, err := io.ReadAll(ctx.GetInputRequest().(*httpprot.Request).GetPayload())
+	assert.NoError(err)
+	assert.Equal(body, data)
+	assert.GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+
+	// canceled by the client.
+	stdctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	ctx = newContext(t, stdctx, "alice", body, false)
+	assert.Equal(resultCanceled, bl.Handle(ctx))
+
+	status := bl.Status().(*Status)
+	assert.Equal(3, status.Consumers)
+	assert.Equal(int64(1000), status.UploadBytes)
+}
+
+func TestDownload(t *testing.T) {
+	assert := assert.New(t)
+
+	bl := newLimiter(t, yamlSpec)
+	defer bl.Close()
+	body := bytes.Repeat([]byte("a"), 200)
+
+	// not limited without consumers.
+	ctx := newContext(t, stdcontext.Background(), "", nil, false)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	assert.Equal("", bl.Handle(ctx))
+	assert.False(resp.IsStream())
+
+	ctx = newContext(t, stdcontext.Background(), "alice", nil, false)
+	resp, _ = httpprot.NewResponse(nil)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	assert.Equal("", bl.Handle(ctx))
+	assert.True(resp.IsStream())
+
+	start := time.Now()
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.NoError(err)
+	assert.Equal(body, data)
+	assert.GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+	assert.Equal(int64(200), bl.Status().(*Status).DownloadBytes)
+}
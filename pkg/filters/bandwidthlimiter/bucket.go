@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bandwidthlimiter
+
+import (
+	stdcontext "context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxChunkSize is the max bytes read at once by a limited reader, which
+// keeps the transfer smooth.
+const maxChunkSize = 16 * 1024
+
+type (
+	// bucket is a token bucket of bytes, the tokens could be negative, i.e.
+	// the bytes have been transferred but the tokens are not refilled yet,
+	// and the transfer must wait until they are.
+	bucket struct {
+		rate  float64
+		burst float64
+
+		mutex  sync.Mutex
+		tokens float64
+		last   time.Time
+	}
+
+	// limitedReader reads from r and waits for the tokens of the buckets
+	// after each read, the bytes read are added to counter.
+	limitedReader struct {
+		ctx     stdcontext.Context
+		r       io.Reader
+		buckets []*bucket
+		chunk   int
+		counter *int64
+	}
+)
+
+func newBucket(rate, burst int64, now time.Time) *bucket {
+	if burst <= 0 {
+		burst = rate
+	}
+	return &bucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// refill refills the bucket to now.
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// take takes n tokens, and returns how long to wait before the tokens are
+// refilled.
+func (b *bucket) take(n int, now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full returns whether the bucket is full at now, a full bucket is the same
+// as a new one.
+func (b *bucket) full(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// wait takes n tokens from all the buckets, and waits for the longest of
+// them, it returns the error of the context if it is done before.
+func wait(ctx stdcontext.Context, buckets []*bucket, n int) error {
+	now := time.Now()
+	var d time.Duration
+	for _, b := range buckets {
+		if w := b.take(n, now); w > d {
+			d = w
+		}
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newLimitedReader(ctx stdcontext.Context, r io.Reader, buckets []*bucket, counter *int64) *limitedReader {
+	chunk := maxChunkSize
+	for _, b := range buckets {
+		if int(b.burst) < chunk {
+			chunk = int(b.burst)
+		}
+	}
+	if chunk < 1 {
+		chunk = 1
+	}
+	return &limitedReader{ctx: ctx, r: r, buckets: buckets, chunk: chunk, counter: counter}
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > lr.chunk {
+		p = p[:lr.chunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		atomic.AddInt64(lr.counter, int64(n))
+		if werr := wait(lr.ctx, lr.buckets, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Close closes the underlying reader if it is an io.Closer.
+func (lr *limitedReader) Close() error {
+	if c, ok := lr.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bandwidthlimiter
+
+import (
+	"bytes"
+	stdcontext "context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	b := newBucket(1000, 0, now)
+	assert.Equal(1000.0, b.burst)
+	assert.True(b.full(now))
+
+	assert.Equal(time.Duration(0), b.take(1000, now))
+	assert.Equal(500*time.Millisecond, b.take(500, now))
+	assert.False(b.full(now))
+
+	// refilled 1000 tokens, 500 of them pays the debt.
+	now = now.Add(time.Second)
+	assert.Equal(time.Duration(0), b.take(500, now))
+
+	// the tokens are never more than the burst.
+	now = now.Add(time.Hour)
+	assert.True(b.full(now))
+	assert.Equal(time.Duration(0), b.take(1000, now))
+	assert.Equal(time.Millisecond, b.take(1, now))
+}
+
+func TestLimitedReader(t *testing.T) {
+	assert := assert.New(t)
+
+	data := bytes.Repeat([]byte("a"), 300)
+	bs := []*bucket{newBucket(1000, 100, time.Now()), newBucket(100000, 0, time.Now())}
+	var counter int64
+	lr := newLimitedReader(stdcontext.Background(), bytes.NewReader(data), bs, &counter)
+	assert.Equal(100, lr.chunk)
+
+	// 100 bytes of the burst, and 200 bytes at 1000 bytes per second.
+	start := time.Now()
+	result, err := io.ReadAll(lr)
+	assert.NoError(err)
+	assert.Equal(data, result)
+	assert.Equal(int64(300), counter)
+	assert.GreaterOrEqual(time.Since(start), 180*time.Millisecond)
+	assert.NoError(lr.Close())
+
+	// canceled while waiting.
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	lr = newLimitedReader(ctx, bytes.NewReader(data), []*bucket{newBucket(10, 0, time.Now())}, &counter)
+	_, err = io.ReadAll(lr)
+	assert.ErrorIs(err, stdcontext.Canceled)
+}
@@ -0,0 +1,424 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bodytransformer provides the BodyTransformer filter.
+package bodytransformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"text/template"
+
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/xmltool"
+)
+
+const (
+	// Kind is the kind of BodyTransformer.
+	Kind = "BodyTransformer"
+
+	resultDecodeErr    = "decodeErr"
+	resultTransformErr = "transformErr"
+
+	targetRequest  = "request"
+	targetResponse = "response"
+
+	convertJSONToForm = "jsonToForm"
+	convertFormToJSON = "formToJSON"
+	convertXMLToJSON  = "xmlToJSON"
+	convertJSONToXML  = "jsonToXML"
+
+	contentTypeJSON = "application/json"
+	contentTypeForm = "application/x-www-form-urlencoded"
+	contentTypeXML  = "application/xml"
+
+	defaultXMLRoot = "root"
+
+	keyContentType   = "Content-Type"
+	keyContentLength = "Content-Length"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "BodyTransformer transforms the JSON, form or XML body of requests or responses",
+	Results:     []string{resultDecodeErr, resultTransformErr},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &BodyTransformer{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*BodyTransformer)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// BodyTransformer is the filter BodyTransformer.
+	BodyTransformer struct {
+		spec     *Spec
+		template *template.Template
+		extract  []*xmltool.XPath
+	}
+
+	// Spec describes the BodyTransformer. Fields in the body are referred
+	// by dot separated paths, e.g. "user.name". The transformations are
+	// applied in the order of rename, delete and defaults, and then the
+	// body is rendered by the template if it is not empty.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Target  string `json:"target" jsonschema:"omitempty,enum=,enum=request,enum=response"`
+		Convert string `json:"convert" jsonschema:"omitempty,enum=,enum=jsonToForm,enum=formToJSON,enum=xmlToJSON,enum=jsonToXML"`
+		// XMLRoot is the name of the root element when converting JSON
+		// to XML, if the JSON is not an object with only one key.
+		XMLRoot    string                 `json:"xmlRoot" jsonschema:"omitempty"`
+		Extract    []*Extract             `json:"extract" jsonschema:"omitempty"`
+		Rename     []*Rename              `json:"rename" jsonschema:"omitempty"`
+		Delete     []string               `json:"delete" jsonschema:"omitempty"`
+		Defaults   map[string]interface{} `json:"defaults" jsonschema:"omitempty"`
+		Template   string                 `json:"template" jsonschema:"omitempty"`
+		LeftDelim  string                 `json:"leftDelim" jsonschema:"omitempty"`
+		RightDelim string                 `json:"rightDelim" jsonschema:"omitempty"`
+	}
+
+	// Extract sets the value of the first node selected by the XPath from
+	// the XML body to the header, the header is deleted if no nodes are
+	// selected.
+	Extract struct {
+		XPath  string `json:"xpath" jsonschema:"required"`
+		Header string `json:"header" jsonschema:"required"`
+	}
+
+	// Rename renames the field From to To.
+	Rename struct {
+		From string `json:"from" jsonschema:"required"`
+		To   string `json:"to" jsonschema:"required"`
+	}
+
+	// body is the interface of requests and responses with a payload.
+	body interface {
+		IsStream() bool
+		RawPayload() []byte
+		SetPayload(payload interface{})
+		HTTPHeader() http.Header
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	for _, r := range s.Rename {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("empty path in rename")
+		}
+	}
+	for _, p := range s.Delete {
+		if p == "" {
+			return fmt.Errorf("empty path in delete")
+		}
+	}
+	if s.Template != "" {
+		if _, err := s.newTemplate(); err != nil {
+			return err
+		}
+	}
+	for _, e := range s.Extract {
+		if _, err := xmltool.CompileXPath(e.XPath); err != nil {
+			return err
+		}
+		if e.Header == "" {
+			return fmt.Errorf("empty header in extract")
+		}
+	}
+	if len(s.Extract) > 0 && s.Convert != convertXMLToJSON && s.transforms() {
+		return fmt.Errorf("extract requires an XML body, convert must be xmlToJSON if the body is transformed")
+	}
+	return nil
+}
+
+// transforms returns whether the body is transformed.
+func (s *Spec) transforms() bool {
+	return s.Convert != "" || len(s.Rename) > 0 || len(s.Delete) > 0 ||
+		len(s.Defaults) > 0 || s.Template != ""
+}
+
+func (s *Spec) newTemplate() (*template.Template, error) {
+	t := template.New("").Delims(s.LeftDelim, s.RightDelim).Funcs(sprig.TxtFuncMap())
+	return t.Parse(s.Template)
+}
+
+// Name returns the name of the BodyTransformer filter instance.
+func (bt *BodyTransformer) Name() string {
+	return bt.spec.Name()
+}
+
+// Kind returns the kind of BodyTransformer.
+func (bt *BodyTransformer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the BodyTransformer
+func (bt *BodyTransformer) Spec() filters.Spec {
+	return bt.spec
+}
+
+// Init initializes BodyTransformer.
+func (bt *BodyTransformer) Init() {
+	bt.reload()
+}
+
+// Inherit inherits previous generation of BodyTransformer.
+func (bt *BodyTransformer) Inherit(previousGeneration filters.Filter) {
+	bt.reload()
+}
+
+func (bt *BodyTransformer) reload() {
+	if bt.spec.Template != "" {
+		bt.template = template.Must(bt.spec.newTemplate())
+	}
+	bt.extract = nil
+	for _, e := range bt.spec.Extract {
+		x, err := xmltool.CompileXPath(e.XPath)
+		if err != nil {
+			logger.Errorf("BUG: compile xpath %s failed: %v", e.XPath, err)
+			continue
+		}
+		bt.extract = append(bt.extract, x)
+	}
+}
+
+// Status returns status.
+func (bt *BodyTransformer) Status() interface{} {
+	return nil
+}
+
+// Close closes BodyTransformer.
+func (bt *BodyTransformer) Close() {
+}
+
+// Handle transforms the body of the request or response.
+func (bt *BodyTransformer) Handle(ctx *context.Context) string {
+	var b body
+	if bt.spec.Target == targetResponse {
+		resp, _ := ctx.GetInputResponse().(*httpprot.Response)
+		if resp == nil {
+			return ""
+		}
+		b = resp
+	} else {
+		b = ctx.GetInputRequest().(*httpprot.Request)
+	}
+
+	if b.IsStream() {
+		logger.Warnf("%s: cannot transform a stream body", bt.Name())
+		return resultDecodeErr
+	}
+
+	var root *xmltool.Node
+	if len(bt.extract) > 0 || bt.spec.Convert == convertXMLToJSON {
+		var err error
+		if root, err = xmltool.Parse(b.RawPayload()); err != nil {
+			logger.Debugf("%s: decode XML body failed: %v", bt.Name(), err)
+			return resultDecodeErr
+		}
+	}
+
+	if len(bt.extract) > 0 {
+		h := b.HTTPHeader()
+		for i, x := range bt.extract {
+			if v, ok := x.SelectFirst(root); ok {
+				h.Set(bt.spec.Extract[i].Header, v)
+			} else {
+				h.Del(bt.spec.Extract[i].Header)
+			}
+		}
+		if !bt.spec.transforms() {
+			return ""
+		}
+	}
+
+	data, err := bt.decode(b.RawPayload(), root)
+	if err != nil {
+		logger.Debugf("%s: decode body failed: %v", bt.Name(), err)
+		return resultDecodeErr
+	}
+
+	data = bt.transform(data)
+
+	payload, contentType, err := bt.encode(data)
+	if err != nil {
+		logger.Debugf("%s: encode body failed: %v", bt.Name(), err)
+		return resultTransformErr
+	}
+
+	b.SetPayload(payload)
+	h := b.HTTPHeader()
+	if contentType != "" {
+		h.Set(keyContentType, contentType)
+	}
+	if bt.spec.Target == targetResponse {
+		h.Set(keyContentLength, strconv.Itoa(len(payload)))
+	}
+	return ""
+}
+
+// decode decodes the payload, root is the parsed payload if it's XML.
+func (bt *BodyTransformer) decode(payload []byte, root *xmltool.Node) (interface{}, error) {
+	if root != nil {
+		return root.ToMap(), nil
+	}
+
+	if bt.spec.Convert == convertFormToJSON {
+		values, err := url.ParseQuery(string(payload))
+		if err != nil {
+			return nil, err
+		}
+		return formToMap(values), nil
+	}
+
+	if len(bytes.TrimSpace(payload)) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	var data interface{}
+	err := json.Unmarshal(payload, &data)
+	return data, err
+}
+
+func (bt *BodyTransformer) transform(data interface{}) interface{} {
+	for _, r := range bt.spec.Rename {
+		if v, ok := getPath(data, r.From); ok {
+			deletePath(data, r.From)
+			data = setPath(data, r.To, v)
+		}
+	}
+
+	for _, p := range bt.spec.Delete {
+		deletePath(data, p)
+	}
+
+	// sort the paths for a stable order.
+	paths := make([]string, 0, len(bt.spec.Defaults))
+	for p := range bt.spec.Defaults {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if _, ok := getPath(data, p); !ok {
+			data = setPath(data, p, bt.spec.Defaults[p])
+		}
+	}
+
+	return data
+}
+
+// encode encodes data, the content type is empty if it is not changed.
+func (bt *BodyTransformer) encode(data interface{}) ([]byte, string, error) {
+	if bt.template != nil {
+		var buf bytes.Buffer
+		err := bt.template.Execute(&buf, map[string]interface{}{"body": data})
+		return buf.Bytes(), "", err
+	}
+
+	switch bt.spec.Convert {
+	case convertJSONToForm:
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("body is not a JSON object")
+		}
+		values := url.Values{}
+		mapToForm(values, "", m)
+		return []byte(values.Encode()), contentTypeForm, nil
+	case convertFormToJSON, convertXMLToJSON:
+		payload, err := json.Marshal(data)
+		return payload, contentTypeJSON, err
+	case convertJSONToXML:
+		root := bt.spec.XMLRoot
+		if root == "" {
+			root = defaultXMLRoot
+		}
+		payload, err := xmltool.Marshal(data, root)
+		return payload, contentTypeXML, err
+	default:
+		payload, err := json.Marshal(data)
+		return payload, "", err
+	}
+}
+
+// formToMap converts form values to a map, keys with multiple values are
+// converted to arrays.
+func formToMap(values url.Values) map[string]interface{} {
+	m := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			m[k] = v[0]
+			continue
+		}
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = v[i]
+		}
+		m[k] = list
+	}
+	return m
+}
+
+// mapToForm converts a map to form values, nested objects are flattened
+// with dot separated keys, and arrays are converted to multiple values.
+func mapToForm(values url.Values, prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			mapToForm(values, k, v)
+		case []interface{}:
+			for _, item := range v {
+				values.Add(k, formValue(item))
+			}
+		default:
+			values.Add(k, formValue(v))
+		}
+	}
+}
+
+func formValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
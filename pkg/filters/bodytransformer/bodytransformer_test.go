@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newBodyTransformer(t *testing.T, yamlSpec string) *BodyTransformer {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	bt := kind.CreateInstance(spec).(*BodyTransformer)
+	bt.Init()
+	return bt
+}
+
+func newContext(t *testing.T, contentType, body string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1", strings.NewReader(body))
+	stdr.Header.Set("Content-Type", contentType)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{Rename: []*Rename{{From: "a"}}}).Validate())
+	assert.Error((&Spec{Delete: []string{""}}).Validate())
+	assert.Error((&Spec{Template: "{{.body"}).Validate())
+	assert.NoError((&Spec{Template: "[[.body.a]]", LeftDelim: "[[", RightDelim: "]]"}).Validate())
+	assert.Error((&Spec{Extract: []*Extract{{XPath: "a[", Header: "X-A"}}}).Validate())
+	assert.Error((&Spec{Extract: []*Extract{{XPath: "a", Header: "X-A"}}, Delete: []string{"a"}}).Validate())
+	assert.NoError((&Spec{Extract: []*Extract{{XPath: "a", Header: "X-A"}}, Convert: "xmlToJSON", Delete: []string{"a"}}).Validate())
+}
+
+func TestTransformJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+rename:
+- from: user.name
+  to: userName
+- from: missing
+  to: other
+delete:
+- user.password
+defaults:
+  user.role: guest
+  version: 1
+`)
+	assert.Equal(kind, bt.Kind())
+	assert.Equal("bt", bt.Name())
+	assert.Nil(bt.Status())
+
+	ctx := newContext(t, "application/json", `{"user":{"name":"alice","password":"secret"},"version":2}`)
+	assert.Equal("", bt.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.JSONEq(`{"userName":"alice","user":{"role":"guest"},"version":2}`, string(req.RawPayload()))
+
+	ctx = newContext(t, "application/json", `{"user":`)
+	assert.Equal(resultDecodeErr, bt.Handle(ctx))
+
+	newbt := kind.CreateInstance(bt.Spec()).(*BodyTransformer)
+	newbt.Inherit(bt)
+	bt.Close()
+	ctx = newContext(t, "application/json", ``)
+	assert.Equal("", newbt.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.JSONEq(`{"user":{"role":"guest"},"version":1}`, string(req.RawPayload()))
+}
+
+func TestTransformTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+template: '{"id":{{.body.id}},"name":"{{.body.name | upper}}"}'
+`)
+	ctx := newContext(t, "application/json", `{"id":1,"name":"alice"}`)
+	assert.Equal("", bt.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.JSONEq(`{"id":1,"name":"ALICE"}`, string(req.RawPayload()))
+
+	bt = newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+template: '{{fail "boom"}}'
+`)
+	ctx = newContext(t, "application/json", `{"id":1}`)
+	assert.Equal(resultTransformErr, bt.Handle(ctx))
+}
+
+func TestConvert(t *testing.T) {
+	assert := assert.New(t)
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+convert: jsonToForm
+`)
+	ctx := newContext(t, "application/json", `{"a":"1","b":{"c":true},"d":[1,2]}`)
+	assert.Equal("", bt.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("application/x-www-form-urlencoded", req.HTTPHeader().Get("Content-Type"))
+	values, err := url.ParseQuery(string(req.RawPayload()))
+	assert.NoError(err)
+	assert.Equal(url.Values{"a": {"1"}, "b.c": {"true"}, "d": {"1", "2"}}, values)
+
+	ctx = newContext(t, "application/json", `[1,2]`)
+	assert.Equal(resultTransformErr, bt.Handle(ctx))
+
+	bt = newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+convert: formToJSON
+rename:
+- from: a
+  to: x.y
+`)
+	ctx = newContext(t, "application/x-www-form-urlencoded", `a=1&b=2&b=3`)
+	assert.Equal("", bt.Handle(ctx))
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("application/json", req.HTTPHeader().Get("Content-Type"))
+	assert.JSONEq(`{"x":{"y":"1"},"b":["2","3"]}`, string(req.RawPayload()))
+}
+
+func TestTransformResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+target: response
+delete:
+- secret
+`)
+	ctx := newContext(t, "application/json", `{}`)
+	assert.Equal("", bt.Handle(ctx))
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload([]byte(`{"secret":"x","ok":true}`))
+	ctx.SetInputResponse(resp)
+	assert.Equal("", bt.Handle(ctx))
+	assert.JSONEq(`{"ok":true}`, string(resp.RawPayload()))
+	assert.Equal("11", resp.HTTPHeader().Get("Content-Length"))
+}
+
+func TestTransformXML(t *testing.T) {
+	assert := assert.New(t)
+
+	const soap = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body><GetPrice currency="USD"><Item>Apple</Item></GetPrice></soap:Body>
+</soap:Envelope>`
+
+	bt := newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+convert: xmlToJSON
+extract:
+- xpath: /Envelope/Body/*/@currency
+  header: X-Currency
+- xpath: /Envelope/Header/Tenant
+  header: X-Tenant
+rename:
+- from: Envelope.Body.GetPrice
+  to: request
+delete: [Envelope]
+`)
+	ctx := newContext(t, "text/xml", soap)
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-Tenant", "forged")
+	assert.Equal("", bt.Handle(ctx))
+	assert.JSONEq(`{"request": {"@currency": "USD", "Item": "Apple"}}`, string(req.RawPayload()))
+	assert.Equal("application/json", req.HTTPHeader().Get("Content-Type"))
+	assert.Equal("USD", req.HTTPHeader().Get("X-Currency"))
+	assert.Equal("", req.HTTPHeader().Get("X-Tenant"))
+
+	assert.Equal(resultDecodeErr, bt.Handle(newContext(t, "text/xml", `{"a": 1}`)))
+
+	// extract only, the body is not changed.
+	bt = newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+extract:
+- xpath: //Item
+  header: X-Item
+`)
+	ctx = newContext(t, "text/xml", soap)
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("", bt.Handle(ctx))
+	assert.Equal(soap, string(req.RawPayload()))
+	assert.Equal("Apple", req.HTTPHeader().Get("X-Item"))
+
+	bt = newBodyTransformer(t, `
+kind: BodyTransformer
+name: bt
+convert: jsonToXML
+xmlRoot: order
+`)
+	ctx = newContext(t, "application/json", `{"id": 1, "items": ["a", "b"]}`)
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("", bt.Handle(ctx))
+	assert.Equal(`<order><id>1</id><items>a</items><items>b</items></order>`, string(req.RawPayload()))
+	assert.Equal("application/xml", req.HTTPHeader().Get("Content-Type"))
+
+	assert.Equal(resultTransformErr, bt.Handle(newContext(t, "application/json", `{"a b": 1, "c": 2}`)))
+}
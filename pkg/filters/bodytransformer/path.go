@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodytransformer
+
+import "strings"
+
+// getPath returns the value at path of data.
+func getPath(data interface{}, path string) (interface{}, bool) {
+	for _, key := range splitPath(path) {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if data, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// setPath sets the value at path of data, the missing objects on the path
+// are created, and so are the ones which are not objects. It returns the
+// new data as data is replaced if it is not an object.
+func setPath(data interface{}, path string, value interface{}) interface{} {
+	root, ok := data.(map[string]interface{})
+	if !ok {
+		root = map[string]interface{}{}
+	}
+
+	keys := splitPath(path)
+	m := root
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := m[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[key] = child
+		}
+		m = child
+	}
+	m[keys[len(keys)-1]] = value
+	return root
+}
+
+// deletePath deletes the value at path of data.
+func deletePath(data interface{}, path string) {
+	keys := splitPath(path)
+	parent := data
+	if len(keys) > 1 {
+		var ok bool
+		if parent, ok = getPath(data, strings.Join(keys[:len(keys)-1], ".")); !ok {
+			return
+		}
+	}
+	if m, ok := parent.(map[string]interface{}); ok {
+		delete(m, keys[len(keys)-1])
+	}
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
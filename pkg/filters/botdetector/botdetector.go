@@ -0,0 +1,456 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package botdetector implements the BotDetector filter, which scores the
+// requests by the user agent, the JA3 fingerprint and the reputation of the
+// client IP, and tags, throttles, challenges or blocks them by the score.
+package botdetector
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/object/ipset"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/ja3"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of BotDetector.
+	Kind = "BotDetector"
+
+	resultThrottled  = "throttled"
+	resultChallenged = "challenged"
+	resultBlocked    = "blocked"
+
+	defaultScoreHeader = "X-Bot-Score"
+
+	// the scores of the built-in user agent heuristics.
+	scoreEmptyUserAgent   = 5
+	scoreAutomationTool   = 4
+	scoreMissingAccept    = 1
+	scoreMissingAcceptLan = 1
+)
+
+// automationTools matches the user agents of the HTTP libraries, the
+// command line tools and the headless browsers.
+var automationTools = regexp.MustCompile(`(?i)curl/|wget/|python-requests|python-urllib|aiohttp|go-http-client|java/|okhttp|apache-httpclient|libwww-perl|scrapy|httpclient|headlesschrome|phantomjs|selenium|puppeteer|playwright`)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "BotDetector scores the requests to tag, throttle, challenge or block bots",
+	Results:     []string{resultThrottled, resultChallenged, resultBlocked},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &BotDetector{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*BotDetector)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// BotDetector is the filter BotDetector.
+	BotDetector struct {
+		spec *Spec
+
+		heuristics bool
+		uaRules    []*uaRule
+		uaAllowed  []*regexp.Regexp
+		ja3Scores  map[string]int
+		lists      []*reputationList
+		throttler  *throttler
+		challenger *challenger
+
+		mutex         sync.Mutex
+		numTagged     uint64
+		numThrottled  uint64
+		numChallenged uint64
+		numBlocked    uint64
+	}
+
+	// Spec describes the BotDetector.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		UserAgent    *UserAgentSpec    `json:"userAgent" jsonschema:"omitempty"`
+		JA3          *JA3Spec          `json:"ja3" jsonschema:"omitempty"`
+		IPReputation []*ReputationList `json:"ipReputation" jsonschema:"omitempty"`
+		Thresholds   *Thresholds       `json:"thresholds" jsonschema:"required"`
+		Throttle     *ThrottleSpec     `json:"throttle" jsonschema:"omitempty"`
+		Challenge    *ChallengeSpec    `json:"challenge" jsonschema:"omitempty"`
+		// ScoreHeader is the request header to pass the score to the
+		// backends when the request is tagged.
+		ScoreHeader string `json:"scoreHeader" jsonschema:"omitempty"`
+	}
+
+	// UserAgentSpec describes the scoring by the user agent.
+	UserAgentSpec struct {
+		// DisableHeuristics disables the built-in heuristics, which score
+		// the empty user agents, the automation tools and the requests
+		// without Accept or Accept-Language.
+		DisableHeuristics bool             `json:"disableHeuristics" jsonschema:"omitempty"`
+		Rules             []*UserAgentRule `json:"rules" jsonschema:"omitempty"`
+		// Allowed are the regular expressions of the user agents not
+		// scored by the user agent, e.g. the search engines.
+		Allowed []string `json:"allowed" jsonschema:"omitempty"`
+	}
+
+	// UserAgentRule scores the user agents matching the regular expression.
+	UserAgentRule struct {
+		Pattern string `json:"pattern" jsonschema:"required,format=regexp"`
+		Score   int    `json:"score" jsonschema:"required"`
+	}
+
+	// JA3Spec describes the scoring by the JA3 fingerprint of the client.
+	JA3Spec struct {
+		// Header is the request header carrying the JA3 hash, which is
+		// set by the TLS terminator in front of Easegress. The JA3 hash of
+		// the connection is used if it is empty.
+		Header string     `json:"header" jsonschema:"omitempty"`
+		Rules  []*JA3Rule `json:"rules" jsonschema:"required,minItems=1"`
+	}
+
+	// JA3Rule scores the JA3 hashes, the score could be negative to trust
+	// the known clients.
+	JA3Rule struct {
+		Hashes []string `json:"hashes" jsonschema:"required,minItems=1"`
+		Score  int      `json:"score" jsonschema:"required"`
+	}
+
+	// Thresholds are the minimum scores of the actions, zero disables the
+	// action.
+	Thresholds struct {
+		Tag       int `json:"tag" jsonschema:"omitempty,minimum=0"`
+		Throttle  int `json:"throttle" jsonschema:"omitempty,minimum=0"`
+		Challenge int `json:"challenge" jsonschema:"omitempty,minimum=0"`
+		Block     int `json:"block" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// ThrottleSpec describes the per client IP rate limit of the
+	// throttled requests.
+	ThrottleSpec struct {
+		// Rate is the number of requests per second.
+		Rate  float64 `json:"rate" jsonschema:"required"`
+		Burst int     `json:"burst" jsonschema:"omitempty,minimum=0"`
+	}
+
+	uaRule struct {
+		re    *regexp.Regexp
+		score int
+	}
+
+	// Status is the status of BotDetector.
+	Status struct {
+		NumOfTagged     uint64                  `json:"numOfTagged"`
+		NumOfThrottled  uint64                  `json:"numOfThrottled"`
+		NumOfChallenged uint64                  `json:"numOfChallenged"`
+		NumOfBlocked    uint64                  `json:"numOfBlocked"`
+		ReputationLists []*ReputationListStatus `json:"reputationLists,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	t := s.Thresholds
+	if t.Tag == 0 && t.Throttle == 0 && t.Challenge == 0 && t.Block == 0 {
+		return fmt.Errorf("no thresholds")
+	}
+	if t.Throttle > 0 && s.Throttle == nil {
+		return fmt.Errorf("throttle is required by the throttle threshold")
+	}
+	if s.Throttle != nil && s.Throttle.Rate <= 0 {
+		return fmt.Errorf("rate of throttle must be positive")
+	}
+
+	if ua := s.UserAgent; ua != nil {
+		for _, r := range ua.Rules {
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("invalid user agent pattern %s: %v", r.Pattern, err)
+			}
+		}
+		for _, p := range ua.Allowed {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("invalid user agent pattern %s: %v", p, err)
+			}
+		}
+	}
+
+	names := map[string]struct{}{}
+	for _, l := range s.IPReputation {
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		if _, ok := names[l.Name]; ok {
+			return fmt.Errorf("duplicated reputation list %s", l.Name)
+		}
+		names[l.Name] = struct{}{}
+	}
+
+	if s.Challenge != nil {
+		return s.Challenge.Validate()
+	}
+	return nil
+}
+
+// Name returns the name of the BotDetector filter instance.
+func (b *BotDetector) Name() string {
+	return b.spec.Name()
+}
+
+// Kind returns the kind of BotDetector.
+func (b *BotDetector) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the BotDetector.
+func (b *BotDetector) Spec() filters.Spec {
+	return b.spec
+}
+
+// Init initializes BotDetector.
+func (b *BotDetector) Init() {
+	b.reload()
+}
+
+// Inherit inherits previous generation of BotDetector.
+func (b *BotDetector) Inherit(previousGeneration filters.Filter) {
+	previousGeneration.Close()
+	b.reload()
+}
+
+func (b *BotDetector) reload() {
+	ua := b.spec.UserAgent
+	if ua == nil {
+		ua = &UserAgentSpec{}
+	}
+	b.heuristics = !ua.DisableHeuristics
+	for _, r := range ua.Rules {
+		b.uaRules = append(b.uaRules, &uaRule{re: regexp.MustCompile(r.Pattern), score: r.Score})
+	}
+	for _, p := range ua.Allowed {
+		b.uaAllowed = append(b.uaAllowed, regexp.MustCompile(p))
+	}
+
+	if b.spec.JA3 != nil {
+		b.ja3Scores = map[string]int{}
+		for _, r := range b.spec.JA3.Rules {
+			for _, h := range r.Hashes {
+				b.ja3Scores[strings.ToLower(h)] = r.Score
+			}
+		}
+	}
+
+	getSet := ipset.SetGetter(b.spec.Super())
+	for _, spec := range b.spec.IPReputation {
+		b.lists = append(b.lists, newReputationList(spec, getSet))
+	}
+
+	if b.spec.Throttle != nil {
+		b.throttler = newThrottler(b.spec.Throttle)
+	}
+	if b.spec.Thresholds.Challenge > 0 {
+		spec := b.spec.Challenge
+		if spec == nil {
+			spec = &ChallengeSpec{}
+		}
+		b.challenger = newChallenger(spec)
+	}
+}
+
+// scoreUserAgent scores the request by the user agent.
+func (b *BotDetector) scoreUserAgent(req *httpprot.Request) (int, []string) {
+	ua := req.UserAgent()
+	for _, re := range b.uaAllowed {
+		if re.MatchString(ua) {
+			return 0, nil
+		}
+	}
+
+	score := 0
+	var reasons []string
+	for _, r := range b.uaRules {
+		if r.re.MatchString(ua) {
+			score += r.score
+			reasons = append(reasons, "userAgent")
+			break
+		}
+	}
+
+	if b.heuristics {
+		switch {
+		case ua == "":
+			score += scoreEmptyUserAgent
+			reasons = append(reasons, "emptyUserAgent")
+		case automationTools.MatchString(ua):
+			score += scoreAutomationTool
+			reasons = append(reasons, "automationTool")
+		}
+
+		h := req.HTTPHeader()
+		if h.Get("Accept") == "" {
+			score += scoreMissingAccept
+			reasons = append(reasons, "missingAccept")
+		}
+		if h.Get("Accept-Language") == "" {
+			score += scoreMissingAcceptLan
+			reasons = append(reasons, "missingAcceptLanguage")
+		}
+	}
+	return score, reasons
+}
+
+// ja3Hash returns the JA3 hash of the client.
+func (b *BotDetector) ja3Hash(req *httpprot.Request) string {
+	if b.spec.JA3.Header != "" {
+		return strings.ToLower(req.HTTPHeader().Get(b.spec.JA3.Header))
+	}
+	if fp := ja3.FromContext(req.Context()); fp != nil {
+		return fp.Hash
+	}
+	return ""
+}
+
+// score returns the score of the request and the reasons.
+func (b *BotDetector) score(req *httpprot.Request) (int, []string) {
+	score, reasons := b.scoreUserAgent(req)
+
+	if b.ja3Scores != nil {
+		if s, ok := b.ja3Scores[b.ja3Hash(req)]; ok {
+			score += s
+			reasons = append(reasons, "ja3")
+		}
+	}
+
+	if ip := net.ParseIP(req.RealIP()); ip != nil {
+		for _, l := range b.lists {
+			if l.contains(ip) {
+				score += l.spec.Score
+				reasons = append(reasons, "ip:"+l.spec.Name)
+			}
+		}
+	}
+	return score, reasons
+}
+
+func reached(score, threshold int) bool {
+	return threshold > 0 && score >= threshold
+}
+
+func (b *BotDetector) count(n *uint64) {
+	b.mutex.Lock()
+	*n++
+	b.mutex.Unlock()
+}
+
+// Handle scores the request and takes the action.
+func (b *BotDetector) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	score, reasons := b.score(req)
+	t := b.spec.Thresholds
+	now := time.Now()
+
+	if reached(score, t.Block) {
+		b.count(&b.numBlocked)
+		b.tag(ctx, "blocked", score, reasons)
+		b.respond(ctx, http.StatusForbidden, "")
+		return resultBlocked
+	}
+
+	if reached(score, t.Challenge) {
+		ip, ua := req.RealIP(), req.UserAgent()
+		c, err := req.Cookie(b.challenger.cookie)
+		if err != nil || !b.challenger.verify(c.Value, ip, ua, now) {
+			b.count(&b.numChallenged)
+			b.tag(ctx, "challenged", score, reasons)
+			b.respond(ctx, http.StatusForbidden, b.challenger.page(ip, ua, now))
+			return resultChallenged
+		}
+	}
+
+	if reached(score, t.Throttle) && !b.throttler.allow(req.RealIP(), now) {
+		b.count(&b.numThrottled)
+		b.tag(ctx, "throttled", score, reasons)
+		b.respond(ctx, http.StatusTooManyRequests, "")
+		return resultThrottled
+	}
+
+	if reached(score, t.Tag) {
+		b.count(&b.numTagged)
+		b.tag(ctx, "tagged", score, reasons)
+		header := b.spec.ScoreHeader
+		if header == "" {
+			header = defaultScoreHeader
+		}
+		req.HTTPHeader().Set(header, strconv.Itoa(score))
+	}
+	return ""
+}
+
+func (b *BotDetector) tag(ctx *context.Context, action string, score int, reasons []string) {
+	ctx.AddTag(stringtool.Cat("botDetector: ", action, ", score ", strconv.Itoa(score),
+		", reasons ", strings.Join(reasons, ",")))
+}
+
+func (b *BotDetector) respond(ctx *context.Context, code int, page string) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	if page != "" {
+		resp.HTTPHeader().Set("Content-Type", "text/html; charset=utf-8")
+		resp.HTTPHeader().Set("Cache-Control", "no-store")
+		resp.SetPayload([]byte(page))
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Status returns status.
+func (b *BotDetector) Status() interface{} {
+	b.mutex.Lock()
+	s := &Status{
+		NumOfTagged:     b.numTagged,
+		NumOfThrottled:  b.numThrottled,
+		NumOfChallenged: b.numChallenged,
+		NumOfBlocked:    b.numBlocked,
+	}
+	b.mutex.Unlock()
+
+	for _, l := range b.lists {
+		s.ReputationLists = append(s.ReputationLists, l.status())
+	}
+	return s
+}
+
+// Close closes BotDetector.
+func (b *BotDetector) Close() {
+	for _, l := range b.lists {
+		l.close()
+	}
+}
@@ -0,0 +1,332 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/mmdb/mmdbtest"
+)
+
+const browserUA = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestBotDetector(assert *assert.Assertions, yamlConfig string) *BotDetector {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	b := kind.CreateInstance(spec).(*BotDetector)
+	b.Init()
+	return b
+}
+
+func newTestContext(ip string, header http.Header) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.RemoteAddr = net.JoinHostPort(ip, "12345")
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func browserHeader() http.Header {
+	return http.Header{
+		"User-Agent":      {browserUA},
+		"Accept":          {"text/html"},
+		"Accept-Language": {"en-US"},
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, spec := range []*Spec{
+		{Thresholds: &Thresholds{}},
+		{Thresholds: &Thresholds{Throttle: 1}},
+		{Thresholds: &Thresholds{Tag: 1}, Throttle: &ThrottleSpec{}},
+		{Thresholds: &Thresholds{Tag: 1}, UserAgent: &UserAgentSpec{Rules: []*UserAgentRule{{Pattern: "("}}}},
+		{Thresholds: &Thresholds{Tag: 1}, UserAgent: &UserAgentSpec{Allowed: []string{"("}}},
+		{Thresholds: &Thresholds{Tag: 1}, IPReputation: []*ReputationList{{Name: "a"}}},
+		{Thresholds: &Thresholds{Tag: 1}, IPReputation: []*ReputationList{{Name: "a", File: "a", URL: "http://a"}}},
+		{Thresholds: &Thresholds{Tag: 1}, IPReputation: []*ReputationList{{Name: "a", File: "a", MMDBField: "a"}}},
+		{Thresholds: &Thresholds{Tag: 1}, IPReputation: []*ReputationList{{Name: "a", File: "a", IPSet: "a"}}},
+		{Thresholds: &Thresholds{Tag: 1}, IPReputation: []*ReputationList{{Name: "a", File: "a", RefreshInterval: "-1s"}}},
+		{Thresholds: &Thresholds{Tag: 1}, IPReputation: []*ReputationList{{Name: "a", File: "a"}, {Name: "a", File: "b"}}},
+		{Thresholds: &Thresholds{Tag: 1}, Challenge: &ChallengeSpec{Secret: "short"}},
+		{Thresholds: &Thresholds{Tag: 1}, Challenge: &ChallengeSpec{TTL: "x"}},
+	} {
+		assert.Error(spec.Validate())
+	}
+
+	spec := &Spec{Thresholds: &Thresholds{Tag: 1}}
+	assert.NoError(spec.Validate())
+}
+
+func TestUserAgentAndJA3(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newTestBotDetector(assert, `
+kind: BotDetector
+name: bot
+userAgent:
+  rules:
+  - pattern: BadBot
+    score: 10
+  allowed: [Googlebot]
+ja3:
+  header: X-JA3-Hash
+  rules:
+  - hashes: [E7D705A3286E19EA42F587B344EE6865]
+    score: 10
+  - hashes: [b32309a26951912be7dba376398abc3b]
+    score: -5
+thresholds:
+  tag: 1
+  block: 10
+`)
+	defer b.Close()
+
+	cases := []struct {
+		header http.Header
+		result string
+		score  string
+	}{
+		{header: browserHeader(), result: "", score: ""},
+		{header: http.Header{}, result: "", score: "7"},
+		{header: http.Header{"User-Agent": {"curl/7.88.1"}, "Accept": {"*/*"}}, result: "", score: "5"},
+		{header: http.Header{"User-Agent": {"BadBot/1.0"}}, result: resultBlocked},
+		{header: http.Header{"User-Agent": {"Googlebot/2.1"}}, result: "", score: ""},
+		{header: http.Header{"User-Agent": {"curl/7.88.1"}, "X-Ja3-Hash": {"e7d705a3286e19ea42f587b344ee6865"}}, result: resultBlocked},
+		{header: http.Header{"User-Agent": {"curl/7.88.1"}, "Accept": {"*/*"}, "X-Ja3-Hash": {"b32309a26951912be7dba376398abc3b"}}, result: "", score: ""},
+	}
+	for i, c := range cases {
+		ctx := newTestContext("192.0.2.1", c.header)
+		assert.Equal(c.result, b.Handle(ctx), "case %d", i)
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		if c.result == "" {
+			assert.Equal(c.score, req.HTTPHeader().Get(defaultScoreHeader), "case %d", i)
+		} else {
+			assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+		}
+	}
+
+	status := b.Status().(*Status)
+	assert.Equal(uint64(2), status.NumOfTagged)
+	assert.Equal(uint64(2), status.NumOfBlocked)
+}
+
+func TestIPReputation(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "list.txt")
+	assert.NoError(os.WriteFile(file, []byte(`# comment
+192.0.2.0/24 ; SBL1
+198.51.100.7
+invalid
+2001:db8::1
+`), 0o644))
+
+	db, err := mmdbtest.Build(6, 24, map[string]interface{}{
+		"203.0.113.0/24": map[string]interface{}{"traits": map[string]interface{}{"is_anonymous_proxy": true}},
+		"203.0.114.0/24": map[string]interface{}{"traits": map[string]interface{}{"is_anonymous_proxy": false}},
+	})
+	assert.NoError(err)
+	dbFile := filepath.Join(dir, "anonymous.mmdb")
+	assert.NoError(os.WriteFile(dbFile, db, 0o644))
+
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "100.64.0.0/10")
+	}))
+	defer feed.Close()
+
+	b := newTestBotDetector(assert, fmt.Sprintf(`
+kind: BotDetector
+name: bot
+ipReputation:
+- name: drop
+  file: %s
+  score: 10
+- name: anonymous
+  mmdb: %s
+  mmdbField: traits.is_anonymous_proxy
+  score: 10
+- name: feed
+  url: %s
+  score: 10
+thresholds:
+  block: 10
+`, file, dbFile, feed.URL))
+	defer b.Close()
+
+	// wait for the feed.
+	for i := 0; i < 100 && b.lists[2].status().Entries == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for ip, result := range map[string]string{
+		"192.0.2.100":  resultBlocked,
+		"198.51.100.7": resultBlocked,
+		"198.51.100.8": "",
+		"2001:db8::1":  resultBlocked,
+		"203.0.113.1":  resultBlocked,
+		"203.0.114.1":  "",
+		"100.64.1.1":   resultBlocked,
+		"10.0.0.1":     "",
+	} {
+		ctx := newTestContext(ip, browserHeader())
+		assert.Equal(result, b.Handle(ctx), ip)
+	}
+
+	status := b.Status().(*Status)
+	assert.Equal(3, status.ReputationLists[0].Entries)
+	assert.Equal("feed", status.ReputationLists[2].Name)
+	assert.Equal(1, status.ReputationLists[2].Entries)
+}
+
+type testSet map[string]bool
+
+func (s testSet) Contains(ip net.IP) bool {
+	return s[ip.String()]
+}
+
+func TestIPSetReputation(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ReputationList{Name: "set", IPSet: "bad", Score: 10}
+	assert.NoError(spec.Validate())
+
+	l := newReputationList(spec, nil)
+	assert.False(l.contains(net.ParseIP("192.0.2.1")))
+	l.close()
+
+	// the set is looked up on every request.
+	sets := map[string]ipfilter.Set{}
+	l = newReputationList(spec, func(name string) ipfilter.Set {
+		return sets[name]
+	})
+	defer l.close()
+	assert.False(l.contains(net.ParseIP("192.0.2.1")))
+	sets["bad"] = testSet{"192.0.2.1": true}
+	assert.True(l.contains(net.ParseIP("192.0.2.1")))
+	assert.False(l.contains(net.ParseIP("192.0.2.2")))
+}
+
+func TestChallenge(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newTestBotDetector(assert, `
+kind: BotDetector
+name: bot
+thresholds:
+  challenge: 2
+challenge:
+  secret: 0123456789abcdef
+  cookieName: challenge
+`)
+	defer b.Close()
+
+	header := http.Header{"User-Agent": {browserUA}}
+	ctx := newTestContext("192.0.2.1", header)
+	assert.Equal(resultChallenged, b.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	page := string(resp.RawPayload())
+	assert.Contains(page, "location.reload()")
+
+	i := strings.Index(page, `"challenge=`)
+	assert.True(i > 0)
+	token := page[i+len(`"challenge=`):]
+	token = token[:strings.Index(token, `"`)]
+
+	header.Set("Cookie", "challenge="+token)
+	ctx = newTestContext("192.0.2.1", header)
+	assert.Equal("", b.Handle(ctx))
+
+	// the cookie is bound to the client IP.
+	ctx = newTestContext("192.0.2.2", header)
+	assert.Equal(resultChallenged, b.Handle(ctx))
+
+	c := b.challenger
+	now := time.Now()
+	assert.False(c.verify(c.token("a", "b", now.Add(-2*time.Hour)), "a", "b", now))
+	assert.False(c.verify("invalid", "a", "b", now))
+	assert.True(c.verify(c.token("a", "b", now), "a", "b", now))
+}
+
+func TestThrottle(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newTestBotDetector(assert, `
+kind: BotDetector
+name: bot
+thresholds:
+  throttle: 5
+throttle:
+  rate: 1
+  burst: 2
+`)
+	defer b.Close()
+
+	header := http.Header{"User-Agent": {"curl/7.88.1"}, "Accept": {"*/*"}}
+	for i := 0; i < 2; i++ {
+		ctx := newTestContext("192.0.2.1", header)
+		assert.Equal("", b.Handle(ctx))
+	}
+	ctx := newTestContext("192.0.2.1", header)
+	assert.Equal(resultThrottled, b.Handle(ctx))
+	assert.Equal(http.StatusTooManyRequests, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// other clients and browsers are not throttled.
+	ctx = newTestContext("192.0.2.2", header)
+	assert.Equal("", b.Handle(ctx))
+	ctx = newTestContext("192.0.2.1", browserHeader())
+	assert.Equal("", b.Handle(ctx))
+
+	th := newThrottler(&ThrottleSpec{Rate: 1})
+	now := time.Now()
+	assert.True(th.allow("a", now))
+	assert.False(th.allow("a", now))
+	assert.True(th.allow("a", now.Add(time.Second)))
+	th.cleanup(now.Add(time.Hour))
+	assert.Empty(th.buckets)
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+const (
+	defaultChallengeCookie = "eg-bot-challenge"
+	defaultChallengeTTL    = time.Hour
+)
+
+type (
+	// ChallengeSpec describes the JavaScript challenge. The clients passing
+	// the challenge get a cookie, and are not challenged until it expires.
+	ChallengeSpec struct {
+		// Secret signs the cookies, a random one is used if it is empty,
+		// which doesn't work across instances and restarts.
+		Secret     string `json:"secret" jsonschema:"omitempty"`
+		CookieName string `json:"cookieName" jsonschema:"omitempty"`
+		TTL        string `json:"ttl" jsonschema:"omitempty,format=duration"`
+	}
+
+	// challenger issues and verifies the challenge cookies, the cookie is
+	// bound to the client IP and the user agent.
+	challenger struct {
+		secret []byte
+		cookie string
+		ttl    time.Duration
+	}
+)
+
+var challengePage = template.Must(template.New("challenge").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Checking your browser</title></head>
+<body>
+<noscript>Please enable JavaScript to continue.</noscript>
+<script>
+document.cookie = {{.Cookie}} + "; path=/; max-age=" + {{.MaxAge}} + "; SameSite=Lax";
+location.reload();
+</script>
+</body>
+</html>
+`))
+
+// Validate validates the ChallengeSpec.
+func (spec *ChallengeSpec) Validate() error {
+	if spec.Secret != "" && len(spec.Secret) < 16 {
+		return fmt.Errorf("secret of challenge must be at least 16 characters")
+	}
+	if spec.TTL != "" {
+		if d, err := time.ParseDuration(spec.TTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid ttl %s of challenge", spec.TTL)
+		}
+	}
+	return nil
+}
+
+func newChallenger(spec *ChallengeSpec) *challenger {
+	c := &challenger{
+		secret: []byte(spec.Secret),
+		cookie: spec.CookieName,
+		ttl:    defaultChallengeTTL,
+	}
+	if len(c.secret) == 0 {
+		c.secret = make([]byte, 32)
+		rand.Read(c.secret)
+	}
+	if c.cookie == "" {
+		c.cookie = defaultChallengeCookie
+	}
+	if spec.TTL != "" {
+		c.ttl, _ = time.ParseDuration(spec.TTL)
+	}
+	return c
+}
+
+func (c *challenger) sign(expires []byte, ip, ua string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(expires)
+	mac.Write([]byte(ip))
+	mac.Write([]byte{0})
+	mac.Write([]byte(ua))
+	return mac.Sum(nil)
+}
+
+// token returns the cookie value for the client.
+func (c *challenger) token(ip, ua string, now time.Time) string {
+	expires := make([]byte, 8)
+	binary.BigEndian.PutUint64(expires, uint64(now.Add(c.ttl).Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(expires, c.sign(expires, ip, ua)...))
+}
+
+// verify returns whether the cookie value is valid for the client.
+func (c *challenger) verify(token, ip, ua string, now time.Time) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 8+sha256.Size {
+		return false
+	}
+	expires := b[:8]
+	if int64(binary.BigEndian.Uint64(expires)) < now.Unix() {
+		return false
+	}
+	return hmac.Equal(b[8:], c.sign(expires, ip, ua))
+}
+
+// page returns the challenge page, which sets the cookie by JavaScript
+// and reloads.
+func (c *challenger) page(ip, ua string, now time.Time) string {
+	sb := &strings.Builder{}
+	challengePage.Execute(sb, map[string]interface{}{
+		"Cookie": c.cookie + "=" + c.token(ip, ua, now),
+		"MaxAge": int(c.ttl.Seconds()),
+	})
+	return sb.String()
+}
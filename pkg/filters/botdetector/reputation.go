@@ -0,0 +1,316 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yl2chen/cidranger"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/mmdb"
+)
+
+const (
+	defaultRefreshInterval = 10 * time.Minute
+	feedTimeout            = 30 * time.Second
+	// maxFeedSize is the max size of the list fetched from a feed.
+	maxFeedSize = 64 * 1024 * 1024
+)
+
+type (
+	// ReputationList is a list of IP addresses with bad reputation, which
+	// is loaded from exactly one of a file, an HTTP feed, a MaxMind DB, or
+	// an IPSet.
+	ReputationList struct {
+		Name string `json:"name" jsonschema:"required"`
+		// File is a file of IP addresses or CIDRs, one per line, the
+		// content after '#' or ';' is comment.
+		File string `json:"file" jsonschema:"omitempty"`
+		// URL is an HTTP feed in the format of File.
+		URL  string `json:"url" jsonschema:"omitempty"`
+		MMDB string `json:"mmdb" jsonschema:"omitempty"`
+		// MMDBField is the path of the field separated by dots, e.g.
+		// traits.is_anonymous_proxy, the IP addresses whose field is not
+		// empty or false are in the list. All the IP addresses in the
+		// database are in the list if it is empty.
+		MMDBField string `json:"mmdbField" jsonschema:"omitempty"`
+		// IPSet is the name of an IPSet, which is looked up on every
+		// request, so it is not refreshed.
+		IPSet           string `json:"ipSet" jsonschema:"omitempty"`
+		RefreshInterval string `json:"refreshInterval" jsonschema:"omitempty,format=duration"`
+		Score           int    `json:"score" jsonschema:"required"`
+	}
+
+	// reputationList is a loaded ReputationList, which is reloaded
+	// periodically.
+	reputationList struct {
+		spec   *ReputationList
+		getSet ipfilter.SetGetter
+		done   chan struct{}
+
+		mutex   sync.RWMutex
+		ranger  cidranger.Ranger
+		db      *mmdb.Reader
+		entries int
+		updated time.Time
+	}
+
+	// ReputationListStatus is the status of a reputation list.
+	ReputationListStatus struct {
+		Name string `json:"name"`
+		// Entries is the number of the IP addresses and CIDRs, or the
+		// number of the nodes of the MaxMind DB.
+		Entries     int       `json:"entries"`
+		LastUpdated time.Time `json:"lastUpdated"`
+	}
+)
+
+// Validate validates the ReputationList.
+func (spec *ReputationList) Validate() error {
+	sources := 0
+	for _, s := range []string{spec.File, spec.URL, spec.MMDB, spec.IPSet} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("reputation list %s: exactly one of file, url, mmdb and ipSet must be specified", spec.Name)
+	}
+	if spec.MMDBField != "" && spec.MMDB == "" {
+		return fmt.Errorf("reputation list %s: mmdbField requires mmdb", spec.Name)
+	}
+	if spec.RefreshInterval != "" {
+		if d, err := time.ParseDuration(spec.RefreshInterval); err != nil || d <= 0 {
+			return fmt.Errorf("reputation list %s: invalid refresh interval %s", spec.Name, spec.RefreshInterval)
+		}
+	}
+	return nil
+}
+
+// newReputationList creates a reputation list, the files are loaded
+// immediately, while the feeds are fetched in the background.
+func newReputationList(spec *ReputationList, getSet ipfilter.SetGetter) *reputationList {
+	l := &reputationList{spec: spec, getSet: getSet, done: make(chan struct{})}
+	if spec.IPSet != "" {
+		return l
+	}
+	if spec.URL == "" {
+		l.refresh()
+	}
+	go l.run()
+	return l
+}
+
+func (l *reputationList) run() {
+	interval := defaultRefreshInterval
+	if l.spec.RefreshInterval != "" {
+		interval, _ = time.ParseDuration(l.spec.RefreshInterval)
+	}
+
+	if l.spec.URL != "" {
+		l.refresh()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.refresh()
+		}
+	}
+}
+
+// refresh reloads the list, the old one is kept if it fails.
+func (l *reputationList) refresh() {
+	var err error
+	if l.spec.MMDB != "" {
+		err = l.loadMMDB()
+	} else {
+		err = l.loadList()
+	}
+	if err != nil {
+		logger.Errorf("load reputation list %s failed: %v", l.spec.Name, err)
+	}
+}
+
+func (l *reputationList) loadMMDB() error {
+	db, err := mmdb.Open(l.spec.MMDB)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	l.db = db
+	l.entries = db.Metadata.NodeCount
+	l.updated = time.Now()
+	l.mutex.Unlock()
+	return nil
+}
+
+func (l *reputationList) loadList() error {
+	var data []byte
+	var err error
+	if l.spec.File != "" {
+		data, err = os.ReadFile(l.spec.File)
+	} else {
+		data, err = fetchFeed(l.spec.URL)
+	}
+	if err != nil {
+		return err
+	}
+
+	ranger, entries := parseList(data)
+	l.mutex.Lock()
+	l.ranger = ranger
+	l.entries = entries
+	l.updated = time.Now()
+	l.mutex.Unlock()
+	return nil
+}
+
+func fetchFeed(url string) ([]byte, error) {
+	client := &http.Client{Timeout: feedTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returns status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// parseList parses the list of IP addresses and CIDRs, the invalid lines
+// are ignored.
+func parseList(data []byte) (cidranger.Ranger, int) {
+	ranger := cidranger.NewPCTrieRanger()
+	entries := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		s := fields[0]
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			continue
+		}
+		ranger.Insert(cidranger.NewBasicRangerEntry(*ipnet))
+		entries++
+	}
+	return ranger, entries
+}
+
+// contains returns whether the ip is in the list.
+func (l *reputationList) contains(ip net.IP) bool {
+	if l.spec.IPSet != "" {
+		if l.getSet == nil {
+			return false
+		}
+		set := l.getSet(l.spec.IPSet)
+		return set != nil && set.Contains(ip)
+	}
+
+	l.mutex.RLock()
+	ranger, db := l.ranger, l.db
+	l.mutex.RUnlock()
+
+	if ranger != nil {
+		ok, _ := ranger.Contains(ip)
+		return ok
+	}
+	if db == nil {
+		return false
+	}
+
+	v, err := db.Lookup(ip)
+	if err != nil || v == nil {
+		return false
+	}
+	if l.spec.MMDBField != "" {
+		v = mmdb.Path(v, strings.Split(l.spec.MMDBField, ".")...)
+	}
+	return truthy(v)
+}
+
+// truthy returns whether the value of a MaxMind DB is not empty or false.
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case uint64:
+		return v != 0
+	case int32:
+		return v != 0
+	case float64:
+		return v != 0
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func (l *reputationList) status() *ReputationListStatus {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return &ReputationListStatus{
+		Name:        l.spec.Name,
+		Entries:     l.entries,
+		LastUpdated: l.updated,
+	}
+}
+
+func (l *reputationList) close() {
+	close(l.done)
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package botdetector
+
+import (
+	"sync"
+	"time"
+)
+
+// maxBuckets is the number of buckets to trigger the cleanup of the full
+// buckets.
+const maxBuckets = 65536
+
+type (
+	// throttler limits the rate of the requests of each client IP by the
+	// token buckets.
+	throttler struct {
+		rate  float64
+		burst float64
+
+		mutex   sync.Mutex
+		buckets map[string]*bucket
+	}
+
+	bucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+func newThrottler(spec *ThrottleSpec) *throttler {
+	burst := float64(spec.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttler{rate: spec.Rate, burst: burst, buckets: map[string]*bucket{}}
+}
+
+// refill refills the bucket to now.
+func (t *throttler) refill(b *bucket, now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * t.rate
+	if b.tokens > t.burst {
+		b.tokens = t.burst
+	}
+	b.last = now
+}
+
+// allow returns whether a request of the key is allowed.
+func (t *throttler) allow(key string, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	b := t.buckets[key]
+	if b == nil {
+		if len(t.buckets) >= maxBuckets {
+			t.cleanup(now)
+		}
+		b = &bucket{tokens: t.burst, last: now}
+		t.buckets[key] = b
+	} else {
+		t.refill(b, now)
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// cleanup removes the full buckets, which are the same as the new ones.
+func (t *throttler) cleanup(now time.Time) {
+	for key, b := range t.buckets {
+		t.refill(b, now)
+		if b.tokens >= t.burst {
+			delete(t.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package clientcertauth implements the ClientCertAuth filter, which
+// authorizes requests by the TLS client certificates.
+package clientcertauth
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ClientCertAuth.
+	Kind = "ClientCertAuth"
+
+	resultUnauthorized = "unauthorized"
+	resultForbidden    = "forbidden"
+
+	defaultIdentityHeader = "X-Client-Identity"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ClientCertAuth validates TLS client certificates and authorizes requests by their identities.",
+	Results:     []string{resultUnauthorized, resultForbidden},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ClientCertAuth{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ClientCertAuth is filter ClientCertAuth.
+	ClientCertAuth struct {
+		spec *Spec
+
+		roots      *x509.CertPool
+		revocation *revocationChecker
+	}
+
+	// Spec describes the ClientCertAuth.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// CACerts are the base64 encoded PEM certificates of the CAs, the
+		// certificates verified by the HTTPServer are accepted if empty.
+		CACerts []string `json:"caCerts" jsonschema:"omitempty"`
+		// CRLs are the base64 encoded certificate revocation lists, in PEM
+		// or DER, which must be signed by one of the CACerts.
+		CRLs []string  `json:"crls" jsonschema:"omitempty"`
+		OCSP *OCSPSpec `json:"ocsp,omitempty" jsonschema:"omitempty"`
+
+		SPIFFEIDs []string `json:"spiffeIds" jsonschema:"omitempty"`
+		DNSNames  []string `json:"dnsNames" jsonschema:"omitempty"`
+		URIs      []string `json:"uris" jsonschema:"omitempty"`
+		Emails    []string `json:"emails" jsonschema:"omitempty"`
+
+		IdentityHeader string `json:"identityHeader" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	cas, err := parseCACerts(spec.CACerts)
+	if err != nil {
+		return err
+	}
+	if len(spec.CRLs) > 0 {
+		if len(cas) == 0 {
+			return fmt.Errorf("crls require caCerts")
+		}
+		if _, err = parseCRLs(spec.CRLs, cas); err != nil {
+			return err
+		}
+	}
+
+	for _, patterns := range [][]string{spec.SPIFFEIDs, spec.DNSNames, spec.URIs, spec.Emails} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid pattern %s: %v", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseCACerts(caCerts []string) ([]*x509.Certificate, error) {
+	var result []*x509.Certificate
+	for _, s := range caCerts {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ca cert: %v", err)
+		}
+		certs, err := parseCertificates(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ca cert: %v", err)
+		}
+		result = append(result, certs...)
+	}
+	return result, nil
+}
+
+// Name returns the name of the ClientCertAuth filter instance.
+func (cca *ClientCertAuth) Name() string {
+	return cca.spec.Name()
+}
+
+// Kind returns the kind of ClientCertAuth.
+func (cca *ClientCertAuth) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ClientCertAuth.
+func (cca *ClientCertAuth) Spec() filters.Spec {
+	return cca.spec
+}
+
+// Init initializes ClientCertAuth.
+func (cca *ClientCertAuth) Init() {
+	cca.reload()
+}
+
+// Inherit inherits previous generation of ClientCertAuth.
+func (cca *ClientCertAuth) Inherit(previousGeneration filters.Filter) {
+	cca.reload()
+}
+
+func (cca *ClientCertAuth) reload() {
+	// the errors are checked in Validate.
+	cas, _ := parseCACerts(cca.spec.CACerts)
+	if len(cas) > 0 {
+		cca.roots = x509.NewCertPool()
+		for _, ca := range cas {
+			cca.roots.AddCert(ca)
+		}
+	}
+
+	crls, _ := parseCRLs(cca.spec.CRLs, cas)
+	if len(crls) > 0 || cca.spec.OCSP != nil {
+		cca.revocation = newRevocationChecker(crls, cca.spec.OCSP)
+	}
+}
+
+// verify verifies the certificates and returns the verified chains.
+func (cca *ClientCertAuth) verify(req *httpprot.Request) ([][]*x509.Certificate, error) {
+	state := req.Std().TLS
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("no client certificate")
+	}
+
+	if cca.roots == nil {
+		if len(state.VerifiedChains) == 0 {
+			return nil, fmt.Errorf("client certificate is not verified")
+		}
+		return state.VerifiedChains, nil
+	}
+
+	certs := state.PeerCertificates
+	opts := x509.VerifyOptions{
+		Roots:         cca.roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	return certs[0].Verify(opts)
+}
+
+func matchAny(patterns []string, values []string) bool {
+	for _, p := range patterns {
+		for _, v := range values {
+			if ok, _ := path.Match(p, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// spiffeIDs returns the SPIFFE IDs in the URI SANs of the certificate.
+func spiffeIDs(cert *x509.Certificate) []string {
+	var result []string
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			result = append(result, u.String())
+		}
+	}
+	return result
+}
+
+// authorize returns whether the SANs of the certificate match the patterns,
+// the certificate is authorized if it matches any of them, or there are no
+// patterns at all.
+func (cca *ClientCertAuth) authorize(cert *x509.Certificate) bool {
+	spec := cca.spec
+	if len(spec.SPIFFEIDs)+len(spec.DNSNames)+len(spec.URIs)+len(spec.Emails) == 0 {
+		return true
+	}
+
+	var uris []string
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+	return matchAny(spec.SPIFFEIDs, spiffeIDs(cert)) ||
+		matchAny(spec.DNSNames, cert.DNSNames) ||
+		matchAny(spec.URIs, uris) ||
+		matchAny(spec.Emails, cert.EmailAddresses)
+}
+
+// identity returns the identity of the certificate, which is the first of
+// the SPIFFE ID, the URI SANs, the DNS SANs, and the common name.
+func identity(cert *x509.Certificate) string {
+	if ids := spiffeIDs(cert); len(ids) > 0 {
+		return ids[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// Handle authorizes the request by its client certificate.
+func (cca *ClientCertAuth) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	header := cca.spec.IdentityHeader
+	if header == "" {
+		header = defaultIdentityHeader
+	}
+	// never trust the identity from the clients.
+	req.HTTPHeader().Del(header)
+
+	reject := func(code int, result string, err error) string {
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(code)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag(cca.Name() + ": " + err.Error())
+		return result
+	}
+
+	chains, err := cca.verify(req)
+	if err != nil {
+		return reject(http.StatusUnauthorized, resultUnauthorized, err)
+	}
+
+	cert := chains[0][0]
+	if cca.revocation != nil {
+		if err = cca.revocation.check(chains[0]); err != nil {
+			logger.Debugf("%s: %v", cca.Name(), err)
+			return reject(http.StatusUnauthorized, resultUnauthorized, err)
+		}
+	}
+
+	if !cca.authorize(cert) {
+		return reject(http.StatusForbidden, resultForbidden, fmt.Errorf("identity %s is not allowed", identity(cert)))
+	}
+
+	req.HTTPHeader().Set(header, identity(cert))
+	return ""
+}
+
+// Status returns status.
+func (cca *ClientCertAuth) Status() interface{} {
+	return nil
+}
+
+// Close closes ClientCertAuth.
+func (cca *ClientCertAuth) Close() {
+}
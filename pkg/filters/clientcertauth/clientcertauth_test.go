@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientcertauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(assert *assert.Assertions) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	assert.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() string {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func (ca *testCA) issue(assert *assert.Assertions, serial int64, uri string, ocspServer string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	u, _ := url.Parse(uri)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{u},
+		DNSNames:     []string{"client.example.com"},
+	}
+	if ocspServer != "" {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	assert.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(err)
+	return cert
+}
+
+func (ca *testCA) crl(assert *assert.Assertions, serials ...int64) string {
+	var revoked []pkix.RevokedCertificate
+	for _, s := range serials {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          time.Now(),
+		NextUpdate:          time.Now().Add(time.Hour),
+		RevokedCertificates: revoked,
+	}, ca.cert, ca.key)
+	assert.NoError(err)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func newTestClientCertAuth(assert *assert.Assertions, yamlConfig string) *ClientCertAuth {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	cca := kind.CreateInstance(spec).(*ClientCertAuth)
+	cca.Init()
+	return cca
+}
+
+func newTestContext(state *tls.ConnectionState) (*context.Context, *httpprot.Request) {
+	stdr, _ := http.NewRequest(http.MethodGet, "https://127.0.0.1", nil)
+	stdr.Header.Set(defaultIdentityHeader, "forged")
+	stdr.TLS = state
+	req, _ := httpprot.NewRequest(stdr)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+	return ctx, req
+}
+
+func TestClientCertAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(assert)
+	other := newTestCA(assert)
+	cca := newTestClientCertAuth(assert, `
+kind: ClientCertAuth
+name: cca
+caCerts: [`+ca.pem()+`]
+crls: [`+ca.crl(assert, 3)+`]
+spiffeIds: ["spiffe://example.org/ns/*/sa/web"]
+`)
+	assert.Equal(Kind, cca.Kind().Name)
+
+	check := func(cert *x509.Certificate, result string, code int) *httpprot.Request {
+		ctx, req := newTestContext(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+		assert.Equal(result, cca.Handle(ctx))
+		if code != 0 {
+			assert.Equal(code, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+		}
+		return req
+	}
+
+	req := check(ca.issue(assert, 2, "spiffe://example.org/ns/prod/sa/web", ""), "", 0)
+	assert.Equal("spiffe://example.org/ns/prod/sa/web", req.HTTPHeader().Get(defaultIdentityHeader))
+
+	req = check(ca.issue(assert, 4, "spiffe://example.org/ns/prod/sa/db", ""), resultForbidden, http.StatusForbidden)
+	assert.Empty(req.HTTPHeader().Get(defaultIdentityHeader))
+
+	// revoked by the CRL.
+	check(ca.issue(assert, 3, "spiffe://example.org/ns/prod/sa/web", ""), resultUnauthorized, http.StatusUnauthorized)
+	// not issued by the CA.
+	check(other.issue(assert, 2, "spiffe://example.org/ns/prod/sa/web", ""), resultUnauthorized, http.StatusUnauthorized)
+
+	// no client certificates.
+	ctx, _ := newTestContext(nil)
+	assert.Equal(resultUnauthorized, cca.Handle(ctx))
+
+	// the certificates verified by the HTTPServer are used without caCerts.
+	cca = newTestClientCertAuth(assert, `
+kind: ClientCertAuth
+name: cca
+dnsNames: ["*.example.com"]
+identityHeader: X-Identity
+`)
+	cert := ca.issue(assert, 2, "https://client.example.com", "")
+	ctx, _ = newTestContext(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+	assert.Equal(resultUnauthorized, cca.Handle(ctx))
+	ctx, req = newTestContext(&tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert, ca.cert}},
+	})
+	assert.Equal("", cca.Handle(ctx))
+	assert.Equal("https://client.example.com", req.HTTPHeader().Get("X-Identity"))
+}
+
+func TestClientCertAuthOCSP(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(assert)
+	var queries, unavailable int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		if atomic.LoadInt32(&unavailable) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		assert.NoError(err)
+		status := ocsp.Good
+		if req.SerialNumber.Int64() == 3 {
+			status = ocsp.Revoked
+		}
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now(),
+		}, ca.key)
+		assert.NoError(err)
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	cca := newTestClientCertAuth(assert, `
+kind: ClientCertAuth
+name: cca
+caCerts: [`+ca.pem()+`]
+ocsp:
+  timeout: 1s
+`)
+	handle := func(cert *x509.Certificate) string {
+		ctx, _ := newTestContext(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+		return cca.Handle(ctx)
+	}
+
+	good := ca.issue(assert, 2, "spiffe://example.org/web", server.URL)
+	assert.Equal("", handle(good))
+	assert.Equal(resultUnauthorized, handle(ca.issue(assert, 3, "spiffe://example.org/web", server.URL)))
+
+	// the status is cached.
+	assert.Equal("", handle(good))
+	assert.Equal(int32(2), atomic.LoadInt32(&queries))
+
+	// fail closed when the responder is unavailable.
+	atomic.StoreInt32(&unavailable, 1)
+	assert.Equal(resultUnauthorized, handle(ca.issue(assert, 4, "spiffe://example.org/web", server.URL)))
+
+	cca = newTestClientCertAuth(assert, `
+kind: ClientCertAuth
+name: cca
+caCerts: [`+ca.pem()+`]
+ocsp:
+  failOpen: true
+`)
+	assert.Equal("", handle(ca.issue(assert, 4, "spiffe://example.org/web", server.URL)))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(assert)
+	other := newTestCA(assert)
+	assert.NoError((&Spec{CACerts: []string{ca.pem()}, CRLs: []string{ca.crl(assert)}}).Validate())
+	assert.Error((&Spec{CACerts: []string{"invalid"}}).Validate())
+	assert.Error((&Spec{CRLs: []string{ca.crl(assert)}}).Validate())
+	assert.Error((&Spec{CACerts: []string{ca.pem()}, CRLs: []string{other.crl(assert)}}).Validate())
+	assert.Error((&Spec{SPIFFEIDs: []string{"spiffe://["}}).Validate())
+}
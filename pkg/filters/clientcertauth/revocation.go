@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientcertauth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	defaultOCSPTimeout  = 3 * time.Second
+	defaultOCSPCacheTTL = 5 * time.Minute
+	maxOCSPResponseSize = 64 * 1024
+)
+
+type (
+	// OCSPSpec describes the OCSP checking of the client certificates.
+	OCSPSpec struct {
+		Timeout  string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		CacheTTL string `json:"cacheTTL" jsonschema:"omitempty,format=duration"`
+		// FailOpen accepts the certificates if the status is unknown, e.g.
+		// the responder is unreachable.
+		FailOpen bool `json:"failOpen" jsonschema:"omitempty"`
+	}
+
+	// revocationChecker checks whether the certificates are revoked by the
+	// CRLs and OCSP.
+	revocationChecker struct {
+		// revoked is the revoked serial numbers, keyed by the raw subject
+		// of the issuers.
+		revoked map[string]map[string]struct{}
+
+		ocsp     *OCSPSpec
+		client   *http.Client
+		cacheTTL time.Duration
+		lock     sync.Mutex
+		cache    map[string]*ocspEntry
+	}
+
+	ocspEntry struct {
+		err    error
+		expire time.Time
+	}
+
+	crl struct {
+		issuer *x509.Certificate
+		list   *pkix.CertificateList
+	}
+)
+
+// Validate validates OCSPSpec.
+func (spec *OCSPSpec) Validate() error {
+	for _, d := range []string{spec.Timeout, spec.CacheTTL} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration %s: %v", d, err)
+		}
+	}
+	return nil
+}
+
+// parseCertificates parses the certificates in PEM or DER.
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return x509.ParseCertificates(data)
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certs, nil
+}
+
+// parseCRLs parses the CRLs and finds their issuers in cas.
+func parseCRLs(crls []string, cas []*x509.Certificate) ([]*crl, error) {
+	var result []*crl
+	for _, s := range crls {
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crl: %v", err)
+		}
+		list, err := x509.ParseCRL(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crl: %v", err)
+		}
+
+		var issuer *x509.Certificate
+		for _, ca := range cas {
+			if ca.CheckCRLSignature(list) == nil {
+				issuer = ca
+				break
+			}
+		}
+		if issuer == nil {
+			return nil, fmt.Errorf("crl of %s is not signed by any of the ca certs", list.TBSCertList.Issuer.String())
+		}
+		result = append(result, &crl{issuer: issuer, list: list})
+	}
+	return result, nil
+}
+
+func newRevocationChecker(crls []*crl, spec *OCSPSpec) *revocationChecker {
+	rc := &revocationChecker{revoked: map[string]map[string]struct{}{}}
+
+	for _, c := range crls {
+		if c.list.HasExpired(time.Now()) {
+			logger.Warnf("crl of %s has expired", c.issuer.Subject.String())
+		}
+		issuer := string(c.issuer.RawSubject)
+		serials := rc.revoked[issuer]
+		if serials == nil {
+			serials = map[string]struct{}{}
+			rc.revoked[issuer] = serials
+		}
+		for _, rev := range c.list.TBSCertList.RevokedCertificates {
+			serials[rev.SerialNumber.String()] = struct{}{}
+		}
+	}
+
+	if spec != nil {
+		timeout := defaultOCSPTimeout
+		if d, err := time.ParseDuration(spec.Timeout); err == nil {
+			timeout = d
+		}
+		rc.cacheTTL = defaultOCSPCacheTTL
+		if d, err := time.ParseDuration(spec.CacheTTL); err == nil {
+			rc.cacheTTL = d
+		}
+		rc.ocsp = spec
+		rc.client = &http.Client{Timeout: timeout}
+		rc.cache = map[string]*ocspEntry{}
+	}
+	return rc
+}
+
+// check checks the certificates of a verified chain, the last one of the
+// chain is the root CA, which is not checked.
+func (rc *revocationChecker) check(chain []*x509.Certificate) error {
+	for _, cert := range chain[:len(chain)-1] {
+		if _, ok := rc.revoked[string(cert.RawIssuer)][cert.SerialNumber.String()]; ok {
+			return fmt.Errorf("certificate %s is revoked", cert.Subject.String())
+		}
+	}
+
+	if rc.ocsp == nil || len(chain) < 2 {
+		return nil
+	}
+
+	err := rc.checkOCSP(chain[0], chain[1])
+	if err != nil && rc.ocsp.FailOpen && err != errRevoked {
+		logger.Warnf("ocsp check of %s failed: %v", chain[0].Subject.String(), err)
+		return nil
+	}
+	return err
+}
+
+var errRevoked = fmt.Errorf("certificate is revoked")
+
+func (rc *revocationChecker) checkOCSP(cert, issuer *x509.Certificate) error {
+	// certificates without OCSP responders are not checked.
+	if len(cert.OCSPServer) == 0 {
+		return nil
+	}
+
+	key := string(cert.RawIssuer) + "/" + cert.SerialNumber.String()
+	now := time.Now()
+
+	rc.lock.Lock()
+	entry := rc.cache[key]
+	rc.lock.Unlock()
+	if entry != nil && now.Before(entry.expire) {
+		return entry.err
+	}
+
+	resp, err := rc.queryOCSP(cert, issuer)
+	entry = &ocspEntry{expire: now.Add(rc.cacheTTL)}
+	switch {
+	case err != nil:
+		// do not cache the failures of the responder.
+		return err
+	case resp.Status == ocsp.Good:
+	case resp.Status == ocsp.Revoked:
+		entry.err = errRevoked
+	default:
+		entry.err = fmt.Errorf("certificate status is unknown")
+	}
+	if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(entry.expire) {
+		entry.expire = resp.NextUpdate
+	}
+
+	rc.lock.Lock()
+	rc.cache[key] = entry
+	rc.lock.Unlock()
+	return entry.err
+}
+
+func (rc *revocationChecker) queryOCSP(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		httpResp, err := rc.client.Post(server, "application/ocsp-request", bytes.NewReader(req))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseSize))
+		httpResp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if httpResp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("ocsp responder %s returns status code %d", server, httpResp.StatusCode)
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
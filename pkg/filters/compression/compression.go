@@ -0,0 +1,295 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package compression implements the Compression filter.
+package compression
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of Compression.
+	Kind = "Compression"
+
+	resultCompressFailed   = "compressFailed"
+	resultDecompressFailed = "decompressFailed"
+
+	keyAcceptEncoding  = "Accept-Encoding"
+	keyContentEncoding = "Content-Encoding"
+	keyContentLength   = "Content-Length"
+	keyContentType     = "Content-Type"
+	keyVary            = "Vary"
+)
+
+var defaultEncodings = []string{encodingBrotli, encodingZstd, encodingGzip}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Compression compresses responses and decompresses requests.",
+	Results:     []string{resultCompressFailed, resultDecompressFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Compression{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Compression is filter Compression.
+	Compression struct {
+		spec *Spec
+
+		encodings []string
+	}
+
+	// Spec describes the Compression.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Encodings           []string `json:"encodings" jsonschema:"omitempty,uniqueItems=true"`
+		MinLength           uint32   `json:"minLength" jsonschema:"omitempty"`
+		MimeTypes           []string `json:"mimeTypes" jsonschema:"omitempty"`
+		DecompressRequest   bool     `json:"decompressRequest" jsonschema:"omitempty"`
+		MaxDecompressedSize int64    `json:"maxDecompressedSize" jsonschema:"omitempty,minimum=0"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for _, enc := range spec.Encodings {
+		if codecs[enc] == nil {
+			return fmt.Errorf("unsupported encoding %s", enc)
+		}
+	}
+	for _, mt := range spec.MimeTypes {
+		if _, _, err := mime.ParseMediaType(mt); err != nil {
+			return fmt.Errorf("invalid mime type %s: %v", mt, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the Compression filter instance.
+func (c *Compression) Name() string {
+	return c.spec.Name()
+}
+
+// Kind returns the kind of Compression.
+func (c *Compression) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Compression.
+func (c *Compression) Spec() filters.Spec {
+	return c.spec
+}
+
+// Init initializes Compression.
+func (c *Compression) Init() {
+	c.reload()
+}
+
+// Inherit inherits previous generation of Compression.
+func (c *Compression) Inherit(previousGeneration filters.Filter) {
+	c.reload()
+}
+
+func (c *Compression) reload() {
+	c.encodings = c.spec.Encodings
+	if len(c.encodings) == 0 {
+		c.encodings = defaultEncodings
+	}
+}
+
+// Handle decompresses the request if DecompressRequest is true, and
+// compresses the response if there is one, so the filter should be put
+// before the Proxy to decompress requests, and after the Proxy to
+// compress responses.
+func (c *Compression) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if c.spec.DecompressRequest {
+		if code := c.decompressRequest(req); code != 0 {
+			buildFailureResponse(ctx, code)
+			return resultDecompressFailed
+		}
+	}
+
+	if resp, _ := ctx.GetInputResponse().(*httpprot.Response); resp != nil {
+		return c.compressResponse(req, resp)
+	}
+	return ""
+}
+
+// decompressRequest decompresses the request, it returns the status code
+// of the response if it fails, or 0 on success.
+func (c *Compression) decompressRequest(req *httpprot.Request) int {
+	h := req.HTTPHeader()
+	enc := strings.ToLower(strings.TrimSpace(h.Get(keyContentEncoding)))
+	codec := codecs[enc]
+	// leave the unsupported encodings to the backend.
+	if codec == nil {
+		return 0
+	}
+
+	maxSize := c.spec.MaxDecompressedSize
+	if maxSize == 0 {
+		maxSize = httpprot.DefaultMaxPayloadSize
+	}
+	zr, err := newDecompressReader(req.GetPayload(), codec, maxSize)
+	if err != nil {
+		logger.Debugf("%s: failed to decompress request body: %v", c.Name(), err)
+		return http.StatusBadRequest
+	}
+
+	// the size of streams is checked while they are read, the Proxy
+	// responds 413 if it is too large.
+	if req.IsStream() {
+		req.SetPayload(zr)
+		h.Del(keyContentLength)
+	} else {
+		data, err := io.ReadAll(zr)
+		zr.Close()
+		if err == httpprot.ErrRequestEntityTooLarge {
+			logger.Debugf("%s: decompressed request body is larger than %d", c.Name(), maxSize)
+			return http.StatusRequestEntityTooLarge
+		}
+		if err != nil {
+			logger.Debugf("%s: failed to decompress request body: %v", c.Name(), err)
+			return http.StatusBadRequest
+		}
+		req.SetPayload(data)
+		h.Set(keyContentLength, strconv.Itoa(len(data)))
+	}
+
+	h.Del(keyContentEncoding)
+	return 0
+}
+
+func buildFailureResponse(ctx *context.Context, statusCode int) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(statusCode)
+	ctx.SetOutputResponse(resp)
+}
+
+// shouldCompress returns whether the response could be compressed, the
+// Accept-Encoding of the request is not considered.
+func (c *Compression) shouldCompress(req *httpprot.Request, resp *httpprot.Response) bool {
+	h := resp.HTTPHeader()
+	if h.Get(keyContentEncoding) != "" {
+		return false
+	}
+
+	code := resp.StatusCode()
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		return false
+	}
+	if req.Method() == http.MethodHead {
+		return false
+	}
+
+	// the events are delayed if they are compressed.
+	if httpprot.IsEventStream(h) {
+		return false
+	}
+
+	if !resp.IsStream() && resp.PayloadSize() < int64(c.spec.MinLength) {
+		return false
+	}
+
+	return c.mimeTypeAllowed(h.Get(keyContentType))
+}
+
+func (c *Compression) mimeTypeAllowed(contentType string) bool {
+	if len(c.spec.MimeTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, mt := range c.spec.MimeTypes {
+		if mt == mediaType {
+			return true
+		}
+		if strings.HasSuffix(mt, "/*") && strings.HasPrefix(mediaType, mt[:len(mt)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Compression) compressResponse(req *httpprot.Request, resp *httpprot.Response) string {
+	if !c.shouldCompress(req, resp) {
+		return ""
+	}
+
+	h := resp.HTTPHeader()
+	h.Add(keyVary, keyAcceptEncoding)
+
+	enc := negotiate(req.HTTPHeader().Get(keyAcceptEncoding), c.encodings)
+	if enc == "" {
+		return ""
+	}
+
+	zr := newCompressReader(resp.GetPayload(), codecs[enc])
+	if resp.IsStream() {
+		resp.SetPayload(zr)
+		h.Del(keyContentLength)
+	} else {
+		data, err := io.ReadAll(zr)
+		zr.Close()
+		if err != nil {
+			logger.Errorf("%s: failed to compress response body: %v", c.Name(), err)
+			return resultCompressFailed
+		}
+		resp.SetPayload(data)
+		h.Set(keyContentLength, strconv.Itoa(len(data)))
+	}
+
+	h.Set(keyContentEncoding, enc)
+	return ""
+}
+
+// Status returns status.
+func (c *Compression) Status() interface{} {
+	return nil
+}
+
+// Close closes Compression.
+func (c *Compression) Close() {
+}
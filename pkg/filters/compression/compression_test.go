@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestCompression(assert *assert.Assertions, yamlConfig string) *Compression {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	c := kind.CreateInstance(spec).(*Compression)
+	c.Init()
+	return c
+}
+
+func newTestContext(assert *assert.Assertions, stdr *http.Request, stdResp *http.Response) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	req, _ := httpprot.NewRequest(stdr)
+	assert.NoError(req.FetchPayload(0))
+	ctx.SetInputRequest(req)
+	if stdResp != nil {
+		resp, _ := httpprot.NewResponse(stdResp)
+		assert.NoError(resp.FetchPayload(0))
+		ctx.SetInputResponse(resp)
+	}
+	return ctx
+}
+
+func newTestResponse(contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{keyContentType: []string{contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func encode(assert *assert.Assertions, enc string, data string) []byte {
+	buf := bytes.Buffer{}
+	w := codecs[enc].newWriter(&buf)
+	_, err := w.Write([]byte(data))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+	return buf.Bytes()
+}
+
+func decode(assert *assert.Assertions, enc string, r io.Reader) string {
+	zr, err := codecs[enc].newReader(r)
+	assert.NoError(err)
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	assert.NoError(err)
+	return string(data)
+}
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	encodings := []string{encodingBrotli, encodingZstd, encodingGzip}
+	assert.Equal("", negotiate("", encodings))
+	assert.Equal("", negotiate("identity, deflate", encodings))
+	assert.Equal(encodingGzip, negotiate("gzip, deflate", encodings))
+	assert.Equal(encodingBrotli, negotiate("gzip, br", encodings))
+	assert.Equal(encodingGzip, negotiate("gzip;q=1.0, br;q=0.5", encodings))
+	assert.Equal(encodingBrotli, negotiate("*", encodings))
+	assert.Equal(encodingZstd, negotiate("br;q=0, *;q=0.1", encodings))
+	assert.Equal("", negotiate("GZIP;q=0", []string{encodingGzip}))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Encodings: []string{"zstd"}, MimeTypes: []string{"text/*"}}).Validate())
+	assert.Error((&Spec{Encodings: []string{"deflate"}}).Validate())
+	assert.Error((&Spec{MimeTypes: []string{"text/"}}).Validate())
+}
+
+func TestCompressResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestCompression(assert, `
+kind: Compression
+name: compression
+minLength: 10
+mimeTypes: ["text/*", "application/json"]
+`)
+	assert.Equal(Kind, c.Kind().Name)
+	assert.Nil(c.Status())
+
+	body := strings.Repeat("hello world ", 100)
+	for _, enc := range []string{encodingGzip, encodingBrotli, encodingZstd} {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+		stdr.Header.Set(keyAcceptEncoding, enc)
+		ctx := newTestContext(assert, stdr, newTestResponse("text/plain; charset=utf-8", body))
+		assert.Equal("", c.Handle(ctx))
+
+		resp := ctx.GetInputResponse().(*httpprot.Response)
+		assert.Equal(enc, resp.HTTPHeader().Get(keyContentEncoding))
+		assert.Equal(keyAcceptEncoding, resp.HTTPHeader().Get(keyVary))
+		assert.Less(resp.PayloadSize(), int64(len(body)))
+		assert.Equal(body, decode(assert, enc, resp.GetPayload()))
+	}
+
+	// too short, or not an allowed mime type.
+	for _, resp := range []*http.Response{newTestResponse("text/html", "hello"), newTestResponse("image/png", body)} {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+		stdr.Header.Set(keyAcceptEncoding, "gzip")
+		ctx := newTestContext(assert, stdr, resp)
+		assert.Equal("", c.Handle(ctx))
+		assert.Empty(ctx.GetInputResponse().(*httpprot.Response).HTTPHeader().Get(keyContentEncoding))
+	}
+
+	// streams.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	stdr.Header.Set(keyAcceptEncoding, "gzip, zstd")
+	ctx := newTestContext(assert, stdr, nil)
+	resp, _ := httpprot.NewResponse(newTestResponse("application/json", body))
+	assert.NoError(resp.FetchPayload(-1))
+	ctx.SetInputResponse(resp)
+	assert.Equal("", c.Handle(ctx))
+	assert.Equal(encodingZstd, resp.HTTPHeader().Get(keyContentEncoding))
+	assert.Empty(resp.HTTPHeader().Get(keyContentLength))
+	assert.Equal(body, decode(assert, encodingZstd, resp.GetPayload()))
+}
+
+func TestDecompressRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestCompression(assert, `
+kind: Compression
+name: compression
+decompressRequest: true
+maxDecompressedSize: 1024
+`)
+
+	body := strings.Repeat("a", 1000)
+	for _, enc := range []string{encodingGzip, encodingBrotli, encodingZstd} {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1", bytes.NewReader(encode(assert, enc, body)))
+		stdr.Header.Set(keyContentEncoding, enc)
+		ctx := newTestContext(assert, stdr, nil)
+		assert.Equal("", c.Handle(ctx))
+
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		assert.Empty(req.HTTPHeader().Get(keyContentEncoding))
+		assert.Equal("1000", req.HTTPHeader().Get(keyContentLength))
+		assert.Equal(body, string(req.RawPayload()))
+	}
+
+	// larger than maxDecompressedSize.
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1", bytes.NewReader(encode(assert, encodingGzip, body+body)))
+	stdr.Header.Set(keyContentEncoding, encodingGzip)
+	ctx := newTestContext(assert, stdr, nil)
+	assert.Equal(resultDecompressFailed, c.Handle(ctx))
+	assert.Equal(http.StatusRequestEntityTooLarge, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// invalid data.
+	stdr, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1", strings.NewReader("not gzip"))
+	stdr.Header.Set(keyContentEncoding, encodingGzip)
+	ctx = newTestContext(assert, stdr, nil)
+	assert.Equal(resultDecompressFailed, c.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// streams fail when they are read after maxDecompressedSize.
+	for _, data := range []string{body, body + body} {
+		stdr, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1", bytes.NewReader(encode(assert, encodingZstd, data)))
+		stdr.Header.Set(keyContentEncoding, encodingZstd)
+		ctx = context.New(tracing.NoopSpan)
+		req, _ := httpprot.NewRequest(stdr)
+		assert.NoError(req.FetchPayload(-1))
+		ctx.SetInputRequest(req)
+		assert.Equal("", c.Handle(ctx))
+
+		decoded, err := io.ReadAll(req.GetPayload())
+		if len(data) > 1024 {
+			assert.Equal(httpprot.ErrRequestEntityTooLarge, err)
+			assert.Len(decoded, 1024)
+		} else {
+			assert.NoError(err)
+			assert.Equal(data, string(decoded))
+		}
+	}
+
+	// unsupported encodings are left to the backend.
+	stdr, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1", strings.NewReader("data"))
+	stdr.Header.Set(keyContentEncoding, "deflate")
+	ctx = newTestContext(assert, stdr, nil)
+	assert.Equal("", c.Handle(ctx))
+	assert.Equal("deflate", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get(keyContentEncoding))
+}
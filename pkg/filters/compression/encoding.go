@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+
+	// compressFlushSize is the size of data to feed the encoder in a pull
+	// of the compress reader.
+	compressFlushSize = 32 * 1024
+)
+
+// codec creates the encoders and decoders of a content encoding.
+type codec struct {
+	newWriter func(w io.Writer) io.WriteCloser
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var codecs = map[string]*codec{
+	encodingGzip: {
+		newWriter: func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	encodingBrotli: {
+		newWriter: func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriter(w)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(brotli.NewReader(r)), nil
+		},
+	},
+	encodingZstd: {
+		newWriter: func(w io.Writer) io.WriteCloser {
+			// the error is only returned for invalid options.
+			zw, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+			return zw
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return zr.IOReadCloser(), nil
+		},
+	},
+}
+
+// compressReader wraps an io.Reader to a new io.Reader, whose data is the
+// compression result of the original io.Reader.
+type compressReader struct {
+	r    io.Reader
+	buff *bytes.Buffer
+	w    io.WriteCloser
+	err  error
+}
+
+func newCompressReader(r io.Reader, c *codec) *compressReader {
+	buff := bytes.NewBuffer(nil)
+	return &compressReader{r: r, buff: buff, w: c.newWriter(buff)}
+}
+
+// Read implements io.Reader.
+func (r *compressReader) Read(p []byte) (n int, err error) {
+	for {
+		// The error could only be io.EOF, which need to be ignored.
+		m, _ := r.buff.Read(p)
+		n += m
+		if m == len(p) {
+			break
+		}
+
+		if r.err != nil {
+			err = r.err
+			break
+		}
+
+		r.pull()
+		p = p[m:]
+	}
+	return
+}
+
+func (r *compressReader) pull() {
+	// reset the buffer to avoid it becomes too large.
+	r.buff.Reset()
+
+	_, r.err = io.CopyN(r.w, r.r, compressFlushSize)
+	if r.err == io.EOF {
+		if err := r.w.Close(); err != nil {
+			r.err = err
+		}
+	}
+}
+
+// Close implements io.Closer and closes the underlying io.Reader if it
+// is an io.Closer.
+func (r *compressReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// decompressReader closes both the decoder and the underlying io.Reader,
+// and fails with httpprot.ErrRequestEntityTooLarge after more than max
+// bytes are decompressed.
+type decompressReader struct {
+	io.ReadCloser
+	r   io.Reader
+	max int64
+	n   int64
+}
+
+// Read implements io.Reader.
+func (r *decompressReader) Read(p []byte) (int, error) {
+	if r.n > r.max {
+		return 0, httpprot.ErrRequestEntityTooLarge
+	}
+	// read one more byte to know whether the data exceeds the limit.
+	if remain := r.max - r.n + 1; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if r.n > r.max {
+		return n - 1, httpprot.ErrRequestEntityTooLarge
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (r *decompressReader) Close() error {
+	err := r.ReadCloser.Close()
+	if c, ok := r.r.(io.Closer); ok {
+		if err2 := c.Close(); err2 != nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func newDecompressReader(r io.Reader, c *codec, max int64) (*decompressReader, error) {
+	zr, err := c.newReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &decompressReader{ReadCloser: zr, r: r, max: max}, nil
+}
+
+// negotiate chooses an encoding from encodings by the Accept-Encoding
+// header, the encoding with the highest quality value is chosen, and
+// encodings is in the order of priority when the quality values are
+// equal. It returns an empty string if none of the encodings is
+// acceptable.
+func negotiate(acceptEncoding string, encodings []string) string {
+	qvalues := map[string]float64{}
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			v, err := strconv.ParseFloat(param[2:], 64)
+			if err != nil {
+				v = 0
+			}
+			q = v
+		}
+		qvalues[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		q, ok := qvalues[enc]
+		if !ok {
+			q = qvalues["*"]
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,475 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package consumerquota implements the ConsumerQuota filter.
+package consumerquota
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/megaease/easegress/pkg/cluster/consumer"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ConsumerQuota.
+	Kind = "ConsumerQuota"
+
+	resultUnauthorized  = "unauthorized"
+	resultQuotaExceeded = "quotaExceeded"
+
+	defaultSyncInterval = 5 * time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ConsumerQuota resolves the consumers of the requests and enforces their daily quotas.",
+	Results:     []string{resultUnauthorized, resultQuotaExceeded},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ConsumerQuota{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ConsumerQuota is filter ConsumerQuota.
+	ConsumerQuota struct {
+		spec *Spec
+
+		plans        map[string]*Plan
+		syncInterval time.Duration
+
+		// index is the *consumer.Index of all consumers.
+		index atomic.Value
+		store usageStore
+
+		lock     sync.Mutex
+		counters map[string]*counter
+
+		numOfUnauthorized  int64
+		numOfQuotaExceeded int64
+
+		cancel stdcontext.CancelFunc
+		done   chan struct{}
+		wg     sync.WaitGroup
+	}
+
+	// Spec describes the ConsumerQuota.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		APIKey *APIKeySpec `json:"apiKey,omitempty" jsonschema:"omitempty"`
+		JWT    *JWTSpec    `json:"jwt,omitempty" jsonschema:"omitempty"`
+		// ClientCert identifies the consumers by the common names of the
+		// client certificates verified by the HTTPServer.
+		ClientCert bool    `json:"clientCert" jsonschema:"omitempty"`
+		Plans      []*Plan `json:"plans" jsonschema:"omitempty"`
+		// ConsumerHeader is the header to pass the consumer name to the
+		// backends.
+		ConsumerHeader string `json:"consumerHeader" jsonschema:"omitempty"`
+		SyncInterval   string `json:"syncInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// APIKeySpec describes how to read the API keys.
+	APIKeySpec struct {
+		Header string `json:"header" jsonschema:"omitempty"`
+		Query  string `json:"query" jsonschema:"omitempty"`
+	}
+
+	// JWTSpec describes how to read the subjects of JWTs. The tokens are
+	// not verified, they must be verified by a Validator before.
+	JWTSpec struct {
+		Header string `json:"header" jsonschema:"omitempty"`
+		Claim  string `json:"claim" jsonschema:"omitempty"`
+	}
+
+	// Plan is a quota plan of the consumers.
+	Plan struct {
+		Name string `json:"name" jsonschema:"required"`
+		// RequestsPerDay is the daily quota, 0 means no limit.
+		RequestsPerDay int64 `json:"requestsPerDay" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Status is the status of ConsumerQuota.
+	Status struct {
+		NumOfConsumers     int   `json:"numOfConsumers"`
+		NumOfUnauthorized  int64 `json:"numOfUnauthorized"`
+		NumOfQuotaExceeded int64 `json:"numOfQuotaExceeded"`
+	}
+
+	// usageStore is the cluster-wide storage of the usage.
+	usageStore interface {
+		AddUsage(counts map[string]int64, now time.Time) (map[string]*consumer.Usage, error)
+	}
+
+	// counter counts the requests of a consumer of a day, synced is the
+	// usage of the cluster at the last sync, and pending is the number of
+	// requests not synced yet.
+	counter struct {
+		date    string
+		synced  int64
+		pending int64
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.APIKey == nil && spec.JWT == nil && !spec.ClientCert {
+		return fmt.Errorf("none of apiKey, jwt and clientCert is specified")
+	}
+
+	names := map[string]bool{}
+	for _, p := range spec.Plans {
+		if names[p.Name] {
+			return fmt.Errorf("duplicated plan %s", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	if spec.SyncInterval != "" {
+		d, err := time.ParseDuration(spec.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid syncInterval %s: %v", spec.SyncInterval, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("syncInterval must be positive")
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ConsumerQuota filter instance.
+func (cq *ConsumerQuota) Name() string {
+	return cq.spec.Name()
+}
+
+// Kind returns the kind of ConsumerQuota.
+func (cq *ConsumerQuota) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ConsumerQuota.
+func (cq *ConsumerQuota) Spec() filters.Spec {
+	return cq.spec
+}
+
+// Init initializes ConsumerQuota.
+func (cq *ConsumerQuota) Init() {
+	cq.reload()
+}
+
+// Inherit inherits previous generation of ConsumerQuota. The usage not
+// synced by the previous generation is synced before it is closed.
+func (cq *ConsumerQuota) Inherit(previousGeneration filters.Filter) {
+	previousGeneration.Close()
+	cq.reload()
+}
+
+func (cq *ConsumerQuota) reload() {
+	cq.plans = map[string]*Plan{}
+	for _, p := range cq.spec.Plans {
+		cq.plans[p.Name] = p
+	}
+
+	cq.syncInterval = defaultSyncInterval
+	if cq.spec.SyncInterval != "" {
+		cq.syncInterval, _ = time.ParseDuration(cq.spec.SyncInterval)
+	}
+
+	cq.index.Store(consumer.NewIndex(nil))
+	cq.counters = map[string]*counter{}
+	cq.done = make(chan struct{})
+
+	var ctx stdcontext.Context
+	ctx, cq.cancel = stdcontext.WithCancel(stdcontext.Background())
+
+	super := cq.spec.Super()
+	if super == nil || super.Cluster() == nil {
+		logger.Errorf("%s: cluster is unavailable, no consumer is found", cq.Name())
+		return
+	}
+	store := consumer.NewStore(super.Cluster())
+	cq.store = store
+
+	cq.wg.Add(2)
+	go func() {
+		defer cq.wg.Done()
+		err := store.Watch(ctx, func(consumers []*consumer.Consumer) {
+			cq.index.Store(consumer.NewIndex(consumers))
+		})
+		if err != nil {
+			logger.Errorf("%s: watch consumers failed: %v", cq.Name(), err)
+		}
+	}()
+	go cq.run()
+}
+
+func (cq *ConsumerQuota) run() {
+	defer cq.wg.Done()
+
+	ticker := time.NewTicker(cq.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cq.done:
+			cq.sync(time.Now())
+			return
+		case now := <-ticker.C:
+			cq.sync(now)
+		}
+	}
+}
+
+// sync adds the pending requests to the usage in the cluster, and updates
+// the counters with the usage of the cluster, which includes the requests
+// of other members.
+func (cq *ConsumerQuota) sync(now time.Time) {
+	date := consumer.Date(now)
+
+	cq.lock.Lock()
+	counts := make(map[string]int64, len(cq.counters))
+	for name, c := range cq.counters {
+		if c.date != date && c.pending == 0 {
+			delete(cq.counters, name)
+			continue
+		}
+		counts[name] = c.pending
+		c.pending = 0
+	}
+	cq.lock.Unlock()
+
+	if len(counts) == 0 {
+		return
+	}
+
+	usage, err := cq.store.AddUsage(counts, now)
+
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	if err != nil {
+		logger.Errorf("%s: sync usage failed: %v", cq.Name(), err)
+		// put the counts back to sync them next time.
+		for name, n := range counts {
+			if c := cq.counters[name]; c != nil {
+				c.pending += n
+			}
+		}
+		return
+	}
+
+	for name, u := range usage {
+		if c := cq.counters[name]; c != nil && c.date == u.Date {
+			c.synced = u.Today
+		}
+	}
+}
+
+func (cq *ConsumerQuota) getIndex() *consumer.Index {
+	return cq.index.Load().(*consumer.Index)
+}
+
+// resolve finds the consumer of the request.
+func (cq *ConsumerQuota) resolve(req *httpprot.Request) *consumer.Consumer {
+	idx := cq.getIndex()
+
+	if spec := cq.spec.APIKey; spec != nil {
+		header := spec.Header
+		if header == "" && spec.Query == "" {
+			header = "X-API-Key"
+		}
+
+		key := ""
+		if header != "" {
+			key = req.HTTPHeader().Get(header)
+		}
+		if key == "" && spec.Query != "" {
+			key = req.URL().Query().Get(spec.Query)
+		}
+		if c := idx.ByAPIKey(key); key != "" && c != nil {
+			return c
+		}
+	}
+
+	if spec := cq.spec.JWT; spec != nil {
+		if sub := jwtSubject(req, spec); sub != "" {
+			if c := idx.ByJWTSubject(sub); c != nil {
+				return c
+			}
+		}
+	}
+
+	if cq.spec.ClientCert {
+		tls := req.Std().TLS
+		if tls != nil && len(tls.PeerCertificates) > 0 {
+			if c := idx.ByCertSubject(tls.PeerCertificates[0].Subject.CommonName); c != nil {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// jwtSubject returns the subject claim of the bearer token without
+// verifying the token.
+func jwtSubject(req *httpprot.Request, spec *JWTSpec) string {
+	header, claim := spec.Header, spec.Claim
+	if header == "" {
+		header = "Authorization"
+	}
+	if claim == "" {
+		claim = "sub"
+	}
+
+	token := req.HTTPHeader().Get(header)
+	const prefix = "Bearer "
+	if len(token) > len(prefix) && strings.EqualFold(token[:len(prefix)], prefix) {
+		token = token[len(prefix):]
+	}
+	if token == "" {
+		return ""
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, claims); err != nil {
+		return ""
+	}
+	sub, _ := claims[claim].(string)
+	return sub
+}
+
+// quota returns the daily quota of the consumer, 0 means no limit.
+func (cq *ConsumerQuota) quota(c *consumer.Consumer) int64 {
+	if c.RequestsPerDay > 0 {
+		return c.RequestsPerDay
+	}
+	if p := cq.plans[c.Plan]; p != nil {
+		return p.RequestsPerDay
+	}
+	return 0
+}
+
+// take counts a request of the consumer at now, it returns false if the
+// quota is exceeded.
+func (cq *ConsumerQuota) take(name string, quota int64, now time.Time) bool {
+	date := consumer.Date(now)
+
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	c := cq.counters[name]
+	if c == nil {
+		c = &counter{date: date}
+		cq.counters[name] = c
+	} else if c.date != date {
+		// the pending requests of yesterday are synced as today's, the
+		// error is negligible.
+		c.date, c.synced = date, 0
+	}
+
+	used := c.synced + c.pending
+	if quota > 0 && used >= quota {
+		return false
+	}
+	c.pending++
+	return true
+}
+
+// Handle resolves the consumer and enforces its quota.
+func (cq *ConsumerQuota) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if cq.spec.ConsumerHeader != "" {
+		// prevent the clients from forging the header.
+		req.HTTPHeader().Del(cq.spec.ConsumerHeader)
+	}
+
+	c := cq.resolve(req)
+	if c == nil {
+		atomic.AddInt64(&cq.numOfUnauthorized, 1)
+		cq.buildResponse(ctx, http.StatusUnauthorized, nil)
+		return resultUnauthorized
+	}
+
+	now := time.Now()
+	quota := cq.quota(c)
+	if !cq.take(c.Name, quota, now) {
+		atomic.AddInt64(&cq.numOfQuotaExceeded, 1)
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		header := http.Header{}
+		header.Set("X-Quota-Limit", strconv.FormatInt(quota, 10))
+		header.Set("X-Quota-Remaining", "0")
+		header.Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+		cq.buildResponse(ctx, http.StatusTooManyRequests, header)
+		ctx.AddTag(fmt.Sprintf("%s: quota of consumer %s exceeded", cq.Name(), c.Name))
+		return resultQuotaExceeded
+	}
+
+	if cq.spec.ConsumerHeader != "" {
+		req.HTTPHeader().Set(cq.spec.ConsumerHeader, c.Name)
+	}
+	ctx.AddTag(cq.Name() + ": consumer " + c.Name)
+	return ""
+}
+
+func (cq *ConsumerQuota) buildResponse(ctx *context.Context, code int, header http.Header) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+	for k, v := range header {
+		resp.HTTPHeader()[k] = v
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Status returns status.
+func (cq *ConsumerQuota) Status() interface{} {
+	return &Status{
+		NumOfConsumers:     cq.getIndex().Len(),
+		NumOfUnauthorized:  atomic.LoadInt64(&cq.numOfUnauthorized),
+		NumOfQuotaExceeded: atomic.LoadInt64(&cq.numOfQuotaExceeded),
+	}
+}
+
+// Close closes ConsumerQuota, the pending usage is synced before it
+// returns.
+func (cq *ConsumerQuota) Close() {
+	cq.cancel()
+	close(cq.done)
+	cq.wg.Wait()
+}
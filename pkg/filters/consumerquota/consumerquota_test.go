@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumerquota
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster/consumer"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type mockedUsageStore struct {
+	usage map[string]int64
+	err   error
+}
+
+func (s *mockedUsageStore) AddUsage(counts map[string]int64, now time.Time) (map[string]*consumer.Usage, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	result := map[string]*consumer.Usage{}
+	for name, n := range counts {
+		s.usage[name] += n
+		result[name] = &consumer.Usage{Name: name, Date: consumer.Date(now), Today: s.usage[name]}
+	}
+	return result, nil
+}
+
+func newTestConsumerQuota(assert *assert.Assertions, yamlConfig string, consumers ...*consumer.Consumer) *ConsumerQuota {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	cq := kind.CreateInstance(spec).(*ConsumerQuota)
+	cq.Init()
+	cq.index.Store(consumer.NewIndex(consumers))
+	return cq
+}
+
+func newTestContext(header http.Header, url string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{ClientCert: true, Plans: []*Plan{{Name: "free"}, {Name: "free"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{ClientCert: true, SyncInterval: "-1s"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{APIKey: &APIKeySpec{}, Plans: []*Plan{{Name: "free"}, {Name: "pro"}}}
+	assert.NoError(spec.Validate())
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	cq := newTestConsumerQuota(assert, `
+kind: ConsumerQuota
+name: cq
+apiKey:
+  query: key
+jwt: {}
+consumerHeader: X-Consumer
+`,
+		&consumer.Consumer{Name: "alice", APIKeys: []string{"alice-key"}},
+		&consumer.Consumer{Name: "bob", JWTSubjects: []string{"bob"}},
+	)
+	defer cq.Close()
+
+	ctx := newTestContext(http.Header{"X-Consumer": []string{"alice"}}, "http://127.0.0.1/")
+	assert.Equal(resultUnauthorized, cq.Handle(ctx))
+	assert.Equal(http.StatusUnauthorized, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newTestContext(nil, "http://127.0.0.1/?key=alice-key")
+	assert.Equal("", cq.Handle(ctx))
+	assert.Equal("alice", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Consumer"))
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "bob"}).SignedString([]byte("secret"))
+	assert.NoError(err)
+	ctx = newTestContext(http.Header{"Authorization": []string{"Bearer " + token}}, "http://127.0.0.1/")
+	assert.Equal("", cq.Handle(ctx))
+	assert.Equal("bob", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Consumer"))
+
+	ctx = newTestContext(http.Header{"Authorization": []string{"Bearer invalid"}}, "http://127.0.0.1/")
+	assert.Equal(resultUnauthorized, cq.Handle(ctx))
+
+	status := cq.Status().(*Status)
+	assert.Equal(2, status.NumOfConsumers)
+	assert.Equal(int64(2), status.NumOfUnauthorized)
+}
+
+func TestQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	cq := newTestConsumerQuota(assert, `
+kind: ConsumerQuota
+name: cq
+apiKey: {}
+plans:
+- name: free
+  requestsPerDay: 3
+`,
+		&consumer.Consumer{Name: "alice", Plan: "free", APIKeys: []string{"alice-key"}},
+		&consumer.Consumer{Name: "bob", Plan: "free", RequestsPerDay: 5, APIKeys: []string{"bob-key"}},
+		&consumer.Consumer{Name: "carol", APIKeys: []string{"carol-key"}},
+	)
+	defer cq.Close()
+
+	store := &mockedUsageStore{usage: map[string]int64{}}
+	cq.store = store
+
+	handle := func(key string) string {
+		return cq.Handle(newTestContext(http.Header{"X-Api-Key": []string{key}}, "http://127.0.0.1/"))
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal("", handle("alice-key"))
+	}
+	ctx := newTestContext(http.Header{"X-Api-Key": []string{"alice-key"}}, "http://127.0.0.1/")
+	assert.Equal(resultQuotaExceeded, cq.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.NotEmpty(resp.HTTPHeader().Get("Retry-After"))
+
+	for i := 0; i < 5; i++ {
+		assert.Equal("", handle("bob-key"))
+	}
+	assert.Equal(resultQuotaExceeded, handle("bob-key"))
+
+	// no limit without a plan.
+	for i := 0; i < 10; i++ {
+		assert.Equal("", handle("carol-key"))
+	}
+
+	// the usage is kept if the sync fails.
+	store.err = fmt.Errorf("mocked error")
+	cq.sync(time.Now())
+	assert.Equal(int64(3), cq.counters["alice"].pending)
+
+	store.err = nil
+	cq.sync(time.Now())
+	assert.Equal(int64(3), store.usage["alice"])
+	assert.Equal(int64(0), cq.counters["alice"].pending)
+	assert.Equal(int64(3), cq.counters["alice"].synced)
+
+	// the usage of other members counts.
+	store.usage["bob"] = 2
+	delete(cq.counters, "bob")
+	cq.sync(time.Now())
+	assert.Equal(int64(10), store.usage["carol"])
+	assert.True(cq.take("bob", 5, time.Now()))
+	cq.sync(time.Now())
+	assert.Equal(int64(3), cq.counters["bob"].synced)
+
+	// the counters are reset on the next day.
+	assert.True(cq.take("alice", 3, time.Now().Add(24*time.Hour)))
+	assert.Equal(int64(2), cq.Status().(*Status).NumOfQuotaExceeded)
+}
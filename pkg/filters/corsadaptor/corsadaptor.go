@@ -38,7 +38,7 @@ const (
 
 var kind = &filters.Kind{
 	Name:        Kind,
-	Description: "CORSAdaptor adapts CORS stuff.",
+	Description: "CORSAdaptor adapts CORS stuff, it is deprecated, please use CORSFilter instead.",
 	Results:     []string{resultPreflighted, resultRejected},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
@@ -156,6 +156,11 @@ func (a *CORSAdaptor) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// RequiresBody implements filters.BodyRequirer.
+func (a *CORSAdaptor) RequiresBody() (request, response bool) {
+	return false, false
+}
+
 // Status return status.
 func (a *CORSAdaptor) Status() interface{} {
 	return nil
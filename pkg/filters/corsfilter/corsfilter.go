@@ -0,0 +1,443 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package corsfilter implements the CORSFilter filter, which handles the
+// cross-origin resource sharing requests with policies that could be
+// different for each route.
+package corsfilter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of CORSFilter.
+	Kind = "CORSFilter"
+
+	resultPreflighted = "preflighted"
+	resultRejected    = "rejected"
+)
+
+const (
+	headerOrigin                = "Origin"
+	headerVary                  = "Vary"
+	headerRequestMethod         = "Access-Control-Request-Method"
+	headerRequestHeaders        = "Access-Control-Request-Headers"
+	headerRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	headerAllowOrigin           = "Access-Control-Allow-Origin"
+	headerAllowMethods          = "Access-Control-Allow-Methods"
+	headerAllowHeaders          = "Access-Control-Allow-Headers"
+	headerAllowCredentials      = "Access-Control-Allow-Credentials"
+	headerAllowPrivateNetwork   = "Access-Control-Allow-Private-Network"
+	headerExposeHeaders         = "Access-Control-Expose-Headers"
+	headerMaxAge                = "Access-Control-Max-Age"
+	wildcard                    = "*"
+)
+
+var (
+	defaultAllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	defaultAllowedHeaders = []string{"Origin", "Accept", "Content-Type", "X-Requested-With"}
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "CORSFilter handles the CORS requests with per-route policies.",
+	Results:     []string{resultPreflighted, resultRejected},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &CORSFilter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// CORSFilter is the filter for CORS requests.
+	CORSFilter struct {
+		spec   *Spec
+		policy *policy
+		routes []*route
+	}
+
+	// Spec describes the CORSFilter. The top level policy applies to the
+	// requests which don't match any of the routes.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+		Policy           `json:",inline"`
+
+		Routes []*RoutePolicy `json:"routes" jsonschema:"omitempty"`
+	}
+
+	// RoutePolicy is the CORS policy of the requests whose path matches.
+	RoutePolicy struct {
+		Path   *urlrule.StringMatch `json:"path" jsonschema:"required"`
+		Policy `json:",inline"`
+	}
+
+	// Policy is a CORS policy.
+	Policy struct {
+		// AllowedOrigins are the allowed origins, an origin could be "*"
+		// for all origins or contain wildcards, e.g. https://*.example.com.
+		AllowedOrigins       []string `json:"allowedOrigins" jsonschema:"omitempty"`
+		AllowedOriginRegexps []string `json:"allowedOriginRegexps" jsonschema:"omitempty"`
+		AllowedMethods       []string `json:"allowedMethods" jsonschema:"omitempty,uniqueItems=true"`
+		// AllowedHeaders are the allowed request headers, "*" allows all.
+		AllowedHeaders   []string `json:"allowedHeaders" jsonschema:"omitempty"`
+		ExposedHeaders   []string `json:"exposedHeaders" jsonschema:"omitempty"`
+		AllowCredentials bool     `json:"allowCredentials" jsonschema:"omitempty"`
+		// MaxAge is the seconds the result of a preflight request could be
+		// cached, 0 means not set and -1 disables caching.
+		MaxAge              int  `json:"maxAge" jsonschema:"omitempty,minimum=-1"`
+		AllowPrivateNetwork bool `json:"allowPrivateNetwork" jsonschema:"omitempty"`
+	}
+
+	route struct {
+		path   *urlrule.StringMatch
+		policy *policy
+	}
+
+	policy struct {
+		spec           *Policy
+		allOrigins     bool
+		origins        map[string]struct{}
+		originRegexps  []*regexp.Regexp
+		allMethods     bool
+		methods        map[string]struct{}
+		allowedMethods string
+		allHeaders     bool
+		headers        map[string]struct{}
+		exposedHeaders string
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if err := spec.Policy.validate(); err != nil {
+		return err
+	}
+	for i, r := range spec.Routes {
+		if err := r.Path.Validate(); err != nil {
+			return fmt.Errorf("route %d: %v", i, err)
+		}
+		if err := r.Policy.validate(); err != nil {
+			return fmt.Errorf("route %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) validate() error {
+	for _, o := range p.AllowedOriginRegexps {
+		if _, err := regexp.Compile(o); err != nil {
+			return fmt.Errorf("invalid origin regexp %q: %v", o, err)
+		}
+	}
+	for _, h := range p.ExposedHeaders {
+		if h == wildcard && p.AllowCredentials {
+			return fmt.Errorf("exposed header * is not allowed with credentials")
+		}
+	}
+	return nil
+}
+
+// wildcardToRegexp converts an origin with wildcards to a regexp, the
+// wildcards don't match slashes so the scheme can't be matched by them.
+func wildcardToRegexp(origin string) *regexp.Regexp {
+	parts := strings.Split(strings.ToLower(origin), wildcard)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, "[^/]+") + "$")
+}
+
+func newPolicy(spec *Policy) *policy {
+	p := &policy{
+		spec:    spec,
+		origins: map[string]struct{}{},
+		methods: map[string]struct{}{},
+		headers: map[string]struct{}{},
+	}
+
+	for _, o := range spec.AllowedOrigins {
+		switch {
+		case o == wildcard:
+			p.allOrigins = true
+		case strings.Contains(o, wildcard):
+			p.originRegexps = append(p.originRegexps, wildcardToRegexp(o))
+		default:
+			p.origins[strings.ToLower(o)] = struct{}{}
+		}
+	}
+	for _, o := range spec.AllowedOriginRegexps {
+		p.originRegexps = append(p.originRegexps, regexp.MustCompile(o))
+	}
+
+	methods := spec.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultAllowedMethods
+	}
+	allowed := make([]string, 0, len(methods))
+	for _, m := range methods {
+		if m == wildcard {
+			p.allMethods = true
+			continue
+		}
+		m = strings.ToUpper(m)
+		p.methods[m] = struct{}{}
+		allowed = append(allowed, m)
+	}
+	p.allowedMethods = strings.Join(allowed, ", ")
+
+	headers := spec.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultAllowedHeaders
+	}
+	for _, h := range headers {
+		if h == wildcard {
+			p.allHeaders = true
+			continue
+		}
+		p.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	p.exposedHeaders = strings.Join(spec.ExposedHeaders, ", ")
+	return p
+}
+
+func (p *policy) isOriginAllowed(origin string) bool {
+	if p.allOrigins {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if _, ok := p.origins[origin]; ok {
+		return true
+	}
+	for _, re := range p.originRegexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) isMethodAllowed(method string) bool {
+	if p.allMethods {
+		return true
+	}
+	method = strings.ToUpper(method)
+	// preflight requests are always allowed.
+	if method == http.MethodOptions {
+		return true
+	}
+	_, ok := p.methods[method]
+	return ok
+}
+
+func (p *policy) areHeadersAllowed(headers []string) bool {
+	if p.allHeaders {
+		return true
+	}
+	for _, h := range headers {
+		if _, ok := p.headers[http.CanonicalHeaderKey(h)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin sets the allowed origin and the credentials headers. The origin
+// is reflected if credentials are allowed, because browsers reject "*" for
+// credentialed requests.
+func (p *policy) setOrigin(h http.Header, origin string) {
+	if p.allOrigins && !p.spec.AllowCredentials {
+		h.Set(headerAllowOrigin, wildcard)
+	} else {
+		h.Set(headerAllowOrigin, origin)
+	}
+	if p.spec.AllowCredentials {
+		h.Set(headerAllowCredentials, "true")
+	}
+}
+
+// Name returns the name of the CORSFilter filter instance.
+func (f *CORSFilter) Name() string {
+	return f.spec.Name()
+}
+
+// Kind returns the kind of CORSFilter.
+func (f *CORSFilter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the CORSFilter.
+func (f *CORSFilter) Spec() filters.Spec {
+	return f.spec
+}
+
+// Init initializes CORSFilter.
+func (f *CORSFilter) Init() {
+	f.reload()
+}
+
+// Inherit inherits previous generation of CORSFilter.
+func (f *CORSFilter) Inherit(previousGeneration filters.Filter) {
+	f.Init()
+}
+
+func (f *CORSFilter) reload() {
+	f.policy = newPolicy(&f.spec.Policy)
+	for _, r := range f.spec.Routes {
+		r.Path.Init()
+		f.routes = append(f.routes, &route{path: r.Path, policy: newPolicy(&r.Policy)})
+	}
+}
+
+func (f *CORSFilter) selectPolicy(path string) *policy {
+	for _, r := range f.routes {
+		if r.path.Match(path) {
+			return r.policy
+		}
+	}
+	return f.policy
+}
+
+func splitHeaderList(value string) []string {
+	var result []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Handle handles the CORS request.
+func (f *CORSFilter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	origin := req.HTTPHeader().Get(headerOrigin)
+	if origin == "" {
+		return ""
+	}
+
+	var resp *httpprot.Response
+	if r := ctx.GetOutputResponse(); r != nil {
+		resp = r.(*httpprot.Response)
+	} else {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	p := f.selectPolicy(req.Path())
+	if req.Method() == http.MethodOptions && req.HTTPHeader().Get(headerRequestMethod) != "" {
+		return f.handlePreflight(ctx, p, req, resp, origin)
+	}
+	return f.handleActual(ctx, p, req, resp, origin)
+}
+
+func (f *CORSFilter) reject(ctx *context.Context, resp *httpprot.Response) string {
+	resp.SetStatusCode(http.StatusForbidden)
+	ctx.SetOutputResponse(resp)
+	return resultRejected
+}
+
+func (f *CORSFilter) handlePreflight(ctx *context.Context, p *policy, req *httpprot.Request, resp *httpprot.Response, origin string) string {
+	h := resp.HTTPHeader()
+	h.Add(headerVary, headerOrigin)
+	h.Add(headerVary, headerRequestMethod)
+	h.Add(headerVary, headerRequestHeaders)
+
+	reqHeader := req.HTTPHeader()
+	if !p.isOriginAllowed(origin) {
+		return f.reject(ctx, resp)
+	}
+
+	method := reqHeader.Get(headerRequestMethod)
+	if !p.isMethodAllowed(method) {
+		return f.reject(ctx, resp)
+	}
+
+	headers := splitHeaderList(reqHeader.Get(headerRequestHeaders))
+	if !p.areHeadersAllowed(headers) {
+		return f.reject(ctx, resp)
+	}
+
+	if reqHeader.Get(headerRequestPrivateNetwork) == "true" {
+		h.Add(headerVary, headerRequestPrivateNetwork)
+		if !p.spec.AllowPrivateNetwork {
+			return f.reject(ctx, resp)
+		}
+		h.Set(headerAllowPrivateNetwork, "true")
+	}
+
+	p.setOrigin(h, origin)
+	if p.allMethods {
+		h.Set(headerAllowMethods, strings.ToUpper(method))
+	} else {
+		h.Set(headerAllowMethods, p.allowedMethods)
+	}
+	if len(headers) > 0 {
+		h.Set(headerAllowHeaders, strings.Join(headers, ", "))
+	}
+	if p.spec.MaxAge > 0 {
+		h.Set(headerMaxAge, strconv.Itoa(p.spec.MaxAge))
+	} else if p.spec.MaxAge < 0 {
+		h.Set(headerMaxAge, "0")
+	}
+
+	resp.SetStatusCode(http.StatusNoContent)
+	ctx.SetOutputResponse(resp)
+	return resultPreflighted
+}
+
+func (f *CORSFilter) handleActual(ctx *context.Context, p *policy, req *httpprot.Request, resp *httpprot.Response, origin string) string {
+	h := resp.HTTPHeader()
+	h.Add(headerVary, headerOrigin)
+
+	if !p.isOriginAllowed(origin) || !p.isMethodAllowed(req.Method()) {
+		return f.reject(ctx, resp)
+	}
+
+	p.setOrigin(h, origin)
+	if p.exposedHeaders != "" {
+		h.Set(headerExposeHeaders, p.exposedHeaders)
+	}
+
+	// the headers are merged into the response of the backend.
+	ctx.SetOutputResponse(resp)
+	return ""
+}
+
+// Status returns status.
+func (f *CORSFilter) Status() interface{} {
+	return nil
+}
+
+// Close closes CORSFilter.
+func (f *CORSFilter) Close() {
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package corsfilter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestCORSFilter(assert *assert.Assertions, yamlConfig string) *CORSFilter {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	f := kind.CreateInstance(spec).(*CORSFilter)
+	f.Init()
+	return f
+}
+
+func newTestContext(method, url string, header map[string]string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(method, url, nil)
+	for k, v := range header {
+		stdr.Header.Set(k, v)
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func outputHeader(ctx *context.Context) http.Header {
+	return ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{Policy: Policy{AllowedOriginRegexps: []string{"("}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Policy: Policy{AllowCredentials: true, ExposedHeaders: []string{"*"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Routes: []*RoutePolicy{{Path: &urlrule.StringMatch{}}}}
+	assert.Error(spec.Validate())
+}
+
+func TestPreflight(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newTestCORSFilter(assert, `
+kind: CORSFilter
+name: cors
+allowedOrigins: ["https://*.example.com", "http://localhost:8080"]
+allowedMethods: [GET, put]
+allowedHeaders: [X-Custom]
+maxAge: 600
+allowPrivateNetwork: true
+`)
+	defer f.Close()
+
+	ctx := newTestContext(http.MethodOptions, "http://127.0.0.1/api", map[string]string{
+		"Origin":                                 "https://app.example.com",
+		"Access-Control-Request-Method":          "PUT",
+		"Access-Control-Request-Headers":         "x-custom",
+		"Access-Control-Request-Private-Network": "true",
+	})
+	assert.Equal(resultPreflighted, f.Handle(ctx))
+	assert.Equal(http.StatusNoContent, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+	h := outputHeader(ctx)
+	assert.Equal("https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal("GET, PUT", h.Get("Access-Control-Allow-Methods"))
+	assert.Equal("x-custom", h.Get("Access-Control-Allow-Headers"))
+	assert.Equal("600", h.Get("Access-Control-Max-Age"))
+	assert.Equal("true", h.Get("Access-Control-Allow-Private-Network"))
+	assert.Contains(h.Values("Vary"), "Origin")
+
+	for _, header := range []map[string]string{
+		// the wildcard doesn't match the scheme.
+		{"Origin": "http://app.example.com", "Access-Control-Request-Method": "PUT"},
+		{"Origin": "https://example.com", "Access-Control-Request-Method": "PUT"},
+		{"Origin": "http://localhost:8080", "Access-Control-Request-Method": "DELETE"},
+		{"Origin": "http://localhost:8080", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Other"},
+	} {
+		ctx = newTestContext(http.MethodOptions, "http://127.0.0.1/api", header)
+		assert.Equal(resultRejected, f.Handle(ctx), "%v", header)
+		assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+		assert.Empty(outputHeader(ctx).Get("Access-Control-Allow-Origin"))
+	}
+
+	// OPTIONS without Access-Control-Request-Method is not a preflight.
+	ctx = newTestContext(http.MethodOptions, "http://127.0.0.1/api", map[string]string{"Origin": "http://localhost:8080"})
+	assert.Equal("", f.Handle(ctx))
+}
+
+func TestActualRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newTestCORSFilter(assert, `
+kind: CORSFilter
+name: cors
+allowedOrigins: ["*"]
+exposedHeaders: [X-Request-Id]
+`)
+	defer f.Close()
+
+	// requests without origin are passed through.
+	ctx := newTestContext(http.MethodGet, "http://127.0.0.1/", nil)
+	assert.Equal("", f.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/", map[string]string{"Origin": "https://a.com"})
+	assert.Equal("", f.Handle(ctx))
+	h := outputHeader(ctx)
+	assert.Equal("*", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal("X-Request-Id", h.Get("Access-Control-Expose-Headers"))
+	assert.Empty(h.Get("Access-Control-Allow-Credentials"))
+
+	ctx = newTestContext(http.MethodDelete, "http://127.0.0.1/", map[string]string{"Origin": "https://a.com"})
+	assert.Equal(resultRejected, f.Handle(ctx))
+}
+
+func TestRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newTestCORSFilter(assert, `
+kind: CORSFilter
+name: cors
+allowedOrigins: ["https://www.example.com"]
+routes:
+- path:
+    prefix: /public/
+  allowedOrigins: ["*"]
+  allowCredentials: true
+- path:
+    regex: ^/admin
+  allowedOriginRegexps: ["^https://admin[0-9]+\\.example\\.com$"]
+`)
+	defer f.Close()
+
+	ctx := newTestContext(http.MethodGet, "http://127.0.0.1/public/a", map[string]string{"Origin": "https://a.com"})
+	assert.Equal("", f.Handle(ctx))
+	h := outputHeader(ctx)
+	// the origin is reflected for credentialed requests.
+	assert.Equal("https://a.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal("true", h.Get("Access-Control-Allow-Credentials"))
+
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/admin/a", map[string]string{"Origin": "https://admin1.example.com"})
+	assert.Equal("", f.Handle(ctx))
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/admin/a", map[string]string{"Origin": "https://www.example.com"})
+	assert.Equal(resultRejected, f.Handle(ctx))
+
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/other", map[string]string{"Origin": "https://WWW.example.com"})
+	assert.Equal("", f.Handle(ctx))
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/other", map[string]string{"Origin": "https://a.com"})
+	assert.Equal(resultRejected, f.Handle(ctx))
+
+	// private network access is not allowed by default.
+	ctx = newTestContext(http.MethodOptions, "http://127.0.0.1/other", map[string]string{
+		"Origin":                                 "https://www.example.com",
+		"Access-Control-Request-Method":          "GET",
+		"Access-Control-Request-Private-Network": "true",
+	})
+	assert.Equal(resultRejected, f.Handle(ctx))
+}
@@ -0,0 +1,400 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package csrf implements the CSRF filter, which protects the applications
+// whose sessions terminate at Easegress from cross-site request forgery.
+package csrf
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of CSRF.
+	Kind = "CSRF"
+
+	resultInvalidToken = "invalidToken"
+
+	modeDoubleSubmitCookie = "doubleSubmitCookie"
+	modeSynchronizerToken  = "synchronizerToken"
+
+	defaultCookieName = "csrf_token"
+	defaultHeaderName = "X-CSRF-Token"
+	defaultFormField  = "csrf_token"
+)
+
+var defaultSafeMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "CSRF protects the requests from cross-site request forgery",
+	Results:     []string{resultInvalidToken},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &CSRF{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*CSRF)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// CSRF is the filter CSRF.
+	CSRF struct {
+		spec *Spec
+
+		codec        *tokenCodec
+		safeMethods  map[string]struct{}
+		cookieMaxAge int
+		sameSite     http.SameSite
+		numRejected  uint64
+	}
+
+	// Spec describes the CSRF.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Mode string `json:"mode" jsonschema:"omitempty,enum=,enum=doubleSubmitCookie,enum=synchronizerToken"`
+		// Secret signs the tokens, it is required by the synchronizer
+		// token pattern.
+		Secret string `json:"secret" jsonschema:"omitempty"`
+		// SessionCookie is the name of the session cookie, the tokens
+		// are bound to its value.
+		SessionCookie string                 `json:"sessionCookie" jsonschema:"omitempty"`
+		TokenTTL      string                 `json:"tokenTTL" jsonschema:"omitempty,format=duration"`
+		RotateToken   bool                   `json:"rotateToken" jsonschema:"omitempty"`
+		HeaderName    string                 `json:"headerName" jsonschema:"omitempty"`
+		FormField     string                 `json:"formField" jsonschema:"omitempty"`
+		SafeMethods   []string               `json:"safeMethods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		ExemptPaths   []*urlrule.StringMatch `json:"exemptPaths" jsonschema:"omitempty"`
+		Cookie        *CookieSpec            `json:"cookie" jsonschema:"omitempty"`
+	}
+
+	// CookieSpec is the spec of the token cookie of the double submit
+	// cookie pattern.
+	CookieSpec struct {
+		Name     string `json:"name" jsonschema:"omitempty"`
+		Path     string `json:"path" jsonschema:"omitempty"`
+		Domain   string `json:"domain" jsonschema:"omitempty"`
+		MaxAge   string `json:"maxAge" jsonschema:"omitempty,format=duration"`
+		Secure   bool   `json:"secure" jsonschema:"omitempty"`
+		SameSite string `json:"sameSite" jsonschema:"omitempty,enum=,enum=Strict,enum=Lax,enum=None"`
+	}
+
+	// Status is the status of CSRF.
+	Status struct {
+		NumOfRejected uint64 `json:"numOfRejected"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if s.Secret != "" && len(s.Secret) < 16 {
+		return fmt.Errorf("secret must be at least 16 characters")
+	}
+
+	if s.mode() == modeSynchronizerToken {
+		if s.Secret == "" || s.SessionCookie == "" {
+			return fmt.Errorf("secret and sessionCookie are required by the synchronizer token pattern")
+		}
+	} else if s.SessionCookie != "" && s.Secret == "" {
+		return fmt.Errorf("secret is required to bind the tokens to the session")
+	}
+
+	if s.TokenTTL != "" {
+		if s.Secret == "" {
+			return fmt.Errorf("secret is required by tokenTTL")
+		}
+		if d, err := time.ParseDuration(s.TokenTTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid token TTL %s", s.TokenTTL)
+		}
+	}
+
+	for i, p := range s.ExemptPaths {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("exempt path %d: %v", i, err)
+		}
+	}
+
+	if c := s.Cookie; c != nil {
+		if c.MaxAge != "" {
+			if _, err := time.ParseDuration(c.MaxAge); err != nil {
+				return fmt.Errorf("invalid cookie max age %s: %v", c.MaxAge, err)
+			}
+		}
+		if c.SameSite == "None" && !c.Secure {
+			return fmt.Errorf("cookies with SameSite=None must be secure")
+		}
+	}
+	return nil
+}
+
+func (s *Spec) mode() string {
+	if s.Mode == "" {
+		return modeDoubleSubmitCookie
+	}
+	return s.Mode
+}
+
+// Name returns the name of the CSRF filter instance.
+func (c *CSRF) Name() string {
+	return c.spec.Name()
+}
+
+// Kind returns the kind of CSRF.
+func (c *CSRF) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the CSRF
+func (c *CSRF) Spec() filters.Spec {
+	return c.spec
+}
+
+// Init initializes CSRF.
+func (c *CSRF) Init() {
+	c.reload()
+}
+
+// Inherit inherits previous generation of CSRF.
+func (c *CSRF) Inherit(previousGeneration filters.Filter) {
+	c.reload()
+}
+
+func (c *CSRF) reload() {
+	c.codec = &tokenCodec{secret: []byte(c.spec.Secret)}
+	if c.spec.TokenTTL != "" {
+		c.codec.ttl, _ = time.ParseDuration(c.spec.TokenTTL)
+	}
+
+	methods := c.spec.SafeMethods
+	if len(methods) == 0 {
+		methods = defaultSafeMethods
+	}
+	c.safeMethods = map[string]struct{}{}
+	for _, m := range methods {
+		c.safeMethods[strings.ToUpper(m)] = struct{}{}
+	}
+
+	for _, p := range c.spec.ExemptPaths {
+		p.Init()
+	}
+
+	c.sameSite = http.SameSiteLaxMode
+	if cs := c.spec.Cookie; cs != nil {
+		if cs.MaxAge != "" {
+			d, _ := time.ParseDuration(cs.MaxAge)
+			c.cookieMaxAge = int(d.Seconds())
+		}
+		switch cs.SameSite {
+		case "Strict":
+			c.sameSite = http.SameSiteStrictMode
+		case "None":
+			c.sameSite = http.SameSiteNoneMode
+		}
+	}
+}
+
+// Status returns status.
+func (c *CSRF) Status() interface{} {
+	return &Status{NumOfRejected: atomic.LoadUint64(&c.numRejected)}
+}
+
+// Close closes CSRF.
+func (c *CSRF) Close() {
+}
+
+func (c *CSRF) cookieName() string {
+	if c.spec.Cookie != nil && c.spec.Cookie.Name != "" {
+		return c.spec.Cookie.Name
+	}
+	return defaultCookieName
+}
+
+func (c *CSRF) headerName() string {
+	if c.spec.HeaderName != "" {
+		return c.spec.HeaderName
+	}
+	return defaultHeaderName
+}
+
+func (c *CSRF) formField() string {
+	if c.spec.FormField != "" {
+		return c.spec.FormField
+	}
+	return defaultFormField
+}
+
+// newCookie creates the token cookie, it is readable by scripts, which
+// need to submit its value in the header.
+func (c *CSRF) newCookie(token string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    token,
+		Path:     "/",
+		MaxAge:   c.cookieMaxAge,
+		SameSite: c.sameSite,
+	}
+	if cs := c.spec.Cookie; cs != nil {
+		if cs.Path != "" {
+			cookie.Path = cs.Path
+		}
+		cookie.Domain = cs.Domain
+		cookie.Secure = cs.Secure
+	}
+	return cookie
+}
+
+func (c *CSRF) isExempt(path string) bool {
+	for _, p := range c.spec.ExemptPaths {
+		if p.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func cookieValue(req *httpprot.Request, name string) string {
+	if cookie, err := req.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// submittedToken returns the token in the header, or in the form field of
+// an url encoded form.
+func (c *CSRF) submittedToken(req *httpprot.Request) string {
+	if token := req.HTTPHeader().Get(c.headerName()); token != "" {
+		return token
+	}
+
+	ct := req.HTTPHeader().Get("Content-Type")
+	if req.IsStream() || !strings.HasPrefix(ct, "application/x-www-form-urlencoded") {
+		return ""
+	}
+	form, err := url.ParseQuery(string(req.RawPayload()))
+	if err != nil {
+		return ""
+	}
+	return form.Get(c.formField())
+}
+
+func (c *CSRF) check(req *httpprot.Request, session string, now time.Time) error {
+	token := c.submittedToken(req)
+	if token == "" {
+		return fmt.Errorf("missing token")
+	}
+
+	if c.spec.mode() == modeSynchronizerToken {
+		if session == "" {
+			return fmt.Errorf("missing session")
+		}
+	} else {
+		cookie := cookieValue(req, c.cookieName())
+		if cookie == "" {
+			return fmt.Errorf("missing token cookie")
+		}
+		if !tokenEqual(cookie, token) {
+			return fmt.Errorf("token mismatch")
+		}
+	}
+
+	return c.codec.verify(token, session, now)
+}
+
+// issue issues a new token to the response. For the double submit cookie
+// pattern, the token cookie is only set if the request doesn't have a
+// valid one, unless force is true. For the synchronizer token pattern, the
+// token is only issued to the requests with a session. The token is also
+// set to the response header, so that the clients could get it without
+// reading the cookie.
+func (c *CSRF) issue(ctx *context.Context, req *httpprot.Request, session string, now time.Time, force bool) {
+	var cookie *http.Cookie
+	if c.spec.mode() == modeSynchronizerToken {
+		if session == "" {
+			return
+		}
+	} else {
+		old := cookieValue(req, c.cookieName())
+		if !force && old != "" && c.codec.verify(old, session, now) == nil {
+			return
+		}
+		cookie = c.newCookie(c.codec.generate(session, now))
+	}
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	if cookie != nil {
+		resp.HTTPHeader().Add("Set-Cookie", cookie.String())
+		resp.HTTPHeader().Set(c.headerName(), cookie.Value)
+	} else {
+		resp.HTTPHeader().Set(c.headerName(), c.codec.generate(session, now))
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Handle checks the token of the request.
+func (c *CSRF) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if c.isExempt(req.Path()) {
+		return ""
+	}
+
+	now := time.Now()
+	session := ""
+	if c.spec.SessionCookie != "" {
+		session = cookieValue(req, c.spec.SessionCookie)
+	}
+
+	if _, ok := c.safeMethods[req.Method()]; ok {
+		c.issue(ctx, req, session, now, false)
+		return ""
+	}
+
+	if err := c.check(req, session, now); err != nil {
+		atomic.AddUint64(&c.numRejected, 1)
+		ctx.AddTag(stringtool.Cat("csrf: ", err.Error()))
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusForbidden)
+		ctx.SetOutputResponse(resp)
+		return resultInvalidToken
+	}
+
+	if c.spec.RotateToken {
+		c.issue(ctx, req, session, now, true)
+	}
+	return ""
+}
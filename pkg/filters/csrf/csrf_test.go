@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package csrf
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestCSRF(assert *assert.Assertions, yamlConfig string) *CSRF {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	c := kind.CreateInstance(spec).(*CSRF)
+	c.Init()
+	return c
+}
+
+func newTestContext(method, url string, header http.Header, body string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func responseCookie(ctx *context.Context, name string) *http.Cookie {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return nil
+	}
+	for _, c := range resp.Std().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{Mode: modeSynchronizerToken, Secret: "0123456789abcdef"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{SessionCookie: "session"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{TokenTTL: "1h"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Cookie: &CookieSpec{SameSite: "None"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Mode: modeSynchronizerToken, Secret: "0123456789abcdef", SessionCookie: "session", TokenTTL: "1h"}
+	assert.NoError(spec.Validate())
+}
+
+func TestDoubleSubmitCookie(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestCSRF(assert, `
+kind: CSRF
+name: csrf
+cookie:
+  name: XSRF-TOKEN
+  domain: example.com
+  secure: true
+  sameSite: Strict
+exemptPaths:
+- prefix: /webhooks/
+`)
+	defer c.Close()
+
+	ctx := newTestContext(http.MethodGet, "http://127.0.0.1/", nil, "")
+	assert.Equal("", c.Handle(ctx))
+	cookie := responseCookie(ctx, "XSRF-TOKEN")
+	assert.NotNil(cookie)
+	assert.True(cookie.Secure)
+	assert.False(cookie.HttpOnly)
+	assert.Equal(http.SameSiteStrictMode, cookie.SameSite)
+	assert.Equal("example.com", cookie.Domain)
+	token := cookie.Value
+
+	// the cookie is not issued again if the request has one.
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/", http.Header{"Cookie": {"XSRF-TOKEN=" + token}}, "")
+	assert.Equal("", c.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	ctx = newTestContext(http.MethodPost, "http://127.0.0.1/", http.Header{
+		"Cookie":       {"XSRF-TOKEN=" + token},
+		"X-Csrf-Token": {token},
+	}, "")
+	assert.Equal("", c.Handle(ctx))
+
+	ctx = newTestContext(http.MethodPost, "http://127.0.0.1/", http.Header{
+		"Cookie":       {"XSRF-TOKEN=" + token},
+		"Content-Type": {"application/x-www-form-urlencoded"},
+	}, "a=1&csrf_token="+token)
+	assert.Equal("", c.Handle(ctx))
+
+	for _, header := range []http.Header{
+		{"Cookie": {"XSRF-TOKEN=" + token}},
+		{"X-Csrf-Token": {token}},
+		{"Cookie": {"XSRF-TOKEN=" + token}, "X-Csrf-Token": {"other"}},
+	} {
+		ctx = newTestContext(http.MethodDelete, "http://127.0.0.1/", header, "")
+		assert.Equal(resultInvalidToken, c.Handle(ctx))
+		assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+	}
+	assert.Equal(uint64(3), c.Status().(*Status).NumOfRejected)
+
+	ctx = newTestContext(http.MethodPost, "http://127.0.0.1/webhooks/github", nil, "")
+	assert.Equal("", c.Handle(ctx))
+}
+
+func TestSignedDoubleSubmitCookie(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestCSRF(assert, `
+kind: CSRF
+name: csrf
+secret: 0123456789abcdef
+sessionCookie: session
+rotateToken: true
+`)
+	defer c.Close()
+
+	ctx := newTestContext(http.MethodGet, "http://127.0.0.1/", http.Header{"Cookie": {"session=s1"}}, "")
+	assert.Equal("", c.Handle(ctx))
+	token := responseCookie(ctx, defaultCookieName).Value
+	assert.Equal(token, ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-CSRF-Token"))
+
+	// a forged cookie is not accepted.
+	ctx = newTestContext(http.MethodPost, "http://127.0.0.1/", http.Header{
+		"Cookie":       {"session=s1; csrf_token=forged"},
+		"X-Csrf-Token": {"forged"},
+	}, "")
+	assert.Equal(resultInvalidToken, c.Handle(ctx))
+
+	// the token is bound to the session.
+	ctx = newTestContext(http.MethodPost, "http://127.0.0.1/", http.Header{
+		"Cookie":       {"session=s2; csrf_token=" + token},
+		"X-Csrf-Token": {token},
+	}, "")
+	assert.Equal(resultInvalidToken, c.Handle(ctx))
+
+	// a new token is issued after the token is used.
+	ctx = newTestContext(http.MethodPost, "http://127.0.0.1/", http.Header{
+		"Cookie":       {"session=s1; csrf_token=" + token},
+		"X-Csrf-Token": {token},
+	}, "")
+	assert.Equal("", c.Handle(ctx))
+	rotated := responseCookie(ctx, defaultCookieName)
+	assert.NotNil(rotated)
+	assert.NotEqual(token, rotated.Value)
+}
+
+func TestSynchronizerToken(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newTestCSRF(assert, `
+kind: CSRF
+name: csrf
+mode: synchronizerToken
+secret: 0123456789abcdef
+sessionCookie: session
+tokenTTL: 1h
+headerName: X-Token
+`)
+	defer c.Close()
+
+	// no token without a session.
+	ctx := newTestContext(http.MethodGet, "http://127.0.0.1/", nil, "")
+	assert.Equal("", c.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/", http.Header{"Cookie": {"session=s1"}}, "")
+	assert.Equal("", c.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	token := resp.HTTPHeader().Get("X-Token")
+	assert.NotEmpty(token)
+	assert.Empty(resp.HTTPHeader().Get("Set-Cookie"))
+
+	ctx = newTestContext(http.MethodPut, "http://127.0.0.1/", http.Header{
+		"Cookie":  {"session=s1"},
+		"X-Token": {token},
+	}, "")
+	assert.Equal("", c.Handle(ctx))
+
+	ctx = newTestContext(http.MethodPut, "http://127.0.0.1/", http.Header{"X-Token": {token}}, "")
+	assert.Equal(resultInvalidToken, c.Handle(ctx))
+
+	ctx = newTestContext(http.MethodPut, "http://127.0.0.1/", http.Header{
+		"Cookie":  {"session=s2"},
+		"X-Token": {token},
+	}, "")
+	assert.Equal(resultInvalidToken, c.Handle(ctx))
+
+	// expired tokens are rejected.
+	old := c.codec.generate("s1", time.Now().Add(-2*time.Hour))
+	assert.Error(c.codec.verify(old, "s1", time.Now()))
+	assert.NoError(c.codec.verify(old, "s1", time.Now().Add(-90*time.Minute)))
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	nonceSize = 16
+	macSize   = sha256.Size
+)
+
+// tokenCodec generates and verifies the tokens. If there's a secret, a
+// token is the nonce, the issue time and the HMAC of them and the session,
+// so that it can't be forged and is bound to the session. Otherwise, a
+// token is only a random string.
+type tokenCodec struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func (tc *tokenCodec) mac(session string, data []byte) []byte {
+	h := hmac.New(sha256.New, tc.secret)
+	h.Write(data)
+	h.Write([]byte(session))
+	return h.Sum(nil)
+}
+
+// generate generates a token for the session at now.
+func (tc *tokenCodec) generate(session string, now time.Time) string {
+	if len(tc.secret) == 0 {
+		return base64.RawURLEncoding.EncodeToString(randomBytes(nonceSize * 2))
+	}
+
+	data := make([]byte, nonceSize+8, nonceSize+8+macSize)
+	copy(data, randomBytes(nonceSize))
+	binary.BigEndian.PutUint64(data[nonceSize:], uint64(now.Unix()))
+	data = append(data, tc.mac(session, data)...)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// verify verifies the signature and the expiry of a token of the session,
+// tokens are always valid if there's no secret.
+func (tc *tokenCodec) verify(token, session string, now time.Time) error {
+	if len(tc.secret) == 0 {
+		return nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != nonceSize+8+macSize {
+		return fmt.Errorf("malformed token")
+	}
+
+	payload, sig := data[:nonceSize+8], data[nonceSize+8:]
+	if !hmac.Equal(sig, tc.mac(session, payload)) {
+		return fmt.Errorf("invalid token signature")
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(payload[nonceSize:])), 0)
+	if tc.ttl > 0 && now.Sub(issued) > tc.ttl {
+		return fmt.Errorf("token expired")
+	}
+	return nil
+}
+
+// tokenEqual compares two tokens in constant time.
+func tokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
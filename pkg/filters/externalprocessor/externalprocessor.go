@@ -0,0 +1,328 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package externalprocessor provides the ExternalProcessor filter.
+package externalprocessor
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/extproc"
+)
+
+const (
+	// Kind is the kind of ExternalProcessor.
+	Kind = "ExternalProcessor"
+
+	resultResponded = "responded"
+	resultFailed    = "processFailed"
+
+	modeSkip    = "skip"
+	modeHeaders = "headers"
+	modeBody    = "body"
+
+	defaultTimeout = 200 * time.Millisecond
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ExternalProcessor processes requests and responses by out-of-process plugins over gRPC",
+	Results:     []string{resultResponded, resultFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Timeout:           "200ms",
+			RequestMode:       modeHeaders,
+			ResponseMode:      modeSkip,
+			FailureStatusCode: http.StatusServiceUnavailable,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ExternalProcessor{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*ExternalProcessor)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ExternalProcessor is the filter ExternalProcessor.
+	ExternalProcessor struct {
+		spec    *Spec
+		client  *extproc.Client
+		timeout time.Duration
+	}
+
+	// Spec describes the ExternalProcessor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		URL     string `json:"url" jsonschema:"required,format=url"`
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// RequestMode and ResponseMode are what to send to the plugin,
+		// skip sends nothing, headers sends the headers, and body sends
+		// both the headers and the body. The default RequestMode is
+		// headers, and the default ResponseMode is skip.
+		RequestMode  string `json:"requestMode" jsonschema:"omitempty,enum=,enum=skip,enum=headers,enum=body"`
+		ResponseMode string `json:"responseMode" jsonschema:"omitempty,enum=,enum=skip,enum=headers,enum=body"`
+		FailOpen     bool   `json:"failOpen" jsonschema:"omitempty"`
+		// FailureStatusCode is the status code of the response if the
+		// processing failed and FailOpen is false, default is 503.
+		FailureStatusCode int `json:"failureStatusCode" jsonschema:"omitempty,minimum=100,maximum=599"`
+		// Attributes are sent to the plugin with each request, e.g. to tell
+		// the routes from each other.
+		Attributes map[string]string `json:"attributes,omitempty" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if _, err := dialTarget(s.URL); err != nil {
+		return err
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", s.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// dialTarget returns the address to dial and whether to use TLS.
+func dialTarget(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %v", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %s: scheme must be http or https", rawURL)
+	}
+	return u, nil
+}
+
+// Name returns the name of the ExternalProcessor filter instance.
+func (p *ExternalProcessor) Name() string {
+	return p.spec.Name()
+}
+
+// Kind returns the kind of ExternalProcessor.
+func (p *ExternalProcessor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ExternalProcessor
+func (p *ExternalProcessor) Spec() filters.Spec {
+	return p.spec
+}
+
+// Init initializes ExternalProcessor.
+func (p *ExternalProcessor) Init() {
+	p.reload()
+}
+
+// Inherit inherits previous generation of ExternalProcessor.
+func (p *ExternalProcessor) Inherit(previousGeneration filters.Filter) {
+	p.reload()
+}
+
+func (p *ExternalProcessor) reload() {
+	p.timeout = defaultTimeout
+	if p.spec.Timeout != "" {
+		p.timeout, _ = time.ParseDuration(p.spec.Timeout)
+	}
+
+	u, _ := dialTarget(p.spec.URL)
+	client, err := extproc.Dial(u.Host, u.Scheme == "https")
+	if err != nil {
+		logger.Errorf("%s: dial %s failed: %v", p.Name(), p.spec.URL, err)
+		return
+	}
+	p.client = client
+}
+
+// Status returns status.
+func (p *ExternalProcessor) Status() interface{} {
+	return nil
+}
+
+// Close closes ExternalProcessor.
+func (p *ExternalProcessor) Close() {
+	if p.client != nil {
+		p.client.Close()
+	}
+}
+
+// Handle processes the response if the context has one, e.g. the filter is
+// after a Proxy, and the request otherwise.
+func (p *ExternalProcessor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if resp, _ := ctx.GetOutputResponse().(*httpprot.Response); resp != nil {
+		return p.handleResponse(ctx, req, resp)
+	}
+	return p.handleRequest(ctx, req)
+}
+
+func (p *ExternalProcessor) handleRequest(ctx *context.Context, req *httpprot.Request) string {
+	mode := p.spec.RequestMode
+	if mode == modeSkip {
+		return ""
+	}
+
+	pr := p.newProcessingRequest(req, extproc.PhaseRequest, req.HTTPHeader())
+	// the stream bodies are not buffered, only their headers are sent.
+	if mode == modeBody && !req.IsStream() {
+		pr.Body, pr.HasBody = req.RawPayload(), true
+	}
+
+	result, err := p.process(req, pr)
+	if err != nil {
+		return p.handleFailure(ctx, err)
+	}
+	if result.ImmediateResponse != nil {
+		respond(ctx, result.ImmediateResponse)
+		return resultResponded
+	}
+
+	applyHeaders(req.HTTPHeader(), result)
+	if result.ReplaceBody {
+		req.SetPayload(result.Body)
+		req.HTTPHeader().Set("Content-Length", strconv.Itoa(len(result.Body)))
+	}
+	return ""
+}
+
+func (p *ExternalProcessor) handleResponse(ctx *context.Context, req *httpprot.Request, resp *httpprot.Response) string {
+	mode := p.spec.ResponseMode
+	if mode == "" || mode == modeSkip {
+		return ""
+	}
+
+	pr := p.newProcessingRequest(req, extproc.PhaseResponse, resp.HTTPHeader())
+	pr.StatusCode = int32(resp.StatusCode())
+	if mode == modeBody && !resp.IsStream() {
+		pr.Body, pr.HasBody = resp.RawPayload(), true
+	}
+
+	result, err := p.process(req, pr)
+	if err != nil {
+		return p.handleFailure(ctx, err)
+	}
+	if result.ImmediateResponse != nil {
+		respond(ctx, result.ImmediateResponse)
+		return resultResponded
+	}
+
+	applyHeaders(resp.HTTPHeader(), result)
+	if result.ReplaceBody {
+		resp.SetPayload(result.Body)
+		resp.HTTPHeader().Set("Content-Length", strconv.Itoa(len(result.Body)))
+	}
+	return ""
+}
+
+func (p *ExternalProcessor) newProcessingRequest(req *httpprot.Request, phase string, h http.Header) *extproc.ProcessingRequest {
+	pr := &extproc.ProcessingRequest{
+		Phase:      phase,
+		Method:     req.Method(),
+		URL:        req.Std().URL.RequestURI(),
+		Host:       req.Host(),
+		Attributes: map[string]string{},
+	}
+	for name, values := range h {
+		for _, v := range values {
+			pr.Headers = append(pr.Headers, &extproc.Header{Name: name, Value: v})
+		}
+	}
+	for k, v := range p.spec.Attributes {
+		pr.Attributes[k] = v
+	}
+	if id := req.RequestID(); id != "" {
+		pr.Attributes["request_id"] = id
+	}
+	if ip := req.RealIP(); ip != "" {
+		pr.Attributes["client_ip"] = ip
+	}
+	return pr
+}
+
+// process calls the plugin, the call is canceled if the client of the
+// request goes away.
+func (p *ExternalProcessor) process(req *httpprot.Request, pr *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error) {
+	if p.client == nil {
+		return nil, fmt.Errorf("plugin %s is not connected", p.spec.URL)
+	}
+	ctx, cancel := stdcontext.WithTimeout(req.Std().Context(), p.timeout)
+	defer cancel()
+	return p.client.Process(ctx, pr)
+}
+
+func (p *ExternalProcessor) handleFailure(ctx *context.Context, err error) string {
+	if p.spec.FailOpen {
+		logger.Warnf("%s: failed to process, skipped: %v", p.Name(), err)
+		return ""
+	}
+	logger.Errorf("%s: failed to process: %v", p.Name(), err)
+
+	statusCode := p.spec.FailureStatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	ctx.SetOutputResponse(resp)
+	return resultFailed
+}
+
+// applyHeaders removes and then sets the headers of the result.
+func applyHeaders(h http.Header, result *extproc.ProcessingResponse) {
+	for _, name := range result.RemoveHeaders {
+		h.Del(name)
+	}
+	set := map[string]bool{}
+	for _, header := range result.SetHeaders {
+		if !set[http.CanonicalHeaderKey(header.Name)] {
+			h.Del(header.Name)
+			set[http.CanonicalHeaderKey(header.Name)] = true
+		}
+		h.Add(header.Name, header.Value)
+	}
+}
+
+func respond(ctx *context.Context, ir *extproc.ImmediateResponse) {
+	resp, _ := httpprot.NewResponse(nil)
+	statusCode := int(ir.StatusCode)
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	resp.SetStatusCode(statusCode)
+	for _, header := range ir.Headers {
+		resp.HTTPHeader().Add(header.Name, header.Value)
+	}
+	resp.SetPayload(ir.Body)
+	ctx.SetOutputResponse(resp)
+}
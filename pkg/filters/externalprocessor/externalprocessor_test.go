@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package externalprocessor
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/extproc"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+// fakePlugin is a fake plugin, its result is made by the process function.
+type fakePlugin struct {
+	lock     sync.Mutex
+	requests []*extproc.ProcessingRequest
+	process  func(req *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error)
+}
+
+func (p *fakePlugin) Process(ctx stdcontext.Context, req *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error) {
+	p.lock.Lock()
+	p.requests = append(p.requests, req)
+	p.lock.Unlock()
+	return p.process(req)
+}
+
+// received returns the requests received by the plugin.
+func (p *fakePlugin) received() []*extproc.ProcessingRequest {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*extproc.ProcessingRequest(nil), p.requests...)
+}
+
+func startPlugin(t *testing.T, p *fakePlugin) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := extproc.NewServer(p)
+	go s.Serve(l)
+	return "http://" + l.Addr().String(), s.Stop
+}
+
+func newProcessor(t *testing.T, yamlSpec string) *ExternalProcessor {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(t, err)
+
+	p := kind.CreateInstance(spec).(*ExternalProcessor)
+	p.Init()
+	return p
+}
+
+func newContext(t *testing.T, method, body string) *context.Context {
+	stdr, _ := http.NewRequest(method, "http://example.com/pets?limit=1", strings.NewReader(body))
+	stdr.Header.Set("X-Remove", "1")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestRequestPhase(t *testing.T) {
+	assert := assert.New(t)
+
+	plugin := &fakePlugin{}
+	url, stop := startPlugin(t, plugin)
+	defer stop()
+
+	p := newProcessor(t, fmt.Sprintf(`
+kind: ExternalProcessor
+name: extproc
+url: %s
+requestMode: body
+attributes:
+  route: pets
+`, url))
+	defer p.Close()
+
+	plugin.process = func(req *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error) {
+		if req.Method == http.MethodDelete {
+			return &extproc.ProcessingResponse{ImmediateResponse: &extproc.ImmediateResponse{
+				StatusCode: http.StatusForbidden,
+				Headers:    []*extproc.Header{{Name: "X-Reason", Value: "denied"}},
+				Body:       []byte("denied"),
+			}}, nil
+		}
+		return &extproc.ProcessingResponse{
+			SetHeaders:    []*extproc.Header{{Name: "X-Set", Value: "1"}, {Name: "X-Set", Value: "2"}},
+			RemoveHeaders: []string{"X-Remove"},
+			ReplaceBody:   true,
+			Body:          []byte("replaced"),
+		}, nil
+	}
+
+	ctx := newContext(t, http.MethodPost, "hello")
+	assert.Equal("", p.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal([]string{"1", "2"}, req.HTTPHeader().Values("X-Set"))
+	assert.Empty(req.HTTPHeader().Get("X-Remove"))
+	assert.Equal("replaced", string(req.RawPayload()))
+	assert.Equal("8", req.HTTPHeader().Get("Content-Length"))
+
+	sent := plugin.received()[0]
+	assert.Equal(extproc.PhaseRequest, sent.Phase)
+	assert.Equal("/pets?limit=1", sent.URL)
+	assert.Equal("example.com", sent.Host)
+	assert.Equal("hello", string(sent.Body))
+	assert.True(sent.HasBody)
+	assert.Equal("pets", sent.Attributes["route"])
+
+	ctx = newContext(t, http.MethodDelete, "")
+	assert.Equal(resultResponded, p.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	assert.Equal("denied", resp.HTTPHeader().Get("X-Reason"))
+	assert.Equal("denied", string(resp.RawPayload()))
+}
+
+func TestResponsePhase(t *testing.T) {
+	assert := assert.New(t)
+
+	plugin := &fakePlugin{}
+	url, stop := startPlugin(t, plugin)
+	defer stop()
+
+	p := newProcessor(t, fmt.Sprintf(`
+kind: ExternalProcessor
+name: extproc
+url: %s
+requestMode: skip
+responseMode: headers
+`, url))
+	defer p.Close()
+
+	plugin.process = func(req *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error) {
+		return &extproc.ProcessingResponse{SetHeaders: []*extproc.Header{{Name: "X-Status", Value: fmt.Sprint(req.StatusCode)}}}, nil
+	}
+
+	// the request is skipped.
+	ctx := newContext(t, http.MethodGet, "")
+	assert.Equal("", p.Handle(ctx))
+	assert.Empty(plugin.received())
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusCreated)
+	resp.SetPayload("body")
+	ctx.SetOutputResponse(resp)
+	assert.Equal("", p.Handle(ctx))
+	assert.Equal("201", resp.HTTPHeader().Get("X-Status"))
+	sent := plugin.received()[0]
+	assert.Equal(extproc.PhaseResponse, sent.Phase)
+	assert.False(sent.HasBody)
+}
+
+func TestFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	plugin := &fakePlugin{}
+	url, stop := startPlugin(t, plugin)
+	defer stop()
+
+	plugin.process = func(req *extproc.ProcessingRequest) (*extproc.ProcessingResponse, error) {
+		if req.Method == http.MethodPut {
+			time.Sleep(200 * time.Millisecond)
+			return &extproc.ProcessingResponse{}, nil
+		}
+		return nil, fmt.Errorf("failed")
+	}
+
+	yamlSpec := fmt.Sprintf(`
+kind: ExternalProcessor
+name: extproc
+url: %s
+timeout: 50ms
+failureStatusCode: 500
+`, url)
+	p := newProcessor(t, yamlSpec)
+	defer p.Close()
+
+	ctx := newContext(t, http.MethodGet, "")
+	assert.Equal(resultFailed, p.Handle(ctx))
+	assert.Equal(http.StatusInternalServerError, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// timeout
+	ctx = newContext(t, http.MethodPut, "")
+	assert.Equal(resultFailed, p.Handle(ctx))
+
+	p = newProcessor(t, yamlSpec+"failOpen: true\n")
+	defer p.Close()
+	ctx = newContext(t, http.MethodGet, "")
+	assert.Equal("", p.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{URL: "127.0.0.1:9000"}
+	assert.Error(spec.Validate())
+	spec.URL = "grpc://127.0.0.1:9000"
+	assert.Error(spec.Validate())
+	spec.URL = "https://plugin:9000"
+	assert.NoError(spec.Validate())
+	spec.Timeout = "1"
+	assert.Error(spec.Validate())
+}
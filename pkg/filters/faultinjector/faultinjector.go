@@ -0,0 +1,377 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package faultinjector implements the FaultInjector filter.
+package faultinjector
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/expression"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of FaultInjector.
+	Kind = "FaultInjector"
+
+	resultAborted = "aborted"
+	resultDropped = "dropped"
+
+	corruptGarbage  = "garbage"
+	corruptTruncate = "truncate"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FaultInjector injects delays, aborts, corrupted responses and dropped connections for resilience testing.",
+	Results:     []string{resultAborted, resultDropped},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FaultInjector{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// randFloat64 returns a random number in [0, 1), it is a variable for
+// testing.
+var randFloat64 = rand.Float64
+
+type (
+	// FaultInjector is filter FaultInjector.
+	FaultInjector struct {
+		spec *Spec
+
+		delay  time.Duration
+		jitter time.Duration
+		expr   *expression.Expression
+
+		numOfDelayed   int64
+		numOfAborted   int64
+		numOfDropped   int64
+		numOfCorrupted int64
+	}
+
+	// Spec describes the FaultInjector.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Headers gate the injection, only the requests matching all the
+		// headers are injected with faults.
+		Headers map[string]*urlrule.StringMatch `json:"headers" jsonschema:"omitempty"`
+		Delay   *DelaySpec                      `json:"delay,omitempty" jsonschema:"omitempty"`
+		Abort   *AbortSpec                      `json:"abort,omitempty" jsonschema:"omitempty"`
+		Drop    *DropSpec                       `json:"drop,omitempty" jsonschema:"omitempty"`
+		Corrupt *CorruptSpec                    `json:"corrupt,omitempty" jsonschema:"omitempty"`
+
+		// Expression is a CEL expression gating the injection like the
+		// headers, e.g. request.header["x-fault"] == "1".
+		Expression string `json:"expression" jsonschema:"omitempty"`
+	}
+
+	// DelaySpec describes the delay fault, the delay is the fixed delay
+	// plus a random duration in [0, jitter).
+	DelaySpec struct {
+		Fixed      string  `json:"fixed" jsonschema:"required,format=duration"`
+		Jitter     string  `json:"jitter" jsonschema:"omitempty,format=duration"`
+		Percentage float64 `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+	}
+
+	// AbortSpec describes the abort fault, the status code is chosen from
+	// the codes randomly.
+	AbortSpec struct {
+		Codes      []int             `json:"codes" jsonschema:"required,minItems=1"`
+		Headers    map[string]string `json:"headers" jsonschema:"omitempty"`
+		Body       string            `json:"body" jsonschema:"omitempty"`
+		Percentage float64           `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+	}
+
+	// DropSpec describes the drop fault, the connection of the client is
+	// closed without a response.
+	DropSpec struct {
+		Percentage float64 `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+	}
+
+	// CorruptSpec describes the corrupt fault of the response body.
+	CorruptSpec struct {
+		Mode       string  `json:"mode" jsonschema:"omitempty,enum=,enum=garbage,enum=truncate"`
+		Percentage float64 `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+	}
+
+	// Status is the status of FaultInjector.
+	Status struct {
+		NumOfDelayed   int64 `json:"numOfDelayed"`
+		NumOfAborted   int64 `json:"numOfAborted"`
+		NumOfDropped   int64 `json:"numOfDropped"`
+		NumOfCorrupted int64 `json:"numOfCorrupted"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Delay == nil && spec.Abort == nil && spec.Drop == nil && spec.Corrupt == nil {
+		return fmt.Errorf("no fault is specified")
+	}
+
+	for k, h := range spec.Headers {
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("invalid header %s: %v", k, err)
+		}
+	}
+
+	if spec.Expression != "" {
+		if _, err := expression.Compile(spec.Expression); err != nil {
+			return fmt.Errorf("invalid expression: %v", err)
+		}
+	}
+
+	if spec.Delay != nil {
+		if _, err := time.ParseDuration(spec.Delay.Fixed); err != nil {
+			return fmt.Errorf("invalid delay %s: %v", spec.Delay.Fixed, err)
+		}
+		if spec.Delay.Jitter != "" {
+			if _, err := time.ParseDuration(spec.Delay.Jitter); err != nil {
+				return fmt.Errorf("invalid jitter %s: %v", spec.Delay.Jitter, err)
+			}
+		}
+	}
+
+	if spec.Abort != nil {
+		for _, code := range spec.Abort.Codes {
+			if code < 200 || code > 599 {
+				return fmt.Errorf("invalid abort code %d", code)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the FaultInjector filter instance.
+func (fi *FaultInjector) Name() string {
+	return fi.spec.Name()
+}
+
+// Kind returns the kind of FaultInjector.
+func (fi *FaultInjector) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FaultInjector.
+func (fi *FaultInjector) Spec() filters.Spec {
+	return fi.spec
+}
+
+// Init initializes FaultInjector.
+func (fi *FaultInjector) Init() {
+	fi.reload()
+}
+
+// Inherit inherits previous generation of FaultInjector.
+func (fi *FaultInjector) Inherit(previousGeneration filters.Filter) {
+	fi.reload()
+}
+
+func (fi *FaultInjector) reload() {
+	for _, h := range fi.spec.Headers {
+		h.Init()
+	}
+	if fi.spec.Expression != "" {
+		fi.expr = expression.MustCompile(fi.spec.Expression)
+	}
+	if fi.spec.Delay != nil {
+		fi.delay, _ = time.ParseDuration(fi.spec.Delay.Fixed)
+		if fi.spec.Delay.Jitter != "" {
+			fi.jitter, _ = time.ParseDuration(fi.spec.Delay.Jitter)
+		}
+	}
+}
+
+// hit returns whether a fault with the percentage is injected.
+func hit(percentage float64) bool {
+	return randFloat64()*100 < percentage
+}
+
+func (fi *FaultInjector) match(req *httpprot.Request) bool {
+	header := req.HTTPHeader()
+	for k, h := range fi.spec.Headers {
+		if !h.Match(header.Get(k)) {
+			return false
+		}
+	}
+	return fi.expr == nil || fi.expr.Match(req)
+}
+
+// Handle injects faults to the request. The faults are injected in the
+// order of delay, drop, abort and corrupt, and the corrupt fault is only
+// injected if there is a response, so the filter should be put after the
+// Proxy to corrupt the responses.
+func (fi *FaultInjector) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !fi.match(req) {
+		return ""
+	}
+
+	if fi.spec.Delay != nil && hit(fi.spec.Delay.Percentage) {
+		fi.injectDelay(ctx, req)
+	}
+
+	if fi.spec.Drop != nil && hit(fi.spec.Drop.Percentage) {
+		if fi.injectDrop(ctx) {
+			return resultDropped
+		}
+	}
+
+	if fi.spec.Abort != nil && hit(fi.spec.Abort.Percentage) {
+		fi.injectAbort(ctx)
+		return resultAborted
+	}
+
+	if fi.spec.Corrupt != nil && hit(fi.spec.Corrupt.Percentage) {
+		if resp, _ := ctx.GetInputResponse().(*httpprot.Response); resp != nil {
+			fi.injectCorrupt(ctx, resp)
+		}
+	}
+
+	return ""
+}
+
+func (fi *FaultInjector) injectDelay(ctx *context.Context, req *httpprot.Request) {
+	delay := fi.delay
+	if fi.jitter > 0 {
+		delay += time.Duration(randFloat64() * float64(fi.jitter))
+	}
+
+	atomic.AddInt64(&fi.numOfDelayed, 1)
+	ctx.LazyAddTag(func() string {
+		return fmt.Sprintf("%s: delayed %v", fi.Name(), delay)
+	})
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		logger.Debugf("%s: request cancelled in the middle of delay", fi.Name())
+	case <-timer.C:
+	}
+}
+
+// injectDrop closes the connection of the client. The connection is taken
+// over by the filter, so the response is marked as switching protocols to
+// prevent the HTTPServer from writing it. The connection can't be taken
+// over for HTTP/2 requests, and false is returned in this case.
+func (fi *FaultInjector) injectDrop(ctx *context.Context) bool {
+	w, _ := ctx.GetData(httpprot.ResponseWriterKey).(http.ResponseWriter)
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		logger.Debugf("%s: connection can't be dropped", fi.Name())
+		return false
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		logger.Debugf("%s: hijack connection failed: %v", fi.Name(), err)
+		return false
+	}
+	conn.Close()
+
+	atomic.AddInt64(&fi.numOfDropped, 1)
+	ctx.AddTag(fi.Name() + ": connection dropped")
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusSwitchingProtocols)
+	ctx.SetOutputResponse(resp)
+	return true
+}
+
+func (fi *FaultInjector) injectAbort(ctx *context.Context) {
+	spec := fi.spec.Abort
+	code := spec.Codes[int(randFloat64()*float64(len(spec.Codes)))]
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+	for k, v := range spec.Headers {
+		resp.HTTPHeader().Set(k, v)
+	}
+	resp.HTTPHeader().Del("Content-Length")
+	resp.SetPayload([]byte(spec.Body))
+	ctx.SetOutputResponse(resp)
+
+	atomic.AddInt64(&fi.numOfAborted, 1)
+	ctx.AddTag(fmt.Sprintf("%s: aborted with %d", fi.Name(), code))
+}
+
+// injectCorrupt corrupts the body of the response, the bodies of streams
+// are not corrupted.
+func (fi *FaultInjector) injectCorrupt(ctx *context.Context, resp *httpprot.Response) {
+	if resp.IsStream() {
+		return
+	}
+
+	body := resp.RawPayload()
+	if len(body) == 0 {
+		return
+	}
+
+	// the body may be shared, e.g. by the cache, so corrupt a copy.
+	if fi.spec.Corrupt.Mode == corruptTruncate {
+		body = body[:len(body)/2]
+		resp.HTTPHeader().Del("Content-Length")
+	} else {
+		body = append([]byte(nil), body...)
+		// replace 1% of the bytes, at least one byte.
+		n := len(body)/100 + 1
+		for i := 0; i < n; i++ {
+			pos := int(randFloat64() * float64(len(body)))
+			body[pos] ^= byte(randFloat64()*255) + 1
+		}
+	}
+	resp.SetPayload(body)
+
+	atomic.AddInt64(&fi.numOfCorrupted, 1)
+	ctx.AddTag(fi.Name() + ": response corrupted")
+}
+
+// Status returns status.
+func (fi *FaultInjector) Status() interface{} {
+	return &Status{
+		NumOfDelayed:   atomic.LoadInt64(&fi.numOfDelayed),
+		NumOfAborted:   atomic.LoadInt64(&fi.numOfAborted),
+		NumOfDropped:   atomic.LoadInt64(&fi.numOfDropped),
+		NumOfCorrupted: atomic.LoadInt64(&fi.numOfCorrupted),
+	}
+}
+
+// Close closes FaultInjector.
+func (fi *FaultInjector) Close() {
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package faultinjector
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestFaultInjector(assert *assert.Assertions, yamlConfig string) *FaultInjector {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	fi := kind.CreateInstance(spec).(*FaultInjector)
+	fi.Init()
+	return fi
+}
+
+func newTestContext(assert *assert.Assertions, header http.Header, respBody string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	assert.NoError(req.FetchPayload(0))
+	ctx.SetInputRequest(req)
+
+	if respBody != "" {
+		resp, _ := httpprot.NewResponse(&http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Length": []string{"10"}},
+			Body:          io.NopCloser(strings.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+		})
+		assert.NoError(resp.FetchPayload(0))
+		ctx.SetInputResponse(resp)
+	}
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Delay: &DelaySpec{Fixed: "abc"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Delay: &DelaySpec{Fixed: "10ms", Jitter: "abc"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Abort: &AbortSpec{Codes: []int{503, 100}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Abort: &AbortSpec{Codes: []int{503}}, Expression: `request.method = "GET"`}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Abort: &AbortSpec{Codes: []int{503, 500}}, Delay: &DelaySpec{Fixed: "10ms", Jitter: "5ms"}}
+	assert.NoError(spec.Validate())
+}
+
+func TestDelayAndAbort(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newTestFaultInjector(assert, `
+kind: FaultInjector
+name: fault
+headers:
+  X-Fault:
+    exact: "true"
+delay:
+  fixed: 20ms
+  jitter: 10ms
+  percentage: 100
+abort:
+  codes: [503]
+  headers:
+    X-Injected: "true"
+  body: injected
+  percentage: 100
+`)
+
+	// not matching the headers.
+	ctx := newTestContext(assert, nil, "")
+	assert.Equal("", fi.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+
+	ctx = newTestContext(assert, http.Header{"X-Fault": []string{"true"}}, "")
+	start := time.Now()
+	assert.Equal(resultAborted, fi.Handle(ctx))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(elapsed, 20*time.Millisecond)
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal("true", resp.HTTPHeader().Get("X-Injected"))
+	assert.Equal("injected", string(resp.RawPayload()))
+
+	status := fi.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfDelayed)
+	assert.Equal(int64(1), status.NumOfAborted)
+
+	fi.Inherit(fi)
+	fi.Close()
+}
+
+func TestExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newTestFaultInjector(assert, `
+kind: FaultInjector
+name: fault
+expression: request.header["x-fault"] == "1" && request.path == "/"
+abort:
+  codes: [503]
+  percentage: 100
+`)
+
+	assert.Equal("", fi.Handle(newTestContext(assert, nil, "")))
+	assert.Equal("", fi.Handle(newTestContext(assert, http.Header{"X-Fault": []string{"0"}}, "")))
+	assert.Equal(resultAborted, fi.Handle(newTestContext(assert, http.Header{"X-Fault": []string{"1"}}, "")))
+}
+
+func TestPercentage(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func() { randFloat64 = rand.Float64 }()
+	randFloat64 = func() float64 { return 0.5 }
+
+	fi := newTestFaultInjector(assert, `
+kind: FaultInjector
+name: fault
+abort:
+  codes: [500, 503]
+  percentage: 50
+`)
+	assert.Equal("", fi.Handle(newTestContext(assert, nil, "")))
+
+	randFloat64 = func() float64 { return 0.49 }
+	ctx := newTestContext(assert, nil, "")
+	assert.Equal(resultAborted, fi.Handle(ctx))
+	assert.Equal(http.StatusInternalServerError, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
+
+func TestCorrupt(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newTestFaultInjector(assert, `
+kind: FaultInjector
+name: fault
+corrupt:
+  percentage: 100
+`)
+
+	// there's no response.
+	ctx := newTestContext(assert, nil, "")
+	assert.Equal("", fi.Handle(ctx))
+
+	ctx = newTestContext(assert, nil, "0123456789")
+	original := ctx.GetInputResponse().(*httpprot.Response).RawPayload()
+	assert.Equal("", fi.Handle(ctx))
+	body := ctx.GetInputResponse().(*httpprot.Response).RawPayload()
+	assert.Len(body, 10)
+	assert.NotEqual("0123456789", string(body))
+	assert.Equal("0123456789", string(original))
+
+	fi = newTestFaultInjector(assert, `
+kind: FaultInjector
+name: fault
+corrupt:
+  mode: truncate
+  percentage: 100
+`)
+	ctx = newTestContext(assert, nil, "0123456789")
+	assert.Equal("", fi.Handle(ctx))
+	resp := ctx.GetInputResponse().(*httpprot.Response)
+	assert.Equal("01234", string(resp.RawPayload()))
+	assert.Equal("", resp.HTTPHeader().Get("Content-Length"))
+	assert.Equal(int64(1), fi.Status().(*Status).NumOfCorrupted)
+}
+
+func TestDrop(t *testing.T) {
+	assert := assert.New(t)
+
+	fi := newTestFaultInjector(assert, `
+kind: FaultInjector
+name: fault
+drop:
+  percentage: 100
+`)
+
+	// the connection can't be dropped without a hijacker.
+	ctx := newTestContext(assert, nil, "")
+	ctx.SetData(httpprot.ResponseWriterKey, httptest.NewRecorder())
+	assert.Equal("", fi.Handle(ctx))
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := newTestContext(assert, nil, "")
+		ctx.SetData(httpprot.ResponseWriterKey, w)
+		assert.Equal(resultDropped, fi.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusSwitchingProtocols, resp.StatusCode())
+	}))
+	defer svr.Close()
+
+	_, err := http.Post(svr.URL, "text/plain", bytes.NewReader([]byte("hello")))
+	assert.Error(err)
+	assert.Equal(int64(1), fi.Status().(*Status).NumOfDropped)
+}
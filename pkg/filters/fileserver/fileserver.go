@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fileserver implements the FileServer filter, which serves static
+// files from a local or an embedded directory.
+package fileserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of FileServer.
+	Kind = "FileServer"
+
+	resultNotFound         = "notFound"
+	resultMethodNotAllowed = "methodNotAllowed"
+
+	encodingBrotli = "br"
+	encodingGZip   = "gzip"
+)
+
+// extensions are the file extensions of the pre-compressed variants.
+var extensions = map[string]string{
+	encodingBrotli: ".br",
+	encodingGZip:   ".gz",
+}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FileServer serves static files from a local or an embedded directory",
+	Results:     []string{resultNotFound, resultMethodNotAllowed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Index:             "index.html",
+			IndexCacheControl: "no-cache",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FileServer{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*FileServer)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+var embeddedFS sync.Map
+
+// RegisterFS registers an embedded directory, e.g. an embed.FS, so that it
+// could be served by the FileServer filters whose embedded is name.
+func RegisterFS(name string, fsys fs.FS) {
+	embeddedFS.Store(name, fsys)
+}
+
+type (
+	// FileServer is the filter FileServer.
+	FileServer struct {
+		spec *Spec
+		fsys fs.FS
+
+		// etags caches the ETags of the files without modification time,
+		// i.e. the embedded files, which are computed from the content.
+		etags sync.Map
+	}
+
+	// Spec describes the FileServer.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Root              string   `json:"root,omitempty" jsonschema:"omitempty"`
+		Embedded          string   `json:"embedded,omitempty" jsonschema:"omitempty"`
+		StripPrefix       string   `json:"stripPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
+		Index             string   `json:"index,omitempty" jsonschema:"omitempty"`
+		AllowedPaths      []string `json:"allowedPaths,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Precompressed     []string `json:"precompressed,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		SPAFallback       bool     `json:"spaFallback,omitempty" jsonschema:"omitempty"`
+		CacheControl      string   `json:"cacheControl,omitempty" jsonschema:"omitempty"`
+		IndexCacheControl string   `json:"indexCacheControl,omitempty" jsonschema:"omitempty"`
+	}
+
+	// file is a file opened to be served.
+	file struct {
+		fs.File
+		name     string
+		info     fs.FileInfo
+		encoding string
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if (s.Root == "") == (s.Embedded == "") {
+		return fmt.Errorf("one and only one of root and embedded must be specified")
+	}
+	if s.Index == "" || strings.Contains(s.Index, "/") {
+		return fmt.Errorf("invalid index %q", s.Index)
+	}
+	for _, p := range s.AllowedPaths {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("allowed path %s must start with /", p)
+		}
+	}
+	for _, enc := range s.Precompressed {
+		if _, ok := extensions[enc]; !ok {
+			return fmt.Errorf("invalid precompressed encoding %s, must be br or gzip", enc)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the FileServer filter instance.
+func (f *FileServer) Name() string {
+	return f.spec.Name()
+}
+
+// Kind returns the kind of FileServer.
+func (f *FileServer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FileServer.
+func (f *FileServer) Spec() filters.Spec {
+	return f.spec
+}
+
+// Init initializes FileServer.
+func (f *FileServer) Init() {
+	f.reload()
+}
+
+// Inherit inherits previous generation of FileServer.
+func (f *FileServer) Inherit(previousGeneration filters.Filter) {
+	f.reload()
+}
+
+func (f *FileServer) reload() {
+	if f.spec.Root != "" {
+		f.fsys = os.DirFS(f.spec.Root)
+		return
+	}
+
+	if v, ok := embeddedFS.Load(f.spec.Embedded); ok {
+		f.fsys = v.(fs.FS)
+	} else {
+		logger.Errorf("%s: embedded directory %s is not registered", f.Name(), f.spec.Embedded)
+	}
+}
+
+// isAllowed returns whether the file of the path could be served, the hidden
+// files and the files out of the allowed paths are never served, except the
+// index of the root.
+func (f *FileServer) isAllowed(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return false
+		}
+	}
+
+	if len(f.spec.AllowedPaths) == 0 || p == "/" || p == "/"+f.spec.Index {
+		return true
+	}
+	for _, allowed := range f.spec.AllowedPaths {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if p == allowed || strings.HasPrefix(p, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// open opens the file of the path, which is cleaned and starts with '/',
+// it opens the index file for a directory.
+func (f *FileServer) open(p string) (*file, error) {
+	name := strings.TrimPrefix(p, "/")
+	if name == "" {
+		name = "."
+	}
+
+	fl, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fl.Stat()
+	if err != nil {
+		fl.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		fl.Close()
+		return f.open(path.Join(p, f.spec.Index))
+	}
+	return &file{File: fl, name: name, info: info}, nil
+}
+
+// openVariant opens the pre-compressed variant of the file accepted by the
+// request, it returns nil if there is none.
+func (f *FileServer) openVariant(fl *file, acceptEncoding string) *file {
+	for _, enc := range f.spec.Precompressed {
+		if !acceptsEncoding(acceptEncoding, enc) {
+			continue
+		}
+
+		name := fl.name + extensions[enc]
+		variant, err := f.fsys.Open(name)
+		if err != nil {
+			continue
+		}
+		info, err := variant.Stat()
+		if err != nil || info.IsDir() {
+			variant.Close()
+			continue
+		}
+		return &file{File: variant, name: name, info: info, encoding: enc}
+	}
+	return nil
+}
+
+// acceptsEncoding returns whether the encoding is accepted by the value of
+// the Accept-Encoding header.
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, v := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(v, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), encoding) {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				return err == nil && q > 0
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (f *FileServer) etag(fl *file) string {
+	if !fl.info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, fl.info.ModTime().UnixNano(), fl.info.Size())
+	}
+
+	if v, ok := f.etags.Load(fl.name); ok {
+		return v.(string)
+	}
+	content, err := fs.ReadFile(f.fsys, fl.name)
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum(content)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	f.etags.Store(fl.name, etag)
+	return etag
+}
+
+// isNotModified evaluates the conditional headers of the request.
+func isNotModified(header http.Header, etag string, modTime time.Time) bool {
+	if inm := header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+			if v == "*" || v == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := header.Get("If-Modified-Since")
+	if ims == "" || modTime.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(t)
+}
+
+// wantsFallback returns whether the index should be served for a request
+// whose file is not found, i.e. the request is likely a navigation of the
+// single page application rather than a request of an asset.
+func wantsFallback(p string, header http.Header) bool {
+	return path.Ext(p) == "" || strings.Contains(header.Get("Accept"), "text/html")
+}
+
+// Handle serves the file of the request.
+func (f *FileServer) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	resp, _ := httpprot.NewResponse(nil)
+	ctx.SetOutputResponse(resp)
+
+	if req.Method() != http.MethodGet && req.Method() != http.MethodHead {
+		resp.HTTPHeader().Set("Allow", "GET, HEAD")
+		resp.SetStatusCode(http.StatusMethodNotAllowed)
+		return resultMethodNotAllowed
+	}
+
+	p := req.Path()
+	if f.spec.StripPrefix != "" {
+		p = strings.TrimPrefix(p, f.spec.StripPrefix)
+	}
+	p = path.Clean("/" + p)
+
+	var fl *file
+	if f.fsys != nil && f.isAllowed(p) {
+		fl, _ = f.open(p)
+	}
+	if fl == nil && f.fsys != nil && f.spec.SPAFallback && wantsFallback(p, req.HTTPHeader()) {
+		fl, _ = f.open("/")
+	}
+	if fl == nil {
+		resp.SetStatusCode(http.StatusNotFound)
+		return resultNotFound
+	}
+
+	header := resp.HTTPHeader()
+	if ct := mime.TypeByExtension(path.Ext(fl.name)); ct != "" {
+		header.Set("Content-Type", ct)
+	} else {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if path.Base(fl.name) == f.spec.Index {
+		if f.spec.IndexCacheControl != "" {
+			header.Set("Cache-Control", f.spec.IndexCacheControl)
+		}
+	} else if f.spec.CacheControl != "" {
+		header.Set("Cache-Control", f.spec.CacheControl)
+	}
+
+	if len(f.spec.Precompressed) > 0 {
+		header.Add("Vary", "Accept-Encoding")
+		if variant := f.openVariant(fl, req.HTTPHeader().Get("Accept-Encoding")); variant != nil {
+			fl.Close()
+			fl = variant
+			header.Set("Content-Encoding", fl.encoding)
+		}
+	}
+
+	etag := f.etag(fl)
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	modTime := fl.info.ModTime()
+	if !modTime.IsZero() {
+		header.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if isNotModified(req.HTTPHeader(), etag, modTime) {
+		fl.Close()
+		header.Del("Content-Type")
+		header.Del("Content-Encoding")
+		resp.SetStatusCode(http.StatusNotModified)
+		return ""
+	}
+
+	header.Set("Content-Length", strconv.FormatInt(fl.info.Size(), 10))
+	if req.Method() == http.MethodHead {
+		fl.Close()
+		return ""
+	}
+
+	// the file is closed along with the response.
+	resp.SetPayload(io.Reader(fl.File))
+	return ""
+}
+
+// Status returns status.
+func (f *FileServer) Status() interface{} {
+	return nil
+}
+
+// Close closes FileServer.
+func (f *FileServer) Close() {
+}
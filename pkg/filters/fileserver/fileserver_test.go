@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fileserver
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestFileServer(assert *assert.Assertions, yamlConfig string) *FileServer {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	f := kind.CreateInstance(spec).(*FileServer)
+	f.Init()
+	return f
+}
+
+func serve(f *FileServer, method, path string, header map[string]string) (*httpprot.Response, string, string) {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(method, "http://127.0.0.1"+path, nil)
+	for k, v := range header {
+		stdr.Header.Set(k, v)
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+
+	result := f.Handle(ctx)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	body, _ := io.ReadAll(resp.GetPayload())
+	resp.Close()
+	return resp, result, string(body)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{
+		"kind: FileServer\nname: f",
+		"kind: FileServer\nname: f\nroot: /tmp\nembedded: www",
+		"kind: FileServer\nname: f\nroot: /tmp\nindex: a/index.html",
+		"kind: FileServer\nname: f\nroot: /tmp\nallowedPaths: [assets]",
+		"kind: FileServer\nname: f\nroot: /tmp\nprecompressed: [zstd]",
+	} {
+		rawSpec := map[string]interface{}{}
+		assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err, yamlConfig)
+	}
+}
+
+func TestLocalDirectory(t *testing.T) {
+	assert := assert.New(t)
+
+	root := t.TempDir()
+	assert.NoError(os.MkdirAll(filepath.Join(root, "assets"), 0o755))
+	assert.NoError(os.WriteFile(filepath.Join(root, "index.html"), []byte("<html></html>"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("console.log(1)"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(root, "assets", "app.js.gz"), []byte("gzipped"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(root, ".env"), []byte("env"), 0o644))
+
+	f := newTestFileServer(assert, `
+kind: FileServer
+name: fileserver
+root: `+root+`
+stripPrefix: /static
+allowedPaths: [/assets]
+precompressed: [br, gzip]
+cacheControl: max-age=3600
+`)
+	defer f.Close()
+
+	resp, result, body := serve(f, http.MethodGet, "/static/", nil)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("<html></html>", body)
+	assert.Equal("no-cache", resp.HTTPHeader().Get("Cache-Control"))
+	assert.Contains(resp.HTTPHeader().Get("Content-Type"), "text/html")
+
+	resp, _, body = serve(f, http.MethodGet, "/static/assets/app.js", nil)
+	assert.Equal("console.log(1)", body)
+	assert.Equal("max-age=3600", resp.HTTPHeader().Get("Cache-Control"))
+	assert.Equal("14", resp.HTTPHeader().Get("Content-Length"))
+	assert.Equal("Accept-Encoding", resp.HTTPHeader().Get("Vary"))
+	etag := resp.HTTPHeader().Get("ETag")
+	assert.NotEmpty(etag)
+
+	resp, _, _ = serve(f, http.MethodGet, "/static/assets/app.js", map[string]string{"If-None-Match": etag})
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+	lastModified := resp.HTTPHeader().Get("Last-Modified")
+	resp, _, _ = serve(f, http.MethodGet, "/static/assets/app.js", map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+
+	resp, _, body = serve(f, http.MethodGet, "/static/assets/app.js", map[string]string{"Accept-Encoding": "br;q=0, gzip"})
+	assert.Equal("gzipped", body)
+	assert.Equal("gzip", resp.HTTPHeader().Get("Content-Encoding"))
+	assert.Contains(resp.HTTPHeader().Get("Content-Type"), "javascript")
+	assert.NotEqual(etag, resp.HTTPHeader().Get("ETag"))
+
+	resp, _, body = serve(f, http.MethodHead, "/static/assets/app.js", nil)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("14", resp.HTTPHeader().Get("Content-Length"))
+	assert.Equal("", body)
+
+	for _, p := range []string{"/static/secret.txt", "/static/.env", "/static/../secret.txt", "/static/assets/missing.js"} {
+		resp, result, _ = serve(f, http.MethodGet, p, nil)
+		assert.Equal(http.StatusNotFound, resp.StatusCode(), p)
+		assert.Equal(resultNotFound, result, p)
+	}
+
+	resp, result, _ = serve(f, http.MethodPost, "/static/", nil)
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode())
+	assert.Equal(resultMethodNotAllowed, result)
+}
+
+func TestEmbeddedSPAFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterFS("www", fstest.MapFS{
+		"index.html":   {Data: []byte("spa")},
+		"logo.svg":     {Data: []byte("<svg/>")},
+		"docs/a/x.css": {Data: []byte("x")},
+	})
+
+	f := newTestFileServer(assert, `
+kind: FileServer
+name: fileserver
+embedded: www
+spaFallback: true
+`)
+	defer f.Close()
+
+	resp, _, body := serve(f, http.MethodGet, "/logo.svg", nil)
+	assert.Equal("<svg/>", body)
+	assert.Equal("", resp.HTTPHeader().Get("Last-Modified"))
+	etag := resp.HTTPHeader().Get("ETag")
+	assert.NotEmpty(etag)
+	resp, _, _ = serve(f, http.MethodGet, "/logo.svg", map[string]string{"If-None-Match": `W/` + etag})
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+
+	_, _, body = serve(f, http.MethodGet, "/users/1", nil)
+	assert.Equal("spa", body)
+	_, _, body = serve(f, http.MethodGet, "/users/john.doe", map[string]string{"Accept": "text/html,*/*"})
+	assert.Equal("spa", body)
+	_, _, body = serve(f, http.MethodGet, "/docs", nil)
+	assert.Equal("spa", body)
+
+	resp, result, _ := serve(f, http.MethodGet, "/missing.js", nil)
+	assert.Equal(http.StatusNotFound, resp.StatusCode())
+	assert.Equal(resultNotFound, result)
+
+	f2 := newTestFileServer(assert, `
+kind: FileServer
+name: fileserver
+embedded: unknown
+spaFallback: true
+`)
+	resp, _, _ = serve(f2, http.MethodGet, "/", nil)
+	assert.Equal(http.StatusNotFound, resp.StatusCode())
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(acceptsEncoding("gzip, deflate, br", "br"))
+	assert.True(acceptsEncoding("GZIP;q=0.5", "gzip"))
+	assert.False(acceptsEncoding("gzip;q=0", "gzip"))
+	assert.False(acceptsEncoding("deflate", "gzip"))
+	assert.False(acceptsEncoding("", "gzip"))
+}
@@ -20,10 +20,12 @@ package filters
 import (
 	"fmt"
 
+	"github.com/megaease/easegress/pkg/cluster/secret"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/spectemplate"
 	"github.com/megaease/easegress/pkg/v"
 )
 
@@ -86,6 +88,14 @@ type (
 		InjectResiliencePolicy(policies map[string]resilience.Policy)
 	}
 
+	// BodyRequirer is the interface of filters declaring whether they
+	// require the full bodies of the requests and responses. The bodies
+	// could be streamed end-to-end if no filter requires them, filters
+	// not implementing it are assumed to require both.
+	BodyRequirer interface {
+		RequiresBody() (request, response bool)
+	}
+
 	// Spec is the common interface of filter specs
 	Spec interface {
 		// Super returns supervisor
@@ -117,6 +127,15 @@ type (
 	}
 )
 
+// RequiresBody returns whether filter requires the full bodies of the
+// requests and responses.
+func RequiresBody(filter Filter) (request, response bool) {
+	if br, ok := filter.(BodyRequirer); ok {
+		return br.RequiresBody()
+	}
+	return true, true
+}
+
 // NewSpec creates a filter spec and validates it.
 func NewSpec(super *supervisor.Supervisor, pipeline string, rawSpec interface{}) (spec Spec, err error) {
 	defer func() {
@@ -130,6 +149,14 @@ func NewSpec(super *supervisor.Supervisor, pipeline string, rawSpec interface{})
 	if err != nil {
 		return nil, err
 	}
+	// the secret and environment variable references are resolved before
+	// unmarshaling, so that filters get the values without knowing them.
+	if jsonConfig, err = secret.ResolveJSON(jsonConfig); err != nil {
+		return nil, err
+	}
+	if jsonConfig, err = spectemplate.ResolveEnvJSON(jsonConfig); err != nil {
+		return nil, err
+	}
 
 	// Meta part.
 	meta := supervisor.MetaSpec{Version: supervisor.DefaultSpecVersion}
@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package geoipfilter implements the GeoIP filter, which resolves the
+// location of the client IP, passes it to the backends by headers, and
+// blocks the requests by the location.
+package geoipfilter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/geoip"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of GeoIP.
+	Kind = "GeoIP"
+
+	resultBlocked = "blocked"
+
+	fieldCountry     = "country"
+	fieldContinent   = "continent"
+	fieldSubdivision = "subdivision"
+	fieldCity        = "city"
+	fieldASN         = "asn"
+	fieldASOrg       = "asOrg"
+)
+
+// defaultHeaders are the headers used if the headers are not specified.
+var defaultHeaders = map[string]string{
+	fieldCountry:   "X-Geo-Country",
+	fieldContinent: "X-Geo-Continent",
+	fieldASN:       "X-Geo-ASN",
+}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "GeoIP resolves the location of the client IP to inject headers or block requests",
+	Results:     []string{resultBlocked},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &GeoIP{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*GeoIP)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// GeoIP is the filter GeoIP.
+	GeoIP struct {
+		spec *Spec
+
+		resolver *geoip.Resolver
+		filter   *geoip.Filter
+		headers  map[string]string
+
+		mutex      sync.Mutex
+		numBlocked uint64
+		numUnknown uint64
+	}
+
+	// Spec describes the GeoIP.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+		geoip.Spec       `json:",inline"`
+
+		// Headers maps the fields of the location to the request headers,
+		// the fields are country, continent, subdivision, city, asn and
+		// asOrg.
+		Headers   map[string]string `json:"headers" jsonschema:"omitempty"`
+		GeoFilter *geoip.FilterSpec `json:"geoFilter,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of GeoIP.
+	Status struct {
+		NumOfBlocked uint64                  `json:"numOfBlocked"`
+		NumOfUnknown uint64                  `json:"numOfUnknown"`
+		Databases    []*geoip.DatabaseStatus `json:"databases"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	for field := range s.Headers {
+		switch field {
+		case fieldCountry, fieldContinent, fieldSubdivision, fieldCity, fieldASN, fieldASOrg:
+		default:
+			return fmt.Errorf("unknown field %s of headers", field)
+		}
+	}
+	return s.Spec.Validate()
+}
+
+// Name returns the name of the GeoIP filter instance.
+func (g *GeoIP) Name() string {
+	return g.spec.Name()
+}
+
+// Kind returns the kind of GeoIP.
+func (g *GeoIP) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the GeoIP.
+func (g *GeoIP) Spec() filters.Spec {
+	return g.spec
+}
+
+// Init initializes GeoIP.
+func (g *GeoIP) Init() {
+	g.reload()
+}
+
+// Inherit inherits previous generation of GeoIP.
+func (g *GeoIP) Inherit(previousGeneration filters.Filter) {
+	previousGeneration.Close()
+	g.reload()
+}
+
+func (g *GeoIP) reload() {
+	g.resolver = geoip.NewResolver(&g.spec.Spec)
+	if g.spec.GeoFilter != nil {
+		g.filter = geoip.NewFilter(g.spec.GeoFilter)
+	}
+	g.headers = g.spec.Headers
+	if len(g.headers) == 0 {
+		g.headers = defaultHeaders
+	}
+}
+
+func fieldValue(loc *geoip.Location, field string) string {
+	switch field {
+	case fieldCountry:
+		return loc.Country
+	case fieldContinent:
+		return loc.Continent
+	case fieldSubdivision:
+		return loc.Subdivision
+	case fieldCity:
+		return loc.City
+	case fieldASN:
+		if loc.ASN == 0 {
+			return ""
+		}
+		return strconv.FormatUint(loc.ASN, 10)
+	case fieldASOrg:
+		return loc.ASOrg
+	}
+	return ""
+}
+
+// Handle resolves the location of the client IP.
+func (g *GeoIP) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	loc := g.resolver.Lookup(req.RealIP())
+
+	if g.filter != nil && !g.filter.Allow(loc) {
+		g.mutex.Lock()
+		g.numBlocked++
+		g.mutex.Unlock()
+
+		country := ""
+		if loc != nil {
+			country = loc.Country
+		}
+		ctx.AddTag(stringtool.Cat("geoip: blocked ", req.RealIP(), " from ", country))
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusForbidden)
+		ctx.SetOutputResponse(resp)
+		return resultBlocked
+	}
+
+	// the headers from the clients are removed, so that they can't be
+	// spoofed.
+	h := req.HTTPHeader()
+	for _, header := range g.headers {
+		h.Del(header)
+	}
+
+	if loc == nil {
+		g.mutex.Lock()
+		g.numUnknown++
+		g.mutex.Unlock()
+		return ""
+	}
+	for field, header := range g.headers {
+		if v := fieldValue(loc, field); v != "" {
+			h.Set(header, v)
+		}
+	}
+	return ""
+}
+
+// RequiresBody implements filters.BodyRequirer.
+func (g *GeoIP) RequiresBody() (request, response bool) {
+	return false, false
+}
+
+// Status returns status.
+func (g *GeoIP) Status() interface{} {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return &Status{
+		NumOfBlocked: g.numBlocked,
+		NumOfUnknown: g.numUnknown,
+		Databases:    g.resolver.Status(),
+	}
+}
+
+// Close closes GeoIP.
+func (g *GeoIP) Close() {
+	g.resolver.Close()
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geoipfilter
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/mmdb/mmdbtest"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestGeoIP(assert *assert.Assertions, yamlConfig string) *GeoIP {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	g := kind.CreateInstance(spec).(*GeoIP)
+	g.Init()
+	return g
+}
+
+func newTestContext(ip string, header http.Header) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.RemoteAddr = ip + ":12345"
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func writeTestDatabase(assert *assert.Assertions, dir string) string {
+	buf, err := mmdbtest.Build(6, 24, map[string]interface{}{
+		"192.0.2.0/24": map[string]interface{}{
+			"country":                        map[string]interface{}{"iso_code": "US"},
+			"continent":                      map[string]interface{}{"code": "NA"},
+			"city":                           map[string]interface{}{"names": map[string]interface{}{"en": "Seattle"}},
+			"autonomous_system_number":       uint64(64500),
+			"autonomous_system_organization": "Example",
+		},
+		"198.51.100.0/24": map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "CN"},
+		},
+	})
+	assert.NoError(err)
+	path := filepath.Join(dir, "geo.mmdb")
+	assert.NoError(os.WriteFile(path, buf, 0o644))
+	return path
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Headers: map[string]string{"unknown": "X-Unknown"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Headers: map[string]string{"city": "X-City"}}
+	spec.ReloadInterval = "invalid"
+	assert.Error(spec.Validate())
+}
+
+func TestHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	db := writeTestDatabase(assert, t.TempDir())
+	g := newTestGeoIP(assert, fmt.Sprintf(`
+kind: GeoIP
+name: geoip
+databases: [%s]
+`, db))
+
+	ctx := newTestContext("192.0.2.1", http.Header{"X-Geo-Country": {"XX"}})
+	assert.Equal("", g.Handle(ctx))
+	h := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("US", h.Get("X-Geo-Country"))
+	assert.Equal("NA", h.Get("X-Geo-Continent"))
+	assert.Equal("64500", h.Get("X-Geo-ASN"))
+
+	// the spoofed headers are removed.
+	ctx = newTestContext("203.0.113.1", http.Header{"X-Geo-Country": {"XX"}})
+	assert.Equal("", g.Handle(ctx))
+	h = ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("", h.Get("X-Geo-Country"))
+
+	g2 := newTestGeoIP(assert, fmt.Sprintf(`
+kind: GeoIP
+name: geoip
+databases: [%s]
+headers:
+  city: X-City
+  asOrg: X-AS-Org
+`, db))
+	// the previous generation is closed.
+	g2.Inherit(g)
+	defer g2.Close()
+
+	ctx = newTestContext("192.0.2.1", nil)
+	assert.Equal("", g2.Handle(ctx))
+	h = ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("Seattle", h.Get("X-City"))
+	assert.Equal("Example", h.Get("X-AS-Org"))
+	assert.Equal("", h.Get("X-Geo-Country"))
+}
+
+func TestGeoFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	db := writeTestDatabase(assert, t.TempDir())
+	g := newTestGeoIP(assert, fmt.Sprintf(`
+kind: GeoIP
+name: geoip
+databases: [%s]
+geoFilter:
+  blockCountries: [CN]
+`, db))
+	defer g.Close()
+
+	ctx := newTestContext("198.51.100.1", nil)
+	assert.Equal(resultBlocked, g.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newTestContext("192.0.2.1", nil)
+	assert.Equal("", g.Handle(ctx))
+	ctx = newTestContext("203.0.113.1", nil)
+	assert.Equal("", g.Handle(ctx))
+
+	status := g.Status().(*Status)
+	assert.Equal(uint64(1), status.NumOfBlocked)
+	assert.Equal(uint64(1), status.NumOfUnknown)
+	assert.Len(status.Databases, 1)
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphqlbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+type (
+	// orderedObject is a JSON object keeping the order of its keys, which
+	// is the order of the fields in the query.
+	orderedObject struct {
+		keys   []string
+		values map[string]interface{}
+	}
+
+	// gqlError is an error in the GraphQL response.
+	gqlError struct {
+		Message    string                 `json:"message"`
+		Path       []interface{}          `json:"path,omitempty"`
+		Extensions map[string]interface{} `json:"extensions,omitempty"`
+	}
+
+	// executor executes an operation of a document.
+	executor struct {
+		resolvers map[string]*resolver
+		req       *httpprot.Request
+		doc       *document
+		op        *operation
+		variables map[string]interface{}
+
+		mutex  sync.Mutex
+		errors []*gqlError
+	}
+)
+
+// MarshalJSON implements json.Marshaler.
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// newExecutor selects the operation and coerces the variables.
+func newExecutor(doc *document, operationName string, variables map[string]interface{}) (*executor, error) {
+	var op *operation
+	if operationName == "" {
+		if len(doc.operations) > 1 {
+			return nil, fmt.Errorf("operation name is required for a document with multiple operations")
+		}
+		op = doc.operations[0]
+	} else {
+		for _, o := range doc.operations {
+			if o.name == operationName {
+				op = o
+				break
+			}
+		}
+		if op == nil {
+			return nil, fmt.Errorf("operation %s not found", operationName)
+		}
+	}
+
+	if op.kind != "query" && op.kind != "mutation" {
+		return nil, fmt.Errorf("%s is not supported", op.kind)
+	}
+
+	coerced := map[string]interface{}{}
+	for _, v := range op.variables {
+		value, ok := variables[v.name]
+		if !ok && v.hasDefault {
+			value, ok = v.defaultValue, true
+		}
+		if v.nonNull && (!ok || value == nil) {
+			return nil, fmt.Errorf("variable $%s is required", v.name)
+		}
+		if ok {
+			coerced[v.name] = value
+		}
+	}
+
+	return &executor{doc: doc, op: op, variables: coerced}, nil
+}
+
+// measure returns the depth and the number of fields of the selections,
+// the fragments are expanded.
+func (e *executor) measure(selections []selection, visiting map[string]bool) (int, int, error) {
+	depth, count := 0, 0
+	for _, s := range selections {
+		var d, c int
+		var err error
+
+		switch s := s.(type) {
+		case *field:
+			d, c, err = e.measure(s.selections, visiting)
+			d, c = d+1, c+1
+		case *inlineFragment:
+			d, c, err = e.measure(s.selections, visiting)
+		case *fragmentSpread:
+			f := e.doc.fragments[s.name]
+			if f == nil {
+				return 0, 0, fmt.Errorf("fragment %s not found", s.name)
+			}
+			if visiting[s.name] {
+				return 0, 0, fmt.Errorf("fragment %s is cyclic", s.name)
+			}
+			visiting[s.name] = true
+			d, c, err = e.measure(f.selections, visiting)
+			delete(visiting, s.name)
+		}
+
+		if err != nil {
+			return 0, 0, err
+		}
+		if d > depth {
+			depth = d
+		}
+		count += c
+	}
+	return depth, count, nil
+}
+
+// shouldInclude evaluates the @skip and @include directives.
+func (e *executor) shouldInclude(directives []*directive) bool {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			continue
+		}
+		cond := false
+		for _, arg := range d.args {
+			if arg.name == "if" {
+				cond, _ = resolveValue(arg.value, e.variables).(bool)
+			}
+		}
+		if (d.name == "skip") == cond {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFields expands the fragments of the selections and merges the
+// fields of the same response key.
+func (e *executor) collectFields(selections []selection) []*field {
+	var fields []*field
+	index := map[string]int{}
+
+	var collect func(selections []selection)
+	collect = func(selections []selection) {
+		for _, s := range selections {
+			switch s := s.(type) {
+			case *field:
+				if !e.shouldInclude(s.directives) {
+					continue
+				}
+				key := s.responseKey()
+				if i, ok := index[key]; ok {
+					merged := *fields[i]
+					merged.selections = append(append([]selection{}, merged.selections...), s.selections...)
+					fields[i] = &merged
+					continue
+				}
+				index[key] = len(fields)
+				fields = append(fields, s)
+			case *inlineFragment:
+				if e.shouldInclude(s.directives) {
+					collect(s.selections)
+				}
+			case *fragmentSpread:
+				if f := e.doc.fragments[s.name]; f != nil && e.shouldInclude(s.directives) {
+					collect(f.selections)
+				}
+			}
+		}
+	}
+
+	collect(selections)
+	return fields
+}
+
+func (e *executor) addError(err error, path []interface{}) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.errors = append(e.errors, &gqlError{Message: err.Error(), Path: path})
+}
+
+// execute executes the operation, the root fields of queries are resolved
+// concurrently, and those of mutations are resolved serially.
+func (e *executor) execute() *orderedObject {
+	fields := e.collectFields(e.op.selections)
+	obj := &orderedObject{values: make(map[string]interface{}, len(fields))}
+	values := make([]interface{}, len(fields))
+	namePath := []string{e.op.kind}
+
+	if e.op.kind == "query" {
+		wg := &sync.WaitGroup{}
+		wg.Add(len(fields))
+		for i, f := range fields {
+			go func(i int, f *field) {
+				defer wg.Done()
+				values[i] = e.resolveField(f, nil, namePath, nil)
+			}(i, f)
+		}
+		wg.Wait()
+	} else {
+		for i, f := range fields {
+			values[i] = e.resolveField(f, nil, namePath, nil)
+		}
+	}
+
+	for i, f := range fields {
+		key := f.responseKey()
+		obj.keys = append(obj.keys, key)
+		obj.values[key] = values[i]
+	}
+	return obj
+}
+
+func (e *executor) executeFields(fields []*field, parent map[string]interface{}, namePath []string, respPath []interface{}) *orderedObject {
+	obj := &orderedObject{values: make(map[string]interface{}, len(fields))}
+	for _, f := range fields {
+		key := f.responseKey()
+		obj.keys = append(obj.keys, key)
+		obj.values[key] = e.resolveField(f, parent, namePath, respPath)
+	}
+	return obj
+}
+
+// resolveField resolves the field by its resolver if there is one, or by
+// reading the property of the same name of the parent.
+func (e *executor) resolveField(f *field, parent map[string]interface{}, namePath []string, respPath []interface{}) interface{} {
+	namePath = append(append([]string{}, namePath...), f.name)
+	respPath = append(append([]interface{}{}, respPath...), f.responseKey())
+
+	var value interface{}
+	if r := e.resolvers[strings.Join(namePath, ".")]; r != nil {
+		args := make(map[string]interface{}, len(f.args))
+		for _, arg := range f.args {
+			args[arg.name] = resolveValue(arg.value, e.variables)
+		}
+		v, err := r.resolve(e.req, args, parent)
+		if err != nil {
+			e.addError(err, respPath)
+			return nil
+		}
+		value = v
+	} else if parent != nil {
+		value = parent[f.name]
+	}
+
+	if len(f.selections) == 0 {
+		return value
+	}
+	return e.completeValue(e.collectFields(f.selections), value, namePath, respPath)
+}
+
+func (e *executor) completeValue(fields []*field, value interface{}, namePath []string, respPath []interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return e.executeFields(fields, v, namePath, respPath)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			itemPath := append(append([]interface{}{}, respPath...), i)
+			list[i] = e.completeValue(fields, item, namePath, itemPath)
+		}
+		return list
+	}
+
+	e.addError(fmt.Errorf("field %s has a selection set but its value is not an object", namePath[len(namePath)-1]), respPath)
+	return nil
+}
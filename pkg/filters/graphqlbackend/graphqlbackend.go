@@ -0,0 +1,529 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package graphqlbackend implements the GraphQLBackend filter, which serves
+// GraphQL queries by resolving the fields with REST calls.
+package graphqlbackend
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of GraphQLBackend.
+	Kind = "GraphQLBackend"
+
+	resultInvalid = "invalid"
+
+	defaultTimeout       = 5 * time.Second
+	defaultMaxDepth      = 10
+	defaultMaxComplexity = 1000
+	// 4MB
+	maxBodySize = 4 * 1024 * 1024
+	// maxAutomaticPersistedQueries is the max number of the automatic
+	// persisted queries kept in memory.
+	maxAutomaticPersistedQueries = 1000
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "GraphQLBackend serves GraphQL queries by resolving the fields with REST calls.",
+	Results:     []string{resultInvalid},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &GraphQLBackend{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// All GraphQLBackend instances use one globalClient in order to reuse
+// some resources such as keepalive connections.
+var globalClient = &http.Client{
+	// NOTE: The timeouts are set by the resolvers.
+	Timeout: 0,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 60 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          10240,
+		MaxIdleConnsPerHost:   512,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+type (
+	// GraphQLBackend is filter GraphQLBackend.
+	GraphQLBackend struct {
+		spec      *Spec
+		resolvers map[string]*resolver
+
+		// persisted are the documents of the persisted queries of the
+		// spec, and automatic are those registered by the clients.
+		persisted map[string]*document
+		mutex     sync.RWMutex
+		automatic map[string]*document
+		maxDepth  int
+		maxFields int
+	}
+
+	// Spec describes the GraphQLBackend.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Resolvers []*Resolver `json:"resolvers" jsonschema:"required,minItems=1"`
+		// MaxDepth is the max depth of the selections of a query.
+		MaxDepth int `json:"maxDepth" jsonschema:"omitempty,minimum=0"`
+		// MaxComplexity is the max number of the fields of a query.
+		MaxComplexity int `json:"maxComplexity" jsonschema:"omitempty,minimum=0"`
+		// PersistedQueries maps the SHA-256 hashes of queries to the queries.
+		PersistedQueries map[string]string `json:"persistedQueries" jsonschema:"omitempty"`
+		// PersistedQueriesOnly rejects the queries not in PersistedQueries.
+		PersistedQueriesOnly bool `json:"persistedQueriesOnly" jsonschema:"omitempty"`
+		// AutomaticPersistedQueries allows the clients to register queries
+		// by their hashes.
+		AutomaticPersistedQueries bool `json:"automaticPersistedQueries" jsonschema:"omitempty"`
+	}
+
+	// Resolver resolves a field by a REST call.
+	Resolver struct {
+		// Path is the path of the field, which is the operation type,
+		// query or mutation, followed by the names of the fields from the
+		// root, separated by dots, e.g. query.user.orders.
+		Path   string `json:"path" jsonschema:"required"`
+		URL    string `json:"url" jsonschema:"required"`
+		Method string `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		Body   string `json:"body" jsonschema:"omitempty"`
+		// ForwardHeaders are the headers of the request forwarded to the
+		// backend.
+		ForwardHeaders []string `json:"forwardHeaders" jsonschema:"omitempty"`
+		Timeout        string   `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// Extract is the dot separated path of the value of the field in
+		// the JSON response, the whole response is the value if empty.
+		Extract string `json:"extract" jsonschema:"omitempty"`
+	}
+
+	resolver struct {
+		spec    *Resolver
+		url     *template.Template
+		body    *template.Template
+		timeout time.Duration
+	}
+
+	gqlRequest struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+		Extensions    struct {
+			PersistedQuery *struct {
+				Version    int    `json:"version"`
+				SHA256Hash string `json:"sha256Hash"`
+			} `json:"persistedQuery"`
+		} `json:"extensions"`
+	}
+
+	gqlResponse struct {
+		Data   interface{} `json:"data,omitempty"`
+		Errors []*gqlError `json:"errors,omitempty"`
+	}
+)
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	paths := map[string]struct{}{}
+	for _, r := range spec.Resolvers {
+		if !strings.HasPrefix(r.Path, "query.") && !strings.HasPrefix(r.Path, "mutation.") {
+			return fmt.Errorf("path %s doesn't start with query. or mutation.", r.Path)
+		}
+		if _, ok := paths[r.Path]; ok {
+			return fmt.Errorf("duplicated path %s", r.Path)
+		}
+		paths[r.Path] = struct{}{}
+
+		if _, err := newTemplate(r.URL); err != nil {
+			return fmt.Errorf("path %s: invalid url template: %v", r.Path, err)
+		}
+		if _, err := newTemplate(r.Body); err != nil {
+			return fmt.Errorf("path %s: invalid body template: %v", r.Path, err)
+		}
+	}
+
+	for hash, query := range spec.PersistedQueries {
+		if hashQuery(query) != strings.ToLower(hash) {
+			return fmt.Errorf("hash of persisted query %s mismatch", hash)
+		}
+		if _, err := parseDocument(query); err != nil {
+			return fmt.Errorf("persisted query %s: %v", hash, err)
+		}
+	}
+
+	if spec.PersistedQueriesOnly && spec.AutomaticPersistedQueries {
+		return fmt.Errorf("persistedQueriesOnly and automaticPersistedQueries are exclusive")
+	}
+	return nil
+}
+
+func newTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(sprig.TxtFuncMap()).Parse(text)
+}
+
+func hashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// Name returns the name of the GraphQLBackend filter instance.
+func (gb *GraphQLBackend) Name() string {
+	return gb.spec.Name()
+}
+
+// Kind returns the kind of GraphQLBackend.
+func (gb *GraphQLBackend) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the GraphQLBackend.
+func (gb *GraphQLBackend) Spec() filters.Spec {
+	return gb.spec
+}
+
+// Init initializes GraphQLBackend.
+func (gb *GraphQLBackend) Init() {
+	gb.reload()
+}
+
+// Inherit inherits previous generation of GraphQLBackend.
+func (gb *GraphQLBackend) Inherit(previousGeneration filters.Filter) {
+	gb.Init()
+}
+
+func (gb *GraphQLBackend) reload() {
+	gb.maxDepth, gb.maxFields = gb.spec.MaxDepth, gb.spec.MaxComplexity
+	if gb.maxDepth == 0 {
+		gb.maxDepth = defaultMaxDepth
+	}
+	if gb.maxFields == 0 {
+		gb.maxFields = defaultMaxComplexity
+	}
+
+	gb.resolvers = make(map[string]*resolver, len(gb.spec.Resolvers))
+	for _, r := range gb.spec.Resolvers {
+		timeout := defaultTimeout
+		if r.Timeout != "" {
+			d, err := time.ParseDuration(r.Timeout)
+			if err != nil {
+				logger.Errorf("BUG: parse duration %s failed: %v", r.Timeout, err)
+			} else {
+				timeout = d
+			}
+		}
+		gb.resolvers[r.Path] = &resolver{
+			spec:    r,
+			url:     template.Must(newTemplate(r.URL)),
+			body:    template.Must(newTemplate(r.Body)),
+			timeout: timeout,
+		}
+	}
+
+	gb.persisted = make(map[string]*document, len(gb.spec.PersistedQueries))
+	for hash, query := range gb.spec.PersistedQueries {
+		doc, err := parseDocument(query)
+		if err != nil {
+			logger.Errorf("BUG: parse persisted query %s failed: %v", hash, err)
+			continue
+		}
+		gb.persisted[strings.ToLower(hash)] = doc
+	}
+	gb.automatic = map[string]*document{}
+}
+
+// Handle handles the GraphQL request.
+func (gb *GraphQLBackend) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	gr, code, err := parseRequest(req)
+	if err != nil {
+		gb.buildResponse(ctx, code, &gqlResponse{Errors: []*gqlError{{Message: err.Error()}}})
+		return resultInvalid
+	}
+
+	doc, gqlErr := gb.getDocument(gr)
+	if gqlErr != nil {
+		// the client should retry with the query if it is not found.
+		code := http.StatusBadRequest
+		if gqlErr.Extensions != nil {
+			code = http.StatusOK
+		}
+		gb.buildResponse(ctx, code, &gqlResponse{Errors: []*gqlError{gqlErr}})
+		return resultInvalid
+	}
+
+	e, err := newExecutor(doc, gr.OperationName, gr.Variables)
+	if err == nil && e.op.kind == "mutation" && req.Method() == http.MethodGet {
+		gb.buildResponse(ctx, http.StatusMethodNotAllowed, &gqlResponse{
+			Errors: []*gqlError{{Message: "mutations are not allowed in GET requests"}},
+		})
+		return resultInvalid
+	}
+	if err == nil {
+		err = gb.checkLimits(e)
+	}
+	if err != nil {
+		gb.buildResponse(ctx, http.StatusBadRequest, &gqlResponse{Errors: []*gqlError{{Message: err.Error()}}})
+		return resultInvalid
+	}
+
+	e.resolvers, e.req = gb.resolvers, req
+	data := e.execute()
+	gb.buildResponse(ctx, http.StatusOK, &gqlResponse{Data: data, Errors: e.errors})
+	return ""
+}
+
+// parseRequest parses the GraphQL request from the query of GET requests
+// or the body of POST requests.
+func parseRequest(req *httpprot.Request) (*gqlRequest, int, error) {
+	gr := &gqlRequest{}
+
+	switch req.Method() {
+	case http.MethodGet:
+		q := req.URL().Query()
+		gr.Query, gr.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := codectool.UnmarshalJSON([]byte(v), &gr.Variables); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid variables: %v", err)
+			}
+		}
+		if v := q.Get("extensions"); v != "" {
+			if err := codectool.UnmarshalJSON([]byte(v), &gr.Extensions); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid extensions: %v", err)
+			}
+		}
+	case http.MethodPost:
+		if err := codectool.UnmarshalJSON(req.RawPayload(), gr); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+		}
+	default:
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", req.Method())
+	}
+
+	return gr, 0, nil
+}
+
+// getDocument returns the document of the request, from the persisted
+// queries if the request has a hash.
+func (gb *GraphQLBackend) getDocument(gr *gqlRequest) (*document, *gqlError) {
+	hash := ""
+	if pq := gr.Extensions.PersistedQuery; pq != nil {
+		hash = strings.ToLower(pq.SHA256Hash)
+	}
+
+	if hash == "" {
+		if gb.spec.PersistedQueriesOnly {
+			return nil, &gqlError{Message: "only persisted queries are allowed"}
+		}
+		if gr.Query == "" {
+			return nil, &gqlError{Message: "query is required"}
+		}
+		doc, err := parseDocument(gr.Query)
+		if err != nil {
+			return nil, &gqlError{Message: err.Error()}
+		}
+		return doc, nil
+	}
+
+	if doc := gb.persisted[hash]; doc != nil {
+		return doc, nil
+	}
+	if !gb.spec.AutomaticPersistedQueries {
+		return nil, &gqlError{Message: "persisted query not found"}
+	}
+
+	gb.mutex.RLock()
+	doc := gb.automatic[hash]
+	gb.mutex.RUnlock()
+	if doc != nil {
+		return doc, nil
+	}
+
+	if gr.Query == "" {
+		return nil, &gqlError{
+			Message:    "PersistedQueryNotFound",
+			Extensions: map[string]interface{}{"code": "PERSISTED_QUERY_NOT_FOUND"},
+		}
+	}
+	if hashQuery(gr.Query) != hash {
+		return nil, &gqlError{Message: "provided sha does not match query"}
+	}
+
+	doc, err := parseDocument(gr.Query)
+	if err != nil {
+		return nil, &gqlError{Message: err.Error()}
+	}
+
+	gb.mutex.Lock()
+	if len(gb.automatic) >= maxAutomaticPersistedQueries {
+		// evict an arbitrary query to make room for the new one.
+		for k := range gb.automatic {
+			delete(gb.automatic, k)
+			break
+		}
+	}
+	gb.automatic[hash] = doc
+	gb.mutex.Unlock()
+	return doc, nil
+}
+
+func (gb *GraphQLBackend) checkLimits(e *executor) error {
+	depth, count, err := e.measure(e.op.selections, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	if depth > gb.maxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit %d", depth, gb.maxDepth)
+	}
+	if count > gb.maxFields {
+		return fmt.Errorf("query complexity %d exceeds the limit %d", count, gb.maxFields)
+	}
+	return nil
+}
+
+func (gb *GraphQLBackend) buildResponse(ctx *context.Context, code int, body *gqlResponse) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	data, err := codectool.MarshalJSON(body)
+	if err != nil {
+		logger.Errorf("%s: marshal response failed: %v", gb.Name(), err)
+		code, data = http.StatusInternalServerError, nil
+	}
+
+	resp.SetStatusCode(code)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(data)
+	ctx.SetOutputResponse(resp)
+}
+
+// resolve calls the backend and returns the value of the field.
+func (r *resolver) resolve(req *httpprot.Request, args map[string]interface{}, parent map[string]interface{}) (interface{}, error) {
+	data := map[string]interface{}{"args": args, "parent": parent}
+
+	var url, body bytes.Buffer
+	if err := r.url.Execute(&url, data); err != nil {
+		return nil, fmt.Errorf("build url failed: %v", err)
+	}
+	if err := r.body.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("build body failed: %v", err)
+	}
+
+	method := r.spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	timeoutCtx, cancel := stdcontext.WithTimeout(req.Context(), r.timeout)
+	defer cancel()
+
+	var bodyReader io.Reader
+	if body.Len() > 0 {
+		bodyReader = &body
+	}
+	stdr, err := http.NewRequestWithContext(timeoutCtx, method, url.String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	if bodyReader != nil {
+		stdr.Header.Set("Content-Type", "application/json")
+	}
+	for _, k := range r.spec.ForwardHeaders {
+		if v := req.HTTPHeader().Values(k); len(v) > 0 {
+			stdr.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	resp, err := globalClient.Do(stdr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("backend returns status code %d", resp.StatusCode)
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(respBody) > maxBodySize {
+		return nil, fmt.Errorf("response body is larger than %dB", maxBodySize)
+	}
+
+	var value interface{}
+	if len(respBody) > 0 {
+		if err = codectool.UnmarshalJSON(respBody, &value); err != nil {
+			return nil, fmt.Errorf("invalid JSON response: %v", err)
+		}
+	}
+
+	if r.spec.Extract != "" {
+		for _, key := range strings.Split(r.spec.Extract, ".") {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			value = m[key]
+		}
+	}
+	return value, nil
+}
+
+// Status returns status.
+func (gb *GraphQLBackend) Status() interface{} {
+	return nil
+}
+
+// Close closes GraphQLBackend.
+func (gb *GraphQLBackend) Close() {}
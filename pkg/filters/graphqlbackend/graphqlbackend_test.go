@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphqlbackend
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestGraphQLBackend(assert *assert.Assertions, yamlConfig string) *GraphQLBackend {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	gb := kind.CreateInstance(spec).(*GraphQLBackend)
+	gb.Init()
+	return gb
+}
+
+func newTestContext(method, url, body string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	stdr.Header.Set("Authorization", "token")
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func newTestBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/users/1":
+			if r.Header.Get("Authorization") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"data": {"id": "1", "name": "alice", "address": {"city": "Paris"}}}`))
+		case r.URL.Path == "/users/1/orders":
+			w.Write([]byte(`[{"id": "o1", "amount": 10}, {"id": "o2", "amount": 20}]`))
+		case r.URL.Path == "/orders" && r.Method == http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte(`{"id": "o3", "request": ` + string(body) + `}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func handle(assert *assert.Assertions, gb *GraphQLBackend, ctx *context.Context) (string, int, string) {
+	result := gb.Handle(ctx)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	return result, resp.StatusCode(), string(resp.RawPayload())
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Resolvers: []*Resolver{{Path: "user", URL: "http://127.0.0.1"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Resolvers: []*Resolver{{Path: "query.user", URL: "{{.args"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Resolvers: []*Resolver{
+		{Path: "query.user", URL: "http://127.0.0.1"},
+		{Path: "query.user", URL: "http://127.0.0.1"},
+	}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{
+		Resolvers:        []*Resolver{{Path: "query.user", URL: "http://127.0.0.1"}},
+		PersistedQueries: map[string]string{"abc": "{ user { id } }"},
+	}
+	assert.Error(spec.Validate())
+
+	spec.PersistedQueries = map[string]string{hashQuery("{ user { id } }"): "{ user { id } }"}
+	assert.NoError(spec.Validate())
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := newTestBackend()
+	defer backend.Close()
+
+	gb := newTestGraphQLBackend(assert, `
+kind: GraphQLBackend
+name: gb
+maxDepth: 3
+resolvers:
+- path: query.user
+  url: `+backend.URL+`/users/{{.args.id}}
+  forwardHeaders: [Authorization]
+  extract: data
+- path: query.user.orders
+  url: `+backend.URL+`/users/{{.parent.id}}/orders
+- path: query.missing
+  url: `+backend.URL+`/missing
+- path: mutation.createOrder
+  url: `+backend.URL+`/orders
+  method: POST
+  body: '{"amount": {{.args.amount}}}'
+`)
+	defer gb.Close()
+
+	query := `query($id: ID!) {
+  missing
+  user(id: $id) {
+    name
+    address { city }
+    orders { id amount }
+  }
+}`
+	body := string(codectool.MustMarshalJSON(map[string]interface{}{
+		"query":     query,
+		"variables": map[string]interface{}{"id": "1"},
+	}))
+	result, code, payload := handle(assert, gb, newTestContext(http.MethodPost, "http://127.0.0.1/graphql", body))
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, code)
+	assert.JSONEq(`{
+  "data": {
+    "missing": null,
+    "user": {
+      "name": "alice",
+      "address": {"city": "Paris"},
+      "orders": [{"id": "o1", "amount": 10}, {"id": "o2", "amount": 20}]
+    }
+  },
+  "errors": [{"message": "backend returns status code 404", "path": ["missing"]}]
+}`, payload)
+	// fields are in the order of the query.
+	assert.True(strings.Index(payload, `"missing"`) < strings.Index(payload, `"user"`))
+
+	// GET request.
+	q := url.Values{}
+	q.Set("query", `{ user(id: "1") { name } }`)
+	result, code, payload = handle(assert, gb, newTestContext(http.MethodGet, "http://127.0.0.1/graphql?"+q.Encode(), ""))
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, code)
+	assert.JSONEq(`{"data": {"user": {"name": "alice"}}}`, payload)
+
+	// mutation.
+	body = `{"query": "mutation { createOrder(amount: 30) { id request { amount } } }"}`
+	result, code, payload = handle(assert, gb, newTestContext(http.MethodPost, "http://127.0.0.1/graphql", body))
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, code)
+	assert.JSONEq(`{"data": {"createOrder": {"id": "o3", "request": {"amount": 30}}}}`, payload)
+
+	// mutations are not allowed in GET requests.
+	q.Set("query", `mutation { createOrder(amount: 30) { id } }`)
+	result, code, _ = handle(assert, gb, newTestContext(http.MethodGet, "http://127.0.0.1/graphql?"+q.Encode(), ""))
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusMethodNotAllowed, code)
+
+	// invalid requests.
+	for _, body := range []string{
+		`invalid`,
+		`{"query": "{ user(id: 1) { name "}`,
+		`{"query": "query($id: ID!) { user(id: $id) { name } }"}`,
+		`{"query": "{ user(id: 1) { orders { items { product { id } } } } }"}`,
+		`{"query": "{ user(id: 1) { ...f } } fragment f on User { ...f }"}`,
+	} {
+		result, code, _ = handle(assert, gb, newTestContext(http.MethodPost, "http://127.0.0.1/graphql", body))
+		assert.Equal(resultInvalid, result, body)
+		assert.Equal(http.StatusBadRequest, code, body)
+	}
+
+	result, code, _ = handle(assert, gb, newTestContext(http.MethodPut, "http://127.0.0.1/graphql", ""))
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusMethodNotAllowed, code)
+}
+
+func TestPersistedQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := newTestBackend()
+	defer backend.Close()
+
+	query := `{ user(id: "1") { name } }`
+	hash := hashQuery(query)
+
+	gb := newTestGraphQLBackend(assert, `
+kind: GraphQLBackend
+name: gb
+persistedQueriesOnly: true
+persistedQueries:
+  `+hash+`: '`+query+`'
+resolvers:
+- path: query.user
+  url: `+backend.URL+`/users/{{.args.id}}
+  forwardHeaders: [Authorization]
+  extract: data
+`)
+	defer gb.Close()
+
+	body := `{"extensions": {"persistedQuery": {"version": 1, "sha256Hash": "` + hash + `"}}}`
+	result, code, payload := handle(assert, gb, newTestContext(http.MethodPost, "http://127.0.0.1/graphql", body))
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, code)
+	assert.JSONEq(`{"data": {"user": {"name": "alice"}}}`, payload)
+
+	body = string(codectool.MustMarshalJSON(map[string]interface{}{"query": query}))
+	result, code, _ = handle(assert, gb, newTestContext(http.MethodPost, "http://127.0.0.1/graphql", body))
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusBadRequest, code)
+
+	// automatic persisted queries.
+	gb = newTestGraphQLBackend(assert, `
+kind: GraphQLBackend
+name: gb
+automaticPersistedQueries: true
+resolvers:
+- path: query.user
+  url: `+backend.URL+`/users/{{.args.id}}
+  forwardHeaders: [Authorization]
+  extract: data
+`)
+	defer gb.Close()
+
+	ext := `{"persistedQuery": {"version": 1, "sha256Hash": "` + hash + `"}}`
+	q := url.Values{}
+	q.Set("extensions", ext)
+	result, code, payload = handle(assert, gb, newTestContext(http.MethodGet, "http://127.0.0.1/graphql?"+q.Encode(), ""))
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusOK, code)
+	assert.Contains(payload, "PERSISTED_QUERY_NOT_FOUND")
+
+	q.Set("query", `{ user(id: "2") { name } }`)
+	result, code, _ = handle(assert, gb, newTestContext(http.MethodGet, "http://127.0.0.1/graphql?"+q.Encode(), ""))
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusBadRequest, code)
+
+	q.Set("query", query)
+	result, _, payload = handle(assert, gb, newTestContext(http.MethodGet, "http://127.0.0.1/graphql?"+q.Encode(), ""))
+	assert.Equal("", result)
+	assert.JSONEq(`{"data": {"user": {"name": "alice"}}}`, payload)
+
+	q.Del("query")
+	result, _, payload = handle(assert, gb, newTestContext(http.MethodGet, "http://127.0.0.1/graphql?"+q.Encode(), ""))
+	assert.Equal("", result)
+	assert.JSONEq(`{"data": {"user": {"name": "alice"}}}`, payload)
+}
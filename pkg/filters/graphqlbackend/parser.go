@@ -0,0 +1,532 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphqlbackend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements a parser of the executable documents of GraphQL,
+// that's the operations and fragments, type system definitions are not
+// supported because the filter has no schema.
+
+type (
+	document struct {
+		operations []*operation
+		fragments  map[string]*fragment
+	}
+
+	operation struct {
+		kind       string
+		name       string
+		variables  []*variableDef
+		directives []*directive
+		selections []selection
+	}
+
+	variableDef struct {
+		name         string
+		nonNull      bool
+		hasDefault   bool
+		defaultValue interface{}
+	}
+
+	fragment struct {
+		name       string
+		typeCond   string
+		directives []*directive
+		selections []selection
+	}
+
+	// selection is one of *field, *fragmentSpread and *inlineFragment.
+	selection interface{}
+
+	field struct {
+		alias      string
+		name       string
+		args       []*argument
+		directives []*directive
+		selections []selection
+	}
+
+	fragmentSpread struct {
+		name       string
+		directives []*directive
+	}
+
+	inlineFragment struct {
+		typeCond   string
+		directives []*directive
+		selections []selection
+	}
+
+	argument struct {
+		name  string
+		value interface{}
+	}
+
+	directive struct {
+		name string
+		args []*argument
+	}
+
+	// variableRef is a reference of a variable in a value, the other
+	// values are int64, float64, string, bool, nil, []interface{} and
+	// map[string]interface{}, enums are strings.
+	variableRef struct {
+		name string
+	}
+
+	tokenKind int
+
+	token struct {
+		kind  tokenKind
+		value string
+		pos   int
+	}
+
+	lexer struct {
+		src string
+		pos int
+	}
+
+	parser struct {
+		lexer *lexer
+		token token
+	}
+)
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// next returns the next token, white spaces, commas and comments are
+// ignored.
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+			continue
+		}
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		break
+	}
+
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$&()[]{}:=@|", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunct, value: string(c), pos: start}, nil
+	case c == '.':
+		if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.pos += 3
+			return token{kind: tokenPunct, value: "...", pos: start}, nil
+		}
+	case isNameStart(c):
+		for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+
+	return token{}, fmt.Errorf("unexpected character %q at %d", c, start)
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokenInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	digits()
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokenFloat
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+	return token{kind: kind, value: l.src[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+
+	// block string, the common indentation is not removed.
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+		}
+		value := l.src[l.pos+3 : l.pos+3+end]
+		l.pos += end + 6
+		return token{kind: tokenString, value: strings.TrimSpace(value), pos: start}, nil
+	}
+
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+			continue
+		case '\n', '\r':
+			return token{}, fmt.Errorf("unterminated string at %d", start)
+		case '"':
+			l.pos++
+			value, err := strconv.Unquote(l.src[start:l.pos])
+			if err != nil {
+				return token{}, fmt.Errorf("invalid string at %d: %v", start, err)
+			}
+			return token{kind: tokenString, value: value, pos: start}, nil
+		}
+		l.pos++
+	}
+	return token{}, fmt.Errorf("unterminated string at %d", start)
+}
+
+// parseDocument parses an executable document.
+func parseDocument(src string) (doc *document, err error) {
+	p := &parser{lexer: &lexer{src: src}}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, e
+		}
+	}()
+
+	p.advance()
+	doc = &document{fragments: map[string]*fragment{}}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunct, "{"):
+			doc.operations = append(doc.operations, &operation{
+				kind:       "query",
+				selections: p.parseSelectionSet(),
+			})
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"), p.peek(tokenName, "subscription"):
+			doc.operations = append(doc.operations, p.parseOperation())
+		case p.peek(tokenName, "fragment"):
+			f := p.parseFragment()
+			if _, ok := doc.fragments[f.name]; ok {
+				p.fail("duplicated fragment %s", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			p.fail("unexpected %q", p.token.value)
+		}
+	}
+
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	panic(fmt.Errorf("syntax error at %d: %s", p.token.pos, msg))
+}
+
+func (p *parser) advance() {
+	t, err := p.lexer.next()
+	if err != nil {
+		panic(fmt.Errorf("syntax error: %v", err))
+	}
+	p.token = t
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+// skip advances and returns true if the current token is the punctuator.
+func (p *parser) skip(punct string) bool {
+	if p.peek(tokenPunct, punct) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) {
+	if !p.skip(punct) {
+		p.fail("expected %q, got %q", punct, p.token.value)
+	}
+}
+
+func (p *parser) parseName() string {
+	if p.token.kind != tokenName {
+		p.fail("expected a name, got %q", p.token.value)
+	}
+	name := p.token.value
+	p.advance()
+	return name
+}
+
+func (p *parser) parseOperation() *operation {
+	op := &operation{kind: p.parseName()}
+	if p.token.kind == tokenName {
+		op.name = p.parseName()
+	}
+
+	if p.skip("(") {
+		for !p.skip(")") {
+			op.variables = append(op.variables, p.parseVariableDef())
+		}
+	}
+
+	op.directives = p.parseDirectives()
+	op.selections = p.parseSelectionSet()
+	return op
+}
+
+func (p *parser) parseVariableDef() *variableDef {
+	p.expect("$")
+	v := &variableDef{name: p.parseName()}
+	p.expect(":")
+	v.nonNull = p.parseType()
+	if p.skip("=") {
+		v.hasDefault = true
+		v.defaultValue = p.parseValue(true)
+	}
+	// directives of variables are ignored.
+	p.parseDirectives()
+	return v
+}
+
+// parseType parses a type reference, the type is ignored except whether it
+// is non-null.
+func (p *parser) parseType() bool {
+	if p.skip("[") {
+		p.parseType()
+		p.expect("]")
+	} else {
+		p.parseName()
+	}
+	return p.skip("!")
+}
+
+func (p *parser) parseFragment() *fragment {
+	p.parseName()
+	f := &fragment{name: p.parseName()}
+	if f.name == "on" {
+		p.fail("invalid fragment name")
+	}
+	if !p.peek(tokenName, "on") {
+		p.fail("expected type condition")
+	}
+	p.advance()
+	f.typeCond = p.parseName()
+	f.directives = p.parseDirectives()
+	f.selections = p.parseSelectionSet()
+	return f
+}
+
+func (p *parser) parseSelectionSet() []selection {
+	p.expect("{")
+	var selections []selection
+	for !p.skip("}") {
+		selections = append(selections, p.parseSelection())
+	}
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	return selections
+}
+
+func (p *parser) parseSelection() selection {
+	if p.skip("...") {
+		if p.token.kind == tokenName && p.token.value != "on" {
+			return &fragmentSpread{name: p.parseName(), directives: p.parseDirectives()}
+		}
+		inline := &inlineFragment{}
+		if p.peek(tokenName, "on") {
+			p.advance()
+			inline.typeCond = p.parseName()
+		}
+		inline.directives = p.parseDirectives()
+		inline.selections = p.parseSelectionSet()
+		return inline
+	}
+
+	f := &field{name: p.parseName()}
+	if p.skip(":") {
+		f.alias, f.name = f.name, p.parseName()
+	}
+	f.args = p.parseArguments(false)
+	f.directives = p.parseDirectives()
+	if p.peek(tokenPunct, "{") {
+		f.selections = p.parseSelectionSet()
+	}
+	return f
+}
+
+func (p *parser) parseArguments(constant bool) []*argument {
+	if !p.skip("(") {
+		return nil
+	}
+	var args []*argument
+	for !p.skip(")") {
+		arg := &argument{name: p.parseName()}
+		p.expect(":")
+		arg.value = p.parseValue(constant)
+		args = append(args, arg)
+	}
+	return args
+}
+
+func (p *parser) parseDirectives() []*directive {
+	var directives []*directive
+	for p.skip("@") {
+		d := &directive{name: p.parseName()}
+		d.args = p.parseArguments(false)
+		directives = append(directives, d)
+	}
+	return directives
+}
+
+func (p *parser) parseValue(constant bool) interface{} {
+	t := p.token
+	switch t.kind {
+	case tokenInt:
+		p.advance()
+		n, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			p.fail("invalid int %s", t.value)
+		}
+		return n
+	case tokenFloat:
+		p.advance()
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			p.fail("invalid float %s", t.value)
+		}
+		return f
+	case tokenString:
+		p.advance()
+		return t.value
+	case tokenName:
+		p.advance()
+		switch t.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return t.value
+	}
+
+	switch {
+	case p.skip("$"):
+		if constant {
+			p.fail("unexpected variable")
+		}
+		return &variableRef{name: p.parseName()}
+	case p.skip("["):
+		list := []interface{}{}
+		for !p.skip("]") {
+			list = append(list, p.parseValue(constant))
+		}
+		return list
+	case p.skip("{"):
+		obj := map[string]interface{}{}
+		for !p.skip("}") {
+			name := p.parseName()
+			p.expect(":")
+			obj[name] = p.parseValue(constant)
+		}
+		return obj
+	}
+
+	p.fail("unexpected %q", t.value)
+	return nil
+}
+
+// resolveValue replaces the variable references in v with their values.
+func resolveValue(v interface{}, variables map[string]interface{}) interface{} {
+	switch v := v.(type) {
+	case *variableRef:
+		return variables[v.name]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = resolveValue(item, variables)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			obj[k] = resolveValue(item, variables)
+		}
+		return obj
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphqlbackend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocument(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := parseDocument(`
+# a comment
+query GetUser($id: ID!, $withOrders: Boolean = true) {
+  me: user(id: $id, tags: ["a", "b"], filter: {min: 1.5, active: true}) {
+    name
+    ...orderFields @include(if: $withOrders)
+    ... on User { email }
+  }
+}
+
+fragment orderFields on User {
+  orders(first: 10) { id }
+}
+`)
+	assert.NoError(err)
+	assert.Len(doc.operations, 1)
+
+	op := doc.operations[0]
+	assert.Equal("query", op.kind)
+	assert.Equal("GetUser", op.name)
+	assert.Len(op.variables, 2)
+	assert.True(op.variables[0].nonNull)
+	assert.Equal(true, op.variables[1].defaultValue)
+
+	f := op.selections[0].(*field)
+	assert.Equal("me", f.responseKey())
+	assert.Equal("user", f.name)
+	assert.Len(f.args, 3)
+	assert.Equal("abc", resolveValue(f.args[0].value, map[string]interface{}{"id": "abc"}))
+	assert.Equal([]interface{}{"a", "b"}, resolveValue(f.args[1].value, nil))
+	assert.Equal(map[string]interface{}{"min": 1.5, "active": true}, resolveValue(f.args[2].value, nil))
+	assert.Len(f.selections, 3)
+	assert.Contains(doc.fragments, "orderFields")
+
+	// shorthand query.
+	doc, err = parseDocument(`{ users { id } }`)
+	assert.NoError(err)
+	assert.Equal("query", doc.operations[0].kind)
+
+	for _, src := range []string{
+		``,
+		`{ user(id: ) { id } }`,
+		`query { user { id }`,
+		`{ user(name: "abc) }`,
+		`fragment f on User { id }`,
+	} {
+		_, err = parseDocument(src)
+		assert.Error(err, src)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcproxy provides the GRPCProxy filter.
+package grpcproxy
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+)
+
+const (
+	// Kind is the kind of GRPCProxy.
+	Kind = "GRPCProxy"
+
+	resultInternalError = "internalError"
+	resultClientError   = "clientError"
+	resultServerError   = "serverError"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "GRPCProxy sets the proxy of gRPC servers",
+	Results: []string{
+		resultInternalError,
+		resultClientError,
+		resultServerError,
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &GRPCProxy{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*GRPCProxy)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// GRPCProxy is the filter GRPCProxy.
+	GRPCProxy struct {
+		spec *Spec
+
+		mainPool       *serverPool
+		candidatePools []*serverPool
+	}
+
+	// Spec describes the GRPCProxy.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Pools []*ServerPoolSpec `json:"pools" jsonschema:"required"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	numMainPool := 0
+	for i, pool := range s.Pools {
+		if pool.Filter == nil {
+			numMainPool++
+		}
+		if err := pool.Validate(); err != nil {
+			return fmt.Errorf("pool %d: %v", i, err)
+		}
+	}
+
+	if numMainPool != 1 {
+		return fmt.Errorf("one and only one mainPool is required")
+	}
+
+	return nil
+}
+
+// Name returns the name of the GRPCProxy filter instance.
+func (p *GRPCProxy) Name() string {
+	return p.spec.Name()
+}
+
+// Kind returns the kind of GRPCProxy.
+func (p *GRPCProxy) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the GRPCProxy
+func (p *GRPCProxy) Spec() filters.Spec {
+	return p.spec
+}
+
+// Init initializes GRPCProxy.
+func (p *GRPCProxy) Init() {
+	p.reload()
+}
+
+// Inherit inherits previous generation of GRPCProxy.
+func (p *GRPCProxy) Inherit(previousGeneration filters.Filter) {
+	p.reload()
+}
+
+func (p *GRPCProxy) reload() {
+	for _, spec := range p.spec.Pools {
+		name := ""
+		if spec.Filter == nil {
+			name = fmt.Sprintf("proxy#%s#main", p.Name())
+		} else {
+			id := len(p.candidatePools)
+			name = fmt.Sprintf("proxy#%s#candidate#%d", p.Name(), id)
+		}
+
+		pool := newServerPool(name, spec)
+		if spec.Filter == nil {
+			p.mainPool = pool
+		} else {
+			p.candidatePools = append(p.candidatePools, pool)
+		}
+	}
+}
+
+// Status returns GRPCProxy status.
+func (p *GRPCProxy) Status() interface{} {
+	return nil
+}
+
+// Close closes GRPCProxy.
+func (p *GRPCProxy) Close() {
+	p.mainPool.close()
+
+	for _, v := range p.candidatePools {
+		v.close()
+	}
+}
+
+// Handle handles GRPCContext.
+func (p *GRPCProxy) Handle(ctx *context.Context) (result string) {
+	req, ok := ctx.GetInputRequest().(*grpcprot.Request)
+	if !ok {
+		logger.Errorf("%s: expect a gRPC request", p.Name())
+		resp := grpcprot.NewResponse()
+		resp.SetStatus(status.New(codes.Internal, "request is not a gRPC request"))
+		ctx.SetOutputResponse(resp)
+		return resultInternalError
+	}
+
+	sp := p.mainPool
+	for _, v := range p.candidatePools {
+		if v.filter.Match(req) {
+			sp = v
+			break
+		}
+	}
+
+	return sp.handle(ctx, req)
+}
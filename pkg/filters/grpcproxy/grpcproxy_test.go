@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcproxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/loadbalance"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestGRPCProxy(yamlConfig string, assert *assert.Assertions) *GRPCProxy {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlConfig), &rawSpec)
+	assert.NoError(err)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+
+	proxy := kind.CreateInstance(spec).(*GRPCProxy)
+	proxy.Init()
+
+	assert.Equal(kind, proxy.Kind())
+	assert.Equal(spec, proxy.Spec())
+	return proxy
+}
+
+type upstream struct {
+	addr     string
+	health   *health.Server
+	server   *grpc.Server
+	md       metadata.MD
+	deadline bool
+}
+
+func startUpstream(assert *assert.Assertions) *upstream {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+
+	u := &upstream{addr: l.Addr().String(), health: health.NewServer()}
+	u.server = grpc.NewServer(grpc.UnaryInterceptor(func(ctx stdcontext.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		u.md, _ = metadata.FromIncomingContext(ctx)
+		_, u.deadline = ctx.Deadline()
+		grpc.SetHeader(ctx, metadata.Pairs("x-upstream", u.addr))
+		return handler(ctx, req)
+	}))
+	grpc_health_v1.RegisterHealthServer(u.server, u.health)
+	go u.server.Serve(l)
+	return u
+}
+
+// startFrontend starts a gRPC server which handles all calls by proxy.
+func startFrontend(proxy *GRPCProxy, assert *assert.Assertions) (*grpc.Server, *grpc.ClientConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, grpcprot.NewRequest(stream))
+		proxy.Handle(ctx)
+		resp := ctx.GetOutputResponse().(*grpcprot.Response)
+		stream.SetTrailer(resp.Trailer().RawHeader())
+		return resp.Status().Err()
+	}
+	server := grpc.NewServer(grpc.UnknownServiceHandler(handler), grpc.ForceServerCodec(grpcprot.Codec{}))
+	go server.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(err)
+	return server, conn
+}
+
+func TestGRPCProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	main, candidate := startUpstream(assert), startUpstream(assert)
+	defer main.server.Stop()
+	defer candidate.server.Stop()
+	main.health.SetServingStatus("svc", grpc_health_v1.HealthCheckResponse_SERVING)
+	candidate.health.SetServingStatus("svc", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+
+	proxy := newTestGRPCProxy(fmt.Sprintf(`
+name: grpcproxy
+kind: GRPCProxy
+pools:
+- servers:
+  - address: %s
+  timeout: 200ms
+- servers:
+  - address: %s
+  filter:
+    headers:
+      x-canary: "true"
+`, main.addr, candidate.addr), assert)
+	defer proxy.Close()
+
+	server, conn := startFrontend(proxy, assert)
+	defer server.Stop()
+	defer conn.Close()
+	client := grpc_health_v1.NewHealthClient(conn)
+
+	// unary call, the metadata and deadline are propagated.
+	callCtx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 5*time.Second)
+	defer cancel()
+	callCtx = metadata.AppendToOutgoingContext(callCtx, "x-test", "value")
+	var header metadata.MD
+	resp, err := client.Check(callCtx, &grpc_health_v1.HealthCheckRequest{Service: "svc"}, grpc.Header(&header))
+	assert.NoError(err)
+	assert.Equal(grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	assert.Equal([]string{"value"}, main.md.Get("x-test"))
+	assert.True(main.deadline)
+	assert.Equal([]string{main.addr}, header.Get("x-upstream"))
+
+	// errors of the upstream are returned as is.
+	_, err = client.Check(callCtx, &grpc_health_v1.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	// the candidate pool.
+	canaryCtx := metadata.AppendToOutgoingContext(callCtx, "x-canary", "true")
+	resp, err = client.Check(canaryCtx, &grpc_health_v1.HealthCheckRequest{Service: "svc"})
+	assert.NoError(err)
+	assert.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	// streaming call, which is canceled by the timeout of the pool.
+	stream, err := client.Watch(callCtx, &grpc_health_v1.HealthCheckRequest{Service: "svc"})
+	assert.NoError(err)
+	resp, err = stream.Recv()
+	assert.NoError(err)
+	assert.Equal(grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+	main.health.SetServingStatus("svc", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	resp, err = stream.Recv()
+	assert.NoError(err)
+	assert.Equal(grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+	_, err = stream.Recv()
+	assert.Equal(codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Pools: []*ServerPoolSpec{{Servers: []*Server{{Address: "127.0.0.1:8080"}}}}}
+	assert.NoError(spec.Validate())
+
+	spec.Pools[0].Filter = &RequestMatcherSpec{Methods: []string{"/svc/Method"}}
+	assert.Error(spec.Validate())
+
+	spec.Pools[0].Filter = nil
+	spec.Pools[0].Timeout = "1x"
+	assert.Error(spec.Validate())
+
+	spec.Pools[0].Timeout = ""
+	spec.Pools[0].Servers = nil
+	assert.Error(spec.Validate())
+}
+
+func TestLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := []*Server{{Address: "a", Weight: 1}, {Address: "b", Weight: 0}}
+
+	lb := NewLoadBalancer(&LoadBalanceSpec{}, servers)
+	assert.Equal("a", lb.ChooseServer(nil).Address)
+	assert.Equal("b", lb.ChooseServer(nil).Address)
+	assert.Equal("a", lb.ChooseServer(nil).Address)
+
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: loadbalance.PolicyWeightedRandom}, servers)
+	for i := 0; i < 10; i++ {
+		assert.Equal("a", lb.ChooseServer(nil).Address)
+	}
+
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: loadbalance.PolicyRandom}, nil)
+	assert.Nil(lb.ChooseServer(nil))
+
+	assert.Error((&LoadBalanceSpec{Policy: loadbalance.PolicyHeaderHash}).Validate())
+}
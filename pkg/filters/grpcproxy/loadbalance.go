@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcproxy
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/pkg/util/loadbalance"
+)
+
+// Server is the gRPC server to proxy to.
+type Server struct {
+	Address string `json:"address" jsonschema:"required"`
+	Weight  int    `json:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
+}
+
+// String implements the Stringer interface.
+func (s *Server) String() string {
+	return fmt.Sprintf("%s,%d", s.Address, s.Weight)
+}
+
+// LoadBalancer is the interface of a gRPC load balancer.
+type LoadBalancer interface {
+	ChooseServer(req *grpcprot.Request) *Server
+}
+
+// LoadBalanceSpec is the spec to create a load balancer.
+type LoadBalanceSpec struct {
+	Policy        string `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
+	HeaderHashKey string `json:"headerHashKey" jsonschema:"omitempty"`
+}
+
+// Validate validates LoadBalanceSpec.
+func (s *LoadBalanceSpec) Validate() error {
+	if s.Policy == loadbalance.PolicyHeaderHash && s.HeaderHashKey == "" {
+		return fmt.Errorf("headerHash needs to specify headerHashKey")
+	}
+	return nil
+}
+
+// NewLoadBalancer creates a load balancer for servers according to spec.
+func NewLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
+	policy := spec.Policy
+	switch policy {
+	case loadbalance.PolicyRoundRobin, loadbalance.PolicyRandom,
+		loadbalance.PolicyWeightedRandom, loadbalance.PolicyIPHash,
+		loadbalance.PolicyHeaderHash:
+	case "":
+		policy = loadbalance.PolicyRoundRobin
+	default:
+		logger.Errorf("unsupported load balancing policy: %s", spec.Policy)
+		policy = loadbalance.PolicyRoundRobin
+	}
+
+	// only the weighted random policy takes the weights of the servers.
+	weights := make([]int, len(servers))
+	if policy == loadbalance.PolicyWeightedRandom {
+		for i, server := range servers {
+			weights[i] = server.Weight
+		}
+	}
+
+	return &loadBalancer{
+		policy:   policy,
+		key:      spec.HeaderHashKey,
+		servers:  servers,
+		weighted: loadbalance.NewWeighted(weights),
+	}
+}
+
+// loadBalancer chooses the servers by the policy.
+type loadBalancer struct {
+	policy   string
+	key      string
+	servers  []*Server
+	weighted *loadbalance.Weighted
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *loadBalancer) ChooseServer(req *grpcprot.Request) *Server {
+	var i int
+	switch lb.policy {
+	case loadbalance.PolicyRandom, loadbalance.PolicyWeightedRandom:
+		i = lb.weighted.Random()
+	case loadbalance.PolicyIPHash:
+		i = lb.weighted.Hash(req.RealIP())
+	case loadbalance.PolicyHeaderHash:
+		i = lb.weighted.Hash(req.Header().Get(lb.key).(string))
+	default:
+		i = lb.weighted.RoundRobin()
+	}
+	if i < 0 {
+		return nil
+	}
+	return lb.servers[i]
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcproxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+// streamDesc describes a bidirectional stream, which can forward all kinds
+// of calls, including unary ones.
+var streamDesc = &grpc.StreamDesc{
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+type (
+	// ServerPoolSpec is the spec for a server pool.
+	ServerPoolSpec struct {
+		SpanName    string              `json:"spanName" jsonschema:"omitempty"`
+		Filter      *RequestMatcherSpec `json:"filter" jsonschema:"omitempty"`
+		Servers     []*Server           `json:"servers" jsonschema:"required"`
+		LoadBalance *LoadBalanceSpec    `json:"loadBalance" jsonschema:"omitempty"`
+		Timeout     string              `json:"timeout" jsonschema:"omitempty,format=duration"`
+		TLS         bool                `json:"tls" jsonschema:"omitempty"`
+	}
+
+	// RequestMatcherSpec describes the requests to be handled by a
+	// candidate pool, a request matches if its full method is one of
+	// Methods (any method if empty), and all the metadata in Headers
+	// have the given values.
+	RequestMatcherSpec struct {
+		Methods []string          `json:"methods" jsonschema:"omitempty"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+	}
+
+	serverPool struct {
+		name    string
+		spec    *ServerPoolSpec
+		filter  *RequestMatcherSpec
+		lb      LoadBalancer
+		timeout time.Duration
+		conns   map[string]*grpc.ClientConn
+	}
+)
+
+// Validate validates ServerPoolSpec.
+func (s *ServerPoolSpec) Validate() error {
+	if len(s.Servers) == 0 {
+		return fmt.Errorf("servers is empty")
+	}
+	for _, svr := range s.Servers {
+		if svr.Address == "" {
+			return fmt.Errorf("server address is empty")
+		}
+	}
+	if s.Filter != nil && len(s.Filter.Methods) == 0 && len(s.Filter.Headers) == 0 {
+		return fmt.Errorf("filter is empty")
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", s.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// Match returns whether req matches the spec.
+func (s *RequestMatcherSpec) Match(req *grpcprot.Request) bool {
+	if len(s.Methods) > 0 {
+		found := false
+		for _, m := range s.Methods {
+			if m == req.FullMethod() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for k, v := range s.Headers {
+		if req.Header().Get(k).(string) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func newServerPool(name string, spec *ServerPoolSpec) *serverPool {
+	sp := &serverPool{
+		name:   name,
+		spec:   spec,
+		filter: spec.Filter,
+		conns:  map[string]*grpc.ClientConn{},
+	}
+
+	lbSpec := spec.LoadBalance
+	if lbSpec == nil {
+		lbSpec = &LoadBalanceSpec{}
+	}
+	sp.lb = NewLoadBalancer(lbSpec, spec.Servers)
+
+	if spec.Timeout != "" {
+		sp.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	creds := insecure.NewCredentials()
+	if spec.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	for _, svr := range spec.Servers {
+		if _, ok := sp.conns[svr.Address]; ok {
+			continue
+		}
+		// grpc.Dial does not block, connections are established in the
+		// background and reconnected automatically.
+		conn, err := grpc.Dial(svr.Address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			logger.Errorf("%s: dial %s failed: %v", name, svr.Address, err)
+			continue
+		}
+		sp.conns[svr.Address] = conn
+	}
+
+	return sp
+}
+
+func buildFailureResponse(ctx *context.Context, code codes.Code, msg string) {
+	resp := grpcprot.NewResponse()
+	resp.SetStatus(status.New(code, msg))
+	ctx.SetOutputResponse(resp)
+}
+
+// outgoingMD returns the metadata to be sent to the upstream, including
+// the tracing context of span.
+func outgoingMD(req *grpcprot.Request, span tracing.Span) metadata.MD {
+	md := req.GRPCHeader().ForwardableMD()
+
+	stdr := &http.Request{Header: http.Header{}}
+	span.InjectHTTP(stdr)
+	for k, v := range stdr.Header {
+		md.Set(strings.ToLower(k), v...)
+	}
+	return md
+}
+
+func (sp *serverPool) handle(ctx *context.Context, req *grpcprot.Request) string {
+	svr := sp.lb.ChooseServer(req)
+	if svr == nil {
+		buildFailureResponse(ctx, codes.Unavailable, "no available server")
+		return resultServerError
+	}
+	conn := sp.conns[svr.Address]
+	if conn == nil {
+		buildFailureResponse(ctx, codes.Unavailable, fmt.Sprintf("no connection to %s", svr.Address))
+		return resultServerError
+	}
+
+	spanName := sp.spec.SpanName
+	if spanName == "" {
+		spanName = sp.name
+	}
+	span := ctx.Span().NewChild(spanName)
+	defer span.Finish()
+	span.TagFromContext(tracing.AttributeUpstream, svr.Address)
+
+	// The deadline of the client is propagated to the upstream by the
+	// context of the request, the timeout of the pool shortens it.
+	stdctx, cancel := stdcontext.WithCancel(req.Context())
+	defer cancel()
+	if sp.timeout > 0 {
+		stdctx, cancel = stdcontext.WithTimeout(stdctx, sp.timeout)
+		defer cancel()
+	}
+	stdctx = metadata.NewOutgoingContext(stdctx, outgoingMD(req, span))
+
+	resp := grpcprot.NewResponse()
+	ctx.SetOutputResponse(resp)
+
+	result := sp.forward(stdctx, cancel, conn, req, resp)
+	if code := resp.Code(); code != codes.OK {
+		span.Tag(tracing.TagError, resp.Status().Message())
+	}
+	return result
+}
+
+// forward forwards the messages between the client stream and the
+// upstream stream, until the upstream finishes the call.
+func (sp *serverPool) forward(stdctx stdcontext.Context, cancel stdcontext.CancelFunc,
+	conn *grpc.ClientConn, req *grpcprot.Request, resp *grpcprot.Response) string {
+	upstream, err := conn.NewStream(stdctx, streamDesc, req.FullMethod(), grpc.ForceCodec(grpcprot.Codec{}))
+	if err != nil {
+		resp.SetStatus(status.Convert(err))
+		return resultServerError
+	}
+
+	downstream := req.Stream()
+	c2u := forwardClientToUpstream(downstream, upstream)
+	u2c := forwardUpstreamToClient(upstream, downstream, resp)
+
+	for {
+		select {
+		case err := <-c2u:
+			if err == io.EOF {
+				// The client finished sending, wait for the upstream.
+				upstream.CloseSend()
+				c2u = nil
+				continue
+			}
+			// The client failed or canceled, cancel the upstream call,
+			// and wait for the forwarding to stop.
+			cancel()
+			<-u2c
+			resp.SetStatus(status.Convert(err))
+			return resultClientError
+		case err := <-u2c:
+			resp.SetTrailer(upstream.Trailer())
+			if err == io.EOF {
+				return ""
+			}
+			// The status of the upstream is returned to the client as is.
+			resp.SetStatus(status.Convert(err))
+			return ""
+		}
+	}
+}
+
+func forwardClientToUpstream(src grpc.ServerStream, dst grpc.ClientStream) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		for {
+			f := &grpcprot.Frame{}
+			if err := src.RecvMsg(f); err != nil {
+				ch <- err
+				return
+			}
+			if err := dst.SendMsg(f); err != nil {
+				// The error of the upstream is returned by its RecvMsg,
+				// stop forwarding.
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func forwardUpstreamToClient(src grpc.ClientStream, dst grpc.ServerStream, resp *grpcprot.Response) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		headerSent := false
+		for {
+			f := &grpcprot.Frame{}
+			err := src.RecvMsg(f)
+			if !headerSent {
+				headerSent = true
+				// Header() blocks until the header is received, or the
+				// call fails.
+				if md, herr := src.Header(); herr == nil {
+					if err == nil {
+						dst.SendHeader(md)
+					} else {
+						// No message, the header is sent with the status.
+						for k, v := range md {
+							resp.GRPCHeader().Set(k, v)
+						}
+					}
+				}
+			}
+			if err != nil {
+				ch <- err
+				return
+			}
+			if err := dst.SendMsg(f); err != nil {
+				ch <- err
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func (sp *serverPool) close() {
+	for _, conn := range sp.conns {
+		conn.Close()
+	}
+}
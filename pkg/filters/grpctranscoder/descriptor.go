@@ -0,0 +1,204 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// bodyAll is the body of an HttpRule which maps the whole request body to
+// the request message.
+const bodyAll = "*"
+
+// route routes HTTP requests to a gRPC method.
+type route struct {
+	httpMethod string
+	path       *pathTemplate
+	body       string
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+}
+
+// readDescriptorSet reads the descriptor set from a file, or decodes it
+// from base64 if no such file.
+func readDescriptorSet(s string) ([]byte, error) {
+	if _, err := os.Stat(s); err == nil {
+		return os.ReadFile(s)
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// loadDescriptorSet loads a FileDescriptorSet generated by protoc with
+// --include_imports, and returns the files and the message types in it.
+func loadDescriptorSet(data []byte) (*protoregistry.Files, *protoregistry.Types, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fds); err != nil {
+		return nil, nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+
+	// the types are used to resolve google.protobuf.Any.
+	types := &protoregistry.Types{}
+	var register func(msgs protoreflect.MessageDescriptors)
+	register = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			md := msgs.Get(i)
+			types.RegisterMessage(dynamicpb.NewMessageType(md))
+			register(md.Messages())
+		}
+	}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		register(fd.Messages())
+		return true
+	})
+
+	return files, types, nil
+}
+
+// buildRoutes builds the routes of the methods of services by their
+// google.api.http options. Every unary method can also be called by
+// "POST /package.Service/Method" with the whole request message as body.
+func buildRoutes(files *protoregistry.Files, services []string) ([]*route, error) {
+	var routes []*route
+	for _, name := range services {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, fmt.Errorf("service %s not found", name)
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
+
+		methods := sd.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			md := methods.Get(i)
+			// streaming methods are not supported.
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				continue
+			}
+
+			fullMethod := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
+			if rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule); ok && rule != nil {
+				rs, err := ruleRoutes(md, fullMethod, rule)
+				if err != nil {
+					return nil, fmt.Errorf("method %s: %v", md.FullName(), err)
+				}
+				routes = append(routes, rs...)
+			}
+
+			pt, _ := parsePathTemplate(fullMethod)
+			routes = append(routes, &route{
+				httpMethod: http.MethodPost,
+				path:       pt,
+				body:       bodyAll,
+				method:     md,
+				fullMethod: fullMethod,
+			})
+		}
+	}
+	return routes, nil
+}
+
+func ruleRoutes(md protoreflect.MethodDescriptor, fullMethod string, rule *annotations.HttpRule) ([]*route, error) {
+	var method, path string
+	switch p := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		method, path = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		method, path = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		method, path = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		method, path = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		method, path = http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		method, path = strings.ToUpper(p.Custom.GetKind()), p.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("no pattern in http rule")
+	}
+
+	pt, err := parsePathTemplate(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range pt.variables {
+		if _, err := findField(md.Input(), v.fieldPath); err != nil {
+			return nil, fmt.Errorf("path %s: %v", path, err)
+		}
+	}
+	if rule.Body != "" && rule.Body != bodyAll {
+		if _, err := findField(md.Input(), strings.Split(rule.Body, ".")); err != nil {
+			return nil, fmt.Errorf("body: %v", err)
+		}
+	}
+
+	routes := []*route{{
+		httpMethod: method,
+		path:       pt,
+		body:       rule.Body,
+		method:     md,
+		fullMethod: fullMethod,
+	}}
+	for _, r := range rule.AdditionalBindings {
+		rs, err := ruleRoutes(md, fullMethod, r)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, rs...)
+	}
+	return routes, nil
+}
+
+// findField finds the field by its path in the message, the fields are
+// referred by either their proto names or their JSON names.
+func findField(md protoreflect.MessageDescriptor, fieldPath []string) (protoreflect.FieldDescriptor, error) {
+	var fd protoreflect.FieldDescriptor
+	for i, name := range fieldPath {
+		if i > 0 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return nil, fmt.Errorf("field %s is not a message", fd.Name())
+			}
+			md = fd.Message()
+		}
+		fields := md.Fields()
+		if fd = fields.ByName(protoreflect.Name(name)); fd == nil {
+			if fd = fields.ByJSONName(name); fd == nil {
+				return nil, fmt.Errorf("field %s not found in %s", name, md.FullName())
+			}
+		}
+	}
+	return fd, nil
+}
@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpctranscoder provides the GRPCJSONTranscoder filter.
+package grpctranscoder
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	// Kind is the kind of GRPCJSONTranscoder.
+	Kind = "GRPCJSONTranscoder"
+
+	resultInternalError = "internalError"
+	resultClientError   = "clientError"
+	resultServerError   = "serverError"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "GRPCJSONTranscoder transcodes RESTful JSON requests to gRPC calls",
+	Results: []string{
+		resultInternalError,
+		resultClientError,
+		resultServerError,
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &GRPCJSONTranscoder{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*GRPCJSONTranscoder)(nil)
+
+// headersToSkip are the request headers which are not sent to the upstream
+// as metadata.
+var headersToSkip = map[string]struct{}{
+	"Host":              {},
+	"Connection":        {},
+	"Keep-Alive":        {},
+	"Te":                {},
+	"Trailer":           {},
+	"Transfer-Encoding": {},
+	"Upgrade":           {},
+	"Content-Type":      {},
+	"Content-Length":    {},
+	"Accept-Encoding":   {},
+	"User-Agent":        {},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// GRPCJSONTranscoder is the filter GRPCJSONTranscoder.
+	GRPCJSONTranscoder struct {
+		spec *Spec
+
+		routes    []*route
+		types     *protoregistry.Types
+		lb        proxy.LoadBalancer
+		conns     map[string]*grpc.ClientConn
+		timeout   time.Duration
+		marshaler protojson.MarshalOptions
+	}
+
+	// Spec describes the GRPCJSONTranscoder.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		ProtoDescriptor              string                 `json:"protoDescriptor" jsonschema:"required"`
+		Services                     []string               `json:"services" jsonschema:"required,minItems=1"`
+		SpanName                     string                 `json:"spanName" jsonschema:"omitempty"`
+		Servers                      []*proxy.Server        `json:"servers" jsonschema:"required,minItems=1"`
+		LoadBalance                  *proxy.LoadBalanceSpec `json:"loadBalance" jsonschema:"omitempty"`
+		Timeout                      string                 `json:"timeout" jsonschema:"omitempty,format=duration"`
+		IgnoreUnknownQueryParameters bool                   `json:"ignoreUnknownQueryParameters" jsonschema:"omitempty"`
+		IgnoreUnknownFields          bool                   `json:"ignoreUnknownFields" jsonschema:"omitempty"`
+		PrintOptions                 *PrintOptions          `json:"printOptions" jsonschema:"omitempty"`
+	}
+
+	// PrintOptions describes how the response messages are printed.
+	PrintOptions struct {
+		AddWhitespace              bool `json:"addWhitespace" jsonschema:"omitempty"`
+		AlwaysPrintPrimitiveFields bool `json:"alwaysPrintPrimitiveFields" jsonschema:"omitempty"`
+		UseProtoNames              bool `json:"useProtoNames" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	data, err := readDescriptorSet(s.ProtoDescriptor)
+	if err != nil {
+		return fmt.Errorf("failed to read proto descriptor: %v", err)
+	}
+	files, _, err := loadDescriptorSet(data)
+	if err != nil {
+		return err
+	}
+	if _, err = buildRoutes(files, s.Services); err != nil {
+		return err
+	}
+
+	for _, svr := range s.Servers {
+		if _, err := dialTarget(svr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialTarget returns the address to dial and whether to use TLS.
+func dialTarget(svr *proxy.Server) (*url.URL, error) {
+	u, err := url.Parse(svr.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url %s: %v", svr.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid server url %s: scheme must be http or https", svr.URL)
+	}
+	return u, nil
+}
+
+// Name returns the name of the GRPCJSONTranscoder filter instance.
+func (t *GRPCJSONTranscoder) Name() string {
+	return t.spec.Name()
+}
+
+// Kind returns the kind of GRPCJSONTranscoder.
+func (t *GRPCJSONTranscoder) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the GRPCJSONTranscoder
+func (t *GRPCJSONTranscoder) Spec() filters.Spec {
+	return t.spec
+}
+
+// Init initializes GRPCJSONTranscoder.
+func (t *GRPCJSONTranscoder) Init() {
+	t.reload()
+}
+
+// Inherit inherits previous generation of GRPCJSONTranscoder.
+func (t *GRPCJSONTranscoder) Inherit(previousGeneration filters.Filter) {
+	t.reload()
+}
+
+func (t *GRPCJSONTranscoder) reload() {
+	// the spec has been validated, so there should be no errors.
+	data, _ := readDescriptorSet(t.spec.ProtoDescriptor)
+	files, types, _ := loadDescriptorSet(data)
+	t.routes, _ = buildRoutes(files, t.spec.Services)
+	t.types = types
+
+	if t.spec.Timeout != "" {
+		t.timeout, _ = time.ParseDuration(t.spec.Timeout)
+	}
+
+	t.marshaler = protojson.MarshalOptions{Resolver: types}
+	if po := t.spec.PrintOptions; po != nil {
+		t.marshaler.Multiline = po.AddWhitespace
+		t.marshaler.EmitUnpopulated = po.AlwaysPrintPrimitiveFields
+		t.marshaler.UseProtoNames = po.UseProtoNames
+	}
+
+	lbSpec := t.spec.LoadBalance
+	if lbSpec == nil {
+		lbSpec = &proxy.LoadBalanceSpec{}
+	}
+	t.lb = proxy.NewLoadBalancer(lbSpec, t.spec.Servers)
+
+	t.conns = map[string]*grpc.ClientConn{}
+	for _, svr := range t.spec.Servers {
+		if _, ok := t.conns[svr.URL]; ok {
+			continue
+		}
+		u, _ := dialTarget(svr)
+		creds := insecure.NewCredentials()
+		if u.Scheme == "https" {
+			creds = credentials.NewTLS(&tls.Config{})
+		}
+		// grpc.Dial does not block, connections are established in the
+		// background and reconnected automatically.
+		conn, err := grpc.Dial(u.Host, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			logger.Errorf("%s: dial %s failed: %v", t.Name(), svr.URL, err)
+			continue
+		}
+		t.conns[svr.URL] = conn
+	}
+}
+
+// Status returns status.
+func (t *GRPCJSONTranscoder) Status() interface{} {
+	return nil
+}
+
+// Close closes GRPCJSONTranscoder.
+func (t *GRPCJSONTranscoder) Close() {
+	for _, conn := range t.conns {
+		conn.Close()
+	}
+}
+
+func (t *GRPCJSONTranscoder) match(req *httpprot.Request) (*route, map[*pathVariable]string) {
+	path := req.Std().URL.EscapedPath()
+	for _, r := range t.routes {
+		if r.httpMethod != req.Method() {
+			continue
+		}
+		if vars, ok := r.path.match(path); ok {
+			return r, vars
+		}
+	}
+	return nil, nil
+}
+
+func buildFailureResponse(ctx *context.Context, code codes.Code, msg string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"code":    code,
+		"message": msg,
+	})
+	buildResponse(ctx, httpStatusCode(code), body, nil)
+}
+
+func buildResponse(ctx *context.Context, statusCode int, body []byte, md metadata.MD) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	h := resp.HTTPHeader()
+	for k, values := range md {
+		for _, v := range values {
+			h.Add(k, v)
+		}
+	}
+	h.Set("Content-Type", "application/json")
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+}
+
+// outgoingMD returns the metadata to be sent to the upstream, which are
+// the request headers and the tracing context of span.
+func outgoingMD(req *httpprot.Request, span tracing.Span) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range req.HTTPHeader() {
+		if _, ok := headersToSkip[k]; !ok {
+			md.Set(strings.ToLower(k), v...)
+		}
+	}
+
+	stdr := &http.Request{Header: http.Header{}}
+	span.InjectHTTP(stdr)
+	for k, v := range stdr.Header {
+		md.Set(strings.ToLower(k), v...)
+	}
+	return md
+}
+
+// responseMD returns the metadata of the upstream to be returned to the
+// client as headers, reserved ones are removed.
+func responseMD(md metadata.MD) metadata.MD {
+	result := metadata.MD{}
+	for k, v := range md {
+		if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") || k == "content-type" {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// Handle transcodes the HTTP request to a gRPC call.
+func (t *GRPCJSONTranscoder) Handle(ctx *context.Context) string {
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		logger.Errorf("%s: expect an HTTP request", t.Name())
+		buildFailureResponse(ctx, codes.Internal, "request is not an HTTP request")
+		return resultInternalError
+	}
+
+	r, vars := t.match(req)
+	if r == nil {
+		buildFailureResponse(ctx, codes.NotFound, "no method matches the request")
+		return resultClientError
+	}
+	if req.IsStream() {
+		buildFailureResponse(ctx, codes.InvalidArgument, "request body is too large")
+		return resultClientError
+	}
+
+	data, err := r.requestJSON(req.RawPayload(), vars, req.Std().URL.Query(), t.spec.IgnoreUnknownQueryParameters)
+	if err != nil {
+		buildFailureResponse(ctx, codes.InvalidArgument, err.Error())
+		return resultClientError
+	}
+	in := dynamicpb.NewMessage(r.method.Input())
+	unmarshaler := protojson.UnmarshalOptions{DiscardUnknown: t.spec.IgnoreUnknownFields, Resolver: t.types}
+	if err = unmarshaler.Unmarshal(data, in); err != nil {
+		buildFailureResponse(ctx, codes.InvalidArgument, err.Error())
+		return resultClientError
+	}
+
+	svr := t.lb.ChooseServer(req)
+	if svr == nil {
+		buildFailureResponse(ctx, codes.Unavailable, "no available server")
+		return resultServerError
+	}
+	conn := t.conns[svr.URL]
+	if conn == nil {
+		buildFailureResponse(ctx, codes.Unavailable, fmt.Sprintf("no connection to %s", svr.URL))
+		return resultServerError
+	}
+
+	spanName := t.spec.SpanName
+	if spanName == "" {
+		spanName = t.Name()
+	}
+	span := ctx.Span().NewChild(spanName)
+	defer span.Finish()
+	span.TagFromContext(tracing.AttributeUpstream, svr.URL)
+
+	stdctx, cancel := stdcontext.WithCancel(req.Std().Context())
+	defer cancel()
+	if t.timeout > 0 {
+		stdctx, cancel = stdcontext.WithTimeout(stdctx, t.timeout)
+		defer cancel()
+	}
+	stdctx = metadata.NewOutgoingContext(stdctx, outgoingMD(req, span))
+
+	var header metadata.MD
+	out := dynamicpb.NewMessage(r.method.Output())
+	err = conn.Invoke(stdctx, r.fullMethod, in, out, grpc.Header(&header))
+	if err != nil {
+		st := status.Convert(err)
+		span.Tag(tracing.TagError, st.Message())
+		span.Tag(tracing.TagGRPCStatusCode, st.Code().String())
+		buildFailureResponse(ctx, st.Code(), st.Message())
+		if httpStatusCode(st.Code()) < http.StatusInternalServerError {
+			return resultClientError
+		}
+		return resultServerError
+	}
+
+	body, err := t.marshaler.Marshal(out)
+	if err != nil {
+		logger.Errorf("%s: failed to marshal response of %s: %v", t.Name(), r.fullMethod, err)
+		buildFailureResponse(ctx, codes.Internal, "failed to marshal response")
+		return resultInternalError
+	}
+	buildResponse(ctx, http.StatusOK, body, responseMD(header))
+	return ""
+}
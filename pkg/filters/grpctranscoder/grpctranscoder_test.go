@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	stdcontext "context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+	fd := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  label.Enum(),
+	}
+	if typeName != "" {
+		fd.TypeName = proto.String(typeName)
+	}
+	return fd
+}
+
+func method(name, input, output string, rule *annotations.HttpRule) *descriptorpb.MethodDescriptorProto {
+	md := &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(input),
+		OutputType: proto.String(output),
+	}
+	if rule != nil {
+		md.Options = &descriptorpb.MethodOptions{}
+		proto.SetExtension(md.Options, annotations.E_Http, rule)
+	}
+	return md
+}
+
+// testDescriptorSet returns the descriptor set of below proto file.
+//
+//	package test.v1;
+//	message GetUserRequest { string id = 1; bool verbose = 2; repeated string tags = 3; int64 big = 4; }
+//	message User { string id = 1; string display_name = 2; bool verbose = 3; repeated string tags = 4; int64 big = 5; }
+//	message CreateUserRequest { User user = 1; string parent = 2; }
+//	service UserService {
+//	  rpc GetUser(GetUserRequest) returns (User) { option (google.api.http) = { get: "/v1/users/{id}" }; }
+//	  rpc CreateUser(CreateUserRequest) returns (User) { option (google.api.http) = { post: "/v1/{parent=orgs/*}/users" body: "user" }; }
+//	  rpc Echo(User) returns (User);
+//	}
+func testDescriptorSet() *descriptorpb.FileDescriptorSet {
+	str := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test.proto"),
+		Package:    proto.String("test.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/annotations.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("GetUserRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, false, ""),
+				field("verbose", 2, descriptorpb.FieldDescriptorProto_TYPE_BOOL, false, ""),
+				field("tags", 3, str, true, ""),
+				field("big", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, false, ""),
+			},
+		}, {
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, str, false, ""),
+				field("display_name", 2, str, false, ""),
+				field("verbose", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL, false, ""),
+				field("tags", 4, str, true, ""),
+				field("big", 5, descriptorpb.FieldDescriptorProto_TYPE_INT64, false, ""),
+			},
+		}, {
+			Name: proto.String("CreateUserRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("user", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, false, ".test.v1.User"),
+				field("parent", 2, str, false, ""),
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("UserService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("GetUser", ".test.v1.GetUserRequest", ".test.v1.User", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Get{Get: "/v1/users/{id}"},
+				}),
+				method("CreateUser", ".test.v1.CreateUserRequest", ".test.v1.User", &annotations.HttpRule{
+					Pattern: &annotations.HttpRule_Post{Post: "/v1/{parent=orgs/*}/users"},
+					Body:    "user",
+				}),
+				method("Echo", ".test.v1.User", ".test.v1.User", nil),
+			},
+		}},
+	}
+
+	return &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+			protodesc.ToFileDescriptorProto(annotations.File_google_api_http_proto),
+			protodesc.ToFileDescriptorProto(annotations.File_google_api_annotations_proto),
+			file,
+		},
+	}
+}
+
+// startUpstream starts a gRPC server of the UserService, the messages are
+// handled as JSON objects for simplicity.
+func startUpstream(t *testing.T, fds *descriptorpb.FileDescriptorSet) (string, func()) {
+	files, err := protodesc.NewFiles(fds)
+	assert.NoError(t, err)
+	d, err := files.FindDescriptorByName("test.v1.UserService")
+	assert.NoError(t, err)
+	sd := d.(protoreflect.ServiceDescriptor)
+
+	type object = map[string]interface{}
+	handler := func(name string, fn func(in object) (object, error)) grpc.MethodDesc {
+		md := sd.Methods().ByName(protoreflect.Name(name))
+		return grpc.MethodDesc{
+			MethodName: name,
+			Handler: func(srv interface{}, ctx stdcontext.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := dynamicpb.NewMessage(md.Input())
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if incoming, ok := metadata.FromIncomingContext(ctx); ok {
+					grpc.SetHeader(ctx, metadata.Pairs("x-echo", strings.Join(incoming.Get("x-request-id"), ",")))
+				}
+
+				data, _ := protojson.Marshal(in)
+				m := object{}
+				json.Unmarshal(data, &m)
+				result, err := fn(m)
+				if err != nil {
+					return nil, err
+				}
+				data, _ = json.Marshal(result)
+				out := dynamicpb.NewMessage(md.Output())
+				return out, protojson.Unmarshal(data, out)
+			},
+		}
+	}
+
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.v1.UserService",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			handler("GetUser", func(in object) (object, error) {
+				if in["id"] == "missing" {
+					return nil, status.Error(codes.NotFound, "user not found")
+				}
+				in["displayName"] = "user"
+				return in, nil
+			}),
+			handler("CreateUser", func(in object) (object, error) {
+				return in["user"].(object), nil
+			}),
+			handler("Echo", func(in object) (object, error) {
+				return in, nil
+			}),
+		},
+	}, struct{}{})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go server.Serve(listener)
+	return listener.Addr().String(), server.Stop
+}
+
+func newTranscoder(t *testing.T, yamlSpec string) *GRPCJSONTranscoder {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	transcoder := kind.CreateInstance(spec).(*GRPCJSONTranscoder)
+	transcoder.Init()
+	return transcoder
+}
+
+func newContext(t *testing.T, method, url, body string) *context.Context {
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	stdr.Header.Set("X-Request-Id", "abc")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestGRPCJSONTranscoder(t *testing.T) {
+	assert := assert.New(t)
+
+	fds := testDescriptorSet()
+	addr, stop := startUpstream(t, fds)
+	defer stop()
+
+	data, err := proto.Marshal(fds)
+	assert.NoError(err)
+	descFile := filepath.Join(t.TempDir(), "test.pb")
+	assert.NoError(os.WriteFile(descFile, data, 0o644))
+
+	transcoder := newTranscoder(t, fmt.Sprintf(`
+kind: GRPCJSONTranscoder
+name: transcoder
+protoDescriptor: %s
+services: ["test.v1.UserService"]
+servers:
+- url: http://%s
+timeout: 5s
+`, base64.StdEncoding.EncodeToString(data), addr))
+	defer transcoder.Close()
+	assert.Equal(kind, transcoder.Kind())
+	assert.Equal("transcoder", transcoder.Name())
+	assert.Nil(transcoder.Status())
+
+	check := func(ctx *context.Context, statusCode int, body string) {
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(statusCode, resp.StatusCode())
+		assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+		assert.JSONEq(body, string(resp.RawPayload()))
+	}
+
+	// path variables and query parameters.
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/v1/users/u%2F1?verbose=true&tags=a&tags=b&big=9007199254740993", "")
+	assert.Equal("", transcoder.Handle(ctx))
+	check(ctx, http.StatusOK, `{"id":"u/1","displayName":"user","verbose":true,"tags":["a","b"],"big":"9007199254740993"}`)
+	assert.Equal("abc", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-Echo"))
+
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/v1/users/1?unknown=1", "")
+	assert.Equal(resultClientError, transcoder.Handle(ctx))
+	check(ctx, http.StatusBadRequest, `{"code":3,"message":"query parameter unknown: field unknown not found in test.v1.GetUserRequest"}`)
+
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/v1/users/missing", "")
+	assert.Equal(resultClientError, transcoder.Handle(ctx))
+	check(ctx, http.StatusNotFound, `{"code":5,"message":"user not found"}`)
+
+	// body mapped to a field.
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/v1/orgs/megaease/users", `{"id":"2","display_name":"bob"}`)
+	assert.Equal("", transcoder.Handle(ctx))
+	check(ctx, http.StatusOK, `{"id":"2","displayName":"bob"}`)
+
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/v1/orgs/megaease/users", `{"id":`)
+	assert.Equal(resultClientError, transcoder.Handle(ctx))
+
+	// the default route of methods.
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/test.v1.UserService/Echo", `{"id":"3","tags":["x"]}`)
+	assert.Equal("", transcoder.Handle(ctx))
+	check(ctx, http.StatusOK, `{"id":"3","tags":["x"]}`)
+
+	ctx = newContext(t, http.MethodDelete, "http://127.0.0.1/v1/users/1", "")
+	assert.Equal(resultClientError, transcoder.Handle(ctx))
+	check(ctx, http.StatusNotFound, `{"code":5,"message":"no method matches the request"}`)
+
+	// the descriptor file, print options and unavailable upstream.
+	newt := newTranscoder(t, fmt.Sprintf(`
+kind: GRPCJSONTranscoder
+name: transcoder
+protoDescriptor: %s
+services: ["test.v1.UserService"]
+servers:
+- url: http://127.0.0.1:1
+printOptions:
+  useProtoNames: true
+  alwaysPrintPrimitiveFields: true
+`, descFile))
+	defer newt.Close()
+	newt.Inherit(transcoder)
+
+	ctx = newContext(t, http.MethodPost, "http://127.0.0.1/test.v1.UserService/Echo", `{}`)
+	assert.Equal(resultServerError, newt.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	body, err := newt.marshaler.Marshal(dynamicpb.NewMessage(newt.routes[0].method.Output()))
+	assert.NoError(err)
+	assert.JSONEq(`{"id":"","display_name":"","verbose":false,"tags":[],"big":"0"}`, string(body))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := proto.Marshal(testDescriptorSet())
+	assert.NoError(err)
+	desc := base64.StdEncoding.EncodeToString(data)
+
+	spec := &Spec{
+		ProtoDescriptor: desc,
+		Services:        []string{"test.v1.UserService"},
+	}
+	assert.NoError(spec.Validate())
+
+	spec.Services = []string{"test.v1.Unknown"}
+	assert.Error(spec.Validate())
+	spec.Services = []string{"test.v1.User"}
+	assert.Error(spec.Validate())
+
+	spec.Services = []string{"test.v1.UserService"}
+	spec.ProtoDescriptor = "invalid"
+	assert.Error(spec.Validate())
+	spec.ProtoDescriptor = base64.StdEncoding.EncodeToString([]byte("invalid"))
+	assert.Error(spec.Validate())
+
+	spec.ProtoDescriptor = desc
+	spec.Servers = []*proxy.Server{{URL: "127.0.0.1:8080"}}
+	assert.Error(spec.Validate())
+}
+
+func TestPathTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tmpl := range []string{"v1", "/v1/{id", "/v1/{=*}", "/v1//a", "/v1/**/a", "/v1/{id}a"} {
+		_, err := parsePathTemplate(tmpl)
+		assert.Error(err, tmpl)
+	}
+
+	values := func(pt *pathTemplate, path string) []string {
+		vars, ok := pt.match(path)
+		if !ok {
+			return nil
+		}
+		result := []string{}
+		for _, v := range pt.variables {
+			result = append(result, strings.Join(v.fieldPath, ".")+"="+vars[v])
+		}
+		return result
+	}
+
+	pt, err := parsePathTemplate("/v1/{name=shelves/*}/books/{book.id}:publish")
+	assert.NoError(err)
+	assert.Equal([]string{"name=shelves/1", "book.id=2"}, values(pt, "/v1/shelves/1/books/2:publish"))
+	assert.Nil(values(pt, "/v1/shelves/1/books/2"))
+	assert.Nil(values(pt, "/v1/shelves/1/books:publish"))
+	assert.Nil(values(pt, "/v1/shelf/1/books/2:publish"))
+
+	pt, err = parsePathTemplate("/v1/{path=files/**}")
+	assert.NoError(err)
+	assert.Equal([]string{"path=files/a/b c"}, values(pt, "/v1/files/a/b%20c"))
+	assert.Equal([]string{"path=files"}, values(pt, "/v1/files"))
+	assert.Nil(values(pt, "/v1"))
+}
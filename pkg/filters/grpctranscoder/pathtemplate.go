@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type (
+	// pathTemplate is a parsed path template of google.api.HttpRule, e.g.
+	// "/v1/{name=shelves/*}/books/{book_id}:publish".
+	pathTemplate struct {
+		segments  []string
+		variables []*pathVariable
+		verb      string
+	}
+
+	// pathVariable binds the segments in [start, end) to a field, end is
+	// -1 if the variable ends with "**", which matches the rest segments.
+	pathVariable struct {
+		fieldPath []string
+		start     int
+		end       int
+	}
+)
+
+const (
+	segmentSingle = "*"
+	segmentMulti  = "**"
+)
+
+// parsePathTemplate parses a path template, "**" is only allowed as the
+// last segment.
+func parsePathTemplate(tmpl string) (*pathTemplate, error) {
+	if !strings.HasPrefix(tmpl, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", tmpl)
+	}
+
+	pt := &pathTemplate{}
+	s := tmpl[1:]
+
+	// the verb is after the last colon which is not in a variable.
+	if i := strings.LastIndexByte(s, ':'); i >= 0 && !strings.ContainsRune(s[i:], '}') {
+		pt.verb = s[i+1:]
+		s = s[:i]
+	}
+
+	for len(s) > 0 {
+		if s[0] != '{' {
+			seg := s
+			if i := strings.IndexByte(s, '/'); i >= 0 {
+				seg, s = s[:i], s[i+1:]
+			} else {
+				s = ""
+			}
+			pt.segments = append(pt.segments, seg)
+			continue
+		}
+
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return nil, fmt.Errorf("path template %q: unclosed variable", tmpl)
+		}
+		v, segs := s[1:end], []string{segmentSingle}
+		if i := strings.IndexByte(v, '='); i >= 0 {
+			v, segs = v[:i], strings.Split(v[i+1:], "/")
+		}
+		if v == "" {
+			return nil, fmt.Errorf("path template %q: empty variable name", tmpl)
+		}
+
+		pv := &pathVariable{
+			fieldPath: strings.Split(v, "."),
+			start:     len(pt.segments),
+		}
+		pt.segments = append(pt.segments, segs...)
+		pv.end = len(pt.segments)
+		pt.variables = append(pt.variables, pv)
+
+		s = s[end+1:]
+		if len(s) > 0 {
+			if s[0] != '/' {
+				return nil, fmt.Errorf("path template %q: invalid character after variable", tmpl)
+			}
+			s = s[1:]
+		}
+	}
+
+	for i, seg := range pt.segments {
+		if seg == "" {
+			return nil, fmt.Errorf("path template %q: empty segment", tmpl)
+		}
+		if seg == segmentMulti && i != len(pt.segments)-1 {
+			return nil, fmt.Errorf("path template %q: ** must be the last segment", tmpl)
+		}
+	}
+	for _, pv := range pt.variables {
+		if pv.end == len(pt.segments) && pt.segments[pv.end-1] == segmentMulti {
+			pv.end = -1
+		}
+	}
+
+	return pt, nil
+}
+
+// match matches the escaped path against the template, and returns the
+// values of the variables on success.
+func (pt *pathTemplate) match(path string) (map[*pathVariable]string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	if pt.verb != "" {
+		if !strings.HasSuffix(path, ":"+pt.verb) {
+			return nil, false
+		}
+		path = path[:len(path)-len(pt.verb)-1]
+	}
+
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	n := len(pt.segments)
+	multi := n > 0 && pt.segments[n-1] == segmentMulti
+	if multi {
+		if len(parts) < n-1 {
+			return nil, false
+		}
+	} else if len(parts) != n {
+		return nil, false
+	}
+
+	for i, seg := range pt.segments {
+		if seg == segmentMulti {
+			break
+		}
+		if seg != segmentSingle && seg != parts[i] {
+			return nil, false
+		}
+	}
+
+	values := make(map[*pathVariable]string, len(pt.variables))
+	for _, pv := range pt.variables {
+		end := pv.end
+		if end < 0 {
+			end = len(parts)
+		}
+		segs := make([]string, 0, end-pv.start)
+		for _, p := range parts[pv.start:end] {
+			p, err := url.PathUnescape(p)
+			if err != nil {
+				return nil, false
+			}
+			segs = append(segs, p)
+		}
+		values[pv] = strings.Join(segs, "/")
+	}
+	return values, true
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpctranscoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// httpStatusCodes maps gRPC status codes to HTTP status codes, by
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto.
+var httpStatusCodes = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+func httpStatusCode(code codes.Code) int {
+	if sc, ok := httpStatusCodes[code]; ok {
+		return sc
+	}
+	return http.StatusInternalServerError
+}
+
+// requestJSON builds the JSON of the request message from the body, the
+// path variables and the query parameters of the HTTP request by the rule
+// of the route. The query parameters are only used if the body is not
+// mapped to the whole message.
+func (r *route) requestJSON(body []byte, vars map[*pathVariable]string, query url.Values, ignoreUnknownQuery bool) ([]byte, error) {
+	input := r.method.Input()
+	msg := map[string]interface{}{}
+
+	if len(bytes.TrimSpace(body)) > 0 && r.body != "" {
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		// keep the numbers as is, as int64 could not be represented by
+		// float64 without loss.
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %v", err)
+		}
+
+		if r.body == bodyAll {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("body is not a JSON object")
+			}
+			msg = m
+		} else if err := setField(msg, input, strings.Split(r.body, "."), v); err != nil {
+			return nil, err
+		}
+	}
+
+	bound := map[string]struct{}{r.body: {}}
+	for pv, value := range vars {
+		fd, _ := findField(input, pv.fieldPath)
+		v, err := fieldValue(fd, []string{value})
+		if err != nil {
+			return nil, err
+		}
+		if err = setField(msg, input, pv.fieldPath, v); err != nil {
+			return nil, err
+		}
+		bound[strings.Join(pv.fieldPath, ".")] = struct{}{}
+	}
+
+	if r.body != bodyAll {
+		for key, values := range query {
+			if _, ok := bound[key]; ok {
+				continue
+			}
+			fieldPath := strings.Split(key, ".")
+			fd, err := findField(input, fieldPath)
+			if err != nil {
+				if ignoreUnknownQuery {
+					continue
+				}
+				return nil, fmt.Errorf("query parameter %s: %v", key, err)
+			}
+			v, err := fieldValue(fd, values)
+			if err != nil {
+				return nil, err
+			}
+			if err = setField(msg, input, fieldPath, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return json.Marshal(msg)
+}
+
+// fieldValue converts the string values to the JSON value of the field.
+// Values of other kinds are kept as strings, which are accepted by the
+// JSON mapping of protobuf, including numbers, enums and bytes.
+func fieldValue(fd protoreflect.FieldDescriptor, values []string) (interface{}, error) {
+	if fd.IsMap() || (fd.Message() != nil && !isWellKnownScalar(fd.Message())) {
+		return nil, fmt.Errorf("field %s is not a scalar", fd.Name())
+	}
+
+	convert := func(s string) (interface{}, error) {
+		if fd.Kind() != protoreflect.BoolKind {
+			return s, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: invalid bool %q", fd.Name(), s)
+		}
+		return b, nil
+	}
+
+	if !fd.IsList() {
+		return convert(values[len(values)-1])
+	}
+	list := make([]interface{}, 0, len(values))
+	for _, s := range values {
+		v, err := convert(s)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// isWellKnownScalar returns whether the message is a well known type whose
+// JSON representation is a string.
+func isWellKnownScalar(md protoreflect.MessageDescriptor) bool {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.StringValue", "google.protobuf.BytesValue",
+		"google.protobuf.Int32Value", "google.protobuf.Int64Value",
+		"google.protobuf.UInt32Value", "google.protobuf.UInt64Value",
+		"google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return true
+	}
+	return false
+}
+
+// setField sets the value of the field by its path in the JSON object of
+// the message, the existing key of the field is used, no matter if it is
+// the proto name or the JSON name.
+func setField(msg map[string]interface{}, md protoreflect.MessageDescriptor, fieldPath []string, v interface{}) error {
+	for i, name := range fieldPath {
+		fd, err := findField(md, fieldPath[i:i+1])
+		if err != nil {
+			return err
+		}
+
+		key := string(fd.Name())
+		if _, ok := msg[fd.JSONName()]; ok {
+			key = fd.JSONName()
+		}
+
+		if i == len(fieldPath)-1 {
+			msg[key] = v
+			return nil
+		}
+
+		child, ok := msg[key].(map[string]interface{})
+		if !ok {
+			if msg[key] != nil {
+				return fmt.Errorf("field %s is not an object", name)
+			}
+			child = map[string]interface{}{}
+			msg[key] = child
+		}
+		msg, md = child, fd.Message()
+	}
+	return nil
+}
@@ -282,5 +282,10 @@ func (hl *HeaderLookup) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// RequiresBody implements filters.BodyRequirer.
+func (hl *HeaderLookup) RequiresBody() (request, response bool) {
+	return false, false
+}
+
 // Status returns status.
 func (hl *HeaderLookup) Status() interface{} { return nil }
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	apiGroupName = "httpcache"
+	apiPath      = "/httpcache/{pipeline}/{name}"
+)
+
+var (
+	// caches are the running HTTPCache filters, keyed by their pipeline
+	// and name.
+	caches     = map[string]*HTTPCache{}
+	cachesLock sync.Mutex
+	apiOnce    sync.Once
+)
+
+// purgeResult is the response of the purge API.
+type purgeResult struct {
+	Purged int `json:"purged"`
+}
+
+func cacheID(pipeline, name string) string {
+	return pipeline + "/" + name
+}
+
+// registerCache registers the filter to the purge API, it replaces the
+// previous generation of the filter.
+func registerCache(c *HTTPCache) {
+	apiOnce.Do(func() {
+		api.RegisterAPIs(&api.Group{
+			Group: apiGroupName,
+			Entries: []*api.Entry{
+				{Path: apiPath, Method: http.MethodDelete, Handler: purgeHandler},
+			},
+		})
+	})
+
+	cachesLock.Lock()
+	caches[cacheID(c.spec.Pipeline(), c.spec.Name())] = c
+	cachesLock.Unlock()
+}
+
+// unregisterCache unregisters the filter, unless it has been replaced by
+// its next generation.
+func unregisterCache(c *HTTPCache) {
+	id := cacheID(c.spec.Pipeline(), c.spec.Name())
+
+	cachesLock.Lock()
+	if caches[id] == c {
+		delete(caches, id)
+	}
+	cachesLock.Unlock()
+}
+
+// purgeHandler purges the entries of a filter, by the exact key with the
+// query parameter key, or by the key prefix with the query parameter
+// prefix. An empty prefix purges all entries.
+func purgeHandler(w http.ResponseWriter, r *http.Request) {
+	id := cacheID(chi.URLParam(r, "pipeline"), chi.URLParam(r, "name"))
+
+	cachesLock.Lock()
+	c := caches[id]
+	cachesLock.Unlock()
+	if c == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("http cache %s not found", id))
+		return
+	}
+
+	query := r.URL.Query()
+	var match func(key string) bool
+	switch {
+	case query.Has("key"):
+		key := query.Get("key")
+		// entries varying by headers share the prefix of the key.
+		match = func(k string) bool {
+			return k == key || strings.HasPrefix(k, key+varySeparator)
+		}
+	case query.Has("prefix"):
+		prefix := query.Get("prefix")
+		match = func(k string) bool {
+			return strings.HasPrefix(k, prefix)
+		}
+	default:
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("key or prefix is required"))
+		return
+	}
+
+	result := &purgeResult{Purged: c.purge(match)}
+	buff, err := codectool.MarshalJSON(result)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buff)
+}
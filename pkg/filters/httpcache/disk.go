@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const diskFileSuffix = ".cache"
+
+// diskStore stores the entries in files of a directory, every file holds
+// the metadata of an entry in JSON in its first line, and the body in the
+// rest. The index of the entries is kept in memory, and rebuilt from the
+// files on creation, so that the cache survives restarts.
+type diskStore struct {
+	dir   string
+	lock  sync.Mutex
+	index *lruIndex
+}
+
+func newDiskStore(dir string, maxSize int64) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	s := &diskStore{dir: dir}
+	s.index = newLRUIndex(maxSize, func(it *lruItem) {
+		os.Remove(s.path(it.key))
+	})
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), diskFileSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		e, size, err := readDiskEntry(path, false)
+		if err != nil || e.Expires <= now || s.path(e.Key) != path {
+			os.Remove(path)
+			continue
+		}
+		s.index.add(&lruItem{key: e.Key, size: size, expires: e.Expires})
+	}
+	return s, nil
+}
+
+func (s *diskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+diskFileSuffix)
+}
+
+// readDiskEntry reads an entry from a file, the body is read only if
+// withBody is true. It also returns the size of the entry.
+func readDiskEntry(path string, withBody bool) (*entry, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	meta, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, 0, err
+	}
+	e := &entry{}
+	if err = codectool.UnmarshalJSON(meta, e); err != nil {
+		return nil, 0, err
+	}
+	if withBody {
+		if e.Body, err = io.ReadAll(r); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	return e, info.Size(), nil
+}
+
+func (s *diskStore) get(key string) *entry {
+	s.lock.Lock()
+	it := s.index.get(key)
+	s.lock.Unlock()
+	if it == nil {
+		return nil
+	}
+
+	// the file may have been removed by eviction or purging, which is
+	// treated as a miss.
+	e, _, err := readDiskEntry(s.path(key), true)
+	if err != nil || e.Key != key {
+		return nil
+	}
+	return e
+}
+
+func (s *diskStore) set(e *entry) {
+	meta, err := codectool.MarshalJSON(e)
+	if err != nil {
+		logger.Errorf("BUG: marshal cache entry failed: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(meta) + 1 + len(e.Body))
+	buf.Write(meta)
+	buf.WriteByte('\n')
+	buf.Write(e.Body)
+
+	// write to a temporary file and rename it, so that readers never see
+	// a partial file.
+	path := s.path(e.Key)
+	f, err := os.CreateTemp(s.dir, "tmp-")
+	if err != nil {
+		logger.Errorf("create cache file failed: %v", err)
+		return
+	}
+	_, err = f.Write(buf.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		logger.Errorf("write cache file failed: %v", err)
+		os.Remove(f.Name())
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		logger.Errorf("rename cache file failed: %v", err)
+		os.Remove(f.Name())
+		return
+	}
+
+	// the file has been replaced, so remove the item from the index
+	// without removing the file.
+	if elem := s.index.items[e.Key]; elem != nil {
+		s.index.list.Remove(elem)
+		delete(s.index.items, e.Key)
+		s.index.size -= elem.Value.(*lruItem).size
+	}
+	s.index.add(&lruItem{key: e.Key, size: int64(buf.Len()), expires: e.Expires})
+}
+
+func (s *diskStore) purge(match func(key string) bool) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.index.purge(match)
+}
+
+func (s *diskStore) stat() (int, int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.index.items), s.index.size
+}
+
+// close keeps the files, so that they can be loaded by the next store of
+// the same directory.
+func (s *diskStore) close() {
+}
@@ -0,0 +1,387 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package httpcache provides the HTTPCache filter.
+package httpcache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of HTTPCache.
+	Kind = "HTTPCache"
+
+	resultCached = "cached"
+
+	backendMemory = "memory"
+	backendDisk   = "disk"
+
+	// varySeparator separates the values of the vary headers in keys.
+	varySeparator = "\n"
+
+	headerCacheControl = "Cache-Control"
+	headerCacheStatus  = "X-EG-Cache"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "HTTPCache caches the responses of the upstream",
+	Results:     []string{resultCached},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			TTL:          "60s",
+			MaxEntrySize: 1 << 20,
+			MaxSize:      64 << 20,
+			Methods:      []string{http.MethodGet, http.MethodHead},
+			Codes:        []int{200, 203, 204, 300, 301, 404, 410},
+			Backend:      backendMemory,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &HTTPCache{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*HTTPCache)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// HTTPCache is the filter HTTPCache.
+	HTTPCache struct {
+		spec    *Spec
+		store   store
+		ttl     time.Duration
+		methods map[string]struct{}
+		codes   map[int]struct{}
+		vary    map[string]struct{}
+
+		// storeInherited is true if the store is inherited by the next
+		// generation.
+		storeInherited bool
+
+		hits   uint64
+		misses uint64
+	}
+
+	// Spec describes the HTTPCache.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		TTL          string   `json:"ttl" jsonschema:"omitempty,format=duration"`
+		MaxEntrySize int64    `json:"maxEntrySize" jsonschema:"omitempty,minimum=1"`
+		MaxSize      int64    `json:"maxSize" jsonschema:"omitempty,minimum=1"`
+		Methods      []string `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		Codes        []int    `json:"codes" jsonschema:"omitempty,uniqueItems=true,format=httpcode-array"`
+		Vary         []string `json:"vary" jsonschema:"omitempty,uniqueItems=true"`
+		Backend      string   `json:"backend" jsonschema:"omitempty,enum=,enum=memory,enum=disk"`
+		Dir          string   `json:"dir" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of HTTPCache.
+	Status struct {
+		Entries int    `json:"entries"`
+		Size    int64  `json:"size"`
+		Hits    uint64 `json:"hits"`
+		Misses  uint64 `json:"misses"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if s.TTL != "" {
+		if _, err := time.ParseDuration(s.TTL); err != nil {
+			return fmt.Errorf("invalid ttl %s: %v", s.TTL, err)
+		}
+	}
+	if s.Backend == backendDisk && s.Dir == "" {
+		return fmt.Errorf("dir is required for the disk backend")
+	}
+	return nil
+}
+
+// Name returns the name of the HTTPCache filter instance.
+func (c *HTTPCache) Name() string {
+	return c.spec.Name()
+}
+
+// Kind returns the kind of HTTPCache.
+func (c *HTTPCache) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the HTTPCache
+func (c *HTTPCache) Spec() filters.Spec {
+	return c.spec
+}
+
+// Init initializes HTTPCache.
+func (c *HTTPCache) Init() {
+	c.reload(nil)
+}
+
+// Inherit inherits previous generation of HTTPCache.
+func (c *HTTPCache) Inherit(previousGeneration filters.Filter) {
+	c.reload(previousGeneration.(*HTTPCache))
+}
+
+func (c *HTTPCache) reload(prev *HTTPCache) {
+	c.ttl, _ = time.ParseDuration(c.spec.TTL)
+
+	c.methods = map[string]struct{}{}
+	for _, m := range c.spec.Methods {
+		c.methods[m] = struct{}{}
+	}
+	c.codes = map[int]struct{}{}
+	for _, code := range c.spec.Codes {
+		c.codes[code] = struct{}{}
+	}
+	c.vary = map[string]struct{}{}
+	for _, h := range c.spec.Vary {
+		c.vary[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	// keep the cached entries if the backend is unchanged, the previous
+	// generation may still be serving requests, so its store is kept but
+	// not closed.
+	if prev != nil && prev.spec.Backend == c.spec.Backend &&
+		prev.spec.Dir == c.spec.Dir && prev.spec.MaxSize == c.spec.MaxSize {
+		c.store = prev.store
+		prev.storeInherited = true
+	} else {
+		c.store = c.newStore()
+	}
+
+	registerCache(c)
+}
+
+func (c *HTTPCache) newStore() store {
+	if c.spec.Backend == backendDisk {
+		s, err := newDiskStore(c.spec.Dir, c.spec.MaxSize)
+		if err == nil {
+			return s
+		}
+		logger.Errorf("%s: create disk store failed, fall back to memory: %v", c.spec.Name(), err)
+	}
+	return newMemoryStore(c.spec.MaxSize)
+}
+
+// key returns the key of the request, which is the method and the URL,
+// followed by the values of the vary headers.
+func (c *HTTPCache) key(req *httpprot.Request) string {
+	var sb strings.Builder
+	sb.WriteString(req.Method())
+	sb.WriteByte(' ')
+	sb.WriteString(req.Scheme())
+	sb.WriteString("://")
+	sb.WriteString(req.Host())
+	sb.WriteString(req.Std().URL.RequestURI())
+
+	for _, h := range c.spec.Vary {
+		sb.WriteString(varySeparator)
+		sb.WriteString(http.CanonicalHeaderKey(h))
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(req.HTTPHeader().Values(h), ","))
+	}
+	return sb.String()
+}
+
+// parseCacheControl parses the Cache-Control header into directives,
+// the directive names are lower-cased.
+func parseCacheControl(h http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range h.Values(headerCacheControl) {
+		for _, d := range strings.Split(value, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, arg, _ := strings.Cut(d, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	return directives
+}
+
+// Handle serves the request from the cache, or stores the response when
+// the request finishes if it is not cached.
+func (c *HTTPCache) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if _, ok := c.methods[req.Method()]; !ok {
+		return ""
+	}
+
+	directives := parseCacheControl(req.HTTPHeader())
+	if _, ok := directives["no-store"]; ok {
+		return ""
+	}
+
+	key := c.key(req)
+	_, noCache := directives["no-cache"]
+	if directives["max-age"] == "0" {
+		noCache = true
+	}
+	if !noCache {
+		if e := c.store.get(key); e != nil {
+			atomic.AddUint64(&c.hits, 1)
+			c.respond(ctx, e)
+			return resultCached
+		}
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+	authorized := req.HTTPHeader().Get("Authorization") != ""
+	store := c.store
+	ctx.OnFinish(func() {
+		c.storeResponse(ctx, store, key, authorized)
+	})
+	return ""
+}
+
+func (c *HTTPCache) respond(ctx *context.Context, e *entry) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(e.StatusCode)
+
+	h := resp.HTTPHeader()
+	for k, v := range e.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	age := time.Since(time.Unix(0, e.Stored)) / time.Second
+	h.Set("Age", strconv.FormatInt(int64(age), 10))
+	h.Set(headerCacheStatus, "HIT")
+
+	resp.SetPayload(e.Body)
+	ctx.SetOutputResponse(resp)
+}
+
+// storeResponse stores the response sent to the client, if it is
+// cacheable.
+func (c *HTTPCache) storeResponse(ctx *context.Context, store store, key string, authorized bool) {
+	resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if !ok || resp.IsStream() {
+		return
+	}
+	if _, ok := c.codes[resp.StatusCode()]; !ok {
+		return
+	}
+	body := resp.RawPayload()
+	if int64(len(body)) > c.spec.MaxEntrySize {
+		return
+	}
+
+	h := resp.HTTPHeader()
+	if len(h.Values("Set-Cookie")) > 0 || !c.varyCovered(h) {
+		return
+	}
+
+	// Reference: https://tools.ietf.org/html/rfc7234#section-3
+	directives := parseCacheControl(h)
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return
+		}
+	}
+	if authorized {
+		_, public := directives["public"]
+		_, sMaxAge := directives["s-maxage"]
+		_, mustRevalidate := directives["must-revalidate"]
+		if !public && !sMaxAge && !mustRevalidate {
+			return
+		}
+	}
+
+	ttl := c.ttl
+	for _, d := range []string{"max-age", "s-maxage"} {
+		if v, ok := directives[d]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil {
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	header := h.Clone()
+	header.Del("Age")
+	header.Del(headerCacheStatus)
+
+	now := time.Now()
+	store.set(&entry{
+		Key:        key,
+		StatusCode: resp.StatusCode(),
+		Header:     header,
+		Body:       body,
+		Stored:     now.UnixNano(),
+		Expires:    now.Add(ttl).UnixNano(),
+	})
+}
+
+// varyCovered returns whether the headers in the Vary header of the
+// response are all covered by the vary headers of the spec.
+func (c *HTTPCache) varyCovered(h http.Header) bool {
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := c.vary[http.CanonicalHeaderKey(name)]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c *HTTPCache) purge(match func(key string) bool) int {
+	return c.store.purge(match)
+}
+
+// Status returns status.
+func (c *HTTPCache) Status() interface{} {
+	entries, size := c.store.stat()
+	return &Status{
+		Entries: entries,
+		Size:    size,
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+	}
+}
+
+// Close closes HTTPCache.
+func (c *HTTPCache) Close() {
+	unregisterCache(c)
+	if !c.storeInherited {
+		c.store.close()
+	}
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+func newHTTPCache(t *testing.T, yamlSpec string) *HTTPCache {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(t, err)
+
+	c := kind.CreateInstance(spec).(*HTTPCache)
+	c.Init()
+	return c
+}
+
+// serve handles a request by the cache, and responds by upstream if the
+// request is not served from the cache.
+func serve(c *HTTPCache, r *http.Request, upstream func(resp *httpprot.Response)) (*httpprot.Response, string) {
+	req, _ := httpprot.NewRequest(r)
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+
+	result := c.Handle(ctx)
+	if result != resultCached {
+		resp, _ := httpprot.NewResponse(nil)
+		upstream(resp)
+		ctx.SetOutputResponse(resp)
+	}
+	resp := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	ctx.Finish()
+	return resp, result
+}
+
+func TestHTTPCache(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newHTTPCache(t, `
+kind: HTTPCache
+name: cache
+ttl: 1m
+maxEntrySize: 10
+vary: [accept-encoding]
+`)
+	defer c.Close()
+	assert.Equal(kind, c.Kind())
+	assert.Equal("cache", c.Name())
+
+	calls := 0
+	upstream := func(resp *httpprot.Response) {
+		calls++
+		resp.HTTPHeader().Set("Content-Type", "text/plain")
+		resp.SetPayload("hello")
+	}
+	get := func(url string, header ...string) (*httpprot.Response, string) {
+		r, _ := http.NewRequest(http.MethodGet, url, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Add(header[i], header[i+1])
+		}
+		return serve(c, r, upstream)
+	}
+
+	// miss, and then hit.
+	resp, result := get("http://example.com/a?x=1")
+	assert.Equal("", result)
+	resp, result = get("http://example.com/a?x=1")
+	assert.Equal(resultCached, result)
+	assert.Equal(1, calls)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("hello", string(resp.RawPayload()))
+	assert.Equal("text/plain", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal("HIT", resp.HTTPHeader().Get(headerCacheStatus))
+	assert.Equal("0", resp.HTTPHeader().Get("Age"))
+
+	// different query and vary headers are different entries.
+	_, result = get("http://example.com/a?x=2")
+	assert.Equal("", result)
+	_, result = get("http://example.com/a?x=1", "Accept-Encoding", "gzip")
+	assert.Equal("", result)
+	_, result = get("http://example.com/a?x=1", "Accept-Encoding", "gzip")
+	assert.Equal(resultCached, result)
+
+	// the Cache-Control of the request.
+	_, result = get("http://example.com/a?x=1", "Cache-Control", "no-cache")
+	assert.Equal("", result)
+	_, result = get("http://example.com/a?x=1", "Cache-Control", "max-age=0")
+	assert.Equal("", result)
+	_, result = get("http://example.com/b", "Cache-Control", "no-store")
+	assert.Equal("", result)
+	_, result = get("http://example.com/b")
+	assert.Equal("", result)
+
+	// methods not configured.
+	r, _ := http.NewRequest(http.MethodPost, "http://example.com/a?x=1", nil)
+	_, result = serve(c, r, upstream)
+	assert.Equal("", result)
+
+	status := c.Status().(*Status)
+	assert.Equal(4, status.Entries)
+	assert.Equal(uint64(2), status.Hits)
+
+	// responses not cacheable.
+	for i, fn := range []func(resp *httpprot.Response){
+		func(resp *httpprot.Response) { resp.SetPayload("too large body") },
+		func(resp *httpprot.Response) { resp.SetStatusCode(http.StatusInternalServerError) },
+		func(resp *httpprot.Response) { resp.HTTPHeader().Set("Cache-Control", "private, max-age=60") },
+		func(resp *httpprot.Response) { resp.HTTPHeader().Set("Cache-Control", "no-store") },
+		func(resp *httpprot.Response) { resp.HTTPHeader().Set("Cache-Control", "max-age=0") },
+		func(resp *httpprot.Response) { resp.HTTPHeader().Set("Set-Cookie", "a=b") },
+		func(resp *httpprot.Response) { resp.HTTPHeader().Set("Vary", "User-Agent") },
+		func(resp *httpprot.Response) { resp.HTTPHeader().Set("Vary", "*") },
+	} {
+		r, _ := http.NewRequest(http.MethodGet, "http://example.com/c", nil)
+		serve(c, r, fn)
+		_, result = serve(c, r, fn)
+		assert.Equal("", result, i)
+	}
+
+	// requests with authorization are cached only if allowed explicitly.
+	r, _ = http.NewRequest(http.MethodGet, "http://example.com/d", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	serve(c, r, upstream)
+	_, result = serve(c, r, upstream)
+	assert.Equal("", result)
+	public := func(resp *httpprot.Response) {
+		resp.HTTPHeader().Set("Cache-Control", "public")
+	}
+	serve(c, r, public)
+	_, result = serve(c, r, public)
+	assert.Equal(resultCached, result)
+
+	// the max age of the response overrides the TTL.
+	shortLived := func(resp *httpprot.Response) {
+		resp.HTTPHeader().Set("Cache-Control", "max-age=1")
+	}
+	r, _ = http.NewRequest(http.MethodGet, "http://example.com/e", nil)
+	serve(c, r, shortLived)
+	e := c.store.get("GET http://example.com/e" + varySeparator + "Accept-Encoding:")
+	assert.NotNil(e)
+	assert.InDelta(time.Second, time.Duration(e.Expires-e.Stored), float64(time.Millisecond))
+}
+
+func TestParseCacheControl(t *testing.T) {
+	assert := assert.New(t)
+
+	h := http.Header{}
+	h.Add("Cache-Control", `No-Cache, max-age="60"`)
+	h.Add("Cache-Control", "private,,")
+	assert.Equal(map[string]string{"no-cache": "", "max-age": "60", "private": ""}, parseCacheControl(h))
+}
+
+func TestInheritAndPurge(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlSpec := `
+kind: HTTPCache
+name: cache
+`
+	c := newHTTPCache(t, yamlSpec)
+	upstream := func(resp *httpprot.Response) {
+		resp.SetPayload("hello")
+	}
+	for _, url := range []string{"http://example.com/a/1", "http://example.com/a/2", "http://example.com/b"} {
+		r, _ := http.NewRequest(http.MethodGet, url, nil)
+		serve(c, r, upstream)
+	}
+
+	// the entries are kept by the next generation.
+	rawSpec := make(map[string]interface{})
+	codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	spec, _ := filters.NewSpec(nil, "pipeline", rawSpec)
+	c2 := kind.CreateInstance(spec).(*HTTPCache)
+	c2.Inherit(c)
+	c.Close()
+	defer c2.Close()
+	assert.Equal(3, c2.Status().(*Status).Entries)
+
+	router := chi.NewRouter()
+	router.Delete(apiPath, purgeHandler)
+	purge := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodDelete, path, nil)
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := purge("/httpcache/pipeline/cache?key=GET+http://example.com/b")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq(`{"purged": 1}`, w.Body.String())
+
+	w = purge("/httpcache/pipeline/cache?prefix=GET+http://example.com/a/")
+	assert.JSONEq(`{"purged": 2}`, w.Body.String())
+	assert.Equal(0, c2.Status().(*Status).Entries)
+
+	w = purge("/httpcache/pipeline/cache")
+	assert.Equal(http.StatusBadRequest, w.Code)
+	w = purge("/httpcache/pipeline/unknown?prefix=")
+	assert.Equal(http.StatusNotFound, w.Code)
+}
+
+func TestMemoryStore(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newMemoryStore(20)
+	expires := time.Now().Add(time.Minute).UnixNano()
+	s.set(&entry{Key: "a", Body: []byte("123456789"), Expires: expires})
+	s.set(&entry{Key: "b", Body: []byte("123456789"), Expires: expires})
+	assert.NotNil(s.get("a"))
+
+	// b is the least recently used one.
+	s.set(&entry{Key: "c", Body: []byte("123456789"), Expires: expires})
+	assert.Nil(s.get("b"))
+	assert.NotNil(s.get("a"))
+	assert.NotNil(s.get("c"))
+	n, size := s.stat()
+	assert.Equal(2, n)
+	assert.Equal(int64(20), size)
+
+	// expired entries.
+	s.set(&entry{Key: "a", Body: []byte("1"), Expires: time.Now().UnixNano()})
+	assert.Nil(s.get("a"))
+
+	assert.Equal(1, s.purge(func(key string) bool { return true }))
+	s.close()
+}
+
+func TestDiskStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	s, err := newDiskStore(dir, 1<<20)
+	assert.NoError(err)
+
+	expires := time.Now().Add(time.Minute).UnixNano()
+	s.set(&entry{
+		Key:        "GET http://example.com/a",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       []byte("hello\nworld"),
+		Expires:    expires,
+	})
+	s.set(&entry{Key: "GET http://example.com/b", Body: []byte("b"), Expires: expires})
+	s.set(&entry{Key: "GET http://example.com/b", Body: []byte("bb"), Expires: expires})
+	s.set(&entry{Key: "GET http://example.com/c", Body: []byte("c"), Expires: time.Now().UnixNano()})
+	assert.Nil(s.get("GET http://example.com/c"))
+	s.close()
+
+	// the entries are loaded by a new store.
+	os.WriteFile(dir+"/invalid"+diskFileSuffix, []byte("invalid"), 0o600)
+	s, err = newDiskStore(dir, 1<<20)
+	assert.NoError(err)
+	defer s.close()
+	n, _ := s.stat()
+	assert.Equal(2, n)
+
+	e := s.get("GET http://example.com/a")
+	assert.NotNil(e)
+	assert.Equal(http.StatusOK, e.StatusCode)
+	assert.Equal("text/plain", e.Header.Get("Content-Type"))
+	assert.Equal("hello\nworld", string(e.Body))
+	assert.Equal("bb", string(s.get("GET http://example.com/b").Body))
+
+	assert.Equal(1, s.purge(func(key string) bool { return key == "GET http://example.com/a" }))
+	assert.Nil(s.get("GET http://example.com/a"))
+	files, _ := os.ReadDir(dir)
+	assert.Len(files, 1)
+}
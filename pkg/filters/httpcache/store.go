@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpcache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// entry is a cached response.
+	entry struct {
+		Key        string      `json:"key"`
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header"`
+		Body       []byte      `json:"-"`
+		// Stored and Expires are unix time in nanoseconds.
+		Stored  int64 `json:"stored"`
+		Expires int64 `json:"expires"`
+	}
+
+	// store stores the cached responses.
+	store interface {
+		get(key string) *entry
+		set(e *entry)
+		// purge removes the entries whose keys match, and returns the
+		// number of removed entries.
+		purge(match func(key string) bool) int
+		// stat returns the number of entries and their total size.
+		stat() (int, int64)
+		close()
+	}
+
+	// lruIndex indexes the entries by the least recently used order, and
+	// evicts the entries when their total size exceeds maxSize.
+	lruIndex struct {
+		maxSize int64
+		size    int64
+		list    *list.List
+		items   map[string]*list.Element
+		onEvict func(it *lruItem)
+	}
+
+	lruItem struct {
+		key     string
+		size    int64
+		expires int64
+		value   interface{}
+	}
+
+	// memoryStore stores the entries in memory.
+	memoryStore struct {
+		lock  sync.Mutex
+		index *lruIndex
+	}
+)
+
+func (e *entry) size() int64 {
+	size := int64(len(e.Key) + len(e.Body))
+	for k, values := range e.Header {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+func newLRUIndex(maxSize int64, onEvict func(it *lruItem)) *lruIndex {
+	return &lruIndex{
+		maxSize: maxSize,
+		list:    list.New(),
+		items:   map[string]*list.Element{},
+		onEvict: onEvict,
+	}
+}
+
+// get returns the item of key, expired items are removed.
+func (idx *lruIndex) get(key string) *lruItem {
+	elem := idx.items[key]
+	if elem == nil {
+		return nil
+	}
+	it := elem.Value.(*lruItem)
+	if time.Now().UnixNano() >= it.expires {
+		idx.remove(elem)
+		return nil
+	}
+	idx.list.MoveToFront(elem)
+	return it
+}
+
+// add adds an item, it replaces the item of the same key, and evicts the
+// least recently used items if the total size exceeds the max size.
+func (idx *lruIndex) add(it *lruItem) {
+	if elem := idx.items[it.key]; elem != nil {
+		idx.remove(elem)
+	}
+
+	idx.items[it.key] = idx.list.PushFront(it)
+	idx.size += it.size
+	for idx.size > idx.maxSize {
+		idx.remove(idx.list.Back())
+	}
+}
+
+func (idx *lruIndex) remove(elem *list.Element) {
+	it := idx.list.Remove(elem).(*lruItem)
+	delete(idx.items, it.key)
+	idx.size -= it.size
+	if idx.onEvict != nil {
+		idx.onEvict(it)
+	}
+}
+
+func (idx *lruIndex) purge(match func(key string) bool) int {
+	n := 0
+	for elem := idx.list.Front(); elem != nil; {
+		next := elem.Next()
+		if match(elem.Value.(*lruItem).key) {
+			idx.remove(elem)
+			n++
+		}
+		elem = next
+	}
+	return n
+}
+
+func newMemoryStore(maxSize int64) *memoryStore {
+	return &memoryStore{index: newLRUIndex(maxSize, nil)}
+}
+
+func (s *memoryStore) get(key string) *entry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if it := s.index.get(key); it != nil {
+		return it.value.(*entry)
+	}
+	return nil
+}
+
+func (s *memoryStore) set(e *entry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.index.add(&lruItem{key: e.Key, size: e.size(), expires: e.Expires, value: e})
+}
+
+func (s *memoryStore) purge(match func(key string) bool) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.index.purge(match)
+}
+
+func (s *memoryStore) stat() (int, int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.index.items), s.index.size
+}
+
+func (s *memoryStore) close() {
+}
@@ -18,9 +18,14 @@
 package kafka
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sync/atomic"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/pkg/context"
@@ -33,13 +38,16 @@ const (
 	// Kind is the kind of Kafka
 	Kind = "Kafka"
 
-	resultParseErr = "parseErr"
+	resultParseErr   = "parseErr"
+	resultProduceErr = "produceErr"
+
+	defaultDeliveryTimeout = 10 * time.Second
 )
 
 var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Kafka is a backend of MQTTProxy",
-	Results:     []string{resultParseErr},
+	Results:     []string{resultParseErr, resultProduceErr},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -59,6 +67,17 @@ type (
 		producer sarama.AsyncProducer
 		done     chan struct{}
 		header   string
+
+		keyHeader  string
+		waitForAck bool
+		timeout    time.Duration
+		status     *Status
+	}
+
+	// Status is the status of Kafka.
+	Status struct {
+		Sent   uint64 `json:"sent"`
+		Failed uint64 `json:"failed"`
 	}
 )
 
@@ -88,15 +107,114 @@ func (k *Kafka) setHeader(spec *Spec) {
 	}
 }
 
+func (k *Kafka) setKey(spec *Spec) {
+	if spec.Key != nil && spec.Key.Header != "" {
+		k.keyHeader = http.CanonicalHeaderKey(spec.Key.Header)
+	}
+}
+
+func (spec *TLS) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: spec.InsecureSkipVerify}
+
+	if spec.CertBase64 != "" {
+		certPem, _ := base64.StdEncoding.DecodeString(spec.CertBase64)
+		keyPem, _ := base64.StdEncoding.DecodeString(spec.KeyBase64)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("generate x509 key pair failed: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if spec.RootCertBase64 != "" {
+		rootCertPem, _ := base64.StdEncoding.DecodeString(spec.RootCertBase64)
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(rootCertPem) {
+			return nil, fmt.Errorf("invalid root cert")
+		}
+		cfg.RootCAs = pool
+	}
+
+	return cfg, nil
+}
+
+// newConfig creates the sarama config from the spec.
+func newConfig(spec *Spec) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.ClientID = spec.Name()
+	config.Version = sarama.V1_0_0_0
+
+	switch spec.Partitioner {
+	case "random":
+		config.Producer.Partitioner = sarama.NewRandomPartitioner
+	case "roundRobin":
+		config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	default:
+		config.Producer.Partitioner = sarama.NewHashPartitioner
+	}
+
+	if sasl := spec.SASL; sasl != nil {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = sasl.Username
+		config.Net.SASL.Password = sasl.Password
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		if sasl.Mechanism != "" {
+			config.Net.SASL.Mechanism = sarama.SASLMechanism(sasl.Mechanism)
+		}
+		if config.Net.SASL.Mechanism != sarama.SASLTypePlaintext {
+			config.Net.SASL.SCRAMClientGeneratorFunc = newSCRAMClientGenerator(sasl.Mechanism)
+		}
+	}
+
+	if spec.TLS != nil {
+		tlsCfg, err := spec.TLS.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsCfg
+	}
+
+	if b := spec.Batch; b != nil {
+		config.Producer.Flush.Messages = b.Messages
+		config.Producer.Flush.Bytes = b.Bytes
+		config.Producer.Flush.MaxMessages = b.MaxMessages
+		if b.Frequency != "" {
+			config.Producer.Flush.Frequency, _ = time.ParseDuration(b.Frequency)
+		}
+	}
+
+	if d := spec.Delivery; d != nil {
+		config.Producer.RequiredAcks = d.requiredAcks()
+		if d.MaxRetries > 0 {
+			config.Producer.Retry.Max = d.MaxRetries
+		}
+		config.Producer.Return.Successes = d.WaitForAck
+	}
+
+	return config, config.Validate()
+}
+
 // Init init Kafka
 func (k *Kafka) Init() {
 	spec := k.spec
 	k.done = make(chan struct{})
+	k.status = &Status{}
 	k.setHeader(k.spec)
+	k.setKey(k.spec)
 
-	config := sarama.NewConfig()
-	config.ClientID = spec.Name()
-	config.Version = sarama.V1_0_0_0
+	k.timeout = defaultDeliveryTimeout
+	if d := spec.Delivery; d != nil {
+		k.waitForAck = d.WaitForAck
+		if d.Timeout != "" {
+			k.timeout, _ = time.ParseDuration(d.Timeout)
+		}
+	}
+
+	config, err := newConfig(spec)
+	if err != nil {
+		panic(fmt.Errorf("invalid kafka config: %v", err))
+	}
 	producer, err := sarama.NewAsyncProducer(k.spec.Backend, config)
 	if err != nil {
 		panic(fmt.Errorf("start sarama producer with address %v failed: %v", k.spec.Backend, err))
@@ -106,6 +224,13 @@ func (k *Kafka) Init() {
 	go k.checkProduceError()
 }
 
+// notify notifies the waiting handler of the delivery result of msg.
+func notify(msg *sarama.ProducerMessage, err error) {
+	if ch, ok := msg.Metadata.(chan error); ok {
+		ch <- err
+	}
+}
+
 func (k *Kafka) checkProduceError() {
 	for {
 		select {
@@ -115,11 +240,20 @@ func (k *Kafka) checkProduceError() {
 				logger.Errorf("close kafka producer failed: %v", err)
 			}
 			return
+		case msg, ok := <-k.producer.Successes():
+			if !ok {
+				return
+			}
+			notify(msg, nil)
 		case err, ok := <-k.producer.Errors():
 			if !ok {
 				return
 			}
+			if k.status != nil {
+				atomic.AddUint64(&k.status.Failed, 1)
+			}
 			logger.Errorf("sarama producer failed: %v", err)
+			notify(err.Msg, err.Err)
 		}
 	}
 }
@@ -136,7 +270,13 @@ func (k *Kafka) Close() {
 
 // Status return status of Kafka
 func (k *Kafka) Status() interface{} {
-	return nil
+	if k.status == nil {
+		return nil
+	}
+	return &Status{
+		Sent:   atomic.LoadUint64(&k.status.Sent),
+		Failed: atomic.LoadUint64(&k.status.Failed),
+	}
 }
 
 func (k *Kafka) getTopic(req *httpprot.Request) string {
@@ -150,6 +290,18 @@ func (k *Kafka) getTopic(req *httpprot.Request) string {
 	return topic
 }
 
+func (k *Kafka) getKey(req *httpprot.Request) string {
+	if k.keyHeader != "" {
+		if key := req.Std().Header.Get(k.keyHeader); key != "" {
+			return key
+		}
+	}
+	if k.spec.Key != nil && k.spec.Key.Query != "" {
+		return req.Std().URL.Query().Get(k.spec.Key.Query)
+	}
+	return ""
+}
+
 // Handle handles the context.
 func (k *Kafka) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
@@ -164,6 +316,46 @@ func (k *Kafka) Handle(ctx *context.Context) (result string) {
 		Topic: topic,
 		Value: sarama.ByteEncoder(body),
 	}
-	k.producer.Input() <- msg
-	return ""
+	if key := k.getKey(req); key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+
+	if !k.waitForAck {
+		k.producer.Input() <- msg
+		k.countSent()
+		return ""
+	}
+
+	// wait for the acknowledgement of Kafka, the channel is buffered as
+	// the result may come after the timeout.
+	ch := make(chan error, 1)
+	msg.Metadata = ch
+	timer := time.NewTimer(k.timeout)
+	defer timer.Stop()
+
+	select {
+	case k.producer.Input() <- msg:
+		k.countSent()
+	case <-timer.C:
+		logger.Warnf("%s: timeout sending message to topic %s", k.Name(), topic)
+		return resultProduceErr
+	}
+
+	select {
+	case err := <-ch:
+		if err != nil {
+			logger.Warnf("%s: failed to send message to topic %s: %v", k.Name(), topic, err)
+			return resultProduceErr
+		}
+		return ""
+	case <-timer.C:
+		logger.Warnf("%s: timeout waiting for acknowledgement of topic %s", k.Name(), topic)
+		return resultProduceErr
+	}
+}
+
+func (k *Kafka) countSent() {
+	if k.status != nil {
+		atomic.AddUint64(&k.status.Sent, 1)
+	}
 }
@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/pkg/context"
@@ -36,12 +37,14 @@ func init() {
 }
 
 type mockAsyncProducer struct {
-	ch chan *sarama.ProducerMessage
+	ch        chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
 }
 
 func (m *mockAsyncProducer) AsyncClose()                               {}
-func (m *mockAsyncProducer) Successes() <-chan *sarama.ProducerMessage { return nil }
-func (m *mockAsyncProducer) Errors() <-chan *sarama.ProducerError      { return nil }
+func (m *mockAsyncProducer) Successes() <-chan *sarama.ProducerMessage { return m.successes }
+func (m *mockAsyncProducer) Errors() <-chan *sarama.ProducerError      { return m.errors }
 
 func (m *mockAsyncProducer) Input() chan<- *sarama.ProducerMessage {
 	return m.ch
@@ -146,3 +149,154 @@ func TestHandleHTTP(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal("text", string(value))
 }
+
+func TestNewConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := defaultFilterSpec(t, &Spec{
+		Topic:       &Topic{Default: "default-topic"},
+		Partitioner: "roundRobin",
+		SASL:        &SASL{Mechanism: sarama.SASLTypeSCRAMSHA512, Username: "user", Password: "pass"},
+		TLS:         &TLS{InsecureSkipVerify: true},
+		Batch:       &Batch{Messages: 100, Bytes: 1024, Frequency: "100ms"},
+		Delivery:    &Delivery{RequiredAcks: "all", MaxRetries: 5, WaitForAck: true},
+	}).(*Spec)
+
+	config, err := newConfig(spec)
+	assert.NoError(err)
+	assert.True(config.Net.SASL.Enable)
+	assert.Equal(sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	assert.NotNil(config.Net.SASL.SCRAMClientGeneratorFunc)
+	assert.True(config.Net.TLS.Enable)
+	assert.True(config.Net.TLS.Config.InsecureSkipVerify)
+	assert.Equal(100, config.Producer.Flush.Messages)
+	assert.Equal(1024, config.Producer.Flush.Bytes)
+	assert.Equal(100*time.Millisecond, config.Producer.Flush.Frequency)
+	assert.Equal(sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(5, config.Producer.Retry.Max)
+	assert.True(config.Producer.Return.Successes)
+
+	spec.SASL.Mechanism = ""
+	config, err = newConfig(spec)
+	assert.NoError(err)
+	assert.Equal(sarama.SASLMechanism(sarama.SASLTypePlaintext), config.Net.SASL.Mechanism)
+	assert.Nil(config.Net.SASL.SCRAMClientGeneratorFunc)
+
+	spec.TLS = &TLS{RootCertBase64: "aW52YWxpZA=="}
+	_, err = newConfig(spec)
+	assert.Error(err)
+
+	assert.Error((&Spec{Key: &Key{}}).Validate())
+	assert.Error((&Spec{TLS: &TLS{CertBase64: "aW52YWxpZA=="}}).Validate())
+	assert.Error((&Spec{Batch: &Batch{Frequency: "1"}}).Validate())
+	assert.Error((&Spec{Delivery: &Delivery{Timeout: "1"}}).Validate())
+}
+
+func TestSCRAMClient(t *testing.T) {
+	assert := assert.New(t)
+
+	// test vector of RFC 7677.
+	c := newSCRAMClientGenerator(sarama.SASLTypeSCRAMSHA256)().(*scramClient)
+	assert.NoError(c.Begin("user", "pencil", ""))
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+
+	msg, err := c.Step("")
+	assert.NoError(err)
+	assert.Equal("n,,n=user,r=rOprNGfwEbeRWgbNEkqO", msg)
+	assert.False(c.Done())
+
+	msg, err = c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.NoError(err)
+	assert.Equal("c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", msg)
+
+	_, err = c.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	assert.NoError(err)
+	assert.True(c.Done())
+
+	// invalid server signature and nonce.
+	assert.NoError(c.Begin("user", "pencil", ""))
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+	c.Step("")
+	c.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	_, err = c.Step("v=aW52YWxpZA==")
+	assert.Error(err)
+
+	assert.NoError(c.Begin("user", "pencil", ""))
+	c.Step("")
+	_, err = c.Step("r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.Error(err)
+}
+
+func TestHandleKeyAndWaitForAck(t *testing.T) {
+	assert := assert.New(t)
+
+	producer := &mockAsyncProducer{
+		ch:        make(chan *sarama.ProducerMessage, 100),
+		successes: make(chan *sarama.ProducerMessage, 100),
+		errors:    make(chan *sarama.ProducerError, 100),
+	}
+	kafka := Kafka{
+		spec: &Spec{
+			Topic:    &Topic{Default: "default-topic"},
+			Key:      &Key{Header: "x-kafka-key", Query: "key"},
+			Delivery: &Delivery{WaitForAck: true},
+		},
+		producer:   producer,
+		done:       make(chan struct{}),
+		status:     &Status{},
+		waitForAck: true,
+		timeout:    time.Second,
+	}
+	kafka.setKey(kafka.spec)
+	go kafka.checkProduceError()
+	defer kafka.Close()
+
+	// the broker acknowledges the first message and rejects the second.
+	go func() {
+		producer.successes <- <-producer.ch
+		producer.errors <- &sarama.ProducerError{Msg: <-producer.ch, Err: fmt.Errorf("broker down")}
+	}()
+
+	ctx := context.New(nil)
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1/?key=query-key", strings.NewReader("text"))
+	assert.Nil(err)
+	req.Header.Add("x-kafka-key", "header-key")
+	setRequest(t, ctx, req)
+	assert.Equal("", kafka.Handle(ctx))
+
+	req, err = http.NewRequest(http.MethodPost, "http://127.0.0.1/?key=query-key", strings.NewReader("text"))
+	assert.Nil(err)
+	setRequest(t, ctx, req)
+	assert.Equal(resultProduceErr, kafka.Handle(ctx))
+
+	status := kafka.Status().(*Status)
+	assert.Equal(uint64(2), status.Sent)
+	assert.Equal(uint64(1), status.Failed)
+
+	// keys of the messages.
+	kafka.waitForAck = false
+	req, err = http.NewRequest(http.MethodPost, "http://127.0.0.1/?key=query-key", strings.NewReader("text"))
+	assert.Nil(err)
+	req.Header.Add("x-kafka-key", "header-key")
+	setRequest(t, ctx, req)
+	assert.Equal("", kafka.Handle(ctx))
+	msg := <-producer.ch
+	key, _ := msg.Key.Encode()
+	assert.Equal("header-key", string(key))
+
+	req, err = http.NewRequest(http.MethodPost, "http://127.0.0.1/?key=query-key", strings.NewReader("text"))
+	assert.Nil(err)
+	setRequest(t, ctx, req)
+	assert.Equal("", kafka.Handle(ctx))
+	msg = <-producer.ch
+	key, _ = msg.Key.Encode()
+	assert.Equal("query-key", string(key))
+
+	// timeout waiting for the acknowledgement.
+	kafka.waitForAck = true
+	kafka.timeout = 50 * time.Millisecond
+	req, err = http.NewRequest(http.MethodPost, "http://127.0.0.1", strings.NewReader("text"))
+	assert.Nil(err)
+	setRequest(t, ctx, req)
+	assert.Equal(resultProduceErr, kafka.Handle(ctx))
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient is a SCRAM client of RFC 5802, the user names and passwords
+// are not normalized by SASLprep, so they should be ASCII strings.
+type scramClient struct {
+	hash func() hash.Hash
+
+	step        int
+	user        string
+	password    string
+	authzID     string
+	nonce       string
+	firstBare   string
+	serverSign  []byte
+	authMessage string
+}
+
+var _ sarama.SCRAMClient = (*scramClient)(nil)
+
+func newSCRAMClientGenerator(mechanism string) func() sarama.SCRAMClient {
+	h := sha256.New
+	if mechanism == sarama.SASLTypeSCRAMSHA512 {
+		h = sha512.New
+	}
+	return func() sarama.SCRAMClient {
+		return &scramClient{hash: h}
+	}
+}
+
+func scramEscape(s string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s)
+}
+
+func (c *scramClient) hmac(key []byte, data string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Begin prepares the client for the SCRAM exchange.
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	c.step = 0
+	c.user, c.password, c.authzID = userName, password, authzID
+	c.nonce = base64.RawStdEncoding.EncodeToString(nonce)
+	return nil
+}
+
+func (c *scramClient) gs2Header() string {
+	if c.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + scramEscape(c.authzID) + ","
+}
+
+// Step steps the client through the SCRAM exchange.
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		c.firstBare = "n=" + scramEscape(c.user) + ",r=" + c.nonce
+		return c.gs2Header() + c.firstBare, nil
+	case 2:
+		return c.finalMessage(challenge)
+	case 3:
+		return "", c.verify(challenge)
+	default:
+		return "", fmt.Errorf("unexpected scram step %d", c.step)
+	}
+}
+
+func scramAttributes(msg string) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range strings.Split(msg, ",") {
+		if len(kv) > 2 && kv[1] == '=' {
+			attrs[kv[:1]] = kv[2:]
+		}
+	}
+	return attrs
+}
+
+func (c *scramClient) finalMessage(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	if e, ok := attrs["e"]; ok {
+		return "", fmt.Errorf("scram server error: %s", e)
+	}
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return "", fmt.Errorf("invalid scram server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil {
+		return "", fmt.Errorf("invalid scram salt: %v", err)
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations <= 0 {
+		return "", fmt.Errorf("invalid scram iteration count %s", attrs["i"])
+	}
+
+	channelBinding := base64.StdEncoding.EncodeToString([]byte(c.gs2Header()))
+	withoutProof := "c=" + channelBinding + ",r=" + nonce
+	c.authMessage = c.firstBare + "," + serverFirst + "," + withoutProof
+
+	salted := pbkdf2.Key([]byte(c.password), salt, iterations, c.hash().Size(), c.hash)
+	clientKey := c.hmac(salted, "Client Key")
+	h := c.hash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+
+	proof := c.hmac(storedKey, c.authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	c.serverSign = c.hmac(c.hmac(salted, "Server Key"), c.authMessage)
+
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verify(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("scram server error: %s", e)
+	}
+	sign, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(sign, c.serverSign) {
+		return fmt.Errorf("invalid scram server signature")
+	}
+	return nil
+}
+
+// Done returns whether the SCRAM exchange is over.
+func (c *scramClient) Done() bool {
+	return c.step >= 3
+}
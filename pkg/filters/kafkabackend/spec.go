@@ -17,15 +17,28 @@
 
 package kafka
 
-import "github.com/megaease/easegress/pkg/filters"
+import (
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/filters"
+)
 
 type (
 	// Spec is spec of Kafka
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		Backend []string `json:"backend" jsonschema:"required,uniqueItems=true"`
-		Topic   *Topic   `json:"topic" jsonschema:"required"`
+		Backend     []string  `json:"backend" jsonschema:"required,uniqueItems=true"`
+		Topic       *Topic    `json:"topic" jsonschema:"required"`
+		Key         *Key      `json:"key,omitempty" jsonschema:"omitempty"`
+		Partitioner string    `json:"partitioner,omitempty" jsonschema:"omitempty,enum=,enum=hash,enum=random,enum=roundRobin"`
+		SASL        *SASL     `json:"sasl,omitempty" jsonschema:"omitempty"`
+		TLS         *TLS      `json:"tls,omitempty" jsonschema:"omitempty"`
+		Batch       *Batch    `json:"batch,omitempty" jsonschema:"omitempty"`
+		Delivery    *Delivery `json:"delivery,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Topic defined ways to get Kafka topic
@@ -38,4 +51,75 @@ type (
 	Dynamic struct {
 		Header string `json:"header" jsonschema:"omitempty"`
 	}
+
+	// Key defines ways to get the key of Kafka messages from http request,
+	// which is used to choose the partition, the header takes precedence
+	// over the query.
+	Key struct {
+		Header string `json:"header,omitempty" jsonschema:"omitempty"`
+		Query  string `json:"query,omitempty" jsonschema:"omitempty"`
+	}
+
+	// SASL is the SASL authentication of Kafka.
+	SASL struct {
+		Mechanism string `json:"mechanism,omitempty" jsonschema:"omitempty,enum=,enum=PLAIN,enum=SCRAM-SHA-256,enum=SCRAM-SHA-512"`
+		Username  string `json:"username" jsonschema:"required"`
+		Password  string `json:"password" jsonschema:"required"`
+	}
+
+	// TLS is the TLS configuration of the connections to Kafka.
+	TLS struct {
+		CertBase64         string `json:"certBase64,omitempty" jsonschema:"omitempty,format=base64"`
+		KeyBase64          string `json:"keyBase64,omitempty" jsonschema:"omitempty,format=base64"`
+		RootCertBase64     string `json:"rootCertBase64,omitempty" jsonschema:"omitempty,format=base64"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Batch defines when to flush the batched messages to Kafka.
+	Batch struct {
+		Messages    int    `json:"messages,omitempty" jsonschema:"omitempty,minimum=0"`
+		Bytes       int    `json:"bytes,omitempty" jsonschema:"omitempty,minimum=0"`
+		Frequency   string `json:"frequency,omitempty" jsonschema:"omitempty,format=duration"`
+		MaxMessages int    `json:"maxMessages,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Delivery defines the delivery guarantee of Kafka messages.
+	Delivery struct {
+		RequiredAcks string `json:"requiredAcks,omitempty" jsonschema:"omitempty,enum=,enum=none,enum=leader,enum=all"`
+		MaxRetries   int    `json:"maxRetries,omitempty" jsonschema:"omitempty,minimum=0"`
+		WaitForAck   bool   `json:"waitForAck,omitempty" jsonschema:"omitempty"`
+		Timeout      string `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+	}
 )
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Key != nil && spec.Key.Header == "" && spec.Key.Query == "" {
+		return fmt.Errorf("both header and query of key are empty")
+	}
+	if spec.TLS != nil && (spec.TLS.CertBase64 == "") != (spec.TLS.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 of tls must be both specified or both empty")
+	}
+	if spec.Batch != nil && spec.Batch.Frequency != "" {
+		if _, err := time.ParseDuration(spec.Batch.Frequency); err != nil {
+			return fmt.Errorf("invalid batch frequency %s: %v", spec.Batch.Frequency, err)
+		}
+	}
+	if spec.Delivery != nil && spec.Delivery.Timeout != "" {
+		if _, err := time.ParseDuration(spec.Delivery.Timeout); err != nil {
+			return fmt.Errorf("invalid delivery timeout %s: %v", spec.Delivery.Timeout, err)
+		}
+	}
+	return nil
+}
+
+func (d *Delivery) requiredAcks() sarama.RequiredAcks {
+	switch d.RequiredAcks {
+	case "none":
+		return sarama.NoResponse
+	case "all":
+		return sarama.WaitForAll
+	default:
+		return sarama.WaitForLocal
+	}
+}
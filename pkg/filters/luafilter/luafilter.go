@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package luafilter implements a filter which runs Lua scripts to inspect
+// and mutate requests and responses.
+package luafilter
+
+import (
+	stdcontext "context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/megaease/easegress/pkg/cluster/kvstore"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of LuaFilter.
+	Kind          = "LuaFilter"
+	maxLuaResult  = 9
+	handlerName   = "handle"
+	resultLuaErr  = "luaError"
+	resultTimeout = "timeout"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LuaFilter runs Lua scripts to inspect and mutate requests and responses",
+	Results:     []string{resultLuaErr, resultTimeout},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			MaxConcurrency: 10,
+			Timeout:        "100ms",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LuaFilter{spec: spec.(*Spec)}
+	},
+}
+
+func luaResultToFilterResult(r int) string {
+	if r == 0 {
+		return ""
+	}
+	return fmt.Sprintf("luaResult%d", r)
+}
+
+func init() {
+	for i := 1; i <= maxLuaResult; i++ {
+		kind.Results = append(kind.Results, luaResultToFilterResult(i))
+	}
+	filters.Register(kind)
+}
+
+type (
+	// Spec is the spec of LuaFilter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxConcurrency int32             `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+		Code           string            `json:"code" jsonschema:"required"`
+		Timeout        string            `json:"timeout" jsonschema:"required,format=duration"`
+		Parameters     map[string]string `json:"parameters" jsonschema:"omitempty"`
+		// KVNamespace is the namespace of the shared key-value store
+		// accessed by the kv functions, it is private to the filter by
+		// default.
+		KVNamespace string `json:"kvNamespace,omitempty" jsonschema:"omitempty"`
+		// KVCacheTTL caches the values of the key-value store locally.
+		KVCacheTTL string `json:"kvCacheTTL,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	// LuaFilter is the filter which runs Lua scripts.
+	LuaFilter struct {
+		spec    *Spec
+		proto   *lua.FunctionProto
+		timeout time.Duration
+		pool    chan *vm
+		kv      *kvstore.Store
+
+		numOfRequest  int64
+		numOfLuaError int64
+	}
+
+	// Status is the status of LuaFilter.
+	Status struct {
+		NumOfRequest  int64 `json:"numOfRequest"`
+		NumOfLuaError int64 `json:"numOfLuaError"`
+	}
+)
+
+// compile compiles the Lua code.
+func compile(code string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(code), Kind)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, Kind)
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if strings.Contains(spec.KVNamespace, "/") {
+		return fmt.Errorf("kvNamespace must not contain '/'")
+	}
+
+	proto, err := compile(spec.Code)
+	if err != nil {
+		return fmt.Errorf("invalid lua code: %v", err)
+	}
+
+	// the handler is checked by a state, as it may be defined dynamically.
+	v, err := newVM(&LuaFilter{spec: spec, proto: proto})
+	if err != nil {
+		return err
+	}
+	v.close()
+	return nil
+}
+
+// Name returns the name of the LuaFilter filter instance.
+func (f *LuaFilter) Name() string {
+	return f.spec.Name()
+}
+
+// Kind returns the kind of LuaFilter.
+func (f *LuaFilter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LuaFilter.
+func (f *LuaFilter) Spec() filters.Spec {
+	return f.spec
+}
+
+// Init initializes LuaFilter.
+func (f *LuaFilter) Init() {
+	if err := f.reload(); err != nil {
+		logger.Errorf("%s: %v", f.spec.Name(), err)
+	}
+}
+
+// Inherit inherits previous generation of LuaFilter.
+func (f *LuaFilter) Inherit(previousGeneration filters.Filter) {
+	f.Init()
+}
+
+func (f *LuaFilter) reload() error {
+	var err error
+	f.timeout, _ = time.ParseDuration(f.spec.Timeout)
+	if super := f.spec.Super(); super != nil && super.Cluster() != nil {
+		ns := f.spec.KVNamespace
+		if ns == "" {
+			ns = f.spec.Pipeline() + "-" + f.spec.Name()
+		}
+		cacheTTL, _ := time.ParseDuration(f.spec.KVCacheTTL)
+		f.kv = kvstore.Namespace(super.Cluster(), ns).WithCache(cacheTTL)
+	}
+
+	f.proto, err = compile(f.spec.Code)
+	if err != nil {
+		return err
+	}
+
+	// all states are created at the beginning to report the errors of the
+	// code as early as possible.
+	f.pool = make(chan *vm, f.spec.MaxConcurrency)
+	for i := int32(0); i < f.spec.MaxConcurrency; i++ {
+		v, err := newVM(f)
+		if err != nil {
+			f.Close()
+			f.pool = nil
+			return err
+		}
+		f.pool <- v
+	}
+	return nil
+}
+
+// Handle handles the request.
+func (f *LuaFilter) Handle(ctx *context.Context) (result string) {
+	if f.pool == nil {
+		ctx.AddTag("lua states are not initialized")
+		return resultLuaErr
+	}
+
+	atomic.AddInt64(&f.numOfRequest, 1)
+
+	v := <-f.pool
+	if v == nil {
+		var err error
+		if v, err = newVM(f); err != nil {
+			f.pool <- nil
+			logger.Errorf("%s: failed to create lua state: %v", f.spec.Name(), err)
+			atomic.AddInt64(&f.numOfLuaError, 1)
+			return resultLuaErr
+		}
+	}
+
+	stdctx := ctx.GetInputRequest().(*httpprot.Request).Context()
+	if f.timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		stdctx, cancel = stdcontext.WithTimeout(stdctx, f.timeout)
+		defer cancel()
+	}
+
+	n, err := v.run(stdctx, ctx)
+	if err != nil {
+		// the state is discarded as it may be in an inconsistent state, a
+		// new one is created when it is needed.
+		v.close()
+		f.pool <- nil
+
+		atomic.AddInt64(&f.numOfLuaError, 1)
+		if stdctx.Err() != nil {
+			ctx.AddTag(fmt.Sprintf("%s: lua execution timeout", f.spec.Name()))
+			return resultTimeout
+		}
+		ctx.AddTag(fmt.Sprintf("%s: %v", f.spec.Name(), err))
+		return resultLuaErr
+	}
+
+	f.pool <- v
+	return luaResultToFilterResult(n)
+}
+
+// Status returns Status generated by the filter.
+func (f *LuaFilter) Status() interface{} {
+	return &Status{
+		NumOfRequest:  atomic.LoadInt64(&f.numOfRequest),
+		NumOfLuaError: atomic.LoadInt64(&f.numOfLuaError),
+	}
+}
+
+// Close closes LuaFilter. The states being used by the requests in flight
+// are closed by the garbage collector.
+func (f *LuaFilter) Close() {
+	for {
+		select {
+		case v := <-f.pool:
+			if v != nil {
+				v.close()
+			}
+		default:
+			return
+		}
+	}
+}
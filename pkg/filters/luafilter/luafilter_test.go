@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luafilter
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/cluster/kvstore"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createLuaFilter(t *testing.T, yamlConfig string) (filters.Filter, error) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		return nil, err
+	}
+	f := kind.CreateInstance(spec)
+	f.Init()
+	return f, nil
+}
+
+func newContext(t *testing.T, method, url string, body string) *context.Context {
+	stdr, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(1024))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+code: "function handle( end"
+`)
+	assert.Error(err)
+
+	_, err = createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+code: "x = 1"
+`)
+	assert.Error(err)
+
+	// the unsafe functions are removed.
+	_, err = createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+code: |
+  dofile("/etc/passwd")
+  function handle() end
+`)
+	assert.Error(err)
+
+	_, err = createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+code: |
+  local x = os.getenv("HOME")
+  function handle() end
+`)
+	assert.Error(err)
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+maxConcurrency: 1
+parameters:
+  prefix: /api
+code: |
+  local count = 0
+  function handle()
+    count = count + 1
+    if request.header("X-Block") then
+      response.set_status(403)
+      response.set_header("X-Count", tostring(count))
+      response.set_body("blocked")
+      return 1
+    end
+    if request.path() == "/error" then
+      error("boom")
+    end
+    if request.path() == "/loop" then
+      while true do end
+    end
+    if request.path() == "/invalid" then
+      return "abc"
+    end
+    request.set_path(params.prefix .. request.path())
+    request.set_header("X-User", request.query("user") or "anonymous")
+    request.set_body(string.upper(request.body()))
+    add_tag("rewritten")
+  end
+`)
+	assert.NoError(err)
+	defer f.Close()
+
+	ctx := newContext(t, http.MethodPost, "http://example.com/users?user=bob", "hello")
+	assert.Equal("", f.Handle(ctx))
+	req := ctx.GetOutputRequest().(*httpprot.Request)
+	assert.Equal("/api/users", req.Path())
+	assert.Equal("bob", req.HTTPHeader().Get("X-User"))
+	assert.Equal("HELLO", string(req.RawPayload()))
+	assert.Contains(ctx.Tags(), "rewritten")
+
+	ctx = newContext(t, http.MethodGet, "http://example.com/", "")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Block", "1")
+	assert.Equal("luaResult1", f.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(403, resp.StatusCode())
+	assert.Equal("2", resp.HTTPHeader().Get("X-Count"))
+	assert.Equal("blocked", string(resp.RawPayload()))
+
+	ctx = newContext(t, http.MethodGet, "http://example.com/error", "")
+	assert.Equal(resultLuaErr, f.Handle(ctx))
+
+	ctx = newContext(t, http.MethodGet, "http://example.com/invalid", "")
+	assert.Equal(resultLuaErr, f.Handle(ctx))
+
+	ctx = newContext(t, http.MethodGet, "http://example.com/loop", "")
+	assert.Equal(resultTimeout, f.Handle(ctx))
+
+	// a new state is created after the errors, so the count is reset.
+	ctx = newContext(t, http.MethodGet, "http://example.com/", "")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Block", "1")
+	assert.Equal("luaResult1", f.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("1", resp.HTTPHeader().Get("X-Count"))
+
+	status := f.Status().(*Status)
+	assert.Equal(int64(6), status.NumOfRequest)
+	assert.Equal(int64(3), status.NumOfLuaError)
+}
+
+func TestKV(t *testing.T) {
+	assert := assert.New(t)
+
+	kvs := map[string]string{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.MockedGet = func(key string) (*string, error) {
+		if v, ok := kvs[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedPut = func(key, value string) error {
+		kvs[key] = value
+		return nil
+	}
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		return apply(&clustertest.MockedSTM{
+			MockedGet: func(key ...string) string {
+				return kvs[key[0]]
+			},
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) {
+				kvs[key] = val
+			},
+		})
+	}
+
+	f, err := createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+maxConcurrency: 1
+code: |
+  function handle()
+    if kv.get("flag") == nil then
+      kv.set("flag", "on", 60)
+    end
+    response.set_header("X-Count", tostring(kv.incr("count")))
+    response.set_header("X-Flag", kv.get("flag"))
+  end
+`)
+	assert.NoError(err)
+	lf := f.(*LuaFilter)
+
+	// the kv functions fail if the cluster is unavailable.
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/", "")
+	assert.Equal(resultLuaErr, f.Handle(ctx))
+
+	lf.kv = kvstore.Namespace(cls, "demo")
+	for i := 1; i <= 2; i++ {
+		ctx = newContext(t, http.MethodGet, "http://127.0.0.1/", "")
+		assert.Equal("", f.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(strconv.Itoa(i), resp.HTTPHeader().Get("X-Count"))
+		assert.Equal("on", resp.HTTPHeader().Get("X-Flag"))
+	}
+	assert.Contains(kvs, "/kv/demo/flag")
+
+	_, err = createLuaFilter(t, `
+kind: LuaFilter
+name: lua
+kvNamespace: a/b
+code: "function handle() end"
+`)
+	assert.Error(err)
+}
@@ -0,0 +1,469 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package luafilter
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/megaease/easegress/pkg/cluster/kvstore"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+// initTimeout is the timeout to run the top level code of the script.
+const initTimeout = 5 * time.Second
+
+// unsafeGlobals are removed from the base library, so that the scripts can't
+// access the file system or load other code.
+var unsafeGlobals = []string{
+	"dofile", "loadfile", "load", "loadstring", "module", "require",
+	"getfenv", "setfenv", "_printregs",
+}
+
+// vm is a Lua state with the API to access the request and response.
+type vm struct {
+	filter  *LuaFilter
+	state   *lua.LState
+	handler *lua.LFunction
+	ctx     *context.Context
+}
+
+func newVM(f *LuaFilter) (*vm, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	v := &vm{filter: f, state: L}
+
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeGlobals {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	v.registerAPI()
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), initTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(f.proto))
+	err := L.PCall(0, 0, nil)
+	L.RemoveContext()
+	if err != nil {
+		L.Close()
+		return nil, fmt.Errorf("run lua code failed: %v", err)
+	}
+
+	handler, ok := L.GetGlobal(handlerName).(*lua.LFunction)
+	if !ok {
+		L.Close()
+		return nil, fmt.Errorf("lua code doesn't define function '%s'", handlerName)
+	}
+	v.handler = handler
+	return v, nil
+}
+
+// run calls the handler, and returns the result number returned by it.
+func (v *vm) run(stdctx stdcontext.Context, ctx *context.Context) (int, error) {
+	v.ctx = ctx
+	v.state.SetContext(stdctx)
+	defer func() {
+		v.ctx = nil
+		v.state.RemoveContext()
+	}()
+
+	err := v.state.CallByParam(lua.P{Fn: v.handler, NRet: 1, Protect: true})
+	if err != nil {
+		return 0, err
+	}
+
+	ret := v.state.Get(-1)
+	v.state.Pop(1)
+	switch r := ret.(type) {
+	case *lua.LNilType:
+		return 0, nil
+	case lua.LNumber:
+		if n := int(r); float64(n) == float64(r) && n >= 0 && n <= maxLuaResult {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid lua result: %v", ret)
+}
+
+func (v *vm) close() {
+	v.state.Close()
+}
+
+func (v *vm) registerAPI() {
+	L := v.state
+
+	params := L.NewTable()
+	for k, val := range v.filter.spec.Parameters {
+		params.RawSetString(k, lua.LString(val))
+	}
+	L.SetGlobal("params", params)
+
+	L.SetGlobal("log", L.NewFunction(v.log))
+	L.SetGlobal("print", L.NewFunction(v.print))
+	L.SetGlobal("add_tag", L.NewFunction(v.addTag))
+
+	L.SetGlobal("request", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"method":        v.requestMethod,
+		"set_method":    v.requestSetMethod,
+		"scheme":        v.requestScheme,
+		"host":          v.requestHost,
+		"set_host":      v.requestSetHost,
+		"path":          v.requestPath,
+		"set_path":      v.requestSetPath,
+		"query":         v.requestQuery,
+		"raw_query":     v.requestRawQuery,
+		"set_raw_query": v.requestSetRawQuery,
+		"real_ip":       v.requestRealIP,
+		"header":        v.requestHeader,
+		"set_header":    v.requestSetHeader,
+		"add_header":    v.requestAddHeader,
+		"del_header":    v.requestDelHeader,
+		"body":          v.requestBody,
+		"set_body":      v.requestSetBody,
+	}))
+
+	L.SetGlobal("response", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"status":     v.responseStatus,
+		"set_status": v.responseSetStatus,
+		"header":     v.responseHeader,
+		"set_header": v.responseSetHeader,
+		"add_header": v.responseAddHeader,
+		"del_header": v.responseDelHeader,
+		"body":       v.responseBody,
+		"set_body":   v.responseSetBody,
+	}))
+
+	L.SetGlobal("kv", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"get":    v.kvGet,
+		"set":    v.kvSet,
+		"delete": v.kvDelete,
+		"incr":   v.kvIncr,
+	}))
+}
+
+// the functions below are only valid when a request is being handled.
+
+func (v *vm) checkCtx(L *lua.LState) {
+	if v.ctx == nil {
+		L.RaiseError("request and response are only accessible in '%s'", handlerName)
+	}
+}
+
+func (v *vm) log(L *lua.LState) int {
+	level, msg := L.CheckString(1), L.CheckString(2)
+	name := v.filter.spec.Name()
+	switch level {
+	case "debug":
+		logger.Debugf("%s: %s", name, msg)
+	case "info":
+		logger.Infof("%s: %s", name, msg)
+	case "warn":
+		logger.Warnf("%s: %s", name, msg)
+	case "error":
+		logger.Errorf("%s: %s", name, msg)
+	default:
+		L.ArgError(1, "invalid log level")
+	}
+	return 0
+}
+
+func (v *vm) print(L *lua.LState) int {
+	var args []string
+	for i := 1; i <= L.GetTop(); i++ {
+		args = append(args, L.ToStringMeta(L.Get(i)).String())
+	}
+	logger.Debugf("%s: %s", v.filter.spec.Name(), strings.Join(args, "\t"))
+	return 0
+}
+
+func (v *vm) addTag(L *lua.LState) int {
+	v.checkCtx(L)
+	v.ctx.AddTag(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) inputRequest(L *lua.LState) *httpprot.Request {
+	v.checkCtx(L)
+	return v.ctx.GetInputRequest().(*httpprot.Request)
+}
+
+func (v *vm) outputRequest(L *lua.LState) *httpprot.Request {
+	v.checkCtx(L)
+	return v.ctx.GetOutputRequest().(*httpprot.Request)
+}
+
+func (v *vm) requestMethod(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest(L).Method()))
+	return 1
+}
+
+func (v *vm) requestSetMethod(L *lua.LState) int {
+	v.outputRequest(L).SetMethod(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestScheme(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest(L).Scheme()))
+	return 1
+}
+
+func (v *vm) requestHost(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest(L).Host()))
+	return 1
+}
+
+func (v *vm) requestSetHost(L *lua.LState) int {
+	v.outputRequest(L).SetHost(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestPath(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest(L).Path()))
+	return 1
+}
+
+func (v *vm) requestSetPath(L *lua.LState) int {
+	v.outputRequest(L).SetPath(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestQuery(L *lua.LState) int {
+	values := v.inputRequest(L).Std().URL.Query()[L.CheckString(1)]
+	if len(values) == 0 {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(values[0]))
+	}
+	return 1
+}
+
+func (v *vm) requestRawQuery(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest(L).Std().URL.RawQuery))
+	return 1
+}
+
+func (v *vm) requestSetRawQuery(L *lua.LState) int {
+	v.outputRequest(L).Std().URL.RawQuery = L.CheckString(1)
+	return 0
+}
+
+func (v *vm) requestRealIP(L *lua.LState) int {
+	L.Push(lua.LString(v.inputRequest(L).RealIP()))
+	return 1
+}
+
+func pushHeader(L *lua.LState, value string) int {
+	if value == "" {
+		L.Push(lua.LNil)
+	} else {
+		L.Push(lua.LString(value))
+	}
+	return 1
+}
+
+func (v *vm) requestHeader(L *lua.LState) int {
+	return pushHeader(L, v.inputRequest(L).HTTPHeader().Get(L.CheckString(1)))
+}
+
+func (v *vm) requestSetHeader(L *lua.LState) int {
+	v.outputRequest(L).HTTPHeader().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) requestAddHeader(L *lua.LState) int {
+	v.outputRequest(L).HTTPHeader().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) requestDelHeader(L *lua.LState) int {
+	v.outputRequest(L).HTTPHeader().Del(L.CheckString(1))
+	return 0
+}
+
+func (v *vm) requestBody(L *lua.LState) int {
+	req := v.inputRequest(L)
+	if req.IsStream() {
+		L.RaiseError("the body of a stream request is not accessible")
+	}
+	L.Push(lua.LString(req.RawPayload()))
+	return 1
+}
+
+func (v *vm) requestSetBody(L *lua.LState) int {
+	req := v.outputRequest(L)
+	if req.IsStream() {
+		if c, ok := req.GetPayload().(io.Closer); ok {
+			c.Close()
+		}
+	}
+	req.SetPayload([]byte(L.CheckString(1)))
+	return 0
+}
+
+// response returns the output response, it is created if create is true
+// and there's no response yet, e.g. when the script generates the response
+// in the request phase.
+func (v *vm) response(L *lua.LState, create bool) *httpprot.Response {
+	v.checkCtx(L)
+	if resp := v.ctx.GetOutputResponse(); resp != nil {
+		return resp.(*httpprot.Response)
+	}
+	if !create {
+		return nil
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	v.ctx.SetOutputResponse(resp)
+	return resp
+}
+
+func (v *vm) responseStatus(L *lua.LState) int {
+	if resp := v.response(L, false); resp != nil {
+		L.Push(lua.LNumber(resp.StatusCode()))
+	} else {
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+func (v *vm) responseSetStatus(L *lua.LState) int {
+	v.response(L, true).SetStatusCode(L.CheckInt(1))
+	return 0
+}
+
+func (v *vm) responseHeader(L *lua.LState) int {
+	name := L.CheckString(1)
+	if resp := v.response(L, false); resp != nil {
+		return pushHeader(L, resp.HTTPHeader().Get(name))
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+func (v *vm) responseSetHeader(L *lua.LState) int {
+	v.response(L, true).HTTPHeader().Set(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) responseAddHeader(L *lua.LState) int {
+	v.response(L, true).HTTPHeader().Add(L.CheckString(1), L.CheckString(2))
+	return 0
+}
+
+func (v *vm) responseDelHeader(L *lua.LState) int {
+	name := L.CheckString(1)
+	if resp := v.response(L, false); resp != nil {
+		resp.HTTPHeader().Del(name)
+	}
+	return 0
+}
+
+func (v *vm) responseBody(L *lua.LState) int {
+	resp := v.response(L, false)
+	if resp == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	if resp.IsStream() {
+		L.RaiseError("the body of a stream response is not accessible")
+	}
+	L.Push(lua.LString(resp.RawPayload()))
+	return 1
+}
+
+func (v *vm) responseSetBody(L *lua.LState) int {
+	resp := v.response(L, true)
+	if resp.IsStream() {
+		if c, ok := resp.GetPayload().(io.Closer); ok {
+			c.Close()
+		}
+	}
+	resp.SetPayload([]byte(L.CheckString(1)))
+	return 0
+}
+
+// the kv functions access the shared key-value store, the TTLs are in
+// seconds.
+
+func (v *vm) kvStore(L *lua.LState) *kvstore.Store {
+	if v.filter.kv == nil {
+		L.RaiseError("the key-value store is unavailable")
+	}
+	return v.filter.kv
+}
+
+func optTTL(L *lua.LState, n int) time.Duration {
+	return time.Duration(float64(L.OptNumber(n, 0)) * float64(time.Second))
+}
+
+func (v *vm) kvGet(L *lua.LState) int {
+	value, ok, err := v.kvStore(L).Get(L.CheckString(1))
+	if err != nil {
+		L.RaiseError("kv get failed: %v", err)
+	}
+	if ok {
+		L.Push(lua.LString(value))
+	} else {
+		L.Push(lua.LNil)
+	}
+	return 1
+}
+
+func (v *vm) kvSet(L *lua.LState) int {
+	err := v.kvStore(L).Set(L.CheckString(1), L.CheckString(2), optTTL(L, 3))
+	if err != nil {
+		L.RaiseError("kv set failed: %v", err)
+	}
+	return 0
+}
+
+func (v *vm) kvDelete(L *lua.LState) int {
+	if err := v.kvStore(L).Delete(L.CheckString(1)); err != nil {
+		L.RaiseError("kv delete failed: %v", err)
+	}
+	return 0
+}
+
+func (v *vm) kvIncr(L *lua.LState) int {
+	n, err := v.kvStore(L).Incr(L.CheckString(1), int64(L.OptInt(2, 1)), optTTL(L, 3))
+	if err != nil {
+		L.RaiseError("kv incr failed: %v", err)
+	}
+	L.Push(lua.LNumber(n))
+	return 1
+}
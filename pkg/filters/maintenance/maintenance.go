@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package maintenance implements the MaintenanceMode filter, which responds
+// the requests with a static response during maintenance.
+package maintenance
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/timetool"
+)
+
+const (
+	// Kind is the kind of MaintenanceMode.
+	Kind = "MaintenanceMode"
+
+	resultMaintenance = "maintenance"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "MaintenanceMode responds the requests with a static response during maintenance",
+	Results:     []string{resultMaintenance},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Code: 503}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &MaintenanceMode{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*MaintenanceMode)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// MaintenanceMode is the filter MaintenanceMode.
+	MaintenanceMode struct {
+		spec *Spec
+
+		schedule   *timetool.Schedule
+		retryAfter string
+		flagOn     int32
+		done       chan struct{}
+
+		numOfRequests uint64
+	}
+
+	// Spec describes the MaintenanceMode.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Enabled turns on the maintenance mode regardless of the schedule
+		// and the flag.
+		Enabled bool `json:"enabled,omitempty" jsonschema:"omitempty"`
+		// Schedule is the time windows of the maintenance.
+		Schedule *timetool.ScheduleSpec `json:"schedule,omitempty" jsonschema:"omitempty"`
+		// Flag is the name of the cluster-wide maintenance flag, which is
+		// turned on and off by the admin API.
+		Flag string `json:"flag,omitempty" jsonschema:"omitempty"`
+
+		Code       int               `json:"code" jsonschema:"omitempty,format=httpcode"`
+		Headers    map[string]string `json:"headers,omitempty" jsonschema:"omitempty"`
+		Body       string            `json:"body,omitempty" jsonschema:"omitempty"`
+		RetryAfter string            `json:"retryAfter,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of MaintenanceMode.
+	Status struct {
+		InMaintenance bool   `json:"inMaintenance"`
+		FlagOn        bool   `json:"flagOn"`
+		NumOfRequests uint64 `json:"numOfRequests"`
+	}
+
+	// Flag is the value of a maintenance flag stored in the cluster, the
+	// flag is on if it exists.
+	Flag struct {
+		Reason string `json:"reason,omitempty"`
+		Time   string `json:"time"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if !s.Enabled && s.Schedule == nil && s.Flag == "" {
+		return fmt.Errorf("none of enabled, schedule and flag is specified")
+	}
+	return nil
+}
+
+// Name returns the name of the MaintenanceMode filter instance.
+func (m *MaintenanceMode) Name() string {
+	return m.spec.Name()
+}
+
+// Kind returns the kind of MaintenanceMode.
+func (m *MaintenanceMode) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the MaintenanceMode.
+func (m *MaintenanceMode) Spec() filters.Spec {
+	return m.spec
+}
+
+// Init initializes MaintenanceMode.
+func (m *MaintenanceMode) Init() {
+	m.reload()
+}
+
+// Inherit inherits previous generation of MaintenanceMode.
+func (m *MaintenanceMode) Inherit(previousGeneration filters.Filter) {
+	previousGeneration.Close()
+	m.reload()
+}
+
+func (m *MaintenanceMode) reload() {
+	m.done = make(chan struct{})
+
+	if m.spec.Schedule != nil {
+		m.schedule, _ = timetool.NewSchedule(m.spec.Schedule)
+	}
+	if m.spec.RetryAfter != "" {
+		d, _ := time.ParseDuration(m.spec.RetryAfter)
+		m.retryAfter = strconv.Itoa(int(math.Ceil(d.Seconds())))
+	}
+
+	if m.spec.Flag == "" {
+		return
+	}
+	super := m.spec.Super()
+	if super == nil || super.Cluster() == nil {
+		logger.Errorf("%s: cluster is unavailable, the maintenance flag is ignored", m.Name())
+		return
+	}
+	go m.watchFlag(super.Cluster())
+}
+
+func (m *MaintenanceMode) watchFlag(cls cluster.Cluster) {
+	var (
+		ch     <-chan *string
+		syncer cluster.Syncer
+		err    error
+	)
+
+	key := cls.Layout().MaintenanceFlagKey(m.spec.Flag)
+	for {
+		syncer, err = cls.Syncer(time.Minute)
+		if err == nil {
+			ch, err = syncer.Sync(key)
+			if err == nil {
+				break
+			}
+		}
+		logger.Errorf("%s: failed to watch maintenance flag: %v", m.Name(), err)
+		select {
+		case <-time.After(10 * time.Second):
+		case <-m.done:
+			return
+		}
+	}
+	defer syncer.Close()
+
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			if value == nil {
+				atomic.StoreInt32(&m.flagOn, 0)
+			} else {
+				atomic.StoreInt32(&m.flagOn, 1)
+			}
+
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *MaintenanceMode) inMaintenance(now time.Time) bool {
+	if m.spec.Enabled || atomic.LoadInt32(&m.flagOn) == 1 {
+		return true
+	}
+	return m.schedule != nil && m.schedule.Match(now)
+}
+
+// Handle responds the request with the static response during maintenance.
+func (m *MaintenanceMode) Handle(ctx *context.Context) string {
+	if !m.inMaintenance(time.Now()) {
+		return ""
+	}
+
+	atomic.AddUint64(&m.numOfRequests, 1)
+	ctx.AddTag(m.Name() + ": in maintenance")
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(m.spec.Code)
+	for k, v := range m.spec.Headers {
+		resp.HTTPHeader().Set(k, v)
+	}
+	if m.retryAfter != "" {
+		resp.HTTPHeader().Set("Retry-After", m.retryAfter)
+	}
+	resp.SetPayload([]byte(m.spec.Body))
+	ctx.SetOutputResponse(resp)
+	return resultMaintenance
+}
+
+// Status returns status.
+func (m *MaintenanceMode) Status() interface{} {
+	return &Status{
+		InMaintenance: m.inMaintenance(time.Now()),
+		FlagOn:        atomic.LoadInt32(&m.flagOn) == 1,
+		NumOfRequests: atomic.LoadUint64(&m.numOfRequests),
+	}
+}
+
+// Close closes MaintenanceMode.
+func (m *MaintenanceMode) Close() {
+	close(m.done)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestMaintenanceMode(assert *assert.Assertions, super *supervisor.Supervisor, yamlConfig string) *MaintenanceMode {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(super, "", rawSpec)
+	assert.NoError(err)
+	m := kind.CreateInstance(spec).(*MaintenanceMode)
+	m.Init()
+	return m
+}
+
+func newTestContext() *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte("kind: MaintenanceMode\nname: m"), &rawSpec))
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
+
+func TestEnabledAndSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newTestMaintenanceMode(assert, nil, `
+kind: MaintenanceMode
+name: maintenance
+enabled: true
+headers:
+  Content-Type: text/plain
+body: under maintenance
+retryAfter: 90s
+`)
+
+	ctx := newTestContext()
+	assert.Equal(resultMaintenance, m.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal("90", resp.HTTPHeader().Get("Retry-After"))
+	assert.Equal("text/plain", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal("under maintenance", string(resp.RawPayload()))
+
+	m2 := newTestMaintenanceMode(assert, nil, `
+kind: MaintenanceMode
+name: maintenance
+code: 200
+schedule:
+  windows:
+  - start: "02:00"
+    end: "04:00"
+`)
+	// the previous generation is closed.
+	m2.Inherit(m)
+	defer m2.Close()
+
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	assert.True(m2.inMaintenance(day.Add(3 * time.Hour)))
+	assert.False(m2.inMaintenance(day.Add(5 * time.Hour)))
+
+	status := m.Status().(*Status)
+	assert.Equal(uint64(1), status.NumOfRequests)
+	assert.True(status.InMaintenance)
+}
+
+func TestFlag(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan *string, 10)
+	var (
+		mutex  sync.Mutex
+		synced string
+	)
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.MockedSyncer = func(time.Duration) (cluster.Syncer, error) {
+		syncer := clustertest.NewMockedSyncer()
+		syncer.MockedSync = func(key string) (<-chan *string, error) {
+			mutex.Lock()
+			synced = key
+			mutex.Unlock()
+			return ch, nil
+		}
+		return syncer, nil
+	}
+	super := supervisor.NewMock(option.New(), cls, sync.Map{}, sync.Map{}, nil, nil, false, nil, nil)
+
+	m := newTestMaintenanceMode(assert, super, `
+kind: MaintenanceMode
+name: maintenance
+flag: db-upgrade
+`)
+	defer m.Close()
+
+	assert.Equal("", m.Handle(newTestContext()))
+
+	value := `{"time":"2023-01-02T10:00:00Z"}`
+	ch <- &value
+	assert.Eventually(func() bool {
+		return m.Handle(newTestContext()) == resultMaintenance
+	}, time.Second, 10*time.Millisecond)
+	assert.True(m.Status().(*Status).FlagOn)
+
+	mutex.Lock()
+	assert.Equal("/maintenance-flags/db-upgrade", synced)
+	mutex.Unlock()
+
+	ch <- nil
+	assert.Eventually(func() bool {
+		return m.Handle(newTestContext()) == ""
+	}, time.Second, 10*time.Millisecond)
+}
@@ -18,13 +18,19 @@
 package mock
 
 import (
+	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/expression"
+	"github.com/megaease/easegress/pkg/util/spectemplate"
 	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
@@ -32,13 +38,21 @@ const (
 	// Kind is the kind of Mock.
 	Kind = "Mock"
 
-	resultMocked = "mocked"
+	resultMocked            = "mocked"
+	resultPassthrough       = "passthrough"
+	resultPassthroughFailed = "passthroughFailed"
+
+	// scenarioStarted is the initial state of the scenarios.
+	scenarioStarted = "Started"
+
+	latencyUniform = "uniform"
+	latencyNormal  = "normal"
 )
 
 var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Mock mocks the response.",
-	Results:     []string{resultMocked},
+	Results:     []string{resultMocked, resultPassthrough, resultPassthroughFailed},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -54,7 +68,12 @@ func init() {
 type (
 	// Mock is filter Mock.
 	Mock struct {
-		spec *Spec
+		spec        *Spec
+		passthrough *passthrough
+
+		// scenarios are the current states of the scenarios.
+		scenariosLock sync.Mutex
+		scenarios     map[string]string
 	}
 
 	// Spec describes the Mock.
@@ -62,17 +81,70 @@ type (
 		filters.BaseSpec `json:",inline"`
 
 		Rules []*Rule `json:"rules"`
+		// Passthrough forwards the requests matching none of the rules to
+		// a backend, the requests are passed to the next filter if it is
+		// not specified.
+		Passthrough *PassthroughSpec `json:"passthrough,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Rule is the mock rule.
 	Rule struct {
 		Match   MatchRule         `json:"match" jsonschema:"required"`
+		Code    int               `json:"code" jsonschema:"omitempty"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+		Body    string            `json:"body" jsonschema:"omitempty"`
+		Delay   string            `json:"delay" jsonschema:"omitempty,format=duration"`
+		Latency *LatencySpec      `json:"latency,omitempty" jsonschema:"omitempty"`
+
+		// Sequence are the responses returned in turn, it replaces the
+		// response above. The last response is returned repeatedly after
+		// the sequence is exhausted, unless Loop is true.
+		Sequence []*Response `json:"sequence,omitempty" jsonschema:"omitempty"`
+		Loop     bool        `json:"loop,omitempty" jsonschema:"omitempty"`
+
+		// Scenario is the name of a state machine shared by rules, the
+		// rule matches only if the state of the scenario is RequiredState,
+		// and the state is changed to NewState after the rule matches.
+		Scenario      string `json:"scenario,omitempty" jsonschema:"omitempty"`
+		RequiredState string `json:"requiredState,omitempty" jsonschema:"omitempty"`
+		NewState      string `json:"newState,omitempty" jsonschema:"omitempty"`
+
+		expr      *expression.Expression
+		responses []*Response
+		total     uint64
+		calls     uint64
+	}
+
+	// Response is a mocked response of the sequence of a rule.
+	Response struct {
 		Code    int               `json:"code" jsonschema:"required,format=httpcode"`
 		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
 		Body    string            `json:"body" jsonschema:"omitempty"`
 		Delay   string            `json:"delay" jsonschema:"omitempty,format=duration"`
+		Latency *LatencySpec      `json:"latency,omitempty" jsonschema:"omitempty"`
+		// Times is the number of times the response is returned before
+		// the next one of the sequence, default is 1.
+		Times int `json:"times,omitempty" jsonschema:"omitempty,minimum=0"`
+
+		delay   time.Duration
+		headers map[string]*spectemplate.Template
+		body    *spectemplate.Template
+	}
 
-		delay time.Duration
+	// LatencySpec is the distribution of the latencies of the responses.
+	LatencySpec struct {
+		// Distribution is uniform or normal.
+		Distribution string `json:"distribution" jsonschema:"required,enum=uniform,enum=normal"`
+		// Min and Max are the range of the latencies, they are required
+		// by the uniform distribution, and limit the latencies of the
+		// normal distribution.
+		Min string `json:"min,omitempty" jsonschema:"omitempty,format=duration"`
+		Max string `json:"max,omitempty" jsonschema:"omitempty,format=duration"`
+		// Mean and StdDev are the parameters of the normal distribution.
+		Mean   string `json:"mean,omitempty" jsonschema:"omitempty,format=duration"`
+		StdDev string `json:"stdDev,omitempty" jsonschema:"omitempty,format=duration"`
+
+		min, max, mean, stdDev time.Duration
 	}
 
 	// MatchRule is the rule to match a request
@@ -81,9 +153,175 @@ type (
 		PathPrefix      string                          `json:"pathPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
 		Headers         map[string]*urlrule.StringMatch `json:"headers" jsonschema:"omitempty"`
 		MatchAllHeaders bool                            `json:"matchAllHeaders" jsonschema:"omitempty"`
+		// Expression is a CEL expression on the request, which must be
+		// true in addition to the path and the headers.
+		Expression string `json:"expression,omitempty" jsonschema:"omitempty"`
 	}
 )
 
+// Validate validates MatchRule.
+func (mr MatchRule) Validate() error {
+	if mr.Expression != "" {
+		if _, err := expression.Compile(mr.Expression); err != nil {
+			return fmt.Errorf("invalid expression: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate validates Rule.
+func (r *Rule) Validate() error {
+	if len(r.Sequence) == 0 {
+		if r.Code < 100 || r.Code >= 600 {
+			return fmt.Errorf("invalid http code %d", r.Code)
+		}
+		if err := r.response().validate(); err != nil {
+			return err
+		}
+	} else {
+		if r.Code != 0 || len(r.Headers) != 0 || r.Body != "" || r.Delay != "" || r.Latency != nil {
+			return fmt.Errorf("code, headers, body, delay and latency must be in the sequence if it is specified")
+		}
+		for i, resp := range r.Sequence {
+			if err := resp.validate(); err != nil {
+				return fmt.Errorf("sequence[%d]: %v", i, err)
+			}
+		}
+	}
+
+	if r.Scenario == "" && (r.RequiredState != "" || r.NewState != "") {
+		return fmt.Errorf("requiredState and newState require scenario")
+	}
+	return nil
+}
+
+func (resp *Response) validate() error {
+	if resp.Delay != "" && resp.Latency != nil {
+		return fmt.Errorf("delay and latency are mutually exclusive")
+	}
+	if _, err := spectemplate.CompileMap(resp.Headers); err != nil {
+		return fmt.Errorf("headers: %v", err)
+	}
+	if _, err := spectemplate.Compile(resp.Body); err != nil {
+		return fmt.Errorf("body: %v", err)
+	}
+	return nil
+}
+
+// Validate validates LatencySpec.
+func (ls *LatencySpec) Validate() error {
+	if err := ls.parse(); err != nil {
+		return err
+	}
+
+	if ls.max > 0 && ls.min > ls.max {
+		return fmt.Errorf("min is greater than max")
+	}
+	switch ls.Distribution {
+	case latencyUniform:
+		if ls.max <= 0 {
+			return fmt.Errorf("max is required by the uniform distribution")
+		}
+	case latencyNormal:
+		if ls.mean <= 0 {
+			return fmt.Errorf("mean is required by the normal distribution")
+		}
+	}
+	return nil
+}
+
+func (ls *LatencySpec) parse() error {
+	for _, d := range []struct {
+		s string
+		d *time.Duration
+	}{{ls.Min, &ls.min}, {ls.Max, &ls.max}, {ls.Mean, &ls.mean}, {ls.StdDev, &ls.stdDev}} {
+		if d.s == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.s)
+		if err != nil {
+			return err
+		}
+		*d.d = v
+	}
+	return nil
+}
+
+// next returns a latency of the distribution.
+func (ls *LatencySpec) next() time.Duration {
+	var d time.Duration
+	switch ls.Distribution {
+	case latencyUniform:
+		d = ls.min
+		if ls.max > ls.min {
+			d += time.Duration(rand.Int63n(int64(ls.max - ls.min)))
+		}
+	case latencyNormal:
+		d = ls.mean + time.Duration(rand.NormFloat64()*float64(ls.stdDev))
+		if d < ls.min {
+			d = ls.min
+		}
+		if ls.max > 0 && d > ls.max {
+			d = ls.max
+		}
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// response returns the response defined by the fields of the rule.
+func (r *Rule) response() *Response {
+	return &Response{
+		Code:    r.Code,
+		Headers: r.Headers,
+		Body:    r.Body,
+		Delay:   r.Delay,
+		Latency: r.Latency,
+	}
+}
+
+func (resp *Response) init() {
+	if resp.Delay != "" {
+		resp.delay, _ = time.ParseDuration(resp.Delay)
+	}
+	if resp.Latency != nil {
+		resp.Latency.parse()
+	}
+	resp.headers, _ = spectemplate.CompileMap(resp.Headers)
+	resp.body = spectemplate.MustCompile(resp.Body)
+}
+
+func (resp *Response) times() uint64 {
+	if resp.Times <= 0 {
+		return 1
+	}
+	return uint64(resp.Times)
+}
+
+// nextResponse returns the response of the current call of the rule.
+func (r *Rule) nextResponse() *Response {
+	if len(r.responses) == 1 {
+		return r.responses[0]
+	}
+
+	n := atomic.AddUint64(&r.calls, 1) - 1
+	if n >= r.total {
+		if !r.Loop {
+			return r.responses[len(r.responses)-1]
+		}
+		n %= r.total
+	}
+	for _, resp := range r.responses {
+		if n < resp.times() {
+			return resp
+		}
+		n -= resp.times()
+	}
+	return r.responses[len(r.responses)-1]
+}
+
 // Name returns the name of the Mock filter instance.
 func (m *Mock) Name() string {
 	return m.spec.Name()
@@ -110,22 +348,62 @@ func (m *Mock) Inherit(previousGeneration filters.Filter) {
 }
 
 func (m *Mock) reload() {
+	m.scenarios = map[string]string{}
 	for _, r := range m.spec.Rules {
-		if r.Delay == "" {
-			continue
+		if r.Match.Expression != "" {
+			r.expr = expression.MustCompile(r.Match.Expression)
 		}
-		r.delay, _ = time.ParseDuration(r.Delay)
+
+		r.responses = r.Sequence
+		if len(r.responses) == 0 {
+			r.responses = []*Response{r.response()}
+		}
+		r.total, r.calls = 0, 0
+		for _, resp := range r.responses {
+			resp.init()
+			r.total += resp.times()
+		}
+
+		if r.Scenario != "" {
+			m.scenarios[r.Scenario] = scenarioStarted
+		}
+	}
+
+	if m.spec.Passthrough != nil {
+		m.passthrough = newPassthrough(m.spec.Passthrough)
 	}
 }
 
 // Handle mocks Context.
 func (m *Mock) Handle(ctx *context.Context) string {
-	result := ""
 	if rule := m.match(ctx); rule != nil {
 		m.mock(ctx, rule)
-		result = resultMocked
+		return resultMocked
 	}
-	return result
+
+	if m.passthrough != nil {
+		return m.passthrough.handle(ctx)
+	}
+	return ""
+}
+
+// matchScenario checks the state of the scenario of the rule, and moves
+// the scenario to the new state if the rule matches.
+func (m *Mock) matchScenario(rule *Rule) bool {
+	if rule.Scenario == "" {
+		return true
+	}
+
+	m.scenariosLock.Lock()
+	defer m.scenariosLock.Unlock()
+
+	if rule.RequiredState != "" && m.scenarios[rule.Scenario] != rule.RequiredState {
+		return false
+	}
+	if rule.NewState != "" {
+		m.scenarios[rule.Scenario] = rule.NewState
+	}
+	return true
 }
 
 func (m *Mock) match(ctx *context.Context) *Rule {
@@ -187,8 +465,12 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 		return rule.Match.MatchAllHeaders
 	}
 
+	matchExpr := func(rule *Rule) bool {
+		return rule.expr == nil || rule.expr.Match(req)
+	}
+
 	for _, rule := range m.spec.Rules {
-		if matchPath(rule) && matchHeader(rule) {
+		if matchPath(rule) && matchHeader(rule) && matchExpr(rule) && m.matchScenario(rule) {
 			return rule
 		}
 	}
@@ -197,31 +479,58 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 }
 
 func (m *Mock) mock(ctx *context.Context, rule *Rule) {
-	resp, _ := httpprot.NewResponse(nil)
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	mocked := rule.nextResponse()
 
-	resp.SetStatusCode(rule.Code)
-	for key, value := range rule.Headers {
-		resp.Std().Header.Set(key, value)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(mocked.Code)
+	for key, t := range mocked.headers {
+		resp.Std().Header.Set(key, t.Render(req, spectemplate.EscapeHeaderValue))
 	}
-	resp.SetPayload([]byte(rule.Body))
+	resp.SetPayload([]byte(mocked.body.Render(req, noEscape)))
 	ctx.SetOutputResponse(resp)
 
-	if rule.delay <= 0 {
+	delay := mocked.delay
+	if mocked.Latency != nil {
+		delay = mocked.Latency.next()
+	}
+	if delay <= 0 {
 		return
 	}
 
-	req := ctx.GetInputRequest().(*httpprot.Request)
-	logger.Debugf("delay for %v ...", rule.delay)
+	logger.Debugf("delay for %v ...", delay)
 	select {
 	case <-req.Context().Done():
 		logger.Debugf("request cancelled in the middle of delay mocking")
-	case <-time.After(rule.delay):
+	case <-time.After(delay):
 	}
 }
 
+// noEscape keeps the request data as is in the mocked bodies.
+func noEscape(s string) string {
+	return s
+}
+
+// Status is the status of Mock.
+type Status struct {
+	// Scenarios are the current states of the scenarios.
+	Scenarios map[string]string `json:"scenarios,omitempty"`
+}
+
 // Status returns status.
 func (m *Mock) Status() interface{} {
-	return nil
+	m.scenariosLock.Lock()
+	defer m.scenariosLock.Unlock()
+
+	if len(m.scenarios) == 0 {
+		return nil
+	}
+
+	s := &Status{Scenarios: make(map[string]string, len(m.scenarios))}
+	for k, v := range m.scenarios {
+		s.Scenarios[k] = v
+	}
+	return s
 }
 
 // Close closes Mock.
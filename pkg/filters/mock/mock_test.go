@@ -20,8 +20,10 @@ package mock
 import (
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
@@ -90,6 +92,11 @@ rules:
   body: 'mocked body'
   headers:
     X-Test: test2
+- match:
+    pathPrefix: /debug/
+    expression: request.header["x-debug"] == "1" && request.method == "POST"
+  code: 208
+  body: 'mocked body'
 - code: 204
   body: 'mocked body 2'
   headers:
@@ -196,6 +203,25 @@ rules:
 		assert.Equal(204, resp.StatusCode())
 	}
 
+	{
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/debug/1", nil)
+		assert.Nil(err)
+		req.Header.Set("X-Debug", "1")
+		setRequest(t, ctx, "id7", req)
+
+		ctx.UseNamespace("id7")
+		m.Handle(ctx)
+
+		resp := ctx.GetResponse("id7").(*httpprot.Response)
+		assert.Equal(208, resp.StatusCode())
+
+		req.Method = http.MethodGet
+		m.Handle(ctx)
+
+		resp = ctx.GetResponse("id7").(*httpprot.Response)
+		assert.Equal(204, resp.StatusCode())
+	}
+
 	{
 		req, err := http.NewRequest(http.MethodGet, "http://example.com/customer", nil)
 		assert.Nil(err)
@@ -213,3 +239,247 @@ rules:
 		assert.Equal(204, resp.StatusCode())
 	}
 }
+
+func TestMockSpecValidate(t *testing.T) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(`
+kind: Mock
+name: mock
+rules:
+- match:
+    expression: request.method = "POST"
+  code: 200
+`), &rawSpec)
+
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	for _, rules := range []string{
+		// no code
+		`
+- match:
+    path: /
+`,
+		// both code and sequence
+		`
+- code: 200
+  sequence:
+  - code: 500
+`,
+		// invalid template
+		`
+- code: 200
+  body: ${req.unknown}
+`,
+		// both delay and latency
+		`
+- code: 200
+  delay: 1ms
+  latency:
+    distribution: uniform
+    max: 5ms
+`,
+		// state without scenario
+		`
+- code: 200
+  newState: done
+`,
+	} {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte("kind: Mock\nname: mock\nrules:"+rules), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(t, err, rules)
+	}
+}
+
+func createMock(t *testing.T, yamlConfig string) *Mock {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	m := kind.CreateInstance(spec)
+	m.Init()
+	return m.(*Mock)
+}
+
+func handleMock(t *testing.T, m *Mock, req *http.Request) (string, *httpprot.Response) {
+	ctx := context.New(nil)
+	setRequest(t, ctx, context.DefaultNamespace, req)
+	result := m.Handle(ctx)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	return result, resp
+}
+
+func TestMockSequence(t *testing.T) {
+	assert := assert.New(t)
+
+	m := createMock(t, `
+kind: Mock
+name: mock
+rules:
+- match:
+    path: /once
+  sequence:
+  - code: 500
+  - code: 200
+- match:
+    path: /loop
+  loop: true
+  sequence:
+  - code: 503
+    times: 2
+  - code: 200
+`)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/once", nil)
+	for _, code := range []int{500, 200, 200} {
+		_, resp := handleMock(t, m, req)
+		assert.Equal(code, resp.StatusCode())
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com/loop", nil)
+	for _, code := range []int{503, 503, 200, 503, 503, 200} {
+		_, resp := handleMock(t, m, req)
+		assert.Equal(code, resp.StatusCode())
+	}
+
+	// sequences restart from the beginning after reloading.
+	spec := m.Spec()
+	newM := kind.CreateInstance(spec)
+	newM.Inherit(m)
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com/once", nil)
+	_, resp := handleMock(t, newM.(*Mock), req)
+	assert.Equal(500, resp.StatusCode())
+}
+
+func TestMockScenario(t *testing.T) {
+	assert := assert.New(t)
+
+	m := createMock(t, `
+kind: Mock
+name: mock
+rules:
+- match:
+    path: /cart
+    expression: request.method == "GET"
+  scenario: cart
+  requiredState: Started
+  code: 200
+  body: 'empty'
+- match:
+    path: /cart
+    expression: request.method == "POST"
+  scenario: cart
+  newState: added
+  code: 201
+- match:
+    path: /cart
+  scenario: cart
+  requiredState: added
+  code: 200
+  body: 'one item'
+`)
+	assert.Equal(&Status{Scenarios: map[string]string{"cart": "Started"}}, m.Status())
+
+	get, _ := http.NewRequest(http.MethodGet, "http://example.com/cart", nil)
+	_, resp := handleMock(t, m, get)
+	body, _ := io.ReadAll(resp.GetPayload())
+	assert.Equal("empty", string(body))
+
+	post, _ := http.NewRequest(http.MethodPost, "http://example.com/cart", nil)
+	_, resp = handleMock(t, m, post)
+	assert.Equal(201, resp.StatusCode())
+	assert.Equal(&Status{Scenarios: map[string]string{"cart": "added"}}, m.Status())
+
+	get, _ = http.NewRequest(http.MethodGet, "http://example.com/cart", nil)
+	_, resp = handleMock(t, m, get)
+	body, _ = io.ReadAll(resp.GetPayload())
+	assert.Equal("one item", string(body))
+}
+
+func TestMockTemplateAndLatency(t *testing.T) {
+	assert := assert.New(t)
+
+	m := createMock(t, `
+kind: Mock
+name: mock
+rules:
+- match:
+    pathPrefix: /users/
+  code: 200
+  headers:
+    X-Request-Id: ${req.header.X-Request-Id}
+  body: '{"path": "${req.path}", "name": "${req.query.name}"}'
+  latency:
+    distribution: uniform
+    min: 1ms
+    max: 5ms
+`)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/users/1?name=alice", nil)
+	req.Header.Set("X-Request-Id", "123")
+	start := time.Now()
+	_, resp := handleMock(t, m, req)
+	assert.GreaterOrEqual(time.Since(start), time.Millisecond)
+	body, _ := io.ReadAll(resp.GetPayload())
+	assert.Equal(`{"path": "/users/1", "name": "alice"}`, string(body))
+	assert.Equal("123", resp.Std().Header.Get("X-Request-Id"))
+
+	ls := &LatencySpec{Distribution: latencyNormal, Mean: "10ms", StdDev: "5ms", Min: "5ms", Max: "15ms"}
+	assert.NoError(ls.Validate())
+	for i := 0; i < 100; i++ {
+		d := ls.next()
+		assert.GreaterOrEqual(d, 5*time.Millisecond)
+		assert.LessOrEqual(d, 15*time.Millisecond)
+	}
+
+	ls = &LatencySpec{Distribution: latencyUniform, Min: "10ms", Max: "5ms"}
+	assert.Error(ls.Validate())
+	ls = &LatencySpec{Distribution: latencyUniform}
+	assert.Error(ls.Validate())
+	ls = &LatencySpec{Distribution: latencyNormal, StdDev: "1ms"}
+	assert.Error(ls.Validate())
+}
+
+func TestMockPassthrough(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	defer backend.Close()
+
+	m := createMock(t, `
+kind: Mock
+name: mock
+rules:
+- match:
+    path: /mocked
+  code: 200
+passthrough:
+  url: `+backend.URL+`/
+  timeout: 1s
+`)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/mocked", nil)
+	result, resp := handleMock(t, m, req)
+	assert.Equal(resultMocked, result)
+	assert.Equal(200, resp.StatusCode())
+
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com/other?a=1", nil)
+	result, resp = handleMock(t, m, req)
+	assert.Equal(resultPassthrough, result)
+	assert.Equal(http.StatusAccepted, resp.StatusCode())
+	assert.Equal("yes", resp.Std().Header.Get("X-Backend"))
+	body, _ := io.ReadAll(resp.GetPayload())
+	assert.Equal("/other?a=1", string(body))
+
+	backend.Close()
+	result, resp = handleMock(t, m, req)
+	assert.Equal(resultPassthroughFailed, result)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+type (
+	// PassthroughSpec is the spec to forward the requests matching none of
+	// the rules to a backend.
+	PassthroughSpec struct {
+		// URL is the base URL of the backend, the path and the query of
+		// the requests are appended to it.
+		URL string `json:"url" jsonschema:"required,format=url"`
+		// Timeout is the timeout of the requests to the backend, no
+		// timeout if not specified.
+		Timeout string `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// MaxBodySize is the max size of the response bodies, default is
+		// the default max payload size of HTTP.
+		MaxBodySize int64 `json:"maxBodySize,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	passthrough struct {
+		spec    *PassthroughSpec
+		url     string
+		timeout time.Duration
+		client  *http.Client
+	}
+)
+
+// Validate validates PassthroughSpec.
+func (spec *PassthroughSpec) Validate() error {
+	u, err := url.Parse(spec.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid scheme of url %s", spec.URL)
+	}
+	return nil
+}
+
+func newPassthrough(spec *PassthroughSpec) *passthrough {
+	p := &passthrough{
+		spec:   spec,
+		url:    spec.URL,
+		client: &http.Client{},
+	}
+	if n := len(p.url); n > 0 && p.url[n-1] == '/' {
+		p.url = p.url[:n-1]
+	}
+	if spec.Timeout != "" {
+		p.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	return p
+}
+
+// handle forwards the request to the backend and sets the response of the
+// backend as the output response.
+func (p *passthrough) handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	stdctx := req.Context()
+	if p.timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		stdctx, cancel = stdcontext.WithTimeout(stdctx, p.timeout)
+		defer cancel()
+	}
+
+	u := p.url + req.Path()
+	if rq := req.Std().URL.RawQuery; rq != "" {
+		u += "?" + rq
+	}
+	stdr, err := http.NewRequestWithContext(stdctx, req.Method(), u, req.GetPayload())
+	if err != nil {
+		return p.fail(ctx, err)
+	}
+	stdr.Header = req.HTTPHeader().Clone()
+
+	stdResp, err := p.client.Do(stdr)
+	if err != nil {
+		return p.fail(ctx, err)
+	}
+	defer stdResp.Body.Close()
+
+	resp, err := httpprot.NewResponse(stdResp)
+	if err != nil {
+		return p.fail(ctx, err)
+	}
+	if err = resp.FetchPayload(p.spec.MaxBodySize); err != nil {
+		return p.fail(ctx, err)
+	}
+
+	ctx.SetOutputResponse(resp)
+	return resultPassthrough
+}
+
+func (p *passthrough) fail(ctx *context.Context, err error) string {
+	logger.Debugf("mock passthrough to %s failed: %v", p.url, err)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusBadGateway)
+	ctx.SetOutputResponse(resp)
+	return resultPassthroughFailed
+}
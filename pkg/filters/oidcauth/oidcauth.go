@@ -0,0 +1,495 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package oidcauth provides the OIDCAuth filter.
+package oidcauth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/oidc"
+)
+
+const (
+	// Kind is the kind of OIDCAuth.
+	Kind = "OIDCAuth"
+
+	resultRedirected   = "redirected"
+	resultUnauthorized = "unauthorized"
+	resultServerError  = "serverError"
+
+	defaultCookieName = "easegress_oidc_session"
+
+	// stateCookieMaxAge is the max age of the state cookie, the login
+	// must be finished in it.
+	stateCookieMaxAge = 10 * time.Minute
+
+	// maxCookieSize is the size limit of cookies of most browsers.
+	maxCookieSize = 4096
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "OIDCAuth authenticates users by the OpenID Connect authorization code flow",
+	Results:     []string{resultRedirected, resultUnauthorized, resultServerError},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &OIDCAuth{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*OIDCAuth)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// OIDCAuth is the filter OIDCAuth.
+	OIDCAuth struct {
+		spec *Spec
+
+		provider     *oidc.Provider
+		codec        *cookieCodec
+		callbackPath string
+		cookieMaxAge int
+		secure       bool
+	}
+
+	// Spec describes the OIDCAuth.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		DiscoveryURL          string            `json:"discoveryUrl" jsonschema:"required,format=url"`
+		ClientID              string            `json:"clientId" jsonschema:"required"`
+		ClientSecret          string            `json:"clientSecret" jsonschema:"required"`
+		RedirectURL           string            `json:"redirectUrl" jsonschema:"required,format=url"`
+		Scopes                []string          `json:"scopes" jsonschema:"omitempty"`
+		CookieName            string            `json:"cookieName" jsonschema:"omitempty"`
+		CookieSecret          string            `json:"cookieSecret" jsonschema:"required,minLength=16"`
+		CookieMaxAge          string            `json:"cookieMaxAge" jsonschema:"omitempty,format=duration"`
+		LogoutPath            string            `json:"logoutPath" jsonschema:"omitempty"`
+		PostLogoutRedirectURL string            `json:"postLogoutRedirectUrl" jsonschema:"omitempty"`
+		ClaimHeaders          map[string]string `json:"claimHeaders" jsonschema:"omitempty"`
+		ForwardAccessToken    bool              `json:"forwardAccessToken" jsonschema:"omitempty"`
+		InsecureTLS           bool              `json:"insecureTls" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	u, err := url.Parse(s.RedirectURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid redirect url %s", s.RedirectURL)
+	}
+	if s.LogoutPath != "" && s.LogoutPath == u.Path {
+		return fmt.Errorf("logout path must be different from the path of the redirect url")
+	}
+	if s.CookieMaxAge != "" {
+		if _, err = time.ParseDuration(s.CookieMaxAge); err != nil {
+			return fmt.Errorf("invalid cookie max age %s: %v", s.CookieMaxAge, err)
+		}
+	}
+	for header, claim := range s.ClaimHeaders {
+		if header == "" || claim == "" {
+			return fmt.Errorf("empty header or claim in claimHeaders")
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the OIDCAuth filter instance.
+func (a *OIDCAuth) Name() string {
+	return a.spec.Name()
+}
+
+// Kind returns the kind of OIDCAuth.
+func (a *OIDCAuth) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the OIDCAuth
+func (a *OIDCAuth) Spec() filters.Spec {
+	return a.spec
+}
+
+// Init initializes OIDCAuth.
+func (a *OIDCAuth) Init() {
+	a.reload()
+}
+
+// Inherit inherits previous generation of OIDCAuth.
+func (a *OIDCAuth) Inherit(previousGeneration filters.Filter) {
+	a.reload()
+}
+
+func (a *OIDCAuth) reload() {
+	client := http.DefaultClient
+	if a.spec.InsecureTLS {
+		cfg := tls.Config{InsecureSkipVerify: true}
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &cfg}}
+	}
+	a.provider = oidc.NewProvider(a.spec.DiscoveryURL, client)
+	a.codec = newCookieCodec(a.spec.CookieSecret)
+
+	u, _ := url.Parse(a.spec.RedirectURL)
+	a.callbackPath = u.Path
+	a.secure = u.Scheme == "https"
+
+	if a.spec.CookieMaxAge != "" {
+		d, _ := time.ParseDuration(a.spec.CookieMaxAge)
+		a.cookieMaxAge = int(d.Seconds())
+	}
+}
+
+// Status returns status.
+func (a *OIDCAuth) Status() interface{} {
+	return nil
+}
+
+// Close closes OIDCAuth.
+func (a *OIDCAuth) Close() {
+}
+
+func (a *OIDCAuth) cookieName() string {
+	if a.spec.CookieName != "" {
+		return a.spec.CookieName
+	}
+	return defaultCookieName
+}
+
+func (a *OIDCAuth) stateCookieName() string {
+	return a.cookieName() + "_state"
+}
+
+func (a *OIDCAuth) newCookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   a.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (a *OIDCAuth) sessionCookie(s *session) (*http.Cookie, error) {
+	value, err := a.codec.encode(s)
+	if err != nil {
+		return nil, err
+	}
+	c := a.newCookie(a.cookieName(), value, a.cookieMaxAge)
+	if len(c.String()) > maxCookieSize {
+		logger.Warnf("%s: size of the session cookie exceeds %d bytes, it may be dropped by browsers", a.Name(), maxCookieSize)
+	}
+	return c, nil
+}
+
+func buildResponse(ctx *context.Context, statusCode int, location string, cookies ...*http.Cookie) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	if location != "" {
+		resp.HTTPHeader().Set("Location", location)
+	}
+	for _, c := range cookies {
+		resp.HTTPHeader().Add("Set-Cookie", c.String())
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Handle authenticates the request.
+func (a *OIDCAuth) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	switch req.Path() {
+	case a.callbackPath:
+		return a.handleCallback(ctx, req)
+	case a.spec.LogoutPath:
+		if a.spec.LogoutPath != "" {
+			return a.handleLogout(ctx, req)
+		}
+	}
+
+	s := a.getSession(req)
+	if s != nil && s.expired() {
+		s = a.refresh(ctx, s)
+	}
+	if s == nil {
+		return a.login(ctx, req)
+	}
+
+	a.setHeaders(req, s)
+	return ""
+}
+
+// getSession returns the session of the request, or nil if there is no
+// valid session.
+func (a *OIDCAuth) getSession(req *httpprot.Request) *session {
+	c, err := req.Cookie(a.cookieName())
+	if err != nil {
+		return nil
+	}
+	s := &session{}
+	if err = a.codec.decode(c.Value, s); err != nil {
+		logger.Debugf("%s: invalid session cookie: %v", a.Name(), err)
+		return nil
+	}
+	return s
+}
+
+// login redirects the user to the provider to login, requests other than
+// GET and HEAD are rejected, as they cannot be redirected back.
+func (a *OIDCAuth) login(ctx *context.Context, req *httpprot.Request) string {
+	if m := req.Method(); m != http.MethodGet && m != http.MethodHead {
+		buildResponse(ctx, http.StatusUnauthorized, "")
+		return resultUnauthorized
+	}
+
+	config, err := oauth2Config(a.provider, a.spec)
+	if err != nil {
+		logger.Errorf("%s: %v", a.Name(), err)
+		buildResponse(ctx, http.StatusServiceUnavailable, "")
+		return resultServerError
+	}
+
+	ls := &loginState{
+		State:       randomString(),
+		Nonce:       randomString(),
+		RedirectURL: req.Std().URL.RequestURI(),
+	}
+	value, err := a.codec.encode(ls)
+	if err != nil {
+		logger.Errorf("%s: failed to encode login state: %v", a.Name(), err)
+		buildResponse(ctx, http.StatusInternalServerError, "")
+		return resultServerError
+	}
+
+	location := config.AuthCodeURL(ls.State, oauth2.SetAuthURLParam("nonce", ls.Nonce))
+	buildResponse(ctx, http.StatusFound, location, a.newCookie(a.stateCookieName(), value, int(stateCookieMaxAge.Seconds())))
+	return resultRedirected
+}
+
+// handleCallback handles the redirection from the provider after login,
+// it exchanges the code for tokens, and creates the session.
+func (a *OIDCAuth) handleCallback(ctx *context.Context, req *httpprot.Request) string {
+	query := req.Std().URL.Query()
+	if e := query.Get("error"); e != "" {
+		logger.Debugf("%s: login failed: %s: %s", a.Name(), e, query.Get("error_description"))
+		buildResponse(ctx, http.StatusUnauthorized, "")
+		return resultUnauthorized
+	}
+
+	ls := &loginState{}
+	c, err := req.Cookie(a.stateCookieName())
+	if err == nil {
+		err = a.codec.decode(c.Value, ls)
+	}
+	if err != nil || ls.State != query.Get("state") {
+		logger.Debugf("%s: invalid login state", a.Name())
+		buildResponse(ctx, http.StatusUnauthorized, "")
+		return resultUnauthorized
+	}
+
+	config, err := oauth2Config(a.provider, a.spec)
+	if err != nil {
+		logger.Errorf("%s: %v", a.Name(), err)
+		buildResponse(ctx, http.StatusServiceUnavailable, "")
+		return resultServerError
+	}
+
+	token, err := config.Exchange(clientContext(a.provider), query.Get("code"))
+	if err != nil {
+		logger.Debugf("%s: failed to exchange the code: %v", a.Name(), err)
+		buildResponse(ctx, http.StatusUnauthorized, "")
+		return resultUnauthorized
+	}
+
+	s, err := a.newSession(token, ls.Nonce, "")
+	if err != nil {
+		logger.Debugf("%s: %v", a.Name(), err)
+		buildResponse(ctx, http.StatusUnauthorized, "")
+		return resultUnauthorized
+	}
+
+	sc, err := a.sessionCookie(s)
+	if err != nil {
+		logger.Errorf("%s: failed to encode session: %v", a.Name(), err)
+		buildResponse(ctx, http.StatusInternalServerError, "")
+		return resultServerError
+	}
+
+	// only redirect to local paths, to prevent open redirection.
+	location := ls.RedirectURL
+	if !strings.HasPrefix(location, "/") || strings.HasPrefix(location, "//") {
+		location = "/"
+	}
+	buildResponse(ctx, http.StatusFound, location, sc, a.newCookie(a.stateCookieName(), "", -1))
+	return resultRedirected
+}
+
+// newSession creates a session from the token, the ID token is verified.
+// The previous ID token is kept if there is no new one, which is allowed
+// in refreshing.
+func (a *OIDCAuth) newSession(token *oauth2.Token, nonce, prevIDToken string) (*session, error) {
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		if prevIDToken == "" {
+			return nil, fmt.Errorf("no id token in the token response")
+		}
+		idToken = prevIDToken
+	} else if _, err := a.provider.VerifyIDToken(idToken, a.spec.ClientID, nonce); err != nil {
+		return nil, fmt.Errorf("invalid id token: %v", err)
+	}
+
+	s := &session{
+		IDToken:      idToken,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+	}
+	if !token.Expiry.IsZero() {
+		s.Expiry = token.Expiry.Unix()
+	}
+	return s, nil
+}
+
+// refresh refreshes the tokens of the expired session, and returns the
+// new session, or nil on failure. The new session cookie is set to the
+// response by the response writer, as the response is built by other
+// filters.
+func (a *OIDCAuth) refresh(ctx *context.Context, s *session) *session {
+	if s.RefreshToken == "" {
+		return nil
+	}
+
+	config, err := oauth2Config(a.provider, a.spec)
+	if err != nil {
+		logger.Errorf("%s: %v", a.Name(), err)
+		return nil
+	}
+
+	old := &oauth2.Token{
+		AccessToken:  s.AccessToken,
+		RefreshToken: s.RefreshToken,
+		Expiry:       time.Unix(s.Expiry, 0),
+	}
+	token, err := config.TokenSource(clientContext(a.provider), old).Token()
+	if err != nil {
+		logger.Debugf("%s: failed to refresh the token: %v", a.Name(), err)
+		return nil
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.RefreshToken
+	}
+
+	ns, err := a.newSession(token, "", s.IDToken)
+	if err != nil {
+		logger.Debugf("%s: %v", a.Name(), err)
+		return nil
+	}
+
+	if w, ok := ctx.GetData(httpprot.ResponseWriterKey).(http.ResponseWriter); ok {
+		if sc, err := a.sessionCookie(ns); err == nil {
+			http.SetCookie(w, sc)
+		}
+	}
+	return ns
+}
+
+// handleLogout removes the session, and redirects the user to the end
+// session endpoint of the provider if there is one.
+func (a *OIDCAuth) handleLogout(ctx *context.Context, req *httpprot.Request) string {
+	location := a.spec.PostLogoutRedirectURL
+	if location == "" {
+		location = "/"
+	}
+
+	if s := a.getSession(req); s != nil {
+		if md, err := a.provider.Metadata(); err == nil && md.EndSessionEndpoint != "" {
+			q := url.Values{"id_token_hint": {s.IDToken}}
+			if a.spec.PostLogoutRedirectURL != "" {
+				q.Set("post_logout_redirect_uri", a.spec.PostLogoutRedirectURL)
+			}
+			sep := "?"
+			if strings.Contains(md.EndSessionEndpoint, "?") {
+				sep = "&"
+			}
+			location = md.EndSessionEndpoint + sep + q.Encode()
+		}
+	}
+
+	buildResponse(ctx, http.StatusFound, location, a.newCookie(a.cookieName(), "", -1))
+	return resultRedirected
+}
+
+// setHeaders sets the claims and the access token to the request headers,
+// and removes the cookies of the filter from the request.
+func (a *OIDCAuth) setHeaders(req *httpprot.Request, s *session) {
+	h := req.HTTPHeader()
+
+	var claims map[string]interface{}
+	if len(a.spec.ClaimHeaders) > 0 {
+		claims = oidc.ParseClaims(s.IDToken)
+	}
+	for header, claim := range a.spec.ClaimHeaders {
+		// remove the header first, so that clients cannot forge it.
+		h.Del(header)
+		if v, ok := claims[claim]; ok {
+			h.Set(header, claimValue(v))
+		}
+	}
+
+	if a.spec.ForwardAccessToken {
+		h.Set("Authorization", "Bearer "+s.AccessToken)
+	}
+
+	cookies := req.Std().Cookies()
+	h.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != a.cookieName() && c.Name != a.stateCookieName() {
+			req.Std().AddCookie(c)
+		}
+	}
+}
+
+func claimValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := codectool.MarshalJSON(v)
+	return string(data)
+}
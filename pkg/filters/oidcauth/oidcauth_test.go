@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+// fakeProvider is a fake OpenID provider.
+type fakeProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	nonce string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	fp := &fakeProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 fp.URL,
+			"authorization_endpoint": fp.URL + "/auth",
+			"token_endpoint":         fp.URL + "/token",
+			"jwks_uri":               fp.URL + "/jwks",
+			"end_session_endpoint":   fp.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		var resp map[string]interface{}
+		switch {
+		case r.Form.Get("grant_type") == "authorization_code" && r.Form.Get("code") == "good":
+			resp = map[string]interface{}{
+				"access_token":  "at1",
+				"refresh_token": "rt1",
+				"id_token":      fp.idToken(t, fp.nonce),
+			}
+		case r.Form.Get("grant_type") == "refresh_token" && r.Form.Get("refresh_token") == "rt1":
+			resp = map[string]interface{}{"access_token": "at2"}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			resp = map[string]interface{}{"error": "invalid_grant"}
+		}
+		resp["token_type"] = "Bearer"
+		resp["expires_in"] = 3600
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	fp.Server = httptest.NewServer(mux)
+	return fp
+}
+
+func (fp *fakeProvider) idToken(t *testing.T, nonce string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":    fp.URL,
+		"aud":    []string{"easegress"},
+		"sub":    "alice",
+		"email":  "alice@megaease.com",
+		"groups": []string{"admin"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  nonce,
+	})
+	token.Header["kid"] = "k1"
+	s, err := token.SignedString(fp.key)
+	assert.NoError(t, err)
+	return s
+}
+
+func newOIDCAuth(t *testing.T, discoveryURL string) *OIDCAuth {
+	yamlSpec := fmt.Sprintf(`
+kind: OIDCAuth
+name: oidc
+discoveryUrl: %s
+clientId: easegress
+clientSecret: secret
+redirectUrl: https://example.com/callback
+scopes: [profile, email]
+cookieSecret: 0123456789abcdef
+logoutPath: /logout
+claimHeaders:
+  X-User-Email: email
+  X-User-Groups: groups
+forwardAccessToken: true
+`, discoveryURL)
+
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	a := kind.CreateInstance(spec).(*OIDCAuth)
+	a.Init()
+	return a
+}
+
+func newContext(t *testing.T, method, u string, cookies ...*http.Cookie) *context.Context {
+	stdr, _ := http.NewRequest(method, u, nil)
+	for _, c := range cookies {
+		stdr.AddCookie(c)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func responseCookie(ctx *context.Context, name string) *http.Cookie {
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	stdr := &http.Response{Header: resp.HTTPHeader()}
+	for _, c := range stdr.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDCAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	fp := newFakeProvider(t)
+	defer fp.Close()
+
+	a := newOIDCAuth(t, fp.URL+"/.well-known/openid-configuration")
+	defer a.Close()
+	assert.Equal(kind, a.Kind())
+	assert.Equal("oidc", a.Name())
+	assert.Nil(a.Status())
+
+	// not logged in.
+	ctx := newContext(t, http.MethodPost, "https://example.com/app")
+	assert.Equal(resultUnauthorized, a.Handle(ctx))
+	assert.Equal(http.StatusUnauthorized, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, http.MethodGet, "https://example.com/app?x=1")
+	assert.Equal(resultRedirected, a.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+	location, err := url.Parse(resp.HTTPHeader().Get("Location"))
+	assert.NoError(err)
+	assert.Equal(fp.URL+"/auth", location.Scheme+"://"+location.Host+location.Path)
+	query := location.Query()
+	assert.Equal("easegress", query.Get("client_id"))
+	assert.Equal("https://example.com/callback", query.Get("redirect_uri"))
+	assert.Equal("openid profile email", query.Get("scope"))
+	stateCookie := responseCookie(ctx, "easegress_oidc_session_state")
+	assert.NotNil(stateCookie)
+	assert.True(stateCookie.Secure)
+	fp.nonce = query.Get("nonce")
+
+	// callback with invalid state or code.
+	ctx = newContext(t, http.MethodGet, "https://example.com/callback?code=good&state=bad", stateCookie)
+	assert.Equal(resultUnauthorized, a.Handle(ctx))
+	ctx = newContext(t, http.MethodGet, "https://example.com/callback?code=bad&state="+query.Get("state"), stateCookie)
+	assert.Equal(resultUnauthorized, a.Handle(ctx))
+	ctx = newContext(t, http.MethodGet, "https://example.com/callback?error=access_denied")
+	assert.Equal(resultUnauthorized, a.Handle(ctx))
+
+	// callback.
+	ctx = newContext(t, http.MethodGet, "https://example.com/callback?code=good&state="+query.Get("state"), stateCookie)
+	assert.Equal(resultRedirected, a.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("/app?x=1", resp.HTTPHeader().Get("Location"))
+	assert.Equal(-1, responseCookie(ctx, "easegress_oidc_session_state").MaxAge)
+	sessionCookie := responseCookie(ctx, "easegress_oidc_session")
+	assert.NotNil(sessionCookie)
+
+	// logged in.
+	ctx = newContext(t, http.MethodGet, "https://example.com/app", sessionCookie, &http.Cookie{Name: "other", Value: "1"})
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-User-Email", "forged")
+	assert.Equal("", a.Handle(ctx))
+	assert.Equal("alice@megaease.com", req.HTTPHeader().Get("X-User-Email"))
+	assert.Equal(`["admin"]`, req.HTTPHeader().Get("X-User-Groups"))
+	assert.Equal("Bearer at1", req.HTTPHeader().Get("Authorization"))
+	assert.Equal("other=1", req.HTTPHeader().Get("Cookie"))
+
+	// invalid session cookie.
+	ctx = newContext(t, http.MethodGet, "https://example.com/app", &http.Cookie{Name: "easegress_oidc_session", Value: "bad"})
+	assert.Equal(resultRedirected, a.Handle(ctx))
+
+	// expired session.
+	s := &session{}
+	assert.NoError(a.codec.decode(sessionCookie.Value, s))
+	s.Expiry = time.Now().Add(-time.Minute).Unix()
+	value, err := a.codec.encode(s)
+	assert.NoError(err)
+	ctx = newContext(t, http.MethodGet, "https://example.com/app", &http.Cookie{Name: "easegress_oidc_session", Value: value})
+	w := httptest.NewRecorder()
+	ctx.SetData(httpprot.ResponseWriterKey, http.ResponseWriter(w))
+	assert.Equal("", a.Handle(ctx))
+	assert.Equal("Bearer at2", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("Authorization"))
+	assert.True(strings.HasPrefix(w.Header().Get("Set-Cookie"), "easegress_oidc_session="))
+
+	s.RefreshToken = ""
+	value, _ = a.codec.encode(s)
+	ctx = newContext(t, http.MethodGet, "https://example.com/app", &http.Cookie{Name: "easegress_oidc_session", Value: value})
+	assert.Equal(resultRedirected, a.Handle(ctx))
+
+	// logout.
+	ctx = newContext(t, http.MethodGet, "https://example.com/logout", sessionCookie)
+	assert.Equal(resultRedirected, a.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.True(strings.HasPrefix(resp.HTTPHeader().Get("Location"), fp.URL+"/logout?id_token_hint="))
+	assert.Equal(-1, responseCookie(ctx, "easegress_oidc_session").MaxAge)
+
+	// the provider is unavailable.
+	newa := newOIDCAuth(t, "http://127.0.0.1:1/.well-known/openid-configuration")
+	newa.Inherit(a)
+	ctx = newContext(t, http.MethodGet, "https://example.com/app")
+	assert.Equal(resultServerError, newa.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{RedirectURL: "https://example.com/callback"}
+	assert.NoError(spec.Validate())
+
+	spec.LogoutPath = "/callback"
+	assert.Error(spec.Validate())
+	spec.LogoutPath = ""
+
+	spec.CookieMaxAge = "1x"
+	assert.Error(spec.Validate())
+	spec.CookieMaxAge = ""
+
+	spec.ClaimHeaders = map[string]string{"X-User": ""}
+	assert.Error(spec.Validate())
+
+	spec.RedirectURL = "/callback"
+	assert.Error(spec.Validate())
+}
+
+func TestCookieCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	cc := newCookieCodec("secret")
+	value, err := cc.encode(&session{IDToken: "id"})
+	assert.NoError(err)
+
+	s := &session{}
+	assert.NoError(cc.decode(value, s))
+	assert.Equal("id", s.IDToken)
+
+	assert.Error(newCookieCodec("other").decode(value, s))
+	assert.Error(cc.decode("a", s))
+	assert.Error(cc.decode("!", s))
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	stdcontext "context"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/megaease/easegress/pkg/util/oidc"
+)
+
+// oauth2Config returns the OAuth2 config of the client.
+func oauth2Config(p *oidc.Provider, spec *Spec) (*oauth2.Config, error) {
+	md, err := p.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     spec.ClientID,
+		ClientSecret: spec.ClientSecret,
+		RedirectURL:  spec.RedirectURL,
+		Scopes:       spec.scopes(),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  md.AuthorizationEndpoint,
+			TokenURL: md.TokenEndpoint,
+		},
+	}, nil
+}
+
+// clientContext returns a context which makes the oauth2 library use the
+// HTTP client of the provider.
+func clientContext(p *oidc.Provider) stdcontext.Context {
+	return stdcontext.WithValue(stdcontext.Background(), oauth2.HTTPClient, p.Client())
+}
+
+// scopes returns the scopes to request, "openid" is always included.
+func (s *Spec) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range s.Scopes {
+		if !strings.EqualFold(scope, "openid") {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
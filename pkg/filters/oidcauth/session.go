@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidcauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// session is the session of an authenticated user, which is stored
+	// in the encrypted session cookie.
+	session struct {
+		IDToken      string `json:"idToken"`
+		AccessToken  string `json:"accessToken"`
+		RefreshToken string `json:"refreshToken,omitempty"`
+		// Expiry is the unix time when the access token expires, 0 means
+		// it does not expire.
+		Expiry int64 `json:"expiry,omitempty"`
+	}
+
+	// loginState is the state of a login, which is stored in the state
+	// cookie, to verify the callback from the provider.
+	loginState struct {
+		State       string `json:"state"`
+		Nonce       string `json:"nonce"`
+		RedirectURL string `json:"redirectUrl"`
+	}
+
+	// cookieCodec encrypts and authenticates cookie values by AES-GCM.
+	cookieCodec struct {
+		aead cipher.AEAD
+	}
+)
+
+// newCookieCodec creates a cookie codec, the key is derived from secret.
+func newCookieCodec(secret string) *cookieCodec {
+	key := sha256.Sum256([]byte(secret))
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+	return &cookieCodec{aead: aead}
+}
+
+func (cc *cookieCodec) encode(v interface{}) (string, error) {
+	data, err := codectool.MarshalJSON(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, cc.aead.NonceSize(), cc.aead.NonceSize()+len(data)+cc.aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cc.aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+func (cc *cookieCodec) decode(value string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+
+	n := cc.aead.NonceSize()
+	if len(data) < n {
+		return fmt.Errorf("cookie value is too short")
+	}
+	if data, err = cc.aead.Open(nil, data[:n], data[n:], nil); err != nil {
+		return err
+	}
+	return codectool.UnmarshalJSON(data, v)
+}
+
+// randomString returns a random string for the state and nonce.
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// expired returns whether the access token of the session has expired.
+func (s *session) expired() bool {
+	return s.Expiry != 0 && time.Now().Unix() >= s.Expiry
+}
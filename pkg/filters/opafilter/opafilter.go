@@ -0,0 +1,348 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package opafilter provides the OPAFilter filter.
+package opafilter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of OPAFilter.
+	Kind = "OPAFilter"
+
+	resultDenied      = "denied"
+	resultServerError = "serverError"
+
+	defaultTimeout = time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "OPAFilter authorizes requests by the policies of Open Policy Agent",
+	Results:     []string{resultDenied, resultServerError},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			ServerURL: "http://127.0.0.1:8181",
+			Timeout:   "1s",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &OPAFilter{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*OPAFilter)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// OPAFilter is the filter OPAFilter.
+	OPAFilter struct {
+		spec    *Spec
+		client  *http.Client
+		dataURL string
+
+		// policyLock protects policyUploaded.
+		policyLock     sync.Mutex
+		policyUploaded bool
+	}
+
+	// Spec describes the OPAFilter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		ServerURL        string `json:"serverUrl" jsonschema:"required,format=url"`
+		DecisionPath     string `json:"decisionPath" jsonschema:"required"`
+		Policy           string `json:"policy" jsonschema:"omitempty"`
+		Timeout          string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		IncludeBody      bool   `json:"includeBody" jsonschema:"omitempty"`
+		IncludeJWTClaims bool   `json:"includeJwtClaims" jsonschema:"omitempty"`
+		FailOpen         bool   `json:"failOpen" jsonschema:"omitempty"`
+	}
+
+	// input is the input document of the decision.
+	input struct {
+		Request *requestInput          `json:"request"`
+		Claims  map[string]interface{} `json:"claims,omitempty"`
+	}
+
+	requestInput struct {
+		Method  string              `json:"method"`
+		Scheme  string              `json:"scheme"`
+		Host    string              `json:"host"`
+		Path    string              `json:"path"`
+		Query   map[string][]string `json:"query"`
+		Headers map[string]string   `json:"headers"`
+		RealIP  string              `json:"realIp"`
+		Body    string              `json:"body,omitempty"`
+	}
+
+	// decision is the decision of the policy, which is either a bool of
+	// whether to allow the request, or an object of this structure.
+	decision struct {
+		Allow      bool              `json:"allow"`
+		Headers    map[string]string `json:"headers"`
+		StatusCode int               `json:"statusCode"`
+		Reason     string            `json:"reason"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if strings.Trim(s.DecisionPath, "/") == "" {
+		return fmt.Errorf("decision path is empty")
+	}
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", s.Timeout, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the OPAFilter filter instance.
+func (f *OPAFilter) Name() string {
+	return f.spec.Name()
+}
+
+// Kind returns the kind of OPAFilter.
+func (f *OPAFilter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the OPAFilter
+func (f *OPAFilter) Spec() filters.Spec {
+	return f.spec
+}
+
+// Init initializes OPAFilter.
+func (f *OPAFilter) Init() {
+	f.reload()
+}
+
+// Inherit inherits previous generation of OPAFilter.
+func (f *OPAFilter) Inherit(previousGeneration filters.Filter) {
+	f.reload()
+}
+
+func (f *OPAFilter) reload() {
+	timeout := defaultTimeout
+	if f.spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(f.spec.Timeout)
+	}
+	f.client = &http.Client{Timeout: timeout}
+
+	server := strings.TrimSuffix(f.spec.ServerURL, "/")
+	f.dataURL = server + "/v1/data/" + strings.Trim(f.spec.DecisionPath, "/")
+
+	// the policy is uploaded here, and on requests if it failed, as the
+	// OPA server may not be ready.
+	if f.spec.Policy != "" {
+		f.uploadPolicy()
+	}
+}
+
+// policyURL returns the URL of the policy of the filter in the OPA server.
+func (f *OPAFilter) policyURL() string {
+	id := fmt.Sprintf("easegress/%s/%s", f.spec.Pipeline(), f.spec.Name())
+	return strings.TrimSuffix(f.spec.ServerURL, "/") + "/v1/policies/" + id
+}
+
+// uploadPolicy uploads the policy to the OPA server if it has not been
+// uploaded, and returns whether the policy is ready.
+func (f *OPAFilter) uploadPolicy() bool {
+	f.policyLock.Lock()
+	defer f.policyLock.Unlock()
+
+	if f.policyUploaded {
+		return true
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, f.policyURL(), strings.NewReader(f.spec.Policy))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		logger.Errorf("%s: failed to upload policy: %v", f.Name(), err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		codectool.DecodeJSON(resp.Body, &e)
+		logger.Errorf("%s: failed to upload policy: status code %d: %s", f.Name(), resp.StatusCode, e.Message)
+		return false
+	}
+
+	f.policyUploaded = true
+	return true
+}
+
+// Status returns status.
+func (f *OPAFilter) Status() interface{} {
+	return nil
+}
+
+// Close closes OPAFilter. The policy is kept in the OPA server, as its ID
+// is the same in all generations of the filter.
+func (f *OPAFilter) Close() {
+}
+
+func (f *OPAFilter) buildInput(req *httpprot.Request) *input {
+	stdr := req.Std()
+
+	ri := &requestInput{
+		Method:  req.Method(),
+		Scheme:  req.Scheme(),
+		Host:    req.Host(),
+		Path:    req.Path(),
+		Query:   stdr.URL.Query(),
+		Headers: map[string]string{},
+		RealIP:  req.RealIP(),
+	}
+	for k, v := range req.HTTPHeader() {
+		ri.Headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	if f.spec.IncludeBody && !req.IsStream() {
+		ri.Body = string(req.RawPayload())
+	}
+
+	in := &input{Request: ri}
+	if f.spec.IncludeJWTClaims {
+		in.Claims = jwtClaims(req.HTTPHeader().Get("Authorization"))
+	}
+	return in
+}
+
+// jwtClaims returns the claims of the bearer token, the token is not
+// verified, which should be done by validators before this filter.
+func jwtClaims(auth string) map[string]interface{} {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(auth, prefix) {
+		return nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(auth[len(prefix):], claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// query queries the decision of the request from the OPA server.
+func (f *OPAFilter) query(in *input) (*decision, error) {
+	if f.spec.Policy != "" && !f.uploadPolicy() {
+		return nil, fmt.Errorf("policy is not uploaded")
+	}
+
+	body, err := codectool.MarshalJSON(map[string]interface{}{"input": in})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Post(f.dataURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result interface{} `json:"result"`
+	}
+	if err = codectool.DecodeJSON(resp.Body, &result); err != nil {
+		return nil, err
+	}
+
+	switch r := result.Result.(type) {
+	case nil:
+		// the decision is undefined, e.g. no rule matches.
+		return &decision{}, nil
+	case bool:
+		return &decision{Allow: r}, nil
+	case map[string]interface{}:
+		data, _ := codectool.MarshalJSON(r)
+		d := &decision{}
+		if err = codectool.UnmarshalJSON(data, d); err != nil {
+			return nil, fmt.Errorf("invalid decision: %v", err)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("invalid decision: %v", result.Result)
+}
+
+func buildResponse(ctx *context.Context, statusCode int, reason string) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	if reason != "" {
+		resp.HTTPHeader().Set("Content-Type", "text/plain; charset=utf-8")
+		resp.SetPayload([]byte(reason))
+	}
+	ctx.SetOutputResponse(resp)
+}
+
+// Handle authorizes the request by the decision of the OPA server.
+func (f *OPAFilter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	d, err := f.query(f.buildInput(req))
+	if err != nil {
+		if f.spec.FailOpen {
+			logger.Warnf("%s: failed to query decision, the request is allowed: %v", f.Name(), err)
+			return ""
+		}
+		logger.Errorf("%s: failed to query decision: %v", f.Name(), err)
+		buildResponse(ctx, http.StatusServiceUnavailable, "")
+		return resultServerError
+	}
+
+	if !d.Allow {
+		statusCode := d.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusForbidden
+		}
+		buildResponse(ctx, statusCode, d.Reason)
+		return resultDenied
+	}
+
+	for k, v := range d.Headers {
+		req.HTTPHeader().Set(k, v)
+	}
+	return ""
+}
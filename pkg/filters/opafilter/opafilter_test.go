@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opafilter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+// fakeOPA is a fake OPA server, its decision is made by the decide
+// function.
+type fakeOPA struct {
+	*httptest.Server
+	policies map[string]string
+	inputs   []*input
+	decide   func(in *input) interface{}
+}
+
+func newFakeOPA() *fakeOPA {
+	opa := &fakeOPA{policies: map[string]string{}}
+	opa.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/policies/"):
+			body, _ := io.ReadAll(r.Body)
+			if !strings.HasPrefix(string(body), "package ") {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"message": "invalid policy"}`))
+				return
+			}
+			opa.policies[strings.TrimPrefix(r.URL.Path, "/v1/policies/")] = string(body)
+			w.Write([]byte(`{}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/data/easegress/authz":
+			var body struct {
+				Input *input `json:"input"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			opa.inputs = append(opa.inputs, body.Input)
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": opa.decide(body.Input)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return opa
+}
+
+func newOPAFilter(t *testing.T, yamlSpec string) *OPAFilter {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(t, err)
+
+	f := kind.CreateInstance(spec).(*OPAFilter)
+	f.Init()
+	return f
+}
+
+func newContext(t *testing.T, method, url, body string) *context.Context {
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	stdr.Header.Set("X-Role", "admin")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestOPAFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	opa := newFakeOPA()
+	defer opa.Close()
+
+	f := newOPAFilter(t, `
+kind: OPAFilter
+name: opa
+serverUrl: `+opa.URL+`
+decisionPath: /easegress/authz
+includeBody: true
+includeJwtClaims: true
+policy: |
+  package easegress.authz
+  default allow = false
+`)
+	defer f.Close()
+	assert.Equal(kind, f.Kind())
+	assert.Equal("opa", f.Name())
+	assert.Nil(f.Status())
+	assert.Contains(opa.policies["easegress/pipeline/opa"], "package easegress.authz")
+
+	// allowed by a bool decision.
+	opa.decide = func(in *input) interface{} {
+		return in.Request.Headers["x-role"] == "admin"
+	}
+	ctx := newContext(t, http.MethodPost, "http://127.0.0.1/api?a=1", "hello")
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice"}).SignedString([]byte("secret"))
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("Authorization", "Bearer "+token)
+	assert.Equal("", f.Handle(ctx))
+	in := opa.inputs[len(opa.inputs)-1]
+	assert.Equal(http.MethodPost, in.Request.Method)
+	assert.Equal("/api", in.Request.Path)
+	assert.Equal([]string{"1"}, in.Request.Query["a"])
+	assert.Equal("hello", in.Request.Body)
+	assert.Equal("alice", in.Claims["sub"])
+
+	// denied by an object decision.
+	opa.decide = func(in *input) interface{} {
+		return map[string]interface{}{"allow": false, "statusCode": 401, "reason": "login required"}
+	}
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/api", "")
+	assert.Equal(resultDenied, f.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusUnauthorized, resp.StatusCode())
+	assert.Equal("login required", string(resp.RawPayload()))
+
+	// allowed and annotated.
+	opa.decide = func(in *input) interface{} {
+		return map[string]interface{}{"allow": true, "headers": map[string]string{"X-Tenant": "megaease"}}
+	}
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/api", "")
+	assert.Equal("", f.Handle(ctx))
+	assert.Equal("megaease", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Tenant"))
+
+	// undefined and invalid decisions.
+	opa.decide = func(in *input) interface{} { return nil }
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/api", "")
+	assert.Equal(resultDenied, f.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	opa.decide = func(in *input) interface{} { return "yes" }
+	ctx = newContext(t, http.MethodGet, "http://127.0.0.1/api", "")
+	assert.Equal(resultServerError, f.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
+
+func TestOPAFilterFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	opa := newFakeOPA()
+	defer opa.Close()
+	opa.decide = func(in *input) interface{} { return true }
+
+	// invalid policy.
+	f := newOPAFilter(t, `
+kind: OPAFilter
+name: opa
+serverUrl: `+opa.URL+`
+decisionPath: easegress/authz
+policy: invalid
+`)
+	ctx := newContext(t, http.MethodGet, "http://127.0.0.1/api", "")
+	assert.Equal(resultServerError, f.Handle(ctx))
+	assert.Empty(opa.inputs)
+
+	// unavailable server.
+	yamlSpec := `
+kind: OPAFilter
+name: opa
+serverUrl: http://127.0.0.1:1
+decisionPath: easegress/authz
+timeout: 100ms
+`
+	f = newOPAFilter(t, yamlSpec)
+	assert.Equal(resultServerError, f.Handle(ctx))
+
+	newf := newOPAFilter(t, yamlSpec+"failOpen: true\n")
+	newf.Inherit(f)
+	assert.Equal("", newf.Handle(ctx))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{DecisionPath: "easegress/authz"}
+	assert.NoError(spec.Validate())
+
+	spec.Timeout = "1x"
+	assert.Error(spec.Validate())
+
+	spec.Timeout = ""
+	spec.DecisionPath = "/"
+	assert.Error(spec.Validate())
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/resilience"
+	libcb "github.com/megaease/easegress/pkg/util/circuitbreaker"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// PoolKey returns the key of a server pool used by the circuit breaker API,
+// which is main, mirror or candidate-N, N is the index of the candidate
+// pool.
+func PoolKey(poolName, proxyName string) string {
+	key := strings.TrimPrefix(poolName, "proxy#"+proxyName+"#")
+	return strings.ReplaceAll(key, "#", "-")
+}
+
+// syncCircuitBreaker applies the states of the circuit breaker stored in
+// the cluster, and shares the state transitions with the other members if
+// required.
+func (sp *ServerPool) syncCircuitBreaker(cb resilience.CircuitBreakerWrapper, share bool) {
+	if sp.proxy == nil {
+		return
+	}
+	super := sp.proxy.super
+	if super == nil || super.Cluster() == nil {
+		return
+	}
+
+	cls := super.Cluster()
+	member := super.Options().Name
+	key := cls.Layout().CircuitBreakerPrefix(sp.proxy.spec.Pipeline(), sp.proxy.Name())
+	key += PoolKey(sp.name, sp.proxy.Name())
+
+	if share {
+		cb.SetStateListener(func(event *libcb.Event) {
+			if !shouldShare(event) {
+				return
+			}
+			record := &resilience.CircuitBreakerRecord{
+				State:  event.NewState,
+				Member: member,
+				Time:   event.Time.Format(time.RFC3339Nano),
+			}
+			if err := cls.Put(key, string(codectool.MustMarshalJSON(record))); err != nil {
+				logger.Proxy.Errorf("%s: failed to share circuit breaker state: %v", sp.name, err)
+			}
+		})
+	}
+
+	sp.wg.Add(1)
+	go func() {
+		defer sp.wg.Done()
+		sp.watchCircuitBreaker(cls, key, member, cb)
+	}()
+}
+
+// shouldShare returns whether the state transition should be shared, the
+// forced ones are not shared as they are from the cluster, and the ones to
+// half open are not shared as they are driven by the timers of all members.
+func shouldShare(event *libcb.Event) bool {
+	if event.Forced {
+		return false
+	}
+	switch event.NewState {
+	case libcb.StateOpen.String():
+		return true
+	case libcb.StateClosed.String():
+		return event.OldState == libcb.StateHalfOpen.String()
+	}
+	return false
+}
+
+func (sp *ServerPool) watchCircuitBreaker(cls cluster.Cluster, key, member string, cb resilience.CircuitBreakerWrapper) {
+	var (
+		ch     <-chan *string
+		syncer cluster.Syncer
+		err    error
+	)
+
+	for {
+		syncer, err = cls.Syncer(time.Minute)
+		if err == nil {
+			ch, err = syncer.Sync(key)
+			if err == nil {
+				break
+			}
+		}
+		logger.Proxy.Errorf("%s: failed to watch circuit breaker state: %v", sp.name, err)
+		select {
+		case <-time.After(10 * time.Second):
+		case <-sp.done:
+			return
+		}
+	}
+	defer syncer.Close()
+
+	started := time.Now()
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			if value == nil {
+				continue
+			}
+			record := &resilience.CircuitBreakerRecord{}
+			if err := codectool.UnmarshalJSON([]byte(*value), record); err != nil {
+				logger.Proxy.Errorf("%s: invalid circuit breaker state %s: %v", sp.name, *value, err)
+				continue
+			}
+			if !shouldApply(record, member, started) {
+				continue
+			}
+			if err := cb.Apply(record); err != nil {
+				logger.Proxy.Errorf("%s: failed to apply circuit breaker state: %v", sp.name, err)
+			}
+
+		case <-sp.done:
+			return
+		}
+	}
+}
+
+// shouldApply returns whether the record should be applied to the circuit
+// breaker started at the given time. The records shared by the member
+// itself are skipped, and only the forced open state is restored from the
+// records written before the start, e.g. when the pipeline is updated.
+func shouldApply(record *resilience.CircuitBreakerRecord, member string, started time.Time) bool {
+	if record.Member != "" && record.Member == member {
+		return false
+	}
+	if record.State == libcb.StateForceOpen.String() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339Nano, record.Time)
+	return err == nil && !t.Before(started)
+}
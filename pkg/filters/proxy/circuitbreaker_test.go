@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/megaease/easegress/pkg/supervisor"
+	libcb "github.com/megaease/easegress/pkg/util/circuitbreaker"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestPoolKey(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("main", PoolKey("proxy#proxy#main", "proxy"))
+	assert.Equal("candidate-1", PoolKey("proxy#proxy#candidate#1", "proxy"))
+	assert.Equal("mirror", PoolKey("proxy#proxy#mirror", "proxy"))
+}
+
+func TestShouldApply(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	before := now.Add(-time.Second).Format(time.RFC3339Nano)
+	after := now.Add(time.Second).Format(time.RFC3339Nano)
+
+	assert.True(shouldApply(&resilience.CircuitBreakerRecord{State: "ForceOpen", Time: before}, "m1", now))
+	assert.False(shouldApply(&resilience.CircuitBreakerRecord{State: "Closed", Time: before}, "m1", now))
+	assert.True(shouldApply(&resilience.CircuitBreakerRecord{State: "Closed", Time: after}, "m1", now))
+	assert.False(shouldApply(&resilience.CircuitBreakerRecord{State: "Open", Member: "m1", Time: after}, "m1", now))
+	assert.True(shouldApply(&resilience.CircuitBreakerRecord{State: "Open", Member: "m2", Time: after}, "m1", now))
+
+	assert.True(shouldShare(&libcb.Event{OldState: "Closed", NewState: "Open"}))
+	assert.True(shouldShare(&libcb.Event{OldState: "HalfOpen", NewState: "Closed"}))
+	assert.False(shouldShare(&libcb.Event{OldState: "Open", NewState: "HalfOpen"}))
+	assert.False(shouldShare(&libcb.Event{OldState: "Closed", NewState: "Open", Forced: true}))
+}
+
+func TestSyncCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan *string, 10)
+	var (
+		mutex  sync.Mutex
+		puts   = map[string]string{}
+		synced string
+	)
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout {
+		return &cluster.Layout{}
+	}
+	cls.MockedSyncer = func(time.Duration) (cluster.Syncer, error) {
+		syncer := clustertest.NewMockedSyncer()
+		syncer.MockedSync = func(key string) (<-chan *string, error) {
+			mutex.Lock()
+			synced = key
+			mutex.Unlock()
+			return ch, nil
+		}
+		return syncer, nil
+	}
+	cls.MockedPut = func(key, value string) error {
+		mutex.Lock()
+		puts[key] = value
+		mutex.Unlock()
+		return nil
+	}
+
+	opt := option.New()
+	opt.Name = "member-1"
+	super := supervisor.NewMock(opt, cls, sync.Map{}, sync.Map{}, nil, nil, false, nil, nil)
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  circuitBreakerPolicy: cb
+`, assert)
+	proxy.super = super
+
+	policy := resilience.CircuitBreakerKind.DefaultPolicy().(*resilience.CircuitBreakerPolicy)
+	policy.SlidingWindowSize = 2
+	policy.MinimumNumberOfCalls = 2
+	policy.ShareState = true
+	proxy.InjectResiliencePolicy(map[string]resilience.Policy{"cb": policy})
+	defer proxy.Close()
+
+	key := "/circuitbreaker//proxy/main"
+	assert.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return synced == key
+	}, time.Second, 10*time.Millisecond)
+
+	state := func() string {
+		return proxy.Status().(*Status).MainPool.CircuitBreaker.State
+	}
+	send := func(record *resilience.CircuitBreakerRecord) {
+		value := string(codectool.MustMarshalJSON(record))
+		ch <- &value
+	}
+	assert.Equal("Closed", state())
+
+	// force open by the admin API.
+	send(&resilience.CircuitBreakerRecord{State: "ForceOpen", Time: time.Now().Format(time.RFC3339Nano)})
+	assert.Eventually(func() bool { return state() == "ForceOpen" }, time.Second, 10*time.Millisecond)
+
+	// a shared state doesn't override the forced open state.
+	send(&resilience.CircuitBreakerRecord{State: "Closed", Member: "member-2", Time: time.Now().Format(time.RFC3339Nano)})
+	send(&resilience.CircuitBreakerRecord{State: "Closed", Reset: true, Time: time.Now().Format(time.RFC3339Nano)})
+	assert.Eventually(func() bool { return state() == "Closed" }, time.Second, 10*time.Millisecond)
+
+	// the local transition to open is shared.
+	cb := proxy.mainPool.circuitBreaker
+	for i := 0; i < 2; i++ {
+		_, stateID := cb.AcquirePermission()
+		cb.RecordResult(stateID, true, time.Millisecond)
+	}
+	assert.Equal("Open", state())
+	assert.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		record := &resilience.CircuitBreakerRecord{}
+		if codectool.UnmarshalJSON([]byte(puts[key]), record) != nil {
+			return false
+		}
+		return record.State == "Open" && record.Member == "member-1"
+	}, time.Second, 10*time.Millisecond)
+
+	// the stale shared state is skipped.
+	send(&resilience.CircuitBreakerRecord{State: "Closed", Member: "member-2", Time: time.Now().Add(-time.Hour).Format(time.RFC3339Nano)})
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal("Open", state())
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/util/readers"
 )
 
@@ -60,6 +61,11 @@ func (c *compression) compress(req *http.Request, resp *http.Response) bool {
 		return false
 	}
 
+	// gzip buffers the data, which delays the events.
+	if httpprot.IsEventStream(resp.Header) {
+		return false
+	}
+
 	if resp.ContentLength != -1 && resp.ContentLength < int64(c.spec.MinLength) {
 		return false
 	}
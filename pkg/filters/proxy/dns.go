@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const dnsLookupTimeout = 5 * time.Second
+
+// dnsResolver looks up the DNS records of the servers, it is implemented by
+// net.Resolver.
+type dnsResolver interface {
+	LookupIPAddr(ctx stdcontext.Context, host string) ([]net.IPAddr, error)
+	LookupSRV(ctx stdcontext.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// defaultResolver is a variable for testing.
+var defaultResolver dnsResolver = net.DefaultResolver
+
+// serverResolver expands the servers whose address is a host name to one
+// server per resolved address. The last resolved addresses of a server are
+// kept when a lookup fails, so that a DNS outage never empties the pool.
+type serverResolver struct {
+	resolver dnsResolver
+	servers  []*Server
+	last     map[string][]string
+}
+
+func newServerResolver(servers []*Server) *serverResolver {
+	return &serverResolver{
+		resolver: defaultResolver,
+		servers:  servers,
+		last:     map[string][]string{},
+	}
+}
+
+// isSRVName returns whether the host name is the name of SRV records,
+// e.g. _http._tcp.backend.default.svc.cluster.local.
+func isSRVName(host string) bool {
+	return strings.HasPrefix(host, "_")
+}
+
+// lookup returns the addresses of the server in the form of host:port, and
+// the port is omitted if the server address has no port.
+func (r *serverResolver) lookup(u *url.URL) ([]string, error) {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	host, port := u.Hostname(), u.Port()
+	if !isSRVName(host) {
+		return r.lookupIP(ctx, host, port)
+	}
+
+	_, records, err := r.resolver.LookupSRV(ctx, "", "", host)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the records with the highest priority, which is the lowest
+	// value, are used.
+	var addrs []string
+	for _, record := range records {
+		if record.Priority != records[0].Priority {
+			continue
+		}
+		target := strings.TrimSuffix(record.Target, ".")
+		ips, err := r.lookupIP(ctx, target, fmt.Sprint(record.Port))
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, ips...)
+	}
+	return addrs, nil
+}
+
+func (r *serverResolver) lookupIP(ctx stdcontext.Context, host, port string) ([]string, error) {
+	ips, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if port != "" {
+			addrs = append(addrs, net.JoinHostPort(ip.IP.String(), port))
+		} else if ip.IP.To4() == nil {
+			addrs = append(addrs, "["+ip.IP.String()+"]")
+		} else {
+			addrs = append(addrs, ip.IP.String())
+		}
+	}
+	return addrs, nil
+}
+
+// resolve returns the servers with the host names replaced by the resolved
+// addresses. A server is kept as is if its address is an IP, or it has
+// never been resolved successfully.
+func (r *serverResolver) resolve() []*Server {
+	result := make([]*Server, 0, len(r.servers))
+
+	for _, svr := range r.servers {
+		u, err := url.Parse(svr.URL)
+		if err != nil || net.ParseIP(u.Hostname()) != nil {
+			result = append(result, svr)
+			continue
+		}
+
+		addrs, err := r.lookup(u)
+		if err == nil && len(addrs) == 0 {
+			err = fmt.Errorf("no record found")
+		}
+		if err != nil {
+			logger.Proxy.Warnf("resolve server %s failed: %v", svr.URL, err)
+			addrs = r.last[svr.URL]
+		} else {
+			sort.Strings(addrs)
+			r.last[svr.URL] = addrs
+		}
+
+		if len(addrs) == 0 {
+			result = append(result, svr)
+			continue
+		}
+
+		// the host name is still used as the Host header, except for SRV
+		// names, which are not the names of the servers.
+		hostName := u.Host
+		if isSRVName(u.Hostname()) {
+			hostName = ""
+		}
+
+		for _, addr := range addrs {
+			nu := *u
+			nu.Host = addr
+			result = append(result, &Server{
+				URL:      nu.String(),
+				Tags:     svr.Tags,
+				Weight:   svr.Weight,
+				KeepHost: svr.KeepHost,
+				hostName: hostName,
+			})
+		}
+	}
+
+	return result
+}
+
+// sameServers returns whether the two server lists have the same URLs in
+// the same order.
+func sameServers(a, b []*Server) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].URL != b[i].URL {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveServers resolves the static servers periodically, and recreates
+// the load balancer when the resolved servers change.
+func (sp *ServerPool) resolveServers(interval time.Duration) {
+	r := newServerResolver(sp.spec.Servers)
+
+	sp.wg.Add(1)
+	go func() {
+		defer sp.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		current := sp.spec.Servers
+		for {
+			if servers := r.resolve(); !sameServers(servers, current) {
+				logger.Proxy.Infof("%s: servers resolved to %v", sp.name, servers)
+				sp.createLoadBalancer(servers)
+				current = servers
+			}
+
+			select {
+			case <-sp.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockResolver struct {
+	sync.Mutex
+	ips  map[string][]string
+	srvs map[string][]*net.SRV
+}
+
+func (r *mockResolver) setIPs(host string, ips ...string) {
+	r.Lock()
+	defer r.Unlock()
+	r.ips[host] = ips
+}
+
+func (r *mockResolver) LookupIPAddr(ctx stdcontext.Context, host string) ([]net.IPAddr, error) {
+	r.Lock()
+	defer r.Unlock()
+	ips, ok := r.ips[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	var result []net.IPAddr
+	for _, ip := range ips {
+		result = append(result, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return result, nil
+}
+
+func (r *mockResolver) LookupSRV(ctx stdcontext.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.Lock()
+	defer r.Unlock()
+	srvs, ok := r.srvs[name]
+	if !ok {
+		return "", nil, fmt.Errorf("no such host %s", name)
+	}
+	return name, srvs, nil
+}
+
+func urls(servers []*Server) []string {
+	var result []string
+	for _, s := range servers {
+		result = append(result, s.URL)
+	}
+	return result
+}
+
+func TestServerResolver(t *testing.T) {
+	assert := assert.New(t)
+
+	mr := &mockResolver{
+		ips: map[string][]string{
+			"backend":  {"10.0.0.2", "10.0.0.1"},
+			"ipv6":     {"fd00::1"},
+			"pod-0.be": {"10.0.1.1"},
+			"pod-1.be": {"10.0.1.2"},
+			"pod-2.be": {"10.0.1.3"},
+		},
+		srvs: map[string][]*net.SRV{
+			"_http._tcp.be": {
+				{Target: "pod-0.be.", Port: 8080, Priority: 1},
+				{Target: "pod-1.be.", Port: 8081, Priority: 1},
+				{Target: "pod-2.be.", Port: 8082, Priority: 2},
+			},
+		},
+	}
+
+	r := newServerResolver([]*Server{
+		{URL: "http://backend:8080/api", Weight: 10, Tags: []string{"v1"}},
+		{URL: "http://ipv6", Weight: 20},
+		{URL: "http://_http._tcp.be", Weight: 30},
+		{URL: "http://127.0.0.1:9090", Weight: 40},
+		{URL: "http://unknown:8080", Weight: 50},
+	})
+	r.resolver = mr
+
+	servers := r.resolve()
+	assert.Equal([]string{
+		"http://10.0.0.1:8080/api",
+		"http://10.0.0.2:8080/api",
+		"http://[fd00::1]",
+		"http://10.0.1.1:8080",
+		"http://10.0.1.2:8081",
+		"http://127.0.0.1:9090",
+		"http://unknown:8080",
+	}, urls(servers))
+
+	assert.Equal("backend:8080", servers[0].hostName)
+	assert.Equal(10, servers[0].Weight)
+	assert.Equal([]string{"v1"}, servers[0].Tags)
+	assert.Equal("", servers[3].hostName)
+
+	// the last resolved addresses are kept if the lookup fails.
+	delete(mr.ips, "backend")
+	mr.ips["unknown"] = []string{"10.0.0.9"}
+	servers = r.resolve()
+	assert.Equal([]string{
+		"http://10.0.0.1:8080/api",
+		"http://10.0.0.2:8080/api",
+		"http://[fd00::1]",
+		"http://10.0.1.1:8080",
+		"http://10.0.1.2:8081",
+		"http://127.0.0.1:9090",
+		"http://10.0.0.9:8080",
+	}, urls(servers))
+}
+
+func TestServerPoolResolveServers(t *testing.T) {
+	assert := assert.New(t)
+
+	mr := &mockResolver{ips: map[string][]string{"backend": {"10.0.0.1"}}}
+	oldResolver := defaultResolver
+	defaultResolver = mr
+	defer func() { defaultResolver = oldResolver }()
+
+	spec := &ServerPoolSpec{
+		Servers:         []*Server{{URL: "http://backend:8080"}},
+		ResolveInterval: "1s",
+	}
+	assert.NoError(spec.Validate())
+
+	sp := NewServerPool(nil, spec, "test")
+	defer sp.close()
+
+	chooseURL := func() string {
+		return sp.LoadBalancer().ChooseServer(nil).URL
+	}
+	assert.Eventually(func() bool {
+		return chooseURL() == "http://10.0.0.1:8080"
+	}, 3*time.Second, 10*time.Millisecond)
+
+	mr.setIPs("backend", "10.0.0.2")
+	assert.Eventually(func() bool {
+		return chooseURL() == "http://10.0.0.2:8080"
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// the host name is used as the Host header.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	spCtx := &serverPoolContext{req: req}
+	svr := sp.LoadBalancer().ChooseServer(nil)
+	assert.NoError(spCtx.prepareRequest(svr, stdcontext.Background(), false))
+	assert.Equal("backend:8080", spCtx.stdReq.Host)
+	assert.Equal("http://10.0.0.2:8080/foo", spCtx.stdReq.URL.String())
+
+	spec.ResolveInterval = "10ms"
+	assert.Error(spec.Validate())
+	spec.ResolveInterval = "abc"
+	assert.Error(spec.Validate())
+}
@@ -0,0 +1,442 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	healthCheckHTTP = "http"
+	healthCheckGRPC = "grpc"
+
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 3 * time.Second
+	defaultHealthCheckPath     = "/"
+)
+
+type (
+	// HealthCheckSpec describes the active health checking of a server
+	// pool, the servers are checked periodically, and the unhealthy ones
+	// are removed from the load balancer until they pass the checks again.
+	HealthCheckSpec struct {
+		// Type is http or grpc, default is http. The gRPC checks use the
+		// health protocol grpc.health.v1.
+		Type     string `json:"type,omitempty" jsonschema:"omitempty,enum=,enum=http,enum=grpc"`
+		Interval string `json:"interval,omitempty" jsonschema:"omitempty,format=duration"`
+		Timeout  string `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// Fails is the number of consecutive failed checks to mark a
+		// server unhealthy, and Passes is the number of consecutive
+		// passed checks to mark it healthy again, both default to 1.
+		Fails  int `json:"fails,omitempty" jsonschema:"omitempty,minimum=1"`
+		Passes int `json:"passes,omitempty" jsonschema:"omitempty,minimum=1"`
+
+		// Path is the path of the HTTP checks, the servers are healthy if
+		// the status codes are 2xx or 3xx.
+		Path string `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
+		// Service is the service name of the gRPC checks, empty means the
+		// overall health of the server.
+		Service string `json:"service,omitempty" jsonschema:"omitempty"`
+
+		TLS *HealthCheckTLSSpec `json:"tls,omitempty" jsonschema:"omitempty"`
+	}
+
+	// HealthCheckTLSSpec is the TLS options of the health checks. The
+	// checks of the servers whose URLs are https always use TLS, and the
+	// certificates of the mTLS of the proxy are used if it is configured.
+	HealthCheckTLSSpec struct {
+		// Enabled uses TLS for the servers whose URLs are http, e.g. the
+		// gRPC servers listening on TLS ports.
+		Enabled            bool   `json:"enabled,omitempty" jsonschema:"omitempty"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" jsonschema:"omitempty"`
+		ServerName         string `json:"serverName,omitempty" jsonschema:"omitempty"`
+	}
+
+	// healthChecker checks the health of the servers of a server pool.
+	healthChecker struct {
+		spec      *HealthCheckSpec
+		interval  time.Duration
+		timeout   time.Duration
+		fails     int
+		passes    int
+		tlsConfig *tls.Config
+		client    *http.Client
+		// servers returns the current servers of the pool.
+		servers func() []*Server
+		// onChange is called when the health of any server changes.
+		onChange func()
+
+		lock sync.Mutex
+		// states are keyed by server URLs, the servers without states
+		// are healthy.
+		states map[string]*healthState
+		conns  map[string]*grpc.ClientConn
+
+		done chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	healthState struct {
+		unhealthy bool
+		fails     int
+		passes    int
+	}
+)
+
+// Validate validates HealthCheckSpec.
+func (s *HealthCheckSpec) Validate() error {
+	if s.Type == healthCheckGRPC && s.Path != "" {
+		return fmt.Errorf("path is not supported by grpc health checks")
+	}
+	if s.Type != healthCheckGRPC && s.Service != "" {
+		return fmt.Errorf("service is only supported by grpc health checks")
+	}
+	for _, d := range []string{s.Interval, s.Timeout} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			return fmt.Errorf("invalid duration %s", d)
+		}
+	}
+	return nil
+}
+
+// newHealthChecker creates a health checker, baseTLS is the TLS config of
+// the proxy, which could be nil.
+func newHealthChecker(spec *HealthCheckSpec, baseTLS *tls.Config, servers func() []*Server, onChange func()) *healthChecker {
+	hc := &healthChecker{
+		spec:     spec,
+		interval: defaultHealthCheckInterval,
+		timeout:  defaultHealthCheckTimeout,
+		fails:    spec.Fails,
+		passes:   spec.Passes,
+		servers:  servers,
+		onChange: onChange,
+		states:   map[string]*healthState{},
+		conns:    map[string]*grpc.ClientConn{},
+		done:     make(chan struct{}),
+	}
+	if spec.Interval != "" {
+		hc.interval, _ = time.ParseDuration(spec.Interval)
+	}
+	if spec.Timeout != "" {
+		hc.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	if hc.fails <= 0 {
+		hc.fails = 1
+	}
+	if hc.passes <= 0 {
+		hc.passes = 1
+	}
+
+	if baseTLS != nil {
+		hc.tlsConfig = baseTLS.Clone()
+	} else {
+		hc.tlsConfig = &tls.Config{}
+	}
+	if spec.TLS != nil {
+		hc.tlsConfig.InsecureSkipVerify = spec.TLS.InsecureSkipVerify
+		hc.tlsConfig.ServerName = spec.TLS.ServerName
+	}
+
+	hc.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   hc.tlsConfig,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return hc
+}
+
+// start starts checking the servers periodically.
+func (hc *healthChecker) start() {
+	hc.wg.Add(1)
+	go func() {
+		defer hc.wg.Done()
+
+		ticker := time.NewTicker(hc.interval)
+		defer ticker.Stop()
+
+		for {
+			hc.checkAll()
+
+			select {
+			case <-hc.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkAll checks all the current servers concurrently, and updates their
+// states.
+func (hc *healthChecker) checkAll() {
+	servers := hc.servers()
+	results := make([]bool, len(servers))
+
+	var wg sync.WaitGroup
+	for i, svr := range servers {
+		wg.Add(1)
+		go func(i int, svr *Server) {
+			defer wg.Done()
+			err := hc.check(svr)
+			if err != nil {
+				logger.Proxy.Debugf("health check of %s failed: %v", svr.URL, err)
+			}
+			results[i] = err == nil
+		}(i, svr)
+	}
+	wg.Wait()
+
+	hc.lock.Lock()
+	select {
+	case <-hc.done:
+		hc.lock.Unlock()
+		return
+	default:
+	}
+
+	changed := false
+	current := make(map[string]struct{}, len(servers))
+	for i, svr := range servers {
+		current[svr.URL] = struct{}{}
+		if hc.update(svr.URL, results[i]) {
+			changed = true
+		}
+	}
+
+	// forget the servers removed from the pool.
+	for url := range hc.states {
+		if _, ok := current[url]; !ok {
+			delete(hc.states, url)
+		}
+	}
+	for url, conn := range hc.conns {
+		if _, ok := current[url]; !ok {
+			conn.Close()
+			delete(hc.conns, url)
+		}
+	}
+	hc.lock.Unlock()
+
+	if changed {
+		hc.onChange()
+	}
+}
+
+// update updates the state of the server by the result of a check, and
+// returns whether the health of the server changes. The caller must hold
+// the lock.
+func (hc *healthChecker) update(url string, passed bool) bool {
+	st := hc.states[url]
+	if st == nil {
+		st = &healthState{}
+		hc.states[url] = st
+	}
+
+	if passed {
+		st.fails = 0
+		if !st.unhealthy {
+			return false
+		}
+		st.passes++
+		if st.passes < hc.passes {
+			return false
+		}
+		st.passes = 0
+		st.unhealthy = false
+		logger.Proxy.Infof("server %s becomes healthy", url)
+		return true
+	}
+
+	st.passes = 0
+	if st.unhealthy {
+		return false
+	}
+	st.fails++
+	if st.fails < hc.fails {
+		return false
+	}
+	st.fails = 0
+	st.unhealthy = true
+	logger.Proxy.Warnf("server %s becomes unhealthy", url)
+	return true
+}
+
+// check checks the health of a server.
+func (hc *healthChecker) check(svr *Server) error {
+	u, err := url.Parse(svr.URL)
+	if err != nil {
+		return err
+	}
+	useTLS := u.Scheme == "https" || (hc.spec.TLS != nil && hc.spec.TLS.Enabled)
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), hc.timeout)
+	defer cancel()
+
+	if hc.spec.Type == healthCheckGRPC {
+		return hc.checkGRPC(ctx, svr.URL, u, useTLS)
+	}
+	return hc.checkHTTP(ctx, u, useTLS)
+}
+
+func (hc *healthChecker) checkHTTP(ctx stdcontext.Context, u *url.URL, useTLS bool) error {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	path := hc.spec.Path
+	if path == "" {
+		path = defaultHealthCheckPath
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+u.Host+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (hc *healthChecker) checkGRPC(ctx stdcontext.Context, key string, u *url.URL, useTLS bool) error {
+	conn, err := hc.grpcConn(key, u, useTLS)
+	if err != nil {
+		return err
+	}
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: hc.spec.Service,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// grpcConn returns the gRPC connection to the server, the connections are
+// kept between the checks.
+func (hc *healthChecker) grpcConn(key string, u *url.URL, useTLS bool) (*grpc.ClientConn, error) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	if conn := hc.conns[key]; conn != nil {
+		return conn, nil
+	}
+
+	target := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if useTLS {
+			port = "443"
+		}
+		target = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(hc.tlsConfig)
+	}
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	hc.conns[key] = conn
+	return conn, nil
+}
+
+// healthy returns the servers which are healthy.
+func (hc *healthChecker) healthy(servers []*Server) []*Server {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	result := make([]*Server, 0, len(servers))
+	for _, svr := range servers {
+		if st := hc.states[svr.URL]; st != nil && st.unhealthy {
+			continue
+		}
+		result = append(result, svr)
+	}
+
+	// use all the servers if none of them is healthy, instead of failing
+	// all requests.
+	if len(result) == 0 {
+		return servers
+	}
+	return result
+}
+
+// status returns the URLs of the unhealthy servers.
+func (hc *healthChecker) status() []string {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+
+	var result []string
+	for url, st := range hc.states {
+		if st.unhealthy {
+			result = append(result, url)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (hc *healthChecker) close() {
+	hc.lock.Lock()
+	close(hc.done)
+	hc.lock.Unlock()
+
+	hc.wg.Wait()
+
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	for _, conn := range hc.conns {
+		conn.Close()
+	}
+	hc.conns = nil
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthCheckSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&HealthCheckSpec{}).Validate())
+	assert.NoError((&HealthCheckSpec{Type: "grpc", Service: "foo", Interval: "1s"}).Validate())
+	assert.Error((&HealthCheckSpec{Type: "grpc", Path: "/healthz"}).Validate())
+	assert.Error((&HealthCheckSpec{Service: "foo"}).Validate())
+	assert.Error((&HealthCheckSpec{Timeout: "-1s"}).Validate())
+}
+
+func TestHTTPHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	var healthy int32 = 1
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer svr.Close()
+
+	servers := []*Server{{URL: svr.URL}, {URL: "http://127.0.0.1:1"}}
+	changes := 0
+	hc := newHealthChecker(&HealthCheckSpec{
+		Path:   "/healthz",
+		Passes: 2,
+	}, nil, func() []*Server { return servers }, func() { changes++ })
+	defer hc.close()
+
+	hc.checkAll()
+	assert.Equal([]string{"http://127.0.0.1:1"}, hc.status())
+	assert.Equal(servers[:1], hc.healthy(servers))
+	assert.Equal(1, changes)
+
+	// all the servers are used if none of them is healthy.
+	atomic.StoreInt32(&healthy, 0)
+	hc.checkAll()
+	assert.Len(hc.status(), 2)
+	assert.Len(hc.healthy(servers), 2)
+	assert.Equal(2, changes)
+
+	// passes are required to be healthy again.
+	atomic.StoreInt32(&healthy, 1)
+	hc.checkAll()
+	assert.Len(hc.status(), 2)
+	hc.checkAll()
+	assert.Equal([]string{"http://127.0.0.1:1"}, hc.status())
+	assert.Equal(3, changes)
+
+	// the states of the removed servers are dropped.
+	servers = servers[:1]
+	hc.checkAll()
+	assert.Empty(hc.status())
+}
+
+func TestServerPoolHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+
+	spec := &ServerPoolSpec{
+		Servers:     []*Server{{URL: svr.URL}, {URL: "http://127.0.0.1:1"}},
+		HealthCheck: &HealthCheckSpec{Interval: "10ms"},
+	}
+	assert.NoError(spec.Validate())
+
+	sp := NewServerPool(nil, spec, "test")
+	defer sp.close()
+
+	assert.Eventually(func() bool {
+		return len(sp.status().UnhealthyServers) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		assert.Equal(svr.URL, sp.LoadBalancer().ChooseServer(nil).URL)
+	}
+}
+
+func TestGRPCHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	hs := health.NewServer()
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, hs)
+	go gs.Serve(l)
+	defer gs.Stop()
+
+	hs.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+
+	url := "http://" + l.Addr().String()
+	hc := newHealthChecker(&HealthCheckSpec{
+		Type:    "grpc",
+		Service: "foo",
+	}, nil, func() []*Server {
+		return []*Server{{URL: url}}
+	}, func() {})
+	defer hc.close()
+
+	hc.checkAll()
+	assert.Empty(hc.status())
+
+	hs.SetServingStatus("foo", healthpb.HealthCheckResponse_NOT_SERVING)
+	hc.checkAll()
+	assert.Equal([]string{url}, hc.status())
+
+	hs.SetServingStatus("foo", healthpb.HealthCheckResponse_SERVING)
+	hc.checkAll()
+	assert.Empty(hc.status())
+
+	// unknown services are unhealthy.
+	hc.spec.Service = "bar"
+	hc.checkAll()
+	assert.Equal([]string{url}, hc.status())
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	gohttpstat "github.com/tcnksm/go-httpstat"
+
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+type (
+	// HedgingSpec describes request hedging of a server pool, a duplicate
+	// request is sent to another server if there's no response after the
+	// delay, and the first successful response is used.
+	HedgingSpec struct {
+		Delay       string   `json:"delay" jsonschema:"required,format=duration"`
+		MaxAttempts int      `json:"maxAttempts,omitempty" jsonschema:"omitempty,minimum=2"`
+		Methods     []string `json:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	hedging struct {
+		delay       time.Duration
+		maxAttempts int
+		methods     []string
+	}
+
+	// upstreamAttempt is an attempt to send a request to a server.
+	upstreamAttempt struct {
+		lb     LoadBalancer
+		svr    *Server
+		stdReq *http.Request
+		stat   *gohttpstat.Result
+		cancel stdcontext.CancelFunc
+
+		resp *http.Response
+		err  error
+	}
+)
+
+// Validate validates HedgingSpec.
+func (spec *HedgingSpec) Validate() error {
+	d, err := time.ParseDuration(spec.Delay)
+	if err != nil {
+		return fmt.Errorf("invalid delay %s: %v", spec.Delay, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("delay must be positive")
+	}
+	return nil
+}
+
+func newHedging(spec *HedgingSpec) *hedging {
+	h := &hedging{
+		maxAttempts: spec.MaxAttempts,
+		methods:     spec.Methods,
+	}
+	h.delay, _ = time.ParseDuration(spec.Delay)
+	if h.maxAttempts == 0 {
+		h.maxAttempts = 2
+	}
+	if len(h.methods) == 0 {
+		h.methods = []string{http.MethodGet, http.MethodHead}
+	}
+	return h
+}
+
+// match returns whether the request could be hedged, stream requests are
+// never hedged as their bodies can only be read once.
+func (h *hedging) match(spCtx *serverPoolContext) bool {
+	return !spCtx.req.IsStream() && stringtool.StrInSlice(spCtx.req.Method(), h.methods)
+}
+
+// discard releases the resources of the attempt.
+func (a *upstreamAttempt) discard() {
+	a.cancel()
+	if a.resp != nil {
+		io.Copy(io.Discard, a.resp.Body)
+		a.resp.Body.Close()
+	}
+}
+
+// sendHedgedRequests sends the request and its duplicates, and returns the
+// first attempt which gets a response that isn't a failure. If all the
+// attempts fail, the last one is returned.
+func (sp *ServerPool) sendHedgedRequests(stdctx stdcontext.Context, spCtx *serverPoolContext) (*upstreamAttempt, error) {
+	h := sp.hedging
+	results := make(chan *upstreamAttempt, h.maxAttempts)
+
+	var attempts []*upstreamAttempt
+	launch := func() error {
+		ctx, cancel := stdcontext.WithCancel(stdctx)
+		a, err := sp.prepareAttempt(ctx, spCtx)
+		if err != nil {
+			cancel()
+			return err
+		}
+		a.cancel = cancel
+		attempts = append(attempts, a)
+		go func() {
+			sp.sendAttempt(a)
+			results <- a
+		}()
+		return nil
+	}
+
+	if err := launch(); err != nil {
+		return nil, err
+	}
+	launched, pending := 1, 1
+
+	timer := time.NewTimer(h.delay)
+	defer timer.Stop()
+
+	var last *upstreamAttempt
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if launched >= h.maxAttempts {
+				break
+			}
+			if sp.retryBudget != nil && !sp.retryBudget.allowRetry() {
+				break
+			}
+			if launch() == nil {
+				launched++
+				pending++
+			}
+			timer.Reset(h.delay)
+
+		case a := <-results:
+			pending--
+			if a.err == nil && !sp.inFailureCodes(a.resp.StatusCode) {
+				if last != nil {
+					last.discard()
+				}
+				// cancel the other attempts and discard them in
+				// background, note that the context of the winner
+				// is canceled along with stdctx as the response body
+				// may be read after this function returns.
+				for _, other := range attempts {
+					if other != a {
+						other.cancel()
+					}
+				}
+				go func(pending int) {
+					for i := 0; i < pending; i++ {
+						(<-results).discard()
+					}
+				}(pending)
+				if launched > 1 {
+					spCtx.AddTag(fmt.Sprintf("hedged requests: %d", launched-1))
+				}
+				return a, nil
+			}
+			if last != nil {
+				last.discard()
+			}
+			last = a
+		}
+	}
+
+	if launched > 1 {
+		spCtx.AddTag(fmt.Sprintf("hedged requests: %d", launched-1))
+	}
+	return last, nil
+}
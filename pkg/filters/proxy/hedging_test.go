@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+func TestHedgingSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&HedgingSpec{Delay: "10ms"}).Validate())
+	assert.Error((&HedgingSpec{}).Validate())
+	assert.Error((&HedgingSpec{Delay: "0s"}).Validate())
+}
+
+func TestHedging(t *testing.T) {
+	assert := assert.New(t)
+
+	// slow is the host of the slow server, or "*" for all servers.
+	var sent, canceled int32
+	var slow atomic.Value
+	slow.Store("127.0.0.1:9095")
+	fnSendRequest0 := fnSendRequest
+	defer func() {
+		fnSendRequest = fnSendRequest0
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		atomic.AddInt32(&sent, 1)
+		if host := slow.Load().(string); host == r.URL.Host || host == "*" {
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&canceled, 1)
+				return nil, r.Context().Err()
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		rw := httptest.NewRecorder()
+		rw.WriteString(r.URL.Host)
+		return rw.Result(), nil
+	}
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9096
+  loadBalance:
+    policy: roundRobin
+  hedging:
+    delay: 20ms
+`, assert)
+	defer proxy.Close()
+
+	// the hedged request to the second server wins.
+	start := time.Now()
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8080", nil)
+	ctx := getCtx(stdr)
+	assert.Equal("", proxy.Handle(ctx))
+	assert.Less(time.Since(start), 150*time.Millisecond)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("127.0.0.1:9096", string(resp.RawPayload()))
+	assert.Equal(int32(2), atomic.LoadInt32(&sent))
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&canceled) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(ctx.Tags(), "hedged requests: 1")
+
+	// no hedging if the response is in time.
+	slow.Store("")
+	stdr, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1:8080", nil)
+	ctx = getCtx(stdr)
+	assert.Equal("", proxy.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("127.0.0.1:9095", string(resp.RawPayload()))
+	assert.Equal(int32(3), atomic.LoadInt32(&sent))
+
+	// methods not in the list are not hedged.
+	slow.Store("*")
+	start = time.Now()
+	stdr, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1:8080", nil)
+	ctx = getCtx(stdr)
+	assert.Equal("", proxy.Handle(ctx))
+	assert.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("127.0.0.1:9096", string(resp.RawPayload()))
+	assert.Equal(int32(4), atomic.LoadInt32(&sent))
+}
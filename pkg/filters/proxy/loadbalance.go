@@ -20,24 +20,46 @@ package proxy
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
 	"math/rand"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/loadbalance"
 )
 
 const (
 	// LoadBalancePolicyRoundRobin is the load balance policy of round robin.
-	LoadBalancePolicyRoundRobin = "roundRobin"
+	LoadBalancePolicyRoundRobin = loadbalance.PolicyRoundRobin
 	// LoadBalancePolicyRandom is the load balance policy of random.
-	LoadBalancePolicyRandom = "random"
+	LoadBalancePolicyRandom = loadbalance.PolicyRandom
 	// LoadBalancePolicyWeightedRandom is the load balance policy of weighted random.
-	LoadBalancePolicyWeightedRandom = "weightedRandom"
+	LoadBalancePolicyWeightedRandom = loadbalance.PolicyWeightedRandom
 	// LoadBalancePolicyIPHash is the load balance policy of IP hash.
-	LoadBalancePolicyIPHash = "ipHash"
+	LoadBalancePolicyIPHash = loadbalance.PolicyIPHash
 	// LoadBalancePolicyHeaderHash is the load balance policy of HTTP header hash.
-	LoadBalancePolicyHeaderHash = "headerHash"
+	LoadBalancePolicyHeaderHash = loadbalance.PolicyHeaderHash
+	// LoadBalancePolicyWeightedRoundRobin is the load balance policy of
+	// weighted round robin.
+	LoadBalancePolicyWeightedRoundRobin = "weightedRoundRobin"
+	// LoadBalancePolicyLeastConnections is the load balance policy of
+	// least connections.
+	LoadBalancePolicyLeastConnections = loadbalance.PolicyLeastConnections
+	// LoadBalancePolicyEWMA is the load balance policy of exponentially
+	// weighted moving average latency.
+	LoadBalancePolicyEWMA = "ewma"
+)
+
+const (
+	// ewmaDecay is the time constant of the EWMA latency, a sample
+	// contributes 1/e of its weight after this duration.
+	ewmaDecay = 10 * time.Second
+	// ewmaFailurePenalty is the minimum latency sample of failed requests,
+	// so that failing servers are not preferred for failing fast.
+	ewmaFailurePenalty = time.Second
 )
 
 // LoadBalancer is the interface of an HTTP load balancer.
@@ -45,14 +67,50 @@ type LoadBalancer interface {
 	ChooseServer(req *httpprot.Request) *Server
 }
 
+// FeedbackLoadBalancer is a LoadBalancer which chooses servers by the
+// results of the previous requests, every server returned by ChooseServer
+// must be returned by ReturnServer after the response header is received
+// or the request failed.
+type FeedbackLoadBalancer interface {
+	LoadBalancer
+	ReturnServer(server *Server, latency time.Duration, err error)
+}
+
 // LoadBalanceSpec is the spec to create a load balancer.
 type LoadBalanceSpec struct {
-	Policy        string `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
+	Policy        string `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash,enum=weightedRoundRobin,enum=leastConnections,enum=ewma"`
 	HeaderHashKey string `json:"headerHashKey" jsonschema:"omitempty"`
+
+	// StickySession pins the clients to the servers, the policy is used
+	// to choose the servers of new clients.
+	StickySession *StickySessionSpec `json:"stickySession,omitempty" jsonschema:"omitempty"`
+}
+
+// Validate validates LoadBalanceSpec.
+func (s *LoadBalanceSpec) Validate() error {
+	if s.StickySession == nil {
+		return nil
+	}
+	switch s.Policy {
+	case LoadBalancePolicyLeastConnections, LoadBalancePolicyEWMA:
+		return fmt.Errorf("stickySession can't be used with policy %s", s.Policy)
+	}
+	return nil
 }
 
 // NewLoadBalancer creates a load balancer for servers according to spec.
 func NewLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
+	return newLoadBalancer(spec, servers, servers)
+}
+
+// newLoadBalancer creates a load balancer, all is all the servers, and
+// healthy is the servers which are not ejected by the outlier detection.
+func newLoadBalancer(spec *LoadBalanceSpec, all, healthy []*Server) LoadBalancer {
+	if spec.StickySession != nil {
+		return newStickySessionLoadBalancer(spec, all, healthy)
+	}
+
+	servers := healthy
 	switch spec.Policy {
 	case LoadBalancePolicyRoundRobin, "":
 		return newRoundRobinLoadBalancer(servers)
@@ -64,8 +122,14 @@ func NewLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
 		return newIPHashLoadBalancer(servers)
 	case LoadBalancePolicyHeaderHash:
 		return newHeaderHashLoadBalancer(servers, spec.HeaderHashKey)
+	case LoadBalancePolicyWeightedRoundRobin:
+		return newWeightedRoundRobinLoadBalancer(servers)
+	case LoadBalancePolicyLeastConnections:
+		return newLeastConnectionsLoadBalancer(servers)
+	case LoadBalancePolicyEWMA:
+		return newEWMALoadBalancer(servers)
 	default:
-		logger.Errorf("unsupported load balancing policy: %s", spec.Policy)
+		logger.Proxy.Errorf("unsupported load balancing policy: %s", spec.Policy)
 		return newRoundRobinLoadBalancer(servers)
 	}
 }
@@ -203,3 +267,189 @@ func (lb *headerHashLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
 	hash.Write([]byte(v))
 	return lb.Servers[hash.Sum32()%uint32(len(lb.Servers))]
 }
+
+// weightedRoundRobinLoadBalancer does load balancing in the smooth
+// weighted round robin manner of nginx, servers are chosen in proportion
+// to their weights, and are interleaved instead of in bursts.
+type weightedRoundRobinLoadBalancer struct {
+	BaseLoadBalancer
+	lock           sync.Mutex
+	weights        []int
+	currentWeights []int
+	totalWeight    int
+}
+
+func newWeightedRoundRobinLoadBalancer(servers []*Server) *weightedRoundRobinLoadBalancer {
+	lb := &weightedRoundRobinLoadBalancer{
+		BaseLoadBalancer: BaseLoadBalancer{
+			Servers: servers,
+		},
+		weights:        make([]int, len(servers)),
+		currentWeights: make([]int, len(servers)),
+	}
+	for i, server := range servers {
+		// servers without weight are treated as weight 1.
+		w := server.Weight
+		if w <= 0 {
+			w = 1
+		}
+		lb.weights[i] = w
+		lb.totalWeight += w
+	}
+	return lb
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *weightedRoundRobinLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if len(lb.Servers) == 0 {
+		return nil
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	best := 0
+	for i, w := range lb.weights {
+		lb.currentWeights[i] += w
+		if lb.currentWeights[i] > lb.currentWeights[best] {
+			best = i
+		}
+	}
+	lb.currentWeights[best] -= lb.totalWeight
+	return lb.Servers[best]
+}
+
+// leastConnectionsLoadBalancer chooses the server with the least in-flight
+// requests, the ties are broken in a round robin manner.
+type leastConnectionsLoadBalancer struct {
+	BaseLoadBalancer
+	counter uint64
+	index   map[*Server]int
+	active  []int64
+}
+
+func newLeastConnectionsLoadBalancer(servers []*Server) *leastConnectionsLoadBalancer {
+	lb := &leastConnectionsLoadBalancer{
+		BaseLoadBalancer: BaseLoadBalancer{
+			Servers: servers,
+		},
+		index:  make(map[*Server]int, len(servers)),
+		active: make([]int64, len(servers)),
+	}
+	for i, server := range servers {
+		lb.index[server] = i
+	}
+	return lb
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *leastConnectionsLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if len(lb.Servers) == 0 {
+		return nil
+	}
+
+	start := int(atomic.AddUint64(&lb.counter, 1) % uint64(len(lb.Servers)))
+	best, min := start, int64(math.MaxInt64)
+	for i := range lb.Servers {
+		idx := (start + i) % len(lb.Servers)
+		if n := atomic.LoadInt64(&lb.active[idx]); n < min {
+			best, min = idx, n
+		}
+	}
+	atomic.AddInt64(&lb.active[best], 1)
+	return lb.Servers[best]
+}
+
+// ReturnServer implements the FeedbackLoadBalancer interface.
+func (lb *leastConnectionsLoadBalancer) ReturnServer(server *Server, latency time.Duration, err error) {
+	if idx, ok := lb.index[server]; ok {
+		atomic.AddInt64(&lb.active[idx], -1)
+	}
+}
+
+// ewmaLoadBalancer chooses the server with the lowest cost, which is the
+// peak EWMA of its latency multiplied by the number of its in-flight requests
+// plus one, so that both slow servers and busy servers are avoided.
+// Servers without latency samples are preferred, so that they are probed.
+type ewmaLoadBalancer struct {
+	BaseLoadBalancer
+	lock   sync.Mutex
+	index  map[*Server]int
+	stats  []ewmaStat
+	offset int
+}
+
+type ewmaStat struct {
+	// latency is the EWMA latency in nanoseconds.
+	latency float64
+	// last is the time of the last sample.
+	last   time.Time
+	active int
+}
+
+func newEWMALoadBalancer(servers []*Server) *ewmaLoadBalancer {
+	lb := &ewmaLoadBalancer{
+		BaseLoadBalancer: BaseLoadBalancer{
+			Servers: servers,
+		},
+		index: make(map[*Server]int, len(servers)),
+		stats: make([]ewmaStat, len(servers)),
+	}
+	for i, server := range servers {
+		lb.index[server] = i
+	}
+	return lb
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *ewmaLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if len(lb.Servers) == 0 {
+		return nil
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	// start from a different server every time to break the ties.
+	lb.offset = (lb.offset + 1) % len(lb.Servers)
+	best, min := lb.offset, math.MaxFloat64
+	for i := range lb.Servers {
+		idx := (lb.offset + i) % len(lb.Servers)
+		st := &lb.stats[idx]
+		cost := st.latency * float64(st.active+1)
+		if cost < min {
+			best, min = idx, cost
+		}
+	}
+	lb.stats[best].active++
+	return lb.Servers[best]
+}
+
+// ReturnServer implements the FeedbackLoadBalancer interface.
+func (lb *ewmaLoadBalancer) ReturnServer(server *Server, latency time.Duration, err error) {
+	idx, ok := lb.index[server]
+	if !ok {
+		return
+	}
+	if err != nil && latency < ewmaFailurePenalty {
+		latency = ewmaFailurePenalty
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	st := &lb.stats[idx]
+	st.active--
+	now := time.Now()
+	if st.last.IsZero() || float64(latency) > st.latency {
+		// the latency jumps to the peaks immediately, so that the slow
+		// down of a server is reacted to without delay.
+		st.latency = float64(latency)
+	} else {
+		// the weight of the old value decays by the elapsed time, so that
+		// the recent samples dominate regardless of the request rate.
+		w := math.Exp(-float64(now.Sub(st.last)) / float64(ewmaDecay))
+		st.latency = st.latency*w + float64(latency)*(1-w)
+	}
+	st.last = now
+}
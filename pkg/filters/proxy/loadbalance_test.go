@@ -22,6 +22,7 @@ import (
 	"math/rand"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/stretchr/testify/assert"
@@ -161,3 +162,113 @@ func TestHeaderHashLoadBalancer(t *testing.T) {
 		assert.GreaterOrEqual(counter[i], 1)
 	}
 }
+
+func TestWeightedRoundRobinLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var svrs []*Server
+	lb := NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	assert.Nil(lb.ChooseServer(nil))
+
+	// the sequence is smooth: a, a, b, a, c, a, a for weights 5, 1, 1.
+	svrs = []*Server{{URL: "a", Weight: 5}, {URL: "b", Weight: 1}, {URL: "c", Weight: 1}}
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	var seq []string
+	for i := 0; i < 7; i++ {
+		seq = append(seq, lb.ChooseServer(nil).URL)
+	}
+	assert.Equal([]string{"a", "a", "b", "a", "c", "a", "a"}, seq)
+
+	svrs = prepareServers(10)
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	counter := [10]int{}
+	for i := 0; i < 5500; i++ {
+		counter[lb.ChooseServer(nil).Weight-1]++
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal((i+1)*100, counter[i])
+	}
+
+	// servers without weight are treated equally.
+	svrs = []*Server{{URL: "a"}, {URL: "b"}}
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	assert.Equal("a", lb.ChooseServer(nil).URL)
+	assert.Equal("b", lb.ChooseServer(nil).URL)
+}
+
+func TestLeastConnectionsLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var svrs []*Server
+	lb := NewLoadBalancer(&LoadBalanceSpec{Policy: "leastConnections"}, svrs)
+	assert.Nil(lb.ChooseServer(nil))
+
+	svrs = prepareServers(3)
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "leastConnections"}, svrs)
+	flb := lb.(FeedbackLoadBalancer)
+
+	// every server gets one in-flight request.
+	chosen := map[*Server]bool{}
+	for i := 0; i < 3; i++ {
+		chosen[lb.ChooseServer(nil)] = true
+	}
+	assert.Len(chosen, 3)
+
+	// the returned server has the least connections.
+	flb.ReturnServer(svrs[1], time.Millisecond, nil)
+	assert.Equal(svrs[1], lb.ChooseServer(nil))
+	flb.ReturnServer(svrs[2], time.Millisecond, nil)
+	flb.ReturnServer(svrs[2], time.Millisecond, nil)
+	assert.Equal(svrs[2], lb.ChooseServer(nil))
+
+	// unknown servers are ignored.
+	flb.ReturnServer(&Server{}, time.Millisecond, nil)
+}
+
+func TestEWMALoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var svrs []*Server
+	lb := NewLoadBalancer(&LoadBalanceSpec{Policy: "ewma"}, svrs)
+	assert.Nil(lb.ChooseServer(nil))
+
+	svrs = prepareServers(3)
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "ewma"}, svrs)
+	flb := lb.(FeedbackLoadBalancer)
+
+	// servers without samples are probed first.
+	latencies := map[*Server]time.Duration{
+		svrs[0]: 10 * time.Millisecond,
+		svrs[1]: 100 * time.Millisecond,
+		svrs[2]: 50 * time.Millisecond,
+	}
+	chosen := map[*Server]bool{}
+	for i := 0; i < 3; i++ {
+		svr := lb.ChooseServer(nil)
+		chosen[svr] = true
+		flb.ReturnServer(svr, latencies[svr], nil)
+	}
+	assert.Len(chosen, 3)
+
+	// the fastest server is preferred.
+	for i := 0; i < 10; i++ {
+		svr := lb.ChooseServer(nil)
+		assert.Equal(svrs[0], svr)
+		flb.ReturnServer(svr, latencies[svr], nil)
+	}
+
+	// busy servers are avoided: the cost of svrs[0] with 5 in-flight
+	// requests is higher than svrs[2] without in-flight requests.
+	for i := 0; i < 5; i++ {
+		assert.Equal(svrs[0], lb.ChooseServer(nil))
+	}
+	assert.Equal(svrs[2], lb.ChooseServer(nil))
+	flb.ReturnServer(svrs[2], latencies[svrs[2]], nil)
+
+	// slow down and failures are reacted to immediately.
+	flb.ReturnServer(svrs[0], 200*time.Millisecond, nil)
+	for i := 0; i < 4; i++ {
+		flb.ReturnServer(svrs[0], time.Millisecond, fmt.Errorf("failed"))
+	}
+	assert.Equal(svrs[2], lb.ChooseServer(nil))
+}
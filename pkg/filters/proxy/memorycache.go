@@ -62,7 +62,7 @@ type (
 func NewMemoryCache(spec *MemoryCacheSpec) *MemoryCache {
 	expiration, err := time.ParseDuration(spec.Expiration)
 	if err != nil {
-		logger.Errorf("BUG: parse duration %s failed: %v", spec.Expiration, err)
+		logger.Proxy.Errorf("BUG: parse duration %s failed: %v", spec.Expiration, err)
 		expiration = 10 * time.Second
 	}
 
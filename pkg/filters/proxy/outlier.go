@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConsecutiveFailures = 5
+	defaultBaseEjectionTime    = 30 * time.Second
+	defaultMaxEjectionTime     = 300 * time.Second
+	defaultMaxEjectionPercent  = 50
+)
+
+type (
+	// OutlierDetectionSpec describes the passive health checking of a
+	// server pool, servers are ejected from the pool after consecutive
+	// failures, i.e. 5xx responses or connection errors, and readmitted
+	// after the ejection time, which doubles on every ejection.
+	OutlierDetectionSpec struct {
+		ConsecutiveFailures int    `json:"consecutiveFailures" jsonschema:"omitempty,minimum=1"`
+		BaseEjectionTime    string `json:"baseEjectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionTime     string `json:"maxEjectionTime" jsonschema:"omitempty,format=duration"`
+		MaxEjectionPercent  int    `json:"maxEjectionPercent" jsonschema:"omitempty,minimum=0,maximum=100"`
+	}
+
+	// EjectedServerStatus is the status of an ejected server.
+	EjectedServerStatus struct {
+		URL          string `json:"url"`
+		Ejections    int    `json:"ejections"`
+		EjectedUntil string `json:"ejectedUntil"`
+	}
+
+	// outlierDetector detects the outliers of a server pool.
+	outlierDetector struct {
+		consecutiveFailures int
+		baseEjectionTime    time.Duration
+		maxEjectionTime     time.Duration
+		maxEjectionPercent  int
+		// onChange is called when a server is ejected or readmitted.
+		onChange func()
+
+		lock sync.Mutex
+		// states are keyed by server URLs, so that they are kept when
+		// the servers are updated by service discovery.
+		states  map[string]*outlierState
+		current map[string]struct{}
+		closed  bool
+	}
+
+	outlierState struct {
+		failures int
+		// ejections is the number of ejections in a row, which is reset
+		// if the server keeps healthy for the max ejection time.
+		ejections    int
+		ejectedUntil time.Time
+		timer        *time.Timer
+	}
+)
+
+// Validate validates OutlierDetectionSpec.
+func (s *OutlierDetectionSpec) Validate() error {
+	base, max := defaultBaseEjectionTime, defaultMaxEjectionTime
+	var err error
+	if s.BaseEjectionTime != "" {
+		if base, err = time.ParseDuration(s.BaseEjectionTime); err != nil || base <= 0 {
+			return fmt.Errorf("invalid baseEjectionTime %s", s.BaseEjectionTime)
+		}
+	}
+	if s.MaxEjectionTime != "" {
+		if max, err = time.ParseDuration(s.MaxEjectionTime); err != nil || max <= 0 {
+			return fmt.Errorf("invalid maxEjectionTime %s", s.MaxEjectionTime)
+		}
+	}
+	if base > max {
+		return fmt.Errorf("baseEjectionTime must not be greater than maxEjectionTime")
+	}
+	return nil
+}
+
+func newOutlierDetector(spec *OutlierDetectionSpec, onChange func()) *outlierDetector {
+	od := &outlierDetector{
+		consecutiveFailures: spec.ConsecutiveFailures,
+		baseEjectionTime:    defaultBaseEjectionTime,
+		maxEjectionTime:     defaultMaxEjectionTime,
+		maxEjectionPercent:  spec.MaxEjectionPercent,
+		onChange:            onChange,
+		states:              map[string]*outlierState{},
+		current:             map[string]struct{}{},
+	}
+	if od.consecutiveFailures == 0 {
+		od.consecutiveFailures = defaultConsecutiveFailures
+	}
+	if od.maxEjectionPercent == 0 {
+		od.maxEjectionPercent = defaultMaxEjectionPercent
+	}
+	if spec.BaseEjectionTime != "" {
+		od.baseEjectionTime, _ = time.ParseDuration(spec.BaseEjectionTime)
+	}
+	if spec.MaxEjectionTime != "" {
+		od.maxEjectionTime, _ = time.ParseDuration(spec.MaxEjectionTime)
+	}
+	return od
+}
+
+func (st *outlierState) ejected(now time.Time) bool {
+	return now.Before(st.ejectedUntil)
+}
+
+// healthy updates the current servers, and returns the servers which are
+// not ejected.
+func (od *outlierDetector) healthy(servers []*Server) []*Server {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	now := time.Now()
+	od.current = make(map[string]struct{}, len(servers))
+	result := make([]*Server, 0, len(servers))
+	for _, svr := range servers {
+		od.current[svr.URL] = struct{}{}
+		if st := od.states[svr.URL]; st != nil && st.ejected(now) {
+			continue
+		}
+		result = append(result, svr)
+	}
+
+	// all servers may be ejected if the servers are updated, use them
+	// anyway instead of failing all requests.
+	if len(result) == 0 {
+		return servers
+	}
+	return result
+}
+
+// canEject returns whether one more server can be ejected, at least one
+// server could be ejected regardless of the max ejection percent, but
+// the last server is never ejected.
+func (od *outlierDetector) canEject(now time.Time) bool {
+	ejected := 0
+	for url := range od.current {
+		if st := od.states[url]; st != nil && st.ejected(now) {
+			ejected++
+		}
+	}
+
+	allowed := len(od.current) * od.maxEjectionPercent / 100
+	if allowed < 1 {
+		allowed = 1
+	}
+	return ejected < allowed && ejected+1 < len(od.current)
+}
+
+// report reports the result of a request to the server.
+func (od *outlierDetector) report(svr *Server, failed bool) {
+	od.lock.Lock()
+
+	if od.closed {
+		od.lock.Unlock()
+		return
+	}
+	if _, ok := od.current[svr.URL]; !ok {
+		od.lock.Unlock()
+		return
+	}
+
+	now := time.Now()
+	st := od.states[svr.URL]
+	if st == nil {
+		st = &outlierState{}
+		od.states[svr.URL] = st
+	}
+
+	// the results of the requests sent before the ejection are ignored.
+	if st.ejected(now) {
+		od.lock.Unlock()
+		return
+	}
+
+	if !failed {
+		st.failures = 0
+		if st.ejections > 0 && now.Sub(st.ejectedUntil) > od.maxEjectionTime {
+			st.ejections = 0
+		}
+		od.lock.Unlock()
+		return
+	}
+
+	st.failures++
+	if st.failures < od.consecutiveFailures || !od.canEject(now) {
+		od.lock.Unlock()
+		return
+	}
+
+	// eject the server with exponential back-off.
+	st.failures = 0
+	st.ejections++
+	d := od.maxEjectionTime
+	if st.ejections <= 31 {
+		if backoff := od.baseEjectionTime << (st.ejections - 1); backoff > 0 && backoff < d {
+			d = backoff
+		}
+	}
+	st.ejectedUntil = now.Add(d)
+	st.timer = time.AfterFunc(d, od.onChange)
+	od.lock.Unlock()
+
+	od.onChange()
+}
+
+// status returns the status of the ejected servers.
+func (od *outlierDetector) status() []*EjectedServerStatus {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	var result []*EjectedServerStatus
+	now := time.Now()
+	for url := range od.current {
+		st := od.states[url]
+		if st == nil || !st.ejected(now) {
+			continue
+		}
+		result = append(result, &EjectedServerStatus{
+			URL:          url,
+			Ejections:    st.ejections,
+			EjectedUntil: st.ejectedUntil.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].URL < result[j].URL
+	})
+	return result
+}
+
+func (od *outlierDetector) close() {
+	od.lock.Lock()
+	defer od.lock.Unlock()
+
+	od.closed = true
+	for _, st := range od.states {
+		if st.timer != nil {
+			st.timer.Stop()
+		}
+	}
+}
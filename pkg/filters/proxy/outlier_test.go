@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlierDetectionSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&OutlierDetectionSpec{}).Validate())
+	assert.NoError((&OutlierDetectionSpec{BaseEjectionTime: "1s", MaxEjectionTime: "10s"}).Validate())
+	assert.Error((&OutlierDetectionSpec{BaseEjectionTime: "invalid"}).Validate())
+	assert.Error((&OutlierDetectionSpec{MaxEjectionTime: "-1s"}).Validate())
+	assert.Error((&OutlierDetectionSpec{BaseEjectionTime: "10s", MaxEjectionTime: "1s"}).Validate())
+}
+
+func TestOutlierDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	changes := 0
+	od := newOutlierDetector(&OutlierDetectionSpec{
+		ConsecutiveFailures: 3,
+		BaseEjectionTime:    "1h",
+		MaxEjectionTime:     "3h",
+	}, func() { changes++ })
+	defer od.close()
+
+	servers := []*Server{{URL: "http://a"}, {URL: "http://b"}, {URL: "http://c"}, {URL: "http://d"}}
+	assert.Len(od.healthy(servers), 4)
+
+	// consecutive failures are required.
+	od.report(servers[0], true)
+	od.report(servers[0], true)
+	od.report(servers[0], false)
+	od.report(servers[0], true)
+	od.report(servers[0], true)
+	assert.Len(od.healthy(servers), 4)
+	od.report(servers[0], true)
+	assert.Equal(1, changes)
+	assert.Equal([]*Server{servers[1], servers[2], servers[3]}, od.healthy(servers))
+
+	status := od.status()
+	assert.Len(status, 1)
+	assert.Equal("http://a", status[0].URL)
+	assert.Equal(1, status[0].Ejections)
+
+	// results of the ejected server are ignored.
+	od.report(servers[0], false)
+	assert.Len(od.healthy(servers), 3)
+
+	// at most 50% of the servers are ejected.
+	for i := 0; i < 3; i++ {
+		od.report(servers[1], true)
+		od.report(servers[2], true)
+	}
+	assert.Len(od.healthy(servers), 2)
+	assert.Equal(2, changes)
+
+	// unknown servers are ignored.
+	od.report(&Server{URL: "http://unknown"}, true)
+
+	// the ejection time doubles, and is capped by the max ejection time.
+	st := od.states["http://a"]
+	now := time.Now()
+	st.ejectedUntil = now
+	st.timer.Stop()
+	for i := 0; i < 3; i++ {
+		od.report(servers[0], true)
+	}
+	assert.Equal(2, st.ejections)
+	assert.InDelta(float64(2*time.Hour), float64(st.ejectedUntil.Sub(now)), float64(time.Minute))
+
+	st.ejectedUntil = now
+	st.timer.Stop()
+	for i := 0; i < 3; i++ {
+		od.report(servers[0], true)
+	}
+	assert.Equal(3, st.ejections)
+	assert.InDelta(float64(3*time.Hour), float64(st.ejectedUntil.Sub(now)), float64(time.Minute))
+
+	// the ejections are reset if keeping healthy for the max ejection time.
+	st.ejectedUntil = now.Add(-4 * time.Hour)
+	st.timer.Stop()
+	od.report(servers[0], false)
+	assert.Equal(0, st.ejections)
+
+	// the last server is never ejected.
+	single := []*Server{{URL: "http://a"}}
+	od.healthy(single)
+	for i := 0; i < 3; i++ {
+		od.report(single[0], true)
+	}
+	assert.Len(od.healthy(single), 1)
+}
+
+func TestServerPoolOutlierDetection(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9096
+  outlierDetection:
+    consecutiveFailures: 2
+    baseEjectionTime: 50ms
+`, assert)
+	defer proxy.Close()
+	sp := proxy.mainPool
+
+	svr := sp.servers[0]
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+
+	// canceled requests are not failures.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := stdr.WithContext(ctx)
+	for i := 0; i < 2; i++ {
+		sp.reportOutlier(svr, canceled, nil, context.Canceled)
+	}
+	assert.Nil(sp.status().EjectedServers)
+
+	sp.reportOutlier(svr, stdr, nil, fmt.Errorf("connection refused"))
+	sp.reportOutlier(svr, stdr, &http.Response{StatusCode: http.StatusBadGateway}, nil)
+	assert.Len(sp.status().EjectedServers, 1)
+	for i := 0; i < 10; i++ {
+		assert.NotEqual(svr, sp.LoadBalancer().ChooseServer(nil))
+	}
+
+	// the server is readmitted after the ejection time.
+	assert.Eventually(func() bool {
+		lb := sp.LoadBalancer()
+		return lb.ChooseServer(nil) == svr || lb.ChooseServer(nil) == svr
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(sp.status().EjectedServers)
+}
@@ -19,9 +19,12 @@ package proxy
 
 import (
 	stdcontext "context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/textproto"
 	"strings"
 	"sync"
@@ -32,13 +35,16 @@ import (
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/canarycontroller"
 	"github.com/megaease/easegress/pkg/object/serviceregistry"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
 	"github.com/megaease/easegress/pkg/util/readers"
+	"github.com/megaease/easegress/pkg/util/spectemplate"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
 
@@ -77,6 +83,9 @@ type serverPoolContext struct {
 	stdResp *http.Response
 
 	respCallbackBody *readers.CallbackReader
+
+	// host is the template of the Host header of the server pool.
+	host *spectemplate.Template
 }
 
 // Hop-by-hop headers. These are removed when sent to the backend.
@@ -148,11 +157,27 @@ func (spCtx *serverPoolContext) prepareRequest(svr *Server, ctx stdcontext.Conte
 
 	// only set host when server address is not host name OR
 	// server is explicitly told to keep the host of the request.
-	if !svr.addrIsHostName || svr.KeepHost {
+	// For servers resolved by DNS, the host name before resolving
+	// is used.
+	switch {
+	case svr.KeepHost:
+		stdr.Host = req.Host()
+	case svr.hostName != "":
+		stdr.Host = svr.hostName
+	case !svr.addrIsHostName:
 		stdr.Host = req.Host()
 	}
 
+	// the host template of the server pool overrides the above, but an
+	// empty result, e.g. a missing header, keeps the default.
+	if spCtx.host != nil {
+		if host := spCtx.host.Render(req, spectemplate.EscapeHost); host != "" {
+			stdr.Host = host
+		}
+	}
+
 	if spCtx.span != nil {
+		spCtx.span.TagFromContext(tracing.AttributeUpstream, svr.URL)
 		spCtx.span.InjectHTTP(stdr)
 	}
 
@@ -168,31 +193,60 @@ type ServerPool struct {
 	wg           sync.WaitGroup
 	name         string
 	failureCodes map[int]struct{}
+	host         *spectemplate.Template
 
 	filter                RequestMatcher
+	canary                string
 	loadBalancer          atomic.Value
 	timeout               time.Duration
 	retryWrapper          resilience.Wrapper
 	circuitBreakerWrapper resilience.Wrapper
+	circuitBreaker        *resilience.CircuitBreakerWrapper
 
 	httpStat    *httpstat.HTTPStat
 	memoryCache *MemoryCache
+
+	// serversLock protects servers, which are all the servers of the
+	// pool, including the ejected ones.
+	serversLock     sync.Mutex
+	servers         []*Server
+	outlierDetector *outlierDetector
+	healthChecker   *healthChecker
+	client          *http.Client
+	// sendRequest sends the requests to the servers, it is fnSendRequest
+	// at the time the pool is created.
+	sendRequest func(r *http.Request, client *http.Client) (*http.Response, error)
+
+	retryBudget *retryBudget
+	hedging     *hedging
+	sseStat     sseStat
 }
 
 // ServerPoolSpec is the spec for a server pool.
 type ServerPoolSpec struct {
-	SpanName             string              `json:"spanName" jsonschema:"omitempty"`
-	Filter               *RequestMatcherSpec `json:"filter" jsonschema:"omitempty"`
-	ServerMaxBodySize    int64               `json:"serverMaxBodySize" jsonschema:"omitempty"`
-	ServerTags           []string            `json:"serverTags" jsonschema:"omitempty,uniqueItems=true"`
-	Servers              []*Server           `json:"servers" jsonschema:"omitempty"`
-	ServiceRegistry      string              `json:"serviceRegistry" jsonschema:"omitempty"`
-	ServiceName          string              `json:"serviceName" jsonschema:"omitempty"`
-	LoadBalance          *LoadBalanceSpec    `json:"loadBalance" jsonschema:"omitempty"`
-	Timeout              string              `json:"timeout" jsonschema:"omitempty,format=duration"`
-	RetryPolicy          string              `json:"retryPolicy" jsonschema:"omitempty"`
-	CircuitBreakerPolicy string              `json:"circuitBreakerPolicy" jsonschema:"omitempty"`
-	MemoryCache          *MemoryCacheSpec    `json:"memoryCache,omitempty" jsonschema:"omitempty"`
+	SpanName             string                `json:"spanName" jsonschema:"omitempty"`
+	Filter               *RequestMatcherSpec   `json:"filter" jsonschema:"omitempty"`
+	ServerMaxBodySize    int64                 `json:"serverMaxBodySize" jsonschema:"omitempty"`
+	ServerTags           []string              `json:"serverTags" jsonschema:"omitempty,uniqueItems=true"`
+	Servers              []*Server             `json:"servers" jsonschema:"omitempty"`
+	ServiceRegistry      string                `json:"serviceRegistry" jsonschema:"omitempty"`
+	ServiceName          string                `json:"serviceName" jsonschema:"omitempty"`
+	ResolveInterval      string                `json:"resolveInterval" jsonschema:"omitempty,format=duration"`
+	LoadBalance          *LoadBalanceSpec      `json:"loadBalance" jsonschema:"omitempty"`
+	Timeout              string                `json:"timeout" jsonschema:"omitempty,format=duration"`
+	RetryPolicy          string                `json:"retryPolicy" jsonschema:"omitempty"`
+	CircuitBreakerPolicy string                `json:"circuitBreakerPolicy" jsonschema:"omitempty"`
+	MemoryCache          *MemoryCacheSpec      `json:"memoryCache,omitempty" jsonschema:"omitempty"`
+	OutlierDetection     *OutlierDetectionSpec `json:"outlierDetection,omitempty" jsonschema:"omitempty"`
+	HealthCheck          *HealthCheckSpec      `json:"healthCheck,omitempty" jsonschema:"omitempty"`
+	Transport            *TransportSpec        `json:"transport,omitempty" jsonschema:"omitempty"`
+	RetryBudget          *RetryBudgetSpec      `json:"retryBudget,omitempty" jsonschema:"omitempty"`
+	Hedging              *HedgingSpec          `json:"hedging,omitempty" jsonschema:"omitempty"`
+
+	// Host is the Host header of the requests to the servers, it supports
+	// the request templates like ${req.header.X-Host}, and overrides the
+	// keepHost of the servers.
+	Host string `json:"host" jsonschema:"omitempty"`
 
 	// FailureCodes would be 5xx if it isn't assigned any value.
 	FailureCodes []int `json:"failureCodes" jsonschema:"omitempty,uniqueItems=true"`
@@ -200,7 +254,15 @@ type ServerPoolSpec struct {
 
 // ServerPoolStatus is the status of Pool.
 type ServerPoolStatus struct {
-	Stat *httpstat.Status `json:"stat"`
+	Stat           *httpstat.Status       `json:"stat"`
+	EjectedServers []*EjectedServerStatus `json:"ejectedServers,omitempty"`
+	SSE            *SSEStatus             `json:"sse,omitempty"`
+
+	// UnhealthyServers are the URLs of the servers failing the health
+	// checks.
+	UnhealthyServers []string `json:"unhealthyServers,omitempty"`
+
+	CircuitBreaker *resilience.CircuitBreakerStatus `json:"circuitBreaker,omitempty"`
 }
 
 // Validate validates ServerPoolSpec.
@@ -220,6 +282,22 @@ func (sps *ServerPoolSpec) Validate() error {
 		return fmt.Errorf(msgFmt, serversGotWeight, len(sps.Servers))
 	}
 
+	if sps.ResolveInterval != "" {
+		d, err := time.ParseDuration(sps.ResolveInterval)
+		if err != nil {
+			return fmt.Errorf("invalid resolveInterval %s: %v", sps.ResolveInterval, err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("resolveInterval must be at least 1s")
+		}
+	}
+
+	if sps.Host != "" {
+		if _, err := spectemplate.Compile(sps.Host); err != nil {
+			return fmt.Errorf("invalid host: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -231,22 +309,64 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		done:     make(chan struct{}),
 		name:     name,
 		httpStat: httpstat.New(),
+
+		sendRequest: fnSendRequest,
 	}
 
 	if spec.Filter != nil {
 		sp.filter = NewRequestMatcher(spec.Filter)
+		if spec.Filter.Policy == "canary" {
+			sp.canary = spec.Filter.Canary
+		}
+	}
+
+	if spec.Host != "" {
+		sp.host = spectemplate.MustCompile(spec.Host)
 	}
 
 	if spec.MemoryCache != nil {
 		sp.memoryCache = NewMemoryCache(spec.MemoryCache)
 	}
 
+	if spec.OutlierDetection != nil {
+		sp.outlierDetector = newOutlierDetector(spec.OutlierDetection, sp.refreshLoadBalancer)
+	}
+
+	if spec.HealthCheck != nil {
+		var tlsCfg *tls.Config
+		if proxy != nil {
+			tlsCfg, _ = proxy.tlsConfig()
+		}
+		sp.healthChecker = newHealthChecker(spec.HealthCheck, tlsCfg, sp.currentServers, sp.refreshLoadBalancer)
+	}
+
+	if spec.Transport != nil {
+		tlsCfg, _ := proxy.tlsConfig()
+		sp.client = newHTTPClient(proxy.spec, tlsCfg, spec.Transport)
+	}
+
+	if spec.RetryBudget != nil {
+		sp.retryBudget = newRetryBudget(spec.RetryBudget)
+	}
+
+	if spec.Hedging != nil {
+		sp.hedging = newHedging(spec.Hedging)
+	}
+
 	if spec.ServiceRegistry == "" || spec.ServiceName == "" {
 		sp.createLoadBalancer(sp.spec.Servers)
+		if spec.ResolveInterval != "" {
+			interval, _ := time.ParseDuration(spec.ResolveInterval)
+			sp.resolveServers(interval)
+		}
 	} else {
 		sp.watchServers()
 	}
 
+	if sp.healthChecker != nil {
+		sp.healthChecker.start()
+	}
+
 	if spec.Timeout != "" {
 		sp.timeout, _ = time.ParseDuration(spec.Timeout)
 	}
@@ -259,6 +379,15 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 	return sp
 }
 
+// httpClient returns the HTTP client of the server pool, which is the
+// client of the proxy if the pool has no transport settings.
+func (sp *ServerPool) httpClient() *http.Client {
+	if sp.client != nil {
+		return sp.client
+	}
+	return sp.proxy.client
+}
+
 // LoadBalancer returns the load balancer of the server pool.
 func (sp *ServerPool) LoadBalancer() LoadBalancer {
 	return sp.loadBalancer.Load().(LoadBalancer)
@@ -269,12 +398,47 @@ func (sp *ServerPool) createLoadBalancer(servers []*Server) {
 		server.checkAddrPattern()
 	}
 
+	sp.serversLock.Lock()
+	defer sp.serversLock.Unlock()
+
+	sp.servers = servers
+	sp.storeLoadBalancer()
+}
+
+// currentServers returns all the servers of the pool.
+func (sp *ServerPool) currentServers() []*Server {
+	sp.serversLock.Lock()
+	defer sp.serversLock.Unlock()
+
+	return sp.servers
+}
+
+// refreshLoadBalancer recreates the load balancer when the ejection state
+// or the health of the servers changes.
+func (sp *ServerPool) refreshLoadBalancer() {
+	sp.serversLock.Lock()
+	defer sp.serversLock.Unlock()
+
+	sp.storeLoadBalancer()
+}
+
+// storeLoadBalancer creates a load balancer of the servers which are
+// healthy and not ejected, the caller must hold serversLock.
+func (sp *ServerPool) storeLoadBalancer() {
 	spec := sp.spec.LoadBalance
 	if spec == nil {
 		spec = &LoadBalanceSpec{}
 	}
 
-	lb := NewLoadBalancer(spec, servers)
+	healthy := sp.servers
+	if sp.healthChecker != nil {
+		healthy = sp.healthChecker.healthy(healthy)
+	}
+	if sp.outlierDetector != nil {
+		healthy = sp.outlierDetector.healthy(healthy)
+	}
+
+	lb := newLoadBalancer(spec, sp.servers, healthy)
 	sp.loadBalancer.Store(lb)
 }
 
@@ -285,7 +449,7 @@ func (sp *ServerPool) watchServers() {
 	instances, err := registry.ListServiceInstances(sp.spec.ServiceRegistry, sp.spec.ServiceName)
 	if err != nil {
 		msgFmt := "first try to use service %s/%s failed(will try again): %v"
-		logger.Warnf(msgFmt, sp.spec.ServiceRegistry, sp.spec.ServiceName, err)
+		logger.Proxy.Warnf(msgFmt, sp.spec.ServiceRegistry, sp.spec.ServiceName, err)
 		sp.createLoadBalancer(sp.spec.Servers)
 	}
 
@@ -331,7 +495,7 @@ func (sp *ServerPool) useService(instances map[string]*serviceregistry.ServiceIn
 
 	if len(servers) == 0 {
 		msgFmt := "%s/%s: no service instance satisfy tags: %v"
-		logger.Warnf(msgFmt, sp.spec.ServiceRegistry, sp.spec.ServiceName, sp.spec.ServerTags)
+		logger.Proxy.Warnf(msgFmt, sp.spec.ServiceRegistry, sp.spec.ServiceName, sp.spec.ServerTags)
 		servers = sp.spec.Servers
 	}
 
@@ -339,7 +503,16 @@ func (sp *ServerPool) useService(instances map[string]*serviceregistry.ServiceIn
 }
 
 func (sp *ServerPool) status() *ServerPoolStatus {
-	s := &ServerPoolStatus{Stat: sp.httpStat.Status()}
+	s := &ServerPoolStatus{Stat: sp.httpStat.Status(), SSE: sp.sseStat.status()}
+	if sp.outlierDetector != nil {
+		s.EjectedServers = sp.outlierDetector.status()
+	}
+	if sp.healthChecker != nil {
+		s.UnhealthyServers = sp.healthChecker.status()
+	}
+	if sp.circuitBreaker != nil {
+		s.CircuitBreaker = sp.circuitBreaker.Status()
+	}
 	return s
 }
 
@@ -369,6 +542,10 @@ func (sp *ServerPool) InjectResiliencePolicy(policies map[string]resilience.Poli
 			panic(fmt.Errorf("policy %s is not a circuitBreaker policy", name))
 		}
 		sp.circuitBreakerWrapper = policy.CreateWrapper()
+		if cb, ok := sp.circuitBreakerWrapper.(resilience.CircuitBreakerWrapper); ok {
+			sp.circuitBreaker = &cb
+			sp.syncCircuitBreaker(cb, policy.ShareState)
+		}
 	}
 }
 
@@ -383,6 +560,9 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 	collect := func() {
 		metric.Duration = fasttime.Since(spCtx.startTime)
 		sp.httpStat.Stat(metric)
+		if sp.canary != "" {
+			canarycontroller.Observe(sp.canary, sp.inFailureCodes(metric.StatusCode), metric.Duration)
+		}
 		spCtx.LazyAddTag(func() string {
 			return sp.name + "#duration: " + metric.Duration.String()
 		})
@@ -412,36 +592,58 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 	})
 }
 
-func (sp *ServerPool) handleMirror(spCtx *serverPoolContext) {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+// mirror sends a copy of the request to the pool asynchronously, the
+// response is ignored. The copy is prepared before returning so that later
+// filters cannot affect it, and it is not canceled with the original request.
+func (sp *ServerPool) mirror(ctx *context.Context) {
+	spCtx := &serverPoolContext{
+		Context: ctx,
+		req:     ctx.GetInputRequest().(*httpprot.Request),
+		host:    sp.host,
+	}
+
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(spCtx.req)
 	if svr == nil {
 		return
 	}
 
-	err := spCtx.prepareRequest(svr, spCtx.req.Context(), true)
-	if err != nil {
-		logger.Debugf("%s: failed to prepare request: %v", sp.name, err)
-		return
+	timeout := sp.timeout
+	if timeout <= 0 {
+		timeout = defaultMirrorTimeout
 	}
+	stdctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), timeout)
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	err := spCtx.prepareRequest(svr, stdctx, true)
 	if err != nil {
+		cancel()
+		returnServer(lb, svr, 0, err)
+		logger.Proxy.Debugf("%s: failed to prepare request: %v", sp.name, err)
 		return
 	}
 
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
+	go func() {
+		defer cancel()
+
+		start := fasttime.Now()
+		resp, err := sp.sendRequest(spCtx.stdReq, sp.httpClient())
+		returnServer(lb, svr, fasttime.Since(start), err)
+		sp.reportOutlier(svr, spCtx.stdReq, resp, err)
+		if err != nil {
+			logger.Proxy.Debugf("%s: failed to send request: %v", sp.name, err)
+			return
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
 }
 
-func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
+func (sp *ServerPool) handle(ctx *context.Context) string {
 	spCtx := &serverPoolContext{
 		Context: ctx,
 		req:     ctx.GetInputRequest().(*httpprot.Request),
-	}
-
-	if mirror {
-		sp.handleMirror(spCtx)
-		return ""
+		host:    sp.host,
 	}
 
 	spCtx.startTime = fasttime.Now()
@@ -454,9 +656,23 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 		return ""
 	}
 
+	if sp.retryBudget != nil {
+		sp.retryBudget.request()
+	}
+
 	// wrap the handler function to meet the requirement of resilience
 	// wrappers.
+	attempts := 0
+	var lastErr error
 	handler := func(stdctx stdcontext.Context) error {
+		// stop retrying if the retry budget is exhausted, the result
+		// of the last attempt is kept.
+		attempts++
+		if attempts > 1 && sp.retryBudget != nil && !sp.retryBudget.allowRetry() {
+			spCtx.AddTag("retry budget exhausted")
+			return resilience.StopRetry(lastErr)
+		}
+
 		if sp.timeout > 0 {
 			var cancel stdcontext.CancelFunc
 			stdctx, cancel = stdcontext.WithTimeout(stdctx, sp.timeout)
@@ -477,7 +693,12 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 		spCtx.span = ctx.Span().NewChild(spanName)
 		defer spCtx.span.Finish()
 
-		return sp.doHandle(stdctx, spCtx)
+		err := sp.doHandle(stdctx, spCtx)
+		if err != nil {
+			spCtx.span.Tag(tracing.TagError, err.Error())
+		}
+		lastErr = err
+		return err
 	}
 
 	// resilience wrappers, note that it is impossible to retry a stream
@@ -498,7 +719,7 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	// CircuitBreaker is the most outside resiliencer, if the error
 	// is ErrShortCircuited, we are sure the response is nil.
 	if err == resilience.ErrShortCircuited {
-		logger.Debugf("%s: short circuited by circuit break policy", sp.name)
+		logger.Proxy.Debugf("%s: short circuited by circuit break policy", sp.name)
 		spCtx.AddTag("short circuited")
 		sp.buildFailureResponse(spCtx, http.StatusServiceUnavailable)
 		return resultShortCircuited
@@ -517,32 +738,96 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	panic(fmt.Errorf("should not reach here"))
 }
 
-func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) error {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+// returnServer returns the server to the load balancer if it is a
+// FeedbackLoadBalancer.
+func returnServer(lb LoadBalancer, svr *Server, latency time.Duration, err error) {
+	if flb, ok := lb.(FeedbackLoadBalancer); ok {
+		flb.ReturnServer(svr, latency, err)
+	}
+}
+
+// reportOutlier reports the result of a request to the outlier detector,
+// 5xx responses and errors other than the cancellation of the request are
+// failures.
+func (sp *ServerPool) reportOutlier(svr *Server, stdr *http.Request, resp *http.Response, err error) {
+	if sp.outlierDetector == nil {
+		return
+	}
+	if err != nil {
+		if stdr.Context().Err() != stdcontext.Canceled && !errors.Is(err, httpprot.ErrRequestEntityTooLarge) {
+			sp.outlierDetector.report(svr, true)
+		}
+		return
+	}
+	sp.outlierDetector.report(svr, resp.StatusCode >= 500)
+}
+
+// prepareAttempt chooses a server and prepares the request to send.
+func (sp *ServerPool) prepareAttempt(stdctx stdcontext.Context, spCtx *serverPoolContext) (*upstreamAttempt, error) {
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(spCtx.req)
 
 	// if there's no available server.
 	if svr == nil {
-		logger.Debugf("%s: no available server", sp.name)
-		return serverPoolError{http.StatusServiceUnavailable, resultInternalError}
+		logger.Proxy.Debugf("%s: no available server", sp.name)
+		return nil, serverPoolError{http.StatusServiceUnavailable, resultInternalError}
+	}
+
+	if sp.spec.Transport != nil && sp.spec.Transport.ProxyProtocol != "" {
+		stdctx = proxyprotocol.WithHeader(stdctx, proxyprotocol.HeaderOfRequest(spCtx.req.Std()))
 	}
 
-	// prepare the request to send.
 	statResult := &gohttpstat.Result{}
 	stdctx = gohttpstat.WithHTTPStat(stdctx, statResult)
+	stdctx = httptrace.WithClientTrace(stdctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: spCtx.span.MarkFirstByte,
+	})
 	if err := spCtx.prepareRequest(svr, stdctx, false); err != nil {
-		logger.Debugf("%s: failed to prepare request: %v", sp.name, err)
-		return serverPoolError{http.StatusInternalServerError, resultInternalError}
+		returnServer(lb, svr, 0, err)
+		logger.Proxy.Debugf("%s: failed to prepare request: %v", sp.name, err)
+		return nil, serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	return &upstreamAttempt{lb: lb, svr: svr, stdReq: spCtx.stdReq, stat: statResult}, nil
+}
+
+// sendAttempt sends the request of the attempt.
+func (sp *ServerPool) sendAttempt(a *upstreamAttempt) {
+	start := fasttime.Now()
+	a.resp, a.err = sp.sendRequest(a.stdReq, sp.httpClient())
+	returnServer(a.lb, a.svr, fasttime.Since(start), a.err)
+	sp.reportOutlier(a.svr, a.stdReq, a.resp, a.err)
+}
+
+func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) error {
+	var a *upstreamAttempt
+	var err error
+	if sp.hedging != nil && sp.hedging.match(spCtx) {
+		a, err = sp.sendHedgedRequests(stdctx, spCtx)
+	} else if a, err = sp.prepareAttempt(stdctx, spCtx); err == nil {
+		sp.sendAttempt(a)
+	}
 	if err != nil {
-		logger.Debugf("%s: failed to send request: %v", sp.name, err)
+		return err
+	}
 
-		statResult.End(fasttime.Now())
+	spCtx.stdReq = a.stdReq
+	spCtx.SetData(httpprot.UpstreamKey, a.svr.URL)
+	resp, err := a.resp, a.err
+	if err != nil {
+		logger.Proxy.Debugf("%s: failed to send request: %v", sp.name, err)
+
+		a.stat.End(fasttime.Now())
 		spCtx.LazyAddTag(func() string {
-			return fmt.Sprintf("trace %v", statResult)
+			return fmt.Sprintf("trace %v", a.stat)
 		})
 
+		// the body of the request is too large, e.g. it is decompressed
+		// by the Compression filter.
+		if errors.Is(err, httpprot.ErrRequestEntityTooLarge) {
+			return serverPoolError{http.StatusRequestEntityTooLarge, resultClientError}
+		}
+
 		if err := spCtx.stdReq.Context().Err(); err == nil {
 			return serverPoolError{http.StatusServiceUnavailable, resultServerError}
 		} else if err == stdcontext.DeadlineExceeded {
@@ -558,6 +843,9 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 	if err = sp.buildResponse(spCtx); err != nil {
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
+	if slb, ok := a.lb.(SessionLoadBalancer); ok {
+		slb.ReturnResponse(a.svr, spCtx.req, spCtx.resp)
+	}
 
 	spCtx.LazyAddTag(func() string {
 		return fmt.Sprintf("status code: %d", resp.StatusCode)
@@ -602,7 +890,7 @@ func (sp *ServerPool) buildResponse(spCtx *serverPoolContext) (err error) {
 
 	resp, err := httpprot.NewResponse(spCtx.stdResp)
 	if err != nil {
-		logger.Debugf("%s: NewResponse returns an error: %v", sp.name, err)
+		logger.Proxy.Debugf("%s: NewResponse returns an error: %v", sp.name, err)
 		body.Close()
 		return err
 	}
@@ -611,14 +899,21 @@ func (sp *ServerPool) buildResponse(spCtx *serverPoolContext) (err error) {
 	if maxBodySize == 0 {
 		maxBodySize = sp.proxy.spec.ServerMaxBodySize
 	}
+	// stream the response if no one requires the full body, unless the
+	// pool has a memory cache.
+	if maxBodySize == 0 && sp.memoryCache == nil && spCtx.StreamResponse() {
+		maxBodySize = -1
+	}
 	if err = resp.FetchPayload(maxBodySize); err != nil {
-		logger.Debugf("%s: failed to fetch response payload: %v", sp.name, err)
+		logger.Proxy.Debugf("%s: failed to fetch response payload: %v", sp.name, err)
 		body.Close()
 		return err
 	}
 
 	if !resp.IsStream() {
 		body.Close()
+	} else if httpprot.IsEventStream(resp.HTTPHeader()) {
+		sp.sseStat.track(resp, body)
 	}
 
 	if sp.memoryCache != nil {
@@ -714,4 +1009,13 @@ func (sp *ServerPool) inFailureCodes(code int) bool {
 func (sp *ServerPool) close() {
 	close(sp.done)
 	sp.wg.Wait()
+	if sp.healthChecker != nil {
+		sp.healthChecker.close()
+	}
+	if sp.outlierDetector != nil {
+		sp.outlierDetector.close()
+	}
+	if sp.client != nil {
+		sp.client.CloseIdleConnections()
+	}
 }
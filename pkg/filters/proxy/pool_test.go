@@ -18,6 +18,7 @@
 package proxy
 
 import (
+	stdcontext "context"
 	"net/http"
 	"testing"
 
@@ -238,3 +239,32 @@ func TestRemoveHopByHopHeader(t *testing.T) {
 	assert.Equal(1, len(h))
 	assert.Equal("foo-bar", h.Get("X-Foo-Bar"))
 }
+
+func TestServerPoolHost(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ServerPoolSpec{
+		Servers: []*Server{{URL: "http://192.168.1.1"}},
+		Host:    "${req.header}",
+	}
+	assert.Error(spec.Validate())
+
+	spec.Host = "${req.header.X-Tenant}.backend"
+	assert.NoError(spec.Validate())
+
+	sp := NewServerPool(nil, spec, "test")
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	spCtx := &serverPoolContext{req: req, host: sp.host}
+	svr := sp.LoadBalancer().ChooseServer(nil)
+
+	stdr.Header.Set("X-Tenant", "t1/x")
+	assert.NoError(spCtx.prepareRequest(svr, stdcontext.Background(), false))
+	assert.Equal("t1x.backend", spCtx.stdReq.Host)
+
+	spec.Host = "${req.header.X-Missing}"
+	sp = NewServerPool(nil, spec, "test")
+	spCtx.host = sp.host
+	assert.NoError(spCtx.prepareRequest(svr, stdcontext.Background(), false))
+	assert.Equal("megaease.com", spCtx.stdReq.Host)
+}
@@ -22,7 +22,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
-	"net"
+	"math/rand"
 	"net/http"
 	"time"
 
@@ -47,6 +47,10 @@ const (
 	// result for resilience
 	resultTimeout        = "timeout"
 	resultShortCircuited = "shortCircuited"
+
+	// defaultMirrorTimeout is the timeout of the mirrored requests if the
+	// mirror pool has no timeout.
+	defaultMirrorTimeout = 30 * time.Second
 )
 
 var kind = &filters.Kind{
@@ -106,6 +110,7 @@ type (
 
 		Pools               []*ServerPoolSpec `json:"pools" jsonschema:"required"`
 		MirrorPool          *ServerPoolSpec   `json:"mirrorPool,omitempty" jsonschema:"omitempty"`
+		MirrorPercentage    float64           `json:"mirrorPercentage,omitempty" jsonschema:"omitempty,minimum=0,maximum=100"`
 		Compression         *CompressionSpec  `json:"compression,omitempty" jsonschema:"omitempty"`
 		MTLS                *MTLS             `json:"mtls,omitempty" jsonschema:"omitempty"`
 		MaxIdleConns        int               `json:"maxIdleConns" jsonschema:"omitempty"`
@@ -145,8 +150,8 @@ func (s *Spec) Validate() error {
 	}
 
 	if s.MirrorPool != nil {
-		if s.MirrorPool.Filter == nil {
-			return fmt.Errorf("filter of mirrorPool is required")
+		if s.MirrorPool.Filter == nil && s.MirrorPercentage == 0 {
+			return fmt.Errorf("filter of mirrorPool or mirrorPercentage is required")
 		}
 		if s.MirrorPool.MemoryCache != nil {
 			return fmt.Errorf("memoryCache must be empty in mirrorPool")
@@ -192,7 +197,7 @@ func (p *Proxy) tlsConfig() (*tls.Config, error) {
 	keyPem, _ := base64.StdEncoding.DecodeString(mtls.KeyBase64)
 	cert, err := tls.X509KeyPair(certPem, keyPem)
 	if err != nil {
-		logger.Errorf("proxy generates x509 key pair failed: %v", err)
+		logger.Proxy.Errorf("proxy generates x509 key pair failed: %v", err)
 		return &tls.Config{InsecureSkipVerify: true}, err
 	}
 
@@ -235,30 +240,7 @@ func (p *Proxy) reload() {
 	}
 
 	tlsCfg, _ := p.tlsConfig()
-	p.client = &http.Client{
-		// NOTE: Timeout could be no limit, real client or server could cancel it.
-		Timeout: 0,
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 60 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			TLSClientConfig:    tlsCfg,
-			DisableCompression: false,
-			// NOTE: The large number of Idle Connections can
-			// reduce overhead of building connections.
-			MaxIdleConns:          p.spec.MaxIdleConns,
-			MaxIdleConnsPerHost:   p.spec.MaxIdleConnsPerHost,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+	p.client = newHTTPClient(p.spec, tlsCfg, nil)
 }
 
 // Status returns Proxy status.
@@ -291,12 +273,27 @@ func (p *Proxy) Close() {
 	}
 }
 
+// shouldMirror returns whether to mirror the request, which must match the
+// filter of the mirror pool, and be sampled by the mirror percentage.
+func (p *Proxy) shouldMirror(req *httpprot.Request) bool {
+	if p.mirrorPool == nil {
+		return false
+	}
+	if p.mirrorPool.filter != nil && !p.mirrorPool.filter.Match(req) {
+		return false
+	}
+	if pct := p.spec.MirrorPercentage; pct > 0 && pct < 100 {
+		return rand.Float64()*100 < pct
+	}
+	return true
+}
+
 // Handle handles HTTPContext.
 func (p *Proxy) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 
-	if p.mirrorPool != nil && p.mirrorPool.filter.Match(req) {
-		go p.mirrorPool.handle(ctx, true)
+	if p.shouldMirror(req) {
+		p.mirrorPool.mirror(ctx)
 	}
 
 	sp := p.mainPool
@@ -307,7 +304,25 @@ func (p *Proxy) Handle(ctx *context.Context) (result string) {
 		}
 	}
 
-	return sp.handle(ctx, false)
+	return sp.handle(ctx)
+}
+
+// RequiresBody implements filters.BodyRequirer. The request body is
+// required for mirroring, retrying and hedging, which send it more than
+// once, and the response body is required for the memory cache.
+func (p *Proxy) RequiresBody() (request, response bool) {
+	if p.spec.MirrorPool != nil {
+		request = true
+	}
+	for _, spec := range p.spec.Pools {
+		if spec.RetryPolicy != "" || spec.Hedging != nil {
+			request = true
+		}
+		if spec.MemoryCache != nil {
+			response = true
+		}
+	}
+	return
 }
 
 // InjectResiliencePolicy injects resilience policies to the proxy.
@@ -22,6 +22,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -118,14 +119,6 @@ mirrorPool:
 compression:
   minLength: 1024
 `
-	proxy := newTestProxy(yamlConfig, assert)
-	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
-
-	assert.Equal(2, len(proxy.candidatePools))
-	assert.Equal(2, len(proxy.mirrorPool.spec.Servers))
-
-	assert.NotNil(proxy.Status())
-
 	fnSendRequest0 := func(r *http.Request, client *http.Client) (*http.Response, error) {
 		return &http.Response{
 			Header: http.Header{},
@@ -159,6 +152,10 @@ compression:
 	// direct set fnSendRequest to different function will cause data race since we use goroutine
 	// for mirror.
 	var fnKind int32
+	fnSendRequestOrig := fnSendRequest
+	defer func() {
+		fnSendRequest = fnSendRequestOrig
+	}()
 	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
 		kind := atomic.LoadInt32(&fnKind)
 		switch kind {
@@ -174,6 +171,14 @@ compression:
 		return nil, fmt.Errorf("unknown kind")
 	}
 
+	proxy := newTestProxy(yamlConfig, assert)
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+
+	assert.Equal(2, len(proxy.candidatePools))
+	assert.Equal(2, len(proxy.mirrorPool.spec.Servers))
+
+	assert.NotNil(proxy.Status())
+
 	atomic.StoreInt32(&fnKind, 0)
 	{
 		stdr, _ := http.NewRequest(http.MethodGet, "https://www.megaease.com", nil)
@@ -186,6 +191,7 @@ compression:
 		stdr, _ := http.NewRequest(http.MethodGet, "https://www.megaease.com", nil)
 		ctx := getCtx(stdr)
 		assert.Equal("", proxy.Handle(ctx))
+		assert.NotEmpty(ctx.GetData(httpprot.UpstreamKey))
 	}
 
 	{
@@ -313,6 +319,59 @@ mirrorPool:
 	assert.Error(spec.Validate())
 }
 
+func TestMirrorPercentage(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+mirrorPool:
+  servers:
+  - url: http://127.0.0.3:9095
+mirrorPercentage: 30
+`
+	spec := &Spec{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), spec))
+	assert.NoError(spec.Validate())
+
+	proxy := newTestProxy(yamlConfig, assert)
+	defer proxy.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "https://www.megaease.com", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	mirrored := 0
+	for i := 0; i < 10000; i++ {
+		if proxy.shouldMirror(req) {
+			mirrored++
+		}
+	}
+	assert.InDelta(3000, mirrored, 300)
+
+	// all requests matching the filter are mirrored without a percentage.
+	yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+mirrorPool:
+  filter:
+    headers:
+      "X-Mirror":
+        exact: mirror
+  servers:
+  - url: http://127.0.0.3:9095
+`
+	proxy = newTestProxy(yamlConfig, assert)
+	defer proxy.Close()
+	assert.False(proxy.shouldMirror(req))
+	stdr.Header.Set("X-Mirror", "mirror")
+	assert.True(proxy.shouldMirror(req))
+}
+
 func TestTLSConfig(t *testing.T) {
 	assert := assert.New(t)
 
@@ -347,3 +406,90 @@ pools:
 	_, err = proxy.tlsConfig()
 	assert.NoError(err)
 }
+
+func TestStreamResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	fnSendRequest0 := fnSendRequest
+	defer func() {
+		fnSendRequest = fnSendRequest0
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		return &http.Response{
+			Header: http.Header{},
+			Body:   io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+`, assert)
+	defer proxy.Close()
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+
+	request, response := proxy.RequiresBody()
+	assert.False(request)
+	assert.False(response)
+
+	for _, stream := range []bool{false, true} {
+		stdr, _ := http.NewRequest(http.MethodGet, "https://www.megaease.com", nil)
+		ctx := getCtx(stdr)
+		ctx.SetStreamResponse(stream)
+		assert.Equal("", proxy.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(stream, resp.IsStream())
+		ctx.Finish()
+	}
+
+	// the memory cache requires the response body, and the retry policy
+	// requires the request body.
+	proxy2 := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  retryPolicy: retry
+  memoryCache:
+    expiration: 10s
+    maxEntryBytes: 4096
+    codes: [200]
+    methods: [GET]
+`, assert)
+	defer proxy2.Close()
+
+	request, response = proxy2.RequiresBody()
+	assert.True(request)
+	assert.True(response)
+}
+
+func TestRequestEntityTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	fnSendRequest0 := fnSendRequest
+	defer func() {
+		fnSendRequest = fnSendRequest0
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		return nil, &url.Error{Op: r.Method, URL: r.URL.String(), Err: httpprot.ErrRequestEntityTooLarge}
+	}
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+`, assert)
+	defer proxy.Close()
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+
+	stdr, _ := http.NewRequest(http.MethodPost, "https://www.megaease.com", strings.NewReader("body"))
+	ctx := getCtx(stdr)
+	assert.Equal(resultClientError, proxy.Handle(ctx))
+	assert.Equal(http.StatusRequestEntityTooLarge, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/canarycontroller"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
@@ -36,12 +37,15 @@ type RequestMatcher interface {
 
 // RequestMatcherSpec describe RequestMatcher
 type RequestMatcherSpec struct {
-	Policy          string                    `json:"policy" jsonschema:"omitempty,enum=,enum=general,enum=ipHash,enum=headerHash,enum=random"`
+	Policy          string                    `json:"policy" jsonschema:"omitempty,enum=,enum=general,enum=ipHash,enum=headerHash,enum=random,enum=canary"`
 	MatchAllHeaders bool                      `json:"matchAllHeaders" jsonschema:"omitempty"`
 	Headers         map[string]*StringMatcher `json:"headers" jsonschema:"omitempty"`
 	URLs            []*MethodAndURLMatcher    `json:"urls" jsonschema:"omitempty"`
 	Permil          uint32                    `json:"permil" jsonschema:"omitempty,minimum=0,maximum=1000"`
 	HeaderHashKey   string                    `json:"headerHashKey" jsonschema:"omitempty"`
+	// Canary is the name of the CanaryController deciding the percentage
+	// of the requests to match, it is required by the canary policy.
+	Canary string `json:"canary" jsonschema:"omitempty"`
 }
 
 // Validate validtes the RequestMatcherSpec.
@@ -50,6 +54,10 @@ func (s *RequestMatcherSpec) Validate() error {
 		if len(s.Headers) == 0 {
 			return fmt.Errorf("headers is not specified")
 		}
+	} else if s.Policy == "canary" {
+		if s.Canary == "" {
+			return fmt.Errorf("canary is not specified")
+		}
 	} else if s.Permil == 0 {
 		return fmt.Errorf("permil is not specified")
 	}
@@ -93,9 +101,11 @@ func NewRequestMatcher(spec *RequestMatcherSpec) RequestMatcher {
 		}
 	case "random":
 		return &randomMatcher{permill: spec.Permil}
+	case "canary":
+		return &canaryMatcher{name: spec.Canary}
 	}
 
-	logger.Errorf("BUG: unsupported probability policy: %s", spec.Policy)
+	logger.Proxy.Errorf("BUG: unsupported probability policy: %s", spec.Policy)
 	return &ipHashMatcher{permill: spec.Permil}
 }
 
@@ -109,6 +119,17 @@ func (rm randomMatcher) Match(req *httpprot.Request) bool {
 	return rand.Uint32()%1000 < rm.permill
 }
 
+// canaryMatcher implements canary request matcher, the percentage of the
+// requests to match is decided by a CanaryController.
+type canaryMatcher struct {
+	name string
+}
+
+// Match implements protocols.Matcher.
+func (cm canaryMatcher) Match(req *httpprot.Request) bool {
+	return canarycontroller.Match(cm.name)
+}
+
 // headerHashMatcher implements header hash request matcher.
 type headerHashMatcher struct {
 	permill       uint32
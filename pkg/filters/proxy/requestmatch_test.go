@@ -61,6 +61,22 @@ func TestRequestMatcherSpecValidate(t *testing.T) {
 
 	spec.HeaderHashKey = "X-Test"
 	assert.NoError(spec.Validate())
+
+	spec = &RequestMatcherSpec{Policy: "canary"}
+	assert.Error(spec.Validate())
+	spec.Canary = "canary"
+	assert.NoError(spec.Validate())
+}
+
+func TestCanaryMatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	// all requests go to the stable pool without the CanaryController.
+	cm := NewRequestMatcher(&RequestMatcherSpec{
+		Policy: "canary",
+		Canary: "not-exist",
+	})
+	assert.False(cm.Match(nil))
 }
 
 func TestRandomMatcher(t *testing.T) {
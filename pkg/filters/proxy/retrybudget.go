@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const retryBudgetBuckets = 10
+
+type (
+	// RetryBudgetSpec describes the retry budget of a server pool, which
+	// limits the retries to a percentage of the requests in a sliding
+	// window, so that retries don't overload the servers in an outage.
+	RetryBudgetSpec struct {
+		Percent    float64 `json:"percent,omitempty" jsonschema:"omitempty,minimum=0,maximum=100"`
+		MinRetries int     `json:"minRetries,omitempty" jsonschema:"omitempty,minimum=0"`
+		Window     string  `json:"window,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	// retryBudget counts the requests and retries in a sliding window,
+	// which is divided into buckets.
+	retryBudget struct {
+		percent    float64
+		minRetries int
+		width      int64
+
+		lock    sync.Mutex
+		buckets [retryBudgetBuckets]retryBudgetBucket
+	}
+
+	retryBudgetBucket struct {
+		index    int64
+		requests int
+		retries  int
+	}
+)
+
+// Validate validates RetryBudgetSpec.
+func (spec *RetryBudgetSpec) Validate() error {
+	if spec.Window == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(spec.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window %s: %v", spec.Window, err)
+	}
+	if d < retryBudgetBuckets*time.Millisecond {
+		return fmt.Errorf("window %s is too short", spec.Window)
+	}
+	return nil
+}
+
+func newRetryBudget(spec *RetryBudgetSpec) *retryBudget {
+	rb := &retryBudget{
+		percent:    spec.Percent,
+		minRetries: spec.MinRetries,
+	}
+	if rb.percent == 0 {
+		rb.percent = 20
+	}
+	if rb.minRetries == 0 {
+		rb.minRetries = 3
+	}
+
+	window := 10 * time.Second
+	if spec.Window != "" {
+		window, _ = time.ParseDuration(spec.Window)
+	}
+	rb.width = int64(window / retryBudgetBuckets)
+	return rb
+}
+
+// current returns the current bucket and the total requests and retries
+// in the window, buckets out of the window are reset, the caller must hold
+// the lock.
+func (rb *retryBudget) current() (b *retryBudgetBucket, requests, retries int) {
+	index := fasttime.Now().UnixNano() / rb.width
+	for i := range rb.buckets {
+		bucket := &rb.buckets[i]
+		if bucket.index <= index-retryBudgetBuckets {
+			*bucket = retryBudgetBucket{}
+		}
+		requests += bucket.requests
+		retries += bucket.retries
+	}
+
+	b = &rb.buckets[index%retryBudgetBuckets]
+	if b.index != index {
+		requests -= b.requests
+		retries -= b.retries
+		*b = retryBudgetBucket{index: index}
+	}
+	return b, requests, retries
+}
+
+// request records a request.
+func (rb *retryBudget) request() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	b, _, _ := rb.current()
+	b.requests++
+}
+
+// allowRetry returns whether a retry is allowed by the budget, and records
+// the retry if it is allowed.
+func (rb *retryBudget) allowRetry() bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	b, requests, retries := rb.current()
+	limit := int(float64(requests) * rb.percent / 100)
+	if limit < rb.minRetries {
+		limit = rb.minRetries
+	}
+	if retries >= limit {
+		return false
+	}
+
+	b.retries++
+	return true
+}
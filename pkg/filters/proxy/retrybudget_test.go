@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/resilience"
+)
+
+func TestRetryBudgetSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&RetryBudgetSpec{}).Validate())
+	assert.NoError((&RetryBudgetSpec{Window: "1s"}).Validate())
+	assert.Error((&RetryBudgetSpec{Window: "1"}).Validate())
+	assert.Error((&RetryBudgetSpec{Window: "1ms"}).Validate())
+}
+
+func TestRetryBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	rb := newRetryBudget(&RetryBudgetSpec{Percent: 10, MinRetries: 2, Window: "200ms"})
+
+	// min retries are always allowed.
+	assert.True(rb.allowRetry())
+	assert.True(rb.allowRetry())
+	assert.False(rb.allowRetry())
+
+	for i := 0; i < 30; i++ {
+		rb.request()
+	}
+	assert.True(rb.allowRetry())
+	assert.False(rb.allowRetry())
+
+	// the retries and requests are out of the window.
+	time.Sleep(250 * time.Millisecond)
+	assert.True(rb.allowRetry())
+	assert.True(rb.allowRetry())
+	assert.False(rb.allowRetry())
+}
+
+func TestRetryBudgetOfPool(t *testing.T) {
+	assert := assert.New(t)
+
+	var sent int32
+	fnSendRequest0 := fnSendRequest
+	defer func() {
+		fnSendRequest = fnSendRequest0
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		atomic.AddInt32(&sent, 1)
+		rw := httptest.NewRecorder()
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return rw.Result(), nil
+	}
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  retryPolicy: retry
+  retryBudget:
+    percent: 1
+    minRetries: 1
+`, assert)
+	defer proxy.Close()
+	proxy.InjectResiliencePolicy(map[string]resilience.Policy{
+		"retry": &resilience.RetryPolicy{
+			RetryRule: resilience.RetryRule{MaxAttempts: 3, WaitDuration: "1ms"},
+		},
+	})
+
+	// only one retry is allowed by the budget.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8080", nil)
+	ctx := getCtx(stdr)
+	assert.Equal(resultFailureCode, proxy.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+	assert.Equal(int32(2), atomic.LoadInt32(&sent))
+
+	stdr, _ = http.NewRequest(http.MethodGet, "http://127.0.0.1:8080", nil)
+	ctx = getCtx(stdr)
+	assert.Equal(resultFailureCode, proxy.Handle(ctx))
+	assert.Equal(int32(3), atomic.LoadInt32(&sent))
+}
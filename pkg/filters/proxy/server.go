@@ -31,6 +31,9 @@ type Server struct {
 	Weight         int      `json:"weight" jsonschema:"omitempty,minimum=0,maximum=100"`
 	KeepHost       bool     `json:"keepHost" jsonschema:"omitempty,default=false"`
 	addrIsHostName bool
+	// hostName is the host name of the server before it is resolved by
+	// DNS, which is used as the Host header of the requests.
+	hostName string
 }
 
 // String implements the Stringer interface.
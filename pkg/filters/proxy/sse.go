@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/readers"
+)
+
+type (
+	// sseStat is the statistics of the Server-Sent Events streams of a
+	// server pool.
+	sseStat struct {
+		open   int64
+		total  uint64
+		events uint64
+	}
+
+	// SSEStatus is the status of the Server-Sent Events streams.
+	SSEStatus struct {
+		OpenStreams  int64  `json:"openStreams"`
+		TotalStreams uint64 `json:"totalStreams"`
+		Events       uint64 `json:"events"`
+	}
+)
+
+// track counts the events of the stream in resp, and counts the stream as
+// open until body reaches EOF, meets an error or is closed.
+func (ss *sseStat) track(resp *httpprot.Response, body *readers.CallbackReader) {
+	atomic.AddInt64(&ss.open, 1)
+	atomic.AddUint64(&ss.total, 1)
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() { atomic.AddInt64(&ss.open, -1) })
+	}
+	body.OnAfter(func(total int, p []byte, err error) {
+		if err != nil {
+			done()
+		}
+	})
+	body.OnClose(done)
+
+	resp.AddSSEHook(func(event *httpprot.SSEEvent) *httpprot.SSEEvent {
+		atomic.AddUint64(&ss.events, 1)
+		return event
+	})
+}
+
+func (ss *sseStat) status() *SSEStatus {
+	s := &SSEStatus{
+		OpenStreams:  atomic.LoadInt64(&ss.open),
+		TotalStreams: atomic.LoadUint64(&ss.total),
+		Events:       atomic.LoadUint64(&ss.events),
+	}
+	if s.TotalStreams == 0 {
+		return nil
+	}
+	return s
+}
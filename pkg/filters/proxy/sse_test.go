@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+func TestSSEStreaming(t *testing.T) {
+	assert := assert.New(t)
+
+	fnSendRequest0 := fnSendRequest
+	defer func() {
+		fnSendRequest = fnSendRequest0
+	}()
+	fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:          io.NopCloser(strings.NewReader(strings.Repeat("data: x\n\n", 10))),
+			ContentLength: -1,
+		}, nil
+	}
+
+	proxy := newTestProxy(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  serverMaxBodySize: 16
+compression:
+  minLength: 1
+`, assert)
+	defer proxy.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:8080", nil)
+	stdr.Header.Set("Accept-Encoding", "gzip")
+	ctx := getCtx(stdr)
+	assert.Equal("", proxy.Handle(ctx))
+
+	// the stream is neither buffered nor compressed.
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.True(resp.IsStream())
+	assert.Empty(resp.HTTPHeader().Get("Content-Encoding"))
+
+	sse := proxy.Status().(*Status).MainPool.SSE
+	assert.Equal(int64(1), sse.OpenStreams)
+
+	dropped := 0
+	resp.AddSSEHook(func(e *httpprot.SSEEvent) *httpprot.SSEEvent {
+		if dropped < 5 {
+			dropped++
+			return nil
+		}
+		return e
+	})
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.NoError(err)
+	assert.Equal(strings.Repeat("data: x\n\n", 5), string(data))
+
+	sse = proxy.Status().(*Status).MainPool.SSE
+	assert.Equal(int64(0), sse.OpenStreams)
+	assert.Equal(uint64(1), sse.TotalStreams)
+	assert.Equal(uint64(10), sse.Events)
+}
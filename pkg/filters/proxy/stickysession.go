@@ -0,0 +1,318 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// StickySessionModeCookie pins the clients to the servers by the
+	// cookies issued by Easegress.
+	StickySessionModeCookie = "cookie"
+	// StickySessionModeAppCookie pins the clients to the servers by the
+	// consistent hash of a cookie issued by the application.
+	StickySessionModeAppCookie = "appCookie"
+	// StickySessionModeHeader pins the clients to the servers by the
+	// consistent hash of a request header.
+	StickySessionModeHeader = "header"
+
+	// StickySessionFailoverRehash chooses another server if the pinned
+	// server is unhealthy.
+	StickySessionFailoverRehash = "rehash"
+	// StickySessionFailoverFail fails the requests if the pinned server
+	// is unhealthy.
+	StickySessionFailoverFail = "fail"
+
+	defaultStickySessionCookieName = "EG_STICKY_SESSION"
+	// stickySessionReplicas is the number of virtual nodes of a server on
+	// the consistent hash ring.
+	stickySessionReplicas = 100
+)
+
+type (
+	// StickySessionSpec is the spec of sticky sessions.
+	StickySessionSpec struct {
+		Mode string `json:"mode" jsonschema:"required,enum=cookie,enum=appCookie,enum=header"`
+		// CookieName is the name of the cookie issued by Easegress in the
+		// cookie mode, or the cookie of the application in the appCookie
+		// mode.
+		CookieName string `json:"cookieName,omitempty" jsonschema:"omitempty"`
+		// CookieTTL is the max age of the cookie issued by Easegress,
+		// the cookie is a session cookie if it is empty.
+		CookieTTL  string `json:"cookieTTL,omitempty" jsonschema:"omitempty,format=duration"`
+		HeaderName string `json:"headerName,omitempty" jsonschema:"omitempty"`
+		// LoadFactor bounds the load of the servers in the consistent
+		// hash modes, a server is skipped if its in-flight requests
+		// exceed LoadFactor times the average, 0 means no bound.
+		LoadFactor float64 `json:"loadFactor,omitempty" jsonschema:"omitempty,minimum=0"`
+		Failover   string  `json:"failover,omitempty" jsonschema:"omitempty,enum=,enum=rehash,enum=fail"`
+	}
+
+	// SessionLoadBalancer is a LoadBalancer which keeps the sessions of
+	// the clients in the responses, e.g. by cookies.
+	SessionLoadBalancer interface {
+		LoadBalancer
+		ReturnResponse(server *Server, req *httpprot.Request, resp *httpprot.Response)
+	}
+
+	// stickySessionLoadBalancer pins the clients to the servers, and
+	// chooses servers by the fallback load balancer for new clients.
+	stickySessionLoadBalancer struct {
+		spec     *StickySessionSpec
+		fallback LoadBalancer
+		servers  []*Server
+		ids      []string
+		healthy  []bool
+		index    map[*Server]int
+
+		// ring is the sorted hashes of the virtual nodes, and nodes are
+		// the indexes of their servers.
+		ring  []uint32
+		nodes map[uint32]int
+
+		active      []int64
+		totalActive int64
+		numHealthy  int
+		maxAge      int
+	}
+)
+
+// Validate validates StickySessionSpec.
+func (s *StickySessionSpec) Validate() error {
+	switch s.Mode {
+	case StickySessionModeAppCookie:
+		if s.CookieName == "" {
+			return fmt.Errorf("cookieName is required by the appCookie mode")
+		}
+	case StickySessionModeHeader:
+		if s.HeaderName == "" {
+			return fmt.Errorf("headerName is required by the header mode")
+		}
+	}
+	if s.CookieTTL != "" {
+		if _, err := time.ParseDuration(s.CookieTTL); err != nil {
+			return fmt.Errorf("invalid cookieTTL %s: %v", s.CookieTTL, err)
+		}
+	}
+	if s.LoadFactor != 0 && s.LoadFactor < 1 {
+		return fmt.Errorf("loadFactor must be 0 or at least 1")
+	}
+	return nil
+}
+
+func (s *StickySessionSpec) cookieName() string {
+	if s.CookieName == "" {
+		return defaultStickySessionCookieName
+	}
+	return s.CookieName
+}
+
+// serverID returns the ID of a server in the cookies.
+func serverID(s *Server) string {
+	h := fnv.New64a()
+	h.Write([]byte(s.URL))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// hash32 hashes the string for the consistent hash ring, FNV is not used
+// as its outputs of similar strings are not distributed evenly.
+func hash32(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.LittleEndian.Uint32(sum[:4])
+}
+
+// newStickySessionLoadBalancer creates a sticky session load balancer, all
+// is all the servers, and healthy is the servers which are not ejected.
+func newStickySessionLoadBalancer(spec *LoadBalanceSpec, all, healthy []*Server) *stickySessionLoadBalancer {
+	ss := spec.StickySession
+	lb := &stickySessionLoadBalancer{
+		spec:     ss,
+		fallback: newLoadBalancer(&LoadBalanceSpec{Policy: spec.Policy, HeaderHashKey: spec.HeaderHashKey}, healthy, healthy),
+		servers:  all,
+		ids:      make([]string, len(all)),
+		healthy:  make([]bool, len(all)),
+		index:    make(map[*Server]int, len(all)),
+		nodes:    map[uint32]int{},
+		active:   make([]int64, len(all)),
+	}
+	if ss.CookieTTL != "" {
+		d, _ := time.ParseDuration(ss.CookieTTL)
+		lb.maxAge = int(math.Ceil(d.Seconds()))
+	}
+
+	for i, s := range all {
+		lb.index[s] = i
+		lb.ids[i] = serverID(s)
+	}
+	for _, s := range healthy {
+		if i, ok := lb.index[s]; ok {
+			lb.healthy[i] = true
+			lb.numHealthy++
+		}
+	}
+
+	if ss.Mode != StickySessionModeCookie {
+		for i, s := range all {
+			for r := 0; r < stickySessionReplicas; r++ {
+				h := hash32(s.URL + "#" + strconv.Itoa(r))
+				if _, ok := lb.nodes[h]; ok {
+					continue
+				}
+				lb.nodes[h] = i
+				lb.ring = append(lb.ring, h)
+			}
+		}
+		sort.Slice(lb.ring, func(i, j int) bool { return lb.ring[i] < lb.ring[j] })
+	}
+	return lb
+}
+
+// key returns the key to pin the request, it returns an empty string if
+// the request is not pinned yet.
+func (lb *stickySessionLoadBalancer) key(req *httpprot.Request) string {
+	if req == nil {
+		return ""
+	}
+	switch lb.spec.Mode {
+	case StickySessionModeHeader:
+		return req.HTTPHeader().Get(lb.spec.HeaderName)
+	default:
+		c, err := req.Cookie(lb.spec.cookieName())
+		if err != nil {
+			return ""
+		}
+		return c.Value
+	}
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *stickySessionLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if len(lb.servers) == 0 {
+		return nil
+	}
+
+	idx := -1
+	if key := lb.key(req); key != "" {
+		var pinned bool
+		if lb.spec.Mode == StickySessionModeCookie {
+			idx, pinned = lb.chooseByID(key)
+		} else {
+			idx, pinned = lb.chooseByHash(key)
+		}
+		if idx < 0 && pinned && lb.spec.Failover == StickySessionFailoverFail {
+			return nil
+		}
+	}
+
+	if idx < 0 {
+		svr := lb.fallback.ChooseServer(req)
+		if svr == nil {
+			return nil
+		}
+		idx = lb.index[svr]
+	}
+
+	atomic.AddInt64(&lb.active[idx], 1)
+	atomic.AddInt64(&lb.totalActive, 1)
+	return lb.servers[idx]
+}
+
+// chooseByID returns the index of the server of the ID if it is healthy,
+// pinned is false if there's no such server.
+func (lb *stickySessionLoadBalancer) chooseByID(id string) (idx int, pinned bool) {
+	for i := range lb.servers {
+		if lb.ids[i] == id {
+			if lb.healthy[i] {
+				return i, true
+			}
+			return -1, true
+		}
+	}
+	return -1, false
+}
+
+// chooseByHash returns the index of the first server on the ring after
+// the hash of the key which is healthy and not overloaded.
+func (lb *stickySessionLoadBalancer) chooseByHash(key string) (idx int, pinned bool) {
+	if lb.numHealthy == 0 {
+		return -1, true
+	}
+
+	limit := int64(math.MaxInt64)
+	if lb.spec.LoadFactor > 0 {
+		avg := float64(atomic.LoadInt64(&lb.totalActive)+1) / float64(lb.numHealthy)
+		limit = int64(math.Ceil(avg * lb.spec.LoadFactor))
+	}
+
+	h := hash32(key)
+	start := sort.Search(len(lb.ring), func(i int) bool { return lb.ring[i] >= h })
+	for i := 0; i < len(lb.ring); i++ {
+		idx := lb.nodes[lb.ring[(start+i)%len(lb.ring)]]
+		if !lb.healthy[idx] {
+			if i == 0 && lb.spec.Failover == StickySessionFailoverFail {
+				return -1, true
+			}
+			continue
+		}
+		if atomic.LoadInt64(&lb.active[idx]) < limit {
+			return idx, true
+		}
+	}
+	return -1, true
+}
+
+// ReturnServer implements the FeedbackLoadBalancer interface.
+func (lb *stickySessionLoadBalancer) ReturnServer(server *Server, latency time.Duration, err error) {
+	if idx, ok := lb.index[server]; ok {
+		atomic.AddInt64(&lb.active[idx], -1)
+		atomic.AddInt64(&lb.totalActive, -1)
+	}
+}
+
+// ReturnResponse implements the SessionLoadBalancer interface, it issues
+// the cookie of the server if the client is not pinned to it.
+func (lb *stickySessionLoadBalancer) ReturnResponse(server *Server, req *httpprot.Request, resp *httpprot.Response) {
+	if lb.spec.Mode != StickySessionModeCookie {
+		return
+	}
+	idx, ok := lb.index[server]
+	if !ok || lb.key(req) == lb.ids[idx] {
+		return
+	}
+
+	c := &http.Cookie{
+		Name:     lb.spec.cookieName(),
+		Value:    lb.ids[idx],
+		Path:     "/",
+		MaxAge:   lb.maxAge,
+		HttpOnly: true,
+	}
+	resp.HTTPHeader().Add("Set-Cookie", c.String())
+}
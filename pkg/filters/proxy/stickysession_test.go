@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+func prepareURLServers(count int) []*Server {
+	svrs := make([]*Server, 0, count)
+	for i := 0; i < count; i++ {
+		svrs = append(svrs, &Server{URL: fmt.Sprintf("http://192.168.1.%d:8080", i+1)})
+	}
+	return svrs
+}
+
+func newStickyRequest(header, value string) *httpprot.Request {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+	if header != "" {
+		stdr.Header.Set(header, value)
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	return req
+}
+
+func TestStickySessionSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&StickySessionSpec{Mode: "cookie", CookieTTL: "1h"}).Validate())
+	assert.Error((&StickySessionSpec{Mode: "cookie", CookieTTL: "1"}).Validate())
+	assert.Error((&StickySessionSpec{Mode: "appCookie"}).Validate())
+	assert.Error((&StickySessionSpec{Mode: "header"}).Validate())
+	assert.Error((&StickySessionSpec{Mode: "header", HeaderName: "X-User", LoadFactor: 0.5}).Validate())
+
+	assert.NoError((&LoadBalanceSpec{Policy: "leastConnections"}).Validate())
+	assert.Error((&LoadBalanceSpec{Policy: "ewma", StickySession: &StickySessionSpec{}}).Validate())
+}
+
+func TestStickySessionCookie(t *testing.T) {
+	assert := assert.New(t)
+
+	svrs := prepareURLServers(3)
+	spec := &LoadBalanceSpec{StickySession: &StickySessionSpec{Mode: "cookie", CookieTTL: "1h"}}
+	lb := NewLoadBalancer(spec, svrs).(*stickySessionLoadBalancer)
+
+	// a new client gets the cookie of the chosen server.
+	req := newStickyRequest("", "")
+	svr := lb.ChooseServer(req)
+	assert.NotNil(svr)
+	lb.ReturnServer(svr, 0, nil)
+	resp, _ := httpprot.NewResponse(nil)
+	lb.ReturnResponse(svr, req, resp)
+	cookies := resp.Std().Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal(defaultStickySessionCookieName, cookies[0].Name)
+	assert.Equal(3600, cookies[0].MaxAge)
+
+	// and it is pinned to the server.
+	cookie := cookies[0].Name + "=" + cookies[0].Value
+	for i := 0; i < 10; i++ {
+		req = newStickyRequest("Cookie", cookie)
+		assert.Same(svr, lb.ChooseServer(req))
+		lb.ReturnServer(svr, 0, nil)
+		resp, _ = httpprot.NewResponse(nil)
+		lb.ReturnResponse(svr, req, resp)
+		assert.Empty(resp.HTTPHeader().Get("Set-Cookie"))
+	}
+
+	// the pinned server is unhealthy.
+	var healthy []*Server
+	for _, s := range svrs {
+		if s != svr {
+			healthy = append(healthy, s)
+		}
+	}
+	lb = newLoadBalancer(spec, svrs, healthy).(*stickySessionLoadBalancer)
+	other := lb.ChooseServer(req)
+	assert.NotNil(other)
+	assert.NotSame(svr, other)
+	resp, _ = httpprot.NewResponse(nil)
+	lb.ReturnResponse(other, req, resp)
+	assert.NotEmpty(resp.HTTPHeader().Get("Set-Cookie"))
+
+	spec.StickySession.Failover = StickySessionFailoverFail
+	lb = newLoadBalancer(spec, svrs, healthy).(*stickySessionLoadBalancer)
+	assert.Nil(lb.ChooseServer(req))
+}
+
+func TestStickySessionConsistentHash(t *testing.T) {
+	assert := assert.New(t)
+
+	svrs := prepareURLServers(5)
+	spec := &LoadBalanceSpec{StickySession: &StickySessionSpec{Mode: "header", HeaderName: "X-User"}}
+	lb := NewLoadBalancer(spec, svrs)
+
+	pinned := map[string]*Server{}
+	counter := map[*Server]int{}
+	for i := 0; i < 100; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		svr := lb.ChooseServer(newStickyRequest("X-User", user))
+		pinned[user] = svr
+		counter[svr]++
+		assert.Same(svr, lb.ChooseServer(newStickyRequest("X-User", user)))
+	}
+	assert.Len(counter, 5)
+
+	// only the clients of the ejected server are moved.
+	lb = newLoadBalancer(spec, svrs, svrs[1:])
+	for user, svr := range pinned {
+		got := lb.ChooseServer(newStickyRequest("X-User", user))
+		if svr == svrs[0] {
+			assert.NotSame(svrs[0], got)
+		} else {
+			assert.Same(svr, got)
+		}
+	}
+
+	// the load is bounded.
+	spec.StickySession.LoadFactor = 1.25
+	lb = NewLoadBalancer(spec, svrs)
+	counter = map[*Server]int{}
+	for i := 0; i < 100; i++ {
+		counter[lb.ChooseServer(newStickyRequest("X-User", "hot-user"))]++
+	}
+	for _, n := range counter {
+		assert.LessOrEqual(n, 25)
+	}
+
+	// the appCookie mode.
+	spec = &LoadBalanceSpec{StickySession: &StickySessionSpec{Mode: "appCookie", CookieName: "JSESSIONID"}}
+	lb = NewLoadBalancer(spec, svrs)
+	svr := lb.ChooseServer(newStickyRequest("Cookie", "JSESSIONID=abc"))
+	for i := 0; i < 10; i++ {
+		assert.Same(svr, lb.ChooseServer(newStickyRequest("Cookie", "JSESSIONID=abc")))
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+const (
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+type (
+	// TransportSpec describes the transport settings of a server pool, it
+	// overrides the transport shared by all pools of the proxy.
+	TransportSpec struct {
+		MaxIdleConnsPerHost int    `json:"maxIdleConnsPerHost,omitempty" jsonschema:"omitempty,minimum=0"`
+		MaxConnsPerHost     int    `json:"maxConnsPerHost,omitempty" jsonschema:"omitempty,minimum=0"`
+		IdleConnTimeout     string `json:"idleConnTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		TLSHandshakeTimeout string `json:"tlsHandshakeTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		DisableKeepAlives   bool   `json:"disableKeepAlives,omitempty" jsonschema:"omitempty"`
+		HTTP2               bool   `json:"http2,omitempty" jsonschema:"omitempty"`
+		H2C                 bool   `json:"h2c,omitempty" jsonschema:"omitempty"`
+
+		// ProxyProtocol is the version of the PROXY protocol header sent
+		// on the connections to the servers, keep-alives are disabled as
+		// a connection carries the addresses of only one client.
+		ProxyProtocol string `json:"proxyProtocol,omitempty" jsonschema:"omitempty,enum=,enum=v1,enum=v2"`
+
+		// TLS is the settings of the TLS connections to the HTTPS servers.
+		TLS *TransportTLSSpec `json:"tls,omitempty" jsonschema:"omitempty"`
+	}
+
+	// TransportTLSSpec describes how the TLS connections to the servers are
+	// originated.
+	TransportTLSSpec struct {
+		// Verify verifies the certificates of the servers, which is
+		// skipped by default.
+		Verify bool `json:"verify,omitempty" jsonschema:"omitempty"`
+		// ServerName is the server name of the TLS handshake, default is
+		// the host of the server URL.
+		ServerName string `json:"serverName,omitempty" jsonschema:"omitempty"`
+		// RootCertBase64 is the root certificates in PEM to verify the
+		// servers, default is the ones of the system.
+		RootCertBase64 string `json:"rootCertBase64,omitempty" jsonschema:"omitempty,format=base64"`
+	}
+
+	// h2cRoundTripper sends plain HTTP requests with HTTP/2 prior
+	// knowledge, and other requests with the underlying transport.
+	h2cRoundTripper struct {
+		h1  *http.Transport
+		h2c *http2.Transport
+	}
+)
+
+// Validate validates TransportSpec.
+func (ts *TransportSpec) Validate() error {
+	if ts.IdleConnTimeout != "" {
+		if _, err := time.ParseDuration(ts.IdleConnTimeout); err != nil {
+			return fmt.Errorf("invalid idleConnTimeout %s: %v", ts.IdleConnTimeout, err)
+		}
+	}
+	if ts.TLSHandshakeTimeout != "" {
+		if _, err := time.ParseDuration(ts.TLSHandshakeTimeout); err != nil {
+			return fmt.Errorf("invalid tlsHandshakeTimeout %s: %v", ts.TLSHandshakeTimeout, err)
+		}
+	}
+	if ts.H2C && ts.DisableKeepAlives {
+		return fmt.Errorf("h2c and disableKeepAlives are mutually exclusive")
+	}
+	if ts.ProxyProtocol != "" && (ts.H2C || ts.HTTP2) {
+		return fmt.Errorf("proxyProtocol can't be used with http2 or h2c")
+	}
+	if ts.TLS != nil && ts.TLS.RootCertBase64 != "" {
+		if _, err := ts.TLS.rootCAs(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tts *TransportTLSSpec) rootCAs() (*x509.CertPool, error) {
+	pem, err := base64.StdEncoding.DecodeString(tts.RootCertBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rootCertBase64: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in rootCertBase64")
+	}
+	return pool, nil
+}
+
+// apply applies the settings to cfg.
+func (tts *TransportTLSSpec) apply(cfg *tls.Config) {
+	cfg.InsecureSkipVerify = !tts.Verify
+	if tts.ServerName != "" {
+		cfg.ServerName = tts.ServerName
+	}
+	if tts.RootCertBase64 != "" {
+		cfg.RootCAs, _ = tts.rootCAs()
+	}
+}
+
+func (rt *h2cRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return rt.h2c.RoundTrip(req)
+	}
+	return rt.h1.RoundTrip(req)
+}
+
+func (rt *h2cRoundTripper) CloseIdleConnections() {
+	rt.h1.CloseIdleConnections()
+	rt.h2c.CloseIdleConnections()
+}
+
+// newHTTPClient creates an HTTP client of the proxy, the transport settings
+// are overridden by ts if it is not nil.
+func newHTTPClient(spec *Spec, tlsCfg *tls.Config, ts *TransportSpec) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 60 * time.Second,
+		DualStack: true,
+	}
+
+	transport := &http.Transport{
+		Proxy:              http.ProxyFromEnvironment,
+		DialContext:        dialer.DialContext,
+		TLSClientConfig:    tlsCfg.Clone(),
+		DisableCompression: false,
+		// NOTE: The large number of Idle Connections can
+		// reduce overhead of building connections.
+		MaxIdleConns:          spec.MaxIdleConns,
+		MaxIdleConnsPerHost:   spec.MaxIdleConnsPerHost,
+		IdleConnTimeout:       defaultIdleConnTimeout,
+		TLSHandshakeTimeout:   defaultTLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	var rt http.RoundTripper = transport
+	if ts != nil {
+		if ts.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = ts.MaxIdleConnsPerHost
+		}
+		transport.MaxConnsPerHost = ts.MaxConnsPerHost
+		if ts.IdleConnTimeout != "" {
+			transport.IdleConnTimeout, _ = time.ParseDuration(ts.IdleConnTimeout)
+		}
+		if ts.TLSHandshakeTimeout != "" {
+			transport.TLSHandshakeTimeout, _ = time.ParseDuration(ts.TLSHandshakeTimeout)
+		}
+		transport.DisableKeepAlives = ts.DisableKeepAlives
+		if ts.TLS != nil {
+			ts.TLS.apply(transport.TLSClientConfig)
+		}
+		// NOTE: HTTP/2 is disabled by default as the TLS config and
+		// the dialer are customized.
+		transport.ForceAttemptHTTP2 = ts.HTTP2
+
+		if ts.ProxyProtocol != "" {
+			transport.DisableKeepAlives = true
+			transport.DialContext = func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+				conn, err := dialer.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				h := proxyprotocol.HeaderFromContext(ctx)
+				if _, err = conn.Write(h.Format(ts.ProxyProtocol)); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return conn, nil
+			}
+		}
+
+		if ts.H2C {
+			rt = &h2cRoundTripper{
+				h1: transport,
+				h2c: &http2.Transport{
+					AllowHTTP: true,
+					DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+						return dialer.Dial(network, addr)
+					},
+				},
+			}
+		}
+	}
+
+	return &http.Client{
+		// NOTE: Timeout could be no limit, real client or server could cancel it.
+		Timeout:   0,
+		Transport: rt,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
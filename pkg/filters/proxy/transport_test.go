@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+func TestTransportSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&TransportSpec{IdleConnTimeout: "30s", TLSHandshakeTimeout: "5s"}).Validate())
+	assert.Error((&TransportSpec{IdleConnTimeout: "30"}).Validate())
+	assert.Error((&TransportSpec{TLSHandshakeTimeout: "abc"}).Validate())
+	assert.Error((&TransportSpec{H2C: true, DisableKeepAlives: true}).Validate())
+	assert.Error((&TransportSpec{HTTP2: true, ProxyProtocol: "v2"}).Validate())
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{MaxIdleConns: 100, MaxIdleConnsPerHost: 10}
+	tlsCfg := &tls.Config{InsecureSkipVerify: true}
+
+	transport := newHTTPClient(spec, tlsCfg, nil).Transport.(*http.Transport)
+	assert.Equal(100, transport.MaxIdleConns)
+	assert.Equal(10, transport.MaxIdleConnsPerHost)
+	assert.Equal(defaultIdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(defaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.False(transport.ForceAttemptHTTP2)
+
+	ts := &TransportSpec{
+		MaxIdleConnsPerHost: 20,
+		MaxConnsPerHost:     50,
+		IdleConnTimeout:     "30s",
+		TLSHandshakeTimeout: "5s",
+		HTTP2:               true,
+	}
+	transport = newHTTPClient(spec, tlsCfg, ts).Transport.(*http.Transport)
+	assert.Equal(100, transport.MaxIdleConns)
+	assert.Equal(20, transport.MaxIdleConnsPerHost)
+	assert.Equal(50, transport.MaxConnsPerHost)
+	assert.Equal(30*time.Second, transport.IdleConnTimeout)
+	assert.Equal(5*time.Second, transport.TLSHandshakeTimeout)
+	assert.True(transport.ForceAttemptHTTP2)
+
+	ts.H2C = true
+	_, ok := newHTTPClient(spec, tlsCfg, ts).Transport.(*h2cRoundTripper)
+	assert.True(ok)
+}
+
+func TestServerPoolHTTPClient(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &Proxy{
+		spec:   &Spec{MaxIdleConns: 100, MaxIdleConnsPerHost: 10},
+		client: &http.Client{},
+	}
+	servers := []*Server{{URL: "http://127.0.0.1:9090"}}
+
+	sp := NewServerPool(p, &ServerPoolSpec{Servers: servers}, "test")
+	assert.Same(p.client, sp.httpClient())
+	sp.close()
+
+	sp = NewServerPool(p, &ServerPoolSpec{
+		Servers:   servers,
+		Transport: &TransportSpec{MaxIdleConnsPerHost: 20},
+	}, "test")
+	assert.NotSame(p.client, sp.httpClient())
+	assert.Equal(20, sp.httpClient().Transport.(*http.Transport).MaxIdleConnsPerHost)
+	sp.close()
+}
+
+func TestHTTP2Upstream(t *testing.T) {
+	assert := assert.New(t)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+	})
+
+	spec := &Spec{MaxIdleConns: 100, MaxIdleConnsPerHost: 10}
+	tlsCfg := &tls.Config{InsecureSkipVerify: true}
+
+	// h2c
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+
+	client := newHTTPClient(spec, tlsCfg, &TransportSpec{H2C: true})
+	resp, err := client.Get(h2cServer.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("HTTP/2.0", resp.Header.Get("X-Proto"))
+
+	client = newHTTPClient(spec, tlsCfg, nil)
+	resp, err = client.Get(h2cServer.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("HTTP/1.1", resp.Header.Get("X-Proto"))
+
+	// HTTP/2 over TLS
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	client = newHTTPClient(spec, tlsCfg, &TransportSpec{HTTP2: true})
+	resp, err = client.Get(tlsServer.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("HTTP/2.0", resp.Header.Get("X-Proto"))
+
+	client = newHTTPClient(spec, tlsCfg, nil)
+	resp, err = client.Get(tlsServer.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("HTTP/1.1", resp.Header.Get("X-Proto"))
+}
+
+func TestProxyProtocolUpstream(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Remote-Addr", r.RemoteAddr)
+	}))
+	server.Listener = proxyprotocol.NewListener(server.Listener, &proxyprotocol.Spec{})
+	server.Start()
+	defer server.Close()
+
+	spec := &Spec{MaxIdleConns: 100, MaxIdleConnsPerHost: 10}
+	client := newHTTPClient(spec, nil, &TransportSpec{ProxyProtocol: "v2"})
+	assert.True(client.Transport.(*http.Transport).DisableKeepAlives)
+
+	h := &proxyprotocol.Header{
+		Src: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 56324},
+		Dst: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80},
+	}
+	req, _ := http.NewRequestWithContext(proxyprotocol.WithHeader(stdcontext.Background(), h), http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("192.168.1.1:56324", resp.Header.Get("X-Remote-Addr"))
+
+	// the header is LOCAL if the client addresses are unknown.
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err = client.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	host, _, _ := net.SplitHostPort(resp.Header.Get("X-Remote-Addr"))
+	assert.Equal("127.0.0.1", host)
+}
+
+func TestTransportTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	rootCert := base64.StdEncoding.EncodeToString(certPEM)
+
+	assert.Error((&TransportSpec{TLS: &TransportTLSSpec{RootCertBase64: "invalid"}}).Validate())
+	assert.Error((&TransportSpec{TLS: &TransportTLSSpec{RootCertBase64: base64.StdEncoding.EncodeToString([]byte("abc"))}}).Validate())
+	assert.NoError((&TransportSpec{TLS: &TransportTLSSpec{Verify: true, RootCertBase64: rootCert}}).Validate())
+
+	spec := &Spec{}
+	tlsCfg := &tls.Config{InsecureSkipVerify: true}
+
+	// the certificate of the test server is not trusted by the system
+	client := newHTTPClient(spec, tlsCfg, &TransportSpec{TLS: &TransportTLSSpec{Verify: true}})
+	_, err := client.Get(server.URL)
+	assert.Error(err)
+
+	client = newHTTPClient(spec, tlsCfg, &TransportSpec{TLS: &TransportTLSSpec{Verify: true, RootCertBase64: rootCert}})
+	resp, err := client.Get(server.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// the name is not in the SANs of the certificate of httptest, which
+	// covers example.com and *.example.com.
+	client = newHTTPClient(spec, tlsCfg, &TransportSpec{TLS: &TransportTLSSpec{
+		Verify:         true,
+		ServerName:     "unknown.invalid",
+		RootCertBase64: rootCert,
+	}})
+	_, err = client.Get(server.URL)
+	assert.Error(err)
+
+	// the shared TLS config is not changed
+	assert.True(tlsCfg.InsecureSkipVerify)
+}
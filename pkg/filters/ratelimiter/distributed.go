@@ -0,0 +1,313 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	stdcontext "context"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	backendEtcd  = "etcd"
+	backendRedis = "redis"
+
+	defaultSyncInterval = 100 * time.Millisecond
+)
+
+type (
+	// DistributedSpec describes the distributed mode of RateLimiter, in
+	// which the limits are enforced cluster-wide by token buckets shared
+	// by all members.
+	DistributedSpec struct {
+		Backend      string     `json:"backend" jsonschema:"omitempty,enum=,enum=etcd,enum=redis"`
+		SyncInterval string     `json:"syncInterval" jsonschema:"omitempty,format=duration"`
+		Redis        *RedisSpec `json:"redis" jsonschema:"omitempty"`
+	}
+
+	// RedisSpec describes the Redis server of the distributed mode.
+	RedisSpec struct {
+		Address  string `json:"address" jsonschema:"required"`
+		Password string `json:"password" jsonschema:"omitempty"`
+		DB       int    `json:"db" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// bucketStore stores the shared token buckets, every distributed
+	// limiter owns its store.
+	bucketStore interface {
+		// take puts the returned tokens back to the bucket of key after
+		// refilling it, and then takes at most n tokens from it. It
+		// returns the number of tokens taken.
+		take(key string, b *bucket, returned, n int) (int, error)
+		close()
+	}
+
+	// bucket is the parameters of a token bucket.
+	bucket struct {
+		// rate is the number of tokens refilled per second.
+		rate     float64
+		capacity float64
+	}
+
+	// bucketState is the state of a token bucket in the store.
+	bucketState struct {
+		Tokens float64 `json:"tokens"`
+		// Last is the unix time in nanoseconds of the last refill.
+		Last int64 `json:"last"`
+	}
+
+	// distributedLimiter is a rate limiter which leases tokens from the
+	// shared bucket periodically, by the demand of the last sync interval.
+	// The requests are permitted by the leased tokens, so that there is no
+	// remote call in the hot path.
+	distributedLimiter struct {
+		key          string
+		store        bucketStore
+		bucket       *bucket
+		timeout      time.Duration
+		syncInterval time.Duration
+
+		lock   sync.Mutex
+		tokens int
+		demand int
+		// synced is closed and replaced on every sync.
+		synced  chan struct{}
+		failing bool
+
+		done chan struct{}
+	}
+)
+
+// Validate validates DistributedSpec.
+func (s *DistributedSpec) Validate() error {
+	if s.Backend == backendRedis && s.Redis == nil {
+		return fmt.Errorf("redis is required for the redis backend")
+	}
+	if s.SyncInterval != "" {
+		d, err := time.ParseDuration(s.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid sync interval %s: %v", s.SyncInterval, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("sync interval must be positive")
+		}
+	}
+	return nil
+}
+
+func (s *DistributedSpec) syncInterval() time.Duration {
+	if s.SyncInterval == "" {
+		return defaultSyncInterval
+	}
+	d, _ := time.ParseDuration(s.SyncInterval)
+	return d
+}
+
+// bucketKey returns the key of the bucket of the URL rule.
+func bucketKey(u *URLRule) string {
+	return url.PathEscape(strings.Join(u.Methods, ",") + " " + u.ID())
+}
+
+// refill refills the bucket state at now, and puts the returned tokens back.
+func (st *bucketState) refill(b *bucket, now int64, returned int) {
+	elapsed := float64(now-st.Last) / float64(time.Second)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	st.Tokens = math.Min(b.capacity, st.Tokens+elapsed*b.rate+float64(returned))
+	st.Last = now
+}
+
+// takeTokens takes at most n tokens from the bucket state.
+func (st *bucketState) takeTokens(n int) int {
+	granted := int(math.Min(float64(n), math.Floor(st.Tokens)))
+	if granted < 0 {
+		granted = 0
+	}
+	st.Tokens -= float64(granted)
+	return granted
+}
+
+// etcdStore stores the buckets in the etcd of the cluster.
+type etcdStore struct {
+	cls    cluster.Cluster
+	prefix string
+}
+
+func (s *etcdStore) take(key string, b *bucket, returned, n int) (int, error) {
+	key = s.prefix + key
+	granted := 0
+	err := s.cls.STM(func(stm concurrency.STM) error {
+		now := time.Now().UnixNano()
+		st := &bucketState{Tokens: b.capacity, Last: now}
+		if v := stm.Get(key); v != "" {
+			if err := codectool.UnmarshalJSON([]byte(v), st); err != nil {
+				st = &bucketState{Tokens: b.capacity, Last: now}
+			}
+		}
+
+		st.refill(b, now, returned)
+		granted = st.takeTokens(n)
+
+		data, err := codectool.MarshalJSON(st)
+		if err != nil {
+			return err
+		}
+		stm.Put(key, string(data))
+		return nil
+	})
+	return granted, err
+}
+
+func (s *etcdStore) close() {
+}
+
+func newDistributedLimiter(key string, store bucketStore, policy *Policy, syncInterval time.Duration) *distributedLimiter {
+	limit := policy.LimitForPeriod
+	if limit == 0 {
+		limit = 50
+	}
+	period := 10 * time.Millisecond
+	if policy.LimitRefreshPeriod != "" {
+		period, _ = time.ParseDuration(policy.LimitRefreshPeriod)
+	}
+	timeout := 100 * time.Millisecond
+	if policy.TimeoutDuration != "" {
+		timeout, _ = time.ParseDuration(policy.TimeoutDuration)
+	}
+
+	l := &distributedLimiter{
+		key:   key,
+		store: store,
+		bucket: &bucket{
+			rate:     float64(limit) / period.Seconds(),
+			capacity: float64(limit),
+		},
+		timeout:      timeout,
+		syncInterval: syncInterval,
+		synced:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *distributedLimiter) run() {
+	l.sync()
+
+	ticker := time.NewTicker(l.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			l.lock.Lock()
+			returned := l.tokens
+			l.tokens = 0
+			l.lock.Unlock()
+			if returned > 0 {
+				l.store.take(l.key, l.bucket, returned, 0)
+			}
+			l.store.close()
+			return
+		case <-ticker.C:
+			l.sync()
+		}
+	}
+}
+
+// sync returns the unused tokens to the shared bucket, and leases new
+// tokens by the demand, with some headroom for the growth of traffic.
+func (l *distributedLimiter) sync() {
+	l.lock.Lock()
+	returned, demand := l.tokens, l.demand
+	l.tokens, l.demand = 0, 0
+	l.lock.Unlock()
+
+	n := demand + demand/4 + 1
+	if n > int(l.bucket.capacity) {
+		n = int(l.bucket.capacity)
+	}
+
+	granted, err := l.store.take(l.key, l.bucket, returned, n)
+	if err != nil {
+		// limit the requests locally if the store is unavailable.
+		granted = int(math.Ceil(l.bucket.rate * l.syncInterval.Seconds()))
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err != nil && !l.failing {
+		logger.Errorf("distributed rate limiter %s: failed to sync, fall back to local limiting: %v", l.key, err)
+	} else if err == nil && l.failing {
+		logger.Infof("distributed rate limiter %s: sync recovered", l.key)
+	}
+	l.failing = err != nil
+
+	l.tokens += granted
+	close(l.synced)
+	l.synced = make(chan struct{})
+}
+
+// AcquirePermission acquires a permission, it waits for the next sync if
+// there are no tokens, until the timeout of the policy.
+func (l *distributedLimiter) AcquirePermission(ctx stdcontext.Context) bool {
+	deadline := time.Now().Add(l.timeout)
+
+	l.lock.Lock()
+	l.demand++
+	for {
+		if l.tokens > 0 {
+			l.tokens--
+			l.lock.Unlock()
+			return true
+		}
+		synced := l.synced
+		l.lock.Unlock()
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-synced:
+			timer.Stop()
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+		l.lock.Lock()
+	}
+}
+
+func (l *distributedLimiter) close() {
+	close(l.done)
+}
@@ -0,0 +1,437 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"bufio"
+	stdcontext "context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+// memStore is a bucketStore in memory.
+type memStore struct {
+	lock   sync.Mutex
+	states map[string]*bucketState
+	err    error
+	closed bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{states: map[string]*bucketState{}}
+}
+
+func (s *memStore) take(key string, b *bucket, returned, n int) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	}
+	now := time.Now().UnixNano()
+	st := s.states[key]
+	if st == nil {
+		st = &bucketState{Tokens: b.capacity, Last: now}
+		s.states[key] = st
+	}
+	st.refill(b, now, returned)
+	return st.takeTokens(n), nil
+}
+
+func (s *memStore) close() {
+	s.lock.Lock()
+	s.closed = true
+	s.lock.Unlock()
+}
+
+func TestDistributedSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &DistributedSpec{Backend: backendRedis}
+	assert.Error(spec.Validate())
+	spec.Redis = &RedisSpec{Address: "127.0.0.1:6379"}
+	assert.NoError(spec.Validate())
+	assert.Equal(defaultSyncInterval, spec.syncInterval())
+
+	spec.SyncInterval = "invalid"
+	assert.Error(spec.Validate())
+	spec.SyncInterval = "-1s"
+	assert.Error(spec.Validate())
+	spec.SyncInterval = "1s"
+	assert.NoError(spec.Validate())
+	assert.Equal(time.Second, spec.syncInterval())
+}
+
+func TestBucketState(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &bucket{rate: 10, capacity: 20}
+	st := &bucketState{Tokens: 20}
+	assert.Equal(15, st.takeTokens(15))
+	assert.Equal(5, st.takeTokens(15))
+	assert.Equal(0, st.takeTokens(1))
+
+	// refilled by the elapsed time, but never beyond the capacity.
+	st.refill(b, int64(time.Second), 0)
+	assert.Equal(10.0, st.Tokens)
+	st.refill(b, int64(time.Second), 3)
+	assert.Equal(13.0, st.Tokens)
+	st.refill(b, int64(time.Hour), 0)
+	assert.Equal(20.0, st.Tokens)
+
+	// the clock going backwards.
+	st.refill(b, 0, 0)
+	assert.Equal(20.0, st.Tokens)
+}
+
+func TestEtcdStore(t *testing.T) {
+	assert := assert.New(t)
+
+	kvs := map[string]string{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		stm := &clustertest.MockedSTM{
+			MockedGet: func(key ...string) string {
+				return kvs[key[0]]
+			},
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) {
+				kvs[key] = val
+			},
+		}
+		return apply(stm)
+	}
+
+	prefix := (&cluster.Layout{}).RateLimiterPrefix("pipeline", "limiter")
+	store := &etcdStore{cls: cls, prefix: prefix}
+	b := &bucket{rate: 0.001, capacity: 10}
+
+	n, err := store.take("key", b, 0, 6)
+	assert.NoError(err)
+	assert.Equal(6, n)
+	n, err = store.take("key", b, 0, 6)
+	assert.NoError(err)
+	assert.Equal(4, n)
+	n, err = store.take("key", b, 3, 6)
+	assert.NoError(err)
+	assert.Equal(3, n)
+	assert.Contains(kvs, "/ratelimiter/pipeline/limiter/key")
+	store.close()
+
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		return fmt.Errorf("etcd is unavailable")
+	}
+	_, err = store.take("key", b, 0, 1)
+	assert.Error(err)
+}
+
+func TestDistributedLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newMemStore()
+	policy := &Policy{
+		Name:               "default",
+		TimeoutDuration:    "50ms",
+		LimitRefreshPeriod: "1h",
+		LimitForPeriod:     10,
+	}
+
+	// two limiters share the bucket, so only 10 requests are permitted.
+	l1 := newDistributedLimiter("key", store, policy, 10*time.Millisecond)
+	l2 := newDistributedLimiter("key", store, policy, 10*time.Millisecond)
+
+	permitted := 0
+	for i := 0; i < 30; i++ {
+		l := l1
+		if i%2 == 1 {
+			l = l2
+		}
+		if l.AcquirePermission(stdcontext.Background()) {
+			permitted++
+		}
+	}
+	assert.Equal(10, permitted)
+
+	// the unused tokens are returned to the bucket on close.
+	l1.close()
+	l2.close()
+	assert.Eventually(func() bool {
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		return store.closed
+	}, time.Second, 10*time.Millisecond)
+
+	// fall back to local limiting if the store is unavailable.
+	store = newMemStore()
+	store.err = fmt.Errorf("store is unavailable")
+	policy.LimitRefreshPeriod = "100ms"
+	l := newDistributedLimiter("key", store, policy, 10*time.Millisecond)
+	defer l.close()
+	assert.True(l.AcquirePermission(stdcontext.Background()))
+
+	// canceled requests are not permitted.
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		l.AcquirePermission(stdcontext.Background())
+	}
+	l.lock.Lock()
+	l.tokens = 0
+	l.lock.Unlock()
+	assert.False(l.AcquirePermission(ctx))
+}
+
+// fakeRedis is a fake Redis server, which replies EVAL by the eval
+// function.
+type fakeRedis struct {
+	listener net.Listener
+	lock     sync.Mutex
+	commands [][]string
+	eval     func(args []string) string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	fr := &fakeRedis{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fr.serve(conn)
+		}
+	}()
+	return fr
+}
+
+func (fr *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := readRedisReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range v.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+
+		fr.lock.Lock()
+		fr.commands = append(fr.commands, args)
+		fr.lock.Unlock()
+
+		reply := "+OK\r\n"
+		switch args[0] {
+		case "AUTH":
+			if args[1] != "secret" {
+				reply = "-ERR invalid password\r\n"
+			}
+		case "EVAL":
+			fr.lock.Lock()
+			reply = fr.eval(args)
+			fr.lock.Unlock()
+		}
+		conn.Write([]byte(reply))
+	}
+}
+
+func (fr *fakeRedis) setEval(eval func(args []string) string) {
+	fr.lock.Lock()
+	fr.eval = eval
+	fr.lock.Unlock()
+}
+
+func (fr *fakeRedis) Close() {
+	fr.listener.Close()
+}
+
+func TestRedisStore(t *testing.T) {
+	assert := assert.New(t)
+
+	fr := newFakeRedis(t)
+	defer fr.Close()
+	fr.setEval(func(args []string) string {
+		return ":" + args[7] + "\r\n"
+	})
+
+	spec := &RedisSpec{Address: fr.listener.Addr().String(), Password: "secret", DB: 2}
+	store := newRedisStore(spec, "easegress:ratelimiter:pipeline:limiter:")
+	defer store.close()
+
+	n, err := store.take("key", &bucket{rate: 10, capacity: 20}, 1, 5)
+	assert.NoError(err)
+	assert.Equal(5, n)
+
+	fr.lock.Lock()
+	assert.Equal([]string{"AUTH", "secret"}, fr.commands[0])
+	assert.Equal([]string{"SELECT", "2"}, fr.commands[1])
+	eval := fr.commands[2]
+	fr.lock.Unlock()
+	assert.Equal("EVAL", eval[0])
+	assert.Equal([]string{"1", "easegress:ratelimiter:pipeline:limiter:key", "10", "20", "1", "5"}, eval[2:])
+
+	// errors of the server.
+	fr.setEval(func(args []string) string {
+		return "-ERR script error\r\n"
+	})
+	_, err = store.take("key", &bucket{rate: 10, capacity: 20}, 0, 5)
+	assert.Error(err)
+	fr.setEval(func(args []string) string {
+		return "$2\r\nok\r\n"
+	})
+	_, err = store.take("key", &bucket{rate: 10, capacity: 20}, 0, 5)
+	assert.Error(err)
+
+	// invalid password.
+	spec.Password = "invalid"
+	_, err = newRedisStore(spec, "").take("key", &bucket{rate: 10, capacity: 20}, 0, 5)
+	assert.Error(err)
+
+	// unavailable server.
+	_, err = newRedisStore(&RedisSpec{Address: "127.0.0.1:1"}, "").take("key", &bucket{rate: 10, capacity: 20}, 0, 5)
+	assert.Error(err)
+}
+
+func TestReadRedisReply(t *testing.T) {
+	assert := assert.New(t)
+
+	read := func(s string) (interface{}, error) {
+		return readRedisReply(bufio.NewReader(strings.NewReader(s)))
+	}
+
+	v, err := read("*3\r\n$3\r\nfoo\r\n:42\r\n$-1\r\n")
+	assert.NoError(err)
+	assert.Equal([]interface{}{"foo", int64(42), nil}, v)
+
+	v, err = read("+OK\r\n")
+	assert.NoError(err)
+	assert.Equal("OK", v)
+
+	_, err = read("-ERR boom\r\n")
+	assert.Equal(redisError("ERR boom"), err)
+
+	for _, s := range []string{"", "\r\n", "?\r\n", "+OK\n", ":x\r\n", "$3\r\nf"} {
+		_, err = read(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestRateLimiterDistributed(t *testing.T) {
+	assert := assert.New(t)
+
+	fr := newFakeRedis(t)
+	defer fr.Close()
+	fr.setEval(func(args []string) string {
+		return ":0\r\n"
+	})
+
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(`
+kind: RateLimiter
+name: limiter
+policies:
+- name: default
+  timeoutDuration: 20ms
+  limitRefreshPeriod: 1s
+  limitForPeriod: 10
+defaultPolicyRef: default
+urls:
+- url:
+    prefix: /
+distributed:
+  backend: redis
+  syncInterval: 10ms
+  redis:
+    address: `+fr.listener.Addr().String()+`
+`), &rawSpec)
+	assert.NoError(err)
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(err)
+
+	rl := kind.CreateInstance(spec).(*RateLimiter)
+	rl.Init()
+	assert.NotNil(rl.spec.URLs[0].drl)
+
+	newContext := func() *context.Context {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/test", nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx := context.New(nil)
+		ctx.SetInputRequest(req)
+		return ctx
+	}
+
+	ctx := newContext()
+	assert.Equal(resultRateLimited, rl.Handle(ctx))
+	assert.Equal(http.StatusTooManyRequests, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	fr.setEval(func(args []string) string {
+		return ":" + args[7] + "\r\n"
+	})
+	assert.Eventually(func() bool {
+		return rl.Handle(newContext()) == ""
+	}, time.Second, 10*time.Millisecond)
+
+	// the distributed limiter is inherited by the next generation.
+	drl := rl.spec.URLs[0].drl
+	spec, err = filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(err)
+	rl2 := kind.CreateInstance(spec).(*RateLimiter)
+	rl2.Inherit(rl)
+	rl.Close()
+	assert.Equal(drl, rl2.spec.URLs[0].drl)
+	rl2.Close()
+	assert.Nil(rl2.spec.URLs[0].drl)
+
+	// fall back to local limiting without a cluster.
+	delete(rawSpec, "distributed")
+	rawSpec["distributed"] = map[string]interface{}{"backend": "etcd"}
+	spec, err = filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(err)
+	rl = kind.CreateInstance(spec).(*RateLimiter)
+	rl.Init()
+	defer rl.Close()
+	assert.Nil(rl.spec.URLs[0].drl)
+	assert.NotNil(rl.spec.URLs[0].rl)
+	assert.Equal("", rl.Handle(newContext()))
+}
@@ -67,12 +67,14 @@ type (
 		urlrule.URLRule `json:",inline"`
 		policy          *Policy
 		rl              *librl.RateLimiter
+		drl             *distributedLimiter
 	}
 
 	// Spec is the configuration of a rate limiter
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 		Rule             `json:",inline"`
+		Distributed      *DistributedSpec `json:"distributed" jsonschema:"omitempty"`
 	}
 
 	// Rule is the detailed config of RateLimiter.
@@ -176,10 +178,39 @@ func (rl *RateLimiter) bindPolicyToURL(u *URLRule) {
 func (rl *RateLimiter) createRateLimiterForURL(u *URLRule) {
 	u.Init()
 	rl.bindPolicyToURL(u)
+	if store := rl.newBucketStore(); store != nil {
+		u.drl = newDistributedLimiter(bucketKey(u), store, u.policy, rl.spec.Distributed.syncInterval())
+		return
+	}
 	u.createRateLimiter()
 	rl.setStateListenerForURL(u)
 }
 
+// newBucketStore creates the store of the shared token buckets, it returns
+// nil if the distributed mode is disabled.
+func (rl *RateLimiter) newBucketStore() bucketStore {
+	spec := rl.spec.Distributed
+	if spec == nil {
+		return nil
+	}
+
+	if spec.Backend == backendRedis {
+		prefix := fmt.Sprintf("easegress:ratelimiter:%s:%s:", rl.spec.Pipeline(), rl.spec.Name())
+		return newRedisStore(spec.Redis, prefix)
+	}
+
+	super := rl.spec.Super()
+	if super == nil || super.Cluster() == nil {
+		logger.Errorf("rate limiter %s: cluster is unavailable, fall back to local limiting", rl.spec.Name())
+		return nil
+	}
+	cls := super.Cluster()
+	return &etcdStore{
+		cls:    cls,
+		prefix: cls.Layout().RateLimiterPrefix(rl.spec.Pipeline(), rl.spec.Name()),
+	}
+}
+
 func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 	if policyName == "" {
 		if spec1.DefaultPolicyRef != spec2.DefaultPolicyRef {
@@ -223,9 +254,20 @@ OuterLoop:
 			if !isSamePolicy(rl.spec, previousGeneration.spec, url.PolicyRef) {
 				continue
 			}
+			if !reflect.DeepEqual(rl.spec.Distributed, previousGeneration.spec.Distributed) {
+				continue
+			}
+			if prev.rl == nil && prev.drl == nil {
+				continue
+			}
 
 			url.Init()
 			rl.bindPolicyToURL(url)
+			if prev.drl != nil {
+				url.drl = prev.drl
+				prev.drl = nil
+				continue OuterLoop
+			}
 			url.rl = prev.rl
 			prev.rl = nil
 			rl.setStateListenerForURL(url)
@@ -253,20 +295,16 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 			continue
 		}
 
-		permitted, d := u.rl.AcquirePermission()
-		if !permitted {
-			ctx.AddTag("rateLimiter: too many requests")
-
-			resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
-			if resp == nil {
-				resp, _ = httpprot.NewResponse(nil)
+		if u.drl != nil {
+			if !u.drl.AcquirePermission(req.Context()) {
+				return rl.rateLimited(ctx)
 			}
+			break
+		}
 
-			resp.SetStatusCode(http.StatusTooManyRequests)
-			resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
-
-			ctx.SetOutputResponse(resp)
-			return resultRateLimited
+		permitted, d := u.rl.AcquirePermission()
+		if !permitted {
+			return rl.rateLimited(ctx)
 		}
 
 		if d <= 0 {
@@ -286,11 +324,38 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 	return ""
 }
 
+func (rl *RateLimiter) rateLimited(ctx *context.Context) string {
+	ctx.AddTag("rateLimiter: too many requests")
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	resp.SetStatusCode(http.StatusTooManyRequests)
+	resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
+
+	ctx.SetOutputResponse(resp)
+	return resultRateLimited
+}
+
+// RequiresBody implements filters.BodyRequirer.
+func (rl *RateLimiter) RequiresBody() (request, response bool) {
+	return false, false
+}
+
 // Status returns Status generated by Runtime.
 func (rl *RateLimiter) Status() interface{} {
 	return nil
 }
 
-// Close closes RateLimiter.
+// Close closes RateLimiter, the distributed limiters inherited by the next
+// generation are not closed.
 func (rl *RateLimiter) Close() {
+	for _, u := range rl.spec.URLs {
+		if u.drl != nil {
+			u.drl.close()
+			u.drl = nil
+		}
+	}
 }
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const redisTimeout = time.Second
+
+// takeScript takes tokens from a token bucket stored in a hash, the time of
+// the Redis server is used, so that the clocks of members do not matter.
+const takeScript = `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local returned = tonumber(ARGV[3])
+local n = tonumber(ARGV[4])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+  tokens = capacity
+  last = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate + returned)
+local granted = math.max(0, math.min(n, math.floor(tokens)))
+tokens = tokens - granted
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(capacity / rate) + 60)
+return granted
+`
+
+// redisStore stores the buckets in Redis, by a minimal client of the
+// Redis protocol, which only supports the commands used here.
+type redisStore struct {
+	spec   *RedisSpec
+	prefix string
+
+	lock   sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisStore(spec *RedisSpec, prefix string) *redisStore {
+	return &redisStore{spec: spec, prefix: prefix}
+}
+
+func (s *redisStore) take(key string, b *bucket, returned, n int) (int, error) {
+	reply, err := s.do("EVAL", takeScript, "1", s.prefix+key,
+		strconv.FormatFloat(b.rate, 'f', -1, 64),
+		strconv.FormatFloat(b.capacity, 'f', -1, 64),
+		strconv.Itoa(returned), strconv.Itoa(n))
+	if err != nil {
+		return 0, err
+	}
+	granted, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply of redis: %v", reply)
+	}
+	return int(granted), nil
+}
+
+func (s *redisStore) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closeConn()
+}
+
+func (s *redisStore) closeConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
+
+// connect connects to the Redis server, and authenticates and selects the
+// database if required.
+func (s *redisStore) connect() error {
+	conn, err := net.DialTimeout("tcp", s.spec.Address, redisTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	if s.spec.Password != "" {
+		if _, err = s.call("AUTH", s.spec.Password); err != nil {
+			s.closeConn()
+			return err
+		}
+	}
+	if s.spec.DB != 0 {
+		if _, err = s.call("SELECT", strconv.Itoa(s.spec.DB)); err != nil {
+			s.closeConn()
+			return err
+		}
+	}
+	return nil
+}
+
+// do executes a command, the connection is closed on errors other than
+// the errors returned by the server, and is reconnected by the next call.
+func (s *redisStore) do(args ...string) (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := s.call(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		s.closeConn()
+	}
+	return reply, err
+}
+
+// redisError is an error returned by the Redis server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+func (s *redisStore) call(args ...string) (interface{}, error) {
+	s.conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := s.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readRedisReply(s.reader)
+}
+
+func readRedisLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("invalid redis reply: %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// readRedisReply reads a reply of the Redis protocol, the values are
+// returned as string, int64, []interface{}, or nil.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readRedisLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("invalid redis reply: empty line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("invalid redis reply: %q", line)
+}
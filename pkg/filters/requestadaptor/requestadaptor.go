@@ -30,6 +30,7 @@ import (
 	"github.com/megaease/easegress/pkg/util/pathadaptor"
 	"github.com/megaease/easegress/pkg/util/readers"
 	"github.com/megaease/easegress/pkg/util/signer"
+	"github.com/megaease/easegress/pkg/util/spectemplate"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
 
@@ -131,6 +132,11 @@ type (
 
 		pa     *pathadaptor.PathAdaptor
 		signer *signer.Signer
+
+		// host and the header templates are rendered per request.
+		host      *spectemplate.Template
+		headerSet map[string]*spectemplate.Template
+		headerAdd map[string]*spectemplate.Template
 	}
 
 	// Spec is HTTPAdaptor Spec.
@@ -174,6 +180,17 @@ func (spec *Spec) Validate() error {
 	if spec.Body != "" && spec.Decompress != "" {
 		return fmt.Errorf("No need to decompress when body is specified in RequestAdaptor spec")
 	}
+	if _, err := spectemplate.Compile(spec.Host); err != nil {
+		return fmt.Errorf("host: %v", err)
+	}
+	if spec.Header != nil {
+		if _, err := spectemplate.CompileMap(spec.Header.Set); err != nil {
+			return fmt.Errorf("header set: %v", err)
+		}
+		if _, err := spectemplate.CompileMap(spec.Header.Add); err != nil {
+			return fmt.Errorf("header add: %v", err)
+		}
+	}
 	if spec.Sign == nil {
 		return nil
 	}
@@ -216,6 +233,13 @@ func (ra *RequestAdaptor) reload() {
 	if ra.spec.Path != nil {
 		ra.pa = pathadaptor.New(ra.spec.Path)
 	}
+	if ra.spec.Host != "" {
+		ra.host = spectemplate.MustCompile(ra.spec.Host)
+	}
+	if ra.spec.Header != nil {
+		ra.headerSet, _ = spectemplate.CompileMap(ra.spec.Header.Set)
+		ra.headerAdd, _ = spectemplate.CompileMap(ra.spec.Header.Add)
+	}
 	if s := ra.spec.Sign; s != nil {
 		sc, ok := signerConfigs[s.APIProvider]
 		if ok {
@@ -226,16 +250,16 @@ func (ra *RequestAdaptor) reload() {
 	}
 }
 
-func adaptHeader(req *httpprot.Request, as *httpheader.AdaptSpec) {
+func (ra *RequestAdaptor) adaptHeader(req *httpprot.Request) {
 	h := req.Std().Header
-	for _, key := range as.Del {
+	for _, key := range ra.spec.Header.Del {
 		h.Del(key)
 	}
-	for key, value := range as.Set {
-		h.Set(key, value)
+	for key, t := range ra.headerSet {
+		h.Set(key, t.Render(req, spectemplate.EscapeHeaderValue))
 	}
-	for key, value := range as.Add {
-		h.Add(key, value)
+	for key, t := range ra.headerAdd {
+		h.Add(key, t.Render(req, spectemplate.EscapeHeaderValue))
 	}
 }
 
@@ -258,7 +282,7 @@ func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 	}
 
 	if ra.spec.Header != nil {
-		adaptHeader(req, ra.spec.Header)
+		ra.adaptHeader(req)
 	}
 
 	if len(ra.spec.Body) != 0 {
@@ -266,8 +290,12 @@ func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 		req.Std().Header.Del("Content-Encoding")
 	}
 
-	if len(ra.spec.Host) != 0 {
-		req.SetHost(ra.spec.Host)
+	// the host is kept if the template renders to empty, e.g. the header
+	// referenced is missing.
+	if ra.host != nil {
+		if host := ra.host.Render(req, spectemplate.EscapeHost); host != "" {
+			req.SetHost(host)
+		}
 	}
 
 	if ra.spec.Compress != "" {
@@ -311,3 +311,42 @@ func TestHandle(t *testing.T) {
 
 	assert.Contains(req.Header.Get("Authorization"), " SignedHeaders=host;x-add;x-amz-date;x-set,")
 }
+
+func TestHandleTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := defaultFilterSpec(&Spec{Host: "${req.unknown}"})
+	assert.Nil(spec)
+
+	spec = defaultFilterSpec(&Spec{
+		Header: &httpheader.AdaptSpec{
+			Set: map[string]string{"X-Set": "${req.header}"},
+		},
+	})
+	assert.Nil(spec)
+
+	spec = defaultFilterSpec(&Spec{
+		Host: "${req.header.X-Tenant}.backend",
+		Header: &httpheader.AdaptSpec{
+			Set: map[string]string{"X-Set": "id-${req.header.X-Id}"},
+			Add: map[string]string{"X-Add": "${req.method} $${req.path}"},
+		},
+	})
+	assert.NotNil(spec)
+	ra := kind.CreateInstance(spec)
+	ra.Init()
+
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1/abc", nil)
+	assert.Nil(err)
+	req.Header.Set("X-Tenant", "t1:80/x")
+	req.Header.Set("X-Id", "123\r\nX-Evil: 1")
+
+	ctx := context.New(nil)
+	setRequest(t, ctx, req)
+	assert.Equal("", ra.Handle(ctx))
+
+	httpreq := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("t180x.backend", httpreq.Host())
+	assert.Equal("id-123X-Evil: 1", httpreq.Std().Header.Get("X-Set"))
+	assert.Equal("POST ${req.path}", httpreq.Std().Header.Get("X-Add"))
+}
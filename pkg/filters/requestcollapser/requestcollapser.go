@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestcollapser provides the RequestCollapser filter.
+package requestcollapser
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of RequestCollapser.
+	Kind = "RequestCollapser"
+
+	resultCollapsed = "collapsed"
+
+	headerCollapsed = "X-EG-Collapsed"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RequestCollapser coalesces concurrent identical requests into one upstream request",
+	Results:     []string{resultCollapsed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Methods:     []string{http.MethodGet, http.MethodHead},
+			Timeout:     "10s",
+			MaxBodySize: 1 << 20,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RequestCollapser{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*RequestCollapser)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RequestCollapser is the filter RequestCollapser.
+	RequestCollapser struct {
+		spec    *Spec
+		timeout time.Duration
+		methods map[string]struct{}
+		vary    map[string]struct{}
+
+		lock  sync.Mutex
+		calls map[string]*call
+
+		leaders   uint64
+		collapsed uint64
+		fallbacks uint64
+	}
+
+	// Spec describes the RequestCollapser.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Methods []string `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		// Vary are the headers which are part of the key of the requests
+		// in addition to the method and the URL.
+		Vary []string `json:"vary" jsonschema:"omitempty,uniqueItems=true"`
+		// Timeout is the max time to wait for the response of the
+		// identical request, the request is sent by itself after it.
+		Timeout     string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxBodySize int64  `json:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of RequestCollapser.
+	Status struct {
+		InFlight  int    `json:"inFlight"`
+		Leaders   uint64 `json:"leaders"`
+		Collapsed uint64 `json:"collapsed"`
+		Fallbacks uint64 `json:"fallbacks"`
+	}
+
+	// call is an in-flight request, the identical requests wait for its
+	// response.
+	call struct {
+		done chan struct{}
+		// the response, statusCode is 0 if it can't be shared.
+		statusCode int
+		header     http.Header
+		body       []byte
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if s.Timeout != "" {
+		if _, err := time.ParseDuration(s.Timeout); err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", s.Timeout, err)
+		}
+	}
+	for _, m := range s.Methods {
+		if m != http.MethodGet && m != http.MethodHead && m != http.MethodOptions {
+			return fmt.Errorf("method %s is not idempotent and safe", m)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the RequestCollapser filter instance.
+func (rc *RequestCollapser) Name() string {
+	return rc.spec.Name()
+}
+
+// Kind returns the kind of RequestCollapser.
+func (rc *RequestCollapser) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RequestCollapser
+func (rc *RequestCollapser) Spec() filters.Spec {
+	return rc.spec
+}
+
+// Init initializes RequestCollapser.
+func (rc *RequestCollapser) Init() {
+	rc.reload()
+}
+
+// Inherit inherits previous generation of RequestCollapser.
+func (rc *RequestCollapser) Inherit(previousGeneration filters.Filter) {
+	rc.reload()
+}
+
+func (rc *RequestCollapser) reload() {
+	rc.timeout, _ = time.ParseDuration(rc.spec.Timeout)
+	rc.calls = map[string]*call{}
+
+	rc.methods = map[string]struct{}{}
+	for _, m := range rc.spec.Methods {
+		rc.methods[m] = struct{}{}
+	}
+	rc.vary = map[string]struct{}{}
+	for _, h := range rc.spec.Vary {
+		rc.vary[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+}
+
+// key returns the key of the request, which is the method and the URL,
+// followed by the values of the vary headers.
+func (rc *RequestCollapser) key(req *httpprot.Request) string {
+	var sb strings.Builder
+	sb.WriteString(req.Method())
+	sb.WriteByte(' ')
+	sb.WriteString(req.Scheme())
+	sb.WriteString("://")
+	sb.WriteString(req.Host())
+	sb.WriteString(req.Std().URL.RequestURI())
+
+	for _, h := range rc.spec.Vary {
+		sb.WriteByte('\n')
+		sb.WriteString(http.CanonicalHeaderKey(h))
+		sb.WriteByte(':')
+		sb.WriteString(strings.Join(req.HTTPHeader().Values(h), ","))
+	}
+	return sb.String()
+}
+
+// collapsible returns whether the request could be collapsed, the
+// requests with credentials are only collapsed if the credentials are
+// part of the key.
+func (rc *RequestCollapser) collapsible(req *httpprot.Request) bool {
+	if _, ok := rc.methods[req.Method()]; !ok {
+		return false
+	}
+	for _, h := range []string{"Authorization", "Cookie"} {
+		if req.HTTPHeader().Get(h) == "" {
+			continue
+		}
+		if _, ok := rc.vary[h]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Handle makes the first request of a key the leader, which is sent to
+// the upstream, and the identical requests wait for its response.
+func (rc *RequestCollapser) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !rc.collapsible(req) {
+		return ""
+	}
+
+	key := rc.key(req)
+	rc.lock.Lock()
+	c, ok := rc.calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		rc.calls[key] = c
+	}
+	rc.lock.Unlock()
+
+	if !ok {
+		atomic.AddUint64(&rc.leaders, 1)
+		ctx.OnFinish(func() {
+			rc.finish(ctx, key, c)
+		})
+		return ""
+	}
+
+	timer := time.NewTimer(rc.timeout)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+	case <-timer.C:
+		atomic.AddUint64(&rc.fallbacks, 1)
+		ctx.AddTag(rc.Name() + ": timeout waiting for the identical request")
+		return ""
+	case <-req.Context().Done():
+		return ""
+	}
+
+	if c.statusCode == 0 {
+		atomic.AddUint64(&rc.fallbacks, 1)
+		return ""
+	}
+
+	atomic.AddUint64(&rc.collapsed, 1)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(c.statusCode)
+	h := resp.HTTPHeader()
+	for k, v := range c.header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set(headerCollapsed, "true")
+	resp.SetPayload(c.body)
+	ctx.SetOutputResponse(resp)
+	return resultCollapsed
+}
+
+// finish shares the response of the leader with the waiting requests.
+func (rc *RequestCollapser) finish(ctx *context.Context, key string, c *call) {
+	rc.lock.Lock()
+	delete(rc.calls, key)
+	rc.lock.Unlock()
+	defer close(c.done)
+
+	resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if !ok || resp.IsStream() {
+		return
+	}
+	body := resp.RawPayload()
+	if int64(len(body)) > rc.spec.MaxBodySize {
+		return
+	}
+	// the cookies are issued to the leader only.
+	if len(resp.HTTPHeader().Values("Set-Cookie")) > 0 {
+		return
+	}
+
+	c.header = resp.HTTPHeader().Clone()
+	c.body = body
+	c.statusCode = resp.StatusCode()
+}
+
+// Status returns status.
+func (rc *RequestCollapser) Status() interface{} {
+	rc.lock.Lock()
+	inFlight := len(rc.calls)
+	rc.lock.Unlock()
+
+	return &Status{
+		InFlight:  inFlight,
+		Leaders:   atomic.LoadUint64(&rc.leaders),
+		Collapsed: atomic.LoadUint64(&rc.collapsed),
+		Fallbacks: atomic.LoadUint64(&rc.fallbacks),
+	}
+}
+
+// Close closes RequestCollapser.
+func (rc *RequestCollapser) Close() {}
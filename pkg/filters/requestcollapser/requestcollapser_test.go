@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestcollapser
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+func newRequestCollapser(t *testing.T, yamlSpec string) *RequestCollapser {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(t, err)
+
+	rc := kind.CreateInstance(spec).(*RequestCollapser)
+	rc.Init()
+	return rc
+}
+
+// serve handles a request by the collapser, and responds by upstream if
+// the request is not collapsed.
+func serve(rc *RequestCollapser, r *http.Request, upstream func(resp *httpprot.Response)) (*httpprot.Response, string) {
+	req, _ := httpprot.NewRequest(r)
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+
+	result := rc.Handle(ctx)
+	if result != resultCollapsed {
+		resp, _ := httpprot.NewResponse(nil)
+		upstream(resp)
+		ctx.SetOutputResponse(resp)
+	}
+	resp := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	ctx.Finish()
+	return resp, result
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte("kind: RequestCollapser\nname: rc\nmethods: [POST]"), &rawSpec))
+	_, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.Error(err)
+
+	assert.NoError(codectool.Unmarshal([]byte("kind: RequestCollapser\nname: rc\ntimeout: 10"), &rawSpec))
+	_, err = filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.Error(err)
+}
+
+func TestRequestCollapser(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newRequestCollapser(t, `
+kind: RequestCollapser
+name: rc
+timeout: 5s
+`)
+	defer rc.Close()
+
+	var upstreamCalls int32
+	release := make(chan struct{})
+	upstream := func(resp *httpprot.Response) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		<-release
+		resp.HTTPHeader().Set("Content-Type", "text/plain")
+		resp.SetPayload([]byte("hello"))
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var collapsed int32
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/hot", nil)
+			resp, result := serve(rc, stdr, upstream)
+			assert.Equal(http.StatusOK, resp.StatusCode())
+			assert.Equal("hello", string(resp.RawPayload()))
+			if result == resultCollapsed {
+				atomic.AddInt32(&collapsed, 1)
+				assert.Equal("true", resp.HTTPHeader().Get(headerCollapsed))
+			}
+		}()
+	}
+
+	// wait for the requests to queue behind the leader.
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&upstreamCalls) == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(int32(1), atomic.LoadInt32(&upstreamCalls))
+	assert.Equal(int32(n-1), collapsed)
+
+	status := rc.Status().(*Status)
+	assert.Equal(0, status.InFlight)
+	assert.Equal(uint64(1), status.Leaders)
+	assert.Equal(uint64(n-1), status.Collapsed)
+
+	// requests with credentials are not collapsed.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/hot", nil)
+	stdr.Header.Set("Authorization", "Bearer abc")
+	_, result := serve(rc, stdr, upstream)
+	assert.Equal("", result)
+	assert.Equal(uint64(1), rc.Status().(*Status).Leaders)
+}
+
+func TestUnsharedResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := newRequestCollapser(t, `
+kind: RequestCollapser
+name: rc
+timeout: 5s
+`)
+	defer rc.Close()
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/login", nil)
+		serve(rc, stdr, func(resp *httpprot.Response) {
+			<-release
+			resp.HTTPHeader().Set("Set-Cookie", "session=abc")
+		})
+		close(done)
+	}()
+	assert.Eventually(func() bool {
+		return rc.Status().(*Status).InFlight == 1
+	}, time.Second, 10*time.Millisecond)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+
+	// the response with cookies is not shared, the waiting request is
+	// sent by itself.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/login", nil)
+	resp, result := serve(rc, stdr, func(resp *httpprot.Response) {
+		resp.SetStatusCode(http.StatusAccepted)
+	})
+	assert.Equal("", result)
+	assert.Equal(http.StatusAccepted, resp.StatusCode())
+	<-done
+	assert.Equal(uint64(1), rc.Status().(*Status).Fallbacks)
+}
@@ -18,6 +18,7 @@
 package responseadaptor
 
 import (
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -28,6 +29,7 @@ import (
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
 	"github.com/megaease/easegress/pkg/util/readers"
+	"github.com/megaease/easegress/pkg/util/spectemplate"
 )
 
 const (
@@ -66,6 +68,10 @@ type (
 	// ResponseAdaptor is filter ResponseAdaptor.
 	ResponseAdaptor struct {
 		spec *Spec
+
+		// the header templates are rendered by the request.
+		headerSet map[string]*spectemplate.Template
+		headerAdd map[string]*spectemplate.Template
 	}
 
 	// Spec is HTTPAdaptor Spec.
@@ -79,6 +85,20 @@ type (
 	}
 )
 
+// Validate validates the templates of the headers.
+func (spec *Spec) Validate() error {
+	if spec.Header == nil {
+		return nil
+	}
+	if _, err := spectemplate.CompileMap(spec.Header.Set); err != nil {
+		return fmt.Errorf("header set: %v", err)
+	}
+	if _, err := spectemplate.CompileMap(spec.Header.Add); err != nil {
+		return fmt.Errorf("header add: %v", err)
+	}
+	return nil
+}
+
 // Name returns the name of the ResponseAdaptor filter instance.
 func (ra *ResponseAdaptor) Name() string {
 	return ra.spec.Name()
@@ -117,19 +137,24 @@ func (ra *ResponseAdaptor) Inherit(previousGeneration filters.Filter) {
 }
 
 func (ra *ResponseAdaptor) reload() {
-	// Nothing to do.
+	if ra.spec.Header != nil {
+		ra.headerSet, _ = spectemplate.CompileMap(ra.spec.Header.Set)
+		ra.headerAdd, _ = spectemplate.CompileMap(ra.spec.Header.Add)
+	}
 }
 
-func adaptHeader(req *httpprot.Response, as *httpheader.AdaptSpec) {
-	h := req.Std().Header
-	for _, key := range as.Del {
+// adaptHeader adapts the header of resp, the templates are rendered by
+// req, which could be nil.
+func (ra *ResponseAdaptor) adaptHeader(req *httpprot.Request, resp *httpprot.Response) {
+	h := resp.Std().Header
+	for _, key := range ra.spec.Header.Del {
 		h.Del(key)
 	}
-	for key, value := range as.Set {
-		h.Set(key, value)
+	for key, t := range ra.headerSet {
+		h.Set(key, t.Render(req, spectemplate.EscapeHeaderValue))
 	}
-	for key, value := range as.Add {
-		h.Add(key, value)
+	for key, t := range ra.headerAdd {
+		h.Add(key, t.Render(req, spectemplate.EscapeHeaderValue))
 	}
 }
 
@@ -142,7 +167,8 @@ func (ra *ResponseAdaptor) Handle(ctx *context.Context) string {
 	egresp := resp.(*httpprot.Response)
 
 	if ra.spec.Header != nil {
-		adaptHeader(egresp, ra.spec.Header)
+		req, _ := ctx.GetInputRequest().(*httpprot.Request)
+		ra.adaptHeader(req, egresp)
 	}
 
 	if len(ra.spec.Body) != 0 {
@@ -226,3 +226,47 @@ func TestCompressDecompress(t *testing.T) {
 		assert.Equal(resultDecompressFailed, res)
 	}
 }
+
+func TestResponseAdaptorTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlSpec := `
+kind: ResponseAdaptor
+name: ra
+header:
+  set:
+    "X-Set": "${req.header}"
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlSpec), &rawSpec)
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+
+	yamlSpec = `
+kind: ResponseAdaptor
+name: ra
+header:
+  set:
+    "X-Request-Id": "${req.header.X-Request-Id}"
+`
+	rawSpec = make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlSpec), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	ra := kind.CreateInstance(spec)
+	ra.Init()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/abc", nil)
+	stdr.Header.Set("X-Request-Id", "123\n")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	resp, err := httpprot.NewResponse(nil)
+	assert.NoError(err)
+	ctx.SetInputResponse(resp)
+
+	ra.Handle(ctx)
+	assert.Equal("123", resp.Std().Header.Get("X-Request-Id"))
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryqueue
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+const (
+	// StatePending is the state of the items waiting for the next attempt.
+	StatePending = "pending"
+	// StateDead is the state of the items failed after all the attempts and
+	// not accepted by the dead letter URL, they are kept until requeued or
+	// deleted.
+	StateDead = "dead"
+
+	deliveryDelivered        = "delivered"
+	deliveryRetried          = "retried"
+	deliveryDead             = "dead"
+	deliveryDeadLettered     = "deadLettered"
+	deliveryDeadLetterFailed = "deadLetterFailed"
+
+	// maxErrorLength is the max length of the last error of an item.
+	maxErrorLength = 256
+)
+
+// hopHeaders are the hop-by-hop headers, which are not queued.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+var (
+	depthGauge = prometheushelper.NewGauge(
+		"retry_queue_depth",
+		"The number of items in the retry queue, by the state.",
+		[]string{"pipeline", "filter", "state"},
+	)
+	deliveryCounter = prometheushelper.NewCounter(
+		"retry_queue_deliveries_total",
+		"The number of deliveries of the retry queue, by the result.",
+		[]string{"pipeline", "filter", "result"},
+	)
+)
+
+// idSeq makes the IDs created in the same nanosecond unique.
+var idSeq uint32
+
+type (
+	// Item is a queued request.
+	Item struct {
+		ID string `json:"id"`
+		// URL is the path and the query of the request.
+		URL         string      `json:"url"`
+		Method      string      `json:"method"`
+		Header      http.Header `json:"header"`
+		Body        []byte      `json:"body,omitempty"`
+		State       string      `json:"state"`
+		Attempts    int         `json:"attempts"`
+		CreatedAt   time.Time   `json:"createdAt"`
+		NextAttempt time.Time   `json:"nextAttempt"`
+		LastError   string      `json:"lastError,omitempty"`
+	}
+
+	queue struct {
+		spec   *Spec
+		store  store
+		client *http.Client
+
+		initialInterval time.Duration
+		maxInterval     time.Duration
+
+		// size is the number of the items, it is refreshed by each poll.
+		size    int64
+		pending int64
+		dead    int64
+
+		// done stops the polling, and abort cancels the ongoing delivery.
+		done     chan struct{}
+		abort    chan struct{}
+		stopOnce sync.Once
+		wg       sync.WaitGroup
+	}
+)
+
+func newItemID(now time.Time) string {
+	seq := atomic.AddUint32(&idSeq, 1) % 10000
+	return fmt.Sprintf("%019d-%04d", now.UnixNano(), seq)
+}
+
+func newQueue(spec *Spec, s store) *queue {
+	q := &queue{
+		spec:  spec,
+		store: s,
+		done:  make(chan struct{}),
+		abort: make(chan struct{}),
+	}
+
+	timeout, _ := time.ParseDuration(spec.Timeout)
+	q.client = &http.Client{Timeout: timeout}
+	q.initialInterval, _ = time.ParseDuration(spec.InitialInterval)
+	q.maxInterval, _ = time.ParseDuration(spec.MaxInterval)
+	pollInterval, _ := time.ParseDuration(spec.PollInterval)
+
+	q.wg.Add(1)
+	go q.run(pollInterval)
+	return q
+}
+
+func (q *queue) status() *Status {
+	return &Status{
+		Pending: int(atomic.LoadInt64(&q.pending)),
+		Dead:    int(atomic.LoadInt64(&q.dead)),
+	}
+}
+
+func (q *queue) enqueue(item *Item) error {
+	if atomic.LoadInt64(&q.size) >= int64(q.spec.MaxItems) {
+		return fmt.Errorf("queue is full")
+	}
+
+	now := time.Now()
+	item.ID = newItemID(now)
+	item.State = StatePending
+	item.CreatedAt = now
+	item.NextAttempt = now.Add(q.initialInterval)
+	if err := q.store.put(item); err != nil {
+		return err
+	}
+	atomic.AddInt64(&q.size, 1)
+	return nil
+}
+
+func (q *queue) requeue(item *Item) error {
+	item.State = StatePending
+	item.Attempts = 0
+	item.NextAttempt = time.Now()
+	return q.store.put(item)
+}
+
+// backoff returns the interval before the next attempt of an item which
+// has been attempted for attempts times.
+func (q *queue) backoff(attempts int) time.Duration {
+	d := float64(q.initialInterval) * math.Pow(q.spec.Multiplier, float64(attempts-1))
+	if d > float64(q.maxInterval) {
+		return q.maxInterval
+	}
+	return time.Duration(d)
+}
+
+func (q *queue) run(pollInterval time.Duration) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			q.poll()
+		}
+	}
+}
+
+// poll delivers the items due, and refreshes the metrics.
+func (q *queue) poll() {
+	items, err := q.store.list()
+	if err != nil {
+		logger.Errorf("%s: list items failed: %v", q.spec.Name(), err)
+		return
+	}
+
+	deliver := true
+	if s, ok := q.store.(*etcdStore); ok && !s.cls.IsLeader() {
+		deliver = false
+	}
+
+	now := time.Now()
+	var pending, dead int64
+	for _, item := range items {
+		if deliver && item.State == StatePending && !item.NextAttempt.After(now) {
+			q.process(item)
+		}
+
+		select {
+		case <-q.done:
+			return
+		default:
+		}
+
+		switch item.State {
+		case StatePending:
+			pending++
+		case StateDead:
+			dead++
+		}
+	}
+
+	atomic.StoreInt64(&q.size, int64(len(items)))
+	atomic.StoreInt64(&q.pending, pending)
+	atomic.StoreInt64(&q.dead, dead)
+	depthGauge.With(q.stateLabels(StatePending)).Set(float64(pending))
+	depthGauge.With(q.stateLabels(StateDead)).Set(float64(dead))
+}
+
+// process delivers the item, and updates or deletes it by the result, the
+// state of the item is updated in place, so that poll counts it.
+func (q *queue) process(item *Item) {
+	item.Attempts++
+	retryable, err := q.send(q.spec.URL+item.URL, item, nil)
+	if err == nil {
+		q.count(deliveryDelivered)
+		if err := q.store.delete(item.ID); err != nil {
+			logger.Errorf("%s: delete item %s failed: %v", q.spec.Name(), item.ID, err)
+		}
+		item.State = ""
+		return
+	}
+
+	item.LastError = err.Error()
+	if len(item.LastError) > maxErrorLength {
+		item.LastError = item.LastError[:maxErrorLength]
+	}
+
+	if retryable && item.Attempts < q.spec.MaxAttempts {
+		q.count(deliveryRetried)
+		item.NextAttempt = time.Now().Add(q.backoff(item.Attempts))
+		q.save(item)
+		return
+	}
+
+	q.count(deliveryDead)
+	if q.spec.DeadLetterURL != "" && q.deadLetter(item) {
+		item.State = ""
+		return
+	}
+	item.State = StateDead
+	q.save(item)
+}
+
+// deadLetter sends the item to the dead letter URL, and deletes it if
+// succeeded.
+func (q *queue) deadLetter(item *Item) bool {
+	header := http.Header{}
+	header.Set("X-Eg-Retry-Id", item.ID)
+	header.Set("X-Eg-Retry-Url", item.URL)
+	header.Set("X-Eg-Retry-Attempts", strconv.Itoa(item.Attempts))
+	header.Set("X-Eg-Retry-Last-Error", item.LastError)
+
+	if _, err := q.send(q.spec.DeadLetterURL, item, header); err != nil {
+		q.count(deliveryDeadLetterFailed)
+		logger.Errorf("%s: send item %s to dead letter url failed: %v", q.spec.Name(), item.ID, err)
+		return false
+	}
+
+	q.count(deliveryDeadLettered)
+	if err := q.store.delete(item.ID); err != nil {
+		logger.Errorf("%s: delete item %s failed: %v", q.spec.Name(), item.ID, err)
+	}
+	return true
+}
+
+func (q *queue) save(item *Item) {
+	if err := q.store.put(item); err != nil {
+		logger.Errorf("%s: update item %s failed: %v", q.spec.Name(), item.ID, err)
+	}
+}
+
+// send sends the request of the item to the URL with the extra headers,
+// it returns whether the failure is retryable, i.e. the request failed or
+// the status code of the response is in RetryOn. The other status codes
+// than 2xx and 3xx are failures which are not retryable.
+func (q *queue) send(url string, item *Item, extra http.Header) (bool, error) {
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-q.abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, item.Method, url, bytes.NewReader(item.Body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range item.Header {
+		req.Header[name] = values
+	}
+	for name, values := range extra {
+		req.Header[name] = values
+	}
+	req.Header.Del("Content-Length")
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	if resp.StatusCode < 400 {
+		return false, nil
+	}
+	err = fmt.Errorf("status code %d", resp.StatusCode)
+	for _, c := range q.spec.RetryOn {
+		if c == resp.StatusCode {
+			return true, err
+		}
+	}
+	return false, err
+}
+
+func (q *queue) count(result string) {
+	deliveryCounter.With(prometheus.Labels{
+		"pipeline": q.spec.Pipeline(),
+		"filter":   q.spec.Name(),
+		"result":   result,
+	}).Inc()
+}
+
+func (q *queue) stateLabels(state string) prometheus.Labels {
+	return prometheus.Labels{
+		"pipeline": q.spec.Pipeline(),
+		"filter":   q.spec.Name(),
+		"state":    state,
+	}
+}
+
+// stop stops delivering the items and waits for the ongoing delivery, the
+// items could still be enqueued.
+func (q *queue) stop() {
+	q.stopOnce.Do(func() {
+		close(q.done)
+	})
+	q.wg.Wait()
+}
+
+func (q *queue) close() {
+	close(q.abort)
+	q.stop()
+	q.store.close()
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package retryqueue provides the RetryQueue filter.
+package retryqueue
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of RetryQueue.
+	Kind = "RetryQueue"
+
+	resultNotQueued = "notQueued"
+
+	storageEtcd  = "etcd"
+	storageLocal = "local"
+
+	defaultDBFile = "retryqueue.db"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "RetryQueue queues the failed requests and retries them asynchronously",
+	Results:     []string{resultNotQueued},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Storage:         storageEtcd,
+			RetryOn:         []int{429, 500, 502, 503, 504},
+			MaxAttempts:     10,
+			InitialInterval: "1s",
+			MaxInterval:     "5m",
+			Multiplier:      2,
+			PollInterval:    "1s",
+			Timeout:         "10s",
+			MaxBodySize:     1024 * 1024,
+			MaxItems:        10000,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &RetryQueue{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*RetryQueue)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// RetryQueue is the filter RetryQueue.
+	RetryQueue struct {
+		spec  *Spec
+		queue *queue
+	}
+
+	// Spec describes the RetryQueue.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// URL is the base URL of the upstream, the path and the query of
+		// the request are appended to it on retrying.
+		URL string `json:"url" jsonschema:"required,format=url"`
+		// DeadLetterURL receives the requests failed after all the attempts,
+		// the requests are kept in the queue as dead if it is empty.
+		DeadLetterURL string `json:"deadLetterURL,omitempty" jsonschema:"omitempty,format=url"`
+		// Storage is etcd or local, the etcd queue is shared by all the
+		// members and delivered by the leader, the local queue is stored in
+		// Path and delivered by the member itself.
+		Storage string `json:"storage" jsonschema:"omitempty,enum=,enum=etcd,enum=local"`
+		// Path is the database file of the local queue, the default is
+		// retryqueue.db in the data directory.
+		Path string `json:"path,omitempty" jsonschema:"omitempty"`
+		// RetryOn are the status codes of the responses to queue, the
+		// requests without responses, e.g. the Proxy failed to connect the
+		// upstream, are always queued.
+		RetryOn         []int   `json:"retryOn,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		MaxAttempts     int     `json:"maxAttempts" jsonschema:"omitempty,minimum=1"`
+		InitialInterval string  `json:"initialInterval" jsonschema:"omitempty,format=duration"`
+		MaxInterval     string  `json:"maxInterval" jsonschema:"omitempty,format=duration"`
+		Multiplier      float64 `json:"multiplier" jsonschema:"omitempty,minimum=1"`
+		PollInterval    string  `json:"pollInterval" jsonschema:"omitempty,format=duration"`
+		// Timeout is the timeout of a delivery.
+		Timeout     string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxBodySize int64  `json:"maxBodySize" jsonschema:"omitempty,minimum=1"`
+		MaxItems    int    `json:"maxItems" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of RetryQueue.
+	Status struct {
+		Pending int `json:"pending"`
+		Dead    int `json:"dead"`
+	}
+)
+
+var (
+	queuesLock sync.Mutex
+	queues     = map[string]*RetryQueue{}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	for _, u := range []string{s.URL, s.DeadLetterURL} {
+		if u == "" {
+			continue
+		}
+		pu, err := url.Parse(u)
+		if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+			return fmt.Errorf("invalid url %s: scheme must be http or https", u)
+		}
+	}
+
+	durations := map[string]string{
+		"initialInterval": s.InitialInterval,
+		"maxInterval":     s.MaxInterval,
+		"pollInterval":    s.PollInterval,
+		"timeout":         s.Timeout,
+	}
+	for name, v := range durations {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %s", name, v)
+		}
+	}
+	return nil
+}
+
+// Find returns the RetryQueue of the pipeline running on this member, it
+// returns nil if not found.
+func Find(pipeline, filter string) *RetryQueue {
+	queuesLock.Lock()
+	defer queuesLock.Unlock()
+	return queues[pipeline+"/"+filter]
+}
+
+// Name returns the name of the RetryQueue filter instance.
+func (rq *RetryQueue) Name() string {
+	return rq.spec.Name()
+}
+
+// Kind returns the kind of RetryQueue.
+func (rq *RetryQueue) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the RetryQueue
+func (rq *RetryQueue) Spec() filters.Spec {
+	return rq.spec
+}
+
+// Init initializes RetryQueue.
+func (rq *RetryQueue) Init() {
+	rq.reload()
+}
+
+// Inherit inherits previous generation of RetryQueue.
+func (rq *RetryQueue) Inherit(previousGeneration filters.Filter) {
+	// The previous generation is closed after this one is ready, stop its
+	// delivery first, so that an item is not delivered by both of them.
+	if prev := previousGeneration.(*RetryQueue); prev.queue != nil {
+		prev.queue.stop()
+	}
+	rq.reload()
+}
+
+func (rq *RetryQueue) reload() {
+	store, err := rq.newStore()
+	if err != nil {
+		logger.Errorf("%s: create store failed, requests won't be queued: %v", rq.Name(), err)
+		return
+	}
+
+	rq.queue = newQueue(rq.spec, store)
+	queuesLock.Lock()
+	queues[rq.spec.Pipeline()+"/"+rq.Name()] = rq
+	queuesLock.Unlock()
+}
+
+func (rq *RetryQueue) newStore() (store, error) {
+	super := rq.spec.Super()
+	if rq.spec.Storage == storageLocal {
+		path := rq.spec.Path
+		if path == "" {
+			path = defaultDBFile
+		}
+		if !filepath.IsAbs(path) && super != nil {
+			path = filepath.Join(super.Options().AbsDataDir, path)
+		}
+		return newBoltStore(path, rq.spec.Pipeline(), rq.Name())
+	}
+
+	if super == nil || super.Cluster() == nil {
+		return nil, fmt.Errorf("cluster is unavailable")
+	}
+	return newEtcdStore(super.Cluster(), rq.spec.Pipeline(), rq.Name()), nil
+}
+
+// RequiresBody implements filters.BodyRequirer. The request body is
+// required to queue the request.
+func (rq *RetryQueue) RequiresBody() (request, response bool) {
+	return true, false
+}
+
+// Status returns status.
+func (rq *RetryQueue) Status() interface{} {
+	if rq.queue == nil {
+		return nil
+	}
+	return rq.queue.status()
+}
+
+// Close closes RetryQueue.
+func (rq *RetryQueue) Close() {
+	key := rq.spec.Pipeline() + "/" + rq.Name()
+	queuesLock.Lock()
+	if queues[key] == rq {
+		delete(queues, key)
+	}
+	queuesLock.Unlock()
+
+	if rq.queue != nil {
+		rq.queue.close()
+	}
+}
+
+// Handle queues the request if the upstream failed, i.e. the context has
+// no response or the status code of the response is in RetryOn, and
+// responds 202 with the ID of the queued item.
+func (rq *RetryQueue) Handle(ctx *context.Context) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp != nil && !rq.shouldRetry(resp.StatusCode()) {
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	item, err := rq.enqueue(req)
+	if err != nil {
+		ctx.AddTag(fmt.Sprintf("%s: request not queued: %v", rq.Name(), err))
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+			resp.SetStatusCode(http.StatusServiceUnavailable)
+			ctx.SetOutputResponse(resp)
+		}
+		return resultNotQueued
+	}
+
+	resp, _ = httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusAccepted)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(codectool.MustMarshalJSON(map[string]string{"id": item.ID}))
+	ctx.SetOutputResponse(resp)
+	return ""
+}
+
+func (rq *RetryQueue) shouldRetry(code int) bool {
+	for _, c := range rq.spec.RetryOn {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (rq *RetryQueue) enqueue(req *httpprot.Request) (*Item, error) {
+	if rq.queue == nil {
+		return nil, fmt.Errorf("queue is unavailable")
+	}
+	if req.IsStream() {
+		return nil, fmt.Errorf("stream body")
+	}
+	body := req.RawPayload()
+	if int64(len(body)) > rq.spec.MaxBodySize {
+		return nil, fmt.Errorf("body size %d exceeds %d", len(body), rq.spec.MaxBodySize)
+	}
+
+	header := req.HTTPHeader().Clone()
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	item := &Item{
+		Method: req.Method(),
+		URL:    req.Std().URL.RequestURI(),
+		Header: header,
+		Body:   body,
+	}
+	if err := rq.queue.enqueue(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// Items returns the items in the queue, all items are returned if state
+// is empty.
+func (rq *RetryQueue) Items(state string) ([]*Item, error) {
+	items, err := rq.queue.store.list()
+	if err != nil || state == "" {
+		return items, err
+	}
+
+	result := []*Item{}
+	for _, item := range items {
+		if item.State == state {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// Item returns the item of the ID, it returns nil if not found.
+func (rq *RetryQueue) Item(id string) (*Item, error) {
+	return rq.queue.store.get(id)
+}
+
+// DeleteItem deletes the item of the ID, it returns false if not found.
+func (rq *RetryQueue) DeleteItem(id string) (bool, error) {
+	item, err := rq.queue.store.get(id)
+	if err != nil || item == nil {
+		return false, err
+	}
+	return true, rq.queue.store.delete(id)
+}
+
+// Requeue resets the attempts of the item of the ID and delivers it again
+// as soon as possible, it returns false if not found.
+func (rq *RetryQueue) Requeue(id string) (bool, error) {
+	item, err := rq.queue.store.get(id)
+	if err != nil || item == nil {
+		return false, err
+	}
+	return true, rq.queue.requeue(item)
+}
+
+// RequeueDead requeues all the dead items, and returns the number of them.
+func (rq *RetryQueue) RequeueDead() (int, error) {
+	items, err := rq.Items(StateDead)
+	if err != nil {
+		return 0, err
+	}
+	for i, item := range items {
+		if err := rq.queue.requeue(item); err != nil {
+			return i, err
+		}
+	}
+	return len(items), nil
+}
@@ -0,0 +1,402 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryqueue
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	os.Exit(m.Run())
+}
+
+// upstream is a fake upstream, it responds the status codes in order, and
+// the last one for the rest requests.
+type upstream struct {
+	sync.Mutex
+	*httptest.Server
+	codes    []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newUpstream(codes ...int) *upstream {
+	u := &upstream{codes: codes}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.Lock()
+		defer u.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		u.requests = append(u.requests, r)
+		u.bodies = append(u.bodies, string(body))
+		code := u.codes[0]
+		if len(u.codes) > 1 {
+			u.codes = u.codes[1:]
+		}
+		w.WriteHeader(code)
+	}))
+	return u
+}
+
+func newRetryQueue(t *testing.T, yamlSpec string) *RetryQueue {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	assert.NoError(t, err)
+
+	spec, err := filters.NewSpec(nil, "pipeline", rawSpec)
+	assert.NoError(t, err)
+
+	rq := kind.CreateInstance(spec).(*RetryQueue)
+	rq.Init()
+	return rq
+}
+
+func localSpec(t *testing.T, url, extra string) string {
+	path := filepath.Join(t.TempDir(), "queue.db")
+	return fmt.Sprintf(`
+name: rq
+kind: RetryQueue
+url: %s
+storage: local
+path: %s
+initialInterval: 1ms
+maxInterval: 4ms
+pollInterval: 1h
+%s`, url, path, extra)
+}
+
+func newContext(t *testing.T, code int) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/hooks?id=1", strings.NewReader("event"))
+	stdr.Header.Set("X-Event", "created")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	if code != 0 {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(code)
+		ctx.SetOutputResponse(resp)
+	}
+	return ctx
+}
+
+// waitDue waits for the items to be due.
+func waitDue() {
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{URL: "ftp://example.com"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{URL: "http://example.com", DeadLetterURL: "example.com"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{URL: "http://example.com", MaxInterval: "-1s"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{URL: "http://example.com", Timeout: "1s"}
+	assert.NoError(spec.Validate())
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	rq := newRetryQueue(t, localSpec(t, "http://127.0.0.1:1", ""))
+	defer rq.Close()
+	assert.Same(rq, Find("pipeline", "rq"))
+
+	// succeeded, not queued.
+	ctx := newContext(t, http.StatusOK)
+	assert.Equal("", rq.Handle(ctx))
+	assert.Equal(http.StatusOK, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// failed with a status code not to retry.
+	ctx = newContext(t, http.StatusBadRequest)
+	assert.Equal("", rq.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// no response and server error are queued.
+	for _, code := range []int{0, http.StatusServiceUnavailable} {
+		ctx = newContext(t, code)
+		assert.Equal("", rq.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusAccepted, resp.StatusCode())
+		result := map[string]string{}
+		assert.NoError(codectool.UnmarshalJSON(resp.RawPayload(), &result))
+		assert.NotEmpty(result["id"])
+	}
+
+	items, err := rq.Items("")
+	assert.NoError(err)
+	assert.Len(items, 2)
+	assert.True(items[0].ID < items[1].ID)
+	item := items[0]
+	assert.Equal(StatePending, item.State)
+	assert.Equal(http.MethodPost, item.Method)
+	assert.Equal("/hooks?id=1", item.URL)
+	assert.Equal("event", string(item.Body))
+	assert.Equal("created", item.Header.Get("X-Event"))
+}
+
+func TestHandleNotQueued(t *testing.T) {
+	assert := assert.New(t)
+
+	rq := newRetryQueue(t, localSpec(t, "http://127.0.0.1:1", "maxBodySize: 2\n"))
+	defer rq.Close()
+
+	ctx := newContext(t, 0)
+	assert.Equal(resultNotQueued, rq.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, http.StatusBadGateway)
+	assert.Equal(resultNotQueued, rq.Handle(ctx))
+	assert.Equal(http.StatusBadGateway, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	rq = newRetryQueue(t, localSpec(t, "http://127.0.0.1:1", "maxItems: 1\n"))
+	defer rq.Close()
+	assert.Equal("", rq.Handle(newContext(t, 0)))
+	assert.Equal(resultNotQueued, rq.Handle(newContext(t, 0)))
+}
+
+func TestDeliver(t *testing.T) {
+	assert := assert.New(t)
+
+	u := newUpstream(http.StatusServiceUnavailable, http.StatusOK)
+	defer u.Close()
+
+	rq := newRetryQueue(t, localSpec(t, u.URL, ""))
+	defer rq.Close()
+	rq.Handle(newContext(t, 0))
+
+	// the first attempt failed, and the item is retried later.
+	waitDue()
+	rq.queue.poll()
+	items, _ := rq.Items(StatePending)
+	assert.Len(items, 1)
+	assert.Equal(1, items[0].Attempts)
+	assert.Equal("status code 503", items[0].LastError)
+	assert.Equal(&Status{Pending: 1}, rq.Status())
+
+	waitDue()
+	rq.queue.poll()
+	items, _ = rq.Items("")
+	assert.Empty(items)
+	assert.Equal(&Status{}, rq.Status())
+
+	assert.Len(u.requests, 2)
+	r := u.requests[1]
+	assert.Equal(http.MethodPost, r.Method)
+	assert.Equal("/hooks?id=1", r.URL.RequestURI())
+	assert.Equal("created", r.Header.Get("X-Event"))
+	assert.Equal("event", u.bodies[1])
+}
+
+func TestDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+
+	u := newUpstream(http.StatusServiceUnavailable)
+	defer u.Close()
+	dl := newUpstream(http.StatusInternalServerError, http.StatusOK)
+	defer dl.Close()
+
+	extra := fmt.Sprintf("maxAttempts: 2\ndeadLetterURL: %s/dead\n", dl.URL)
+	rq := newRetryQueue(t, localSpec(t, u.URL, extra))
+	defer rq.Close()
+	rq.Handle(newContext(t, 0))
+
+	waitDue()
+	rq.queue.poll()
+	waitDue()
+	rq.queue.poll()
+
+	// the dead letter URL failed, the item is kept as dead.
+	items, _ := rq.Items(StateDead)
+	assert.Len(items, 1)
+	assert.Equal(2, items[0].Attempts)
+	assert.Equal(&Status{Dead: 1}, rq.Status())
+	assert.Len(dl.requests, 1)
+	assert.Equal("/dead", dl.requests[0].URL.Path)
+	assert.Equal("2", dl.requests[0].Header.Get("X-Eg-Retry-Attempts"))
+	assert.Equal("/hooks?id=1", dl.requests[0].Header.Get("X-Eg-Retry-Url"))
+
+	// requeue it, and it is sent to the dead letter URL after the attempts.
+	n, err := rq.RequeueDead()
+	assert.NoError(err)
+	assert.Equal(1, n)
+	for i := 0; i < 2; i++ {
+		waitDue()
+		rq.queue.poll()
+	}
+	items, _ = rq.Items("")
+	assert.Empty(items)
+	assert.Len(dl.requests, 2)
+	assert.Len(u.requests, 4)
+}
+
+func TestNotRetryable(t *testing.T) {
+	assert := assert.New(t)
+
+	u := newUpstream(http.StatusBadRequest)
+	defer u.Close()
+
+	rq := newRetryQueue(t, localSpec(t, u.URL, ""))
+	defer rq.Close()
+	rq.Handle(newContext(t, 0))
+
+	waitDue()
+	rq.queue.poll()
+	items, _ := rq.Items(StateDead)
+	assert.Len(items, 1)
+	assert.Equal(1, items[0].Attempts)
+	assert.Equal("status code 400", items[0].LastError)
+}
+
+func TestItemAPIs(t *testing.T) {
+	assert := assert.New(t)
+
+	rq := newRetryQueue(t, localSpec(t, "http://127.0.0.1:1", ""))
+	defer rq.Close()
+	rq.Handle(newContext(t, 0))
+	items, _ := rq.Items("")
+	id := items[0].ID
+
+	item, err := rq.Item(id)
+	assert.NoError(err)
+	assert.Equal(id, item.ID)
+	item, err = rq.Item("none")
+	assert.NoError(err)
+	assert.Nil(item)
+
+	item, _ = rq.Item(id)
+	item.State, item.Attempts = StateDead, 3
+	assert.NoError(rq.queue.store.put(item))
+
+	ok, err := rq.Requeue(id)
+	assert.NoError(err)
+	assert.True(ok)
+	item, _ = rq.Item(id)
+	assert.Equal(StatePending, item.State)
+	assert.Equal(0, item.Attempts)
+
+	ok, _ = rq.Requeue("none")
+	assert.False(ok)
+
+	ok, err = rq.DeleteItem(id)
+	assert.NoError(err)
+	assert.True(ok)
+	ok, _ = rq.DeleteItem(id)
+	assert.False(ok)
+}
+
+func TestInherit(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlSpec := localSpec(t, "http://127.0.0.1:1", "")
+	rq1 := newRetryQueue(t, yamlSpec)
+	rq1.Handle(newContext(t, 0))
+
+	// the generations share the database file.
+	rawSpec := make(map[string]interface{})
+	codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	spec, _ := filters.NewSpec(nil, "pipeline", rawSpec)
+	rq2 := kind.CreateInstance(spec).(*RetryQueue)
+	rq2.Inherit(rq1)
+	rq1.Close()
+
+	assert.Same(rq2, Find("pipeline", "rq"))
+	items, err := rq2.Items("")
+	assert.NoError(err)
+	assert.Len(items, 1)
+
+	rq2.Close()
+	assert.Nil(Find("pipeline", "rq"))
+}
+
+func TestInheritPending(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	requests := 0
+	u := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+		// a slow upstream, so that the delivery is ongoing on reloading.
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer u.Close()
+
+	yamlSpec := strings.Replace(localSpec(t, u.URL, ""), "pollInterval: 1h", "pollInterval: 1ms", 1)
+	rq1 := newRetryQueue(t, yamlSpec)
+	rq1.Handle(newContext(t, 0))
+	waitDue()
+
+	rawSpec := make(map[string]interface{})
+	codectool.Unmarshal([]byte(yamlSpec), &rawSpec)
+	spec, _ := filters.NewSpec(nil, "pipeline", rawSpec)
+	rq2 := kind.CreateInstance(spec).(*RetryQueue)
+	rq2.Inherit(rq1)
+	defer rq2.Close()
+
+	// the previous generation is closed later than the new one is ready.
+	time.Sleep(100 * time.Millisecond)
+	rq1.Close()
+
+	items, err := rq2.Items("")
+	assert.NoError(err)
+	assert.Empty(items)
+	lock.Lock()
+	assert.Equal(1, requests)
+	lock.Unlock()
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	q := &queue{
+		spec:            &Spec{Multiplier: 2},
+		initialInterval: time.Second,
+		maxInterval:     5 * time.Second,
+	}
+	assert.Equal(time.Second, q.backoff(1))
+	assert.Equal(2*time.Second, q.backoff(2))
+	assert.Equal(4*time.Second, q.backoff(3))
+	assert.Equal(5*time.Second, q.backoff(4))
+}
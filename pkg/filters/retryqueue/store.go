@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retryqueue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// store stores the items of a queue, the items are listed in the order
+	// of their IDs, which is the order they are queued.
+	store interface {
+		put(item *Item) error
+		// get returns nil if the item doesn't exist.
+		get(id string) (*Item, error)
+		delete(id string) error
+		list() ([]*Item, error)
+		// shared returns whether the store is shared by all the members,
+		// the items of a shared store are delivered by the leader only.
+		shared() bool
+		close()
+	}
+
+	etcdStore struct {
+		cls    cluster.Cluster
+		prefix string
+	}
+
+	boltStore struct {
+		db     *boltDB
+		bucket []byte
+	}
+
+	// boltDB is a bolt database shared by the queues using the same file,
+	// a file can't be opened twice by a process, and the generations of a
+	// queue overlap when the pipeline is updated.
+	boltDB struct {
+		*bolt.DB
+		path string
+		refs int
+	}
+)
+
+var (
+	boltDBsLock sync.Mutex
+	boltDBs     = map[string]*boltDB{}
+)
+
+func newEtcdStore(cls cluster.Cluster, pipeline, filter string) *etcdStore {
+	return &etcdStore{
+		cls:    cls,
+		prefix: cls.Layout().RetryQueuePrefix(pipeline, filter),
+	}
+}
+
+func (s *etcdStore) put(item *Item) error {
+	return s.cls.Put(s.prefix+item.ID, string(codectool.MustMarshalJSON(item)))
+}
+
+func (s *etcdStore) get(id string) (*Item, error) {
+	value, err := s.cls.Get(s.prefix + id)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	item := &Item{}
+	if err := codectool.UnmarshalJSON([]byte(*value), item); err != nil {
+		return nil, fmt.Errorf("unmarshal item %s failed: %v", id, err)
+	}
+	return item, nil
+}
+
+func (s *etcdStore) delete(id string) error {
+	return s.cls.Delete(s.prefix + id)
+}
+
+func (s *etcdStore) list() ([]*Item, error) {
+	kvs, err := s.cls.GetPrefix(s.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*Item, 0, len(kvs))
+	for k, v := range kvs {
+		item := &Item{}
+		if err := codectool.UnmarshalJSON([]byte(v), item); err != nil {
+			return nil, fmt.Errorf("unmarshal item %s failed: %v", strings.TrimPrefix(k, s.prefix), err)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID < items[j].ID
+	})
+	return items, nil
+}
+
+func (s *etcdStore) shared() bool {
+	return true
+}
+
+func (s *etcdStore) close() {
+}
+
+// openBoltDB opens the database of the path, or increases the reference
+// count if it has been opened.
+func openBoltDB(path string) (*boltDB, error) {
+	boltDBsLock.Lock()
+	defer boltDBsLock.Unlock()
+
+	if db := boltDBs[path]; db != nil {
+		db.refs++
+		return db, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s failed: %v", path, err)
+	}
+	boltDBs[path] = &boltDB{DB: db, path: path, refs: 1}
+	return boltDBs[path], nil
+}
+
+func (db *boltDB) release() {
+	boltDBsLock.Lock()
+	defer boltDBsLock.Unlock()
+
+	db.refs--
+	if db.refs == 0 {
+		delete(boltDBs, db.path)
+		db.Close()
+	}
+}
+
+func newBoltStore(path, pipeline, filter string) (*boltStore, error) {
+	db, err := openBoltDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &boltStore{db: db, bucket: []byte(pipeline + "/" + filter)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucket)
+		return err
+	})
+	if err != nil {
+		db.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *boltStore) put(item *Item) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(item.ID), codectool.MustMarshalJSON(item))
+	})
+}
+
+func (s *boltStore) get(id string) (*Item, error) {
+	var item *Item
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(s.bucket).Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		item = &Item{}
+		return codectool.UnmarshalJSON(value, item)
+	})
+	return item, err
+}
+
+func (s *boltStore) delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(id))
+	})
+}
+
+func (s *boltStore) list() ([]*Item, error) {
+	items := []*Item{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// the keys of bolt are sorted, no need to sort the items.
+		return tx.Bucket(s.bucket).ForEach(func(k, v []byte) error {
+			item := &Item{}
+			if err := codectool.UnmarshalJSON(v, item); err != nil {
+				return fmt.Errorf("unmarshal item %s failed: %v", k, err)
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+func (s *boltStore) shared() bool {
+	return false
+}
+
+func (s *boltStore) close() {
+	s.db.release()
+}
@@ -0,0 +1,531 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schemavalidator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAvroDepth is the max depth of the nested values, which prevents the
+// recursive schemas from exhausting the stack.
+const maxAvroDepth = 128
+
+type (
+	// avroSchema is a parsed Avro schema.
+	avroSchema struct {
+		// typ is one of the primitive types, record, enum, array, map,
+		// union and fixed.
+		typ string
+		// name is the full name of the named types.
+		name    string
+		fields  []*avroField
+		symbols []string
+		items   *avroSchema
+		values  *avroSchema
+		union   []*avroSchema
+		size    int
+	}
+
+	avroField struct {
+		name       string
+		schema     *avroSchema
+		hasDefault bool
+	}
+
+	avroParser struct {
+		named map[string]*avroSchema
+	}
+
+	avroReader struct {
+		data []byte
+		pos  int
+	}
+)
+
+// avroString is the schema of the keys of maps.
+var avroString = &avroSchema{typ: "string"}
+
+var avroPrimitives = map[string]struct{}{
+	"null": {}, "boolean": {}, "int": {}, "long": {}, "float": {},
+	"double": {}, "bytes": {}, "string": {},
+}
+
+// parseAvroSchema parses an Avro schema in JSON.
+func parseAvroSchema(text string) (*avroSchema, error) {
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(text))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %v", err)
+	}
+	p := &avroParser{named: map[string]*avroSchema{}}
+	return p.parse(v, "")
+}
+
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func (p *avroParser) parse(v interface{}, namespace string) (*avroSchema, error) {
+	switch v := v.(type) {
+	case string:
+		if _, ok := avroPrimitives[v]; ok {
+			return &avroSchema{typ: v}, nil
+		}
+		if s := p.named[fullName(v, namespace)]; s != nil {
+			return s, nil
+		}
+		if s := p.named[v]; s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown avro type %s", v)
+
+	case []interface{}:
+		s := &avroSchema{typ: "union"}
+		seen := map[string]struct{}{}
+		for _, item := range v {
+			branch, err := p.parse(item, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if branch.typ == "union" {
+				return nil, fmt.Errorf("nested avro unions")
+			}
+			key := branch.unionKey()
+			if _, ok := seen[key]; ok {
+				return nil, fmt.Errorf("duplicated type %s in avro union", key)
+			}
+			seen[key] = struct{}{}
+			s.union = append(s.union, branch)
+		}
+		if len(s.union) == 0 {
+			return nil, fmt.Errorf("empty avro union")
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	}
+
+	return nil, fmt.Errorf("invalid avro schema %v", v)
+}
+
+func (p *avroParser) parseComplex(v map[string]interface{}, namespace string) (*avroSchema, error) {
+	typ, _ := v["type"].(string)
+	s := &avroSchema{typ: typ}
+
+	switch typ {
+	case "record", "error", "enum", "fixed":
+		name, _ := v["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("avro %s without name", typ)
+		}
+		if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		s.name = fullName(name, namespace)
+		if i := strings.LastIndexByte(s.name, '.'); i >= 0 {
+			namespace = s.name[:i]
+		}
+		if _, ok := p.named[s.name]; ok {
+			return nil, fmt.Errorf("duplicated avro type %s", s.name)
+		}
+		// registered before the fields to support recursive types.
+		p.named[s.name] = s
+	}
+
+	switch typ {
+	case "record", "error":
+		s.typ = "record"
+		fields, ok := v["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("avro record %s without fields", s.name)
+		}
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field of avro record %s", s.name)
+			}
+			name, _ := fm["name"].(string)
+			if name == "" {
+				return nil, fmt.Errorf("avro record %s has a field without name", s.name)
+			}
+			fs, err := p.parse(fm["type"], namespace)
+			if err != nil {
+				return nil, fmt.Errorf("field %s of avro record %s: %v", name, s.name, err)
+			}
+			_, hasDefault := fm["default"]
+			s.fields = append(s.fields, &avroField{name: name, schema: fs, hasDefault: hasDefault})
+		}
+	case "enum":
+		symbols, _ := v["symbols"].([]interface{})
+		for _, sym := range symbols {
+			str, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid symbol of avro enum %s", s.name)
+			}
+			s.symbols = append(s.symbols, str)
+		}
+		if len(s.symbols) == 0 {
+			return nil, fmt.Errorf("avro enum %s without symbols", s.name)
+		}
+	case "fixed":
+		size, ok := v["size"].(json.Number)
+		n, err := size.Int64()
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid size of avro fixed %s", s.name)
+		}
+		s.size = int(n)
+	case "array":
+		items, err := p.parse(v["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("items of avro array: %v", err)
+		}
+		s.items = items
+	case "map":
+		values, err := p.parse(v["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("values of avro map: %v", err)
+		}
+		s.values = values
+	default:
+		// primitive types with attributes, like the logical types.
+		if _, ok := avroPrimitives[typ]; !ok {
+			return nil, fmt.Errorf("unknown avro type %v", v["type"])
+		}
+	}
+
+	return s, nil
+}
+
+// unionKey returns the key of the branch in the JSON encoding of unions.
+func (s *avroSchema) unionKey() string {
+	if s.name != "" {
+		return s.name
+	}
+	return s.typ
+}
+
+// validateBinary validates the data in the Avro binary encoding.
+func (s *avroSchema) validateBinary(data []byte) error {
+	r := &avroReader{data: data}
+	if err := s.readBinary(r, 0); err != nil {
+		return err
+	}
+	if r.pos != len(r.data) {
+		return fmt.Errorf("%d trailing bytes", len(r.data)-r.pos)
+	}
+	return nil
+}
+
+func (r *avroReader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *avroReader) readVarint(maxBytes int) (int64, error) {
+	var v uint64
+	for i := 0; i < maxBytes; i++ {
+		if r.pos >= len(r.data) {
+			return 0, fmt.Errorf("unexpected end of data")
+		}
+		b := r.data[r.pos]
+		r.pos++
+		v |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			// zigzag decoding.
+			return int64(v>>1) ^ -int64(v&1), nil
+		}
+	}
+	return 0, fmt.Errorf("varint overflow")
+}
+
+func (r *avroReader) skip(n int64) error {
+	if n < 0 || n > int64(r.remaining()) {
+		return fmt.Errorf("unexpected end of data")
+	}
+	r.pos += int(n)
+	return nil
+}
+
+// readCount reads the item count of a block of arrays and maps.
+func (r *avroReader) readCount() (int64, error) {
+	n, err := r.readVarint(10)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		// the count is followed by the size of the block in bytes.
+		if n == math.MinInt64 {
+			return 0, fmt.Errorf("invalid block count")
+		}
+		n = -n
+		if _, err = r.readVarint(10); err != nil {
+			return 0, err
+		}
+	}
+	// every item takes at least one byte except the ones of empty types,
+	// so more items than the remaining bytes are rejected to prevent huge
+	// loops.
+	if n > int64(r.remaining()) {
+		return 0, fmt.Errorf("block count %d exceeds the data", n)
+	}
+	return n, nil
+}
+
+func (s *avroSchema) readBinary(r *avroReader, depth int) error {
+	if depth > maxAvroDepth {
+		return fmt.Errorf("too deep")
+	}
+
+	switch s.typ {
+	case "null":
+		return nil
+	case "boolean":
+		if r.remaining() < 1 {
+			return fmt.Errorf("unexpected end of data")
+		}
+		if b := r.data[r.pos]; b > 1 {
+			return fmt.Errorf("invalid boolean %d", b)
+		}
+		r.pos++
+		return nil
+	case "int":
+		v, err := r.readVarint(5)
+		if err == nil && (v < math.MinInt32 || v > math.MaxInt32) {
+			err = fmt.Errorf("int overflow")
+		}
+		return err
+	case "long":
+		_, err := r.readVarint(10)
+		return err
+	case "float":
+		return r.skip(4)
+	case "double":
+		return r.skip(8)
+	case "bytes", "string":
+		n, err := r.readVarint(10)
+		if err != nil {
+			return err
+		}
+		start := r.pos
+		if err = r.skip(n); err != nil {
+			return err
+		}
+		if s.typ == "string" && !utf8.Valid(r.data[start:r.pos]) {
+			return fmt.Errorf("invalid UTF-8 string")
+		}
+		return nil
+	case "fixed":
+		return r.skip(int64(s.size))
+	case "enum":
+		v, err := r.readVarint(5)
+		if err == nil && (v < 0 || v >= int64(len(s.symbols))) {
+			err = fmt.Errorf("invalid index %d of enum %s", v, s.name)
+		}
+		return err
+	case "union":
+		v, err := r.readVarint(10)
+		if err != nil {
+			return err
+		}
+		if v < 0 || v >= int64(len(s.union)) {
+			return fmt.Errorf("invalid union index %d", v)
+		}
+		return s.union[v].readBinary(r, depth+1)
+	case "record":
+		for _, f := range s.fields {
+			if err := f.schema.readBinary(r, depth+1); err != nil {
+				return fmt.Errorf("%s.%s: %v", s.name, f.name, err)
+			}
+		}
+		return nil
+	case "array", "map":
+		for {
+			n, err := r.readCount()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+			for i := int64(0); i < n; i++ {
+				if s.typ == "array" {
+					err = s.items.readBinary(r, depth+1)
+				} else if err = avroString.readBinary(r, depth+1); err == nil {
+					err = s.values.readBinary(r, depth+1)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return fmt.Errorf("BUG: unknown avro type %s", s.typ)
+}
+
+// validateJSON validates the data in the Avro JSON encoding.
+func (s *avroSchema) validateJSON(data []byte) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	if d.More() {
+		return fmt.Errorf("trailing data")
+	}
+	return s.checkJSON(v, 0)
+}
+
+func (s *avroSchema) checkJSON(v interface{}, depth int) error {
+	if depth > maxAvroDepth {
+		return fmt.Errorf("too deep")
+	}
+	mismatch := fmt.Errorf("%v is not a valid %s", v, s.typ)
+
+	switch s.typ {
+	case "null":
+		if v != nil {
+			return mismatch
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch
+		}
+	case "int", "long":
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch
+		}
+		i, err := n.Int64()
+		if err != nil || (s.typ == "int" && (i < math.MinInt32 || i > math.MaxInt32)) {
+			return mismatch
+		}
+	case "float", "double":
+		if _, ok := v.(json.Number); !ok {
+			return mismatch
+		}
+	case "string", "bytes":
+		if _, ok := v.(string); !ok {
+			return mismatch
+		}
+	case "fixed":
+		str, ok := v.(string)
+		if !ok || utf8.RuneCountInString(str) != s.size {
+			return mismatch
+		}
+	case "enum":
+		str, _ := v.(string)
+		for _, sym := range s.symbols {
+			if sym == str {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not a symbol of enum %s", v, s.name)
+	case "union":
+		if v == nil {
+			for _, b := range s.union {
+				if b.typ == "null" {
+					return nil
+				}
+			}
+			return fmt.Errorf("null is not in the union")
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return fmt.Errorf("value of union must be an object of one key")
+		}
+		for k, value := range m {
+			for _, b := range s.union {
+				if b.unionKey() == k {
+					return b.checkJSON(value, depth+1)
+				}
+			}
+			return fmt.Errorf("%s is not in the union", k)
+		}
+	case "record":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		known := make(map[string]struct{}, len(s.fields))
+		for _, f := range s.fields {
+			known[f.name] = struct{}{}
+			value, ok := m[f.name]
+			if !ok {
+				if f.hasDefault {
+					continue
+				}
+				return fmt.Errorf("%s: missing field %s", s.name, f.name)
+			}
+			if err := f.schema.checkJSON(value, depth+1); err != nil {
+				return fmt.Errorf("%s.%s: %v", s.name, f.name, err)
+			}
+		}
+		for k := range m {
+			if _, ok := known[k]; !ok {
+				return fmt.Errorf("%s: unknown field %s", s.name, k)
+			}
+		}
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		for _, item := range list {
+			if err := s.items.checkJSON(item, depth+1); err != nil {
+				return err
+			}
+		}
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		for _, value := range m {
+			if err := s.values.checkJSON(value, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("BUG: unknown avro type %s", s.typ)
+	}
+	return nil
+}
+
+// wireFormatHeader is the size of the header of the Confluent wire format,
+// which is a zero magic byte and the 4-byte big-endian schema ID.
+const wireFormatHeader = 5
+
+// splitWireFormat returns the schema ID and the payload of the data in the
+// Confluent wire format.
+func splitWireFormat(data []byte) (int, []byte, error) {
+	if len(data) < wireFormatHeader || data[0] != 0 {
+		return 0, nil, fmt.Errorf("invalid wire format header")
+	}
+	return int(binary.BigEndian.Uint32(data[1:wireFormatHeader])), data[wireFormatHeader:], nil
+}
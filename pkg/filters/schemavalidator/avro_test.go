@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schemavalidator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const userSchema = `{
+  "type": "record",
+  "name": "User",
+  "namespace": "test",
+  "fields": [
+    {"name": "name", "type": "string"},
+    {"name": "age", "type": "int"},
+    {"name": "email", "type": ["null", "string"], "default": null},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "role", "type": {"type": "enum", "name": "Role", "symbols": ["ADMIN", "USER"]}},
+    {"name": "friend", "type": ["null", "User"], "default": null}
+  ]
+}`
+
+// zz encodes n in the zigzag varint encoding.
+func zz(n int64) []byte {
+	v := uint64((n << 1) ^ (n >> 63))
+	var buf []byte
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func cat(parts ...[]byte) []byte {
+	var buf []byte
+	for _, p := range parts {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+func encodeUser(name string, age int64, friend []byte) []byte {
+	data := cat(zz(int64(len(name))), []byte(name), zz(age),
+		zz(1), zz(5), []byte("a@b.c"), // email
+		zz(1), zz(1), []byte("x"), zz(0), // tags
+		zz(1)) // role
+	if friend == nil {
+		return cat(data, zz(0))
+	}
+	return cat(data, zz(1), friend)
+}
+
+func TestParseAvroSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := parseAvroSchema(userSchema)
+	assert.NoError(err)
+	assert.Equal("record", s.typ)
+	assert.Equal("test.User", s.name)
+	assert.Len(s.fields, 6)
+	// recursive reference.
+	assert.Equal(s, s.fields[5].schema.union[1])
+
+	for _, schema := range []string{
+		`"int"`,
+		`["null", "string"]`,
+		`{"type": "map", "values": {"type": "fixed", "name": "md5", "size": 16}}`,
+		`{"type": "long", "logicalType": "timestamp-millis"}`,
+	} {
+		_, err = parseAvroSchema(schema)
+		assert.NoError(err, schema)
+	}
+
+	for _, schema := range []string{
+		``,
+		`"unknown"`,
+		`[]`,
+		`["null", "null"]`,
+		`["null", ["int"]]`,
+		`{"type": "record", "fields": []}`,
+		`{"type": "record", "name": "a"}`,
+		`{"type": "enum", "name": "e", "symbols": []}`,
+		`{"type": "fixed", "name": "f"}`,
+		`{"type": "array", "items": "unknown"}`,
+		`{"type": "record", "name": "a", "fields": [{"name": "b", "type": "a"}, {"name": "c", "type": {"type": "enum", "name": "a", "symbols": ["x"]}}]}`,
+	} {
+		_, err = parseAvroSchema(schema)
+		assert.Error(err, schema)
+	}
+}
+
+func TestAvroBinary(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := parseAvroSchema(userSchema)
+	assert.NoError(err)
+
+	assert.NoError(s.validateBinary(encodeUser("alice", 30, nil)))
+	assert.NoError(s.validateBinary(encodeUser("alice", 30, encodeUser("bob", -1, nil))))
+
+	invalid := [][]byte{
+		nil,
+		encodeUser("alice", 30, nil)[:10],
+		append(encodeUser("alice", 30, nil), 0),
+		encodeUser("alice", 1<<40, nil),
+		encodeUser("\xff", 30, nil),
+		encodeUser("alice", 30, encodeUser("bob", 1, nil)[:3]),
+		// union index out of range.
+		cat(zz(1), []byte("a"), zz(1), zz(2)),
+		// negative string length.
+		cat(zz(-1)),
+		// huge block count.
+		cat(zz(1), []byte("a"), zz(1), zz(0), zz(1<<40)),
+	}
+	for _, data := range invalid {
+		assert.Error(s.validateBinary(data), data)
+	}
+
+	// blocks with negative counts and sizes.
+	m, _ := parseAvroSchema(`{"type": "map", "values": "boolean"}`)
+	assert.NoError(m.validateBinary(cat(zz(-2), zz(6), zz(1), []byte("a"), []byte{1}, zz(1), []byte("b"), []byte{0}, zz(0))))
+	assert.Error(m.validateBinary(cat(zz(1), zz(1), []byte("a"), []byte{2}, zz(0))))
+}
+
+func TestAvroJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := parseAvroSchema(userSchema)
+	assert.NoError(err)
+
+	valid := []string{
+		`{"name": "alice", "age": 30, "tags": [], "role": "USER"}`,
+		`{"name": "alice", "age": 30, "email": {"string": "a@b.c"}, "tags": ["x"], "role": "ADMIN",
+		  "friend": {"test.User": {"name": "bob", "age": 1, "email": null, "tags": [], "role": "USER"}}}`,
+	}
+	for _, data := range valid {
+		assert.NoError(s.validateJSON([]byte(data)), data)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"name": "alice", "age": 30, "tags": [], "role": "USER"} {}`,
+		`{"name": "alice", "tags": [], "role": "USER"}`,
+		`{"name": "alice", "age": 1.5, "tags": [], "role": "USER"}`,
+		`{"name": "alice", "age": 3000000000, "tags": [], "role": "USER"}`,
+		`{"name": "alice", "age": 30, "tags": [1], "role": "USER"}`,
+		`{"name": "alice", "age": 30, "tags": [], "role": "GUEST"}`,
+		`{"name": "alice", "age": 30, "tags": [], "role": "USER", "extra": 1}`,
+		`{"name": "alice", "age": 30, "email": "a@b.c", "tags": [], "role": "USER"}`,
+		`{"name": "alice", "age": 30, "email": {"int": 1}, "tags": [], "role": "USER"}`,
+	}
+	for _, data := range invalid {
+		assert.Error(s.validateJSON([]byte(data)), data)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schemavalidator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufValidator validates messages of a protobuf message type.
+type protobufValidator struct {
+	md            protoreflect.MessageDescriptor
+	types         *protoregistry.Types
+	rejectUnknown bool
+}
+
+// readDescriptorSet reads the descriptor set from a file, or decodes it
+// from base64 if no such file.
+func readDescriptorSet(s string) ([]byte, error) {
+	if _, err := os.Stat(s); err == nil {
+		return os.ReadFile(s)
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func newProtobufValidator(spec *ProtobufSpec) (*protobufValidator, error) {
+	data, err := readDescriptorSet(spec.Descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proto descriptor: %v", err)
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, fds); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %v", err)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(spec.MessageType))
+	if err != nil {
+		return nil, fmt.Errorf("message type %s not found: %v", spec.MessageType, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", spec.MessageType)
+	}
+
+	// the types are used to resolve google.protobuf.Any and extensions.
+	types := &protoregistry.Types{}
+	var register func(msgs protoreflect.MessageDescriptors)
+	register = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			md := msgs.Get(i)
+			types.RegisterMessage(dynamicpb.NewMessageType(md))
+			register(md.Messages())
+		}
+	}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		register(fd.Messages())
+		exts := fd.Extensions()
+		for i := 0; i < exts.Len(); i++ {
+			types.RegisterExtension(dynamicpb.NewExtensionType(exts.Get(i)))
+		}
+		return true
+	})
+
+	return &protobufValidator{md: md, types: types, rejectUnknown: spec.RejectUnknownFields}, nil
+}
+
+// validate validates the message in the binary or JSON encoding, the
+// required fields of proto2 must be set.
+func (v *protobufValidator) validate(data []byte, isJSON bool) error {
+	msg := dynamicpb.NewMessage(v.md)
+
+	if isJSON {
+		opts := protojson.UnmarshalOptions{DiscardUnknown: !v.rejectUnknown, Resolver: v.types}
+		return opts.Unmarshal(data, msg)
+	}
+
+	opts := proto.UnmarshalOptions{Resolver: v.types}
+	if err := opts.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	if v.rejectUnknown && hasUnknownFields(msg) {
+		return fmt.Errorf("unknown fields in message")
+	}
+	return nil
+}
+
+func hasUnknownFields(msg protoreflect.Message) bool {
+	if len(msg.GetUnknown()) > 0 {
+		return true
+	}
+
+	found := false
+	msg.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := value.List()
+			for i := 0; i < list.Len() && !found; i++ {
+				found = hasUnknownFields(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				found = hasUnknownFields(v.Message())
+				return !found
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			found = hasUnknownFields(value.Message())
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schemavalidator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	defaultRefreshInterval = time.Minute
+	defaultRegistryTimeout = 5 * time.Second
+	// maxCachedSchemas is the max number of the schemas cached by ID.
+	maxCachedSchemas = 1000
+)
+
+type (
+	// SchemaRegistrySpec describes a Confluent compatible schema registry.
+	SchemaRegistrySpec struct {
+		URL string `json:"url" jsonschema:"required,format=uri"`
+		// Subject is the subject of the schema, the schema of the subject
+		// is refreshed periodically.
+		Subject string `json:"subject" jsonschema:"omitempty"`
+		// Version is the version of the schema of the subject, default is
+		// latest.
+		Version         string `json:"version" jsonschema:"omitempty"`
+		RefreshInterval string `json:"refreshInterval" jsonschema:"omitempty,format=duration"`
+		Timeout         string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		Username        string `json:"username" jsonschema:"omitempty"`
+		Password        string `json:"password" jsonschema:"omitempty"`
+	}
+
+	// schemaRegistry fetches the Avro schemas from a schema registry.
+	schemaRegistry struct {
+		spec     *SchemaRegistrySpec
+		client   *http.Client
+		interval time.Duration
+		done     chan struct{}
+
+		mutex   sync.RWMutex
+		subject *avroSchema
+		byID    map[int]*avroSchema
+	}
+
+	registrySchema struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+)
+
+// Validate validates the SchemaRegistrySpec.
+func (spec *SchemaRegistrySpec) Validate() error {
+	if spec.RefreshInterval != "" {
+		if d, err := time.ParseDuration(spec.RefreshInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid refresh interval %s", spec.RefreshInterval)
+		}
+	}
+	if spec.Timeout != "" {
+		if d, err := time.ParseDuration(spec.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %s", spec.Timeout)
+		}
+	}
+	return nil
+}
+
+func newSchemaRegistry(spec *SchemaRegistrySpec) *schemaRegistry {
+	r := &schemaRegistry{
+		spec:     spec,
+		interval: defaultRefreshInterval,
+		done:     make(chan struct{}),
+		byID:     map[int]*avroSchema{},
+	}
+
+	timeout := defaultRegistryTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	r.client = &http.Client{Timeout: timeout}
+	if spec.RefreshInterval != "" {
+		r.interval, _ = time.ParseDuration(spec.RefreshInterval)
+	}
+
+	if spec.Subject != "" {
+		go r.run()
+	}
+	return r
+}
+
+func (r *schemaRegistry) run() {
+	r.refresh()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.refresh()
+		}
+	}
+}
+
+// refresh fetches the schema of the subject, the old one is kept if it
+// fails.
+func (r *schemaRegistry) refresh() {
+	version := r.spec.Version
+	if version == "" {
+		version = "latest"
+	}
+	path := fmt.Sprintf("/subjects/%s/versions/%s", url.PathEscape(r.spec.Subject), url.PathEscape(version))
+
+	s, err := r.fetch(path)
+	if err != nil {
+		logger.Errorf("fetch schema of subject %s failed: %v", r.spec.Subject, err)
+		return
+	}
+
+	r.mutex.Lock()
+	r.subject = s
+	r.mutex.Unlock()
+}
+
+// current returns the schema of the subject, nil if it's not fetched.
+func (r *schemaRegistry) current() *avroSchema {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.subject
+}
+
+// getByID returns the schema of the ID, which is fetched if not cached.
+func (r *schemaRegistry) getByID(id int) (*avroSchema, error) {
+	r.mutex.RLock()
+	s := r.byID[id]
+	r.mutex.RUnlock()
+	if s != nil {
+		return s, nil
+	}
+
+	s, err := r.fetch("/schemas/ids/" + strconv.Itoa(id))
+	if err != nil {
+		return nil, fmt.Errorf("fetch schema %d failed: %v", id, err)
+	}
+
+	r.mutex.Lock()
+	if len(r.byID) >= maxCachedSchemas {
+		r.byID = map[int]*avroSchema{}
+	}
+	r.byID[id] = s
+	r.mutex.Unlock()
+	return s, nil
+}
+
+func (r *schemaRegistry) fetch(path string) (*avroSchema, error) {
+	req, err := http.NewRequest(http.MethodGet, r.spec.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.spec.Username != "" {
+		req.SetBasicAuth(r.spec.Username, r.spec.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema registry returns status code %d", resp.StatusCode)
+	}
+
+	rs := &registrySchema{}
+	if err = codectool.UnmarshalJSON(body, rs); err != nil {
+		return nil, fmt.Errorf("invalid response: %v", err)
+	}
+	if rs.SchemaType != "" && rs.SchemaType != "AVRO" {
+		return nil, fmt.Errorf("schema type %s is not supported", rs.SchemaType)
+	}
+	return parseAvroSchema(rs.Schema)
+}
+
+func (r *schemaRegistry) close() {
+	close(r.done)
+}
@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package schemavalidator implements the SchemaValidator filter, which
+// validates the bodies of requests against protobuf or Avro schemas.
+package schemavalidator
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of SchemaValidator.
+	Kind = "SchemaValidator"
+
+	resultInvalid  = "invalid"
+	resultNoSchema = "noSchema"
+
+	encodingBinary = "binary"
+	encodingJSON   = "json"
+
+	// 4MB
+	maxBodySize = 4 * 1024 * 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SchemaValidator validates the bodies of requests against protobuf or Avro schemas.",
+	Results:     []string{resultInvalid, resultNoSchema},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SchemaValidator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SchemaValidator is filter SchemaValidator.
+	SchemaValidator struct {
+		spec *Spec
+
+		protobuf *protobufValidator
+		avro     *avroSchema
+		registry *schemaRegistry
+
+		numOfInvalid uint64
+	}
+
+	// Spec describes the SchemaValidator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Protobuf *ProtobufSpec `json:"protobuf,omitempty" jsonschema:"omitempty"`
+		Avro     *AvroSpec     `json:"avro,omitempty" jsonschema:"omitempty"`
+		// Encoding is the encoding of the bodies, default is binary.
+		Encoding string `json:"encoding" jsonschema:"omitempty,enum=,enum=binary,enum=json"`
+	}
+
+	// ProtobufSpec describes the protobuf message type of the bodies.
+	ProtobufSpec struct {
+		// Descriptor is the file of the FileDescriptorSet generated by
+		// protoc with --include_imports, or its base64 encoding.
+		Descriptor          string `json:"descriptor" jsonschema:"required"`
+		MessageType         string `json:"messageType" jsonschema:"required"`
+		RejectUnknownFields bool   `json:"rejectUnknownFields" jsonschema:"omitempty"`
+	}
+
+	// AvroSpec describes the Avro schema of the bodies.
+	AvroSpec struct {
+		Schema string `json:"schema" jsonschema:"omitempty"`
+		// WireFormat means the bodies are in the Confluent wire format, the
+		// schema is fetched from the schema registry by the ID in the
+		// bodies if there's a registry.
+		WireFormat     bool                `json:"wireFormat" jsonschema:"omitempty"`
+		SchemaRegistry *SchemaRegistrySpec `json:"schemaRegistry,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of SchemaValidator.
+	Status struct {
+		NumOfInvalid uint64 `json:"numOfInvalid"`
+	}
+)
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	if (spec.Protobuf == nil) == (spec.Avro == nil) {
+		return fmt.Errorf("one and only one of protobuf and avro must be defined")
+	}
+
+	if spec.Protobuf != nil {
+		if _, err := newProtobufValidator(spec.Protobuf); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	a := spec.Avro
+	if a.Schema != "" {
+		if _, err := parseAvroSchema(a.Schema); err != nil {
+			return err
+		}
+	}
+	if a.SchemaRegistry != nil {
+		if err := a.SchemaRegistry.Validate(); err != nil {
+			return err
+		}
+		if a.SchemaRegistry.Subject == "" && !a.WireFormat {
+			return fmt.Errorf("subject of schema registry is required if the bodies are not in wire format")
+		}
+	} else if a.Schema == "" {
+		return fmt.Errorf("one of schema and schemaRegistry is required")
+	}
+	if a.WireFormat && spec.Encoding == encodingJSON {
+		return fmt.Errorf("wire format only supports binary encoding")
+	}
+	return nil
+}
+
+// Name returns the name of the SchemaValidator filter instance.
+func (sv *SchemaValidator) Name() string {
+	return sv.spec.Name()
+}
+
+// Kind returns the kind of SchemaValidator.
+func (sv *SchemaValidator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SchemaValidator.
+func (sv *SchemaValidator) Spec() filters.Spec {
+	return sv.spec
+}
+
+// Init initializes SchemaValidator.
+func (sv *SchemaValidator) Init() {
+	sv.reload()
+}
+
+// Inherit inherits previous generation of SchemaValidator.
+func (sv *SchemaValidator) Inherit(previousGeneration filters.Filter) {
+	previousGeneration.Close()
+	sv.reload()
+}
+
+func (sv *SchemaValidator) reload() {
+	var err error
+	if sv.spec.Protobuf != nil {
+		if sv.protobuf, err = newProtobufValidator(sv.spec.Protobuf); err != nil {
+			logger.Errorf("BUG: create protobuf validator failed: %v", err)
+		}
+		return
+	}
+
+	if sv.spec.Avro.Schema != "" {
+		if sv.avro, err = parseAvroSchema(sv.spec.Avro.Schema); err != nil {
+			logger.Errorf("BUG: parse avro schema failed: %v", err)
+		}
+	}
+	if sv.spec.Avro.SchemaRegistry != nil {
+		sv.registry = newSchemaRegistry(sv.spec.Avro.SchemaRegistry)
+	}
+}
+
+// Handle validates the body of the request.
+func (sv *SchemaValidator) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	prepareErrorResponse := func(status int, err error) {
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(status)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag(stringtool.Cat("schema validator: ", err.Error()))
+	}
+
+	if req.IsStream() {
+		atomic.AddUint64(&sv.numOfInvalid, 1)
+		prepareErrorResponse(http.StatusBadRequest, fmt.Errorf("cannot validate a stream body"))
+		return resultInvalid
+	}
+
+	payload := req.RawPayload()
+	isJSON := sv.spec.Encoding == encodingJSON
+
+	var err error
+	if sv.protobuf != nil {
+		err = sv.protobuf.validate(payload, isJSON)
+	} else {
+		id := 0
+		if sv.spec.Avro.WireFormat {
+			id, payload, err = splitWireFormat(payload)
+		}
+		if err == nil {
+			schema, schemaErr := sv.avroSchema(id)
+			if schemaErr != nil {
+				prepareErrorResponse(http.StatusServiceUnavailable, schemaErr)
+				return resultNoSchema
+			}
+			if isJSON {
+				err = schema.validateJSON(payload)
+			} else {
+				err = schema.validateBinary(payload)
+			}
+		}
+	}
+
+	if err != nil {
+		atomic.AddUint64(&sv.numOfInvalid, 1)
+		prepareErrorResponse(http.StatusBadRequest, err)
+		return resultInvalid
+	}
+	return ""
+}
+
+// avroSchema returns the Avro schema to validate the payload, id is the
+// schema ID in the wire format header.
+func (sv *SchemaValidator) avroSchema(id int) (*avroSchema, error) {
+	if sv.registry == nil {
+		return sv.avro, nil
+	}
+	if sv.spec.Avro.WireFormat {
+		return sv.registry.getByID(id)
+	}
+	if s := sv.registry.current(); s != nil {
+		return s, nil
+	}
+	if sv.avro == nil {
+		return nil, fmt.Errorf("schema of subject %s is not available", sv.spec.Avro.SchemaRegistry.Subject)
+	}
+	return sv.avro, nil
+}
+
+// Status returns status.
+func (sv *SchemaValidator) Status() interface{} {
+	return &Status{NumOfInvalid: atomic.LoadUint64(&sv.numOfInvalid)}
+}
+
+// Close closes SchemaValidator.
+func (sv *SchemaValidator) Close() {
+	if sv.registry != nil {
+		sv.registry.close()
+	}
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schemavalidator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestSchemaValidator(assert *assert.Assertions, yamlConfig string) *SchemaValidator {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	sv := kind.CreateInstance(spec).(*SchemaValidator)
+	sv.Init()
+	return sv
+}
+
+func newTestContext(body []byte) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/events", bytes.NewReader(body))
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// testDescriptorSet returns the base64 encoded descriptor set of below
+// proto file.
+//
+//	syntax = "proto2";
+//	package test.v1;
+//	message Event { required string id = 1; optional int64 time = 2; repeated Event children = 3; }
+func testDescriptorSet() string {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typ == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+			fd.TypeName = proto.String(".test.v1.Event")
+		}
+		return fd
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("event.proto"),
+			Package: proto.String("test.v1"),
+			Syntax:  proto.String("proto2"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Event"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_LABEL_REQUIRED),
+					field("time", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL),
+					field("children", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_LABEL_REPEATED),
+				},
+			}},
+		}},
+	}
+	data, _ := proto.Marshal(fds)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{Protobuf: &ProtobufSpec{}, Avro: &AvroSpec{}}).Validate())
+	assert.Error((&Spec{Protobuf: &ProtobufSpec{Descriptor: testDescriptorSet(), MessageType: "test.v1.None"}}).Validate())
+	assert.NoError((&Spec{Protobuf: &ProtobufSpec{Descriptor: testDescriptorSet(), MessageType: "test.v1.Event"}}).Validate())
+
+	assert.Error((&Spec{Avro: &AvroSpec{}}).Validate())
+	assert.Error((&Spec{Avro: &AvroSpec{Schema: `"unknown"`}}).Validate())
+	assert.Error((&Spec{Avro: &AvroSpec{Schema: `"int"`, WireFormat: true}, Encoding: "json"}).Validate())
+	assert.Error((&Spec{Avro: &AvroSpec{SchemaRegistry: &SchemaRegistrySpec{URL: "http://127.0.0.1"}}}).Validate())
+	assert.Error((&Spec{Avro: &AvroSpec{SchemaRegistry: &SchemaRegistrySpec{URL: "http://127.0.0.1", Subject: "s", Timeout: "-1s"}}}).Validate())
+	assert.NoError((&Spec{Avro: &AvroSpec{SchemaRegistry: &SchemaRegistrySpec{URL: "http://127.0.0.1"}, WireFormat: true}}).Validate())
+}
+
+func TestProtobuf(t *testing.T) {
+	assert := assert.New(t)
+
+	sv := newTestSchemaValidator(assert, `
+kind: SchemaValidator
+name: sv
+protobuf:
+  descriptor: `+testDescriptorSet()+`
+  messageType: test.v1.Event
+  rejectUnknownFields: true
+`)
+	defer sv.Close()
+
+	// id: "e1", time: 1, children: [{id: "e2"}]
+	valid := []byte{0x0a, 0x02, 'e', '1', 0x10, 0x01, 0x1a, 0x04, 0x0a, 0x02, 'e', '2'}
+	assert.Equal("", sv.Handle(newTestContext(valid)))
+
+	invalid := [][]byte{
+		// missing the required id.
+		{0x10, 0x01},
+		// truncated.
+		valid[:8],
+		// unknown field 4 in the child.
+		{0x0a, 0x02, 'e', '1', 0x1a, 0x06, 0x0a, 0x02, 'e', '2', 0x20, 0x01},
+	}
+	for _, data := range invalid {
+		ctx := newTestContext(data)
+		assert.Equal(resultInvalid, sv.Handle(ctx), data)
+		assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+	}
+	assert.Equal(uint64(3), sv.Status().(*Status).NumOfInvalid)
+
+	sv = newTestSchemaValidator(assert, `
+kind: SchemaValidator
+name: sv
+encoding: json
+protobuf:
+  descriptor: `+testDescriptorSet()+`
+  messageType: test.v1.Event
+`)
+	defer sv.Close()
+
+	assert.Equal("", sv.Handle(newTestContext([]byte(`{"id": "e1", "time": "1", "children": [{"id": "e2"}], "extra": 1}`))))
+	assert.Equal(resultInvalid, sv.Handle(newTestContext([]byte(`{"time": "1"}`))))
+	assert.Equal(resultInvalid, sv.Handle(newTestContext([]byte(`{"id": 1}`))))
+}
+
+func TestAvro(t *testing.T) {
+	assert := assert.New(t)
+
+	sv := newTestSchemaValidator(assert, `
+kind: SchemaValidator
+name: sv
+avro:
+  schema: '{"type": "record", "name": "Event", "fields": [{"name": "id", "type": "string"}]}'
+  wireFormat: true
+`)
+	defer sv.Close()
+
+	header := []byte{0, 0, 0, 0, 1}
+	assert.Equal("", sv.Handle(newTestContext(cat(header, zz(2), []byte("e1")))))
+	assert.Equal(resultInvalid, sv.Handle(newTestContext(cat(zz(2), []byte("e1")))))
+	assert.Equal(resultInvalid, sv.Handle(newTestContext(nil)))
+	assert.Equal(resultInvalid, sv.Handle(newTestContext(header)))
+}
+
+func TestSchemaRegistry(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		schema := ""
+		switch r.URL.Path {
+		case "/subjects/events-value/versions/latest", "/schemas/ids/1":
+			schema = `{"type": "record", "name": "Event", "fields": [{"name": "id", "type": "string"}]}`
+		case "/schemas/ids/2":
+			schema = `"long"`
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "schema": schema})
+	}))
+	defer registry.Close()
+
+	sv := newTestSchemaValidator(assert, fmt.Sprintf(`
+kind: SchemaValidator
+name: sv
+encoding: json
+avro:
+  schemaRegistry:
+    url: %s
+    subject: events-value
+    username: user
+    password: pass
+`, registry.URL))
+	defer sv.Close()
+
+	assert.Eventually(func() bool {
+		return sv.Handle(newTestContext([]byte(`{"id": "e1"}`))) == ""
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(resultInvalid, sv.Handle(newTestContext([]byte(`{"id": 1}`))))
+
+	sv = newTestSchemaValidator(assert, fmt.Sprintf(`
+kind: SchemaValidator
+name: sv
+avro:
+  wireFormat: true
+  schemaRegistry:
+    url: %s
+    username: user
+    password: pass
+`, registry.URL))
+	defer sv.Close()
+
+	atomic.StoreInt32(&requests, 0)
+	assert.Equal("", sv.Handle(newTestContext(cat([]byte{0, 0, 0, 0, 1}, zz(2), []byte("e1")))))
+	assert.Equal("", sv.Handle(newTestContext(cat([]byte{0, 0, 0, 0, 2}, zz(100)))))
+	assert.Equal(resultInvalid, sv.Handle(newTestContext(cat([]byte{0, 0, 0, 0, 2}, zz(2), []byte("e1")))))
+	// the schemas are cached.
+	assert.Equal(int32(2), atomic.LoadInt32(&requests))
+
+	ctx := newTestContext(cat([]byte{0, 0, 0, 0, 3}, zz(100)))
+	assert.Equal(resultNoSchema, sv.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package traffictagger implements the TrafficTagger filter.
+package traffictagger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of TrafficTagger.
+	Kind = "TrafficTagger"
+
+	defaultHeader = "X-Traffic-Tag"
+
+	// numOfBuckets is the number of the hash buckets, the weights of the
+	// cohorts are mapped to continuous ranges of the buckets.
+	numOfBuckets = 10000
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "TrafficTagger assigns the requests to cohorts by consistent hashing and tags them with a header.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &TrafficTagger{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// TrafficTagger is filter TrafficTagger.
+	TrafficTagger struct {
+		spec *Spec
+
+		header string
+		salt   string
+		// bounds[i] is the upper bound (exclusive) of the buckets of
+		// cohort i.
+		bounds []uint32
+		counts []int64
+	}
+
+	// Spec describes the TrafficTagger.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Key *KeySpec `json:"key" jsonschema:"required"`
+		// Salt makes the assignments of experiments independent, the
+		// filter name is used if it is empty.
+		Salt string `json:"salt" jsonschema:"omitempty"`
+		// Header is the header to set the cohort name to, default is
+		// X-Traffic-Tag.
+		Header string `json:"header" jsonschema:"omitempty"`
+		// AllowOverride keeps the cohort in the header of the request if it
+		// is one of the cohorts, which is useful to test a cohort.
+		AllowOverride bool      `json:"allowOverride" jsonschema:"omitempty"`
+		Cohorts       []*Cohort `json:"cohorts" jsonschema:"required,minItems=1"`
+	}
+
+	// KeySpec describes where to read the hash key of the requests, the
+	// sources are tried in the order of header, cookie and query, and the
+	// IP of the client is used if none of them is present.
+	KeySpec struct {
+		Header string `json:"header" jsonschema:"omitempty"`
+		Cookie string `json:"cookie" jsonschema:"omitempty"`
+		Query  string `json:"query" jsonschema:"omitempty"`
+	}
+
+	// Cohort is a group of the requests.
+	Cohort struct {
+		Name   string `json:"name" jsonschema:"required"`
+		Weight int    `json:"weight" jsonschema:"required,minimum=0"`
+	}
+
+	// Status is the status of TrafficTagger.
+	Status struct {
+		Cohorts map[string]int64 `json:"cohorts"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Key.Header == "" && spec.Key.Cookie == "" && spec.Key.Query == "" {
+		return fmt.Errorf("none of header, cookie and query of key is specified")
+	}
+
+	total := 0
+	names := map[string]bool{}
+	for _, c := range spec.Cohorts {
+		if names[c.Name] {
+			return fmt.Errorf("duplicated cohort %s", c.Name)
+		}
+		names[c.Name] = true
+		total += c.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("total weight of cohorts must be positive")
+	}
+	return nil
+}
+
+// Name returns the name of the TrafficTagger filter instance.
+func (tt *TrafficTagger) Name() string {
+	return tt.spec.Name()
+}
+
+// Kind returns the kind of TrafficTagger.
+func (tt *TrafficTagger) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the TrafficTagger.
+func (tt *TrafficTagger) Spec() filters.Spec {
+	return tt.spec
+}
+
+// Init initializes TrafficTagger.
+func (tt *TrafficTagger) Init() {
+	tt.reload()
+}
+
+// Inherit inherits previous generation of TrafficTagger.
+func (tt *TrafficTagger) Inherit(previousGeneration filters.Filter) {
+	tt.reload()
+}
+
+func (tt *TrafficTagger) reload() {
+	tt.header = tt.spec.Header
+	if tt.header == "" {
+		tt.header = defaultHeader
+	}
+
+	tt.salt = tt.spec.Salt
+	if tt.salt == "" {
+		tt.salt = tt.spec.Name()
+	}
+
+	total := 0
+	for _, c := range tt.spec.Cohorts {
+		total += c.Weight
+	}
+
+	// the buckets are split in proportion to the weights, the last cohort
+	// with a weight takes the remainder of the rounding.
+	tt.bounds = make([]uint32, len(tt.spec.Cohorts))
+	sum, last := 0, 0
+	for i, c := range tt.spec.Cohorts {
+		sum += c.Weight
+		tt.bounds[i] = uint32(sum * numOfBuckets / total)
+		if c.Weight > 0 {
+			last = i
+		}
+	}
+	tt.bounds[last] = numOfBuckets
+
+	tt.counts = make([]int64, len(tt.spec.Cohorts))
+}
+
+// key returns the hash key of the request.
+func (tt *TrafficTagger) key(req *httpprot.Request) string {
+	spec := tt.spec.Key
+	if spec.Header != "" {
+		if v := req.HTTPHeader().Get(spec.Header); v != "" {
+			return v
+		}
+	}
+	if spec.Cookie != "" {
+		if c, err := req.Cookie(spec.Cookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	if spec.Query != "" {
+		if v := req.URL().Query().Get(spec.Query); v != "" {
+			return v
+		}
+	}
+	return req.RealIP()
+}
+
+// assign returns the index of the cohort of the key, the same key is always
+// assigned to the same cohort as long as the weights are not changed.
+func (tt *TrafficTagger) assign(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(tt.salt))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	bucket := h.Sum32() % numOfBuckets
+
+	for i, bound := range tt.bounds {
+		if bucket < bound {
+			return i
+		}
+	}
+	return len(tt.bounds) - 1
+}
+
+func (tt *TrafficTagger) cohortIndex(name string) int {
+	for i, c := range tt.spec.Cohorts {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Handle tags the request with its cohort.
+func (tt *TrafficTagger) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	idx := -1
+	if tt.spec.AllowOverride {
+		idx = tt.cohortIndex(req.HTTPHeader().Get(tt.header))
+	}
+	if idx < 0 {
+		idx = tt.assign(tt.key(req))
+	}
+
+	atomic.AddInt64(&tt.counts[idx], 1)
+	name := tt.spec.Cohorts[idx].Name
+	req.HTTPHeader().Set(tt.header, name)
+	ctx.AddTag(tt.Name() + ": cohort " + name)
+	return ""
+}
+
+// RequiresBody implements filters.BodyRequirer.
+func (tt *TrafficTagger) RequiresBody() (request, response bool) {
+	return false, false
+}
+
+// Status returns status.
+func (tt *TrafficTagger) Status() interface{} {
+	s := &Status{Cohorts: make(map[string]int64, len(tt.counts))}
+	for i, c := range tt.spec.Cohorts {
+		s.Cohorts[c.Name] = atomic.LoadInt64(&tt.counts[i])
+	}
+	return s
+}
+
+// Close closes TrafficTagger.
+func (tt *TrafficTagger) Close() {
+}
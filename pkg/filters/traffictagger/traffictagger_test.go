@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package traffictagger
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestTrafficTagger(assert *assert.Assertions, yamlConfig string) *TrafficTagger {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	tt := kind.CreateInstance(spec).(*TrafficTagger)
+	tt.Init()
+	return tt
+}
+
+func newTestContext(header http.Header, url string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+	stdr.RemoteAddr = "192.168.1.1:1234"
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func cohortOf(ctx *context.Context, header string) string {
+	return ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get(header)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Key: &KeySpec{}, Cohorts: []*Cohort{{Name: "a", Weight: 1}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Key: &KeySpec{Header: "X-User"}, Cohorts: []*Cohort{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Key: &KeySpec{Header: "X-User"}, Cohorts: []*Cohort{{Name: "a"}, {Name: "b"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Key: &KeySpec{Cookie: "uid"}, Cohorts: []*Cohort{{Name: "a"}, {Name: "b", Weight: 1}}}
+	assert.NoError(spec.Validate())
+}
+
+func TestAssign(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := newTestTrafficTagger(assert, `
+kind: TrafficTagger
+name: tagger
+key:
+  header: X-User-ID
+  cookie: uid
+  query: uid
+cohorts:
+- name: control
+  weight: 80
+- name: treatment
+  weight: 20
+- name: disabled
+  weight: 0
+`)
+	defer tt.Close()
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		ctx := newTestContext(http.Header{"X-User-Id": []string{fmt.Sprintf("user-%d", i)}}, "http://127.0.0.1/")
+		tt.Handle(ctx)
+		counts[cohortOf(ctx, defaultHeader)]++
+	}
+	assert.InDelta(8000, counts["control"], 300)
+	assert.InDelta(2000, counts["treatment"], 300)
+	assert.Zero(counts["disabled"])
+
+	// the same key is always in the same cohort, whatever the source is.
+	ctx := newTestContext(http.Header{"X-User-Id": []string{"user-1"}}, "http://127.0.0.1/")
+	tt.Handle(ctx)
+	cohort := cohortOf(ctx, defaultHeader)
+
+	ctx = newTestContext(http.Header{"Cookie": []string{"uid=user-1"}}, "http://127.0.0.1/")
+	tt.Handle(ctx)
+	assert.Equal(cohort, cohortOf(ctx, defaultHeader))
+
+	ctx = newTestContext(nil, "http://127.0.0.1/?uid=user-1")
+	tt.Handle(ctx)
+	assert.Equal(cohort, cohortOf(ctx, defaultHeader))
+
+	// the header from the client is replaced.
+	ctx = newTestContext(http.Header{"X-Traffic-Tag": []string{"disabled"}}, "http://127.0.0.1/")
+	tt.Handle(ctx)
+	assert.NotEqual("disabled", cohortOf(ctx, defaultHeader))
+
+	status := tt.Status().(*Status)
+	assert.Equal(int64(10004), status.Cohorts["control"]+status.Cohorts["treatment"])
+	assert.Zero(status.Cohorts["disabled"])
+}
+
+func TestSaltAndOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: TrafficTagger
+name: tagger
+key:
+  header: X-User-ID
+salt: %s
+header: X-Cohort
+allowOverride: true
+cohorts:
+- name: a
+  weight: 50
+- name: b
+  weight: 50
+`
+	tt1 := newTestTrafficTagger(assert, fmt.Sprintf(yamlConfig, "exp1"))
+	tt2 := newTestTrafficTagger(assert, fmt.Sprintf(yamlConfig, "exp2"))
+
+	// the experiments with different salts are independent.
+	same := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		if tt1.assign(key) == tt2.assign(key) {
+			same++
+		}
+	}
+	assert.InDelta(500, same, 100)
+
+	ctx := newTestContext(http.Header{"X-Cohort": []string{"b"}, "X-User-Id": []string{"user-1"}}, "http://127.0.0.1/")
+	tt1.Handle(ctx)
+	assert.Equal("b", cohortOf(ctx, "X-Cohort"))
+
+	ctx = newTestContext(http.Header{"X-Cohort": []string{"c"}, "X-User-Id": []string{"user-1"}}, "http://127.0.0.1/")
+	tt1.Handle(ctx)
+	assert.Equal(tt1.spec.Cohorts[tt1.assign("user-1")].Name, cohortOf(ctx, "X-Cohort"))
+}
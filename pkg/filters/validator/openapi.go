@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/openapi"
+)
+
+// OpenAPIValidator validates the requests against an OpenAPI operation.
+type OpenAPIValidator struct {
+	spec      *openapi.OperationSpec
+	validator *openapi.RequestValidator
+}
+
+// NewOpenAPIValidator creates a new OpenAPI validator.
+func NewOpenAPIValidator(spec *openapi.OperationSpec) *OpenAPIValidator {
+	v := &OpenAPIValidator{spec: spec}
+	v.validator, _ = openapi.NewRequestValidator(spec)
+	return v
+}
+
+// Validate validates the parameters and the body of a http request, the
+// error wraps openapi.ErrUnsupportedMediaType if the media type of the
+// body is not one of the operation.
+func (v *OpenAPIValidator) Validate(req *httpprot.Request) error {
+	var body []byte
+	if v.spec.RequestBody != nil {
+		if req.IsStream() {
+			return fmt.Errorf("cannot validate a stream body")
+		}
+		body = req.RawPayload()
+	}
+	return v.validator.Validate(req.Std(), body)
+}
@@ -0,0 +1,424 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/signer"
+)
+
+const (
+	signatureSchemeAWSSigV4 = "awsSigV4"
+	signatureSchemeHMAC     = "hmac"
+
+	defaultClockSkew = 5 * time.Minute
+
+	hmacUnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// awsLiteral makes the signer compatible with AWS Signature Version 4.
+var awsLiteral = &signer.Literal{
+	ScopeSuffix:      "aws4_request",
+	AlgorithmName:    "X-Amz-Algorithm",
+	AlgorithmValue:   "AWS4-HMAC-SHA256",
+	SignedHeaders:    "X-Amz-SignedHeaders",
+	Signature:        "X-Amz-Signature",
+	Date:             "X-Amz-Date",
+	Expires:          "X-Amz-Expires",
+	Credential:       "X-Amz-Credential",
+	ContentSHA256:    "X-Amz-Content-Sha256",
+	SigningKeyPrefix: "AWS4",
+}
+
+type (
+	// RequestSignatureValidatorSpec defines the configuration of the request
+	// signature validator, which verifies AWS Signature Version 4 or HMAC
+	// signatures of the requests.
+	RequestSignatureValidatorSpec struct {
+		Scheme      string `json:"scheme" jsonschema:"required,enum=awsSigV4,enum=hmac"`
+		ClockSkew   string `json:"clockSkew" jsonschema:"omitempty,format=duration"`
+		ExcludeBody bool   `json:"excludeBody" jsonschema:"omitempty"`
+		// Keys are the secrets of the key IDs.
+		Keys map[string]string `json:"keys" jsonschema:"omitempty"`
+		// When EtcdPrefix is specified, the secrets are also loaded from etcd:
+		// key: /custom-data/{etcdPrefix}/{$key}
+		// value:
+		//   key: "$key"
+		//   secret: "$secret"
+		EtcdPrefix string             `json:"etcdPrefix" jsonschema:"omitempty"`
+		AWS        *AWSSigV4Spec      `json:"aws,omitempty" jsonschema:"omitempty"`
+		HMAC       *HMACSignatureSpec `json:"hmac,omitempty" jsonschema:"omitempty"`
+	}
+
+	// AWSSigV4Spec restricts the credential scope of AWS Signature Version 4.
+	AWSSigV4Spec struct {
+		Region  string `json:"region" jsonschema:"omitempty"`
+		Service string `json:"service" jsonschema:"omitempty"`
+	}
+
+	// HMACSignatureSpec defines the headers of the HMAC signature scheme.
+	HMACSignatureSpec struct {
+		Algorithm       string   `json:"algorithm" jsonschema:"omitempty,enum=,enum=hmac-sha256,enum=hmac-sha512"`
+		KeyIDHeader     string   `json:"keyIdHeader" jsonschema:"omitempty"`
+		SignatureHeader string   `json:"signatureHeader" jsonschema:"omitempty"`
+		TimestampHeader string   `json:"timestampHeader" jsonschema:"omitempty"`
+		SignedHeaders   []string `json:"signedHeaders" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// RequestSignatureValidator defines the request signature validator.
+	RequestSignatureValidator struct {
+		spec      *RequestSignatureValidatorSpec
+		clockSkew time.Duration
+		keys      *signingKeyStore
+		aws       *signer.Signer
+		hmac      *HMACSignatureSpec
+		newHash   func() hash.Hash
+	}
+
+	// signingKeyStore stores the secrets of the key IDs, it implements
+	// signer.AccessKeyStore.
+	signingKeyStore struct {
+		static map[string]string
+
+		lock    sync.RWMutex
+		dynamic map[string]string
+
+		cluster cluster.Cluster
+		prefix  string
+		cancel  context.CancelFunc
+	}
+
+	// etcdSigningKey defines the format of secrets in etcd.
+	etcdSigningKey struct {
+		Key    string `json:"key" jsonschema:"required"`
+		Secret string `json:"secret" jsonschema:"required"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *RequestSignatureValidatorSpec) Validate() error {
+	if len(spec.Keys) == 0 && spec.EtcdPrefix == "" {
+		return fmt.Errorf("both keys and etcdPrefix are empty")
+	}
+	if spec.ClockSkew != "" {
+		if _, err := time.ParseDuration(spec.ClockSkew); err != nil {
+			return fmt.Errorf("invalid clock skew %s: %v", spec.ClockSkew, err)
+		}
+	}
+	return nil
+}
+
+// NewRequestSignatureValidator creates a new request signature validator.
+func NewRequestSignatureValidator(spec *RequestSignatureValidatorSpec, super *supervisor.Supervisor) *RequestSignatureValidator {
+	v := &RequestSignatureValidator{
+		spec:      spec,
+		clockSkew: defaultClockSkew,
+		keys:      &signingKeyStore{static: spec.Keys},
+	}
+	if d, err := time.ParseDuration(spec.ClockSkew); err == nil {
+		v.clockSkew = d
+	}
+
+	if spec.EtcdPrefix != "" {
+		if super == nil || super.Cluster() == nil {
+			logger.Errorf("request signature validator: failed to read secrets from etcd")
+		} else {
+			v.keys.watch(super.Cluster(), spec.EtcdPrefix)
+		}
+	}
+
+	switch spec.Scheme {
+	case signatureSchemeAWSSigV4:
+		v.aws = signer.New().
+			SetLiteral(awsLiteral).
+			SetTTL(v.clockSkew).
+			ExcludeBody(spec.ExcludeBody).
+			SetAccessKeyStore(v.keys)
+	case signatureSchemeHMAC:
+		v.hmac = spec.HMAC
+		if v.hmac == nil {
+			v.hmac = &HMACSignatureSpec{}
+		}
+		v.newHash = sha256.New
+		if v.hmac.Algorithm == "hmac-sha512" {
+			v.newHash = sha512.New
+		}
+	}
+	return v
+}
+
+// Validate validates the signature of the request.
+func (v *RequestSignatureValidator) Validate(req *httpprot.Request) error {
+	if v.aws != nil {
+		return v.validateAWS(req)
+	}
+	return v.validateHMAC(req)
+}
+
+func (v *RequestSignatureValidator) validateAWS(req *httpprot.Request) error {
+	vCtx := v.aws.NewVerificationContext()
+	if req.IsStream() {
+		vCtx.ExcludeBody(true)
+	}
+	if err := vCtx.Verify(req.Std(), req.GetPayload); err != nil {
+		return err
+	}
+
+	if aws := v.spec.AWS; aws != nil {
+		// scopes of AWS are region and service.
+		if len(vCtx.Scopes) != 2 {
+			return fmt.Errorf("invalid credential scope")
+		}
+		if aws.Region != "" && vCtx.Scopes[0] != aws.Region {
+			return fmt.Errorf("region %s is not allowed", vCtx.Scopes[0])
+		}
+		if aws.Service != "" && vCtx.Scopes[1] != aws.Service {
+			return fmt.Errorf("service %s is not allowed", vCtx.Scopes[1])
+		}
+	}
+	return nil
+}
+
+func (spec *HMACSignatureSpec) keyIDHeader() string {
+	if spec.KeyIDHeader == "" {
+		return "X-Key-Id"
+	}
+	return spec.KeyIDHeader
+}
+
+func (spec *HMACSignatureSpec) signatureHeader() string {
+	if spec.SignatureHeader == "" {
+		return "X-Signature"
+	}
+	return spec.SignatureHeader
+}
+
+func (spec *HMACSignatureSpec) timestampHeader() string {
+	if spec.TimestampHeader == "" {
+		return "X-Timestamp"
+	}
+	return spec.TimestampHeader
+}
+
+// stringToSign builds the string to sign of the HMAC scheme, which is:
+//
+//	Method + "\n" +
+//	EscapedPath + "\n" +
+//	SortedQuery + "\n" +
+//	Timestamp + "\n" +
+//	lowercase(SignedHeader1) + ":" + Value1 + "\n" + ... +
+//	hex(sha256(Body)), or "UNSIGNED-PAYLOAD" if the body is excluded
+func (v *RequestSignatureValidator) stringToSign(req *httpprot.Request, timestamp string, excludeBody bool) ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteString(req.Method())
+	buf.WriteByte('\n')
+
+	path := req.URL().EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	buf.WriteString(path)
+	buf.WriteByte('\n')
+
+	query := req.URL().Query()
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	buf.WriteString(strings.ReplaceAll(query.Encode(), "+", "%20"))
+	buf.WriteByte('\n')
+
+	buf.WriteString(timestamp)
+	buf.WriteByte('\n')
+
+	for _, name := range v.hmac.SignedHeaders {
+		buf.WriteString(strings.ToLower(name))
+		buf.WriteByte(':')
+		if strings.EqualFold(name, "host") {
+			buf.WriteString(req.Host())
+		} else {
+			buf.WriteString(strings.Join(req.HTTPHeader().Values(name), ","))
+		}
+		buf.WriteByte('\n')
+	}
+
+	if excludeBody {
+		buf.WriteString(hmacUnsignedPayload)
+		return buf.Bytes(), nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, req.GetPayload()); err != nil {
+		return nil, err
+	}
+	buf.WriteString(hex.EncodeToString(h.Sum(nil)))
+	return buf.Bytes(), nil
+}
+
+func (v *RequestSignatureValidator) validateHMAC(req *httpprot.Request) error {
+	h := req.HTTPHeader()
+
+	keyID := h.Get(v.hmac.keyIDHeader())
+	if keyID == "" {
+		return fmt.Errorf("missing header %s", v.hmac.keyIDHeader())
+	}
+	signature, err := hex.DecodeString(h.Get(v.hmac.signatureHeader()))
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("invalid header %s", v.hmac.signatureHeader())
+	}
+
+	timestamp := h.Get(v.hmac.timestampHeader())
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid header %s", v.hmac.timestampHeader())
+	}
+	age := time.Since(time.Unix(sec, 0))
+	if age < -v.clockSkew || age > v.clockSkew {
+		return fmt.Errorf("signature expired")
+	}
+
+	secret, ok := v.keys.GetSecret(keyID)
+	if !ok {
+		return fmt.Errorf("key id not found")
+	}
+
+	data, err := v.stringToSign(req, timestamp, v.spec.ExcludeBody || req.IsStream())
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(v.newHash, []byte(secret))
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// Close closes the validator.
+func (v *RequestSignatureValidator) Close() {
+	v.keys.close()
+}
+
+// GetSecret returns the secret of the key ID.
+func (s *signingKeyStore) GetSecret(id string) (string, bool) {
+	if secret, ok := s.static[id]; ok {
+		return secret, true
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	secret, ok := s.dynamic[id]
+	return secret, ok
+}
+
+func (s *signingKeyStore) update(kvs map[string]string) {
+	keys := make(map[string]string, len(kvs))
+	for _, v := range kvs {
+		key := &etcdSigningKey{}
+		if err := codectool.Unmarshal([]byte(v), key); err != nil {
+			logger.Errorf("failed to unmarshal signing key: %v", err)
+			continue
+		}
+		if key.Key == "" || key.Secret == "" {
+			logger.Errorf("signing key must contain both 'key' and 'secret'")
+			continue
+		}
+		keys[key.Key] = key.Secret
+	}
+
+	s.lock.Lock()
+	s.dynamic = keys
+	s.lock.Unlock()
+}
+
+// watch loads the secrets from etcd and keeps them up to date.
+func (s *signingKeyStore) watch(c cluster.Cluster, etcdPrefix string) {
+	s.cluster = c
+	s.prefix = customDataPrefix + strings.TrimPrefix(etcdPrefix, "/")
+
+	kvs, err := c.GetPrefix(s.prefix)
+	if err != nil {
+		logger.Errorf("failed to get signing keys: %v", err)
+	} else {
+		s.update(kvs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.sync(ctx)
+}
+
+func (s *signingKeyStore) sync(ctx context.Context) {
+	var (
+		syncer cluster.Syncer
+		err    error
+		ch     <-chan map[string]string
+	)
+
+	for {
+		syncer, err = s.cluster.Syncer(30 * time.Minute)
+		if err != nil {
+			logger.Errorf("failed to create syncer: %v", err)
+		} else if ch, err = syncer.SyncPrefix(s.prefix); err != nil {
+			logger.Errorf("failed to sync prefix: %v", err)
+			syncer.Close()
+		} else {
+			break
+		}
+
+		select {
+		case <-time.After(10 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	defer syncer.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case kvs := <-ch:
+			logger.Infof("signing keys update")
+			s.update(kvs)
+		}
+	}
+}
+
+func (s *signingKeyStore) close() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
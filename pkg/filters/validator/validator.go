@@ -18,14 +18,15 @@
 package validator
 
 import (
-	"net/http"
-
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
+	"github.com/megaease/easegress/pkg/util/openapi"
 	"github.com/megaease/easegress/pkg/util/signer"
 	"github.com/megaease/easegress/pkg/util/stringtool"
 )
@@ -63,6 +64,9 @@ type (
 		signer    *signer.Signer
 		oauth2    *OAuth2Validator
 		basicAuth *BasicAuthValidator
+		reqSigner *RequestSignatureValidator
+		xml       *XMLValidator
+		openAPI   *OpenAPIValidator
 	}
 
 	// Spec describes the Validator.
@@ -74,6 +78,10 @@ type (
 		Signature *signer.Spec              `json:"signature,omitempty" jsonschema:"omitempty"`
 		OAuth2    *OAuth2ValidatorSpec      `json:"oauth2,omitempty" jsonschema:"omitempty"`
 		BasicAuth *BasicAuthValidatorSpec   `json:"basicAuth,omitempty" jsonschema:"omitempty"`
+
+		RequestSignature *RequestSignatureValidatorSpec `json:"requestSignature,omitempty" jsonschema:"omitempty"`
+		XML              *XMLValidatorSpec              `json:"xml,omitempty" jsonschema:"omitempty"`
+		OpenAPI          *openapi.OperationSpec         `json:"openAPI,omitempty" jsonschema:"omitempty"`
 	}
 )
 
@@ -82,6 +90,16 @@ func (spec Spec) Validate() error {
 	if spec == (Spec{}) {
 		return fmt.Errorf("none of the validations are defined")
 	}
+	if spec.XML != nil {
+		if err := spec.XML.Validate(); err != nil {
+			return fmt.Errorf("xml: %v", err)
+		}
+	}
+	if spec.OpenAPI != nil {
+		if err := spec.OpenAPI.Validate(); err != nil {
+			return fmt.Errorf("openAPI: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -126,6 +144,15 @@ func (v *Validator) reload() {
 	if v.spec.BasicAuth != nil {
 		v.basicAuth = NewBasicAuthValidator(v.spec.BasicAuth, v.spec.Super())
 	}
+	if v.spec.RequestSignature != nil {
+		v.reqSigner = NewRequestSignatureValidator(v.spec.RequestSignature, v.spec.Super())
+	}
+	if v.spec.XML != nil {
+		v.xml = NewXMLValidator(v.spec.XML)
+	}
+	if v.spec.OpenAPI != nil {
+		v.openAPI = NewOpenAPIValidator(v.spec.OpenAPI)
+	}
 }
 
 // Handle validates the request in the context.
@@ -177,6 +204,28 @@ func (v *Validator) Handle(ctx *context.Context) string {
 			return resultInvalid
 		}
 	}
+	if v.reqSigner != nil {
+		if err := v.reqSigner.Validate(req); err != nil {
+			prepareErrorResponse(http.StatusUnauthorized, "request signature validator: ", err)
+			return resultInvalid
+		}
+	}
+	if v.xml != nil {
+		if err := v.xml.Validate(req); err != nil {
+			prepareErrorResponse(http.StatusBadRequest, "xml validator: ", err)
+			return resultInvalid
+		}
+	}
+	if v.openAPI != nil {
+		if err := v.openAPI.Validate(req); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, openapi.ErrUnsupportedMediaType) {
+				status = http.StatusUnsupportedMediaType
+			}
+			prepareErrorResponse(status, "openapi validator: ", err)
+			return resultInvalid
+		}
+	}
 
 	return ""
 }
@@ -189,4 +238,7 @@ func (v *Validator) Close() {
 	if v.basicAuth != nil {
 		v.basicAuth.Close()
 	}
+	if v.reqSigner != nil {
+		v.reqSigner.Close()
+	}
 }
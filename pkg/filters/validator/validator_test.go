@@ -18,11 +18,15 @@
 package validator
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -36,6 +40,7 @@ import (
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/openapi"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -518,3 +523,217 @@ lastEntry: "byebye"
 		v.Close()
 	})
 }
+
+func TestRequestSignatureAWS(t *testing.T) {
+	assert := assert.New(t)
+
+	// the get-vanilla case of the AWS Signature Version 4 test suite, the
+	// clock skew is large enough for the fixed date of the test case.
+	yamlConfig := `
+kind: Validator
+name: validator
+requestSignature:
+  scheme: awsSigV4
+  clockSkew: 1000000h
+  keys:
+    AKIDEXAMPLE: wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY
+  aws:
+    region: us-east-1
+`
+	v := createValidator(yamlConfig, nil, nil)
+	defer v.Close()
+
+	newCtx := func(signature string) *context.Context {
+		ctx := context.New(nil)
+		req, _ := http.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+		req.Header.Set("X-Amz-Date", "20150830T123600Z")
+		req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, Signature="+signature)
+		setRequest(t, ctx, req)
+		return ctx
+	}
+
+	assert.Equal("", v.Handle(newCtx("5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")))
+	assert.Equal(resultInvalid, v.Handle(newCtx("5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf32")))
+
+	yamlConfig = strings.Replace(yamlConfig, "us-east-1", "us-west-2", 1)
+	v = createValidator(yamlConfig, nil, nil)
+	assert.Equal(resultInvalid, v.Handle(newCtx("5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")))
+
+	// the default clock skew rejects the old signature.
+	yamlConfig = strings.Replace(yamlConfig, "1000000h", "5m", 1)
+	v = createValidator(yamlConfig, nil, nil)
+	assert.Equal(resultInvalid, v.Handle(newCtx("5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")))
+}
+
+func signHMAC(req *http.Request, keyID, secret string, timestamp time.Time, body string) {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	bodyHash := sha256.Sum256([]byte(body))
+	data := req.Method + "\n" + req.URL.EscapedPath() + "\n" + "a=1&b=x%20y" + "\n" + ts + "\n" +
+		"host:" + req.Host + "\n" + "x-tenant:t1\n" + hex.EncodeToString(bodyHash[:])
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+
+	req.Header.Set("X-Key-Id", keyID)
+	req.Header.Set("X-Timestamp", ts)
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestRequestSignatureHMAC(t *testing.T) {
+	assert := assert.New(t)
+
+	clusterInstance, syncerChannel := createClusterAndSyncer()
+	clusterInstance.MockedGetPrefix = func(key string) (map[string]string, error) {
+		assert.Equal("/custom-data/signing-keys/", key)
+		return map[string]string{"/custom-data/signing-keys/k2": "key: k2\nsecret: s2"}, nil
+	}
+	super := supervisor.NewMock(nil, clusterInstance, sync.Map{}, sync.Map{}, nil, nil, false, nil, nil)
+
+	yamlConfig := `
+kind: Validator
+name: validator
+requestSignature:
+  scheme: hmac
+  keys:
+    k1: s1
+  etcdPrefix: signing-keys/
+  hmac:
+    signedHeaders: [Host, X-Tenant]
+`
+	v := createValidator(yamlConfig, nil, super)
+	defer v.Close()
+
+	newCtx := func(keyID, secret string, timestamp time.Time, body string) *context.Context {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/api/v1?b=x+y&a=1", strings.NewReader("body"))
+		stdr.Header.Set("X-Tenant", "t1")
+		signHMAC(stdr, keyID, secret, timestamp, body)
+		req, _ := httpprot.NewRequest(stdr)
+		assert.NoError(req.FetchPayload(0))
+		ctx.SetInputRequest(req)
+		return ctx
+	}
+
+	now := time.Now()
+	assert.Equal("", v.Handle(newCtx("k1", "s1", now, "body")))
+	assert.Equal("", v.Handle(newCtx("k2", "s2", now, "body")))
+	assert.Equal(resultInvalid, v.Handle(newCtx("k1", "s2", now, "body")))
+	assert.Equal(resultInvalid, v.Handle(newCtx("k3", "s3", now, "body")))
+	assert.Equal(resultInvalid, v.Handle(newCtx("k1", "s1", now, "tampered")))
+	assert.Equal(resultInvalid, v.Handle(newCtx("k1", "s1", now.Add(-10*time.Minute), "body")))
+
+	// k2 is removed, and k3 is added.
+	syncerChannel <- map[string]string{"/custom-data/signing-keys/k3": "key: k3\nsecret: s3"}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(resultInvalid, v.Handle(newCtx("k2", "s2", now, "body")))
+	assert.Equal("", v.Handle(newCtx("k3", "s3", now, "body")))
+
+	spec := &RequestSignatureValidatorSpec{Scheme: "hmac"}
+	assert.Error(spec.Validate())
+	spec.Keys = map[string]string{"k": "s"}
+	assert.NoError(spec.Validate())
+	spec.ClockSkew = "1"
+	assert.Error(spec.Validate())
+}
+
+func TestXML(t *testing.T) {
+	assert := assert.New(t)
+	const yamlConfig = `
+kind: Validator
+name: validator
+xml:
+  element: /Envelope/Body/*
+  schema: |
+    <xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+      <xs:element name="GetPrice">
+        <xs:complexType>
+          <xs:sequence>
+            <xs:element name="Item" type="xs:string" maxOccurs="unbounded"/>
+          </xs:sequence>
+        </xs:complexType>
+      </xs:element>
+    </xs:schema>
+`
+	v := createValidator(yamlConfig, nil, nil)
+
+	newCtx := func(body string) *context.Context {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/soap", strings.NewReader(body))
+		req, _ := httpprot.NewRequest(stdr)
+		assert.NoError(req.FetchPayload(0))
+		ctx.SetInputRequest(req)
+		return ctx
+	}
+
+	const envelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>%s</soap:Body></soap:Envelope>`
+	assert.Equal("", v.Handle(newCtx(fmt.Sprintf(envelope, `<GetPrice><Item>Apple</Item></GetPrice>`))))
+
+	ctx := newCtx(fmt.Sprintf(envelope, `<GetPrice><Price>1</Price></GetPrice>`))
+	assert.Equal(resultInvalid, v.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	assert.Equal(resultInvalid, v.Handle(newCtx(fmt.Sprintf(envelope, ""))))
+	assert.Equal(resultInvalid, v.Handle(newCtx("not xml")))
+
+	spec := &XMLValidatorSpec{Schema: "<schema/>"}
+	assert.Error(spec.Validate())
+	spec = &XMLValidatorSpec{Schema: `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"/></xs:schema>`, Element: "a["}
+	assert.Error(spec.Validate())
+	spec.Element = ""
+	assert.NoError(spec.Validate())
+}
+
+func TestOpenAPI(t *testing.T) {
+	assert := assert.New(t)
+	const yamlConfig = `
+kind: Validator
+name: validator
+openAPI:
+  path: /pets/{petId}
+  parameters:
+  - name: petId
+    in: path
+    required: true
+    schema:
+      type: integer
+  requestBody:
+    required: true
+    content:
+      application/json:
+        schema:
+          type: object
+          required: [name]
+`
+	v := createValidator(yamlConfig, nil, nil)
+
+	newCtx := func(path, contentType, body string) *context.Context {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodPut, "http://example.com"+path, strings.NewReader(body))
+		stdr.Header.Set("Content-Type", contentType)
+		req, _ := httpprot.NewRequest(stdr)
+		assert.NoError(req.FetchPayload(0))
+		ctx.SetInputRequest(req)
+		return ctx
+	}
+
+	assert.Equal("", v.Handle(newCtx("/pets/1", "application/json", `{"name": "kitty"}`)))
+
+	ctx := newCtx("/pets/kitty", "application/json", `{"name": "kitty"}`)
+	assert.Equal(resultInvalid, v.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	assert.Equal(resultInvalid, v.Handle(newCtx("/pets/1", "application/json", `{}`)))
+	assert.Equal(resultInvalid, v.Handle(newCtx("/pets/1", "application/json", "")))
+
+	ctx = newCtx("/pets/1", "text/plain", "kitty")
+	assert.Equal(resultInvalid, v.Handle(ctx))
+	assert.Equal(http.StatusUnsupportedMediaType, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	spec := &Spec{OpenAPI: &openapi.OperationSpec{
+		Path:       "/pets",
+		Parameters: []*openapi.Parameter{{Name: "petId", In: "path"}},
+	}}
+	assert.Error(spec.Validate())
+	spec.OpenAPI.Path = "/pets/{petId}"
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/xmltool"
+)
+
+// XMLValidatorSpec defines the configuration of XML validator
+type XMLValidatorSpec struct {
+	// Schema is the XML Schema (XSD) of the body.
+	Schema string `json:"schema" jsonschema:"required"`
+	// Element is the XPath of the elements to validate, the root element is
+	// validated if it is empty. For SOAP requests, it is usually the payload
+	// in the body of the envelope, e.g. /Envelope/Body/*.
+	Element string `json:"element" jsonschema:"omitempty"`
+}
+
+// Validate validates the XMLValidatorSpec.
+func (spec *XMLValidatorSpec) Validate() error {
+	if _, err := xmltool.ParseSchema([]byte(spec.Schema)); err != nil {
+		return fmt.Errorf("invalid schema: %v", err)
+	}
+	if spec.Element != "" {
+		if _, err := xmltool.CompileXPath(spec.Element); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewXMLValidator creates a new XML validator
+func NewXMLValidator(spec *XMLValidatorSpec) *XMLValidator {
+	v := &XMLValidator{spec: spec}
+	v.schema, _ = xmltool.ParseSchema([]byte(spec.Schema))
+	if spec.Element != "" {
+		v.element, _ = xmltool.CompileXPath(spec.Element)
+	}
+	return v
+}
+
+// XMLValidator defines the XML validator
+type XMLValidator struct {
+	spec    *XMLValidatorSpec
+	schema  *xmltool.Schema
+	element *xmltool.XPath
+}
+
+// Validate validates the XML body of a http request
+func (v *XMLValidator) Validate(req *httpprot.Request) error {
+	if req.IsStream() {
+		return fmt.Errorf("cannot validate a stream body")
+	}
+
+	root, err := xmltool.Parse(req.RawPayload())
+	if err != nil {
+		return fmt.Errorf("invalid XML body: %v", err)
+	}
+
+	if v.element == nil {
+		return v.schema.Validate(root)
+	}
+
+	nodes := v.element.SelectNodes(root)
+	if len(nodes) == 0 {
+		return fmt.Errorf("no elements selected by %s", v.element)
+	}
+	for _, n := range nodes {
+		if err := v.schema.Validate(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
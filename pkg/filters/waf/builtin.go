@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+// The built-in rule sets, the IDs of the rules are in the ranges of the
+// OWASP Core Rule Set for the same attacks, but the rules are much simpler.
+var ruleSets = map[string][]*Rule{
+	"pathTraversal": {
+		{
+			ID:          "930100",
+			Description: "Path traversal attack (/../)",
+			Targets:     []string{"uri", "args", "headers:Referer"},
+			Transforms:  []string{"urlDecode", "urlDecode", "normalizeSlashes"},
+			Pattern:     `(?:^|/)\.\.(?:/|$)`,
+		},
+		{
+			ID:          "930110",
+			Description: "Path traversal attack with overlong or unicode encoding",
+			Targets:     []string{"uri", "args"},
+			Transforms:  []string{"lowercase"},
+			Pattern:     `%c0%ae|%c0%af|%c1%9c|%e0%80%ae|%u002e|%u2215|%u2216`,
+		},
+		{
+			ID:          "930120",
+			Description: "Access to sensitive OS files",
+			Targets:     []string{"uri", "args"},
+			Transforms:  []string{"urlDecode", "normalizeSlashes", "lowercase"},
+			Pattern:     `(?:^|/)(?:etc/(?:passwd|shadow|group|hosts)|proc/self/|windows/(?:win\.ini|system32))|boot\.ini`,
+		},
+	},
+
+	"xss": {
+		{
+			ID:          "941100",
+			Description: "XSS attack with script tags",
+			Targets:     []string{"args", "argNames", "cookies", "headers:Referer"},
+			Transforms:  []string{"urlDecode", "htmlEntityDecode", "lowercase"},
+			Pattern:     `<script[\s/>]`,
+		},
+		{
+			ID:          "941110",
+			Description: "XSS attack with event handlers",
+			Targets:     []string{"args", "argNames", "cookies", "headers:Referer"},
+			Transforms:  []string{"urlDecode", "htmlEntityDecode", "lowercase"},
+			Pattern:     `<[a-z][^>]*[\s"'/]on[a-z]+\s*=`,
+		},
+		{
+			ID:          "941120",
+			Description: "XSS attack with javascript or vbscript URIs",
+			Targets:     []string{"args", "cookies", "headers:Referer"},
+			Transforms:  []string{"urlDecode", "htmlEntityDecode", "lowercase", "compressWhitespace"},
+			Pattern:     `(?:java|vb)\s?script\s*:`,
+		},
+		{
+			ID:          "941130",
+			Description: "XSS attack with dangerous tags",
+			Targets:     []string{"args", "cookies"},
+			Transforms:  []string{"urlDecode", "htmlEntityDecode", "lowercase"},
+			Pattern:     `<(?:iframe|object|embed|applet|meta|base|frameset)\b`,
+		},
+		{
+			ID:          "941140",
+			Description: "XSS attack with DOM access",
+			Targets:     []string{"args", "cookies"},
+			Transforms:  []string{"urlDecode", "htmlEntityDecode", "lowercase"},
+			Pattern:     `document\.(?:cookie|write|domain)|window\.location|\beval\s*\(|\bexpression\s*\(`,
+		},
+	},
+
+	"sqli": {
+		{
+			ID:          "942100",
+			Description: "SQL injection with UNION SELECT",
+			Targets:     []string{"args", "argNames", "cookies"},
+			Transforms:  []string{"urlDecode", "removeComments", "lowercase", "compressWhitespace"},
+			Pattern:     `\bunion(?:\s|\()+(?:all\s+|distinct\s+)?(?:\()*select\b`,
+		},
+		{
+			ID:          "942110",
+			Description: "SQL injection with tautologies",
+			Targets:     []string{"args", "cookies"},
+			Transforms:  []string{"urlDecode", "removeComments", "lowercase", "compressWhitespace"},
+			Pattern:     `['"]\s*(?:or|and|\|\||&&)\s*\(?\s*['"]?\w*['"]?\s*(?:=|<|>|!=|\blike\b|\bis\b)|['"]\s*(?:or|and)\s+(?:true|not)\b|\b\d+\s*(?:or|and)\s+\d+\s*(?:=|<|>|like\b)`,
+		},
+		{
+			ID:          "942120",
+			Description: "SQL injection with stacked queries",
+			Targets:     []string{"args", "cookies"},
+			Transforms:  []string{"urlDecode", "removeComments", "lowercase", "compressWhitespace"},
+			Pattern:     `;\s*(?:drop|delete|insert|update|alter|create|truncate|exec|execute|shutdown)\b`,
+		},
+		{
+			ID:          "942130",
+			Description: "SQL injection with comments after quotes",
+			Targets:     []string{"args", "cookies"},
+			Transforms:  []string{"urlDecode", "lowercase"},
+			Pattern:     `['"]\s*(?:--|#|/\*)`,
+		},
+		{
+			ID:          "942140",
+			Description: "SQL injection with dangerous functions or tables",
+			Targets:     []string{"args", "cookies"},
+			Transforms:  []string{"urlDecode", "removeComments", "lowercase", "compressWhitespace"},
+			Pattern:     `\b(?:sleep|benchmark|pg_sleep|load_file)\s*\(|\bwaitfor\s+delay\b|\binformation_schema\b|\binto\s+(?:out|dump)file\b|\bxp_cmdshell\b`,
+		},
+	},
+}
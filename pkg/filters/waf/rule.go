@@ -0,0 +1,389 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	defaultScore = 5
+
+	operatorRegex      = "regex"
+	operatorContains   = "contains"
+	operatorEquals     = "equals"
+	operatorBeginsWith = "beginsWith"
+	operatorEndsWith   = "endsWith"
+)
+
+type (
+	// Rule is a rule to detect the attacks, a rule matches a request if
+	// any of its targets matches the pattern after the transforms.
+	Rule struct {
+		ID          string `json:"id" jsonschema:"required"`
+		Description string `json:"description" jsonschema:"omitempty"`
+		// Targets are the parts of the request to inspect, e.g. args,
+		// headers:User-Agent.
+		Targets    []string `json:"targets" jsonschema:"required,minItems=1"`
+		Transforms []string `json:"transforms" jsonschema:"omitempty"`
+		Operator   string   `json:"operator" jsonschema:"omitempty,enum=,enum=regex,enum=contains,enum=equals,enum=beginsWith,enum=endsWith"`
+		Pattern    string   `json:"pattern" jsonschema:"required"`
+		Score      int      `json:"score" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// rule is the compiled rule.
+	rule struct {
+		spec       *Rule
+		targets    []target
+		transforms []transform
+		match      func(string) bool
+		score      int
+	}
+
+	// target is a part of the request, the name is empty for the whole
+	// collection, e.g. all the args.
+	target struct {
+		collection string
+		name       string
+	}
+
+	// value is a value of the request to inspect, the key is the target
+	// of the value, e.g. args:q.
+	value struct {
+		key   string
+		value string
+	}
+
+	transform func(string) string
+)
+
+var (
+	collections = map[string]bool{
+		"method":   false,
+		"uri":      false,
+		"path":     false,
+		"query":    false,
+		"body":     false,
+		"args":     true,
+		"argNames": false,
+		"headers":  true,
+		"cookies":  true,
+	}
+
+	commentRegexp    = regexp.MustCompile(`/\*.*?\*/`)
+	whitespaceRegexp = regexp.MustCompile(`\s+`)
+
+	transforms = map[string]transform{
+		"urlDecode":          urlDecode,
+		"htmlEntityDecode":   html.UnescapeString,
+		"lowercase":          strings.ToLower,
+		"removeComments":     func(s string) string { return commentRegexp.ReplaceAllString(s, " ") },
+		"compressWhitespace": func(s string) string { return whitespaceRegexp.ReplaceAllString(s, " ") },
+		"normalizeSlashes":   func(s string) string { return strings.ReplaceAll(s, `\`, "/") },
+	}
+)
+
+// urlDecode decodes the percent-encoding and '+' leniently, invalid
+// escapes are kept as they are.
+func urlDecode(s string) string {
+	if !strings.ContainsAny(s, "%+") {
+		return s
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '+':
+			sb.WriteByte(' ')
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			sb.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// parseTarget parses a target, which is a collection, or a collection and a
+// name separated by a colon, e.g. args:q.
+func parseTarget(s string) (target, error) {
+	collection, name, _ := strings.Cut(s, ":")
+	named, ok := collections[collection]
+	if !ok {
+		return target{}, fmt.Errorf("unknown target %s", s)
+	}
+	if name != "" && !named {
+		return target{}, fmt.Errorf("target %s doesn't support names", collection)
+	}
+	if collection == "headers" {
+		name = http.CanonicalHeaderKey(name)
+	}
+	return target{collection: collection, name: name}, nil
+}
+
+// matchKey returns whether the key of a value matches the target.
+func (t target) matchKey(key string) bool {
+	if t.name == "" {
+		return key == t.collection || strings.HasPrefix(key, t.collection+":")
+	}
+	return key == t.collection+":"+t.name
+}
+
+// validate validates the rule.
+func (r *Rule) validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("empty rule id")
+	}
+	_, err := newRule(r)
+	return err
+}
+
+func newRule(spec *Rule) (*rule, error) {
+	r := &rule{spec: spec, score: spec.Score}
+	if r.score == 0 {
+		r.score = defaultScore
+	}
+
+	for _, s := range spec.Targets {
+		t, err := parseTarget(s)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", spec.ID, err)
+		}
+		r.targets = append(r.targets, t)
+	}
+
+	for _, name := range spec.Transforms {
+		t, ok := transforms[name]
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown transform %s", spec.ID, name)
+		}
+		r.transforms = append(r.transforms, t)
+	}
+
+	pattern := spec.Pattern
+	switch spec.Operator {
+	case "", operatorRegex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pattern: %v", spec.ID, err)
+		}
+		r.match = re.MatchString
+	case operatorContains:
+		r.match = func(s string) bool { return strings.Contains(s, pattern) }
+	case operatorEquals:
+		r.match = func(s string) bool { return s == pattern }
+	case operatorBeginsWith:
+		r.match = func(s string) bool { return strings.HasPrefix(s, pattern) }
+	case operatorEndsWith:
+		r.match = func(s string) bool { return strings.HasSuffix(s, pattern) }
+	default:
+		return nil, fmt.Errorf("rule %s: unknown operator %s", spec.ID, spec.Operator)
+	}
+	return r, nil
+}
+
+// evaluate returns the key of the first value matching the rule, or empty
+// if none matches. The values excluded are skipped.
+func (r *rule) evaluate(vs *values, excluded func(key string) bool) string {
+	for _, t := range r.targets {
+		for _, v := range vs.get(t) {
+			if excluded != nil && excluded(v.key) {
+				continue
+			}
+			s := v.value
+			for _, tf := range r.transforms {
+				s = tf(s)
+			}
+			if r.match(s) {
+				return v.key
+			}
+		}
+	}
+	return ""
+}
+
+// values are the values of a request to inspect, which are collected
+// lazily.
+type values struct {
+	req         *httpprot.Request
+	maxBodySize int64
+
+	collected map[string][]value
+}
+
+func newValues(req *httpprot.Request, maxBodySize int64) *values {
+	return &values{req: req, maxBodySize: maxBodySize, collected: map[string][]value{}}
+}
+
+func (vs *values) get(t target) []value {
+	all, ok := vs.collected[t.collection]
+	if !ok {
+		all = vs.collect(t.collection)
+		vs.collected[t.collection] = all
+	}
+	if t.name == "" {
+		return all
+	}
+
+	key := t.collection + ":" + t.name
+	var result []value
+	for _, v := range all {
+		if v.key == key {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// body returns the body to inspect, stream bodies are not inspected, and
+// only the first maxBodySize bytes are inspected.
+func (vs *values) body() []byte {
+	if vs.req.IsStream() {
+		return nil
+	}
+	body := vs.req.RawPayload()
+	if vs.maxBodySize > 0 && int64(len(body)) > vs.maxBodySize {
+		body = body[:vs.maxBodySize]
+	}
+	return body
+}
+
+func (vs *values) collect(collection string) []value {
+	req := vs.req
+	switch collection {
+	case "method":
+		return []value{{key: collection, value: req.Method()}}
+	case "uri":
+		uri := req.Std().RequestURI
+		if uri == "" {
+			uri = req.URL().RequestURI()
+		}
+		return []value{{key: collection, value: uri}}
+	case "path":
+		return []value{{key: collection, value: req.Path()}}
+	case "query":
+		return []value{{key: collection, value: req.URL().RawQuery}}
+	case "body":
+		return []value{{key: collection, value: string(vs.body())}}
+	case "args":
+		return vs.args()
+	case "argNames":
+		var result []value
+		for _, v := range vs.get(target{collection: "args"}) {
+			result = append(result, value{key: collection, value: strings.TrimPrefix(v.key, "args:")})
+		}
+		return result
+	case "headers":
+		var result []value
+		for k, vv := range req.HTTPHeader() {
+			for _, v := range vv {
+				result = append(result, value{key: "headers:" + k, value: v})
+			}
+		}
+		return result
+	case "cookies":
+		var result []value
+		for _, c := range req.Cookies() {
+			result = append(result, value{key: "cookies:" + c.Name, value: c.Value})
+		}
+		return result
+	}
+	return nil
+}
+
+// parseForm parses the url encoded form leniently, invalid pairs are not
+// dropped, so that the attacks can't be hidden by them.
+func parseForm(s string) []value {
+	var result []value
+	for _, pair := range strings.Split(s, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		result = append(result, value{key: "args:" + urlDecode(k), value: urlDecode(v)})
+	}
+	return result
+}
+
+// args returns the query arguments, and the fields of url encoded form
+// bodies or the string values of JSON bodies, the names of the values of
+// JSON bodies are their paths separated by dots.
+func (vs *values) args() []value {
+	result := parseForm(vs.req.URL().RawQuery)
+
+	ct := vs.req.HTTPHeader().Get("Content-Type")
+	switch {
+	case strings.HasPrefix(ct, "application/x-www-form-urlencoded"):
+		result = append(result, parseForm(string(vs.body()))...)
+	case strings.Contains(ct, "json"):
+		var v interface{}
+		if codectool.UnmarshalJSON(vs.body(), &v) == nil {
+			walkJSON("", v, func(name, s string) {
+				result = append(result, value{key: "args:" + name, value: s})
+			})
+		}
+	}
+	return result
+}
+
+func walkJSON(prefix string, v interface{}, fn func(name, s string)) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			walkJSON(join(k), child, fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkJSON(prefix, child, fn)
+		}
+	case string:
+		fn(prefix, v)
+	}
+}
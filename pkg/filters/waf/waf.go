@@ -0,0 +1,334 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package waf implements the WebApplicationFirewall filter, which detects
+// the attacks like SQL injection, XSS and path traversal by rules.
+package waf
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of WebApplicationFirewall.
+	Kind = "WebApplicationFirewall"
+
+	resultBlocked = "blocked"
+
+	modeLogOnly = "logOnly"
+
+	defaultAnomalyThreshold = 5
+	defaultMaxBodySize      = 64 * 1024
+)
+
+var ruleHits = prometheushelper.NewCounter(
+	"waf_rule_hits_total",
+	"The number of requests matching the rule of the web application firewall.",
+	[]string{"pipeline", "filter", "rule"},
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "WebApplicationFirewall detects and blocks the attacks by rules",
+	Results:     []string{resultBlocked},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &WAF{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*WAF)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// WAF is the filter WebApplicationFirewall.
+	WAF struct {
+		spec *Spec
+
+		rules      []*rule
+		exclusions []*exclusion
+		threshold  int
+
+		mutex       sync.Mutex
+		numBlocked  uint64
+		numDetected uint64
+		hits        map[string]uint64
+	}
+
+	// Spec describes the WebApplicationFirewall.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Mode string `json:"mode" jsonschema:"omitempty,enum=,enum=block,enum=logOnly"`
+		// RuleSets are the names of the built-in rule sets.
+		RuleSets   []string     `json:"ruleSets" jsonschema:"omitempty,uniqueItems=true"`
+		Rules      []*Rule      `json:"rules" jsonschema:"omitempty"`
+		Exclusions []*Exclusion `json:"exclusions" jsonschema:"omitempty"`
+		// AnomalyThreshold is the total score of the matched rules to
+		// detect a request as an attack.
+		AnomalyThreshold int   `json:"anomalyThreshold" jsonschema:"omitempty,minimum=0"`
+		MaxBodySize      int64 `json:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Exclusion excludes rules from the requests, or only some values of
+	// the requests from the rules.
+	Exclusion struct {
+		RuleIDs []string             `json:"ruleIDs" jsonschema:"required,minItems=1"`
+		Path    *urlrule.StringMatch `json:"path" jsonschema:"omitempty"`
+		Targets []string             `json:"targets" jsonschema:"omitempty"`
+	}
+
+	exclusion struct {
+		spec    *Exclusion
+		ruleIDs map[string]struct{}
+		targets []target
+	}
+
+	// Status is the status of WebApplicationFirewall.
+	Status struct {
+		NumOfBlocked  uint64            `json:"numOfBlocked"`
+		NumOfDetected uint64            `json:"numOfDetected"`
+		RuleHits      map[string]uint64 `json:"ruleHits"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if len(s.RuleSets) == 0 && len(s.Rules) == 0 {
+		return fmt.Errorf("no rule sets or rules")
+	}
+
+	ids := map[string]struct{}{}
+	for _, name := range s.RuleSets {
+		rules, ok := ruleSets[name]
+		if !ok {
+			return fmt.Errorf("unknown rule set %s", name)
+		}
+		for _, r := range rules {
+			ids[r.ID] = struct{}{}
+		}
+	}
+
+	for _, r := range s.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if _, ok := ids[r.ID]; ok {
+			return fmt.Errorf("duplicated rule id %s", r.ID)
+		}
+		ids[r.ID] = struct{}{}
+	}
+
+	for i, e := range s.Exclusions {
+		if e.Path != nil {
+			if err := e.Path.Validate(); err != nil {
+				return fmt.Errorf("exclusion %d: %v", i, err)
+			}
+		}
+		for _, t := range e.Targets {
+			if _, err := parseTarget(t); err != nil {
+				return fmt.Errorf("exclusion %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the WebApplicationFirewall filter instance.
+func (w *WAF) Name() string {
+	return w.spec.Name()
+}
+
+// Kind returns the kind of WebApplicationFirewall.
+func (w *WAF) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the WebApplicationFirewall.
+func (w *WAF) Spec() filters.Spec {
+	return w.spec
+}
+
+// Init initializes WebApplicationFirewall.
+func (w *WAF) Init() {
+	w.reload()
+}
+
+// Inherit inherits previous generation of WebApplicationFirewall.
+func (w *WAF) Inherit(previousGeneration filters.Filter) {
+	w.reload()
+}
+
+func (w *WAF) reload() {
+	w.hits = map[string]uint64{}
+
+	w.threshold = w.spec.AnomalyThreshold
+	if w.threshold == 0 {
+		w.threshold = defaultAnomalyThreshold
+	}
+
+	specs := []*Rule{}
+	for _, name := range w.spec.RuleSets {
+		specs = append(specs, ruleSets[name]...)
+	}
+	specs = append(specs, w.spec.Rules...)
+	for _, spec := range specs {
+		// the rules have been validated.
+		r, _ := newRule(spec)
+		w.rules = append(w.rules, r)
+	}
+
+	for _, spec := range w.spec.Exclusions {
+		e := &exclusion{spec: spec, ruleIDs: map[string]struct{}{}}
+		for _, id := range spec.RuleIDs {
+			e.ruleIDs[id] = struct{}{}
+		}
+		for _, s := range spec.Targets {
+			t, _ := parseTarget(s)
+			e.targets = append(e.targets, t)
+		}
+		if spec.Path != nil {
+			spec.Path.Init()
+		}
+		w.exclusions = append(w.exclusions, e)
+	}
+}
+
+// excludedKeys returns the function to check whether a value is excluded
+// from the rule, it returns skip if the whole rule is excluded.
+func (w *WAF) excludedKeys(r *rule, path string) (excluded func(string) bool, skip bool) {
+	var targets []target
+	for _, e := range w.exclusions {
+		if _, ok := e.ruleIDs[r.spec.ID]; !ok {
+			continue
+		}
+		if e.spec.Path != nil && !e.spec.Path.Match(path) {
+			continue
+		}
+		if len(e.targets) == 0 {
+			return nil, true
+		}
+		targets = append(targets, e.targets...)
+	}
+
+	if len(targets) == 0 {
+		return nil, false
+	}
+	return func(key string) bool {
+		for _, t := range targets {
+			if t.matchKey(key) {
+				return true
+			}
+		}
+		return false
+	}, false
+}
+
+// Handle inspects the request.
+func (w *WAF) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	maxBodySize := w.spec.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+	vs := newValues(req, maxBodySize)
+
+	score := 0
+	var matched []string
+	for _, r := range w.rules {
+		excluded, skip := w.excludedKeys(r, req.Path())
+		if skip {
+			continue
+		}
+		key := r.evaluate(vs, excluded)
+		if key == "" {
+			continue
+		}
+		score += r.score
+		matched = append(matched, r.spec.ID)
+		logger.Infof("%s: request %s %s matched rule %s (%s) at %s",
+			w.Name(), req.Method(), req.Path(), r.spec.ID, r.spec.Description, key)
+	}
+
+	if len(matched) == 0 {
+		return ""
+	}
+
+	w.mutex.Lock()
+	for _, id := range matched {
+		w.hits[id]++
+		ruleHits.WithLabelValues(w.spec.Pipeline(), w.Name(), id).Inc()
+	}
+	detected := score >= w.threshold
+	if detected {
+		w.numDetected++
+		if w.spec.Mode != modeLogOnly {
+			w.numBlocked++
+		}
+	}
+	w.mutex.Unlock()
+
+	if !detected {
+		return ""
+	}
+
+	ctx.AddTag(stringtool.Cat("waf: rules ", strings.Join(matched, ",")))
+	if w.spec.Mode == modeLogOnly {
+		return ""
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusForbidden)
+	ctx.SetOutputResponse(resp)
+	return resultBlocked
+}
+
+// Status returns status.
+func (w *WAF) Status() interface{} {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	s := &Status{
+		NumOfBlocked:  w.numBlocked,
+		NumOfDetected: w.numDetected,
+		RuleHits:      make(map[string]uint64, len(w.hits)),
+	}
+	for id, n := range w.hits {
+		s.RuleHits[id] = n
+	}
+	return s
+}
+
+// Close closes WebApplicationFirewall.
+func (w *WAF) Close() {
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waf
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestWAF(assert *assert.Assertions, yamlConfig string) *WAF {
+	rawSpec := map[string]interface{}{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), &rawSpec))
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	w := kind.CreateInstance(spec).(*WAF)
+	w.Init()
+	return w
+}
+
+func newTestContext(method, url string, header http.Header, body string) *context.Context {
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{RuleSets: []string{"unknown"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{RuleSets: []string{"sqli"}, Rules: []*Rule{{ID: "942100", Targets: []string{"args"}, Pattern: "a"}}}
+	assert.Error(spec.Validate())
+
+	for _, r := range []*Rule{
+		{ID: "1", Targets: []string{"unknown"}, Pattern: "a"},
+		{ID: "1", Targets: []string{"path:a"}, Pattern: "a"},
+		{ID: "1", Targets: []string{"args"}, Pattern: "("},
+		{ID: "1", Targets: []string{"args"}, Pattern: "a", Transforms: []string{"unknown"}},
+		{ID: "1", Targets: []string{"args"}, Pattern: "a", Operator: "unknown"},
+	} {
+		spec = &Spec{Rules: []*Rule{r}}
+		assert.Error(spec.Validate())
+	}
+
+	spec = &Spec{RuleSets: []string{"sqli"}, Exclusions: []*Exclusion{{RuleIDs: []string{"942100"}, Targets: []string{"unknown"}}}}
+	assert.Error(spec.Validate())
+}
+
+func TestBuiltinRules(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newTestWAF(assert, `
+kind: WebApplicationFirewall
+name: waf
+ruleSets: [sqli, xss, pathTraversal]
+`)
+	defer w.Close()
+
+	attacks := []struct {
+		url    string
+		header http.Header
+		body   string
+		rule   string
+	}{
+		{url: "/?id=1%20UNION%20SELECT%20password%20FROM%20users", rule: "942100"},
+		{url: "/?id=1/**/union/**/all/**/select/**/1", rule: "942100"},
+		{url: "/?name=admin'%20or%20'1'='1", rule: "942110"},
+		{url: "/?id=1;%20DROP%20TABLE%20users", rule: "942120"},
+		{url: "/?name=admin'--", rule: "942130"},
+		{url: "/?id=1%20and%20sleep(5)", rule: "942140"},
+		{url: "/?q=%3Cscript%3Ealert(1)%3C/script%3E", rule: "941100"},
+		{url: "/?q=%26lt%3Bscript%26gt%3B", rule: "941100"},
+		{url: "/?q=<img src=x onerror=alert(1)>", rule: "941110"},
+		{url: "/?u=javascript:alert(1)", rule: "941120"},
+		{url: "/?q=<iframe src=//evil.com>", rule: "941130"},
+		{url: "/?q=document.cookie", rule: "941140"},
+		{url: "/static/..%2f..%2fapp.conf", rule: "930100"},
+		{url: "/?file=..%252f..%252fapp.conf", rule: "930100"},
+		{url: "/?file=..%5c..%5cwin.conf", rule: "930100"},
+		{url: "/static/%c0%ae%c0%ae/x", rule: "930110"},
+		{url: "/?file=/etc/passwd", rule: "930120"},
+		{url: "/", header: http.Header{"Cookie": {"session=' or 1=1"}}, rule: "942110"},
+		{url: "/", header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}, body: "comment=<script>alert(1)</script>", rule: "941100"},
+		{url: "/", header: http.Header{"Content-Type": {"application/json"}}, body: `{"user":{"name":"x' or 'a'='a"}}`, rule: "942110"},
+	}
+	for _, a := range attacks {
+		ctx := newTestContext(http.MethodPost, "http://127.0.0.1"+a.url, a.header, a.body)
+		assert.Equal(resultBlocked, w.Handle(ctx), a.url)
+		assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+		assert.Contains(w.hits, a.rule, a.url)
+	}
+
+	benign := []string{
+		"/?q=select+a+product+from+the+list",
+		"/?q=I+said+'yes'+and+'no'",
+		"/?q=rock+%26+roll",
+		"/?name=O'Brien",
+		"/?q=1+%3C+2",
+		"/?email=a.b%40example.com",
+		"/docs/v1.2/index.html",
+		"/?q=javascript+tutorial",
+		"/?q=union+station",
+	}
+	for _, url := range benign {
+		ctx := newTestContext(http.MethodGet, "http://127.0.0.1"+url, nil, "")
+		assert.Equal("", w.Handle(ctx), url)
+	}
+
+	status := w.Status().(*Status)
+	assert.Equal(uint64(len(attacks)), status.NumOfBlocked)
+	assert.Equal(uint64(len(attacks)), status.NumOfDetected)
+}
+
+func TestCustomRulesAndExclusions(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newTestWAF(assert, `
+kind: WebApplicationFirewall
+name: waf
+mode: logOnly
+ruleSets: [sqli]
+rules:
+- id: "100001"
+  targets: ["headers:User-Agent"]
+  transforms: [lowercase]
+  operator: contains
+  pattern: sqlmap
+- id: "100002"
+  targets: [path]
+  operator: beginsWith
+  pattern: /admin
+  score: 3
+exclusions:
+- ruleIDs: ["942110"]
+  targets: ["args:password"]
+- ruleIDs: ["942130"]
+  path:
+    prefix: /search
+`)
+	defer w.Close()
+
+	// the log only mode doesn't block the requests.
+	ctx := newTestContext(http.MethodGet, "http://127.0.0.1/", http.Header{"User-Agent": {"SQLMap/1.0"}}, "")
+	assert.Equal("", w.Handle(ctx))
+	assert.Nil(ctx.GetOutputResponse())
+	assert.Contains(ctx.Tags(), "waf: rules 100001")
+
+	// the score is below the threshold.
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/admin", nil, "")
+	assert.Equal("", w.Handle(ctx))
+	assert.NotContains(ctx.Tags(), "waf")
+
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/?password=a'or'1'='1", nil, "")
+	w.Handle(ctx)
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/search?q=a'--", nil, "")
+	w.Handle(ctx)
+
+	status := w.Status().(*Status)
+	assert.Equal(uint64(0), status.NumOfBlocked)
+	assert.Equal(uint64(1), status.NumOfDetected)
+	assert.Equal(map[string]uint64{"100001": 1, "100002": 1}, status.RuleHits)
+
+	// the exclusion of targets doesn't exclude others.
+	ctx = newTestContext(http.MethodGet, "http://127.0.0.1/?name=a'or'1'='1", nil, "")
+	w.Handle(ctx)
+	assert.Equal(uint64(1), w.Status().(*Status).RuleHits["942110"])
+}
+
+func TestURLDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("a b/c", urlDecode("a+b%2fc"))
+	assert.Equal("%zz%2", urlDecode("%zz%2"))
+	assert.Equal("abc", urlDecode("abc"))
+}
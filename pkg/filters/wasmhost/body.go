@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"bytes"
+	"io"
+)
+
+const (
+	defaultBodyChunkSize = 64 << 10
+	maxBodyChunkSize     = 1 << 20
+)
+
+// bodyStream gives the wasm code chunked access to a body, so that large
+// bodies can be processed without loading them into the wasm memory at
+// once.
+//
+// The chunks written by the wasm code replace the chunks it has read, and
+// the unread part of the body follows them. That is, a filter transforms the
+// body by reading a chunk and writing the transformed one, inspects the body
+// by only reading it, and prepends data to the body by only writing.
+type bodyStream struct {
+	src      io.Reader
+	isStream bool
+	eof      bool
+	written  bool
+	read     bytes.Buffer
+	out      bytes.Buffer
+}
+
+// payload is the common interface of the payloads of requests and responses.
+type payload interface {
+	IsStream() bool
+	GetPayload() io.Reader
+}
+
+func newBodyStream(p payload) *bodyStream {
+	return &bodyStream{src: p.GetPayload(), isStream: p.IsStream()}
+}
+
+// readChunk reads the next chunk of at most n bytes, it returns an empty
+// chunk at the end of the body.
+func (bs *bodyStream) readChunk(n int) ([]byte, error) {
+	if bs.eof {
+		return nil, nil
+	}
+
+	if n <= 0 {
+		n = defaultBodyChunkSize
+	} else if n > maxBodyChunkSize {
+		n = maxBodyChunkSize
+	}
+
+	chunk := make([]byte, n)
+	n, err := io.ReadFull(bs.src, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		bs.eof, err = true, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	chunk = chunk[:n]
+	// the chunks read are only kept for passing through when nothing is
+	// written.
+	if !bs.written {
+		bs.read.Write(chunk)
+	}
+	return chunk, nil
+}
+
+// writeChunk appends a chunk to the output.
+func (bs *bodyStream) writeChunk(chunk []byte) {
+	if !bs.written {
+		bs.written = true
+		bs.read.Reset()
+	}
+	bs.out.Write(chunk)
+}
+
+// payload returns the payload of the processed body, it is a stream if the
+// original body is a stream and it has not been read to the end.
+func (bs *bodyStream) payload() (interface{}, error) {
+	head := bs.read.Bytes()
+	if bs.written {
+		head = bs.out.Bytes()
+	}
+
+	if bs.eof {
+		return head, nil
+	}
+
+	if bs.isStream {
+		return io.MultiReader(bytes.NewReader(head), bs.src), nil
+	}
+
+	rest, err := io.ReadAll(bs.src)
+	if err != nil {
+		return nil, err
+	}
+	return append(head, rest...), nil
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+func newTestRequest(t *testing.T, body string, stream bool) *httpprot.Request {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/", strings.NewReader(body))
+	req, err := httpprot.NewRequest(stdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream {
+		req.FetchPayload(-1)
+	} else {
+		req.FetchPayload(0)
+	}
+	return req
+}
+
+func readAll(t *testing.T, p interface{}) string {
+	switch v := p.(type) {
+	case []byte:
+		return string(v)
+	case io.Reader:
+		data, err := io.ReadAll(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	t.Fatalf("unexpected payload type %T", p)
+	return ""
+}
+
+func TestBodyStreamReadOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, stream := range []bool{false, true} {
+		bs := newBodyStream(newTestRequest(t, "hello world", stream))
+		chunk, err := bs.readChunk(5)
+		assert.NoError(err)
+		assert.Equal("hello", string(chunk))
+
+		p, err := bs.payload()
+		assert.NoError(err)
+		if stream {
+			assert.Implements((*io.Reader)(nil), p)
+		} else {
+			assert.IsType([]byte{}, p)
+		}
+		assert.Equal("hello world", readAll(t, p))
+	}
+}
+
+func TestBodyStreamTransform(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, stream := range []bool{false, true} {
+		bs := newBodyStream(newTestRequest(t, "abcdefgh", stream))
+		for {
+			chunk, err := bs.readChunk(3)
+			assert.NoError(err)
+			if len(chunk) == 0 {
+				break
+			}
+			bs.writeChunk([]byte(strings.ToUpper(string(chunk))))
+		}
+
+		p, err := bs.payload()
+		assert.NoError(err)
+		assert.IsType([]byte{}, p)
+		assert.Equal("ABCDEFGH", readAll(t, p))
+	}
+}
+
+func TestBodyStreamPartial(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, stream := range []bool{false, true} {
+		// replace the head of the body.
+		bs := newBodyStream(newTestRequest(t, "hello world", stream))
+		bs.readChunk(5)
+		bs.writeChunk([]byte("HI"))
+		p, err := bs.payload()
+		assert.NoError(err)
+		assert.Equal("HI world", readAll(t, p))
+
+		// prepend to the body.
+		bs = newBodyStream(newTestRequest(t, "hello", stream))
+		bs.writeChunk([]byte(">> "))
+		p, err = bs.payload()
+		assert.NoError(err)
+		assert.Equal(">> hello", readAll(t, p))
+	}
+}
+
+func TestBodyStreamChunkSize(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Repeat("a", 2*maxBodyChunkSize)
+	bs := newBodyStream(newTestRequest(t, body, true))
+
+	chunk, err := bs.readChunk(0)
+	assert.NoError(err)
+	assert.Len(chunk, defaultBodyChunkSize)
+
+	chunk, err = bs.readChunk(maxBodyChunkSize * 2)
+	assert.NoError(err)
+	assert.Len(chunk, maxBodyChunkSize)
+
+	chunk, err = bs.readChunk(maxBodyChunkSize)
+	assert.NoError(err)
+	assert.Len(chunk, maxBodyChunkSize-defaultBodyChunkSize)
+
+	chunk, err = bs.readChunk(maxBodyChunkSize)
+	assert.NoError(err)
+	assert.Empty(chunk)
+}
@@ -41,7 +41,13 @@ import (
 
 // helper functions
 
-const wasmMemory = "memory"
+const (
+	wasmMemory = "memory"
+
+	// abiVersion is the version of the host functions, version 2 adds the
+	// chunked body access and the shared key-value functions.
+	abiVersion = 2
+)
 
 func (vm *WasmVM) readDataFromWasm(addr int32) []byte {
 	mem := vm.inst.GetExport(vm.store, wasmMemory).Memory().UnsafeData(vm.store)
@@ -276,6 +282,7 @@ func (vm *WasmVM) hostRequestGetBody() int32 {
 func (vm *WasmVM) hostRequestSetBody(addr int32) {
 	body := vm.readDataFromWasm(addr)
 	req := vm.ctx.GetOutputRequest()
+	vm.reqBody = nil
 	if req.IsStream() {
 		if c, ok := req.GetPayload().(io.Closer); ok {
 			c.Close()
@@ -284,6 +291,24 @@ func (vm *WasmVM) hostRequestSetBody(addr int32) {
 	req.SetPayload(body)
 }
 
+func (vm *WasmVM) hostRequestReadBodyChunk(size int32) int32 {
+	if vm.reqBody == nil {
+		vm.reqBody = newBodyStream(vm.ctx.GetInputRequest())
+	}
+	chunk, e := vm.reqBody.readChunk(int(size))
+	if e != nil {
+		panic(e)
+	}
+	return vm.writeDataToWasm(chunk)
+}
+
+func (vm *WasmVM) hostRequestWriteBodyChunk(addr int32) {
+	if vm.reqBody == nil {
+		vm.reqBody = newBodyStream(vm.ctx.GetInputRequest())
+	}
+	vm.reqBody.writeChunk(vm.readDataFromWasm(addr))
+}
+
 // response functions
 
 func (vm *WasmVM) hostResponseGetStatusCode() int32 {
@@ -345,6 +370,7 @@ func (vm *WasmVM) hostResponseGetBody() int32 {
 func (vm *WasmVM) hostResponseSetBody(addr int32) {
 	body := vm.readDataFromWasm(addr)
 	resp := vm.ctx.GetOutputResponse()
+	vm.respBody = nil
 	if resp.IsStream() {
 		if c, ok := resp.GetPayload().(io.Closer); ok {
 			c.Close()
@@ -353,6 +379,43 @@ func (vm *WasmVM) hostResponseSetBody(addr int32) {
 	resp.SetPayload(body)
 }
 
+func (vm *WasmVM) hostResponseReadBodyChunk(size int32) int32 {
+	if vm.respBody == nil {
+		vm.respBody = newBodyStream(vm.ctx.GetInputResponse())
+	}
+	chunk, e := vm.respBody.readChunk(int(size))
+	if e != nil {
+		panic(e)
+	}
+	return vm.writeDataToWasm(chunk)
+}
+
+func (vm *WasmVM) hostResponseWriteBodyChunk(addr int32) {
+	if vm.respBody == nil {
+		vm.respBody = newBodyStream(vm.ctx.GetInputResponse())
+	}
+	vm.respBody.writeChunk(vm.readDataFromWasm(addr))
+}
+
+// flushBodyStreams sets the bodies processed by chunks to the output
+// request and response.
+func (vm *WasmVM) flushBodyStreams() {
+	if vm.reqBody != nil {
+		p, e := vm.reqBody.payload()
+		if e != nil {
+			panic(e)
+		}
+		vm.ctx.GetOutputRequest().SetPayload(p)
+	}
+	if vm.respBody != nil {
+		p, e := vm.respBody.payload()
+		if e != nil {
+			panic(e)
+		}
+		vm.ctx.GetOutputResponse().SetPayload(p)
+	}
+}
+
 // cluster data functions
 
 func (vm *WasmVM) hostClusterGetBinary(addr int32) int32 {
@@ -500,8 +563,59 @@ func (vm *WasmVM) hostClusterCountKey(prefixAddr int32) int32 {
 	return count
 }
 
+// shared key-value functions
+
+func (vm *WasmVM) hostKVGet(addr int32) int32 {
+	key := vm.readStringFromWasm(addr)
+	val, _, e := vm.host.kv.Get(key)
+	if e != nil {
+		panic(e)
+	}
+	return vm.writeStringToWasm(val)
+}
+
+func (vm *WasmVM) hostKVExists(addr int32) int32 {
+	key := vm.readStringFromWasm(addr)
+	_, ok, e := vm.host.kv.Get(key)
+	if e != nil {
+		panic(e)
+	}
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+func (vm *WasmVM) hostKVSet(keyAddr, valAddr int32, ttlMs int64) {
+	key := vm.readStringFromWasm(keyAddr)
+	val := vm.readStringFromWasm(valAddr)
+	if e := vm.host.kv.Set(key, val, time.Duration(ttlMs)*time.Millisecond); e != nil {
+		panic(e)
+	}
+}
+
+func (vm *WasmVM) hostKVDelete(addr int32) {
+	key := vm.readStringFromWasm(addr)
+	if e := vm.host.kv.Delete(key); e != nil {
+		panic(e)
+	}
+}
+
+func (vm *WasmVM) hostKVIncr(keyAddr int32, delta int64, ttlMs int64) int64 {
+	key := vm.readStringFromWasm(keyAddr)
+	v, e := vm.host.kv.Incr(key, delta, time.Duration(ttlMs)*time.Millisecond)
+	if e != nil {
+		panic(e)
+	}
+	return v
+}
+
 // misc functions
 
+func (vm *WasmVM) hostGetABIVersion() int32 {
+	return abiVersion
+}
+
 func (vm *WasmVM) hostAddTag(addr int32) {
 	tag := vm.readStringFromWasm(addr)
 	vm.ctx.AddTag(tag)
@@ -569,6 +683,8 @@ func (vm *WasmVM) importHostFuncs(linker *wasmtime.Linker) {
 
 	defineFunc("host_req_get_body", vm.hostRequestGetBody)
 	defineFunc("host_req_set_body", vm.hostRequestSetBody)
+	defineFunc("host_req_read_body_chunk", vm.hostRequestReadBodyChunk)
+	defineFunc("host_req_write_body_chunk", vm.hostRequestWriteBodyChunk)
 
 	// response functions
 	defineFunc("host_resp_get_status_code", vm.hostResponseGetStatusCode)
@@ -585,6 +701,8 @@ func (vm *WasmVM) importHostFuncs(linker *wasmtime.Linker) {
 
 	defineFunc("host_resp_get_body", vm.hostResponseGetBody)
 	defineFunc("host_resp_set_body", vm.hostResponseSetBody)
+	defineFunc("host_resp_read_body_chunk", vm.hostResponseReadBodyChunk)
+	defineFunc("host_resp_write_body_chunk", vm.hostResponseWriteBodyChunk)
 
 	// cluster data functions
 	defineFunc("host_cluster_get_binary", vm.hostClusterGetBinary)
@@ -603,7 +721,15 @@ func (vm *WasmVM) importHostFuncs(linker *wasmtime.Linker) {
 
 	defineFunc("host_cluster_count_key", vm.hostClusterCountKey)
 
+	// shared key-value functions
+	defineFunc("host_kv_get", vm.hostKVGet)
+	defineFunc("host_kv_exists", vm.hostKVExists)
+	defineFunc("host_kv_set", vm.hostKVSet)
+	defineFunc("host_kv_delete", vm.hostKVDelete)
+	defineFunc("host_kv_incr", vm.hostKVIncr)
+
 	// misc functions
+	defineFunc("host_get_abi_version", vm.hostGetABIVersion)
 	defineFunc("host_add_tag", vm.hostAddTag)
 	defineFunc("host_log", vm.hostLog)
 	defineFunc("host_get_unix_time_in_ms", vm.hostGetUnixTimeInMs)
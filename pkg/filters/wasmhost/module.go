@@ -0,0 +1,480 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ociScheme = "oci://"
+
+	// maxModuleSize is the maximum size of a wasm module.
+	maxModuleSize = 64 << 20
+)
+
+var (
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+	// wasmLayerMediaTypes are the media types of wasm layers used by the
+	// popular tools, e.g. oras and wasm-to-oci.
+	wasmLayerMediaTypes = []string{
+		"application/vnd.wasm.content.layer.v1+wasm",
+		"application/vnd.module.wasm.content.layer.v1+wasm",
+	}
+
+	manifestMediaTypes = []string{
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+	}
+)
+
+type (
+	// ModuleSpec describes where to fetch the wasm module.
+	ModuleSpec struct {
+		// URL is the URL of the module, it is an HTTP(S) URL, or a reference
+		// of an OCI artifact like oci://ghcr.io/megaease/demo:v1.
+		URL string `json:"url" jsonschema:"required"`
+		// Digest pins the sha256 digest of the module, e.g. sha256:abcd...,
+		// the module is loaded from the local cache if it is cached.
+		Digest string `json:"digest,omitempty" jsonschema:"omitempty"`
+		// Username and Password are the credentials of the OCI registry.
+		Username string `json:"username,omitempty" jsonschema:"omitempty"`
+		Password string `json:"password,omitempty" jsonschema:"omitempty"`
+		// Insecure accesses the OCI registry by plain HTTP.
+		Insecure bool `json:"insecure,omitempty" jsonschema:"omitempty"`
+	}
+
+	// moduleFetcher fetches the wasm modules and caches them by digests.
+	moduleFetcher struct {
+		cacheDir string
+		client   *http.Client
+	}
+
+	ociReference struct {
+		registry   string
+		repository string
+		reference  string
+	}
+
+	ociDescriptor struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Size      int64  `json:"size"`
+	}
+
+	ociManifest struct {
+		MediaType string          `json:"mediaType"`
+		Layers    []ociDescriptor `json:"layers"`
+	}
+)
+
+// Validate validates the module spec.
+func (spec *ModuleSpec) Validate() error {
+	if spec.Digest != "" && !digestRegexp.MatchString(spec.Digest) {
+		return fmt.Errorf("invalid digest %s, must be in the form of sha256:<hex>", spec.Digest)
+	}
+
+	if strings.HasPrefix(spec.URL, ociScheme) {
+		_, err := parseOCIReference(spec.URL)
+		return err
+	}
+
+	u, err := url.Parse(spec.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid module url %s, scheme must be http, https or oci", spec.URL)
+	}
+	return nil
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// parseOCIReference parses references like oci://host/repo:tag or
+// oci://host/repo@sha256:..., the tag defaults to latest.
+func parseOCIReference(str string) (*ociReference, error) {
+	s := strings.TrimPrefix(str, ociScheme)
+	i := strings.IndexByte(s, '/')
+	if i <= 0 || i == len(s)-1 {
+		return nil, fmt.Errorf("invalid oci reference %s", str)
+	}
+
+	ref := &ociReference{registry: s[:i], repository: s[i+1:], reference: "latest"}
+	if j := strings.IndexByte(ref.repository, '@'); j >= 0 {
+		ref.reference = ref.repository[j+1:]
+		ref.repository = ref.repository[:j]
+		if !digestRegexp.MatchString(ref.reference) {
+			return nil, fmt.Errorf("invalid digest in oci reference %s", str)
+		}
+	} else if j := strings.LastIndexByte(ref.repository, ':'); j > strings.LastIndexByte(ref.repository, '/') {
+		ref.reference = ref.repository[j+1:]
+		ref.repository = ref.repository[:j]
+	}
+
+	if ref.repository == "" || ref.reference == "" {
+		return nil, fmt.Errorf("invalid oci reference %s", str)
+	}
+	return ref, nil
+}
+
+func newModuleFetcher(cacheDir string) *moduleFetcher {
+	return &moduleFetcher{
+		cacheDir: cacheDir,
+		client:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (mf *moduleFetcher) cachePath(digest string) string {
+	return filepath.Join(mf.cacheDir, strings.Replace(digest, ":", "-", 1)+".wasm")
+}
+
+func (mf *moduleFetcher) loadCache(digest string) []byte {
+	if mf.cacheDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(mf.cachePath(digest))
+	if err != nil || digestOf(data) != digest {
+		return nil
+	}
+	return data
+}
+
+// saveCache writes the module to a temporary file and renames it, so that
+// a partial written file is never used.
+func (mf *moduleFetcher) saveCache(digest string, data []byte) error {
+	if mf.cacheDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(mf.cacheDir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(mf.cacheDir, "module-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), mf.cachePath(digest))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// fetch returns the module and its digest. A pinned module is loaded from
+// the local cache if possible, otherwise, it is downloaded and verified.
+func (mf *moduleFetcher) fetch(spec *ModuleSpec) ([]byte, string, error) {
+	if spec.Digest != "" {
+		if data := mf.loadCache(spec.Digest); data != nil {
+			return data, spec.Digest, nil
+		}
+	}
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(spec.URL, ociScheme) {
+		data, err = mf.fetchOCI(spec)
+	} else {
+		data, err = mf.fetchHTTP(spec.URL)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	digest := digestOf(data)
+	if spec.Digest != "" && spec.Digest != digest {
+		return nil, "", fmt.Errorf("digest mismatch: expected %s, got %s", spec.Digest, digest)
+	}
+
+	if err = mf.saveCache(digest, data); err != nil {
+		// the module is still usable, so just return it.
+		return data, digest, fmt.Errorf("cache module %s failed: %v", digest, err)
+	}
+	return data, digest, nil
+}
+
+func readBody(resp *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxModuleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxModuleSize {
+		return nil, fmt.Errorf("module is larger than %d bytes", maxModuleSize)
+	}
+	return data, nil
+}
+
+func (mf *moduleFetcher) fetchHTTP(u string) ([]byte, error) {
+	resp, err := mf.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get %s returns status code %d", u, resp.StatusCode)
+	}
+	return readBody(resp)
+}
+
+// ociClient is a minimal client of the OCI distribution API, it supports
+// the anonymous, basic and bearer token authentications.
+type ociClient struct {
+	mf    *moduleFetcher
+	spec  *ModuleSpec
+	ref   *ociReference
+	base  string
+	token string
+}
+
+func (mf *moduleFetcher) fetchOCI(spec *ModuleSpec) ([]byte, error) {
+	ref, err := parseOCIReference(spec.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "https"
+	if spec.Insecure {
+		scheme = "http"
+	}
+	c := &ociClient{
+		mf:   mf,
+		spec: spec,
+		ref:  ref,
+		base: fmt.Sprintf("%s://%s/v2/%s", scheme, ref.registry, ref.repository),
+	}
+
+	// the digest of the module is the digest of the layer, so it could be
+	// downloaded directly if pinned.
+	if spec.Digest != "" {
+		return c.getBlob(spec.Digest)
+	}
+
+	layer, err := c.getWasmLayer()
+	if err != nil {
+		return nil, err
+	}
+	return c.getBlob(layer.Digest)
+}
+
+func (c *ociClient) getWasmLayer() (*ociDescriptor, error) {
+	resp, err := c.get("/manifests/"+c.ref.reference, strings.Join(manifestMediaTypes, ", "))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ociManifest{}
+	if err = json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest failed: %v", err)
+	}
+
+	for i := range manifest.Layers {
+		layer := &manifest.Layers[i]
+		for _, mt := range wasmLayerMediaTypes {
+			if layer.MediaType == mt {
+				return layer, nil
+			}
+		}
+	}
+	if len(manifest.Layers) == 1 {
+		return &manifest.Layers[0], nil
+	}
+	return nil, fmt.Errorf("no wasm layer found in %s", c.spec.URL)
+}
+
+func (c *ociClient) getBlob(digest string) ([]byte, error) {
+	resp, err := c.get("/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if d := digestOf(data); d != digest {
+		return nil, fmt.Errorf("digest mismatch of blob: expected %s, got %s", digest, d)
+	}
+	return data, nil
+}
+
+// get sends a GET request, and retries it once with the credentials if
+// the registry requires authentication.
+func (c *ociClient) get(path, accept string) (*http.Response, error) {
+	for i := 0; ; i++ {
+		req, err := http.NewRequest(http.MethodGet, c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.spec.Username != "" {
+			req.SetBasicAuth(c.spec.Username, c.spec.Password)
+		}
+
+		resp, err := c.mf.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusUnauthorized || i > 0 {
+			return nil, fmt.Errorf("get %s returns status code %d", req.URL, resp.StatusCode)
+		}
+
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			// basic authentication, the credentials are already sent if
+			// configured.
+			if c.spec.Username == "" {
+				return nil, fmt.Errorf("get %s returns status code %d", req.URL, resp.StatusCode)
+			}
+			continue
+		}
+		if err = c.fetchToken(challenge[len("bearer "):]); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseChallenge parses the parameters of a challenge like
+// realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			j := strings.IndexByte(s[1:], '"')
+			if j < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:j+1], s[j+2:]
+			}
+		} else if j := strings.IndexByte(s, ','); j >= 0 {
+			value, s = s[:j], s[j:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func (c *ociClient) fetchToken(challenge string) error {
+	params := parseChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return fmt.Errorf("no realm in the challenge of %s", c.ref.registry)
+	}
+
+	q := url.Values{}
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + c.ref.repository + ":pull"
+	}
+	q.Set("scope", scope)
+
+	u := realm
+	if strings.Contains(u, "?") {
+		u += "&" + q.Encode()
+	} else {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if c.spec.Username != "" {
+		req.SetBasicAuth(c.spec.Username, c.spec.Password)
+	}
+
+	resp, err := c.mf.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get token from %s returns status code %d", realm, resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal(bytes.TrimSpace(data), &token); err != nil {
+		return fmt.Errorf("unmarshal token failed: %v", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("no token returned from %s", realm)
+	}
+	return nil
+}
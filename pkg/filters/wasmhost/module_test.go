@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasmhost
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	assert := assert.New(t)
+
+	ref, err := parseOCIReference("oci://ghcr.io/megaease/demo:v1")
+	assert.NoError(err)
+	assert.Equal(&ociReference{registry: "ghcr.io", repository: "megaease/demo", reference: "v1"}, ref)
+
+	ref, err = parseOCIReference("oci://localhost:5000/demo")
+	assert.NoError(err)
+	assert.Equal(&ociReference{registry: "localhost:5000", repository: "demo", reference: "latest"}, ref)
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	ref, err = parseOCIReference("oci://localhost:5000/demo@" + digest)
+	assert.NoError(err)
+	assert.Equal(digest, ref.reference)
+
+	for _, s := range []string{"oci://ghcr.io", "oci://ghcr.io/", "oci://ghcr.io/demo@sha256:1", "oci://ghcr.io/demo:"} {
+		_, err = parseOCIReference(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestModuleSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&ModuleSpec{URL: "https://example.com/demo.wasm"}).Validate())
+	assert.NoError((&ModuleSpec{URL: "oci://ghcr.io/megaease/demo:v1"}).Validate())
+	assert.Error((&ModuleSpec{URL: "ftp://example.com/demo.wasm"}).Validate())
+	assert.Error((&ModuleSpec{URL: "https://example.com/demo.wasm", Digest: "md5:1234"}).Validate())
+}
+
+func TestFetchHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	module := []byte("\x00asm module")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(module)
+	}))
+	defer server.Close()
+
+	mf := newModuleFetcher(t.TempDir())
+	spec := &ModuleSpec{URL: server.URL + "/demo.wasm"}
+
+	data, digest, err := mf.fetch(spec)
+	assert.NoError(err)
+	assert.Equal(module, data)
+	assert.Equal(digestOf(module), digest)
+
+	// a pinned module is loaded from the cache.
+	spec.Digest = digest
+	data, _, err = mf.fetch(spec)
+	assert.NoError(err)
+	assert.Equal(module, data)
+	assert.Equal(1, requests)
+
+	spec.Digest = "sha256:" + strings.Repeat("0", 64)
+	_, _, err = mf.fetch(spec)
+	assert.Error(err)
+	assert.Equal(2, requests)
+}
+
+func TestFetchOCI(t *testing.T) {
+	assert := assert.New(t)
+
+	module := []byte("\x00asm oci module")
+	digest := digestOf(module)
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "layers": [{"mediaType": "application/vnd.wasm.content.layer.v1+wasm", "digest": "%s", "size": %d}]}`, digest, len(module))
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			user, pass, _ := r.BasicAuth()
+			if user != "user" || pass != "pass" || r.URL.Query().Get("scope") != "repository:megaease/demo:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"token": "abc"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/megaease/demo/manifests/v1":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Write([]byte(manifest))
+		case "/v2/megaease/demo/blobs/" + digest:
+			w.Write(module)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	url := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/megaease/demo:v1"
+	spec := &ModuleSpec{URL: url, Username: "user", Password: "pass", Insecure: true}
+
+	mf := newModuleFetcher("")
+	data, d, err := mf.fetch(spec)
+	assert.NoError(err)
+	assert.Equal(module, data)
+	assert.Equal(digest, d)
+
+	// pinned by digest, the blob is downloaded directly.
+	spec.URL = "oci://" + strings.TrimPrefix(server.URL, "http://") + "/megaease/demo:none"
+	spec.Digest = digest
+	data, _, err = mf.fetch(spec)
+	assert.NoError(err)
+	assert.Equal(module, data)
+
+	spec.Digest = ""
+	_, _, err = mf.fetch(spec)
+	assert.Error(err)
+
+	spec.Password = "bad"
+	spec.URL = url
+	_, _, err = mf.fetch(spec)
+	assert.Error(err)
+}
+
+func TestParseChallenge(t *testing.T) {
+	assert := assert.New(t)
+
+	params := parseChallenge(`realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:a/b:pull"`)
+	assert.Equal(map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:a/b:pull",
+	}, params)
+}
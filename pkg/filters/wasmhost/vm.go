@@ -38,6 +38,11 @@ type WasmVM struct {
 	fnRun   *wasmtime.Func
 	fnAlloc *wasmtime.Func
 	fnFree  *wasmtime.Func
+
+	// reqBody and respBody are the body streams of the current request,
+	// they are created on the first chunked access.
+	reqBody  *bodyStream
+	respBody *bodyStream
 }
 
 // Interrupt interrupts the execution of wasm code
@@ -27,12 +27,14 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/kvstore"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/logger"
@@ -44,6 +46,14 @@ const (
 	// Kind is the kind of WasmHost.
 	Kind          = "WasmHost"
 	maxWasmResult = 9
+
+	// wasmModuleCacheDir is the directory under the home directory to
+	// cache the modules fetched by digests.
+	wasmModuleCacheDir = "wasm-modules"
+
+	// kvPurgeInterval is the interval to purge the expired keys of the
+	// shared key-value namespace.
+	kvPurgeInterval = time.Minute
 )
 
 var (
@@ -89,10 +99,15 @@ type (
 		filters.BaseSpec `json:",inline"`
 
 		MaxConcurrency int32             `json:"maxConcurrency" jsonschema:"required,minimum=1"`
-		Code           string            `json:"code" jsonschema:"required"`
+		Code           string            `json:"code" jsonschema:"omitempty"`
+		Module         *ModuleSpec       `json:"module,omitempty" jsonschema:"omitempty"`
 		Timeout        string            `json:"timeout" jsonschema:"required,format=duration"`
 		Parameters     map[string]string `json:"parameters" jsonschema:"omitempty"`
-		timeout        time.Duration
+		// KVNamespace is the namespace of the shared key-value functions,
+		// WasmHosts in the same namespace share the data. It defaults to
+		// a namespace private to the filter.
+		KVNamespace string `json:"kvNamespace,omitempty" jsonschema:"omitempty"`
+		timeout     time.Duration
 	}
 
 	// WasmHost is the WebAssembly filter
@@ -100,7 +115,10 @@ type (
 		spec *Spec
 
 		code       []byte
+		digest     atomic.Value
+		fetcher    *moduleFetcher
 		dataPrefix string
+		kv         *kvstore.Store
 		data       atomic.Value
 		vmPool     atomic.Value
 		chStop     chan struct{}
@@ -112,11 +130,23 @@ type (
 	// Status is the status of WasmHost
 	Status struct {
 		Health         string `json:"health"`
+		ModuleDigest   string `json:"moduleDigest,omitempty"`
 		NumOfRequest   int64  `json:"numOfRequest"`
 		NumOfWasmError int64  `json:"numOfWasmError"`
 	}
 )
 
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if (spec.Code == "") == (spec.Module == nil) {
+		return fmt.Errorf("one and only one of code and module must be specified")
+	}
+	if strings.Contains(spec.KVNamespace, "/") {
+		return fmt.Errorf("kvNamespace must not contain '/'")
+	}
+	return nil
+}
+
 // Name returns the name of the WasmHost filter instance.
 func (wh *WasmHost) Name() string {
 	return wh.spec.Name()
@@ -168,18 +198,34 @@ func isURL(str string) bool {
 	return false
 }
 
-func (wh *WasmHost) readWasmCode() ([]byte, error) {
-	if isURL(wh.spec.Code) {
-		return readWasmCodeFromURL(wh.spec.Code)
+// readWasmCode returns the wasm code and its digest, the digest is only
+// available for the code from the module.
+func (wh *WasmHost) readWasmCode() ([]byte, string, error) {
+	if wh.spec.Module != nil {
+		code, digest, err := wh.fetcher.fetch(wh.spec.Module)
+		if err != nil && code == nil {
+			return nil, "", err
+		}
+		if err != nil {
+			logger.Warnf("%v", err)
+		}
+		return code, digest, nil
 	}
-	if _, e := os.Stat(wh.spec.Code); e == nil {
-		return os.ReadFile(wh.spec.Code)
+
+	var code []byte
+	var err error
+	if isURL(wh.spec.Code) {
+		code, err = readWasmCodeFromURL(wh.spec.Code)
+	} else if _, e := os.Stat(wh.spec.Code); e == nil {
+		code, err = os.ReadFile(wh.spec.Code)
+	} else {
+		code, err = base64.StdEncoding.DecodeString(wh.spec.Code)
 	}
-	return base64.StdEncoding.DecodeString(wh.spec.Code)
+	return code, "", err
 }
 
 func (wh *WasmHost) loadWasmCode() error {
-	code, e := wh.readWasmCode()
+	code, digest, e := wh.readWasmCode()
 	if e != nil {
 		logger.Errorf("failed to load wasm code: %v", e)
 		return e
@@ -197,6 +243,7 @@ func (wh *WasmHost) loadWasmCode() error {
 	wh.code = code
 
 	wh.vmPool.Store(p)
+	wh.digest.Store(digest)
 	return nil
 }
 
@@ -275,17 +322,43 @@ func (wh *WasmHost) watchWasmData() {
 	}
 }
 
+func (wh *WasmHost) purgeExpiredKV() {
+	for {
+		select {
+		case <-time.After(kvPurgeInterval):
+			if !wh.Cluster().IsLeader() {
+				continue
+			}
+			if _, err := wh.kv.Purge(); err != nil {
+				logger.Errorf("failed to purge expired wasm kv: %v", err)
+			}
+
+		case <-wh.chStop:
+			return
+		}
+	}
+}
+
 func (wh *WasmHost) reload() {
 	spec := wh.spec
 
 	wh.dataPrefix = wh.Cluster().Layout().WasmDataPrefix(spec.Pipeline(), spec.Name())
+	ns := spec.KVNamespace
+	if ns == "" {
+		ns = spec.Pipeline() + "-" + spec.Name()
+	}
+	wh.kv = kvstore.NewStore(wh.Cluster(), wh.Cluster().Layout().WasmKVPrefix(ns))
 
 	wh.spec.timeout, _ = time.ParseDuration(wh.spec.Timeout)
 	wh.chStop = make(chan struct{})
+	if wh.fetcher == nil {
+		wh.fetcher = newModuleFetcher(filepath.Join(spec.Super().Options().AbsHomeDir, wasmModuleCacheDir))
+	}
 
 	wh.loadWasmCode()
 	go wh.watchWasmCode()
 	go wh.watchWasmData()
+	go wh.purgeExpiredKV()
 }
 
 // Init initializes WasmHost.
@@ -295,6 +368,8 @@ func (wh *WasmHost) Init() {
 
 // Inherit inherits previous generation of WasmHost.
 func (wh *WasmHost) Inherit(previousGeneration filters.Filter) {
+	prev := previousGeneration.(*WasmHost)
+	wh.fetcher = prev.fetcher
 	wh.reload()
 }
 
@@ -317,6 +392,7 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 		return resultOutOfVM
 	}
 	vm.ctx = ctx
+	vm.reqBody, vm.respBody = nil, nil
 	atomic.AddInt64(&wh.numOfRequest, 1)
 
 	var wg sync.WaitGroup
@@ -367,6 +443,7 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 	if !ok || n < 0 || n > maxWasmResult {
 		panic(fmt.Errorf("invalid wasm result: %v", r))
 	}
+	vm.flushBodyStreams()
 
 	return wasmResultToFilterResult(n)
 }
@@ -380,6 +457,9 @@ func (wh *WasmHost) Status() interface{} {
 	} else {
 		s.Health = "ready"
 	}
+	if d := wh.digest.Load(); d != nil {
+		s.ModuleDigest = d.(string)
+	}
 
 	s.NumOfRequest = atomic.LoadInt64(&wh.numOfRequest)
 	s.NumOfWasmError = atomic.LoadInt64(&wh.numOfWasmError)
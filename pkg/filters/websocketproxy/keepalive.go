@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocketproxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/megaease/easegress/pkg/util/workerpool"
+)
+
+// keepAliver pings the connections registered to it from a shared worker
+// pool, instead of a goroutine per connection. The ticker and the workers
+// are started by the first connection and stopped after the last one is
+// removed, so a keepAliver needs no closing and outlives the generation of
+// the filter creating it.
+type keepAliver struct {
+	interval  time.Duration
+	timeout   time.Duration
+	workers   int
+	queueSize int
+
+	lock  sync.Mutex
+	conns map[*websocket.Conn]struct{}
+	pool  *workerpool.Pool
+	done  chan struct{}
+}
+
+func newKeepAliver(interval, timeout time.Duration, spec *WorkerPoolSpec) *keepAliver {
+	ka := &keepAliver{
+		interval:  interval,
+		timeout:   timeout,
+		workers:   spec.Workers,
+		queueSize: spec.QueueSize,
+		conns:     map[*websocket.Conn]struct{}{},
+	}
+	if ka.workers <= 0 {
+		ka.workers = defaultWorkers
+	}
+	if ka.queueSize <= 0 {
+		ka.queueSize = defaultWorkerQueueSize
+	}
+	return ka
+}
+
+// add registers conn to be pinged, and closes it if no pong is received
+// within the pong timeout.
+func (ka *keepAliver) add(conn *websocket.Conn) {
+	wait := ka.interval + ka.timeout
+	conn.SetReadDeadline(time.Now().Add(wait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wait))
+	})
+
+	ka.lock.Lock()
+	defer ka.lock.Unlock()
+
+	if len(ka.conns) == 0 {
+		ka.pool = workerpool.New(ka.workers, ka.queueSize)
+		ka.done = make(chan struct{})
+		go ka.run(ka.pool, ka.done)
+	}
+	ka.conns[conn] = struct{}{}
+}
+
+// remove unregisters conn.
+func (ka *keepAliver) remove(conn *websocket.Conn) {
+	ka.lock.Lock()
+	delete(ka.conns, conn)
+	if len(ka.conns) > 0 {
+		ka.lock.Unlock()
+		return
+	}
+	pool, done := ka.pool, ka.done
+	ka.pool, ka.done = nil, nil
+	ka.lock.Unlock()
+
+	close(done)
+	pool.Close()
+}
+
+func (ka *keepAliver) run(pool *workerpool.Pool, done chan struct{}) {
+	ticker := time.NewTicker(ka.interval)
+	defer ticker.Stop()
+
+	conns := []*websocket.Conn{}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		conns = conns[:0]
+		ka.lock.Lock()
+		for conn := range ka.conns {
+			conns = append(conns, conn)
+		}
+		ka.lock.Unlock()
+
+		// The ping is skipped if the queue is full, which applies the
+		// backpressure, and the connection is pinged again at next tick.
+		for _, conn := range conns {
+			conn := conn
+			pool.TrySubmit(func() {
+				deadline := time.Now().Add(ka.timeout)
+				conn.WriteControl(websocket.PingMessage, nil, deadline)
+			})
+		}
+	}
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocketproxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	xForwardedFor   = "X-Forwarded-For"
+	xForwardedHost  = "X-Forwarded-Host"
+	xForwardedProto = "X-Forwarded-Proto"
+
+	// closeTimeout is the timeout to send the close message.
+	closeTimeout = time.Second
+)
+
+// headersToSkip are the request headers set by the gorilla library, the
+// proxy should not copy them.
+var headersToSkip = map[string]struct{}{
+	"Upgrade":                  {},
+	"Connection":               {},
+	"Sec-Websocket-Key":        {},
+	"Sec-Websocket-Version":    {},
+	"Sec-Websocket-Extensions": {},
+	"Sec-Websocket-Protocol":   {},
+}
+
+type (
+	// ServerPoolSpec is the spec for a server pool.
+	ServerPoolSpec struct {
+		SpanName    string                    `json:"spanName" jsonschema:"omitempty"`
+		Filter      *proxy.RequestMatcherSpec `json:"filter" jsonschema:"omitempty"`
+		Servers     []*proxy.Server           `json:"servers" jsonschema:"required"`
+		LoadBalance *proxy.LoadBalanceSpec    `json:"loadBalance" jsonschema:"omitempty"`
+	}
+
+	serverPool struct {
+		name   string
+		spec   *ServerPoolSpec
+		filter proxy.RequestMatcher
+		lb     proxy.LoadBalancer
+
+		upgrader *websocket.Upgrader
+		dialer   *websocket.Dialer
+
+		pingInterval   time.Duration
+		pongTimeout    time.Duration
+		maxMessageSize int64
+
+		// keepAliver is nil if the connections ping by themselves.
+		keepAliver *keepAliver
+	}
+)
+
+// Validate validates ServerPoolSpec.
+func (s *ServerPoolSpec) Validate() error {
+	if len(s.Servers) == 0 {
+		return fmt.Errorf("servers is empty")
+	}
+	return nil
+}
+
+func newServerPool(p *WebSocketProxy, spec *ServerPoolSpec, name string) *serverPool {
+	sp := &serverPool{
+		name: name,
+		spec: spec,
+		upgrader: &websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// The origin is checked by the backend servers, as the Origin
+			// header is passed to them.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		dialer: &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+			TLSClientConfig:  &tls.Config{InsecureSkipVerify: p.spec.InsecureSkipVerify},
+		},
+		maxMessageSize: p.spec.MaxMessageSize,
+	}
+	sp.pingInterval, sp.pongTimeout = p.spec.keepAlive()
+	if sp.pingInterval > 0 && p.spec.WorkerPool != nil {
+		sp.keepAliver = newKeepAliver(sp.pingInterval, sp.pongTimeout, p.spec.WorkerPool)
+	}
+
+	if spec.Filter != nil {
+		sp.filter = proxy.NewRequestMatcher(spec.Filter)
+	}
+
+	lbSpec := spec.LoadBalance
+	if lbSpec == nil {
+		lbSpec = &proxy.LoadBalanceSpec{}
+	}
+	sp.lb = proxy.NewLoadBalancer(lbSpec, spec.Servers)
+
+	return sp
+}
+
+func setResponse(ctx *context.Context, statusCode int) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	ctx.SetOutputResponse(resp)
+}
+
+// buildRequestURL builds the URL of the backend by the server and the
+// request, HTTP schemes are converted to WebSocket ones.
+func buildRequestURL(svr *proxy.Server, req *httpprot.Request) string {
+	u := strings.TrimSuffix(svr.URL, "/")
+	switch {
+	case strings.HasPrefix(u, "http://"):
+		u = "ws://" + u[len("http://"):]
+	case strings.HasPrefix(u, "https://"):
+		u = "wss://" + u[len("https://"):]
+	}
+
+	u += req.Path()
+	if q := req.Std().URL.RawQuery; q != "" {
+		u += "?" + q
+	}
+	return u
+}
+
+// copyHeader copies headers from the request to the backend, except the
+// ones set by gorilla, and adds the X-Forwarded headers.
+func copyHeader(req *http.Request) http.Header {
+	header := http.Header{}
+	for k, values := range req.Header {
+		if _, ok := headersToSkip[k]; ok {
+			continue
+		}
+		for _, v := range values {
+			header.Add(k, v)
+		}
+	}
+
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if xff := header.Get(xForwardedFor); xff == "" {
+			header.Set(xForwardedFor, clientIP)
+		} else {
+			header.Set(xForwardedFor, xff+", "+clientIP)
+		}
+	}
+
+	if header.Get(xForwardedHost) == "" && req.Host != "" {
+		header.Set(xForwardedHost, req.Host)
+	}
+
+	header.Set(xForwardedProto, "http")
+	if req.TLS != nil {
+		header.Set(xForwardedProto, "https")
+	}
+	return header
+}
+
+// upgradeRspHeader returns the headers of the backend handshake response
+// to be passed to the client.
+func upgradeRspHeader(resp *http.Response) http.Header {
+	header := http.Header{}
+	if hdr := resp.Header.Get("Sec-Websocket-Protocol"); hdr != "" {
+		header.Set("Sec-Websocket-Protocol", hdr)
+	}
+	if hdr := resp.Header.Values("Set-Cookie"); len(hdr) > 0 {
+		header["Set-Cookie"] = hdr
+	}
+	return header
+}
+
+func (sp *serverPool) handle(ctx *context.Context, req *httpprot.Request) string {
+	stdr := req.Std()
+	if !websocket.IsWebSocketUpgrade(stdr) {
+		setResponse(ctx, http.StatusBadRequest)
+		return resultClientError
+	}
+
+	stdw, ok := ctx.GetData(httpprot.ResponseWriterKey).(http.ResponseWriter)
+	if !ok {
+		logger.Errorf("%s: no response writer in the context", sp.name)
+		setResponse(ctx, http.StatusInternalServerError)
+		return resultInternalError
+	}
+
+	svr := sp.lb.ChooseServer(req)
+	if svr == nil {
+		setResponse(ctx, http.StatusServiceUnavailable)
+		return resultServerError
+	}
+
+	spanName := sp.spec.SpanName
+	if spanName == "" {
+		spanName = sp.name
+	}
+	span := ctx.Span().NewChild(spanName)
+	defer span.Finish()
+	span.TagFromContext(tracing.AttributeUpstream, svr.URL)
+
+	header := copyHeader(stdr)
+	span.InjectHTTP(&http.Request{Header: header})
+
+	u := buildRequestURL(svr, req)
+	// The subprotocols requested by the client are negotiated with the
+	// backend, and the selected one is passed back to the client.
+	dialer := *sp.dialer
+	dialer.Subprotocols = websocket.Subprotocols(stdr)
+	connBackend, resp, err := dialer.DialContext(req.Context(), u, header)
+	if err != nil {
+		logger.Debugf("%s: dial %s failed: %v", sp.name, u, err)
+		span.Tag(tracing.TagError, err.Error())
+		// Pass the handshake response of the backend to the client, for
+		// redirects, authentication and so on.
+		if resp != nil {
+			r, _ := httpprot.NewResponse(resp)
+			r.FetchPayload(0)
+			ctx.SetOutputResponse(r)
+		} else {
+			setResponse(ctx, http.StatusServiceUnavailable)
+		}
+		return resultServerError
+	}
+	defer connBackend.Close()
+
+	// The connection of the client is taken over no matter whether the
+	// upgrade succeeds, as the upgrader replies the client on failure.
+	setResponse(ctx, http.StatusSwitchingProtocols)
+	connClient, err := sp.upgrader.Upgrade(stdw, stdr, upgradeRspHeader(resp))
+	if err != nil {
+		logger.Debugf("%s: upgrade request failed: %v", sp.name, err)
+		span.Tag(tracing.TagError, err.Error())
+		return resultClientError
+	}
+	defer connClient.Close()
+
+	sp.tunnel(connClient, connBackend)
+	return ""
+}
+
+// tunnel passes messages between the client and the backend until any of
+// the connections is closed. Messages from the client are passed in the
+// calling goroutine, so only one more goroutine is needed per tunnel.
+func (sp *serverPool) tunnel(client, backend *websocket.Conn) {
+	if sp.maxMessageSize > 0 {
+		client.SetReadLimit(sp.maxMessageSize)
+		backend.SetReadLimit(sp.maxMessageSize)
+	}
+
+	switch {
+	case sp.pingInterval <= 0:
+	case sp.keepAliver != nil:
+		sp.keepAliver.add(client)
+		defer sp.keepAliver.remove(client)
+	default:
+		done := make(chan struct{})
+		defer close(done)
+		go sp.keepAlive(client, done)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- passMsg(backend, client)
+		// Unblock the reading of the client.
+		client.UnderlyingConn().Close()
+	}()
+
+	err := passMsg(client, backend)
+	// The error of the backend is the cause if it has been closed.
+	select {
+	case err = <-errc:
+	default:
+	}
+	if e, ok := err.(*websocket.CloseError); !ok || e.Code == websocket.CloseAbnormalClosure {
+		logger.Debugf("%s: websocket tunnel closed: %v", sp.name, err)
+	}
+}
+
+// keepAlive pings conn periodically, and closes it if no pong is received
+// within the pong timeout.
+func (sp *serverPool) keepAlive(conn *websocket.Conn, done chan struct{}) {
+	wait := sp.pingInterval + sp.pongTimeout
+	conn.SetReadDeadline(time.Now().Add(wait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wait))
+	})
+
+	ticker := time.NewTicker(sp.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(sp.pongTimeout)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// passMsg passes messages from src to dst, and passes the close message
+// to dst when src is closed, it returns the error stopping the passing.
+func passMsg(src, dst *websocket.Conn) error {
+	for {
+		msgType, msg, err := src.ReadMessage()
+		if err != nil {
+			m := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			if e, ok := err.(*websocket.CloseError); ok && e.Code != websocket.CloseNoStatusReceived {
+				m = websocket.FormatCloseMessage(e.Code, e.Text)
+			}
+			dst.WriteControl(websocket.CloseMessage, m, time.Now().Add(closeTimeout))
+			return err
+		}
+		if err = dst.WriteMessage(msgType, msg); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package websocketproxy provides the WebSocketProxy filter.
+package websocketproxy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of WebSocketProxy.
+	Kind = "WebSocketProxy"
+
+	resultInternalError = "internalError"
+	resultClientError   = "clientError"
+	resultServerError   = "serverError"
+
+	defaultWorkers         = 16
+	defaultWorkerQueueSize = 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "WebSocketProxy tunnels WebSocket connections to backend servers",
+	Results: []string{
+		resultInternalError,
+		resultClientError,
+		resultServerError,
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			PingInterval: "30s",
+			PongTimeout:  "10s",
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &WebSocketProxy{spec: spec.(*Spec)}
+	},
+}
+
+var _ filters.Filter = (*WebSocketProxy)(nil)
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// WebSocketProxy is the filter WebSocketProxy.
+	WebSocketProxy struct {
+		spec *Spec
+
+		mainPool       *serverPool
+		candidatePools []*serverPool
+	}
+
+	// Spec describes the WebSocketProxy.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Pools              []*ServerPoolSpec `json:"pools" jsonschema:"required"`
+		PingInterval       string            `json:"pingInterval" jsonschema:"omitempty,format=duration"`
+		PongTimeout        string            `json:"pongTimeout" jsonschema:"omitempty,format=duration"`
+		MaxMessageSize     int64             `json:"maxMessageSize" jsonschema:"omitempty,minimum=0"`
+		InsecureSkipVerify bool              `json:"insecureSkipVerify" jsonschema:"omitempty"`
+		WorkerPool         *WorkerPoolSpec   `json:"workerPool,omitempty" jsonschema:"omitempty"`
+	}
+
+	// WorkerPoolSpec describes the worker pool shared by the connections to
+	// send the keepalive pings.
+	WorkerPoolSpec struct {
+		Workers   int `json:"workers" jsonschema:"omitempty,minimum=0"`
+		QueueSize int `json:"queueSize" jsonschema:"omitempty,minimum=0"`
+	}
+)
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	numMainPool := 0
+	for i, pool := range s.Pools {
+		if pool.Filter == nil {
+			numMainPool++
+		}
+		if err := pool.Validate(); err != nil {
+			return fmt.Errorf("pool %d: %v", i, err)
+		}
+	}
+
+	if numMainPool != 1 {
+		return fmt.Errorf("one and only one mainPool is required")
+	}
+
+	for _, d := range []string{s.PingInterval, s.PongTimeout} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration %s: %v", d, err)
+		}
+	}
+
+	return nil
+}
+
+// keepAlive returns the ping interval and the pong timeout, the ping
+// interval is 0 if ping/pong keepalive is disabled.
+func (s *Spec) keepAlive() (interval, timeout time.Duration) {
+	if s.PingInterval != "" {
+		interval, _ = time.ParseDuration(s.PingInterval)
+	}
+	if s.PongTimeout != "" {
+		timeout, _ = time.ParseDuration(s.PongTimeout)
+	}
+	return
+}
+
+// Name returns the name of the WebSocketProxy filter instance.
+func (p *WebSocketProxy) Name() string {
+	return p.spec.Name()
+}
+
+// Kind returns the kind of WebSocketProxy.
+func (p *WebSocketProxy) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the WebSocketProxy
+func (p *WebSocketProxy) Spec() filters.Spec {
+	return p.spec
+}
+
+// Init initializes WebSocketProxy.
+func (p *WebSocketProxy) Init() {
+	p.reload()
+}
+
+// Inherit inherits previous generation of WebSocketProxy.
+func (p *WebSocketProxy) Inherit(previousGeneration filters.Filter) {
+	p.reload()
+}
+
+func (p *WebSocketProxy) reload() {
+	for _, spec := range p.spec.Pools {
+		name := ""
+		if spec.Filter == nil {
+			name = fmt.Sprintf("proxy#%s#main", p.Name())
+		} else {
+			id := len(p.candidatePools)
+			name = fmt.Sprintf("proxy#%s#candidate#%d", p.Name(), id)
+		}
+
+		pool := newServerPool(p, spec, name)
+		if spec.Filter == nil {
+			p.mainPool = pool
+		} else {
+			p.candidatePools = append(p.candidatePools, pool)
+		}
+	}
+}
+
+// Status returns WebSocketProxy status.
+func (p *WebSocketProxy) Status() interface{} {
+	return nil
+}
+
+// Close closes WebSocketProxy.
+func (p *WebSocketProxy) Close() {
+}
+
+// Handle handles HTTPContext.
+func (p *WebSocketProxy) Handle(ctx *context.Context) (result string) {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	sp := p.mainPool
+	for _, v := range p.candidatePools {
+		if v.filter.Match(req) {
+			sp = v
+			break
+		}
+	}
+
+	return sp.handle(ctx, req)
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocketproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func newTestWebSocketProxy(yamlConfig string, assert *assert.Assertions) *WebSocketProxy {
+	rawSpec := make(map[string]interface{})
+	err := codectool.Unmarshal([]byte(yamlConfig), &rawSpec)
+	assert.NoError(err)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+
+	proxy := kind.CreateInstance(spec).(*WebSocketProxy)
+	proxy.Init()
+
+	assert.Equal(kind, proxy.Kind())
+	assert.Equal(spec, proxy.Spec())
+	return proxy
+}
+
+// startEchoServer starts a WebSocket server echoing messages with the
+// request path as the prefix.
+func startEchoServer() *httptest.Server {
+	upgrader := &websocket.Upgrader{
+		Subprotocols: []string{"echo"},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-For") == "" {
+			http.Error(w, "no X-Forwarded-For", http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(typ, append([]byte(r.URL.Path+":"), msg...))
+		}
+	}))
+}
+
+// startFrontend starts an HTTP server which handles all requests by the
+// filter, like the HTTPServer.
+func startFrontend(f filters.Filter, results chan string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetData(httpprot.ResponseWriterKey, w)
+		req, _ := httpprot.NewRequest(r)
+		ctx.SetRequest(context.DefaultNamespace, req)
+
+		results <- f.Handle(ctx)
+
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp.StatusCode() != http.StatusSwitchingProtocols {
+			w.WriteHeader(resp.StatusCode())
+		}
+	}))
+}
+
+func TestWebSocketProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startEchoServer()
+	defer backend.Close()
+
+	p := newTestWebSocketProxy(`
+name: wsproxy
+kind: WebSocketProxy
+pingInterval: 50ms
+pongTimeout: 1s
+maxMessageSize: 64
+pools:
+- servers:
+  - url: `+backend.URL+`
+`, assert)
+	defer p.Close()
+
+	results := make(chan string, 10)
+	frontend := startFrontend(p, results)
+	defer frontend.Close()
+	wsURL := "ws" + strings.TrimPrefix(frontend.URL, "http")
+
+	// not an upgrade request.
+	resp, err := http.Get(frontend.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(resultClientError, <-results)
+
+	dialer := &websocket.Dialer{Subprotocols: []string{"echo"}}
+	conn, resp, err := dialer.Dial(wsURL+"/chat", nil)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("echo", resp.Header.Get("Sec-Websocket-Protocol"))
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	assert.NoError(conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(err)
+	assert.Equal("/chat:hello", string(msg))
+
+	// the ping is handled while reading.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	go conn.ReadMessage()
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		assert.Fail("no ping received")
+	}
+
+	// the message is too large, the tunnel is closed.
+	assert.NoError(conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 100))))
+	assert.Equal("", <-results)
+	conn.Close()
+}
+
+func TestWebSocketProxyWorkerPool(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startEchoServer()
+	defer backend.Close()
+
+	p := newTestWebSocketProxy(`
+name: wsproxy
+kind: WebSocketProxy
+pingInterval: 50ms
+pongTimeout: 1s
+workerPool:
+  workers: 1
+pools:
+- servers:
+  - url: `+backend.URL+`
+`, assert)
+	defer p.Close()
+
+	ka := p.mainPool.keepAliver
+	if !assert.NotNil(ka) {
+		return
+	}
+
+	results := make(chan string, 10)
+	frontend := startFrontend(p, results)
+	defer frontend.Close()
+	wsURL := "ws" + strings.TrimPrefix(frontend.URL, "http")
+
+	dialer := &websocket.Dialer{Subprotocols: []string{"echo"}}
+	pinged := make(chan struct{}, 10)
+	conns := []*websocket.Conn{}
+	for i := 0; i < 2; i++ {
+		conn, _, err := dialer.Dial(wsURL+"/chat", nil)
+		if !assert.NoError(err) {
+			return
+		}
+		conn.SetPingHandler(func(data string) error {
+			select {
+			case pinged <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+		conns = append(conns, conn)
+
+		assert.NoError(conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+		_, msg, err := conn.ReadMessage()
+		assert.NoError(err)
+		assert.Equal("/chat:hello", string(msg))
+		go conn.ReadMessage()
+	}
+
+	// both connections are pinged by the shared workers.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-pinged:
+		case <-time.After(time.Second):
+			assert.Fail("no ping received")
+		}
+	}
+
+	for _, conn := range conns {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		assert.Equal("", <-results)
+		conn.Close()
+	}
+
+	// the workers are stopped after the last connection is closed.
+	ka.lock.Lock()
+	assert.Nil(ka.pool)
+	assert.Empty(ka.conns)
+	ka.lock.Unlock()
+}
+
+func TestWebSocketProxyBackendFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startEchoServer()
+	backendURL := backend.URL
+	backend.Close()
+
+	p := newTestWebSocketProxy(`
+name: wsproxy
+kind: WebSocketProxy
+pools:
+- servers:
+  - url: `+backendURL+`
+`, assert)
+	defer p.Close()
+
+	results := make(chan string, 10)
+	frontend := startFrontend(p, results)
+	defer frontend.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(frontend.URL, "http"), nil)
+	assert.Error(err)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(resultServerError, <-results)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{PingInterval: "1x"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{}
+	assert.Error(spec.Validate())
+}
+
+func TestBuildRequestURL(t *testing.T) {
+	assert := assert.New(t)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/path?a=1", nil)
+	req, _ := httpprot.NewRequest(stdr)
+
+	svr := &proxy.Server{URL: "https://backend:8443/"}
+	assert.Equal("wss://backend:8443/path?a=1", buildRequestURL(svr, req))
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graceupdate
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DrainStateServing means the member is not draining.
+	DrainStateServing = "serving"
+	// DrainStateDraining means the member is waiting for the in-flight
+	// requests and connections to finish.
+	DrainStateDraining = "draining"
+	// DrainStateDrained means all the in-flight requests and connections
+	// have finished.
+	DrainStateDrained = "drained"
+	// DrainStateTimeout means the deadline has passed before all the
+	// in-flight requests and connections finished.
+	DrainStateTimeout = "timeout"
+)
+
+// DrainStatus is the progress of draining the member.
+type DrainStatus struct {
+	State             string `json:"state"`
+	StartTime         string `json:"startTime,omitempty"`
+	Deadline          string `json:"deadline,omitempty"`
+	InFlightRequests  int64  `json:"inFlightRequests"`
+	ActiveConnections int64  `json:"activeConnections"`
+}
+
+var (
+	draining          int32
+	inFlightRequests  int64
+	activeConnections int64
+
+	drainLock     sync.Mutex
+	drainStart    time.Time
+	drainDeadline time.Time
+)
+
+// StartDraining puts the member into the draining mode, in which the
+// readiness check fails and the traffic gates stop accepting new work. The
+// in-flight requests and connections are waited for timeout. Calling it
+// while draining only resets the deadline.
+func StartDraining(timeout time.Duration) *DrainStatus {
+	drainLock.Lock()
+	now := time.Now()
+	if !IsDraining() {
+		drainStart = now
+	}
+	drainDeadline = now.Add(timeout)
+	atomic.StoreInt32(&draining, 1)
+	drainLock.Unlock()
+
+	return GetDrainStatus()
+}
+
+// StopDraining puts the member back into serving.
+func StopDraining() *DrainStatus {
+	drainLock.Lock()
+	atomic.StoreInt32(&draining, 0)
+	drainLock.Unlock()
+
+	return GetDrainStatus()
+}
+
+// IsDraining returns whether the member is in the draining mode.
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// BeginRequest counts an in-flight request, EndRequest must be called when
+// the request finishes.
+func BeginRequest() {
+	atomic.AddInt64(&inFlightRequests, 1)
+}
+
+// EndRequest finishes an in-flight request counted by BeginRequest.
+func EndRequest() {
+	atomic.AddInt64(&inFlightRequests, -1)
+}
+
+// AddConnections adds delta to the active connections which are not
+// request based, e.g. the ones of TCPServer.
+func AddConnections(delta int64) {
+	atomic.AddInt64(&activeConnections, delta)
+}
+
+// GetDrainStatus returns the progress of draining.
+func GetDrainStatus() *DrainStatus {
+	status := &DrainStatus{
+		State:             DrainStateServing,
+		InFlightRequests:  atomic.LoadInt64(&inFlightRequests),
+		ActiveConnections: atomic.LoadInt64(&activeConnections),
+	}
+
+	drainLock.Lock()
+	defer drainLock.Unlock()
+
+	if !IsDraining() {
+		return status
+	}
+
+	status.StartTime = drainStart.Format(time.RFC3339)
+	status.Deadline = drainDeadline.Format(time.RFC3339)
+	switch {
+	case status.InFlightRequests == 0 && status.ActiveConnections == 0:
+		status.State = DrainStateDrained
+	case time.Now().After(drainDeadline):
+		status.State = DrainStateTimeout
+	default:
+		status.State = DrainStateDraining
+	}
+	return status
+}
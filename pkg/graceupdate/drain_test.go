@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graceupdate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+	defer StopDraining()
+
+	BeginRequest()
+	AddConnections(1)
+	status := GetDrainStatus()
+	assert.Equal(DrainStateServing, status.State)
+	assert.Equal(int64(1), status.InFlightRequests)
+	assert.Equal(int64(1), status.ActiveConnections)
+	assert.Empty(status.StartTime)
+
+	status = StartDraining(time.Hour)
+	assert.True(IsDraining())
+	assert.Equal(DrainStateDraining, status.State)
+	assert.NotEmpty(status.StartTime)
+	start := status.StartTime
+
+	EndRequest()
+	assert.Equal(DrainStateDraining, GetDrainStatus().State)
+	AddConnections(-1)
+	assert.Equal(DrainStateDrained, GetDrainStatus().State)
+
+	// draining again only resets the deadline.
+	BeginRequest()
+	defer EndRequest()
+	status = StartDraining(-time.Second)
+	assert.Equal(start, status.StartTime)
+	assert.Equal(DrainStateTimeout, status.State)
+
+	status = StopDraining()
+	assert.False(IsDraining())
+	assert.Equal(DrainStateServing, status.State)
+}
@@ -19,6 +19,8 @@ package graceupdate
 
 import (
 	"os"
+	"sync/atomic"
+	"time"
 
 	"github.com/megaease/grace/gracenet"
 
@@ -31,8 +33,24 @@ var (
 	Global     = &gracenet.Net{}
 	didInherit = os.Getenv("LISTEN_FDS") != ""
 	ppid       = os.Getppid()
+
+	// drainTimeout is the deadline to drain the in-flight requests and
+	// connections when the servers are closed, in nanoseconds.
+	drainTimeout = int64(30 * time.Second)
 )
 
+// SetDrainTimeout sets the deadline to drain the in-flight requests and
+// connections when the servers are closed.
+func SetDrainTimeout(d time.Duration) {
+	atomic.StoreInt64(&drainTimeout, int64(d))
+}
+
+// DrainTimeout returns the deadline to drain the in-flight requests and
+// connections when the servers are closed.
+func DrainTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&drainTimeout))
+}
+
 // IsInherit returns if I am the child process
 // on gracefully updating process.
 func IsInherit() bool {
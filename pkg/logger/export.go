@@ -72,14 +72,14 @@ func Sync() {
 
 // APIAccess logs admin api log.
 func APIAccess(
-	method, remoteAddr, path string,
+	method, remoteAddr, user, path string,
 	code int,
 	bodyBytedReceived, bodyBytesSent int64,
 	requestTime time.Time,
 	processTime time.Duration) {
 
-	restAPILogger.Debugf("%s %s %s %v rx:%dB tx:%dB start:%v process:%v",
-		method, remoteAddr, path, code,
+	restAPILogger.Debugf("%s %s %s %s %v rx:%dB tx:%dB start:%v process:%v",
+		method, remoteAddr, user, path, code,
 		bodyBytedReceived, bodyBytesSent,
 		fasttime.Format(requestTime, fasttime.RFC3339), processTime)
 }
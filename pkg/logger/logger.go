@@ -33,6 +33,7 @@ import (
 
 // Init initializes logger.
 func Init(opt *option.Options) {
+	initLevels(opt)
 	initDefault(opt)
 	initHTTPFilter(opt)
 	initRestAPI(opt)
@@ -48,6 +49,9 @@ func InitNop() {
 	defaultLogger = nop.Sugar()
 	gressLogger = defaultLogger
 	stderrLogger = defaultLogger
+	for _, m := range modules {
+		m.setLogger(defaultLogger)
+	}
 }
 
 // InitMock initializes all logger to print stdout, mainly for unit testing
@@ -60,9 +64,18 @@ func InitMock() {
 	defaultLogger = mock.Sugar()
 	gressLogger = defaultLogger
 	stderrLogger = defaultLogger
+	for _, m := range modules {
+		m.setLogger(defaultLogger)
+	}
 }
 
 const (
+	// LogFormatConsole is the plain text log format.
+	LogFormatConsole = "console"
+	// LogFormatJSON is the JSON log format, whose field names are time,
+	// level, module, caller and message.
+	LogFormatJSON = "json"
+
 	stdoutFilename           = "stdout.log"
 	filterHTTPAccessFilename = "filter_http_access.log"
 	filterHTTPDumpFilename   = "filter_http_dump.log"
@@ -91,6 +104,11 @@ var (
 // EtcdClientLoggerConfig generates the config of etcd client logger.
 func EtcdClientLoggerConfig(opt *option.Options, filename string) *zap.Config {
 	encoderConfig := defaultEncoderConfig()
+	encoding := LogFormatConsole
+	if opt.LogFormat == LogFormatJSON {
+		encoderConfig = jsonEncoderConfig()
+		encoding = LogFormatJSON
+	}
 
 	level := zap.NewAtomicLevel()
 	if opt.Debug {
@@ -101,7 +119,7 @@ func EtcdClientLoggerConfig(opt *option.Options, filename string) *zap.Config {
 
 	cfg := &zap.Config{
 		Level:            level,
-		Encoding:         "console",
+		Encoding:         encoding,
 		EncoderConfig:    encoderConfig,
 		OutputPaths:      []string{"stdout"},
 		ErrorOutputPaths: []string{"stderr"},
@@ -133,13 +151,42 @@ func defaultEncoderConfig() zapcore.EncoderConfig {
 	}
 }
 
-func initDefault(opt *option.Options) {
-	encoderConfig := defaultEncoderConfig()
+// jsonEncoderConfig returns the config of the JSON encoder, the field names
+// are stable, so that the logs could be parsed by the log collectors.
+func jsonEncoderConfig() zapcore.EncoderConfig {
+	cfg := defaultEncoderConfig()
+	cfg.NameKey = "module"
+	cfg.EncodeLevel = zapcore.LowercaseLevelEncoder
+	return cfg
+}
 
-	lowestLevel := zap.InfoLevel
+func newEncoder(opt *option.Options) zapcore.Encoder {
+	if opt.LogFormat == LogFormatJSON {
+		return zapcore.NewJSONEncoder(jsonEncoderConfig())
+	}
+	return zapcore.NewConsoleEncoder(defaultEncoderConfig())
+}
+
+// initLevels initializes the global level and the levels of the modules.
+func initLevels(opt *option.Options) {
 	if opt.Debug {
-		lowestLevel = zap.DebugLevel
+		globalLevel.SetLevel(zapcore.DebugLevel)
+	} else {
+		globalLevel.SetLevel(zapcore.InfoLevel)
+	}
+	for name, level := range opt.LogLevels {
+		if m := GetModule(name); m != nil {
+			m.SetLevel(level)
+		}
 	}
+}
+
+// initDefault initializes the default logger and the loggers of the
+// modules. The cores log all levels, the levels are decided by the
+// global level and the levels of the modules, so they could be changed at
+// runtime.
+func initDefault(opt *option.Options) {
+	lowestLevel := zap.DebugLevel
 
 	var err error
 	var gressLF io.Writer = os.Stdout
@@ -153,18 +200,19 @@ func initDefault(opt *option.Options) {
 	opts := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1)}
 
 	stderrSyncer := zapcore.AddSync(os.Stderr)
-	stderrCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), stderrSyncer, lowestLevel)
-	stderrLogger = zap.New(stderrCore, opts...).Sugar()
+	stderrCore := zapcore.NewCore(newEncoder(opt), stderrSyncer, lowestLevel)
+	stderrLogger = zap.New(newLevelCore(stderrCore, globalLevel), opts...).Sugar()
 
 	gressSyncer := zapcore.AddSync(gressLF)
-	gressCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), gressSyncer, lowestLevel)
-	gressLogger = zap.New(gressCore, opts...).Sugar()
+	gressCore := zapcore.NewCore(newEncoder(opt), gressSyncer, lowestLevel)
+	gressLogger = zap.New(newLevelCore(gressCore, globalLevel), opts...).Sugar()
 
 	defaultCore := gressCore
 	if gressLF != os.Stdout && gressLF != os.Stderr {
 		defaultCore = zapcore.NewTee(gressCore, stderrCore)
 	}
-	defaultLogger = zap.New(defaultCore, opts...).Sugar()
+	defaultLogger = zap.New(newLevelCore(defaultCore, globalLevel), opts...).Sugar()
+	initModules(defaultCore, opts...)
 }
 
 func initHTTPFilter(opt *option.Options) {
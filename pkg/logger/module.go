@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type (
+	// Module is the logger of a module, whose level could be changed at
+	// runtime independently of the global level, so that a module could
+	// be debugged without the debug logs of the others.
+	Module struct {
+		name string
+		// level is the level of the module encoded by encodeLevel, 0
+		// means following the global level.
+		level  int32
+		logger atomic.Value // *zap.SugaredLogger
+	}
+
+	// Levels are the global level and the levels of the modules, an
+	// empty level of a module means following the global level.
+	Levels struct {
+		Level   string            `json:"level"`
+		Modules map[string]string `json:"modules"`
+	}
+
+	// levelCore is a core whose level is decided by enabler instead of
+	// the wrapped core, whose level must be the lowest one.
+	levelCore struct {
+		zapcore.Core
+		enabler zapcore.LevelEnabler
+	}
+)
+
+var (
+	// API is the logger of the admin API.
+	API = newModule("api")
+	// Cluster is the logger of the cluster.
+	Cluster = newModule("cluster")
+	// Proxy is the logger of the Proxy filter.
+	Proxy = newModule("proxy")
+	// MQTT is the logger of the MQTTProxy.
+	MQTT = newModule("mqtt")
+	// Tracing is the logger of the tracing.
+	Tracing = newModule("tracing")
+
+	modules = map[string]*Module{}
+
+	// globalLevel is the level of the loggers not belonging to a module.
+	globalLevel = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+)
+
+func newModule(name string) *Module {
+	m := &Module{name: name}
+	m.logger.Store(zap.NewNop().Sugar())
+	modules[name] = m
+	return m
+}
+
+func newLevelCore(core zapcore.Core, enabler zapcore.LevelEnabler) zapcore.Core {
+	return &levelCore{Core: core, enabler: enabler}
+}
+
+func (c *levelCore) Enabled(l zapcore.Level) bool {
+	return c.enabler.Enabled(l)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), enabler: c.enabler}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.enabler.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// initModules creates the loggers of the modules on core, whose level must
+// be the lowest one.
+func initModules(core zapcore.Core, opts ...zap.Option) {
+	for _, m := range modules {
+		m.setLogger(zap.New(newLevelCore(core, m), opts...).Named(m.name).Sugar())
+	}
+}
+
+func (m *Module) setLogger(l *zap.SugaredLogger) {
+	m.logger.Store(l)
+}
+
+func (m *Module) getLogger() *zap.SugaredLogger {
+	return m.logger.Load().(*zap.SugaredLogger)
+}
+
+// Name returns the name of the module.
+func (m *Module) Name() string {
+	return m.name
+}
+
+// Enabled implements zapcore.LevelEnabler.
+func (m *Module) Enabled(l zapcore.Level) bool {
+	if level := atomic.LoadInt32(&m.level); level != 0 {
+		return l >= decodeLevel(level)
+	}
+	return globalLevel.Enabled(l)
+}
+
+// Level returns the level of the module, it is empty if the module follows
+// the global level.
+func (m *Module) Level() string {
+	if level := atomic.LoadInt32(&m.level); level != 0 {
+		return decodeLevel(level).String()
+	}
+	return ""
+}
+
+// SetLevel sets the level of the module, an empty level means following
+// the global level.
+func (m *Module) SetLevel(level string) error {
+	if level == "" {
+		atomic.StoreInt32(&m.level, 0)
+		return nil
+	}
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&m.level, encodeLevel(l))
+	return nil
+}
+
+// encodeLevel encodes l to a positive number, as the debug level is -1.
+func encodeLevel(l zapcore.Level) int32 {
+	return int32(l-zapcore.DebugLevel) + 1
+}
+
+func decodeLevel(v int32) zapcore.Level {
+	return zapcore.Level(v-1) + zapcore.DebugLevel
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, err
+	}
+	if l < zapcore.DebugLevel || l > zapcore.ErrorLevel {
+		return l, fmt.Errorf("unsupported level %s", level)
+	}
+	return l, nil
+}
+
+// Debugf logs a debug log of the module.
+func (m *Module) Debugf(template string, args ...interface{}) {
+	m.getLogger().Debugf(template, args...)
+}
+
+// LazyDebug logs a debug log of the module in lazy mode, the message is
+// not built if the debug log of the module is disabled.
+func (m *Module) LazyDebug(fn func() string) {
+	m.getLogger().Debug(lazyLogBuilder{fn})
+}
+
+// Infof logs an info log of the module.
+func (m *Module) Infof(template string, args ...interface{}) {
+	m.getLogger().Infof(template, args...)
+}
+
+// Warnf logs a warning log of the module.
+func (m *Module) Warnf(template string, args ...interface{}) {
+	m.getLogger().Warnf(template, args...)
+}
+
+// Errorf logs an error log of the module.
+func (m *Module) Errorf(template string, args ...interface{}) {
+	m.getLogger().Errorf(template, args...)
+}
+
+// SpanDebugf logs a debug log of the module with the IDs of the span.
+func (m *Module) SpanDebugf(context *model.SpanContext, template string, args ...interface{}) {
+	m.getLogger().Debugf(getSpanTemplate(context, template), args...)
+}
+
+// SpanErrorf logs an error log of the module with the IDs of the span.
+func (m *Module) SpanErrorf(context *model.SpanContext, template string, args ...interface{}) {
+	m.getLogger().Errorf(getSpanTemplate(context, template), args...)
+}
+
+// GetModule returns the module of name, or nil if not found.
+func GetModule(name string) *Module {
+	return modules[name]
+}
+
+// GetLevels returns the global level and the levels of the modules.
+func GetLevels() *Levels {
+	levels := &Levels{
+		Level:   globalLevel.Level().String(),
+		Modules: map[string]string{},
+	}
+	for name, m := range modules {
+		levels.Modules[name] = m.Level()
+	}
+	return levels
+}
+
+// SetLevels sets the global level if it is not empty, and the levels of
+// the modules in levels.Modules. Nothing is changed if any level or
+// module is invalid.
+func SetLevels(levels *Levels) error {
+	var global zapcore.Level
+	if levels.Level != "" {
+		l, err := parseLevel(levels.Level)
+		if err != nil {
+			return fmt.Errorf("invalid level: %v", err)
+		}
+		global = l
+	}
+
+	for name, level := range levels.Modules {
+		if modules[name] == nil {
+			return fmt.Errorf("unknown module %s", name)
+		}
+		if level != "" {
+			if _, err := parseLevel(level); err != nil {
+				return fmt.Errorf("invalid level of module %s: %v", name, err)
+			}
+		}
+	}
+
+	if levels.Level != "" {
+		globalLevel.SetLevel(global)
+	}
+	for name, level := range levels.Modules {
+		modules[name].SetLevel(level)
+	}
+	return nil
+}
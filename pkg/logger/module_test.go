@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestModuleLevels(t *testing.T) {
+	assert := assert.New(t)
+	defer SetLevels(&Levels{Level: "info", Modules: map[string]string{"proxy": "", "api": ""}})
+
+	buf := &bytes.Buffer{}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(jsonEncoderConfig()), zapcore.AddSync(buf), zap.DebugLevel)
+	initModules(core)
+	defer InitNop()
+
+	globalLevel.SetLevel(zapcore.InfoLevel)
+	Proxy.Debugf("hidden")
+	assert.Zero(buf.Len())
+
+	assert.NoError(Proxy.SetLevel("debug"))
+	Proxy.Debugf("proxy %s", "debug")
+	API.Debugf("hidden")
+
+	entry := map[string]interface{}{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal("debug", entry["level"])
+	assert.Equal("proxy", entry["module"])
+	assert.Equal("proxy debug", entry["message"])
+	assert.Contains(entry, "time")
+
+	// the invalid levels change nothing.
+	assert.Error(SetLevels(&Levels{Level: "debug", Modules: map[string]string{"api": "verbose"}}))
+	assert.Error(SetLevels(&Levels{Modules: map[string]string{"unknown": "debug"}}))
+	assert.Error(SetLevels(&Levels{Level: "fatal"}))
+	levels := GetLevels()
+	assert.Equal("info", levels.Level)
+	assert.Equal("debug", levels.Modules["proxy"])
+	assert.Equal("", levels.Modules["api"])
+
+	assert.NoError(SetLevels(&Levels{Level: "warn", Modules: map[string]string{"proxy": "", "api": "error"}}))
+	assert.False(Proxy.Enabled(zapcore.InfoLevel))
+	assert.True(Proxy.Enabled(zapcore.WarnLevel))
+	assert.False(API.Enabled(zapcore.WarnLevel))
+	assert.Equal("error", API.Level())
+}
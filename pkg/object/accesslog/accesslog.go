@@ -0,0 +1,293 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accesslog implements a business controller which writes the
+// access logs of HTTPServers to files, syslog, Kafka, HTTP endpoints and
+// ClickHouse.
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of AccessLog.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of AccessLog.
+	Kind = "AccessLog"
+)
+
+func init() {
+	supervisor.Register(&AccessLog{})
+}
+
+type (
+	// AccessLog is a business controller which writes the access logs of
+	// the HTTPServers referencing it. The logs are queued and written by a
+	// dedicated goroutine, they are dropped if the queue is full, so that
+	// the requests are never blocked by slow sinks.
+	AccessLog struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		formatter     formatter
+		sinks         []*sinkInstance
+		entries       chan *Entry
+		flushInterval time.Duration
+		done          chan struct{}
+		wg            sync.WaitGroup
+
+		numOfLogged     int64
+		numOfSampledOut int64
+		numOfDropped    int64
+	}
+
+	// Spec describes AccessLog.
+	Spec struct {
+		Format string `json:"format" jsonschema:"omitempty,enum=,enum=json,enum=combined"`
+		// Fields are the fields of the JSON format, default is all fields
+		// except the headers.
+		Fields []string `json:"fields" jsonschema:"omitempty"`
+		// SampleRate is the ratio of the requests to log, from 0 to 1.
+		SampleRate float64 `json:"sampleRate" jsonschema:"omitempty,minimum=0,maximum=1"`
+		// AlwaysLogErrors logs all the requests with 5xx responses
+		// regardless of the sample rate.
+		AlwaysLogErrors bool        `json:"alwaysLogErrors" jsonschema:"omitempty"`
+		BufferSize      int         `json:"bufferSize" jsonschema:"omitempty,minimum=1"`
+		FlushInterval   string      `json:"flushInterval" jsonschema:"omitempty,format=duration"`
+		Sinks           []*SinkSpec `json:"sinks" jsonschema:"required,minItems=1"`
+	}
+
+	// Status is the status of AccessLog.
+	Status struct {
+		NumOfLogged     int64         `json:"numOfLogged"`
+		NumOfSampledOut int64         `json:"numOfSampledOut"`
+		NumOfDropped    int64         `json:"numOfDropped"`
+		Sinks           []*SinkStatus `json:"sinks"`
+	}
+
+	// SinkStatus is the status of a sink.
+	SinkStatus struct {
+		Kind        string `json:"kind"`
+		NumOfErrors int64  `json:"numOfErrors"`
+		LastError   string `json:"lastError,omitempty"`
+	}
+
+	sinkInstance struct {
+		kind        string
+		sink        sink
+		numOfErrors int64
+		lastError   atomic.Value
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Format == formatCombined && len(spec.Fields) > 0 {
+		return fmt.Errorf("fields are only supported by the json format")
+	}
+	for _, f := range spec.Fields {
+		if err := validateField(f); err != nil {
+			return err
+		}
+	}
+	for _, s := range spec.Sinks {
+		if s.Kind == sinkClickHouse && spec.Format == formatCombined {
+			return fmt.Errorf("clickhouse sink requires the json format")
+		}
+	}
+	if spec.FlushInterval != "" {
+		d, err := time.ParseDuration(spec.FlushInterval)
+		if err != nil {
+			return fmt.Errorf("invalid flush interval %s: %v", spec.FlushInterval, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("flush interval must be positive")
+		}
+	}
+	return nil
+}
+
+// Category returns the category of AccessLog.
+func (al *AccessLog) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of AccessLog.
+func (al *AccessLog) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AccessLog.
+func (al *AccessLog) DefaultSpec() interface{} {
+	return &Spec{
+		Format:        formatJSON,
+		SampleRate:    1,
+		BufferSize:    10240,
+		FlushInterval: "1s",
+	}
+}
+
+// Init initializes AccessLog.
+func (al *AccessLog) Init(superSpec *supervisor.Spec) {
+	al.superSpec, al.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	al.reload()
+}
+
+// Inherit inherits previous generation of AccessLog. The previous
+// generation is closed first, so that the sinks like files are not shared
+// by the two generations.
+func (al *AccessLog) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	al.Init(superSpec)
+}
+
+func (al *AccessLog) reload() {
+	al.formatter = newFormatter(al.spec.Format, al.spec.Fields)
+	al.flushInterval, _ = time.ParseDuration(al.spec.FlushInterval)
+	if al.flushInterval <= 0 {
+		al.flushInterval = time.Second
+	}
+
+	for _, spec := range al.spec.Sinks {
+		s, err := newSink(spec)
+		if err != nil {
+			logger.Errorf("%s: create sink failed: %v", al.superSpec.Name(), err)
+			continue
+		}
+		al.sinks = append(al.sinks, &sinkInstance{kind: spec.Kind, sink: s})
+	}
+
+	al.entries = make(chan *Entry, al.spec.BufferSize)
+	al.done = make(chan struct{})
+	al.wg.Add(1)
+	go al.run()
+}
+
+// Log logs an access log entry, it never blocks.
+func (al *AccessLog) Log(e *Entry) {
+	if !al.sample(e) {
+		atomic.AddInt64(&al.numOfSampledOut, 1)
+		return
+	}
+
+	e.extractHeaders(al.spec.Fields)
+	select {
+	case al.entries <- e:
+	default:
+		atomic.AddInt64(&al.numOfDropped, 1)
+	}
+}
+
+func (al *AccessLog) sample(e *Entry) bool {
+	if al.spec.SampleRate >= 1 {
+		return true
+	}
+	if al.spec.AlwaysLogErrors && e.StatusCode >= 500 {
+		return true
+	}
+	return rand.Float64() < al.spec.SampleRate
+}
+
+func (al *AccessLog) run() {
+	defer al.wg.Done()
+
+	ticker := time.NewTicker(al.flushInterval)
+	defer ticker.Stop()
+
+	var buf bytes.Buffer
+	for {
+		select {
+		case e := <-al.entries:
+			al.write(&buf, e)
+
+		case <-ticker.C:
+			al.flush()
+
+		case <-al.done:
+			// write the queued entries before exiting.
+			for {
+				select {
+				case e := <-al.entries:
+					al.write(&buf, e)
+				default:
+					for _, si := range al.sinks {
+						si.sink.close()
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (si *sinkInstance) setError(err error) {
+	atomic.AddInt64(&si.numOfErrors, 1)
+	si.lastError.Store(err.Error())
+}
+
+func (al *AccessLog) write(buf *bytes.Buffer, e *Entry) {
+	buf.Reset()
+	al.formatter.format(buf, e)
+	atomic.AddInt64(&al.numOfLogged, 1)
+
+	for _, si := range al.sinks {
+		if err := si.sink.write(buf.Bytes()); err != nil {
+			si.setError(err)
+		}
+	}
+}
+
+func (al *AccessLog) flush() {
+	for _, si := range al.sinks {
+		if err := si.sink.flush(); err != nil {
+			si.setError(err)
+		}
+	}
+}
+
+// Status returns the status of AccessLog.
+func (al *AccessLog) Status() *supervisor.Status {
+	s := &Status{
+		NumOfLogged:     atomic.LoadInt64(&al.numOfLogged),
+		NumOfSampledOut: atomic.LoadInt64(&al.numOfSampledOut),
+		NumOfDropped:    atomic.LoadInt64(&al.numOfDropped),
+	}
+	for _, si := range al.sinks {
+		ss := &SinkStatus{Kind: si.kind, NumOfErrors: atomic.LoadInt64(&si.numOfErrors)}
+		if v := si.lastError.Load(); v != nil {
+			ss.LastError = v.(string)
+		}
+		s.Sinks = append(s.Sinks, ss)
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes AccessLog, the queued entries are written before it returns.
+func (al *AccessLog) Close() {
+	close(al.done)
+	al.wg.Wait()
+}
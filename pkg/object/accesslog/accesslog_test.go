@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestAccessLog(t *testing.T, yaml string) *AccessLog {
+	superSpec, err := supervisor.NewSpec(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	al := &AccessLog{}
+	al.Init(superSpec)
+	return al
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Format: formatCombined, Fields: []string{"statusCode"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Format: formatJSON, Fields: []string{"statusCode", "bad"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Format: formatJSON, Fields: []string{"statusCode"}, FlushInterval: "-1s"}
+	assert.Error(spec.Validate())
+
+	spec.FlushInterval = "2s"
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{Format: formatCombined, Sinks: []*SinkSpec{{Kind: sinkClickHouse}}}
+	assert.Error(spec.Validate())
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(t.TempDir(), "access.log")
+	al := newTestAccessLog(t, fmt.Sprintf(`
+kind: AccessLog
+name: accesslog
+format: combined
+sinks:
+- kind: file
+  file:
+    filename: %s
+`, filename))
+
+	for i := 0; i < 3; i++ {
+		al.Log(newTestEntry())
+	}
+	al.Close()
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(lines, 3)
+	assert.True(strings.HasPrefix(lines[0], "127.0.0.1 - - "))
+
+	status := al.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(3), status.NumOfLogged)
+	assert.Len(status.Sinks, 1)
+	assert.Zero(status.Sinks[0].NumOfErrors)
+}
+
+func TestAccessLogSampleAndDrop(t *testing.T) {
+	assert := assert.New(t)
+
+	al := newTestAccessLog(t, `
+kind: AccessLog
+name: accesslog
+sampleRate: 0
+alwaysLogErrors: true
+bufferSize: 1
+sinks:
+- kind: http
+  http:
+    url: http://127.0.0.1:1
+`)
+	// stop the writer, so that the queue is not consumed.
+	al.Close()
+
+	e := newTestEntry()
+	al.Log(e)
+	e = newTestEntry()
+	e.StatusCode = 503
+	al.Log(e)
+	e = newTestEntry()
+	e.StatusCode = 500
+	al.Log(e)
+
+	status := al.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(1), status.NumOfSampledOut)
+	assert.Equal(int64(1), status.NumOfDropped)
+	assert.Len(al.entries, 1)
+}
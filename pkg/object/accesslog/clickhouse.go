@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClickHouseBatchSize         = 1000
+	defaultClickHouseMaxPendingBatches = 4
+	defaultClickHouseTimeout           = 10 * time.Second
+)
+
+type (
+	// ClickHouseSinkSpec describes a ClickHouse table. The logs are
+	// inserted in batches by the HTTP interface of ClickHouse in the
+	// JSONEachRow format, so the format of the logs must be json, and the
+	// columns of the table are named as the fields.
+	ClickHouseSinkSpec struct {
+		// URL is the HTTP interface of ClickHouse, e.g.
+		// http://127.0.0.1:8123.
+		URL       string `json:"url" jsonschema:"required,format=uri"`
+		Database  string `json:"database" jsonschema:"omitempty"`
+		Table     string `json:"table" jsonschema:"required"`
+		Username  string `json:"username" jsonschema:"omitempty"`
+		Password  string `json:"password" jsonschema:"omitempty"`
+		BatchSize int    `json:"batchSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		Timeout   string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// MaxPendingBatches is the number of the batches waiting to be
+		// inserted, the writer is blocked when it is reached, so that the
+		// logs are buffered and then dropped by AccessLog.
+		MaxPendingBatches int `json:"maxPendingBatches,omitempty" jsonschema:"omitempty,minimum=1"`
+		// MaxRetries is the number of the retries of a failed insert
+		// before the batch is dropped, default is no retry.
+		MaxRetries int `json:"maxRetries,omitempty" jsonschema:"omitempty,minimum=0"`
+	}
+
+	clickHouseBatch struct {
+		data  []byte
+		count int
+	}
+
+	// clickHouseSink inserts the batches in a dedicated goroutine, so
+	// that the other sinks are not blocked by a slow insert unless too
+	// many batches are pending.
+	clickHouseSink struct {
+		spec       *ClickHouseSinkSpec
+		insertURL  string
+		batchSize  int
+		maxRetries int
+		client     *http.Client
+
+		buf   bytes.Buffer
+		count int
+
+		batches chan *clickHouseBatch
+		errs    chan error
+		closing chan struct{}
+		wg      sync.WaitGroup
+	}
+)
+
+func newClickHouseSink(spec *ClickHouseSinkSpec) *clickHouseSink {
+	s := &clickHouseSink{
+		spec:       spec,
+		batchSize:  spec.BatchSize,
+		maxRetries: spec.MaxRetries,
+		errs:       make(chan error, 1),
+		closing:    make(chan struct{}),
+	}
+	if s.batchSize == 0 {
+		s.batchSize = defaultClickHouseBatchSize
+	}
+
+	timeout := defaultClickHouseTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	s.client = &http.Client{Timeout: timeout}
+
+	table := spec.Table
+	if spec.Database != "" {
+		table = spec.Database + "." + table
+	}
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table))
+	// startTime is in RFC3339, and the fields without columns are
+	// ignored, so that the fields could be added before the columns.
+	query.Set("date_time_input_format", "best_effort")
+	query.Set("input_format_skip_unknown_fields", "1")
+	s.insertURL = spec.URL + "?" + query.Encode()
+
+	maxPending := spec.MaxPendingBatches
+	if maxPending == 0 {
+		maxPending = defaultClickHouseMaxPendingBatches
+	}
+	s.batches = make(chan *clickHouseBatch, maxPending)
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+func (s *clickHouseSink) write(line []byte) error {
+	s.buf.Write(line)
+	s.buf.WriteByte('\n')
+
+	s.count++
+	if s.count >= s.batchSize {
+		return s.flush()
+	}
+	return s.takeError()
+}
+
+// flush queues the buffered logs as a batch, it blocks if there are too
+// many pending batches. The error returned is the one of a previous insert.
+func (s *clickHouseSink) flush() error {
+	if s.count > 0 {
+		data := make([]byte, s.buf.Len())
+		copy(data, s.buf.Bytes())
+		s.batches <- &clickHouseBatch{data: data, count: s.count}
+		s.buf.Reset()
+		s.count = 0
+	}
+	return s.takeError()
+}
+
+func (s *clickHouseSink) takeError() error {
+	select {
+	case err := <-s.errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (s *clickHouseSink) setError(err error) {
+	select {
+	case s.errs <- err:
+	default:
+	}
+}
+
+func (s *clickHouseSink) run() {
+	defer s.wg.Done()
+	for b := range s.batches {
+		if err := s.insertWithRetries(b); err != nil {
+			s.setError(err)
+		}
+	}
+}
+
+// insertWithRetries inserts the batch, and retries with a linear backoff
+// if failed, there's no retry once the sink is closing.
+func (s *clickHouseSink) insertWithRetries(b *clickHouseBatch) error {
+	err := s.insert(b)
+	for i := 1; err != nil && i <= s.maxRetries; i++ {
+		select {
+		case <-s.closing:
+			return err
+		case <-time.After(time.Duration(i) * time.Second):
+		}
+		err = s.insert(b)
+	}
+	return err
+}
+
+func (s *clickHouseSink) insert(b *clickHouseBatch) error {
+	req, err := http.NewRequest(http.MethodPost, s.insertURL, bytes.NewReader(b.data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.spec.Username != "" {
+		req.Header.Set("X-ClickHouse-User", s.spec.Username)
+		req.Header.Set("X-ClickHouse-Key", s.spec.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("insert %d access logs to %s returns status code %d: %s",
+			b.count, s.spec.Table, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// close inserts the buffered and pending batches before returning.
+func (s *clickHouseSink) close() {
+	s.flush()
+	close(s.closing)
+	close(s.batches)
+	s.wg.Wait()
+}
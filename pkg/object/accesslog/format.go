@@ -0,0 +1,248 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatJSON     = "json"
+	formatCombined = "combined"
+
+	requestHeaderPrefix  = "requestHeader."
+	responseHeaderPrefix = "responseHeader."
+
+	combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+// fieldNames are the names of the fields could be logged, except the
+// headers.
+var fieldNames = []string{
+	"startTime",
+	"requestID",
+	"server",
+	"pipeline",
+	"route",
+	"upstream",
+	"remoteAddr",
+	"realIP",
+	"method",
+	"host",
+	"path",
+	"uri",
+	"proto",
+	"statusCode",
+	"duration",
+	"requestSize",
+	"responseSize",
+	"userAgent",
+	"referer",
+	"tags",
+}
+
+type (
+	// Entry is an access log entry.
+	Entry struct {
+		StartTime time.Time
+		// RequestID is empty if the request IDs are disabled.
+		RequestID string
+		Server    string
+		Pipeline  string
+		// Route is the path pattern of the matched route, and Upstream
+		// is the URL of the server which the request is proxied to.
+		Route      string
+		Upstream   string
+		RemoteAddr string
+		RealIP     string
+		Method     string
+		Host       string
+		Path       string
+		URI        string
+		Proto      string
+		StatusCode int
+		Duration   time.Duration
+		// RequestSize and ResponseSize are the sizes of the whole request
+		// and response, ResponseBodySize is the size of the response body.
+		RequestSize      uint64
+		ResponseSize     uint64
+		ResponseBodySize int64
+		Tags             string
+
+		RequestHeader  http.Header
+		ResponseHeader http.Header
+
+		// headers are the header values extracted from RequestHeader and
+		// ResponseHeader before the entry is queued.
+		headers map[string]string
+	}
+
+	// formatter formats the entries into log lines.
+	formatter interface {
+		format(buf *bytes.Buffer, e *Entry)
+	}
+
+	jsonFormatter struct {
+		fields []string
+	}
+
+	combinedFormatter struct{}
+)
+
+// validateField validates the name of a field.
+func validateField(name string) error {
+	for _, prefix := range []string{requestHeaderPrefix, responseHeaderPrefix} {
+		if strings.HasPrefix(name, prefix) {
+			if len(name) == len(prefix) {
+				return fmt.Errorf("header name of field %s is empty", name)
+			}
+			return nil
+		}
+	}
+	for _, n := range fieldNames {
+		if n == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown field %s", name)
+}
+
+// extractHeaders extracts the values of the header fields, so that the
+// entry does not reference the headers after it is queued.
+func (e *Entry) extractHeaders(fields []string) {
+	e.headers = map[string]string{
+		"userAgent": e.RequestHeader.Get("User-Agent"),
+		"referer":   e.RequestHeader.Get("Referer"),
+	}
+	for _, f := range fields {
+		var v string
+		if strings.HasPrefix(f, requestHeaderPrefix) {
+			v = e.RequestHeader.Get(f[len(requestHeaderPrefix):])
+		} else if strings.HasPrefix(f, responseHeaderPrefix) {
+			v = e.ResponseHeader.Get(f[len(responseHeaderPrefix):])
+		} else {
+			continue
+		}
+		e.headers[f] = v
+	}
+	e.RequestHeader, e.ResponseHeader = nil, nil
+}
+
+func newFormatter(format string, fields []string) formatter {
+	if format == formatCombined {
+		return &combinedFormatter{}
+	}
+	if len(fields) == 0 {
+		fields = fieldNames
+	}
+	return &jsonFormatter{fields: fields}
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	buf.Write(data)
+}
+
+func (f *jsonFormatter) format(buf *bytes.Buffer, e *Entry) {
+	buf.WriteByte('{')
+	for i, field := range f.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, field)
+		buf.WriteByte(':')
+
+		switch field {
+		case "startTime":
+			writeJSONString(buf, e.StartTime.Format(time.RFC3339Nano))
+		case "requestID":
+			writeJSONString(buf, e.RequestID)
+		case "server":
+			writeJSONString(buf, e.Server)
+		case "pipeline":
+			writeJSONString(buf, e.Pipeline)
+		case "route":
+			writeJSONString(buf, e.Route)
+		case "upstream":
+			writeJSONString(buf, e.Upstream)
+		case "remoteAddr":
+			writeJSONString(buf, e.RemoteAddr)
+		case "realIP":
+			writeJSONString(buf, e.RealIP)
+		case "method":
+			writeJSONString(buf, e.Method)
+		case "host":
+			writeJSONString(buf, e.Host)
+		case "path":
+			writeJSONString(buf, e.Path)
+		case "uri":
+			writeJSONString(buf, e.URI)
+		case "proto":
+			writeJSONString(buf, e.Proto)
+		case "statusCode":
+			buf.WriteString(strconv.Itoa(e.StatusCode))
+		case "duration":
+			// in milliseconds
+			ms := float64(e.Duration) / float64(time.Millisecond)
+			buf.WriteString(strconv.FormatFloat(ms, 'f', 3, 64))
+		case "requestSize":
+			buf.WriteString(strconv.FormatUint(e.RequestSize, 10))
+		case "responseSize":
+			buf.WriteString(strconv.FormatUint(e.ResponseSize, 10))
+		case "tags":
+			writeJSONString(buf, e.Tags)
+		default:
+			// userAgent, referer and the header fields
+			writeJSONString(buf, e.headers[field])
+		}
+	}
+	buf.WriteByte('}')
+}
+
+// combinedValue returns "-" for the empty values as Apache does.
+func combinedValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// format formats the entry in the Apache combined log format:
+//
+//	%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func (f *combinedFormatter) format(buf *bytes.Buffer, e *Entry) {
+	size := "-"
+	if e.ResponseBodySize > 0 {
+		size = strconv.FormatInt(e.ResponseBodySize, 10)
+	}
+
+	fmt.Fprintf(buf, `%s - - [%s] "%s %s %s" %d %s "%s" "%s"`,
+		combinedValue(e.RealIP),
+		e.StartTime.Format(combinedTimeLayout),
+		e.Method, combinedValue(e.URI), e.Proto,
+		e.StatusCode, size,
+		combinedValue(e.headers["referer"]),
+		combinedValue(e.headers["userAgent"]),
+	)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEntry() *Entry {
+	return &Entry{
+		StartTime:        time.Date(2022, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600)),
+		RequestID:        "0190d5f2-7c3e-7a4b-9b1e-3f2a1c4d5e6f",
+		Server:           "server-demo",
+		Pipeline:         "pipeline-demo",
+		Route:            "/apache_pb.*",
+		Upstream:         "http://127.0.0.1:9095",
+		RemoteAddr:       "127.0.0.1:34567",
+		RealIP:           "127.0.0.1",
+		Method:           http.MethodGet,
+		Host:             "example.com",
+		Path:             "/apache_pb.gif",
+		URI:              "/apache_pb.gif?a=1",
+		Proto:            "HTTP/1.0",
+		StatusCode:       200,
+		Duration:         1500 * time.Microsecond,
+		RequestSize:      100,
+		ResponseSize:     2426,
+		ResponseBodySize: 2326,
+		Tags:             "tag1",
+		RequestHeader: http.Header{
+			"User-Agent": []string{"Mozilla/4.08"},
+			"Referer":    []string{"http://www.example.com/start.html"},
+			"X-Id":       []string{"abc"},
+		},
+		ResponseHeader: http.Header{
+			"Content-Type": []string{"image/gif"},
+		},
+	}
+}
+
+func TestValidateField(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateField("statusCode"))
+	assert.NoError(validateField("requestHeader.X-Id"))
+	assert.NoError(validateField("responseHeader.Content-Type"))
+	assert.Error(validateField("requestHeader."))
+	assert.Error(validateField("unknown"))
+}
+
+func TestJSONFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	e := newTestEntry()
+	fields := []string{"statusCode", "duration", "uri", "userAgent", "requestHeader.X-Id", "responseHeader.Content-Type", "requestHeader.None"}
+	e.extractHeaders(fields)
+	assert.Nil(e.RequestHeader)
+
+	buf := &bytes.Buffer{}
+	newFormatter(formatJSON, fields).format(buf, e)
+	assert.Equal(`{"statusCode":200,"duration":1.500,"uri":"/apache_pb.gif?a=1","userAgent":"Mozilla/4.08","requestHeader.X-Id":"abc","responseHeader.Content-Type":"image/gif","requestHeader.None":""}`, buf.String())
+
+	// all fields by default.
+	buf.Reset()
+	newFormatter(formatJSON, nil).format(buf, e)
+	m := map[string]interface{}{}
+	assert.NoError(json.Unmarshal(buf.Bytes(), &m))
+	assert.Len(m, len(fieldNames))
+	assert.Equal("pipeline-demo", m["pipeline"])
+	assert.Equal("0190d5f2-7c3e-7a4b-9b1e-3f2a1c4d5e6f", m["requestID"])
+	assert.Equal("http://127.0.0.1:9095", m["upstream"])
+	assert.Equal("2022-10-10T13:55:36-07:00", m["startTime"])
+}
+
+func TestCombinedFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	e := newTestEntry()
+	e.extractHeaders(nil)
+
+	buf := &bytes.Buffer{}
+	newFormatter(formatCombined, nil).format(buf, e)
+	assert.Equal(`127.0.0.1 - - [10/Oct/2022:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`, buf.String())
+
+	e.ResponseBodySize = 0
+	e.headers = map[string]string{}
+	buf.Reset()
+	newFormatter(formatCombined, nil).format(buf, e)
+	assert.Equal(`127.0.0.1 - - [10/Oct/2022:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 - "-" "-"`, buf.String())
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultHTTPBatchSize = 500
+	defaultHTTPTimeout   = 10 * time.Second
+)
+
+type (
+	// HTTPSinkSpec describes an HTTP bulk endpoint, the logs are sent in
+	// batches, one log per line, e.g. to the _bulk API of Elasticsearch
+	// with a JSON format log.
+	HTTPSinkSpec struct {
+		URL       string            `json:"url" jsonschema:"required,format=uri"`
+		Headers   map[string]string `json:"headers" jsonschema:"omitempty"`
+		BatchSize int               `json:"batchSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		Timeout   string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+		// Prefix is written before every log line, e.g. the action line of
+		// the _bulk API of Elasticsearch.
+		Prefix string `json:"prefix" jsonschema:"omitempty"`
+	}
+
+	httpSink struct {
+		spec      *HTTPSinkSpec
+		batchSize int
+		client    *http.Client
+
+		buf   bytes.Buffer
+		count int
+	}
+)
+
+func newHTTPSink(spec *HTTPSinkSpec) *httpSink {
+	s := &httpSink{spec: spec, batchSize: spec.BatchSize}
+	if s.batchSize == 0 {
+		s.batchSize = defaultHTTPBatchSize
+	}
+
+	timeout := defaultHTTPTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	s.client = &http.Client{Timeout: timeout}
+	return s
+}
+
+func (s *httpSink) write(line []byte) error {
+	if s.spec.Prefix != "" {
+		s.buf.WriteString(s.spec.Prefix)
+		s.buf.WriteByte('\n')
+	}
+	s.buf.Write(line)
+	s.buf.WriteByte('\n')
+
+	s.count++
+	if s.count >= s.batchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush sends the buffered logs, they are dropped if failed.
+func (s *httpSink) flush() error {
+	if s.count == 0 {
+		return nil
+	}
+	defer func() {
+		s.buf.Reset()
+		s.count = 0
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, s.spec.URL, bytes.NewReader(s.buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range s.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("send %d access logs to %s returns status code %d", s.count, s.spec.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) close() {
+	s.flush()
+}
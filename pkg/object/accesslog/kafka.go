@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"fmt"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+var newAsyncProducer = sarama.NewAsyncProducer
+
+type (
+	// KafkaSinkSpec describes a Kafka topic.
+	KafkaSinkSpec struct {
+		Brokers []string `json:"brokers" jsonschema:"required,minItems=1"`
+		Topic   string   `json:"topic" jsonschema:"required"`
+	}
+
+	kafkaSink struct {
+		spec     *KafkaSinkSpec
+		producer sarama.AsyncProducer
+		done     chan struct{}
+	}
+)
+
+// newKafkaSink creates a Kafka sink, the producer is created on the first
+// write, so that the sink recovers if the brokers are not available at the
+// beginning.
+func newKafkaSink(spec *KafkaSinkSpec) *kafkaSink {
+	return &kafkaSink{spec: spec, done: make(chan struct{})}
+}
+
+func (s *kafkaSink) connect() error {
+	config := sarama.NewConfig()
+	config.ClientID = "easegress-accesslog"
+	config.Version = sarama.V1_0_0_0
+
+	producer, err := newAsyncProducer(s.spec.Brokers, config)
+	if err != nil {
+		return fmt.Errorf("start sarama producer with brokers %v failed: %v", s.spec.Brokers, err)
+	}
+	s.producer = producer
+
+	go func() {
+		for {
+			select {
+			case <-s.done:
+				return
+			case err, ok := <-producer.Errors():
+				if !ok {
+					return
+				}
+				logger.Errorf("send access log to kafka failed: %v", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *kafkaSink) write(line []byte) error {
+	if s.producer == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	value := make([]byte, len(line))
+	copy(value, line)
+	s.producer.Input() <- &sarama.ProducerMessage{
+		Topic: s.spec.Topic,
+		Value: sarama.ByteEncoder(value),
+	}
+	return nil
+}
+
+func (s *kafkaSink) flush() error {
+	return nil
+}
+
+func (s *kafkaSink) close() {
+	close(s.done)
+	if s.producer == nil {
+		return
+	}
+	if err := s.producer.Close(); err != nil {
+		logger.Errorf("close kafka producer failed: %v", err)
+	}
+}
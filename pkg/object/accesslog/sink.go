@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bufio"
+	"fmt"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	sinkFile       = "file"
+	sinkSyslog     = "syslog"
+	sinkKafka      = "kafka"
+	sinkHTTP       = "http"
+	sinkClickHouse = "clickhouse"
+)
+
+type (
+	// SinkSpec describes where the access logs are written to.
+	SinkSpec struct {
+		Kind       string              `json:"kind" jsonschema:"required,enum=file,enum=syslog,enum=kafka,enum=http,enum=clickhouse"`
+		File       *FileSinkSpec       `json:"file,omitempty" jsonschema:"omitempty"`
+		Syslog     *SyslogSinkSpec     `json:"syslog,omitempty" jsonschema:"omitempty"`
+		Kafka      *KafkaSinkSpec      `json:"kafka,omitempty" jsonschema:"omitempty"`
+		HTTP       *HTTPSinkSpec       `json:"http,omitempty" jsonschema:"omitempty"`
+		ClickHouse *ClickHouseSinkSpec `json:"clickhouse,omitempty" jsonschema:"omitempty"`
+	}
+
+	// FileSinkSpec describes a file sink which is rotated by size.
+	FileSinkSpec struct {
+		Filename string `json:"filename" jsonschema:"required"`
+		// MaxSize is the maximum size in megabytes before the file is
+		// rotated, default is 100.
+		MaxSize int `json:"maxSize,omitempty" jsonschema:"omitempty,minimum=1"`
+		// MaxBackups is the maximum number of rotated files to retain,
+		// default is to retain all.
+		MaxBackups int `json:"maxBackups,omitempty" jsonschema:"omitempty,minimum=0"`
+		// MaxAge is the maximum number of days to retain the rotated files,
+		// default is to retain all.
+		MaxAge   int  `json:"maxAge,omitempty" jsonschema:"omitempty,minimum=0"`
+		Compress bool `json:"compress" jsonschema:"omitempty"`
+	}
+
+	// sink writes the log lines to a destination. The sinks are only called
+	// by the writer goroutine, and the line passed to write is reused after
+	// the call returns.
+	sink interface {
+		write(line []byte) error
+		flush() error
+		close()
+	}
+
+	fileSink struct {
+		logger *lumberjack.Logger
+		w      *bufio.Writer
+	}
+)
+
+// Validate validates SinkSpec.
+func (s *SinkSpec) Validate() error {
+	var ok bool
+	switch s.Kind {
+	case sinkFile:
+		ok = s.File != nil
+	case sinkSyslog:
+		ok = s.Syslog != nil
+	case sinkKafka:
+		ok = s.Kafka != nil
+	case sinkHTTP:
+		ok = s.HTTP != nil
+	case sinkClickHouse:
+		ok = s.ClickHouse != nil
+	}
+	if !ok {
+		return fmt.Errorf("%s is required for sink of kind %s", s.Kind, s.Kind)
+	}
+	return nil
+}
+
+func newSink(spec *SinkSpec) (sink, error) {
+	switch spec.Kind {
+	case sinkFile:
+		return newFileSink(spec.File), nil
+	case sinkSyslog:
+		return newSyslogSink(spec.Syslog), nil
+	case sinkKafka:
+		return newKafkaSink(spec.Kafka), nil
+	case sinkHTTP:
+		return newHTTPSink(spec.HTTP), nil
+	case sinkClickHouse:
+		return newClickHouseSink(spec.ClickHouse), nil
+	}
+	return nil, fmt.Errorf("unknown sink kind %s", spec.Kind)
+}
+
+func newFileSink(spec *FileSinkSpec) *fileSink {
+	maxSize := spec.MaxSize
+	if maxSize == 0 {
+		maxSize = 100
+	}
+
+	l := &lumberjack.Logger{
+		Filename:   spec.Filename,
+		MaxSize:    maxSize,
+		MaxBackups: spec.MaxBackups,
+		MaxAge:     spec.MaxAge,
+		Compress:   spec.Compress,
+		LocalTime:  true,
+	}
+	return &fileSink{logger: l, w: bufio.NewWriterSize(l, 64<<10)}
+}
+
+func (s *fileSink) write(line []byte) error {
+	if _, err := s.w.Write(line); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+func (s *fileSink) flush() error {
+	return s.w.Flush()
+}
+
+func (s *fileSink) close() {
+	s.w.Flush()
+	s.logger.Close()
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinkSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&SinkSpec{Kind: sinkFile}).Validate())
+	assert.NoError((&SinkSpec{Kind: sinkFile, File: &FileSinkSpec{Filename: "a.log"}}).Validate())
+	assert.Error((&SinkSpec{Kind: sinkKafka, File: &FileSinkSpec{Filename: "a.log"}}).Validate())
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+
+	filename := filepath.Join(t.TempDir(), "access.log")
+	s, err := newSink(&SinkSpec{Kind: sinkFile, File: &FileSinkSpec{Filename: filename}})
+	assert.NoError(err)
+
+	assert.NoError(s.write([]byte("line1")))
+	assert.NoError(s.write([]byte("line2")))
+	assert.NoError(s.flush())
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(err)
+	assert.Equal("line1\nline2\n", string(data))
+
+	s.write([]byte("line3"))
+	s.close()
+	data, _ = os.ReadFile(filename)
+	assert.Equal("line1\nline2\nline3\n", string(data))
+}
+
+func TestSyslogSink(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+
+	s := newSyslogSink(&SyslogSinkSpec{Address: conn.LocalAddr().String(), Facility: "local1", Tag: "eg"})
+	defer s.close()
+	assert.NoError(s.write([]byte(`{"statusCode":200}`)))
+
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(err)
+	msg := string(buf[:n])
+	// local1 * 8 + info
+	assert.True(strings.HasPrefix(msg, "<142>1 "), msg)
+	assert.Contains(msg, " eg ")
+	assert.True(strings.HasSuffix(msg, ` - - {"statusCode":200}`), msg)
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	s := newSyslogSink(&SyslogSinkSpec{Network: "tcp", Address: l.Addr().String()})
+	assert.NoError(s.write([]byte("line1")))
+	assert.NoError(s.write([]byte("line2")))
+	s.close()
+
+	conn, err := l.Accept()
+	assert.NoError(err)
+	data, _ := io.ReadAll(conn)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Len(lines, 2)
+	assert.True(strings.HasPrefix(lines[0], "<134>1 "))
+	assert.True(strings.HasSuffix(lines[1], " - - line2"))
+}
+
+func TestHTTPSink(t *testing.T) {
+	assert := assert.New(t)
+
+	var bodies []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.Equal("Basic abc", r.Header.Get("Authorization"))
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s := newHTTPSink(&HTTPSinkSpec{
+		URL:       server.URL,
+		Headers:   map[string]string{"Authorization": "Basic abc"},
+		BatchSize: 2,
+		Prefix:    `{"index":{}}`,
+	})
+
+	assert.NoError(s.write([]byte("line1")))
+	assert.Empty(bodies)
+	assert.NoError(s.write([]byte("line2")))
+	assert.Equal([]string{"{\"index\":{}}\nline1\n{\"index\":{}}\nline2\n"}, bodies)
+
+	// nothing to flush.
+	assert.NoError(s.flush())
+	assert.Len(bodies, 1)
+
+	status = http.StatusInternalServerError
+	s.write([]byte("line3"))
+	assert.Error(s.flush())
+	assert.Len(bodies, 2)
+	assert.Zero(s.count)
+}
+
+func TestKafkaSink(t *testing.T) {
+	assert := assert.New(t)
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	producer.ExpectInputAndSucceed()
+	newAsyncProducer = func(addrs []string, conf *sarama.Config) (sarama.AsyncProducer, error) {
+		return producer, nil
+	}
+	defer func() {
+		newAsyncProducer = sarama.NewAsyncProducer
+	}()
+
+	s := newKafkaSink(&KafkaSinkSpec{Brokers: []string{"127.0.0.1:9092"}, Topic: "accesslog"})
+	line := []byte("line1")
+	assert.NoError(s.write(line))
+	copy(line, "xxxxx")
+
+	msg := <-producer.Successes()
+	assert.Equal("accesslog", msg.Topic)
+	value, _ := msg.Value.Encode()
+	assert.Equal("line1", string(value))
+	s.close()
+}
+
+func TestClickHouseSink(t *testing.T) {
+	assert := assert.New(t)
+
+	bodies := make(chan string, 10)
+	var failures int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("INSERT INTO logs.access FORMAT JSONEachRow", r.URL.Query().Get("query"))
+		assert.Equal("default", r.Header.Get("X-ClickHouse-User"))
+		assert.Equal("secret", r.Header.Get("X-ClickHouse-Key"))
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("Code: 60. DB::Exception: Table logs.access doesn't exist.\n"))
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies <- string(data)
+	}))
+	defer server.Close()
+
+	s := newClickHouseSink(&ClickHouseSinkSpec{
+		URL:       server.URL,
+		Database:  "logs",
+		Table:     "access",
+		Username:  "default",
+		Password:  "secret",
+		BatchSize: 2,
+	})
+
+	assert.NoError(s.write([]byte(`{"statusCode":200}`)))
+	assert.NoError(s.write([]byte(`{"statusCode":404}`)))
+	assert.Equal("{\"statusCode\":200}\n{\"statusCode\":404}\n", <-bodies)
+
+	// the error of the failed insert is returned by the next call.
+	atomic.StoreInt32(&failures, 1)
+	s.write([]byte(`{"statusCode":500}`))
+	assert.NoError(s.flush())
+	assert.Eventually(func() bool {
+		err := s.flush()
+		return err != nil && strings.Contains(err.Error(), "doesn't exist")
+	}, time.Second, 10*time.Millisecond)
+
+	// the buffered logs are inserted on closing.
+	s.write([]byte(`{"statusCode":503}`))
+	s.close()
+	assert.Equal("{\"statusCode\":503}\n", <-bodies)
+}
+
+func TestClickHouseSinkRetry(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	s := newClickHouseSink(&ClickHouseSinkSpec{URL: server.URL, Table: "access", MaxRetries: 1})
+	s.write([]byte(`{"statusCode":200}`))
+	assert.NoError(s.flush())
+	assert.Eventually(func() bool {
+		return atomic.LoadInt32(&requests) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+	s.close()
+	assert.NoError(s.takeError())
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// severityInfo is the syslog severity of the access logs.
+	severityInfo = 6
+
+	syslogDialTimeout = 5 * time.Second
+)
+
+// syslogFacilities maps the facility names to their codes.
+var syslogFacilities = map[string]int{
+	"user":   1,
+	"daemon": 3,
+	"local0": 16,
+	"local1": 17,
+	"local2": 18,
+	"local3": 19,
+	"local4": 20,
+	"local5": 21,
+	"local6": 22,
+	"local7": 23,
+}
+
+type (
+	// SyslogSinkSpec describes a syslog server, the logs are sent in the
+	// RFC 5424 format.
+	SyslogSinkSpec struct {
+		Network  string `json:"network" jsonschema:"omitempty,enum=,enum=udp,enum=tcp,enum=unix,enum=unixgram"`
+		Address  string `json:"address" jsonschema:"required"`
+		Facility string `json:"facility" jsonschema:"omitempty,enum=,enum=user,enum=daemon,enum=local0,enum=local1,enum=local2,enum=local3,enum=local4,enum=local5,enum=local6,enum=local7"`
+		Tag      string `json:"tag" jsonschema:"omitempty"`
+	}
+
+	syslogSink struct {
+		network  string
+		address  string
+		priority int
+		tag      string
+		hostname string
+		pid      int
+
+		conn net.Conn
+		buf  bytes.Buffer
+	}
+)
+
+// newSyslogSink creates a syslog sink, it connects to the server on the
+// first write.
+func newSyslogSink(spec *SyslogSinkSpec) *syslogSink {
+	s := &syslogSink{
+		network: spec.Network,
+		address: spec.Address,
+		tag:     spec.Tag,
+		pid:     os.Getpid(),
+	}
+	if s.network == "" {
+		s.network = "udp"
+	}
+	if s.tag == "" {
+		s.tag = "easegress"
+	}
+
+	facility := syslogFacilities["local0"]
+	if spec.Facility != "" {
+		facility = syslogFacilities[spec.Facility]
+	}
+	s.priority = facility*8 + severityInfo
+
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+
+	return s
+}
+
+func (s *syslogSink) connect() error {
+	conn, err := net.DialTimeout(s.network, s.address, syslogDialTimeout)
+	if err != nil {
+		return fmt.Errorf("connect to syslog server %s failed: %v", s.address, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// isStream returns whether the network is a stream one, whose messages
+// need to be delimited.
+func (s *syslogSink) isStream() bool {
+	return s.network == "tcp" || s.network == "unix"
+}
+
+// write sends a message, it reconnects once if the connection is broken.
+func (s *syslogSink) write(line []byte) error {
+	s.buf.Reset()
+	fmt.Fprintf(&s.buf, "<%d>1 %s %s %s %d - - ", s.priority,
+		time.Now().Format(time.RFC3339Nano), s.hostname, s.tag, s.pid)
+	s.buf.Write(line)
+	if s.isStream() {
+		s.buf.WriteByte('\n')
+	}
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if s.conn == nil {
+			if err = s.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = s.conn.Write(s.buf.Bytes()); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *syslogSink) flush() error {
+	return nil
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	apiGroupName        = "autocertmanager"
+	dnsCredentialPrefix = "/autocertmanager/dnscredentials"
+)
+
+var apiOnce sync.Once
+
+// registerAPIs registers the APIs to manage the credentials of the DNS
+// providers. The credentials are write only, their fields are never
+// returned by the APIs.
+func registerAPIs() {
+	apiOnce.Do(func() {
+		api.RegisterAPIs(&api.Group{
+			Group: apiGroupName,
+			Entries: []*api.Entry{
+				{Path: dnsCredentialPrefix, Method: http.MethodGet, Handler: listDNSCredentials},
+				{Path: dnsCredentialPrefix + "/{name}", Method: http.MethodPut, Handler: putDNSCredential},
+				{Path: dnsCredentialPrefix + "/{name}", Method: http.MethodDelete, Handler: deleteDNSCredential},
+			},
+		})
+	})
+}
+
+func currentACM(w http.ResponseWriter, r *http.Request) *AutoCertManager {
+	if p := globalACM.Load(); p != nil && p.(*AutoCertManager) != nil {
+		return p.(*AutoCertManager)
+	}
+	api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("auto certificate manager is not started"))
+	return nil
+}
+
+func listDNSCredentials(w http.ResponseWriter, r *http.Request) {
+	acm := currentACM(w, r)
+	if acm == nil {
+		return
+	}
+
+	names, err := acm.storage.listDNSCredentials()
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+	api.WriteBody(w, r, names)
+}
+
+func putDNSCredential(w http.ResponseWriter, r *http.Request) {
+	acm := currentACM(w, r)
+	if acm == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if strings.Contains(name, "/") {
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid credential name %q", name))
+		return
+	}
+
+	fields := map[string]string{}
+	if err := codectool.Decode(r.Body, &fields); err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	// the provider and zone are decided by the domains.
+	for _, f := range []string{"name", "zone", dnsCredentialField} {
+		if _, ok := fields[f]; ok {
+			api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("field %q is not allowed in credentials", f))
+			return
+		}
+	}
+
+	if err := acm.storage.putDNSCredential(name, fields); err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+func deleteDNSCredential(w http.ResponseWriter, r *http.Request) {
+	acm := currentACM(w, r)
+	if acm == nil {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := acm.storage.deleteDNSCredential(name); err != nil {
+		api.ClusterPanic(err)
+	}
+}
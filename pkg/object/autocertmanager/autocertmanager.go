@@ -119,7 +119,7 @@ func (spec *Spec) Validate() error {
 			return fmt.Errorf("find wildcard domain name but DNS-01 challenge is disabled: %s", d.Name)
 		}
 
-		if _, err := newDNSProvider(d); err != nil {
+		if err := validateDNSProvider(d); err != nil {
 			return fmt.Errorf("DNS provider configuration is invalid: %v", err)
 		}
 	}
@@ -231,6 +231,7 @@ func (acm *AutoCertManager) reload() {
 	}
 
 	globalACM.Store(acm)
+	registerAPIs()
 	go acm.run()
 	go acm.watchCertificate()
 }
@@ -46,7 +46,27 @@ type dnsProviderCreator struct {
 	creatorFn      func(d *DomainSpec) (dnsProvider, error)
 }
 
+// dnsCredentialField is the DNS provider field to reference the
+// credential stored in the cluster, whose fields are merged into the
+// DNS provider at runtime.
+const dnsCredentialField = "credential"
+
 func newDNSProvider(d *DomainSpec) (dnsProvider, error) {
+	creator, err := findDNSProviderCreator(d)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range creator.requiredFields {
+		if _, ok := d.DNSProvider[f]; !ok {
+			return nil, fmt.Errorf("DNS provider field %q is required for domain: %s", f, d.Name)
+		}
+	}
+
+	return creator.creatorFn(d)
+}
+
+func findDNSProviderCreator(d *DomainSpec) (*dnsProviderCreator, error) {
 	if len(d.DNSProvider) == 0 {
 		return nil, fmt.Errorf("DNS provider is not configured for domain: %s", d.Name)
 	}
@@ -65,13 +85,45 @@ func newDNSProvider(d *DomainSpec) (dnsProvider, error) {
 		return nil, fmt.Errorf("unknown DNS provider %q for domain: %s", name, d.Name)
 	}
 
-	for _, f := range creator.requiredFields {
-		if _, ok := d.DNSProvider[f]; !ok {
-			return nil, fmt.Errorf("DNS provider field %q is required for domain: %s", f, d.Name)
-		}
+	return creator, nil
+}
+
+// newDNSProvider creates the DNS provider of a domain, the fields of the
+// credential stored in the cluster are merged into the provider, but the
+// ones in the spec take precedence.
+func (acm *AutoCertManager) newDNSProvider(d *DomainSpec) (dnsProvider, error) {
+	name := d.DNSProvider[dnsCredentialField]
+	if name == "" {
+		return newDNSProvider(d)
 	}
 
-	return creator.creatorFn(d)
+	credential, err := acm.storage.getDNSCredential(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(credential)+len(d.DNSProvider))
+	for k, v := range credential {
+		fields[k] = v
+	}
+	for k, v := range d.DNSProvider {
+		fields[k] = v
+	}
+
+	spec := *d
+	spec.DNSProvider = fields
+	return newDNSProvider(&spec)
+}
+
+// validateDNSProvider validates the DNS provider of a domain, the required
+// fields are not checked if they are stored in the cluster.
+func validateDNSProvider(d *DomainSpec) error {
+	if d.DNSProvider[dnsCredentialField] != "" {
+		_, err := findDNSProviderCreator(d)
+		return err
+	}
+	_, err := newDNSProvider(d)
+	return err
 }
 
 var dnsProviderCreators = map[string]*dnsProviderCreator{
@@ -135,6 +187,13 @@ var dnsProviderCreators = map[string]*dnsProviderCreator{
 		},
 	*/
 
+	"godaddy": {
+		requiredFields: []string{"apiKey", "apiSecret"},
+		creatorFn: func(d *DomainSpec) (dnsProvider, error) {
+			return newGodaddyProvider(d), nil
+		},
+	},
+
 	"hetzner": {
 		requiredFields: []string{"authApiToken"},
 		creatorFn: func(d *DomainSpec) (dnsProvider, error) {
@@ -149,7 +149,7 @@ func (d *Domain) waitDNSRecord(value string) error {
 	r := net.DefaultResolver
 	if addr := d.DNSProvider["nsAddress"]; addr != "" {
 		network := d.DNSProvider["nsNetwork"]
-		r := net.Resolver{PreferGo: true}
+		r = &net.Resolver{PreferGo: true}
 		r.Dial = func(ctx context.Context, n, a string) (net.Conn, error) {
 			d := net.Dialer{Timeout: 10 * time.Second}
 			if network != "" {
@@ -185,7 +185,7 @@ func (d *Domain) runDNS01(acm *AutoCertManager, chal *acme.Challenge) error {
 		return err
 	}
 
-	dp, err := newDNSProvider(d.DomainSpec)
+	dp, err := acm.newDNSProvider(d.DomainSpec)
 	if err != nil {
 		logger.Errorf("new DNS provider: %v", err)
 		return err
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+const (
+	godaddyDefaultURL = "https://api.godaddy.com"
+	// godaddyMinTTL is the minimal TTL accepted by the GoDaddy API.
+	godaddyMinTTL = 600
+)
+
+// godaddyProvider is a libdns provider of the GoDaddy domains API v1.
+type godaddyProvider struct {
+	APIKey    string
+	APISecret string
+	// APIURL is the base URL of the API, the production one is used if
+	// empty, it could be the OTE one for testing.
+	APIURL string
+
+	client *http.Client
+}
+
+type godaddyRecord struct {
+	Type string `json:"type,omitempty"`
+	Name string `json:"name,omitempty"`
+	Data string `json:"data"`
+	TTL  int    `json:"ttl,omitempty"`
+}
+
+func newGodaddyProvider(d *DomainSpec) *godaddyProvider {
+	return &godaddyProvider{
+		APIKey:    d.DNSProvider["apiKey"],
+		APISecret: d.DNSProvider["apiSecret"],
+		APIURL:    d.DNSProvider["apiUrl"],
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *godaddyProvider) do(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	base := p.APIURL
+	if base == "" {
+		base = godaddyDefaultURL
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("sso-key %s:%s", p.APIKey, p.APISecret))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("godaddy: %s %s returns status code %d: %s", method, path, resp.StatusCode, data)
+	}
+	if result != nil && len(data) > 0 {
+		return json.Unmarshal(data, result)
+	}
+	return nil
+}
+
+func godaddyDomain(zone string) string {
+	return url.PathEscape(strings.TrimSuffix(zone, "."))
+}
+
+func godaddyTTL(ttl time.Duration) int {
+	if seconds := int(ttl / time.Second); seconds > godaddyMinTTL {
+		return seconds
+	}
+	return godaddyMinTTL
+}
+
+func godaddyName(name string) string {
+	// GoDaddy uses '@' for the records of the zone itself.
+	if name == "" {
+		return "@"
+	}
+	return name
+}
+
+// GetRecords implements libdns.RecordGetter.
+func (p *godaddyProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	var records []godaddyRecord
+	err := p.do(ctx, http.MethodGet, "/v1/domains/"+godaddyDomain(zone)+"/records", nil, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]libdns.Record, 0, len(records))
+	for _, r := range records {
+		result = append(result, libdns.Record{
+			Type:  r.Type,
+			Name:  r.Name,
+			Value: r.Data,
+			TTL:   time.Duration(r.TTL) * time.Second,
+		})
+	}
+	return result, nil
+}
+
+// AppendRecords implements libdns.RecordAppender.
+func (p *godaddyProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	records := make([]godaddyRecord, 0, len(recs))
+	for _, r := range recs {
+		records = append(records, godaddyRecord{
+			Type: r.Type,
+			Name: godaddyName(r.Name),
+			Data: r.Value,
+			TTL:  godaddyTTL(r.TTL),
+		})
+	}
+
+	err := p.do(ctx, http.MethodPatch, "/v1/domains/"+godaddyDomain(zone)+"/records", records, nil)
+	if err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// SetRecords implements libdns.RecordSetter, the records of the same type
+// and name replace the existing ones as a whole.
+func (p *godaddyProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	groups := map[string][]godaddyRecord{}
+	var keys []string
+	for _, r := range recs {
+		key := "/" + url.PathEscape(r.Type) + "/" + url.PathEscape(godaddyName(r.Name))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], godaddyRecord{Data: r.Value, TTL: godaddyTTL(r.TTL)})
+	}
+
+	for _, key := range keys {
+		err := p.do(ctx, http.MethodPut, "/v1/domains/"+godaddyDomain(zone)+"/records"+key, groups[key], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+// DeleteRecords implements libdns.RecordDeleter, all records of the same
+// type and name are deleted as the GoDaddy API doesn't support deleting a
+// single one.
+func (p *godaddyProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	for _, r := range recs {
+		path := "/v1/domains/" + godaddyDomain(zone) + "/records/" + url.PathEscape(r.Type) + "/" + url.PathEscape(godaddyName(r.Name))
+		err := p.do(ctx, http.MethodDelete, path, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package autocertmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+)
+
+func TestGodaddyProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("sso-key key:secret", r.Header.Get("Authorization"))
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode([]godaddyRecord{{Type: "TXT", Name: "_acme-challenge", Data: "token", TTL: 600}})
+			return
+		}
+		if r.URL.Path == "/v1/domains/bad.com/records" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+	}))
+	defer server.Close()
+
+	dp, err := newDNSProvider(&DomainSpec{
+		Name: "*.megaease.com",
+		DNSProvider: map[string]string{
+			"name":      "godaddy",
+			"zone":      "megaease.com",
+			"apiKey":    "key",
+			"apiSecret": "secret",
+			"apiUrl":    server.URL,
+		},
+	})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	record := libdns.Record{Type: "TXT", Name: "_acme-challenge", Value: "token"}
+
+	_, err = dp.AppendRecords(ctx, "megaease.com.", []libdns.Record{record})
+	assert.NoError(err)
+	assert.Equal("PATCH /v1/domains/megaease.com/records", requests[0])
+	assert.JSONEq(`[{"type":"TXT","name":"_acme-challenge","data":"token","ttl":600}]`, bodies[0])
+
+	record.TTL = time.Hour
+	_, err = dp.SetRecords(ctx, "megaease.com", []libdns.Record{record})
+	assert.NoError(err)
+	assert.Equal("PUT /v1/domains/megaease.com/records/TXT/_acme-challenge", requests[1])
+	assert.JSONEq(`[{"data":"token","ttl":3600}]`, bodies[1])
+
+	_, err = dp.DeleteRecords(ctx, "megaease.com", []libdns.Record{{Type: "TXT"}})
+	assert.NoError(err)
+	assert.Equal("DELETE /v1/domains/megaease.com/records/TXT/@", requests[2])
+
+	records, err := dp.GetRecords(ctx, "megaease.com")
+	assert.NoError(err)
+	assert.Equal([]libdns.Record{{Type: "TXT", Name: "_acme-challenge", Value: "token", TTL: 600 * time.Second}}, records)
+
+	_, err = dp.AppendRecords(ctx, "bad.com", []libdns.Record{record})
+	assert.Error(err)
+}
+
+func TestDNSCredential(t *testing.T) {
+	assert := assert.New(t)
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		if key == fmt.Sprintf(autoCertManagerDNSCredential, "cf") {
+			return &mvccpb.KeyValue{Value: []byte(`{"apiToken": "token"}`)}, nil
+		}
+		return nil, nil
+	}
+	acm := &AutoCertManager{storage: newStorage(cls)}
+
+	d := &DomainSpec{
+		Name: "*.megaease.com",
+		DNSProvider: map[string]string{
+			"name":       "cloudflare",
+			"zone":       "megaease.com",
+			"credential": "cf",
+		},
+	}
+	assert.NoError(validateDNSProvider(d))
+	_, err := newDNSProvider(d)
+	assert.Error(err)
+
+	dp, err := acm.newDNSProvider(d)
+	assert.NoError(err)
+	assert.NotNil(dp)
+
+	d.DNSProvider["credential"] = "missing"
+	_, err = acm.newDNSProvider(d)
+	assert.Error(err)
+
+	d.DNSProvider["name"] = "unknown"
+	assert.Error(validateDNSProvider(d))
+}
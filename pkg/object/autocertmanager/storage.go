@@ -27,11 +27,13 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 )
 
@@ -40,6 +42,9 @@ const (
 	autoCertManagerCert        = "autocert/cert/%s"
 	autoCertManagerHTTPToken   = "autocert/http/%s/%s"
 	autoCertManagerTLSALPNCert = "autocert/tlsalpn/%s"
+
+	autoCertManagerDNSCredentialPrefix = "autocert/dnscredential/"
+	autoCertManagerDNSCredential       = "autocert/dnscredential/%s"
 )
 
 type storage struct {
@@ -289,6 +294,51 @@ func (s *storage) deleteTLSALPNCert(domain string) error {
 	return s.cls.Delete(key)
 }
 
+func (s *storage) getDNSCredential(name string) (map[string]string, error) {
+	key := fmt.Sprintf(autoCertManagerDNSCredential, name)
+	kv, err := s.cls.GetRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, fmt.Errorf("DNS credential %s does not exist", name)
+	}
+
+	var fields map[string]string
+	if err = codectool.UnmarshalJSON(kv.Value, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (s *storage) putDNSCredential(name string, fields map[string]string) error {
+	key := fmt.Sprintf(autoCertManagerDNSCredential, name)
+	value, err := codectool.MarshalJSON(fields)
+	if err != nil {
+		return err
+	}
+	return s.cls.Put(key, string(value))
+}
+
+func (s *storage) deleteDNSCredential(name string) error {
+	key := fmt.Sprintf(autoCertManagerDNSCredential, name)
+	return s.cls.Delete(key)
+}
+
+func (s *storage) listDNSCredentials() ([]string, error) {
+	kvs, err := s.cls.GetRawPrefix(autoCertManagerDNSCredentialPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(kvs))
+	for k := range kvs {
+		names = append(names, strings.TrimPrefix(k, autoCertManagerDNSCredentialPrefix))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 func (s *storage) watchCertificate(ctx context.Context, onChange func(domain string, cert *tls.Certificate)) {
 	var (
 		syncer cluster.Syncer
@@ -0,0 +1,543 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package canarycontroller implements a business controller which shifts
+// the traffic from the stable pool of a Proxy to the canary pool step by
+// step, and rolls back automatically if the canary pool breaches the
+// thresholds.
+package canarycontroller
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/sampler"
+)
+
+const (
+	// Category is the category of CanaryController.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of CanaryController.
+	Kind = "CanaryController"
+
+	// StateProgressing means the traffic is being shifted to the canary.
+	StateProgressing = "progressing"
+	// StateCompleted means all the steps are passed.
+	StateCompleted = "completed"
+	// StateRolledBack means the thresholds were breached, and all the
+	// traffic is routed to the stable pool.
+	StateRolledBack = "rolledBack"
+)
+
+// percentiles are the indexes of the percentiles returned by
+// sampler.DurationSampler.Percentiles.
+var percentiles = map[string]int{
+	"p50": 1,
+	"p75": 2,
+	"p95": 3,
+	"p99": 5,
+}
+
+func init() {
+	supervisor.Register(&CanaryController{})
+}
+
+type (
+	// CanaryController is a business controller which decides the
+	// percentage of the requests routed to the canary pools of the Proxy
+	// filters referring to it, and watches the error rate and latency of
+	// the requests. The progress is stored in the cluster, so that it
+	// survives restarts and is shared by the members, the leader moves to
+	// the next step, and any member could roll back the release.
+	CanaryController struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		cls       cluster.Cluster
+
+		stepDuration  time.Duration
+		checkInterval time.Duration
+		maxLatency    time.Duration
+
+		// weight is the bits of the percentage of the requests routed to
+		// the canary, it is read by every request.
+		weight uint64
+
+		// mutex protects the fields below. The statistics are updated
+		// atomically with the read lock, as they are updated by every
+		// request.
+		mutex     sync.RWMutex
+		state     string
+		step      int
+		stepStart time.Time
+		reason    string
+		stat      *stepStat
+
+		done chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	// record is the progress of a release stored in the cluster.
+	record struct {
+		Release   string    `json:"release"`
+		Steps     []float64 `json:"steps"`
+		State     string    `json:"state"`
+		Step      int       `json:"step"`
+		StepStart time.Time `json:"stepStart"`
+		Reason    string    `json:"reason,omitempty"`
+	}
+
+	// stepStat is the statistics of the canary requests in a step.
+	stepStat struct {
+		requests uint64
+		errors   uint64
+		latency  *sampler.DurationSampler
+	}
+
+	// Spec describes CanaryController.
+	Spec struct {
+		// Release identifies the release, changing it starts a new release
+		// from the first step, e.g. to retry after a rollback.
+		Release string `json:"release" jsonschema:"omitempty"`
+		// Steps are the percentages of the requests routed to the canary
+		// in every step, e.g. [5, 25, 50, 100].
+		Steps        []float64 `json:"steps" jsonschema:"required,minItems=1"`
+		StepDuration string    `json:"stepDuration" jsonschema:"required,format=duration"`
+		// MinRequests is the minimum number of canary requests in a step
+		// to evaluate the thresholds and to move to the next step.
+		MinRequests   uint64 `json:"minRequests" jsonschema:"omitempty"`
+		CheckInterval string `json:"checkInterval" jsonschema:"omitempty,format=duration"`
+		// MaxErrorRate is the maximum percentage of the failed canary
+		// requests, 0 means no limit.
+		MaxErrorRate float64 `json:"maxErrorRate" jsonschema:"omitempty,minimum=0,maximum=100"`
+		// MaxLatency is the maximum latency of the canary requests at the
+		// LatencyPercentile, empty means no limit.
+		MaxLatency        string `json:"maxLatency" jsonschema:"omitempty,format=duration"`
+		LatencyPercentile string `json:"latencyPercentile" jsonschema:"omitempty,enum=,enum=p50,enum=p75,enum=p95,enum=p99"`
+	}
+
+	// Status is the status of CanaryController.
+	Status struct {
+		Release       string  `json:"release,omitempty"`
+		State         string  `json:"state"`
+		Step          int     `json:"step"`
+		Weight        float64 `json:"weight"`
+		StepStartTime string  `json:"stepStartTime"`
+		Requests      uint64  `json:"requests"`
+		Errors        uint64  `json:"errors"`
+		ErrorRate     float64 `json:"errorRate"`
+		// Latency is the latency in milliseconds at the percentile.
+		Latency        float64 `json:"latency"`
+		RollbackReason string  `json:"rollbackReason,omitempty"`
+	}
+)
+
+var (
+	// canariesLock serializes the updates of canaries.
+	canariesLock sync.Mutex
+	// canaries holds the running CanaryControllers by name, it is an
+	// atomic value because it is read by every request.
+	canaries atomic.Value
+)
+
+func init() {
+	canaries.Store(map[string]*CanaryController{})
+}
+
+func register(cc *CanaryController) {
+	canariesLock.Lock()
+	defer canariesLock.Unlock()
+
+	old := canaries.Load().(map[string]*CanaryController)
+	m := make(map[string]*CanaryController, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[cc.superSpec.Name()] = cc
+	canaries.Store(m)
+}
+
+// unregister removes the CanaryController, it does nothing if the
+// CanaryController has been replaced by a new generation.
+func unregister(cc *CanaryController) {
+	canariesLock.Lock()
+	defer canariesLock.Unlock()
+
+	old := canaries.Load().(map[string]*CanaryController)
+	name := cc.superSpec.Name()
+	if old[name] != cc {
+		return
+	}
+
+	m := make(map[string]*CanaryController, len(old))
+	for k, v := range old {
+		if k != name {
+			m[k] = v
+		}
+	}
+	canaries.Store(m)
+}
+
+func lookup(name string) *CanaryController {
+	return canaries.Load().(map[string]*CanaryController)[name]
+}
+
+// Match returns whether a request should be routed to the canary of the
+// CanaryController. It returns false if the CanaryController doesn't
+// exist, so all requests are routed to the stable pool.
+func Match(name string) bool {
+	cc := lookup(name)
+	if cc == nil {
+		return false
+	}
+
+	w := cc.getWeight()
+	return w >= 100 || (w > 0 && rand.Float64()*100 < w)
+}
+
+// Observe records the result of a request routed to the canary of the
+// CanaryController.
+func Observe(name string, failed bool, duration time.Duration) {
+	if cc := lookup(name); cc != nil {
+		cc.observe(failed, duration)
+	}
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Steps) == 0 {
+		return fmt.Errorf("steps is required")
+	}
+	prev := 0.0
+	for _, s := range spec.Steps {
+		if s <= prev || s > 100 {
+			return fmt.Errorf("steps must be ascending percentages in (0, 100]")
+		}
+		prev = s
+	}
+
+	if _, err := time.ParseDuration(spec.StepDuration); err != nil {
+		return fmt.Errorf("invalid stepDuration %s: %v", spec.StepDuration, err)
+	}
+	if spec.CheckInterval != "" {
+		d, err := time.ParseDuration(spec.CheckInterval)
+		if err != nil {
+			return fmt.Errorf("invalid checkInterval %s: %v", spec.CheckInterval, err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("checkInterval must be at least 1s")
+		}
+	}
+
+	if spec.MaxErrorRate == 0 && spec.MaxLatency == "" {
+		return fmt.Errorf("maxErrorRate or maxLatency is required")
+	}
+	if spec.MaxLatency != "" {
+		if _, err := time.ParseDuration(spec.MaxLatency); err != nil {
+			return fmt.Errorf("invalid maxLatency %s: %v", spec.MaxLatency, err)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of CanaryController.
+func (cc *CanaryController) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of CanaryController.
+func (cc *CanaryController) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of CanaryController.
+func (cc *CanaryController) DefaultSpec() interface{} {
+	return &Spec{
+		MinRequests:       100,
+		CheckInterval:     "10s",
+		LatencyPercentile: "p99",
+	}
+}
+
+// Init initializes CanaryController.
+func (cc *CanaryController) Init(superSpec *supervisor.Spec) {
+	cc.superSpec, cc.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	cc.cls = superSpec.Super().Cluster()
+	cc.reload()
+}
+
+// Inherit inherits previous generation of CanaryController. The progress
+// stored in the cluster is kept if the release and the steps are not
+// changed, and a rolled back release is kept rolled back until the
+// release is changed.
+func (cc *CanaryController) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	cc.Init(superSpec)
+	previousGeneration.Close()
+}
+
+func (cc *CanaryController) reload() {
+	cc.stepDuration, _ = time.ParseDuration(cc.spec.StepDuration)
+	cc.checkInterval = 10 * time.Second
+	if cc.spec.CheckInterval != "" {
+		cc.checkInterval, _ = time.ParseDuration(cc.spec.CheckInterval)
+	}
+	if cc.spec.MaxLatency != "" {
+		cc.maxLatency, _ = time.ParseDuration(cc.spec.MaxLatency)
+	}
+
+	cc.state = StateProgressing
+	cc.setStep(0, time.Now())
+	if rec := cc.loadRecord(); rec == nil || !cc.restore(rec) {
+		cc.saveRecord()
+	}
+	register(cc)
+
+	cc.done = make(chan struct{})
+	cc.wg.Add(1)
+	go cc.run()
+}
+
+func (cc *CanaryController) getWeight() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&cc.weight))
+}
+
+func (cc *CanaryController) setWeight(w float64) {
+	atomic.StoreUint64(&cc.weight, math.Float64bits(w))
+}
+
+// setStep moves to the step and resets the statistics, the caller must
+// hold the lock or be the initialization.
+func (cc *CanaryController) setStep(step int, now time.Time) {
+	cc.step = step
+	cc.stepStart = now
+	cc.stat = &stepStat{latency: sampler.NewDurationSampler()}
+	cc.setWeight(cc.spec.Steps[step])
+}
+
+// restore restores the progress from rec, it returns false if rec is not
+// of the release, or the steps are changed and it is not rolled back. The
+// caller must hold the lock or be the initialization.
+func (cc *CanaryController) restore(rec *record) bool {
+	if rec.Release != cc.spec.Release {
+		return false
+	}
+
+	step := rec.Step
+	if step < 0 || step >= len(cc.spec.Steps) {
+		step = len(cc.spec.Steps) - 1
+	}
+
+	if rec.State == StateRolledBack {
+		cc.state = StateRolledBack
+		cc.reason = rec.Reason
+		cc.setStep(step, rec.StepStart)
+		cc.setWeight(0)
+		return true
+	}
+
+	if !reflect.DeepEqual(rec.Steps, cc.spec.Steps) {
+		return false
+	}
+	cc.state = rec.State
+	cc.setStep(step, rec.StepStart)
+	return true
+}
+
+func (cc *CanaryController) loadRecord() *record {
+	name := cc.superSpec.Name()
+	value, err := cc.cls.Get(cc.cls.Layout().CanaryKey(name))
+	if err != nil {
+		logger.Errorf("%s: load progress failed: %v", name, err)
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+
+	rec := &record{}
+	if err := codectool.UnmarshalJSON([]byte(*value), rec); err != nil {
+		logger.Errorf("%s: unmarshal progress failed: %v", name, err)
+		return nil
+	}
+	return rec
+}
+
+// saveRecord saves the progress to the cluster, the caller must hold the
+// lock or be the initialization.
+func (cc *CanaryController) saveRecord() {
+	rec := &record{
+		Release:   cc.spec.Release,
+		Steps:     cc.spec.Steps,
+		State:     cc.state,
+		Step:      cc.step,
+		StepStart: cc.stepStart,
+		Reason:    cc.reason,
+	}
+	name := cc.superSpec.Name()
+	value := string(codectool.MustMarshalJSON(rec))
+	if err := cc.cls.Put(cc.cls.Layout().CanaryKey(name), value); err != nil {
+		logger.Errorf("%s: save progress failed: %v", name, err)
+	}
+}
+
+func (cc *CanaryController) observe(failed bool, duration time.Duration) {
+	cc.mutex.RLock()
+	defer cc.mutex.RUnlock()
+
+	s := cc.stat
+	atomic.AddUint64(&s.requests, 1)
+	if failed {
+		atomic.AddUint64(&s.errors, 1)
+	}
+	s.latency.Update(duration)
+}
+
+func (cc *CanaryController) run() {
+	defer cc.wg.Done()
+
+	ticker := time.NewTicker(cc.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cc.done:
+			return
+		case now := <-ticker.C:
+			cc.check(now)
+		}
+	}
+}
+
+// latency returns the latency in milliseconds at the percentile of the
+// spec, the caller must hold the write lock.
+func (cc *CanaryController) latency() float64 {
+	if cc.stat.requests == 0 {
+		return 0
+	}
+	idx, ok := percentiles[cc.spec.LatencyPercentile]
+	if !ok {
+		idx = percentiles["p99"]
+	}
+	return cc.stat.latency.Percentiles()[idx]
+}
+
+// breach returns the reason if the statistics of the current step breach
+// the thresholds, the caller must hold the write lock.
+func (cc *CanaryController) breach() string {
+	s := cc.stat
+	if cc.spec.MaxErrorRate > 0 {
+		rate := float64(s.errors) * 100 / float64(s.requests)
+		if rate > cc.spec.MaxErrorRate {
+			return fmt.Sprintf("error rate %.2f%% exceeds %.2f%% at step %d", rate, cc.spec.MaxErrorRate, cc.step)
+		}
+	}
+	if cc.maxLatency > 0 {
+		latency := time.Duration(cc.latency() * float64(time.Millisecond))
+		if latency > cc.maxLatency {
+			return fmt.Sprintf("%s latency %v exceeds %v at step %d", cc.spec.LatencyPercentile, latency, cc.maxLatency, cc.step)
+		}
+	}
+	return ""
+}
+
+// check evaluates the thresholds, and moves to the next step if the
+// current step lasts long enough. A step is extended until there are
+// enough requests to evaluate. Only the leader moves to the next step,
+// and the other members follow the progress in the cluster.
+func (cc *CanaryController) check(now time.Time) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	// follow the progress of the other members, e.g. a rollback.
+	if rec := cc.loadRecord(); rec != nil && (rec.State != cc.state || rec.Step != cc.step) {
+		cc.restore(rec)
+	}
+
+	if cc.state != StateProgressing {
+		return
+	}
+
+	name := cc.superSpec.Name()
+	enough := cc.stat.requests > 0 && cc.stat.requests >= cc.spec.MinRequests
+	if enough {
+		if reason := cc.breach(); reason != "" {
+			cc.state = StateRolledBack
+			cc.reason = reason
+			cc.setWeight(0)
+			cc.saveRecord()
+			logger.Warnf("%s: rolled back to the stable pool: %s", name, reason)
+			return
+		}
+	}
+
+	if now.Sub(cc.stepStart) < cc.stepDuration || !cc.cls.IsLeader() {
+		return
+	}
+	if !enough {
+		logger.Debugf("%s: not enough requests at step %d, step extended", name, cc.step)
+		return
+	}
+
+	if cc.step == len(cc.spec.Steps)-1 {
+		cc.state = StateCompleted
+		cc.saveRecord()
+		logger.Infof("%s: canary release completed", name)
+		return
+	}
+	cc.setStep(cc.step+1, now)
+	cc.saveRecord()
+	logger.Infof("%s: moved to step %d, %.2f%% of the requests are routed to the canary",
+		name, cc.step, cc.spec.Steps[cc.step])
+}
+
+// Status returns the status of CanaryController.
+func (cc *CanaryController) Status() *supervisor.Status {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	s := &Status{
+		Release:        cc.spec.Release,
+		State:          cc.state,
+		Step:           cc.step,
+		Weight:         cc.getWeight(),
+		StepStartTime:  cc.stepStart.Format(time.RFC3339),
+		Requests:       cc.stat.requests,
+		Errors:         cc.stat.errors,
+		Latency:        cc.latency(),
+		RollbackReason: cc.reason,
+	}
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) * 100 / float64(s.Requests)
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes CanaryController.
+func (cc *CanaryController) Close() {
+	unregister(cc)
+	close(cc.done)
+	cc.wg.Wait()
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package canarycontroller
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestSuper(c cluster.Cluster) *supervisor.Supervisor {
+	return supervisor.NewMock(nil, c, sync.Map{}, sync.Map{}, nil, nil, false, nil, nil)
+}
+
+func newTestCanaryController(t *testing.T, super *supervisor.Supervisor, yaml string) *CanaryController {
+	superSpec, err := super.NewSpec(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &CanaryController{}
+	cc.Init(superSpec)
+	return cc
+}
+
+func observeN(name string, n int, failed bool, d time.Duration) {
+	for i := 0; i < n; i++ {
+		Observe(name, failed, d)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Steps: []float64{10, 5}, StepDuration: "1m", MaxErrorRate: 1}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Steps: []float64{10, 200}, StepDuration: "1m", MaxErrorRate: 1}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Steps: []float64{10, 100}, StepDuration: "abc", MaxErrorRate: 1}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Steps: []float64{10, 100}, StepDuration: "1m"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Steps: []float64{10, 100}, StepDuration: "1m", MaxLatency: "100ms", CheckInterval: "10ms"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Steps: []float64{10, 100}, StepDuration: "1m", MaxLatency: "100ms"}
+	assert.NoError(spec.Validate())
+}
+
+func TestProgressAndComplete(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(Match("canary"))
+
+	c, _ := clustertest.NewMemoryCluster()
+	cc := newTestCanaryController(t, newTestSuper(c), `
+kind: CanaryController
+name: canary
+steps: [50, 100]
+stepDuration: 1m
+minRequests: 10
+maxErrorRate: 10
+maxLatency: 100ms
+`)
+	defer cc.Close()
+
+	start := cc.stepStart
+	assert.Equal(50.0, cc.getWeight())
+
+	// not enough requests, the step is extended.
+	observeN("canary", 5, false, time.Millisecond)
+	cc.check(start.Add(2 * time.Minute))
+	assert.Equal(0, cc.step)
+
+	observeN("canary", 5, false, time.Millisecond)
+	cc.check(start.Add(30 * time.Second))
+	assert.Equal(0, cc.step)
+	cc.check(start.Add(2 * time.Minute))
+	assert.Equal(1, cc.step)
+	assert.True(Match("canary"))
+
+	status := cc.Status().ObjectStatus.(*Status)
+	assert.Equal(StateProgressing, status.State)
+	assert.Equal(100.0, status.Weight)
+	assert.Zero(status.Requests)
+
+	observeN("canary", 10, false, time.Millisecond)
+	cc.check(start.Add(4 * time.Minute))
+	assert.Equal(StateCompleted, cc.Status().ObjectStatus.(*Status).State)
+	assert.True(Match("canary"))
+}
+
+func TestRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	c, data := clustertest.NewMemoryCluster()
+	super := newTestSuper(c)
+	yamlConfig := `
+kind: CanaryController
+name: canary
+release: v1
+steps: [5, 25, 100]
+stepDuration: 1m
+minRequests: 10
+maxErrorRate: 10
+`
+	cc := newTestCanaryController(t, super, yamlConfig)
+	observeN("canary", 8, false, time.Millisecond)
+	observeN("canary", 2, true, time.Millisecond)
+	cc.check(cc.stepStart.Add(time.Second))
+
+	status := cc.Status().ObjectStatus.(*Status)
+	assert.Equal(StateRolledBack, status.State)
+	assert.Equal(0.0, status.Weight)
+	assert.Equal(20.0, status.ErrorRate)
+	assert.Contains(status.RollbackReason, "error rate")
+	assert.False(Match("canary"))
+	assert.Contains(data[c.Layout().CanaryKey("canary")], StateRolledBack)
+
+	// the release is kept rolled back by the new generation, even if the
+	// thresholds are changed.
+	superSpec, err := super.NewSpec(yamlConfig + "maxLatency: 100ms\n")
+	assert.NoError(err)
+	cc2 := &CanaryController{}
+	cc2.Inherit(superSpec, cc)
+	assert.Equal(cc2, lookup("canary"))
+	assert.Equal(0.0, cc2.getWeight())
+	status = cc2.Status().ObjectStatus.(*Status)
+	assert.Equal(StateRolledBack, status.State)
+	assert.Contains(status.RollbackReason, "error rate")
+
+	// and so is it after a restart.
+	cc2.Close()
+	cc3 := newTestCanaryController(t, super, yamlConfig)
+	assert.Equal(0.0, cc3.getWeight())
+	assert.Equal(StateRolledBack, cc3.Status().ObjectStatus.(*Status).State)
+
+	// a new release starts over.
+	superSpec, err = super.NewSpec(strings.Replace(yamlConfig, "release: v1", "release: v2", 1) + `
+maxLatency: 100ms
+latencyPercentile: p50
+`)
+	assert.NoError(err)
+	cc4 := &CanaryController{}
+	cc4.Inherit(superSpec, cc3)
+	assert.Equal(5.0, cc4.getWeight())
+	assert.Equal(StateProgressing, cc4.Status().ObjectStatus.(*Status).State)
+
+	observeN("canary", 100, false, 200*time.Millisecond)
+	cc4.check(cc4.stepStart.Add(time.Second))
+	status = cc4.Status().ObjectStatus.(*Status)
+	assert.Equal(StateRolledBack, status.State)
+	assert.Contains(status.RollbackReason, "p50 latency")
+
+	cc4.Close()
+	assert.Nil(lookup("canary"))
+}
+
+func TestSharedProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _ := clustertest.NewMemoryCluster()
+	yamlConfig := `
+kind: CanaryController
+name: canary
+steps: [5, 25, 100]
+stepDuration: 1m
+minRequests: 10
+maxErrorRate: 10
+`
+	cc := newTestCanaryController(t, newTestSuper(c), yamlConfig)
+	start := cc.stepStart
+
+	// the progress is kept if the steps are not changed.
+	observeN("canary", 10, false, time.Millisecond)
+	cc.check(start.Add(2 * time.Minute))
+	assert.Equal(1, cc.step)
+
+	superSpec, err := newTestSuper(c).NewSpec(yamlConfig)
+	assert.NoError(err)
+	cc2 := &CanaryController{}
+	cc2.Inherit(superSpec, cc)
+	assert.Equal(1, cc2.step)
+	assert.Equal(25.0, cc2.getWeight())
+
+	// a member which is not the leader doesn't move to the next step, but
+	// follows the progress of the leader.
+	follower, _ := clustertest.NewMemoryCluster()
+	follower.MockedIsLeader = func() bool { return false }
+	follower.MockedGet = c.MockedGet
+	follower.MockedPut = c.MockedPut
+	cc3 := &CanaryController{superSpec: superSpec, spec: superSpec.ObjectSpec().(*Spec), cls: follower}
+	cc3.setStep(0, start)
+	cc3.state = StateProgressing
+	cc3.check(start.Add(10 * time.Minute))
+	assert.Equal(1, cc3.step)
+	assert.Equal(25.0, cc3.getWeight())
+
+	cc3.stat.requests = 10
+	cc3.check(start.Add(10 * time.Minute))
+	assert.Equal(1, cc3.step)
+
+	observeN("canary", 10, false, time.Millisecond)
+	cc2.check(cc2.stepStart.Add(2 * time.Minute))
+	assert.Equal(2, cc2.step)
+	cc3.check(start.Add(10 * time.Minute))
+	assert.Equal(2, cc3.step)
+
+	// the release starts over if the steps are changed.
+	superSpec, err = newTestSuper(c).NewSpec(strings.Replace(yamlConfig, "[5, 25, 100]", "[10, 100]", 1))
+	assert.NoError(err)
+	cc4 := &CanaryController{}
+	cc4.Inherit(superSpec, cc2)
+	assert.Equal(0, cc4.step)
+	assert.Equal(10.0, cc4.getWeight())
+	cc4.Close()
+}
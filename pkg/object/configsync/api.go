@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configsync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/pkg/api"
+)
+
+const (
+	apiGroupName = "configsync"
+	apiPrefix    = "/configsyncs"
+)
+
+var (
+	apiOnce sync.Once
+
+	// instances are the running ConfigSyncs by names.
+	instances      = map[string]*ConfigSync{}
+	instancesMutex sync.Mutex
+)
+
+func registerInstance(cs *ConfigSync) {
+	instancesMutex.Lock()
+	defer instancesMutex.Unlock()
+	instances[cs.superSpec.Name()] = cs
+}
+
+func unregisterInstance(cs *ConfigSync) {
+	instancesMutex.Lock()
+	defer instancesMutex.Unlock()
+	// the instance may have been replaced by the next generation.
+	if instances[cs.superSpec.Name()] == cs {
+		delete(instances, cs.superSpec.Name())
+	}
+}
+
+func getInstance(name string) *ConfigSync {
+	instancesMutex.Lock()
+	defer instancesMutex.Unlock()
+	return instances[name]
+}
+
+// registerAPIs registers the webhook API which triggers a sync on the
+// member receiving it.
+func registerAPIs() {
+	apiOnce.Do(func() {
+		api.RegisterAPIs(&api.Group{
+			Group: apiGroupName,
+			Entries: []*api.Entry{
+				{Path: apiPrefix + "/{name}/sync", Method: http.MethodPost, Handler: syncWebhook},
+			},
+		})
+	})
+}
+
+func syncWebhook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	cs := getInstance(name)
+	if cs == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("ConfigSync %s not found", name))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+
+	if !verifyWebhook(cs.spec.WebhookSecret, r.Header, body) {
+		api.HandleAPIError(w, r, http.StatusUnauthorized, fmt.Errorf("invalid webhook signature or token"))
+		return
+	}
+
+	cs.triggerSync()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyWebhook verifies the signature of GitHub webhooks or the token of
+// GitLab webhooks, all requests are accepted if the secret is empty.
+func verifyWebhook(secret string, header http.Header, body []byte) bool {
+	if secret == "" {
+		return true
+	}
+
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return hmac.Equal([]byte(token), []byte(secret))
+	}
+
+	signature := strings.TrimPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
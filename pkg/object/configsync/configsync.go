@@ -0,0 +1,466 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package configsync implements a business controller which syncs the
+// objects defined in a Git repository to the cluster.
+package configsync
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Category is the category of ConfigSync.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of ConfigSync.
+	Kind = "ConfigSync"
+
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+
+	gitTimeout = 2 * time.Minute
+)
+
+func init() {
+	supervisor.Register(&ConfigSync{})
+}
+
+type (
+	// ConfigSync is a business controller which syncs the objects defined
+	// in the YAML files of a Git repository to the cluster. The repository
+	// is pulled by the leader on an interval, or by any member when its
+	// webhook is called, and the objects are created, updated or deleted in
+	// one transaction to match the repository.
+	ConfigSync struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		cls      cluster.Cluster
+		store    *api.ObjectStore
+		repo     *gitRepo
+		interval time.Duration
+
+		// mutex serializes the syncs.
+		mutex   sync.Mutex
+		status  atomic.Value
+		trigger chan struct{}
+		done    chan struct{}
+		wg      sync.WaitGroup
+	}
+
+	// Spec describes ConfigSync.
+	Spec struct {
+		Repository string `json:"repository" jsonschema:"required"`
+		Branch     string `json:"branch" jsonschema:"omitempty"`
+		// Path is the directory of the YAML files in the repository, the
+		// files in its subdirectories are also synced.
+		Path     string `json:"path" jsonschema:"omitempty"`
+		Interval string `json:"interval" jsonschema:"omitempty,format=duration"`
+		// Prune deletes the objects synced before but removed from the
+		// repository.
+		Prune bool `json:"prune" jsonschema:"omitempty"`
+		// DryRun only reports the drift without changing the cluster.
+		DryRun bool `json:"dryRun" jsonschema:"omitempty"`
+		// WebhookSecret authenticates the webhook requests, it is the
+		// secret of GitHub webhooks or the token of GitLab webhooks.
+		WebhookSecret string `json:"webhookSecret" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of ConfigSync.
+	Status struct {
+		// Commit is the commit synced by the last sync.
+		Commit       string `json:"commit,omitempty"`
+		LastSyncTime string `json:"lastSyncTime,omitempty"`
+		// Version is the config version of the last change.
+		Version int64    `json:"version,omitempty"`
+		Objects []string `json:"objects,omitempty"`
+		// Drift is the differences between the repository and the cluster
+		// found by the last sync, they have been corrected unless dryRun
+		// is true.
+		Drift     []*Drift `json:"drift,omitempty"`
+		LastError string   `json:"lastError,omitempty"`
+	}
+
+	// Drift is a difference between the repository and the cluster.
+	Drift struct {
+		Name   string `json:"name"`
+		Kind   string `json:"kind,omitempty"`
+		Action string `json:"action"`
+	}
+
+	// record is the record of the last sync saved in the cluster, so that
+	// the synced objects could be pruned after the leader changes.
+	record struct {
+		Commit  string   `json:"commit"`
+		Objects []string `json:"objects"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Interval != "" {
+		d, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s: %v", spec.Interval, err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("interval must be at least 1s")
+		}
+	}
+	if path.IsAbs(spec.Path) {
+		return fmt.Errorf("path %s must be relative to the repository root", spec.Path)
+	}
+	for _, elem := range strings.Split(path.Clean(spec.Path), "/") {
+		if elem == ".." {
+			return fmt.Errorf("path %s is out of the repository", spec.Path)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of ConfigSync.
+func (cs *ConfigSync) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of ConfigSync.
+func (cs *ConfigSync) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of ConfigSync.
+func (cs *ConfigSync) DefaultSpec() interface{} {
+	return &Spec{
+		Branch:   "main",
+		Interval: "1m",
+	}
+}
+
+// Init initializes ConfigSync.
+func (cs *ConfigSync) Init(superSpec *supervisor.Spec) {
+	cs.superSpec, cs.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	cs.super = superSpec.Super()
+	cs.cls = cs.super.Cluster()
+	cs.store = api.NewObjectStore(cs.cls, cs.super)
+	cs.reload()
+}
+
+// Inherit inherits previous generation of ConfigSync.
+func (cs *ConfigSync) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	cs.Init(superSpec)
+}
+
+func (cs *ConfigSync) reload() {
+	cs.interval, _ = time.ParseDuration(cs.spec.Interval)
+	if cs.interval <= 0 {
+		cs.interval = time.Minute
+	}
+
+	dir, err := os.MkdirTemp("", "easegress-configsync-")
+	if err != nil {
+		logger.Errorf("%s: create directory failed: %v", cs.superSpec.Name(), err)
+	}
+	cs.repo = &gitRepo{url: cs.spec.Repository, branch: cs.spec.Branch, dir: dir}
+
+	cs.status.Store(&Status{})
+	cs.trigger = make(chan struct{}, 1)
+	cs.done = make(chan struct{})
+
+	registerAPIs()
+	registerInstance(cs)
+
+	cs.wg.Add(1)
+	go cs.run()
+}
+
+func (cs *ConfigSync) run() {
+	defer cs.wg.Done()
+
+	ticker := time.NewTicker(cs.interval)
+	defer ticker.Stop()
+
+	if cs.cls.IsLeader() {
+		cs.sync()
+	}
+
+	for {
+		select {
+		case <-cs.done:
+			return
+		case <-ticker.C:
+			// only the leader syncs on the interval.
+			if cs.cls.IsLeader() {
+				cs.sync()
+			}
+		case <-cs.trigger:
+			cs.sync()
+		}
+	}
+}
+
+// triggerSync triggers a sync, it never blocks.
+func (cs *ConfigSync) triggerSync() {
+	select {
+	case cs.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (cs *ConfigSync) sync() {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	prev := cs.status.Load().(*Status)
+	status := &Status{
+		Commit:       prev.Commit,
+		LastSyncTime: time.Now().Format(time.RFC3339),
+		Version:      prev.Version,
+		Objects:      prev.Objects,
+	}
+
+	if err := cs.doSync(status); err != nil {
+		logger.Errorf("%s: sync failed: %v", cs.superSpec.Name(), err)
+		status.LastError = err.Error()
+	}
+	cs.status.Store(status)
+}
+
+func (cs *ConfigSync) doSync(status *Status) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	commit, err := cs.repo.pull(ctx)
+	if err != nil {
+		return err
+	}
+
+	specs, err := cs.loadSpecs()
+	if err != nil {
+		return fmt.Errorf("commit %s: %v", commit, err)
+	}
+
+	rec, err := cs.loadRecord()
+	if err != nil {
+		return err
+	}
+
+	puts, deletes, drift, err := cs.diff(specs, rec)
+	if err != nil {
+		return fmt.Errorf("commit %s: %v", commit, err)
+	}
+
+	status.Drift = drift
+	if cs.spec.DryRun {
+		return nil
+	}
+
+	if len(drift) > 0 {
+		version, err := cs.store.Apply(puts, deletes)
+		if err != nil {
+			return err
+		}
+		status.Version = version
+		logger.Infof("%s: synced commit %s, %d objects changed, config version %d",
+			cs.superSpec.Name(), commit, len(drift), version)
+	}
+
+	rec = &record{Commit: commit}
+	for _, spec := range specs {
+		rec.Objects = append(rec.Objects, spec.Name())
+	}
+	sort.Strings(rec.Objects)
+	if err := cs.saveRecord(rec); err != nil {
+		return err
+	}
+
+	status.Commit, status.Objects = rec.Commit, rec.Objects
+	return nil
+}
+
+// loadSpecs loads the specs in the YAML files under the path, a file could
+// contain multiple documents.
+func (cs *ConfigSync) loadSpecs() ([]*supervisor.Spec, error) {
+	root := filepath.Join(cs.repo.dir, filepath.FromSlash(cs.spec.Path))
+
+	var specs []*supervisor.Spec
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(p); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(cs.repo.dir, p)
+		docs, err := readYAMLDocs(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", rel, err)
+		}
+		for _, doc := range docs {
+			spec, err := cs.super.NewSpec(string(doc))
+			if err != nil {
+				return fmt.Errorf("%s: %v", rel, err)
+			}
+			if f, ok := files[spec.Name()]; ok {
+				return fmt.Errorf("%s: object %s is also defined in %s", rel, spec.Name(), f)
+			}
+			files[spec.Name()] = rel
+			specs = append(specs, spec)
+		}
+		return nil
+	})
+	return specs, err
+}
+
+// readYAMLDocs reads the documents of a YAML file, and converts them to
+// JSON.
+func readYAMLDocs(filename string) ([][]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var docs [][]byte
+	r := yaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		data, err := r.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		doc, err := codectool.YAMLToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		if string(doc) == "null" {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+}
+
+// diff compares the specs with the objects in the cluster.
+func (cs *ConfigSync) diff(specs []*supervisor.Spec, rec *record) (puts []*supervisor.Spec, deletes []string, drift []*Drift, err error) {
+	names := map[string]bool{}
+	for _, spec := range specs {
+		names[spec.Name()] = true
+
+		existing, err := cs.store.GetObject(spec.Name())
+		switch {
+		case err != nil:
+			return nil, nil, nil, err
+		case existing == nil:
+			drift = append(drift, &Drift{Name: spec.Name(), Kind: spec.Kind(), Action: actionCreate})
+		case existing.Kind() != spec.Kind():
+			return nil, nil, nil, fmt.Errorf("object %s is a %s in the cluster, not %s", spec.Name(), existing.Kind(), spec.Kind())
+		case !existing.Equals(spec):
+			drift = append(drift, &Drift{Name: spec.Name(), Kind: spec.Kind(), Action: actionUpdate})
+		default:
+			continue
+		}
+		puts = append(puts, spec)
+	}
+
+	if !cs.spec.Prune {
+		return puts, nil, drift, nil
+	}
+
+	for _, name := range rec.Objects {
+		if names[name] {
+			continue
+		}
+		existing, err := cs.store.GetObject(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if existing != nil {
+			deletes = append(deletes, name)
+			drift = append(drift, &Drift{Name: name, Kind: existing.Kind(), Action: actionDelete})
+		}
+	}
+	return puts, deletes, drift, nil
+}
+
+func (cs *ConfigSync) loadRecord() (*record, error) {
+	value, err := cs.cls.Get(cs.cls.Layout().ConfigSyncKey(cs.superSpec.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &record{}
+	if value != nil {
+		if err := codectool.UnmarshalJSON([]byte(*value), rec); err != nil {
+			return nil, fmt.Errorf("unmarshal sync record failed: %v", err)
+		}
+	}
+	return rec, nil
+}
+
+func (cs *ConfigSync) saveRecord(rec *record) error {
+	value := string(codectool.MustMarshalJSON(rec))
+	return cs.cls.Put(cs.cls.Layout().ConfigSyncKey(cs.superSpec.Name()), value)
+}
+
+// Status returns the status of ConfigSync.
+func (cs *ConfigSync) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: cs.status.Load().(*Status)}
+}
+
+// Close closes ConfigSync.
+func (cs *ConfigSync) Close() {
+	close(cs.done)
+	cs.wg.Wait()
+	unregisterInstance(cs)
+	os.RemoveAll(cs.repo.dir)
+}
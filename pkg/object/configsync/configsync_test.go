@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configsync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	_ "github.com/megaease/easegress/pkg/object/accesslog"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const accessLogYAML = `
+kind: AccessLog
+name: %s
+sinks:
+- kind: file
+  file:
+    filename: %s
+`
+
+// gitSource is a Git repository used as the source of ConfigSync.
+type gitSource struct {
+	t   *testing.T
+	dir string
+}
+
+func newGitSource(t *testing.T) *gitSource {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	g := &gitSource{t: t, dir: t.TempDir()}
+	g.git("init", "--quiet")
+	g.git("checkout", "--quiet", "-b", "main")
+	return g
+}
+
+func (g *gitSource) git(args ...string) {
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@test"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		g.t.Fatalf("git %v failed: %v: %s", args, err, out)
+	}
+}
+
+func (g *gitSource) write(name, content string) {
+	p := filepath.Join(g.dir, name)
+	os.MkdirAll(filepath.Dir(p), 0o755)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		g.t.Fatal(err)
+	}
+}
+
+func (g *gitSource) commit() {
+	g.git("add", "-A")
+	g.git("commit", "--quiet", "-m", "update")
+}
+
+func newTestConfigSync(t *testing.T, c cluster.Cluster, url string) *ConfigSync {
+	superSpec, err := supervisor.NewSpec(`
+kind: ConfigSync
+name: gitops
+repository: ` + url + `
+path: objects
+prune: true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	super := supervisor.NewDefaultMock()
+	cs := &ConfigSync{
+		super:     super,
+		superSpec: superSpec,
+		spec:      superSpec.ObjectSpec().(*Spec),
+		cls:       c,
+		store:     api.NewObjectStore(c, super),
+		repo:      &gitRepo{url: url, branch: "main", dir: t.TempDir()},
+	}
+	cs.status.Store(&Status{})
+	return cs
+}
+
+func TestSync(t *testing.T) {
+	assert := assert.New(t)
+
+	src := newGitSource(t)
+	src.write("objects/log.yaml", strings.Replace(strings.Replace(accessLogYAML, "%s", "log", 1), "%s", "/tmp/1.log", 1))
+	src.write("README.md", "not synced")
+	src.commit()
+
+	c, data := clustertest.NewMemoryCluster()
+	cs := newTestConfigSync(t, c, src.dir)
+	status := func() *Status { return cs.Status().ObjectStatus.(*Status) }
+
+	cs.sync()
+	assert.Empty(status().LastError)
+	assert.Len(status().Commit, 40)
+	assert.Equal([]string{"log"}, status().Objects)
+	assert.Equal([]*Drift{{Name: "log", Kind: "AccessLog", Action: actionCreate}}, status().Drift)
+	assert.Contains(data[c.Layout().ConfigObjectKey("log")], "/tmp/1.log")
+	assert.Equal("1", data[c.Layout().ConfigVersion()])
+
+	// nothing changed.
+	cs.sync()
+	assert.Empty(status().Drift)
+	assert.Equal("1", data[c.Layout().ConfigVersion()])
+
+	// update an object and add two objects in one file.
+	commit := status().Commit
+	src.write("objects/log.yaml", strings.Replace(strings.Replace(accessLogYAML, "%s", "log", 1), "%s", "/tmp/2.log", 1))
+	src.write("objects/more/logs.yml",
+		strings.Replace(strings.Replace(accessLogYAML, "%s", "log2", 1), "%s", "/tmp/3.log", 1)+"---\n"+
+			strings.Replace(strings.Replace(accessLogYAML, "%s", "log3", 1), "%s", "/tmp/4.log", 1))
+	src.commit()
+	cs.sync()
+	assert.Empty(status().LastError)
+	assert.NotEqual(commit, status().Commit)
+	assert.Equal([]string{"log", "log2", "log3"}, status().Objects)
+	assert.Len(status().Drift, 3)
+	assert.Contains(data[c.Layout().ConfigObjectKey("log")], "/tmp/2.log")
+	assert.Equal("2", data[c.Layout().ConfigVersion()])
+
+	// the objects removed from the repository are pruned.
+	src.git("rm", "--quiet", "objects/more/logs.yml")
+	src.commit()
+	cs.sync()
+	assert.Equal([]string{"log"}, status().Objects)
+	assert.Equal([]*Drift{
+		{Name: "log2", Kind: "AccessLog", Action: actionDelete},
+		{Name: "log3", Kind: "AccessLog", Action: actionDelete},
+	}, status().Drift)
+	assert.NotContains(data, c.Layout().ConfigObjectKey("log2"))
+
+	// the drift is only reported in dry run mode.
+	data[c.Layout().ConfigObjectKey("log")] = strings.Replace(data[c.Layout().ConfigObjectKey("log")], "/tmp/2.log", "/tmp/x.log", 1)
+	cs.spec.DryRun = true
+	cs.sync()
+	assert.Equal([]*Drift{{Name: "log", Kind: "AccessLog", Action: actionUpdate}}, status().Drift)
+	assert.Contains(data[c.Layout().ConfigObjectKey("log")], "/tmp/x.log")
+
+	cs.spec.DryRun = false
+	cs.sync()
+	assert.Contains(data[c.Layout().ConfigObjectKey("log")], "/tmp/2.log")
+
+	// nothing is applied if any object is invalid.
+	src.write("objects/bad.yaml", "kind: AccessLog\nname: bad\n")
+	src.write("objects/log.yaml", strings.Replace(strings.Replace(accessLogYAML, "%s", "log", 1), "%s", "/tmp/5.log", 1))
+	src.commit()
+	cs.sync()
+	assert.Contains(status().LastError, "objects/bad.yaml")
+	assert.Contains(data[c.Layout().ConfigObjectKey("log")], "/tmp/2.log")
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Path: "a/b"}).Validate())
+	assert.Error((&Spec{Path: "/a"}).Validate())
+	assert.Error((&Spec{Path: "a/../.."}).Validate())
+	assert.Error((&Spec{Interval: "10ms"}).Validate())
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte(`{"ref": "refs/heads/main"}`)
+	assert.True(verifyWebhook("", http.Header{}, body))
+	assert.False(verifyWebhook("secret", http.Header{}, body))
+
+	assert.True(verifyWebhook("secret", http.Header{"X-Gitlab-Token": []string{"secret"}}, body))
+	assert.False(verifyWebhook("secret", http.Header{"X-Gitlab-Token": []string{"wrong"}}, body))
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	assert.True(verifyWebhook("secret", http.Header{"X-Hub-Signature-256": []string{signature}}, body))
+	assert.False(verifyWebhook("secret", http.Header{"X-Hub-Signature-256": []string{signature}}, []byte("{}")))
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRepo is a shallow clone of a branch of a Git repository, it uses the
+// git command, so the credentials configured for git, like SSH keys and
+// credential helpers, are used.
+type gitRepo struct {
+	url    string
+	branch string
+	dir    string
+}
+
+func (r *gitRepo) run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.dir
+	// never prompt for the credentials.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// pull fetches the latest commit of the branch, and returns its hash.
+func (r *gitRepo) pull(ctx context.Context) (string, error) {
+	if _, err := os.Stat(filepath.Join(r.dir, ".git")); os.IsNotExist(err) {
+		if _, err := r.run(ctx, "init", "--quiet"); err != nil {
+			return "", err
+		}
+		if _, err := r.run(ctx, "remote", "add", "origin", r.url); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := r.run(ctx, "fetch", "--quiet", "--depth", "1", "origin", r.branch); err != nil {
+		return "", err
+	}
+	if _, err := r.run(ctx, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return r.run(ctx, "rev-parse", "HEAD")
+}
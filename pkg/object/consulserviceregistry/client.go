@@ -51,12 +51,39 @@ func (c *consulAPIClient) ServiceDeregister(instanceID string) error {
 	return c.client.Agent().ServiceDeregister(instanceID)
 }
 
+// ListServiceInstances lists the instances of the service which pass all
+// their health checks.
 func (c *consulAPIClient) ListServiceInstances(serviceName string) ([]*api.CatalogService, error) {
-	resp, _, err := c.client.Catalog().Service(serviceName, "", &api.QueryOptions{})
+	entries, _, err := c.client.Health().Service(serviceName, "", true, &api.QueryOptions{})
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	return serviceEntriesToCatalogServices(entries), nil
+}
+
+// serviceEntriesToCatalogServices converts the service entries of the
+// health API to the catalog services.
+func serviceEntriesToCatalogServices(entries []*api.ServiceEntry) []*api.CatalogService {
+	services := make([]*api.CatalogService, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Service == nil {
+			continue
+		}
+		service := &api.CatalogService{
+			ServiceID:      entry.Service.ID,
+			ServiceName:    entry.Service.Service,
+			ServiceAddress: entry.Service.Address,
+			ServicePort:    entry.Service.Port,
+			ServiceTags:    entry.Service.Tags,
+			ServiceMeta:    entry.Service.Meta,
+		}
+		if entry.Node != nil {
+			service.Node = entry.Node.Node
+			service.Address = entry.Node.Address
+		}
+		services = append(services, service)
+	}
+	return services
 }
 
 func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, error) {
@@ -67,14 +94,12 @@ func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, erro
 
 	catalogServices := []*api.CatalogService{}
 	for serviceName := range resp {
-		services, _, err := c.client.Catalog().Service(serviceName, "", &api.QueryOptions{})
+		services, err := c.ListServiceInstances(serviceName)
 		if err != nil {
 			return nil, fmt.Errorf("pull catalog service %s failed: %v", serviceName, err)
 		}
 
-		for _, service := range services {
-			catalogServices = append(catalogServices, service)
-		}
+		catalogServices = append(catalogServices, services...)
 	}
 
 	return catalogServices, nil
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consulserviceregistry
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestServiceEntriesToCatalogServices(t *testing.T) {
+	assert := assert.New(t)
+
+	entries := []*api.ServiceEntry{
+		{
+			Node: &api.Node{Node: "node-1", Address: "10.0.0.1"},
+			Service: &api.AgentService{
+				ID:      "service-001-1",
+				Service: "service-001",
+				Port:    8080,
+				Tags:    []string{"v2"},
+				Meta:    map[string]string{MetaKeyRegistryName: "consul"},
+			},
+		},
+		{Node: &api.Node{Node: "node-2"}},
+	}
+
+	services := serviceEntriesToCatalogServices(entries)
+	assert.Len(services, 1)
+	assert.Equal(&api.CatalogService{
+		Node:        "node-1",
+		Address:     "10.0.0.1",
+		ServiceID:   "service-001-1",
+		ServiceName: "service-001",
+		ServicePort: 8080,
+		ServiceTags: []string{"v2"},
+		ServiceMeta: map[string]string{MetaKeyRegistryName: "consul"},
+	}, services[0])
+
+	superSpec, err := supervisor.NewSpec(`
+kind: ConsulServiceRegistry
+name: consul-service-registry
+address: 127.0.0.1:8500
+scheme: http
+syncInterval: 10s
+`)
+	assert.NoError(err)
+	c := &ConsulServiceRegistry{superSpec: superSpec}
+	instance := c.catalogServiceToServiceInstance(services[0])
+	assert.Equal("10.0.0.1", instance.Address)
+	assert.Equal("consul", instance.RegistryName)
+}
@@ -378,9 +378,16 @@ func (e *EurekaServiceRegistry) ListAllServiceInstances() (map[string]*servicere
 	return instances, nil
 }
 
+// instanceInfoToServiceInstances converts the instance info to the service
+// instances of its plain and secure ports, the instances not UP are
+// skipped.
 func (e *EurekaServiceRegistry) instanceInfoToServiceInstances(info *eurekaapi.InstanceInfo) []*serviceregistry.ServiceInstanceSpec {
 	var instances []*serviceregistry.ServiceInstanceSpec
 
+	if info.Status != "" && info.Status != eurekaapi.UP {
+		return nil
+	}
+
 	registryName := e.Name()
 	if info.Metadata != nil && info.Metadata.Map != nil &&
 		info.Metadata.Map[MetaKeyRegistryName] != "" {
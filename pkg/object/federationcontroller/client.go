@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package federationcontroller
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	apiPrefix      = "/apis/v2"
+	requestTimeout = 30 * time.Second
+	maxBodySize    = 16 << 20
+)
+
+// remoteCluster calls the admin APIs of a remote cluster.
+type remoteCluster struct {
+	spec   *ClusterSpec
+	client *http.Client
+}
+
+func newRemoteCluster(spec *ClusterSpec) *remoteCluster {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if spec.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &remoteCluster{
+		spec:   spec,
+		client: &http.Client{Transport: transport, Timeout: requestTimeout},
+	}
+}
+
+// do sends a request to the admin API, and unmarshals the response body to
+// result if it is not nil. It returns http.StatusNotFound as an error for
+// the callers to check.
+func (rc *remoteCluster) do(method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(codectool.MustMarshalJSON(body))
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(rc.spec.Server, "/")+apiPrefix+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case rc.spec.Username != "":
+		req.SetBasicAuth(rc.spec.Username, rc.spec.Password)
+	case rc.spec.Token != "":
+		req.Header.Set("Authorization", "Bearer "+rc.spec.Token)
+	}
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("%s %s: read body failed: %v", method, path, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode >= 300 {
+		apiErr := &api.Err{}
+		if codectool.UnmarshalJSON(data, apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s %s: %d: %s", method, path, resp.StatusCode, apiErr.Message)
+		}
+		return fmt.Errorf("%s %s: %d: %s", method, path, resp.StatusCode, data)
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := codectool.UnmarshalJSON(data, result); err != nil {
+		return fmt.Errorf("%s %s: unmarshal body failed: %v", method, path, err)
+	}
+	return nil
+}
+
+// apply creates or updates the objects in one transaction.
+func (rc *remoteCluster) apply(objects []map[string]interface{}) (*api.ApplyResponse, error) {
+	resp := &api.ApplyResponse{}
+	if err := rc.do(http.MethodPost, api.ApplyPath, objects, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// deleteObject deletes the object, it succeeds if the object doesn't exist.
+func (rc *remoteCluster) deleteObject(name string) error {
+	err := rc.do(http.MethodDelete, api.ObjectPrefix+"/"+url.PathEscape(name), nil, nil)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+// listStatuses returns the statuses of all objects, the keys are in the
+// format of namespace/name/member.
+func (rc *remoteCluster) listStatuses() (map[string]map[string]interface{}, error) {
+	statuses := map[string]map[string]interface{}{}
+	if err := rc.do(http.MethodGet, api.StatusObjectPrefix, nil, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
@@ -0,0 +1,469 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package federationcontroller implements a business controller which
+// replicates objects to remote clusters and aggregates their statuses.
+package federationcontroller
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Category is the category of FederationController.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of FederationController.
+	Kind = "FederationController"
+)
+
+var errNotFound = errors.New("not found")
+
+func init() {
+	supervisor.Register(&FederationController{})
+}
+
+type (
+	// FederationController is a business controller which replicates the
+	// selected objects of this cluster to remote clusters by their admin
+	// APIs, and aggregates the statuses of the objects in remote clusters.
+	// Only the leader replicates the objects, on an interval.
+	FederationController struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		cls      cluster.Cluster
+		store    *api.ObjectStore
+		remotes  []*remoteCluster
+		interval time.Duration
+
+		status atomic.Value
+		done   chan struct{}
+		wg     sync.WaitGroup
+	}
+
+	// Spec describes FederationController.
+	Spec struct {
+		Interval string `json:"interval" jsonschema:"omitempty,format=duration"`
+		// Objects and Kinds select the objects to replicate, an object is
+		// selected if its name is in Objects or its kind is in Kinds.
+		Objects []string `json:"objects" jsonschema:"omitempty,uniqueItems=true"`
+		Kinds   []string `json:"kinds" jsonschema:"omitempty,uniqueItems=true"`
+		// Prune deletes the objects replicated before but not selected
+		// any more from the remote clusters.
+		Prune    bool           `json:"prune" jsonschema:"omitempty"`
+		Clusters []*ClusterSpec `json:"clusters" jsonschema:"required,minItems=1"`
+	}
+
+	// ClusterSpec describes a remote cluster.
+	ClusterSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Server is the URL of the admin API of the remote cluster, e.g.
+		// http://10.0.0.1:2381.
+		Server             string `json:"server" jsonschema:"required,format=uri"`
+		Token              string `json:"token" jsonschema:"omitempty"`
+		Username           string `json:"username" jsonschema:"omitempty"`
+		Password           string `json:"password" jsonschema:"omitempty"`
+		InsecureSkipVerify bool   `json:"insecureSkipVerify" jsonschema:"omitempty"`
+		// Overrides are the JSON merge patches (RFC 7386) of the objects
+		// for this cluster, the key is the object name.
+		Overrides map[string]map[string]interface{} `json:"overrides" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of FederationController.
+	Status struct {
+		LastSyncTime string `json:"lastSyncTime,omitempty"`
+		// Objects are the objects replicated by the last sync.
+		Objects  []string         `json:"objects,omitempty"`
+		Clusters []*ClusterStatus `json:"clusters,omitempty"`
+		// LastError is the error of the last sync which is not specific to
+		// a cluster.
+		LastError string `json:"lastError,omitempty"`
+	}
+
+	// ClusterStatus is the status of a remote cluster.
+	ClusterStatus struct {
+		Name string `json:"name"`
+		// Version is the config version of the remote cluster of the last
+		// change made by the sync.
+		Version int64 `json:"version,omitempty"`
+		// Statuses are the statuses of the objects in the remote cluster,
+		// indexed by the object names and then the member names.
+		Statuses  map[string]map[string]interface{} `json:"statuses,omitempty"`
+		LastError string                            `json:"lastError,omitempty"`
+	}
+
+	// record is the record of the objects replicated to the clusters, so
+	// that they could be pruned after the leader changes.
+	record struct {
+		Objects map[string][]string `json:"objects"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Interval != "" {
+		d, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s: %v", spec.Interval, err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("interval must be at least 1s")
+		}
+	}
+	if len(spec.Objects) == 0 && len(spec.Kinds) == 0 {
+		return fmt.Errorf("neither objects nor kinds is specified")
+	}
+
+	names := map[string]bool{}
+	for _, c := range spec.Clusters {
+		if names[c.Name] {
+			return fmt.Errorf("duplicated cluster %s", c.Name)
+		}
+		names[c.Name] = true
+
+		u, err := url.Parse(c.Server)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("cluster %s: invalid server %s", c.Name, c.Server)
+		}
+		for name, patch := range c.Overrides {
+			for _, field := range []string{"name", "kind"} {
+				if _, ok := patch[field]; ok {
+					return fmt.Errorf("cluster %s: can't override the %s of object %s", c.Name, field, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Category returns the category of FederationController.
+func (fc *FederationController) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of FederationController.
+func (fc *FederationController) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of FederationController.
+func (fc *FederationController) DefaultSpec() interface{} {
+	return &Spec{Interval: "30s"}
+}
+
+// Init initializes FederationController.
+func (fc *FederationController) Init(superSpec *supervisor.Spec) {
+	fc.superSpec, fc.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	fc.super = superSpec.Super()
+	fc.cls = fc.super.Cluster()
+	fc.store = api.NewObjectStore(fc.cls, fc.super)
+	fc.reload()
+}
+
+// Inherit inherits previous generation of FederationController.
+func (fc *FederationController) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	fc.Init(superSpec)
+}
+
+func (fc *FederationController) reload() {
+	fc.interval, _ = time.ParseDuration(fc.spec.Interval)
+	if fc.interval <= 0 {
+		fc.interval = 30 * time.Second
+	}
+
+	fc.remotes = nil
+	for _, c := range fc.spec.Clusters {
+		fc.remotes = append(fc.remotes, newRemoteCluster(c))
+	}
+
+	fc.status.Store(&Status{})
+	fc.done = make(chan struct{})
+
+	fc.wg.Add(1)
+	go fc.run()
+}
+
+func (fc *FederationController) run() {
+	defer fc.wg.Done()
+
+	ticker := time.NewTicker(fc.interval)
+	defer ticker.Stop()
+
+	for {
+		// only the leader replicates the objects.
+		if fc.cls.IsLeader() {
+			fc.sync()
+		}
+
+		select {
+		case <-fc.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync replicates the selected objects to all remote clusters, the
+// clusters are synced one by one, and the failure of a cluster doesn't
+// stop the others.
+func (fc *FederationController) sync() {
+	status := &Status{LastSyncTime: time.Now().Format(time.RFC3339)}
+	defer fc.status.Store(status)
+
+	specs, err := fc.selectObjects()
+	if err != nil {
+		logger.Errorf("%s: select objects failed: %v", fc.superSpec.Name(), err)
+		status.LastError = err.Error()
+		return
+	}
+	for _, spec := range specs {
+		status.Objects = append(status.Objects, spec.Name())
+	}
+
+	rec, err := fc.loadRecord()
+	if err != nil {
+		logger.Errorf("%s: load record failed: %v", fc.superSpec.Name(), err)
+		status.LastError = err.Error()
+		return
+	}
+
+	prev := map[string]*ClusterStatus{}
+	for _, cs := range fc.status.Load().(*Status).Clusters {
+		prev[cs.Name] = cs
+	}
+
+	for _, rc := range fc.remotes {
+		cs := &ClusterStatus{Name: rc.spec.Name}
+		if p := prev[cs.Name]; p != nil {
+			cs.Version = p.Version
+		}
+		status.Clusters = append(status.Clusters, cs)
+
+		err := fc.syncCluster(rc, specs, rec, cs)
+		if err != nil {
+			logger.Errorf("%s: sync cluster %s failed: %v", fc.superSpec.Name(), cs.Name, err)
+			cs.LastError = err.Error()
+		}
+	}
+
+	if err := fc.saveRecord(rec); err != nil {
+		logger.Errorf("%s: save record failed: %v", fc.superSpec.Name(), err)
+		status.LastError = err.Error()
+	}
+}
+
+// selectObjects returns the selected objects sorted by names.
+func (fc *FederationController) selectObjects() ([]*supervisor.Spec, error) {
+	all, err := fc.store.ListObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []*supervisor.Spec
+	for _, spec := range all {
+		if spec.Name() == fc.superSpec.Name() {
+			continue
+		}
+		if contains(fc.spec.Objects, spec.Name()) || contains(fc.spec.Kinds, spec.Kind()) {
+			specs = append(specs, spec)
+		}
+	}
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name() < specs[j].Name() })
+	return specs, nil
+}
+
+// syncCluster applies the objects to the cluster, prunes the objects not
+// selected any more, and collects the statuses of the objects. The record
+// is updated for the cluster.
+func (fc *FederationController) syncCluster(rc *remoteCluster, specs []*supervisor.Spec, rec *record, cs *ClusterStatus) error {
+	objects, err := overrideObjects(specs, rc.spec.Overrides)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Name())
+	}
+
+	if len(objects) > 0 {
+		resp, err := rc.apply(objects)
+		if err != nil {
+			return err
+		}
+		if resp.Version != 0 {
+			cs.Version = resp.Version
+			logger.Infof("%s: replicated objects to cluster %s, config version %d",
+				fc.superSpec.Name(), cs.Name, resp.Version)
+		}
+	}
+
+	// the objects which failed to be pruned are kept in the record, so
+	// that they are pruned by the next sync.
+	replicated := names
+	if fc.spec.Prune {
+		var errs []string
+		for _, name := range rec.Objects[cs.Name] {
+			if contains(names, name) {
+				continue
+			}
+			if err := rc.deleteObject(name); err != nil {
+				errs = append(errs, fmt.Sprintf("delete %s: %v", name, err))
+				replicated = append(replicated, name)
+			}
+		}
+		if len(errs) > 0 {
+			rec.Objects[cs.Name] = replicated
+			return fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+	} else {
+		for _, name := range rec.Objects[cs.Name] {
+			if !contains(replicated, name) {
+				replicated = append(replicated, name)
+			}
+		}
+	}
+	sort.Strings(replicated)
+	rec.Objects[cs.Name] = replicated
+
+	statuses, err := rc.listStatuses()
+	if err != nil {
+		return err
+	}
+	cs.Statuses = filterStatuses(statuses, names)
+	return nil
+}
+
+// overrideObjects converts the specs to objects, and applies the overrides
+// to them.
+func overrideObjects(specs []*supervisor.Spec, overrides map[string]map[string]interface{}) ([]map[string]interface{}, error) {
+	objects := make([]map[string]interface{}, 0, len(specs))
+	for _, spec := range specs {
+		obj := map[string]interface{}{}
+		if err := codectool.UnmarshalJSON([]byte(spec.JSONConfig()), &obj); err != nil {
+			return nil, fmt.Errorf("unmarshal %s failed: %v", spec.Name(), err)
+		}
+		if patch, ok := overrides[spec.Name()]; ok {
+			obj = mergePatch(obj, patch).(map[string]interface{})
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// mergePatch applies the JSON merge patch (RFC 7386) to the target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	result := make(map[string]interface{}, len(t))
+	for k, v := range t {
+		result[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = mergePatch(result[k], v)
+		}
+	}
+	return result
+}
+
+// filterStatuses returns the statuses of the objects indexed by the object
+// names and then the member names, the keys of the statuses are in the
+// format of namespace/name/member.
+func filterStatuses(statuses map[string]map[string]interface{}, names []string) map[string]map[string]interface{} {
+	result := map[string]map[string]interface{}{}
+	for key, status := range statuses {
+		parts := strings.SplitN(key, "/", 3)
+		if len(parts) != 3 || !contains(names, parts[1]) {
+			continue
+		}
+		if result[parts[1]] == nil {
+			result[parts[1]] = map[string]interface{}{}
+		}
+		result[parts[1]][parts[2]] = status
+	}
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (fc *FederationController) loadRecord() (*record, error) {
+	value, err := fc.cls.Get(fc.cls.Layout().FederationKey(fc.superSpec.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &record{}
+	if value != nil {
+		if err := codectool.UnmarshalJSON([]byte(*value), rec); err != nil {
+			return nil, fmt.Errorf("unmarshal federation record failed: %v", err)
+		}
+	}
+	if rec.Objects == nil {
+		rec.Objects = map[string][]string{}
+	}
+	return rec, nil
+}
+
+func (fc *FederationController) saveRecord(rec *record) error {
+	value := string(codectool.MustMarshalJSON(rec))
+	return fc.cls.Put(fc.cls.Layout().FederationKey(fc.superSpec.Name()), value)
+}
+
+// Status returns the status of FederationController.
+func (fc *FederationController) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: fc.status.Load().(*Status)}
+}
+
+// Close closes FederationController.
+func (fc *FederationController) Close() {
+	close(fc.done)
+	fc.wg.Wait()
+}
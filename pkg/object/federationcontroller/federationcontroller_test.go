@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package federationcontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/logger"
+	_ "github.com/megaease/easegress/pkg/object/accesslog"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+// fakeRemote fakes the admin APIs of a remote cluster.
+type fakeRemote struct {
+	*httptest.Server
+	mu      sync.Mutex
+	token   string
+	version int64
+	objects map[string]map[string]interface{}
+}
+
+func newFakeRemote(token string) *fakeRemote {
+	fr := &fakeRemote{token: token, objects: map[string]map[string]interface{}{}}
+	fr.Server = httptest.NewServer(http.HandlerFunc(fr.serve))
+	return fr
+}
+
+func (fr *fakeRemote) serve(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+fr.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(&api.Err{Code: http.StatusUnauthorized, Message: "unauthorized"})
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	switch {
+	case r.Method == http.MethodPost && path == api.ApplyPath:
+		var objects []map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&objects)
+		fr.version++
+		resp := &api.ApplyResponse{Version: fr.version}
+		for _, obj := range objects {
+			fr.objects[obj["name"].(string)] = obj
+		}
+		json.NewEncoder(w).Encode(resp)
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(path, api.ObjectPrefix+"/"):
+		name := strings.TrimPrefix(path, api.ObjectPrefix+"/")
+		if _, ok := fr.objects[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fr.version++
+		delete(fr.objects, name)
+
+	case r.Method == http.MethodGet && path == api.StatusObjectPrefix:
+		statuses := map[string]interface{}{}
+		for name := range fr.objects {
+			statuses[fmt.Sprintf("default/%s/eg-1", name)] = map[string]interface{}{"health": "ok"}
+		}
+		statuses["default/other/eg-1"] = map[string]interface{}{}
+		json.NewEncoder(w).Encode(statuses)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (fr *fakeRemote) object(name string) map[string]interface{} {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return fr.objects[name]
+}
+
+const accessLogYAML = `
+kind: AccessLog
+name: %s
+sinks:
+- kind: file
+  file:
+    filename: /tmp/%s.log
+`
+
+func newTestFederationController(t *testing.T, c cluster.Cluster, yamlConfig string) *FederationController {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	super := supervisor.NewDefaultMock()
+	fc := &FederationController{
+		super:     super,
+		superSpec: superSpec,
+		spec:      superSpec.ObjectSpec().(*Spec),
+		cls:       c,
+		store:     api.NewObjectStore(c, super),
+	}
+	for _, cs := range fc.spec.Clusters {
+		fc.remotes = append(fc.remotes, newRemoteCluster(cs))
+	}
+	fc.status.Store(&Status{})
+	return fc
+}
+
+func applyAccessLogs(t *testing.T, store *api.ObjectStore, names ...string) {
+	var specs []*supervisor.Spec
+	for _, name := range names {
+		spec, err := supervisor.NewSpec(fmt.Sprintf(accessLogYAML, name, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		specs = append(specs, spec)
+	}
+	if _, err := store.Apply(specs, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	assert := assert.New(t)
+
+	east, west := newFakeRemote("east"), newFakeRemote("west")
+	defer east.Close()
+	defer west.Close()
+
+	c, data := clustertest.NewMemoryCluster()
+	fc := newTestFederationController(t, c, `
+kind: FederationController
+name: federation
+kinds: [AccessLog]
+prune: true
+clusters:
+- name: east
+  server: `+east.URL+`
+  token: east
+- name: west
+  server: `+west.URL+`
+  token: west
+  overrides:
+    log1:
+      sinks: [{kind: file, file: {filename: /tmp/west.log}}]
+`)
+	status := func() *Status { return fc.Status().ObjectStatus.(*Status) }
+
+	applyAccessLogs(t, fc.store, "log1", "log2")
+	fc.sync()
+	assert.Empty(status().LastError)
+	assert.Equal([]string{"log1", "log2"}, status().Objects)
+	assert.Len(status().Clusters, 2)
+	for _, cs := range status().Clusters {
+		assert.Empty(cs.LastError)
+		assert.Equal(int64(1), cs.Version)
+		assert.Len(cs.Statuses, 2)
+		assert.Equal(map[string]interface{}{"health": "ok"}, cs.Statuses["log1"]["eg-1"])
+	}
+	assert.Contains(fmt.Sprint(east.object("log1")), "/tmp/log1.log")
+	assert.Contains(fmt.Sprint(west.object("log1")), "/tmp/west.log")
+	assert.Contains(fmt.Sprint(west.object("log2")), "/tmp/log2.log")
+	assert.Contains(data[c.Layout().FederationKey("federation")], "log2")
+
+	// the objects not selected any more are pruned.
+	if _, err := fc.store.Apply(nil, []string{"log2"}); err != nil {
+		t.Fatal(err)
+	}
+	fc.sync()
+	assert.Equal([]string{"log1"}, status().Objects)
+	assert.Nil(east.object("log2"))
+	assert.Nil(west.object("log2"))
+	assert.NotContains(data[c.Layout().FederationKey("federation")], "log2")
+
+	// the failure of a cluster doesn't stop the others.
+	fc.remotes[0].spec.Token = "wrong"
+	applyAccessLogs(t, fc.store, "log3")
+	fc.sync()
+	assert.Contains(status().Clusters[0].LastError, "unauthorized")
+	assert.Empty(status().Clusters[1].LastError)
+	assert.Nil(east.object("log3"))
+	assert.NotNil(west.object("log3"))
+}
+
+func TestMergePatch(t *testing.T) {
+	assert := assert.New(t)
+
+	target := map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": "e", "f": "g"},
+	}
+	patch := map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"f": nil},
+		"h": []interface{}{"i"},
+	}
+	assert.Equal(map[string]interface{}{
+		"a": "z",
+		"c": map[string]interface{}{"d": "e"},
+		"h": []interface{}{"i"},
+	}, mergePatch(target, patch))
+	// the target is not modified.
+	assert.Equal("g", target["c"].(map[string]interface{})["f"])
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	cluster := func(name, server string) *ClusterSpec {
+		return &ClusterSpec{Name: name, Server: server}
+	}
+
+	assert.NoError((&Spec{Kinds: []string{"HTTPServer"}, Clusters: []*ClusterSpec{cluster("a", "http://a:2381")}}).Validate())
+	assert.Error((&Spec{Clusters: []*ClusterSpec{cluster("a", "http://a:2381")}}).Validate())
+	assert.Error((&Spec{Objects: []string{"a"}, Interval: "10ms"}).Validate())
+	assert.Error((&Spec{Objects: []string{"a"}, Clusters: []*ClusterSpec{cluster("a", "a:2381")}}).Validate())
+	assert.Error((&Spec{Objects: []string{"a"}, Clusters: []*ClusterSpec{
+		cluster("a", "http://a:2381"), cluster("a", "http://b:2381"),
+	}}).Validate())
+
+	c := cluster("a", "http://a:2381")
+	c.Overrides = map[string]map[string]interface{}{"obj": {"name": "other"}}
+	assert.Error((&Spec{Objects: []string{"obj"}, Clusters: []*ClusterSpec{c}}).Validate())
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package filtertemplate implements the FilterTemplate, which defines a
+// chain of filters once to be referenced by many pipelines.
+package filtertemplate
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Category is the category of FilterTemplate.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of FilterTemplate.
+	Kind = "FilterTemplate"
+)
+
+type (
+	// FilterTemplate is a business controller.
+	// It provides a chain of filters for the pipelines referencing it,
+	// every pipeline has its own filter instances with its overrides.
+	FilterTemplate struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		// instances maps the name of a pipeline to its instance, it is
+		// read without lock, and updated with mutex held.
+		instances sync.Map
+		mutex     sync.Mutex
+		closed    bool
+	}
+
+	// Spec describes the FilterTemplate, the flow and filters are defined
+	// in the same way as those of a pipeline.
+	Spec struct {
+		pipeline.Spec `json:",inline"`
+	}
+
+	// Status is the status of FilterTemplate.
+	Status struct {
+		// Pipelines are the names of the pipelines using the template.
+		Pipelines []string `json:"pipelines"`
+	}
+
+	// instance is the instance of the template for a pipeline.
+	instance struct {
+		key       string
+		overrides map[string]map[string]interface{}
+		pipeline  *pipeline.Pipeline
+	}
+
+	// pipelineSpec defines pipeline spec to create an pipeline entity.
+	pipelineSpec struct {
+		Kind           string `json:"kind" jsonschema:"omitempty"`
+		Name           string `json:"name" jsonschema:"omitempty"`
+		*pipeline.Spec `json:",inline"`
+	}
+)
+
+func init() {
+	supervisor.Register(&FilterTemplate{})
+}
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if len(s.Templates) > 0 {
+		return fmt.Errorf("templates can't be nested")
+	}
+	return s.Spec.Validate()
+}
+
+// Category returns the object category of itself.
+func (ft *FilterTemplate) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the unique kind name to represent itself.
+func (ft *FilterTemplate) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec.
+// It must return a pointer to point a struct.
+func (ft *FilterTemplate) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Status returns its runtime status.
+func (ft *FilterTemplate) Status() *supervisor.Status {
+	s := &Status{Pipelines: []string{}}
+	ft.instances.Range(func(k, v interface{}) bool {
+		s.Pipelines = append(s.Pipelines, k.(string))
+		return true
+	})
+	sort.Strings(s.Pipelines)
+
+	return &supervisor.Status{
+		ObjectStatus: s,
+	}
+}
+
+// Init initializes FilterTemplate.
+func (ft *FilterTemplate) Init(superSpec *supervisor.Spec) {
+	ft.superSpec, ft.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+}
+
+// Inherit inherits previous generation of FilterTemplate, the instances of
+// the previous generation are rebuilt with the new spec.
+func (ft *FilterTemplate) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	ft.superSpec, ft.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+
+	prev := previousGeneration.(*FilterTemplate)
+	prev.mutex.Lock()
+	defer prev.mutex.Unlock()
+
+	prev.closed = true
+	prev.instances.Range(func(k, v interface{}) bool {
+		owner, inst := k.(string), v.(*instance)
+		p, err := ft.createPipeline(owner, inst.overrides, inst.pipeline)
+		if err != nil {
+			logger.Errorf("%s: rebuild for pipeline %s failed: %v", ft.superSpec.Name(), owner, err)
+			inst.pipeline.Close()
+		} else {
+			ft.instances.Store(owner, &instance{key: inst.key, overrides: inst.overrides, pipeline: p})
+		}
+		prev.instances.Delete(owner)
+		return true
+	})
+}
+
+// GetPipeline returns the pipeline running the filters of the template for
+// the pipeline named owner, the pipeline is created on the first call and
+// rebuilt when the overrides change.
+func (ft *FilterTemplate) GetPipeline(owner string, ref *pipeline.TemplateRef) (*pipeline.Pipeline, error) {
+	key := ref.Key()
+	if v, ok := ft.instances.Load(owner); ok && v.(*instance).key == key {
+		return v.(*instance).pipeline, nil
+	}
+
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	if ft.closed {
+		return nil, fmt.Errorf("template %s is closed", ft.superSpec.Name())
+	}
+
+	var prev *pipeline.Pipeline
+	if v, ok := ft.instances.Load(owner); ok {
+		inst := v.(*instance)
+		if inst.key == key {
+			return inst.pipeline, nil
+		}
+		prev = inst.pipeline
+	}
+
+	p, err := ft.createPipeline(owner, ref.Overrides, prev)
+	if err != nil {
+		return nil, err
+	}
+	ft.instances.Store(owner, &instance{key: key, overrides: ref.Overrides, pipeline: p})
+	return p, nil
+}
+
+// createPipeline creates a pipeline from the template with the overrides,
+// the top level fields of the filters are replaced by the overrides.
+func (ft *FilterTemplate) createPipeline(owner string, overrides map[string]map[string]interface{}, previousGeneration *pipeline.Pipeline) (*pipeline.Pipeline, error) {
+	spec := ft.spec.Spec
+	spec.Filters = make([]map[string]interface{}, 0, len(ft.spec.Filters))
+
+	used := 0
+	for _, f := range ft.spec.Filters {
+		filter := make(map[string]interface{}, len(f))
+		for k, v := range f {
+			filter[k] = v
+		}
+		name, _ := f["name"].(string)
+		if fields, ok := overrides[name]; ok {
+			used++
+			for k, v := range fields {
+				filter[k] = v
+			}
+		}
+		spec.Filters = append(spec.Filters, filter)
+	}
+	if used != len(overrides) {
+		return nil, fmt.Errorf("overrides contain filters not in template %s", ft.superSpec.Name())
+	}
+
+	jsonSpec := codectool.MustMarshalJSON(&pipelineSpec{
+		Kind: pipeline.Kind,
+		Name: owner + "-" + ft.superSpec.Name(),
+		Spec: &spec,
+	})
+
+	var fullSpec *supervisor.Spec
+	var err error
+	if super := ft.superSpec.Super(); super != nil {
+		fullSpec, err = super.NewSpec(string(jsonSpec))
+	} else {
+		fullSpec, err = supervisor.NewSpec(string(jsonSpec))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// init or update pipeline
+	p := &pipeline.Pipeline{}
+	if previousGeneration != nil {
+		p.Inherit(fullSpec, previousGeneration, nil)
+	} else {
+		p.Init(fullSpec, nil)
+	}
+
+	return p, nil
+}
+
+// Close closes FilterTemplate itself.
+func (ft *FilterTemplate) Close() {
+	ft.mutex.Lock()
+	defer ft.mutex.Unlock()
+
+	ft.closed = true
+	ft.instances.Range(func(k, v interface{}) bool {
+		v.(*instance).pipeline.Close()
+		ft.instances.Delete(k)
+		return true
+	})
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filtertemplate
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	_ "github.com/megaease/easegress/pkg/filters/mock"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const templateYAML = `
+name: auth-chain
+kind: FilterTemplate
+flow:
+- filter: mock
+  jumpIf: {mocked: END}
+filters:
+- name: mock
+  kind: Mock
+  rules:
+  - match:
+      pathPrefix: /
+    code: %d
+`
+
+func newTemplateSpec(assert *assert.Assertions, code int) *supervisor.Spec {
+	spec, err := supervisor.NewSpec(fmt.Sprintf(templateYAML, code))
+	assert.NoError(err)
+	return spec
+}
+
+func handle(assert *assert.Assertions, p *pipeline.Pipeline) int {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+	assert.Equal("mocked", p.Handle(ctx))
+	return ctx.GetOutputResponse().(*httpprot.Response).StatusCode()
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := supervisor.NewSpec(`
+name: auth-chain
+kind: FilterTemplate
+templates:
+- name: other
+filters:
+- name: mock
+  kind: Mock
+`)
+	assert.Error(err)
+
+	_, err = supervisor.NewSpec(`
+name: pipeline
+kind: Pipeline
+templates:
+- name: auth-chain
+  overrides:
+    mock:
+      kind: Proxy
+filters:
+- name: mock
+  kind: Mock
+`)
+	assert.Error(err)
+}
+
+func TestGetPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	ft := &FilterTemplate{}
+	ft.Init(newTemplateSpec(assert, 200))
+
+	p1, err := ft.GetPipeline("p1", &pipeline.TemplateRef{Name: "auth-chain"})
+	assert.NoError(err)
+	assert.Equal(200, handle(assert, p1))
+
+	// the same instance is returned for the same overrides.
+	p, err := ft.GetPipeline("p1", &pipeline.TemplateRef{Name: "auth-chain"})
+	assert.NoError(err)
+	assert.Same(p1, p)
+
+	ref := &pipeline.TemplateRef{
+		Name: "auth-chain",
+		Overrides: map[string]map[string]interface{}{
+			"mock": {"rules": []interface{}{map[string]interface{}{
+				"match": map[string]interface{}{"pathPrefix": "/"},
+				"code":  403,
+			}}},
+		},
+	}
+	p2, err := ft.GetPipeline("p2", ref)
+	assert.NoError(err)
+	assert.Equal(403, handle(assert, p2))
+	assert.Equal(200, handle(assert, p1))
+
+	_, err = ft.GetPipeline("p3", &pipeline.TemplateRef{
+		Name:      "auth-chain",
+		Overrides: map[string]map[string]interface{}{"none": {"foo": "bar"}},
+	})
+	assert.Error(err)
+
+	assert.Equal([]string{"p1", "p2"}, ft.Status().ObjectStatus.(*Status).Pipelines)
+
+	// the instances are rebuilt with the new spec, the overrides are kept.
+	ft2 := &FilterTemplate{}
+	ft2.Inherit(newTemplateSpec(assert, 201), ft)
+	assert.Empty(ft.Status().ObjectStatus.(*Status).Pipelines)
+	_, err = ft.GetPipeline("p1", &pipeline.TemplateRef{Name: "auth-chain"})
+	assert.Error(err)
+
+	p1, err = ft2.GetPipeline("p1", &pipeline.TemplateRef{Name: "auth-chain"})
+	assert.NoError(err)
+	assert.Equal(201, handle(assert, p1))
+	p2, err = ft2.GetPipeline("p2", ref)
+	assert.NoError(err)
+	assert.Equal(403, handle(assert, p2))
+
+	ft2.Close()
+	assert.Empty(ft2.Status().ObjectStatus.(*Status).Pipelines)
+}
@@ -63,20 +63,13 @@ func (f *FaasController) DefaultSpec() interface{} {
 	return &spec.Admin{
 		SyncInterval: "10s",
 		Provider:     spec.ProviderKnative,
-		Knative: &spec.Knative{
-			Namespace: "default",
-			Timeout:   "2s",
-		},
 	}
 }
 
 // Validate validates the spec
 func (f *FaasController) Validate() error {
-	switch f.spec.Provider {
-	case spec.ProviderKnative:
-		//
-	default:
-		return fmt.Errorf("unknown FaaS provider: %s", f.spec.Provider)
+	if err := f.spec.Validate(); err != nil {
+		return err
 	}
 
 	vr := v.Validate(f.spec.HTTPServer)
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package provider
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type (
+	// openFaaSClient is client for communicating with the gateway of
+	// OpenFaaS.
+	openFaaSClient struct {
+		superSpec *supervisor.Spec
+		client    *restClient
+		namespace string
+	}
+
+	// openFaaSDeployment is the function deployment of OpenFaaS.
+	openFaaSDeployment struct {
+		Service   string             `json:"service"`
+		Image     string             `json:"image"`
+		Namespace string             `json:"namespace,omitempty"`
+		Labels    map[string]string  `json:"labels,omitempty"`
+		Limits    *openFaaSResources `json:"limits,omitempty"`
+		Requests  *openFaaSResources `json:"requests,omitempty"`
+	}
+
+	openFaaSResources struct {
+		Memory string `json:"memory,omitempty"`
+		CPU    string `json:"cpu,omitempty"`
+	}
+
+	openFaaSDeleteRequest struct {
+		FunctionName string `json:"functionName"`
+		Namespace    string `json:"namespace,omitempty"`
+	}
+
+	openFaaSFunctionStatus struct {
+		Name              string `json:"name"`
+		Image             string `json:"image"`
+		Replicas          uint64 `json:"replicas"`
+		AvailableReplicas uint64 `json:"availableReplicas"`
+	}
+)
+
+func newOpenFaaSClient(superSpec *supervisor.Spec) *openFaaSClient {
+	spec := superSpec.ObjectSpec().(*spec.Admin)
+	return &openFaaSClient{
+		superSpec: superSpec,
+		namespace: spec.OpenFaaS.Namespace,
+	}
+}
+
+// Init initializes OpenFaaS client.
+func (oc *openFaaSClient) Init() error {
+	spec := oc.superSpec.ObjectSpec().(*spec.Admin).OpenFaaS
+
+	timeout := defaultTimeout
+	if spec.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse openfaas timeout interval: %s failed: %v",
+				spec.Timeout, err)
+			return err
+		}
+	}
+
+	oc.client = newRESTClient(spec.GatewayURL, timeout)
+	oc.client.username = spec.Username
+	oc.client.password = spec.Password
+	return nil
+}
+
+// openFaaSLabels returns the scaling labels of the function.
+func openFaaSLabels(funcSpec *spec.Spec) map[string]string {
+	labels := map[string]string{}
+	switch funcSpec.AutoScaleType {
+	case spec.AutoScaleMetricCPU:
+		labels["com.openfaas.scale.type"] = "cpu"
+	case spec.AutoScaleMetricConcurrency:
+		labels["com.openfaas.scale.type"] = "capacity"
+	default:
+		labels["com.openfaas.scale.type"] = "rps"
+	}
+	labels["com.openfaas.scale.target"] = funcSpec.AutoScaleValue
+	if funcSpec.MinReplica != 0 {
+		labels["com.openfaas.scale.min"] = strconv.Itoa(funcSpec.MinReplica)
+	}
+	if funcSpec.MaxReplica != 0 {
+		labels["com.openfaas.scale.max"] = strconv.Itoa(funcSpec.MaxReplica)
+	}
+	return labels
+}
+
+func (oc *openFaaSClient) deployment(funcSpec *spec.Spec) *openFaaSDeployment {
+	d := &openFaaSDeployment{
+		Service:   funcSpec.Name,
+		Image:     funcSpec.Image,
+		Namespace: oc.namespace,
+		Labels:    openFaaSLabels(funcSpec),
+	}
+	if funcSpec.LimitMemory != "" || funcSpec.LimitCPU != "" {
+		d.Limits = &openFaaSResources{Memory: funcSpec.LimitMemory, CPU: funcSpec.LimitCPU}
+	}
+	if funcSpec.RequestMemory != "" || funcSpec.RequestCPU != "" {
+		d.Requests = &openFaaSResources{Memory: funcSpec.RequestMemory, CPU: funcSpec.RequestCPU}
+	}
+	return d
+}
+
+// Create deploys the function to OpenFaaS.
+func (oc *openFaaSClient) Create(funcSpec *spec.Spec) error {
+	_, err := oc.client.do(http.MethodPost, "/system/functions", oc.deployment(funcSpec), nil)
+	if err != nil {
+		logger.Errorf("create openfaas function: %s failed: %v", funcSpec.Name, err)
+	}
+	return err
+}
+
+// Update updates the function deployed to OpenFaaS.
+func (oc *openFaaSClient) Update(funcSpec *spec.Spec) error {
+	_, err := oc.client.do(http.MethodPut, "/system/functions", oc.deployment(funcSpec), nil)
+	if err != nil {
+		logger.Errorf("update openfaas function: %s failed: %v", funcSpec.Name, err)
+	}
+	return err
+}
+
+// Delete removes the function from OpenFaaS.
+func (oc *openFaaSClient) Delete(name string) error {
+	req := &openFaaSDeleteRequest{FunctionName: name, Namespace: oc.namespace}
+	_, err := oc.client.do(http.MethodDelete, "/system/functions", req, nil)
+	if err != nil {
+		logger.Errorf("delete openfaas function: %s failed: %v", name, err)
+	}
+	return err
+}
+
+// GetStatus returns the status of the function, it is ready once one of
+// its replicas is available.
+func (oc *openFaaSClient) GetStatus(name string) (*spec.Status, error) {
+	path := "/system/function/" + url.PathEscape(name)
+	if oc.namespace != "" {
+		path += "?namespace=" + url.QueryEscape(oc.namespace)
+	}
+
+	fs := &openFaaSFunctionStatus{}
+	_, err := oc.client.do(http.MethodGet, path, nil, fs)
+	if err != nil {
+		logger.Errorf("openfaas get function: %s, err: %v", name, err)
+		return nil, err
+	}
+
+	status := &spec.Status{
+		ExtData: map[string]string{
+			"replicas":          strconv.FormatUint(fs.Replicas, 10),
+			"availableReplicas": strconv.FormatUint(fs.AvailableReplicas, 10),
+		},
+	}
+	if fs.AvailableReplicas > 0 {
+		status.Event = spec.ReadyEvent
+	} else {
+		status.Event = spec.PendingEvent
+	}
+	return status, nil
+}
+
+// Route returns the route of the function, the requests are sent to the
+// gateway of OpenFaaS with the path prefix of the function.
+func (oc *openFaaSClient) Route(name string) *Route {
+	spec := oc.superSpec.ObjectSpec().(*spec.Admin)
+	prefix := "/function/" + name
+	if oc.namespace != "" {
+		prefix += "." + oc.namespace
+	}
+	return &Route{
+		URL:        spec.OpenFaaS.GatewayURL,
+		PathPrefix: prefix,
+	}
+}
@@ -36,6 +36,11 @@ import (
 	"github.com/megaease/easegress/pkg/supervisor"
 )
 
+const (
+	defaultNamespace = "default"
+	defaultTimeout   = 2 * time.Second
+)
+
 type (
 	// FaaSProvider is the physical serverless function instance manager
 	FaaSProvider interface {
@@ -44,6 +49,19 @@ type (
 		Create(funcSpec *spec.Spec) error
 		Delete(name string) error
 		Update(funcSpec *spec.Spec) error
+		// Route returns how the requests are routed to the function.
+		Route(name string) *Route
+	}
+
+	// Route describes how the requests are routed to a function.
+	Route struct {
+		// URL is the URL of the server to send the requests to.
+		URL string
+		// Host is the Host header of the requests if it is not empty.
+		Host string
+		// PathPrefix is added to the path of the requests if it is not
+		// empty.
+		PathPrefix string
 	}
 
 	// knativeClient is client for communicating with Knative type FaaSProvider
@@ -107,11 +125,39 @@ func (kc *knativeClient) Delete(name string) error {
 	return kc.deleteService(name)
 }
 
-// NewProvider returns FaaSProvider client. It only supports Knative now.
+// Route returns the route of the function, the requests are sent to the
+// network layer of Knative, and the functions are recognized by the Host.
+func (kc *knativeClient) Route(name string) *Route {
+	spec := kc.superSpec.ObjectSpec().(*spec.Admin)
+	return &Route{
+		URL:  spec.Knative.NetworkLayerURL,
+		Host: name + "." + kc.namespace + "." + spec.Knative.HostSuffix,
+	}
+}
+
+// NewProvider returns FaaSProvider client of the provider of the spec.
 func NewProvider(superSpec *supervisor.Spec) FaaSProvider {
-	return &knativeClient{
+	switch superSpec.ObjectSpec().(*spec.Admin).Provider {
+	case spec.ProviderOpenFaaS:
+		return newOpenFaaSClient(superSpec)
+	case spec.ProviderWebhook:
+		return newWebhookClient(superSpec)
+	default:
+		return newKnativeClient(superSpec)
+	}
+}
+
+func newKnativeClient(superSpec *supervisor.Spec) *knativeClient {
+	spec := superSpec.ObjectSpec().(*spec.Admin)
+	kc := &knativeClient{
 		superSpec: superSpec,
+		namespace: spec.Knative.Namespace,
+		timeout:   defaultTimeout,
+	}
+	if kc.namespace == "" {
+		kc.namespace = defaultNamespace
 	}
+	return kc
 }
 
 // Init initializes knative client.
@@ -121,13 +167,15 @@ func (kc *knativeClient) Init() error {
 	param.Initialize()
 	spec := kc.superSpec.ObjectSpec().(*spec.Admin)
 
-	kc.namespace = spec.Knative.Namespace
 	kc.serviceClient, err = param.NewServingClient(kc.namespace)
 	if err != nil {
 		logger.Errorf("knative new serving client failed: %v", err)
 		return err
 	}
 
+	if spec.Knative.Timeout == "" {
+		return nil
+	}
 	kc.timeout, err = time.ParseDuration(spec.Knative.Timeout)
 	if err != nil {
 		logger.Errorf("BUG: parse knative timeout interval: %s failed: %v",
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package provider
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func TestOpenFaaSClient(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		deployment *openFaaSDeployment
+		deleted    *openFaaSDeleteRequest
+		available  uint64
+		username   string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _, _ = r.BasicAuth()
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.URL.Path == "/system/functions" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+			deployment = &openFaaSDeployment{}
+			codectool.UnmarshalJSON(body, deployment)
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/system/functions" && r.Method == http.MethodDelete:
+			deleted = &openFaaSDeleteRequest{}
+			codectool.UnmarshalJSON(body, deleted)
+		case r.URL.Path == "/system/function/demo" && r.URL.Query().Get("namespace") == "fn":
+			data, _ := codectool.MarshalJSON(&openFaaSFunctionStatus{Name: "demo", Replicas: 1, AvailableReplicas: available})
+			w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	oc := &openFaaSClient{client: newRESTClient(server.URL, time.Second), namespace: "fn"}
+	oc.client.username = "admin"
+
+	funcSpec := &spec.Spec{
+		Name:           "demo",
+		Image:          "demo:1.0",
+		AutoScaleType:  spec.AutoScaleMetricConcurrency,
+		AutoScaleValue: "10",
+		MaxReplica:     3,
+		LimitMemory:    "128Mi",
+	}
+	assert.NoError(oc.Create(funcSpec))
+	assert.Equal("admin", username)
+	assert.Equal("demo", deployment.Service)
+	assert.Equal("fn", deployment.Namespace)
+	assert.Equal("capacity", deployment.Labels["com.openfaas.scale.type"])
+	assert.Equal("3", deployment.Labels["com.openfaas.scale.max"])
+	assert.Equal("128Mi", deployment.Limits.Memory)
+	assert.Nil(deployment.Requests)
+
+	status, err := oc.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.PendingEvent, status.Event)
+	available = 1
+	status, err = oc.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ReadyEvent, status.Event)
+
+	_, err = oc.GetStatus("unknown")
+	assert.Error(err)
+
+	assert.NoError(oc.Delete("demo"))
+	assert.Equal("demo", deleted.FunctionName)
+}
+
+func TestWebhookClient(t *testing.T) {
+	assert := assert.New(t)
+
+	var method, path, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path, token = r.Method, r.URL.Path, r.Header.Get("X-Token")
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"event":"error","extData":{"reason":"image not found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	wc := &webhookClient{client: newRESTClient(server.URL, time.Second)}
+	wc.client.headers = map[string]string{"X-Token": "secret"}
+
+	funcSpec := &spec.Spec{Name: "demo", Image: "demo:1.0"}
+	assert.NoError(wc.Create(funcSpec))
+	assert.Equal(http.MethodPost, method)
+	assert.Equal("/functions", path)
+	assert.Equal("secret", token)
+
+	assert.NoError(wc.Update(funcSpec))
+	assert.Equal(http.MethodPut, method)
+	assert.Equal("/functions/demo", path)
+
+	status, err := wc.GetStatus("demo")
+	assert.NoError(err)
+	assert.Equal(spec.ErrorEvent, status.Event)
+	assert.Equal("image not found", status.ExtData["reason"])
+
+	assert.NoError(wc.Delete("demo"))
+	assert.Equal(http.MethodDelete, method)
+}
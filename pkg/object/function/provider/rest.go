@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// restClient is the client of the REST APIs of the providers.
+type restClient struct {
+	client   *http.Client
+	baseURL  string
+	headers  map[string]string
+	username string
+	password string
+}
+
+func newRESTClient(baseURL string, timeout time.Duration) *restClient {
+	return &restClient{
+		client:  &http.Client{Timeout: timeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// do sends a request with the body encoded to JSON, and decodes the
+// response body to result if it is not nil. It returns the status code
+// and an error if the status code is not 2xx.
+func (rc *restClient) do(method, path string, body, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := codectool.MarshalJSON(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, rc.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range rc.headers {
+		req.Header.Set(k, v)
+	}
+	if rc.username != "" {
+		req.SetBasicAuth(rc.username, rc.password)
+	}
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s %s: status code %d: %s", method, path, resp.StatusCode, bytes.TrimSpace(data))
+	}
+	if result != nil && len(data) > 0 {
+		if err = codectool.UnmarshalJSON(data, result); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package provider
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/spec"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+type (
+	// webhookClient manages the functions by calling the webhook, which
+	// is usually a custom container runner. The webhook should serve:
+	//
+	//   POST   /functions         creates a function from the spec
+	//   PUT    /functions/{name}  updates the function
+	//   DELETE /functions/{name}  deletes the function
+	//   GET    /functions/{name}  returns the status of the function
+	webhookClient struct {
+		superSpec *supervisor.Spec
+		client    *restClient
+	}
+
+	// webhookStatus is the status of a function returned by the webhook.
+	webhookStatus struct {
+		Event   spec.Event        `json:"event"`
+		ExtData map[string]string `json:"extData,omitempty"`
+	}
+)
+
+func newWebhookClient(superSpec *supervisor.Spec) *webhookClient {
+	return &webhookClient{superSpec: superSpec}
+}
+
+// Init initializes webhook client.
+func (wc *webhookClient) Init() error {
+	spec := wc.superSpec.ObjectSpec().(*spec.Admin).Webhook
+
+	timeout := defaultTimeout
+	if spec.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(spec.Timeout)
+		if err != nil {
+			logger.Errorf("BUG: parse webhook timeout interval: %s failed: %v",
+				spec.Timeout, err)
+			return err
+		}
+	}
+
+	wc.client = newRESTClient(spec.URL, timeout)
+	wc.client.headers = spec.Headers
+	return nil
+}
+
+// Create creates the function by the webhook.
+func (wc *webhookClient) Create(funcSpec *spec.Spec) error {
+	_, err := wc.client.do(http.MethodPost, "/functions", funcSpec, nil)
+	if err != nil {
+		logger.Errorf("create function: %s by webhook failed: %v", funcSpec.Name, err)
+	}
+	return err
+}
+
+// Update updates the function by the webhook.
+func (wc *webhookClient) Update(funcSpec *spec.Spec) error {
+	_, err := wc.client.do(http.MethodPut, "/functions/"+url.PathEscape(funcSpec.Name), funcSpec, nil)
+	if err != nil {
+		logger.Errorf("update function: %s by webhook failed: %v", funcSpec.Name, err)
+	}
+	return err
+}
+
+// Delete deletes the function by the webhook.
+func (wc *webhookClient) Delete(name string) error {
+	_, err := wc.client.do(http.MethodDelete, "/functions/"+url.PathEscape(name), nil, nil)
+	if err != nil {
+		logger.Errorf("delete function: %s by webhook failed: %v", name, err)
+	}
+	return err
+}
+
+// GetStatus returns the status of the function reported by the webhook,
+// unknown events are treated as pending.
+func (wc *webhookClient) GetStatus(name string) (*spec.Status, error) {
+	ws := &webhookStatus{}
+	_, err := wc.client.do(http.MethodGet, "/functions/"+url.PathEscape(name), nil, ws)
+	if err != nil {
+		logger.Errorf("get function: %s by webhook, err: %v", name, err)
+		return nil, err
+	}
+
+	status := &spec.Status{Event: ws.Event, ExtData: ws.ExtData}
+	switch ws.Event {
+	case spec.ReadyEvent, spec.PendingEvent, spec.ErrorEvent:
+	default:
+		status.Event = spec.PendingEvent
+	}
+	return status, nil
+}
+
+// Route returns the route of the function, the requests are sent to the
+// invoke URL with the name of the function as the path prefix.
+func (wc *webhookClient) Route(name string) *Route {
+	spec := wc.superSpec.ObjectSpec().(*spec.Admin)
+	return &Route{
+		URL:        spec.Webhook.InvokeURL,
+		PathPrefix: "/" + name,
+	}
+}
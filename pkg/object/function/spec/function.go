@@ -36,6 +36,11 @@ const (
 
 	// ProviderKnative is the FaaS provider Knative.
 	ProviderKnative = "knative"
+	// ProviderOpenFaaS is the FaaS provider OpenFaaS.
+	ProviderOpenFaaS = "openfaas"
+	// ProviderWebhook is the FaaS provider which manages the functions by
+	// calling a webhook, e.g. a custom container runner.
+	ProviderWebhook = "webhook"
 )
 
 type (
@@ -45,14 +50,15 @@ type (
 		SyncInterval string `json:"syncInterval" jsonschema:"required,format=duration"`
 
 		// Provider is the FaaSProvider.
-		Provider string `json:"provider" jsonschema:"required"`
+		Provider string `json:"provider" jsonschema:"required,enum=knative,enum=openfaas,enum=webhook"`
 
 		// HTTPServer is the HTTP traffic gate for accepting ingress traffic.
 		HTTPServer *httpserver.Spec `json:"httpServer" jsonschema:"required"`
 
-		// Currently we only supports knative type faas provider, so this filed should be
-		// "required" right now.
-		Knative *Knative `json:"knative" jsonschema:"required"`
+		// The spec of the provider, which is required by the provider.
+		Knative  *Knative  `json:"knative,omitempty" jsonschema:"omitempty"`
+		OpenFaaS *OpenFaaS `json:"openFaaS,omitempty" jsonschema:"omitempty"`
+		Webhook  *Webhook  `json:"webhook,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Function contains the FaaSFunction's spec ,runtime status with a build-in fsm.
@@ -95,8 +101,50 @@ type (
 		Namespace string `json:"namespace" jsonschema:"omitempty"`
 		Timeout   string `json:"timeout" jsonschema:"omitempty,format=duration"`
 	}
+
+	// OpenFaaS is the faas provider OpenFaaS, the functions are managed
+	// and invoked by the gateway of OpenFaaS.
+	OpenFaaS struct {
+		GatewayURL string `json:"gatewayURL" jsonschema:"required,format=uri"`
+		Username   string `json:"username,omitempty" jsonschema:"omitempty"`
+		Password   string `json:"password,omitempty" jsonschema:"omitempty"`
+
+		Namespace string `json:"namespace,omitempty" jsonschema:"omitempty"`
+		Timeout   string `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Webhook is the faas provider which manages the functions by calling
+	// the webhook, the requests to a function are sent to InvokeURL with
+	// the name of the function as the path prefix.
+	Webhook struct {
+		URL       string            `json:"url" jsonschema:"required,format=uri"`
+		Headers   map[string]string `json:"headers,omitempty" jsonschema:"omitempty"`
+		InvokeURL string            `json:"invokeURL" jsonschema:"required,format=uri"`
+		Timeout   string            `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+	}
 )
 
+// Validate validates Admin.
+func (admin *Admin) Validate() error {
+	switch admin.Provider {
+	case ProviderKnative:
+		if admin.Knative == nil {
+			return fmt.Errorf("knative is required by provider %s", admin.Provider)
+		}
+	case ProviderOpenFaaS:
+		if admin.OpenFaaS == nil {
+			return fmt.Errorf("openFaaS is required by provider %s", admin.Provider)
+		}
+	case ProviderWebhook:
+		if admin.Webhook == nil {
+			return fmt.Errorf("webhook is required by provider %s", admin.Provider)
+		}
+	default:
+		return fmt.Errorf("unknown FaaS provider: %s", admin.Provider)
+	}
+	return nil
+}
+
 // Validate valid FaaSFunction's spec.
 func (spec *Spec) Validate() error {
 	if spec.MinReplica > spec.MaxReplica {
@@ -184,3 +184,25 @@ func TestInvalidNext(t *testing.T) {
 		t.Errorf("test failed Next should failed, start event will be rejected in initial state")
 	}
 }
+
+func TestAdminValidate(t *testing.T) {
+	admin := &Admin{Provider: ProviderOpenFaaS}
+	if err := admin.Validate(); err == nil {
+		t.Errorf("openFaaS is required by the openfaas provider")
+	}
+
+	admin.OpenFaaS = &OpenFaaS{GatewayURL: "http://127.0.0.1:8080"}
+	if err := admin.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	admin.Provider = ProviderWebhook
+	if err := admin.Validate(); err == nil {
+		t.Errorf("webhook is required by the webhook provider")
+	}
+
+	admin.Provider = "unknown"
+	if err := admin.Validate(); err == nil {
+		t.Errorf("unknown provider should be invalid")
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/megaease/easegress/pkg/filters/proxy"
 	"github.com/megaease/easegress/pkg/filters/requestadaptor"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/function/provider"
 	"github.com/megaease/easegress/pkg/object/function/spec"
 	"github.com/megaease/easegress/pkg/object/httpserver"
 	"github.com/megaease/easegress/pkg/object/pipeline"
@@ -38,10 +39,7 @@ type (
 	// ingressServer manages one/many ingress pipelines and one HTTPServer
 	ingressServer struct {
 		superSpec *supervisor.Spec
-
-		faasNetworkLayerURL string
-		faasHostSuffix      string
-		faasNamespace       string
+		provider  provider.FaaSProvider
 
 		namespace string
 		mutex     sync.RWMutex
@@ -66,7 +64,7 @@ type (
 )
 
 // newIngressServer creates an initialized ingress server
-func newIngressServer(superSpec *supervisor.Spec, controllerName string) *ingressServer {
+func newIngressServer(superSpec *supervisor.Spec, controllerName string, faasProvider provider.FaaSProvider) *ingressServer {
 	entity, exists := superSpec.Super().GetSystemController(trafficcontroller.Kind)
 
 	if !exists {
@@ -81,6 +79,7 @@ func newIngressServer(superSpec *supervisor.Spec, controllerName string) *ingres
 		pipelines:  make(map[string]struct{}),
 		httpServer: nil,
 		superSpec:  superSpec,
+		provider:   faasProvider,
 		mutex:      sync.RWMutex{},
 		namespace:  fmt.Sprintf("%s/%s", superSpec.Name(), "ingress"),
 		tc:         tc,
@@ -131,28 +130,44 @@ func (b *pipelineSpecBuilder) jsonConfig() string {
 	return string(buff)
 }
 
-func (b *pipelineSpecBuilder) appendReqAdaptor(funcSpec *spec.Spec, faasNamespace, faasHostSuffix string) *pipelineSpecBuilder {
+func (b *pipelineSpecBuilder) appendReqAdaptor(funcSpec *spec.Spec, route *provider.Route) *pipelineSpecBuilder {
 	adaptorName := "requestAdaptor"
 	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: adaptorName})
 
-	b.Filters = append(b.Filters, map[string]interface{}{
+	adaptor := map[string]interface{}{
 		"kind":   requestadaptor.Kind,
 		"name":   adaptorName,
 		"method": funcSpec.RequestAdaptor.Method,
 		"path":   funcSpec.RequestAdaptor.Path,
 		"header": funcSpec.RequestAdaptor.Header,
-
-		// let faas Provider's gateway recognized this function by Host field
-		"host": funcSpec.Name + "." + faasNamespace + "." + faasHostSuffix,
-	})
+	}
+	// let faas Provider's gateway recognized this function by Host field
+	if route.Host != "" {
+		adaptor["host"] = route.Host
+	}
+	b.Filters = append(b.Filters, adaptor)
+
+	// or by the path prefix, which is added after the path of the function
+	// is adapted.
+	if route.PathPrefix != "" {
+		adaptorName = "providerAdaptor"
+		b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: adaptorName})
+		b.Filters = append(b.Filters, map[string]interface{}{
+			"kind": requestadaptor.Kind,
+			"name": adaptorName,
+			"path": map[string]interface{}{
+				"addPrefix": route.PathPrefix,
+			},
+		})
+	}
 
 	return b
 }
 
-func (b *pipelineSpecBuilder) appendProxy(faasNetworkLayerURL string) *pipelineSpecBuilder {
+func (b *pipelineSpecBuilder) appendProxy(route *provider.Route) *pipelineSpecBuilder {
 	mainServers := []*proxy.Server{
 		{
-			URL:      faasNetworkLayerURL,
+			URL:      route.URL,
 			KeepHost: true, // Keep the host of the requests as they route to functions.
 		},
 	}
@@ -184,10 +199,6 @@ func (ings *ingressServer) Init() error {
 	}
 	spec := ings.superSpec.ObjectSpec().(*spec.Admin)
 
-	ings.faasNetworkLayerURL = spec.Knative.NetworkLayerURL
-	ings.faasHostSuffix = spec.Knative.HostSuffix
-	ings.faasNamespace = spec.Knative.Namespace
-
 	builder := newHTTPServerSpecBuilder(ings.superSpec.Name())
 	builder.buildWithOutRules(spec.HTTPServer)
 	superSpec, err := supervisor.NewSpec(builder.jsonConfig())
@@ -276,8 +287,9 @@ func (ings *ingressServer) remove(pipeline string) error {
 // Put puts pipeline named by faas function's name with a requestAdaptor and proxy
 func (ings *ingressServer) Put(funcSpec *spec.Spec) error {
 	builder := newPipelineSpecBuilder(funcSpec.Name)
-	builder.appendReqAdaptor(funcSpec, ings.faasNamespace, ings.faasHostSuffix)
-	builder.appendProxy(ings.faasNetworkLayerURL)
+	route := ings.provider.Route(funcSpec.Name)
+	builder.appendReqAdaptor(funcSpec, route)
+	builder.appendProxy(route)
 
 	jsonConfig := builder.jsonConfig()
 	superSpec, err := supervisor.NewSpec(jsonConfig)
@@ -54,7 +54,7 @@ type (
 func NewWorker(superSpec *supervisor.Spec) *Worker {
 	store := storage.NewStorage(superSpec.Name(), superSpec.Super().Cluster())
 	faasProvider := provider.NewProvider(superSpec)
-	ingress := newIngressServer(superSpec, superSpec.Name())
+	ingress := newIngressServer(superSpec, superSpec.Name(), faasProvider)
 	adm := superSpec.ObjectSpec().(*spec.Admin)
 
 	w := &Worker{
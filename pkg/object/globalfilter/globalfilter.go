@@ -188,6 +188,19 @@ func (gf *GlobalFilter) Handle(ctx *context.Context, handler context.Handler) {
 	p.HandleWithBeforeAfter(ctx, before, after)
 }
 
+// RequiresBody returns whether the filters of `beforePipeline` or
+// `afterPipeline` require the full bodies of the requests and responses.
+func (gf *GlobalFilter) RequiresBody() (request, response bool) {
+	for _, v := range []interface{}{gf.beforePipeline.Load(), gf.afterPipeline.Load()} {
+		if p, ok := v.(*pipeline.Pipeline); ok {
+			reqBody, respBody := p.RequiresBody()
+			request = request || reqBody
+			response = response || respBody
+		}
+	}
+	return
+}
+
 // Close closes GlobalFilter itself.
 func (gf *GlobalFilter) Close() {
 }
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcserver implements the GRPCServer.
+package grpcserver
+
+import (
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of GRPCServer.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of GRPCServer.
+	Kind = "GRPCServer"
+)
+
+func init() {
+	supervisor.Register(&GRPCServer{})
+}
+
+type (
+	// GRPCServer is Object GRPCServer.
+	GRPCServer struct {
+		runtime *runtime
+	}
+)
+
+// Category returns the category of GRPCServer.
+func (gs *GRPCServer) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of GRPCServer.
+func (gs *GRPCServer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of GRPCServer.
+func (gs *GRPCServer) DefaultSpec() interface{} {
+	return &Spec{
+		MaxConnectionIdle: "60s",
+	}
+}
+
+// Init initializes GRPCServer.
+func (gs *GRPCServer) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	gs.runtime = newRuntime(superSpec, muxMapper)
+
+	gs.runtime.eventChan <- &eventReload{
+		nextSuperSpec: superSpec,
+		muxMapper:     muxMapper,
+	}
+}
+
+// Inherit inherits previous generation of GRPCServer.
+func (gs *GRPCServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, muxMapper context.MuxMapper) {
+	gs.runtime = previousGeneration.(*GRPCServer).runtime
+
+	gs.runtime.eventChan <- &eventReload{
+		nextSuperSpec: superSpec,
+		muxMapper:     muxMapper,
+	}
+}
+
+// Status is the wrapper of runtime's Status.
+func (gs *GRPCServer) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: gs.runtime.Status(),
+	}
+}
+
+// Close closes GRPCServer.
+func (gs *GRPCServer) Close() {
+	gs.runtime.Close()
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcserver
+
+import (
+	stdcontext "context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func TestGRPCServer(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: GRPCServer
+name: test
+port: 38091
+rules:
+- service: grpc.health.v1.Health
+  methods:
+  - method: Check
+    backend: check-pipeline
+  - method: Watch
+    ipFilter:
+      blockByDefault: true
+    backend: watch-pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	var fullMethod, header string
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		if name != "check-pipeline" {
+			return nil, false
+		}
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				req := ctx.GetInputRequest().(*grpcprot.Request)
+				fullMethod = req.FullMethod()
+				header = req.Header().Get("x-test").(string)
+
+				resp := grpcprot.NewResponse()
+				resp.SetStatus(status.New(codes.NotFound, "not found"))
+				resp.Trailer().Set("x-trailer", "trailer")
+				ctx.SetOutputResponse(resp)
+				return ""
+			},
+		}, true
+	}
+
+	svr := &GRPCServer{}
+	svr.Init(superSpec, mm)
+	defer svr.Close()
+
+	dialCtx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 3*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(dialCtx, "127.0.0.1:38091", grpc.WithBlock(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	client := grpc_health_v1.NewHealthClient(conn)
+	callCtx := metadata.AppendToOutgoingContext(stdcontext.Background(), "x-test", "value")
+
+	var trailer metadata.MD
+	_, err = client.Check(callCtx, &grpc_health_v1.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	assert.Equal(codes.NotFound, status.Code(err))
+	assert.Equal("/grpc.health.v1.Health/Check", fullMethod)
+	assert.Equal("value", header)
+	assert.Equal([]string{"trailer"}, trailer.Get("x-trailer"))
+
+	// blocked by the IP filter.
+	stream, err := client.Watch(callCtx, &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(err)
+	_, err = stream.Recv()
+	assert.Equal(codes.PermissionDenied, status.Code(err))
+
+	// no matched route.
+	err = conn.Invoke(callCtx, "/unknown.Service/Method", &grpc_health_v1.HealthCheckRequest{}, &grpc_health_v1.HealthCheckResponse{})
+	assert.Equal(codes.Unimplemented, status.Code(err))
+
+	status := svr.Status().ObjectStatus.(*Status)
+	assert.Equal(stateRunning, status.State)
+	assert.Equal(uint64(3), status.Count)
+	assert.Equal(uint64(3), status.FailedCount)
+}
+
+func TestNeedRestartServer(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &runtime{spec: &Spec{Port: 8080}}
+	assert.False(r.needRestartServer(&Spec{Port: 8080, Rules: []*Rule{{}}}))
+	assert.True(r.needRestartServer(&Spec{Port: 8081}))
+	assert.True(r.needRestartServer(&Spec{Port: 8080, MaxRecvMsgSize: 1024}))
+}
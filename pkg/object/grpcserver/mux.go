@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/ipset"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+type (
+	mux struct {
+		count       uint64
+		failedCount uint64
+
+		inst atomic.Value // *muxInstance
+	}
+
+	muxInstance struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		muxMapper context.MuxMapper
+
+		tracer   *tracing.Tracer
+		ipFilter *ipfilter.IPFilter
+
+		rules []*muxRule
+	}
+
+	muxRule struct {
+		ipFilter *ipfilter.IPFilter
+		service  string
+		methods  []*muxMethod
+	}
+
+	muxMethod struct {
+		ipFilter *ipfilter.IPFilter
+		method   string
+		backend  string
+	}
+)
+
+func newIPFilter(spec *ipfilter.Spec, getSet ipfilter.SetGetter) *ipfilter.IPFilter {
+	if spec == nil {
+		return nil
+	}
+
+	return ipfilter.NewWithSets(spec, getSet)
+}
+
+func allowIP(ipFilter *ipfilter.IPFilter, ip string) bool {
+	if ipFilter == nil {
+		return true
+	}
+
+	return ipFilter.Allow(ip)
+}
+
+func newMux(mapper context.MuxMapper) *mux {
+	m := &mux{}
+
+	m.inst.Store(&muxInstance{
+		spec:      &Spec{},
+		tracer:    tracing.NoopTracer,
+		muxMapper: mapper,
+	})
+
+	return m
+}
+
+func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	spec := superSpec.ObjectSpec().(*Spec)
+
+	tracer := tracing.NoopTracer
+	oldInst := m.inst.Load().(*muxInstance)
+	if !reflect.DeepEqual(oldInst.spec.Tracing, spec.Tracing) {
+		defer func() {
+			err := oldInst.tracer.Close()
+			if err != nil {
+				logger.Errorf("close tracing failed: %v", err)
+			}
+		}()
+		tracer0, err := tracing.New(spec.Tracing)
+		if err != nil {
+			logger.Errorf("create tracing failed: %v", err)
+		} else {
+			tracer = tracer0
+			tracer.RegisterMetrics(superSpec.Name())
+		}
+	} else if oldInst.tracer != nil {
+		tracer = oldInst.tracer
+	}
+
+	getSet := ipset.SetGetter(superSpec.Super())
+	inst := &muxInstance{
+		superSpec: superSpec,
+		spec:      spec,
+		muxMapper: muxMapper,
+		tracer:    tracer,
+		ipFilter:  newIPFilter(spec.IPFilter, getSet),
+		rules:     make([]*muxRule, len(spec.Rules)),
+	}
+
+	for i, specRule := range spec.Rules {
+		rule := &muxRule{
+			ipFilter: newIPFilter(specRule.IPFilter, getSet),
+			service:  specRule.Service,
+			methods:  make([]*muxMethod, len(specRule.Methods)),
+		}
+		for j, specMethod := range specRule.Methods {
+			rule.methods[j] = &muxMethod{
+				ipFilter: newIPFilter(specMethod.IPFilter, getSet),
+				method:   specMethod.Method,
+				backend:  specMethod.Backend,
+			}
+		}
+		inst.rules[i] = rule
+	}
+
+	m.inst.Store(inst)
+}
+
+// handleStream is the handler of all gRPC calls.
+func (m *mux) handleStream(srv interface{}, stream grpc.ServerStream) error {
+	graceupdate.BeginRequest()
+	defer graceupdate.EndRequest()
+
+	err := m.inst.Load().(*muxInstance).serveGRPC(stream)
+	atomic.AddUint64(&m.count, 1)
+	if err != nil {
+		atomic.AddUint64(&m.failedCount, 1)
+	}
+	return err
+}
+
+func buildFailureResponse(ctx *context.Context, code codes.Code, msg string) *grpcprot.Response {
+	resp := grpcprot.NewResponse()
+	resp.SetStatus(status.New(code, msg))
+	ctx.SetResponse(context.DefaultNamespace, resp)
+	return resp
+}
+
+// toHTTPRequest converts req to an HTTP request for tracing, as the
+// propagation formats of tracing are defined by HTTP headers.
+func toHTTPRequest(req *grpcprot.Request) *http.Request {
+	h := http.Header{}
+	req.Header().Walk(func(key string, value interface{}) bool {
+		h[http.CanonicalHeaderKey(key)] = value.([]string)
+		return true
+	})
+	return &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: req.FullMethod()},
+		Host:   req.Host(),
+		Header: h,
+	}
+}
+
+func (mi *muxInstance) serveGRPC(stream grpc.ServerStream) error {
+	startAt := fasttime.Now()
+	req := grpcprot.NewRequest(stream)
+
+	stdr := toHTTPRequest(req)
+	span := mi.tracer.NewSpanFromHTTP(mi.superSpec.Name(), startAt, stdr)
+	ctx := context.New(span)
+	ctx.SetRequest(context.DefaultNamespace, req)
+
+	span.TagFromHeaders(stdr.Header)
+	span.TagFromContext(tracing.AttributeMethod, req.Method())
+	span.TagFromContext(tracing.AttributePath, req.FullMethod())
+	span.TagFromContext(tracing.AttributeClientIP, req.RealIP())
+
+	mi.handle(ctx, req, span)
+
+	var resp *grpcprot.Response
+	if v := ctx.GetResponse(context.DefaultNamespace); v == nil {
+		logger.Errorf("%s: response is nil", mi.superSpec.Name())
+		resp = buildFailureResponse(ctx, codes.Unavailable, "response is nil")
+	} else if r, ok := v.(*grpcprot.Response); !ok {
+		logger.Errorf("%s: expect a gRPC response", mi.superSpec.Name())
+		resp = buildFailureResponse(ctx, codes.Unavailable, "response is not a gRPC response")
+	} else {
+		resp = r
+	}
+
+	// The header has been sent if any message is sent to the client, the
+	// error of SetHeader is ignored in this case.
+	if md := resp.GRPCHeader().RawHeader(); len(md) > 0 {
+		stream.SetHeader(md)
+	}
+	if md := resp.Trailer().RawHeader(); len(md) > 0 {
+		stream.SetTrailer(md)
+	}
+
+	ctx.Finish()
+
+	code := resp.Code()
+	if code != codes.OK {
+		span.Tag(tracing.TagError, resp.Status().Message())
+	}
+	span.Tag(tracing.TagGRPCStatusCode, code.String())
+	span.Finish()
+
+	// Write access log.
+	logger.LazyHTTPAccess(func() string {
+		// log format:
+		//
+		// [$startTime]
+		// [$remoteAddr $realIP $fullMethod $statusCode]
+		// [$contextDuration]
+		// [$tags]
+		const logFmt = "[%s] [%s %s %s %s] [%v] [%s]"
+		return fmt.Sprintf(logFmt,
+			fasttime.Format(startAt, fasttime.RFC3339Milli),
+			req.RemoteAddr(), req.RealIP(), req.FullMethod(), code,
+			fasttime.Since(startAt), ctx.Tags())
+	})
+
+	return resp.Status().Err()
+}
+
+func (mi *muxInstance) handle(ctx *context.Context, req *grpcprot.Request, span tracing.Span) {
+	method, code := mi.search(req)
+	if code != codes.OK {
+		logger.Debugf("%s: status code of result route for %s: %s", mi.superSpec.Name(), req.FullMethod(), code)
+		buildFailureResponse(ctx, code, fmt.Sprintf("no route for method %s", req.FullMethod()))
+		return
+	}
+
+	handler, ok := mi.muxMapper.GetHandler(method.backend)
+	if !ok {
+		logger.Debugf("%s: backend(Pipeline) %q for %s not found", mi.superSpec.Name(), method.backend, req.FullMethod())
+		buildFailureResponse(ctx, codes.Unavailable, fmt.Sprintf("backend %s not found", method.backend))
+		return
+	}
+	logger.Debugf("%s: the matched backend(Pipeline) for %s is %q", mi.superSpec.Name(), req.FullMethod(), method.backend)
+	span.Tag(tracing.TagPipeline, method.backend)
+
+	handler.Handle(ctx)
+}
+
+func (mi *muxInstance) search(req *grpcprot.Request) (*muxMethod, codes.Code) {
+	ip := req.RealIP()
+	if !allowIP(mi.ipFilter, ip) {
+		return nil, codes.PermissionDenied
+	}
+
+	for _, rule := range mi.rules {
+		if rule.service != "" && rule.service != req.Service() {
+			continue
+		}
+		if !allowIP(rule.ipFilter, ip) {
+			return nil, codes.PermissionDenied
+		}
+
+		for _, method := range rule.methods {
+			if method.method != "" && method.method != req.Method() {
+				continue
+			}
+			if !allowIP(method.ipFilter, ip) {
+				return nil, codes.PermissionDenied
+			}
+			return method, codes.OK
+		}
+	}
+
+	return nil, codes.Unimplemented
+}
+
+func (mi *muxInstance) close() {
+	if err := mi.tracer.Close(); err != nil {
+		logger.Errorf("%s close tracer failed: %v", mi.superSpec.Name(), err)
+	}
+}
+
+func (m *mux) close() {
+	m.inst.Load().(*muxInstance).close()
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcserver
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/grpcprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	checkFailedTimeout = 10 * time.Second
+
+	stateNil     stateType = "nil"
+	stateFailed  stateType = "failed"
+	stateRunning stateType = "running"
+	stateClosed  stateType = "closed"
+)
+
+var (
+	errNil = fmt.Errorf("")
+	gnet   = graceupdate.Global
+)
+
+type (
+	stateType string
+
+	eventCheckFailed struct{}
+	eventServeFailed struct {
+		startNum uint64
+		err      error
+	}
+	eventReload struct {
+		nextSuperSpec *supervisor.Spec
+		muxMapper     context.MuxMapper
+	}
+	eventClose struct{ done chan struct{} }
+
+	runtime struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		server    *grpc.Server
+		mux       *mux
+		startNum  uint64
+		eventChan chan interface{}
+
+		// status
+		state atomic.Value // stateType
+		err   atomic.Value // error
+	}
+
+	// Status contains all status generated by runtime, for displaying to users.
+	Status struct {
+		Name   string `json:"name"`
+		Health string `json:"health"`
+
+		State stateType `json:"state"`
+		Error string    `json:"error,omitempty"`
+
+		Count       uint64 `json:"count"`
+		FailedCount uint64 `json:"failedCount"`
+	}
+)
+
+func newRuntime(superSpec *supervisor.Spec, muxMapper context.MuxMapper) *runtime {
+	r := &runtime{
+		superSpec: superSpec,
+		eventChan: make(chan interface{}, 10),
+	}
+
+	r.mux = newMux(muxMapper)
+	r.setState(stateNil)
+	r.setError(errNil)
+
+	go r.fsm()
+	go r.checkFailed(checkFailedTimeout)
+
+	return r
+}
+
+// Close closes runtime.
+func (r *runtime) Close() {
+	done := make(chan struct{})
+	r.eventChan <- &eventClose{done: done}
+	<-done
+}
+
+// Status returns GRPCServer Status.
+func (r *runtime) Status() *Status {
+	return &Status{
+		Name:        r.superSpec.Name(),
+		Health:      r.getError().Error(),
+		State:       r.getState(),
+		Error:       r.getError().Error(),
+		Count:       atomic.LoadUint64(&r.mux.count),
+		FailedCount: atomic.LoadUint64(&r.mux.failedCount),
+	}
+}
+
+// FSM is the finite-state-machine for the runtime.
+func (r *runtime) fsm() {
+	for e := range r.eventChan {
+		switch e := e.(type) {
+		case *eventCheckFailed:
+			r.handleEventCheckFailed(e)
+		case *eventServeFailed:
+			r.handleEventServeFailed(e)
+		case *eventReload:
+			r.handleEventReload(e)
+		case *eventClose:
+			r.handleEventClose(e)
+			// NOTE: We don't close r.eventChan,
+			// in case of panic of any other goroutines
+			// to send event to it later.
+			return
+		default:
+			logger.Errorf("BUG: unknown event: %T\n", e)
+		}
+	}
+}
+
+func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	r.superSpec = nextSuperSpec
+	r.mux.reload(nextSuperSpec, muxMapper)
+
+	nextSpec := nextSuperSpec.ObjectSpec().(*Spec)
+	switch {
+	case r.spec == nil:
+		r.spec = nextSpec
+		r.startServer()
+	case r.needRestartServer(nextSpec):
+		r.spec = nextSpec
+		r.closeServer()
+		r.startServer()
+	default:
+		r.spec = nextSpec
+	}
+}
+
+func (r *runtime) setState(state stateType) {
+	r.state.Store(state)
+}
+
+func (r *runtime) getState() stateType {
+	return r.state.Load().(stateType)
+}
+
+func (r *runtime) setError(err error) {
+	if err == nil {
+		r.err.Store(errNil)
+	} else {
+		// NOTE: For type safe.
+		r.err.Store(fmt.Errorf("%v", err))
+	}
+}
+
+func (r *runtime) getError() error {
+	err := r.err.Load()
+	if err == nil {
+		return nil
+	}
+	return err.(error)
+}
+
+func (r *runtime) needRestartServer(nextSpec *Spec) bool {
+	x := *r.spec
+	y := *nextSpec
+
+	// The change of options below need not restart the gRPC server.
+	x.Tracing, y.Tracing = nil, nil
+	x.IPFilter, y.IPFilter = nil, nil
+	x.Rules, y.Rules = nil, nil
+
+	return !reflect.DeepEqual(x, y)
+}
+
+func (r *runtime) serverOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.UnknownServiceHandler(r.mux.handleStream),
+		grpc.ForceServerCodec(grpcprot.Codec{}),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: r.spec.maxConnectionIdle(),
+		}),
+	}
+	if r.spec.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(r.spec.MaxConcurrentStreams))
+	}
+	if r.spec.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(r.spec.MaxRecvMsgSize))
+	}
+	if r.spec.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(r.spec.MaxSendMsgSize))
+	}
+	return opts
+}
+
+func (r *runtime) startServer() {
+	r.startNum++
+	r.setState(stateRunning)
+	r.setError(nil)
+
+	listener, err := gnet.Listen("tcp", fmt.Sprintf(":%d", r.spec.Port))
+	if err != nil {
+		r.setState(stateFailed)
+		r.setError(err)
+		return
+	}
+
+	r.server = grpc.NewServer(r.serverOptions()...)
+
+	// to avoid data race
+	startNum := r.startNum
+	srv := r.server
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+			r.eventChan <- &eventServeFailed{
+				err:      err,
+				startNum: startNum,
+			}
+		}
+	}()
+}
+
+func (r *runtime) closeServer() {
+	if r.server == nil {
+		return
+	}
+
+	srv := r.server
+	r.server = nil
+
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(graceupdate.DrainTimeout()):
+		logger.Warnf("graceful stop grpc server %s timeout, force stop it", r.superSpec.Name())
+		srv.Stop()
+	}
+}
+
+func (r *runtime) checkFailed(timeout time.Duration) {
+	ticker := time.NewTicker(timeout)
+	for range ticker.C {
+		state := r.getState()
+		if state == stateFailed {
+			r.eventChan <- &eventCheckFailed{}
+		} else if state == stateClosed {
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (r *runtime) handleEventCheckFailed(e *eventCheckFailed) {
+	if r.getState() == stateFailed {
+		r.startServer()
+	}
+}
+
+func (r *runtime) handleEventServeFailed(e *eventServeFailed) {
+	if r.startNum > e.startNum {
+		return
+	}
+	r.setState(stateFailed)
+	r.setError(e.err)
+}
+
+func (r *runtime) handleEventReload(e *eventReload) {
+	r.reload(e.nextSuperSpec, e.muxMapper)
+}
+
+func (r *runtime) handleEventClose(e *eventClose) {
+	r.setState(stateClosed)
+	r.closeServer()
+	r.mux.close()
+	close(e.done)
+}
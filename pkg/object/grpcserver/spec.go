@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/megaease/easegress/pkg/object/ipset"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+type (
+	// Spec describes the GRPCServer.
+	Spec struct {
+		Port                 uint16         `json:"port" jsonschema:"required,minimum=1"`
+		MaxConnectionIdle    string         `json:"maxConnectionIdle" jsonschema:"omitempty,format=duration"`
+		MaxConcurrentStreams uint32         `json:"maxConcurrentStreams" jsonschema:"omitempty"`
+		MaxRecvMsgSize       int            `json:"maxRecvMsgSize" jsonschema:"omitempty,minimum=0"`
+		MaxSendMsgSize       int            `json:"maxSendMsgSize" jsonschema:"omitempty,minimum=0"`
+		Tracing              *tracing.Spec  `json:"tracing,omitempty" jsonschema:"omitempty"`
+		IPFilter             *ipfilter.Spec `json:"ipFilter,omitempty" jsonschema:"omitempty"`
+		Rules                []*Rule        `json:"rules" jsonschema:"omitempty"`
+	}
+
+	// Rule routes the methods of a service, an empty service matches all
+	// services.
+	Rule struct {
+		IPFilter *ipfilter.Spec `json:"ipFilter,omitempty" jsonschema:"omitempty"`
+		Service  string         `json:"service" jsonschema:"omitempty"`
+		Methods  []*Method      `json:"methods" jsonschema:"required"`
+	}
+
+	// Method routes a method to a backend pipeline, an empty method matches
+	// all methods of the service.
+	Method struct {
+		IPFilter *ipfilter.Spec `json:"ipFilter,omitempty" jsonschema:"omitempty"`
+		Method   string         `json:"method" jsonschema:"omitempty"`
+		Backend  string         `json:"backend" jsonschema:"required"`
+	}
+)
+
+// Validate validates GRPCServer.
+func (spec *Spec) Validate() error {
+	if spec.MaxConnectionIdle != "" {
+		if _, err := time.ParseDuration(spec.MaxConnectionIdle); err != nil {
+			return fmt.Errorf("invalid maxConnectionIdle %s: %v", spec.MaxConnectionIdle, err)
+		}
+	}
+	return nil
+}
+
+// References returns the pipelines and the IPSets referenced by the
+// GRPCServer.
+func (spec *Spec) References() []*supervisor.ObjectReference {
+	var refs []*supervisor.ObjectReference
+	backends := map[string]bool{}
+	for _, rule := range spec.Rules {
+		for _, m := range rule.Methods {
+			if backends[m.Backend] {
+				continue
+			}
+			backends[m.Backend] = true
+			refs = append(refs, &supervisor.ObjectReference{Kind: pipeline.Kind, Name: m.Backend})
+		}
+	}
+
+	ipFilters := []*ipfilter.Spec{spec.IPFilter}
+	for _, rule := range spec.Rules {
+		ipFilters = append(ipFilters, rule.IPFilter)
+		for _, m := range rule.Methods {
+			ipFilters = append(ipFilters, m.IPFilter)
+		}
+	}
+	refs = append(refs, ipset.References(ipFilters...)...)
+	return refs
+}
+
+func (spec *Spec) maxConnectionIdle() time.Duration {
+	if spec.MaxConnectionIdle == "" {
+		return 0
+	}
+	d, _ := time.ParseDuration(spec.MaxConnectionIdle)
+	return d
+}
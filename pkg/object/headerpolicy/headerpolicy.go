@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package headerpolicy implements a business controller which injects the
+// security headers and mutates the headers of all the requests and
+// responses of the HTTPServers referencing it.
+package headerpolicy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of HeaderPolicy.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of HeaderPolicy.
+	Kind = "HeaderPolicy"
+
+	opSet    = "set"
+	opAdd    = "add"
+	opRemove = "remove"
+	opRename = "rename"
+)
+
+func init() {
+	supervisor.Register(&HeaderPolicy{})
+}
+
+type (
+	// HeaderPolicy is a business controller which applies the same header
+	// policy to all the requests and responses of the HTTPServers
+	// referencing it.
+	HeaderPolicy struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		// securityHeaders are the security headers of all responses, and
+		// hsts is the Strict-Transport-Security header of the responses
+		// of HTTPS requests.
+		securityHeaders http.Header
+		hsts            string
+	}
+
+	// Spec describes HeaderPolicy.
+	Spec struct {
+		Security *SecuritySpec `json:"security,omitempty" jsonschema:"omitempty"`
+		// Request and Response are the operations applied to the headers
+		// of the requests and the responses in order.
+		Request  []*Operation `json:"request,omitempty" jsonschema:"omitempty"`
+		Response []*Operation `json:"response,omitempty" jsonschema:"omitempty"`
+	}
+
+	// SecuritySpec describes the standard security headers, they are only
+	// added to the responses without them.
+	SecuritySpec struct {
+		HSTS                  *HSTSSpec `json:"hsts,omitempty" jsonschema:"omitempty"`
+		ContentTypeOptions    bool      `json:"contentTypeOptions,omitempty" jsonschema:"omitempty"`
+		FrameOptions          string    `json:"frameOptions,omitempty" jsonschema:"omitempty,enum=,enum=DENY,enum=SAMEORIGIN"`
+		ContentSecurityPolicy string    `json:"contentSecurityPolicy,omitempty" jsonschema:"omitempty"`
+		ReferrerPolicy        string    `json:"referrerPolicy,omitempty" jsonschema:"omitempty,enum=,enum=no-referrer,enum=no-referrer-when-downgrade,enum=origin,enum=origin-when-cross-origin,enum=same-origin,enum=strict-origin,enum=strict-origin-when-cross-origin,enum=unsafe-url"`
+	}
+
+	// HSTSSpec describes the Strict-Transport-Security header.
+	HSTSSpec struct {
+		MaxAge            int64 `json:"maxAge" jsonschema:"required,minimum=0"`
+		IncludeSubDomains bool  `json:"includeSubDomains,omitempty" jsonschema:"omitempty"`
+		Preload           bool  `json:"preload,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Operation is an operation on a header.
+	Operation struct {
+		Op   string `json:"op" jsonschema:"required,enum=set,enum=add,enum=remove,enum=rename"`
+		Name string `json:"name" jsonschema:"required"`
+		// Value is the value to set or add.
+		Value string `json:"value,omitempty" jsonschema:"omitempty"`
+		// To is the new name of the header to rename.
+		To string `json:"to,omitempty" jsonschema:"omitempty"`
+	}
+)
+
+// Validate validates Operation.
+func (o *Operation) Validate() error {
+	switch o.Op {
+	case opSet, opAdd:
+		if o.To != "" {
+			return fmt.Errorf("to can't be used with %s", o.Op)
+		}
+	case opRemove:
+		if o.Value != "" || o.To != "" {
+			return fmt.Errorf("value and to can't be used with remove")
+		}
+	case opRename:
+		if o.To == "" {
+			return fmt.Errorf("to of rename %s is empty", o.Name)
+		}
+		if o.Value != "" {
+			return fmt.Errorf("value can't be used with rename")
+		}
+	}
+	return nil
+}
+
+func (o *Operation) apply(h http.Header) {
+	switch o.Op {
+	case opSet:
+		h.Set(o.Name, o.Value)
+	case opAdd:
+		h.Add(o.Name, o.Value)
+	case opRemove:
+		h.Del(o.Name)
+	case opRename:
+		values := h.Values(o.Name)
+		if len(values) == 0 {
+			return
+		}
+		h.Del(o.Name)
+		h[http.CanonicalHeaderKey(o.To)] = values
+	}
+}
+
+func (h *HSTSSpec) String() string {
+	s := "max-age=" + strconv.FormatInt(h.MaxAge, 10)
+	if h.IncludeSubDomains {
+		s += "; includeSubDomains"
+	}
+	if h.Preload {
+		s += "; preload"
+	}
+	return s
+}
+
+// Category returns the category of HeaderPolicy.
+func (hp *HeaderPolicy) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of HeaderPolicy.
+func (hp *HeaderPolicy) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of HeaderPolicy.
+func (hp *HeaderPolicy) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes HeaderPolicy.
+func (hp *HeaderPolicy) Init(superSpec *supervisor.Spec) {
+	hp.superSpec, hp.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	hp.reload()
+}
+
+// Inherit inherits previous generation of HeaderPolicy.
+func (hp *HeaderPolicy) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	hp.Init(superSpec)
+}
+
+func (hp *HeaderPolicy) reload() {
+	hp.securityHeaders = http.Header{}
+
+	sec := hp.spec.Security
+	if sec == nil {
+		return
+	}
+	if sec.HSTS != nil {
+		hp.hsts = sec.HSTS.String()
+	}
+	if sec.ContentTypeOptions {
+		hp.securityHeaders.Set("X-Content-Type-Options", "nosniff")
+	}
+	if sec.FrameOptions != "" {
+		hp.securityHeaders.Set("X-Frame-Options", sec.FrameOptions)
+	}
+	if sec.ContentSecurityPolicy != "" {
+		hp.securityHeaders.Set("Content-Security-Policy", sec.ContentSecurityPolicy)
+	}
+	if sec.ReferrerPolicy != "" {
+		hp.securityHeaders.Set("Referrer-Policy", sec.ReferrerPolicy)
+	}
+}
+
+// ApplyRequest applies the request operations to the request header.
+func (hp *HeaderPolicy) ApplyRequest(h http.Header) {
+	for _, o := range hp.spec.Request {
+		o.apply(h)
+	}
+}
+
+// ApplyResponse adds the security headers missing in the response header,
+// and then applies the response operations to it. The HSTS header is only
+// added to the responses of HTTPS requests, as browsers ignore it otherwise.
+func (hp *HeaderPolicy) ApplyResponse(h http.Header, https bool) {
+	for k, v := range hp.securityHeaders {
+		if _, ok := h[k]; !ok {
+			h[k] = v
+		}
+	}
+	if https && hp.hsts != "" && h.Get("Strict-Transport-Security") == "" {
+		h.Set("Strict-Transport-Security", hp.hsts)
+	}
+
+	for _, o := range hp.spec.Response {
+		o.apply(h)
+	}
+}
+
+// Status returns the status of HeaderPolicy.
+func (hp *HeaderPolicy) Status() *supervisor.Status {
+	return &supervisor.Status{}
+}
+
+// Close closes HeaderPolicy.
+func (hp *HeaderPolicy) Close() {
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerpolicy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestHeaderPolicy(t *testing.T, yaml string) *HeaderPolicy {
+	superSpec, err := supervisor.NewSpec(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hp := &HeaderPolicy{}
+	hp.Init(superSpec)
+	return hp
+}
+
+func TestOperationValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, o := range []*Operation{
+		{Op: opSet, Name: "X-A", To: "X-B"},
+		{Op: opRemove, Name: "X-A", Value: "a"},
+		{Op: opRename, Name: "X-A"},
+		{Op: opRename, Name: "X-A", To: "X-B", Value: "a"},
+	} {
+		assert.Error(o.Validate())
+	}
+
+	assert.NoError((&Operation{Op: opAdd, Name: "X-A", Value: "a"}).Validate())
+	assert.NoError((&Operation{Op: opRename, Name: "X-A", To: "X-B"}).Validate())
+
+	_, err := supervisor.NewSpec(`
+kind: HeaderPolicy
+name: header-policy
+request:
+- op: move
+  name: X-A
+`)
+	assert.Error(err)
+}
+
+func TestApplyRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	hp := newTestHeaderPolicy(t, `
+kind: HeaderPolicy
+name: header-policy
+request:
+- op: remove
+  name: X-Internal
+- op: rename
+  name: X-Legacy-User
+  to: X-User
+- op: add
+  name: X-User
+  value: guest
+- op: set
+  name: X-Gateway
+  value: easegress
+- op: rename
+  name: X-Missing
+  to: X-Other
+`)
+	defer hp.Close()
+
+	h := http.Header{}
+	h.Set("X-Internal", "1")
+	h.Set("X-Legacy-User", "alice")
+	h.Set("X-User", "bob")
+	hp.ApplyRequest(h)
+
+	assert.Equal(http.Header{
+		"X-User":    {"alice", "guest"},
+		"X-Gateway": {"easegress"},
+	}, h)
+}
+
+func TestApplyResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	hp := newTestHeaderPolicy(t, `
+kind: HeaderPolicy
+name: header-policy
+security:
+  hsts:
+    maxAge: 31536000
+    includeSubDomains: true
+    preload: true
+  contentTypeOptions: true
+  frameOptions: DENY
+  contentSecurityPolicy: default-src 'self'
+  referrerPolicy: strict-origin-when-cross-origin
+response:
+- op: remove
+  name: Server
+- op: remove
+  name: X-Frame-Options
+`)
+	defer hp.Close()
+
+	h := http.Header{}
+	h.Set("Server", "nginx")
+	h.Set("Content-Security-Policy", "default-src *")
+	hp.ApplyResponse(h, true)
+
+	assert.Equal("max-age=31536000; includeSubDomains; preload", h.Get("Strict-Transport-Security"))
+	assert.Equal("nosniff", h.Get("X-Content-Type-Options"))
+	assert.Equal("strict-origin-when-cross-origin", h.Get("Referrer-Policy"))
+	// the header of the response is kept.
+	assert.Equal("default-src *", h.Get("Content-Security-Policy"))
+	// the operations are applied after the security headers.
+	assert.Equal("", h.Get("X-Frame-Options"))
+	assert.Equal("", h.Get("Server"))
+
+	h = http.Header{}
+	hp.ApplyResponse(h, false)
+	assert.Equal("", h.Get("Strict-Transport-Security"))
+	assert.Equal("default-src 'self'", h.Get("Content-Security-Policy"))
+
+	assert.NotNil(hp.Status())
+}
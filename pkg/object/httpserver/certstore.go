@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/tlscert"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// certStore keeps the certificates stored in the cluster up to date, and
+// selects them by the server names of the TLS handshakes.
+type certStore struct {
+	cancel context.CancelFunc
+
+	mutex    sync.RWMutex
+	patterns []string
+	// certs are all the certificates in the cluster, keyed by their names.
+	certs map[string]*tls.Certificate
+	// index are the selected certificates, keyed by their DNS names, which
+	// may be wildcards like *.example.com.
+	index map[string]*tls.Certificate
+}
+
+func newCertStore(cls cluster.Cluster, patterns []string) *certStore {
+	ctx, cancel := context.WithCancel(context.Background())
+	cs := &certStore{
+		cancel:   cancel,
+		patterns: patterns,
+	}
+
+	store := tlscert.NewStore(cls)
+	go func() {
+		for {
+			err := store.Watch(ctx, cs.onChange)
+			if err == nil {
+				return
+			}
+			logger.Errorf("watch tls certificates failed: %v", err)
+
+			select {
+			case <-time.After(10 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cs
+}
+
+func (cs *certStore) onChange(certs map[string]*tls.Certificate) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	cs.certs = certs
+	cs.rebuildIndex()
+}
+
+func (cs *certStore) setPatterns(patterns []string) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	cs.patterns = patterns
+	cs.rebuildIndex()
+}
+
+func (cs *certStore) match(name string) bool {
+	for _, p := range cs.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildIndex must be called with the write lock held. If more than one
+// certificate has the same DNS name, the one expires the latest wins, so
+// that a new certificate takes over the old one once it is added.
+func (cs *certStore) rebuildIndex() {
+	index := map[string]*tls.Certificate{}
+	for name, cert := range cs.certs {
+		if !cs.match(name) {
+			continue
+		}
+		for _, dnsName := range cert.Leaf.DNSNames {
+			dnsName = strings.ToLower(dnsName)
+			old := index[dnsName]
+			if old == nil || old.Leaf.NotAfter.Before(cert.Leaf.NotAfter) {
+				index[dnsName] = cert
+			}
+		}
+	}
+	cs.index = index
+}
+
+// get returns the certificate of serverName, an exact match is preferred
+// over a wildcard one. It returns nil if there's no such certificate.
+func (cs *certStore) get(serverName string) *tls.Certificate {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return nil
+	}
+
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	if cert := cs.index[name]; cert != nil {
+		return cert
+	}
+
+	// wildcards only match a single label, e.g. *.example.com matches
+	// www.example.com but not a.www.example.com.
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return cs.index["*"+name[i:]]
+	}
+	return nil
+}
+
+func (cs *certStore) close() {
+	cs.cancel()
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCert(t *testing.T, notAfter time.Time, dnsNames ...string) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCertStore(t *testing.T) {
+	assert := assert.New(t)
+
+	expire := time.Now().Add(time.Hour)
+	exact := newTestCert(t, expire, "www.example.com")
+	wildcard := newTestCert(t, expire, "*.example.com")
+	other := newTestCert(t, expire, "www.example.org")
+
+	cs := &certStore{patterns: []string{"example-*"}}
+	cs.onChange(map[string]*tls.Certificate{
+		"example-www":      exact,
+		"example-wildcard": wildcard,
+		"other":            other,
+	})
+
+	assert.Equal(exact, cs.get("www.example.com"))
+	assert.Equal(exact, cs.get("WWW.example.com."))
+	assert.Equal(wildcard, cs.get("api.example.com"))
+	assert.Nil(cs.get("a.api.example.com"))
+	assert.Nil(cs.get("example.com"))
+	assert.Nil(cs.get(""))
+	assert.Nil(cs.get("www.example.org"))
+
+	cs.setPatterns([]string{"*"})
+	assert.Equal(other, cs.get("www.example.org"))
+
+	// the certificate expires the latest wins.
+	renewed := newTestCert(t, expire.Add(time.Hour), "www.example.com")
+	cs.onChange(map[string]*tls.Certificate{
+		"example-www":     exact,
+		"example-renewed": renewed,
+	})
+	assert.Equal(renewed, cs.get("www.example.com"))
+	assert.Nil(cs.get("api.example.com"))
+}
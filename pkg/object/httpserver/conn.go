@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	stdcontext "context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// connTracker tracks the HTTP/1 connections of a server, so that the
+	// timeouts of the routes could be applied to the connections.
+	connTracker struct {
+		conns sync.Map // net.Conn -> *trackedConn
+	}
+
+	trackedConn struct {
+		net.Conn
+
+		lock        sync.Mutex
+		state       http.ConnState
+		idleTimeout time.Duration
+		idleTimer   *time.Timer
+	}
+
+	trackedConnKey struct{}
+)
+
+// ConnContext is the ConnContext hook of http.Server.
+func (ct *connTracker) ConnContext(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+	tc := &trackedConn{Conn: c}
+	ct.conns.Store(c, tc)
+	return stdcontext.WithValue(ctx, trackedConnKey{}, tc)
+}
+
+// ConnState is the ConnState hook of http.Server.
+func (ct *connTracker) ConnState(c net.Conn, state http.ConnState) {
+	v, ok := ct.conns.Load(c)
+	if !ok {
+		return
+	}
+	tc := v.(*trackedConn)
+
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		ct.conns.Delete(c)
+	}
+	tc.setState(state)
+}
+
+// getTrackedConn returns the tracked connection of the request, it returns
+// nil if the request is not an HTTP/1 request, because the deadlines of
+// an HTTP/2 connection are shared by all of its streams.
+func getTrackedConn(r *http.Request) *trackedConn {
+	if r.ProtoMajor != 1 {
+		return nil
+	}
+	tc, _ := r.Context().Value(trackedConnKey{}).(*trackedConn)
+	return tc
+}
+
+func (tc *trackedConn) setState(state http.ConnState) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	tc.state = state
+	if tc.idleTimer != nil {
+		tc.idleTimer.Stop()
+		tc.idleTimer = nil
+	}
+
+	switch state {
+	case http.StateActive:
+		// the idle timeout is decided by the route of the next request.
+		tc.idleTimeout = 0
+	case http.StateIdle:
+		if tc.idleTimeout > 0 {
+			tc.idleTimer = time.AfterFunc(tc.idleTimeout, tc.closeIfIdle)
+		}
+	}
+}
+
+// setIdleTimeout sets the idle timeout of the connection after the
+// current request. It could only be shorter than the idle timeout of the
+// server, which closes the connection anyway.
+func (tc *trackedConn) setIdleTimeout(d time.Duration) {
+	tc.lock.Lock()
+	tc.idleTimeout = d
+	tc.lock.Unlock()
+}
+
+func (tc *trackedConn) closeIfIdle() {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	if tc.state == http.StateIdle {
+		tc.Conn.Close()
+	}
+}
@@ -18,35 +18,55 @@
 package httpserver
 
 import (
+	stdcontext "context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/megaease/easegress/pkg/object/accesslog"
 	"github.com/megaease/easegress/pkg/object/globalfilter"
+	"github.com/megaease/easegress/pkg/object/headerpolicy"
+	"github.com/megaease/easegress/pkg/object/ipset"
+	"github.com/megaease/easegress/pkg/object/loadshedder"
+	"github.com/megaease/easegress/pkg/object/trafficcapture"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 
 	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/autocertmanager"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/clientip"
+	"github.com/megaease/easegress/pkg/util/expression"
 	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/geoip"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
 	"github.com/megaease/easegress/pkg/util/readers"
+	"github.com/megaease/easegress/pkg/util/requestid"
+	"github.com/megaease/easegress/pkg/util/resources"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/timetool"
 )
 
 type (
 	mux struct {
-		httpStat *httpstat.HTTPStat
-		topN     *httpstat.TopN
+		httpStat  *httpstat.HTTPStat
+		topN      *httpstat.TopN
+		resources *resources.Tracker
+		streams   *streamTracker
 
 		inst atomic.Value // *muxInstance
 	}
@@ -56,6 +76,8 @@ type (
 		spec      *Spec
 		httpStat  *httpstat.HTTPStat
 		topN      *httpstat.TopN
+		resources *resources.Tracker
+		streams   *streamTracker
 
 		muxMapper context.MuxMapper
 
@@ -64,13 +86,19 @@ type (
 		tracer       *tracing.Tracer
 		ipFilter     *ipfilter.IPFilter
 		ipFilterChan *ipfilter.IPFilters
+		geoResolver  *geoip.Resolver
+		geoFilter    *geoip.Filter
+		clientIP     *clientip.Resolver
+		requestID    *requestid.Generator
 
-		rules []*muxRule
+		redirectors []*redirector
+		rules       []*muxRule
 	}
 
 	muxRule struct {
 		ipFilter      *ipfilter.IPFilter
 		ipFilterChain *ipfilter.IPFilters
+		geoFilter     *geoip.Filter
 
 		host       string
 		hostRegexp string
@@ -82,6 +110,13 @@ type (
 	MuxPath struct {
 		ipFilter      *ipfilter.IPFilter
 		ipFilterChain *ipfilter.IPFilters
+		geoFilter     *geoip.Filter
+		// geoFilterChain are the geo filters of the server, the rule and
+		// the path.
+		geoFilterChain []*geoip.Filter
+		countries      []string
+		schedule       *timetool.Schedule
+		expr           *expression.Expression
 
 		path              string
 		pathPrefix        string
@@ -93,6 +128,14 @@ type (
 		headers           []*Header
 		clientMaxBodySize int64
 		matchAllHeader    bool
+		queries           []*Query
+		matchAllQuery     bool
+
+		readTimeout   time.Duration
+		writeTimeout  time.Duration
+		idleTimeout   time.Duration
+		maxHeaderSize int64
+		maxStreams    int64
 	}
 
 	route struct {
@@ -109,7 +152,7 @@ var (
 )
 
 // newIPFilterChain returns nil if the number of final filters is zero.
-func newIPFilterChain(parentIPFilters *ipfilter.IPFilters, childSpec *ipfilter.Spec) *ipfilter.IPFilters {
+func newIPFilterChain(parentIPFilters *ipfilter.IPFilters, childSpec *ipfilter.Spec, getSet ipfilter.SetGetter) *ipfilter.IPFilters {
 	var ipFilters *ipfilter.IPFilters
 	if parentIPFilters != nil {
 		ipFilters = ipfilter.NewIPFilters(parentIPFilters.Filters()...)
@@ -118,7 +161,7 @@ func newIPFilterChain(parentIPFilters *ipfilter.IPFilters, childSpec *ipfilter.S
 	}
 
 	if childSpec != nil {
-		ipFilters.Append(ipfilter.New(childSpec))
+		ipFilters.Append(ipfilter.NewWithSets(childSpec, getSet))
 	}
 
 	if len(ipFilters.Filters()) == 0 {
@@ -128,12 +171,12 @@ func newIPFilterChain(parentIPFilters *ipfilter.IPFilters, childSpec *ipfilter.S
 	return ipFilters
 }
 
-func newIPFilter(spec *ipfilter.Spec) *ipfilter.IPFilter {
+func newIPFilter(spec *ipfilter.Spec, getSet ipfilter.SetGetter) *ipfilter.IPFilter {
 	if spec == nil {
 		return nil
 	}
 
-	return ipfilter.New(spec)
+	return ipfilter.NewWithSets(spec, getSet)
 }
 
 func allowIP(ipFilter *ipfilter.IPFilter, ip string) bool {
@@ -144,6 +187,42 @@ func allowIP(ipFilter *ipfilter.IPFilter, ip string) bool {
 	return ipFilter.Allow(ip)
 }
 
+func newGeoFilter(spec *geoip.FilterSpec) *geoip.Filter {
+	if spec == nil {
+		return nil
+	}
+
+	return geoip.NewFilter(spec)
+}
+
+// newGeoFilterChain returns a new chain of the parent filters and the
+// child filter.
+func newGeoFilterChain(parent []*geoip.Filter, child *geoip.Filter) []*geoip.Filter {
+	chain := make([]*geoip.Filter, len(parent), len(parent)+1)
+	copy(chain, parent)
+	if child != nil {
+		chain = append(chain, child)
+	}
+	return chain
+}
+
+func allowGeo(geoFilter *geoip.Filter, loc *geoip.Location) bool {
+	if geoFilter == nil {
+		return true
+	}
+
+	return geoFilter.Allow(loc)
+}
+
+func allowGeoChain(chain []*geoip.Filter, loc *geoip.Location) bool {
+	for _, f := range chain {
+		if !f.Allow(loc) {
+			return false
+		}
+	}
+	return true
+}
+
 func (mi *muxInstance) getRouteFromCache(req *httpprot.Request) *route {
 	if mi.cache != nil {
 		key := stringtool.Cat(req.Host(), req.Method(), req.Path())
@@ -161,7 +240,7 @@ func (mi *muxInstance) putRouteToCache(req *httpprot.Request, r *route) {
 	}
 }
 
-func newMuxRule(parentIPFilters *ipfilter.IPFilters, rule *Rule, paths []*MuxPath) *muxRule {
+func newMuxRule(parentIPFilters *ipfilter.IPFilters, rule *Rule, paths []*MuxPath, getSet ipfilter.SetGetter) *muxRule {
 	var hostRE *regexp.Regexp
 
 	if rule.HostRegexp != "" {
@@ -174,8 +253,9 @@ func newMuxRule(parentIPFilters *ipfilter.IPFilters, rule *Rule, paths []*MuxPat
 	}
 
 	return &muxRule{
-		ipFilter:      newIPFilter(rule.IPFilter),
-		ipFilterChain: newIPFilterChain(parentIPFilters, rule.IPFilter),
+		ipFilter:      newIPFilter(rule.IPFilter, getSet),
+		ipFilterChain: newIPFilterChain(parentIPFilters, rule.IPFilter, getSet),
+		geoFilter:     newGeoFilter(rule.GeoFilter),
 
 		host:       rule.Host,
 		hostRegexp: rule.HostRegexp,
@@ -204,7 +284,7 @@ func (mr *muxRule) match(r *httpprot.Request) bool {
 	return false
 }
 
-func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *MuxPath {
+func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path, getSet ipfilter.SetGetter) *MuxPath {
 	var pathRE *regexp.Regexp
 	if path.PathRegexp != "" {
 		var err error
@@ -218,10 +298,37 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *MuxPath {
 	for _, p := range path.Headers {
 		p.initHeaderRoute()
 	}
+	for _, q := range path.Queries {
+		q.initQueryRoute()
+	}
+
+	var schedule *timetool.Schedule
+	if path.Schedule != nil {
+		var err error
+		schedule, err = timetool.NewSchedule(path.Schedule)
+		// defensive programming
+		if err != nil {
+			logger.Errorf("BUG: create schedule failed: %v", err)
+		}
+	}
+
+	var expr *expression.Expression
+	if path.Expression != "" {
+		var err error
+		expr, err = expression.Compile(path.Expression)
+		// defensive programming
+		if err != nil {
+			logger.Errorf("BUG: compile expression %s failed: %v", path.Expression, err)
+		}
+	}
 
 	return &MuxPath{
-		ipFilter:      newIPFilter(path.IPFilter),
-		ipFilterChain: newIPFilterChain(parentIPFilters, path.IPFilter),
+		ipFilter:      newIPFilter(path.IPFilter, getSet),
+		ipFilterChain: newIPFilterChain(parentIPFilters, path.IPFilter, getSet),
+		geoFilter:     newGeoFilter(path.GeoFilter),
+		countries:     path.Countries,
+		schedule:      schedule,
+		expr:          expr,
 
 		path:              path.Path,
 		pathPrefix:        path.PathPrefix,
@@ -233,6 +340,51 @@ func newMuxPath(parentIPFilters *ipfilter.IPFilters, path *Path) *MuxPath {
 		headers:           path.Headers,
 		clientMaxBodySize: path.ClientMaxBodySize,
 		matchAllHeader:    path.MatchAllHeader,
+		queries:           path.Queries,
+		matchAllQuery:     path.MatchAllQuery,
+
+		readTimeout:   parseDuration(path.ReadTimeout),
+		writeTimeout:  parseDuration(path.WriteTimeout),
+		idleTimeout:   parseDuration(path.IdleTimeout),
+		maxHeaderSize: path.MaxHeaderSize,
+		maxStreams:    path.MaxStreams,
+	}
+}
+
+// parseDuration parses a duration which has been validated, an empty
+// string means zero.
+func parseDuration(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	// defensive programming
+	if err != nil {
+		logger.Errorf("BUG: parse duration %s failed: %v", s, err)
+	}
+	return d
+}
+
+// inheritRuleOptions inherits the options of the rule which are not set
+// by the path.
+func (mp *MuxPath) inheritRuleOptions(rule *Rule) {
+	if mp.readTimeout == 0 {
+		mp.readTimeout = parseDuration(rule.ReadTimeout)
+	}
+	if mp.writeTimeout == 0 {
+		mp.writeTimeout = parseDuration(rule.WriteTimeout)
+	}
+	if mp.idleTimeout == 0 {
+		mp.idleTimeout = parseDuration(rule.IdleTimeout)
+	}
+	if mp.clientMaxBodySize == 0 {
+		mp.clientMaxBodySize = rule.ClientMaxBodySize
+	}
+	if mp.maxHeaderSize == 0 {
+		mp.maxHeaderSize = rule.MaxHeaderSize
+	}
+	if mp.maxStreams == 0 {
+		mp.maxStreams = rule.MaxStreams
 	}
 }
 
@@ -255,6 +407,21 @@ func (mp *MuxPath) matchPath(r *httpprot.Request) bool {
 	return false
 }
 
+// pathTemplate returns the path pattern matching r, it should be called
+// before rewriting the request. A path prefix is suffixed with "*".
+func (mp *MuxPath) pathTemplate(r *httpprot.Request) string {
+	path := r.Path()
+	switch {
+	case mp.path != "" && mp.path == path:
+		return mp.path
+	case mp.pathPrefix != "" && strings.HasPrefix(path, mp.pathPrefix):
+		return mp.pathPrefix + "*"
+	case mp.pathRE != nil:
+		return mp.pathRegexp
+	}
+	return "*"
+}
+
 func (mp *MuxPath) rewrite(r *httpprot.Request) {
 	if mp.rewriteTarget == "" {
 		return
@@ -314,10 +481,42 @@ func (mp *MuxPath) matchHeaders(r *httpprot.Request) bool {
 	return mp.matchAllHeader
 }
 
+func (mp *MuxPath) matchQueries(r *httpprot.Request) bool {
+	query := r.URL().Query()
+
+	if mp.matchAllQuery {
+		for _, q := range mp.queries {
+			v := query.Get(q.Key)
+			if len(q.Values) > 0 && !stringtool.StrInSlice(v, q.Values) {
+				return false
+			}
+
+			if q.Regexp != "" && !q.re.MatchString(v) {
+				return false
+			}
+		}
+	} else {
+		for _, q := range mp.queries {
+			v := query.Get(q.Key)
+			if stringtool.StrInSlice(v, q.Values) {
+				return true
+			}
+
+			if q.Regexp != "" && q.re.MatchString(v) {
+				return true
+			}
+		}
+	}
+
+	return mp.matchAllQuery
+}
+
 func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN, mapper context.MuxMapper) *mux {
 	m := &mux{
-		httpStat: httpStat,
-		topN:     topN,
+		httpStat:  httpStat,
+		topN:      topN,
+		resources: resources.NewTracker(nil),
+		streams:   newStreamTracker(),
 	}
 
 	m.inst.Store(&muxInstance{
@@ -326,6 +525,8 @@ func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN, mapper context.Mux
 		muxMapper: mapper,
 		httpStat:  httpStat,
 		topN:      topN,
+		resources: m.resources,
+		streams:   m.streams,
 	})
 
 	return m
@@ -348,23 +549,47 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 			logger.Errorf("create tracing failed: %v", err)
 		} else {
 			tracer = tracer0
+			tracer.RegisterMetrics(superSpec.Name())
 		}
 	} else if oldInst.tracer != nil {
 		tracer = oldInst.tracer
 	}
 
+	// The IPSets are looked up by the IP filters on every request, so
+	// that they could be updated without reloading the server.
+	getSet := ipset.SetGetter(superSpec.Super())
+
 	inst := &muxInstance{
 		superSpec:    superSpec,
 		spec:         spec,
 		muxMapper:    muxMapper,
 		httpStat:     m.httpStat,
 		topN:         m.topN,
-		ipFilter:     newIPFilter(spec.IPFilter),
-		ipFilterChan: newIPFilterChain(nil, spec.IPFilter),
+		resources:    m.resources,
+		streams:      m.streams,
+		ipFilter:     newIPFilter(spec.IPFilter, getSet),
+		ipFilterChan: newIPFilterChain(nil, spec.IPFilter, getSet),
+		geoFilter:    newGeoFilter(spec.GeoFilter),
+		redirectors:  newRedirectors(spec.Redirects),
+		clientIP:     newClientIPResolver(spec.ClientIP),
+		requestID:    newRequestIDGenerator(spec.RequestID, superSpec.Super()),
 		rules:        make([]*muxRule, len(spec.Rules)),
 		tracer:       tracer,
 	}
 
+	// The GeoIP resolver is reused if the databases are not changed.
+	if spec.GeoIP != nil {
+		if oldInst.geoResolver != nil && reflect.DeepEqual(oldInst.spec.GeoIP, spec.GeoIP) {
+			inst.geoResolver = oldInst.geoResolver
+		} else {
+			inst.geoResolver = geoip.NewResolver(spec.GeoIP)
+		}
+	}
+	if oldInst.geoResolver != nil && oldInst.geoResolver != inst.geoResolver {
+		oldInst.geoResolver.Close()
+	}
+	serverGeoChain := newGeoFilterChain(nil, inst.geoFilter)
+
 	if spec.CacheSize > 0 {
 		arc, err := lru.NewARC(int(spec.CacheSize))
 		if err != nil {
@@ -373,20 +598,38 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 		inst.cache = arc
 	}
 
+	// Sort the rules and paths by priority, the stable sort keeps the
+	// order of the ones with the same priority. The spec is not changed.
+	specRules := make([]*Rule, len(spec.Rules))
+	copy(specRules, spec.Rules)
+	sort.SliceStable(specRules, func(i, j int) bool {
+		return specRules[i].Priority > specRules[j].Priority
+	})
+
 	for i := 0; i < len(inst.rules); i++ {
-		specRule := spec.Rules[i]
+		specRule := specRules[i]
+
+		ruleIPFilterChain := newIPFilterChain(inst.ipFilterChan, specRule.IPFilter, getSet)
+		ruleGeoChain := newGeoFilterChain(serverGeoChain, newGeoFilter(specRule.GeoFilter))
 
-		ruleIPFilterChain := newIPFilterChain(inst.ipFilterChan, specRule.IPFilter)
+		specPaths := make([]*Path, len(specRule.Paths))
+		copy(specPaths, specRule.Paths)
+		sort.SliceStable(specPaths, func(i, j int) bool {
+			return specPaths[i].Priority > specPaths[j].Priority
+		})
 
-		paths := make([]*MuxPath, len(specRule.Paths))
+		paths := make([]*MuxPath, len(specPaths))
 		for j := 0; j < len(paths); j++ {
-			paths[j] = newMuxPath(ruleIPFilterChain, specRule.Paths[j])
+			paths[j] = newMuxPath(ruleIPFilterChain, specPaths[j], getSet)
+			paths[j].geoFilterChain = newGeoFilterChain(ruleGeoChain, paths[j].geoFilter)
+			paths[j].inheritRuleOptions(specRule)
 		}
 
 		// NOTE: Given the parent ipFilters not its own.
-		inst.rules[i] = newMuxRule(inst.ipFilterChan, specRule, paths)
+		inst.rules[i] = newMuxRule(inst.ipFilterChan, specRule, paths, getSet)
 	}
 
+	m.resources.SetLimits(spec.Limits)
 	m.inst.Store(inst)
 }
 
@@ -400,6 +643,15 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		return
 	}
 
+	graceupdate.BeginRequest()
+	defer graceupdate.EndRequest()
+
+	// Ask the client to close the connection while the member is draining,
+	// which also makes the HTTP/2 server send GOAWAY.
+	if graceupdate.IsDraining() {
+		stdw.Header().Set("Connection", "close")
+	}
+
 	// Forward to the current muxInstance to handle the request.
 	m.inst.Load().(*muxInstance).serveHTTP(stdw, stdr)
 }
@@ -418,11 +670,24 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	stdr.Body = body
 
 	startAt := fasttime.Now()
-	span := mi.tracer.NewSpanWithStart(mi.superSpec.Name(), startAt)
+	span := mi.tracer.NewSpanFromHTTP(mi.superSpec.Name(), startAt, stdr)
 	ctx := context.New(span)
+	ctx.SetData(httpprot.ResponseWriterKey, stdw)
 
 	// httpprot.NewRequest never returns an error.
 	req, _ := httpprot.NewRequest(stdr)
+	if mi.clientIP != nil {
+		req.SetRealIP(mi.clientIP.Resolve(stdr))
+	}
+
+	// requestID is empty if the request IDs are disabled.
+	var requestID string
+	if mi.requestID != nil {
+		requestID = mi.requestID.Resolve(req.HTTPHeader())
+		req.SetRequestID(requestID)
+		ctx.SetData(httpprot.RequestIDKey, requestID)
+		span.Tag(tracing.TagRequestID, requestID)
+	}
 
 	// Calculate the meta size now, as everything could be modified.
 	reqMetaSize := req.MetaSize()
@@ -431,6 +696,24 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	// get topN here, as the path could be modified later.
 	topN := mi.topN.Stat(req.Path())
 
+	// start the capture before the request is modified by the filters.
+	capture := trafficcapture.Start(mi.superSpec.Name(), stdr)
+
+	// the header policy is looked up only once, so that the request and
+	// the response are handled by the same one.
+	headerPolicy := mi.getHeaderPolicy()
+
+	// backend is the name of the matched pipeline, and routePath is the
+	// path pattern of the matched route.
+	var backend, routePath string
+	// restoreTimeouts restores the timeouts changed by the route.
+	restoreTimeouts := func() {}
+	// endRequest releases the resources of the request.
+	endRequest := func(respBodyBytes int64) {}
+	// openStream is the stream of the request, it is nil if the request
+	// is not a WebSocket or Server-Sent Events stream.
+	var openStream *stream
+
 	defer func() {
 		var resp *httpprot.Response
 		if v := ctx.GetResponse(context.DefaultNamespace); v == nil {
@@ -443,19 +726,61 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 			resp = r
 		}
 
-		// Send the response.
-		header := stdw.Header()
-		for k, v := range resp.HTTPHeader() {
-			header[k] = v
+		// Send the response, unless the connection has been taken over
+		// by a filter, e.g. WebSocketProxy.
+		var respBodySize int64
+		if resp.StatusCode() != http.StatusSwitchingProtocols {
+			// Headers may have been set to the writer by filters, e.g.
+			// the cookies of OIDCAuth, so append instead of overwriting.
+			header := stdw.Header()
+			for k, v := range resp.HTTPHeader() {
+				if values := header[k]; len(values) > 0 {
+					header[k] = append(values, v...)
+				} else {
+					// share the values instead of copying them, the
+					// capacity is limited so that appending to them
+					// later doesn't modify the response.
+					header[k] = v[:len(v):len(v)]
+				}
+			}
+			if headerPolicy != nil {
+				headerPolicy.ApplyResponse(header, req.Scheme() == "https")
+			}
+			if requestID != "" && mi.requestID.ResponseHeader() {
+				header.Set(mi.requestID.Header(), requestID)
+			}
+			// the buffered response body is accounted while sending.
+			var bufferedBytes int64
+			if !resp.IsStream() {
+				bufferedBytes = int64(len(resp.RawPayload()))
+				mi.resources.AddBufferedBodyBytes(bufferedBytes)
+			}
+			// an event stream not requested as one is tracked but not
+			// limited.
+			if openStream == nil && routePath != "" && resp.IsStream() && httpprot.IsEventStream(resp.HTTPHeader()) {
+				openStream = mi.streams.begin(mi.superSpec.Name(), routePath, streamSSE, 0, startAt)
+			}
+			stdw.WriteHeader(resp.StatusCode())
+			w := responseWriter(stdw, resp)
+			if openStream != nil {
+				w = &streamWriter{w: w, stream: openStream}
+			}
+			respBodySize, _ = io.Copy(w, resp.GetPayload())
+			endRequest(bufferedBytes)
+		} else {
+			endRequest(0)
 		}
-		stdw.WriteHeader(resp.StatusCode())
-		respBodySize, _ := io.Copy(stdw, resp.GetPayload())
 
 		ctx.Finish()
+		restoreTimeouts()
 
 		// Drain off the body if it has not been, so that we can get the
 		// correct body size.
 		io.Copy(io.Discard, body)
+		if openStream != nil {
+			openStream.addReceived(int(body.BytesRead()))
+			openStream.end(fasttime.Now())
+		}
 
 		metric := httpstat.Metric{
 			StatusCode: resp.StatusCode(),
@@ -466,6 +791,7 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		topN.Stat(&metric)
 		mi.httpStat.Stat(&metric)
 
+		span.Tag(tracing.TagHTTPStatusCode, strconv.Itoa(resp.StatusCode()))
 		span.Finish()
 
 		// Write access log.
@@ -483,8 +809,62 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 				stdr.Proto, resp.StatusCode(), metric.Duration, metric.ReqSize,
 				metric.RespSize, ctx.Tags())
 		})
+
+		if capture != nil {
+			var respBody []byte
+			if !resp.IsStream() {
+				respBody = resp.RawPayload()
+			}
+			capture.Finish(resp.StatusCode(), stdw.Header(), respBody, metric.Duration)
+		}
+
+		if al := mi.getAccessLog(); al != nil {
+			upstream, _ := ctx.GetData(httpprot.UpstreamKey).(string)
+			al.Log(&accesslog.Entry{
+				StartTime:        startAt,
+				RequestID:        requestID,
+				Server:           mi.superSpec.Name(),
+				Pipeline:         backend,
+				Route:            routePath,
+				Upstream:         upstream,
+				RemoteAddr:       stdr.RemoteAddr,
+				RealIP:           req.RealIP(),
+				Method:           stdr.Method,
+				Host:             stdr.Host,
+				Path:             stdr.URL.Path,
+				URI:              stdr.RequestURI,
+				Proto:            stdr.Proto,
+				StatusCode:       resp.StatusCode(),
+				Duration:         metric.Duration,
+				RequestSize:      metric.ReqSize,
+				ResponseSize:     metric.RespSize,
+				ResponseBodySize: respBodySize,
+				Tags:             ctx.Tags(),
+				RequestHeader:    stdr.Header,
+				ResponseHeader:   stdw.Header(),
+			})
+		}
+
+		// the context is recycled, as nothing refers to it now.
+		ctx.Release()
 	}()
 
+	span.TagFromHeaders(stdr.Header)
+	span.TagFromContext(tracing.AttributeMethod, req.Method())
+	span.TagFromContext(tracing.AttributePath, req.Path())
+	span.TagFromContext(tracing.AttributeClientIP, req.RealIP())
+
+	if headerPolicy != nil {
+		headerPolicy.ApplyRequest(req.HTTPHeader())
+	}
+
+	if code, location := mi.redirect(req); code != 0 {
+		logger.Debugf("%s: redirect [%s %s] to %s", mi.superSpec.Name(), req.Method(), req.RequestURI, location)
+		resp := buildFailureResponse(ctx, code)
+		resp.HTTPHeader().Set("Location", location)
+		return
+	}
+
 	route := mi.search(req)
 	if route.code != 0 {
 		logger.Debugf("%s: status code of result route for [%s %s]: %d", mi.superSpec.Name(), req.Method(), req.RequestURI, route.code)
@@ -499,6 +879,42 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		return
 	}
 	logger.Debugf("%s: the matched backend(Pipeline) for [%s %s] is %q", mi.superSpec.Name(), req.Method(), req.RequestURI, route.path.backend)
+	span.Tag(tracing.TagPipeline, route.path.backend)
+	backend = route.path.backend
+	routePath = route.path.pathTemplate(req)
+	span.TagFromContext(tracing.AttributePathTemplate, routePath)
+
+	// Shed the request before reading the body, to save the resources.
+	if ls := mi.getLoadShedder(); ls != nil && !ls.Admit(req.HTTPHeader(), backend) {
+		logger.Debugf("%s: request to %q is shed", mi.superSpec.Name(), backend)
+		ctx.AddTag("load shed")
+		resp := buildFailureResponse(ctx, http.StatusServiceUnavailable)
+		resp.HTTPHeader().Set("Retry-After", ls.RetryAfter())
+		return
+	}
+
+	// Limit the streams before reading the body, as they are long-lived.
+	if kind := streamKind(req); kind != "" {
+		openStream = mi.streams.begin(mi.superSpec.Name(), routePath, kind, route.path.maxStreams, startAt)
+		if openStream == nil {
+			logger.Debugf("%s: %s stream to %q is rejected by the max streams of the route", mi.superSpec.Name(), kind, routePath)
+			ctx.AddTag("stream limited")
+			resp := buildFailureResponse(ctx, http.StatusServiceUnavailable)
+			resp.HTTPHeader().Set("Retry-After", streamRetryAfter)
+			return
+		}
+		if kind == streamWebSocket {
+			// count the bytes of the connection taken over by filters.
+			ctx.SetData(httpprot.ResponseWriterKey, &streamResponseWriter{ResponseWriter: stdw, stream: openStream})
+		}
+	}
+
+	if route.path.maxHeaderSize > 0 && reqMetaSize > route.path.maxHeaderSize {
+		logger.Debugf("%s: header size %d exceeds the limit of the route", mi.superSpec.Name(), reqMetaSize)
+		buildFailureResponse(ctx, http.StatusRequestHeaderFieldsTooLarge)
+		return
+	}
+	restoreTimeouts = applyRouteTimeouts(req, route.path)
 
 	route.path.rewrite(req)
 	if mi.spec.XForwardedFor {
@@ -509,20 +925,66 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	if maxBodySize == 0 {
 		maxBodySize = mi.spec.ClientMaxBodySize
 	}
+
+	globalFilter := mi.getGlobalFilter()
+	if mi.spec.StreamBody {
+		reqBody, respBody := requiresBody(handler, globalFilter)
+		if !reqBody {
+			maxBodySize = -1
+		}
+		ctx.SetStreamResponse(!respBody)
+	}
+
+	// Account the request before reading the body, so that the body is
+	// not read if the server runs out of resources. The size of a chunked
+	// body is only known after reading.
+	var reqBodyBytes int64
+	if maxBodySize >= 0 && stdr.ContentLength > 0 {
+		reqBodyBytes = stdr.ContentLength
+	}
+	if !mi.resources.BeginRequest(reqBodyBytes) {
+		logger.Debugf("%s: request to %q is rejected by the resource limits", mi.superSpec.Name(), backend)
+		ctx.AddTag("resource limited")
+		buildFailureResponse(ctx, http.StatusServiceUnavailable)
+		return
+	}
+	endRequest = func(respBodyBytes int64) {
+		mi.resources.EndRequest(reqBodyBytes + respBodyBytes)
+	}
+
 	err := req.FetchPayload(maxBodySize)
+	if err == nil && stdr.ContentLength < 0 && !req.IsStream() {
+		n := int64(len(req.RawPayload()))
+		mi.resources.AddBufferedBodyBytes(n)
+		reqBodyBytes += n
+	}
+	if tc := getTrackedConn(stdr); tc != nil && err == nil && route.path.readTimeout > 0 && !req.IsStream() {
+		// The body has been read, clear the deadline so that the
+		// connection is not broken while the request is being handled.
+		tc.SetReadDeadline(time.Time{})
+	}
 	if err == httpprot.ErrRequestEntityTooLarge {
 		logger.Debugf("%s: %s", mi.superSpec.Name(), err.Error())
 		buildFailureResponse(ctx, http.StatusRequestEntityTooLarge)
 		return
 	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		logger.Debugf("%s: read request body timeout: %v", mi.superSpec.Name(), err)
+		buildFailureResponse(ctx, http.StatusRequestTimeout)
+		return
+	}
 	if err != nil {
 		logger.Debugf("%s: failed to read request body: %v", mi.superSpec.Name(), err)
 		buildFailureResponse(ctx, http.StatusBadRequest)
 		return
 	}
 
+	if capture != nil && !req.IsStream() {
+		capture.SetRequestBody(req.RawPayload())
+	}
+
 	// global filter
-	globalFilter := mi.getGlobalFilter()
 	if globalFilter == nil {
 		handler.Handle(ctx)
 	} else {
@@ -530,29 +992,135 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	}
 }
 
+// requiresBody returns whether the handler or the global filter requires
+// the full bodies of the requests and responses.
+func requiresBody(handler context.Handler, globalFilter *globalfilter.GlobalFilter) (request, response bool) {
+	request, response = true, true
+	if br, ok := handler.(filters.BodyRequirer); ok {
+		request, response = br.RequiresBody()
+	}
+	if globalFilter != nil {
+		reqBody, respBody := globalFilter.RequiresBody()
+		request = request || reqBody
+		response = response || respBody
+	}
+	return
+}
+
+// applyRouteTimeouts applies the timeouts of the route to the request and
+// its connection, the returned function restores them and must be called
+// after the response is sent.
+//
+// The read and write timeouts start when the request is routed, the write
+// timeout is also the deadline of the request context, so that the
+// handling of the request is canceled once it is exceeded. The deadlines
+// of the connection are only set for HTTP/1 requests.
+func applyRouteTimeouts(req *httpprot.Request, mp *MuxPath) func() {
+	tc := getTrackedConn(req.Std())
+	now := time.Now()
+
+	if tc != nil && mp.readTimeout > 0 {
+		tc.SetReadDeadline(now.Add(mp.readTimeout))
+	}
+	if tc != nil && mp.idleTimeout > 0 {
+		tc.setIdleTimeout(mp.idleTimeout)
+	}
+	if mp.writeTimeout == 0 {
+		return func() {}
+	}
+
+	ctx, cancel := stdcontext.WithDeadline(req.Context(), now.Add(mp.writeTimeout))
+	req.Request = req.Std().WithContext(ctx)
+	if tc != nil {
+		tc.SetWriteDeadline(now.Add(mp.writeTimeout))
+	}
+
+	return func() {
+		cancel()
+		if tc != nil {
+			tc.SetWriteDeadline(time.Time{})
+		}
+	}
+}
+
+// responseWriter returns the writer to send the payload of resp, events of
+// a Server-Sent Events stream are flushed to the client one by one.
+func responseWriter(stdw http.ResponseWriter, resp *httpprot.Response) io.Writer {
+	f, ok := stdw.(http.Flusher)
+	if !ok || !resp.IsStream() || !httpprot.IsEventStream(resp.HTTPHeader()) {
+		return stdw
+	}
+	f.Flush()
+	return &flushWriter{w: stdw, f: f}
+}
+
+// flushWriter flushes after every write.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
+func newClientIPResolver(spec *clientip.Spec) *clientip.Resolver {
+	if spec == nil {
+		return nil
+	}
+	return clientip.NewResolver(spec)
+}
+
+func newRequestIDGenerator(spec *requestid.Spec, super *supervisor.Supervisor) *requestid.Generator {
+	if spec == nil {
+		return nil
+	}
+	var member string
+	if super != nil && super.Options() != nil {
+		member = super.Options().Name
+	}
+	return requestid.NewGenerator(spec, member)
+}
+
+// lookupLocation returns the location of the ip, it returns nil if GeoIP
+// is not enabled.
+func (mi *muxInstance) lookupLocation(ip string) *geoip.Location {
+	if mi.geoResolver == nil {
+		return nil
+	}
+	return mi.geoResolver.Lookup(ip)
+}
+
 func (mi *muxInstance) search(req *httpprot.Request) *route {
-	headerMismatch, methodMismatch := false, false
+	headerMismatch, queryMismatch, methodMismatch := false, false, false
+	// geoMismatch, scheduleMismatch and exprMismatch are true if a path is
+	// skipped by the country of the client, the time or the expression,
+	// the result can't be cached.
+	geoMismatch, scheduleMismatch, exprMismatch := false, false, false
 
 	ip := req.RealIP()
+	loc := mi.lookupLocation(ip)
 
 	// The key of the cache is req.Host + req.Method + req.URL.Path,
 	// and if a path is cached, we are sure it does not contain any
-	// headers.
+	// headers or queries.
 	r := mi.getRouteFromCache(req)
 	if r != nil {
 		if r.code != 0 {
 			return r
 		}
-		if r.path.ipFilterChain == nil {
-			return r
+		if r.path.ipFilterChain != nil && !r.path.ipFilterChain.Allow(ip) {
+			return forbidden
 		}
-		if r.path.ipFilterChain.Allow(ip) {
-			return r
+		if !allowGeoChain(r.path.geoFilterChain, loc) {
+			return forbidden
 		}
-		return forbidden
+		return r
 	}
 
-	if !allowIP(mi.ipFilter, ip) {
+	if !allowIP(mi.ipFilter, ip) || !allowGeo(mi.geoFilter, loc) {
 		return forbidden
 	}
 
@@ -561,7 +1129,7 @@ func (mi *muxInstance) search(req *httpprot.Request) *route {
 			continue
 		}
 
-		if !allowIP(host.ipFilter, ip) {
+		if !allowIP(host.ipFilter, ip) || !allowGeo(host.geoFilter, loc) {
 			return forbidden
 		}
 
@@ -575,16 +1143,41 @@ func (mi *muxInstance) search(req *httpprot.Request) *route {
 				continue
 			}
 
-			// The path can be put into the cache if it has no headers.
-			if len(path.headers) == 0 {
+			// The path routes by the country of the client.
+			if len(path.countries) > 0 && !geoip.MatchCountry(loc, path.countries) {
+				geoMismatch = true
+				continue
+			}
+
+			// The path routes by the time.
+			if path.schedule != nil && !path.schedule.Match(time.Now()) {
+				scheduleMismatch = true
+				continue
+			}
+
+			// The path routes by the expression.
+			if path.expr != nil && !path.expr.Match(req) {
+				exprMismatch = true
+				continue
+			}
+
+			// The path can be put into the cache if it has no headers,
+			// queries, countries, schedule and expression, and no path is
+			// skipped by them, because the result depends on the country
+			// of the client, the time or the whole request.
+			if len(path.headers) == 0 && len(path.queries) == 0 && len(path.countries) == 0 &&
+				path.schedule == nil && path.expr == nil && !geoMismatch && !scheduleMismatch && !exprMismatch {
 				r = &route{code: 0, path: path}
 				mi.putRouteToCache(req, r)
-			} else if !path.matchHeaders(req) {
+			} else if len(path.headers) > 0 && !path.matchHeaders(req) {
 				headerMismatch = true
 				continue
+			} else if len(path.queries) > 0 && !path.matchQueries(req) {
+				queryMismatch = true
+				continue
 			}
 
-			if !allowIP(path.ipFilter, ip) {
+			if !allowIP(path.ipFilter, ip) || !allowGeo(path.geoFilter, loc) {
 				return forbidden
 			}
 
@@ -592,7 +1185,7 @@ func (mi *muxInstance) search(req *httpprot.Request) *route {
 		}
 	}
 
-	if headerMismatch {
+	if headerMismatch || queryMismatch {
 		return badRequest
 	}
 
@@ -601,6 +1194,12 @@ func (mi *muxInstance) search(req *httpprot.Request) *route {
 		return methodNotAllowed
 	}
 
+	// The result depends on the country of the client, the time or the
+	// expression, so it can't be cached.
+	if geoMismatch || scheduleMismatch || exprMismatch {
+		return notFound
+	}
+
 	mi.putRouteToCache(req, notFound)
 	return notFound
 }
@@ -637,10 +1236,58 @@ func (mi *muxInstance) getGlobalFilter() *globalfilter.GlobalFilter {
 	return globalFilterInstance
 }
 
+func (mi *muxInstance) getAccessLog() *accesslog.AccessLog {
+	if mi.spec.AccessLog == "" {
+		return nil
+	}
+	entity, ok := mi.superSpec.Super().GetBusinessController(mi.spec.AccessLog)
+	if entity == nil || !ok {
+		return nil
+	}
+	al, ok := entity.Instance().(*accesslog.AccessLog)
+	if !ok {
+		return nil
+	}
+	return al
+}
+
+func (mi *muxInstance) getLoadShedder() *loadshedder.LoadShedder {
+	if mi.spec.LoadShedder == "" {
+		return nil
+	}
+	entity, ok := mi.superSpec.Super().GetBusinessController(mi.spec.LoadShedder)
+	if entity == nil || !ok {
+		return nil
+	}
+	ls, ok := entity.Instance().(*loadshedder.LoadShedder)
+	if !ok {
+		return nil
+	}
+	return ls
+}
+
+func (mi *muxInstance) getHeaderPolicy() *headerpolicy.HeaderPolicy {
+	if mi.spec.HeaderPolicy == "" {
+		return nil
+	}
+	entity, ok := mi.superSpec.Super().GetBusinessController(mi.spec.HeaderPolicy)
+	if entity == nil || !ok {
+		return nil
+	}
+	hp, ok := entity.Instance().(*headerpolicy.HeaderPolicy)
+	if !ok {
+		return nil
+	}
+	return hp
+}
+
 func (mi *muxInstance) close() {
 	if err := mi.tracer.Close(); err != nil {
 		logger.Errorf("%s close tracer failed: %v", mi.superSpec.Name(), err)
 	}
+	if mi.geoResolver != nil {
+		mi.geoResolver.Close()
+	}
 }
 
 func (m *mux) close() {
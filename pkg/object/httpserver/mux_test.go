@@ -18,12 +18,19 @@
 package httpserver
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/context/contexttest"
@@ -31,29 +38,35 @@ import (
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/geoip"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/mmdb/mmdbtest"
+	"github.com/megaease/easegress/pkg/util/requestid"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/yl2chen/cidranger"
 )
 
 func TestNewIPFilterChain(t *testing.T) {
 	assert := assert.New(t)
 
-	assert.Nil(newIPFilterChain(nil, nil))
+	assert.Nil(newIPFilterChain(nil, nil, nil))
 
 	filters := newIPFilterChain(nil, &ipfilter.Spec{
 		AllowIPs: []string{"192.168.1.0/24"},
-	})
+	}, nil)
 	assert.NotNil(filters)
 
-	assert.NotNil(newIPFilterChain(filters, nil))
+	assert.NotNil(newIPFilterChain(filters, nil, nil))
 }
 
 func TestNewIPFilter(t *testing.T) {
 	assert := assert.New(t)
-	assert.Nil(newIPFilter(nil))
+	assert.Nil(newIPFilter(nil, nil))
 	assert.NotNil(newIPFilter(&ipfilter.Spec{
 		AllowIPs: []string{"192.168.1.0/24"},
-	}))
+	}, nil))
 }
 
 func TestAllowIP(t *testing.T) {
@@ -62,9 +75,30 @@ func TestAllowIP(t *testing.T) {
 	filter := newIPFilter(&ipfilter.Spec{
 		AllowIPs: []string{"192.168.1.0/24"},
 		BlockIPs: []string{"192.168.2.0/24"},
-	})
+	}, nil)
 	assert.True(allowIP(filter, "192.168.1.1"))
 	assert.False(allowIP(filter, "192.168.2.1"))
+
+	blocked := ipfilter.NewRanger([]string{"192.168.3.0/24"})
+	filter = newIPFilter(&ipfilter.Spec{
+		BlockSets: []string{"blocked"},
+	}, func(name string) ipfilter.Set {
+		if name == "blocked" {
+			return testSet{blocked}
+		}
+		return nil
+	})
+	assert.True(allowIP(filter, "192.168.1.1"))
+	assert.False(allowIP(filter, "192.168.3.1"))
+}
+
+type testSet struct {
+	ranger cidranger.Ranger
+}
+
+func (s testSet) Contains(ip net.IP) bool {
+	ok, _ := s.ranger.Contains(ip)
+	return ok
 }
 
 func TestMuxRule(t *testing.T) {
@@ -73,19 +107,19 @@ func TestMuxRule(t *testing.T) {
 	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com:8080", nil)
 	req, _ := httpprot.NewRequest(stdr)
 
-	rule := newMuxRule(nil, &Rule{}, nil)
+	rule := newMuxRule(nil, &Rule{}, nil, nil)
 	assert.NotNil(rule)
 	assert.True(rule.match(req))
 
-	rule = newMuxRule(nil, &Rule{Host: "www.megaease.com"}, nil)
+	rule = newMuxRule(nil, &Rule{Host: "www.megaease.com"}, nil, nil)
 	assert.NotNil(rule)
 	assert.True(rule.match(req))
 
-	rule = newMuxRule(nil, &Rule{HostRegexp: `^[^.]+\.megaease\.com$`}, nil)
+	rule = newMuxRule(nil, &Rule{HostRegexp: `^[^.]+\.megaease\.com$`}, nil, nil)
 	assert.NotNil(rule)
 	assert.True(rule.match(req))
 
-	rule = newMuxRule(nil, &Rule{HostRegexp: `^[^.]+\.megaease\.cn$`}, nil)
+	rule = newMuxRule(nil, &Rule{HostRegexp: `^[^.]+\.megaease\.cn$`}, nil, nil)
 	assert.NotNil(rule)
 	assert.False(rule.match(req))
 }
@@ -97,45 +131,45 @@ func TestMuxPath(t *testing.T) {
 	req, _ := httpprot.NewRequest(stdr)
 
 	// 1. match path
-	mp := newMuxPath(nil, &Path{})
+	mp := newMuxPath(nil, &Path{}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchPath(req))
 
 	// exact match
-	mp = newMuxPath(nil, &Path{Path: "/abc"})
+	mp = newMuxPath(nil, &Path{Path: "/abc"}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchPath(req))
 
 	// prefix
-	mp = newMuxPath(nil, &Path{PathPrefix: "/ab"})
+	mp = newMuxPath(nil, &Path{PathPrefix: "/ab"}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchPath(req))
 
 	// regexp
-	mp = newMuxPath(nil, &Path{PathRegexp: "/[a-z]+"})
+	mp = newMuxPath(nil, &Path{PathRegexp: "/[a-z]+"}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchPath(req))
 
 	// invalid regexp
-	mp = newMuxPath(nil, &Path{PathRegexp: "/[a-z+"})
+	mp = newMuxPath(nil, &Path{PathRegexp: "/[a-z+"}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchPath(req))
 
 	// not match
-	mp = newMuxPath(nil, &Path{Path: "/xyz"})
+	mp = newMuxPath(nil, &Path{Path: "/xyz"}, nil)
 	assert.NotNil(mp)
 	assert.False(mp.matchPath(req))
 
 	// 2. match method
-	mp = newMuxPath(nil, &Path{})
+	mp = newMuxPath(nil, &Path{}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchMethod(req))
 
-	mp = newMuxPath(nil, &Path{Methods: []string{http.MethodGet}})
+	mp = newMuxPath(nil, &Path{Methods: []string{http.MethodGet}}, nil)
 	assert.NotNil(mp)
 	assert.True(mp.matchMethod(req))
 
-	mp = newMuxPath(nil, &Path{Methods: []string{http.MethodPut}})
+	mp = newMuxPath(nil, &Path{Methods: []string{http.MethodPut}}, nil)
 	assert.NotNil(mp)
 	assert.False(mp.matchMethod(req))
 
@@ -145,38 +179,44 @@ func TestMuxPath(t *testing.T) {
 	mp = newMuxPath(nil, &Path{Headers: []*Header{{
 		Key:    "X-Test",
 		Values: []string{"test1", "test2"},
-	}}})
+	}}}, nil)
 	assert.True(mp.matchHeaders(req))
 
 	mp = newMuxPath(nil, &Path{Headers: []*Header{{
 		Key:    "X-Test",
 		Regexp: "test[0-9]",
-	}}})
+	}}}, nil)
 	assert.True(mp.matchHeaders(req))
 
 	mp = newMuxPath(nil, &Path{Headers: []*Header{{
 		Key:    "X-Test2",
 		Values: []string{"test1", "test2"},
-	}}})
+	}}}, nil)
 	assert.False(mp.matchHeaders(req))
 
-	// 4. rewrite
-	mp = newMuxPath(nil, &Path{Path: "/abc"})
+	// 4. path template
+	assert.Equal("/abc", newMuxPath(nil, &Path{Path: "/abc"}, nil).pathTemplate(req))
+	assert.Equal("/ab*", newMuxPath(nil, &Path{PathPrefix: "/ab"}, nil).pathTemplate(req))
+	assert.Equal("/[a-z]+", newMuxPath(nil, &Path{PathRegexp: "/[a-z]+"}, nil).pathTemplate(req))
+	assert.Equal("*", newMuxPath(nil, &Path{}, nil).pathTemplate(req))
+
+	// 5. rewrite
+	mp = newMuxPath(nil, &Path{Path: "/abc"}, nil)
 	assert.NotNil(mp)
 	mp.rewrite(req)
 	assert.Equal("/abc", req.Path())
 
-	mp = newMuxPath(nil, &Path{Path: "/abc", RewriteTarget: "/xyz"})
+	mp = newMuxPath(nil, &Path{Path: "/abc", RewriteTarget: "/xyz"}, nil)
 	assert.NotNil(mp)
 	mp.rewrite(req)
 	assert.Equal("/xyz", req.Path())
 
-	mp = newMuxPath(nil, &Path{PathPrefix: "/xy", RewriteTarget: "/ab"})
+	mp = newMuxPath(nil, &Path{PathPrefix: "/xy", RewriteTarget: "/ab"}, nil)
 	assert.NotNil(mp)
 	mp.rewrite(req)
 	assert.Equal("/abz", req.Path())
 
-	mp = newMuxPath(nil, &Path{PathRegexp: "/([a-z]+)", RewriteTarget: "/1$1"})
+	mp = newMuxPath(nil, &Path{PathRegexp: "/([a-z]+)", RewriteTarget: "/1$1"}, nil)
 	assert.NotNil(mp)
 	mp.rewrite(req)
 	assert.Equal("/1abz", req.Path())
@@ -227,6 +267,67 @@ rules:
 	m.close()
 }
 
+// gatherMetrics returns the metrics of the family name labeled with the
+// server in the default Prometheus registry, which is exposed by the API.
+func gatherMetrics(assert *assert.Assertions, name, server string) []*dto.Metric {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(err)
+
+	var result []*dto.Metric
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.Metric {
+			for _, l := range m.Label {
+				if l.GetName() == "server" && l.GetValue() == server {
+					result = append(result, m)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func TestTracingMetrics(t *testing.T) {
+	assert := assert.New(t)
+	m := newMux(&httpstat.HTTPStat{}, &httpstat.TopN{}, nil)
+
+	yamlConfig := `
+kind: HTTPServer
+name: tracing-metrics
+port: 8080
+tracing:
+  serviceName: %s
+  redMetrics: true
+  zipkin:
+    serverURL: http://test.megaease.com/zipkin
+    disableReport: true
+    sampleRate: 1
+`
+	superSpec, err := supervisor.NewSpec(fmt.Sprintf(yamlConfig, "test"))
+	assert.NoError(err)
+	m.reload(superSpec, nil)
+
+	m.inst.Load().(*muxInstance).tracer.NewSpan("op").Finish()
+	assert.Len(gatherMetrics(assert, "span_requests_total", "tracing-metrics"), 1)
+
+	// the metrics of the new tracer replace the old ones.
+	superSpec, err = supervisor.NewSpec(fmt.Sprintf(yamlConfig, "test2"))
+	assert.NoError(err)
+	assert.NotPanics(func() { m.reload(superSpec, nil) })
+	assert.Empty(gatherMetrics(assert, "span_requests_total", "tracing-metrics"))
+
+	m.inst.Load().(*muxInstance).tracer.NewSpan("op").Finish()
+	metrics := gatherMetrics(assert, "span_requests_total", "tracing-metrics")
+	assert.Len(metrics, 1)
+	assert.Equal(1.0, metrics[0].GetCounter().GetValue())
+
+	// the metrics are unregistered when the server is closed.
+	m.close()
+	assert.Empty(gatherMetrics(assert, "span_requests_total", "tracing-metrics"))
+}
+
 func TestBuildFailureResponse(t *testing.T) {
 	assert := assert.New(t)
 	ctx := context.New(tracing.NoopSpan)
@@ -234,6 +335,27 @@ func TestBuildFailureResponse(t *testing.T) {
 	assert.Equal(http.StatusNotFound, resp.StatusCode())
 }
 
+func TestResponseWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload(strings.NewReader("data: a\n\n"))
+
+	rw := httptest.NewRecorder()
+	_, ok := responseWriter(rw, resp).(*flushWriter)
+	assert.False(ok)
+
+	resp.HTTPHeader().Set("Content-Type", "text/event-stream")
+	w := responseWriter(rw, resp)
+	_, ok = w.(*flushWriter)
+	assert.True(ok)
+	assert.True(rw.Flushed)
+
+	rw.Flushed = false
+	w.Write([]byte("data: a\n\n"))
+	assert.True(rw.Flushed)
+}
+
 func TestAppendXForwardFor(t *testing.T) {
 	const xForwardedFor = "X-Forwarded-For"
 
@@ -311,6 +433,9 @@ rules:
   paths:
   - pathPrefix: /xyz
     backend: xyz-pipeline
+redirects:
+- host: megaease.com
+  targetHost: www.megaease.com
 `
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	assert.NoError(err)
@@ -346,6 +471,110 @@ rules:
 	stdw = httptest.NewRecorder()
 	m.ServeHTTP(stdw, stdr)
 	assert.Equal(http.StatusBadRequest, stdw.Code)
+
+	// redirected
+	stdr, _ = http.NewRequest(http.MethodGet, "http://megaease.com/abc", http.NoBody)
+	stdw = httptest.NewRecorder()
+	m.ServeHTTP(stdw, stdr)
+	assert.Equal(http.StatusMovedPermanently, stdw.Code)
+	assert.Equal("http://www.megaease.com/abc", stdw.Header().Get("Location"))
+}
+
+func TestClientIP(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+clientIP:
+  trustedCIDRs: [10.0.0.0/8]
+  headers: [CF-Connecting-IP, X-Forwarded-For]
+ipFilter:
+  blockIPs: [1.2.3.4]
+rules:
+- paths:
+  - pathPrefix: /
+    backend: pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	serve := func(remoteAddr, xff string) int {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", http.NoBody)
+		stdr.RemoteAddr = remoteAddr
+		stdr.Header.Set("X-Forwarded-For", xff)
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		return stdw.Code
+	}
+
+	// the header of a trusted proxy is used.
+	assert.Equal(http.StatusForbidden, serve("10.0.0.2:12345", "1.2.3.4, 10.0.0.3"))
+	// the header of an untrusted client is ignored.
+	assert.Equal(http.StatusServiceUnavailable, serve("5.6.7.8:12345", "1.2.3.4"))
+}
+
+func TestRequestID(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+requestID:
+  generator: snowflake
+  nodeID: 7
+  responseHeader: true
+rules:
+- paths:
+  - pathPrefix: /
+    backend: pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	var dataID, headerID string
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{MockedHandle: func(ctx *context.Context) string {
+			req := ctx.GetInputRequest().(*httpprot.Request)
+			dataID, _ = ctx.GetData(httpprot.RequestIDKey).(string)
+			headerID = req.HTTPHeader().Get(requestid.HeaderXRequestID)
+			assert.Equal(dataID, req.RequestID())
+			resp, _ := httpprot.NewResponse(nil)
+			ctx.SetOutputResponse(resp)
+			return ""
+		}}, true
+	}
+
+	// a new ID is generated.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", http.NoBody)
+	stdw := httptest.NewRecorder()
+	m.ServeHTTP(stdw, stdr)
+	assert.Equal(http.StatusOK, stdw.Code)
+	assert.NotEmpty(dataID)
+	assert.Equal(dataID, headerID)
+	assert.Equal(dataID, stdw.Header().Get(requestid.HeaderXRequestID))
+
+	// the incoming ID is honored.
+	stdr, _ = http.NewRequest(http.MethodGet, "http://www.megaease.com/", http.NoBody)
+	stdr.Header.Set(requestid.HeaderXRequestID, "abc-123")
+	stdw = httptest.NewRecorder()
+	m.ServeHTTP(stdw, stdr)
+	assert.Equal("abc-123", dataID)
+	assert.Equal("abc-123", stdw.Header().Get(requestid.HeaderXRequestID))
 }
 
 func TestMuxInstanceSearch(t *testing.T) {
@@ -487,3 +716,567 @@ rules:
 	req, _ = httpprot.NewRequest(stdr)
 	assert.Equal(400, mi.search(req).code)
 }
+
+func TestMuxInstanceSearchQueryAndPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), nil)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+cacheSize: 100
+rules:
+- paths:
+  - pathPrefix: /
+    backend: default-pipeline
+- host: www.megaease.com
+  priority: 10
+  paths:
+  - pathPrefix: /api
+    backend: api-pipeline
+  - pathPrefix: /api/v2
+    methods: [GET, POST]
+    queries:
+    - key: version
+      values: ["2"]
+    - key: beta
+      regexp: "^(true|1)$"
+    matchAllQuery: true
+    priority: 5
+    backend: v2-pipeline
+  - pathPrefix: /api/v2
+    headers:
+    - key: X-Version
+      regexp: "^2\\."
+    queries:
+    - key: version
+      values: ["2", "3"]
+    priority: 5
+    backend: v2-header-pipeline
+`
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, nil)
+	mi := m.inst.Load().(*muxInstance)
+
+	search := func(method, url string, header http.Header) *route {
+		stdr, _ := http.NewRequest(method, url, http.NoBody)
+		for k, v := range header {
+			stdr.Header[k] = v
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return mi.search(req)
+	}
+
+	// the rule with higher priority is matched first.
+	r := search(http.MethodGet, "http://www.megaease.com/api/v1", nil)
+	assert.Equal("api-pipeline", r.path.backend)
+	r = search(http.MethodGet, "http://www.megaease.cn/api/v1", nil)
+	assert.Equal("default-pipeline", r.path.backend)
+
+	// all queries are matched.
+	r = search(http.MethodGet, "http://www.megaease.com/api/v2/users?version=2&beta=1", nil)
+	assert.Equal("v2-pipeline", r.path.backend)
+
+	// the paths with queries are not cached.
+	r = search(http.MethodGet, "http://www.megaease.com/api/v2/users?version=2&beta=0", http.Header{"X-Version": []string{"2.1"}})
+	assert.Equal("v2-header-pipeline", r.path.backend)
+
+	// both headers and queries are required, the paths with lower
+	// priorities are matched if they are mismatched.
+	r = search(http.MethodGet, "http://www.megaease.com/api/v2/users?version=3", nil)
+	assert.Equal("api-pipeline", r.path.backend)
+	r = search(http.MethodPut, "http://www.megaease.com/api/v2/users?version=1", http.Header{"X-Version": []string{"2.1"}})
+	assert.Equal("api-pipeline", r.path.backend)
+
+	// the spec is not changed by sorting.
+	assert.Equal("default-pipeline", mi.spec.Rules[0].Paths[0].Backend)
+	assert.Equal("api-pipeline", mi.spec.Rules[1].Paths[0].Backend)
+
+	assert.Error((&Query{Key: "version"}).Validate())
+	assert.NoError((&Query{Key: "version", Regexp: ".*"}).Validate())
+}
+
+func TestMuxInstanceSearchGeo(t *testing.T) {
+	assert := assert.New(t)
+
+	db, err := mmdbtest.Build(6, 24, map[string]interface{}{
+		"192.0.2.0/24":    map[string]interface{}{"country": map[string]interface{}{"iso_code": "DE"}},
+		"198.51.100.0/24": map[string]interface{}{"country": map[string]interface{}{"iso_code": "CN"}},
+		"203.0.113.0/24": map[string]interface{}{
+			"country":                  map[string]interface{}{"iso_code": "US"},
+			"autonomous_system_number": uint64(64500),
+		},
+	})
+	assert.NoError(err)
+	dbFile := filepath.Join(t.TempDir(), "geo.mmdb")
+	assert.NoError(os.WriteFile(dbFile, db, 0o644))
+
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), nil)
+	defer m.close()
+
+	yamlConfig := fmt.Sprintf(`
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+cacheSize: 100
+geoIP:
+  databases: [%s]
+geoFilter:
+  blockCountries: [CN]
+rules:
+- host: www.megaease.cn
+  geoFilter:
+    blockASNs: [64500]
+  paths:
+  - pathPrefix: /
+    countries: [DE, FR]
+    backend: eu-pipeline
+  - pathPrefix: /
+    backend: default-pipeline
+- host: www.megaease.com
+  paths:
+  - pathPrefix: /
+    countries: [DE]
+    backend: de-pipeline
+`, dbFile)
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, nil)
+	mi := m.inst.Load().(*muxInstance)
+
+	search := func(url, ip string) *route {
+		stdr, _ := http.NewRequest(http.MethodGet, url, http.NoBody)
+		stdr.RemoteAddr = ip + ":12345"
+		req, _ := httpprot.NewRequest(stdr)
+		return mi.search(req)
+	}
+
+	// the paths with countries are not cached.
+	for i := 0; i < 2; i++ {
+		assert.Equal("eu-pipeline", search("http://www.megaease.cn/", "192.0.2.1").path.backend)
+		assert.Equal("default-pipeline", search("http://www.megaease.cn/", "10.0.0.1").path.backend)
+	}
+
+	assert.Equal(forbidden, search("http://www.megaease.cn/", "198.51.100.1"))
+	assert.Equal(forbidden, search("http://www.megaease.cn/", "203.0.113.1"))
+
+	// the not found results of the mismatched countries are not cached.
+	assert.Equal(notFound, search("http://www.megaease.com/", "10.0.0.1"))
+	assert.Equal("de-pipeline", search("http://www.megaease.com/", "192.0.2.1").path.backend)
+
+	// the resolver is reused if the databases are not changed.
+	resolver := mi.geoResolver
+	m.reload(superSpec, nil)
+	assert.Equal(resolver, m.inst.Load().(*muxInstance).geoResolver)
+
+	spec := &Spec{Rules: []*Rule{{Paths: []*Path{{Countries: []string{"DE"}}}}}}
+	assert.Error(spec.Validate())
+	spec.GeoIP = &geoip.Spec{Databases: []string{dbFile}}
+	assert.NoError(spec.Validate())
+}
+
+func TestMuxInstanceSearchSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), nil)
+	defer m.close()
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+cacheSize: 100
+rules:
+- host: www.megaease.cn
+  paths:
+  - pathPrefix: /
+    schedule:
+      windows:
+      - from: "2000-01-01T00:00:00Z"
+        to: "2001-01-01T00:00:00Z"
+    backend: past-pipeline
+  - pathPrefix: /
+    schedule:
+      windows:
+      - from: "2000-01-01T00:00:00Z"
+        to: "2100-01-01T00:00:00Z"
+    backend: maintenance-pipeline
+  - pathPrefix: /
+    backend: default-pipeline
+- host: www.megaease.com
+  paths:
+  - pathPrefix: /
+    schedule:
+      windows:
+      - from: "2000-01-01T00:00:00Z"
+        to: "2001-01-01T00:00:00Z"
+    backend: past-pipeline
+`
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, nil)
+	mi := m.inst.Load().(*muxInstance)
+
+	search := func(url string) *route {
+		stdr, _ := http.NewRequest(http.MethodGet, url, http.NoBody)
+		req, _ := httpprot.NewRequest(stdr)
+		return mi.search(req)
+	}
+
+	// the paths with schedule and the not found results of the
+	// mismatched schedules are not cached.
+	for i := 0; i < 2; i++ {
+		assert.Equal("maintenance-pipeline", search("http://www.megaease.cn/").path.backend)
+		assert.Equal(notFound, search("http://www.megaease.com/"))
+	}
+	assert.Equal(0, mi.cache.Len())
+
+	_, err = supervisor.NewSpec(`
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rules:
+- paths:
+  - pathPrefix: /
+    schedule:
+      windows:
+      - start: "25:00"
+        end: "08:00"
+    backend: pipeline
+`)
+	assert.Error(err)
+}
+
+func TestMuxInstanceSearchExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), nil)
+	defer m.close()
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+cacheSize: 100
+rules:
+- paths:
+  - pathPrefix: /
+    expression: request.header["x-debug"] == "1" && request.method == "POST"
+    backend: debug-pipeline
+  - pathPrefix: /api
+    backend: api-pipeline
+`
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, nil)
+	mi := m.inst.Load().(*muxInstance)
+
+	search := func(method, url string, header http.Header) *route {
+		stdr, _ := http.NewRequest(method, url, http.NoBody)
+		for k, v := range header {
+			stdr.Header[k] = v
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return mi.search(req)
+	}
+
+	debug := http.Header{"X-Debug": []string{"1"}}
+	// the paths with expression and the results of the mismatched
+	// expressions are not cached.
+	for i := 0; i < 2; i++ {
+		assert.Equal("debug-pipeline", search(http.MethodPost, "http://www.megaease.com/api", debug).path.backend)
+		assert.Equal("api-pipeline", search(http.MethodGet, "http://www.megaease.com/api", debug).path.backend)
+		assert.Equal("api-pipeline", search(http.MethodPost, "http://www.megaease.com/api", nil).path.backend)
+		assert.Equal(notFound, search(http.MethodPost, "http://www.megaease.com/", nil))
+	}
+	assert.Equal(0, mi.cache.Len())
+
+	_, err = supervisor.NewSpec(`
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rules:
+- paths:
+  - pathPrefix: /
+    expression: request.method = "POST"
+    backend: pipeline
+`)
+	assert.Error(err)
+}
+
+func TestRouteTimeoutsAndLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	canceled := make(chan struct{}, 1)
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				req := ctx.GetInputRequest().(*httpprot.Request)
+				if req.Path() == "/slow" {
+					select {
+					case <-req.Context().Done():
+						canceled <- struct{}{}
+					case <-time.After(time.Second):
+					}
+				}
+				resp, _ := httpprot.NewResponse(nil)
+				ctx.SetOutputResponse(resp)
+				return ""
+			},
+		}, true
+	}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rules:
+- writeTimeout: 50ms
+  maxHeaderSize: 200
+  paths:
+  - path: /slow
+    backend: pipeline
+  - path: /upload
+    readTimeout: 100ms
+    writeTimeout: 1s
+    maxHeaderSize: 1024
+    backend: pipeline
+  - path: /idle
+    idleTimeout: 50ms
+    backend: pipeline
+  - path: /fast
+    backend: pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	tracker := &connTracker{}
+	server := httptest.NewUnstartedServer(m)
+	server.Config.ConnContext = tracker.ConnContext
+	server.Config.ConnState = tracker.ConnState
+	server.Start()
+	defer server.Close()
+
+	send := func(conn net.Conn, reader *bufio.Reader, raw string) *http.Response {
+		_, err := conn.Write([]byte(raw))
+		assert.NoError(err)
+		resp, err := http.ReadResponse(reader, nil)
+		assert.NoError(err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		assert.NoError(err)
+		return conn, bufio.NewReader(conn)
+	}
+
+	// the write timeout of the rule cancels the request.
+	if resp, err := http.Get(server.URL + "/slow"); err == nil {
+		resp.Body.Close()
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("request is not canceled")
+	}
+
+	// the header size limit of the rule.
+	conn, reader := dial()
+	header := "X-Large: " + strings.Repeat("a", 300) + "\r\n"
+	resp := send(conn, reader, "GET /fast HTTP/1.1\r\nHost: test\r\n"+header+"\r\n")
+	assert.Equal(http.StatusRequestHeaderFieldsTooLarge, resp.StatusCode)
+	conn.Close()
+
+	// the path overrides the options of the rule.
+	conn, reader = dial()
+	resp = send(conn, reader, "GET /upload HTTP/1.1\r\nHost: test\r\n"+header+"\r\n")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	// the body is not sent in time.
+	resp = send(conn, reader, "POST /upload HTTP/1.1\r\nHost: test\r\nContent-Length: 10\r\n\r\nabc")
+	assert.Equal(http.StatusRequestTimeout, resp.StatusCode)
+	conn.Close()
+
+	// the connection is closed if it is idle for too long.
+	conn, reader = dial()
+	resp = send(conn, reader, "GET /idle HTTP/1.1\r\nHost: test\r\n\r\n")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = reader.ReadByte()
+	assert.Equal(io.EOF, err)
+	conn.Close()
+
+	// but the idle timeout only applies to the next idle period.
+	conn, reader = dial()
+	resp = send(conn, reader, "GET /idle HTTP/1.1\r\nHost: test\r\n\r\n")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	resp = send(conn, reader, "GET /fast HTTP/1.1\r\nHost: test\r\n\r\n")
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	_, err = reader.ReadByte()
+	var netErr net.Error
+	assert.True(errors.As(err, &netErr) && netErr.Timeout())
+	conn.Close()
+}
+
+// bodyHandler is a handler declaring whether it requires the bodies.
+type bodyHandler struct {
+	contexttest.MockedHandler
+	request, response bool
+}
+
+func (h *bodyHandler) RequiresBody() (request, response bool) {
+	return h.request, h.response
+}
+
+func TestStreamBody(t *testing.T) {
+	assert := assert.New(t)
+
+	var reqStream, respStream bool
+	handle := func(ctx *context.Context) string {
+		reqStream = ctx.GetInputRequest().IsStream()
+		respStream = ctx.StreamResponse()
+		resp, _ := httpprot.NewResponse(nil)
+		ctx.SetOutputResponse(resp)
+		return ""
+	}
+
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		h := &bodyHandler{MockedHandler: contexttest.MockedHandler{MockedHandle: handle}}
+		switch name {
+		case "buffer":
+			// a handler not declaring the requirements requires both.
+			return &h.MockedHandler, true
+		case "request":
+			h.request = true
+		}
+		return h, true
+	}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+streamBody: true
+rules:
+- paths:
+  - path: /buffer
+    backend: buffer
+  - path: /request
+    backend: request
+  - path: /stream
+    backend: stream
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	serve := func(path string) {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com"+path, strings.NewReader("body"))
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		assert.Equal(http.StatusOK, stdw.Code)
+	}
+
+	serve("/buffer")
+	assert.False(reqStream)
+	assert.False(respStream)
+
+	serve("/request")
+	assert.False(reqStream)
+	assert.True(respStream)
+
+	serve("/stream")
+	assert.True(reqStream)
+	assert.True(respStream)
+
+	// nothing is streamed if streamBody is not enabled.
+	superSpec, err = supervisor.NewSpec(strings.Replace(yamlConfig, "streamBody: true", "", 1))
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+	serve("/stream")
+	assert.False(reqStream)
+	assert.False(respStream)
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	// the headers of the upstream response, which are not modified.
+	header := http.Header{
+		"Content-Type":  []string{"text/plain"},
+		"Cache-Control": []string{"no-cache"},
+		"X-Upstream":    []string{"upstream"},
+	}
+
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				resp, _ := httpprot.NewResponse(&http.Response{
+					StatusCode: http.StatusOK,
+					Header:     header,
+					Body:       http.NoBody,
+				})
+				resp.SetPayload([]byte("hello"))
+				ctx.SetOutputResponse(resp)
+				return ""
+			},
+		}, true
+	}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rules:
+- paths:
+  - pathPrefix: /
+    backend: pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m.reload(superSpec, mm)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com/abc", strings.NewReader("hello world"))
+		// a chunked body, whose size is unknown before reading.
+		stdr.ContentLength = -1
+		m.ServeHTTP(httptest.NewRecorder(), stdr)
+	}
+}
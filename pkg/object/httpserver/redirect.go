@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+type (
+	// RedirectRule redirects or rewrites the requests matching it before
+	// they are routed to the pipelines.
+	RedirectRule struct {
+		// Host, HostRegexp and PathRegexp match the requests, empty ones
+		// match all.
+		Host       string `json:"host,omitempty" jsonschema:"omitempty"`
+		HostRegexp string `json:"hostRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		PathRegexp string `json:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+
+		Scheme     string `json:"scheme,omitempty" jsonschema:"omitempty,enum=,enum=http,enum=https"`
+		TargetHost string `json:"targetHost,omitempty" jsonschema:"omitempty"`
+		// Replacement replaces the path by pathRegexp, $1, $2 represent
+		// the sub-matches.
+		Replacement   string `json:"replacement,omitempty" jsonschema:"omitempty"`
+		TrailingSlash string `json:"trailingSlash,omitempty" jsonschema:"omitempty,enum=,enum=add,enum=remove"`
+		// Code is the status code of the redirect, default is 301.
+		Code int `json:"code,omitempty" jsonschema:"omitempty"`
+		// Rewrite changes the host and the path of the requests instead of
+		// redirecting them, and the next rules are evaluated.
+		Rewrite bool `json:"rewrite,omitempty" jsonschema:"omitempty"`
+	}
+
+	redirector struct {
+		rule   *RedirectRule
+		hostRE *regexp.Regexp
+		pathRE *regexp.Regexp
+	}
+)
+
+// Validate validates RedirectRule.
+func (r *RedirectRule) Validate() error {
+	if r.Scheme == "" && r.TargetHost == "" && r.Replacement == "" && r.TrailingSlash == "" {
+		return fmt.Errorf("none of scheme, targetHost, replacement and trailingSlash is specified")
+	}
+	if r.Replacement != "" && r.PathRegexp == "" {
+		return fmt.Errorf("replacement is specified but pathRegexp is empty")
+	}
+
+	switch r.Code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("invalid redirect code %d, must be 301, 302, 307 or 308", r.Code)
+	}
+
+	if r.Rewrite && (r.Scheme != "" || r.Code != 0) {
+		return fmt.Errorf("scheme and code can't be used with rewrite")
+	}
+	return nil
+}
+
+func newRedirectors(rules []*RedirectRule) []*redirector {
+	redirectors := make([]*redirector, 0, len(rules))
+	for _, rule := range rules {
+		r := &redirector{rule: rule}
+		if rule.HostRegexp != "" {
+			r.hostRE = regexp.MustCompile(rule.HostRegexp)
+		}
+		if rule.PathRegexp != "" {
+			r.pathRE = regexp.MustCompile(rule.PathRegexp)
+		}
+		redirectors = append(redirectors, r)
+	}
+	return redirectors
+}
+
+func (r *redirector) match(req *httpprot.Request) bool {
+	host := req.Host()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if r.rule.Host != "" && r.rule.Host != host {
+		return false
+	}
+	if r.hostRE != nil && !r.hostRE.MatchString(host) {
+		return false
+	}
+	return r.pathRE == nil || r.pathRE.MatchString(req.Path())
+}
+
+// target returns the host and the path the request is redirected or
+// rewritten to.
+func (r *redirector) target(req *httpprot.Request) (string, string) {
+	host := req.Host()
+	if r.rule.TargetHost != "" {
+		host = r.rule.TargetHost
+	}
+
+	path := req.Path()
+	if r.rule.Replacement != "" {
+		path = r.pathRE.ReplaceAllString(path, r.rule.Replacement)
+	}
+	switch r.rule.TrailingSlash {
+	case "add":
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	case "remove":
+		if len(path) > 1 {
+			path = strings.TrimRight(path, "/")
+			if path == "" {
+				path = "/"
+			}
+		}
+	}
+
+	return host, path
+}
+
+// redirect evaluates the redirect rules in order, it rewrites the request
+// by the matched rewrite rules, and returns the status code and the location
+// of the first matched redirect rule which changes the URL. The code is 0 if
+// the request is not redirected.
+func (mi *muxInstance) redirect(req *httpprot.Request) (int, string) {
+	for _, r := range mi.redirectors {
+		if !r.match(req) {
+			continue
+		}
+
+		host, path := r.target(req)
+		scheme := req.Scheme()
+		if r.rule.Scheme != "" {
+			scheme = r.rule.Scheme
+		}
+
+		// skip the rules which change nothing, to avoid redirect loops.
+		if scheme == req.Scheme() && host == req.Host() && path == req.Path() {
+			continue
+		}
+
+		if r.rule.Rewrite {
+			req.SetHost(host)
+			req.SetPath(path)
+			continue
+		}
+
+		code := r.rule.Code
+		if code == 0 {
+			code = http.StatusMovedPermanently
+		}
+		u := url.URL{Scheme: scheme, Host: host, Path: path, RawQuery: req.URL().RawQuery}
+		return code, u.String()
+	}
+
+	return 0, ""
+}
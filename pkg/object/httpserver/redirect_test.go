@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestRedirectRuleValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, redirects := range []string{
+		"- host: example.com",
+		"- replacement: /v2/$1",
+		"- scheme: https\n  code: 303",
+		"- scheme: https\n  rewrite: true",
+		"- scheme: ftp",
+	} {
+		yamlConfig := `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+redirects:
+` + redirects
+		_, err := supervisor.NewSpec(yamlConfig)
+		assert.Error(err, redirects)
+	}
+
+	_, err := supervisor.NewSpec(`
+name: http-server-test
+kind: HTTPServer
+port: 10080
+redirects:
+- pathRegexp: ^/old/(.*)$
+  replacement: /new/$1
+  code: 308
+`)
+	assert.NoError(err)
+}
+
+func TestMuxInstanceRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	mi := &muxInstance{
+		redirectors: newRedirectors([]*RedirectRule{
+			{Host: "www.example.com", Scheme: "https", TargetHost: "example.com"},
+			{PathRegexp: `^/legacy/(.*)$`, Replacement: "/api/$1", Rewrite: true},
+			{PathRegexp: `^/old/(.*)$`, Replacement: "/new/$1", Code: http.StatusFound},
+			{PathRegexp: `^/docs(/.*)?$`, TrailingSlash: "add", Code: http.StatusPermanentRedirect},
+			{PathRegexp: `^/api/`, TrailingSlash: "remove", Rewrite: true},
+			{Scheme: "https"},
+		}),
+	}
+
+	newRequest := func(url string, tlsOn bool) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+		if tlsOn {
+			stdr.TLS = &tls.ConnectionState{}
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	// scheme and host.
+	code, location := mi.redirect(newRequest("http://www.example.com:8080/a?b=c", false))
+	assert.Equal(http.StatusMovedPermanently, code)
+	assert.Equal("https://example.com/a?b=c", location)
+
+	// the last rule redirects to https.
+	code, location = mi.redirect(newRequest("http://example.com/a", false))
+	assert.Equal(http.StatusMovedPermanently, code)
+	assert.Equal("https://example.com/a", location)
+
+	// nothing changes.
+	code, _ = mi.redirect(newRequest("https://example.com/a", true))
+	assert.Equal(0, code)
+
+	// regexp replacement.
+	code, location = mi.redirect(newRequest("https://example.com/old/x/y?z=1", true))
+	assert.Equal(http.StatusFound, code)
+	assert.Equal("https://example.com/new/x/y?z=1", location)
+
+	// trailing slash.
+	code, location = mi.redirect(newRequest("https://example.com/docs/intro", true))
+	assert.Equal(http.StatusPermanentRedirect, code)
+	assert.Equal("https://example.com/docs/intro/", location)
+	code, _ = mi.redirect(newRequest("https://example.com/docs/intro/", true))
+	assert.Equal(0, code)
+
+	// rewrites are chained.
+	req := newRequest("https://example.com/legacy/users/", true)
+	code, _ = mi.redirect(req)
+	assert.Equal(0, code)
+	assert.Equal("/api/users", req.Path())
+}
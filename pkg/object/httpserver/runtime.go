@@ -20,8 +20,10 @@ package httpserver
 import (
 	"bytes"
 	stdcontext "context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
@@ -30,6 +32,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/http3"
+	"golang.org/x/crypto/acme"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/graceupdate"
@@ -38,12 +41,18 @@ import (
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/easemonitor"
 	"github.com/megaease/easegress/pkg/util/filterwriter"
+	"github.com/megaease/easegress/pkg/util/ja3"
 	"github.com/megaease/easegress/pkg/util/limitlistener"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+	"github.com/megaease/easegress/pkg/util/resources"
 )
 
 const (
 	defaultKeepAliveTimeout = 60 * time.Second
 
+	// altSvcMaxAge is the max age in seconds of the Alt-Svc header.
+	altSvcMaxAge = 86400
+
 	checkFailedTimeout = 10 * time.Second
 
 	topNum = 10
@@ -89,6 +98,9 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *httpstat.TopN
 		limitListener *limitlistener.LimitListener
+
+		// certStore is *certStore, it is read by the TLS handshakes.
+		certStore atomic.Value
 	}
 
 	// Status contains all status generated by runtime, for displaying to users.
@@ -100,7 +112,11 @@ type (
 		Error string    `json:"error,omitempty"`
 
 		*httpstat.Status
-		TopN []*httpstat.Item `json:"topN"`
+		TopN      []*httpstat.Item `json:"topN"`
+		Resources *resources.Usage `json:"resources"`
+		// Streams are the WebSocket and Server-Sent Events streams of the
+		// routes.
+		Streams []*StreamStatus `json:"streams,omitempty"`
 	}
 )
 
@@ -113,6 +129,7 @@ func newRuntime(superSpec *supervisor.Spec, muxMapper context.MuxMapper) *runtim
 	}
 
 	r.mux = newMux(r.httpStat, r.topN, muxMapper)
+	r.certStore.Store((*certStore)(nil))
 	r.setState(stateNil)
 	r.setError(errNil)
 
@@ -134,12 +151,14 @@ func (r *runtime) Status() *Status {
 	health := r.getError().Error()
 
 	return &Status{
-		Name:   r.superSpec.Name(),
-		Health: health,
-		State:  r.getState(),
-		Error:  r.getError().Error(),
-		Status: r.httpStat.Status(),
-		TopN:   r.topN.Status(),
+		Name:      r.superSpec.Name(),
+		Health:    health,
+		State:     r.getState(),
+		Error:     r.getError().Error(),
+		Status:    r.httpStat.Status(),
+		TopN:      r.topN.Status(),
+		Resources: r.mux.resources.Usage(),
+		Streams:   r.mux.streams.Status(),
 	}
 }
 
@@ -176,6 +195,10 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper context.MuxMa
 		r.limitListener.SetMaxConnection(nextSpec.MaxConnections)
 	}
 
+	if nextSpec != nil {
+		r.reloadCertStore(nextSuperSpec, nextSpec)
+	}
+
 	// NOTE: Due to the mechanism of supervisor,
 	// nextSpec must not be nil, just defensive programming here.
 	switch {
@@ -236,25 +259,102 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.Tracing, y.Tracing = nil, nil
 	x.IPFilter, y.IPFilter = nil, nil
 	x.Rules, y.Rules = nil, nil
+	// The certificates in the cluster are reloaded without restarting.
+	x.ClusterCerts, y.ClusterCerts = nil, nil
 
 	// The update of rules need not to shutdown server.
 	return !reflect.DeepEqual(x, y)
 }
 
+func (r *runtime) getCertStore() *certStore {
+	return r.certStore.Load().(*certStore)
+}
+
+func (r *runtime) reloadCertStore(superSpec *supervisor.Spec, spec *Spec) {
+	cs := r.getCertStore()
+
+	if !spec.HTTPS || len(spec.ClusterCerts) == 0 {
+		if cs != nil {
+			cs.close()
+			r.certStore.Store((*certStore)(nil))
+		}
+		return
+	}
+
+	if cs != nil {
+		cs.setPatterns(spec.ClusterCerts)
+		return
+	}
+
+	super := superSpec.Super()
+	if super == nil || super.Cluster() == nil {
+		logger.Errorf("BUG: no cluster to load certificates for %s", superSpec.Name())
+		return
+	}
+	r.certStore.Store(newCertStore(super.Cluster(), spec.ClusterCerts))
+}
+
+// tlsConfig returns the TLS config of spec, the certificates in the cluster
+// take precedence over the ones managed by the AutoCertManager and the
+// static ones.
+func (r *runtime) tlsConfig(spec *Spec) *tls.Config {
+	tlsConfig, _ := spec.tlsConfig()
+
+	getCertificate := tlsConfig.GetCertificate
+	tlsConfig.GetCertificate = func(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		// TLS-ALPN-01 challenges are always handled by the AutoCertManager.
+		isChallenge := len(chi.SupportedProtos) == 1 && chi.SupportedProtos[0] == acme.ALPNProto
+		if cs := r.getCertStore(); cs != nil && !isChallenge {
+			if cert := cs.get(chi.ServerName); cert != nil {
+				return cert, nil
+			}
+		}
+		return getCertificate(chi)
+	}
+
+	return tlsConfig
+}
+
 func (r *runtime) startServer() {
 	r.startNum++
 	r.setState(stateRunning)
 	r.setError(nil)
 
-	if r.spec.HTTP3 {
+	// The HTTP3 server listens on the UDP port alongside the TCP one, and
+	// the TCP server advertises it by the Alt-Svc header.
+	r.startHTTP1And2Server()
+	if r.spec.HTTP3 && r.getState() == stateRunning {
 		r.startHTTP3Server()
-	} else {
-		r.startHTTP1And2Server()
 	}
 }
 
+// altSvcHandler adds the Alt-Svc header to responses to advertise the
+// HTTP3 server.
+type altSvcHandler struct {
+	handler http.Handler
+	altSvc  string
+}
+
+func newAltSvcHandler(handler http.Handler, port uint16) *altSvcHandler {
+	return &altSvcHandler{
+		handler: handler,
+		altSvc:  fmt.Sprintf(`h3=":%d"; ma=%d`, port, altSvcMaxAge),
+	}
+}
+
+func (h *altSvcHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Alt-Svc", h.altSvc)
+	h.handler.ServeHTTP(w, req)
+}
+
 func (r *runtime) startHTTP3Server() {
-	tlsConfig, _ := r.spec.tlsConfig()
+	// The previous HTTP3 server is still running if only the TCP server
+	// failed.
+	if r.server3 != nil {
+		r.server3.Close()
+	}
+
+	tlsConfig := r.tlsConfig(r.spec)
 
 	keepAliveTimeout := defaultKeepAliveTimeout
 	if r.spec.KeepAliveTimeout != "" {
@@ -296,11 +396,24 @@ func (r *runtime) startHTTP1And2Server() {
 	fw := filterwriter.New(os.Stderr, func(p []byte) bool {
 		return !bytes.Contains(p, []byte("TLS handshake error"))
 	})
+	var handler http.Handler = r.mux
+	if r.spec.HTTP3 {
+		handler = newAltSvcHandler(r.mux, r.spec.Port)
+	}
+	tracker := &connTracker{}
 	r.server = &http.Server{
-		Addr:        fmt.Sprintf(":%d", r.spec.Port),
-		Handler:     r.mux,
-		IdleTimeout: keepAliveTimeout,
-		ErrorLog:    log.New(fw, "", log.LstdFlags),
+		Addr:           fmt.Sprintf(":%d", r.spec.Port),
+		Handler:        handler,
+		IdleTimeout:    keepAliveTimeout,
+		ReadTimeout:    parseDuration(r.spec.ReadTimeout),
+		WriteTimeout:   parseDuration(r.spec.WriteTimeout),
+		MaxHeaderBytes: r.spec.MaxHeaderSize,
+		ErrorLog:       log.New(fw, "", log.LstdFlags),
+		ConnContext: func(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+			ctx = tracker.ConnContext(ctx, c)
+			return ja3.WithConn(ctx, c)
+		},
+		ConnState: tracker.ConnState,
 	}
 	r.server.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
@@ -313,6 +426,11 @@ func (r *runtime) startHTTP1And2Server() {
 	limitListener := limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
 	r.limitListener = limitListener
 
+	var l net.Listener = limitListener
+	if r.spec.ProxyProtocol != nil {
+		l = proxyprotocol.NewListener(l, r.spec.ProxyProtocol)
+	}
+
 	// to avoid data race
 	spec := r.spec
 	startNum := r.startNum
@@ -321,11 +439,11 @@ func (r *runtime) startHTTP1And2Server() {
 	go func() {
 		var err error
 		if spec.HTTPS {
-			tlsConfig, _ := spec.tlsConfig()
-			srv.TLSConfig = tlsConfig
-			err = srv.ServeTLS(limitListener, "", "")
+			srv.TLSConfig = r.tlsConfig(spec)
+			// record the ClientHello for the JA3 fingerprints.
+			err = srv.ServeTLS(ja3.NewListener(l), "", "")
 		} else {
-			err = srv.Serve(limitListener)
+			err = srv.Serve(l)
 		}
 		if err != http.ErrServerClosed {
 			r.eventChan <- &eventServeFailed{
@@ -342,12 +460,12 @@ func (r *runtime) closeServer() {
 		if err != nil {
 			logger.Warnf("shutdown http3 server %s failed: %v", r.superSpec.Name(), err)
 		}
-		return
+		r.server3 = nil
 	}
 
 	if r.server != nil {
 		// NOTE: It's safe to shutdown serve failed server.
-		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 30*time.Second)
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), graceupdate.DrainTimeout())
 		defer cancel()
 		err := r.server.Shutdown(ctx)
 		if err != nil {
@@ -392,6 +510,9 @@ func (r *runtime) handleEventClose(e *eventClose) {
 	r.setState(stateClosed)
 	r.closeServer()
 	r.mux.close()
+	if cs := r.getCertStore(); cs != nil {
+		cs.close()
+	}
 	close(e.done)
 }
 
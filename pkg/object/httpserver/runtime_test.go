@@ -18,6 +18,8 @@
 package httpserver
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -92,3 +94,18 @@ https: false
 
 	//
 }
+
+func TestAltSvcHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	h := newAltSvcHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "test")
+		w.WriteHeader(http.StatusNoContent)
+	}), 8443)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com", nil))
+	assert.Equal(http.StatusNoContent, w.Code)
+	assert.Equal(`h3=":8443"; ma=86400`, w.Header().Get("Alt-Svc"))
+	assert.Equal("test", w.Header().Get("X-Test"))
+}
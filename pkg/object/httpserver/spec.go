@@ -22,12 +22,27 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"path"
 	"regexp"
 
+	"github.com/megaease/easegress/pkg/object/accesslog"
 	"github.com/megaease/easegress/pkg/object/autocertmanager"
+	"github.com/megaease/easegress/pkg/object/globalfilter"
+	"github.com/megaease/easegress/pkg/object/headerpolicy"
+	"github.com/megaease/easegress/pkg/object/ipset"
+	"github.com/megaease/easegress/pkg/object/loadshedder"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/clientip"
+	"github.com/megaease/easegress/pkg/util/expression"
+	"github.com/megaease/easegress/pkg/util/geoip"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+	"github.com/megaease/easegress/pkg/util/requestid"
+	"github.com/megaease/easegress/pkg/util/resources"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/timetool"
 )
 
 type (
@@ -41,10 +56,17 @@ type (
 		Port              uint16        `json:"port" jsonschema:"required,minimum=1"`
 		ClientMaxBodySize int64         `json:"clientMaxBodySize" jsonschema:"omitempty"`
 		KeepAliveTimeout  string        `json:"keepAliveTimeout" jsonschema:"omitempty,format=duration"`
+		ReadTimeout       string        `json:"readTimeout" jsonschema:"omitempty,format=duration"`
+		WriteTimeout      string        `json:"writeTimeout" jsonschema:"omitempty,format=duration"`
+		MaxHeaderSize     int           `json:"maxHeaderSize" jsonschema:"omitempty,minimum=0"`
 		MaxConnections    uint32        `json:"maxConnections" jsonschema:"omitempty,minimum=1"`
 		CacheSize         uint32        `json:"cacheSize" jsonschema:"omitempty"`
 		Tracing           *tracing.Spec `json:"tracing,omitempty" jsonschema:"omitempty"`
 		CaCertBase64      string        `json:"caCertBase64" jsonschema:"omitempty,format=base64"`
+		// ClientCertMode requests the client certificates without verifying
+		// them when caCertBase64 is empty, so that they can be verified by
+		// filters like ClientCertAuth.
+		ClientCertMode string `json:"clientCertMode" jsonschema:"omitempty,enum=,enum=request,enum=require"`
 
 		// Support multiple certs, preserve the certbase64 and keybase64
 		// for backward compatibility
@@ -55,11 +77,50 @@ type (
 		Certs map[string]string `json:"certs" jsonschema:"omitempty"`
 		// Keys saved as map, key is domain name, value is secret
 		Keys map[string]string `json:"keys" jsonschema:"omitempty"`
+		// ClusterCerts are the name patterns of the certificates stored in
+		// the cluster, the certificates are reloaded once they change and
+		// selected by the server names of the TLS handshakes.
+		ClusterCerts []string `json:"clusterCerts" jsonschema:"omitempty"`
 
 		IPFilter *ipfilter.Spec `json:"ipFilter,omitempty" jsonschema:"omitempty"`
-		Rules    []*Rule        `json:"rules" jsonschema:"omitempty"`
+		// GeoIP is the databases to resolve the locations of the clients,
+		// which are required by the geo filters and the countries of the
+		// paths.
+		GeoIP     *geoip.Spec       `json:"geoIP,omitempty" jsonschema:"omitempty"`
+		GeoFilter *geoip.FilterSpec `json:"geoFilter,omitempty" jsonschema:"omitempty"`
+		Rules     []*Rule           `json:"rules" jsonschema:"omitempty"`
 
 		GlobalFilter string `json:"globalFilter,omitempty" jsonschema:"omitempty"`
+		// AccessLog is the name of the AccessLog controller to write the
+		// access logs, in addition to the default access log file.
+		AccessLog string `json:"accessLog,omitempty" jsonschema:"omitempty"`
+		// LoadShedder is the name of the LoadShedder controller to reject
+		// the requests of low priorities under resource pressure.
+		LoadShedder string `json:"loadShedder,omitempty" jsonschema:"omitempty"`
+		// Limits are the hard limits of the resources used by the server,
+		// the requests exceeding them are rejected.
+		Limits *resources.Limits `json:"limits,omitempty" jsonschema:"omitempty"`
+		// HeaderPolicy is the name of the HeaderPolicy controller to
+		// mutate the headers of all the requests and responses.
+		HeaderPolicy string `json:"headerPolicy,omitempty" jsonschema:"omitempty"`
+		// ProxyProtocol accepts the PROXY protocol on the TCP listener, to
+		// get the addresses of the clients behind L4 load balancers.
+		ProxyProtocol *proxyprotocol.Spec `json:"proxyProtocol,omitempty" jsonschema:"omitempty"`
+		// ClientIP resolves the client IPs from the headers of the trusted
+		// proxies, which are used by the IP filters, GeoIP, access logs
+		// and filters.
+		ClientIP *clientip.Spec `json:"clientIP,omitempty" jsonschema:"omitempty"`
+		// RequestID generates the IDs of the requests or honors the
+		// incoming ones, which are forwarded to the backends, exposed to
+		// filters, and attached to spans and access logs.
+		RequestID *requestid.Spec `json:"requestID,omitempty" jsonschema:"omitempty"`
+		// Redirects are evaluated in order before the requests are routed,
+		// to redirect or rewrite them.
+		Redirects []*RedirectRule `json:"redirects,omitempty" jsonschema:"omitempty"`
+		// StreamBody streams the bodies of the requests and responses
+		// end-to-end instead of buffering them in memory, if no filter of
+		// the backend requires the full bodies.
+		StreamBody bool `json:"streamBody,omitempty" jsonschema:"omitempty"`
 	}
 
 	// Rule is first level entry of router.
@@ -71,24 +132,63 @@ type (
 		// Reference: https://github.com/alecthomas/jsonschema/issues/30
 		// In the future if we have the scenario where we need marshal the field, but omitempty
 		// in the schema, we are suppose to support multiple types on our own.
-		IPFilter   *ipfilter.Spec `json:"ipFilter,omitempty" jsonschema:"omitempty"`
-		Host       string         `json:"host" jsonschema:"omitempty"`
-		HostRegexp string         `json:"hostRegexp" jsonschema:"omitempty,format=regexp"`
-		Paths      []*Path        `json:"paths" jsonschema:"omitempty"`
+		IPFilter   *ipfilter.Spec    `json:"ipFilter,omitempty" jsonschema:"omitempty"`
+		GeoFilter  *geoip.FilterSpec `json:"geoFilter,omitempty" jsonschema:"omitempty"`
+		Host       string            `json:"host" jsonschema:"omitempty"`
+		HostRegexp string            `json:"hostRegexp" jsonschema:"omitempty,format=regexp"`
+		Paths      []*Path           `json:"paths" jsonschema:"omitempty"`
+		// Priority decides the order to match the rules, rules with higher
+		// priorities are matched first, and rules with the same priority
+		// are matched in the order they are defined.
+		Priority int `json:"priority" jsonschema:"omitempty"`
+
+		// The options below override the ones of the server for the
+		// requests matching the rule, and are overridden by the ones of
+		// the paths.
+		ReadTimeout       string `json:"readTimeout" jsonschema:"omitempty,format=duration"`
+		WriteTimeout      string `json:"writeTimeout" jsonschema:"omitempty,format=duration"`
+		IdleTimeout       string `json:"idleTimeout" jsonschema:"omitempty,format=duration"`
+		ClientMaxBodySize int64  `json:"clientMaxBodySize" jsonschema:"omitempty"`
+		MaxHeaderSize     int64  `json:"maxHeaderSize" jsonschema:"omitempty,minimum=0"`
+		MaxStreams        int64  `json:"maxStreams,omitempty" jsonschema:"omitempty,minimum=0"`
 	}
 
 	// Path is second level entry of router.
 	Path struct {
-		IPFilter          *ipfilter.Spec `json:"ipFilter,omitempty" jsonschema:"omitempty"`
-		Path              string         `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
-		PathPrefix        string         `json:"pathPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
-		PathRegexp        string         `json:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
-		RewriteTarget     string         `json:"rewriteTarget" jsonschema:"omitempty"`
-		Methods           []string       `json:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
-		Backend           string         `json:"backend" jsonschema:"required"`
-		Headers           []*Header      `json:"headers" jsonschema:"omitempty"`
-		ClientMaxBodySize int64          `json:"clientMaxBodySize" jsonschema:"omitempty"`
-		MatchAllHeader    bool           `json:"matchAllHeader" jsonschema:"omitempty"`
+		IPFilter  *ipfilter.Spec    `json:"ipFilter,omitempty" jsonschema:"omitempty"`
+		GeoFilter *geoip.FilterSpec `json:"geoFilter,omitempty" jsonschema:"omitempty"`
+		// Countries are the ISO 3166-1 codes of the countries, the path
+		// only matches the requests from them if it is not empty.
+		Countries         []string  `json:"countries,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Path              string    `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
+		PathPrefix        string    `json:"pathPrefix,omitempty" jsonschema:"omitempty,pattern=^/"`
+		PathRegexp        string    `json:"pathRegexp,omitempty" jsonschema:"omitempty,format=regexp"`
+		RewriteTarget     string    `json:"rewriteTarget" jsonschema:"omitempty"`
+		Methods           []string  `json:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		Backend           string    `json:"backend" jsonschema:"required"`
+		Headers           []*Header `json:"headers" jsonschema:"omitempty"`
+		ClientMaxBodySize int64     `json:"clientMaxBodySize" jsonschema:"omitempty"`
+		MatchAllHeader    bool      `json:"matchAllHeader" jsonschema:"omitempty"`
+		Queries           []*Query  `json:"queries" jsonschema:"omitempty"`
+		MatchAllQuery     bool      `json:"matchAllQuery" jsonschema:"omitempty"`
+		// Priority decides the order to match the paths of a rule, like
+		// the priority of rules.
+		Priority int `json:"priority" jsonschema:"omitempty"`
+		// Schedule is the time windows in which the path matches, the
+		// path always matches if it is nil.
+		Schedule *timetool.ScheduleSpec `json:"schedule,omitempty" jsonschema:"omitempty"`
+		// Expression is a CEL expression on the request, the path only
+		// matches the requests for which it is true.
+		Expression string `json:"expression,omitempty" jsonschema:"omitempty"`
+
+		ReadTimeout   string `json:"readTimeout" jsonschema:"omitempty,format=duration"`
+		WriteTimeout  string `json:"writeTimeout" jsonschema:"omitempty,format=duration"`
+		IdleTimeout   string `json:"idleTimeout" jsonschema:"omitempty,format=duration"`
+		MaxHeaderSize int64  `json:"maxHeaderSize" jsonschema:"omitempty,minimum=0"`
+		// MaxStreams is the max number of the concurrent streaming
+		// connections, i.e. WebSocket and Server-Sent Events, of the
+		// route, the new ones are rejected with 503 once it is reached.
+		MaxStreams int64 `json:"maxStreams,omitempty" jsonschema:"omitempty,minimum=0"`
 	}
 
 	// Header is the third level entry of router. A header entry is always under a specific path entry, that is to mean
@@ -101,10 +201,43 @@ type (
 
 		headerRE *regexp.Regexp
 	}
+
+	// Query is the query parameter entry of router, it works like Header,
+	// but matches the query parameters of the requests.
+	Query struct {
+		Key    string   `json:"key" jsonschema:"required"`
+		Values []string `json:"values,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Regexp string   `json:"regexp,omitempty" jsonschema:"omitempty,format=regexp"`
+
+		re *regexp.Regexp
+	}
 )
 
+// validateGeo validates the GeoIP related options.
+func (spec *Spec) validateGeo() error {
+	if spec.GeoIP != nil {
+		return spec.GeoIP.Validate()
+	}
+
+	used := spec.GeoFilter != nil
+	for _, r := range spec.Rules {
+		used = used || r.GeoFilter != nil
+		for _, p := range r.Paths {
+			used = used || p.GeoFilter != nil || len(p.Countries) > 0
+		}
+	}
+	if used {
+		return fmt.Errorf("geoIP is required by geo filters and countries")
+	}
+	return nil
+}
+
 // Validate validates HTTPServerSpec.
 func (spec *Spec) Validate() error {
+	if err := spec.validateGeo(); err != nil {
+		return err
+	}
+
 	if !spec.HTTPS {
 		if spec.HTTP3 {
 			return fmt.Errorf("https is disabled when http3 enabled")
@@ -112,13 +245,58 @@ func (spec *Spec) Validate() error {
 		return nil
 	}
 
-	if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 && !spec.AutoCert {
-		return fmt.Errorf("certBase64/keyBase64, certs/keys are both empty and autocert is disabled when https enabled")
+	if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 &&
+		!spec.AutoCert && len(spec.ClusterCerts) == 0 {
+		return fmt.Errorf("certBase64/keyBase64, certs/keys, clusterCerts are all empty and autocert is disabled when https enabled")
+	}
+	for _, p := range spec.ClusterCerts {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid cluster cert pattern %s: %v", p, err)
+		}
 	}
 	_, err := spec.tlsConfig()
 	return err
 }
 
+// References returns the pipelines, the GlobalFilter, the AccessLog, the
+// LoadShedder, the HeaderPolicy and the IPSets referenced by the HTTPServer.
+func (spec *Spec) References() []*supervisor.ObjectReference {
+	var refs []*supervisor.ObjectReference
+	backends := map[string]bool{}
+	for _, rule := range spec.Rules {
+		for _, p := range rule.Paths {
+			if backends[p.Backend] {
+				continue
+			}
+			backends[p.Backend] = true
+			refs = append(refs, &supervisor.ObjectReference{Kind: pipeline.Kind, Name: p.Backend})
+		}
+	}
+
+	if spec.GlobalFilter != "" {
+		refs = append(refs, &supervisor.ObjectReference{Kind: globalfilter.Kind, Name: spec.GlobalFilter})
+	}
+	if spec.AccessLog != "" {
+		refs = append(refs, &supervisor.ObjectReference{Kind: accesslog.Kind, Name: spec.AccessLog})
+	}
+	if spec.LoadShedder != "" {
+		refs = append(refs, &supervisor.ObjectReference{Kind: loadshedder.Kind, Name: spec.LoadShedder})
+	}
+	if spec.HeaderPolicy != "" {
+		refs = append(refs, &supervisor.ObjectReference{Kind: headerpolicy.Kind, Name: spec.HeaderPolicy})
+	}
+
+	ipFilters := []*ipfilter.Spec{spec.IPFilter}
+	for _, rule := range spec.Rules {
+		ipFilters = append(ipFilters, rule.IPFilter)
+		for _, p := range rule.Paths {
+			ipFilters = append(ipFilters, p.IPFilter)
+		}
+	}
+	refs = append(refs, ipset.References(ipFilters...)...)
+	return refs
+}
+
 func tryDecodeBase64Pem(pem string) []byte {
 	// The pem could in base64 encoding or plain text. It starts with '-' if it is
 	// in plain text, and '-' is not a valid character in standard base64 encoding.
@@ -159,7 +337,7 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		certificates = append(certificates, cert)
 	}
 
-	if len(certificates) == 0 && !spec.AutoCert {
+	if len(certificates) == 0 && !spec.AutoCert && len(spec.ClusterCerts) == 0 {
 		return nil, fmt.Errorf("none valid certs and secret")
 	}
 
@@ -185,6 +363,10 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 
 		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
 		tlsConf.ClientCAs = certPool
+	} else if spec.ClientCertMode == "request" {
+		tlsConf.ClientAuth = tls.RequestClientCert
+	} else if spec.ClientCertMode == "require" {
+		tlsConf.ClientAuth = tls.RequireAnyClientCert
 	}
 
 	return tlsConf, nil
@@ -203,11 +385,29 @@ func (h *Header) Validate() error {
 	return nil
 }
 
+func (q *Query) initQueryRoute() {
+	q.re = regexp.MustCompile(q.Regexp)
+}
+
+// Validate validates Query.
+func (q *Query) Validate() error {
+	if len(q.Values) == 0 && q.Regexp == "" {
+		return fmt.Errorf("both of values and regexp are empty for query key: %s", q.Key)
+	}
+
+	return nil
+}
+
 // Validate validates Path.
 func (p *Path) Validate() error {
 	if (stringtool.IsAllEmpty(p.Path, p.PathPrefix, p.PathRegexp)) && p.RewriteTarget != "" {
 		return fmt.Errorf("rewriteTarget is specified but path is empty")
 	}
+	if p.Expression != "" {
+		if _, err := expression.Compile(p.Expression); err != nil {
+			return fmt.Errorf("expression: %v", err)
+		}
+	}
 
 	return nil
 }
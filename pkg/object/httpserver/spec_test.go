@@ -75,6 +75,31 @@ rules:
 	superSpec, err = supervisor.NewSpec(yamlConfig)
 	assert.True(strings.Contains(err.Error(), "keepAliveTimeout: invalid duration"))
 	assert.Nil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10443
+https: true
+clusterCerts: ["example-*"]
+rules:
+  - paths:
+    - pathPrefix: /api`
+	superSpec, err = supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	assert.NotNil(superSpec)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10443
+https: true
+clusterCerts: ["example-["]
+rules:
+  - paths:
+    - pathPrefix: /api`
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.True(strings.Contains(err.Error(), "invalid cluster cert pattern"))
 }
 
 func TestTlsConfig(t *testing.T) {
@@ -190,3 +215,46 @@ rules: []`, validSpec: true, mTLSExpected: true,
 		})
 	}
 }
+
+func TestReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	superSpec, err := supervisor.NewSpec(`
+name: http-server-test
+kind: HTTPServer
+port: 10080
+keepAlive: true
+https: false
+globalFilter: global-filter
+accessLog: access-log
+loadShedder: load-shedder
+headerPolicy: header-policy
+ipFilter:
+  blockSets: [blocklist]
+rules:
+- paths:
+  - pathPrefix: /api
+    backend: pipeline-api
+    ipFilter:
+      allowSets: [allowlist]
+      blockSets: [blocklist]
+  - pathPrefix: /web
+    backend: pipeline-web
+- host: www.megaease.com
+  paths:
+  - pathPrefix: /api
+    backend: pipeline-api
+`)
+	assert.NoError(err)
+
+	assert.Equal([]*supervisor.ObjectReference{
+		{Kind: "Pipeline", Name: "pipeline-api"},
+		{Kind: "Pipeline", Name: "pipeline-web"},
+		{Kind: "GlobalFilter", Name: "global-filter"},
+		{Kind: "AccessLog", Name: "access-log"},
+		{Kind: "LoadShedder", Name: "load-shedder"},
+		{Kind: "HeaderPolicy", Name: "header-policy"},
+		{Kind: "IPSet", Name: "blocklist"},
+		{Kind: "IPSet", Name: "allowlist"},
+	}, superSpec.References())
+}
@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+const (
+	streamWebSocket = "websocket"
+	streamSSE       = "sse"
+
+	// streamRetryAfter is the Retry-After header of the rejected streams.
+	streamRetryAfter = "1"
+)
+
+// streamDurationBuckets are the upper bounds of the duration histograms of
+// the streams, which last much longer than the requests.
+var streamDurationBuckets = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+}
+
+// The Prometheus metrics of the streams, the label of a route is its path
+// pattern.
+var (
+	openStreams = prometheushelper.NewGauge(
+		"httpserver_open_streams",
+		"The number of open streaming connections of the route, i.e. WebSocket and Server-Sent Events.",
+		[]string{"server", "route", "kind"},
+	)
+	streamDuration = prometheushelper.NewHistogram(
+		"httpserver_stream_duration_seconds",
+		"The duration of the streaming connections of the route.",
+		durationsInSeconds(streamDurationBuckets),
+		[]string{"server", "route", "kind"},
+	)
+	streamBytes = prometheushelper.NewCounter(
+		"httpserver_stream_bytes_total",
+		"The bytes transferred by the streaming connections of the route, by the direction.",
+		[]string{"server", "route", "kind", "direction"},
+	)
+	rejectedStreams = prometheushelper.NewCounter(
+		"httpserver_rejected_streams_total",
+		"The number of streaming connections rejected by the max streams of the route.",
+		[]string{"server", "route", "kind"},
+	)
+)
+
+type (
+	// streamTracker tracks the streams of the routes of a server, it is
+	// shared by all the generations of the mux, so that the streams opened
+	// before a reload are counted.
+	streamTracker struct {
+		mutex  sync.Mutex
+		routes map[string]*routeStreams
+	}
+
+	routeStreams struct {
+		open     int64
+		total    uint64
+		rejected uint64
+
+		bytesReceived uint64
+		bytesSent     uint64
+		// durations are the counts of the durations of the closed streams
+		// in streamDurationBuckets, and the last one is for the longer
+		// ones.
+		durations []uint64
+	}
+
+	// stream is an open stream.
+	stream struct {
+		tracker *streamTracker
+		rs      *routeStreams
+		labels  []string
+		start   time.Time
+	}
+
+	// StreamStatus is the status of the streams of a route.
+	StreamStatus struct {
+		Route         string            `json:"route"`
+		Open          int64             `json:"open"`
+		Total         uint64            `json:"total"`
+		Rejected      uint64            `json:"rejected"`
+		BytesReceived uint64            `json:"bytesReceived"`
+		BytesSent     uint64            `json:"bytesSent"`
+		Durations     []*DurationBucket `json:"durations"`
+	}
+
+	// DurationBucket is a bucket of the duration histogram, Count is the
+	// number of the closed streams not longer than LE.
+	DurationBucket struct {
+		LE    string `json:"le"`
+		Count uint64 `json:"count"`
+	}
+
+	// streamResponseWriter counts the bytes of the connection taken over
+	// by a filter, e.g. the WebSocketProxy.
+	streamResponseWriter struct {
+		http.ResponseWriter
+		stream *stream
+	}
+
+	// streamConn counts the bytes of a hijacked connection.
+	streamConn struct {
+		net.Conn
+		stream *stream
+	}
+
+	// streamWriter counts the bytes of the response body.
+	streamWriter struct {
+		w      io.Writer
+		stream *stream
+	}
+)
+
+func durationsInSeconds(durations []time.Duration) []float64 {
+	result := make([]float64, len(durations))
+	for i, d := range durations {
+		result[i] = d.Seconds()
+	}
+	return result
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{routes: map[string]*routeStreams{}}
+}
+
+// streamKind returns the kind of the stream of the request by its headers,
+// it returns an empty string if the request is not for a stream.
+func streamKind(req *httpprot.Request) string {
+	h := req.HTTPHeader()
+	if strings.EqualFold(h.Get("Upgrade"), "websocket") {
+		return streamWebSocket
+	}
+	for _, v := range h.Values("Accept") {
+		if strings.Contains(v, httpprot.EventStreamContentType) {
+			return streamSSE
+		}
+	}
+	return ""
+}
+
+// begin opens a stream of the route which is started at start, it returns
+// nil if the max streams of the route is reached, zero max means no limit.
+func (st *streamTracker) begin(server, route, kind string, max int64, start time.Time) *stream {
+	labels := []string{server, route, kind}
+
+	st.mutex.Lock()
+	rs := st.routes[route]
+	if rs == nil {
+		rs = &routeStreams{durations: make([]uint64, len(streamDurationBuckets)+1)}
+		st.routes[route] = rs
+	}
+	if max > 0 && rs.open >= max {
+		rs.rejected++
+		st.mutex.Unlock()
+		rejectedStreams.WithLabelValues(labels...).Inc()
+		return nil
+	}
+	rs.open++
+	rs.total++
+	st.mutex.Unlock()
+
+	openStreams.WithLabelValues(labels...).Inc()
+	return &stream{tracker: st, rs: rs, labels: labels, start: start}
+}
+
+// end closes the stream.
+func (s *stream) end(now time.Time) {
+	d := now.Sub(s.start)
+	i := sort.Search(len(streamDurationBuckets), func(i int) bool {
+		return d <= streamDurationBuckets[i]
+	})
+
+	s.tracker.mutex.Lock()
+	s.rs.open--
+	s.rs.durations[i]++
+	s.tracker.mutex.Unlock()
+
+	openStreams.WithLabelValues(s.labels...).Dec()
+	streamDuration.WithLabelValues(s.labels...).Observe(d.Seconds())
+}
+
+func (s *stream) addReceived(n int) {
+	if n > 0 {
+		atomic.AddUint64(&s.rs.bytesReceived, uint64(n))
+		streamBytes.WithLabelValues(append(s.labels, "received")...).Add(float64(n))
+	}
+}
+
+func (s *stream) addSent(n int) {
+	if n > 0 {
+		atomic.AddUint64(&s.rs.bytesSent, uint64(n))
+		streamBytes.WithLabelValues(append(s.labels, "sent")...).Add(float64(n))
+	}
+}
+
+// Status returns the status of the streams of the routes, sorted by the
+// routes.
+func (st *streamTracker) Status() []*StreamStatus {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	result := make([]*StreamStatus, 0, len(st.routes))
+	for route, rs := range st.routes {
+		status := &StreamStatus{
+			Route:         route,
+			Open:          rs.open,
+			Total:         rs.total,
+			Rejected:      rs.rejected,
+			BytesReceived: atomic.LoadUint64(&rs.bytesReceived),
+			BytesSent:     atomic.LoadUint64(&rs.bytesSent),
+		}
+		var count uint64
+		for i, n := range rs.durations {
+			count += n
+			le := "+Inf"
+			if i < len(streamDurationBuckets) {
+				le = streamDurationBuckets[i].String()
+			}
+			status.Durations = append(status.Durations, &DurationBucket{LE: le, Count: count})
+		}
+		result = append(result, status)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Route < result[j].Route
+	})
+	return result
+}
+
+// Hijack implements http.Hijacker.
+func (w *streamResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer doesn't support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sc := &streamConn{Conn: conn, stream: w.stream}
+	// the buffered bytes have been read from the connection, keep the
+	// reader to not lose them.
+	reader := rw.Reader
+	if reader.Buffered() == 0 {
+		reader = bufio.NewReader(sc)
+	}
+	return sc, bufio.NewReadWriter(reader, bufio.NewWriter(sc)), nil
+}
+
+// Flush implements http.Flusher.
+func (w *streamResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.stream.addReceived(n)
+	return n, err
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.stream.addSent(n)
+	return n, err
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	n, err := sw.w.Write(p)
+	sw.stream.addSent(n)
+	return n, err
+}
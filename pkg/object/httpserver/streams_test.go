@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func TestStreamKind(t *testing.T) {
+	assert := assert.New(t)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	assert.Equal("", streamKind(req))
+
+	stdr.Header.Set("Accept", "text/event-stream")
+	assert.Equal(streamSSE, streamKind(req))
+
+	stdr.Header.Set("Upgrade", "WebSocket")
+	assert.Equal(streamWebSocket, streamKind(req))
+}
+
+func TestStreamTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	st := newStreamTracker()
+	now := time.Now()
+
+	s1 := st.begin("server", "/a", streamSSE, 1, now.Add(-2*time.Minute))
+	assert.NotNil(s1)
+	assert.Nil(st.begin("server", "/a", streamSSE, 1, now))
+	s2 := st.begin("server", "/b", streamWebSocket, 0, now.Add(-7*time.Hour))
+	assert.NotNil(s2)
+
+	s1.addSent(10)
+	s1.addReceived(3)
+	s1.end(now)
+	s2.end(now)
+
+	status := st.Status()
+	assert.Len(status, 2)
+	a := status[0]
+	assert.Equal("/a", a.Route)
+	assert.Equal(int64(0), a.Open)
+	assert.Equal(uint64(1), a.Total)
+	assert.Equal(uint64(1), a.Rejected)
+	assert.Equal(uint64(3), a.BytesReceived)
+	assert.Equal(uint64(10), a.BytesSent)
+	assert.Len(a.Durations, len(streamDurationBuckets)+1)
+	assert.Equal(&DurationBucket{LE: "1m0s", Count: 0}, a.Durations[2])
+	assert.Equal(&DurationBucket{LE: "5m0s", Count: 1}, a.Durations[3])
+	assert.Equal(&DurationBucket{LE: "+Inf", Count: 1}, a.Durations[7])
+
+	b := status[1]
+	assert.Equal("/b", b.Route)
+	assert.Equal(uint64(0), b.Durations[6].Count)
+	assert.Equal(uint64(1), b.Durations[7].Count)
+}
+
+func newStreamMux(t *testing.T, handle func(ctx *context.Context) string) *mux {
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{MockedHandle: handle}, true
+	}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), mm)
+
+	superSpec, err := supervisor.NewSpec(`
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rules:
+- maxStreams: 1
+  paths:
+  - path: /events
+    backend: events
+  - path: /feed
+    backend: feed
+  - path: /ws
+    backend: ws
+`)
+	assert.NoError(t, err)
+	m.reload(superSpec, mm)
+	return m
+}
+
+func TestServeEventStreams(t *testing.T) {
+	assert := assert.New(t)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	m := newStreamMux(t, func(ctx *context.Context) string {
+		if ctx.GetInputRequest().(*httpprot.Request).Path() == "/events" {
+			started <- struct{}{}
+			<-release
+		}
+		resp, _ := httpprot.NewResponse(nil)
+		resp.HTTPHeader().Set("Content-Type", "text/event-stream")
+		resp.SetPayload(strings.NewReader("data: x\n\n"))
+		ctx.SetOutputResponse(resp)
+		return ""
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		stdr := httptest.NewRequest(http.MethodGet, "http://www.megaease.com"+path, nil)
+		if path == "/events" {
+			stdr.Header.Set("Accept", "text/event-stream")
+		}
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		return stdw
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve("/events")
+	}()
+	<-started
+
+	status := m.streams.Status()
+	assert.Len(status, 1)
+	assert.Equal(int64(1), status[0].Open)
+
+	// the second stream of the route is rejected.
+	w := serve("/events")
+	assert.Equal(http.StatusServiceUnavailable, w.Code)
+	assert.Equal(streamRetryAfter, w.Header().Get("Retry-After"))
+
+	close(release)
+	w = <-done
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("data: x\n\n", w.Body.String())
+
+	// the event stream not requested as one is tracked, but not limited.
+	assert.Equal(http.StatusOK, serve("/feed").Code)
+
+	status = m.streams.Status()
+	assert.Len(status, 2)
+	events, feed := status[0], status[1]
+	assert.Equal("/events", events.Route)
+	assert.Equal(int64(0), events.Open)
+	assert.Equal(uint64(1), events.Total)
+	assert.Equal(uint64(1), events.Rejected)
+	assert.Equal(uint64(9), events.BytesSent)
+	assert.Equal(uint64(1), events.Durations[0].Count)
+	assert.Equal("/feed", feed.Route)
+	assert.Equal(uint64(1), feed.Total)
+}
+
+func TestServeWebSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	m := newStreamMux(t, func(ctx *context.Context) string {
+		stdw := ctx.GetData(httpprot.ResponseWriterKey).(http.ResponseWriter)
+		conn, rw, err := stdw.(http.Hijacker).Hijack()
+		if err != nil {
+			return "hijackFailed"
+		}
+		defer conn.Close()
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusSwitchingProtocols)
+		ctx.SetOutputResponse(resp)
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\nhello")
+		rw.Flush()
+		buf := make([]byte, 5)
+		io.ReadFull(rw, buf)
+		return ""
+	})
+
+	server := httptest.NewServer(m)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	assert.NoError(err)
+	defer conn.Close()
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	assert.NoError(err)
+	assert.Equal(http.StatusSwitchingProtocols, resp.StatusCode)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(reader, buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf))
+	conn.Write([]byte("world"))
+
+	// wait for the stream to end.
+	for i := 0; i < 100; i++ {
+		if status := m.streams.Status(); len(status) == 1 && status[0].Open == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := m.streams.Status()
+	assert.Len(status, 1)
+	assert.Equal("/ws", status[0].Route)
+	assert.Equal(int64(0), status[0].Open)
+	assert.Equal(uint64(5), status[0].BytesReceived)
+	assert.Equal(uint64(len("HTTP/1.1 101 Switching Protocols\r\n\r\nhello")), status[0].BytesSent)
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/filters/corsfilter"
+	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/filters/requestadaptor"
+	"github.com/megaease/easegress/pkg/filters/responseadaptor"
+	"github.com/megaease/easegress/pkg/filters/validator"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	apinetv1 "k8s.io/api/networking/v1"
+)
+
+const (
+	annotationPrefix = "easegress.ingress.kubernetes.io/"
+
+	annotationRewriteTarget = annotationPrefix + "rewrite-target"
+
+	annotationRateLimit = annotationPrefix + "rate-limit"
+
+	annotationJWTSecret     = annotationPrefix + "jwt-secret"
+	annotationJWTAlgorithm  = annotationPrefix + "jwt-algorithm"
+	annotationJWTCookieName = annotationPrefix + "jwt-cookie-name"
+
+	annotationRequestHeadersSet     = annotationPrefix + "request-headers-set"
+	annotationRequestHeadersAdd     = annotationPrefix + "request-headers-add"
+	annotationRequestHeadersRemove  = annotationPrefix + "request-headers-remove"
+	annotationResponseHeadersSet    = annotationPrefix + "response-headers-set"
+	annotationResponseHeadersAdd    = annotationPrefix + "response-headers-add"
+	annotationResponseHeadersRemove = annotationPrefix + "response-headers-remove"
+
+	annotationEnableCORS           = annotationPrefix + "enable-cors"
+	annotationCORSAllowOrigins     = annotationPrefix + "cors-allow-origins"
+	annotationCORSAllowMethods     = annotationPrefix + "cors-allow-methods"
+	annotationCORSAllowHeaders     = annotationPrefix + "cors-allow-headers"
+	annotationCORSExposeHeaders    = annotationPrefix + "cors-expose-headers"
+	annotationCORSAllowCredentials = annotationPrefix + "cors-allow-credentials"
+	annotationCORSMaxAge           = annotationPrefix + "cors-max-age"
+
+	annotationFilters = annotationPrefix + "filters"
+
+	// jwtSecretKey is the key of the JWT secret in the Kubernetes secret.
+	jwtSecretKey = "jwt.key"
+)
+
+// routeFilters are the filters attached to the routes of an ingress by
+// its annotations, before are the filters before the proxy and after are
+// the ones after it.
+type routeFilters struct {
+	before []map[string]interface{}
+	after  []map[string]interface{}
+}
+
+func (rf *routeFilters) empty() bool {
+	return len(rf.before) == 0 && len(rf.after) == 0
+}
+
+// splitList splits a comma separated list and trims the spaces.
+func splitList(s string) []string {
+	var result []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// parseHeaders parses a map of headers in YAML or JSON, e.g.
+// '{"X-Env": "prod"}'.
+func parseHeaders(annotations map[string]string, key string) (map[string]string, error) {
+	v, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	if err := codectool.Unmarshal([]byte(v), &headers); err != nil {
+		return nil, fmt.Errorf("invalid annotation %s: %v", key, err)
+	}
+	return headers, nil
+}
+
+// headerAdaptSpec returns the header adaptor spec of the annotations, nil
+// if there is no header annotation.
+func headerAdaptSpec(annotations map[string]string, setKey, addKey, removeKey string) (map[string]interface{}, error) {
+	set, err := parseHeaders(annotations, setKey)
+	if err != nil {
+		return nil, err
+	}
+	add, err := parseHeaders(annotations, addKey)
+	if err != nil {
+		return nil, err
+	}
+	del := splitList(annotations[removeKey])
+	if len(set) == 0 && len(add) == 0 && len(del) == 0 {
+		return nil, nil
+	}
+	return map[string]interface{}{"set": set, "add": add, "del": del}, nil
+}
+
+// translateAnnotations translates the filter annotations of the ingress to
+// the filters of its routes. The filters run in the order of JWT
+// validation, rate limiting, CORS, request header rewriting, the filters
+// of the filters annotation, the proxy, and response header rewriting.
+func (st *specTranslator) translateAnnotations(ingress *apinetv1.Ingress) (*routeFilters, error) {
+	annotations := ingress.Annotations
+	rf := &routeFilters{}
+
+	if name, ok := annotations[annotationJWTSecret]; ok {
+		secret, err := st.k8sClient.getSecret(ingress.Namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		if secret == nil || len(secret.Data[jwtSecretKey]) == 0 {
+			return nil, fmt.Errorf("'%s' is missing or empty in secret %s/%s", jwtSecretKey, ingress.Namespace, name)
+		}
+
+		algorithm := annotations[annotationJWTAlgorithm]
+		if algorithm == "" {
+			algorithm = "HS256"
+		}
+		rf.before = append(rf.before, map[string]interface{}{
+			"kind": validator.Kind,
+			"name": "jwt-validator",
+			"jwt": map[string]interface{}{
+				"algorithm":  algorithm,
+				"secret":     hex.EncodeToString(secret.Data[jwtSecretKey]),
+				"cookieName": annotations[annotationJWTCookieName],
+			},
+		})
+	}
+
+	if v, ok := annotations[annotationRateLimit]; ok {
+		rps, err := strconv.Atoi(v)
+		if err != nil || rps <= 0 {
+			return nil, fmt.Errorf("invalid annotation %s: %s is not a positive integer", annotationRateLimit, v)
+		}
+		rf.before = append(rf.before, map[string]interface{}{
+			"kind": ratelimiter.Kind,
+			"name": "rate-limiter",
+			"policies": []map[string]interface{}{{
+				"name":               "default",
+				"limitForPeriod":     rps,
+				"limitRefreshPeriod": "1s",
+			}},
+			"defaultPolicyRef": "default",
+			"urls": []map[string]interface{}{{
+				"url": map[string]interface{}{"prefix": "/"},
+			}},
+		})
+	}
+
+	if v, ok := annotations[annotationEnableCORS]; ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %v", annotationEnableCORS, err)
+		}
+		if enabled {
+			filter, err := corsFilter(annotations)
+			if err != nil {
+				return nil, err
+			}
+			rf.before = append(rf.before, filter)
+		}
+	}
+
+	header, err := headerAdaptSpec(annotations, annotationRequestHeadersSet,
+		annotationRequestHeadersAdd, annotationRequestHeadersRemove)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		rf.before = append(rf.before, map[string]interface{}{
+			"kind":   requestadaptor.Kind,
+			"name":   "request-header-adaptor",
+			"header": header,
+		})
+	}
+
+	if v, ok := annotations[annotationFilters]; ok {
+		var filters []map[string]interface{}
+		if err := codectool.Unmarshal([]byte(v), &filters); err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %v", annotationFilters, err)
+		}
+		for _, f := range filters {
+			if f["kind"] == nil || f["name"] == nil {
+				return nil, fmt.Errorf("invalid annotation %s: both kind and name of filters are required", annotationFilters)
+			}
+		}
+		rf.before = append(rf.before, filters...)
+	}
+
+	header, err = headerAdaptSpec(annotations, annotationResponseHeadersSet,
+		annotationResponseHeadersAdd, annotationResponseHeadersRemove)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		rf.after = append(rf.after, map[string]interface{}{
+			"kind":   responseadaptor.Kind,
+			"name":   "response-header-adaptor",
+			"header": header,
+		})
+	}
+
+	return rf, nil
+}
+
+func corsFilter(annotations map[string]string) (map[string]interface{}, error) {
+	filter := map[string]interface{}{
+		"kind":           corsfilter.Kind,
+		"name":           "cors-filter",
+		"allowedOrigins": []string{"*"},
+	}
+
+	lists := map[string]string{
+		annotationCORSAllowOrigins:  "allowedOrigins",
+		annotationCORSAllowMethods:  "allowedMethods",
+		annotationCORSAllowHeaders:  "allowedHeaders",
+		annotationCORSExposeHeaders: "exposedHeaders",
+	}
+	for key, field := range lists {
+		if v, ok := annotations[key]; ok {
+			filter[field] = splitList(v)
+		}
+	}
+
+	if v, ok := annotations[annotationCORSAllowCredentials]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %v", annotationCORSAllowCredentials, err)
+		}
+		filter["allowCredentials"] = b
+	}
+	if v, ok := annotations[annotationCORSMaxAge]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %v", annotationCORSMaxAge, err)
+		}
+		filter["maxAge"] = n
+	}
+	return filter, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/megaease/easegress/pkg/filters/mock"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	apicorev1 "k8s.io/api/core/v1"
+	apinetv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newIngress(name, host string, annotations map[string]string) *apinetv1.Ingress {
+	ingressClass := defaultIngressClass
+	pathType := apinetv1.PathTypePrefix
+	return &apinetv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations},
+		Spec: apinetv1.IngressSpec{
+			IngressClassName: &ingressClass,
+			Rules: []apinetv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: apinetv1.IngressRuleValue{
+					HTTP: &apinetv1.HTTPIngressRuleValue{
+						Paths: []apinetv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: apinetv1.IngressBackend{
+								Service: &apinetv1.IngressServiceBackend{
+									Name: "foo",
+									Port: apinetv1.ServiceBackendPort{Number: 80},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestTranslateAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	svc, ep := newService("foo", "10.0.0.1")
+	factory.Core().V1().Services().Informer().GetIndexer().Add(svc)
+	factory.Core().V1().Endpoints().Informer().GetIndexer().Add(ep)
+	factory.Core().V1().Secrets().Informer().GetIndexer().Add(&apicorev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "jwt", Namespace: "default"},
+		Data:       map[string][]byte{jwtSecretKey: []byte("secret")},
+	})
+
+	ingresses := factory.Networking().V1().Ingresses().Informer().GetIndexer()
+	ingresses.Add(newIngress("plain", "plain.example.com", nil))
+	ingresses.Add(newIngress("filtered", "filtered.example.com", map[string]string{
+		annotationJWTSecret:             "jwt",
+		annotationRateLimit:             "100",
+		annotationEnableCORS:            "true",
+		annotationCORSAllowMethods:      "GET, POST",
+		annotationRequestHeadersSet:     `{"X-Env": "prod"}`,
+		annotationResponseHeadersRemove: "Server",
+		annotationFilters: `
+- kind: Mock
+  name: mock
+  rules:
+  - match:
+      pathPrefix: /mock
+    code: 200
+`,
+	}))
+	ingresses.Add(newIngress("invalid", "invalid.example.com", map[string]string{
+		annotationJWTSecret: "not-exist",
+	}))
+
+	c := &k8sClient{namespaces: []string{metav1.NamespaceAll}, informerFactory: factory}
+	st := newSpecTranslator(c, &Spec{
+		HTTPServer:   &httpserver.Spec{Port: 8080, KeepAlive: true, MaxConnections: 10240},
+		IngressClass: defaultIngressClass,
+	})
+	assert.NoError(st.translate())
+
+	pipelines := st.pipelineSpecs()
+	assert.Len(pipelines, 2)
+	assert.Contains(pipelines, "pipeline-default-foo-80")
+
+	spec := pipelines["pipeline-ingress-default-filtered-foo-80"]
+	if !assert.NotNil(spec) {
+		return
+	}
+	var flow []string
+	for _, node := range spec.ObjectSpec().(*pipeline.Spec).Flow {
+		flow = append(flow, node.FilterName)
+	}
+	assert.Equal([]string{"jwt-validator", "rate-limiter", "cors-filter", "request-header-adaptor",
+		"mock", "proxy", "response-header-adaptor"}, flow)
+	assert.Contains(spec.JSONConfig(), `"secret":"736563726574"`)
+	assert.Contains(spec.JSONConfig(), `"allowedMethods":["GET","POST"]`)
+
+	b := &httpServerSpecBuilder{}
+	codectool.MustUnmarshal([]byte(st.httpServerSpec().JSONConfig()), b)
+	backends := map[string]string{}
+	for _, r := range b.Rules {
+		backends[r.Host] = r.Paths[0].Backend
+	}
+	// the routes of the ingress with invalid annotations are not created.
+	assert.Equal(map[string]string{
+		"filtered.example.com": "pipeline-ingress-default-filtered-foo-80",
+		"plain.example.com":    "pipeline-default-foo-80",
+	}, backends)
+}
+
+func TestTranslateAnnotationsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	st := newSpecTranslator(&k8sClient{}, &Spec{HTTPServer: &httpserver.Spec{}})
+	for _, annotations := range []map[string]string{
+		{annotationRateLimit: "0"},
+		{annotationEnableCORS: "yes please"},
+		{annotationEnableCORS: "true", annotationCORSMaxAge: "1h"},
+		{annotationRequestHeadersSet: "[a, b]"},
+		{annotationFilters: "- kind: Mock"},
+	} {
+		_, err := st.translateAnnotations(newIngress("test", "", annotations))
+		assert.Error(err, "%v", annotations)
+	}
+
+	rf, err := st.translateAnnotations(newIngress("test", "", map[string]string{annotationEnableCORS: "false"}))
+	assert.NoError(err)
+	assert.True(rf.empty())
+}
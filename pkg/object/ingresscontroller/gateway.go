@@ -0,0 +1,767 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/tcpserver"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	apinetv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	gatewayGroup = "gateway.networking.k8s.io"
+
+	protocolHTTP  = "HTTP"
+	protocolHTTPS = "HTTPS"
+	protocolTLS   = "TLS"
+
+	tlsModePassthrough = "Passthrough"
+
+	pathMatchExact             = "Exact"
+	pathMatchPathPrefix        = "PathPrefix"
+	pathMatchRegularExpression = "RegularExpression"
+
+	headerMatchRegularExpression = "RegularExpression"
+
+	namespacesFromAll  = "All"
+	namespacesFromSame = "Same"
+)
+
+var (
+	gatewayClassGVR = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1beta1", Resource: "gatewayclasses"}
+	gatewayGVR      = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1beta1", Resource: "gateways"}
+	httpRouteGVR    = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1beta1", Resource: "httproutes"}
+	tlsRouteGVR     = schema.GroupVersionResource{Group: gatewayGroup, Version: "v1alpha2", Resource: "tlsroutes"}
+)
+
+// The types below are the subsets of the Gateway API resources used by
+// the translation, they are converted from the unstructured objects, so
+// that the Gateway API module is not required.
+type (
+	gatewayClass struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Spec              struct {
+			ControllerName string `json:"controllerName"`
+		} `json:"spec"`
+	}
+
+	gateway struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Spec              struct {
+			GatewayClassName string             `json:"gatewayClassName"`
+			Listeners        []*gatewayListener `json:"listeners"`
+		} `json:"spec"`
+	}
+
+	gatewayListener struct {
+		Name          string            `json:"name"`
+		Hostname      string            `json:"hostname"`
+		Port          int32             `json:"port"`
+		Protocol      string            `json:"protocol"`
+		TLS           *gatewayTLSConfig `json:"tls"`
+		AllowedRoutes *struct {
+			Namespaces *struct {
+				From string `json:"from"`
+			} `json:"namespaces"`
+		} `json:"allowedRoutes"`
+	}
+
+	gatewayTLSConfig struct {
+		Mode            string             `json:"mode"`
+		CertificateRefs []*objectReference `json:"certificateRefs"`
+	}
+
+	objectReference struct {
+		Group     string `json:"group"`
+		Kind      string `json:"kind"`
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	}
+
+	parentReference struct {
+		Group       string `json:"group"`
+		Kind        string `json:"kind"`
+		Name        string `json:"name"`
+		Namespace   string `json:"namespace"`
+		SectionName string `json:"sectionName"`
+		Port        int32  `json:"port"`
+	}
+
+	backendReference struct {
+		Group     string `json:"group"`
+		Kind      string `json:"kind"`
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Port      int32  `json:"port"`
+		Weight    *int32 `json:"weight"`
+	}
+
+	httpRoute struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Spec              struct {
+			ParentRefs []*parentReference `json:"parentRefs"`
+			Hostnames  []string           `json:"hostnames"`
+			Rules      []*httpRouteRule   `json:"rules"`
+		} `json:"spec"`
+	}
+
+	httpRouteRule struct {
+		Matches     []*httpRouteMatch   `json:"matches"`
+		BackendRefs []*backendReference `json:"backendRefs"`
+		Filters     []*struct {
+			Type string `json:"type"`
+		} `json:"filters"`
+	}
+
+	httpRouteMatch struct {
+		Path *struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"path"`
+		Headers []*struct {
+			Type  string `json:"type"`
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		QueryParams []interface{} `json:"queryParams"`
+		Method      string        `json:"method"`
+	}
+
+	tlsRoute struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Spec              struct {
+			ParentRefs []*parentReference `json:"parentRefs"`
+			Hostnames  []string           `json:"hostnames"`
+			Rules      []*struct {
+				BackendRefs []*backendReference `json:"backendRefs"`
+			} `json:"rules"`
+		} `json:"spec"`
+	}
+
+	// weightedBackend is a backend of a route with its endpoints.
+	weightedBackend struct {
+		endpoints []string
+		weight    int32
+	}
+)
+
+// hasResource returns whether the resource is served by the API server,
+// i.e. whether the CRD is installed.
+func hasResource(cli discovery.DiscoveryInterface, gvr schema.GroupVersionResource) bool {
+	list, err := cli.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, r := range list.APIResources {
+		if r.Name == gvr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// watchGatewayAPI watches the Gateway API resources, the TLSRoutes are
+// optional as they are not in the standard channel.
+func (c *k8sClient) watchGatewayAPI(stopCh chan struct{}) error {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(c.config)
+	if err != nil {
+		return err
+	}
+	for _, gvr := range []schema.GroupVersionResource{gatewayClassGVR, gatewayGVR, httpRouteGVR} {
+		if !hasResource(discoveryClient, gvr) {
+			return fmt.Errorf("resource %s not found, the Gateway API CRDs are not installed", gvr)
+		}
+	}
+	resources := []schema.GroupVersionResource{gatewayGVR, httpRouteGVR}
+	if hasResource(discoveryClient, tlsRouteGVR) {
+		resources = append(resources, tlsRouteGVR)
+	} else {
+		logger.Warnf("resource %s not found, TLSRoutes are ignored", tlsRouteGVR)
+	}
+
+	client, err := dynamic.NewForConfig(c.config)
+	if err != nil {
+		return err
+	}
+
+	c.gatewayListers = map[schema.GroupVersionResource][]cache.GenericLister{}
+	addInformer := func(factory dynamicinformer.DynamicSharedInformerFactory, gvr schema.GroupVersionResource) {
+		informer := factory.ForResource(gvr)
+		informer.Informer().AddEventHandler(c)
+		c.gatewayListers[gvr] = append(c.gatewayListers[gvr], informer.Lister())
+	}
+
+	// GatewayClasses are cluster scoped.
+	factories := []dynamicinformer.DynamicSharedInformerFactory{
+		dynamicinformer.NewDynamicSharedInformerFactory(client, resyncPeriod),
+	}
+	addInformer(factories[0], gatewayClassGVR)
+	for _, ns := range c.namespaces {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, ns, nil)
+		for _, gvr := range resources {
+			addInformer(factory, gvr)
+		}
+		factories = append(factories, factory)
+	}
+
+	for _, factory := range factories {
+		factory.Start(stopCh)
+		for typ, ok := range factory.WaitForCacheSync(stopCh) {
+			if !ok {
+				return fmt.Errorf("timed out waiting for controller caches to sync %s", typ)
+			}
+		}
+	}
+	return nil
+}
+
+// listGatewayResources lists the resources of gvr and converts them by
+// fn, the resources failed to convert are skipped.
+func (c *k8sClient) listGatewayResources(gvr schema.GroupVersionResource, fn func(u *unstructured.Unstructured) error) {
+	for _, lister := range c.gatewayListers[gvr] {
+		list, err := lister.List(labels.Everything())
+		if err != nil {
+			logger.Errorf("failed to list %s: %v", gvr.Resource, err)
+			continue
+		}
+		for _, obj := range list {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			if err := fn(u); err != nil {
+				logger.Errorf("failed to convert %s %s/%s: %v", gvr.Resource, u.GetNamespace(), u.GetName(), err)
+			}
+		}
+	}
+}
+
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), obj)
+}
+
+func (c *k8sClient) getGatewayClasses(controllerName string) map[string]bool {
+	result := map[string]bool{}
+	c.listGatewayResources(gatewayClassGVR, func(u *unstructured.Unstructured) error {
+		gc := &gatewayClass{}
+		if err := fromUnstructured(u, gc); err != nil {
+			return err
+		}
+		if gc.Spec.ControllerName == controllerName {
+			result[gc.Name] = true
+		}
+		return nil
+	})
+	return result
+}
+
+func (c *k8sClient) getGateways() []*gateway {
+	var result []*gateway
+	c.listGatewayResources(gatewayGVR, func(u *unstructured.Unstructured) error {
+		gw := &gateway{}
+		if err := fromUnstructured(u, gw); err != nil {
+			return err
+		}
+		result = append(result, gw)
+		return nil
+	})
+	return result
+}
+
+func (c *k8sClient) getHTTPRoutes() []*httpRoute {
+	var result []*httpRoute
+	c.listGatewayResources(httpRouteGVR, func(u *unstructured.Unstructured) error {
+		route := &httpRoute{}
+		if err := fromUnstructured(u, route); err != nil {
+			return err
+		}
+		result = append(result, route)
+		return nil
+	})
+	return result
+}
+
+func (c *k8sClient) getTLSRoutes() []*tlsRoute {
+	var result []*tlsRoute
+	c.listGatewayResources(tlsRouteGVR, func(u *unstructured.Unstructured) error {
+		route := &tlsRoute{}
+		if err := fromUnstructured(u, route); err != nil {
+			return err
+		}
+		result = append(result, route)
+		return nil
+	})
+	return result
+}
+
+// allowsRoutesFrom returns whether the listener of the gateway in
+// gatewayNamespace accepts the routes in namespace, the namespace
+// selectors are not supported.
+func (l *gatewayListener) allowsRoutesFrom(gatewayNamespace, namespace string) bool {
+	from := namespacesFromSame
+	if l.AllowedRoutes != nil && l.AllowedRoutes.Namespaces != nil && l.AllowedRoutes.Namespaces.From != "" {
+		from = l.AllowedRoutes.Namespaces.From
+	}
+
+	switch from {
+	case namespacesFromAll:
+		return true
+	case namespacesFromSame:
+		return namespace == gatewayNamespace
+	default:
+		return false
+	}
+}
+
+// attachedListeners returns the listeners of the gateways that the route
+// attaches to, the listeners are filtered by the section names and ports
+// of the parent references and the protocols.
+func attachedListeners(gateways map[string]*gateway, namespace string, parents []*parentReference, match func(l *gatewayListener) bool) []*gatewayListener {
+	var result []*gatewayListener
+	for _, parent := range parents {
+		if (parent.Group != "" && parent.Group != gatewayGroup) || (parent.Kind != "" && parent.Kind != "Gateway") {
+			continue
+		}
+		ns := parent.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		gw := gateways[ns+"/"+parent.Name]
+		if gw == nil {
+			continue
+		}
+
+		for _, l := range gw.Spec.Listeners {
+			if parent.SectionName != "" && parent.SectionName != l.Name {
+				continue
+			}
+			if parent.Port != 0 && parent.Port != l.Port {
+				continue
+			}
+			if match(l) && l.allowsRoutesFrom(gw.Namespace, namespace) {
+				result = append(result, l)
+			}
+		}
+	}
+	return result
+}
+
+// hostnameMatches returns whether host matches pattern, the pattern could
+// be a wildcard hostname like "*.example.com".
+func hostnameMatches(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "*.") {
+		return len(host) > len(pattern)-1 && strings.HasSuffix(strings.ToLower(host), strings.ToLower(pattern[1:]))
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+// routeHostnames returns the hostnames of the route that are accepted by
+// the listeners, an empty hostname matches all hosts.
+func routeHostnames(listeners []*gatewayListener, hostnames []string) []string {
+	set := map[string]bool{}
+	for _, l := range listeners {
+		if len(hostnames) == 0 {
+			set[l.Hostname] = true
+			continue
+		}
+		for _, h := range hostnames {
+			switch {
+			case l.Hostname == "" || hostnameMatches(l.Hostname, h):
+				set[h] = true
+			case hostnameMatches(h, l.Hostname):
+				set[l.Hostname] = true
+			}
+		}
+	}
+
+	result := make([]string, 0, len(set))
+	for h := range set {
+		result = append(result, h)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// endpointWeights returns the weights of the endpoints of the backends, so
+// that the traffic is split among the backends in proportion to their
+// weights regardless of the number of their endpoints. The weights are
+// nil if there is only one backend.
+func endpointWeights(backends []*weightedBackend) [][]int {
+	if len(backends) < 2 {
+		return nil
+	}
+
+	maxWeight := 0.0
+	for _, b := range backends {
+		maxWeight = math.Max(maxWeight, float64(b.weight)/float64(len(b.endpoints)))
+	}
+
+	result := make([][]int, len(backends))
+	for i, b := range backends {
+		w := int(math.Round(100 * float64(b.weight) / float64(len(b.endpoints)) / maxWeight))
+		if w < 1 {
+			w = 1
+		}
+		result[i] = make([]int, len(b.endpoints))
+		for j := range result[i] {
+			result[i][j] = w
+		}
+	}
+	return result
+}
+
+// getBackends returns the backends of the route with their endpoints, the
+// backends in other namespaces and the ones with a zero weight are skipped.
+func (st *specTranslator) getBackends(namespace string, refs []*backendReference) []*weightedBackend {
+	var result []*weightedBackend
+	for _, ref := range refs {
+		if (ref.Group != "" && ref.Group != "core") || (ref.Kind != "" && ref.Kind != "Service") {
+			logger.Errorf("backend %s of kind %s is not supported", ref.Name, ref.Kind)
+			continue
+		}
+		if ref.Namespace != "" && ref.Namespace != namespace {
+			logger.Errorf("backend %s/%s is not in the namespace of the route", ref.Namespace, ref.Name)
+			continue
+		}
+
+		weight := int32(1)
+		if ref.Weight != nil {
+			weight = *ref.Weight
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		service := &apinetv1.IngressServiceBackend{
+			Name: ref.Name,
+			Port: apinetv1.ServiceBackendPort{Number: ref.Port},
+		}
+		endpoints, err := st.getEndpoints(namespace, service)
+		if err != nil {
+			logger.Errorf("failed to get service endpoints: %v", err)
+			continue
+		}
+		result = append(result, &weightedBackend{endpoints: endpoints, weight: weight})
+	}
+	return result
+}
+
+func (st *specTranslator) translateGateways(b *httpServerSpecBuilder) error {
+	classes := st.k8sClient.getGatewayClasses(st.gatewayControllerName)
+	gateways := map[string]*gateway{}
+	for _, gw := range st.k8sClient.getGateways() {
+		if !classes[gw.Spec.GatewayClassName] {
+			continue
+		}
+		gateways[gw.Namespace+"/"+gw.Name] = gw
+	}
+
+	if st.httpSvrCfg.HTTPS {
+		st.translateGatewayTLSConfig(b, gateways)
+	}
+
+	for _, route := range st.k8sClient.getHTTPRoutes() {
+		st.translateHTTPRoute(b, gateways, route)
+	}
+
+	tcpSvrs := map[uint16]*tcpserver.Spec{}
+	for _, route := range st.k8sClient.getTLSRoutes() {
+		st.translateTLSRoute(tcpSvrs, gateways, route)
+	}
+	for port, spec := range tcpSvrs {
+		if len(spec.Rules) == 0 && spec.DefaultPool == nil {
+			continue
+		}
+		sort.Slice(spec.Rules, func(i, j int) bool {
+			return spec.Rules[i].SNI[0] < spec.Rules[j].SNI[0]
+		})
+
+		b := &tcpServerSpecBuilder{
+			Kind: tcpserver.Kind,
+			Name: fmt.Sprintf("tcp-server-ingress-controller-%d", port),
+			Spec: *spec,
+		}
+		buff, err := codectool.MarshalJSON(b)
+		if err != nil {
+			return err
+		}
+		superSpec, err := supervisor.NewSpec(string(buff))
+		if err != nil {
+			return err
+		}
+		st.tcpSvrs[port] = superSpec
+	}
+	return nil
+}
+
+// hasSNI returns whether the host is in the rules of spec.
+func hasSNI(spec *tcpserver.Spec, host string) bool {
+	for _, r := range spec.Rules {
+		for _, sni := range r.SNI {
+			if strings.EqualFold(sni, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tcpServerSpecBuilder builds the spec of the TCPServer of a TLS listener
+// port.
+type tcpServerSpecBuilder struct {
+	Kind           string `json:"kind"`
+	Name           string `json:"name"`
+	tcpserver.Spec `json:",inline"`
+}
+
+// translateGatewayTLSConfig adds the certificates of the HTTPS listeners
+// to the HTTPServer.
+func (st *specTranslator) translateGatewayTLSConfig(b *httpServerSpecBuilder, gateways map[string]*gateway) {
+	if b.Certs == nil {
+		b.Certs, b.Keys = map[string]string{}, map[string]string{}
+	}
+
+	for _, gw := range gateways {
+		for _, l := range gw.Spec.Listeners {
+			if l.Protocol != protocolHTTPS || l.TLS == nil {
+				continue
+			}
+			for _, ref := range l.TLS.CertificateRefs {
+				if ref.Kind != "" && ref.Kind != "Secret" {
+					continue
+				}
+				// certificates in other namespaces are not supported as
+				// ReferenceGrants are not checked.
+				if ref.Namespace != "" && ref.Namespace != gw.Namespace {
+					logger.Errorf("secret %s/%s is not in the namespace of gateway %s", ref.Namespace, ref.Name, gw.Name)
+					continue
+				}
+
+				cfgKey := gw.Namespace + "/" + ref.Name
+				if _, ok := b.Certs[cfgKey]; ok {
+					continue
+				}
+				secret, err := st.k8sClient.getSecret(gw.Namespace, ref.Name)
+				if err != nil || secret == nil {
+					logger.Errorf("failed to get secret %s: %v", cfgKey, err)
+					continue
+				}
+				cert, key, err := getCertificateBlocks(secret, gw.Namespace, ref.Name)
+				if err != nil {
+					logger.Errorf("%v", err)
+					continue
+				}
+				b.Certs[cfgKey] = cert
+				b.Keys[cfgKey] = key
+			}
+		}
+	}
+}
+
+// httpRouteMatchToPath converts a match of an HTTPRoute to a path of the
+// HTTPServer.
+func httpRouteMatchToPath(m *httpRouteMatch, backend string) (*httpserver.Path, error) {
+	p := &httpserver.Path{Backend: backend}
+
+	typ, value := pathMatchPathPrefix, "/"
+	if m.Path != nil {
+		if m.Path.Type != "" {
+			typ = m.Path.Type
+		}
+		if m.Path.Value != "" {
+			value = m.Path.Value
+		}
+	}
+	switch typ {
+	case pathMatchExact:
+		p.Path = value
+	case pathMatchPathPrefix:
+		p.PathPrefix = value
+	case pathMatchRegularExpression:
+		p.PathRegexp = value
+	default:
+		return nil, fmt.Errorf("unknown path match type %s", typ)
+	}
+
+	if len(m.QueryParams) > 0 {
+		return nil, fmt.Errorf("query param matches are not supported")
+	}
+	if m.Method != "" {
+		p.Methods = []string{m.Method}
+	}
+
+	for _, h := range m.Headers {
+		header := &httpserver.Header{Key: h.Name}
+		if h.Type == headerMatchRegularExpression {
+			header.Regexp = h.Value
+		} else {
+			header.Values = []string{h.Value}
+		}
+		p.Headers = append(p.Headers, header)
+	}
+	p.MatchAllHeader = len(p.Headers) > 0
+	return p, nil
+}
+
+func (st *specTranslator) translateHTTPRoute(b *httpServerSpecBuilder, gateways map[string]*gateway, route *httpRoute) {
+	listeners := attachedListeners(gateways, route.Namespace, route.Spec.ParentRefs, func(l *gatewayListener) bool {
+		return l.Protocol == protocolHTTP || l.Protocol == protocolHTTPS
+	})
+	hostnames := routeHostnames(listeners, route.Spec.Hostnames)
+	if len(hostnames) == 0 {
+		return
+	}
+
+	for i, rule := range route.Spec.Rules {
+		if len(rule.Filters) > 0 {
+			logger.Warnf("filters of httproute %s/%s are not supported, ignored", route.Namespace, route.Name)
+		}
+
+		backends := st.getBackends(route.Namespace, rule.BackendRefs)
+		if len(backends) == 0 {
+			logger.Errorf("no available backend for rule %d of httproute %s/%s", i, route.Namespace, route.Name)
+			continue
+		}
+
+		var servers []*proxy.Server
+		weights := endpointWeights(backends)
+		for j, backend := range backends {
+			for k, ep := range backend.endpoints {
+				svr := &proxy.Server{URL: ep}
+				if weights != nil {
+					svr.Weight = weights[j][k]
+				}
+				servers = append(servers, svr)
+			}
+		}
+		policy := ""
+		if weights != nil {
+			policy = proxy.LoadBalancePolicyWeightedRoundRobin
+		}
+
+		name := fmt.Sprintf("pipeline-httproute-%s-%s-%d", route.Namespace, route.Name, i)
+		pb := newPipelineSpecBuilder(name)
+		pb.addProxyServers(servers, policy)
+		spec, err := supervisor.NewSpec(pb.jsonConfig())
+		if err != nil {
+			logger.Errorf("failed to generate pipeline spec: %v", err)
+			continue
+		}
+
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []*httpRouteMatch{{}}
+		}
+		var paths []*httpserver.Path
+		for _, m := range matches {
+			p, err := httpRouteMatchToPath(m, name)
+			if err != nil {
+				logger.Errorf("invalid match of httproute %s/%s: %v", route.Namespace, route.Name, err)
+				continue
+			}
+			paths = append(paths, p)
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		st.pipelines[name] = spec
+		for _, host := range hostnames {
+			r := &httpserver.Rule{Paths: append([]*httpserver.Path(nil), paths...)}
+			b.addRule(host, r)
+		}
+	}
+}
+
+func (st *specTranslator) translateTLSRoute(tcpSvrs map[uint16]*tcpserver.Spec, gateways map[string]*gateway, route *tlsRoute) {
+	listeners := attachedListeners(gateways, route.Namespace, route.Spec.ParentRefs, func(l *gatewayListener) bool {
+		return l.Protocol == protocolTLS && l.TLS != nil && l.TLS.Mode == tlsModePassthrough
+	})
+	if len(listeners) == 0 {
+		return
+	}
+
+	var refs []*backendReference
+	for _, rule := range route.Spec.Rules {
+		refs = append(refs, rule.BackendRefs...)
+	}
+	backends := st.getBackends(route.Namespace, refs)
+	if len(backends) == 0 {
+		logger.Errorf("no available backend for tlsroute %s/%s", route.Namespace, route.Name)
+		return
+	}
+
+	pool := &tcpserver.PoolSpec{}
+	weights := endpointWeights(backends)
+	for i, backend := range backends {
+		for j, ep := range backend.endpoints {
+			// the endpoints are URLs of HTTP, only the addresses are used.
+			if k := strings.Index(ep, "://"); k >= 0 {
+				ep = ep[k+3:]
+			}
+			svr := &tcpserver.ServerSpec{Address: ep}
+			if weights != nil {
+				svr.Weight = weights[i][j]
+			}
+			pool.Servers = append(pool.Servers, svr)
+		}
+	}
+
+	for _, l := range listeners {
+		port := uint16(l.Port)
+		spec := tcpSvrs[port]
+		if spec == nil {
+			spec = &tcpserver.Spec{Port: port}
+			tcpSvrs[port] = spec
+		}
+
+		var sni []string
+		for _, host := range routeHostnames([]*gatewayListener{l}, route.Spec.Hostnames) {
+			if host == "" {
+				if spec.DefaultPool == nil {
+					spec.DefaultPool = pool
+				}
+				continue
+			}
+			if !hasSNI(spec, host) {
+				sni = append(sni, host)
+			}
+		}
+		if len(sni) > 0 {
+			spec.Rules = append(spec.Rules, &tcpserver.RuleSpec{SNI: sni, Pool: pool})
+		}
+	}
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ingresscontroller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/tcpserver"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	apicorev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const gatewayResources = `
+- apiVersion: gateway.networking.k8s.io/v1beta1
+  kind: GatewayClass
+  metadata:
+    name: easegress
+  spec:
+    controllerName: megaease.com/ingress-controller
+- apiVersion: gateway.networking.k8s.io/v1beta1
+  kind: GatewayClass
+  metadata:
+    name: others
+  spec:
+    controllerName: example.com/gateway-controller
+- apiVersion: gateway.networking.k8s.io/v1beta1
+  kind: Gateway
+  metadata:
+    name: gateway
+    namespace: default
+  spec:
+    gatewayClassName: easegress
+    listeners:
+    - name: http
+      protocol: HTTP
+      port: 80
+      hostname: "*.example.com"
+    - name: tls
+      protocol: TLS
+      port: 8443
+      tls:
+        mode: Passthrough
+      allowedRoutes:
+        namespaces:
+          from: All
+- apiVersion: gateway.networking.k8s.io/v1beta1
+  kind: Gateway
+  metadata:
+    name: other-gateway
+    namespace: default
+  spec:
+    gatewayClassName: others
+    listeners:
+    - name: http
+      protocol: HTTP
+      port: 80
+- apiVersion: gateway.networking.k8s.io/v1beta1
+  kind: HTTPRoute
+  metadata:
+    name: route
+    namespace: default
+  spec:
+    parentRefs:
+    - name: gateway
+    hostnames:
+    - foo.example.com
+    - bar.other.com
+    rules:
+    - matches:
+      - path:
+          type: Exact
+          value: /login
+        method: POST
+      - path:
+          value: /api
+        headers:
+        - name: X-Version
+          value: v2
+      backendRefs:
+      - name: foo
+        port: 80
+        weight: 90
+      - name: bar
+        port: 80
+        weight: 10
+    - backendRefs:
+      - name: foo
+        port: 80
+- apiVersion: gateway.networking.k8s.io/v1beta1
+  kind: HTTPRoute
+  metadata:
+    name: other-route
+    namespace: default
+  spec:
+    parentRefs:
+    - name: other-gateway
+    rules:
+    - backendRefs:
+      - name: foo
+        port: 80
+- apiVersion: gateway.networking.k8s.io/v1alpha2
+  kind: TLSRoute
+  metadata:
+    name: tls-route
+    namespace: default
+  spec:
+    parentRefs:
+    - name: gateway
+      sectionName: tls
+    hostnames:
+    - tls.example.com
+    rules:
+    - backendRefs:
+      - name: bar
+        port: 80
+`
+
+func newService(name, ip string) (*apicorev1.Service, *apicorev1.Endpoints) {
+	meta := metav1.ObjectMeta{Name: name, Namespace: "default"}
+	svc := &apicorev1.Service{
+		ObjectMeta: meta,
+		Spec: apicorev1.ServiceSpec{
+			Ports: []apicorev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	ep := &apicorev1.Endpoints{
+		ObjectMeta: meta,
+		Subsets: []apicorev1.EndpointSubset{{
+			Addresses: []apicorev1.EndpointAddress{{IP: ip}},
+			Ports:     []apicorev1.EndpointPort{{Name: "http", Port: 8080}},
+		}},
+	}
+	return svc, ep
+}
+
+func newGatewayTestClient(t *testing.T) *k8sClient {
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	for _, name := range []string{"foo", "bar"} {
+		svc, ep := newService(name, "10.0.0."+map[string]string{"foo": "1", "bar": "2"}[name])
+		factory.Core().V1().Services().Informer().GetIndexer().Add(svc)
+		factory.Core().V1().Endpoints().Informer().GetIndexer().Add(ep)
+	}
+
+	var objs []map[string]interface{}
+	codectool.MustUnmarshal([]byte(gatewayResources), &objs)
+
+	c := &k8sClient{
+		namespaces:      []string{metav1.NamespaceAll},
+		informerFactory: factory,
+		gatewayListers:  map[schema.GroupVersionResource][]cache.GenericLister{},
+	}
+	indexers := map[schema.GroupVersionResource]cache.Indexer{}
+	for _, obj := range objs {
+		u := &unstructured.Unstructured{Object: obj}
+		gvr := map[string]schema.GroupVersionResource{
+			"GatewayClass": gatewayClassGVR,
+			"Gateway":      gatewayGVR,
+			"HTTPRoute":    httpRouteGVR,
+			"TLSRoute":     tlsRouteGVR,
+		}[u.GetKind()]
+
+		indexer := indexers[gvr]
+		if indexer == nil {
+			indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			indexers[gvr] = indexer
+			c.gatewayListers[gvr] = []cache.GenericLister{cache.NewGenericLister(indexer, gvr.GroupResource())}
+		}
+		if err := indexer.Add(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+func TestTranslateGateways(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		HTTPServer:            &httpserver.Spec{Port: 8080, KeepAlive: true, MaxConnections: 10240},
+		IngressClass:          defaultIngressClass,
+		GatewayAPI:            true,
+		GatewayControllerName: defaultIngressControllerName,
+	}
+	st := newSpecTranslator(newGatewayTestClient(t), spec)
+	assert.NoError(st.translate())
+
+	// the route of other-gateway is not served.
+	pipelines := st.pipelineSpecs()
+	assert.Len(pipelines, 2)
+	assert.Contains(pipelines, "pipeline-httproute-default-route-0")
+	assert.Contains(pipelines, "pipeline-httproute-default-route-1")
+
+	b := &httpServerSpecBuilder{}
+	codectool.MustUnmarshal([]byte(st.httpServerSpec().JSONConfig()), b)
+	// bar.other.com is not accepted by the listener.
+	assert.Len(b.Rules, 1)
+	r := b.Rules[0]
+	assert.Equal("foo.example.com", r.Host)
+	assert.Len(r.Paths, 3)
+	// the longer prefix first.
+	assert.Equal("/api", r.Paths[0].PathPrefix)
+	assert.True(r.Paths[0].MatchAllHeader)
+	assert.Equal("X-Version", r.Paths[0].Headers[0].Key)
+	assert.Equal([]string{"v2"}, r.Paths[0].Headers[0].Values)
+	assert.Equal("/", r.Paths[1].PathPrefix)
+	assert.Equal("pipeline-httproute-default-route-1", r.Paths[1].Backend)
+	assert.Equal("/login", r.Paths[2].Path)
+	assert.Equal([]string{"POST"}, r.Paths[2].Methods)
+	assert.Equal("pipeline-httproute-default-route-0", r.Paths[2].Backend)
+
+	p := newPipelineSpecBuilder("")
+	codectool.MustUnmarshal([]byte(pipelines["pipeline-httproute-default-route-0"].JSONConfig()), p)
+	pool := p.Filters[0]["pools"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(proxy.LoadBalancePolicyWeightedRoundRobin, pool["loadBalance"].(map[string]interface{})["policy"])
+	servers := pool["servers"].([]interface{})
+	assert.Equal("http://10.0.0.1:8080", servers[0].(map[string]interface{})["url"])
+	assert.EqualValues(100, servers[0].(map[string]interface{})["weight"])
+	assert.EqualValues(11, servers[1].(map[string]interface{})["weight"])
+
+	tcpSvrs := st.tcpServerSpecs()
+	assert.Len(tcpSvrs, 1)
+	tcpSpec := tcpSvrs[8443].ObjectSpec().(*tcpserver.Spec)
+	assert.Equal(uint16(8443), tcpSpec.Port)
+	assert.Len(tcpSpec.Rules, 1)
+	assert.Equal([]string{"tls.example.com"}, tcpSpec.Rules[0].SNI)
+	assert.Equal("10.0.0.2:8080", tcpSpec.Rules[0].Pool.Servers[0].Address)
+
+	// Gateway API is disabled.
+	spec.GatewayAPI = false
+	st = newSpecTranslator(newGatewayTestClient(t), spec)
+	st.translate()
+	assert.Empty(st.pipelineSpecs())
+	assert.Empty(st.tcpServerSpecs())
+}
+
+func TestRouteHostnames(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(hostnameMatches("*.example.com", "foo.example.com"))
+	assert.True(hostnameMatches("*.example.com", "foo.bar.example.com"))
+	assert.False(hostnameMatches("*.example.com", "example.com"))
+	assert.True(hostnameMatches("foo.example.com", "FOO.example.com"))
+
+	any := &gatewayListener{}
+	wildcard := &gatewayListener{Hostname: "*.example.com"}
+	assert.Equal([]string{""}, routeHostnames([]*gatewayListener{any}, nil))
+	assert.Equal([]string{"*.example.com"}, routeHostnames([]*gatewayListener{wildcard}, nil))
+	assert.Equal([]string{"a.com", "foo.example.com"}, routeHostnames([]*gatewayListener{any}, []string{"foo.example.com", "a.com"}))
+	assert.Equal([]string{"foo.example.com"}, routeHostnames([]*gatewayListener{wildcard}, []string{"foo.example.com", "a.com"}))
+	assert.Equal([]string{"*.example.com"}, routeHostnames([]*gatewayListener{wildcard}, []string{"*.com"}))
+	assert.Empty(routeHostnames([]*gatewayListener{wildcard}, []string{"a.com"}))
+}
+
+func TestEndpointWeights(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(endpointWeights([]*weightedBackend{{endpoints: []string{"a", "b"}, weight: 1}}))
+
+	weights := endpointWeights([]*weightedBackend{
+		{endpoints: []string{"a", "b"}, weight: 50},
+		{endpoints: []string{"c"}, weight: 50},
+		{endpoints: []string{"d"}, weight: 1},
+	})
+	assert.Equal([][]int{{50, 50}, {100}, {2}}, weights)
+}
+
+func TestHTTPRouteMatchToPath(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &httpRouteMatch{}
+	codectool.MustUnmarshal([]byte(`
+path:
+  type: RegularExpression
+  value: ^/v[0-9]+/
+headers:
+- type: RegularExpression
+  name: X-Id
+  value: "[0-9]+"
+`), m)
+	p, err := httpRouteMatchToPath(m, "backend")
+	assert.NoError(err)
+	assert.Equal("^/v[0-9]+/", p.PathRegexp)
+	assert.Equal("[0-9]+", p.Headers[0].Regexp)
+	assert.Equal("backend", p.Backend)
+
+	m.QueryParams = []interface{}{map[string]interface{}{"name": "a"}}
+	_, err = httpRouteMatchToPath(m, "backend")
+	assert.Error(err)
+}
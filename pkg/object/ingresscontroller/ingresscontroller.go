@@ -24,6 +24,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/httpserver"
+	"github.com/megaease/easegress/pkg/object/tcpserver"
 	"github.com/megaease/easegress/pkg/object/trafficcontroller"
 	"github.com/megaease/easegress/pkg/supervisor"
 )
@@ -50,6 +51,11 @@ type (
 		namespace string
 		k8sClient *k8sClient
 
+		// tcpServers serve the TLSRoutes of Gateway API, the key is the
+		// port. They are only accessed by the run goroutine.
+		tcpServers     map[uint16]*tcpserver.TCPServer
+		tcpServerSpecs map[uint16]*supervisor.Spec
+
 		stopCh chan struct{}
 		wg     sync.WaitGroup
 	}
@@ -61,6 +67,12 @@ type (
 		MasterURL    string           `json:"masterURL" jsonschema:"omitempty"`
 		Namespaces   []string         `json:"namespaces" jsonschema:"omitempty"`
 		IngressClass string           `json:"ingressClass" jsonschema:"omitempty"`
+
+		// GatewayAPI enables the support of Kubernetes Gateway API, the
+		// Gateways whose GatewayClass has the controller name of
+		// GatewayControllerName are served.
+		GatewayAPI            bool   `json:"gatewayAPI" jsonschema:"omitempty"`
+		GatewayControllerName string `json:"gatewayControllerName" jsonschema:"omitempty"`
 	}
 )
 
@@ -86,7 +98,8 @@ func (ic *IngressController) DefaultSpec() interface{} {
 			KeepAliveTimeout: "60s",
 			MaxConnections:   10240,
 		},
-		IngressClass: defaultIngressClass,
+		IngressClass:          defaultIngressClass,
+		GatewayControllerName: defaultIngressControllerName,
 	}
 }
 
@@ -115,6 +128,8 @@ func (ic *IngressController) reload() {
 
 	ic.namespace = fmt.Sprintf("%s/%s", ic.superSpec.Name(), "ingresscontroller")
 	ic.stopCh = make(chan struct{})
+	ic.tcpServers = map[uint16]*tcpserver.TCPServer{}
+	ic.tcpServerSpecs = map[uint16]*supervisor.Spec{}
 
 	ic.wg.Add(1)
 	go ic.run()
@@ -146,7 +161,7 @@ func (ic *IngressController) run() {
 		err    error
 	)
 	for {
-		stopCh, err = ic.k8sClient.watch(ic.spec.Namespaces)
+		stopCh, err = ic.k8sClient.watch(ic.spec.Namespaces, ic.spec.GatewayAPI)
 		if err == nil {
 			break
 		}
@@ -193,11 +208,14 @@ func (ic *IngressController) Close() {
 	close(ic.stopCh)
 	ic.wg.Wait()
 	ic.tc.Clean(ic.namespace)
+	for _, ts := range ic.tcpServers {
+		ts.Close()
+	}
 }
 
 func (ic *IngressController) translate() error {
 	logger.Debugf("begin translate kubernetes ingress to easegress configuration")
-	st := newSpecTranslator(ic.k8sClient, ic.spec.IngressClass, ic.spec.HTTPServer)
+	st := newSpecTranslator(ic.k8sClient, ic.spec)
 	err := st.translate()
 	if err != nil {
 		logger.Errorf("failed to translate kubernetes ingress: %v", err)
@@ -228,5 +246,30 @@ func (ic *IngressController) translate() error {
 		}
 	}
 
+	ic.applyTCPServers(st.tcpServerSpecs())
 	return nil
 }
+
+// applyTCPServers creates, updates or closes the TCPServers of the
+// TLSRoutes, the listeners are kept on updates.
+func (ic *IngressController) applyTCPServers(specs map[uint16]*supervisor.Spec) {
+	for port, spec := range specs {
+		ts := &tcpserver.TCPServer{}
+		if prev := ic.tcpServers[port]; prev == nil {
+			ts.Init(spec)
+		} else if !ic.tcpServerSpecs[port].Equals(spec) {
+			ts.Inherit(spec, prev)
+		} else {
+			continue
+		}
+		ic.tcpServers[port], ic.tcpServerSpecs[port] = ts, spec
+	}
+
+	for port, ts := range ic.tcpServers {
+		if _, ok := specs[port]; !ok {
+			ts.Close()
+			delete(ic.tcpServers, port)
+			delete(ic.tcpServerSpecs, port)
+		}
+	}
+}
@@ -37,6 +37,8 @@ import (
 	apinetv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
@@ -111,9 +113,14 @@ func isSubsetsChanged(a, b apicorev1.EndpointSubset) bool {
 
 type k8sClient struct {
 	namespaces      []string
+	config          *rest.Config
 	clientset       *kubernetes.Clientset
 	informerFactory informers.SharedInformerFactory
 	eventCh         chan interface{}
+
+	// gatewayListers are the listers of the Gateway API resources, there
+	// is one lister for every watched namespace.
+	gatewayListers map[schema.GroupVersionResource][]cache.GenericLister
 }
 
 // OnAdd is called on Resource Add Events.
@@ -167,6 +174,7 @@ func newK8sClient(masterURL string, kubeConfig string) (*k8sClient, error) {
 	}
 
 	return &k8sClient{
+		config:    cfg,
 		clientset: clientset,
 		eventCh:   make(chan interface{}, 1),
 	}, nil
@@ -204,7 +212,7 @@ func (c *k8sClient) event() <-chan interface{} {
 	return c.eventCh
 }
 
-func (c *k8sClient) watch(namespaces []string) (chan struct{}, error) {
+func (c *k8sClient) watch(namespaces []string, gatewayAPI bool) (chan struct{}, error) {
 	stopCh := make(chan struct{})
 
 	if len(namespaces) == 0 {
@@ -240,6 +248,13 @@ func (c *k8sClient) watch(namespaces []string) (chan struct{}, error) {
 	}
 
 	c.informerFactory = factory
+
+	if gatewayAPI {
+		if err := c.watchGatewayAPI(stopCh); err != nil {
+			close(stopCh)
+			return nil, err
+		}
+	}
 	return stopCh, nil
 }
 
@@ -40,13 +40,19 @@ const (
 
 type (
 	// specTranslator translates k8s ingress related specs to Easegress http server
-	// spec and pipeline specs
+	// spec and pipeline specs, and the TLSRoutes of Gateway API to tcp server
+	// specs
 	specTranslator struct {
 		k8sClient    *k8sClient
 		httpSvr      *supervisor.Spec
 		pipelines    map[string]*supervisor.Spec
+		tcpSvrs      map[uint16]*supervisor.Spec
 		httpSvrCfg   *httpserver.Spec
 		ingressClass string
+
+		// gatewayControllerName is the controller name of the served
+		// GatewayClasses, Gateway API is disabled if it is empty.
+		gatewayControllerName string
 	}
 
 	pipelineSpecBuilder struct {
@@ -71,14 +77,19 @@ func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
 }
 
 func (b *pipelineSpecBuilder) addProxy(endpoints []string) {
+	var servers []*proxy.Server
+	for _, ep := range endpoints {
+		servers = append(servers, &proxy.Server{URL: ep})
+	}
+	b.addProxyServers(servers, "")
+}
+
+func (b *pipelineSpecBuilder) addProxyServers(servers []*proxy.Server, policy string) {
 	const name = "proxy"
 
 	pool := &proxy.ServerPoolSpec{
-		LoadBalance: &proxy.LoadBalanceSpec{},
-	}
-
-	for _, ep := range endpoints {
-		pool.Servers = append(pool.Servers, &proxy.Server{URL: ep})
+		LoadBalance: &proxy.LoadBalanceSpec{Policy: policy},
+		Servers:     servers,
 	}
 
 	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: name})
@@ -90,6 +101,11 @@ func (b *pipelineSpecBuilder) addProxy(endpoints []string) {
 	)
 }
 
+func (b *pipelineSpecBuilder) addFilter(filter map[string]interface{}) {
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: fmt.Sprint(filter["name"])})
+	b.Filters = append(b.Filters, filter)
+}
+
 func (b *pipelineSpecBuilder) jsonConfig() string {
 	buff, err := codectool.MarshalJSON(b)
 	if err != nil {
@@ -112,6 +128,25 @@ func newHTTPServerSpecBuilder(template *httpserver.Spec) *httpServerSpecBuilder
 	}
 }
 
+// addRule adds the paths of r to the rule of host, a new rule is created
+// if there is no such rule. A host starts with '*' is a wildcard host.
+func (b *httpServerSpecBuilder) addRule(host string, r *httpserver.Rule) {
+	if len(host) > 0 && host[0] == '*' {
+		host = strings.ReplaceAll(host[1:], ".", "\\.")
+		r.HostRegexp = fmt.Sprintf("^[^.]+%s$", host)
+	} else {
+		r.Host = host
+	}
+
+	for _, r1 := range b.Rules {
+		if strings.EqualFold(r.Host, r1.Host) && strings.EqualFold(r.HostRegexp, r1.HostRegexp) {
+			r1.Paths = append(r1.Paths, r.Paths...)
+			return
+		}
+	}
+	b.Rules = append(b.Rules, r)
+}
+
 func (b *httpServerSpecBuilder) jsonConfig() string {
 	buff, err := codectool.MarshalJSON(b)
 	if err != nil {
@@ -120,13 +155,18 @@ func (b *httpServerSpecBuilder) jsonConfig() string {
 	return string(buff)
 }
 
-func newSpecTranslator(k8sClient *k8sClient, ingressClass string, httpSvrCfg *httpserver.Spec) *specTranslator {
-	return &specTranslator{
+func newSpecTranslator(k8sClient *k8sClient, spec *Spec) *specTranslator {
+	st := &specTranslator{
 		k8sClient:    k8sClient,
-		httpSvrCfg:   httpSvrCfg,
-		ingressClass: ingressClass,
+		httpSvrCfg:   spec.HTTPServer,
+		ingressClass: spec.IngressClass,
 		pipelines:    map[string]*supervisor.Spec{},
+		tcpSvrs:      map[uint16]*supervisor.Spec{},
 	}
+	if spec.GatewayAPI {
+		st.gatewayControllerName = spec.GatewayControllerName
+	}
+	return st
 }
 
 func (st *specTranslator) httpServerSpec() *supervisor.Spec {
@@ -137,9 +177,25 @@ func (st *specTranslator) pipelineSpecs() map[string]*supervisor.Spec {
 	return st.pipelines
 }
 
-func generatePipelineSpec(name string, endpoints []string) (*supervisor.Spec, error) {
+func (st *specTranslator) tcpServerSpecs() map[uint16]*supervisor.Spec {
+	return st.tcpSvrs
+}
+
+// generatePipelineSpec generates the spec of a pipeline proxying to the
+// endpoints, with the filters of rf if it is not nil.
+func generatePipelineSpec(name string, endpoints []string, rf *routeFilters) (*supervisor.Spec, error) {
 	b := newPipelineSpecBuilder(name)
+	if rf != nil {
+		for _, f := range rf.before {
+			b.addFilter(f)
+		}
+	}
 	b.addProxy(endpoints)
+	if rf != nil {
+		for _, f := range rf.after {
+			b.addFilter(f)
+		}
+	}
 	jsonConfig := b.jsonConfig()
 
 	return supervisor.NewSpec(jsonConfig)
@@ -206,7 +262,11 @@ func (st *specTranslator) getEndpoints(namespace string, service *apinetv1.Ingre
 	return result, nil
 }
 
-func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.IngressServiceBackend) (*supervisor.Spec, error) {
+// serviceToPipeline returns the pipeline of the service, the pipeline is
+// shared by all ingresses if there is no filter, otherwise, it is only
+// used by the ingress.
+func (st *specTranslator) serviceToPipeline(ingress *apinetv1.Ingress, service *apinetv1.IngressServiceBackend, rf *routeFilters) (*supervisor.Spec, error) {
+	namespace := ingress.Namespace
 	if service == nil || len(service.Name) == 0 {
 		err := fmt.Errorf("invalid service name, ingress backend is object ref")
 		logger.Errorf("%v", err)
@@ -218,6 +278,9 @@ func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.
 		port = strconv.Itoa(int(service.Port.Number))
 	}
 	pipelineName := fmt.Sprintf("pipeline-%s-%s-%s", namespace, service.Name, port)
+	if !rf.empty() {
+		pipelineName = fmt.Sprintf("pipeline-ingress-%s-%s-%s-%s", namespace, ingress.Name, service.Name, port)
+	}
 	if st.pipelines[pipelineName] != nil {
 		return st.pipelines[pipelineName], nil
 	}
@@ -228,7 +291,7 @@ func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.
 		return nil, err
 	}
 
-	spec, err := generatePipelineSpec(pipelineName, endpoints)
+	spec, err := generatePipelineSpec(pipelineName, endpoints, rf)
 	if err != nil {
 		logger.Errorf("failed to generate pipeline spec: %v", err)
 		return nil, err
@@ -238,7 +301,7 @@ func (st *specTranslator) serviceToPipeline(namespace string, service *apinetv1.
 	return spec, err
 }
 
-func (st *specTranslator) translateDefaultPipeline(ingress *apinetv1.Ingress) error {
+func (st *specTranslator) translateDefaultPipeline(ingress *apinetv1.Ingress, rf *routeFilters) error {
 	if st.pipelines[defaultPipelineName] != nil {
 		err := fmt.Errorf("the default pipeline has already been created")
 		logger.Errorf("%v", err)
@@ -251,7 +314,7 @@ func (st *specTranslator) translateDefaultPipeline(ingress *apinetv1.Ingress) er
 		return err
 	}
 
-	spec, err := generatePipelineSpec(defaultPipelineName, endpoints)
+	spec, err := generatePipelineSpec(defaultPipelineName, endpoints, rf)
 	if err != nil {
 		logger.Errorf("failed to generate pipeline spec: %v", err)
 		return err
@@ -314,7 +377,7 @@ func (st *specTranslator) translateTLSConfig(b *httpServerSpecBuilder, ingresses
 	return nil
 }
 
-func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingress *apinetv1.Ingress) {
+func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingress *apinetv1.Ingress, rf *routeFilters) {
 	for _, rule := range ingress.Spec.Rules {
 		if rule.HTTP == nil {
 			continue
@@ -322,7 +385,7 @@ func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingres
 
 		r := &httpserver.Rule{}
 		for _, path := range rule.HTTP.Paths {
-			pipeline, err := st.serviceToPipeline(ingress.Namespace, path.Backend.Service)
+			pipeline, err := st.serviceToPipeline(ingress, path.Backend.Service, rf)
 			if err != nil {
 				continue
 			}
@@ -334,7 +397,7 @@ func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingres
 				p.PathPrefix = path.Path
 			}
 
-			p.RewriteTarget = ingress.Annotations["easegress.ingress.kubernetes.io/rewrite-target"]
+			p.RewriteTarget = ingress.Annotations[annotationRewriteTarget]
 
 			r.Paths = append(r.Paths, &p)
 		}
@@ -343,31 +406,7 @@ func (st *specTranslator) translateIngressRules(b *httpServerSpecBuilder, ingres
 			continue
 		}
 
-		var existingRule *httpserver.Rule
-		if len(rule.Host) > 0 && rule.Host[0] == '*' {
-			host := strings.ReplaceAll(rule.Host[1:], ".", "\\.")
-			r.HostRegexp = fmt.Sprintf("^[^.]+%s$", host)
-			for _, r1 := range b.Rules {
-				if strings.EqualFold(r.HostRegexp, r1.HostRegexp) {
-					existingRule = r1
-					break
-				}
-			}
-		} else {
-			r.Host = rule.Host
-			for _, r1 := range b.Rules {
-				if strings.EqualFold(r.Host, r1.Host) {
-					existingRule = r1
-					break
-				}
-			}
-		}
-
-		if existingRule == nil {
-			b.Rules = append(b.Rules, r)
-		} else {
-			existingRule.Paths = append(existingRule.Paths, r.Paths...)
-		}
+		b.addRule(rule.Host, r)
 	}
 }
 
@@ -381,10 +420,23 @@ func (st *specTranslator) translate() error {
 	}
 
 	for _, ingress := range ingresses {
+		// the routes are not created if the annotations are invalid, so
+		// that they are never served without the filters like JWT.
+		rf, err := st.translateAnnotations(ingress)
+		if err != nil {
+			logger.Errorf("failed to translate annotations of ingress %s/%s: %v", ingress.Namespace, ingress.Name, err)
+			continue
+		}
 		if ingress.Spec.DefaultBackend != nil {
-			st.translateDefaultPipeline(ingress)
+			st.translateDefaultPipeline(ingress, rf)
+		}
+		st.translateIngressRules(b, ingress, rf)
+	}
+
+	if st.gatewayControllerName != "" {
+		if err := st.translateGateways(b); err != nil {
+			return err
 		}
-		st.translateIngressRules(b, ingress)
 	}
 
 	// sort rules by host
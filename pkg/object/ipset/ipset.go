@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ipset implements a business controller which is a named set of
+// IP addresses and CIDRs, it is shared by the IP filters of the servers,
+// the rules and the filters referencing it.
+package ipset
+
+import (
+	"net"
+
+	"github.com/yl2chen/cidranger"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+const (
+	// Category is the category of IPSet.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of IPSet.
+	Kind = "IPSet"
+)
+
+func init() {
+	supervisor.Register(&IPSet{})
+}
+
+type (
+	// IPSet is a business controller which is a named set of IP addresses
+	// and CIDRs. Like other objects, it is stored in the cluster, and the
+	// updates take effect on the IP filters referencing it without
+	// updating them.
+	IPSet struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		ranger cidranger.Ranger
+	}
+
+	// Spec describes IPSet.
+	Spec struct {
+		// CIDRs are the IP addresses and CIDRs of the set, both IPv4 and
+		// IPv6 are supported.
+		CIDRs []string `json:"cidrs" jsonschema:"omitempty,format=ipcidr-array"`
+	}
+
+	// Status is the status of IPSet.
+	Status struct {
+		NumOfEntries int `json:"numOfEntries"`
+	}
+)
+
+var _ ipfilter.Set = (*IPSet)(nil)
+
+// Category returns the category of IPSet.
+func (s *IPSet) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of IPSet.
+func (s *IPSet) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of IPSet.
+func (s *IPSet) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes IPSet.
+func (s *IPSet) Init(superSpec *supervisor.Spec) {
+	s.superSpec, s.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	s.ranger = ipfilter.NewRanger(s.spec.CIDRs)
+}
+
+// Inherit inherits previous generation of IPSet.
+func (s *IPSet) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	s.Init(superSpec)
+}
+
+// Contains returns whether the set contains the IP address.
+func (s *IPSet) Contains(ip net.IP) bool {
+	ok, err := s.ranger.Contains(ip)
+	return err == nil && ok
+}
+
+// Status returns the status of IPSet.
+func (s *IPSet) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: &Status{NumOfEntries: len(s.spec.CIDRs)},
+	}
+}
+
+// Close closes IPSet.
+func (s *IPSet) Close() {
+}
+
+// SetGetter returns an ipfilter.SetGetter which gets the IPSets from the
+// supervisor. It returns nil if the supervisor is nil, e.g. in the tests.
+func SetGetter(super *supervisor.Supervisor) ipfilter.SetGetter {
+	if super == nil {
+		return nil
+	}
+
+	return func(name string) ipfilter.Set {
+		entity, ok := super.GetBusinessController(name)
+		if entity == nil || !ok {
+			return nil
+		}
+		set, ok := entity.Instance().(*IPSet)
+		if !ok {
+			return nil
+		}
+		return set
+	}
+}
+
+// References returns the IPSets referenced by the IP filters, the nil
+// filters are skipped.
+func References(specs ...*ipfilter.Spec) []*supervisor.ObjectReference {
+	var refs []*supervisor.ObjectReference
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		if spec == nil {
+			continue
+		}
+		for _, names := range [][]string{spec.AllowSets, spec.BlockSets} {
+			for _, name := range names {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				refs = append(refs, &supervisor.ObjectReference{Kind: Kind, Name: name})
+			}
+		}
+	}
+	return refs
+}
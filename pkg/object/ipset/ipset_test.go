@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ipset
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestIPSet(t *testing.T, yaml string) *IPSet {
+	superSpec, err := supervisor.NewSpec(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &IPSet{}
+	s.Init(superSpec)
+	return s
+}
+
+func TestIPSet(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := supervisor.NewSpec(`
+kind: IPSet
+name: ipset
+cidrs: [192.168.1.0/24, invalid]
+`)
+	assert.Error(err)
+
+	s := newTestIPSet(t, `
+kind: IPSet
+name: ipset
+cidrs: [192.168.1.0/24, 10.0.0.1, "2001:db8::/32"]
+`)
+	defer s.Close()
+
+	assert.True(s.Contains(net.ParseIP("192.168.1.100")))
+	assert.True(s.Contains(net.ParseIP("10.0.0.1")))
+	assert.True(s.Contains(net.ParseIP("2001:db8::1")))
+	assert.False(s.Contains(net.ParseIP("10.0.0.2")))
+	assert.Equal(3, s.Status().ObjectStatus.(*Status).NumOfEntries)
+
+	// the new generation takes the new CIDRs.
+	superSpec, _ := supervisor.NewSpec(`
+kind: IPSet
+name: ipset
+cidrs: [10.0.0.0/8]
+`)
+	s2 := &IPSet{}
+	s2.Inherit(superSpec, s)
+	assert.True(s2.Contains(net.ParseIP("10.0.0.2")))
+	assert.False(s2.Contains(net.ParseIP("192.168.1.100")))
+
+	assert.Nil(SetGetter(nil))
+
+	// the IP filters look up the sets on every request.
+	sets := map[string]ipfilter.Set{}
+	f := ipfilter.NewWithSets(&ipfilter.Spec{
+		BlockByDefault: true,
+		AllowSets:      []string{"allowed", "none"},
+		BlockSets:      []string{"blocked"},
+	}, func(name string) ipfilter.Set {
+		return sets[name]
+	})
+	assert.False(f.Allow("192.168.1.100"))
+	sets["allowed"] = s
+	assert.True(f.Allow("192.168.1.100"))
+	assert.False(f.Allow("10.0.0.2"))
+	// allowed and blocked at the same time.
+	sets["blocked"] = s2
+	sets["allowed"] = s2
+	assert.False(f.Allow("10.0.0.2"))
+}
@@ -0,0 +1,43 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTime returns the user and kernel CPU time used by the process.
+func cpuTime() time.Duration {
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0
+	}
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0
+	}
+	// Filetime is in 100-nanosecond intervals.
+	ticks := func(ft syscall.Filetime) int64 {
+		return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+	}
+	return time.Duration((ticks(kernel) + ticks(user)) * 100)
+}
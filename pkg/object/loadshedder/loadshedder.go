@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loadshedder implements a business controller which monitors the
+// resource usage of Easegress, and rejects the requests of low priorities
+// before the ones of high priorities once the usage exceeds the thresholds.
+package loadshedder
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of LoadShedder.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of LoadShedder.
+	Kind = "LoadShedder"
+
+	priorityLow    = "low"
+	priorityMedium = "medium"
+	priorityHigh   = "high"
+
+	// notShedding is the shedding level if no level is reached.
+	notShedding = -1
+)
+
+// priorities are the priorities in ascending order.
+var priorities = []string{priorityLow, priorityMedium, priorityHigh}
+
+func init() {
+	supervisor.Register(&LoadShedder{})
+}
+
+type (
+	// LoadShedder is a business controller which sheds the requests of
+	// the HTTPServers referencing it by their priorities under resource
+	// pressure. Every member of the cluster monitors its own process, so
+	// that only the overloaded members shed the requests.
+	LoadShedder struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		interval   time.Duration
+		cooldown   time.Duration
+		retryAfter string
+		done       chan struct{}
+
+		lastCPUTime time.Duration
+		lastCheck   time.Time
+
+		mutex      sync.RWMutex
+		usage      usage
+		level      int
+		lowerSince time.Time
+
+		numOfShed [3]uint64
+	}
+
+	// Spec describes LoadShedder.
+	Spec struct {
+		CheckInterval string   `json:"checkInterval" jsonschema:"omitempty,format=duration"`
+		Cooldown      string   `json:"cooldown" jsonschema:"omitempty,format=duration"`
+		RetryAfter    string   `json:"retryAfter" jsonschema:"omitempty,format=duration"`
+		Levels        []*Level `json:"levels" jsonschema:"required,minItems=1"`
+
+		// PriorityHeader is the request header of the priority, which
+		// overrides the priority of the backend.
+		PriorityHeader string `json:"priorityHeader" jsonschema:"omitempty"`
+		// Backends are the priorities of the backends, i.e. the pipelines
+		// of the routes.
+		Backends        map[string]string `json:"backends" jsonschema:"omitempty"`
+		DefaultPriority string            `json:"defaultPriority" jsonschema:"omitempty,enum=,enum=low,enum=medium,enum=high"`
+	}
+
+	// Level is a shedding level, the requests of the priority and the
+	// lower ones are rejected once any of the thresholds is reached.
+	Level struct {
+		Priority string `json:"priority" jsonschema:"required,enum=low,enum=medium,enum=high"`
+		// CPU is the percentage of all the CPUs used by the process.
+		CPU        float64 `json:"cpu" jsonschema:"omitempty"`
+		MemoryMB   uint64  `json:"memoryMB" jsonschema:"omitempty"`
+		Goroutines int     `json:"goroutines" jsonschema:"omitempty"`
+	}
+
+	usage struct {
+		cpu        float64
+		memoryMB   uint64
+		goroutines int
+	}
+
+	// Status is the status of LoadShedder.
+	Status struct {
+		CPU        float64 `json:"cpu"`
+		MemoryMB   uint64  `json:"memoryMB"`
+		Goroutines int     `json:"goroutines"`
+		// Shedding is the highest priority being shed, it is empty if no
+		// request is shed.
+		Shedding  string            `json:"shedding"`
+		NumOfShed map[string]uint64 `json:"numOfShed"`
+	}
+)
+
+func priorityIndex(p string) int {
+	for i, v := range priorities {
+		if v == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	for name, s := range map[string]string{
+		"checkInterval": spec.CheckInterval,
+		"cooldown":      spec.Cooldown,
+		"retryAfter":    spec.RetryAfter,
+	} {
+		if s == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(s); err != nil || d < 0 {
+			return fmt.Errorf("invalid %s %s", name, s)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, l := range spec.Levels {
+		if seen[l.Priority] {
+			return fmt.Errorf("duplicated level of priority %s", l.Priority)
+		}
+		seen[l.Priority] = true
+		if l.CPU <= 0 && l.MemoryMB == 0 && l.Goroutines <= 0 {
+			return fmt.Errorf("level of priority %s has no threshold", l.Priority)
+		}
+	}
+
+	for backend, p := range spec.Backends {
+		if priorityIndex(p) < 0 {
+			return fmt.Errorf("invalid priority %s of backend %s", p, backend)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of LoadShedder.
+func (ls *LoadShedder) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of LoadShedder.
+func (ls *LoadShedder) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of LoadShedder.
+func (ls *LoadShedder) DefaultSpec() interface{} {
+	return &Spec{
+		CheckInterval:   "1s",
+		Cooldown:        "10s",
+		RetryAfter:      "1s",
+		DefaultPriority: priorityMedium,
+	}
+}
+
+// Init initializes LoadShedder.
+func (ls *LoadShedder) Init(superSpec *supervisor.Spec) {
+	ls.superSpec, ls.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ls.reload()
+}
+
+// Inherit inherits previous generation of LoadShedder.
+func (ls *LoadShedder) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	ls.Init(superSpec)
+}
+
+func (ls *LoadShedder) reload() {
+	ls.interval, _ = time.ParseDuration(ls.spec.CheckInterval)
+	if ls.interval <= 0 {
+		ls.interval = time.Second
+	}
+	ls.cooldown, _ = time.ParseDuration(ls.spec.Cooldown)
+	retryAfter, _ := time.ParseDuration(ls.spec.RetryAfter)
+	ls.retryAfter = strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	ls.level = notShedding
+
+	ls.lastCPUTime, ls.lastCheck = cpuTime(), time.Now()
+	ls.done = make(chan struct{})
+	go ls.run()
+}
+
+func (ls *LoadShedder) run() {
+	ticker := time.NewTicker(ls.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ls.done:
+			return
+		case <-ticker.C:
+			ls.check(ls.measure(time.Now()), time.Now())
+		}
+	}
+}
+
+// measure measures the resource usage since the last check.
+func (ls *LoadShedder) measure(now time.Time) usage {
+	t := cpuTime()
+	elapsed := now.Sub(ls.lastCheck)
+	var cpu float64
+	if elapsed > 0 {
+		cpu = float64(t-ls.lastCPUTime) / float64(elapsed) / float64(runtime.NumCPU()) * 100
+	}
+	ls.lastCPUTime, ls.lastCheck = t, now
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	return usage{
+		cpu:        cpu,
+		memoryMB:   (ms.Sys - ms.HeapReleased) >> 20,
+		goroutines: runtime.NumGoroutine(),
+	}
+}
+
+// reached returns whether the usage reaches any threshold of the level.
+func (l *Level) reached(u usage) bool {
+	return (l.CPU > 0 && u.cpu >= l.CPU) ||
+		(l.MemoryMB > 0 && u.memoryMB >= l.MemoryMB) ||
+		(l.Goroutines > 0 && u.goroutines >= l.Goroutines)
+}
+
+// check updates the shedding level by the usage. The level goes up at
+// once, but goes down only after it has been lower for the cooldown, so
+// that the shedding doesn't flap.
+func (ls *LoadShedder) check(u usage, now time.Time) {
+	level := notShedding
+	for _, l := range ls.spec.Levels {
+		if i := priorityIndex(l.Priority); i > level && l.reached(u) {
+			level = i
+		}
+	}
+
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	ls.usage = u
+	switch {
+	case level >= ls.level:
+		ls.level = level
+		ls.lowerSince = time.Time{}
+	case ls.lowerSince.IsZero():
+		ls.lowerSince = now
+	case now.Sub(ls.lowerSince) >= ls.cooldown:
+		ls.level = level
+		ls.lowerSince = time.Time{}
+	}
+}
+
+// priority returns the priority of the request, the priority header
+// overrides the priority of the backend.
+func (ls *LoadShedder) priority(header http.Header, backend string) int {
+	if ls.spec.PriorityHeader != "" {
+		p := strings.ToLower(header.Get(ls.spec.PriorityHeader))
+		if i := priorityIndex(p); i >= 0 {
+			return i
+		}
+	}
+	if i := priorityIndex(ls.spec.Backends[backend]); i >= 0 {
+		return i
+	}
+	if i := priorityIndex(ls.spec.DefaultPriority); i >= 0 {
+		return i
+	}
+	return priorityIndex(priorityMedium)
+}
+
+// Admit returns whether the request to the backend is admitted, it returns
+// false if the priority of the request is being shed.
+func (ls *LoadShedder) Admit(header http.Header, backend string) bool {
+	ls.mutex.RLock()
+	level := ls.level
+	ls.mutex.RUnlock()
+
+	if level == notShedding {
+		return true
+	}
+	p := ls.priority(header, backend)
+	if p > level {
+		return true
+	}
+	atomic.AddUint64(&ls.numOfShed[p], 1)
+	return false
+}
+
+// RetryAfter returns the value of the Retry-After header of the rejected
+// requests.
+func (ls *LoadShedder) RetryAfter() string {
+	return ls.retryAfter
+}
+
+// Status returns the status of LoadShedder.
+func (ls *LoadShedder) Status() *supervisor.Status {
+	ls.mutex.RLock()
+	s := &Status{
+		CPU:        math.Round(ls.usage.cpu*100) / 100,
+		MemoryMB:   ls.usage.memoryMB,
+		Goroutines: ls.usage.goroutines,
+		NumOfShed:  map[string]uint64{},
+	}
+	if ls.level != notShedding {
+		s.Shedding = priorities[ls.level]
+	}
+	ls.mutex.RUnlock()
+
+	for i, p := range priorities {
+		s.NumOfShed[p] = atomic.LoadUint64(&ls.numOfShed[i])
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes LoadShedder.
+func (ls *LoadShedder) Close() {
+	close(ls.done)
+}
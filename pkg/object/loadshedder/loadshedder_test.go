@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestLoadShedder(t *testing.T, yaml string) *LoadShedder {
+	superSpec, err := supervisor.NewSpec(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls := &LoadShedder{}
+	ls.Init(superSpec)
+	return ls
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, spec := range []*Spec{
+		{Levels: []*Level{{Priority: priorityLow}}},
+		{Levels: []*Level{{Priority: priorityLow, CPU: 80}, {Priority: priorityLow, CPU: 90}}},
+		{Levels: []*Level{{Priority: priorityLow, CPU: 80}}, Backends: map[string]string{"a": "urgent"}},
+		{Levels: []*Level{{Priority: priorityLow, CPU: 80}}, Cooldown: "x"},
+	} {
+		assert.Error(spec.Validate())
+	}
+
+	spec := &Spec{Levels: []*Level{{Priority: priorityLow, Goroutines: 100}}}
+	assert.NoError(spec.Validate())
+}
+
+func TestShedding(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newTestLoadShedder(t, `
+kind: LoadShedder
+name: load-shedder
+cooldown: 10s
+retryAfter: 3s
+priorityHeader: X-Priority
+backends:
+  batch: low
+  checkout: high
+levels:
+- priority: low
+  cpu: 60
+  goroutines: 1000
+- priority: medium
+  cpu: 80
+  memoryMB: 1024
+`)
+	defer ls.Close()
+	assert.Equal("3", ls.RetryAfter())
+
+	high := http.Header{"X-Priority": {"High"}}
+	admitted := func() []bool {
+		return []bool{
+			ls.Admit(http.Header{}, "batch"),
+			ls.Admit(http.Header{}, "other"),
+			ls.Admit(http.Header{}, "checkout"),
+			ls.Admit(high, "batch"),
+		}
+	}
+
+	now := time.Now()
+	ls.check(usage{cpu: 10, memoryMB: 100, goroutines: 10}, now)
+	assert.Equal([]bool{true, true, true, true}, admitted())
+
+	ls.check(usage{cpu: 10, memoryMB: 100, goroutines: 2000}, now)
+	assert.Equal([]bool{false, true, true, true}, admitted())
+
+	ls.check(usage{cpu: 90, memoryMB: 100, goroutines: 10}, now)
+	assert.Equal([]bool{false, false, true, true}, admitted())
+
+	// the level goes down after the cooldown.
+	ls.check(usage{cpu: 70, memoryMB: 100, goroutines: 10}, now.Add(time.Second))
+	assert.Equal([]bool{false, false, true, true}, admitted())
+	ls.check(usage{cpu: 70, memoryMB: 100, goroutines: 10}, now.Add(11*time.Second))
+	assert.Equal([]bool{false, true, true, true}, admitted())
+
+	status := ls.Status().ObjectStatus.(*Status)
+	assert.Equal("low", status.Shedding)
+	assert.Equal(float64(70), status.CPU)
+	assert.Equal(uint64(4), status.NumOfShed["low"])
+	assert.Equal(uint64(2), status.NumOfShed["medium"])
+	assert.Equal(uint64(0), status.NumOfShed["high"])
+
+	u := ls.measure(time.Now().Add(time.Second))
+	assert.True(u.goroutines > 0)
+	assert.True(u.cpu >= 0)
+}
@@ -72,6 +72,9 @@ const (
 	// MeshServiceMetricsPath is the mesh service metrics path.
 	MeshServiceMetricsPath = "/mesh/services/{serviceName}/metrics"
 
+	// MeshServiceMTLSPath is the mesh service mTLS path.
+	MeshServiceMTLSPath = "/mesh/services/{serviceName}/mtls"
+
 	// MeshServiceInstancePrefix is the mesh service prefix.
 	MeshServiceInstancePrefix = "/mesh/serviceinstances"
 
@@ -90,6 +93,21 @@ const (
 	// MeshTrafficTargetPath is the mesh traffic target path.
 	MeshTrafficTargetPath = "/mesh/traffictargets/{name}"
 
+	// MeshTrafficPermissionPrefix is the mesh traffic permission prefix.
+	MeshTrafficPermissionPrefix = "/mesh/trafficpermissions"
+
+	// MeshTrafficPermissionPath is the mesh traffic permission path.
+	MeshTrafficPermissionPath = "/mesh/trafficpermissions/{name}"
+
+	// MeshExternalServicePrefix is the mesh external service prefix.
+	MeshExternalServicePrefix = "/mesh/externalservices"
+
+	// MeshExternalServicePath is the mesh external service path.
+	MeshExternalServicePath = "/mesh/externalservices/{name}"
+
+	// MeshCertsPath is the path of the status of the mesh certificates.
+	MeshCertsPath = "/mesh/certs"
+
 	// MeshCustomResourceKindPrefix is the mesh custom resource kind prefix.
 	MeshCustomResourceKindPrefix = "/mesh/customresourcekinds"
 
@@ -196,6 +214,9 @@ func (a *API) registerAPIs() {
 			{Path: MeshServiceMetricsPath, Method: "PUT", Handler: a.updatePartOfService(metricsMeta)},
 			{Path: MeshServiceMetricsPath, Method: "DELETE", Handler: a.deletePartOfService(metricsMeta)},
 
+			{Path: MeshServiceMTLSPath, Method: "GET", Handler: a.getServiceMTLS},
+			{Path: MeshServiceMTLSPath, Method: "PUT", Handler: a.updateServiceMTLS},
+
 			{Path: MeshHTTPRouteGroupPrefix, Method: "GET", Handler: a.listHTTPRouteGroups},
 			{Path: MeshHTTPRouteGroupPrefix, Method: "POST", Handler: a.createHTTPRouteGroup},
 			{Path: MeshHTTPRouteGroupPath, Method: "GET", Handler: a.getHTTPRouteGroup},
@@ -208,6 +229,20 @@ func (a *API) registerAPIs() {
 			{Path: MeshTrafficTargetPath, Method: "PUT", Handler: a.updateTrafficTarget},
 			{Path: MeshTrafficTargetPath, Method: "DELETE", Handler: a.deleteTrafficTarget},
 
+			{Path: MeshTrafficPermissionPrefix, Method: "GET", Handler: a.listTrafficPermissions},
+			{Path: MeshTrafficPermissionPrefix, Method: "POST", Handler: a.createTrafficPermission},
+			{Path: MeshTrafficPermissionPath, Method: "GET", Handler: a.getTrafficPermission},
+			{Path: MeshTrafficPermissionPath, Method: "PUT", Handler: a.updateTrafficPermission},
+			{Path: MeshTrafficPermissionPath, Method: "DELETE", Handler: a.deleteTrafficPermission},
+
+			{Path: MeshExternalServicePrefix, Method: "GET", Handler: a.listExternalServices},
+			{Path: MeshExternalServicePrefix, Method: "POST", Handler: a.createExternalService},
+			{Path: MeshExternalServicePath, Method: "GET", Handler: a.getExternalService},
+			{Path: MeshExternalServicePath, Method: "PUT", Handler: a.updateExternalService},
+			{Path: MeshExternalServicePath, Method: "DELETE", Handler: a.deleteExternalService},
+
+			{Path: MeshCertsPath, Method: "GET", Handler: a.getCertsStatus},
+
 			{Path: MeshCustomResourceKindPrefix, Method: "GET", Handler: a.listCustomResourceKinds},
 			{Path: MeshCustomResourceKindPrefix, Method: "POST", Handler: a.createCustomResourceKind},
 			{Path: MeshCustomResourceKind, Method: "GET", Handler: a.getCustomResourceKind},
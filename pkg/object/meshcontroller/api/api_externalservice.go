@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func (a *API) listExternalServices(w http.ResponseWriter, r *http.Request) {
+	specs := a.service.ListExternalServiceSpecs()
+	buff := codectool.MustMarshalJSON(specs)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) createExternalService(w http.ResponseWriter, r *http.Request) {
+	es := &spec.ExternalService{}
+	err := a.readSpec(r, es)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetExternalServiceSpec(es.Name) != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("%s existed", es.Name))
+		return
+	}
+
+	a.service.PutExternalServiceSpec(es)
+
+	w.Header().Set("Location", path.Join(r.URL.Path, es.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *API) getExternalService(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readURLParam(r, "name")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	es := a.service.GetExternalServiceSpec(name)
+	if es == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	buff := codectool.MustMarshalJSON(es)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) updateExternalService(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readURLParam(r, "name")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	es := &spec.ExternalService{}
+	err = a.readSpec(r, es)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if name != es.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", name, es.Name))
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetExternalServiceSpec(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.PutExternalServiceSpec(es)
+}
+
+func (a *API) deleteExternalService(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readURLParam(r, "name")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetExternalServiceSpec(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.DeleteExternalServiceSpec(name)
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type serviceMTLS struct {
+	Mode string `json:"mode" jsonschema:"omitempty,enum=,enum=strict,enum=permissive"`
+}
+
+func (a *API) getCertsStatus(w http.ResponseWriter, r *http.Request) {
+	status := a.service.GetCertsStatus()
+	buff := codectool.MustMarshalJSON(status)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) getServiceMTLS(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("service %s not found", serviceName))
+		return
+	}
+
+	status := a.service.GetServiceMTLSStatus(serviceSpec)
+	buff := codectool.MustMarshalJSON(status)
+	a.writeJSONBody(w, buff)
+}
+
+// updateServiceMTLS updates the mTLS mode of the service, an empty mode
+// means following the mesh.
+func (a *API) updateServiceMTLS(w http.ResponseWriter, r *http.Request) {
+	serviceName, err := a.readServiceName(r)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	mtls := &serviceMTLS{}
+	err = a.readSpec(r, mtls)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	serviceSpec := a.service.GetServiceSpec(serviceName)
+	if serviceSpec == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("service %s not found", serviceName))
+		return
+	}
+
+	serviceSpec.MTLSMode = mtls.Mode
+	a.service.PutServiceSpec(serviceSpec)
+}
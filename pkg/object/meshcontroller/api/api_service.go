@@ -155,6 +155,9 @@ func (a *API) updateService(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The mTLS mode is not in the protobuf spec, it is updated by its own API.
+	serviceSpec.MTLSMode = oldSpec.MTLSMode
+
 	if serviceSpec.RegisterTenant != oldSpec.RegisterTenant {
 		newTenantSpec := a.service.GetTenantSpec(serviceSpec.RegisterTenant)
 		if newTenantSpec == nil {
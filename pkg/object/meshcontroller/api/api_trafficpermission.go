@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/megaease/easegress/pkg/api"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/v"
+)
+
+// readSpec reads the spec which has no protobuf definition from the body.
+func (a *API) readSpec(r *http.Request, spec interface{}) error {
+	err := codectool.DecodeJSON(r.Body, spec)
+	if err != nil {
+		return fmt.Errorf("unmarshal spec failed: %v", err)
+	}
+
+	vr := v.Validate(spec)
+	if !vr.Valid() {
+		return fmt.Errorf("validate failed:\n%s", vr)
+	}
+
+	return nil
+}
+
+func (a *API) listTrafficPermissions(w http.ResponseWriter, r *http.Request) {
+	specs := a.service.ListTrafficPermissionSpecs()
+	buff := codectool.MustMarshalJSON(specs)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) createTrafficPermission(w http.ResponseWriter, r *http.Request) {
+	tp := &spec.TrafficPermission{}
+	err := a.readSpec(r, tp)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetTrafficPermissionSpec(tp.Name) != nil {
+		api.HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("%s existed", tp.Name))
+		return
+	}
+
+	a.service.PutTrafficPermissionSpec(tp)
+
+	w.Header().Set("Location", path.Join(r.URL.Path, tp.Name))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *API) getTrafficPermission(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readURLParam(r, "name")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tp := a.service.GetTrafficPermissionSpec(name)
+	if tp == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	buff := codectool.MustMarshalJSON(tp)
+	a.writeJSONBody(w, buff)
+}
+
+func (a *API) updateTrafficPermission(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readURLParam(r, "name")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tp := &spec.TrafficPermission{}
+	err = a.readSpec(r, tp)
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if name != tp.Name {
+		api.HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("name conflict: %s %s", name, tp.Name))
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetTrafficPermissionSpec(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.PutTrafficPermissionSpec(tp)
+}
+
+func (a *API) deleteTrafficPermission(w http.ResponseWriter, r *http.Request) {
+	name, err := a.readURLParam(r, "name")
+	if err != nil {
+		api.HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	a.service.Lock()
+	defer a.service.Unlock()
+
+	if a.service.GetTrafficPermissionSpec(name) == nil {
+		api.HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("%s not found", name))
+		return
+	}
+
+	a.service.DeleteTrafficPermissionSpec(name)
+}
@@ -101,6 +101,12 @@ type (
 	// TrafficTargetSpecsFunc is the callback function type for traffic target specs.
 	TrafficTargetSpecsFunc func(value map[string]*spec.TrafficTarget) bool
 
+	// TrafficPermissionSpecsFunc is the callback function type for traffic permission specs.
+	TrafficPermissionSpecsFunc func(value map[string]*spec.TrafficPermission) bool
+
+	// ExternalServiceSpecsFunc is the callback function type for external service specs.
+	ExternalServiceSpecsFunc func(value map[string]*spec.ExternalService) bool
+
 	// ServiceCanarySpecFunc is the callback function type for service canary spec.
 	ServiceCanarySpecFunc func(event Event, value *spec.ServiceCanary) bool
 
@@ -134,6 +140,10 @@ type (
 		OnPartOfTrafficTargetSpec(ttName string, fn TrafficTargetSpecFunc) error
 		OnAllTrafficTargetSpecs(fn TrafficTargetSpecsFunc) error
 
+		OnAllTrafficPermissionSpecs(fn TrafficPermissionSpecsFunc) error
+
+		OnAllExternalServiceSpecs(fn ExternalServiceSpecsFunc) error
+
 		OnPartOfServiceCanary(serviceCanaryName string, fn ServiceCanarySpecFunc) error
 		OnAllServiceCanaries(fn ServiceCanariesFunc) error
 
@@ -706,6 +716,50 @@ func (inf *meshInformer) OnAllTrafficTargetSpecs(fn TrafficTargetSpecsFunc) erro
 	return inf.onSpecs(storeKey, syncerKey, specsFunc)
 }
 
+// OnAllTrafficPermissionSpecs watches all traffic permission specs.
+func (inf *meshInformer) OnAllTrafficPermissionSpecs(fn TrafficPermissionSpecsFunc) error {
+	storeKey := layout.TrafficPermissionPrefix()
+	syncerKey := "prefix-traffic-permission"
+
+	specsFunc := func(kvs map[string]string) bool {
+		tps := make(map[string]*spec.TrafficPermission)
+		for k, v := range kvs {
+			tp := &spec.TrafficPermission{}
+			if err := codectool.Unmarshal([]byte(v), tp); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+				continue
+			}
+			tps[k] = tp
+		}
+
+		return fn(tps)
+	}
+
+	return inf.onSpecs(storeKey, syncerKey, specsFunc)
+}
+
+// OnAllExternalServiceSpecs watches all external service specs.
+func (inf *meshInformer) OnAllExternalServiceSpecs(fn ExternalServiceSpecsFunc) error {
+	storeKey := layout.ExternalServicePrefix()
+	syncerKey := "prefix-external-service"
+
+	specsFunc := func(kvs map[string]string) bool {
+		services := make(map[string]*spec.ExternalService)
+		for k, v := range kvs {
+			es := &spec.ExternalService{}
+			if err := codectool.Unmarshal([]byte(v), es); err != nil {
+				logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+				continue
+			}
+			services[k] = es
+		}
+
+		return fn(services)
+	}
+
+	return inf.onSpecs(storeKey, syncerKey, specsFunc)
+}
+
 // OnAllServiceCanaries watches all service canary specs.
 func (inf *meshInformer) OnAllServiceCanaries(fn ServiceCanariesFunc) error {
 	storeKey := layout.ServiceCanaryPrefix()
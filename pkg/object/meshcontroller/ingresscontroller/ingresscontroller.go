@@ -234,7 +234,7 @@ func (ic *IngressController) _reloadPipelines() {
 	// if in mTLS strict model, should init pipeline with certificates
 	admSpec := ic.superSpec.ObjectSpec().(*spec.Admin)
 	var cert, rootCert *spec.Certificate
-	if admSpec.EnablemTLS() {
+	if admSpec.EnableCertManager() {
 		cert = ic.service.GetIngressControllerInstanceCert(ic.instanceID)
 		rootCert = ic.service.GetRootCert()
 	}
@@ -259,7 +259,11 @@ func (ic *IngressController) _reloadPipelines() {
 			continue
 		}
 
-		superSpec, err := serviceSpec.IngressControllerPipelineSpec(instanceSpecs, canaries, cert, rootCert)
+		var svcCert, svcRootCert *spec.Certificate
+		if admSpec.EnablemTLSForService(serviceSpec) {
+			svcCert, svcRootCert = cert, rootCert
+		}
+		superSpec, err := serviceSpec.IngressControllerPipelineSpec(instanceSpecs, canaries, svcCert, svcRootCert)
 		if err != nil {
 			logger.Errorf("get ingress pipeline for %s failed: %v",
 				serviceSpec.Name, err)
@@ -277,7 +281,7 @@ func (ic *IngressController) _reloadPipelines() {
 }
 
 func (ic *IngressController) _reloadHTTPServer() {
-	superSpec, err := spec.IngressControllerHTTPServerSpec(ic.spec.IngressPort, ic.ingressRules)
+	superSpec, err := spec.IngressControllerHTTPServerSpec(ic.spec.IngressPort, ic.ingressRules, ic.spec.WorkerSpec.AccessLog)
 	if err != nil {
 		logger.Errorf("get ingress http server spec failed: %v", err)
 		return
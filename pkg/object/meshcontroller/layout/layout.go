@@ -52,6 +52,12 @@ const (
 	trafficTarget        = "/mesh/traffic-targets/%s" // + trafficTargetName
 	trafficTargetPrefix  = "/mesh/traffic-targets/"
 
+	trafficPermission       = "/mesh/traffic-permissions/%s" // + trafficPermissionName
+	trafficPermissionPrefix = "/mesh/traffic-permissions/"
+
+	externalService       = "/mesh/external-services/%s" // + externalServiceName
+	externalServicePrefix = "/mesh/external-services/"
+
 	customResourceKindPrefix = "/mesh/custom-resource-kinds/"
 	customResourceKind       = "/mesh/custom-resource-kinds/%s" // +kind
 	allCustomResourcePrefix  = "/mesh/custom-resources/"
@@ -211,3 +217,23 @@ func ServiceCanaryPrefix() string {
 func ServiceCanaryKey(serviceCanaryName string) string {
 	return fmt.Sprintf(serviceCanary, serviceCanaryName)
 }
+
+// TrafficPermissionPrefix returns the prefix of traffic permissions.
+func TrafficPermissionPrefix() string {
+	return trafficPermissionPrefix
+}
+
+// TrafficPermissionKey returns the key of traffic permission.
+func TrafficPermissionKey(name string) string {
+	return fmt.Sprintf(trafficPermission, name)
+}
+
+// ExternalServicePrefix returns the prefix of external services.
+func ExternalServicePrefix() string {
+	return externalServicePrefix
+}
+
+// ExternalServiceKey returns the key of external service.
+func ExternalServiceKey(name string) string {
+	return fmt.Sprintf(externalService, name)
+}
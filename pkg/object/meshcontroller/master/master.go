@@ -87,7 +87,7 @@ func New(superSpec *supervisor.Spec) *Master {
 }
 
 func (m *Master) initMTLS() error {
-	if !m.spec.EnablemTLS() {
+	if !m.spec.EnableCertManager() {
 		return nil
 	}
 	appCertTTL, err := time.ParseDuration(m.spec.Security.AppCertTTL)
@@ -240,7 +240,7 @@ func (m *Master) updateInstanceStatus(_spec *spec.ServiceInstanceSpec, status st
 
 // Close closes the master
 func (m *Master) Close() {
-	if m.spec.EnablemTLS() {
+	if m.spec.EnableCertManager() {
 		m.certManager.Close()
 	}
 	close(m.done)
@@ -900,3 +900,185 @@ func (s serviceCanariesByPriority) Less(i, j int) bool {
 }
 func (s serviceCanariesByPriority) Len() int      { return len(s) }
 func (s serviceCanariesByPriority) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+// PutTrafficPermissionSpec writes the traffic permission spec.
+func (s *Service) PutTrafficPermissionSpec(tp *spec.TrafficPermission) {
+	buff, err := codectool.MarshalJSON(tp)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", tp, err))
+	}
+
+	err = s.store.Put(layout.TrafficPermissionKey(tp.Name), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// GetTrafficPermissionSpec gets the traffic permission spec.
+func (s *Service) GetTrafficPermissionSpec(name string) *spec.TrafficPermission {
+	value, err := s.store.Get(layout.TrafficPermissionKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	tp := &spec.TrafficPermission{}
+	err = codectool.Unmarshal([]byte(*value), tp)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", string(*value), err))
+	}
+
+	return tp
+}
+
+// DeleteTrafficPermissionSpec deletes the traffic permission spec.
+func (s *Service) DeleteTrafficPermissionSpec(name string) {
+	err := s.store.Delete(layout.TrafficPermissionKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListTrafficPermissionSpecs lists the traffic permission specs.
+func (s *Service) ListTrafficPermissionSpecs() []*spec.TrafficPermission {
+	tps := []*spec.TrafficPermission{}
+	kvs, err := s.store.GetRawPrefix(layout.TrafficPermissionPrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		tp := &spec.TrafficPermission{}
+		err := codectool.Unmarshal(v.Value, tp)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+		tps = append(tps, tp)
+	}
+
+	sort.Slice(tps, func(i, j int) bool {
+		return tps[i].Name < tps[j].Name
+	})
+
+	return tps
+}
+
+// ListTrafficPermissionsOfService lists the traffic permissions whose
+// destination is the service.
+func (s *Service) ListTrafficPermissionsOfService(serviceName string) []*spec.TrafficPermission {
+	var tps []*spec.TrafficPermission
+	for _, tp := range s.ListTrafficPermissionSpecs() {
+		if tp.Destination == serviceName {
+			tps = append(tps, tp)
+		}
+	}
+	return tps
+}
+
+// GetCertsStatus gets the status of all certificates.
+func (s *Service) GetCertsStatus() *spec.CertsStatus {
+	status := &spec.CertsStatus{
+		MTLSMode:               s.spec.ServiceMTLSMode(nil),
+		ServiceCerts:           []*spec.CertStatus{},
+		IngressControllerCerts: []*spec.CertStatus{},
+	}
+
+	if rootCert := s.GetRootCert(); rootCert != nil {
+		status.RootCert = rootCert.Status()
+	}
+	for _, cert := range s.ListServiceCerts() {
+		status.ServiceCerts = append(status.ServiceCerts, cert.Status())
+	}
+	for _, cert := range s.ListAllIngressControllerInstanceCerts() {
+		status.IngressControllerCerts = append(status.IngressControllerCerts, cert.Status())
+	}
+
+	return status
+}
+
+// GetServiceMTLSStatus gets the mTLS status of the service.
+func (s *Service) GetServiceMTLSStatus(serviceSpec *spec.Service) *spec.ServiceMTLSStatus {
+	status := &spec.ServiceMTLSStatus{
+		Mode:          serviceSpec.MTLSMode,
+		EffectiveMode: s.spec.ServiceMTLSMode(serviceSpec),
+		Certs:         []*spec.CertStatus{},
+	}
+
+	for _, cert := range s.ListServiceCerts() {
+		if cert.ServiceName == serviceSpec.Name {
+			status.Certs = append(status.Certs, cert.Status())
+		}
+	}
+
+	return status
+}
+
+// PutExternalServiceSpec writes the external service spec.
+func (s *Service) PutExternalServiceSpec(es *spec.ExternalService) {
+	buff, err := codectool.MarshalJSON(es)
+	if err != nil {
+		panic(fmt.Errorf("BUG: marshal %#v to json failed: %v", es, err))
+	}
+
+	err = s.store.Put(layout.ExternalServiceKey(es.Name), string(buff))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// GetExternalServiceSpec gets the external service spec.
+func (s *Service) GetExternalServiceSpec(name string) *spec.ExternalService {
+	value, err := s.store.Get(layout.ExternalServiceKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	es := &spec.ExternalService{}
+	err = codectool.Unmarshal([]byte(*value), es)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unmarshal %s to json failed: %v", string(*value), err))
+	}
+
+	return es
+}
+
+// DeleteExternalServiceSpec deletes the external service spec.
+func (s *Service) DeleteExternalServiceSpec(name string) {
+	err := s.store.Delete(layout.ExternalServiceKey(name))
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+}
+
+// ListExternalServiceSpecs lists the external service specs.
+func (s *Service) ListExternalServiceSpecs() []*spec.ExternalService {
+	services := []*spec.ExternalService{}
+	kvs, err := s.store.GetRawPrefix(layout.ExternalServicePrefix())
+	if err != nil {
+		api.ClusterPanic(err)
+	}
+
+	for _, v := range kvs {
+		es := &spec.ExternalService{}
+		err := codectool.Unmarshal(v.Value, es)
+		if err != nil {
+			logger.Errorf("BUG: unmarshal %s to json failed: %v", v, err)
+			continue
+		}
+		services = append(services, es)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services
+}
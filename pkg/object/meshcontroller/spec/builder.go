@@ -19,12 +19,14 @@ package spec
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/megaease/easegress/pkg/filters"
 	"github.com/megaease/easegress/pkg/filters/meshadaptor"
 	"github.com/megaease/easegress/pkg/filters/mock"
 	"github.com/megaease/easegress/pkg/filters/proxy"
 	"github.com/megaease/easegress/pkg/filters/ratelimiter"
+	"github.com/megaease/easegress/pkg/filters/requestadaptor"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/pipeline"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
@@ -38,12 +40,14 @@ type (
 		Kind string `json:"kind"`
 		Name string `json:"name"`
 
-		mockName           string
-		rateLimiterName    string
-		circuitBreakerName string
-		retryName          string
-		meshAdaptorName    string
-		proxyName          string
+		mockName              string
+		trafficPermissionName string
+		sourceAdaptorName     string
+		rateLimiterName       string
+		circuitBreakerName    string
+		retryName             string
+		meshAdaptorName       string
+		proxyName             string
 
 		pipeline.Spec `json:",inline"`
 	}
@@ -58,6 +62,7 @@ type (
 		retryPolicy          string
 		circuitBreakerPolicy string
 		failureCodes         []int
+		healthCheck          *proxy.HealthCheckSpec
 	}
 )
 
@@ -66,12 +71,14 @@ func newPipelineSpecBuilder(name string) *pipelineSpecBuilder {
 		Kind: pipeline.Kind,
 		Name: name,
 
-		mockName:           "mock",
-		rateLimiterName:    "rateLimiter",
-		circuitBreakerName: "circuitBreaker",
-		retryName:          "retry",
-		meshAdaptorName:    "meshAdaptor",
-		proxyName:          "proxy",
+		mockName:              "mock",
+		trafficPermissionName: "trafficPermission",
+		sourceAdaptorName:     "sourceAdaptor",
+		rateLimiterName:       "rateLimiter",
+		circuitBreakerName:    "circuitBreaker",
+		retryName:             "retry",
+		meshAdaptorName:       "meshAdaptor",
+		proxyName:             "proxy",
 
 		Spec: pipeline.Spec{},
 	}
@@ -191,6 +198,75 @@ func (b *pipelineSpecBuilder) appendMock(rules []*mock.Rule) *pipelineSpecBuilde
 	return b
 }
 
+// appendTrafficPermissions appends a Mock which rejects the requests not
+// permitted by perms.
+func (b *pipelineSpecBuilder) appendTrafficPermissions(perms []*TrafficPermission) *pipelineSpecBuilder {
+	expr := deniedTrafficExpression(perms)
+	if expr == "" {
+		return b
+	}
+
+	spec := &mock.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.trafficPermissionName,
+				Kind: mock.Kind,
+			},
+		},
+		Rules: []*mock.Rule{
+			{
+				Match: mock.MatchRule{Expression: expr},
+				Code:  http.StatusForbidden,
+				Body:  "forbidden by traffic permissions",
+			},
+		},
+	}
+
+	m, err := codectool.StructToMap(spec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", spec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.trafficPermissionName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
+// appendSourceService appends a RequestAdaptor which sets the name of the
+// calling service into the request header.
+func (b *pipelineSpecBuilder) appendSourceService(source string) *pipelineSpecBuilder {
+	if source == "" {
+		return b
+	}
+
+	spec := &requestadaptor.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.sourceAdaptorName,
+				Kind: requestadaptor.Kind,
+			},
+		},
+		Header: &httpheader.AdaptSpec{
+			Set: map[string]string{
+				SourceServiceHeaderKey: source,
+			},
+		},
+	}
+
+	m, err := codectool.StructToMap(spec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", spec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.sourceAdaptorName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
 func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipelineSpecBuilder {
 	if param.lb == nil {
 		param.lb = &proxy.LoadBalanceSpec{}
@@ -235,6 +311,7 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 		RetryPolicy:          param.retryPolicy,
 		CircuitBreakerPolicy: param.circuitBreakerPolicy,
 		FailureCodes:         param.failureCodes,
+		HealthCheck:          param.healthCheck,
 	}
 	candidatePools := make([]*proxy.ServerPoolSpec, len(param.canaries))
 
@@ -267,6 +344,7 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 					RetryPolicy:          param.retryPolicy,
 					CircuitBreakerPolicy: param.circuitBreakerPolicy,
 					FailureCodes:         param.failureCodes,
+					HealthCheck:          param.healthCheck,
 				}
 			}
 
@@ -302,6 +380,50 @@ func (b *pipelineSpecBuilder) appendProxyWithCanary(param *proxyParam) *pipeline
 	return b
 }
 
+func (b *pipelineSpecBuilder) appendExternalProxy(es *ExternalService,
+	retryPolicy, circuitBreakerPolicy string,
+) *pipelineSpecBuilder {
+	lb := es.LoadBalance
+	if lb == nil {
+		lb = &proxy.LoadBalanceSpec{}
+	}
+
+	pool := &proxy.ServerPoolSpec{
+		LoadBalance:          lb,
+		Timeout:              es.Timeout,
+		RetryPolicy:          retryPolicy,
+		CircuitBreakerPolicy: circuitBreakerPolicy,
+		FailureCodes:         es.FailureCodes,
+	}
+	for _, s := range es.Servers {
+		pool.Servers = append(pool.Servers, &proxy.Server{URL: s})
+	}
+	if es.TLS != nil {
+		pool.Transport = &proxy.TransportSpec{TLS: es.TLS}
+	}
+
+	proxySpec := &proxy.Spec{
+		BaseSpec: filters.BaseSpec{
+			MetaSpec: supervisor.MetaSpec{
+				Name: b.proxyName,
+				Kind: proxy.Kind,
+			},
+		},
+		Pools: []*proxy.ServerPoolSpec{pool},
+	}
+
+	m, err := codectool.StructToMap(proxySpec)
+	if err != nil {
+		logger.Errorf("BUG: convert %#v to map failed: %v", proxySpec, err)
+		return b
+	}
+
+	b.Flow = append(b.Flow, pipeline.FlowNode{FilterName: b.proxyName})
+	b.Filters = append(b.Filters, m)
+
+	return b
+}
+
 func (b *pipelineSpecBuilder) appendMeshAdaptor(canaries []*ServiceCanary) *pipelineSpecBuilder {
 	if len(canaries) == 0 {
 		return b
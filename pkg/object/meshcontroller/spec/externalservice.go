@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+// Validate validates ExternalService.
+func (es *ExternalService) Validate() error {
+	for _, s := range es.Servers {
+		u, err := url.Parse(s)
+		if err != nil {
+			return fmt.Errorf("invalid server %s: %v", s, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid server %s: scheme must be http or https", s)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid server %s: empty host", s)
+		}
+	}
+	return nil
+}
+
+// SidecarEgressPipelineName returns the name of the egress pipeline of the
+// external service.
+func (es *ExternalService) SidecarEgressPipelineName() string {
+	return fmt.Sprintf("sidecar-egress-external-pipeline-%s", es.Name)
+}
+
+// AllowSource returns whether the service could call the external service.
+func (es *ExternalService) AllowSource(serviceName string) bool {
+	if len(es.Sources) == 0 {
+		return true
+	}
+	for _, s := range es.Sources {
+		if s == serviceName || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// SidecarEgressPipelineSpec returns a spec for the egress pipeline of the
+// external service, the source service is not sent to the external
+// service, as it is an internal detail of the mesh.
+func (es *ExternalService) SidecarEgressPipelineSpec() (*supervisor.Spec, error) {
+	pipelineSpecBuilder := newPipelineSpecBuilder(es.SidecarEgressPipelineName())
+
+	var retryPolicy, circuitBreakerPolicy string
+	if es.Retry != nil {
+		pipelineSpecBuilder.appendRetry(es.Retry)
+		retryPolicy = pipelineSpecBuilder.retryName
+	}
+	if es.CircuitBreaker != nil {
+		pipelineSpecBuilder.appendCircuitBreaker(es.CircuitBreaker)
+		circuitBreakerPolicy = pipelineSpecBuilder.circuitBreakerName
+	}
+
+	pipelineSpecBuilder.appendExternalProxy(es, retryPolicy, circuitBreakerPolicy)
+
+	jsonConfig := pipelineSpecBuilder.jsonConfig()
+	superSpec, err := supervisor.NewSpec(jsonConfig)
+	if err != nil {
+		logger.Errorf("new spec for %s failed: %v", jsonConfig, err)
+		return nil, err
+	}
+
+	return superSpec, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/resilience"
+)
+
+func TestExternalServiceValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	es := &ExternalService{
+		Name:    "github",
+		Hosts:   []string{"api.github.com"},
+		Servers: []string{"https://api.github.com", "http://127.0.0.1:8080"},
+	}
+	assert.NoError(es.Validate())
+
+	es.Servers = []string{"tcp://api.github.com"}
+	assert.Error(es.Validate())
+
+	es.Servers = []string{"https://"}
+	assert.Error(es.Validate())
+}
+
+func TestExternalServiceAllowSource(t *testing.T) {
+	assert := assert.New(t)
+
+	es := &ExternalService{Name: "github"}
+	assert.True(es.AllowSource("order"))
+
+	es.Sources = []string{"order"}
+	assert.True(es.AllowSource("order"))
+	assert.False(es.AllowSource("delivery"))
+
+	es.Sources = []string{"*"}
+	assert.True(es.AllowSource("delivery"))
+}
+
+func TestExternalServiceSidecarEgressPipelineSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	es := &ExternalService{
+		Name:    "github",
+		Hosts:   []string{"api.github.com"},
+		Servers: []string{"https://api.github.com"},
+		TLS: &proxy.TransportTLSSpec{
+			Verify:     true,
+			ServerName: "api.github.com",
+		},
+		Timeout: "5s",
+		Retry: &resilience.RetryRule{
+			MaxAttempts:         3,
+			WaitDuration:        "100ms",
+			BackOffPolicy:       "random",
+			RandomizationFactor: 0.5,
+		},
+	}
+
+	superSpec, err := es.SidecarEgressPipelineSpec()
+	assert.NoError(err)
+	assert.Equal("sidecar-egress-external-pipeline-github", superSpec.Name())
+
+	config := superSpec.JSONConfig()
+	for _, s := range []string{
+		`"url":"https://api.github.com"`,
+		`"tls":{"serverName":"api.github.com","verify":true}`,
+		`"retryPolicy":"retry"`,
+		`"timeout":"5s"`,
+	} {
+		assert.True(strings.Contains(config, s), "%s not found in %s", s, config)
+	}
+	assert.False(strings.Contains(config, SourceServiceHeaderKey))
+	assert.False(strings.Contains(config, `"kind":"CircuitBreaker"`))
+}
@@ -40,13 +40,14 @@ func (s *Service) BackendName() string {
 
 // IngressControllerHTTPServerSpec generates HTTP server spec for ingress.
 // as ingress does not belong to a service, it is not a method of 'Service'
-func IngressControllerHTTPServerSpec(port int, rules []*IngressRule) (*supervisor.Spec, error) {
+func IngressControllerHTTPServerSpec(port int, rules []*IngressRule, accessLog string) (*supervisor.Spec, error) {
 	const specFmt = `
 kind: HTTPServer
 name: %s
 port: %d
 keepAlive: true
 https: false
+accessLog: %q
 rules:`
 
 	const ruleFmt = `
@@ -60,7 +61,7 @@ rules:`
 
 	buf := bytes.Buffer{}
 
-	str := fmt.Sprintf(specFmt, IngressControllerServerName, port)
+	str := fmt.Sprintf(specFmt, IngressControllerServerName, port, accessLog)
 	buf.WriteString(str)
 
 	for _, r := range rules {
@@ -89,6 +90,7 @@ func (s *Service) IngressControllerPipelineSpec(instanceSpecs []*ServiceInstance
 ) (*supervisor.Spec, error) {
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.IngressControllerPipelineName())
 
+	pipelineSpecBuilder.appendSourceService(IngressControllerName)
 	pipelineSpecBuilder.appendMeshAdaptor(canaries)
 	pipelineSpecBuilder.appendProxyWithCanary(&proxyParam{
 		instanceSpecs: instanceSpecs,
@@ -96,6 +98,7 @@ func (s *Service) IngressControllerPipelineSpec(instanceSpecs []*ServiceInstance
 		lb:            s.LoadBalance,
 		cert:          cert,
 		rootCert:      rootCert,
+		healthCheck:   s.HealthCheck,
 	})
 
 	jsonConfig := pipelineSpecBuilder.jsonConfig()
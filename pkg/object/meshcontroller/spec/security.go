@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// CertStatus is the status of a certificate, the certificates are
+	// resigned by the cert manager automatically after they expire.
+	CertStatus struct {
+		ServiceName string `json:"serviceName"`
+		InstanceID  string `json:"instanceID,omitempty"`
+		IP          string `json:"ip,omitempty"`
+		SignTime    string `json:"signTime"`
+		TTL         string `json:"ttl"`
+		ExpireTime  string `json:"expireTime,omitempty"`
+		Expired     bool   `json:"expired"`
+	}
+
+	// ServiceMTLSStatus is the mTLS status of a service.
+	ServiceMTLSStatus struct {
+		// Mode is the mode configured in the service.
+		Mode string `json:"mode"`
+		// EffectiveMode is the mode in use, which falls back to the mode
+		// of the mesh if Mode is empty.
+		EffectiveMode string        `json:"effectiveMode"`
+		Certs         []*CertStatus `json:"certs"`
+	}
+
+	// CertsStatus is the status of all certificates in the mesh.
+	CertsStatus struct {
+		MTLSMode               string        `json:"mtlsMode"`
+		RootCert               *CertStatus   `json:"rootCert,omitempty"`
+		ServiceCerts           []*CertStatus `json:"serviceCerts"`
+		IngressControllerCerts []*CertStatus `json:"ingressControllerCerts"`
+	}
+)
+
+var httpMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodConnect: {},
+	http.MethodOptions: {},
+	http.MethodTrace:   {},
+}
+
+// Validate validates TrafficPermission.
+func (tp *TrafficPermission) Validate() error {
+	for _, m := range tp.Methods {
+		if _, ok := httpMethods[m]; !ok {
+			return fmt.Errorf("invalid method %s", m)
+		}
+	}
+	for _, p := range tp.PathPrefixes {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("path prefix %s must start with /", p)
+		}
+	}
+	return nil
+}
+
+func quoteStrings(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = strconv.Quote(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// expression returns the CEL expression which is true if the request is
+// permitted by tp.
+func (tp *TrafficPermission) expression() string {
+	header := strconv.Quote(strings.ToLower(SourceServiceHeaderKey))
+	conds := []string{fmt.Sprintf("%s in request.header", header)}
+
+	anySource := false
+	for _, s := range tp.Sources {
+		if s == "*" {
+			anySource = true
+		}
+	}
+	if !anySource {
+		conds = append(conds, fmt.Sprintf("request.header[%s] in %s", header, quoteStrings(tp.Sources)))
+	}
+
+	if len(tp.Methods) > 0 {
+		conds = append(conds, fmt.Sprintf("request.method in %s", quoteStrings(tp.Methods)))
+	}
+
+	if len(tp.PathPrefixes) > 0 {
+		prefixes := make([]string, len(tp.PathPrefixes))
+		for i, p := range tp.PathPrefixes {
+			prefixes[i] = fmt.Sprintf("request.path.startsWith(%s)", strconv.Quote(p))
+		}
+		conds = append(conds, "("+strings.Join(prefixes, " || ")+")")
+	}
+
+	return strings.Join(conds, " && ")
+}
+
+// deniedTrafficExpression returns the CEL expression which is true if the
+// request is not permitted by any of perms, it returns an empty string if
+// perms is empty, which means all requests are permitted.
+func deniedTrafficExpression(perms []*TrafficPermission) string {
+	if len(perms) == 0 {
+		return ""
+	}
+
+	exprs := make([]string, len(perms))
+	for i, perm := range perms {
+		exprs[i] = "(" + perm.expression() + ")"
+	}
+	return "!(" + strings.Join(exprs, " || ") + ")"
+}
+
+// Status returns the status of the certificate.
+func (c *Certificate) Status() *CertStatus {
+	status := &CertStatus{
+		ServiceName: c.ServiceName,
+		InstanceID:  c.HOST,
+		IP:          c.IP,
+		SignTime:    c.SignTime,
+		TTL:         c.TTL,
+	}
+
+	signTime, err := time.Parse(time.RFC3339, c.SignTime)
+	if err != nil {
+		return status
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return status
+	}
+
+	expireTime := signTime.Add(ttl)
+	status.ExpireTime = expireTime.Format(time.RFC3339)
+	status.Expired = time.Now().After(expireTime)
+	return status
+}
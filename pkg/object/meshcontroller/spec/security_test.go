@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spec
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/expression"
+)
+
+func newPermissionRequest(t *testing.T, method, path, source string) *httpprot.Request {
+	stdr, err := http.NewRequest(method, "http://127.0.0.1"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "" {
+		stdr.Header.Set(SourceServiceHeaderKey, source)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestTrafficPermissionValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	tp := &TrafficPermission{
+		Name:         "order-to-delivery",
+		Destination:  "delivery",
+		Sources:      []string{"order"},
+		Methods:      []string{http.MethodGet},
+		PathPrefixes: []string{"/api"},
+	}
+	assert.NoError(tp.Validate())
+
+	tp.Methods = []string{"get"}
+	assert.Error(tp.Validate())
+
+	tp.Methods = nil
+	tp.PathPrefixes = []string{"api"}
+	assert.Error(tp.Validate())
+}
+
+func TestDeniedTrafficExpression(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", deniedTrafficExpression(nil))
+
+	perms := []*TrafficPermission{
+		{
+			Name:         "order-to-delivery",
+			Destination:  "delivery",
+			Sources:      []string{"order", "restaurant"},
+			Methods:      []string{http.MethodGet, http.MethodPost},
+			PathPrefixes: []string{"/api/", "/v2/"},
+		},
+		{
+			Name:         "any-to-delivery-health",
+			Destination:  "delivery",
+			Sources:      []string{"*"},
+			PathPrefixes: []string{"/health"},
+		},
+	}
+
+	expr, err := expression.Compile(deniedTrafficExpression(perms))
+	assert.NoError(err)
+
+	cases := []struct {
+		method, path, source string
+		denied               bool
+	}{
+		{http.MethodGet, "/api/orders", "order", false},
+		{http.MethodPost, "/v2/orders", "restaurant", false},
+		{http.MethodDelete, "/api/orders", "order", true},
+		{http.MethodGet, "/admin", "order", true},
+		{http.MethodGet, "/api/orders", "payment", true},
+		{http.MethodGet, "/api/orders", "", true},
+		{http.MethodGet, "/health", "payment", false},
+		{http.MethodGet, "/health", "", true},
+	}
+	for _, c := range cases {
+		req := newPermissionRequest(t, c.method, c.path, c.source)
+		assert.Equal(c.denied, expr.Match(req), "%s %s from %q", c.method, c.path, c.source)
+	}
+}
+
+func TestSidecarPipelineSpecWithTrafficPermissions(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Service{
+		Name: "delivery",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+	}
+
+	perms := []*TrafficPermission{
+		{
+			Name:        "order-to-delivery",
+			Destination: "delivery",
+			Sources:     []string{"order"},
+		},
+	}
+	superSpec, err := s.SidecarIngressPipelineSpec(13001, perms)
+	assert.NoError(err)
+	config := superSpec.JSONConfig()
+	assert.True(strings.Contains(config, `"name":"trafficPermission"`), config)
+	assert.True(strings.Contains(config, `"code":403`), config)
+
+	superSpec, err = s.SidecarIngressPipelineSpec(13001, nil)
+	assert.NoError(err)
+	assert.False(strings.Contains(superSpec.JSONConfig(), "trafficPermission"))
+
+	instances := []*ServiceInstanceSpec{
+		{
+			ServiceName: "delivery",
+			InstanceID:  "delivery-0",
+			IP:          "10.1.0.76",
+			Port:        13001,
+			Status:      ServiceStatusUp,
+		},
+	}
+	superSpec, err = s.SidecarEgressPipelineSpec(instances, nil, nil, nil, "order")
+	assert.NoError(err)
+	config = superSpec.JSONConfig()
+	assert.True(strings.Contains(config, `"name":"sourceAdaptor"`), config)
+	assert.True(strings.Contains(config, `"X-Mesh-Source-Service":"order"`), config)
+}
+
+func TestServiceMTLSMode(t *testing.T) {
+	assert := assert.New(t)
+
+	admin := Admin{}
+	svc := &Service{Name: "order", MTLSMode: SecurityLevelStrict}
+	assert.Equal(SecurityLevelPermissive, admin.ServiceMTLSMode(svc))
+	assert.False(admin.EnableCertManager())
+
+	admin.Security = &Security{MTLSMode: SecurityLevelPermissive}
+	assert.True(admin.EnableCertManager())
+	assert.True(admin.EnablemTLSForService(svc))
+	assert.False(admin.EnablemTLSForService(&Service{Name: "delivery"}))
+	assert.Equal(SecurityLevelPermissive, admin.ServiceMTLSMode(nil))
+
+	admin.Security.MTLSMode = SecurityLevelStrict
+	svc.MTLSMode = SecurityLevelPermissive
+	assert.False(admin.EnablemTLSForService(svc))
+	assert.True(admin.EnablemTLSForService(&Service{Name: "delivery"}))
+}
+
+func TestCertificateStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	signTime := time.Now().Add(-2 * time.Hour)
+	cert := &Certificate{
+		ServiceName: "order",
+		HOST:        "order-0",
+		IP:          "10.1.0.1",
+		SignTime:    signTime.Format(time.RFC3339),
+		TTL:         "1h",
+	}
+	status := cert.Status()
+	assert.Equal("order-0", status.InstanceID)
+	assert.Equal(signTime.Add(time.Hour).Format(time.RFC3339), status.ExpireTime)
+	assert.True(status.Expired)
+
+	cert.TTL = "3h"
+	assert.False(cert.Status().Expired)
+
+	cert.TTL = "invalid"
+	status = cert.Status()
+	assert.Equal("", status.ExpireTime)
+	assert.False(status.Expired)
+}
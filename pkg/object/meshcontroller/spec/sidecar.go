@@ -53,8 +53,9 @@ func (s *Service) ApplicationInstanceSpec(port uint32) *ServiceInstanceSpec {
 	}
 }
 
-// SidecarEgressHTTPServerSpec returns a spec for egress HTTP server
-func (s *Service) SidecarEgressHTTPServerSpec(keepalive bool, timeout string) (*supervisor.Spec, error) {
+// SidecarEgressHTTPServerSpec returns a spec for egress HTTP server,
+// accessLog is the name of its AccessLog, it could be empty.
+func (s *Service) SidecarEgressHTTPServerSpec(keepalive bool, timeout string, accessLog string) (*supervisor.Spec, error) {
 	egressHTTPServerFormat := `
 kind: HTTPServer
 name: %s
@@ -62,6 +63,7 @@ port: %d
 keepAlive: %v
 keepAliveTimeout: %s
 https: false
+accessLog: %q
 `
 	if timeout == "" {
 		timeout = defaultKeepAliveTimeout
@@ -70,7 +72,8 @@ https: false
 		s.SidecarEgressServerName(),
 		s.Sidecar.EgressPort,
 		keepalive,
-		timeout)
+		timeout,
+		accessLog)
 
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	if err != nil {
@@ -81,9 +84,10 @@ https: false
 	return superSpec, nil
 }
 
-// SidecarEgressPipelineSpec returns a spec for sidecar egress pipeline
+// SidecarEgressPipelineSpec returns a spec for sidecar egress pipeline,
+// source is the name of the calling service.
 func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec,
-	canaries []*ServiceCanary, appCert, rootCert *Certificate,
+	canaries []*ServiceCanary, appCert, rootCert *Certificate, source string,
 ) (*supervisor.Spec, error) {
 	if len(instanceSpecs) == 0 {
 		return nil, fmt.Errorf("no instance")
@@ -91,6 +95,7 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarEgressPipelineName())
 
+	pipelineSpecBuilder.appendSourceService(source)
 	pipelineSpecBuilder.appendMeshAdaptor(canaries)
 
 	if s.Mock != nil && s.Mock.Enabled {
@@ -127,6 +132,7 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 		retryPolicy:          retryPolicy,
 		circuitBreakerPolicy: circuitBreakerPolicy,
 		failureCodes:         failureCodes,
+		healthCheck:          s.HealthCheck,
 	})
 
 	jsonConfig := pipelineSpecBuilder.jsonConfig()
@@ -139,9 +145,10 @@ func (s *Service) SidecarEgressPipelineSpec(instanceSpecs []*ServiceInstanceSpec
 	return superSpec, nil
 }
 
-// SidecarIngressHTTPServerSpec generates a spec for sidecar ingress HTTP server
+// SidecarIngressHTTPServerSpec generates a spec for sidecar ingress HTTP server,
+// accessLog is the name of its AccessLog, it could be empty.
 func (s *Service) SidecarIngressHTTPServerSpec(keepalive bool, timeout string,
-	cert, rootCert *Certificate,
+	cert, rootCert *Certificate, accessLog string,
 ) (*supervisor.Spec, error) {
 	ingressHTTPServerFormat := `
 kind: HTTPServer
@@ -153,6 +160,7 @@ https: %s
 certBase64: %s
 keyBase64: %s
 caCertBase64: %s
+accessLog: %q
 rules:
   - paths:
     - pathPrefix: /
@@ -172,7 +180,7 @@ rules:
 	}
 	yamlConfig := fmt.Sprintf(ingressHTTPServerFormat, name,
 		s.Sidecar.IngressPort, keepalive, timeout, needHTTPS,
-		certBase64, keyBase64, rootCertBaser64, pipelineName)
+		certBase64, keyBase64, rootCertBaser64, accessLog, pipelineName)
 
 	superSpec, err := supervisor.NewSpec(yamlConfig)
 	if err != nil {
@@ -183,10 +191,13 @@ rules:
 	return superSpec, nil
 }
 
-// SidecarIngressPipelineSpec returns a spec for sidecar ingress pipeline
-func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32) (*supervisor.Spec, error) {
+// SidecarIngressPipelineSpec returns a spec for sidecar ingress pipeline,
+// perms are the traffic permissions whose destination is the service.
+func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32, perms []*TrafficPermission) (*supervisor.Spec, error) {
 	pipelineSpecBuilder := newPipelineSpecBuilder(s.SidecarIngressPipelineName())
 
+	pipelineSpecBuilder.appendTrafficPermissions(perms)
+
 	var timeout string
 	if s.Resilience != nil {
 		pipelineSpecBuilder.appendRateLimiter(s.Resilience.RateLimiter)
@@ -199,6 +210,7 @@ func (s *Service) SidecarIngressPipelineSpec(applicationPort uint32) (*superviso
 		instanceSpecs: []*ServiceInstanceSpec{s.ApplicationInstanceSpec(applicationPort)},
 		lb:            s.LoadBalance,
 		timeout:       timeout,
+		healthCheck:   s.HealthCheck,
 	})
 
 	jsonConfig := pipelineSpecBuilder.jsonConfig()
@@ -82,6 +82,11 @@ const (
 	// ServiceCanaryHeaderKey is the http header key of service canary.
 	ServiceCanaryHeaderKey = "X-Mesh-Service-Canary"
 
+	// SourceServiceHeaderKey is the http header key of the calling
+	// service, it is set by the egress of the caller and checked against
+	// the traffic permissions by the ingress of the callee.
+	SourceServiceHeaderKey = "X-Mesh-Source-Service"
+
 	defaultKeepAliveTimeout = "60s"
 )
 
@@ -134,6 +139,10 @@ type (
 	WorkerSpec struct {
 		Ingress IngressServerSpec `json:"ingress" jsonschema:"omitempty"`
 		Egress  EgressServerSpec  `json:"egress" jsonschema:"omitempty"`
+
+		// AccessLog is the name of the AccessLog controller to write the
+		// access logs of the sidecars and the ingress controller.
+		AccessLog string `json:"accessLog,omitempty" jsonschema:"omitempty"`
 	}
 
 	// IngressServerSpec is the spec of ingress httpserver in worker
@@ -188,6 +197,11 @@ type (
 		Resilience    *Resilience    `json:"resilience,omitempty" jsonschema:"omitempty"`
 		LoadBalance   *LoadBalance   `json:"loadBalance,omitempty" jsonschema:"omitempty"`
 		Observability *Observability `json:"observability,omitempty" jsonschema:"omitempty"`
+		HealthCheck   *HealthCheck   `json:"healthCheck,omitempty" jsonschema:"omitempty"`
+
+		// MTLSMode overrides the mTLS mode of the mesh for the ingress
+		// traffic of this service, empty means following the mesh.
+		MTLSMode string `json:"mtlsMode,omitempty" jsonschema:"omitempty,enum=,enum=strict,enum=permissive"`
 	}
 
 	// Mock is the spec of configured and static API responses for this service.
@@ -239,6 +253,10 @@ type (
 	// LoadBalance is the spec of service load balance.
 	LoadBalance = proxy.LoadBalanceSpec
 
+	// HealthCheck is the spec of the active health checking of the service
+	// instances.
+	HealthCheck = proxy.HealthCheckSpec
+
 	// Sidecar is the spec of service sidecar.
 	Sidecar struct {
 		DiscoveryType   string `json:"discoveryType" jsonschema:"required"`
@@ -451,6 +469,51 @@ type (
 		// Rules are the traffic rules to allow (HTTPRoutes)
 		Rules []TrafficTargetRule `json:"rules,omitempty"`
 	}
+
+	// TrafficPermission permits the sources to call the destination, once
+	// a service is the destination of any permission, the calls not
+	// permitted by its permissions are rejected by its sidecar.
+	TrafficPermission struct {
+		Name string `json:"name" jsonschema:"required"`
+
+		// Destination is the name of the service being called.
+		Destination string `json:"destination" jsonschema:"required"`
+
+		// Sources are the names of the calling services, "*" means any
+		// service in the mesh.
+		Sources []string `json:"sources" jsonschema:"required,minItems=1,uniqueItems=true"`
+
+		// Methods are the permitted HTTP methods, empty means all.
+		Methods []string `json:"methods,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+
+		// PathPrefixes are the permitted path prefixes, empty means all.
+		PathPrefixes []string `json:"pathPrefixes,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// ExternalService is a service outside the mesh, the sidecars call it
+	// through a dedicated egress pipeline instead of bypassing the mesh.
+	ExternalService struct {
+		Name string `json:"name" jsonschema:"required"`
+
+		// Hosts are the host names which the applications call the
+		// service by.
+		Hosts []string `json:"hosts" jsonschema:"required,minItems=1,uniqueItems=true"`
+
+		// Servers are the URLs of the service, the sidecars originate TLS
+		// for the ones in HTTPS.
+		Servers []string `json:"servers" jsonschema:"required,minItems=1,uniqueItems=true"`
+
+		TLS            *proxy.TransportTLSSpec        `json:"tls,omitempty" jsonschema:"omitempty"`
+		LoadBalance    *LoadBalance                   `json:"loadBalance,omitempty" jsonschema:"omitempty"`
+		Timeout        string                         `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+		Retry          *resilience.RetryRule          `json:"retry,omitempty" jsonschema:"omitempty"`
+		CircuitBreaker *resilience.CircuitBreakerRule `json:"circuitBreaker,omitempty" jsonschema:"omitempty"`
+		FailureCodes   []int                          `json:"failureCodes,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+
+		// Sources are the names of the services which could call the
+		// service, empty means all services.
+		Sources []string `json:"sources,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
 )
 
 // Validate validates ServiceCanary.
@@ -497,7 +560,7 @@ func (a Admin) Validate() error {
 		}
 	}
 
-	if a.EnablemTLS() {
+	if a.Security != nil {
 		appCertTTL, err := time.ParseDuration(a.Security.AppCertTTL)
 		if err != nil {
 			return fmt.Errorf("parse appcertTTl: %s failed: %v", a.Security.AppCertTTL, err)
@@ -537,6 +600,31 @@ func (a Admin) EnablemTLS() bool {
 	return false
 }
 
+// EnableCertManager indicates whether the certificates should be signed,
+// they are needed once the security is configured, because a service
+// could enable mTLS by itself in the permissive mesh.
+func (a Admin) EnableCertManager() bool {
+	return a.Security != nil
+}
+
+// ServiceMTLSMode returns the effective mTLS mode of the service, the mode
+// of the service overrides the one of the mesh.
+func (a Admin) ServiceMTLSMode(s *Service) string {
+	if a.Security == nil {
+		return SecurityLevelPermissive
+	}
+	if s != nil && s.MTLSMode != "" {
+		return s.MTLSMode
+	}
+	return a.Security.MTLSMode
+}
+
+// EnablemTLSForService indicates whether the ingress traffic of the
+// service is in mTLS.
+func (a Admin) EnablemTLSForService(s *Service) bool {
+	return a.ServiceMTLSMode(s) == SecurityLevelStrict
+}
+
 // Key returns the key of ServiceInstanceSpec.
 func (s *ServiceInstanceSpec) Key() string {
 	return fmt.Sprintf("%s/%s/%s", s.RegistryName, s.ServiceName, s.InstanceID)
@@ -20,6 +20,7 @@ package spec
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/megaease/easegress/pkg/filters/mock"
@@ -247,7 +248,7 @@ func TestSidecarEgressPipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarEgressPipelineSpec(instances, canaries, nil, nil)
+	superSpec, err := s.SidecarEgressPipelineSpec(instances, canaries, nil, nil, "")
 	if err != nil {
 		t.Fatalf("generate sidecar egress pipeline failed: %v", err)
 	}
@@ -299,7 +300,7 @@ func TestSidecarEgressPipelineWithCanarySpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -333,7 +334,7 @@ func TestSidecarEgressPipelineSpecWithMock(t *testing.T) {
 	}
 
 	instanceSpecs := []*ServiceInstanceSpec{}
-	_, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	_, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	if err == nil {
 		t.Fatalf("mocking service should failed: %v", err)
 	}
@@ -411,7 +412,7 @@ func TestSidecarEgressPipelneNotLoadBalancer(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, err := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	if err != nil {
 		t.Fatalf("sidecar egress pipeline spec gen failed: %v", err)
 	}
@@ -463,7 +464,7 @@ func TestSidecarEgressPipelineWithMultipleCanarySpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -512,7 +513,7 @@ func TestSidecarEgressPipelineWithCanaryNoInstanceSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -562,7 +563,7 @@ func TestSidecarEgressPipelineWithCanaryInstanceMultipleLabelSpec(t *testing.T)
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -579,7 +580,7 @@ func TestIngressHTTPServerSpec(t *testing.T) {
 		},
 	}
 
-	_, err := IngressControllerHTTPServerSpec(1233, rule)
+	_, err := IngressControllerHTTPServerSpec(1233, rule, "")
 	if err != nil {
 		t.Errorf("ingress http server spec failed: %v", err)
 	}
@@ -622,7 +623,7 @@ func TestSidecarIngressWithResiliencePipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarIngressPipelineSpec(443)
+	superSpec, _ := s.SidecarIngressPipelineSpec(443, nil)
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -683,7 +684,7 @@ func TestSidecarEgressResiliencePipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil)
+	superSpec, _ := s.SidecarEgressPipelineSpec(instanceSpecs, nil, nil, nil, "")
 	fmt.Println(superSpec.JSONConfig())
 }
 
@@ -816,13 +817,13 @@ func TestSidecarIngressPipelineSpecCert(t *testing.T) {
 		SignTime:    "2021-10-13 12:33:10",
 	}
 
-	superSpec, err := s.SidecarIngressHTTPServerSpec(false, defaultKeepAliveTimeout, cert, rootCert)
+	superSpec, err := s.SidecarIngressHTTPServerSpec(false, defaultKeepAliveTimeout, cert, rootCert, "")
 	if err != nil {
 		t.Fatalf("ingress http server spec failed: %v", err)
 	}
 	fmt.Println(superSpec.JSONConfig())
 
-	superSpec, err = s.SidecarEgressHTTPServerSpec(true, defaultKeepAliveTimeout)
+	superSpec, err = s.SidecarEgressHTTPServerSpec(true, defaultKeepAliveTimeout, "")
 
 	if err != nil {
 		t.Fatalf("egress http server spec failed: %v", err)
@@ -846,13 +847,13 @@ func TestSidecarIngressPipelineSpec(t *testing.T) {
 		},
 	}
 
-	superSpec, err := s.SidecarIngressHTTPServerSpec(true, "", nil, nil)
+	superSpec, err := s.SidecarIngressHTTPServerSpec(true, "", nil, nil, "accesslog-mesh")
 	if err != nil {
 		t.Fatalf("ingress http server spec failed: %v", err)
 	}
 	fmt.Println(superSpec.JSONConfig())
 
-	superSpec, err = s.SidecarEgressHTTPServerSpec(false, "")
+	superSpec, err = s.SidecarEgressHTTPServerSpec(false, "", "accesslog-mesh")
 
 	if err != nil {
 		t.Fatalf("egress http server spec failed: %v", err)
@@ -989,3 +990,47 @@ func TestAppendMeshAdaptor(t *testing.T) {
 	buff, _ := codectool.MarshalJSON(b.Spec)
 	t.Logf("%s", buff)
 }
+
+func TestSidecarEgressPipelineSpecWithHealthCheck(t *testing.T) {
+	s := &Service{
+		Name: "delivery-mesh",
+		Sidecar: &Sidecar{
+			Address:         "127.0.0.1",
+			IngressPort:     8080,
+			IngressProtocol: "http",
+			EgressPort:      9090,
+			EgressProtocol:  "http",
+		},
+		HealthCheck: &HealthCheck{
+			Type:    "grpc",
+			Service: "delivery",
+		},
+	}
+
+	instances := []*ServiceInstanceSpec{
+		{
+			ServiceName:  "delivery-mesh",
+			RegistryName: "easemesh-controller",
+			InstanceID:   "delivery-mesh-84dbdb69df-7b6st",
+			IP:           "10.1.0.76",
+			Port:         13001,
+			Status:       "UP",
+		},
+	}
+
+	superSpec, err := s.SidecarEgressPipelineSpec(instances, nil, nil, nil, "")
+	if err != nil {
+		t.Fatalf("generate sidecar egress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"healthCheck":{"service":"delivery","type":"grpc"}`) {
+		t.Fatalf("health check not found in %s", superSpec.JSONConfig())
+	}
+
+	superSpec, err = s.SidecarIngressPipelineSpec(13001, nil)
+	if err != nil {
+		t.Fatalf("generate sidecar ingress pipeline failed: %v", err)
+	}
+	if !strings.Contains(superSpec.JSONConfig(), `"healthCheck":{"service":"delivery","type":"grpc"}`) {
+		t.Fatalf("health check not found in %s", superSpec.JSONConfig())
+	}
+}
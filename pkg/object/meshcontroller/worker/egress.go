@@ -123,7 +123,8 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 
 	egs.egressServerName = service.SidecarEgressServerName()
 	admSpec := egs.superSpec.ObjectSpec().(*spec.Admin)
-	superSpec, err := service.SidecarEgressHTTPServerSpec(admSpec.WorkerSpec.Egress.KeepAlive, admSpec.WorkerSpec.Egress.KeepAliveTimeout)
+	superSpec, err := service.SidecarEgressHTTPServerSpec(admSpec.WorkerSpec.Egress.KeepAlive,
+		admSpec.WorkerSpec.Egress.KeepAliveTimeout, admSpec.WorkerSpec.AccessLog)
 	if err != nil {
 		return err
 	}
@@ -149,7 +150,7 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 		}
 	}
 
-	if admSpec.EnablemTLS() {
+	if admSpec.EnableCertManager() {
 		logger.Infof("egress in mtls mode, start listen ID: %s's cert", egs.instanceID)
 		if err := egs.inf.OnServerCert(egs.serviceName, egs.instanceID, egs.reloadByCert); err != nil {
 			if err != informer.ErrAlreadyWatched {
@@ -182,6 +183,13 @@ func (egs *EgressServer) InitEgress(service *spec.Service) error {
 		}
 	}
 
+	if err := egs.inf.OnAllExternalServiceSpecs(egs.reloadByExternalServices); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add external service watching service: %s failed: %v", service.Name, err)
+			return err
+		}
+	}
+
 	go egs.watch()
 
 	return nil
@@ -247,6 +255,26 @@ func (egs *EgressServer) reloadByServiceCanaries(value map[string]*spec.ServiceC
 	return true
 }
 
+func (egs *EgressServer) reloadByExternalServices(value map[string]*spec.ExternalService) bool {
+	select {
+	case egs.chReloadEvent <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// listExternalServices returns the external services which can be called
+// by the service.
+func (egs *EgressServer) listExternalServices() []*spec.ExternalService {
+	var result []*spec.ExternalService
+	for _, es := range egs.service.ListExternalServiceSpecs() {
+		if es.AllowSource(egs.serviceName) {
+			result = append(result, es)
+		}
+	}
+	return result
+}
+
 func (egs *EgressServer) listTrafficTargets(lgSvcs map[string]*spec.Service) []*spec.TrafficTarget {
 	var result []*spec.TrafficTarget
 
@@ -409,13 +437,14 @@ func (egs *EgressServer) reload() {
 	tts := egs.listTrafficTargets(lgSvcs)
 	ttSvcs := egs.listServiceOfTrafficTarget(tts)
 	groups := egs.listHTTPRouteGroups(tts)
+	externalSvcs := egs.listExternalServices()
 
 	egs.mutex.Lock()
 	defer egs.mutex.Unlock()
 
 	admSpec := egs.superSpec.ObjectSpec().(*spec.Admin)
 	var cert, rootCert *spec.Certificate
-	if admSpec.EnablemTLS() {
+	if admSpec.EnableCertManager() {
 		cert = egs.service.GetServiceInstanceCert(egs.serviceName, egs.instanceID)
 		rootCert = egs.service.GetRootCert()
 		logger.Infof("egress enable TLS")
@@ -432,7 +461,12 @@ func (egs *EgressServer) reload() {
 			return
 		}
 
-		pipelineSpec, err := svc.SidecarEgressPipelineSpec(instances, canaries, cert, rootCert)
+		// only the services in mTLS mode are called with the certificates
+		var svcCert, svcRootCert *spec.Certificate
+		if admSpec.EnablemTLSForService(svc) {
+			svcCert, svcRootCert = cert, rootCert
+		}
+		pipelineSpec, err := svc.SidecarEgressPipelineSpec(instances, canaries, svcCert, svcRootCert, egs.serviceName)
 		if err != nil {
 			logger.Errorf("generate sidecar egress pipeline spec for service %s failed: %v", svc.Name, err)
 			return
@@ -455,6 +489,23 @@ func (egs *EgressServer) reload() {
 		createPipeline(svc)
 	}
 
+	// the external services are called through their own pipelines, so
+	// that they are not bypassing the mesh
+	for _, es := range externalSvcs {
+		pipelineSpec, err := es.SidecarEgressPipelineSpec()
+		if err != nil {
+			logger.Errorf("generate sidecar egress pipeline spec for external service %s failed: %v", es.Name, err)
+			continue
+		}
+
+		entity, err := egs.tc.CreatePipelineForSpec(egs.namespace, pipelineSpec)
+		if err != nil {
+			logger.Errorf("update http pipeline failed: %v", err)
+			continue
+		}
+		pipelines[pipelineSpec.Name()] = entity
+	}
+
 	httpServerSpec := egs.httpServer.Spec().ObjectSpec().(*httpserver.Spec)
 	httpServerSpec.Rules = nil
 
@@ -520,6 +571,14 @@ func (egs *EgressServer) reload() {
 		}
 	}
 
+	for _, es := range externalSvcs {
+		pipelineName := es.SidecarEgressPipelineName()
+		if pipelines[pipelineName] == nil {
+			continue
+		}
+		httpServerSpec.Rules = append(httpServerSpec.Rules, egs.buildExternalServiceRules(pipelineName, es)...)
+	}
+
 	builder := newHTTPServerSpecBuilder(egs.egressServerName, httpServerSpec)
 	superSpec, err := supervisor.NewSpec(builder.jsonConfig())
 	if err != nil {
@@ -537,6 +596,41 @@ func (egs *EgressServer) reload() {
 	egs.httpServer = entity
 }
 
+// buildExternalServiceRules builds the rules matching the hosts of the
+// external service, or the RPC header with its name.
+func (egs *EgressServer) buildExternalServiceRules(pipelineName string, es *spec.ExternalService) []*httpserver.Rule {
+	rules := []*httpserver.Rule{
+		{
+			Paths: []*httpserver.Path{
+				{
+					PathPrefix: "/",
+					Headers: []*httpserver.Header{
+						{
+							Key:    egressRPCKey,
+							Values: []string{es.Name},
+						},
+					},
+					Backend: pipelineName,
+				},
+			},
+		},
+	}
+
+	for _, host := range es.Hosts {
+		rules = append(rules, &httpserver.Rule{
+			Host: host,
+			Paths: []*httpserver.Path{
+				{
+					PathPrefix: "/",
+					Backend:    pipelineName,
+				},
+			},
+		})
+	}
+
+	return rules
+}
+
 func (egs *EgressServer) watch() {
 	for range egs.chReloadEvent {
 		egs.reload()
@@ -19,6 +19,7 @@ package worker
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/megaease/easegress/pkg/logger"
@@ -48,6 +49,7 @@ type (
 		namespace       string
 		inf             informer.Informer
 		instanceID      string
+		mTLS            bool
 
 		pipelines  map[string]*supervisor.ObjectEntity
 		httpServer *supervisor.ObjectEntity
@@ -113,7 +115,8 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 	ings.applicationPort = port
 
 	if _, ok := ings.pipelines[service.SidecarIngressPipelineName()]; !ok {
-		superSpec, err := service.SidecarIngressPipelineSpec(port)
+		perms := ings.service.ListTrafficPermissionsOfService(service.Name)
+		superSpec, err := service.SidecarIngressPipelineSpec(port, perms)
 		if err != nil {
 			return err
 		}
@@ -126,15 +129,14 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 
 	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
 	if ings.httpServer == nil {
-		var cert, rootCert *spec.Certificate
-		if admSpec.EnablemTLS() {
+		ings.mTLS = admSpec.EnablemTLSForService(service)
+		var cert *spec.Certificate
+		if ings.mTLS {
 			cert = ings.service.GetServiceInstanceCert(ings.serviceName, ings.instanceID)
-			rootCert = ings.service.GetRootCert()
 			logger.Infof("ingress enable TLS, init httpserver with cert: %#v", cert)
 		}
 
-		superSpec, err := service.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive,
-			admSpec.WorkerSpec.Ingress.KeepAliveTimeout, cert, rootCert)
+		superSpec, err := ings.httpServerSpec(service, cert)
 		if err != nil {
 			return err
 		}
@@ -154,7 +156,14 @@ func (ings *IngressServer) InitIngress(service *spec.Service, port uint32) error
 		}
 	}
 
-	if admSpec.EnablemTLS() {
+	if err := ings.inf.OnAllTrafficPermissionSpecs(ings.reloadByTrafficPermissions); err != nil {
+		if err != informer.ErrAlreadyWatched {
+			logger.Errorf("add traffic permission watching service: %s failed: %v", service.Name, err)
+			return err
+		}
+	}
+
+	if admSpec.EnableCertManager() {
 		logger.Infof("ingress in mtls mode, start listen ID: %s's cert", ings.instanceID)
 		if err := ings.inf.OnServerCert(ings.serviceName, ings.instanceID, ings.reloadHTTPServer); err != nil {
 			if err != informer.ErrAlreadyWatched {
@@ -181,27 +190,86 @@ func (ings *IngressServer) reloadHTTPServer(event informer.Event, value *spec.Ce
 		logger.Infof("ingress can't find its service: %s", ings.serviceName)
 		return false
 	}
+
+	if !ings.mTLS {
+		return true
+	}
+
+	ings.updateHTTPServer(serviceSpec, value)
+	return true
+}
+
+// httpServerSpec returns the spec of the HTTPServer, it is in HTTPS if
+// cert is not nil.
+func (ings *IngressServer) httpServerSpec(serviceSpec *spec.Service, cert *spec.Certificate) (*supervisor.Spec, error) {
 	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
-	rootCert := ings.service.GetRootCert()
-	superSpec, err := serviceSpec.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive, admSpec.WorkerSpec.Ingress.KeepAliveTimeout, value, rootCert)
+
+	var rootCert *spec.Certificate
+	if cert != nil {
+		rootCert = ings.service.GetRootCert()
+	}
+
+	return serviceSpec.SidecarIngressHTTPServerSpec(admSpec.WorkerSpec.Ingress.KeepAlive,
+		admSpec.WorkerSpec.Ingress.KeepAliveTimeout, cert, rootCert, admSpec.WorkerSpec.AccessLog)
+}
+
+func (ings *IngressServer) updateHTTPServer(serviceSpec *spec.Service, cert *spec.Certificate) {
+	superSpec, err := ings.httpServerSpec(serviceSpec, cert)
 	if err != nil {
-		logger.Errorf("BUG: update ingress pipeline spec: %s new super spec failed: %v",
-			superSpec.JSONConfig(), err)
-		return true
+		logger.Errorf("BUG: update ingress http server spec failed: %v", err)
+		return
 	}
 
 	entity, err := ings.tc.UpdateTrafficGateForSpec(ings.namespace, superSpec)
 	if err != nil {
 		logger.Errorf("update http server %s failed: %v", ings.serviceName, err)
-		return true
+		return
 	}
 
 	// update local storage
 	ings.httpServer = entity
+}
+
+func (ings *IngressServer) reloadByTrafficPermissions(value map[string]*spec.TrafficPermission) bool {
+	serviceSpec := ings.service.GetServiceSpec(ings.serviceName)
+	if serviceSpec == nil {
+		logger.Infof("ingress can't find its service: %s", ings.serviceName)
+		return true
+	}
+
+	ings.mutex.Lock()
+	defer ings.mutex.Unlock()
+
+	var perms []*spec.TrafficPermission
+	for _, tp := range value {
+		if tp.Destination == ings.serviceName {
+			perms = append(perms, tp)
+		}
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		return perms[i].Name < perms[j].Name
+	})
 
+	ings.updatePipeline(serviceSpec, perms)
 	return true
 }
 
+func (ings *IngressServer) updatePipeline(serviceSpec *spec.Service, perms []*spec.TrafficPermission) {
+	superSpec, err := serviceSpec.SidecarIngressPipelineSpec(ings.applicationPort, perms)
+	if err != nil {
+		logger.Errorf("BUG: update ingress pipeline spec failed: %v", err)
+		return
+	}
+
+	entity, err := ings.tc.UpdatePipelineForSpec(ings.namespace, superSpec)
+	if err != nil {
+		logger.Errorf("update http pipeline %s failed: %v", superSpec.Name(), err)
+		return
+	}
+
+	ings.pipelines[serviceSpec.SidecarIngressPipelineName()] = entity
+}
+
 func (ings *IngressServer) reloadPipeline(event informer.Event, serviceSpec *spec.Service) bool {
 	ings.mutex.Lock()
 	defer ings.mutex.Unlock()
@@ -211,19 +279,20 @@ func (ings *IngressServer) reloadPipeline(event informer.Event, serviceSpec *spe
 		return false
 	}
 
-	superSpec, err := serviceSpec.SidecarIngressPipelineSpec(ings.applicationPort)
-	if err != nil {
-		logger.Errorf("BUG: update ingress pipeline spec: %s new super spec failed: %v",
-			superSpec.JSONConfig(), err)
-		return true
-	}
+	perms := ings.service.ListTrafficPermissionsOfService(ings.serviceName)
+	ings.updatePipeline(serviceSpec, perms)
 
-	entity, err := ings.tc.UpdatePipelineForSpec(ings.namespace, superSpec)
-	if err != nil {
-		return true
+	// the mTLS mode of the service is changed
+	admSpec := ings.superSpec.ObjectSpec().(*spec.Admin)
+	if mTLS := admSpec.EnablemTLSForService(serviceSpec); mTLS != ings.mTLS {
+		ings.mTLS = mTLS
+		var cert *spec.Certificate
+		if mTLS {
+			cert = ings.service.GetServiceInstanceCert(ings.serviceName, ings.instanceID)
+		}
+		ings.updateHTTPServer(serviceSpec, cert)
 	}
 
-	ings.pipelines[ings.serviceName] = entity
 	return true
 }
 
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	defaultDatadogSite    = "datadoghq.com"
+	defaultDatadogTimeout = 10 * time.Second
+	// maxDatadogSeries limits the number of series in one request.
+	maxDatadogSeries = 1000
+)
+
+type (
+	// DatadogSpec describes the Datadog metrics API.
+	DatadogSpec struct {
+		APIKey string `json:"apiKey" jsonschema:"required"`
+		// Site is the Datadog site, e.g. datadoghq.eu, default is
+		// datadoghq.com.
+		Site string `json:"site" jsonschema:"omitempty"`
+		// URL overrides the URL derived from the site.
+		URL     string `json:"url" jsonschema:"omitempty,format=uri"`
+		Timeout string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	datadogSender struct {
+		url    string
+		apiKey string
+		prefix string
+		host   string
+		tags   []tag
+		client *http.Client
+	}
+
+	datadogSeries struct {
+		Metric string       `json:"metric"`
+		Points [][2]float64 `json:"points"`
+		Type   string       `json:"type"`
+		Host   string       `json:"host,omitempty"`
+		Tags   []string     `json:"tags,omitempty"`
+	}
+
+	datadogPayload struct {
+		Series []*datadogSeries `json:"series"`
+	}
+)
+
+func newDatadogSender(spec *DatadogSpec, prefix, host string, tags []tag) *datadogSender {
+	s := &datadogSender{
+		url:    spec.URL,
+		apiKey: spec.APIKey,
+		prefix: prefix,
+		host:   host,
+		tags:   tags,
+	}
+	if s.url == "" {
+		site := spec.Site
+		if site == "" {
+			site = defaultDatadogSite
+		}
+		s.url = fmt.Sprintf("https://api.%s/api/v1/series", site)
+	}
+
+	timeout := defaultDatadogTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	s.client = &http.Client{Timeout: timeout}
+	return s
+}
+
+func (s *datadogSender) toSeries(p *point) *datadogSeries {
+	tags := make([]string, 0, len(p.tags)+len(s.tags))
+	for _, t := range p.tags {
+		tags = append(tags, t.key+":"+t.value)
+	}
+	for _, t := range s.tags {
+		tags = append(tags, t.key+":"+t.value)
+	}
+
+	return &datadogSeries{
+		Metric: s.prefix + "." + p.name,
+		Points: [][2]float64{{float64(p.timestamp), p.value}},
+		Type:   "gauge",
+		Host:   s.host,
+		Tags:   tags,
+	}
+}
+
+func (s *datadogSender) send(points []*point) error {
+	for len(points) > 0 {
+		n := len(points)
+		if n > maxDatadogSeries {
+			n = maxDatadogSeries
+		}
+
+		payload := &datadogPayload{Series: make([]*datadogSeries, 0, n)}
+		for _, p := range points[:n] {
+			payload.Series = append(payload.Series, s.toSeries(p))
+		}
+		if err := s.post(payload); err != nil {
+			return err
+		}
+		points = points[n:]
+	}
+	return nil
+}
+
+func (s *datadogSender) post(payload *datadogPayload) error {
+	body, err := codectool.MarshalJSON(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", s.apiKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("send %d series to %s returns status code %d", len(payload.Series), s.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *datadogSender) close() {
+}
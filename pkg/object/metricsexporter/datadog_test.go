@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func TestDatadog(t *testing.T) {
+	assert := assert.New(t)
+
+	var payloads []*datadogPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("secret", r.Header.Get("DD-API-KEY"))
+		payload := &datadogPayload{}
+		assert.NoError(codectool.DecodeJSON(r.Body, payload))
+		payloads = append(payloads, payload)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	s := newDatadogSender(&DatadogSpec{APIKey: "secret", URL: server.URL}, "easegress", "eg-1", []tag{{key: "env", value: "prod"}})
+	points := testPoints()
+	points[0].timestamp = 100
+	assert.NoError(s.send(points))
+
+	assert.Len(payloads, 1)
+	series := payloads[0].Series
+	assert.Len(series, 2)
+	assert.Equal("easegress.http_request.count", series[0].Metric)
+	assert.Equal([][2]float64{{100, 10}}, series[0].Points)
+	assert.Equal("gauge", series[0].Type)
+	assert.Equal("eg-1", series[0].Host)
+	assert.Equal([]string{"service:pipeline-demo/proxy", "env:prod"}, series[0].Tags)
+
+	// batches
+	payloads = nil
+	for i := 0; i < maxDatadogSeries; i++ {
+		points = append(points, testPoints()...)
+	}
+	assert.NoError(s.send(points))
+	assert.Len(payloads, 3)
+
+	// errors
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	assert.Error(s.send(points))
+}
+
+func TestDatadogURL(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newDatadogSender(&DatadogSpec{APIKey: "secret"}, "easegress", "", nil)
+	assert.Equal("https://api.datadoghq.com/api/v1/series", s.url)
+
+	s = newDatadogSender(&DatadogSpec{APIKey: "secret", Site: "datadoghq.eu"}, "easegress", "", nil)
+	assert.Equal("https://api.datadoghq.eu/api/v1/series", s.url)
+}
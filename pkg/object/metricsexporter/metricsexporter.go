@@ -0,0 +1,289 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metricsexporter implements a business controller which pushes
+// the statistics of the traffic objects to StatsD, DogStatsD or Datadog.
+package metricsexporter
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/statussynccontroller"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/easemonitor"
+)
+
+const (
+	// Category is the category of MetricsExporter.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of MetricsExporter.
+	Kind = "MetricsExporter"
+
+	backendStatsD    = "statsd"
+	backendDogStatsD = "dogstatsd"
+	backendDatadog   = "datadog"
+)
+
+func init() {
+	supervisor.Register(&MetricsExporter{})
+}
+
+type (
+	// MetricsExporter is a business controller which pushes the statistics
+	// of HTTPServers, Pipelines and filters to StatsD, DogStatsD or the
+	// Datadog API on an interval. The statistics are the same as the ones
+	// sent by EaseMonitorMetrics.
+	MetricsExporter struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		ssc      *statussynccontroller.StatusSyncController
+		sender   sender
+		interval time.Duration
+		done     chan struct{}
+		wg       sync.WaitGroup
+
+		latestTimestamp int64
+		numOfPoints     int64
+		numOfErrors     int64
+		lastError       atomic.Value
+	}
+
+	// Spec describes MetricsExporter.
+	Spec struct {
+		Backend  string `json:"backend" jsonschema:"required,enum=statsd,enum=dogstatsd,enum=datadog"`
+		Interval string `json:"interval" jsonschema:"omitempty,format=duration"`
+		// Prefix is the prefix of the metric names, default is easegress.
+		Prefix string `json:"prefix" jsonschema:"omitempty"`
+		// Tags are added to all metrics, they are ignored by the plain
+		// StatsD protocol.
+		Tags    map[string]string `json:"tags" jsonschema:"omitempty"`
+		StatsD  *StatsDSpec       `json:"statsd,omitempty" jsonschema:"omitempty"`
+		Datadog *DatadogSpec      `json:"datadog,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of MetricsExporter.
+	Status struct {
+		NumOfPoints int64  `json:"numOfPoints"`
+		NumOfErrors int64  `json:"numOfErrors"`
+		LastError   string `json:"lastError,omitempty"`
+	}
+
+	// sender sends the points to a backend, it is only called by the
+	// exporting goroutine.
+	sender interface {
+		send(points []*point) error
+		close()
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	switch spec.Backend {
+	case backendStatsD, backendDogStatsD:
+		if spec.StatsD == nil {
+			return fmt.Errorf("statsd is required for backend %s", spec.Backend)
+		}
+	case backendDatadog:
+		if spec.Datadog == nil {
+			return fmt.Errorf("datadog is required for backend %s", spec.Backend)
+		}
+	}
+
+	if spec.Interval != "" {
+		d, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s: %v", spec.Interval, err)
+		}
+		if d < statussynccontroller.SyncStatusPaceInUnixSeconds*time.Second {
+			return fmt.Errorf("interval must not be less than %ds", statussynccontroller.SyncStatusPaceInUnixSeconds)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of MetricsExporter.
+func (me *MetricsExporter) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of MetricsExporter.
+func (me *MetricsExporter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of MetricsExporter.
+func (me *MetricsExporter) DefaultSpec() interface{} {
+	return &Spec{
+		Interval: "10s",
+		Prefix:   "easegress",
+	}
+}
+
+// Init initializes MetricsExporter.
+func (me *MetricsExporter) Init(superSpec *supervisor.Spec) {
+	me.superSpec, me.spec, me.super = superSpec, superSpec.ObjectSpec().(*Spec), superSpec.Super()
+	me.reload()
+}
+
+// Inherit inherits previous generation of MetricsExporter.
+func (me *MetricsExporter) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	me.Init(superSpec)
+}
+
+func (me *MetricsExporter) reload() {
+	ssc, exists := me.super.GetSystemController(statussynccontroller.Kind)
+	if !exists {
+		logger.Errorf("BUG: status sync controller not found")
+		return
+	}
+	me.ssc = ssc.Instance().(*statussynccontroller.StatusSyncController)
+
+	me.interval, _ = time.ParseDuration(me.spec.Interval)
+	if me.interval <= 0 {
+		me.interval = 10 * time.Second
+	}
+	me.sender = me.newSender()
+
+	me.done = make(chan struct{})
+	me.wg.Add(1)
+	go me.run()
+}
+
+// tags returns the tags added to all metrics, the tags in the spec
+// override the default ones.
+func (me *MetricsExporter) tags() []tag {
+	m := map[string]string{
+		"cluster": me.super.Options().ClusterName,
+		"member":  me.super.Options().Name,
+	}
+	for k, v := range me.spec.Tags {
+		m[k] = v
+	}
+
+	tags := make([]tag, 0, len(m))
+	for k, v := range m {
+		tags = append(tags, tag{key: k, value: v})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].key < tags[j].key
+	})
+	return tags
+}
+
+func (me *MetricsExporter) newSender() sender {
+	prefix := me.spec.Prefix
+	if prefix == "" {
+		prefix = "easegress"
+	}
+
+	switch me.spec.Backend {
+	case backendStatsD:
+		return newStatsDSender(me.spec.StatsD, false, prefix, nil)
+	case backendDogStatsD:
+		return newStatsDSender(me.spec.StatsD, true, prefix, me.tags())
+	default:
+		return newDatadogSender(me.spec.Datadog, prefix, me.super.Options().Name, me.tags())
+	}
+}
+
+func (me *MetricsExporter) run() {
+	defer me.wg.Done()
+
+	ticker := time.NewTicker(me.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-me.done:
+			me.sender.close()
+			return
+		case <-ticker.C:
+			me.export(me.ssc.GetStatusSnapshots())
+		}
+	}
+}
+
+// export sends the latest snapshot if it has not been sent. The statistics
+// are cumulative or rates, so the earlier snapshots are skipped.
+func (me *MetricsExporter) export(snapshots []*statussynccontroller.StatusesSnapshot) {
+	if len(snapshots) == 0 {
+		return
+	}
+	snapshot := snapshots[len(snapshots)-1]
+	if snapshot.UnixTimestamp <= me.latestTimestamp {
+		return
+	}
+	me.latestTimestamp = snapshot.UnixTimestamp
+
+	var points []*point
+	for service, status := range snapshot.Statuses {
+		metricer, ok := status.ObjectStatus.(easemonitor.Metricer)
+		if !ok {
+			continue
+		}
+
+		for _, m := range metricer.ToMetrics(service) {
+			p, err := toPoints(snapshot.UnixTimestamp, m)
+			if err != nil {
+				logger.Errorf("%s: convert metrics of %s failed: %v", me.superSpec.Name(), service, err)
+				continue
+			}
+			points = append(points, p...)
+		}
+	}
+	if len(points) == 0 {
+		return
+	}
+
+	if err := me.sender.send(points); err != nil {
+		atomic.AddInt64(&me.numOfErrors, 1)
+		me.lastError.Store(err.Error())
+		logger.Errorf("%s: send metrics failed: %v", me.superSpec.Name(), err)
+		return
+	}
+	atomic.AddInt64(&me.numOfPoints, int64(len(points)))
+}
+
+// Status returns the status of MetricsExporter.
+func (me *MetricsExporter) Status() *supervisor.Status {
+	s := &Status{
+		NumOfPoints: atomic.LoadInt64(&me.numOfPoints),
+		NumOfErrors: atomic.LoadInt64(&me.numOfErrors),
+	}
+	if v := me.lastError.Load(); v != nil {
+		s.LastError = v.(string)
+	}
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes MetricsExporter.
+func (me *MetricsExporter) Close() {
+	if me.done == nil {
+		return
+	}
+	close(me.done)
+	me.wg.Wait()
+}
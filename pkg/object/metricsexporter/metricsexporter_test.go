@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/statussynccontroller"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type mockSender struct {
+	points []*point
+	err    error
+}
+
+func (s *mockSender) send(points []*point) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.points = append(s.points, points...)
+	return nil
+}
+
+func (s *mockSender) close() {}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Backend: backendStatsD}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Backend: backendDatadog, StatsD: &StatsDSpec{Address: "127.0.0.1:8125"}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Backend: backendDogStatsD, StatsD: &StatsDSpec{Address: "127.0.0.1:8125"}, Interval: "1s"}
+	assert.Error(spec.Validate())
+
+	spec.Interval = "30s"
+	assert.NoError(spec.Validate())
+
+	_, err := supervisor.NewSpec(`
+kind: MetricsExporter
+name: exporter
+backend: datadog
+`)
+	assert.Error(err)
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+
+	superSpec, err := supervisor.NewSpec(`
+kind: MetricsExporter
+name: exporter
+backend: statsd
+statsd:
+  address: 127.0.0.1:8125
+`)
+	assert.NoError(err)
+
+	sender := &mockSender{}
+	me := &MetricsExporter{superSpec: superSpec, sender: sender}
+
+	snapshot := func(ts int64, count uint64) *statussynccontroller.StatusesSnapshot {
+		return &statussynccontroller.StatusesSnapshot{
+			UnixTimestamp: ts,
+			Statuses: map[string]*supervisor.Status{
+				"pipeline-demo": {ObjectStatus: &httpstat.Status{RequestMetric: httpstat.RequestMetric{Count: count}}},
+				"other":         {ObjectStatus: "not a metricer"},
+			},
+		}
+	}
+
+	me.export(nil)
+	assert.Empty(sender.points)
+
+	me.export([]*statussynccontroller.StatusesSnapshot{snapshot(5, 1), snapshot(10, 2)})
+	assert.NotEmpty(sender.points)
+	for _, p := range sender.points {
+		assert.Equal(int64(10), p.timestamp)
+		if p.name == "http_request.count" {
+			assert.Equal(2.0, p.value)
+		}
+	}
+	sent := len(sender.points)
+
+	// the snapshot has been sent.
+	me.export([]*statussynccontroller.StatusesSnapshot{snapshot(10, 2)})
+	assert.Len(sender.points, sent)
+
+	sender.err = fmt.Errorf("mock error")
+	me.export([]*statussynccontroller.StatusesSnapshot{snapshot(15, 3)})
+	status := me.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(sent), status.NumOfPoints)
+	assert.Equal(int64(1), status.NumOfErrors)
+	assert.Equal("mock error", status.LastError)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/easemonitor"
+)
+
+// tagFields are the numeric fields of the metrics which identify the
+// metrics rather than measure something, they are converted to tags.
+var tagFields = map[string]bool{
+	"code": true,
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_\-]+`)
+
+type (
+	// tag is a tag of a point.
+	tag struct {
+		key   string
+		value string
+	}
+
+	// point is a gauge value at a point in time, the name is
+	// <type>.<field> and the prefix is added by the senders.
+	point struct {
+		name      string
+		value     float64
+		timestamp int64
+		tags      []tag
+	}
+)
+
+// toPoints converts EaseMonitor metrics to points. Every numeric field of
+// the metrics is converted to a point, and the service, resource, url and
+// the string fields are converted to tags.
+func toPoints(timestamp int64, m *easemonitor.Metrics) ([]*point, error) {
+	fields, err := codectool.StructToMap(m.OtherFields)
+	if err != nil {
+		return nil, err
+	}
+
+	typ := strings.ReplaceAll(strings.TrimPrefix(m.Type, "eg-"), "-", "_")
+
+	var tags []tag
+	addTag := func(key, value string) {
+		if value != "" {
+			tags = append(tags, tag{key: key, value: value})
+		}
+	}
+	addTag("service", m.Service)
+	addTag("resource", m.Resource)
+	addTag("url", m.URL)
+
+	values := make(map[string]float64)
+	for k, v := range fields {
+		// numbers are always decoded as float64.
+		f, ok := v.(float64)
+		switch {
+		case ok && !tagFields[k]:
+			values[k] = f
+		case ok:
+			addTag(k, fmt.Sprint(v))
+		default:
+			if s, ok := v.(string); ok {
+				addTag(k, s)
+			}
+		}
+	}
+
+	points := make([]*point, 0, len(values))
+	for k, v := range values {
+		points = append(points, &point{
+			name:      typ + "." + k,
+			value:     v,
+			timestamp: timestamp,
+			tags:      tags,
+		})
+	}
+
+	// sort for stable output.
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].name < points[j].name
+	})
+	return points, nil
+}
+
+// sanitize replaces the characters which are not allowed in a metric name.
+func sanitize(s string) string {
+	return invalidNameChars.ReplaceAllString(s, "_")
+}
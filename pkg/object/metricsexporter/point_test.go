@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+)
+
+func TestToPoints(t *testing.T) {
+	assert := assert.New(t)
+
+	status := &httpstat.Status{
+		RequestMetric: httpstat.RequestMetric{Count: 10, ErrCount: 2, P99: 12.5},
+		Codes:         map[int]uint64{200: 8},
+	}
+	metrics := status.ToMetrics("pipeline-demo/proxy")
+	assert.Len(metrics, 2)
+
+	points, err := toPoints(100, metrics[0])
+	assert.NoError(err)
+	byName := map[string]*point{}
+	for _, p := range points {
+		byName[p.name] = p
+	}
+	assert.Equal(10.0, byName["http_request.count"].value)
+	assert.Equal(2.0, byName["http_request.errCount"].value)
+	assert.Equal(12.5, byName["http_request.p99"].value)
+	assert.Equal(int64(100), byName["http_request.count"].timestamp)
+	assert.Equal([]tag{{key: "service", value: "pipeline-demo/proxy"}}, byName["http_request.count"].tags)
+
+	// the code is a tag rather than a value.
+	points, err = toPoints(100, metrics[1])
+	assert.NoError(err)
+	assert.Len(points, 1)
+	assert.Equal("http_status_code.cnt", points[0].name)
+	assert.Equal(8.0, points[0].value)
+	assert.Contains(points[0].tags, tag{key: "code", value: "200"})
+}
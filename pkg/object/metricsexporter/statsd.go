@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxStatsDPacketSize keeps the UDP packets under the common MTU.
+	maxStatsDPacketSize = 1432
+	statsDDialTimeout   = 5 * time.Second
+)
+
+type (
+	// StatsDSpec describes a StatsD or DogStatsD server.
+	StatsDSpec struct {
+		Network string `json:"network" jsonschema:"omitempty,enum=,enum=udp,enum=tcp,enum=unixgram"`
+		Address string `json:"address" jsonschema:"required"`
+	}
+
+	// statsDSender sends the points as gauges. The plain StatsD protocol
+	// has no tags, so the tags of the points are folded into the names,
+	// while DogStatsD sends them as tags.
+	statsDSender struct {
+		network string
+		address string
+		dog     bool
+		prefix  string
+		tags    []tag
+
+		conn net.Conn
+	}
+)
+
+func newStatsDSender(spec *StatsDSpec, dog bool, prefix string, tags []tag) *statsDSender {
+	s := &statsDSender{
+		network: spec.Network,
+		address: spec.Address,
+		dog:     dog,
+		prefix:  prefix,
+		tags:    tags,
+	}
+	if s.network == "" {
+		s.network = "udp"
+	}
+	return s
+}
+
+func (s *statsDSender) line(buf *bytes.Buffer, p *point) {
+	buf.WriteString(s.prefix)
+	buf.WriteByte('.')
+	if !s.dog {
+		// <prefix>.<tag values>.<type>.<field>
+		for _, t := range p.tags {
+			buf.WriteString(sanitize(t.value))
+			buf.WriteByte('.')
+		}
+	}
+	buf.WriteString(p.name)
+
+	buf.WriteByte(':')
+	buf.WriteString(strconv.FormatFloat(p.value, 'f', -1, 64))
+	buf.WriteString("|g")
+
+	if s.dog && len(p.tags)+len(s.tags) > 0 {
+		buf.WriteString("|#")
+		for i, t := range append(p.tags[:len(p.tags):len(p.tags)], s.tags...) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(t.key)
+			buf.WriteByte(':')
+			buf.WriteString(t.value)
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+func (s *statsDSender) send(points []*point) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, statsDDialTimeout)
+		if err != nil {
+			return fmt.Errorf("connect to %s failed: %v", s.address, err)
+		}
+		s.conn = conn
+	}
+
+	var packet, line bytes.Buffer
+	for _, p := range points {
+		line.Reset()
+		s.line(&line, p)
+		if packet.Len() > 0 && packet.Len()+line.Len() > maxStatsDPacketSize {
+			if err := s.write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		packet.Write(line.Bytes())
+	}
+	if packet.Len() == 0 {
+		return nil
+	}
+	return s.write(packet.Bytes())
+}
+
+// write writes a packet, the connection is reset on failures, so that it
+// is recreated in the next round.
+func (s *statsDSender) write(packet []byte) error {
+	_, err := s.conn.Write(packet)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("write to %s failed: %v", s.address, err)
+	}
+	return nil
+}
+
+func (s *statsDSender) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
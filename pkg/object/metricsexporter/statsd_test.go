@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metricsexporter
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPoints() []*point {
+	return []*point{
+		{
+			name:  "http_request.count",
+			value: 10,
+			tags:  []tag{{key: "service", value: "pipeline-demo/proxy"}},
+		},
+		{
+			name:  "http_request.p99",
+			value: 12.5,
+			tags:  []tag{{key: "service", value: "pipeline-demo/proxy"}},
+		},
+	}
+}
+
+func receiveStatsD(t *testing.T, dog bool, tags []tag) []string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := newStatsDSender(&StatsDSpec{Address: conn.LocalAddr().String()}, dog, "easegress", tags)
+	defer s.close()
+	if err := s.send(testPoints()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxStatsDPacketSize)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(buf[:n])), "\n")
+}
+
+func TestStatsD(t *testing.T) {
+	assert := assert.New(t)
+
+	lines := receiveStatsD(t, false, nil)
+	assert.Equal([]string{
+		"easegress.pipeline-demo_proxy.http_request.count:10|g",
+		"easegress.pipeline-demo_proxy.http_request.p99:12.5|g",
+	}, lines)
+}
+
+func TestDogStatsD(t *testing.T) {
+	assert := assert.New(t)
+
+	lines := receiveStatsD(t, true, []tag{{key: "env", value: "prod"}})
+	assert.Equal([]string{
+		"easegress.http_request.count:10|g|#service:pipeline-demo/proxy,env:prod",
+		"easegress.http_request.p99:12.5|g|#service:pipeline-demo/proxy,env:prod",
+	}, lines)
+}
+
+func TestStatsDPacketSize(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+
+	var points []*point
+	for i := 0; i < 100; i++ {
+		points = append(points, testPoints()...)
+	}
+	s := newStatsDSender(&StatsDSpec{Address: conn.LocalAddr().String()}, false, "easegress", nil)
+	defer s.close()
+	assert.NoError(s.send(points))
+
+	lines := 0
+	buf := make([]byte, 65536)
+	for lines < len(points) {
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(err)
+		assert.LessOrEqual(n, maxStatsDPacketSize)
+		lines += strings.Count(string(buf[:n]), "\n")
+	}
+	assert.Equal(len(points), lines)
+}
@@ -19,8 +19,10 @@ package mqttproxy
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/http"
@@ -37,6 +39,7 @@ import (
 	"github.com/megaease/easegress/pkg/protocols/mqttprot"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/workerpool"
 	"github.com/openzipkin/zipkin-go/model"
 	"github.com/openzipkin/zipkin-go/propagation/b3"
 )
@@ -60,6 +63,17 @@ type (
 		connectionLimiter *Limiter
 		memberURL         func(string, string) ([]string, error)
 
+		// sharedCh notifies changes of shared subscriptions, and
+		// sharedCursors are the round robin cursors of shared subscriptions.
+		sharedCh      chan struct{}
+		sharedMu      sync.Mutex
+		sharedCursors map[string]uint64
+
+		// workers are shared by the clients to write packets and resend
+		// pending messages, nil means every client has its own goroutines.
+		workers      *workerpool.Pool
+		writeTimeout time.Duration
+
 		// done is the channel for shutdowning this proxy.
 		done      chan struct{}
 		closeFlag int32
@@ -72,6 +86,10 @@ type (
 		Payload     string `json:"payload"`
 		Base64      bool   `json:"base64"`
 		Distributed bool   `json:"distributed"`
+		// SharedTargets maps shared subscriptions to the clients chosen to
+		// receive the message, it is set by the member which receives the
+		// message first and transferred to other members.
+		SharedTargets map[string]SharedTarget `json:"sharedTargets"`
 	}
 
 	// HTTPSessions is json data used for session related operations, like get all sessions and delete some sessions
@@ -101,23 +119,25 @@ func getPipelineMap(spec *Spec) (map[PacketType]string, error) {
 	}
 
 	if _, ok := ans[Publish]; !ok {
-		logger.Warnf("no pipeline for publish packet type to send MQTT message to backend")
+		logger.MQTT.Warnf("no pipeline for publish packet type to send MQTT message to backend")
 	}
 	if _, ok := ans[Connect]; !ok {
-		logger.Warnf("no pipeline for connect packet type to check username and password of MQTT client")
+		logger.MQTT.Warnf("no pipeline for connect packet type to check username and password of MQTT client")
 	}
 	return ans, nil
 }
 
 func newBroker(spec *Spec, store storage, muxMapper context.MuxMapper, memberURL func(string, string) ([]string, error)) *Broker {
 	broker := &Broker{
-		egName:    spec.EGName,
-		name:      spec.Name,
-		spec:      spec,
-		clients:   make(map[string]*Client),
-		memberURL: memberURL,
-		done:      make(chan struct{}),
-		muxMapper: muxMapper,
+		egName:        spec.EGName,
+		name:          spec.Name,
+		spec:          spec,
+		clients:       make(map[string]*Client),
+		memberURL:     memberURL,
+		done:          make(chan struct{}),
+		muxMapper:     muxMapper,
+		sharedCh:      make(chan struct{}, 1),
+		sharedCursors: make(map[string]uint64),
 	}
 	pipelines, err := getPipelineMap(spec)
 	if err != nil {
@@ -127,20 +147,41 @@ func newBroker(spec *Spec, store storage, muxMapper context.MuxMapper, memberURL
 
 	err = broker.setListener()
 	if err != nil {
-		logger.SpanErrorf(nil, "mqtt broker set listener failed: %v", err)
+		logger.MQTT.SpanErrorf(nil, "mqtt broker set listener failed: %v", err)
 		return nil
 	}
 
 	if spec.TopicCacheSize <= 0 {
 		spec.TopicCacheSize = 100000
 	}
+	if spec.TopicAliasMaximum == 0 {
+		spec.TopicAliasMaximum = defaultTopicAliasMaximum
+	}
+	if spec.WriteQueueSize <= 0 {
+		spec.WriteQueueSize = defaultWriteQueueSize
+	}
+	if wp := spec.WorkerPool; wp != nil {
+		if wp.Workers <= 0 {
+			wp.Workers = defaultWorkers
+		}
+		if wp.QueueSize <= 0 {
+			wp.QueueSize = defaultWorkerQueueSize
+		}
+		broker.workers = workerpool.New(wp.Workers, wp.QueueSize)
+		broker.writeTimeout = wp.writeTimeout()
+	}
 	broker.topicMgr = newTopicManager(spec.TopicCacheSize)
+	broker.topicMgr.sharedChanged = broker.notifySharedChanged
 	broker.sessMgr = newSessionManager(broker, store)
 	broker.connectionLimiter = newLimiter(spec.ConnectionLimit)
 	go broker.run()
+	go broker.syncSharedSubscriptions()
+	if broker.workers != nil {
+		go broker.resendPending()
+	}
 	ch, closeFunc, err := broker.sessMgr.store.watchDelete(sessionStoreKey(""))
 	if err != nil {
-		logger.SpanErrorf(nil, "get watcher for session failed, %v", err)
+		logger.MQTT.SpanErrorf(nil, "get watcher for session failed, %v", err)
 	}
 	if ch != nil {
 		go broker.watchDelete(ch, closeFunc)
@@ -180,7 +221,7 @@ func (b *Broker) reconnectWatcher() {
 
 	ch, cancelFunc, err := b.sessMgr.store.watchDelete(sessionStoreKey(""))
 	if err != nil {
-		logger.SpanErrorf(nil, "get watcher for session failed, %v", err)
+		logger.MQTT.SpanErrorf(nil, "get watcher for session failed, %v", err)
 		time.Sleep(10 * time.Second)
 		go b.reconnectWatcher()
 		return
@@ -190,7 +231,7 @@ func (b *Broker) reconnectWatcher() {
 	// check event during reconnect
 	sessions, err := b.sessMgr.store.getPrefix(sessionStoreKey(""), true)
 	if err != nil {
-		logger.SpanErrorf(nil, "get all session prefix failed, %v", err)
+		logger.MQTT.SpanErrorf(nil, "get all session prefix failed, %v", err)
 	}
 
 	clients := []*Client{}
@@ -223,7 +264,7 @@ func (b *Broker) watchDelete(ch <-chan map[string]*string, closeFunc func()) {
 					continue
 				}
 				clientID := strings.TrimPrefix(k, sessionStoreKey(""))
-				logger.SpanDebugf(nil, "client %v recv delete watch %v", clientID, v)
+				logger.MQTT.SpanDebugf(nil, "client %v recv delete watch %v", clientID, v)
 				go b.deleteSession(clientID)
 			}
 		}
@@ -235,7 +276,7 @@ func (b *Broker) deleteSession(clientID string) {
 	defer b.Unlock()
 	if c, ok := b.clients[clientID]; ok {
 		if !c.disconnected() {
-			logger.SpanDebugf(nil, "broker watch and delete client %v", c.info.cid)
+			logger.MQTT.SpanDebugf(nil, "broker watch and delete client %v", c.info.cid)
 			c.close()
 		}
 	}
@@ -279,19 +320,23 @@ func (b *Broker) checkConnectPermission(connect *packets.ConnectPacket) bool {
 func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.Conn) (*Client, *packets.ConnackPacket, bool) {
 	connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
 	connack.SessionPresent = connect.CleanSession
-	connack.ReturnCode = connect.Validate()
+	if connect.ProtocolVersion == protocolVersion5 {
+		connack.ReturnCode = validateConnectV5(connect)
+	} else {
+		connack.ReturnCode = connect.Validate()
+	}
 	if connack.ReturnCode != packets.Accepted {
-		err := connack.Write(conn)
-		logger.SpanErrorf(nil, "invalid connection %v, write connack failed: %s", connack.ReturnCode, err)
+		err := writeConnack(conn, connect, connack, nil)
+		logger.MQTT.SpanErrorf(nil, "invalid connection %v, write connack failed: %s", connack.ReturnCode, err)
 		return nil, nil, false
 	}
 	// check rate limiter and max allowed connection
 	if !b.checkConnectPermission(connect) {
-		logger.SpanDebugf(nil, "client %v not get connect permission from rate limiter", connect.ClientIdentifier)
+		logger.MQTT.SpanDebugf(nil, "client %v not get connect permission from rate limiter", connect.ClientIdentifier)
 		connack.ReturnCode = packets.ErrRefusedServerUnavailable
-		err := connack.Write(conn)
+		err := writeConnack(conn, connect, connack, nil)
 		if err != nil {
-			logger.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
+			logger.MQTT.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
 		}
 		return nil, nil, false
 	}
@@ -304,25 +349,25 @@ func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.C
 	if ok {
 		pipe, ok := b.muxMapper.GetHandler(authPipeline)
 		if !ok {
-			logger.SpanErrorf(nil, "get pipeline %v failed", authPipeline)
+			logger.MQTT.SpanErrorf(nil, "get pipeline %v failed", authPipeline)
 			authFail = true
 		} else {
 			ctx := newContext(connect, client)
 			pipe.Handle(ctx)
 			res := ctx.GetResponse(context.DefaultNamespace).(*mqttprot.Response)
 			if res.Disconnect() {
-				logger.SpanErrorf(nil, "client %v not get connect permission from pipeline", connect.ClientIdentifier)
+				logger.MQTT.SpanErrorf(nil, "client %v not get connect permission from pipeline", connect.ClientIdentifier)
 				authFail = true
 			}
 		}
 	}
 	if authFail {
 		connack.ReturnCode = packets.ErrRefusedNotAuthorised
-		err := connack.Write(conn)
+		err := writeConnack(conn, connect, connack, nil)
 		if err != nil {
-			logger.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
+			logger.MQTT.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
 		}
-		logger.SpanErrorf(nil, "invalid connection %v, client %s auth failed", connack.ReturnCode, connect.ClientIdentifier)
+		logger.MQTT.SpanErrorf(nil, "invalid connection %v, client %s auth failed", connack.ReturnCode, connect.ClientIdentifier)
 		return nil, nil, false
 	}
 	return client, connack, true
@@ -330,17 +375,28 @@ func (b *Broker) connectionValidation(connect *packets.ConnectPacket, conn net.C
 
 func (b *Broker) handleConn(conn net.Conn) {
 	defer conn.Close()
-	packet, err := packets.ReadPacket(conn)
+	packet, err := readFirstPacket(conn)
 	if err != nil {
-		logger.SpanErrorf(nil, "read connect packet failed: %s", err)
+		logger.MQTT.SpanErrorf(nil, "read connect packet failed: %s", err)
 		return
 	}
+	var props properties
+	if pv, ok := packet.(*packetV5); ok {
+		packet, props = pv.ControlPacket, pv.props
+	}
 	connect, ok := packet.(*packets.ConnectPacket)
 	if !ok {
-		logger.SpanErrorf(nil, "first packet received %s that was not Connect", packet.String())
+		logger.MQTT.SpanErrorf(nil, "first packet received %s that was not Connect", packet.String())
 		return
 	}
-	logger.SpanDebugf(nil, "connection from client %s", connect.ClientIdentifier)
+	logger.MQTT.SpanDebugf(nil, "connection from client %s", connect.ClientIdentifier)
+
+	v5 := connect.ProtocolVersion == protocolVersion5
+	assignedID := ""
+	if v5 && connect.ClientIdentifier == "" {
+		assignedID = newClientID()
+		connect.ClientIdentifier = assignedID
+	}
 
 	client, connack, valid := b.connectionValidation(connect, conn)
 	if !valid {
@@ -350,16 +406,16 @@ func (b *Broker) handleConn(conn net.Conn) {
 
 	b.Lock()
 	if oldClient, ok := b.clients[cid]; ok {
-		logger.SpanDebugf(nil, "client %v take over by new client with same name", oldClient.info.cid)
-		go oldClient.close()
+		logger.MQTT.SpanDebugf(nil, "client %v take over by new client with same name", oldClient.info.cid)
+		go oldClient.disconnect(reasonSessionTakenOver)
 
 	} else if b.spec.MaxAllowedConnection > 0 {
 		if len(b.clients) >= b.spec.MaxAllowedConnection {
-			logger.SpanDebugf(nil, "client %v not get connect permission from rate limiter", connect.ClientIdentifier)
+			logger.MQTT.SpanDebugf(nil, "client %v not get connect permission from rate limiter", connect.ClientIdentifier)
 			connack.ReturnCode = packets.ErrRefusedServerUnavailable
-			err = connack.Write(conn)
+			err = writeConnack(conn, connect, connack, nil)
 			if err != nil {
-				logger.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
+				logger.MQTT.SpanErrorf(nil, "connack back to client %s failed: %s", connect.ClientIdentifier, err)
 			}
 			b.Unlock()
 			return
@@ -369,9 +425,17 @@ func (b *Broker) handleConn(conn net.Conn) {
 	b.Unlock()
 
 	b.setSession(client, connect)
-	err = connack.Write(conn)
+	var connackProps properties
+	if v5 {
+		requested, _ := props.uint32(propSessionExpiryInterval)
+		granted := b.limitSessionExpiry(requested)
+		b.sessMgr.cancelExpiry(cid)
+		client.session.setExpiry(granted)
+		connackProps = b.connackProperties(requested, granted, assignedID)
+	}
+	err = writeConnack(conn, connect, connack, connackProps)
 	if err != nil {
-		logger.SpanErrorf(nil, "send connack to client %s failed: %s", connect.ClientIdentifier, err)
+		logger.MQTT.SpanErrorf(nil, "send connack to client %s failed: %s", connect.ClientIdentifier, err)
 		return
 	}
 
@@ -380,13 +444,63 @@ func (b *Broker) handleConn(conn net.Conn) {
 	if len(topics) > 0 {
 		err = b.topicMgr.subscribe(topics, qoss, client.info.cid)
 		if err != nil {
-			logger.SpanErrorf(nil, "client %v use previous session topics %v to subscribe failed: %v", client.info.cid, topics, err)
+			logger.MQTT.SpanErrorf(nil, "client %v use previous session topics %v to subscribe failed: %v", client.info.cid, topics, err)
 		}
 	}
-	go client.writeLoop()
+	if b.workers == nil {
+		go client.writeLoop()
+	}
 	client.readLoop()
 }
 
+// limitSessionExpiry limits the session expiry interval requested by MQTT 5.0
+// clients by the spec.
+func (b *Broker) limitSessionExpiry(interval uint32) uint32 {
+	if b.spec.MaxSessionExpiryInterval > 0 && interval > b.spec.MaxSessionExpiryInterval {
+		return b.spec.MaxSessionExpiryInterval
+	}
+	return interval
+}
+
+// connackProperties returns the properties of CONNACK sent to MQTT 5.0
+// clients, which tell the clients the features supported by the broker.
+func (b *Broker) connackProperties(requestedExpiry, grantedExpiry uint32, assignedID string) properties {
+	props := properties{}
+	props.add(propTopicAliasMaximum, b.spec.TopicAliasMaximum)
+	props.add(propMaximumQoS, QoS1)
+	props.add(propRetainAvailable, byte(0))
+	props.add(propSubscriptionIdentifierAvailable, byte(0))
+	props.add(propSharedSubscriptionAvailable, byte(1))
+	if grantedExpiry != requestedExpiry {
+		props.add(propSessionExpiryInterval, grantedExpiry)
+	}
+	if assignedID != "" {
+		props.add(propAssignedClientIdentifier, assignedID)
+	}
+	return props
+}
+
+// writeConnack writes CONNACK in the protocol version of the client.
+func writeConnack(conn net.Conn, connect *packets.ConnectPacket, connack *packets.ConnackPacket, props properties) error {
+	if connect.ProtocolVersion != protocolVersion5 {
+		return connack.Write(conn)
+	}
+	pv := &packetV5{
+		ControlPacket: connack,
+		reasonCode:    connackReasonCodes[connack.ReturnCode],
+		props:         props,
+	}
+	return writePacketV5(conn, pv)
+}
+
+// newClientID generates the client identifier assigned to MQTT 5.0 clients
+// which connect with an empty one.
+func newClientID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "auto-" + hex.EncodeToString(b)
+}
+
 func (b *Broker) setSession(client *Client, connect *packets.ConnectPacket) {
 	// when clean session is false, previous session exist and previous session not clean session,
 	// then we use previous session, otherwise use new session
@@ -404,36 +518,36 @@ func (b *Broker) setSession(client *Client, connect *packets.ConnectPacket) {
 func (b *Broker) requestTransfer(span *model.SpanContext, egName, name string, data HTTPJsonData, header http.Header) {
 	urls, err := b.memberURL(egName, name)
 	if err != nil {
-		logger.SpanErrorf(span, "eg %v find urls for other egs failed:%v", b.egName, err)
+		logger.MQTT.SpanErrorf(span, "eg %v find urls for other egs failed:%v", b.egName, err)
 		return
 	}
 	jsonData, err := codectool.MarshalJSON(data)
 	if err != nil {
-		logger.SpanErrorf(span, "json data marshal failed: %v", err)
+		logger.MQTT.SpanErrorf(span, "json data marshal failed: %v", err)
 		return
 	}
 	for _, url := range urls {
 		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(jsonData))
 		req.Header = header.Clone()
 		if err != nil {
-			logger.SpanErrorf(span, "make new request failed: %v", err)
+			logger.MQTT.SpanErrorf(span, "make new request failed: %v", err)
 			continue
 		}
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			logger.SpanErrorf(span, "http client send msg failed:%v", err)
+			logger.MQTT.SpanErrorf(span, "http client send msg failed:%v", err)
 		} else {
 			resp.Body.Close()
 		}
 	}
-	logger.SpanDebugf(span, "eg %v http transfer data %v to %v", b.egName, data, urls)
+	logger.MQTT.SpanDebugf(span, "eg %v http transfer data %v to %v", b.egName, data, urls)
 }
 
 func (b *Broker) sendMsgToClient(span *model.SpanContext, topic string, payload []byte, qos byte) {
 	subscribers, _ := b.topicMgr.findSubscribers(topic)
-	logger.SpanDebugf(span, "eg %v send topic %v to client %v", b.egName, topic, subscribers)
+	logger.MQTT.SpanDebugf(span, "eg %v send topic %v to client %v", b.egName, topic, subscribers)
 	if subscribers == nil {
-		logger.SpanErrorf(span, "eg %v not find subscribers for topic %s", b.egName, topic)
+		logger.MQTT.SpanErrorf(span, "eg %v not find subscribers for topic %s", b.egName, topic)
 		return
 	}
 
@@ -443,7 +557,7 @@ func (b *Broker) sendMsgToClient(span *model.SpanContext, topic string, payload
 		}
 		client := b.getClient(clientID)
 		if client == nil {
-			logger.SpanDebugf(span, "client %v not on broker %v in eg %v", clientID, b.name, b.egName)
+			logger.MQTT.SpanDebugf(span, "client %v not on broker %v in eg %v", clientID, b.name, b.egName)
 		} else {
 			client.session.publish(span, topic, payload, qos)
 		}
@@ -496,13 +610,17 @@ func (b *Broker) httpTopicsPublishHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	span, _ := b3.ExtractHTTP(r)()
-	logger.SpanDebugf(span, "http endpoint received json data: %v", data)
+	logger.MQTT.SpanDebugf(span, "http endpoint received json data: %v", data)
 	if !data.Distributed {
 		data.Distributed = true
+		data.SharedTargets = b.sharedTargets(span, data.Topic)
 		headers := r.Header.Clone()
 		b.requestTransfer(span, b.egName, b.name, data, headers)
 	}
-	go b.sendMsgToClient(span, data.Topic, payload, byte(data.QoS))
+	go func() {
+		b.sendMsgToSharedClients(span, data.Topic, payload, byte(data.QoS), data.SharedTargets)
+		b.sendMsgToClient(span, data.Topic, payload, byte(data.QoS))
+	}()
 }
 
 func (b *Broker) mqttAPIPrefix(path string) string {
@@ -515,7 +633,7 @@ func (b *Broker) httpGetAllSessionHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	span, _ := b3.ExtractHTTP(r)()
-	logger.SpanDebugf(span, "http endpoint receive request to get all session")
+	logger.MQTT.SpanDebugf(span, "http endpoint receive request to get all session")
 
 	query := r.URL.Query()
 	page := 0
@@ -543,9 +661,9 @@ func (b *Broker) httpGetAllSessionHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	allSession, err := b.sessMgr.store.getPrefix(sessionStoreKey(""), false)
-	logger.SpanDebugf(span, "httpGetAllSessionHandler current total %v sessions, query %v, topic %v", len(allSession), []int{page, pageSize}, topic)
+	logger.MQTT.SpanDebugf(span, "httpGetAllSessionHandler current total %v sessions, query %v, topic %v", len(allSession), []int{page, pageSize}, topic)
 	if err != nil {
-		logger.SpanErrorf(span, "get all sessions with prefix %v failed, %v", sessionStoreKey(""), err)
+		logger.MQTT.SpanErrorf(span, "get all sessions with prefix %v failed, %v", sessionStoreKey(""), err)
 		api.HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("get all sessions failed, %v", err))
 		return
 	}
@@ -554,13 +672,13 @@ func (b *Broker) httpGetAllSessionHandler(w http.ResponseWriter, r *http.Request
 
 	jsonData, err := codectool.MarshalJSON(res)
 	if err != nil {
-		logger.SpanErrorf(span, "all session data json marshal failed, %v", err)
+		logger.MQTT.SpanErrorf(span, "all session data json marshal failed, %v", err)
 		api.HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("all sessions json marshal failed, %v", err))
 		return
 	}
 	_, err = w.Write(jsonData)
 	if err != nil {
-		logger.SpanErrorf(span, "write json data to http response writer failed, %v", err)
+		logger.MQTT.SpanErrorf(span, "write json data to http response writer failed, %v", err)
 		api.HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("write json data failed"))
 	}
 }
@@ -617,11 +735,11 @@ func (b *Broker) httpDeleteSessionHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	span, _ := b3.ExtractHTTP(r)()
-	logger.SpanDebugf(span, "http endpoint received delete session data: %v", data)
+	logger.MQTT.SpanDebugf(span, "http endpoint received delete session data: %v", data)
 	for _, s := range data.Sessions {
 		err := b.sessMgr.store.delete(sessionStoreKey(s.SessionID))
 		if err != nil {
-			logger.SpanErrorf(span, "delete session %v failed, %v", s, err)
+			logger.MQTT.SpanErrorf(span, "delete session %v failed, %v", s, err)
 		}
 	}
 }
@@ -670,6 +788,33 @@ func (b *Broker) close() {
 		go v.closeAndDelSession()
 	}
 	b.clients = nil
+
+	if b.workers != nil {
+		b.workers.Close()
+	}
+}
+
+// resendPending resends the pending messages of the sessions periodically
+// by the workers, it replaces the resending goroutines of the sessions
+// when the worker pool is enabled.
+func (b *Broker) resendPending() {
+	ticker := time.NewTicker(resendInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.sessMgr.sessionMap.Range(func(_, v interface{}) bool {
+				s := v.(*Session)
+				if s.hasPending() {
+					return b.workers.Submit(s.doResend)
+				}
+				return true
+			})
+		}
+	}
 }
 
 func newContext(packet packets.ControlPacket, client mqttprot.Client) *context.Context {
@@ -19,6 +19,7 @@ package mqttproxy
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"reflect"
 	"sync"
@@ -63,9 +64,9 @@ var processPacketMap = map[string]processFnWithErr{
 	"*packets.PubackPacket":      nilErrWrapper(processPuback),
 	"*packets.PublishPacket": func(c *Client, packet packets.ControlPacket) error {
 		publish := packet.(*packets.PublishPacket)
-		logger.SpanDebugf(nil, "client %s process publish %v", c.info.cid, publish.TopicName)
+		logger.MQTT.SpanDebugf(nil, "client %s process publish %v", c.info.cid, publish.TopicName)
 		if !c.checkPublishLimit(publish) {
-			logger.SpanErrorf(nil, "client %v publish limiter drop packet %v", c.info.cid, publish.TopicName)
+			logger.MQTT.SpanErrorf(nil, "client %v publish limiter drop packet %v", c.info.cid, publish.TopicName)
 			return nil
 		}
 		return pipelineWrapper(processPublish, Publish)(c, packet)
@@ -80,6 +81,7 @@ type (
 		password  string
 		keepalive uint16
 		will      *packets.PublishPacket
+		version   byte
 	}
 
 	// Client represents a MQTT client connection in Broker
@@ -94,7 +96,14 @@ type (
 		info       ClientInfo
 		statusFlag int32
 		writeCh    chan packets.ControlPacket
+		writeLock  sync.Mutex
 		done       chan struct{}
+		// writing is 1 if the packets are being written by a worker.
+		writing int32
+
+		// topicAliases and disconnectReason are used by MQTT 5.0 clients.
+		topicAliases     map[uint16]string
+		disconnectReason byte
 
 		// kv map is used for pipeline to share messages among filters during whole connection
 		kvMap sync.Map
@@ -139,21 +148,28 @@ func newClient(connect *packets.ConnectPacket, broker *Broker, conn net.Conn, li
 		will.Dup = connect.Dup
 	}
 
+	writeQueueSize := defaultWriteQueueSize
+	if broker != nil && broker.spec.WriteQueueSize > 0 {
+		writeQueueSize = broker.spec.WriteQueueSize
+	}
+
 	info := ClientInfo{
 		cid:       connect.ClientIdentifier,
 		username:  connect.Username,
 		password:  string(connect.Password),
 		keepalive: connect.Keepalive,
 		will:      will,
+		version:   connect.ProtocolVersion,
 	}
 	client := &Client{
 		broker:       broker,
 		conn:         conn,
 		info:         info,
 		statusFlag:   Connected,
-		writeCh:      make(chan packets.ControlPacket, 50),
+		writeCh:      make(chan packets.ControlPacket, writeQueueSize),
 		done:         make(chan struct{}),
 		publishLimit: newLimiter(limitSpec),
+		topicAliases: make(map[uint16]string),
 	}
 	return client
 }
@@ -177,28 +193,87 @@ func (c *Client) readLoop() {
 
 		if keepAlive > 0 {
 			if err := c.conn.SetDeadline(time.Now().Add(timeOut)); err != nil {
-				logger.SpanErrorf(nil, "set read timeout failed: %s", c.info.cid)
+				logger.MQTT.SpanErrorf(nil, "set read timeout failed: %s", c.info.cid)
 			}
 		}
 
-		logger.SpanDebugf(nil, "client %s readLoop read packet", c.info.cid)
-		packet, err := packets.ReadPacket(c.conn)
+		logger.MQTT.SpanDebugf(nil, "client %s readLoop read packet", c.info.cid)
+		packet, err := c.readPacket()
 		if err != nil {
-			logger.SpanErrorf(nil, "client %s read packet failed: %v", c.info.cid, err)
+			logger.MQTT.SpanErrorf(nil, "client %s read packet failed: %v", c.info.cid, err)
 			return
 		}
 		if _, ok := packet.(*packets.DisconnectPacket); ok {
-			c.info.will = nil
+			if c.disconnectReason != reasonDisconnectWithWill {
+				c.info.will = nil
+			}
 			return
 		}
 		err = c.processPacket(packet)
 		if err != nil {
-			logger.SpanErrorf(nil, "client %s process packet failed: %v", c.info.cid, err)
+			logger.MQTT.SpanErrorf(nil, "client %s process packet failed: %v", c.info.cid, err)
 			return
 		}
 	}
 }
 
+func (c *Client) readPacket() (packets.ControlPacket, error) {
+	if c.info.version != protocolVersion5 {
+		return packets.ReadPacket(c.conn)
+	}
+
+	pv, err := readPacketV5(c.conn)
+	if err != nil {
+		c.disconnect(reasonMalformedPacket)
+		return nil, err
+	}
+	if err = c.processPacketV5(pv); err != nil {
+		return nil, err
+	}
+	return pv.ControlPacket, nil
+}
+
+// processPacketV5 processes the MQTT 5.0 extensions of a packet, the packet
+// is processed in the same way as MQTT 3.1.1 after that.
+func (c *Client) processPacketV5(pv *packetV5) error {
+	switch p := pv.ControlPacket.(type) {
+	case *packets.PublishPacket:
+		if p.Qos == QoS2 {
+			c.disconnect(reasonQoSNotSupported)
+			return errors.New("qos2 not support now")
+		}
+		alias, ok := pv.props.uint16(propTopicAlias)
+		if !ok {
+			if p.TopicName == "" {
+				c.disconnect(reasonProtocolError)
+				return errors.New("publish without topic name and topic alias")
+			}
+			return nil
+		}
+		if alias == 0 || alias > c.broker.spec.TopicAliasMaximum {
+			c.disconnect(reasonTopicAliasInvalid)
+			return fmt.Errorf("invalid topic alias %d", alias)
+		}
+		if p.TopicName != "" {
+			c.topicAliases[alias] = p.TopicName
+			return nil
+		}
+		topic, ok := c.topicAliases[alias]
+		if !ok {
+			c.disconnect(reasonProtocolError)
+			return fmt.Errorf("unknown topic alias %d", alias)
+		}
+		p.TopicName = topic
+	case *packets.DisconnectPacket:
+		c.disconnectReason = pv.reasonCode
+		// the session expiry interval can not be changed if it is zero.
+		if interval, ok := pv.props.uint32(propSessionExpiryInterval); ok && c.session.expiryInterval() != 0 {
+			c.session.setExpiry(c.broker.limitSessionExpiry(interval))
+		}
+	}
+	return nil
+}
+
 func (c *Client) processPacket(packet packets.ControlPacket) error {
 	packetType := reflect.TypeOf(packet).String()
 	fn, ok := processPacketMap[packetType]
@@ -223,7 +298,7 @@ func (c *Client) runPipeline(packet packets.ControlPacket, packetType PacketType
 
 	pipe, ok := c.broker.muxMapper.GetHandler(pipelineName)
 	if !ok {
-		logger.SpanErrorf(nil, "get pipeline %v failed", pipelineName)
+		logger.MQTT.SpanErrorf(nil, "get pipeline %v failed", pipelineName)
 		return nil
 	}
 
@@ -240,17 +315,89 @@ func (c *Client) runPipeline(packet packets.ControlPacket, packetType PacketType
 	return nil
 }
 
+// writePacket queues packet to be written to the client, it blocks if the
+// queue is full.
 func (c *Client) writePacket(packet packets.ControlPacket) {
-	c.writeCh <- packet
+	select {
+	case c.writeCh <- packet:
+	case <-c.done:
+		return
+	}
+	if c.broker != nil && c.broker.workers != nil {
+		c.scheduleWrite()
+	}
+}
+
+// scheduleWrite submits the writing of the queued packets to the workers,
+// unless it has been submitted.
+func (c *Client) scheduleWrite() {
+	if atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+		if !c.broker.workers.Submit(c.flushWrites) {
+			atomic.StoreInt32(&c.writing, 0)
+		}
+	}
+}
+
+// flushWrites writes the queued packets in a worker.
+func (c *Client) flushWrites() {
+	for {
+		c.writeQueued()
+
+		// yield the worker to other clients if there are more packets.
+		if len(c.writeCh) > 0 && !c.disconnected() {
+			if c.broker.workers.TrySubmit(c.flushWrites) {
+				return
+			}
+			continue
+		}
+
+		// the packets queued before resetting writing are not scheduled
+		// by the writers, so check again.
+		atomic.StoreInt32(&c.writing, 0)
+		if len(c.writeCh) == 0 || c.disconnected() || !atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+			return
+		}
+	}
+}
+
+// writeQueued writes at most a queue of packets, so that a busy client
+// doesn't hold the worker for too long.
+func (c *Client) writeQueued() {
+	for i := 0; i < cap(c.writeCh); i++ {
+		var p packets.ControlPacket
+		select {
+		case p = <-c.writeCh:
+		default:
+			return
+		}
+		if c.disconnected() {
+			continue
+		}
+
+		c.conn.SetWriteDeadline(time.Now().Add(c.broker.writeTimeout))
+		if err := c.write(p); err != nil {
+			logger.MQTT.SpanErrorf(nil, "write packet %v to client %s failed: %s", p.String(), c.info.cid, err)
+			c.closeAndDelSession()
+		}
+	}
+}
+
+func (c *Client) write(packet packets.ControlPacket) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.info.version == protocolVersion5 {
+		return writePacketV5(c.conn, packet)
+	}
+	return packet.Write(c.conn)
 }
 
 func (c *Client) writeLoop() {
 	for {
 		select {
 		case p := <-c.writeCh:
-			err := p.Write(c.conn)
+			err := c.write(p)
 			if err != nil {
-				logger.SpanErrorf(nil, "write packet %v to client %s failed: %s", p.String(), c.info.cid, err)
+				logger.MQTT.SpanErrorf(nil, "write packet %v to client %s failed: %s", p.String(), c.info.cid, err)
 				c.closeAndDelSession()
 			}
 		case <-c.done:
@@ -265,7 +412,7 @@ func (c *Client) close() {
 		c.Unlock()
 		return
 	}
-	logger.SpanDebugf(nil, "client %v connection close", c.info.cid)
+	logger.MQTT.SpanDebugf(nil, "client %v connection close", c.info.cid)
 	atomic.StoreInt32(&c.statusFlag, Disconnected)
 	close(c.done)
 	c.conn.SetReadDeadline(time.Now().Add(time.Second))
@@ -278,7 +425,7 @@ func (c *Client) close() {
 	}
 	pipe, ok := c.broker.muxMapper.GetHandler(pipelineName)
 	if !ok {
-		logger.SpanErrorf(nil, "get pipeline %v failed", pipelineName)
+		logger.MQTT.SpanErrorf(nil, "get pipeline %v failed", pipelineName)
 	} else {
 		disconnect := packets.NewControlPacket(packets.Disconnect).(*packets.DisconnectPacket)
 		ctx := newContext(disconnect, c)
@@ -286,6 +433,18 @@ func (c *Client) close() {
 	}
 }
 
+// disconnect closes the connection, MQTT 5.0 clients are sent a DISCONNECT
+// packet with the reason code before that.
+func (c *Client) disconnect(reasonCode byte) {
+	if c.info.version == protocolVersion5 && !c.disconnected() {
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if err := c.write(newDisconnectV5(reasonCode)); err != nil {
+			logger.MQTT.SpanDebugf(nil, "write disconnect to client %s failed: %v", c.info.cid, err)
+		}
+	}
+	c.close()
+}
+
 func (c *Client) disconnected() bool {
 	return atomic.LoadInt32(&c.statusFlag) == Disconnected
 }
@@ -294,6 +453,8 @@ func (c *Client) closeAndDelSession() {
 	c.broker.sessMgr.delLocal(c.info.cid)
 	if c.session.cleanSession() {
 		c.broker.sessMgr.delDB(c.info.cid)
+	} else if c.info.version == protocolVersion5 {
+		c.broker.sessMgr.expireLater(c.info.cid, c.session.expiryInterval())
 	}
 
 	topics, _, _ := c.session.allSubscribes()
@@ -319,7 +480,7 @@ func pipelineWrapper(fn processFn, packetType PacketType) processFnWithErr {
 	return func(c *Client, p packets.ControlPacket) error {
 		err := c.runPipeline(p, packetType)
 		if err != nil {
-			logger.SpanDebugf(nil, "client process pipeline failed, %v", c.info.cid, err)
+			logger.MQTT.SpanDebugf(nil, "client process pipeline failed, %v", c.info.cid, err)
 			return nil
 		}
 		fn(c, p)
@@ -348,11 +509,15 @@ func processPuback(c *Client, packet packets.ControlPacket) {
 
 func processSubscribe(c *Client, p packets.ControlPacket) {
 	packet := p.(*packets.SubscribePacket)
-	logger.SpanDebugf(nil, "client %s subscribe %v with qos %v", c.info.cid, packet.Topics, packet.Qoss)
+	logger.MQTT.SpanDebugf(nil, "client %s subscribe %v with qos %v", c.info.cid, packet.Topics, packet.Qoss)
+	if c.info.version == protocolVersion5 {
+		processSubscribeV5(c, packet)
+		return
+	}
 
 	err := c.broker.topicMgr.subscribe(packet.Topics, packet.Qoss, c.info.cid)
 	if err != nil {
-		logger.SpanErrorf(nil, "client %v subscribe %v failed: %v", c.info.cid, packet.Topics, err)
+		logger.MQTT.SpanErrorf(nil, "client %v subscribe %v failed: %v", c.info.cid, packet.Topics, err)
 		return
 	}
 	c.session.subscribe(packet.Topics, packet.Qoss)
@@ -366,19 +531,68 @@ func processSubscribe(c *Client, p packets.ControlPacket) {
 	c.writePacket(suback)
 }
 
+// processSubscribeV5 subscribes topics one by one, and answers each topic
+// with the granted qos or a reason code of failure.
+func processSubscribeV5(c *Client, packet *packets.SubscribePacket) {
+	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	suback.MessageID = packet.MessageID
+	suback.ReturnCodes = make([]byte, len(packet.Topics))
+
+	var topics []string
+	var qoss []byte
+	for i, topic := range packet.Topics {
+		qos := packet.Qoss[i]
+		if qos > QoS1 {
+			qos = QoS1
+		}
+		err := c.broker.topicMgr.subscribe([]string{topic}, []byte{qos}, c.info.cid)
+		if err != nil {
+			logger.MQTT.SpanErrorf(nil, "client %v subscribe %v failed: %v", c.info.cid, topic, err)
+			suback.ReturnCodes[i] = reasonTopicFilterInvalid
+			continue
+		}
+		suback.ReturnCodes[i] = qos
+		topics = append(topics, topic)
+		qoss = append(qoss, qos)
+	}
+	if len(topics) > 0 {
+		c.session.subscribe(topics, qoss)
+	}
+	c.writePacket(suback)
+}
+
 func processUnsubscribe(c *Client, p packets.ControlPacket) {
 	packet := p.(*packets.UnsubscribePacket)
 
-	logger.SpanDebugf(nil, "client %s processUnsubscribe %v", c.info.cid, packet.Topics)
+	logger.MQTT.SpanDebugf(nil, "client %s processUnsubscribe %v", c.info.cid, packet.Topics)
+
+	var reasonCodes []byte
+	if c.info.version == protocolVersion5 {
+		subscribed, _, _ := c.session.allSubscribes()
+		reasonCodes = make([]byte, len(packet.Topics))
+		for i, topic := range packet.Topics {
+			reasonCodes[i] = reasonNoSubscriptionExisted
+			for _, t := range subscribed {
+				if t == topic {
+					reasonCodes[i] = reasonSuccess
+					break
+				}
+			}
+		}
+	}
 
 	err := c.broker.topicMgr.unsubscribe(packet.Topics, c.info.cid)
 	if err != nil {
-		logger.SpanErrorf(nil, "client %v unsubscribe %v failed: %v", c.info.cid, packet.Topics, err)
+		logger.MQTT.SpanErrorf(nil, "client %v unsubscribe %v failed: %v", c.info.cid, packet.Topics, err)
 	}
 	c.session.unsubscribe(packet.Topics)
 
 	unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
 	unsuback.MessageID = packet.MessageID
+	if reasonCodes != nil {
+		c.writePacket(&packetV5{ControlPacket: unsuback, reasonCodes: reasonCodes})
+		return
+	}
 	c.writePacket(unsuback)
 }
 
@@ -708,6 +708,54 @@ func TestSendMsgBack(t *testing.T) {
 	close(done)
 }
 
+func TestWorkerPool(t *testing.T) {
+	clientNum := 5
+	msgNum := 50
+	subscribeCh := make(chan CheckMsg, clientNum*msgNum)
+
+	spec := getDefaultSpec()
+	spec.WorkerPool = &WorkerPoolSpec{Workers: 2, QueueSize: 16}
+	broker := getBrokerFromSpec(spec, nil)
+	defer broker.close()
+	require.NotNil(t, broker.workers)
+
+	handler := getMQTTSubscribeHandler(subscribeCh)
+	clients := []paho.Client{}
+	for i := 0; i < clientNum; i++ {
+		cid := fmt.Sprintf("test_%d", i)
+		c := getMQTTClient(t, cid, "test", "test", true)
+		if token := c.Subscribe(cid, 1, handler); token.Wait() && token.Error() != nil {
+			t.Errorf("subscribe qos1 error %s", token.Error())
+		}
+		clients = append(clients, c)
+	}
+
+	for i := 0; i < clientNum; i++ {
+		topic := fmt.Sprintf("test_%d", i)
+		for j := 0; j < msgNum; j++ {
+			broker.sendMsgToClient(nil, topic, []byte(strconv.Itoa(j)), QoS1)
+		}
+	}
+
+	ans := make(map[string]int)
+	for i := 0; i < clientNum*msgNum; i++ {
+		select {
+		case msg := <-subscribeCh:
+			num, _ := strconv.Atoi(msg.payload)
+			if val, ok := ans[msg.topic]; ok && num != val+1 {
+				t.Errorf("received msg of %s not in order", msg.topic)
+			}
+			ans[msg.topic] = num
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d msgs received", i)
+		}
+	}
+
+	for _, c := range clients {
+		c.Disconnect(200)
+	}
+}
+
 func TestYamlEncodeDecode(t *testing.T) {
 	broker := getDefaultBroker(nil)
 	defer broker.close()
@@ -93,10 +93,10 @@ func memberURLFunc(superSpec *supervisor.Spec) func(string, string) ([]string, e
 	c := superSpec.Super().Cluster()
 
 	f := func(egName, name string) ([]string, error) {
-		logger.SpanDebugf(nil, "get member url for %v %v", egName, name)
+		logger.MQTT.SpanDebugf(nil, "get member url for %v %v", egName, name)
 		kv, err := c.GetPrefix(c.Layout().StatusMemberPrefix())
 		if err != nil {
-			logger.SpanErrorf(nil, "cluster get member list failed: %v", err)
+			logger.MQTT.SpanErrorf(nil, "cluster get member list failed: %v", err)
 			return []string{}, err
 		}
 		urls := []string{}
@@ -104,7 +104,7 @@ func memberURLFunc(superSpec *supervisor.Spec) func(string, string) ([]string, e
 			memberStatus := cluster.MemberStatus{}
 			err := codectool.Unmarshal([]byte(v), &memberStatus)
 			if err != nil {
-				logger.SpanErrorf(nil, "cluster status unmarshal failed: %v", err)
+				logger.MQTT.SpanErrorf(nil, "cluster status unmarshal failed: %v", err)
 				return []string{}, err
 			}
 			if memberStatus.Options.Name != egName {
@@ -126,7 +126,7 @@ func memberURLFunc(superSpec *supervisor.Spec) func(string, string) ([]string, e
 				urls = append(urls, newURL+"/apis/v2"+fmt.Sprintf(mqttAPITopicPublishPrefix, name))
 			}
 		}
-		logger.SpanDebugf(nil, "eg %v %v get urls %v", egName, name, urls)
+		logger.MQTT.SpanDebugf(nil, "eg %v %v get urls %v", egName, name, urls)
 		return urls, nil
 	}
 	return f
@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+const (
+	// protocolVersion5 is the protocol level of MQTT 5.0.
+	protocolVersion5 byte = 5
+
+	// sessionNeverExpire is the session expiry interval of sessions which
+	// never expire.
+	sessionNeverExpire uint32 = 0xFFFFFFFF
+)
+
+// MQTT 5.0 reason codes used by the broker, see section 2.4 of the
+// specification.
+const (
+	reasonSuccess               byte = 0x00
+	reasonDisconnectWithWill    byte = 0x04
+	reasonNoSubscriptionExisted byte = 0x11
+	reasonMalformedPacket       byte = 0x81
+	reasonProtocolError         byte = 0x82
+	reasonUnsupportedProtocol   byte = 0x84
+	reasonClientIDNotValid      byte = 0x85
+	reasonBadUsernameOrPassword byte = 0x86
+	reasonNotAuthorized         byte = 0x87
+	reasonServerUnavailable     byte = 0x88
+	reasonSessionTakenOver      byte = 0x8E
+	reasonTopicFilterInvalid    byte = 0x8F
+	reasonTopicAliasInvalid     byte = 0x94
+	reasonQoSNotSupported       byte = 0x9B
+)
+
+// connackReasonCodes maps MQTT 3.1.1 CONNACK return codes to MQTT 5.0
+// reason codes.
+var connackReasonCodes = map[byte]byte{
+	packets.Accepted:                        reasonSuccess,
+	packets.ErrRefusedBadProtocolVersion:    reasonUnsupportedProtocol,
+	packets.ErrRefusedIDRejected:            reasonClientIDNotValid,
+	packets.ErrRefusedServerUnavailable:     reasonServerUnavailable,
+	packets.ErrRefusedBadUsernameOrPassword: reasonBadUsernameOrPassword,
+	packets.ErrRefusedNotAuthorised:         reasonNotAuthorized,
+	packets.ErrProtocolViolation:            reasonProtocolError,
+}
+
+// packetV5 is an MQTT 5.0 packet. ControlPacket holds the fields shared
+// with MQTT 3.1.1, so that pipelines and filters handle packets of both
+// versions in the same way, and the others are the MQTT 5.0 extensions.
+type packetV5 struct {
+	packets.ControlPacket
+
+	// reasonCode is the reason code of CONNACK, PUBACK and DISCONNECT.
+	reasonCode byte
+	// reasonCodes are the reason codes of UNSUBACK, the reason codes of
+	// SUBACK are the ReturnCodes of the SubackPacket.
+	reasonCodes []byte
+	props       properties
+}
+
+func newDisconnectV5(reasonCode byte) *packetV5 {
+	return &packetV5{
+		ControlPacket: packets.NewControlPacket(packets.Disconnect),
+		reasonCode:    reasonCode,
+	}
+}
+
+func readFixedHeader(r io.Reader) (packets.FixedHeader, []byte, error) {
+	var fh packets.FixedHeader
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return fh, nil, err
+	}
+	fh.MessageType = b[0] >> 4
+	fh.Dup = (b[0]>>3)&0x01 > 0
+	fh.Qos = (b[0] >> 1) & 0x03
+	fh.Retain = b[0]&0x01 > 0
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return fh, nil, errMalformedPacket
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return fh, nil, err
+		}
+		length += int(b[0]&0x7f) * multiplier
+		if b[0]&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	fh.RemainingLength = length
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return fh, nil, err
+	}
+	return fh, body, nil
+}
+
+// readFirstPacket reads the first packet of a connection, a CONNECT packet
+// of MQTT 5.0 is returned as a packetV5, and all the other packets are
+// decoded as MQTT 3.1.1 packets.
+func readFirstPacket(r io.Reader) (packets.ControlPacket, error) {
+	fh, body, err := readFixedHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if fh.MessageType == packets.Connect {
+		d := &decoder{buf: body}
+		d.string()
+		if d.byte() == protocolVersion5 && d.err == nil {
+			return decodePacketV5(fh, body)
+		}
+	}
+
+	p, err := packets.NewControlPacketWithHeader(fh)
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Unpack(bytes.NewBuffer(body)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func readPacketV5(r io.Reader) (*packetV5, error) {
+	fh, body, err := readFixedHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodePacketV5(fh, body)
+}
+
+func decodePacketV5(fh packets.FixedHeader, body []byte) (*packetV5, error) {
+	cp, err := packets.NewControlPacketWithHeader(fh)
+	if err != nil {
+		return nil, err
+	}
+	pv := &packetV5{ControlPacket: cp}
+	d := &decoder{buf: body}
+
+	switch p := cp.(type) {
+	case *packets.ConnectPacket:
+		p.ProtocolName = d.string()
+		p.ProtocolVersion = d.byte()
+		flags := d.byte()
+		p.ReservedBit = flags & 0x01
+		p.CleanSession = flags&0x02 > 0
+		p.WillFlag = flags&0x04 > 0
+		p.WillQos = (flags >> 3) & 0x03
+		p.WillRetain = flags&0x20 > 0
+		p.PasswordFlag = flags&0x40 > 0
+		p.UsernameFlag = flags&0x80 > 0
+		p.Keepalive = d.uint16()
+		pv.props = d.properties()
+		p.ClientIdentifier = d.string()
+		if p.WillFlag {
+			// will properties are not supported and ignored.
+			d.properties()
+			p.WillTopic = d.string()
+			p.WillMessage = d.binary()
+		}
+		if p.UsernameFlag {
+			p.Username = d.string()
+		}
+		if p.PasswordFlag {
+			p.Password = d.binary()
+		}
+	case *packets.ConnackPacket:
+		p.SessionPresent = d.byte()&0x01 > 0
+		pv.reasonCode = d.byte()
+		p.ReturnCode = pv.reasonCode
+		pv.props = d.properties()
+	case *packets.PublishPacket:
+		p.TopicName = d.string()
+		if p.Qos > 0 {
+			p.MessageID = d.uint16()
+		}
+		pv.props = d.properties()
+		p.Payload = d.next(d.remaining())
+	case *packets.PubackPacket:
+		p.MessageID = d.uint16()
+		if d.remaining() > 0 {
+			pv.reasonCode = d.byte()
+		}
+		if d.remaining() > 0 {
+			pv.props = d.properties()
+		}
+	case *packets.SubscribePacket:
+		p.MessageID = d.uint16()
+		pv.props = d.properties()
+		for d.remaining() > 0 && d.err == nil {
+			p.Topics = append(p.Topics, d.string())
+			// only the QoS in subscription options is supported.
+			p.Qoss = append(p.Qoss, d.byte()&0x03)
+		}
+	case *packets.SubackPacket:
+		p.MessageID = d.uint16()
+		pv.props = d.properties()
+		p.ReturnCodes = d.next(d.remaining())
+	case *packets.UnsubscribePacket:
+		p.MessageID = d.uint16()
+		pv.props = d.properties()
+		for d.remaining() > 0 && d.err == nil {
+			p.Topics = append(p.Topics, d.string())
+		}
+	case *packets.UnsubackPacket:
+		p.MessageID = d.uint16()
+		pv.props = d.properties()
+		pv.reasonCodes = d.next(d.remaining())
+	case *packets.PingreqPacket, *packets.PingrespPacket:
+	case *packets.DisconnectPacket:
+		if d.remaining() > 0 {
+			pv.reasonCode = d.byte()
+		}
+		if d.remaining() > 0 {
+			pv.props = d.properties()
+		}
+	default:
+		return nil, fmt.Errorf("packet type %v is not supported in MQTT 5.0", packets.PacketNames[fh.MessageType])
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return pv, nil
+}
+
+// writePacketV5 writes a packet in the format of MQTT 5.0, p is a packetV5
+// or a packet of MQTT 3.1.1, which is written with the success reason code
+// and no properties.
+func writePacketV5(w io.Writer, p packets.ControlPacket) error {
+	pv, ok := p.(*packetV5)
+	if !ok {
+		pv = &packetV5{ControlPacket: p}
+	}
+
+	body := &bytes.Buffer{}
+	var fh *packets.FixedHeader
+	var flags byte
+
+	switch p := pv.ControlPacket.(type) {
+	case *packets.ConnectPacket:
+		fh = &p.FixedHeader
+		encodeString(body, "MQTT")
+		body.WriteByte(protocolVersion5)
+		var connectFlags byte
+		if p.CleanSession {
+			connectFlags |= 0x02
+		}
+		if p.WillFlag {
+			connectFlags |= 0x04 | p.WillQos<<3
+			if p.WillRetain {
+				connectFlags |= 0x20
+			}
+		}
+		if p.PasswordFlag {
+			connectFlags |= 0x40
+		}
+		if p.UsernameFlag {
+			connectFlags |= 0x80
+		}
+		body.WriteByte(connectFlags)
+		encodeUint16(body, p.Keepalive)
+		pv.props.encode(body)
+		encodeString(body, p.ClientIdentifier)
+		if p.WillFlag {
+			properties(nil).encode(body)
+			encodeString(body, p.WillTopic)
+			encodeBinary(body, p.WillMessage)
+		}
+		if p.UsernameFlag {
+			encodeString(body, p.Username)
+		}
+		if p.PasswordFlag {
+			encodeBinary(body, p.Password)
+		}
+	case *packets.ConnackPacket:
+		fh = &p.FixedHeader
+		if p.SessionPresent {
+			body.WriteByte(0x01)
+		} else {
+			body.WriteByte(0x00)
+		}
+		body.WriteByte(pv.reasonCode)
+		pv.props.encode(body)
+	case *packets.PublishPacket:
+		fh = &p.FixedHeader
+		if p.Dup {
+			flags |= 0x08
+		}
+		flags |= p.Qos << 1
+		if p.Retain {
+			flags |= 0x01
+		}
+		encodeString(body, p.TopicName)
+		if p.Qos > 0 {
+			encodeUint16(body, p.MessageID)
+		}
+		pv.props.encode(body)
+		body.Write(p.Payload)
+	case *packets.PubackPacket:
+		fh = &p.FixedHeader
+		encodeUint16(body, p.MessageID)
+		if pv.reasonCode != reasonSuccess || len(pv.props) > 0 {
+			body.WriteByte(pv.reasonCode)
+			pv.props.encode(body)
+		}
+	case *packets.SubscribePacket:
+		fh = &p.FixedHeader
+		flags = 0x02
+		encodeUint16(body, p.MessageID)
+		pv.props.encode(body)
+		for i, topic := range p.Topics {
+			encodeString(body, topic)
+			body.WriteByte(p.Qoss[i])
+		}
+	case *packets.SubackPacket:
+		fh = &p.FixedHeader
+		encodeUint16(body, p.MessageID)
+		pv.props.encode(body)
+		body.Write(p.ReturnCodes)
+	case *packets.UnsubscribePacket:
+		fh = &p.FixedHeader
+		flags = 0x02
+		encodeUint16(body, p.MessageID)
+		pv.props.encode(body)
+		for _, topic := range p.Topics {
+			encodeString(body, topic)
+		}
+	case *packets.UnsubackPacket:
+		fh = &p.FixedHeader
+		encodeUint16(body, p.MessageID)
+		pv.props.encode(body)
+		body.Write(pv.reasonCodes)
+	case *packets.PingreqPacket:
+		fh = &p.FixedHeader
+	case *packets.PingrespPacket:
+		fh = &p.FixedHeader
+	case *packets.DisconnectPacket:
+		fh = &p.FixedHeader
+		if pv.reasonCode != reasonSuccess || len(pv.props) > 0 {
+			body.WriteByte(pv.reasonCode)
+			pv.props.encode(body)
+		}
+	default:
+		return fmt.Errorf("packet %v is not supported in MQTT 5.0", p.String())
+	}
+
+	packet := &bytes.Buffer{}
+	packet.WriteByte(fh.MessageType<<4 | flags)
+	encodeVarint(packet, body.Len())
+	packet.Write(body.Bytes())
+	_, err := w.Write(packet.Bytes())
+	return err
+}
+
+// validateConnectV5 validates a CONNECT packet of MQTT 5.0 and returns the
+// return code of MQTT 3.1.1, an empty client identifier is valid since the
+// broker assigns one to the client.
+func validateConnectV5(connect *packets.ConnectPacket) byte {
+	if connect.ProtocolName != "MQTT" || connect.ReservedBit != 0 {
+		return packets.ErrProtocolViolation
+	}
+	if connect.WillQos > QoS2 {
+		return packets.ErrProtocolViolation
+	}
+	return packets.Accepted
+}
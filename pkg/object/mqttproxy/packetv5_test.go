@@ -0,0 +1,269 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketV5Codec(t *testing.T) {
+	assert := assert.New(t)
+
+	roundTrip := func(p packets.ControlPacket) *packetV5 {
+		buf := &bytes.Buffer{}
+		assert.NoError(writePacketV5(buf, p))
+		pv, err := readPacketV5(buf)
+		assert.NoError(err)
+		assert.Zero(buf.Len())
+		return pv
+	}
+
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ClientIdentifier = "client"
+	connect.CleanSession = true
+	connect.Keepalive = 30
+	connect.UsernameFlag, connect.Username = true, "user"
+	connect.PasswordFlag, connect.Password = true, []byte("pass")
+	connect.WillFlag, connect.WillQos, connect.WillTopic, connect.WillMessage = true, QoS1, "will", []byte("bye")
+	props := properties{}
+	props.add(propSessionExpiryInterval, uint32(100))
+	props.add(propUserProperty, [2]string{"k", "v"})
+	props.add(propCorrelationData, []byte("data"))
+	props.add(propSubscriptionIdentifier, uint32(200))
+	pv := roundTrip(&packetV5{ControlPacket: connect, props: props})
+	got := pv.ControlPacket.(*packets.ConnectPacket)
+	assert.Equal(protocolVersion5, got.ProtocolVersion)
+	assert.Equal("client", got.ClientIdentifier)
+	assert.True(got.CleanSession)
+	assert.Equal(uint16(30), got.Keepalive)
+	assert.Equal("user", got.Username)
+	assert.Equal([]byte("pass"), got.Password)
+	assert.Equal(QoS1, got.WillQos)
+	assert.Equal("will", got.WillTopic)
+	assert.Equal([]byte("bye"), got.WillMessage)
+	assert.Equal(props, pv.props)
+	assert.Equal(byte(packets.Accepted), validateConnectV5(got))
+
+	// a CONNECT of MQTT 5.0 is the first packet of a connection.
+	buf := &bytes.Buffer{}
+	writePacketV5(buf, connect)
+	first, err := readFirstPacket(buf)
+	assert.NoError(err)
+	assert.IsType(&packetV5{}, first)
+
+	// packets of MQTT 3.1.1 are decoded by paho.
+	buf.Reset()
+	connect.ProtocolName, connect.ProtocolVersion = "MQTT", 4
+	connect.Write(buf)
+	first, err = readFirstPacket(buf)
+	assert.NoError(err)
+	assert.Equal("client", first.(*packets.ConnectPacket).ClientIdentifier)
+
+	publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.Qos, publish.MessageID, publish.TopicName, publish.Payload = QoS1, 7, "a/b", []byte("payload")
+	props = properties{}
+	props.add(propTopicAlias, uint16(3))
+	pv = roundTrip(&packetV5{ControlPacket: publish, props: props})
+	gotPublish := pv.ControlPacket.(*packets.PublishPacket)
+	assert.Equal(uint16(7), gotPublish.MessageID)
+	assert.Equal("a/b", gotPublish.TopicName)
+	assert.Equal([]byte("payload"), gotPublish.Payload)
+	alias, ok := pv.props.uint16(propTopicAlias)
+	assert.True(ok)
+	assert.Equal(uint16(3), alias)
+
+	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	suback.MessageID, suback.ReturnCodes = 8, []byte{QoS1, reasonTopicFilterInvalid}
+	pv = roundTrip(suback)
+	assert.Equal([]byte{QoS1, reasonTopicFilterInvalid}, pv.ControlPacket.(*packets.SubackPacket).ReturnCodes)
+
+	unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+	unsuback.MessageID = 9
+	pv = roundTrip(&packetV5{ControlPacket: unsuback, reasonCodes: []byte{reasonSuccess, reasonNoSubscriptionExisted}})
+	assert.Equal([]byte{reasonSuccess, reasonNoSubscriptionExisted}, pv.reasonCodes)
+
+	pv = roundTrip(newDisconnectV5(reasonSessionTakenOver))
+	assert.IsType(&packets.DisconnectPacket{}, pv.ControlPacket)
+	assert.Equal(reasonSessionTakenOver, pv.reasonCode)
+
+	// a PUBACK of success has no reason code.
+	puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+	puback.MessageID = 10
+	buf.Reset()
+	writePacketV5(buf, puback)
+	assert.Equal([]byte{0x40, 0x02, 0x00, 0x0a}, buf.Bytes())
+
+	// malformed packets.
+	_, err = readPacketV5(bytes.NewReader([]byte{0x30, 0x02, 0x00, 0x05}))
+	assert.Error(err)
+	_, err = readPacketV5(bytes.NewReader([]byte{0xe0, 0x02, 0x01, 0x7f}))
+	assert.Error(err)
+}
+
+type v5TestClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newV5TestClient(t *testing.T, clientID string, cleanStart bool, expiry uint32) (*v5TestClient, *packetV5) {
+	conn, err := net.Dial("tcp", "localhost:1883")
+	require.Nil(t, err)
+	c := &v5TestClient{t: t, conn: conn}
+
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ClientIdentifier = clientID
+	connect.CleanSession = cleanStart
+	props := properties{}
+	props.add(propSessionExpiryInterval, expiry)
+	c.write(&packetV5{ControlPacket: connect, props: props})
+	return c, c.read()
+}
+
+func (c *v5TestClient) write(p packets.ControlPacket) {
+	require.Nil(c.t, writePacketV5(c.conn, p))
+}
+
+func (c *v5TestClient) read() *packetV5 {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	pv, err := readPacketV5(c.conn)
+	require.Nil(c.t, err)
+	return pv
+}
+
+func (c *v5TestClient) publish(topic string, alias uint16, id uint16, payload string) {
+	publish := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	publish.Qos, publish.MessageID, publish.TopicName, publish.Payload = QoS1, id, topic, []byte(payload)
+	props := properties{}
+	if alias != 0 {
+		props.add(propTopicAlias, alias)
+	}
+	c.write(&packetV5{ControlPacket: publish, props: props})
+}
+
+func TestMQTTv5(t *testing.T) {
+	assert := assert.New(t)
+
+	pipe, backend := getPublishPipeline(t)
+	defer pipe.Close()
+	mapper := &mockMuxMapper{
+		MockFunc: func(name string) (context.Handler, bool) {
+			return pipe, true
+		},
+	}
+	broker := getDefaultBroker(mapper)
+	defer broker.close()
+
+	// the broker assigns client identifier and tells its features.
+	client, connack := newV5TestClient(t, "", true, 100)
+	defer client.conn.Close()
+	assert.Equal(reasonSuccess, connack.reasonCode)
+	cid, ok := connack.props.string(propAssignedClientIdentifier)
+	assert.True(ok)
+	assert.True(strings.HasPrefix(cid, "auto-"))
+	aliasMax, _ := connack.props.uint16(propTopicAliasMaximum)
+	assert.Equal(uint16(defaultTopicAliasMaximum), aliasMax)
+	_, ok = connack.props.uint32(propSessionExpiryInterval)
+	assert.False(ok)
+
+	subscribe := packets.NewControlPacket(packets.Subscribe).(*packets.SubscribePacket)
+	subscribe.MessageID = 1
+	subscribe.Topics = []string{"v5/topic", "$share/group/v5/+", "v5/#/invalid"}
+	subscribe.Qoss = []byte{QoS2, QoS1, QoS0}
+	client.write(subscribe)
+	suback := client.read().ControlPacket.(*packets.SubackPacket)
+	assert.Equal([]byte{QoS1, QoS1, reasonTopicFilterInvalid}, suback.ReturnCodes)
+
+	// topic alias is set by the first publish and used by later ones.
+	client.publish("v5/alias", 1, 2, "a")
+	assert.Equal("v5/alias", backend.get().TopicName)
+	assert.Equal(uint16(2), client.read().ControlPacket.(*packets.PubackPacket).MessageID)
+	client.publish("", 1, 3, "b")
+	p := backend.get()
+	assert.Equal("v5/alias", p.TopicName)
+	assert.Equal("b", string(p.Payload))
+	assert.Equal(uint16(3), client.read().ControlPacket.(*packets.PubackPacket).MessageID)
+
+	// messages to normal and shared subscriptions.
+	broker.sendMsgToClient(nil, "v5/topic", []byte("normal"), QoS0)
+	received := client.read().ControlPacket.(*packets.PublishPacket)
+	assert.Equal("v5/topic", received.TopicName)
+	assert.Equal("normal", string(received.Payload))
+	broker.sendMsgToSharedClients(nil, "v5/topic", []byte("shared"), QoS0, nil)
+	received = client.read().ControlPacket.(*packets.PublishPacket)
+	assert.Equal("shared", string(received.Payload))
+
+	unsubscribe := packets.NewControlPacket(packets.Unsubscribe).(*packets.UnsubscribePacket)
+	unsubscribe.MessageID = 4
+	unsubscribe.Topics = []string{"v5/topic", "not/subscribed"}
+	client.write(unsubscribe)
+	assert.Equal([]byte{reasonSuccess, reasonNoSubscriptionExisted}, client.read().reasonCodes)
+
+	// invalid topic alias disconnects the client with the reason code.
+	client.publish("v5/alias", 1000, 5, "c")
+	assert.Equal(reasonTopicAliasInvalid, client.read().reasonCode)
+
+	// the session is kept since the session expiry interval is not zero.
+	assert.Nil(checkSessionStore(broker, cid, "$share/group/v5/+"))
+}
+
+func TestMQTTv5Session(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := getDefaultSpec()
+	spec.Rules = nil
+	spec.MaxSessionExpiryInterval = 1
+	broker := getBrokerFromSpec(spec, nil)
+	defer broker.close()
+
+	// the session expiry interval is limited by the spec.
+	client, connack := newV5TestClient(t, "v5-session", true, 100)
+	expiry, ok := connack.props.uint32(propSessionExpiryInterval)
+	assert.True(ok)
+	assert.Equal(uint32(1), expiry)
+
+	// the old client is disconnected when the session is taken over.
+	newClient, _ := newV5TestClient(t, "v5-session", false, 100)
+	assert.Equal(reasonSessionTakenOver, client.read().reasonCode)
+	client.conn.Close()
+
+	newClient.write(packets.NewControlPacket(packets.Disconnect))
+	newClient.conn.Close()
+	assert.Nil(checkSessionStore(broker, "v5-session", ""))
+
+	// the session expires after the expiry interval.
+	time.Sleep(1500 * time.Millisecond)
+	_, err := broker.sessMgr.store.get(sessionStoreKey("v5-session"))
+	assert.Error(err)
+
+	// the session ends with the connection if the expiry interval is zero.
+	client, _ = newV5TestClient(t, "v5-clean", false, 0)
+	client.write(packets.NewControlPacket(packets.Disconnect))
+	client.conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	_, err = broker.sessMgr.store.get(sessionStoreKey("v5-clean"))
+	assert.Error(err)
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MQTT 5.0 property identifiers, see section 2.2.2.2 of the specification.
+const (
+	propPayloadFormatIndicator          byte = 0x01
+	propMessageExpiryInterval           byte = 0x02
+	propContentType                     byte = 0x03
+	propResponseTopic                   byte = 0x08
+	propCorrelationData                 byte = 0x09
+	propSubscriptionIdentifier          byte = 0x0B
+	propSessionExpiryInterval           byte = 0x11
+	propAssignedClientIdentifier        byte = 0x12
+	propServerKeepAlive                 byte = 0x13
+	propAuthenticationMethod            byte = 0x15
+	propAuthenticationData              byte = 0x16
+	propRequestProblemInformation       byte = 0x17
+	propWillDelayInterval               byte = 0x18
+	propRequestResponseInformation      byte = 0x19
+	propResponseInformation             byte = 0x1A
+	propServerReference                 byte = 0x1C
+	propReasonString                    byte = 0x1F
+	propReceiveMaximum                  byte = 0x21
+	propTopicAliasMaximum               byte = 0x22
+	propTopicAlias                      byte = 0x23
+	propMaximumQoS                      byte = 0x24
+	propRetainAvailable                 byte = 0x25
+	propUserProperty                    byte = 0x26
+	propMaximumPacketSize               byte = 0x27
+	propWildcardSubscriptionAvailable   byte = 0x28
+	propSubscriptionIdentifierAvailable byte = 0x29
+	propSharedSubscriptionAvailable     byte = 0x2A
+)
+
+// data types of MQTT 5.0 properties.
+const (
+	propTypeByte byte = iota
+	propTypeUint16
+	propTypeUint32
+	propTypeVarint
+	propTypeString
+	propTypeBinary
+	propTypeStringPair
+)
+
+var propertyTypes = map[byte]byte{
+	propPayloadFormatIndicator:          propTypeByte,
+	propMessageExpiryInterval:           propTypeUint32,
+	propContentType:                     propTypeString,
+	propResponseTopic:                   propTypeString,
+	propCorrelationData:                 propTypeBinary,
+	propSubscriptionIdentifier:          propTypeVarint,
+	propSessionExpiryInterval:           propTypeUint32,
+	propAssignedClientIdentifier:        propTypeString,
+	propServerKeepAlive:                 propTypeUint16,
+	propAuthenticationMethod:            propTypeString,
+	propAuthenticationData:              propTypeBinary,
+	propRequestProblemInformation:       propTypeByte,
+	propWillDelayInterval:               propTypeUint32,
+	propRequestResponseInformation:      propTypeByte,
+	propResponseInformation:             propTypeString,
+	propServerReference:                 propTypeString,
+	propReasonString:                    propTypeString,
+	propReceiveMaximum:                  propTypeUint16,
+	propTopicAliasMaximum:               propTypeUint16,
+	propTopicAlias:                      propTypeUint16,
+	propMaximumQoS:                      propTypeByte,
+	propRetainAvailable:                 propTypeByte,
+	propUserProperty:                    propTypeStringPair,
+	propMaximumPacketSize:               propTypeUint32,
+	propWildcardSubscriptionAvailable:   propTypeByte,
+	propSubscriptionIdentifierAvailable: propTypeByte,
+	propSharedSubscriptionAvailable:     propTypeByte,
+}
+
+var errMalformedPacket = errors.New("malformed packet")
+
+type (
+	// property is an MQTT 5.0 property, the type of value is byte, uint16,
+	// uint32, string, []byte or [2]string according to the property type,
+	// variable byte integers are uint32.
+	property struct {
+		id    byte
+		value interface{}
+	}
+
+	// properties are the properties of an MQTT 5.0 packet in wire order.
+	properties []property
+
+	// decoder decodes MQTT data types from a packet body, the first error
+	// is kept and all later reads return zero values.
+	decoder struct {
+		buf []byte
+		err error
+	}
+)
+
+func (ps properties) get(id byte) (interface{}, bool) {
+	for _, p := range ps {
+		if p.id == id {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+func (ps properties) uint16(id byte) (uint16, bool) {
+	v, ok := ps.get(id)
+	if !ok {
+		return 0, false
+	}
+	return v.(uint16), true
+}
+
+func (ps properties) uint32(id byte) (uint32, bool) {
+	v, ok := ps.get(id)
+	if !ok {
+		return 0, false
+	}
+	return v.(uint32), true
+}
+
+func (ps properties) string(id byte) (string, bool) {
+	v, ok := ps.get(id)
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// add appends a property, the value must match the property type.
+func (ps *properties) add(id byte, value interface{}) {
+	*ps = append(*ps, property{id: id, value: value})
+}
+
+func (ps properties) encode(buf *bytes.Buffer) {
+	body := &bytes.Buffer{}
+	for _, p := range ps {
+		body.WriteByte(p.id)
+		switch v := p.value.(type) {
+		case byte:
+			body.WriteByte(v)
+		case uint16:
+			encodeUint16(body, v)
+		case uint32:
+			if propertyTypes[p.id] == propTypeVarint {
+				encodeVarint(body, int(v))
+			} else {
+				encodeUint32(body, v)
+			}
+		case string:
+			encodeString(body, v)
+		case []byte:
+			encodeBinary(body, v)
+		case [2]string:
+			encodeString(body, v[0])
+			encodeString(body, v[1])
+		}
+	}
+	encodeVarint(buf, body.Len())
+	buf.Write(body.Bytes())
+}
+
+func encodeUint16(buf *bytes.Buffer, v uint16) {
+	buf.WriteByte(byte(v >> 8))
+	buf.WriteByte(byte(v))
+}
+
+func encodeUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func encodeString(buf *bytes.Buffer, s string) {
+	encodeUint16(buf, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func encodeBinary(buf *bytes.Buffer, b []byte) {
+	encodeUint16(buf, uint16(len(b)))
+	buf.Write(b)
+}
+
+func encodeVarint(buf *bytes.Buffer, v int) {
+	for {
+		b := byte(v % 128)
+		v /= 128
+		if v > 0 {
+			b |= 0x80
+		}
+		buf.WriteByte(b)
+		if v == 0 {
+			return
+		}
+	}
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf)
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.buf) {
+		d.err = errMalformedPacket
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) varint() int {
+	v, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b := d.byte()
+		if d.err != nil {
+			return 0
+		}
+		v += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return v
+		}
+		multiplier *= 128
+	}
+	d.err = errMalformedPacket
+	return 0
+}
+
+func (d *decoder) binary() []byte {
+	n := d.uint16()
+	b := d.next(int(n))
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.binary())
+}
+
+func (d *decoder) properties() properties {
+	n := d.varint()
+	body := d.next(n)
+	if d.err != nil {
+		return nil
+	}
+
+	pd := &decoder{buf: body}
+	var ps properties
+	for pd.remaining() > 0 && pd.err == nil {
+		id := byte(pd.varint())
+		typ, ok := propertyTypes[id]
+		if !ok {
+			d.err = fmt.Errorf("unknown property identifier 0x%02x", id)
+			return nil
+		}
+		var value interface{}
+		switch typ {
+		case propTypeByte:
+			value = pd.byte()
+		case propTypeUint16:
+			value = pd.uint16()
+		case propTypeUint32:
+			value = pd.uint32()
+		case propTypeVarint:
+			value = uint32(pd.varint())
+		case propTypeString:
+			value = pd.string()
+		case propTypeBinary:
+			value = pd.binary()
+		case propTypeStringPair:
+			value = [2]string{pd.string(), pd.string()}
+		}
+		ps.add(id, value)
+	}
+	if pd.err != nil {
+		d.err = pd.err
+		return nil
+	}
+	return ps
+}
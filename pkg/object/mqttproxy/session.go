@@ -38,6 +38,9 @@ type (
 		Topics    map[string]int `json:"topics"`
 		ClientID  string         `json:"clientID"`
 		CleanFlag bool           `json:"cleanFlag"`
+		// ExpiryInterval is the session expiry interval in seconds of
+		// MQTT 5.0 clients.
+		ExpiryInterval uint32 `json:"expiryInterval"`
 	}
 
 	// Session includes the information about the connect between client and broker,
@@ -71,10 +74,10 @@ func newMsg(topic string, payload []byte, qos byte) *Message {
 }
 
 func (s *Session) store() {
-	logger.SpanDebugf(nil, "session %v store", s.info.ClientID)
+	logger.MQTT.SpanDebugf(nil, "session %v store", s.info.ClientID)
 	str, err := s.encode()
 	if err != nil {
-		logger.SpanErrorf(nil, "encode session %+v failed: %v", s, err)
+		logger.MQTT.SpanErrorf(nil, "encode session %+v failed: %v", s, err)
 		return
 	}
 	ss := SessionStore{
@@ -122,8 +125,24 @@ func (s *Session) updateEGName(egName, name string) {
 	s.Unlock()
 }
 
+// setExpiry sets the session expiry interval of MQTT 5.0 clients, sessions
+// with a zero interval end when the connection closes.
+func (s *Session) setExpiry(interval uint32) {
+	s.Lock()
+	s.info.ExpiryInterval = interval
+	s.info.CleanFlag = interval == 0
+	s.store()
+	s.Unlock()
+}
+
+func (s *Session) expiryInterval() uint32 {
+	s.Lock()
+	defer s.Unlock()
+	return s.info.ExpiryInterval
+}
+
 func (s *Session) subscribe(topics []string, qoss []byte) error {
-	logger.SpanDebugf(nil, "session %s sub %v", s.info.ClientID, topics)
+	logger.MQTT.SpanDebugf(nil, "session %s sub %v", s.info.ClientID, topics)
 	s.Lock()
 	for i, t := range topics {
 		s.info.Topics[t] = int(qoss[i])
@@ -134,7 +153,7 @@ func (s *Session) subscribe(topics []string, qoss []byte) error {
 }
 
 func (s *Session) unsubscribe(topics []string) error {
-	logger.SpanDebugf(nil, "session %s unsub %v", s.info.ClientID, topics)
+	logger.MQTT.SpanDebugf(nil, "session %s unsub %v", s.info.ClientID, topics)
 	s.Lock()
 	for _, t := range topics {
 		delete(s.info.Topics, t)
@@ -172,14 +191,14 @@ func (s *Session) getPacketFromMsg(topic string, payload []byte, qos byte) *pack
 func (s *Session) publish(span *model.SpanContext, topic string, payload []byte, qos byte) {
 	client := s.broker.getClient(s.info.ClientID)
 	if client == nil {
-		logger.SpanErrorf(span, "client %s is offline in eg %v", s.info.ClientID, s.broker.egName)
+		logger.MQTT.SpanErrorf(span, "client %s is offline in eg %v", s.info.ClientID, s.broker.egName)
 		return
 	}
 
 	s.Lock()
 	defer s.Unlock()
 
-	logger.SpanDebugf(span, "session %v publish %v", s.info.ClientID, topic)
+	logger.MQTT.SpanDebugf(span, "session %v publish %v", s.info.ClientID, topic)
 	p := s.getPacketFromMsg(topic, payload, qos)
 	if qos == QoS0 {
 		select {
@@ -192,7 +211,7 @@ func (s *Session) publish(span *model.SpanContext, topic string, payload []byte,
 		s.pendingQueue = append(s.pendingQueue, p.MessageID)
 		client.writePacket(p)
 	} else {
-		logger.SpanErrorf(span, "publish message with qos=2 is not supported currently")
+		logger.MQTT.SpanErrorf(span, "publish message with qos=2 is not supported currently")
 	}
 }
 
@@ -228,7 +247,7 @@ func (s *Session) doResend() {
 			p.TopicName = val.Topic
 			payload, err := base64.StdEncoding.DecodeString(val.B64Payload)
 			if err != nil {
-				logger.SpanErrorf(nil, "base64 decode error for Message B64Payload %s", err)
+				logger.MQTT.SpanErrorf(nil, "base64 decode error for Message B64Payload %s", err)
 				return
 			}
 			p.Payload = payload
@@ -236,16 +255,26 @@ func (s *Session) doResend() {
 			if client != nil {
 				client.writePacket(p)
 			} else {
-				logger.SpanDebugf(nil, "session %v do resend but client is nil", s.info.ClientID)
+				logger.MQTT.SpanDebugf(nil, "session %v do resend but client is nil", s.info.ClientID)
 			}
 			return
 		}
 	}
 }
 
+// resendInterval is the interval to resend the pending messages.
+const resendInterval = 200 * time.Millisecond
+
+// hasPending returns whether the session has messages to resend.
+func (s *Session) hasPending() bool {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.pending) > 0
+}
+
 func (s *Session) backgroundResendPending() {
 	debugLogTime := time.Now().Add(time.Minute)
-	ticker := time.NewTicker(200 * time.Millisecond)
+	ticker := time.NewTicker(resendInterval)
 	defer ticker.Stop()
 
 	for {
@@ -256,7 +285,7 @@ func (s *Session) backgroundResendPending() {
 			s.doResend()
 		}
 		if time.Now().After(debugLogTime) {
-			logger.SpanDebugf(nil, "session %v resend", s.info.ClientID)
+			logger.MQTT.SpanDebugf(nil, "session %v resend", s.info.ClientID)
 			debugLogTime = time.Now().Add(time.Minute)
 		}
 	}
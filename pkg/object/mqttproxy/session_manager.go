@@ -19,9 +19,11 @@ package mqttproxy
 
 import (
 	"sync"
+	"time"
 
 	"github.com/eclipse/paho.mqtt.golang/packets"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
 )
 
 type (
@@ -32,6 +34,9 @@ type (
 		store      storage
 		storeCh    chan SessionStore
 		done       chan struct{}
+
+		expiryLock sync.Mutex
+		expiries   map[string]*time.Timer
 	}
 
 	// SessionStore for session store, key is session clientID, value is session json marshal value
@@ -43,10 +48,11 @@ type (
 
 func newSessionManager(b *Broker, store storage) *SessionManager {
 	sm := &SessionManager{
-		broker:  b,
-		store:   store,
-		storeCh: make(chan SessionStore),
-		done:    make(chan struct{}),
+		broker:   b,
+		store:    store,
+		storeCh:  make(chan SessionStore),
+		done:     make(chan struct{}),
+		expiries: make(map[string]*time.Timer),
 	}
 	go sm.doStore()
 	return sm
@@ -54,6 +60,13 @@ func newSessionManager(b *Broker, store storage) *SessionManager {
 
 func (sm *SessionManager) close() {
 	close(sm.done)
+
+	sm.expiryLock.Lock()
+	for clientID, timer := range sm.expiries {
+		timer.Stop()
+		delete(sm.expiries, clientID)
+	}
+	sm.expiryLock.Unlock()
 }
 
 func (sm *SessionManager) doStore() {
@@ -62,10 +75,10 @@ func (sm *SessionManager) doStore() {
 		case <-sm.done:
 			return
 		case kv := <-sm.storeCh:
-			logger.SpanDebugf(nil, "session manager store session %v", kv.key)
+			logger.MQTT.SpanDebugf(nil, "session manager store session %v", kv.key)
 			err := sm.store.put(sessionStoreKey(kv.key), kv.value)
 			if err != nil {
-				logger.SpanErrorf(nil, "put session %v into storage failed: %v", kv.key, err)
+				logger.MQTT.SpanErrorf(nil, "put session %v into storage failed: %v", kv.key, err)
 			}
 		}
 	}
@@ -75,7 +88,9 @@ func (sm *SessionManager) newSessionFromConn(connect *packets.ConnectPacket) *Se
 	s := &Session{}
 	s.init(sm, sm.broker, connect)
 	sm.sessionMap.Store(connect.ClientIdentifier, s)
-	go s.backgroundResendPending()
+	if sm.broker.workers == nil {
+		go s.backgroundResendPending()
+	}
 	return s
 }
 
@@ -92,7 +107,9 @@ func (sm *SessionManager) newSessionFromJSON(str *string) *Session {
 	if err != nil {
 		return nil
 	}
-	go sess.backgroundResendPending()
+	if sm.broker.workers == nil {
+		go sess.backgroundResendPending()
+	}
 	return sess
 }
 
@@ -123,6 +140,57 @@ func (sm *SessionManager) delLocal(clientID string) {
 func (sm *SessionManager) delDB(clientID string) {
 	err := sm.store.delete(sessionStoreKey(clientID))
 	if err != nil {
-		logger.SpanErrorf(nil, "delete session %v failed, %v", err)
+		logger.MQTT.SpanErrorf(nil, "delete session %v failed, %v", err)
+	}
+}
+
+// expireLater deletes the session of an MQTT 5.0 client from storage after
+// the session expiry interval, unless the client connects again before that.
+func (sm *SessionManager) expireLater(clientID string, interval uint32) {
+	if interval == sessionNeverExpire {
+		return
+	}
+
+	sm.expiryLock.Lock()
+	defer sm.expiryLock.Unlock()
+	if timer, ok := sm.expiries[clientID]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(interval)*time.Second, func() {
+		sm.expiryLock.Lock()
+		if sm.expiries[clientID] != timer {
+			sm.expiryLock.Unlock()
+			return
+		}
+		delete(sm.expiries, clientID)
+		sm.expiryLock.Unlock()
+
+		if sm.broker.getClient(clientID) != nil {
+			return
+		}
+		// the client may connect to another member and update the session.
+		str, err := sm.store.get(sessionStoreKey(clientID))
+		if err != nil || str == nil {
+			return
+		}
+		info := &SessionInfo{}
+		if err := codectool.Unmarshal([]byte(*str), info); err != nil || info.EGName != sm.broker.egName {
+			return
+		}
+		logger.MQTT.SpanDebugf(nil, "session %v expired", clientID)
+		sm.delLocal(clientID)
+		sm.delDB(clientID)
+	})
+	sm.expiries[clientID] = timer
+}
+
+// cancelExpiry cancels the session expiry of a client which connects again.
+func (sm *SessionManager) cancelExpiry(clientID string) {
+	sm.expiryLock.Lock()
+	if timer, ok := sm.expiries[clientID]; ok {
+		timer.Stop()
+		delete(sm.expiries, clientID)
 	}
+	sm.expiryLock.Unlock()
 }
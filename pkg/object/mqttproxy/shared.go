@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+// sharedTopicPrefix is the prefix of shared subscriptions, a shared
+// subscription is in the format of "$share/{ShareName}/{filter}".
+const sharedTopicPrefix = "$share/"
+
+// SharedTarget is the client chosen to receive a message of a shared
+// subscription.
+type SharedTarget struct {
+	EGName   string `json:"egName"`
+	ClientID string `json:"clientID"`
+}
+
+// parseSharedTopic returns the topic filter of a shared subscription, and
+// the topic itself if it is not a shared subscription.
+func parseSharedTopic(topic string) (string, bool, error) {
+	if !strings.HasPrefix(topic, sharedTopicPrefix) {
+		return topic, false, nil
+	}
+	rest := topic[len(sharedTopicPrefix):]
+	idx := strings.Index(rest, "/")
+	if idx <= 0 || idx == len(rest)-1 || strings.ContainsAny(rest[:idx], "+#") {
+		return "", false, fmt.Errorf("shared subscription %v is invalid", topic)
+	}
+	return rest[idx+1:], true, nil
+}
+
+// matchTopic returns whether the levels of a topic match the levels of a
+// topic filter.
+func matchTopic(filter, topic []string) bool {
+	for i, level := range filter {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topic) || (level != "+" && level != topic[i]) {
+			return false
+		}
+	}
+	return len(filter) == len(topic)
+}
+
+func (b *Broker) notifySharedChanged() {
+	select {
+	case b.sharedCh <- struct{}{}:
+	default:
+	}
+}
+
+// syncSharedSubscriptions puts the shared subscriptions of the clients
+// connected to this member into storage, so that other members are able to
+// balance messages of shared subscriptions among all clients in the cluster.
+func (b *Broker) syncSharedSubscriptions() {
+	key := sharedSubscriptionStoreKey(b.name, b.egName)
+	stored := false
+	for {
+		select {
+		case <-b.done:
+			if stored {
+				b.sessMgr.store.delete(key)
+			}
+			return
+		case <-b.sharedCh:
+			subs := b.topicMgr.sharedSubscriptions()
+			if len(subs) == 0 {
+				if stored {
+					if err := b.sessMgr.store.delete(key); err != nil {
+						logger.MQTT.SpanErrorf(nil, "delete shared subscriptions of %v failed: %v", b.egName, err)
+					}
+					stored = false
+				}
+				continue
+			}
+			data, err := codectool.MarshalJSON(subs)
+			if err != nil {
+				logger.MQTT.SpanErrorf(nil, "marshal shared subscriptions failed: %v", err)
+				continue
+			}
+			if err = b.sessMgr.store.put(key, string(data)); err != nil {
+				logger.MQTT.SpanErrorf(nil, "put shared subscriptions of %v failed: %v", b.egName, err)
+				continue
+			}
+			stored = true
+		}
+	}
+}
+
+// nextShared returns the index of the next client of a shared subscription
+// with n clients in round robin.
+func (b *Broker) nextShared(sharedTopic string, n int) int {
+	b.sharedMu.Lock()
+	defer b.sharedMu.Unlock()
+	cursor := b.sharedCursors[sharedTopic]
+	b.sharedCursors[sharedTopic] = cursor + 1
+	return int(cursor % uint64(n))
+}
+
+// sharedTargets chooses one client of each shared subscription that matches
+// the topic, among clients connected to all members of the cluster.
+func (b *Broker) sharedTargets(span *model.SpanContext, topic string) map[string]SharedTarget {
+	candidates := make(map[string][]SharedTarget)
+
+	local, err := b.topicMgr.findSharedSubscribers(topic)
+	if err != nil {
+		logger.MQTT.SpanErrorf(span, "find shared subscribers for topic %v failed: %v", topic, err)
+		return map[string]SharedTarget{}
+	}
+	for sharedTopic, clients := range local {
+		for clientID := range clients {
+			candidates[sharedTopic] = append(candidates[sharedTopic], SharedTarget{EGName: b.egName, ClientID: clientID})
+		}
+	}
+
+	prefix := sharedSubscriptionStoreKey(b.name, "")
+	remote, err := b.sessMgr.store.getPrefix(prefix, false)
+	if err != nil {
+		logger.MQTT.SpanErrorf(span, "get shared subscriptions of other members failed: %v", err)
+	}
+	topicLevels, _ := b.topicMgr.getLevels(topic)
+	for key, value := range remote {
+		egName := strings.TrimPrefix(key, prefix)
+		if egName == b.egName {
+			continue
+		}
+		subs := make(map[string][]string)
+		if err := codectool.Unmarshal([]byte(value), &subs); err != nil {
+			logger.MQTT.SpanErrorf(span, "unmarshal shared subscriptions of %v failed: %v", egName, err)
+			continue
+		}
+		for sharedTopic, clients := range subs {
+			filter, _, err := parseSharedTopic(sharedTopic)
+			if err != nil {
+				continue
+			}
+			filterLevels, err := b.topicMgr.getLevels(filter)
+			if err != nil || !matchTopic(filterLevels, topicLevels) {
+				continue
+			}
+			for _, clientID := range clients {
+				candidates[sharedTopic] = append(candidates[sharedTopic], SharedTarget{EGName: egName, ClientID: clientID})
+			}
+		}
+	}
+
+	targets := make(map[string]SharedTarget, len(candidates))
+	for sharedTopic, list := range candidates {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].EGName != list[j].EGName {
+				return list[i].EGName < list[j].EGName
+			}
+			return list[i].ClientID < list[j].ClientID
+		})
+		targets[sharedTopic] = list[b.nextShared(sharedTopic, len(list))]
+	}
+	return targets
+}
+
+// sendMsgToSharedClients sends a message to one client of each matched
+// shared subscription. The clients are chosen by targets, and when targets
+// is nil, or the target of a shared subscription is not chosen or has left,
+// a client connected to this member is chosen in round robin.
+func (b *Broker) sendMsgToSharedClients(span *model.SpanContext, topic string, payload []byte, qos byte, targets map[string]SharedTarget) {
+	subscribers, err := b.topicMgr.findSharedSubscribers(topic)
+	if err != nil {
+		logger.MQTT.SpanErrorf(span, "eg %v find shared subscribers for topic %s failed: %v", b.egName, topic, err)
+		return
+	}
+
+	for sharedTopic, clients := range subscribers {
+		clientID := ""
+		if target, ok := targets[sharedTopic]; ok {
+			if target.EGName != b.egName {
+				continue
+			}
+			if _, ok := clients[target.ClientID]; ok && b.getClient(target.ClientID) != nil {
+				clientID = target.ClientID
+			}
+		}
+		if clientID == "" {
+			online := []string{}
+			for id := range clients {
+				if b.getClient(id) != nil {
+					online = append(online, id)
+				}
+			}
+			if len(online) == 0 {
+				continue
+			}
+			sort.Strings(online)
+			clientID = online[b.nextShared(sharedTopic, len(online))]
+		}
+
+		client := b.getClient(clientID)
+		if client == nil {
+			continue
+		}
+		msgQoS := qos
+		if subQoS := clients[clientID]; subQoS < msgQoS {
+			msgQoS = subQoS
+		}
+		logger.MQTT.SpanDebugf(span, "eg %v send topic %v of shared subscription %v to client %v", b.egName, topic, sharedTopic, clientID)
+		client.session.publish(span, topic, payload, msgQoS)
+	}
+}
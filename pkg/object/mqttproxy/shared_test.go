@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mqttproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSharedTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	filter, shared, err := parseSharedTopic("$share/group/a/+")
+	assert.NoError(err)
+	assert.True(shared)
+	assert.Equal("a/+", filter)
+
+	filter, shared, err = parseSharedTopic("a/b")
+	assert.NoError(err)
+	assert.False(shared)
+	assert.Equal("a/b", filter)
+
+	for _, topic := range []string{"$share/", "$share/group", "$share/group/", "$share//a", "$share/g+/a"} {
+		_, _, err = parseSharedTopic(topic)
+		assert.Error(err, topic)
+	}
+
+	levels := func(topic string) []string {
+		l, _ := splitTopic(topic)
+		return l
+	}
+	assert.True(matchTopic(levels("a/+/c"), levels("a/b/c")))
+	assert.True(matchTopic(levels("a/#"), levels("a")))
+	assert.True(matchTopic(levels("#"), levels("a/b")))
+	assert.False(matchTopic(levels("a/+"), levels("a/b/c")))
+	assert.False(matchTopic(levels("a/b/c"), levels("a/b")))
+}
+
+func TestSharedTopicManager(t *testing.T) {
+	assert := assert.New(t)
+
+	mgr := newTopicManager(100)
+	changed := 0
+	mgr.sharedChanged = func() { changed++ }
+
+	assert.NoError(mgr.subscribe([]string{"$share/g/a/+", "a/b"}, []byte{1, 0}, "c1"))
+	assert.NoError(mgr.subscribe([]string{"$share/g/a/+", "$share/h/a/b"}, []byte{0, 1}, "c2"))
+	assert.Error(mgr.subscribe([]string{"$share/g"}, []byte{0}, "c3"))
+	assert.Equal(3, changed)
+
+	subscribers, err := mgr.findSubscribers("a/b")
+	assert.NoError(err)
+	assert.Equal(map[string]byte{"c1": 0}, subscribers)
+
+	shared, err := mgr.findSharedSubscribers("a/b")
+	assert.NoError(err)
+	assert.Equal(map[string]map[string]byte{
+		"$share/g/a/+": {"c1": 1, "c2": 0},
+		"$share/h/a/b": {"c2": 1},
+	}, shared)
+
+	assert.Equal(map[string][]string{
+		"$share/g/a/+": {"c1", "c2"},
+		"$share/h/a/b": {"c2"},
+	}, mgr.sharedSubscriptions())
+
+	assert.NoError(mgr.unsubscribe([]string{"$share/g/a/+", "$share/h/a/b"}, "c2"))
+	assert.NoError(mgr.unsubscribe([]string{"$share/g/a/+", "a/b"}, "c1"))
+	assert.Empty(mgr.sharedSubscriptions())
+	assert.Empty(mgr.root.nodes)
+}
+
+func TestSharedSubscription(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := getDefaultSpec()
+	spec.Rules = nil
+	broker := getBrokerFromSpec(spec, nil)
+	defer broker.close()
+
+	ch1, ch2, ch3 := make(chan CheckMsg, 10), make(chan CheckMsg, 10), make(chan CheckMsg, 10)
+	c1 := getDefaultMQTTClient(t, "c1", true)
+	c2 := getDefaultMQTTClient(t, "c2", true)
+	c3 := getDefaultMQTTClient(t, "c3", true)
+	defer c1.Disconnect(200)
+	defer c2.Disconnect(200)
+	defer c3.Disconnect(200)
+	c1.Subscribe("$share/g/shared/+", 1, getMQTTSubscribeHandler(ch1)).Wait()
+	c2.Subscribe("$share/g/shared/+", 1, getMQTTSubscribeHandler(ch2)).Wait()
+	c3.Subscribe("shared/+", 1, getMQTTSubscribeHandler(ch3)).Wait()
+
+	// shared subscriptions of this member are synced to storage.
+	key := sharedSubscriptionStoreKey("test", "test")
+	assert.Eventually(func() bool {
+		value, err := broker.sessMgr.store.get(key)
+		return err == nil && strings.Contains(*value, "c2")
+	}, time.Second, 10*time.Millisecond)
+
+	// messages are balanced among clients of the shared subscription.
+	for i := 0; i < 4; i++ {
+		data, _ := codectool.MarshalJSON(HTTPJsonData{Topic: "shared/topic", QoS: 1, Payload: "data"})
+		req := httptest.NewRequest(http.MethodPost, "/mqtt", strings.NewReader(string(data)))
+		broker.httpTopicsPublishHandler(httptest.NewRecorder(), req)
+	}
+	count := func(ch chan CheckMsg) int {
+		n := 0
+		for {
+			select {
+			case <-ch:
+				n++
+			case <-time.After(200 * time.Millisecond):
+				return n
+			}
+		}
+	}
+	assert.Equal(2, count(ch1))
+	assert.Equal(2, count(ch2))
+	assert.Equal(4, count(ch3))
+
+	// clients connected to other members are chosen too.
+	broker.sessMgr.store.put(sharedSubscriptionStoreKey("test", "test1"), `{"$share/g/shared/+": ["remote"]}`)
+	chosen := map[SharedTarget]int{}
+	for i := 0; i < 3; i++ {
+		targets := broker.sharedTargets(nil, "shared/topic")
+		assert.Len(targets, 1)
+		chosen[targets["$share/g/shared/+"]]++
+	}
+	assert.Equal(map[SharedTarget]int{
+		{EGName: "test", ClientID: "c1"}:      1,
+		{EGName: "test", ClientID: "c2"}:      1,
+		{EGName: "test1", ClientID: "remote"}: 1,
+	}, chosen)
+	assert.Empty(broker.sharedTargets(nil, "other/topic"))
+
+	// the message is not sent to local clients if a remote one is chosen,
+	// and a local client is chosen if the target has left.
+	remote := map[string]SharedTarget{"$share/g/shared/+": {EGName: "test1", ClientID: "remote"}}
+	broker.sendMsgToSharedClients(nil, "shared/topic", []byte("data"), QoS1, remote)
+	assert.Equal(0, count(ch1)+count(ch2))
+	left := map[string]SharedTarget{"$share/g/shared/+": {EGName: "test", ClientID: "left"}}
+	broker.sendMsgToSharedClients(nil, "shared/topic", []byte("data"), QoS1, left)
+	assert.Equal(1, count(ch1)+count(ch2))
+}
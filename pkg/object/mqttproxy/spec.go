@@ -20,6 +20,7 @@ package mqttproxy
 import (
 	"crypto/tls"
 	"fmt"
+	"time"
 )
 
 const (
@@ -28,6 +29,14 @@ const (
 	mqttAPITopicPublishPrefix  = "/mqttproxy/%s/topics/publish"
 	mqttAPISessionQueryPrefix  = "/mqttproxy/%s/session/query"
 	mqttAPISessionDeletePrefix = "/mqttproxy/%s/sessions"
+	sharedSubscriptionPrefix   = "/mqtt/sharedSubMgr/%s/member/%s"
+
+	defaultTopicAliasMaximum = 64
+	defaultWriteQueueSize    = 50
+
+	defaultWorkers            = 64
+	defaultWorkerQueueSize    = 1024
+	defaultWorkerWriteTimeout = 10 * time.Second
 )
 
 // PacketType is mqtt packet type
@@ -71,6 +80,33 @@ type (
 		ConnectionLimit      *RateLimit    `json:"connectionLimit" jsonschema:"omitempty"`
 		ClientPublishLimit   *RateLimit    `json:"clientPublishLimit" jsonschema:"omitempty"`
 		Rules                []*Rule       `json:"rules" jsonschema:"omitempty"`
+
+		// TopicAliasMaximum is the max number of topic aliases an MQTT 5.0
+		// client can use in a connection, default 64.
+		TopicAliasMaximum uint16 `json:"topicAliasMaximum" jsonschema:"omitempty"`
+		// MaxSessionExpiryInterval limits the session expiry interval in
+		// seconds requested by MQTT 5.0 clients, 0 means no limit.
+		MaxSessionExpiryInterval uint32 `json:"maxSessionExpiryInterval" jsonschema:"omitempty"`
+		// WriteQueueSize is the number of the packets waiting to be written
+		// to a client, writing to a client blocks if its queue is full,
+		// default 50.
+		WriteQueueSize int `json:"writeQueueSize" jsonschema:"omitempty,minimum=0"`
+		// WorkerPool shares a pool of goroutines among the clients to write
+		// the packets and resend the pending messages, instead of starting
+		// goroutines per client.
+		WorkerPool *WorkerPoolSpec `json:"workerPool,omitempty" jsonschema:"omitempty"`
+	}
+
+	// WorkerPoolSpec describes the worker pool shared by the clients.
+	WorkerPoolSpec struct {
+		// Workers is the number of the workers, default 64.
+		Workers int `json:"workers" jsonschema:"omitempty,minimum=0"`
+		// QueueSize is the number of the tasks waiting for the workers,
+		// submitting a task blocks if the queue is full, default 1024.
+		QueueSize int `json:"queueSize" jsonschema:"omitempty,minimum=0"`
+		// WriteTimeout is the timeout to write a packet to a client, so
+		// that slow clients don't hold the workers, default 10s.
+		WriteTimeout string `json:"writeTimeout" jsonschema:"omitempty,format=duration"`
 	}
 
 	// Rule used to route MQTT packets to different pipelines
@@ -119,6 +155,18 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 	return &tls.Config{Certificates: certificates}, nil
 }
 
+func (spec *WorkerPoolSpec) writeTimeout() time.Duration {
+	d, err := time.ParseDuration(spec.WriteTimeout)
+	if err != nil || d <= 0 {
+		return defaultWorkerWriteTimeout
+	}
+	return d
+}
+
 func sessionStoreKey(clientID string) string {
 	return fmt.Sprintf(sessionPrefix, clientID)
 }
+
+func sharedSubscriptionStoreKey(name, egName string) string {
+	return fmt.Sprintf(sharedSubscriptionPrefix, name, egName)
+}
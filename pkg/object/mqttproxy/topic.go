@@ -19,6 +19,7 @@ package mqttproxy
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -30,6 +31,9 @@ type TopicManager struct {
 	sync.RWMutex
 	root     *topicNode
 	levelMgr *topicLevelManager
+
+	// sharedChanged is called when shared subscriptions change.
+	sharedChanged func()
 }
 
 type topicLevelManager struct {
@@ -84,14 +88,39 @@ func (mgr *TopicManager) unsubscribe(topics []string, clientID string) error {
 // so, clients subscribe topics that contain or not contain wildcard, and this function will find all subscribed topics that match
 // the given topic.
 func (mgr *TopicManager) findSubscribers(topic string) (map[string]byte, error) {
+	ans := make(map[string]byte)
+	err := mgr.match(topic, func(node *topicNode) {
+		node.addClients(ans)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// findSharedSubscribers finds the shared subscriptions that match the topic,
+// the result maps shared subscriptions like "$share/group/loc/+" to their
+// clients with qos.
+func (mgr *TopicManager) findSharedSubscribers(topic string) (map[string]map[string]byte, error) {
+	ans := make(map[string]map[string]byte)
+	err := mgr.match(topic, func(node *topicNode) {
+		node.addSharedClients(ans)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// match calls fn with all nodes whose topic filter matches the topic.
+func (mgr *TopicManager) match(topic string, fn func(node *topicNode)) error {
 	mgr.RLock()
 	defer mgr.RUnlock()
 
 	levels, err := mgr.getLevels(topic)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	ans := make(map[string]byte)
 
 	currentLevelNodes := []*topicNode{mgr.root}
 	for _, topicLevel := range levels {
@@ -99,7 +128,7 @@ func (mgr *TopicManager) findSubscribers(topic string) (map[string]byte, error)
 		for _, node := range currentLevelNodes {
 			for nodeLevel, nextNode := range node.nodes {
 				if nodeLevel == "#" {
-					nextNode.addClients(ans)
+					fn(nextNode)
 
 				} else if nodeLevel == "+" || nodeLevel == topicLevel {
 					nextLevelNodes = append(nextLevelNodes, nextNode)
@@ -108,22 +137,49 @@ func (mgr *TopicManager) findSubscribers(topic string) (map[string]byte, error)
 		}
 		currentLevelNodes = nextLevelNodes
 		if len(currentLevelNodes) == 0 {
-			return ans, nil
+			return nil
 		}
 	}
 	for _, n := range currentLevelNodes {
-		n.addClients(ans)
+		fn(n)
 		// in MQTT version 3.1.1 section 4.7.1.2, topic "sport/tennis/player1/#" would receive msg from "sport/tennis/player1"
 		// which means when we reach end of topic level, we need check one more level for wildcard #
 		if val, ok := n.nodes["#"]; ok {
-			val.addClients(ans)
+			fn(val)
 		}
 	}
-	return ans, nil
+	return nil
+}
+
+// sharedSubscriptions returns all shared subscriptions with their clients.
+func (mgr *TopicManager) sharedSubscriptions() map[string][]string {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	ans := make(map[string][]string)
+	nodes := []*topicNode{mgr.root}
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		for topic, clients := range node.shared {
+			for client := range clients {
+				ans[topic] = append(ans[topic], client)
+			}
+			sort.Strings(ans[topic])
+		}
+		for _, next := range node.nodes {
+			nodes = append(nodes, next)
+		}
+	}
+	return ans
 }
 
 func (mgr *TopicManager) insert(topic string, qos byte, clientID string) error {
-	levels, err := mgr.getLevels(topic)
+	filter, shared, err := parseSharedTopic(topic)
+	if err != nil {
+		return err
+	}
+	levels, err := mgr.getLevels(filter)
 	if err != nil {
 		return err
 	}
@@ -138,12 +194,26 @@ func (mgr *TopicManager) insert(topic string, qos byte, clientID string) error {
 		}
 		node = nextNode
 	}
-	node.clients[clientID] = qos
+	if !shared {
+		node.clients[clientID] = qos
+		return nil
+	}
+	if node.shared[topic] == nil {
+		node.shared[topic] = make(map[string]byte)
+	}
+	node.shared[topic][clientID] = qos
+	if mgr.sharedChanged != nil {
+		mgr.sharedChanged()
+	}
 	return nil
 }
 
 func (mgr *TopicManager) remove(topic string, clientID string) error {
-	levels, err := mgr.getLevels(topic)
+	filter, shared, err := parseSharedTopic(topic)
+	if err != nil {
+		return err
+	}
+	levels, err := mgr.getLevels(filter)
 	if err != nil {
 		return err
 	}
@@ -158,12 +228,22 @@ func (mgr *TopicManager) remove(topic string, clientID string) error {
 		prevNodes = append(prevNodes, node)
 		node = nextNode
 	}
-	delete(node.clients, clientID)
+	if !shared {
+		delete(node.clients, clientID)
+	} else if clients, ok := node.shared[topic]; ok {
+		delete(clients, clientID)
+		if len(clients) == 0 {
+			delete(node.shared, topic)
+		}
+		if mgr.sharedChanged != nil {
+			mgr.sharedChanged()
+		}
+	}
 
 	// clear memory
 	for i := len(prevNodes) - 1; i >= 0; i-- {
 		node = prevNodes[i].nodes[levels[i]]
-		if len(node.clients) == 0 && len(node.nodes) == 0 {
+		if len(node.clients) == 0 && len(node.shared) == 0 && len(node.nodes) == 0 {
 			delete(prevNodes[i].nodes, levels[i])
 		} else {
 			return nil
@@ -223,12 +303,15 @@ func (t *topicLevelManager) get(topic string) ([]string, error) {
 type topicNode struct {
 	// client with their qos
 	clients map[string]byte
-	nodes   map[string]*topicNode
+	// shared subscriptions with their clients and qos
+	shared map[string]map[string]byte
+	nodes  map[string]*topicNode
 }
 
 func newNode() *topicNode {
 	return &topicNode{
 		clients: make(map[string]byte),
+		shared:  make(map[string]map[string]byte),
 		nodes:   make(map[string]*topicNode),
 	}
 }
@@ -238,3 +321,14 @@ func (node *topicNode) addClients(ans map[string]byte) {
 		ans[client] = qos
 	}
 }
+
+func (node *topicNode) addSharedClients(ans map[string]map[string]byte) {
+	for topic, clients := range node.shared {
+		if ans[topic] == nil {
+			ans[topic] = make(map[string]byte)
+		}
+		for client, qos := range clients {
+			ans[topic][client] = qos
+		}
+	}
+}
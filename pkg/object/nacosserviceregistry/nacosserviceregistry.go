@@ -405,6 +405,9 @@ func (n *NacosServiceRegistry) ListServiceInstances(serviceName string) (map[str
 
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
 	for _, nacosInstance := range service.Hosts {
+		if !isAvailable(&nacosInstance) {
+			continue
+		}
 		serviceInstance := n.nacosInstanceToServiceInstance(&nacosInstance)
 		err := serviceInstance.Validate()
 		if err != nil {
@@ -456,6 +459,9 @@ func (n *NacosServiceRegistry) ListAllServiceInstances() (map[string]*servicereg
 		}
 
 		for _, nacosInstance := range service.Hosts {
+			if !isAvailable(&nacosInstance) {
+				continue
+			}
 			serviceInstance := n.nacosInstanceToServiceInstance(&nacosInstance)
 			err := serviceInstance.Validate()
 			if err != nil {
@@ -493,6 +499,12 @@ func (n *NacosServiceRegistry) serviceInstanceToDeregisterInstance(instance *ser
 	}
 }
 
+// isAvailable returns whether the instance is healthy, enabled and has a
+// positive weight, the other instances are not listed.
+func isAvailable(instance *model.Instance) bool {
+	return instance.Healthy && instance.Enable && instance.Weight > 0
+}
+
 func (n *NacosServiceRegistry) nacosInstanceToServiceInstance(nacosInstance *model.Instance) *serviceregistry.ServiceInstanceSpec {
 	instanceID := nacosInstance.Metadata[MetaKeyInstanceID]
 	if instanceID == "" {
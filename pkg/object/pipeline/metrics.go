@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/util/prometheushelper"
+)
+
+// The Prometheus metrics of pipelines and filters. The label of a filter is
+// its alias in the flow, so that a filter used more than once in a flow is
+// measured separately.
+var (
+	pipelineRequests = prometheushelper.NewCounter(
+		"pipeline_requests_total",
+		"The number of requests handled by the pipeline, by the final result.",
+		[]string{"pipeline", "result"},
+	)
+	pipelineDuration = prometheushelper.NewHistogram(
+		"pipeline_request_duration_seconds",
+		"The duration of the requests handled by the pipeline.",
+		prometheushelper.DurationBuckets,
+		[]string{"pipeline"},
+	)
+	filterRequests = prometheushelper.NewCounter(
+		"filter_requests_total",
+		"The number of invocations of the filter, by the result.",
+		[]string{"pipeline", "filter", "kind", "result"},
+	)
+	filterDuration = prometheushelper.NewHistogram(
+		"filter_duration_seconds",
+		"The duration of the invocations of the filter.",
+		prometheushelper.DurationBuckets,
+		[]string{"pipeline", "filter", "kind"},
+	)
+)
+
+type (
+	// pipelineMetrics are the metrics of a pipeline.
+	pipelineMetrics struct {
+		name     string
+		duration prometheus.Observer
+	}
+
+	// filterMetrics are the metrics of a filter in the flow.
+	filterMetrics struct {
+		pipeline string
+		alias    string
+		kind     string
+		duration prometheus.Observer
+	}
+)
+
+func newPipelineMetrics(name string) *pipelineMetrics {
+	return &pipelineMetrics{
+		name:     name,
+		duration: pipelineDuration.WithLabelValues(name),
+	}
+}
+
+func (m *pipelineMetrics) observe(result string, d time.Duration) {
+	pipelineRequests.WithLabelValues(m.name, result).Inc()
+	m.duration.Observe(d.Seconds())
+}
+
+func newFilterMetrics(pipeline, alias, kind string) *filterMetrics {
+	return &filterMetrics{
+		pipeline: pipeline,
+		alias:    alias,
+		kind:     kind,
+		duration: filterDuration.WithLabelValues(pipeline, alias, kind),
+	}
+}
+
+func (m *filterMetrics) observe(result string, d time.Duration) {
+	filterRequests.WithLabelValues(m.pipeline, m.alias, m.kind, result).Inc()
+	m.duration.Observe(d.Seconds())
+}
@@ -0,0 +1,95 @@
+/*
+* Copyright (c) 2017, MegaEase
+* All rights reserved.
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	filters.Register(MockFilterKind("Filter1", nil))
+	defer cleanup()
+
+	newPipeline := func(yamlConfig string) *Pipeline {
+		spec, err := supervisor.NewSpec(yamlConfig)
+		assert.Nil(err)
+		p := &Pipeline{}
+		p.Init(spec, nil)
+		return p
+	}
+
+	pipeline := newPipeline(`
+name: metrics-pipeline
+kind: Pipeline
+flow:
+  - filter: filter1
+  - filter: filter1
+    alias: filter1-again
+filters:
+  - name: filter1
+    kind: Filter1
+`)
+	defer pipeline.Close()
+
+	before := newPipeline(`
+name: metrics-before
+kind: Pipeline
+flow:
+  - filter: filter2
+filters:
+  - name: filter2
+    kind: Filter1
+`)
+	defer before.Close()
+
+	stdReq, err := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+	assert.Nil(err)
+	req, err := httpprot.NewRequest(stdReq)
+	assert.Nil(err)
+
+	for i := 0; i < 3; i++ {
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		pipeline.Handle(ctx)
+	}
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	pipeline.HandleWithBeforeAfter(ctx, before, nil)
+
+	assert.Equal(4.0, testutil.ToFloat64(pipelineRequests.WithLabelValues("metrics-pipeline", "")))
+	assert.Equal(4.0, testutil.ToFloat64(filterRequests.WithLabelValues("metrics-pipeline", "filter1", "Filter1", "")))
+	assert.Equal(4.0, testutil.ToFloat64(filterRequests.WithLabelValues("metrics-pipeline", "filter1-again", "Filter1", "")))
+
+	// the filters of the before pipeline are labeled by its own name.
+	assert.Equal(1.0, testutil.ToFloat64(filterRequests.WithLabelValues("metrics-before", "filter2", "Filter1", "")))
+	assert.Equal(0.0, testutil.ToFloat64(pipelineRequests.WithLabelValues("metrics-before", "")))
+
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import "github.com/megaease/easegress/pkg/context"
+
+// FilterObserverKey is the key of the FilterObserver in the context data.
+// Tools debugging the pipelines, like egctl tryout, set an observer to the
+// context to be notified before and after every filter is executed.
+const FilterObserverKey = "PIPELINE_FILTER_OBSERVER"
+
+// FilterObserver observes the execution of the filters of a pipeline.
+type FilterObserver interface {
+	// BeforeFilter is called before a filter is executed.
+	BeforeFilter(ctx *context.Context, name, kind string)
+	// AfterFilter is called after a filter is executed.
+	AfterFilter(ctx *context.Context, stat *FilterStat)
+}
+
+func getFilterObserver(ctx *context.Context) FilterObserver {
+	if o, ok := ctx.GetData(FilterObserverKey).(FilterObserver); ok {
+		return o
+	}
+	return nil
+}
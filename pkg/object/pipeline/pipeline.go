@@ -19,16 +19,25 @@ package pipeline
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/resilience"
 	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/megaease/easegress/pkg/util/easemonitor"
+	"github.com/megaease/easegress/pkg/util/expression"
 	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/resources"
 	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/urlrule"
 )
 
 const (
@@ -40,6 +49,13 @@ const (
 
 	// BuiltInFilterEnd is the name of the build-in end filter.
 	BuiltInFilterEnd = "END"
+
+	// resultTemplateNotFound is the result of the pipeline if one of its
+	// templates is not available.
+	resultTemplateNotFound = "templateNotFound"
+	// resultResourceLimited is the result of the pipeline if the request
+	// is rejected by the resource limits.
+	resultResourceLimited = "resourceLimited"
 )
 
 func init() {
@@ -59,23 +75,90 @@ type (
 		filters    map[string]filters.Filter
 		flow       []FlowNode
 		resilience map[string]resilience.Policy
+		metrics    *pipelineMetrics
+		resources  *resources.Tracker
+
+		// whether any filter requires the full request/response bodies.
+		requestBody  bool
+		responseBody bool
 	}
 
 	// Spec describes the Pipeline.
 	Spec struct {
+		// Templates are run in order before the flow.
+		Templates  []*TemplateRef           `json:"templates" jsonschema:"omitempty"`
 		Flow       []FlowNode               `json:"flow" jsonschema:"omitempty"`
 		Filters    []map[string]interface{} `json:"filters" jsonschema:"required"`
 		Resilience []map[string]interface{} `json:"resilience" jsonschema:"omitempty"`
 		Data       map[string]interface{}   `json:"data" jsonschema:"omitempty"`
+		// Limits are the hard limits of the resources used by the
+		// pipeline, the requests exceeding them are rejected.
+		Limits *resources.Limits `json:"limits" jsonschema:"omitempty"`
 	}
 
-	// FlowNode describes one node of the pipeline flow.
+	// FlowNode describes one node of the pipeline flow, a node runs either
+	// a filter or several filters in parallel.
 	FlowNode struct {
-		FilterName  string            `json:"filter" jsonschema:"required,format=urlname"`
+		FilterName  string            `json:"filter" jsonschema:"omitempty,format=urlname"`
 		FilterAlias string            `json:"alias" jsonschema:"omitempty"`
 		Namespace   string            `json:"namespace" jsonshema:"omitempty"`
 		JumpIf      map[string]string `json:"jumpIf" jsonschema:"omitempty"`
+		// When skips the node if the request does not match it.
+		When *Condition `json:"when" jsonschema:"omitempty"`
+		// JumpWhen is checked in order if the node returns an empty
+		// result, the first matched one decides the next node.
+		JumpWhen []*ConditionalJump `json:"jumpWhen" jsonschema:"omitempty"`
+		// Parallel are the branches running concurrently, every branch
+		// has one filter, and the node returns the first non-empty result
+		// of the branches in order.
+		Parallel []*Branch `json:"parallel" jsonschema:"omitempty"`
+		filter   filters.Filter
+		metrics  *filterMetrics
+	}
+
+	// Branch is a branch of a parallel flow node.
+	Branch struct {
+		FilterName  string `json:"filter" jsonschema:"required,format=urlname"`
+		FilterAlias string `json:"alias" jsonschema:"omitempty"`
+		Namespace   string `json:"namespace" jsonschema:"omitempty"`
 		filter      filters.Filter
+		metrics     *filterMetrics
+	}
+
+	// Condition is a predicate on the HTTP request of the namespace of the
+	// node, all of the non-empty fields must match. Requests of other
+	// protocols never match.
+	Condition struct {
+		Methods []string                        `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		Path    *urlrule.StringMatch            `json:"path" jsonschema:"omitempty"`
+		Headers map[string]*urlrule.StringMatch `json:"headers" jsonschema:"omitempty"`
+		// Expression is a CEL expression on the request, e.g.
+		// request.header["x-debug"] == "1" && request.method == "POST".
+		Expression string `json:"expression" jsonschema:"omitempty"`
+		expr       *expression.Expression
+	}
+
+	// ConditionalJump jumps to Target if the request matches the condition.
+	ConditionalJump struct {
+		Condition `json:",inline"`
+		Target    string `json:"target" jsonschema:"required"`
+	}
+
+	// TemplateRef references a filter template, which is a business
+	// controller, e.g. FilterTemplate, implementing the Template interface.
+	TemplateRef struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Overrides overrides the top level fields of the filters of the
+		// template for this pipeline, the key is the filter name.
+		Overrides map[string]map[string]interface{} `json:"overrides" jsonschema:"omitempty"`
+		key       string
+	}
+
+	// Template is a reusable chain of filters referenced by pipelines.
+	Template interface {
+		// GetPipeline returns the pipeline running the filters of the
+		// template for the pipeline named owner.
+		GetPipeline(owner string, ref *TemplateRef) (*Pipeline, error)
 	}
 
 	// FilterStat records the statistics of a filter.
@@ -88,8 +171,9 @@ type (
 
 	// Status is the status of Pipeline.
 	Status struct {
-		Health  string                 `json:"health"`
-		Filters map[string]interface{} `json:"filters"`
+		Health    string                 `json:"health"`
+		Filters   map[string]interface{} `json:"filters"`
+		Resources *resources.Usage       `json:"resources"`
 	}
 )
 
@@ -100,32 +184,157 @@ func (fn *FlowNode) filterAlias() string {
 	return fn.FilterName
 }
 
+// Key returns a string identifying the overrides of the reference.
+func (r *TemplateRef) Key() string {
+	if r.key == "" {
+		r.key = string(codectool.MustMarshalJSON(r.Overrides))
+	}
+	return r.key
+}
+
+func (b *Branch) filterAlias() string {
+	if b.FilterAlias != "" {
+		return b.FilterAlias
+	}
+	return b.FilterName
+}
+
+func (fn *FlowNode) name() string {
+	if alias := fn.filterAlias(); alias != "" {
+		return alias
+	}
+	return "parallel"
+}
+
+// Validate validates Condition.
+func (c *Condition) Validate() error {
+	if c.Path != nil {
+		if err := c.Path.Validate(); err != nil {
+			return fmt.Errorf("path: %v", err)
+		}
+	}
+	for k, v := range c.Headers {
+		if v == nil {
+			return fmt.Errorf("header %s: no match rule", k)
+		}
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("header %s: %v", k, err)
+		}
+	}
+	if c.Expression != "" {
+		if _, err := expression.Compile(c.Expression); err != nil {
+			return fmt.Errorf("expression: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) init() {
+	if c.Path != nil {
+		c.Path.Init()
+	}
+	for _, v := range c.Headers {
+		v.Init()
+	}
+	if c.Expression != "" {
+		c.expr = expression.MustCompile(c.Expression)
+	}
+}
+
+// match matches the condition against the request of namespace ns.
+func (c *Condition) match(ctx *context.Context, ns string) bool {
+	if ns == "" {
+		ns = context.DefaultNamespace
+	}
+	req, ok := ctx.GetRequest(ns).(*httpprot.Request)
+	if !ok {
+		return false
+	}
+
+	if len(c.Methods) > 0 && !stringtool.StrInSlice(req.Method(), c.Methods) {
+		return false
+	}
+	if c.Path != nil && !c.Path.Match(req.Path()) {
+		return false
+	}
+	for k, v := range c.Headers {
+		if !v.Match(req.HTTPHeader().Get(k)) {
+			return false
+		}
+	}
+	if c.expr != nil && !c.expr.Match(req) {
+		return false
+	}
+	return true
+}
+
 // ValidateJumpIf validates whether the target of JumpIfs are valid or not.
 func (s *Spec) ValidateJumpIf(specs map[string]filters.Spec) {
 	validTargets := map[string]int{BuiltInFilterEnd: 1}
+	validateTarget := func(node *FlowNode, target string) {
+		if count := validTargets[target]; count == 0 {
+			msgFmt := "filter %s: target filter %s not found"
+			panic(fmt.Errorf(msgFmt, node.name(), target))
+		} else if count > 1 {
+			panic(fmt.Errorf("duplicated filter name/alias: %s", target))
+		}
+	}
+
 	for i := len(s.Flow) - 1; i >= 0; i-- {
 		node := &s.Flow[i]
 		if node.FilterName == BuiltInFilterEnd {
 			continue
 		}
-		spec := specs[node.FilterName]
-		if spec == nil {
-			panic(fmt.Errorf("filter %s not found", node.FilterName))
+
+		var results []string
+		if len(node.Parallel) > 0 {
+			if node.FilterName != "" {
+				panic(fmt.Errorf("filter %s: filter and parallel are exclusive", node.FilterName))
+			}
+			for _, branch := range node.Parallel {
+				if branch.FilterName == BuiltInFilterEnd {
+					panic(fmt.Errorf("can't use %s(built-in) in parallel", branch.FilterName))
+				}
+				spec := specs[branch.FilterName]
+				if spec == nil {
+					panic(fmt.Errorf("filter %s not found", branch.FilterName))
+				}
+				results = append(results, filters.GetKind(spec.Kind()).Results...)
+			}
+		} else {
+			if node.FilterName == "" {
+				panic(fmt.Errorf("neither filter nor parallel is specified"))
+			}
+			spec := specs[node.FilterName]
+			if spec == nil {
+				panic(fmt.Errorf("filter %s not found", node.FilterName))
+			}
+			results = filters.GetKind(spec.Kind()).Results
 		}
-		results := filters.GetKind(spec.Kind()).Results
+
 		for result, target := range node.JumpIf {
 			if result != "" && !stringtool.StrInSlice(result, results) {
 				msgFmt := "filter %s: result %s is not in %v"
-				panic(fmt.Errorf(msgFmt, node.FilterName, result, results))
+				panic(fmt.Errorf(msgFmt, node.name(), result, results))
+			}
+			validateTarget(node, target)
+		}
+
+		if node.When != nil {
+			if err := node.When.Validate(); err != nil {
+				panic(fmt.Errorf("filter %s: when: %v", node.name(), err))
 			}
-			if count := validTargets[target]; count == 0 {
-				msgFmt := "filter %s: target filter %s not found"
-				panic(fmt.Errorf(msgFmt, node.FilterName, target))
-			} else if count > 1 {
-				panic(fmt.Errorf("duplicated filter name/alias: %s", target))
+		}
+		for _, jump := range node.JumpWhen {
+			if err := jump.Validate(); err != nil {
+				panic(fmt.Errorf("filter %s: jumpWhen: %v", node.name(), err))
 			}
+			validateTarget(node, jump.Target)
+		}
+
+		if alias := node.filterAlias(); alias != "" {
+			validTargets[alias]++
 		}
-		validTargets[node.filterAlias()]++
 	}
 }
 
@@ -163,7 +372,20 @@ func (s *Spec) Validate() (err error) {
 	errPrefix = "flow"
 	s.ValidateJumpIf(specs)
 
-	// 3: validate resilience
+	// 3: validate templates
+	errPrefix = "templates"
+	for _, ref := range s.Templates {
+		for name, fields := range ref.Overrides {
+			if _, ok := fields["name"]; ok {
+				panic(fmt.Errorf("template %s: can't override the name of filter %s", ref.Name, name))
+			}
+			if _, ok := fields["kind"]; ok {
+				panic(fmt.Errorf("template %s: can't override the kind of filter %s", ref.Name, name))
+			}
+		}
+	}
+
+	// 4: validate resilience
 	for _, r := range s.Resilience {
 		_, err := resilience.NewPolicy(r)
 		if err != nil {
@@ -278,6 +500,9 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 		if r, ok := filter.(filters.Resiliencer); ok {
 			r.InjectResiliencePolicy(p.resilience)
 		}
+		reqBody, respBody := filters.RequiresBody(filter)
+		p.requestBody = p.requestBody || reqBody
+		p.responseBody = p.responseBody || respBody
 
 		// add the filter to pipeline, and if the pipeline does not define a
 		// flow, append it to the flow we just created.
@@ -288,12 +513,43 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 	}
 
 	p.flow = flow
+	p.metrics = newPipelineMetrics(pipelineName)
+
+	// the resources are tracked across the generations, as the requests
+	// being handled by the previous generation are still in flight.
+	if previousGeneration != nil && previousGeneration.resources != nil {
+		p.resources = previousGeneration.resources
+		p.resources.SetLimits(p.spec.Limits)
+	} else {
+		p.resources = resources.NewTracker(p.spec.Limits)
+	}
+
+	// compute the keys in advance to avoid doing it when handling.
+	for _, ref := range p.spec.Templates {
+		ref.Key()
+	}
 
 	// bind filter instance to flow node.
 	for i := range flow {
 		node := &flow[i]
-		if node.FilterName != BuiltInFilterEnd {
+		if node.When != nil {
+			node.When.init()
+		}
+		for _, jump := range node.JumpWhen {
+			jump.init()
+		}
+		// the branches share the request, whose body could be read only
+		// once if it is a stream.
+		if len(node.Parallel) > 0 {
+			p.requestBody = true
+		}
+		for _, branch := range node.Parallel {
+			branch.filter = p.filters[branch.FilterName]
+			branch.metrics = newFilterMetrics(pipelineName, branch.filterAlias(), branch.filter.Kind().Name)
+		}
+		if node.FilterName != BuiltInFilterEnd && node.FilterName != "" {
 			node.filter = p.filters[node.FilterName]
+			node.metrics = newFilterMetrics(pipelineName, node.filterAlias(), node.filter.Kind().Name)
 		}
 	}
 }
@@ -309,6 +565,13 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 		ctx.SetData("PIPELINE", p.spec.Data)
 	}
 
+	bodyBytes := bufferedBodyBytes(ctx)
+	if !p.resources.BeginRequest(bodyBytes) {
+		return p.rejectRequest(ctx)
+	}
+	defer p.resources.EndRequest(bodyBytes)
+
+	start := fasttime.Now()
 	result, sawEnd := "", false
 	flowLen := len(p.flow)
 	if before != nil {
@@ -320,7 +583,11 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 	stats := make([]FilterStat, 0, flowLen)
 
 	if before != nil {
-		result, stats, sawEnd = p.doHandle(ctx, before.flow, stats)
+		result, stats, sawEnd = before.doHandle(ctx, before.flow, stats)
+	}
+
+	if !sawEnd {
+		result, stats, sawEnd = p.handleTemplates(ctx, stats)
 	}
 
 	if !sawEnd {
@@ -328,8 +595,9 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 	}
 
 	if !sawEnd && after != nil {
-		result, stats, sawEnd = p.doHandle(ctx, after.flow, stats)
+		result, stats, sawEnd = after.doHandle(ctx, after.flow, stats)
 	}
+	p.metrics.observe(result, fasttime.Since(start))
 
 	ctx.LazyAddTag(func() string {
 		return p.serializeStats(stats)
@@ -343,8 +611,19 @@ func (p *Pipeline) Handle(ctx *context.Context) string {
 		ctx.SetData("PIPELINE", p.spec.Data)
 	}
 
+	bodyBytes := bufferedBodyBytes(ctx)
+	if !p.resources.BeginRequest(bodyBytes) {
+		return p.rejectRequest(ctx)
+	}
+	defer p.resources.EndRequest(bodyBytes)
+
+	start := fasttime.Now()
 	stats := make([]FilterStat, 0, len(p.flow))
-	result, stats, _ := p.doHandle(ctx, p.flow, stats)
+	result, stats, sawEnd := p.handleTemplates(ctx, stats)
+	if !sawEnd {
+		result, stats, _ = p.doHandle(ctx, p.flow, stats)
+	}
+	p.metrics.observe(result, fasttime.Since(start))
 
 	ctx.LazyAddTag(func() string {
 		return p.serializeStats(stats)
@@ -352,6 +631,52 @@ func (p *Pipeline) Handle(ctx *context.Context) string {
 	return result
 }
 
+// RequiresBody returns whether any filter of the pipeline, including the
+// ones of the templates, requires the full bodies of the requests and
+// responses.
+func (p *Pipeline) RequiresBody() (request, response bool) {
+	request, response = p.requestBody, p.responseBody
+	for _, ref := range p.spec.Templates {
+		if request && response {
+			break
+		}
+		t := getTemplate(p.superSpec.Super(), ref.Name)
+		if t == nil {
+			continue
+		}
+		tp, err := t.GetPipeline(p.superSpec.Name(), ref)
+		if err != nil {
+			continue
+		}
+		request = request || tp.requestBody
+		response = response || tp.responseBody
+	}
+	return
+}
+
+// bufferedBodyBytes returns the size of the request body buffered in memory.
+func bufferedBodyBytes(ctx *context.Context) int64 {
+	req := ctx.GetInputRequest()
+	if req == nil || req.IsStream() {
+		return 0
+	}
+	return int64(len(req.RawPayload()))
+}
+
+// rejectRequest rejects the request exceeding the resource limits, HTTP
+// requests are responded with 503.
+func (p *Pipeline) rejectRequest(ctx *context.Context) string {
+	logger.Debugf("pipeline %s: request rejected by the resource limits", p.superSpec.Name())
+	ctx.AddTag("resource limited")
+	if _, ok := ctx.GetInputRequest().(*httpprot.Request); ok {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.SetResponse(context.DefaultNamespace, resp)
+	}
+	p.metrics.observe(resultResourceLimited, 0)
+	return resultResourceLimited
+}
+
 func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []FilterStat) (string, []FilterStat, bool) {
 	result, next, sawEnd := "", "", false
 
@@ -368,22 +693,18 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 			break
 		}
 
-		start := fasttime.Now()
-		ctx.UseNamespace(node.Namespace)
-
-		result = node.filter.Handle(ctx)
-		stats = append(stats, FilterStat{
-			Name:     alias,
-			Kind:     node.filter.Kind().Name,
-			Duration: fasttime.Since(start),
-			Result:   result,
-		})
+		if node.When != nil && !node.When.match(ctx, node.Namespace) {
+			next = ""
+			continue
+		}
 
-		var ok bool
-		if next, ok = node.JumpIf[result]; result != "" && !ok {
-			next = BuiltInFilterEnd
+		if len(node.Parallel) > 0 {
+			result, stats = p.handleParallel(ctx, node, stats)
+		} else {
+			result, stats = p.handleNode(ctx, node, stats)
 		}
 
+		next = node.nextNode(ctx, result)
 		if next == BuiltInFilterEnd {
 			sawEnd = true
 			break
@@ -393,10 +714,208 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 	return result, stats, sawEnd
 }
 
+// getTemplate returns the template of name, it is a variable for testing.
+var getTemplate = func(super *supervisor.Supervisor, name string) Template {
+	if super == nil {
+		return nil
+	}
+	entity, ok := super.GetBusinessController(name)
+	if !ok {
+		return nil
+	}
+	t, _ := entity.Instance().(Template)
+	return t
+}
+
+// handleTemplates runs the templates of the pipeline in order, the pipeline
+// ends if a template is not available, so that the requests don't bypass
+// the filters of the template, e.g. authentication.
+func (p *Pipeline) handleTemplates(ctx *context.Context, stats []FilterStat) (string, []FilterStat, bool) {
+	result, sawEnd := "", false
+
+	for _, ref := range p.spec.Templates {
+		t := getTemplate(p.superSpec.Super(), ref.Name)
+		if t == nil {
+			logger.Errorf("pipeline %s: template %s not found", p.superSpec.Name(), ref.Name)
+			return resultTemplateNotFound, stats, true
+		}
+
+		tp, err := t.GetPipeline(p.superSpec.Name(), ref)
+		if err != nil {
+			logger.Errorf("pipeline %s: template %s: %v", p.superSpec.Name(), ref.Name, err)
+			return resultTemplateNotFound, stats, true
+		}
+
+		result, stats, sawEnd = tp.doHandle(ctx, tp.flow, stats)
+		if sawEnd {
+			break
+		}
+	}
+
+	return result, stats, sawEnd
+}
+
+// handleNode runs the filter of node.
+func (p *Pipeline) handleNode(ctx *context.Context, node *FlowNode, stats []FilterStat) (string, []FilterStat) {
+	observer := getFilterObserver(ctx)
+	alias := node.filterAlias()
+
+	if observer != nil {
+		observer.BeforeFilter(ctx, alias, node.filter.Kind().Name)
+	}
+
+	start := fasttime.Now()
+	ctx.UseNamespace(node.Namespace)
+
+	finishSpan := startFilterSpan(ctx, alias, node.filter.Kind().Name)
+	result := node.filter.Handle(ctx)
+	finishSpan(result)
+	duration := fasttime.Since(start)
+	node.metrics.observe(result, duration)
+	stats = append(stats, FilterStat{
+		Name:     alias,
+		Kind:     node.filter.Kind().Name,
+		Duration: duration,
+		Result:   result,
+	})
+
+	if observer != nil {
+		observer.AfterFilter(ctx, &stats[len(stats)-1])
+	}
+
+	return result, stats
+}
+
+// startFilterSpan makes a child span of the filter the span of ctx if the
+// spans of the filters are enabled by the tracer, so that the spans created
+// by the filter are its children. The returned function finishes the child
+// span with the result of the filter and restores the span of ctx.
+func startFilterSpan(ctx *context.Context, name, kind string) func(result string) {
+	parent := ctx.Span()
+	if parent == nil || !parent.Tracer().FilterSpansEnabled() {
+		return func(string) {}
+	}
+
+	span := parent.NewChild(name)
+	span.Tag(tracing.TagFilterName, name)
+	span.Tag(tracing.TagFilterKind, kind)
+	ctx.SetSpan(span)
+
+	return func(result string) {
+		if result != "" {
+			span.Tag(tracing.TagFilterResult, result)
+		}
+		span.Finish()
+		ctx.SetSpan(parent)
+	}
+}
+
+// handleParallel runs the branches of node concurrently, every branch runs
+// on a fork of ctx, and the forks are joined back in the order of the
+// branches after all of them complete.
+func (p *Pipeline) handleParallel(ctx *context.Context, node *FlowNode, stats []FilterStat) (string, []FilterStat) {
+	observer := getFilterObserver(ctx)
+	n := len(node.Parallel)
+	children := make([]*context.Context, n)
+	results := make([]string, n)
+	durations := make([]time.Duration, n)
+	panics := make([]interface{}, n)
+
+	for i, branch := range node.Parallel {
+		if observer != nil {
+			observer.BeforeFilter(ctx, branch.filterAlias(), branch.filter.Kind().Name)
+		}
+		children[i] = ctx.Fork()
+	}
+
+	runBranch := func(i int) {
+		defer func() {
+			panics[i] = recover()
+		}()
+
+		branch, child := node.Parallel[i], children[i]
+		start := fasttime.Now()
+		child.UseNamespace(branch.Namespace)
+		finishSpan := startFilterSpan(child, branch.filterAlias(), branch.filter.Kind().Name)
+		results[i] = branch.filter.Handle(child)
+		finishSpan(results[i])
+		durations[i] = fasttime.Since(start)
+	}
+
+	// the branches run one by one in the goroutine of ctx if the pipeline
+	// has run out of goroutines.
+	if p.resources.AcquireGoroutines(int64(n)) {
+		wg := &sync.WaitGroup{}
+		wg.Add(n)
+		for i := range node.Parallel {
+			go func(i int) {
+				defer wg.Done()
+				runBranch(i)
+			}(i)
+		}
+		wg.Wait()
+		p.resources.ReleaseGoroutines(int64(n))
+	} else {
+		for i := range node.Parallel {
+			runBranch(i)
+		}
+	}
+
+	result := ""
+	for i := range node.Parallel {
+		// re-panic in the goroutine of ctx, so it could be recovered as
+		// the panics of other filters.
+		if panics[i] != nil {
+			panic(panics[i])
+		}
+
+		branch := node.Parallel[i]
+		ctx.Join(children[i])
+		children[i].Release()
+		branch.metrics.observe(results[i], durations[i])
+		stats = append(stats, FilterStat{
+			Name:     branch.filterAlias(),
+			Kind:     branch.filter.Kind().Name,
+			Duration: durations[i],
+			Result:   results[i],
+		})
+
+		if observer != nil {
+			observer.AfterFilter(ctx, &stats[len(stats)-1])
+		}
+
+		if result == "" {
+			result = results[i]
+		}
+	}
+
+	ctx.UseNamespace(node.Namespace)
+	return result, stats
+}
+
+// nextNode returns the alias of the next node after node returns result,
+// an empty string means the node next to it.
+func (fn *FlowNode) nextNode(ctx *context.Context, result string) string {
+	if result == "" {
+		for _, jump := range fn.JumpWhen {
+			if jump.match(ctx, fn.Namespace) {
+				return jump.Target
+			}
+		}
+	}
+
+	next, ok := fn.JumpIf[result]
+	if result != "" && !ok {
+		return BuiltInFilterEnd
+	}
+	return next
+}
+
 // Status returns Status generated by Runtime.
 func (p *Pipeline) Status() *supervisor.Status {
 	s := &Status{
-		Filters: make(map[string]interface{}),
+		Filters:   make(map[string]interface{}),
+		Resources: p.resources.Usage(),
 	}
 
 	for name, filter := range p.filters {
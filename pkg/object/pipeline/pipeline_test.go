@@ -18,10 +18,15 @@
 package pipeline
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
@@ -29,6 +34,8 @@ import (
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -282,7 +289,7 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil, nil, nil, false, false}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
 
@@ -330,7 +337,7 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil, nil, nil, false, false}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
 
@@ -498,3 +505,601 @@ filters:
 	assert.NotContains(tags, "filter2")
 	assert.NotContains(tags, "filter3")
 }
+
+type checkFilter struct {
+	kind *filters.Kind
+	spec *MockedSpec
+}
+
+func (f *checkFilter) Name() string                              { return f.spec.Name() }
+func (f *checkFilter) Kind() *filters.Kind                       { return f.kind }
+func (f *checkFilter) Spec() filters.Spec                        { return f.spec }
+func (f *checkFilter) Close()                                    {}
+func (f *checkFilter) Init()                                     {}
+func (f *checkFilter) Inherit(previousGeneration filters.Filter) {}
+func (f *checkFilter) Status() interface{}                       { return nil }
+
+// Handle only reads the request, and fails if header X-Fail is the name of
+// the filter.
+func (f *checkFilter) Handle(ctx *context.Context) string {
+	time.Sleep(10 * time.Millisecond)
+	ctx.SetData(f.Name(), ctx.Namespace())
+	resp, _ := httpprot.NewResponse(nil)
+	ctx.SetOutputResponse(resp)
+	req := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+	if req.HTTPHeader().Get("X-Fail") == f.Name() {
+		return "failed"
+	}
+	return ""
+}
+
+func checkFilterKind() *filters.Kind {
+	k := &filters.Kind{
+		Name:        "Check",
+		Description: "Check",
+		Results:     []string{"failed"},
+		DefaultSpec: func() filters.Spec {
+			return &MockedSpec{}
+		},
+	}
+	k.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &checkFilter{kind: k, spec: spec.(*MockedSpec)}
+	}
+	return k
+}
+
+func TestSpecValidateFlowControl(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+	filters.Register(MockFilterKind("Filter1", nil))
+	filters.Register(checkFilterKind())
+
+	header := `name: pipeline
+kind: Pipeline
+filters:
+- name: filter1
+  kind: Filter1
+- name: check
+  kind: Check
+flow:
+`
+	for _, flow := range []string{
+		// filter and parallel are exclusive
+		"- filter: filter1\n  parallel: [{filter: check}]",
+		// neither filter nor parallel
+		"- alias: foo",
+		"- parallel: [{filter: END}]",
+		"- parallel: [{filter: filter2}]",
+		// unknown target
+		"- filter: filter1\n  jumpWhen: [{methods: [POST], target: foo}]",
+		// invalid condition
+		"- filter: filter1\n  when: {path: {}}",
+		"- filter: filter1\n  when: {expression: 'request.method =='}",
+		"- filter: filter1\n  jumpWhen: [{expression: 'size(request.path)', target: END}]",
+		// result not in the results of the branches
+		"- parallel: [{filter: filter1}]\n  jumpIf: {failed: END}",
+	} {
+		_, err := supervisor.NewSpec(header + flow)
+		assert.Error(err, flow)
+	}
+
+	flow := `- parallel: [{filter: check}, {filter: filter1}]
+  jumpIf: {failed: END}
+  jumpWhen: [{headers: {X-Foo: {exact: bar}}, target: filter1}]
+- filter: filter1
+  when: {methods: [GET], path: {prefix: /api}}
+- filter: check
+  when: {expression: 'request.header["x-debug"] == "1"'}`
+	_, err := supervisor.NewSpec(header + flow)
+	assert.NoError(err)
+}
+
+func TestHandleFlowControl(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+	filters.Register(MockFilterKind("Filter1", nil))
+	filters.Register(checkFilterKind())
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - alias: checks
+    parallel:
+    - filter: check1
+    - filter: check2
+      namespace: ns2
+    jumpIf:
+      failed: END
+  - filter: filter1
+    when:
+      headers:
+        X-Skip:
+          empty: true
+  - filter: filter2
+    jumpWhen:
+    - methods: [POST]
+      target: END
+  - filter: filter3
+    when:
+      expression: request.header["x-debug"] == "1" && request.method == "GET"
+filters:
+  - name: check1
+    kind: Check
+  - name: check2
+    kind: Check
+  - name: filter1
+    kind: Filter1
+  - name: filter2
+    kind: Filter1
+  - name: filter3
+    kind: Filter1
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	handle := func(method string, header http.Header) (*context.Context, string) {
+		stdReq, err := http.NewRequest(method, "http://localhost:9095/api", nil)
+		assert.NoError(err)
+		for k, v := range header {
+			stdReq.Header[k] = v
+		}
+		req, err := httpprot.NewRequest(stdReq)
+		assert.NoError(err)
+
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		return ctx, pipeline.Handle(ctx)
+	}
+
+	ctx, result := handle(http.MethodGet, http.Header{"X-Debug": []string{"1"}})
+	assert.Equal("", result)
+	assert.Equal(context.DefaultNamespace, ctx.GetData("check1"))
+	assert.Equal("ns2", ctx.GetData("check2"))
+	assert.NotNil(ctx.GetResponse(context.DefaultNamespace))
+	assert.NotNil(ctx.GetResponse("ns2"))
+	tags := ctx.Tags()
+	for _, name := range []string{"check1", "check2", "filter1", "filter2", "filter3"} {
+		assert.Contains(tags, name)
+	}
+	ctx.Finish()
+
+	ctx, result = handle(http.MethodGet, nil)
+	assert.Equal("", result)
+	tags = ctx.Tags()
+	assert.Contains(tags, "filter2")
+	assert.NotContains(tags, "filter3")
+	ctx.Finish()
+
+	ctx, result = handle(http.MethodPost, http.Header{"X-Skip": []string{"1"}})
+	assert.Equal("", result)
+	tags = ctx.Tags()
+	assert.NotContains(tags, "filter1")
+	assert.Contains(tags, "filter2")
+	assert.NotContains(tags, "filter3")
+	ctx.Finish()
+
+	ctx, result = handle(http.MethodGet, http.Header{"X-Fail": []string{"check2"}})
+	assert.Equal("failed", result)
+	tags = ctx.Tags()
+	assert.Contains(tags, "check1")
+	assert.NotContains(tags, "filter1")
+	ctx.Finish()
+}
+
+func TestResourceLimits(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+	filters.Register(checkFilterKind())
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+limits:
+  maxInFlightRequests: 1
+  maxGoroutines: 1
+flow:
+  - parallel:
+    - filter: check1
+    - filter: check2
+      namespace: ns2
+filters:
+  - name: check1
+    kind: Check
+  - name: check2
+    kind: Check
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	newContext := func() *context.Context {
+		stdReq, err := http.NewRequest(http.MethodGet, "http://localhost:9095/api", nil)
+		assert.NoError(err)
+		req, err := httpprot.NewRequest(stdReq)
+		assert.NoError(err)
+
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		return ctx
+	}
+
+	// the branches run sequentially as they need more goroutines than
+	// the limit.
+	ctx := newContext()
+	assert.Equal("", pipeline.Handle(ctx))
+	assert.Equal(context.DefaultNamespace, ctx.GetData("check1"))
+	assert.Equal("ns2", ctx.GetData("check2"))
+	ctx.Finish()
+
+	// occupy the only in-flight request.
+	assert.True(pipeline.resources.BeginRequest(0))
+	ctx = newContext()
+	assert.Equal(resultResourceLimited, pipeline.Handle(ctx))
+	resp := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	ctx.Finish()
+	pipeline.resources.EndRequest(0)
+
+	status := pipeline.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(1), status.Resources.RejectedRequests)
+	assert.Equal(int64(0), status.Resources.InFlightRequests)
+	assert.Equal(int64(0), status.Resources.Goroutines)
+}
+
+// spanRecorder is a reporter recording the reported spans.
+type spanRecorder struct {
+	mutex sync.Mutex
+	spans []model.SpanModel
+}
+
+func (r *spanRecorder) Send(s model.SpanModel) {
+	r.mutex.Lock()
+	r.spans = append(r.spans, s)
+	r.mutex.Unlock()
+}
+
+func (r *spanRecorder) Close() error { return nil }
+
+// proxyLikeFilter creates a child span of the span of the context like the
+// Proxy filter.
+type proxyLikeFilter struct {
+	MockedFilter
+}
+
+func (f *proxyLikeFilter) Handle(ctx *context.Context) string {
+	ctx.Span().NewChild("upstream").Finish()
+	return "done"
+}
+
+func TestFilterSpans(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+	filters.Register(MockFilterKind("Filter1", nil))
+	k := MockFilterKind("ProxyLike", []string{"done"})
+	k.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &proxyLikeFilter{MockedFilter{kind: k, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(k)
+
+	recorder := &spanRecorder{}
+	tracing.RegisterReporter("pipeline-test", func(cfg json.RawMessage) (zipkinreporter.Reporter, error) {
+		return recorder, nil
+	})
+	defer tracing.UnregisterReporter("pipeline-test")
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+  - parallel:
+    - filter: filter2
+  - filter: proxy
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: filter2
+    kind: Filter1
+  - name: proxy
+    kind: ProxyLike
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	handle := func(filterSpans bool) {
+		tracer, err := tracing.New(&tracing.Spec{
+			ServiceName: "test",
+			Backend:     "pipeline-test",
+			Zipkin:      &tracing.ZipkinSpec{SampleRate: 1},
+			FilterSpans: filterSpans,
+		})
+		assert.NoError(err)
+		defer tracer.Close()
+
+		root := tracer.NewSpan("server")
+		ctx := context.New(root)
+		stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095/api", nil)
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		assert.Equal("done", pipeline.Handle(ctx))
+		assert.Equal(root, ctx.Span())
+		root.Finish()
+	}
+
+	handle(false)
+	assert.Len(recorder.spans, 2)
+	recorder.spans = nil
+
+	handle(true)
+	spans := map[string]model.SpanModel{}
+	for _, s := range recorder.spans {
+		spans[s.Name] = s
+	}
+	assert.Len(spans, 5)
+
+	rootID := spans["server"].ID
+	for _, name := range []string{"filter1", "filter2", "proxy"} {
+		s := spans[name]
+		assert.Equal(rootID, *s.ParentID, name)
+		assert.Equal(name, s.Tags[tracing.TagFilterName])
+	}
+	assert.Equal("Filter1", spans["filter1"].Tags[tracing.TagFilterKind])
+	assert.Equal("done", spans["proxy"].Tags[tracing.TagFilterResult])
+	assert.Empty(spans["filter1"].Tags[tracing.TagFilterResult])
+	// the spans created by the filter are children of its span.
+	assert.Equal(spans["proxy"].ID, *spans["upstream"].ParentID)
+}
+
+// noBodyFilter is a filter never accessing the bodies.
+type noBodyFilter struct {
+	MockedFilter
+}
+
+func (f *noBodyFilter) RequiresBody() (request, response bool) {
+	return false, false
+}
+
+func TestRequiresBody(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Filter1", nil))
+	k := MockFilterKind("NoBody", nil)
+	k.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &noBodyFilter{MockedFilter{kind: k, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(k)
+
+	newPipeline := func(yamlConfig string) *Pipeline {
+		superSpec, err := supervisor.NewSpec(yamlConfig)
+		assert.NoError(err)
+		p := &Pipeline{}
+		p.Init(superSpec, nil)
+		return p
+	}
+
+	p := newPipeline(`
+name: pipeline
+kind: Pipeline
+filters:
+- name: filter1
+  kind: NoBody
+- name: filter2
+  kind: NoBody
+`)
+	defer p.Close()
+	request, response := p.RequiresBody()
+	assert.False(request)
+	assert.False(response)
+
+	// filters not declaring the requirements require both.
+	p2 := newPipeline(`
+name: pipeline
+kind: Pipeline
+filters:
+- name: filter1
+  kind: NoBody
+- name: filter2
+  kind: Filter1
+`)
+	defer p2.Close()
+	request, response = p2.RequiresBody()
+	assert.True(request)
+	assert.True(response)
+}
+
+// streamFilter is a filter reading the request body as a stream, like the
+// Proxy.
+type streamFilter struct {
+	noBodyFilter
+	lock   *sync.Mutex
+	bodies map[string]string
+}
+
+func (f *streamFilter) Handle(ctx *context.Context) string {
+	body, _ := io.ReadAll(ctx.GetInputRequest().GetPayload())
+	f.lock.Lock()
+	f.bodies[f.spec.Name()] = string(body)
+	f.lock.Unlock()
+	return ""
+}
+
+func TestRequiresBodyParallel(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+
+	lock, bodies := &sync.Mutex{}, map[string]string{}
+	k := MockFilterKind("Stream", nil)
+	k.CreateInstance = func(spec filters.Spec) filters.Filter {
+		mf := MockedFilter{kind: k, spec: spec.(*MockedSpec)}
+		return &streamFilter{noBodyFilter{mf}, lock, bodies}
+	}
+	filters.Register(k)
+
+	superSpec, err := supervisor.NewSpec(`
+name: pipeline
+kind: Pipeline
+flow:
+- parallel:
+  - filter: proxy1
+  - filter: proxy2
+filters:
+- name: proxy1
+  kind: Stream
+- name: proxy2
+  kind: Stream
+`)
+	assert.NoError(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	// the branches share the request, so the body is required although
+	// none of the filters requires it.
+	request, response := p.RequiresBody()
+	assert.True(request)
+	assert.False(response)
+
+	// fetch the body as the HTTPServer does with streamBody.
+	maxBodySize := int64(-1)
+	if request {
+		maxBodySize = 0
+	}
+	stdr, _ := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader("body"))
+	req, _ := httpprot.NewRequest(stdr)
+	assert.NoError(req.FetchPayload(maxBodySize))
+	assert.False(req.IsStream())
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+	p.Handle(ctx)
+	ctx.Finish()
+
+	assert.Equal(map[string]string{"proxy1": "body", "proxy2": "body"}, bodies)
+}
+
+type mockedTemplate struct {
+	p *Pipeline
+}
+
+func (t *mockedTemplate) GetPipeline(owner string, ref *TemplateRef) (*Pipeline, error) {
+	return t.p, nil
+}
+
+func TestHandleTemplates(t *testing.T) {
+	assert := assert.New(t)
+	cleanup()
+	defer cleanup()
+	filters.Register(MockFilterKind("Filter1", nil))
+
+	spec, err := supervisor.NewSpec(`
+name: template
+kind: Pipeline
+filters:
+- name: filter1
+  kind: Filter1
+`)
+	assert.NoError(err)
+	tp := &Pipeline{}
+	tp.Init(spec, nil)
+	defer tp.Close()
+
+	oldGetTemplate := getTemplate
+	defer func() {
+		getTemplate = oldGetTemplate
+	}()
+	getTemplate = func(super *supervisor.Supervisor, name string) Template {
+		if name == "template" {
+			return &mockedTemplate{p: tp}
+		}
+		return nil
+	}
+
+	newPipeline := func(template string) *Pipeline {
+		spec, err := supervisor.NewSpec(`
+name: pipeline
+kind: Pipeline
+templates:
+- name: ` + template + `
+filters:
+- name: filter2
+  kind: Filter1
+`)
+		assert.NoError(err)
+		p := &Pipeline{}
+		p.Init(spec, nil)
+		return p
+	}
+
+	p := newPipeline("template")
+	defer p.Close()
+	ctx := context.New(tracing.NoopSpan)
+	assert.Equal("", p.Handle(ctx))
+	tags := ctx.Tags()
+	assert.Contains(tags, "filter1")
+	assert.Contains(tags, "filter2")
+
+	// the pipeline ends if the template is not found.
+	p = newPipeline("none")
+	defer p.Close()
+	ctx = context.New(tracing.NoopSpan)
+	assert.Equal(resultTemplateNotFound, p.HandleWithBeforeAfter(ctx, nil, nil))
+	assert.NotContains(ctx.Tags(), "filter2")
+}
+
+func BenchmarkHandleParallel(b *testing.B) {
+	cleanup()
+	defer cleanup()
+	filters.Register(MockFilterKind("Filter1", nil))
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - parallel:
+    - filter: check1
+    - filter: check2
+filters:
+  - name: check1
+    kind: Filter1
+  - name: check2
+    kind: Filter1
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095/api", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		pipeline.Handle(ctx)
+		ctx.Finish()
+		ctx.Release()
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretprovider
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+const awsSecretsManagerService = "secretsmanager"
+
+type (
+	// AWSSecretsManagerSpec is the spec of AWS Secrets Manager.
+	AWSSecretsManagerSpec struct {
+		Region string `json:"region" jsonschema:"required"`
+		// Endpoint overrides the default endpoint of the region.
+		Endpoint string `json:"endpoint,omitempty" jsonschema:"omitempty,format=uri"`
+		// AccessKeyID and SecretAccessKey could be secret references, the
+		// default credential chain of AWS is used if they are empty.
+		AccessKeyID     string `json:"accessKeyId,omitempty" jsonschema:"omitempty"`
+		SecretAccessKey string `json:"secretAccessKey,omitempty" jsonschema:"omitempty"`
+	}
+
+	awsSecretsManagerProvider struct {
+		region      string
+		endpoint    string
+		credentials aws.CredentialsProvider
+		signer      *v4.Signer
+		client      *http.Client
+	}
+
+	awsGetSecretValueResponse struct {
+		SecretString *string `json:"SecretString"`
+		SecretBinary []byte  `json:"SecretBinary"`
+	}
+)
+
+func newAWSSecretsManagerProvider(spec *AWSSecretsManagerSpec) (*awsSecretsManagerProvider, error) {
+	p := &awsSecretsManagerProvider{
+		region:   spec.Region,
+		endpoint: strings.TrimSuffix(spec.Endpoint, "/"),
+		signer:   v4.NewSigner(),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if p.endpoint == "" {
+		p.endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", awsSecretsManagerService, spec.Region)
+	}
+
+	if spec.AccessKeyID != "" {
+		id, err := resolveSecret(spec.AccessKeyID)
+		if err != nil {
+			return nil, err
+		}
+		key, err := resolveSecret(spec.SecretAccessKey)
+		if err != nil {
+			return nil, err
+		}
+		p.credentials = credentials.NewStaticCredentialsProvider(id, key, "")
+		return p, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(spec.Region))
+	if err != nil {
+		return nil, err
+	}
+	p.credentials = cfg.Credentials
+	return p, nil
+}
+
+// fetch gets the current version of the secret. A secret string of a JSON
+// object is converted to the keys of the secret, otherwise, the string or
+// the base64 encoded binary is stored in the key 'value'.
+func (p *awsSecretsManagerProvider) fetch(ctx context.Context, path string) (*fetchResult, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": path})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	creds, err := p.credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("aws: retrieve credentials failed: %v", err)
+	}
+	hash := sha256.Sum256(body)
+	err = p.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), awsSecretsManagerService, p.region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("aws: get secret %s returns status code %d: %s", path, resp.StatusCode, data)
+	}
+
+	result := &awsGetSecretValueResponse{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("aws: unmarshal response failed: %v", err)
+	}
+
+	if result.SecretString == nil {
+		value := base64.StdEncoding.EncodeToString(result.SecretBinary)
+		return &fetchResult{data: map[string]string{"value": value}}, nil
+	}
+
+	var m map[string]interface{}
+	if json.Unmarshal([]byte(*result.SecretString), &m) == nil && len(m) > 0 {
+		return &fetchResult{data: toStringMap(m)}, nil
+	}
+	return &fetchResult{data: map[string]string{"value": *result.SecretString}}, nil
+}
+
+// renew is not supported by AWS Secrets Manager, the secrets are fetched
+// again to get the rotated values.
+func (p *awsSecretsManagerProvider) renew(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error) {
+	return 0, fmt.Errorf("aws: lease renewal is not supported")
+}
@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package secretprovider syncs secrets from external secret stores, like
+// HashiCorp Vault and AWS Secrets Manager, into the secret store of the
+// cluster.
+package secretprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster/secret"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of SecretProvider.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of SecretProvider.
+	Kind = "SecretProvider"
+
+	providerVault             = "vault"
+	providerAWSSecretsManager = "awsSecretsManager"
+
+	defaultSyncInterval = 10 * time.Minute
+	// retryInterval is the maximum interval to retry a failed sync.
+	retryInterval = 30 * time.Second
+	// followerCheckInterval is the interval for non-leader members to check
+	// whether they become the leader.
+	followerCheckInterval = 30 * time.Second
+)
+
+type (
+	// SecretProvider syncs secrets from an external secret store into the
+	// secret store of the cluster.
+	SecretProvider struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		store        *secret.Store
+		provider     provider
+		syncInterval time.Duration
+		isLeader     func() bool
+
+		cancel context.CancelFunc
+
+		mutex   sync.Mutex
+		entries []*entry
+	}
+
+	// Spec describes SecretProvider.
+	Spec struct {
+		Provider          string                 `json:"provider" jsonschema:"required,enum=vault,enum=awsSecretsManager"`
+		SyncInterval      string                 `json:"syncInterval,omitempty" jsonschema:"omitempty,format=duration"`
+		Vault             *VaultSpec             `json:"vault,omitempty" jsonschema:"omitempty"`
+		AWSSecretsManager *AWSSecretsManagerSpec `json:"awsSecretsManager,omitempty" jsonschema:"omitempty"`
+		Secrets           []*SecretSpec          `json:"secrets" jsonschema:"required"`
+	}
+
+	// SecretSpec describes how to sync an external secret.
+	SecretSpec struct {
+		// Name is the name of the secret in the cluster.
+		Name string `json:"name" jsonschema:"required"`
+		// Path is the API path of the secret in Vault, e.g. secret/data/jwt,
+		// or the secret ID in AWS Secrets Manager.
+		Path string `json:"path" jsonschema:"required"`
+		// Keys maps the keys of the secret in the cluster to the keys of
+		// the external secret, all keys are synced if it is empty.
+		Keys map[string]string `json:"keys,omitempty" jsonschema:"omitempty"`
+	}
+
+	// SecretStatus is the sync status of a secret.
+	SecretStatus struct {
+		Name            string    `json:"name"`
+		LastSyncTime    time.Time `json:"lastSyncTime,omitempty"`
+		NextSyncTime    time.Time `json:"nextSyncTime,omitempty"`
+		LeaseExpireTime time.Time `json:"leaseExpireTime,omitempty"`
+		Error           string    `json:"error,omitempty"`
+	}
+
+	// Status is the status of SecretProvider.
+	Status struct {
+		Secrets []SecretStatus `json:"secrets"`
+	}
+
+	entry struct {
+		spec      *SecretSpec
+		status    SecretStatus
+		leaseID   string
+		renewable bool
+	}
+
+	// provider is the interface of external secret stores.
+	provider interface {
+		// fetch reads the secret at path.
+		fetch(ctx context.Context, path string) (*fetchResult, error)
+		// renew renews the lease of a secret, and returns the new lease
+		// duration.
+		renew(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error)
+	}
+
+	fetchResult struct {
+		data          map[string]string
+		leaseID       string
+		leaseDuration time.Duration
+		renewable     bool
+	}
+)
+
+// Validate validates the spec of SecretProvider.
+func (spec *Spec) Validate() error {
+	switch spec.Provider {
+	case providerVault:
+		if spec.Vault == nil {
+			return fmt.Errorf("vault is required for provider %s", spec.Provider)
+		}
+	case providerAWSSecretsManager:
+		if spec.AWSSecretsManager == nil {
+			return fmt.Errorf("awsSecretsManager is required for provider %s", spec.Provider)
+		}
+	}
+
+	if spec.SyncInterval != "" {
+		d, err := time.ParseDuration(spec.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid syncInterval: %v", err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("syncInterval must be at least 1s")
+		}
+	}
+
+	names := map[string]bool{}
+	for _, s := range spec.Secrets {
+		if names[s.Name] {
+			return fmt.Errorf("duplicated secret %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+func init() {
+	supervisor.Register(&SecretProvider{})
+}
+
+// Category returns the category of SecretProvider.
+func (sp *SecretProvider) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind return the kind of SecretProvider.
+func (sp *SecretProvider) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of SecretProvider.
+func (sp *SecretProvider) DefaultSpec() interface{} {
+	return &Spec{SyncInterval: defaultSyncInterval.String()}
+}
+
+// Init initializes SecretProvider.
+func (sp *SecretProvider) Init(superSpec *supervisor.Spec) {
+	sp.superSpec = superSpec
+	sp.spec = superSpec.ObjectSpec().(*Spec)
+	sp.super = superSpec.Super()
+
+	sp.reload()
+}
+
+// Inherit inherits previous generation of SecretProvider.
+func (sp *SecretProvider) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.(*SecretProvider).Close()
+	sp.Init(superSpec)
+}
+
+func (sp *SecretProvider) reload() {
+	sp.syncInterval = defaultSyncInterval
+	if sp.spec.SyncInterval != "" {
+		sp.syncInterval, _ = time.ParseDuration(sp.spec.SyncInterval)
+	}
+	sp.isLeader = sp.super.Cluster().IsLeader
+
+	for _, s := range sp.spec.Secrets {
+		sp.entries = append(sp.entries, &entry{spec: s, status: SecretStatus{Name: s.Name}})
+	}
+
+	sp.store = secret.GetGlobalStore()
+	if sp.store == nil {
+		sp.setError(fmt.Errorf("secret store is not ready"))
+		return
+	}
+
+	var err error
+	switch sp.spec.Provider {
+	case providerVault:
+		sp.provider, err = newVaultProvider(sp.spec.Vault)
+	case providerAWSSecretsManager:
+		sp.provider, err = newAWSSecretsManagerProvider(sp.spec.AWSSecretsManager)
+	}
+	if err != nil {
+		sp.setError(fmt.Errorf("create provider failed: %v", err))
+		return
+	}
+
+	var ctx context.Context
+	ctx, sp.cancel = context.WithCancel(context.Background())
+	go sp.run(ctx)
+}
+
+// setError reports the error, which prevents the SecretProvider from
+// running, in the status of all secrets.
+func (sp *SecretProvider) setError(err error) {
+	logger.Errorf("%s: %v", sp.superSpec.Name(), err)
+	for _, e := range sp.entries {
+		e.status.Error = err.Error()
+	}
+}
+
+func (sp *SecretProvider) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		next := time.Now().Add(followerCheckInterval)
+		// only the leader syncs the secrets to avoid writing the same
+		// secret from all members.
+		if sp.isLeader() {
+			next = sp.syncAll(ctx)
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// syncAll syncs the secrets which are due, and returns the time of the
+// next sync.
+func (sp *SecretProvider) syncAll(ctx context.Context) time.Time {
+	now := time.Now()
+	next := now.Add(sp.syncInterval)
+	for _, e := range sp.entries {
+		if !e.status.NextSyncTime.After(now) {
+			sp.syncEntry(ctx, e)
+		}
+		if e.status.NextSyncTime.Before(next) {
+			next = e.status.NextSyncTime
+		}
+	}
+	return next
+}
+
+// syncEntry renews the lease of the secret if possible, otherwise, it
+// fetches the secret and saves it to the cluster if it is changed. The
+// entries are only modified in the goroutine of run, the lock is to
+// protect the status from being read by Status.
+func (sp *SecretProvider) syncEntry(ctx context.Context, e *entry) {
+	now := time.Now()
+	status := e.status
+
+	defer func() {
+		sp.mutex.Lock()
+		e.status = status
+		sp.mutex.Unlock()
+	}()
+
+	if e.leaseID != "" && e.renewable {
+		d, err := sp.provider.renew(ctx, e.leaseID, sp.syncInterval)
+		if err == nil && d > 0 {
+			status.LeaseExpireTime = now.Add(d)
+			status.NextSyncTime = now.Add(nextSyncDelay(sp.syncInterval, d))
+			status.Error = ""
+			return
+		}
+		logger.Warnf("%s: renew lease of secret %s failed, fetch it again: %v", sp.superSpec.Name(), e.spec.Name, err)
+	}
+
+	result, err := sp.fetchEntry(ctx, e)
+	if err != nil {
+		logger.Errorf("%s: sync secret %s failed: %v", sp.superSpec.Name(), e.spec.Name, err)
+		status.Error = err.Error()
+		delay := retryInterval
+		if sp.syncInterval < delay {
+			delay = sp.syncInterval
+		}
+		status.NextSyncTime = now.Add(delay)
+		return
+	}
+
+	e.leaseID = result.leaseID
+	e.renewable = result.renewable
+	status.LastSyncTime = now
+	status.NextSyncTime = now.Add(nextSyncDelay(sp.syncInterval, result.leaseDuration))
+	status.LeaseExpireTime = time.Time{}
+	if result.leaseDuration > 0 {
+		status.LeaseExpireTime = now.Add(result.leaseDuration)
+	}
+	status.Error = ""
+}
+
+// fetchEntry fetches the secret and saves it to the cluster if changed.
+func (sp *SecretProvider) fetchEntry(ctx context.Context, e *entry) (*fetchResult, error) {
+	result, err := sp.provider.fetch(ctx, e.spec.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	data := result.data
+	if len(e.spec.Keys) > 0 {
+		data = make(map[string]string, len(e.spec.Keys))
+		for key, remoteKey := range e.spec.Keys {
+			value, ok := result.data[remoteKey]
+			if !ok {
+				return nil, fmt.Errorf("key %s not found in %s", remoteKey, e.spec.Path)
+			}
+			data[key] = value
+		}
+	}
+
+	old, err := sp.store.Get(e.spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	// the secret is only saved when changed, as saving it reloads the
+	// objects referencing it.
+	if old == nil || !reflect.DeepEqual(old.Data, data) {
+		if err = sp.store.Put(&secret.Secret{Name: e.spec.Name, Data: data}); err != nil {
+			return nil, err
+		}
+		logger.Infof("%s: secret %s is updated", sp.superSpec.Name(), e.spec.Name)
+	}
+	return result, nil
+}
+
+// nextSyncDelay returns the delay of the next sync, the secret is synced
+// when two thirds of its lease is passed, to leave enough time to retry.
+func nextSyncDelay(interval, lease time.Duration) time.Duration {
+	if lease > 0 && lease*2/3 < interval {
+		return lease * 2 / 3
+	}
+	return interval
+}
+
+// resolveSecret resolves the secret references in the credentials of the
+// providers, so that they need not to be stored in plain text.
+func resolveSecret(str string) (string, error) {
+	s := secret.GetGlobalStore()
+	if s == nil {
+		return str, nil
+	}
+	return s.Resolve(str, func(v string) string { return v })
+}
+
+// toStringMap converts the values of m to strings, the non-string values
+// are converted to JSON.
+func toStringMap(m map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			result[k] = s
+			continue
+		}
+		data, _ := json.Marshal(v)
+		result[k] = string(data)
+	}
+	return result
+}
+
+// Status returns the status of SecretProvider.
+func (sp *SecretProvider) Status() *supervisor.Status {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	status := &Status{}
+	for _, e := range sp.entries {
+		status.Secrets = append(status.Secrets, e.status)
+	}
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes SecretProvider.
+func (sp *SecretProvider) Close() {
+	if sp.cancel != nil {
+		sp.cancel()
+	}
+}
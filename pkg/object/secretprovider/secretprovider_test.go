@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretprovider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/cluster/secret"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestStore(t *testing.T) (*secret.Store, *int) {
+	data := map[string]string{}
+	puts := 0
+
+	cls := clustertest.NewMockedCluster()
+	cls.MockedPut = func(key, value string) error {
+		puts++
+		data[key] = value
+		return nil
+	}
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		if v, ok := data[key]; ok {
+			return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(v)}, nil
+		}
+		return nil, nil
+	}
+
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	s, err := secret.NewStore(cls, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, &puts
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Provider: providerVault}
+	assert.Error(spec.Validate())
+
+	spec.Vault = &VaultSpec{Address: "http://127.0.0.1:8200", Token: "token"}
+	spec.Secrets = []*SecretSpec{{Name: "jwt", Path: "secret/data/jwt"}}
+	assert.NoError(spec.Validate())
+
+	spec.SyncInterval = "10ms"
+	assert.Error(spec.Validate())
+	spec.SyncInterval = "1m"
+	assert.NoError(spec.Validate())
+
+	spec.Secrets = append(spec.Secrets, &SecretSpec{Name: "jwt", Path: "secret/data/jwt2"})
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Provider: providerAWSSecretsManager}
+	assert.Error(spec.Validate())
+}
+
+func TestVaultProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/jwt":
+			w.Write([]byte(`{"data": {"data": {"key": "abc", "ttl": 10}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/jwt":
+			w.Write([]byte(`{"lease_duration": 2764800, "data": {"key": "def"}}`))
+		case "/v1/database/creds/app":
+			w.Write([]byte(`{"lease_id": "database/creds/app/1", "lease_duration": 3600, "renewable": true, "data": {"username": "u", "password": "p"}}`))
+		case "/v1/sys/leases/renew":
+			body := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if r.Method != http.MethodPut || body["lease_id"] != "database/creds/app/1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"lease_id": "database/creds/app/1", "lease_duration": 1800, "renewable": true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p, err := newVaultProvider(&VaultSpec{Address: server.URL, Token: "token"})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	result, err := p.fetch(ctx, "secret/data/jwt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"key": "abc", "ttl": "10"}, result.data)
+
+	result, err = p.fetch(ctx, "kv/jwt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"key": "def"}, result.data)
+	assert.Empty(result.leaseID)
+
+	result, err = p.fetch(ctx, "database/creds/app")
+	assert.NoError(err)
+	assert.Equal("database/creds/app/1", result.leaseID)
+	assert.Equal(time.Hour, result.leaseDuration)
+	assert.True(result.renewable)
+
+	d, err := p.renew(ctx, result.leaseID, time.Hour)
+	assert.NoError(err)
+	assert.Equal(30*time.Minute, d)
+
+	_, err = p.fetch(ctx, "secret/data/none")
+	assert.Error(err)
+
+	p.token = "bad"
+	_, err = p.fetch(ctx, "secret/data/jwt")
+	assert.Error(err)
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/") ||
+			r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case `{"SecretId":"jwt"}`:
+			w.Write([]byte(`{"Name": "jwt", "SecretString": "{\"key\": \"abc\"}"}`))
+		case `{"SecretId":"token"}`:
+			w.Write([]byte(`{"Name": "token", "SecretString": "xyz"}`))
+		case `{"SecretId":"binary"}`:
+			w.Write([]byte(`{"Name": "binary", "SecretBinary": "AQI="}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	p, err := newAWSSecretsManagerProvider(&AWSSecretsManagerSpec{
+		Region:          "us-east-1",
+		Endpoint:        server.URL,
+		AccessKeyID:     "id",
+		SecretAccessKey: "key",
+	})
+	assert.NoError(err)
+
+	ctx := context.Background()
+	result, err := p.fetch(ctx, "jwt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"key": "abc"}, result.data)
+
+	result, err = p.fetch(ctx, "token")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"value": "xyz"}, result.data)
+
+	result, err = p.fetch(ctx, "binary")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"value": "AQI="}, result.data)
+
+	_, err = p.fetch(ctx, "none")
+	assert.Error(err)
+
+	_, err = p.renew(ctx, "", time.Hour)
+	assert.Error(err)
+}
+
+type mockProvider struct {
+	data      map[string]string
+	lease     time.Duration
+	renewable bool
+	fetches   int
+	renews    int
+}
+
+func (p *mockProvider) fetch(ctx context.Context, path string) (*fetchResult, error) {
+	p.fetches++
+	result := &fetchResult{data: p.data, leaseDuration: p.lease, renewable: p.renewable}
+	if p.lease > 0 {
+		result.leaseID = path + "/lease"
+	}
+	return result, nil
+}
+
+func (p *mockProvider) renew(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error) {
+	p.renews++
+	return p.lease, nil
+}
+
+func TestSync(t *testing.T) {
+	assert := assert.New(t)
+
+	superSpec, err := supervisor.NewSpec(`
+kind: SecretProvider
+name: vault
+provider: vault
+vault:
+  address: http://127.0.0.1:8200
+  token: token
+secrets:
+- name: jwt
+  path: secret/data/jwt
+`)
+	assert.NoError(err)
+
+	store, puts := newTestStore(t)
+	p := &mockProvider{data: map[string]string{"key": "abc", "other": "x"}}
+	sp := &SecretProvider{
+		superSpec:    superSpec,
+		store:        store,
+		provider:     p,
+		syncInterval: time.Hour,
+		entries: []*entry{{
+			spec:   &SecretSpec{Name: "jwt", Path: "secret/data/jwt", Keys: map[string]string{"signKey": "key"}},
+			status: SecretStatus{Name: "jwt"},
+		}},
+	}
+
+	ctx := context.Background()
+	next := sp.syncAll(ctx)
+	assert.WithinDuration(time.Now().Add(time.Hour), next, time.Minute)
+	s, err := store.Get("jwt")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"signKey": "abc"}, s.Data)
+	assert.Equal(1, *puts)
+
+	// not due, nothing happens.
+	sp.syncAll(ctx)
+	assert.Equal(1, p.fetches)
+
+	// the secret is not saved if unchanged.
+	sp.entries[0].status.NextSyncTime = time.Time{}
+	sp.syncAll(ctx)
+	assert.Equal(2, p.fetches)
+	assert.Equal(1, *puts)
+
+	// rotated.
+	p.data = map[string]string{"key": "def"}
+	p.lease = 30 * time.Minute
+	p.renewable = true
+	sp.entries[0].status.NextSyncTime = time.Time{}
+	next = sp.syncAll(ctx)
+	assert.WithinDuration(time.Now().Add(20*time.Minute), next, time.Minute)
+	s, _ = store.Get("jwt")
+	assert.Equal(map[string]string{"signKey": "def"}, s.Data)
+	assert.Equal(2, *puts)
+
+	// the lease is renewed instead of fetching the secret again.
+	sp.entries[0].status.NextSyncTime = time.Time{}
+	sp.syncAll(ctx)
+	assert.Equal(3, p.fetches)
+	assert.Equal(1, p.renews)
+
+	// missing key.
+	sp.entries[0].leaseID = ""
+	sp.entries[0].status.NextSyncTime = time.Time{}
+	p.data = map[string]string{}
+	next = sp.syncAll(ctx)
+	assert.WithinDuration(time.Now().Add(retryInterval), next, time.Second)
+
+	status := sp.Status().ObjectStatus.(*Status)
+	assert.Len(status.Secrets, 1)
+	assert.NotEmpty(status.Secrets[0].Error)
+}
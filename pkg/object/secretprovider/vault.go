@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secretprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// VaultSpec is the spec of HashiCorp Vault.
+	VaultSpec struct {
+		Address string `json:"address" jsonschema:"required,format=uri"`
+		// Token is the token to access Vault, it could be a secret
+		// reference like $secret{vault/token}.
+		Token     string `json:"token" jsonschema:"required"`
+		Namespace string `json:"namespace,omitempty" jsonschema:"omitempty"`
+	}
+
+	vaultProvider struct {
+		address   string
+		token     string
+		namespace string
+		client    *http.Client
+	}
+
+	vaultResponse struct {
+		LeaseID       string                 `json:"lease_id"`
+		LeaseDuration int64                  `json:"lease_duration"`
+		Renewable     bool                   `json:"renewable"`
+		Data          map[string]interface{} `json:"data"`
+	}
+)
+
+func newVaultProvider(spec *VaultSpec) (*vaultProvider, error) {
+	token, err := resolveSecret(spec.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vaultProvider{
+		address:   strings.TrimSuffix(spec.Address, "/"),
+		token:     token,
+		namespace: spec.Namespace,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (p *vaultProvider) do(ctx context.Context, method, path string, body interface{}) (*vaultResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	url := p.address + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault: %s %s returns status code %d: %s", method, path, resp.StatusCode, data)
+	}
+
+	result := &vaultResponse{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("vault: unmarshal response failed: %v", err)
+	}
+	return result, nil
+}
+
+// fetch reads the secret at path. The secrets of the KV version 2 engine
+// are nested in the data field along with their metadata, and they are
+// unwrapped.
+func (p *vaultProvider) fetch(ctx context.Context, path string) (*fetchResult, error) {
+	resp, err := p.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := resp.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok = data["metadata"].(map[string]interface{}); ok {
+			data = inner
+		}
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("vault: no data in %s", path)
+	}
+
+	return &fetchResult{
+		data:          toStringMap(data),
+		leaseID:       resp.LeaseID,
+		leaseDuration: time.Duration(resp.LeaseDuration) * time.Second,
+		renewable:     resp.Renewable,
+	}, nil
+}
+
+func (p *vaultProvider) renew(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error) {
+	body := map[string]interface{}{
+		"lease_id":  leaseID,
+		"increment": int64(increment / time.Second),
+	}
+	resp, err := p.do(ctx, http.MethodPut, "sys/leases/renew", body)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
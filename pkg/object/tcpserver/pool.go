@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/util/loadbalance"
+)
+
+type (
+	// server is a backend server of a pool.
+	server struct {
+		address string
+		weight  int
+
+		// connections is the number of active connections.
+		connections int64
+	}
+
+	// pool chooses a backend server for the connections.
+	pool struct {
+		policy   string
+		servers  []*server
+		weighted *loadbalance.Weighted
+
+		proxyProtocol string
+	}
+)
+
+func newPool(spec *PoolSpec) *pool {
+	p := &pool{policy: spec.LoadBalance, proxyProtocol: spec.ProxyProtocol}
+	if p.policy == "" {
+		p.policy = loadbalance.PolicyRoundRobin
+	}
+
+	weights := make([]int, len(spec.Servers))
+	for i, s := range spec.Servers {
+		p.servers = append(p.servers, &server{address: s.Address, weight: s.Weight})
+		weights[i] = s.Weight
+	}
+	p.weighted = loadbalance.NewWeighted(weights)
+	return p
+}
+
+// choose chooses a server for the connection from the client IP.
+func (p *pool) choose(clientIP string) *server {
+	switch p.policy {
+	case loadbalance.PolicyRandom:
+		return p.servers[p.weighted.Random()]
+	case loadbalance.PolicyLeastConnections:
+		return p.chooseLeastConnections()
+	case loadbalance.PolicyIPHash:
+		return p.servers[p.weighted.Hash(clientIP)]
+	default:
+		return p.servers[p.weighted.RoundRobin()]
+	}
+}
+
+func (p *pool) chooseLeastConnections() *server {
+	var result *server
+	var min int64
+	for _, svr := range p.servers {
+		conns := atomic.LoadInt64(&svr.connections)
+		if result == nil || conns < min {
+			result, min = svr, conns
+		}
+	}
+	return result
+}
@@ -0,0 +1,431 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+const (
+	defaultConnectTimeout     = 5 * time.Second
+	defaultClientHelloTimeout = 5 * time.Second
+	defaultFirstByteTimeout   = 200 * time.Millisecond
+)
+
+type (
+	// runtime accepts the connections and routes them to the pools, it
+	// is inherited by the next generation so that the listener and the
+	// existing connections are kept on reloading.
+	runtime struct {
+		name   string
+		router atomic.Value // *router
+
+		lock     sync.Mutex
+		port     uint16
+		listener net.Listener
+		conns    map[net.Conn]struct{}
+		err      string
+		closed   bool
+		wg       sync.WaitGroup
+
+		activeConnections   int64
+		totalConnections    uint64
+		rejectedConnections uint64
+	}
+
+	// router is built from the spec of a generation.
+	router struct {
+		spec               *Spec
+		rules              []*rule
+		defaultPool        *pool
+		idleTimeout        time.Duration
+		connectTimeout     time.Duration
+		clientHelloTimeout time.Duration
+		firstByteTimeout   time.Duration
+		proxyProtocol      *proxyprotocol.Policy
+	}
+
+	rule struct {
+		sni  []string
+		pool *pool
+	}
+
+	// Status is the status of TCPServer.
+	Status struct {
+		Port                uint16 `json:"port"`
+		Error               string `json:"error,omitempty"`
+		ActiveConnections   int64  `json:"activeConnections"`
+		TotalConnections    uint64 `json:"totalConnections"`
+		RejectedConnections uint64 `json:"rejectedConnections"`
+	}
+)
+
+func newRouter(spec *Spec) *router {
+	rt := &router{spec: spec}
+	rt.idleTimeout, _ = parseDuration("idleTimeout", spec.IdleTimeout, 0)
+	rt.connectTimeout, _ = parseDuration("connectTimeout", spec.ConnectTimeout, defaultConnectTimeout)
+	rt.clientHelloTimeout, _ = parseDuration("clientHelloTimeout", spec.ClientHelloTimeout, defaultClientHelloTimeout)
+	rt.firstByteTimeout, _ = parseDuration("firstByteTimeout", spec.FirstByteTimeout, defaultFirstByteTimeout)
+
+	if spec.ProxyProtocol != nil {
+		rt.proxyProtocol = proxyprotocol.NewPolicy(spec.ProxyProtocol)
+	}
+
+	for _, r := range spec.Rules {
+		rt.rules = append(rt.rules, &rule{sni: r.SNI, pool: newPool(r.Pool)})
+	}
+	if spec.DefaultPool != nil {
+		rt.defaultPool = newPool(spec.DefaultPool)
+	}
+	return rt
+}
+
+// match returns the pool of the SNI, exact hosts take precedence over
+// wildcard ones.
+func (rt *router) match(sni string) *pool {
+	if sni == "" {
+		return rt.defaultPool
+	}
+	for _, r := range rt.rules {
+		for _, host := range r.sni {
+			if host == sni {
+				return r.pool
+			}
+		}
+	}
+	for _, r := range rt.rules {
+		for _, host := range r.sni {
+			if matchSNI(host, sni) {
+				return r.pool
+			}
+		}
+	}
+	return rt.defaultPool
+}
+
+func newRuntime(name string) *runtime {
+	return &runtime{
+		name:  name,
+		conns: map[net.Conn]struct{}{},
+	}
+}
+
+// reload applies the spec, the listener is recreated if the port changes.
+func (r *runtime) reload(spec *Spec) {
+	r.router.Store(newRouter(spec))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.listener != nil && r.port == spec.Port {
+		return
+	}
+	if r.listener != nil {
+		r.listener.Close()
+		r.listener = nil
+	}
+
+	r.port = spec.Port
+	// the listener is inherited by the new process on graceful upgrade.
+	listener, err := graceupdate.Global.Listen("tcp", fmt.Sprintf(":%d", spec.Port))
+	if err != nil {
+		r.err = err.Error()
+		logger.Errorf("%s: failed to listen on port %d: %v", r.name, spec.Port, err)
+		return
+	}
+
+	r.err = ""
+	r.listener = listener
+	r.wg.Add(1)
+	go r.serve(listener)
+}
+
+func (r *runtime) serve(listener net.Listener) {
+	defer r.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("%s: failed to accept connection: %v", r.name, err)
+			}
+			return
+		}
+
+		atomic.AddUint64(&r.totalConnections, 1)
+		rt := r.router.Load().(*router)
+		// new connections are rejected while the member is draining.
+		if graceupdate.IsDraining() {
+			atomic.AddUint64(&r.rejectedConnections, 1)
+			conn.Close()
+			continue
+		}
+
+		max := int64(rt.spec.MaxConnections)
+		if max > 0 && atomic.LoadInt64(&r.activeConnections) >= max {
+			atomic.AddUint64(&r.rejectedConnections, 1)
+			logger.Debugf("%s: too many connections, reject %s", r.name, conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		if !r.track(conn) {
+			conn.Close()
+			continue
+		}
+		go r.handleConn(rt, conn)
+	}
+}
+
+// track adds the connection to the active connections, it returns false
+// if the runtime is closed.
+func (r *runtime) track(conn net.Conn) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return false
+	}
+	r.conns[conn] = struct{}{}
+	atomic.AddInt64(&r.activeConnections, 1)
+	graceupdate.AddConnections(1)
+	r.wg.Add(1)
+	return true
+}
+
+func (r *runtime) untrack(conn net.Conn) {
+	r.lock.Lock()
+	delete(r.conns, conn)
+	r.lock.Unlock()
+
+	atomic.AddInt64(&r.activeConnections, -1)
+	graceupdate.AddConnections(-1)
+	r.wg.Done()
+}
+
+func (r *runtime) handleConn(rt *router, conn net.Conn) {
+	defer r.untrack(conn)
+	defer conn.Close()
+
+	// client is the connection to read from and to get the addresses of
+	// the client, it reads the PROXY protocol header at first if enabled.
+	client := conn
+	if rt.proxyProtocol != nil {
+		pc := rt.proxyProtocol.NewConn(conn)
+		if _, err := pc.Header(); err != nil {
+			logger.Debugf("%s: %v", r.name, err)
+			return
+		}
+		client = pc
+	}
+
+	br := bufio.NewReader(client)
+	p := rt.defaultPool
+
+	var peeked []byte
+	if rt.spec.inspectSNI() {
+		// if the client doesn't speak first, e.g. the client of MySQL,
+		// this is not a TLS connection, route it to the default pool.
+		conn.SetReadDeadline(time.Now().Add(rt.firstByteTimeout))
+		_, err := br.Peek(1)
+
+		var sni string
+		if err == nil {
+			conn.SetReadDeadline(time.Now().Add(rt.clientHelloTimeout))
+			sni, peeked, err = peekSNI(br)
+			if err != nil {
+				logger.Debugf("%s: failed to read client hello from %s: %v", r.name, client.RemoteAddr(), err)
+				return
+			}
+		} else if ne := net.Error(nil); !errors.As(err, &ne) || !ne.Timeout() {
+			logger.Debugf("%s: failed to read from %s: %v", r.name, client.RemoteAddr(), err)
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+		p = rt.match(sni)
+	}
+
+	if p == nil {
+		logger.Debugf("%s: no pool for connection from %s", r.name, client.RemoteAddr())
+		return
+	}
+
+	clientIP, _, _ := net.SplitHostPort(client.RemoteAddr().String())
+	svr := p.choose(clientIP)
+	atomic.AddInt64(&svr.connections, 1)
+	defer atomic.AddInt64(&svr.connections, -1)
+
+	upstream, err := net.DialTimeout("tcp", svr.address, rt.connectTimeout)
+	if err != nil {
+		logger.Warnf("%s: failed to connect to %s: %v", r.name, svr.address, err)
+		return
+	}
+	defer upstream.Close()
+
+	if p.proxyProtocol != "" {
+		h := &proxyprotocol.Header{}
+		h.Src, _ = client.RemoteAddr().(*net.TCPAddr)
+		h.Dst, _ = client.LocalAddr().(*net.TCPAddr)
+		if h.Src == nil || h.Dst == nil {
+			h = nil
+		}
+		if _, err := upstream.Write(h.Format(p.proxyProtocol)); err != nil {
+			logger.Debugf("%s: failed to write to %s: %v", r.name, svr.address, err)
+			return
+		}
+	}
+
+	if len(peeked) > 0 {
+		if _, err := upstream.Write(peeked); err != nil {
+			logger.Debugf("%s: failed to write to %s: %v", r.name, svr.address, err)
+			return
+		}
+	}
+
+	t := &tunnel{idleTimeout: rt.idleTimeout}
+	t.touch()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		t.pipe(upstream, conn, br)
+	}()
+	go func() {
+		defer wg.Done()
+		t.pipe(conn, upstream, upstream)
+	}()
+	wg.Wait()
+}
+
+// Status returns the status of the runtime.
+func (r *runtime) Status() *Status {
+	r.lock.Lock()
+	port, err := r.port, r.err
+	r.lock.Unlock()
+
+	return &Status{
+		Port:                port,
+		Error:               err,
+		ActiveConnections:   atomic.LoadInt64(&r.activeConnections),
+		TotalConnections:    atomic.LoadUint64(&r.totalConnections),
+		RejectedConnections: atomic.LoadUint64(&r.rejectedConnections),
+	}
+}
+
+// Close closes the listener, and waits for the connections to finish, the
+// remaining connections are closed at the drain deadline.
+func (r *runtime) Close() {
+	r.lock.Lock()
+	r.closed = true
+	if r.listener != nil {
+		r.listener.Close()
+	}
+	r.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(graceupdate.DrainTimeout()):
+	}
+
+	r.lock.Lock()
+	logger.Warnf("%s: drain timeout, close %d connections", r.name, len(r.conns))
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.lock.Unlock()
+
+	<-done
+}
+
+// tunnel copies data between the client and the backend server, it is
+// closed if there's no data in either direction for idleTimeout.
+type tunnel struct {
+	idleTimeout time.Duration
+	lastActive  int64
+}
+
+func (t *tunnel) touch() {
+	atomic.StoreInt64(&t.lastActive, fasttime.NowUnixNano())
+}
+
+func (t *tunnel) idle() bool {
+	last := atomic.LoadInt64(&t.lastActive)
+	return time.Duration(fasttime.NowUnixNano()-last) >= t.idleTimeout
+}
+
+// pipe copies data from src, which reads from srcConn, to dst. When src
+// reaches EOF, the write side of dst is closed, and for other errors,
+// both connections are closed so that the other direction stops too.
+func (t *tunnel) pipe(dst, srcConn net.Conn, src io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		if t.idleTimeout > 0 {
+			srcConn.SetReadDeadline(time.Now().Add(t.idleTimeout))
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			t.touch()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				err = werr
+			}
+		}
+		if err == nil {
+			continue
+		}
+
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() && !t.idle() {
+			// the other direction is active.
+			continue
+		}
+		if err == io.EOF {
+			if tc, ok := dst.(*net.TCPConn); ok {
+				tc.CloseWrite()
+				return
+			}
+		}
+		dst.Close()
+		srcConn.Close()
+		return
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// recordTypeHandshake is the first byte of a TLS handshake record.
+const recordTypeHandshake = 0x16
+
+var errClientHelloRead = errors.New("client hello read")
+
+// readOnlyConn is a net.Conn which can only be read, it is used to parse
+// the ClientHello message without writing anything to the client.
+// The last read error is recorded in err.
+type readOnlyConn struct {
+	r   io.Reader
+	err error
+}
+
+func (c *readOnlyConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c *readOnlyConn) Close() error                       { return nil }
+func (c *readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c *readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c *readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c *readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// peekSNI reads the ClientHello message from br if the client starts a
+// TLS handshake, and returns the server name in it. The bytes read are
+// returned too, which need to be sent to the backend server before the
+// remaining bytes of br, as the TLS connection is not terminated. If there
+// is an error reading from br, the bytes read before the error are returned
+// along with the error.
+func peekSNI(br *bufio.Reader) (sni string, peeked []byte, err error) {
+	header, err := br.Peek(1)
+	if err != nil {
+		return "", nil, err
+	}
+	if header[0] != recordTypeHandshake {
+		return "", nil, nil
+	}
+
+	buf := &bytes.Buffer{}
+	conn := &readOnlyConn{r: io.TeeReader(br, buf)}
+	err = tls.Server(conn, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			sni = hello.ServerName
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+
+	if errors.Is(err, errClientHelloRead) {
+		return strings.ToLower(sni), buf.Bytes(), nil
+	}
+	if conn.err != nil {
+		return "", buf.Bytes(), conn.err
+	}
+
+	// not a valid ClientHello, but the connection is still forwarded
+	// as it is.
+	return "", buf.Bytes(), nil
+}
+
+// matchSNI returns whether the sni matches the host, which could be a
+// wildcard like "*.example.com" that matches exactly one label.
+func matchSNI(host, sni string) bool {
+	if !strings.HasPrefix(host, "*.") {
+		return host == sni
+	}
+	i := strings.IndexByte(sni, '.')
+	return i > 0 && sni[i:] == host[1:]
+}
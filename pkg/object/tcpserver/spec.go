@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/proxyprotocol"
+)
+
+type (
+	// Spec describes the TCPServer.
+	Spec struct {
+		Port               uint16 `json:"port" jsonschema:"required,minimum=1"`
+		MaxConnections     uint32 `json:"maxConnections,omitempty" jsonschema:"omitempty"`
+		IdleTimeout        string `json:"idleTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		ConnectTimeout     string `json:"connectTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		ClientHelloTimeout string `json:"clientHelloTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+		FirstByteTimeout   string `json:"firstByteTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+
+		// ProxyProtocol accepts the PROXY protocol on the connections.
+		ProxyProtocol *proxyprotocol.Spec `json:"proxyProtocol,omitempty" jsonschema:"omitempty"`
+
+		Rules       []*RuleSpec `json:"rules,omitempty" jsonschema:"omitempty"`
+		DefaultPool *PoolSpec   `json:"defaultPool,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RuleSpec routes the TLS connections whose SNI matches one of the
+	// hosts to the pool, a host could be an exact host name or a wildcard
+	// like "*.example.com".
+	RuleSpec struct {
+		SNI  []string  `json:"sni" jsonschema:"required,minItems=1"`
+		Pool *PoolSpec `json:"pool" jsonschema:"required"`
+	}
+
+	// PoolSpec describes a pool of backend servers.
+	PoolSpec struct {
+		Servers     []*ServerSpec `json:"servers" jsonschema:"required,minItems=1"`
+		LoadBalance string        `json:"loadBalance,omitempty" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=leastConnections,enum=ipHash"`
+
+		// ProxyProtocol is the version of the PROXY protocol header sent
+		// to the servers, empty means no header.
+		ProxyProtocol string `json:"proxyProtocol,omitempty" jsonschema:"omitempty,enum=,enum=v1,enum=v2"`
+	}
+
+	// ServerSpec describes a backend server.
+	ServerSpec struct {
+		Address string `json:"address" jsonschema:"required"`
+		Weight  int    `json:"weight,omitempty" jsonschema:"omitempty,minimum=0,maximum=100"`
+	}
+)
+
+func parseDuration(name, d string, dft time.Duration) (time.Duration, error) {
+	if d == "" {
+		return dft, nil
+	}
+	v, err := time.ParseDuration(d)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s: %v", name, d, err)
+	}
+	return v, nil
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Rules) == 0 && spec.DefaultPool == nil {
+		return fmt.Errorf("both rules and defaultPool are empty")
+	}
+
+	if _, err := parseDuration("idleTimeout", spec.IdleTimeout, 0); err != nil {
+		return err
+	}
+	if _, err := parseDuration("connectTimeout", spec.ConnectTimeout, 0); err != nil {
+		return err
+	}
+	if _, err := parseDuration("clientHelloTimeout", spec.ClientHelloTimeout, 0); err != nil {
+		return err
+	}
+	if _, err := parseDuration("firstByteTimeout", spec.FirstByteTimeout, 0); err != nil {
+		return err
+	}
+
+	sni := map[string]struct{}{}
+	for _, rule := range spec.Rules {
+		for _, host := range rule.SNI {
+			host = strings.ToLower(host)
+			if strings.Contains(host, "*") && (!strings.HasPrefix(host, "*.") || strings.Count(host, "*") > 1) {
+				return fmt.Errorf("invalid wildcard sni %s", host)
+			}
+			if _, ok := sni[host]; ok {
+				return fmt.Errorf("duplicated sni %s", host)
+			}
+			sni[host] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Validate validates PoolSpec.
+func (spec *PoolSpec) Validate() error {
+	serversGotWeight := 0
+	for _, server := range spec.Servers {
+		if server.Weight > 0 {
+			serversGotWeight++
+		}
+	}
+	if serversGotWeight > 0 && serversGotWeight < len(spec.Servers) {
+		return fmt.Errorf("not all servers have weight(%d/%d)", serversGotWeight, len(spec.Servers))
+	}
+	return nil
+}
+
+// Validate validates ServerSpec.
+func (spec *ServerSpec) Validate() error {
+	if _, _, err := net.SplitHostPort(spec.Address); err != nil {
+		return fmt.Errorf("invalid address %s: %v", spec.Address, err)
+	}
+	return nil
+}
+
+// inspectSNI returns whether the SNI of the connections needs to be
+// inspected.
+func (spec *Spec) inspectSNI() bool {
+	return len(spec.Rules) > 0
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of TCPServer.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of TCPServer.
+	Kind = "TCPServer"
+)
+
+func init() {
+	supervisor.Register(&TCPServer{})
+}
+
+type (
+	// TCPServer is a layer 4 proxy, which routes the TCP connections to
+	// the pools of backend servers, TLS connections could be routed by
+	// their SNI without termination.
+	TCPServer struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		runtime   *runtime
+	}
+)
+
+// Category returns the category of TCPServer.
+func (ts *TCPServer) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TCPServer.
+func (ts *TCPServer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TCPServer.
+func (ts *TCPServer) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes TCPServer.
+func (ts *TCPServer) Init(superSpec *supervisor.Spec) {
+	ts.superSpec, ts.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ts.runtime = newRuntime(superSpec.Name())
+	ts.runtime.reload(ts.spec)
+}
+
+// Inherit inherits previous generation of TCPServer, the listener and the
+// existing connections are kept.
+func (ts *TCPServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	ts.superSpec, ts.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	ts.runtime = previousGeneration.(*TCPServer).runtime
+	ts.runtime.reload(ts.spec)
+}
+
+// Status returns the status of TCPServer.
+func (ts *TCPServer) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: ts.runtime.Status(),
+	}
+}
+
+// Close closes TCPServer.
+func (ts *TCPServer) Close() {
+	ts.runtime.Close()
+}
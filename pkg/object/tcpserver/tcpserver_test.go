@@ -0,0 +1,533 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tcpserver
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/megaease/easegress/pkg/graceupdate"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/loadbalance"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startBackend starts a backend server which writes its name and then
+// echoes the data from the client, the server is a TLS server if cert is
+// not nil.
+func startBackend(t *testing.T, name string, cert *tls.Certificate) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if cert != nil {
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{*cert}})
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprintf(conn, "%s\n", name)
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func newTestTCPServer(t *testing.T, yamlConfig string) *TCPServer {
+	superSpec, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+	require.NoError(t, err)
+	ts := &TCPServer{}
+	ts.Init(superSpec)
+	return ts
+}
+
+func inheritTestTCPServer(t *testing.T, prev *TCPServer, yamlConfig string) *TCPServer {
+	superSpec, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+	require.NoError(t, err)
+	ts := &TCPServer{}
+	ts.Inherit(superSpec, prev)
+	return ts
+}
+
+// dial connects to the TCPServer, and returns the connection and the name
+// of the backend server.
+func dial(t *testing.T, port int, serverName string) (net.Conn, string) {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	var conn net.Conn
+	var err error
+	if serverName == "" {
+		conn, err = net.DialTimeout("tcp", addr, time.Second)
+	} else {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", addr, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		})
+	}
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	name, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return conn, ""
+	}
+	return conn, name[:len(name)-1]
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	validate := func(yamlConfig string) error {
+		_, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+		return err
+	}
+
+	assert.NoError(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+rules:
+- sni: [a.example.com, "*.example.org"]
+  pool:
+    servers:
+    - address: 127.0.0.1:8080
+defaultPool:
+  servers:
+  - address: 127.0.0.1:8081
+`))
+
+	// no pools.
+	assert.Error(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+`))
+
+	// invalid wildcard.
+	assert.Error(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+rules:
+- sni: ["a.*.example.com"]
+  pool:
+    servers:
+    - address: 127.0.0.1:8080
+`))
+
+	// duplicated sni.
+	assert.Error(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+rules:
+- sni: [a.example.com]
+  pool:
+    servers:
+    - address: 127.0.0.1:8080
+- sni: [A.example.com]
+  pool:
+    servers:
+    - address: 127.0.0.1:8081
+`))
+
+	// invalid address.
+	assert.Error(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+defaultPool:
+  servers:
+  - address: 127.0.0.1
+`))
+
+	// not all servers have weight.
+	assert.Error(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+defaultPool:
+  servers:
+  - address: 127.0.0.1:8080
+    weight: 1
+  - address: 127.0.0.1:8081
+`))
+
+	// invalid duration.
+	assert.Error(validate(`
+name: tcp
+kind: TCPServer
+port: 10080
+idleTimeout: 10
+defaultPool:
+  servers:
+  - address: 127.0.0.1:8080
+`))
+}
+
+func TestMatchSNI(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(matchSNI("a.example.com", "a.example.com"))
+	assert.False(matchSNI("a.example.com", "b.example.com"))
+	assert.True(matchSNI("*.example.com", "a.example.com"))
+	assert.False(matchSNI("*.example.com", "a.b.example.com"))
+	assert.False(matchSNI("*.example.com", "example.com"))
+
+	rt := newRouter(&Spec{
+		Rules: []*RuleSpec{
+			{SNI: []string{"*.example.com"}, Pool: &PoolSpec{Servers: []*ServerSpec{{Address: "127.0.0.1:1"}}}},
+			{SNI: []string{"a.example.com"}, Pool: &PoolSpec{Servers: []*ServerSpec{{Address: "127.0.0.1:2"}}}},
+		},
+	})
+	assert.Equal(rt.rules[1].pool, rt.match("a.example.com"))
+	assert.Equal(rt.rules[0].pool, rt.match("b.example.com"))
+	assert.Nil(rt.match("example.org"))
+	assert.Nil(rt.match(""))
+}
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := []*ServerSpec{{Address: "127.0.0.1:1"}, {Address: "127.0.0.1:2"}}
+	p := newPool(&PoolSpec{Servers: servers})
+	assert.Equal("127.0.0.1:1", p.choose("").address)
+	assert.Equal("127.0.0.1:2", p.choose("").address)
+	assert.Equal("127.0.0.1:1", p.choose("").address)
+
+	p = newPool(&PoolSpec{Servers: servers, LoadBalance: loadbalance.PolicyIPHash})
+	svr := p.choose("10.0.0.1")
+	for i := 0; i < 10; i++ {
+		assert.Equal(svr, p.choose("10.0.0.1"))
+	}
+
+	p = newPool(&PoolSpec{Servers: servers, LoadBalance: loadbalance.PolicyLeastConnections})
+	p.servers[0].connections = 2
+	assert.Equal("127.0.0.1:2", p.choose("").address)
+
+	p = newPool(&PoolSpec{
+		Servers:     []*ServerSpec{{Address: "127.0.0.1:1", Weight: 1}, {Address: "127.0.0.1:2", Weight: 3}},
+		LoadBalance: loadbalance.PolicyRandom,
+	})
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[p.choose("").address]++
+	}
+	assert.InDelta(750, counts["127.0.0.1:2"], 100)
+}
+
+func TestTCPServer(t *testing.T) {
+	assert := assert.New(t)
+
+	cert := selfSignedCert(t)
+	backendA := startBackend(t, "a", &cert)
+	defer backendA.Close()
+	backendB := startBackend(t, "b", &cert)
+	defer backendB.Close()
+	backendPlain := startBackend(t, "plain", nil)
+	defer backendPlain.Close()
+
+	port := freePort(t)
+	yamlConfig := fmt.Sprintf(`
+name: tcp
+kind: TCPServer
+port: %d
+clientHelloTimeout: 10s
+firstByteTimeout: 100ms
+rules:
+- sni: [a.example.com]
+  pool:
+    servers:
+    - address: %s
+- sni: ["*.example.com"]
+  pool:
+    servers:
+    - address: %s
+defaultPool:
+  servers:
+  - address: %s
+`, port, backendA.Addr(), backendB.Addr(), backendPlain.Addr())
+	ts := newTestTCPServer(t, yamlConfig)
+	defer ts.Close()
+
+	// TLS connections are routed by SNI without termination.
+	conn, name := dial(t, port, "a.example.com")
+	assert.Equal("a", name)
+	_, err := conn.Write([]byte("hello\n"))
+	assert.NoError(err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("hello\n", line)
+	conn.Close()
+
+	conn, name = dial(t, port, "b.example.com")
+	assert.Equal("b", name)
+	conn.Close()
+
+	// plain TCP connections whose clients don't speak first go to the
+	// default pool without waiting for the client hello timeout.
+	start := time.Now()
+	conn, name = dial(t, port, "")
+	assert.Equal("plain", name)
+	assert.Less(time.Since(start), 5*time.Second)
+	conn.Close()
+
+	// reload with the same port keeps the existing connections.
+	conn, name = dial(t, port, "a.example.com")
+	assert.Equal("a", name)
+
+	yamlConfig = fmt.Sprintf(`
+name: tcp
+kind: TCPServer
+port: %d
+maxConnections: 1
+defaultPool:
+  servers:
+  - address: %s
+`, port, backendPlain.Addr())
+	ts = inheritTestTCPServer(t, ts, yamlConfig)
+
+	_, err = conn.Write([]byte("still alive\n"))
+	assert.NoError(err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err = bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("still alive\n", line)
+
+	// the connection limit is reached.
+	conn2, name := dial(t, port, "")
+	assert.Equal("", name)
+	conn2.Close()
+	conn.Close()
+
+	assert.Eventually(func() bool {
+		conn, name = dial(t, port, "")
+		conn.Close()
+		return name == "plain"
+	}, time.Second, 50*time.Millisecond)
+
+	status := ts.Status().ObjectStatus.(*Status)
+	assert.Equal(uint16(port), status.Port)
+	assert.GreaterOrEqual(status.RejectedConnections, uint64(1))
+	assert.GreaterOrEqual(status.TotalConnections, uint64(6))
+}
+
+func TestIdleTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startBackend(t, "plain", nil)
+	defer backend.Close()
+
+	port := freePort(t)
+	ts := newTestTCPServer(t, fmt.Sprintf(`
+name: tcp
+kind: TCPServer
+port: %d
+idleTimeout: 200ms
+defaultPool:
+  servers:
+  - address: %s
+`, port, backend.Addr()))
+	defer ts.Close()
+
+	conn, name := dial(t, port, "")
+	defer conn.Close()
+	assert.Equal("plain", name)
+
+	// the connection is kept if it is active.
+	br := bufio.NewReader(conn)
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		_, err := conn.Write([]byte("ping\n"))
+		assert.NoError(err)
+		line, err := br.ReadString('\n')
+		assert.NoError(err)
+		assert.Equal("ping\n", line)
+	}
+
+	// and closed after the idle timeout.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := br.ReadString('\n')
+	assert.Equal(io.EOF, err)
+	assert.Eventually(func() bool {
+		return ts.Status().ObjectStatus.(*Status).ActiveConnections == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := startBackend(t, "plain", nil)
+	defer backend.Close()
+
+	defer graceupdate.SetDrainTimeout(graceupdate.DrainTimeout())
+	graceupdate.SetDrainTimeout(300 * time.Millisecond)
+
+	yamlConfig := `
+name: tcp
+kind: TCPServer
+port: %d
+defaultPool:
+  servers:
+  - address: %s
+`
+
+	// the connections finished in time are not interrupted.
+	port := freePort(t)
+	ts := newTestTCPServer(t, fmt.Sprintf(yamlConfig, port, backend.Addr()))
+	conn, name := dial(t, port, "")
+	assert.Equal("plain", name)
+
+	closed := make(chan struct{})
+	go func() {
+		ts.Close()
+		close(closed)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	br := bufio.NewReader(conn)
+	_, err := conn.Write([]byte("ping\n"))
+	assert.NoError(err)
+	line, err := br.ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("ping\n", line)
+	conn.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("TCPServer is not closed after the connections finished")
+	}
+
+	// and the remaining ones are closed at the deadline.
+	port = freePort(t)
+	ts = newTestTCPServer(t, fmt.Sprintf(yamlConfig, port, backend.Addr()))
+	conn, name = dial(t, port, "")
+	defer conn.Close()
+	assert.Equal("plain", name)
+
+	start := time.Now()
+	ts.Close()
+	assert.GreaterOrEqual(time.Since(start), 300*time.Millisecond)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	assert.Equal(io.EOF, err)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	// the backend echoes the PROXY protocol header it receives.
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				conn.Write([]byte(line))
+			}()
+		}
+	}()
+
+	port := freePort(t)
+	ts := newTestTCPServer(t, fmt.Sprintf(`
+name: tcp
+kind: TCPServer
+port: %d
+proxyProtocol:
+  trustedCIDRs: [127.0.0.1]
+defaultPool:
+  proxyProtocol: v1
+  servers:
+  - address: %s
+`, port, backend.Addr()))
+	defer ts.Close()
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the addresses of the client header are passed to the backend.
+	_, err = conn.Write([]byte("PROXY TCP4 192.168.1.1 10.0.0.1 56324 443\r\n"))
+	assert.NoError(err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("PROXY TCP4 192.168.1.1 10.0.0.1 56324 443\r\n", line)
+
+	// connections without the header are rejected.
+	conn2, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	require.NoError(t, err)
+	defer conn2.Close()
+	_, err = conn2.Write([]byte("hello\n"))
+	assert.NoError(err)
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = bufio.NewReader(conn2).ReadString('\n')
+	assert.Error(err)
+}
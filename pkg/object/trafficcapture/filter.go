@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/megaease/easegress/pkg/util/stringtool"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+type (
+	// FilterSpec describes the requests to capture, a request is captured
+	// if it matches all the conditions.
+	FilterSpec struct {
+		// Hosts match the host of the request without the port, the
+		// request matches if any of them matches.
+		Hosts   []*urlrule.StringMatch `json:"hosts" jsonschema:"omitempty"`
+		Path    *urlrule.StringMatch   `json:"path,omitempty" jsonschema:"omitempty"`
+		Methods []string               `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		// Headers match the headers of the request, all of them must
+		// match.
+		Headers map[string]*urlrule.StringMatch `json:"headers" jsonschema:"omitempty"`
+	}
+
+	filter struct {
+		spec *FilterSpec
+	}
+)
+
+// Validate validates FilterSpec.
+func (spec *FilterSpec) Validate() error {
+	for _, h := range spec.Hosts {
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("invalid host: %v", err)
+		}
+	}
+	if spec.Path != nil {
+		if err := spec.Path.Validate(); err != nil {
+			return fmt.Errorf("invalid path: %v", err)
+		}
+	}
+	for k, h := range spec.Headers {
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("invalid header %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+func newFilter(spec *FilterSpec) *filter {
+	if spec == nil {
+		return &filter{}
+	}
+
+	for _, h := range spec.Hosts {
+		h.Init()
+	}
+	if spec.Path != nil {
+		spec.Path.Init()
+	}
+	for _, h := range spec.Headers {
+		h.Init()
+	}
+	return &filter{spec: spec}
+}
+
+// match returns whether the request of the record matches the filter, it
+// matches all requests if there's no filter.
+func (f *filter) match(r *Record) bool {
+	if f.spec == nil {
+		return true
+	}
+
+	if len(f.spec.Methods) > 0 && !stringtool.StrInSlice(r.Method, f.spec.Methods) {
+		return false
+	}
+
+	if len(f.spec.Hosts) > 0 {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		matched := false
+		for _, h := range f.spec.Hosts {
+			if h.Match(host) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if f.spec.Path != nil {
+		if !f.spec.Path.Match(r.Path) {
+			return false
+		}
+	}
+
+	for k, h := range f.spec.Headers {
+		if !h.Match(r.RequestHeader.Get(k)) {
+			return false
+		}
+	}
+
+	return true
+}
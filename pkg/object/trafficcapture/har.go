@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/megaease/easegress/pkg/version"
+)
+
+type (
+	// harEncoder encodes the records to a HAR 1.2 file, one entry per
+	// record. The file is a valid HAR file only after it is closed.
+	harEncoder struct {
+		first bool
+	}
+
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+		Comment  string `json:"comment,omitempty"`
+	}
+
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+	}
+
+	harContent struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+		Encoding string `json:"encoding,omitempty"`
+		Comment  string `json:"comment,omitempty"`
+	}
+
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int64          `json:"bodySize"`
+	}
+
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+
+	harEntry struct {
+		StartedDateTime string      `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+)
+
+func newHAREncoder() *harEncoder {
+	return &harEncoder{}
+}
+
+func (e *harEncoder) ext() string {
+	return ".har"
+}
+
+func (e *harEncoder) begin(w io.Writer) error {
+	e.first = true
+	creator, _ := json.Marshal(map[string]string{"name": "Easegress", "version": version.RELEASE})
+	_, err := fmt.Fprintf(w, `{"log":{"version":"1.2","creator":%s,"entries":[`, creator)
+	return err
+}
+
+func (e *harEncoder) end(w io.Writer) error {
+	_, err := io.WriteString(w, "\n]}}\n")
+	return err
+}
+
+func (e *harEncoder) encode(w io.Writer, r *Record) error {
+	data, err := json.Marshal(newHAREntry(r))
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if e.first {
+		sep, e.first = "\n", false
+	}
+	if _, err = io.WriteString(w, sep); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// harHeaders converts the headers to name value pairs sorted by name.
+func harHeaders(h http.Header) []harNameValue {
+	result := []harNameValue{}
+	for k, values := range h {
+		for _, v := range values {
+			result = append(result, harNameValue{Name: k, Value: v})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func harCookies(cookies []*http.Cookie) []harNameValue {
+	result := []harNameValue{}
+	for _, c := range cookies {
+		result = append(result, harNameValue{Name: c.Name, Value: c.Value})
+	}
+	return result
+}
+
+// harText returns the text of a body, it is base64 encoded if it is not a
+// valid UTF-8 string.
+func harText(body []byte) (text, encoding string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func truncatedComment(captured []byte, size int64) string {
+	if int64(len(captured)) < size {
+		return fmt.Sprintf("truncated to %d bytes", len(captured))
+	}
+	return ""
+}
+
+func newHAREntry(r *Record) *harEntry {
+	ms := float64(r.Duration) / float64(time.Millisecond)
+	entry := &harEntry{
+		StartedDateTime: r.StartTime.Format(time.RFC3339Nano),
+		Time:            ms,
+		Timings:         harTimings{Wait: ms},
+		Comment:         "server: " + r.Server,
+	}
+	if host, _, err := net.SplitHostPort(r.LocalAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+
+	// build the request.
+	u := r.Scheme + "://" + r.Host + r.URI
+	if pu, err := url.Parse(r.URI); err == nil && pu.IsAbs() {
+		u = r.URI
+	}
+	req := &entry.Request
+	req.Method = r.Method
+	req.URL = u
+	req.HTTPVersion = r.Proto
+	req.Headers = harHeaders(r.RequestHeader)
+	req.Cookies = harCookies((&http.Request{Header: r.RequestHeader}).Cookies())
+	req.QueryString = []harNameValue{}
+	if pu, err := url.Parse(u); err == nil {
+		for k, values := range pu.Query() {
+			for _, v := range values {
+				req.QueryString = append(req.QueryString, harNameValue{Name: k, Value: v})
+			}
+		}
+		sort.SliceStable(req.QueryString, func(i, j int) bool {
+			return req.QueryString[i].Name < req.QueryString[j].Name
+		})
+	}
+	req.HeadersSize = -1
+	req.BodySize = r.RequestBodySize
+	if len(r.RequestBody) > 0 {
+		// HAR has no encoding field for the post data, so binary bodies
+		// are base64 encoded and noted in the comment.
+		text, encoding := harText(r.RequestBody)
+		req.PostData = &harPostData{
+			MimeType: r.RequestHeader.Get("Content-Type"),
+			Text:     text,
+			Comment:  truncatedComment(r.RequestBody, r.RequestBodySize),
+		}
+		if encoding != "" {
+			req.PostData.Comment = joinComments(req.PostData.Comment, "base64 encoded")
+		}
+	}
+
+	// build the response.
+	resp := &entry.Response
+	resp.Status = r.StatusCode
+	resp.StatusText = http.StatusText(r.StatusCode)
+	resp.HTTPVersion = r.Proto
+	resp.Headers = harHeaders(r.ResponseHeader)
+	resp.Cookies = harCookies((&http.Response{Header: r.ResponseHeader}).Cookies())
+	resp.RedirectURL = r.ResponseHeader.Get("Location")
+	resp.HeadersSize = -1
+	resp.BodySize = r.ResponseBodySize
+	resp.Content = harContent{
+		Size:     r.ResponseBodySize,
+		MimeType: r.ResponseHeader.Get("Content-Type"),
+	}
+	if r.ResponseBodySize < 0 {
+		resp.Content.Size = 0
+		resp.Content.Comment = "body is not captured"
+	} else if len(r.ResponseBody) > 0 {
+		resp.Content.Text, resp.Content.Encoding = harText(r.ResponseBody)
+		resp.Content.Comment = truncatedComment(r.ResponseBody, r.ResponseBodySize)
+	}
+
+	return entry
+}
+
+func joinComments(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + ", " + b
+}
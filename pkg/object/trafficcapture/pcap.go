@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	pcapMagic    = 0xa1b2c3d4
+	pcapSnapLen  = 65535
+	linkTypeRaw  = 101
+	tcpFlagACK   = 0x10
+	tcpFlagPSH   = 0x08
+	maxSegment   = 32 * 1024
+	maxTCPFlows  = 10000
+	ipv4HeaderSz = 20
+	ipv6HeaderSz = 40
+	tcpHeaderSz  = 20
+)
+
+type (
+	// pcapEncoder encodes the records to a PCAP file. As the requests are
+	// not captured from the network, the packets are synthesized: the
+	// request and the response of a record are re-encoded as HTTP/1.1
+	// messages and sent in TCP segments between the addresses of the
+	// client and the HTTPServer, so that they can be analyzed by tools
+	// like Wireshark. The packets have no link layer header.
+	pcapEncoder struct {
+		ipID  uint16
+		flows map[string]*tcpFlow
+	}
+
+	// tcpFlow records the next sequence numbers of a connection, so that
+	// the segments of the requests on the same connection are contiguous.
+	tcpFlow struct {
+		clientSeq uint32
+		serverSeq uint32
+	}
+
+	endpoint struct {
+		ip   net.IP
+		port uint16
+	}
+)
+
+func newPCAPEncoder() *pcapEncoder {
+	return &pcapEncoder{}
+}
+
+func (e *pcapEncoder) ext() string {
+	return ".pcap"
+}
+
+func (e *pcapEncoder) begin(w io.Writer) error {
+	e.flows = map[string]*tcpFlow{}
+
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeRaw)
+	_, err := w.Write(hdr[:])
+	return err
+}
+
+func (e *pcapEncoder) end(w io.Writer) error {
+	return nil
+}
+
+// parseEndpoint parses the address, the unspecified address is returned if
+// the address is invalid.
+func parseEndpoint(addr string, defaultPort uint16) endpoint {
+	ep := endpoint{ip: net.IPv4zero, port: defaultPort}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ep
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		ep.ip = ip
+	}
+	if p, err := strconv.Atoi(port); err == nil {
+		ep.port = uint16(p)
+	}
+	return ep
+}
+
+func (e *pcapEncoder) encode(w io.Writer, r *Record) error {
+	client := parseEndpoint(r.RemoteAddr, 0)
+	server := parseEndpoint(r.LocalAddr, 80)
+
+	// use IPv4 only if both addresses are IPv4 addresses.
+	if client.ip.To4() != nil && server.ip.To4() != nil {
+		client.ip, server.ip = client.ip.To4(), server.ip.To4()
+	} else {
+		client.ip, server.ip = client.ip.To16(), server.ip.To16()
+	}
+
+	key := r.RemoteAddr + "-" + r.LocalAddr
+	flow := e.flows[key]
+	if flow == nil {
+		if len(e.flows) >= maxTCPFlows {
+			e.flows = map[string]*tcpFlow{}
+		}
+		flow = &tcpFlow{clientSeq: 1, serverSeq: 1}
+		e.flows[key] = flow
+	}
+
+	err := e.writeSegments(w, r.StartTime, client, server, &flow.clientSeq, flow.serverSeq, requestBytes(r))
+	if err != nil {
+		return err
+	}
+	return e.writeSegments(w, r.StartTime.Add(r.Duration), server, client, &flow.serverSeq, flow.clientSeq, responseBytes(r))
+}
+
+// writeSegments writes the data in TCP segments from src to dst.
+func (e *pcapEncoder) writeSegments(w io.Writer, t time.Time, src, dst endpoint, seq *uint32, ack uint32, data []byte) error {
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxSegment {
+			n = maxSegment
+		}
+		if err := e.writePacket(w, t, e.packet(src, dst, *seq, ack, data[:n])); err != nil {
+			return err
+		}
+		*seq += uint32(n)
+		data = data[n:]
+	}
+	return nil
+}
+
+func (e *pcapEncoder) writePacket(w io.Writer, t time.Time, pkt []byte) error {
+	var hdr [16]byte
+	binary.LittleEndian.PutUint32(hdr[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(len(pkt)))
+	binary.LittleEndian.PutUint32(hdr[12:], uint32(len(pkt)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(pkt)
+	return err
+}
+
+// packet builds an IP packet which contains a TCP segment.
+func (e *pcapEncoder) packet(src, dst endpoint, seq, ack uint32, payload []byte) []byte {
+	tcpLen := tcpHeaderSz + len(payload)
+	ipv4 := len(src.ip) == net.IPv4len
+
+	ipLen := ipv6HeaderSz
+	if ipv4 {
+		ipLen = ipv4HeaderSz
+	}
+	pkt := make([]byte, ipLen+tcpLen)
+
+	if ipv4 {
+		ip := pkt[:ipv4HeaderSz]
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(len(pkt)))
+		e.ipID++
+		binary.BigEndian.PutUint16(ip[4:], e.ipID)
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+		ip[8] = 64
+		ip[9] = 6 // TCP
+		copy(ip[12:], src.ip)
+		copy(ip[16:], dst.ip)
+		binary.BigEndian.PutUint16(ip[10:], ^checksum(0, ip))
+	} else {
+		ip := pkt[:ipv6HeaderSz]
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(tcpLen))
+		ip[6] = 6 // TCP
+		ip[7] = 64
+		copy(ip[8:], src.ip)
+		copy(ip[24:], dst.ip)
+	}
+
+	tcp := pkt[ipLen:]
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = (tcpHeaderSz / 4) << 4
+	tcp[13] = tcpFlagACK | tcpFlagPSH
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[tcpHeaderSz:], payload)
+
+	// the checksum of the pseudo header.
+	sum := uint32(checksum(0, src.ip))
+	sum = uint32(checksum(sum, dst.ip))
+	sum += 6 + uint32(tcpLen)
+	binary.BigEndian.PutUint16(tcp[16:], ^checksum(sum, tcp))
+
+	return pkt
+}
+
+// checksum adds the data to the Internet checksum and returns the folded
+// result, the sum could be passed to the next call as the initial value.
+func checksum(sum uint32, data []byte) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return uint16(sum)
+}
+
+// writeHeader writes the headers sorted by name, the Content-Length is
+// replaced by the size of the captured body, so that the message is
+// consistent even if the body is truncated.
+func writeHeader(buf *bytes.Buffer, h http.Header, body []byte) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length", "Transfer-Encoding":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+	fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(body))
+	buf.Write(body)
+}
+
+func requestBytes(r *Record) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s HTTP/1.1\r\nHost: %s\r\n", r.Method, r.URI, r.Host)
+	writeHeader(buf, r.RequestHeader, r.RequestBody)
+	return buf.Bytes()
+}
+
+func responseBytes(r *Record) []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", r.StatusCode, http.StatusText(r.StatusCode))
+	writeHeader(buf, r.ResponseHeader, r.ResponseBody)
+	return buf.Bytes()
+}
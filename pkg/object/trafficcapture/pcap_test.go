@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPacket struct {
+	src, dst net.IP
+	srcPort  uint16
+	dstPort  uint16
+	seq      uint32
+	payload  string
+}
+
+// parsePCAP parses the packets and verifies the checksums.
+func parsePCAP(t *testing.T, data []byte) []*testPacket {
+	assert := assert.New(t)
+
+	assert.Equal(uint32(pcapMagic), binary.LittleEndian.Uint32(data))
+	assert.Equal(uint32(linkTypeRaw), binary.LittleEndian.Uint32(data[20:]))
+	data = data[24:]
+
+	var packets []*testPacket
+	for len(data) > 0 {
+		n := binary.LittleEndian.Uint32(data[8:])
+		pkt := data[16 : 16+n]
+		data = data[16+n:]
+
+		p := &testPacket{}
+		var tcp []byte
+		var sum uint32
+		if pkt[0]>>4 == 4 {
+			assert.Equal(uint16(0), ^checksum(0, pkt[:ipv4HeaderSz]))
+			p.src, p.dst = net.IP(pkt[12:16]), net.IP(pkt[16:20])
+			tcp = pkt[ipv4HeaderSz:]
+		} else {
+			p.src, p.dst = net.IP(pkt[8:24]), net.IP(pkt[24:40])
+			tcp = pkt[ipv6HeaderSz:]
+		}
+		sum = uint32(checksum(0, p.src))
+		sum = uint32(checksum(sum, p.dst))
+		sum += 6 + uint32(len(tcp))
+		assert.Equal(uint16(0), ^checksum(sum, tcp))
+
+		p.srcPort = binary.BigEndian.Uint16(tcp[0:])
+		p.dstPort = binary.BigEndian.Uint16(tcp[2:])
+		p.seq = binary.BigEndian.Uint32(tcp[4:])
+		p.payload = string(tcp[tcpHeaderSz:])
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func TestPCAPEncoder(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &Record{
+		StartTime:        time.Now(),
+		Duration:         time.Millisecond,
+		RemoteAddr:       "192.168.1.2:50000",
+		LocalAddr:        "10.0.0.1:8080",
+		Method:           http.MethodPost,
+		Host:             "example.com",
+		URI:              "/api?id=1",
+		RequestHeader:    http.Header{"Content-Length": []string{"100"}, "X-Debug": []string{"true"}},
+		RequestBody:      []byte("name"),
+		StatusCode:       http.StatusOK,
+		ResponseHeader:   http.Header{"Content-Type": []string{"text/plain"}},
+		ResponseBody:     []byte(strings.Repeat("a", maxSegment+10)),
+		RequestBodySize:  100,
+		ResponseBodySize: maxSegment + 10,
+	}
+
+	buf := &bytes.Buffer{}
+	e := newPCAPEncoder()
+	assert.NoError(e.begin(buf))
+	assert.NoError(e.encode(buf, r))
+	assert.NoError(e.encode(buf, r))
+	assert.NoError(e.end(buf))
+
+	packets := parsePCAP(t, buf.Bytes())
+	assert.Len(packets, 6)
+
+	req := packets[0]
+	assert.Equal("192.168.1.2", req.src.String())
+	assert.Equal("10.0.0.1", req.dst.String())
+	assert.Equal(uint16(50000), req.srcPort)
+	assert.Equal(uint16(8080), req.dstPort)
+	assert.Equal(uint32(1), req.seq)
+	assert.Equal("POST /api?id=1 HTTP/1.1\r\nHost: example.com\r\nX-Debug: true\r\nContent-Length: 4\r\n\r\nname", req.payload)
+
+	resp := packets[1]
+	assert.Equal("10.0.0.1", resp.src.String())
+	assert.Equal(uint16(8080), resp.srcPort)
+	assert.True(strings.HasPrefix(resp.payload, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n"))
+	assert.Len(resp.payload, maxSegment)
+	assert.Equal(resp.seq+maxSegment, packets[2].seq)
+
+	// the sequence numbers continue on the same connection.
+	assert.Equal(req.seq+uint32(len(req.payload)), packets[3].seq)
+
+	// IPv6 is used if any address is an IPv6 address.
+	r.RemoteAddr = "[fd00::2]:50000"
+	buf.Reset()
+	assert.NoError(e.begin(buf))
+	assert.NoError(e.encode(buf, r))
+	packets = parsePCAP(t, buf.Bytes())
+	assert.Equal("fd00::2", packets[0].src.String())
+	assert.Equal("10.0.0.1", packets[0].dst.String())
+}
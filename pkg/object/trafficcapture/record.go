@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+type (
+	// Record is a captured request and its response.
+	Record struct {
+		Server     string
+		StartTime  time.Time
+		Duration   time.Duration
+		RemoteAddr string
+		LocalAddr  string
+
+		Method        string
+		Scheme        string
+		Host          string
+		Path          string
+		URI           string
+		Proto         string
+		RequestHeader http.Header
+		RequestBody   []byte
+		// RequestBodySize is the size of the request body before it is
+		// truncated, -1 if the body is not captured, e.g. a stream.
+		RequestBodySize int64
+
+		StatusCode       int
+		ResponseHeader   http.Header
+		ResponseBody     []byte
+		ResponseBodySize int64
+	}
+
+	// Session captures a request and its response for the TrafficCaptures
+	// matching the request.
+	Session struct {
+		captures []*TrafficCapture
+		record   *Record
+	}
+)
+
+// Start starts capturing the request of the HTTPServer, it returns nil if
+// the request is not captured by any TrafficCapture, which is the common
+// case and is cheap. The request must be passed before it is modified.
+func Start(server string, stdr *http.Request) *Session {
+	list := captures.Load().([]*TrafficCapture)
+	if len(list) == 0 {
+		return nil
+	}
+
+	r := &Record{
+		Server:           server,
+		StartTime:        time.Now(),
+		RemoteAddr:       stdr.RemoteAddr,
+		Method:           stdr.Method,
+		Scheme:           "http",
+		Host:             stdr.Host,
+		Path:             stdr.URL.Path,
+		URI:              stdr.RequestURI,
+		Proto:            stdr.Proto,
+		RequestHeader:    stdr.Header,
+		RequestBodySize:  -1,
+		ResponseBodySize: -1,
+	}
+	if stdr.TLS != nil {
+		r.Scheme = "https"
+	}
+
+	var matched []*TrafficCapture
+	for _, tc := range list {
+		if tc.capture(server, r) {
+			matched = append(matched, tc)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	if addr, ok := stdr.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		r.LocalAddr = addr.String()
+	}
+	r.RequestHeader = stdr.Header.Clone()
+	return &Session{captures: matched, record: r}
+}
+
+// SetRequestBody sets the body of the request.
+func (s *Session) SetRequestBody(body []byte) {
+	s.record.RequestBody = body
+	s.record.RequestBodySize = int64(len(body))
+}
+
+// Finish records the response and sends the record to the TrafficCaptures.
+// The body is nil if it is a stream.
+func (s *Session) Finish(statusCode int, header http.Header, body []byte, duration time.Duration) {
+	r := s.record
+	r.Duration = duration
+	r.StatusCode = statusCode
+	r.ResponseHeader = header.Clone()
+	if body != nil {
+		r.ResponseBody = body
+		r.ResponseBodySize = int64(len(body))
+	}
+
+	for _, tc := range s.captures {
+		tc.add(r)
+	}
+}
+
+// truncateBodies truncates the bodies to the max size, the bodies are
+// sliced but never modified.
+func (r *Record) truncateBodies(maxSize int64) {
+	if int64(len(r.RequestBody)) > maxSize {
+		r.RequestBody = r.RequestBody[:maxSize]
+	}
+	if int64(len(r.ResponseBody)) > maxSize {
+		r.ResponseBody = r.ResponseBody[:maxSize]
+	}
+}
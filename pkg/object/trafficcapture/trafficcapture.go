@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package trafficcapture implements a business controller which records
+// the requests and responses of HTTPServers to HAR or PCAP files for
+// debugging.
+package trafficcapture
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Category is the category of TrafficCapture.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of TrafficCapture.
+	Kind = "TrafficCapture"
+
+	formatHAR  = "har"
+	formatPCAP = "pcap"
+)
+
+func init() {
+	supervisor.Register(&TrafficCapture{})
+}
+
+type (
+	// TrafficCapture is a business controller which records the matched
+	// requests and their responses of all HTTPServers, or the HTTPServers
+	// in the spec. The records are queued and written by a dedicated
+	// goroutine, they are dropped if the queue is full, so that the
+	// requests are never blocked by the capture.
+	TrafficCapture struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		filter  *filter
+		writer  *rotatingWriter
+		records chan *Record
+		done    chan struct{}
+		wg      sync.WaitGroup
+
+		numOfCaptured   int64
+		numOfSampledOut int64
+		numOfDropped    int64
+	}
+
+	// Spec describes TrafficCapture.
+	Spec struct {
+		// HTTPServers are the names of the HTTPServers to capture, default
+		// is all HTTPServers.
+		HTTPServers []string    `json:"httpServers" jsonschema:"omitempty,uniqueItems=true"`
+		Filter      *FilterSpec `json:"filter,omitempty" jsonschema:"omitempty"`
+		// SampleRate is the ratio of the matched requests to capture, from
+		// 0 to 1.
+		SampleRate float64 `json:"sampleRate" jsonschema:"omitempty,minimum=0,maximum=1"`
+		Format     string  `json:"format" jsonschema:"omitempty,enum=,enum=har,enum=pcap"`
+		Directory  string  `json:"directory" jsonschema:"required"`
+		// MaxFileSize is the maximum size in megabytes before a file is
+		// rotated.
+		MaxFileSize int `json:"maxFileSize" jsonschema:"omitempty,minimum=1"`
+		// MaxFiles is the maximum number of files to retain.
+		MaxFiles int `json:"maxFiles" jsonschema:"omitempty,minimum=1"`
+		// MaxBodySize is the maximum size in bytes of the captured bodies,
+		// the bodies are truncated if they are larger.
+		MaxBodySize int64 `json:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+		BufferSize  int   `json:"bufferSize" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of TrafficCapture.
+	Status struct {
+		NumOfCaptured   int64  `json:"numOfCaptured"`
+		NumOfSampledOut int64  `json:"numOfSampledOut"`
+		NumOfDropped    int64  `json:"numOfDropped"`
+		CurrentFile     string `json:"currentFile,omitempty"`
+		NumOfErrors     int64  `json:"numOfErrors"`
+		LastError       string `json:"lastError,omitempty"`
+	}
+)
+
+var (
+	// capturesLock serializes the updates of captures.
+	capturesLock sync.Mutex
+	// captures holds the running TrafficCaptures, it is an atomic value
+	// because it is read by every request.
+	captures atomic.Value
+)
+
+func init() {
+	captures.Store([]*TrafficCapture{})
+}
+
+func register(tc *TrafficCapture) {
+	capturesLock.Lock()
+	defer capturesLock.Unlock()
+
+	old := captures.Load().([]*TrafficCapture)
+	list := make([]*TrafficCapture, 0, len(old)+1)
+	list = append(list, old...)
+	captures.Store(append(list, tc))
+}
+
+func unregister(tc *TrafficCapture) {
+	capturesLock.Lock()
+	defer capturesLock.Unlock()
+
+	old := captures.Load().([]*TrafficCapture)
+	list := make([]*TrafficCapture, 0, len(old))
+	for _, c := range old {
+		if c != tc {
+			list = append(list, c)
+		}
+	}
+	captures.Store(list)
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if spec.Filter != nil {
+		if err := spec.Filter.Validate(); err != nil {
+			return fmt.Errorf("invalid filter: %v", err)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of TrafficCapture.
+func (tc *TrafficCapture) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TrafficCapture.
+func (tc *TrafficCapture) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TrafficCapture.
+func (tc *TrafficCapture) DefaultSpec() interface{} {
+	return &Spec{
+		SampleRate:  1,
+		Format:      formatHAR,
+		MaxFileSize: 100,
+		MaxFiles:    10,
+		MaxBodySize: 64 * 1024,
+		BufferSize:  1024,
+	}
+}
+
+// Init initializes TrafficCapture.
+func (tc *TrafficCapture) Init(superSpec *supervisor.Spec) {
+	tc.superSpec, tc.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	tc.reload()
+}
+
+// Inherit inherits previous generation of TrafficCapture. The previous
+// generation is closed first, so that the files are not shared by the two
+// generations.
+func (tc *TrafficCapture) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	tc.Init(superSpec)
+}
+
+func (tc *TrafficCapture) reload() {
+	tc.filter = newFilter(tc.spec.Filter)
+
+	var enc encoder
+	if tc.spec.Format == formatPCAP {
+		enc = newPCAPEncoder()
+	} else {
+		enc = newHAREncoder()
+	}
+	tc.writer = newRotatingWriter(tc.spec.Directory, tc.superSpec.Name(),
+		int64(tc.spec.MaxFileSize)*1024*1024, tc.spec.MaxFiles, enc)
+
+	tc.records = make(chan *Record, tc.spec.BufferSize)
+	tc.done = make(chan struct{})
+	tc.wg.Add(1)
+	go tc.run()
+
+	register(tc)
+}
+
+// capture returns whether the request of the HTTPServer should be
+// captured.
+func (tc *TrafficCapture) capture(server string, r *Record) bool {
+	if len(tc.spec.HTTPServers) > 0 && !stringtool.StrInSlice(server, tc.spec.HTTPServers) {
+		return false
+	}
+	if !tc.filter.match(r) {
+		return false
+	}
+	if tc.spec.SampleRate < 1 && rand.Float64() >= tc.spec.SampleRate {
+		atomic.AddInt64(&tc.numOfSampledOut, 1)
+		return false
+	}
+	return true
+}
+
+// add queues a record, it never blocks.
+func (tc *TrafficCapture) add(r *Record) {
+	select {
+	case tc.records <- r:
+	default:
+		atomic.AddInt64(&tc.numOfDropped, 1)
+	}
+}
+
+func (tc *TrafficCapture) run() {
+	defer tc.wg.Done()
+
+	for {
+		select {
+		case r := <-tc.records:
+			tc.write(r)
+
+		case <-tc.done:
+			// write the queued records before exiting.
+			for {
+				select {
+				case r := <-tc.records:
+					tc.write(r)
+				default:
+					tc.writer.close()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (tc *TrafficCapture) write(r *Record) {
+	// the record is shared by the TrafficCaptures, so truncate a copy.
+	c := *r
+	c.truncateBodies(tc.spec.MaxBodySize)
+	if err := tc.writer.write(&c); err != nil {
+		logger.Errorf("%s: write capture failed: %v", tc.superSpec.Name(), err)
+		return
+	}
+	atomic.AddInt64(&tc.numOfCaptured, 1)
+}
+
+// Status returns the status of TrafficCapture.
+func (tc *TrafficCapture) Status() *supervisor.Status {
+	s := &Status{
+		NumOfCaptured:   atomic.LoadInt64(&tc.numOfCaptured),
+		NumOfSampledOut: atomic.LoadInt64(&tc.numOfSampledOut),
+		NumOfDropped:    atomic.LoadInt64(&tc.numOfDropped),
+	}
+	s.CurrentFile, s.NumOfErrors, s.LastError = tc.writer.status()
+	return &supervisor.Status{ObjectStatus: s}
+}
+
+// Close closes TrafficCapture, the queued records are written before it
+// returns.
+func (tc *TrafficCapture) Close() {
+	unregister(tc)
+	close(tc.done)
+	tc.wg.Wait()
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newTestTrafficCapture(t *testing.T, yaml string) *TrafficCapture {
+	superSpec, err := supervisor.NewSpec(yaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &TrafficCapture{}
+	tc.Init(superSpec)
+	return tc
+}
+
+func newTestRequest(method, url string, body string) *http.Request {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("X-Debug", "true")
+	req.Header.Set("Cookie", "session=abc")
+	return req
+}
+
+func capture(server string, req *http.Request, body string) {
+	s := Start(server, req)
+	if s == nil {
+		return
+	}
+	s.SetRequestBody([]byte(body))
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain")
+	s.Finish(http.StatusOK, header, []byte("hello"), 15*time.Millisecond)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Filter: &FilterSpec{Hosts: []*urlrule.StringMatch{{}}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Filter: &FilterSpec{Path: &urlrule.StringMatch{Empty: true, Exact: "/"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Filter: &FilterSpec{Headers: map[string]*urlrule.StringMatch{"X-Debug": {}}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Filter: &FilterSpec{Path: &urlrule.StringMatch{Prefix: "/api"}}}
+	assert.NoError(spec.Validate())
+}
+
+func TestFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFilter(nil)
+	assert.True(f.match(&Record{}))
+
+	f = newFilter(&FilterSpec{
+		Hosts:   []*urlrule.StringMatch{{Exact: "example.com"}, {RegEx: `^.*\.example\.org$`}},
+		Path:    &urlrule.StringMatch{Prefix: "/api/"},
+		Methods: []string{http.MethodGet, http.MethodPost},
+		Headers: map[string]*urlrule.StringMatch{"X-Debug": {Exact: "true"}},
+	})
+
+	r := &Record{
+		Method:        http.MethodGet,
+		Host:          "example.com:8080",
+		Path:          "/api/users",
+		RequestHeader: http.Header{"X-Debug": []string{"true"}},
+	}
+	assert.True(f.match(r))
+
+	r.Host = "www.example.org"
+	assert.True(f.match(r))
+
+	r.Host = "example.net"
+	assert.False(f.match(r))
+
+	r.Host = "example.com"
+	r.Method = http.MethodDelete
+	assert.False(f.match(r))
+
+	r.Method = http.MethodPost
+	r.Path = "/users"
+	assert.False(f.match(r))
+
+	r.Path = "/api/users"
+	r.RequestHeader.Set("X-Debug", "false")
+	assert.False(f.match(r))
+}
+
+func readHAR(t *testing.T, filename string) map[string]interface{} {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	har := map[string]interface{}{}
+	if err = json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("invalid HAR file: %v\n%s", err, data)
+	}
+	return har["log"].(map[string]interface{})
+}
+
+func TestTrafficCaptureHAR(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(Start("server", newTestRequest(http.MethodGet, "http://example.com/api/users", "")))
+
+	dir := t.TempDir()
+	tc := newTestTrafficCapture(t, fmt.Sprintf(`
+kind: TrafficCapture
+name: capture
+directory: %s
+httpServers: [server]
+maxBodySize: 4
+filter:
+  path:
+    prefix: /api/
+`, dir))
+
+	capture("server", newTestRequest(http.MethodPost, "http://example.com/api/users?id=1", "name=foo"), "name=foo")
+	capture("server", newTestRequest(http.MethodGet, "http://example.com/other", ""), "")
+	capture("other", newTestRequest(http.MethodGet, "http://example.com/api/users", ""), "")
+	tc.Close()
+
+	assert.Nil(Start("server", newTestRequest(http.MethodGet, "http://example.com/api/users", "")))
+
+	status := tc.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(1), status.NumOfCaptured)
+	assert.Zero(status.NumOfErrors)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "capture-*.har"))
+	assert.Len(files, 1)
+
+	log := readHAR(t, files[0])
+	assert.Equal("1.2", log["version"])
+	entries := log["entries"].([]interface{})
+	assert.Len(entries, 1)
+
+	entry := entries[0].(map[string]interface{})
+	assert.Equal(15.0, entry["time"])
+	req := entry["request"].(map[string]interface{})
+	assert.Equal(http.MethodPost, req["method"])
+	assert.Equal("http://example.com/api/users?id=1", req["url"])
+	assert.Equal(8.0, req["bodySize"])
+	postData := req["postData"].(map[string]interface{})
+	assert.Equal("name", postData["text"])
+	assert.Equal("truncated to 4 bytes", postData["comment"])
+	assert.Len(req["cookies"], 1)
+	assert.Len(req["queryString"], 1)
+
+	resp := entry["response"].(map[string]interface{})
+	assert.Equal(200.0, resp["status"])
+	content := resp["content"].(map[string]interface{})
+	assert.Equal("text/plain", content["mimeType"])
+	assert.Equal("hell", content["text"])
+}
+
+func TestTrafficCaptureSampleAndRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	tc := newTestTrafficCapture(t, fmt.Sprintf(`
+kind: TrafficCapture
+name: capture
+directory: %s
+sampleRate: 0
+`, dir))
+	capture("server", newTestRequest(http.MethodGet, "http://example.com/", ""), "")
+	tc.Close()
+	status := tc.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(1), status.NumOfSampledOut)
+	assert.Zero(status.NumOfCaptured)
+
+	// every record exceeds the size limit, so every record is written to
+	// its own file.
+	dir = t.TempDir()
+	tc = newTestTrafficCapture(t, fmt.Sprintf(`
+kind: TrafficCapture
+name: capture
+directory: %s
+maxFiles: 2
+`, dir))
+	tc.writer.maxSize = 1
+	for i := 0; i < 3; i++ {
+		r := &Record{Method: http.MethodGet, Host: "example.com", URI: "/", Scheme: "http", StatusCode: 200}
+		assert.NoError(tc.writer.write(r))
+		// the file names contain the time in milliseconds.
+		time.Sleep(2 * time.Millisecond)
+	}
+	tc.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "capture-*.har"))
+	assert.Len(files, 2)
+	for _, f := range files {
+		assert.Len(readHAR(t, f)["entries"], 1)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficcapture
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+type (
+	// encoder encodes the records of a file, begin and end are called
+	// when a file is created and closed respectively.
+	encoder interface {
+		ext() string
+		begin(w io.Writer) error
+		encode(w io.Writer, r *Record) error
+		end(w io.Writer) error
+	}
+
+	// rotatingWriter writes the records to the files in a directory, a
+	// file is closed when its size reaches the limit, and a new file is
+	// created for the next record. The oldest files are removed if there
+	// are too many.
+	rotatingWriter struct {
+		dir      string
+		prefix   string
+		maxSize  int64
+		maxFiles int
+		enc      encoder
+
+		file *os.File
+		w    *bufio.Writer
+		cw   *countWriter
+
+		// lock protects the fields below, which are read by status.
+		lock        sync.Mutex
+		filename    string
+		numOfErrors int64
+		lastError   string
+	}
+
+	countWriter struct {
+		w io.Writer
+		n int64
+	}
+)
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func newRotatingWriter(dir, prefix string, maxSize int64, maxFiles int, enc encoder) *rotatingWriter {
+	return &rotatingWriter{
+		dir:      dir,
+		prefix:   prefix,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		enc:      enc,
+	}
+}
+
+func (rw *rotatingWriter) setError(err error) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	rw.numOfErrors++
+	rw.lastError = err.Error()
+}
+
+func (rw *rotatingWriter) open() error {
+	if err := os.MkdirAll(rw.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := rw.prefix + "-" + time.Now().Format("20060102-150405.000") + rw.enc.ext()
+	filename := filepath.Join(rw.dir, name)
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	rw.file = f
+	rw.w = bufio.NewWriterSize(f, 64<<10)
+	rw.cw = &countWriter{w: rw.w}
+	if err = rw.enc.begin(rw.cw); err != nil {
+		rw.closeFile()
+		return err
+	}
+
+	rw.lock.Lock()
+	rw.filename = filename
+	rw.lock.Unlock()
+
+	rw.removeOldFiles()
+	return nil
+}
+
+// removeOldFiles removes the oldest files if there are more than maxFiles
+// files, the current file included.
+func (rw *rotatingWriter) removeOldFiles() {
+	if rw.maxFiles <= 0 {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(rw.dir, rw.prefix+"-*"+rw.enc.ext()))
+	if err != nil || len(files) <= rw.maxFiles {
+		return
+	}
+
+	// the names contain the creation time, so they are sorted by time.
+	sort.Strings(files)
+	for _, f := range files[:len(files)-rw.maxFiles] {
+		if err := os.Remove(f); err != nil {
+			logger.Errorf("remove capture file %s failed: %v", f, err)
+		}
+	}
+}
+
+func (rw *rotatingWriter) closeFile() {
+	if err := rw.enc.end(rw.cw); err != nil {
+		rw.setError(err)
+	}
+	if err := rw.w.Flush(); err != nil {
+		rw.setError(err)
+	}
+	rw.file.Close()
+	rw.file, rw.w, rw.cw = nil, nil, nil
+
+	rw.lock.Lock()
+	rw.filename = ""
+	rw.lock.Unlock()
+}
+
+// write writes a record, it is only called by the writer goroutine.
+func (rw *rotatingWriter) write(r *Record) error {
+	err := rw.doWrite(r)
+	if err != nil {
+		rw.setError(err)
+	}
+	return err
+}
+
+func (rw *rotatingWriter) doWrite(r *Record) error {
+	if rw.file == nil {
+		if err := rw.open(); err != nil {
+			return err
+		}
+	}
+
+	if err := rw.enc.encode(rw.cw, r); err != nil {
+		return err
+	}
+
+	if rw.maxSize > 0 && rw.cw.n >= rw.maxSize {
+		rw.closeFile()
+		return nil
+	}
+
+	// flush every record, as the records are for debugging, they should
+	// be visible as soon as possible.
+	return rw.w.Flush()
+}
+
+func (rw *rotatingWriter) close() {
+	if rw.file != nil {
+		rw.closeFile()
+	}
+}
+
+func (rw *rotatingWriter) status() (filename string, numOfErrors int64, lastError string) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	return rw.filename, rw.numOfErrors, rw.lastError
+}
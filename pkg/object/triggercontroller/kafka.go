@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package triggercontroller
+
+import (
+	stdcontext "context"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	headerKafkaTopic     = "X-Kafka-Topic"
+	headerKafkaKey       = "X-Kafka-Key"
+	headerKafkaPartition = "X-Kafka-Partition"
+	headerKafkaOffset    = "X-Kafka-Offset"
+)
+
+type (
+	// KafkaSpec describes the Kafka messages which fire the trigger.
+	KafkaSpec struct {
+		Backend []string `json:"backend" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `json:"topic" jsonschema:"required"`
+		// Group is the consumer group, it defaults to the name of the
+		// trigger, so that each message fires the trigger only once in
+		// the cluster.
+		Group string `json:"group,omitempty" jsonschema:"omitempty"`
+		// InitialOffset is where to start if the group has no committed
+		// offset.
+		InitialOffset string `json:"initialOffset,omitempty" jsonschema:"omitempty,enum=,enum=newest,enum=oldest"`
+	}
+
+	// kafkaHandler is the handler of the consumer group.
+	kafkaHandler struct {
+		t *trigger
+	}
+)
+
+func (t *trigger) runKafka(done chan struct{}) {
+	spec := t.spec.Kafka
+	config := sarama.NewConfig()
+	config.ClientID = t.name()
+	config.Version = sarama.V1_0_0_0
+	if spec.InitialOffset == "oldest" {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+	group := spec.Group
+	if group == "" {
+		group = t.name()
+	}
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	defer cancel()
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	var (
+		cg  sarama.ConsumerGroup
+		err error
+	)
+	for {
+		cg, err = sarama.NewConsumerGroup(spec.Backend, group, config)
+		if err == nil {
+			break
+		}
+		logger.Errorf("%s: create kafka consumer group failed: %v", t.name(), err)
+		select {
+		case <-time.After(retryInterval):
+		case <-done:
+			return
+		}
+	}
+	defer cg.Close()
+
+	// Consume returns when the group rebalances, so call it in a loop.
+	for {
+		err = cg.Consume(ctx, []string{spec.Topic}, &kafkaHandler{t: t})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Errorf("%s: consume kafka topic %s failed: %v", t.name(), spec.Topic, err)
+			select {
+			case <-time.After(retryInterval):
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (h *kafkaHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (h *kafkaHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim fires the trigger on the messages one by one, and marks
+// them consumed no matter whether the pipeline succeeds.
+func (h *kafkaHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		h.t.fire(kafkaEvent(msg))
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+func kafkaEvent(msg *sarama.ConsumerMessage) *event {
+	header := map[string]string{
+		headerKafkaTopic:     msg.Topic,
+		headerKafkaPartition: strconv.Itoa(int(msg.Partition)),
+		headerKafkaOffset:    strconv.FormatInt(msg.Offset, 10),
+	}
+	if len(msg.Key) > 0 {
+		header[headerKafkaKey] = string(msg.Key)
+	}
+	return &event{header: header, body: msg.Value}
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package triggercontroller
+
+import (
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const headerMQTTTopic = "X-MQTT-Topic"
+
+// MQTTSpec describes the MQTT messages which fire the trigger.
+type MQTTSpec struct {
+	// URL is the URL of the broker, e.g. tcp://127.0.0.1:1883.
+	URL   string `json:"url" jsonschema:"required"`
+	Topic string `json:"topic" jsonschema:"required"`
+	// ClientID defaults to the name of the trigger.
+	ClientID string `json:"clientID,omitempty" jsonschema:"omitempty"`
+	Username string `json:"username,omitempty" jsonschema:"omitempty"`
+	Password string `json:"password,omitempty" jsonschema:"omitempty"`
+	QoS      int    `json:"qos,omitempty" jsonschema:"omitempty,minimum=0,maximum=2"`
+}
+
+func (t *trigger) runMQTT(done chan struct{}) {
+	spec := t.spec.MQTT
+	clientID := spec.ClientID
+	if clientID == "" {
+		clientID = t.name()
+	}
+
+	onMessage := func(_ paho.Client, msg paho.Message) {
+		if !t.shouldFire() {
+			return
+		}
+		t.fire(&event{
+			header: map[string]string{headerMQTTTopic: msg.Topic()},
+			body:   msg.Payload(),
+		})
+	}
+
+	opts := paho.NewClientOptions().AddBroker(spec.URL).SetClientID(clientID).
+		SetUsername(spec.Username).SetPassword(spec.Password).
+		SetAutoReconnect(true).SetConnectRetry(true).
+		SetConnectRetryInterval(retryInterval)
+	// subscribe on every connection, as the subscription is lost if
+	// the session is not kept by the broker.
+	opts.SetOnConnectHandler(func(c paho.Client) {
+		token := c.Subscribe(spec.Topic, byte(spec.QoS), onMessage)
+		if token.WaitTimeout(t.timeout) && token.Error() != nil {
+			logger.Errorf("%s: subscribe mqtt topic %s failed: %v", t.name(), spec.Topic, token.Error())
+		}
+	})
+
+	client := paho.NewClient(opts)
+	// the client retries in background if the broker is unavailable.
+	client.Connect()
+	<-done
+	client.Disconnect(uint(time.Second / time.Millisecond))
+}
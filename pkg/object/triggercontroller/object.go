@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package triggercontroller
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+type (
+	// ObjectSpec describes the object changes which fire the trigger, the
+	// empty fields match everything.
+	ObjectSpec struct {
+		Kinds   []string `json:"kinds,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Names   []string `json:"names,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		Actions []string `json:"actions,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// ObjectEvent is the body of the requests fired by object changes.
+	ObjectEvent struct {
+		Action string                 `json:"action"`
+		Kind   string                 `json:"kind"`
+		Name   string                 `json:"name"`
+		Spec   map[string]interface{} `json:"spec,omitempty"`
+	}
+)
+
+// Validate validates ObjectSpec.
+func (spec *ObjectSpec) Validate() error {
+	for _, a := range spec.Actions {
+		switch a {
+		case actionCreate, actionUpdate, actionDelete:
+		default:
+			return fmt.Errorf("unknown action %s", a)
+		}
+	}
+	return nil
+}
+
+func (spec *ObjectSpec) match(entity *supervisor.ObjectEntity) bool {
+	if len(spec.Kinds) > 0 && !stringtool.StrInSlice(entity.Spec().Kind(), spec.Kinds) {
+		return false
+	}
+	if len(spec.Names) > 0 && !stringtool.StrInSlice(entity.Spec().Name(), spec.Names) {
+		return false
+	}
+	return true
+}
+
+func (spec *ObjectSpec) matchAction(action string) bool {
+	return len(spec.Actions) == 0 || stringtool.StrInSlice(action, spec.Actions)
+}
+
+// objectEvents returns the events of the object changes to fire the
+// trigger, the specs of the deleted objects are not included.
+func (spec *ObjectSpec) objectEvents(we *supervisor.ObjectEntityWatcherEvent) []*event {
+	var events []*event
+	add := func(action string, entities map[string]*supervisor.ObjectEntity) {
+		if !spec.matchAction(action) {
+			return
+		}
+		for _, entity := range entities {
+			oe := &ObjectEvent{
+				Action: action,
+				Kind:   entity.Spec().Kind(),
+				Name:   entity.Spec().Name(),
+			}
+			if action != actionDelete {
+				oe.Spec = entity.Spec().RawSpec()
+			}
+			body, err := codectool.MarshalJSON(oe)
+			if err != nil {
+				logger.Errorf("BUG: marshal %#v to json failed: %v", oe, err)
+				continue
+			}
+			events = append(events, &event{
+				header: map[string]string{"Content-Type": "application/json"},
+				body:   body,
+			})
+		}
+	}
+
+	add(actionDelete, we.Delete)
+	add(actionCreate, we.Create)
+	add(actionUpdate, we.Update)
+	return events
+}
+
+func (t *trigger) runObject(done chan struct{}) {
+	spec := t.spec.Object
+	registry := t.tc.superSpec.Super().ObjectRegistry()
+	watcher := registry.NewWatcher(t.name(), spec.match)
+	if watcher == nil {
+		return
+	}
+	defer registry.CloseWatcher(t.name())
+
+	queue := make(chan *event, eventQueueSize)
+	go t.runQueue(queue, done)
+
+	// the first event is the existing objects.
+	select {
+	case <-done:
+		return
+	case <-watcher.Watch():
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case we := <-watcher.Watch():
+			if !t.shouldFire() {
+				continue
+			}
+			for _, e := range spec.objectEvents(we) {
+				t.enqueue(queue, e)
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package triggercontroller
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+)
+
+const (
+	// the headers of the synthesized requests.
+	headerTrigger       = "X-EG-Trigger"
+	headerTriggerSource = "X-EG-Trigger-Source"
+	headerTriggerTime   = "X-EG-Trigger-Time"
+
+	// requestHost is the host of the synthesized requests.
+	requestHost = "trigger.easegress"
+
+	defaultTimeout = 30 * time.Second
+	// eventQueueSize is the max number of the events waiting for the
+	// pipeline, the events are dropped once it is exceeded.
+	eventQueueSize = 100
+	retryInterval  = 10 * time.Second
+)
+
+type (
+	// trigger invokes the pipeline on the events of its source.
+	trigger struct {
+		tc       *TriggerController
+		spec     *TriggerSpec
+		source   string
+		timeout  time.Duration
+		schedule cron.Schedule
+
+		fired   uint64
+		failed  uint64
+		dropped uint64
+
+		mutex          sync.Mutex
+		lastFireTime   time.Time
+		lastStatusCode int
+		lastError      string
+		nextFireTime   time.Time
+	}
+
+	// event is an event which fires the trigger.
+	event struct {
+		header map[string]string
+		body   []byte
+	}
+)
+
+func newTrigger(tc *TriggerController, spec *TriggerSpec) *trigger {
+	t := &trigger{
+		tc:      tc,
+		spec:    spec,
+		source:  spec.source(),
+		timeout: defaultTimeout,
+	}
+	if spec.Timeout != "" {
+		t.timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+	if spec.Cron != "" {
+		t.schedule, _ = cron.ParseStandard(spec.Cron)
+	}
+	return t
+}
+
+func (t *trigger) name() string {
+	return t.tc.superSpec.Name() + "/" + t.spec.Name
+}
+
+// run runs the trigger until done is closed.
+func (t *trigger) run(done chan struct{}) {
+	switch t.source {
+	case SourceObject:
+		t.runObject(done)
+	case SourceKafka:
+		t.runKafka(done)
+	case SourceMQTT:
+		t.runMQTT(done)
+	default:
+		t.runCron(done)
+	}
+}
+
+// shouldFire returns whether the trigger should be fired on this member.
+func (t *trigger) shouldFire() bool {
+	return t.spec.AllMembers || t.tc.isLeader()
+}
+
+func (t *trigger) runCron(done chan struct{}) {
+	for {
+		next := t.schedule.Next(time.Now())
+		t.mutex.Lock()
+		t.nextFireTime = next
+		t.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-done:
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			if t.shouldFire() {
+				t.fire(&event{header: map[string]string{
+					headerTriggerTime: now.UTC().Format(time.RFC3339),
+				}})
+			}
+		}
+	}
+}
+
+// runQueue fires the trigger on the events of the queue, so that the
+// event sources which can't be blocked are decoupled from the pipeline.
+func (t *trigger) runQueue(queue chan *event, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case e := <-queue:
+			t.fire(e)
+		}
+	}
+}
+
+func (t *trigger) enqueue(queue chan *event, e *event) {
+	select {
+	case queue <- e:
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+		logger.Warnf("%s: event dropped, the pipeline can't keep up", t.name())
+	}
+}
+
+// newRequest synthesizes the request of the event.
+func (t *trigger) newRequest(ctx stdcontext.Context, e *event) (*httpprot.Request, error) {
+	method, path, body := http.MethodPost, "/", e.body
+	if t.source == SourceCron {
+		method = http.MethodGet
+	}
+
+	rs := t.spec.Request
+	if rs != nil {
+		if rs.Method != "" {
+			method = rs.Method
+		}
+		if rs.Path != "" {
+			path = rs.Path
+		}
+		if t.source == SourceCron && rs.Body != "" {
+			body = []byte(rs.Body)
+		}
+	}
+
+	stdr, err := http.NewRequestWithContext(ctx, method, "http://"+requestHost+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	stdr.RemoteAddr = "127.0.0.1:0"
+	if rs != nil {
+		for k, v := range rs.Header {
+			stdr.Header.Set(k, v)
+		}
+	}
+	for k, v := range e.header {
+		stdr.Header.Set(k, v)
+	}
+	stdr.Header.Set(headerTrigger, t.spec.Name)
+	stdr.Header.Set(headerTriggerSource, t.source)
+
+	req, _ := httpprot.NewRequest(stdr)
+	if err = req.FetchPayload(0); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// fire invokes the pipeline with the request of the event.
+func (t *trigger) fire(e *event) {
+	atomic.AddUint64(&t.fired, 1)
+	statusCode, err := t.invoke(e)
+	if err == nil && statusCode >= 400 {
+		err = fmt.Errorf("pipeline %s responded status code %d", t.spec.Pipeline, statusCode)
+	}
+	if err != nil {
+		atomic.AddUint64(&t.failed, 1)
+		logger.Errorf("%s: %v", t.name(), err)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.lastFireTime = time.Now()
+	t.lastStatusCode = statusCode
+	t.lastError = ""
+	if err != nil {
+		t.lastError = err.Error()
+	}
+}
+
+func (t *trigger) invoke(e *event) (int, error) {
+	handler, ok := t.tc.getHandler(t.spec.Pipeline)
+	if !ok {
+		return 0, fmt.Errorf("pipeline %s not found", t.spec.Pipeline)
+	}
+
+	stdctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), t.timeout)
+	defer cancel()
+	req, err := t.newRequest(stdctx, e)
+	if err != nil {
+		return 0, fmt.Errorf("synthesize request failed: %v", err)
+	}
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	defer ctx.Finish()
+	handler.Handle(ctx)
+
+	// a pipeline may have no response, e.g. it only sends messages.
+	resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if !ok {
+		return 0, nil
+	}
+	if resp.IsStream() {
+		resp.Close()
+	}
+	return resp.StatusCode(), nil
+}
+
+func (t *trigger) status() *TriggerStatus {
+	s := &TriggerStatus{
+		Name:    t.spec.Name,
+		Source:  t.source,
+		Fired:   atomic.LoadUint64(&t.fired),
+		Failed:  atomic.LoadUint64(&t.failed),
+		Dropped: atomic.LoadUint64(&t.dropped),
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.lastFireTime.IsZero() {
+		s.LastFireTime = t.lastFireTime.Format(time.RFC3339)
+	}
+	s.LastStatusCode = t.lastStatusCode
+	s.LastError = t.lastError
+	if !t.nextFireTime.IsZero() {
+		s.NextFireTime = t.nextFireTime.Format(time.RFC3339)
+	}
+	return s
+}
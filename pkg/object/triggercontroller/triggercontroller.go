@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package triggercontroller implements a business controller which invokes
+// pipelines on cron schedules or on events.
+package triggercontroller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of TriggerController.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of TriggerController.
+	Kind = "TriggerController"
+
+	// SourceCron fires the trigger on a cron schedule.
+	SourceCron = "cron"
+	// SourceObject fires the trigger when the objects change.
+	SourceObject = "object"
+	// SourceKafka fires the trigger on Kafka messages.
+	SourceKafka = "kafka"
+	// SourceMQTT fires the trigger on MQTT messages.
+	SourceMQTT = "mqtt"
+
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+func init() {
+	supervisor.Register(&TriggerController{})
+}
+
+type (
+	// TriggerController is a business controller which invokes pipelines
+	// with synthesized requests, on cron schedules or on events like the
+	// changes of objects and the messages of Kafka or MQTT.
+	TriggerController struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		// getHandler returns the pipeline, and isLeader reports whether
+		// the member is the leader, they are replaced in tests.
+		getHandler func(name string) (context.Handler, bool)
+		isLeader   func() bool
+
+		triggers []*trigger
+		done     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	// Spec describes TriggerController.
+	Spec struct {
+		Triggers []*TriggerSpec `json:"triggers" jsonschema:"required,minItems=1"`
+	}
+
+	// TriggerSpec describes a trigger, exactly one of the sources must be
+	// specified.
+	TriggerSpec struct {
+		Name     string `json:"name" jsonschema:"required"`
+		Pipeline string `json:"pipeline" jsonschema:"required"`
+
+		// Cron is the schedule in the standard cron format, or a
+		// descriptor like @hourly and @every 5m.
+		Cron   string      `json:"cron,omitempty" jsonschema:"omitempty"`
+		Object *ObjectSpec `json:"object,omitempty" jsonschema:"omitempty"`
+		Kafka  *KafkaSpec  `json:"kafka,omitempty" jsonschema:"omitempty"`
+		MQTT   *MQTTSpec   `json:"mqtt,omitempty" jsonschema:"omitempty"`
+
+		Request *RequestSpec `json:"request,omitempty" jsonschema:"omitempty"`
+		Timeout string       `json:"timeout,omitempty" jsonschema:"omitempty,format=duration"`
+		// AllMembers fires the trigger on all members of the cluster,
+		// otherwise, it is only fired on the leader. Kafka triggers are
+		// fired on all members as the messages are shared by the
+		// consumer group.
+		AllMembers bool `json:"allMembers,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RequestSpec describes the request synthesized to invoke the pipeline.
+	RequestSpec struct {
+		// Method defaults to GET for cron triggers, and POST for the others.
+		Method string            `json:"method,omitempty" jsonschema:"omitempty,format=httpmethod"`
+		Path   string            `json:"path,omitempty" jsonschema:"omitempty,pattern=^/"`
+		Header map[string]string `json:"header,omitempty" jsonschema:"omitempty"`
+		// Body is the body of the requests of cron triggers, the body of
+		// the other triggers is the event.
+		Body string `json:"body,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of TriggerController.
+	Status struct {
+		Triggers []*TriggerStatus `json:"triggers"`
+	}
+
+	// TriggerStatus is the status of a trigger.
+	TriggerStatus struct {
+		Name   string `json:"name"`
+		Source string `json:"source"`
+		Fired  uint64 `json:"fired"`
+		Failed uint64 `json:"failed"`
+		// Dropped is the number of events dropped as the pipeline can't
+		// keep up with them.
+		Dropped        uint64 `json:"dropped,omitempty"`
+		LastFireTime   string `json:"lastFireTime,omitempty"`
+		LastStatusCode int    `json:"lastStatusCode,omitempty"`
+		LastError      string `json:"lastError,omitempty"`
+		NextFireTime   string `json:"nextFireTime,omitempty"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	names := map[string]struct{}{}
+	for _, t := range spec.Triggers {
+		if _, ok := names[t.Name]; ok {
+			return fmt.Errorf("duplicated trigger %s", t.Name)
+		}
+		names[t.Name] = struct{}{}
+	}
+	return nil
+}
+
+// Validate validates TriggerSpec.
+func (spec *TriggerSpec) Validate() error {
+	sources := 0
+	if spec.Cron != "" {
+		sources++
+		if _, err := cron.ParseStandard(spec.Cron); err != nil {
+			return fmt.Errorf("trigger %s: invalid cron %s: %v", spec.Name, spec.Cron, err)
+		}
+	}
+	if spec.Object != nil {
+		sources++
+	}
+	if spec.Kafka != nil {
+		sources++
+	}
+	if spec.MQTT != nil {
+		sources++
+	}
+	if sources != 1 {
+		return fmt.Errorf("trigger %s: exactly one of cron, object, kafka and mqtt must be specified", spec.Name)
+	}
+
+	if spec.Timeout != "" {
+		if _, err := time.ParseDuration(spec.Timeout); err != nil {
+			return fmt.Errorf("trigger %s: invalid timeout %s: %v", spec.Name, spec.Timeout, err)
+		}
+	}
+	return nil
+}
+
+func (spec *TriggerSpec) source() string {
+	switch {
+	case spec.Object != nil:
+		return SourceObject
+	case spec.Kafka != nil:
+		return SourceKafka
+	case spec.MQTT != nil:
+		return SourceMQTT
+	default:
+		return SourceCron
+	}
+}
+
+// Category returns the category of TriggerController.
+func (tc *TriggerController) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TriggerController.
+func (tc *TriggerController) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TriggerController.
+func (tc *TriggerController) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes TriggerController.
+func (tc *TriggerController) Init(superSpec *supervisor.Spec) {
+	tc.superSpec, tc.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	tc.getHandler = tc.getPipeline
+	tc.isLeader = func() bool {
+		cls := superSpec.Super().Cluster()
+		return cls == nil || cls.IsLeader()
+	}
+	tc.reload()
+}
+
+// Inherit inherits previous generation of TriggerController.
+func (tc *TriggerController) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	tc.Init(superSpec)
+}
+
+func (tc *TriggerController) reload() {
+	tc.done = make(chan struct{})
+	for _, spec := range tc.spec.Triggers {
+		t := newTrigger(tc, spec)
+		tc.triggers = append(tc.triggers, t)
+		tc.wg.Add(1)
+		go func() {
+			defer tc.wg.Done()
+			t.run(tc.done)
+		}()
+	}
+}
+
+// getPipeline returns the pipeline in the default namespace.
+func (tc *TriggerController) getPipeline(name string) (context.Handler, bool) {
+	entity, ok := tc.superSpec.Super().GetSystemController(trafficcontroller.Kind)
+	if !ok {
+		return nil, false
+	}
+	traffic, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		return nil, false
+	}
+	p, ok := traffic.GetPipeline(rawconfigtrafficcontroller.DefaultNamespace, name)
+	if !ok {
+		return nil, false
+	}
+	handler, ok := p.Instance().(context.Handler)
+	return handler, ok
+}
+
+// Status returns the status of TriggerController.
+func (tc *TriggerController) Status() *supervisor.Status {
+	status := &Status{}
+	for _, t := range tc.triggers {
+		status.Triggers = append(status.Triggers, t.status())
+	}
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes TriggerController.
+func (tc *TriggerController) Close() {
+	close(tc.done)
+	tc.wg.Wait()
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package triggercontroller
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+// recorder is a pipeline which records the requests.
+type recorder struct {
+	mutex    sync.Mutex
+	requests []*httpprot.Request
+	bodies   []string
+	code     int
+}
+
+func (r *recorder) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	body, _ := io.ReadAll(req.GetPayload())
+
+	r.mutex.Lock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, string(body))
+	r.mutex.Unlock()
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(r.code)
+	ctx.SetOutputResponse(resp)
+	return ""
+}
+
+func (r *recorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.requests)
+}
+
+func newTestTriggerController(t *testing.T, yamlConfig string, pipeline *recorder) *TriggerController {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	if err != nil {
+		t.Fatalf("new spec failed: %v", err)
+	}
+	tc := &TriggerController{
+		superSpec: superSpec,
+		spec:      superSpec.ObjectSpec().(*Spec),
+		getHandler: func(name string) (context.Handler, bool) {
+			if name != "pipeline-demo" {
+				return nil, false
+			}
+			return pipeline, true
+		},
+		isLeader: func() bool { return true },
+	}
+	return tc
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, config := range []string{
+		// no source
+		"name: trigger\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p",
+		// two sources
+		"name: trigger\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p\n  cron: '@hourly'\n  object: {}",
+		// invalid cron
+		"name: trigger\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p\n  cron: '* *'",
+		// duplicated names
+		"name: trigger\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p\n  cron: '@hourly'\n- name: t1\n  pipeline: p\n  cron: '@daily'",
+		// unknown action
+		"name: trigger\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p\n  object:\n    actions: [rename]",
+	} {
+		_, err := supervisor.NewSpec(config)
+		assert.Error(err, config)
+	}
+
+	_, err := supervisor.NewSpec("name: trigger\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p\n  cron: '*/5 * * * *'")
+	assert.NoError(err)
+}
+
+func TestCron(t *testing.T) {
+	assert := assert.New(t)
+
+	pipeline := &recorder{code: http.StatusOK}
+	tc := newTestTriggerController(t, `
+name: trigger
+kind: TriggerController
+triggers:
+- name: warm
+  pipeline: pipeline-demo
+  cron: "@every 1s"
+  request:
+    path: /warm
+    header:
+      X-Demo: demo
+    body: hello
+- name: missing
+  pipeline: pipeline-missing
+  cron: "@every 1s"
+`, pipeline)
+	tc.reload()
+
+	assert.Eventually(func() bool { return pipeline.count() > 0 }, 3*time.Second, 50*time.Millisecond)
+	assert.Eventually(func() bool {
+		return tc.Status().ObjectStatus.(*Status).Triggers[1].Failed > 0
+	}, 3*time.Second, 50*time.Millisecond)
+	tc.Close()
+
+	pipeline.mutex.Lock()
+	req := pipeline.requests[0]
+	assert.Equal(http.MethodGet, req.Method())
+	assert.Equal("/warm", req.Path())
+	assert.Equal("demo", req.HTTPHeader().Get("X-Demo"))
+	assert.Equal("warm", req.HTTPHeader().Get(headerTrigger))
+	assert.Equal(SourceCron, req.HTTPHeader().Get(headerTriggerSource))
+	assert.NotEmpty(req.HTTPHeader().Get(headerTriggerTime))
+	assert.Equal("hello", pipeline.bodies[0])
+	pipeline.mutex.Unlock()
+
+	status := tc.Status().ObjectStatus.(*Status)
+	assert.Equal(http.StatusOK, status.Triggers[0].LastStatusCode)
+	assert.Zero(status.Triggers[0].Failed)
+	assert.NotEmpty(status.Triggers[0].NextFireTime)
+	assert.Contains(status.Triggers[1].LastError, "not found")
+}
+
+func TestEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	pipeline := &recorder{code: http.StatusInternalServerError}
+	tc := newTestTriggerController(t, `
+name: trigger
+kind: TriggerController
+triggers:
+- name: changes
+  pipeline: pipeline-demo
+  object:
+    kinds: [TriggerController]
+    actions: [create, delete]
+`, pipeline)
+
+	superSpec, err := supervisor.NewSpec("name: other\nkind: TriggerController\ntriggers:\n- name: t1\n  pipeline: p\n  cron: '@hourly'")
+	assert.NoError(err)
+	entity, err := supervisor.NewDefaultMock().NewObjectEntityFromSpec(superSpec)
+	assert.NoError(err)
+
+	spec := tc.spec.Triggers[0].Object
+	assert.True(spec.match(entity))
+	we := &supervisor.ObjectEntityWatcherEvent{
+		Create: map[string]*supervisor.ObjectEntity{},
+		Update: map[string]*supervisor.ObjectEntity{"other": entity},
+		Delete: map[string]*supervisor.ObjectEntity{"other": entity},
+	}
+	events := spec.objectEvents(we)
+	assert.Len(events, 1)
+	oe := &ObjectEvent{}
+	assert.NoError(codectool.UnmarshalJSON(events[0].body, oe))
+	assert.Equal(ObjectEvent{Action: actionDelete, Kind: Kind, Name: "other"}, *oe)
+
+	tr := newTrigger(tc, tc.spec.Triggers[0])
+	tr.fire(events[0])
+	assert.Equal(1, pipeline.count())
+	req := pipeline.requests[0]
+	assert.Equal(http.MethodPost, req.Method())
+	assert.Equal("/", req.Path())
+	assert.Equal("application/json", req.HTTPHeader().Get("Content-Type"))
+	assert.Equal(SourceObject, req.HTTPHeader().Get(headerTriggerSource))
+
+	status := tr.status()
+	assert.Equal(uint64(1), status.Failed)
+	assert.Equal(http.StatusInternalServerError, status.LastStatusCode)
+
+	// kafka messages
+	tr.fire(kafkaEvent(&sarama.ConsumerMessage{Topic: "orders", Key: []byte("k1"), Offset: 3, Value: []byte(`{"id":1}`)}))
+	assert.Equal(2, pipeline.count())
+	req = pipeline.requests[1]
+	assert.Equal("orders", req.HTTPHeader().Get(headerKafkaTopic))
+	assert.Equal("k1", req.HTTPHeader().Get(headerKafkaKey))
+	assert.Equal("3", req.HTTPHeader().Get(headerKafkaOffset))
+	assert.Equal(`{"id":1}`, pipeline.bodies[1])
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"github.com/megaease/easegress/pkg/util/loadbalance"
+)
+
+// pool chooses a backend server for the sessions.
+type pool struct {
+	policy   string
+	servers  []*ServerSpec
+	weighted *loadbalance.Weighted
+}
+
+func newPool(spec *Spec) *pool {
+	p := &pool{policy: spec.LoadBalance, servers: spec.Servers}
+	if p.policy == "" {
+		p.policy = loadbalance.PolicyRoundRobin
+	}
+	weights := make([]int, len(spec.Servers))
+	for i, s := range spec.Servers {
+		weights[i] = s.Weight
+	}
+	p.weighted = loadbalance.NewWeighted(weights)
+	return p
+}
+
+// choose returns the address of the server for the session of the client.
+func (p *pool) choose(clientIP string) string {
+	switch p.policy {
+	case loadbalance.PolicyRandom:
+		return p.servers[p.weighted.Random()].Address
+	case loadbalance.PolicyIPHash:
+		return p.servers[p.weighted.Hash(clientIP)].Address
+	default:
+		return p.servers[p.weighted.RoundRobin()].Address
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+// maxDatagramSize is the max size of UDP datagrams.
+const maxDatagramSize = 65535
+
+type (
+	// runtime receives the datagrams and forwards them to the backend
+	// servers by sessions, it is inherited by the next generation so that
+	// the listener and the existing sessions are kept on reloading.
+	runtime struct {
+		name   string
+		config atomic.Value // *config
+
+		lock     sync.Mutex
+		port     uint16
+		conn     *net.UDPConn
+		sessions map[string]*session
+		err      string
+		closed   bool
+		wg       sync.WaitGroup
+
+		totalSessions    uint64
+		rejectedSessions uint64
+	}
+
+	// config is built from the spec of a generation.
+	config struct {
+		spec        *Spec
+		pool        *pool
+		idleTimeout time.Duration
+	}
+
+	// session is a pseudo session identified by the address of a client,
+	// datagrams from the client go to the same backend server until the
+	// session is idle for the idle timeout.
+	session struct {
+		key         string
+		clientAddr  *net.UDPAddr
+		listener    *net.UDPConn
+		upstream    net.Conn
+		idleTimeout time.Duration
+		lastActive  int64
+	}
+
+	// Status is the status of UDPServer.
+	Status struct {
+		Port             uint16 `json:"port"`
+		Error            string `json:"error,omitempty"`
+		ActiveSessions   int    `json:"activeSessions"`
+		TotalSessions    uint64 `json:"totalSessions"`
+		RejectedSessions uint64 `json:"rejectedSessions"`
+	}
+)
+
+func newRuntime(name string) *runtime {
+	return &runtime{
+		name:     name,
+		sessions: map[string]*session{},
+	}
+}
+
+// reload applies the spec, the listener is recreated if the port changes,
+// and the existing sessions are closed in this case.
+func (r *runtime) reload(spec *Spec) {
+	cfg := &config{spec: spec, pool: newPool(spec)}
+	cfg.idleTimeout, _ = spec.sessionIdleTimeout()
+	r.config.Store(cfg)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.conn != nil && r.port == spec.Port {
+		return
+	}
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+		r.closeSessions()
+	}
+
+	r.port = spec.Port
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: int(spec.Port)})
+	if err != nil {
+		r.err = err.Error()
+		logger.Errorf("%s: failed to listen on port %d: %v", r.name, spec.Port, err)
+		return
+	}
+
+	r.err = ""
+	r.conn = conn
+	r.wg.Add(1)
+	go r.serve(conn)
+}
+
+// closeSessions closes all the sessions, the caller must hold the lock.
+func (r *runtime) closeSessions() {
+	for key, s := range r.sessions {
+		s.upstream.Close()
+		delete(r.sessions, key)
+	}
+}
+
+func (r *runtime) serve(conn *net.UDPConn) {
+	defer r.wg.Done()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.Errorf("%s: failed to read datagram: %v", r.name, err)
+			}
+			return
+		}
+
+		s := r.getSession(conn, addr)
+		if s == nil {
+			continue
+		}
+		s.touch()
+		if _, err := s.upstream.Write(buf[:n]); err != nil {
+			logger.Debugf("%s: failed to forward datagram from %s: %v", r.name, addr, err)
+		}
+	}
+}
+
+// getSession returns the session of the client, a new session is created
+// if it doesn't exist, it returns nil if failed to create the session.
+func (r *runtime) getSession(conn *net.UDPConn, addr *net.UDPAddr) *session {
+	key := addr.String()
+
+	r.lock.Lock()
+	if s := r.sessions[key]; s != nil || r.closed {
+		r.lock.Unlock()
+		return s
+	}
+	cfg := r.config.Load().(*config)
+	if r.tooManySessions(cfg, addr) {
+		r.lock.Unlock()
+		return nil
+	}
+	r.lock.Unlock()
+
+	// dial without holding the lock, so that a slow dial, e.g. resolving
+	// the host name of the server, doesn't block the other sessions.
+	server := cfg.pool.choose(addr.IP.String())
+	upstream, err := net.Dial("udp", server)
+	if err != nil {
+		logger.Warnf("%s: failed to connect to %s: %v", r.name, server, err)
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// the runtime may be closed, or the session may be created by others
+	// during dialing.
+	if s := r.sessions[key]; s != nil || r.closed {
+		upstream.Close()
+		return s
+	}
+	if r.tooManySessions(cfg, addr) {
+		upstream.Close()
+		return nil
+	}
+
+	s := &session{
+		key:         key,
+		clientAddr:  addr,
+		listener:    conn,
+		upstream:    upstream,
+		idleTimeout: cfg.idleTimeout,
+	}
+	s.touch()
+	r.sessions[key] = s
+	atomic.AddUint64(&r.totalSessions, 1)
+
+	r.wg.Add(1)
+	go r.serveSession(s)
+	return s
+}
+
+// tooManySessions returns whether the sessions reach the max sessions, the
+// caller must hold the lock.
+func (r *runtime) tooManySessions(cfg *config, addr *net.UDPAddr) bool {
+	if max := int(cfg.spec.MaxSessions); max > 0 && len(r.sessions) >= max {
+		atomic.AddUint64(&r.rejectedSessions, 1)
+		logger.Debugf("%s: too many sessions, drop datagram from %s", r.name, addr)
+		return true
+	}
+	return false
+}
+
+// serveSession forwards the datagrams from the backend server to the
+// client, until the session is idle or closed.
+func (r *runtime) serveSession(s *session) {
+	defer r.wg.Done()
+	defer r.removeSession(s)
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		s.upstream.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		n, err := s.upstream.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && !s.idle() {
+				continue
+			}
+			return
+		}
+
+		s.touch()
+		if _, err := s.listener.WriteToUDP(buf[:n], s.clientAddr); err != nil {
+			logger.Debugf("%s: failed to send datagram to %s: %v", r.name, s.clientAddr, err)
+		}
+	}
+}
+
+func (r *runtime) removeSession(s *session) {
+	s.upstream.Close()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.sessions[s.key] == s {
+		delete(r.sessions, s.key)
+	}
+}
+
+func (s *session) touch() {
+	atomic.StoreInt64(&s.lastActive, fasttime.NowUnixNano())
+}
+
+func (s *session) idle() bool {
+	last := atomic.LoadInt64(&s.lastActive)
+	return time.Duration(fasttime.NowUnixNano()-last) >= s.idleTimeout
+}
+
+// Status returns the status of the runtime.
+func (r *runtime) Status() *Status {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return &Status{
+		Port:             r.port,
+		Error:            r.err,
+		ActiveSessions:   len(r.sessions),
+		TotalSessions:    atomic.LoadUint64(&r.totalSessions),
+		RejectedSessions: atomic.LoadUint64(&r.rejectedSessions),
+	}
+}
+
+// Close closes the listener and all the sessions.
+func (r *runtime) Close() {
+	r.lock.Lock()
+	r.closed = true
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.closeSessions()
+	r.lock.Unlock()
+
+	r.wg.Wait()
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+type (
+	// Spec describes the UDPServer.
+	Spec struct {
+		Port               uint16 `json:"port" jsonschema:"required,minimum=1"`
+		MaxSessions        uint32 `json:"maxSessions,omitempty" jsonschema:"omitempty"`
+		SessionIdleTimeout string `json:"sessionIdleTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+
+		Servers     []*ServerSpec `json:"servers" jsonschema:"required,minItems=1"`
+		LoadBalance string        `json:"loadBalance,omitempty" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=ipHash"`
+	}
+
+	// ServerSpec describes a backend server.
+	ServerSpec struct {
+		Address string `json:"address" jsonschema:"required"`
+		Weight  int    `json:"weight,omitempty" jsonschema:"omitempty,minimum=0,maximum=100"`
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if _, err := spec.sessionIdleTimeout(); err != nil {
+		return err
+	}
+
+	serversGotWeight := 0
+	for _, server := range spec.Servers {
+		if server.Weight > 0 {
+			serversGotWeight++
+		}
+	}
+	if serversGotWeight > 0 && serversGotWeight < len(spec.Servers) {
+		return fmt.Errorf("not all servers have weight(%d/%d)", serversGotWeight, len(spec.Servers))
+	}
+	return nil
+}
+
+func (spec *Spec) sessionIdleTimeout() (time.Duration, error) {
+	if spec.SessionIdleTimeout == "" {
+		return time.Minute, nil
+	}
+	d, err := time.ParseDuration(spec.SessionIdleTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sessionIdleTimeout %s: %v", spec.SessionIdleTimeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("sessionIdleTimeout must be positive")
+	}
+	return d, nil
+}
+
+// Validate validates ServerSpec.
+func (spec *ServerSpec) Validate() error {
+	if _, _, err := net.SplitHostPort(spec.Address); err != nil {
+		return fmt.Errorf("invalid address %s: %v", spec.Address, err)
+	}
+	return nil
+}
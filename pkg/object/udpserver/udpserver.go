@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"github.com/megaease/easegress/pkg/supervisor"
+)
+
+const (
+	// Category is the category of UDPServer.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of UDPServer.
+	Kind = "UDPServer"
+)
+
+func init() {
+	supervisor.Register(&UDPServer{})
+}
+
+type (
+	// UDPServer forwards UDP datagrams to a pool of backend servers, the
+	// datagrams from the same client address go to the same server until
+	// the session of the client is idle.
+	UDPServer struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		runtime   *runtime
+	}
+)
+
+// Category returns the category of UDPServer.
+func (us *UDPServer) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of UDPServer.
+func (us *UDPServer) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of UDPServer.
+func (us *UDPServer) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes UDPServer.
+func (us *UDPServer) Init(superSpec *supervisor.Spec) {
+	us.superSpec, us.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	us.runtime = newRuntime(superSpec.Name())
+	us.runtime.reload(us.spec)
+}
+
+// Inherit inherits previous generation of UDPServer, the listener and the
+// existing sessions are kept if the port is unchanged.
+func (us *UDPServer) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	us.superSpec, us.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	us.runtime = previousGeneration.(*UDPServer).runtime
+	us.runtime.reload(us.spec)
+}
+
+// Status returns the status of UDPServer.
+func (us *UDPServer) Status() *supervisor.Status {
+	return &supervisor.Status{
+		ObjectStatus: us.runtime.Status(),
+	}
+}
+
+// Close closes UDPServer.
+func (us *UDPServer) Close() {
+	us.runtime.Close()
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package udpserver
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/util/loadbalance"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+// startBackend starts a backend server which replies every datagram with
+// its name and the datagram.
+func startBackend(t *testing.T, name string) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(name+":"+string(buf[:n])), addr)
+		}
+	}()
+	return conn
+}
+
+func freePort(t *testing.T) int {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func newTestUDPServer(t *testing.T, yamlConfig string) *UDPServer {
+	superSpec, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+	require.NoError(t, err)
+	us := &UDPServer{}
+	us.Init(superSpec)
+	return us
+}
+
+func newClient(t *testing.T, port int) *net.UDPConn {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	require.NoError(t, err)
+	return conn
+}
+
+// request sends the message and returns the reply, or an empty string if
+// there's no reply.
+func request(conn *net.UDPConn, msg string) string {
+	conn.Write([]byte(msg))
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	validate := func(yamlConfig string) error {
+		_, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+		return err
+	}
+
+	assert.NoError(validate(`
+name: udp
+kind: UDPServer
+port: 10053
+sessionIdleTimeout: 10s
+servers:
+- address: 127.0.0.1:53
+`))
+	assert.Error(validate(`
+name: udp
+kind: UDPServer
+port: 10053
+`))
+	assert.Error(validate(`
+name: udp
+kind: UDPServer
+port: 10053
+sessionIdleTimeout: 0s
+servers:
+- address: 127.0.0.1:53
+`))
+	assert.Error(validate(`
+name: udp
+kind: UDPServer
+port: 10053
+servers:
+- address: 127.0.0.1
+`))
+	assert.Error(validate(`
+name: udp
+kind: UDPServer
+port: 10053
+servers:
+- address: 127.0.0.1:53
+  weight: 1
+- address: 127.0.0.1:54
+`))
+}
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := []*ServerSpec{{Address: "127.0.0.1:1"}, {Address: "127.0.0.1:2"}}
+	p := newPool(&Spec{Servers: servers})
+	assert.Equal("127.0.0.1:1", p.choose(""))
+	assert.Equal("127.0.0.1:2", p.choose(""))
+
+	p = newPool(&Spec{Servers: servers, LoadBalance: loadbalance.PolicyIPHash})
+	addr := p.choose("10.0.0.1")
+	for i := 0; i < 10; i++ {
+		assert.Equal(addr, p.choose("10.0.0.1"))
+	}
+
+	p = newPool(&Spec{
+		Servers:     []*ServerSpec{{Address: "127.0.0.1:1", Weight: 1}, {Address: "127.0.0.1:2", Weight: 3}},
+		LoadBalance: loadbalance.PolicyRandom,
+	})
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[p.choose("")]++
+	}
+	assert.InDelta(750, counts["127.0.0.1:2"], 100)
+}
+
+func TestUDPServer(t *testing.T) {
+	assert := assert.New(t)
+
+	backendA := startBackend(t, "a")
+	defer backendA.Close()
+	backendB := startBackend(t, "b")
+	defer backendB.Close()
+
+	port := freePort(t)
+	yamlConfig := fmt.Sprintf(`
+name: udp
+kind: UDPServer
+port: %d
+maxSessions: 2
+sessionIdleTimeout: 1s
+servers:
+- address: %s
+- address: %s
+`, port, backendA.LocalAddr(), backendB.LocalAddr())
+	us := newTestUDPServer(t, yamlConfig)
+	defer us.Close()
+
+	// datagrams of a client go to the same server.
+	client1 := newClient(t, port)
+	defer client1.Close()
+	assert.Equal("a:hello", request(client1, "hello"))
+	assert.Equal("a:world", request(client1, "world"))
+
+	client2 := newClient(t, port)
+	defer client2.Close()
+	assert.Equal("b:hello", request(client2, "hello"))
+
+	// the max sessions is reached.
+	client3 := newClient(t, port)
+	defer client3.Close()
+	assert.Equal("", request(client3, "hello"))
+
+	status := us.Status().ObjectStatus.(*Status)
+	assert.Equal(2, status.ActiveSessions)
+	assert.Equal(uint64(2), status.TotalSessions)
+	assert.Equal(uint64(1), status.RejectedSessions)
+
+	// sessions are removed after the idle timeout, and the new session
+	// of the client goes to the next server.
+	assert.Eventually(func() bool {
+		return us.Status().ObjectStatus.(*Status).ActiveSessions == 0
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Equal("a:again", request(client1, "again"))
+
+	// sessions are kept on reloading.
+	superSpec, err := supervisor.NewDefaultMock().NewSpec(yamlConfig)
+	require.NoError(t, err)
+	next := &UDPServer{}
+	next.Inherit(superSpec, us)
+	us = next
+	assert.Equal("a:still", request(client1, "still"))
+	assert.Equal(uint64(3), us.Status().ObjectStatus.(*Status).TotalSessions)
+}
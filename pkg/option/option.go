@@ -29,6 +29,7 @@ import (
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/megaease/easegress/pkg/common"
 	"github.com/megaease/easegress/pkg/util/codectool"
@@ -46,7 +47,110 @@ type ClusterOptions struct {
 	StateFlag                string            `yaml:"state-flag"`
 	// Secondary members define URLs to connect to cluster formed by primary members.
 	PrimaryListenPeerURLs []string `yaml:"primary-listen-peer-urls"`
-	MaxCallSendMsgSize    int      `yaml:"max-call-send-msg-size"`
+	// SecondaryLeaseTTL is the TTL of the lease of secondary members, the
+	// status of a secondary member is removed from the cluster once it
+	// stops keeping the lease alive for the TTL.
+	SecondaryLeaseTTL  string `yaml:"secondary-lease-ttl"`
+	MaxCallSendMsgSize int    `yaml:"max-call-send-msg-size"`
+}
+
+// APIAuthOptions defines the authentication and authorization of the
+// admin APIs.
+type APIAuthOptions struct {
+	// The admin APIs are served over TLS if the certificate is set, and the
+	// clients are authenticated by their certificates if the client CA is
+	// set, the common name is the user, and the organizations are the
+	// groups.
+	TLSCertFile  string `yaml:"tls-cert-file"`
+	TLSKeyFile   string `yaml:"tls-key-file"`
+	ClientCAFile string `yaml:"client-ca-file"`
+
+	Tokens       []*APIToken       `yaml:"tokens"`
+	OIDC         *APIOIDCOptions   `yaml:"oidc"`
+	Roles        []*APIRole        `yaml:"roles"`
+	RoleBindings []*APIRoleBinding `yaml:"role-bindings"`
+}
+
+// APIToken is a static bearer token of the admin APIs.
+type APIToken struct {
+	User   string   `yaml:"user"`
+	Token  string   `yaml:"token" json:"-"`
+	Groups []string `yaml:"groups"`
+}
+
+// APIOIDCOptions authenticates the clients of the admin APIs by the ID
+// tokens issued by an OpenID provider.
+type APIOIDCOptions struct {
+	DiscoveryURL string `yaml:"discovery-url"`
+	ClientID     string `yaml:"client-id"`
+	// UsernameClaim is the claim of the user, default is sub.
+	UsernameClaim string `yaml:"username-claim"`
+	// GroupsClaim is the claim of the groups, default is groups.
+	GroupsClaim string `yaml:"groups-claim"`
+}
+
+// APIRole is a set of permissions of the admin APIs.
+type APIRole struct {
+	Name  string         `yaml:"name"`
+	Rules []*APIRoleRule `yaml:"rules"`
+}
+
+// APIRoleRule allows the verbs, which are read and write, on the objects
+// of the kinds, the rule applies to all the APIs if kinds are empty.
+type APIRoleRule struct {
+	Verbs []string `yaml:"verbs"`
+	Kinds []string `yaml:"kinds"`
+}
+
+// APIRoleBinding grants a role to the users and groups.
+type APIRoleBinding struct {
+	Role   string   `yaml:"role"`
+	Users  []string `yaml:"users"`
+	Groups []string `yaml:"groups"`
+}
+
+// Enabled returns whether any authentication method is configured.
+func (o *APIAuthOptions) Enabled() bool {
+	return o.ClientCAFile != "" || len(o.Tokens) > 0 || o.OIDC != nil
+}
+
+func (o *APIAuthOptions) validate() error {
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return fmt.Errorf("tls-cert-file and tls-key-file must be set together")
+	}
+	if o.ClientCAFile != "" && o.TLSCertFile == "" {
+		return fmt.Errorf("client-ca-file requires tls-cert-file")
+	}
+
+	for _, t := range o.Tokens {
+		if t.User == "" || t.Token == "" {
+			return fmt.Errorf("empty user or token")
+		}
+	}
+	if o.OIDC != nil && (o.OIDC.DiscoveryURL == "" || o.OIDC.ClientID == "") {
+		return fmt.Errorf("oidc requires discovery-url and client-id")
+	}
+
+	roles := map[string]bool{"admin": true, "read-only": true}
+	for _, r := range o.Roles {
+		if roles[r.Name] {
+			return fmt.Errorf("duplicated role %s", r.Name)
+		}
+		roles[r.Name] = true
+		for _, rule := range r.Rules {
+			for _, verb := range rule.Verbs {
+				if verb != "read" && verb != "write" {
+					return fmt.Errorf("role %s: invalid verb %s", r.Name, verb)
+				}
+			}
+		}
+	}
+	for _, b := range o.RoleBindings {
+		if !roles[b.Role] {
+			return fmt.Errorf("role %s not found", b.Role)
+		}
+	}
+	return nil
 }
 
 // Options is the start-up options.
@@ -70,6 +174,8 @@ type Options struct {
 	Labels                   map[string]string `yaml:"labels" env:"EG_LABELS"`
 	APIAddr                  string            `yaml:"api-addr"`
 	Debug                    bool              `yaml:"debug"`
+	LogFormat                string            `yaml:"log-format"`
+	LogLevels                map[string]string `yaml:"log-levels"`
 	DisableAccessLog         bool              `yaml:"disable-access-log"`
 	InitialObjectConfigFiles []string          `yaml:"initial-object-config-files"`
 
@@ -94,6 +200,31 @@ type Options struct {
 	// Status
 	StatusUpdateMaxBatchSize int `yaml:"status-update-max-batch-size"`
 
+	// SecretMasterKey is the base64 encoded AES-256 key to encrypt the
+	// secrets, a random one is generated and stored in the cluster if empty.
+	SecretMasterKey string `yaml:"secret-master-key"`
+
+	// ReadinessProbes are the URLs of the upstreams checked by the
+	// readiness API.
+	ReadinessProbes []string `yaml:"readiness-probes"`
+
+	// APIAdminUsers are the cluster admins of the admin APIs, it maps the
+	// usernames to the bcrypt hashed passwords. The APIs are open to
+	// everyone if it is empty.
+	APIAdminUsers map[string]string `yaml:"api-admin-users"`
+	// APIAuth is the authentication and authorization of the admin APIs.
+	APIAuth APIAuthOptions `yaml:"api-auth"`
+
+	// AuditLogMaxEntries and AuditLogMaxAge are the retention limits of
+	// the audit log of the configuration changes, 0 means no limit.
+	AuditLogMaxEntries int    `yaml:"audit-log-max-entries"`
+	AuditLogMaxAge     string `yaml:"audit-log-max-age"`
+
+	// DrainTimeout is the deadline to drain the in-flight requests and
+	// connections of the traffic gates when they are closed, e.g. when the
+	// old process exits after a graceful upgrade.
+	DrainTimeout string `yaml:"drain-timeout"`
+
 	// Prepare the items below in advance.
 	AbsHomeDir   string `yaml:"-"`
 	AbsDataDir   string `yaml:"-"`
@@ -116,6 +247,7 @@ func addClusterVars(opt *Options) {
 	opt.flags.StringToStringVarP(&opt.Cluster.InitialCluster, "initial-cluster", "", nil, "List of (member name, URL) pairs that will form the cluster. E.g. primary-1=http://localhost:2380.")
 	opt.flags.StringVar(&opt.Cluster.StateFlag, "state-flag", "new", "Cluster state (new, existing)")
 	opt.flags.StringSliceVar(&opt.Cluster.PrimaryListenPeerURLs, "primary-listen-peer-urls", []string{"http://localhost:2380"}, "List of peer URLs of primary members. Define this only, when cluster-role is secondary.")
+	opt.flags.StringVar(&opt.Cluster.SecondaryLeaseTTL, "secondary-lease-ttl", "30s", "TTL of the lease of secondary members, the status of a secondary member is removed once it stops keeping the lease alive for the TTL.")
 	opt.flags.IntVar(&opt.Cluster.MaxCallSendMsgSize, "max-call-send-msg-size", 10*1024*1024, "Maximum size in bytes for cluster synchronization messages.")
 }
 
@@ -138,6 +270,8 @@ func New() *Options {
 	addClusterVars(opt)
 	opt.flags.StringVar(&opt.APIAddr, "api-addr", "localhost:2381", "Address([host]:port) to listen on for administration traffic.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
+	opt.flags.StringVar(&opt.LogFormat, "log-format", "console", "Format of the logs, console or json.")
+	opt.flags.StringToStringVar(&opt.LogLevels, "log-levels", nil, "Levels of the modules overriding the global level, e.g. proxy=debug, the modules are api, cluster, proxy, mqtt and tracing.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
 
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
@@ -150,6 +284,12 @@ func New() *Options {
 	opt.flags.StringVar(&opt.MemoryProfileFile, "memory-profile-file", "", "Path to the memory profile file.")
 
 	opt.flags.IntVar(&opt.StatusUpdateMaxBatchSize, "status-update-max-batch-size", 20, "Number of object statuses to update at maximum in one transaction.")
+	opt.flags.StringVar(&opt.SecretMasterKey, "secret-master-key", "", "Base64 encoded AES-256 key to encrypt the secrets, a random one is generated and stored in the cluster if empty.")
+	opt.flags.StringSliceVar(&opt.ReadinessProbes, "readiness-probes", nil, "List of URLs of the upstreams checked by the readiness API, a probe succeeds if the status code is less than 400.")
+	opt.flags.IntVar(&opt.AuditLogMaxEntries, "audit-log-max-entries", 10000, "Number of entries of the audit log of the configuration changes kept at maximum, 0 means no limit.")
+	opt.flags.StringVar(&opt.AuditLogMaxAge, "audit-log-max-age", "720h", "Max age of the entries of the audit log of the configuration changes, 0 means no limit.")
+	opt.flags.StringVar(&opt.DrainTimeout, "drain-timeout", "30s", "Deadline to drain the in-flight requests and connections when the traffic gates are closed, e.g. when the old process exits after a graceful upgrade.")
+	opt.flags.StringToStringVar(&opt.APIAdminUsers, "api-admin-users", nil, "Cluster admins of the administration APIs, which map the usernames to the bcrypt hashed passwords, the APIs are open to everyone if empty.")
 
 	opt.viper.BindPFlags(opt.flags)
 
@@ -289,6 +429,15 @@ func (opt *Options) validate() error {
 		if len(opt.Cluster.PrimaryListenPeerURLs) == 0 {
 			return fmt.Errorf("secondary got empty cluster.primary-listen-peer-urls")
 		}
+		if ttl := opt.Cluster.SecondaryLeaseTTL; ttl != "" {
+			d, err := time.ParseDuration(ttl)
+			if err != nil {
+				return fmt.Errorf("invalid secondary-lease-ttl: %v", err)
+			}
+			if d < 5*time.Second {
+				return fmt.Errorf("invalid secondary-lease-ttl: must be at least 5s")
+			}
+		}
 	case "primary":
 		argumentsToValidate := map[string][]string{
 			"listen-client-urls":          opt.Cluster.ListenClientURLs,
@@ -329,6 +478,47 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("invalid api-url: %v", err)
 	}
 
+	if _, err := ParseURLs(opt.ReadinessProbes); err != nil {
+		return fmt.Errorf("invalid readiness-probes: %v", err)
+	}
+
+	if opt.AuditLogMaxEntries < 0 {
+		return fmt.Errorf("invalid audit-log-max-entries: must not be negative")
+	}
+	if opt.AuditLogMaxAge != "" {
+		if _, err := time.ParseDuration(opt.AuditLogMaxAge); err != nil {
+			return fmt.Errorf("invalid audit-log-max-age: %v", err)
+		}
+	}
+
+	switch opt.LogFormat {
+	case "", "console", "json":
+	default:
+		return fmt.Errorf("invalid log-format: supported formats are console/json")
+	}
+	for module, level := range opt.LogLevels {
+		switch level {
+		case "debug", "info", "warn", "error":
+		default:
+			return fmt.Errorf("invalid log-levels: invalid level %s of module %s", level, module)
+		}
+	}
+
+	if opt.DrainTimeout != "" {
+		if d, err := time.ParseDuration(opt.DrainTimeout); err != nil || d < 0 {
+			return fmt.Errorf("invalid drain-timeout: %s", opt.DrainTimeout)
+		}
+	}
+
+	if err := opt.APIAuth.validate(); err != nil {
+		return fmt.Errorf("invalid api-auth: %v", err)
+	}
+	for user, hash := range opt.APIAdminUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid api-admin-users: password of %s is not bcrypt hashed", user)
+		}
+	}
+
 	// dirs
 	if opt.HomeDir == "" {
 		return fmt.Errorf("empty home-dir")
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package grpcprot implements the gRPC protocol.
+package grpcprot
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	"github.com/megaease/easegress/pkg/protocols"
+)
+
+func init() {
+	protocols.Register("grpc", &Protocol{})
+}
+
+type (
+	// Protocol implements protocols.Protocol for gRPC.
+	Protocol struct {
+	}
+
+	// Frame is a raw gRPC message, messages are forwarded as frames
+	// without being decoded.
+	Frame struct {
+		Payload []byte
+	}
+
+	// Codec is the gRPC codec of Frames.
+	Codec struct{}
+)
+
+var _ protocols.Protocol = (*Protocol)(nil)
+
+// CreateRequest creates a new gRPC request from a grpc.ServerStream.
+func (p *Protocol) CreateRequest(req interface{}) (protocols.Request, error) {
+	stream, ok := req.(grpc.ServerStream)
+	if !ok {
+		return nil, fmt.Errorf("input param's type should be grpc.ServerStream")
+	}
+	return NewRequest(stream), nil
+}
+
+// CreateResponse creates a new gRPC response.
+func (p *Protocol) CreateResponse(resp interface{}) (protocols.Response, error) {
+	return NewResponse(), nil
+}
+
+// Marshal implements encoding.Codec.
+func (c Codec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*Frame)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want *Frame", v)
+	}
+	return f.Payload, nil
+}
+
+// Unmarshal implements encoding.Codec.
+func (c Codec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*Frame)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want *Frame", v)
+	}
+	// data may be reused by gRPC, so copy it.
+	f.Payload = append([]byte(nil), data...)
+	return nil
+}
+
+// Name implements encoding.Codec, the name is "proto" so that clients and
+// servers using the default codec are compatible.
+func (c Codec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcprot
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/megaease/easegress/pkg/protocols"
+)
+
+// Header wraps the gRPC metadata, keys are case insensitive.
+type Header struct {
+	md metadata.MD
+}
+
+var _ protocols.Header = (*Header)(nil)
+
+// NewHeader creates a new Header from md.
+func NewHeader(md metadata.MD) *Header {
+	if md == nil {
+		md = metadata.MD{}
+	}
+	return &Header{md: md}
+}
+
+// RawHeader returns the underlying metadata.
+func (h *Header) RawHeader() metadata.MD {
+	return h.md
+}
+
+func toValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	default:
+		panic("value must be string or []string")
+	}
+}
+
+// Add adds the value to key, value must be a string or a string slice.
+func (h *Header) Add(key string, value interface{}) {
+	h.md.Append(key, toValues(value)...)
+}
+
+// Set sets the value of key, value must be a string or a string slice.
+func (h *Header) Set(key string, value interface{}) {
+	h.md.Set(key, toValues(value)...)
+}
+
+// Get returns the first value of key, or an empty string if the key does
+// not exist.
+func (h *Header) Get(key string) interface{} {
+	return h.first(key)
+}
+
+func (h *Header) first(key string) string {
+	values := h.md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Values returns all values of key.
+func (h *Header) Values(key string) []string {
+	return h.md.Get(key)
+}
+
+// Del deletes key.
+func (h *Header) Del(key string) {
+	h.md.Delete(key)
+}
+
+// Walk walks all header items, and stops if fn returns false, the values
+// are in string slices.
+func (h *Header) Walk(fn func(key string, value interface{}) bool) {
+	for k, v := range h.md {
+		if !fn(k, v) {
+			break
+		}
+	}
+}
+
+// Clone returns a copy of the header.
+func (h *Header) Clone() protocols.Header {
+	return &Header{md: h.md.Copy()}
+}
+
+// isReserved returns whether key is a reserved header of gRPC or HTTP/2,
+// which must not be forwarded.
+func isReserved(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") {
+		return true
+	}
+	switch key {
+	case "content-type", "user-agent", "te", "connection":
+		return true
+	}
+	return false
+}
+
+// ForwardableMD returns a copy of the metadata without reserved headers.
+func (h *Header) ForwardableMD() metadata.MD {
+	md := metadata.MD{}
+	for k, v := range h.md {
+		if !isReserved(k) {
+			md[k] = append([]string(nil), v...)
+		}
+	}
+	return md
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcprot
+
+import (
+	stdcontext "context"
+	"io"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/megaease/easegress/pkg/protocols"
+)
+
+// Request wraps a gRPC server stream, the messages of the request are not
+// read in advance, they are forwarded by filters from the stream directly.
+type Request struct {
+	stream     grpc.ServerStream
+	fullMethod string
+	service    string
+	method     string
+	header     *Header
+	remoteAddr string
+	realIP     string
+}
+
+var _ protocols.Request = (*Request)(nil)
+
+// NewRequest creates a new gRPC request from stream.
+func NewRequest(stream grpc.ServerStream) *Request {
+	ctx := stream.Context()
+	r := &Request{stream: stream}
+
+	r.fullMethod, _ = grpc.MethodFromServerStream(stream)
+	r.service, r.method = SplitMethod(r.fullMethod)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.header = NewHeader(md.Copy())
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.remoteAddr = p.Addr.String()
+	}
+	r.realIP = r.getRealIP()
+	return r
+}
+
+// SplitMethod splits a full method name like "/package.Service/Method"
+// into the service name and the method name.
+func SplitMethod(fullMethod string) (service, method string) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+func (r *Request) getRealIP() string {
+	if xff := r.header.first("x-forwarded-for"); xff != "" {
+		ip := strings.TrimSpace(strings.Split(xff, ",")[0])
+		if ip != "" {
+			return ip
+		}
+	}
+	if xrip := r.header.first("x-real-ip"); xrip != "" {
+		return xrip
+	}
+	ip, _, err := net.SplitHostPort(r.remoteAddr)
+	if err != nil {
+		return r.remoteAddr
+	}
+	return ip
+}
+
+// Stream returns the underlying server stream.
+func (r *Request) Stream() grpc.ServerStream {
+	return r.stream
+}
+
+// Context returns the context of the stream, it carries the deadline of
+// the call, and is canceled when the call ends.
+func (r *Request) Context() stdcontext.Context {
+	return r.stream.Context()
+}
+
+// FullMethod returns the full method name, e.g. "/package.Service/Method".
+func (r *Request) FullMethod() string {
+	return r.fullMethod
+}
+
+// Service returns the service name, e.g. "package.Service".
+func (r *Request) Service() string {
+	return r.service
+}
+
+// Method returns the method name, e.g. "Method".
+func (r *Request) Method() string {
+	return r.method
+}
+
+// Host returns the authority of the request.
+func (r *Request) Host() string {
+	return r.header.first(":authority")
+}
+
+// RemoteAddr returns the address of the client.
+func (r *Request) RemoteAddr() string {
+	return r.remoteAddr
+}
+
+// RealIP returns the real IP of the client.
+func (r *Request) RealIP() string {
+	return r.realIP
+}
+
+// Header returns the metadata of the request.
+func (r *Request) Header() protocols.Header {
+	return r.header
+}
+
+// GRPCHeader returns the metadata of the request in type *Header.
+func (r *Request) GRPCHeader() *Header {
+	return r.header
+}
+
+// IsStream returns whether the payload of the request is a stream, it is
+// always true as messages are read from the stream.
+func (r *Request) IsStream() bool {
+	return true
+}
+
+// SetPayload is not supported by gRPC requests.
+func (r *Request) SetPayload(payload interface{}) {
+	panic("payload of gRPC request cannot be set")
+}
+
+// GetPayload returns an empty reader, as the messages are read from the
+// stream by filters.
+func (r *Request) GetPayload() io.Reader {
+	return strings.NewReader("")
+}
+
+// RawPayload panics, the payload of gRPC request is a stream.
+func (r *Request) RawPayload() []byte {
+	panic("payload of gRPC request is a stream")
+}
+
+// PayloadSize returns 0.
+func (r *Request) PayloadSize() int64 {
+	return 0
+}
+
+// Close closes the request.
+func (r *Request) Close() {
+}
+
+// ToBuilderRequest wraps the request and returns the wrapper, the
+// return value can be used in the template of the Builder filters.
+func (r *Request) ToBuilderRequest(name string) interface{} {
+	panic("not implemented")
+}
+
+// NewRequestInfo returns a new requestInfo.
+func (p *Protocol) NewRequestInfo() interface{} {
+	panic("not implemented")
+}
+
+// BuildRequest builds and returns a request according to the given reqInfo.
+func (p *Protocol) BuildRequest(reqInfo interface{}) (protocols.Request, error) {
+	panic("not implemented")
+}
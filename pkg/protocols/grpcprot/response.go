@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package grpcprot
+
+import (
+	"io"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/megaease/easegress/pkg/protocols"
+)
+
+// Response is a gRPC response, the messages are sent to the client stream
+// by filters directly, the response only carries the status, header and
+// trailer of the call.
+type Response struct {
+	status  *status.Status
+	header  *Header
+	trailer *Header
+}
+
+var _ protocols.Response = (*Response)(nil)
+
+// NewResponse returns a new gRPC response with status OK.
+func NewResponse() *Response {
+	return &Response{
+		status:  status.New(codes.OK, ""),
+		header:  NewHeader(nil),
+		trailer: NewHeader(nil),
+	}
+}
+
+// Status returns the status of the response.
+func (r *Response) Status() *status.Status {
+	return r.status
+}
+
+// SetStatus sets the status of the response.
+func (r *Response) SetStatus(s *status.Status) {
+	r.status = s
+}
+
+// Code returns the status code of the response.
+func (r *Response) Code() codes.Code {
+	return r.status.Code()
+}
+
+// Header returns the header metadata of the response.
+func (r *Response) Header() protocols.Header {
+	return r.header
+}
+
+// GRPCHeader returns the header metadata of the response in type *Header.
+func (r *Response) GRPCHeader() *Header {
+	return r.header
+}
+
+// Trailer returns the trailer metadata of the response.
+func (r *Response) Trailer() *Header {
+	return r.trailer
+}
+
+// SetTrailer replaces the trailer metadata of the response.
+func (r *Response) SetTrailer(md metadata.MD) {
+	r.trailer = NewHeader(md)
+}
+
+// IsStream returns whether the payload of the response is a stream, it is
+// always true as messages are sent to the stream.
+func (r *Response) IsStream() bool {
+	return true
+}
+
+// SetPayload is not supported by gRPC responses.
+func (r *Response) SetPayload(payload interface{}) {
+	panic("payload of gRPC response cannot be set")
+}
+
+// GetPayload returns an empty reader.
+func (r *Response) GetPayload() io.Reader {
+	return strings.NewReader("")
+}
+
+// RawPayload panics, the payload of gRPC response is a stream.
+func (r *Response) RawPayload() []byte {
+	panic("payload of gRPC response is a stream")
+}
+
+// PayloadSize returns 0.
+func (r *Response) PayloadSize() int64 {
+	return 0
+}
+
+// Close closes the response.
+func (r *Response) Close() {
+}
+
+// ToBuilderResponse wraps the response and returns the wrapper, the
+// return value can be used in the template of the Builder filters.
+func (r *Response) ToBuilderResponse(name string) interface{} {
+	panic("not implemented")
+}
+
+// NewResponseInfo returns a new responseInfo.
+func (p *Protocol) NewResponseInfo() interface{} {
+	panic("not implemented")
+}
+
+// BuildResponse builds and returns a response according to the given respInfo.
+func (p *Protocol) BuildResponse(respInfo interface{}) (protocols.Response, error) {
+	panic("not implemented")
+}
@@ -30,6 +30,20 @@ import (
 // DefaultMaxPayloadSize is the default max allowed payload size.
 const DefaultMaxPayloadSize = 4 * 1024 * 1024
 
+// ResponseWriterKey is the key of the http.ResponseWriter of the client in
+// the context data. Filters taking over the client connection, like the
+// WebSocketProxy, use it, and they must set a response with status code
+// 101 (Switching Protocols) so that the server won't write the response.
+const ResponseWriterKey = "HTTP_RESPONSE_WRITER"
+
+// UpstreamKey is the key of the URL of the server which the request is
+// proxied to in the context data, it is set by the Proxy filter.
+const UpstreamKey = "HTTP_UPSTREAM"
+
+// RequestIDKey is the key of the ID of the request in the context data, it
+// is set by the HTTPServer if the request IDs are enabled.
+const RequestIDKey = "HTTP_REQUEST_ID"
+
 func init() {
 	protocols.Register("http", &Protocol{})
 }
@@ -28,6 +28,7 @@ import (
 	"strings"
 
 	"github.com/megaease/easegress/pkg/protocols"
+	"github.com/megaease/easegress/pkg/util/bufferpool"
 	"github.com/megaease/easegress/pkg/util/readers"
 	"github.com/tomasen/realip"
 )
@@ -45,6 +46,8 @@ type Request struct {
 	stream  *readers.ByteCountReader
 	payload []byte
 	realIP  string
+	// requestID is set by the HTTPServer if the request IDs are enabled.
+	requestID string
 }
 
 var (
@@ -124,7 +127,7 @@ func (r *Request) FetchPayload(maxPayloadSize int64) error {
 		return nil
 	}
 
-	payload, err := io.ReadAll(io.LimitReader(stdr.Body, maxPayloadSize))
+	payload, err := bufferpool.ReadAll(io.LimitReader(stdr.Body, maxPayloadSize))
 	r.SetPayload(payload)
 	if err != nil {
 		return err
@@ -295,6 +298,23 @@ func (r *Request) RealIP() string {
 	return r.realIP
 }
 
+// SetRealIP sets the real IP of the request, e.g. the IP resolved from
+// the headers of the trusted proxies.
+func (r *Request) SetRealIP(ip string) {
+	r.realIP = ip
+}
+
+// RequestID returns the ID of the request, it is empty if the request IDs
+// are not enabled by the HTTPServer.
+func (r *Request) RequestID() string {
+	return r.requestID
+}
+
+// SetRequestID sets the ID of the request.
+func (r *Request) SetRequestID(id string) {
+	r.requestID = id
+}
+
 // Std returns the underlying http.Request.
 func (r *Request) Std() *http.Request {
 	return r.Request
@@ -25,6 +25,7 @@ import (
 	"strconv"
 
 	"github.com/megaease/easegress/pkg/protocols"
+	"github.com/megaease/easegress/pkg/util/bufferpool"
 	"github.com/megaease/easegress/pkg/util/readers"
 )
 
@@ -41,6 +42,7 @@ type Response struct {
 	// using the big http.Response object.
 	*http.Response
 	stream      *readers.ByteCountReader
+	sse         *SSEReader
 	payload     []byte
 	payloadSize int64
 }
@@ -74,14 +76,15 @@ func (r *Response) IsStream() bool {
 // FetchPayload reads the body of the underlying http.Response and initializes
 // the payload.
 //
-// if maxPayloadSize is a negative number, the payload is treated as a stream.
+// if maxPayloadSize is a negative number, or the response is a Server-Sent
+// Events stream, the payload is treated as a stream.
 // if maxPayloadSize is zero, DefaultMaxPayloadSize is used.
 func (r *Response) FetchPayload(maxPayloadSize int64) error {
 	if maxPayloadSize == 0 {
 		maxPayloadSize = DefaultMaxPayloadSize
 	}
 
-	if maxPayloadSize < 0 {
+	if maxPayloadSize < 0 || IsEventStream(r.Response.Header) {
 		r.SetPayload(r.Response.Body)
 		return nil
 	}
@@ -108,7 +111,7 @@ func (r *Response) FetchPayload(maxPayloadSize int64) error {
 		return nil
 	}
 
-	payload, err := io.ReadAll(io.LimitReader(stdr.Body, maxPayloadSize))
+	payload, err := bufferpool.ReadAll(io.LimitReader(stdr.Body, maxPayloadSize))
 	r.SetPayload(payload)
 	if err != nil {
 		return err
@@ -134,6 +137,7 @@ func (r *Response) FetchPayload(maxPayloadSize int64) error {
 // the payload.
 func (r *Response) SetPayload(payload interface{}) {
 	r.stream = nil
+	r.sse = nil
 	r.payload = nil
 
 	if payload == nil {
@@ -146,6 +150,9 @@ func (r *Response) SetPayload(payload interface{}) {
 	case string:
 		r.payload = []byte(p)
 	case io.Reader:
+		if sr, ok := p.(*SSEReader); ok {
+			r.sse = sr
+		}
 		if bcr, ok := p.(*readers.ByteCountReader); ok {
 			r.stream = bcr
 		} else {
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpprot
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// EventStreamContentType is the content type of Server-Sent Events.
+const EventStreamContentType = "text/event-stream"
+
+type (
+	// SSEEvent is an event of a Server-Sent Events stream. Data is the
+	// value of all data lines joined by "\n", and Comments are the comment
+	// lines without the leading colon.
+	SSEEvent struct {
+		ID       string
+		Event    string
+		Data     string
+		Retry    string
+		Comments []string
+	}
+
+	// SSEHook is called for every event of a Server-Sent Events stream,
+	// it returns the event to send, which can be the original one, a new
+	// one, or nil to drop the event.
+	SSEHook func(event *SSEEvent) *SSEEvent
+
+	// SSEReader reads a Server-Sent Events stream event by event, the
+	// events are passed to the hooks before they are returned by Read,
+	// and a Read never returns data of more than one event.
+	SSEReader struct {
+		src   io.Reader
+		r     *bufio.Reader
+		hooks []SSEHook
+		buf   bytes.Buffer
+		err   error
+	}
+)
+
+// IsEventStream returns whether the header is of a Server-Sent Events stream.
+func IsEventStream(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediaType == EventStreamContentType
+}
+
+// Bytes encodes the event in the format of the event stream, including the
+// blank line at the end.
+func (e *SSEEvent) Bytes() []byte {
+	buf := bytes.Buffer{}
+	for _, c := range e.Comments {
+		buf.WriteString(":" + c + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + e.Event + "\n")
+	}
+	if e.ID != "" {
+		buf.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Retry != "" {
+		buf.WriteString("retry: " + e.Retry + "\n")
+	}
+	// the client dispatches an event only if it has a data line, so the
+	// data line is always written unless the event has only comments, like
+	// the keep-alive ones.
+	if e.Data != "" || e.ID != "" || e.Event != "" || e.Retry != "" || len(e.Comments) == 0 {
+		for _, line := range strings.Split(e.Data, "\n") {
+			buf.WriteString("data: " + line + "\n")
+		}
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// NewSSEReader creates an SSEReader reading events from r.
+func NewSSEReader(r io.Reader, hooks ...SSEHook) *SSEReader {
+	return &SSEReader{src: r, r: bufio.NewReader(r), hooks: hooks}
+}
+
+// AddHook adds a hook, which is called after the existing hooks.
+func (sr *SSEReader) AddHook(hook SSEHook) {
+	sr.hooks = append(sr.hooks, hook)
+}
+
+// Read implements io.Reader.
+func (sr *SSEReader) Read(p []byte) (int, error) {
+	for sr.buf.Len() == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		var event *SSEEvent
+		event, sr.err = sr.readEvent()
+		if event == nil {
+			continue
+		}
+		for _, hook := range sr.hooks {
+			if event = hook(event); event == nil {
+				break
+			}
+		}
+		if event != nil {
+			sr.buf.Write(event.Bytes())
+		}
+	}
+	return sr.buf.Read(p)
+}
+
+// readEvent reads the lines of an event until a blank line, it returns a
+// nil event if there are no lines before the error.
+func (sr *SSEReader) readEvent() (*SSEEvent, error) {
+	event := &SSEEvent{}
+	var data []string
+	hasLines := false
+	for {
+		line, err := sr.r.ReadString('\n')
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if err == nil && !hasLines {
+				// skip leading blank lines.
+				continue
+			}
+			if !hasLines {
+				return nil, err
+			}
+			event.Data = strings.Join(data, "\n")
+			return event, err
+		}
+
+		hasLines = true
+		field, value := line, ""
+		if idx := strings.IndexByte(line, ':'); idx >= 0 {
+			field, value = line[:idx], strings.TrimPrefix(line[idx+1:], " ")
+		}
+		switch field {
+		case "":
+			event.Comments = append(event.Comments, line[1:])
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "retry":
+			event.Retry = value
+		case "data":
+			data = append(data, value)
+		}
+
+		if err != nil {
+			event.Data = strings.Join(data, "\n")
+			return event, err
+		}
+	}
+}
+
+// Close implements io.Closer and closes the underlying io.Reader if it is
+// an io.Closer.
+func (sr *SSEReader) Close() error {
+	if c, ok := sr.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// AddSSEHook adds a hook to the events of the response, it returns false
+// if the payload of the response is not a Server-Sent Events stream.
+func (r *Response) AddSSEHook(hook SSEHook) bool {
+	if r.stream == nil || !IsEventStream(r.HTTPHeader()) {
+		return false
+	}
+	if r.sse == nil {
+		r.SetPayload(NewSSEReader(r.stream))
+	}
+	r.sse.AddHook(hook)
+	return true
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpprot
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsEventStream(t *testing.T) {
+	assert := assert.New(t)
+
+	h := http.Header{}
+	assert.False(IsEventStream(h))
+	h.Set("Content-Type", "text/event-stream; charset=utf-8")
+	assert.True(IsEventStream(h))
+	h.Set("Content-Type", "text/plain")
+	assert.False(IsEventStream(h))
+}
+
+func TestSSEReader(t *testing.T) {
+	assert := assert.New(t)
+
+	stream := "\n: hello\r\nevent: add\r\nid: 1\r\ndata: a\r\ndata:b\r\n\r\n" +
+		"data: drop\n\n" +
+		"retry: 100\ndata: last"
+
+	var events []*SSEEvent
+	sr := NewSSEReader(strings.NewReader(stream), func(e *SSEEvent) *SSEEvent {
+		events = append(events, e)
+		if e.Data == "drop" {
+			return nil
+		}
+		return e
+	})
+
+	buf := make([]byte, 1024)
+	n, err := sr.Read(buf)
+	assert.NoError(err)
+	assert.Equal(": hello\nevent: add\nid: 1\ndata: a\ndata: b\n\n", string(buf[:n]))
+
+	// the dropped event is skipped.
+	n, err = sr.Read(buf)
+	assert.NoError(err)
+	assert.Equal("retry: 100\ndata: last\n\n", string(buf[:n]))
+
+	_, err = sr.Read(buf)
+	assert.Equal(io.EOF, err)
+
+	assert.Len(events, 3)
+	assert.Equal(&SSEEvent{ID: "1", Event: "add", Data: "a\nb", Comments: []string{" hello"}}, events[0])
+	assert.Equal("100", events[2].Retry)
+}
+
+func TestSSEEventBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &SSEEvent{Event: "ping"}
+	assert.Equal("event: ping\ndata: \n\n", string(e.Bytes()))
+
+	e = &SSEEvent{}
+	assert.Equal("data: \n\n", string(e.Bytes()))
+
+	e = &SSEEvent{Data: "a\n\nb"}
+	assert.Equal("data: a\ndata: \ndata: b\n\n", string(e.Bytes()))
+
+	// keep-alive events with only comments are not dispatched by clients.
+	e = &SSEEvent{Comments: []string{" keep-alive"}}
+	assert.Equal(": keep-alive\n\n", string(e.Bytes()))
+}
+
+func TestResponseSSEHook(t *testing.T) {
+	assert := assert.New(t)
+
+	hook := func(e *SSEEvent) *SSEEvent {
+		e.Data = strings.ToUpper(e.Data)
+		return e
+	}
+
+	resp, _ := NewResponse(nil)
+	resp.SetPayload("data: a\n\n")
+	assert.False(resp.AddSSEHook(hook))
+
+	stdr := &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": []string{EventStreamContentType}},
+		Body:          io.NopCloser(strings.NewReader("data: a\n\ndata: b\n\n")),
+		ContentLength: -1,
+	}
+	resp, _ = NewResponse(stdr)
+	defer resp.Close()
+
+	// event streams are always treated as streams.
+	assert.NoError(resp.FetchPayload(1024))
+	assert.True(resp.IsStream())
+
+	assert.True(resp.AddSSEHook(hook))
+	assert.True(resp.AddSSEHook(func(e *SSEEvent) *SSEEvent {
+		e.ID = e.Data
+		return e
+	}))
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.NoError(err)
+	assert.Equal("id: A\ndata: A\n\nid: B\ndata: B\n\n", string(data))
+}
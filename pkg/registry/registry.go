@@ -19,43 +19,86 @@ package registry
 
 import (
 	// Filters
+	_ "github.com/megaease/easegress/pkg/filters/adaptiveconcurrency"
+	_ "github.com/megaease/easegress/pkg/filters/aggregator"
+	_ "github.com/megaease/easegress/pkg/filters/bandwidthlimiter"
+	_ "github.com/megaease/easegress/pkg/filters/bodytransformer"
+	_ "github.com/megaease/easegress/pkg/filters/botdetector"
 	_ "github.com/megaease/easegress/pkg/filters/builder"
 	_ "github.com/megaease/easegress/pkg/filters/certextractor"
+	_ "github.com/megaease/easegress/pkg/filters/clientcertauth"
+	_ "github.com/megaease/easegress/pkg/filters/compression"
 	_ "github.com/megaease/easegress/pkg/filters/connectcontrol"
+	_ "github.com/megaease/easegress/pkg/filters/consumerquota"
 	_ "github.com/megaease/easegress/pkg/filters/corsadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/corsfilter"
+	_ "github.com/megaease/easegress/pkg/filters/csrf"
+	_ "github.com/megaease/easegress/pkg/filters/externalprocessor"
 	_ "github.com/megaease/easegress/pkg/filters/fallback"
+	_ "github.com/megaease/easegress/pkg/filters/faultinjector"
+	_ "github.com/megaease/easegress/pkg/filters/fileserver"
+	_ "github.com/megaease/easegress/pkg/filters/geoipfilter"
+	_ "github.com/megaease/easegress/pkg/filters/graphqlbackend"
+	_ "github.com/megaease/easegress/pkg/filters/grpcproxy"
+	_ "github.com/megaease/easegress/pkg/filters/grpctranscoder"
 	_ "github.com/megaease/easegress/pkg/filters/headerlookup"
 	_ "github.com/megaease/easegress/pkg/filters/headertojson"
+	_ "github.com/megaease/easegress/pkg/filters/httpcache"
 	_ "github.com/megaease/easegress/pkg/filters/kafka"
 	_ "github.com/megaease/easegress/pkg/filters/kafkabackend"
+	_ "github.com/megaease/easegress/pkg/filters/luafilter"
+	_ "github.com/megaease/easegress/pkg/filters/maintenance"
 	_ "github.com/megaease/easegress/pkg/filters/meshadaptor"
 	_ "github.com/megaease/easegress/pkg/filters/mock"
 	_ "github.com/megaease/easegress/pkg/filters/mqttclientauth"
+	_ "github.com/megaease/easegress/pkg/filters/oidcauth"
+	_ "github.com/megaease/easegress/pkg/filters/opafilter"
 	_ "github.com/megaease/easegress/pkg/filters/proxy"
 	_ "github.com/megaease/easegress/pkg/filters/ratelimiter"
 	_ "github.com/megaease/easegress/pkg/filters/remotefilter"
 	_ "github.com/megaease/easegress/pkg/filters/requestadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/requestcollapser"
 	_ "github.com/megaease/easegress/pkg/filters/responseadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/retryqueue"
+	_ "github.com/megaease/easegress/pkg/filters/schemavalidator"
 	_ "github.com/megaease/easegress/pkg/filters/topicmapper"
+	_ "github.com/megaease/easegress/pkg/filters/traffictagger"
 	_ "github.com/megaease/easegress/pkg/filters/validator"
+	_ "github.com/megaease/easegress/pkg/filters/waf"
 	_ "github.com/megaease/easegress/pkg/filters/wasmhost"
+	_ "github.com/megaease/easegress/pkg/filters/websocketproxy"
 
 	// Objects
+	_ "github.com/megaease/easegress/pkg/object/accesslog"
 	_ "github.com/megaease/easegress/pkg/object/autocertmanager"
+	_ "github.com/megaease/easegress/pkg/object/canarycontroller"
+	_ "github.com/megaease/easegress/pkg/object/configsync"
 	_ "github.com/megaease/easegress/pkg/object/consulserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/easemonitormetrics"
 	_ "github.com/megaease/easegress/pkg/object/etcdserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/eurekaserviceregistry"
+	_ "github.com/megaease/easegress/pkg/object/federationcontroller"
+	_ "github.com/megaease/easegress/pkg/object/filtertemplate"
 	_ "github.com/megaease/easegress/pkg/object/function"
 	_ "github.com/megaease/easegress/pkg/object/globalfilter"
+	_ "github.com/megaease/easegress/pkg/object/grpcserver"
+	_ "github.com/megaease/easegress/pkg/object/headerpolicy"
 	_ "github.com/megaease/easegress/pkg/object/httpserver"
 	_ "github.com/megaease/easegress/pkg/object/ingresscontroller"
+	_ "github.com/megaease/easegress/pkg/object/ipset"
+	_ "github.com/megaease/easegress/pkg/object/loadshedder"
 	_ "github.com/megaease/easegress/pkg/object/meshcontroller"
+	_ "github.com/megaease/easegress/pkg/object/metricsexporter"
 	_ "github.com/megaease/easegress/pkg/object/mqttproxy"
 	_ "github.com/megaease/easegress/pkg/object/nacosserviceregistry"
 	_ "github.com/megaease/easegress/pkg/object/pipeline"
 	_ "github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	_ "github.com/megaease/easegress/pkg/object/secretprovider"
+	_ "github.com/megaease/easegress/pkg/object/tcpserver"
+	_ "github.com/megaease/easegress/pkg/object/trafficcapture"
 	_ "github.com/megaease/easegress/pkg/object/trafficcontroller"
+	_ "github.com/megaease/easegress/pkg/object/triggercontroller"
+	_ "github.com/megaease/easegress/pkg/object/udpserver"
 	_ "github.com/megaease/easegress/pkg/object/websocketserver"
 	_ "github.com/megaease/easegress/pkg/object/zookeeperserviceregistry"
 )
@@ -20,6 +20,7 @@ package resilience
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -70,6 +71,35 @@ type (
 		SlowCallDurationThreshold        string `json:"slowCallDurationThreshold" jsonschema:"omitempty,format=duration"`
 		MaxWaitDurationInHalfOpen        string `json:"maxWaitDurationInHalfOpenState" jsonschema:"omitempty,format=duration"`
 		WaitDurationInOpen               string `json:"waitDurationInOpenState" jsonschema:"omitempty,format=duration"`
+		// ShareState shares the state transitions of the circuit breaker
+		// with the other members of the cluster, so that they open and
+		// close together.
+		ShareState bool `json:"shareState,omitempty" jsonschema:"omitempty"`
+	}
+
+	// CircuitBreakerStatus is the status of a circuit breaker.
+	CircuitBreakerStatus struct {
+		State        string `json:"state"`
+		TransitTime  string `json:"transitTime"`
+		FailureRate  uint8  `json:"failureRate"`
+		SlowCallRate uint8  `json:"slowCallRate"`
+		NumOfCalls   uint32 `json:"numOfCalls"`
+	}
+
+	// CircuitBreakerRecord is the state of a circuit breaker stored in the
+	// cluster. It is written by the admin API to force the state of the
+	// circuit breakers of all members, or by a member to share its state
+	// transitions with the other members.
+	CircuitBreakerRecord struct {
+		// State is one of ForceOpen, Open and Closed.
+		State string `json:"state"`
+		// Reset discards the recorded results, it is only valid if the
+		// state is Closed.
+		Reset bool `json:"reset,omitempty"`
+		// Member is the member sharing the state, it is empty if the
+		// record is written by the admin API.
+		Member string `json:"member,omitempty"`
+		Time   string `json:"time"`
 	}
 )
 
@@ -110,15 +140,55 @@ func (p *CircuitBreakerPolicy) CreateWrapper() Wrapper {
 		policy.WaitDurationInOpen = time.Minute
 	}
 
-	return circuitBreakerWrapper{CircuitBreaker: libcb.New(policy)}
+	return CircuitBreakerWrapper{CircuitBreaker: libcb.New(policy)}
 }
 
-type circuitBreakerWrapper struct {
+// CircuitBreakerWrapper is the Wrapper created by CircuitBreakerPolicy.
+type CircuitBreakerWrapper struct {
 	*libcb.CircuitBreaker
 }
 
+// Status returns the status of the circuit breaker.
+func (w CircuitBreakerWrapper) Status() *CircuitBreakerStatus {
+	transitTime, failureRate, slowCallRate, numOfCalls := w.Metrics()
+	return &CircuitBreakerStatus{
+		State:        w.State().String(),
+		TransitTime:  transitTime.Format(time.RFC3339),
+		FailureRate:  failureRate,
+		SlowCallRate: slowCallRate,
+		NumOfCalls:   numOfCalls,
+	}
+}
+
+// Apply applies the record to the circuit breaker, a state shared by other
+// members doesn't override the forced open state.
+func (w CircuitBreakerWrapper) Apply(r *CircuitBreakerRecord) error {
+	state, ok := libcb.ParseState(r.State)
+	if !ok {
+		return fmt.Errorf("unknown circuit breaker state %s", r.State)
+	}
+
+	if r.Member != "" && w.State() == libcb.StateForceOpen {
+		return nil
+	}
+
+	switch state {
+	case libcb.StateClosed:
+		if r.Reset {
+			w.Reset()
+		} else {
+			w.SetState(state)
+		}
+	case libcb.StateOpen, libcb.StateForceOpen:
+		w.SetState(state)
+	default:
+		return fmt.Errorf("circuit breaker state %s can not be applied", r.State)
+	}
+	return nil
+}
+
 // Wrap wraps the handler function.
-func (w circuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
+func (w CircuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
 	return func(ctx context.Context) error {
 		var err error
 
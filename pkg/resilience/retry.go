@@ -55,8 +55,22 @@ type (
 		BackOffPolicy       string  `json:"backOffPolicy" jsonschema:"omitempty,enum=random,enum=exponential"`
 		RandomizationFactor float64 `json:"randomizationFactor" jsonschema:"omitempty,minimum=0,maximum=1"`
 	}
+
+	stopRetryError struct {
+		err error
+	}
 )
 
+func (e *stopRetryError) Error() string {
+	return e.err.Error()
+}
+
+// StopRetry wraps err to tell the retry wrapper to stop retrying, the
+// wrapper returns err itself instead of the wrapped one.
+func StopRetry(err error) error {
+	return &stopRetryError{err: err}
+}
+
 // Validate validates the retry policy.
 func (p *RetryPolicy) Validate() error {
 	// TODO
@@ -85,6 +99,9 @@ func (p *RetryPolicy) Wrap(handler HandlerFunc) HandlerFunc {
 			if err == nil {
 				return nil
 			}
+			if se, ok := err.(*stopRetryError); ok {
+				return se.err
+			}
 
 			delta := base * p.RandomizationFactor
 			d := base - delta + float64(rand.Intn(int(delta*2+1)))
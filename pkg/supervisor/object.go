@@ -28,7 +28,10 @@ import (
 	"sync"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
+
 	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/secret"
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/util/codectool"
@@ -74,6 +77,9 @@ type (
 		configPrefix          string
 		configLocalPathPrefix string
 
+		secretSyncChan  <-chan map[string]*mvccpb.KeyValue
+		secretRevisions map[string]int64
+
 		mutex    sync.Mutex
 		entities map[string]*ObjectEntity
 		watchers map[string]*ObjectEntityWatcher
@@ -146,12 +152,18 @@ func newObjectRegistry(super *Supervisor, initObjs map[string]string) *ObjectReg
 		panic(fmt.Errorf("sync prefix %s failed: %v", prefix, err))
 	}
 
+	secretSyncChan, err := syncer.SyncRawPrefix(cls.Layout().SecretPrefix())
+	if err != nil {
+		panic(fmt.Errorf("sync prefix %s failed: %v", cls.Layout().SecretPrefix(), err))
+	}
+
 	or := &ObjectRegistry{
 		super:                 super,
 		configSyncer:          syncer,
 		configSyncChan:        syncChan,
 		configPrefix:          prefix,
 		configLocalPathPrefix: filepath.Join(super.Options().AbsHomeDir, configFilePrefix),
+		secretSyncChan:        secretSyncChan,
 		entities:              make(map[string]*ObjectEntity),
 		watchers:              map[string]*ObjectEntityWatcher{},
 		done:                  make(chan struct{}),
@@ -175,8 +187,76 @@ func (or *ObjectRegistry) run() {
 			}
 			or.applyConfig(config)
 			or.storeConfigInLocal(config)
+		case kvs := <-or.secretSyncChan:
+			if changed := or.changedSecrets(kvs); len(changed) > 0 {
+				or.refreshSecretReferences(changed)
+			}
+		}
+	}
+}
+
+// changedSecrets returns the names of the secrets which are created or
+// updated since the last sync, nothing is returned for the first sync.
+// Deleted secrets are ignored, as the objects referencing them can't be
+// recreated.
+func (or *ObjectRegistry) changedSecrets(kvs map[string]*mvccpb.KeyValue) []string {
+	prefix := or.super.Cluster().Layout().SecretPrefix()
+	revisions := make(map[string]int64, len(kvs))
+	for k, kv := range kvs {
+		revisions[strings.TrimPrefix(k, prefix)] = kv.ModRevision
+	}
+
+	first := or.secretRevisions == nil
+	old := or.secretRevisions
+	or.secretRevisions = revisions
+	if first {
+		return nil
+	}
+
+	var changed []string
+	for name, rev := range revisions {
+		if old[name] != rev {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// refreshSecretReferences recreates the object entities which reference
+// any of the secrets, so that the new secret values take effect.
+func (or *ObjectRegistry) refreshSecretReferences(secrets []string) {
+	or.mutex.Lock()
+	defer or.mutex.Unlock()
+
+	changed := make(map[string]bool, len(secrets))
+	for _, name := range secrets {
+		changed[name] = true
+	}
+
+	updated := make(map[string]*ObjectEntity)
+	for name, entity := range or.entities {
+		referenced := false
+		for _, s := range secret.ReferencedNames(entity.Spec().JSONConfig()) {
+			if changed[s] {
+				referenced = true
+				break
+			}
+		}
+		if !referenced {
+			continue
 		}
+
+		newEntity, err := or.super.NewObjectEntityFromSpec(entity.Spec())
+		if err != nil {
+			logger.Errorf("BUG: %s: %v", name, err)
+			continue
+		}
+		logger.Infof("refresh %s as its secrets are changed", name)
+		updated[name] = newEntity
+		or.entities[name] = newEntity
 	}
+
+	or.notifyWatchers(nil, nil, updated)
 }
 
 func (or *ObjectRegistry) applyConfig(config map[string]string) {
@@ -216,6 +296,11 @@ func (or *ObjectRegistry) applyConfig(config map[string]string) {
 		or.entities[name] = entity
 	}
 
+	or.notifyWatchers(deleted, created, updated)
+}
+
+// notifyWatchers must be called with the lock held.
+func (or *ObjectRegistry) notifyWatchers(deleted, created, updated map[string]*ObjectEntity) {
 	for _, watcher := range or.watchers {
 		func() {
 			watcher.mutex.Lock()
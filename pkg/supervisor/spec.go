@@ -45,6 +45,19 @@ type (
 		Kind    string `json:"kind" jsonschema:"required"`
 		Version string `json:"version" jsonschema:"required"`
 	}
+
+	// ObjectReference is a reference to another object, an empty kind
+	// matches objects of any kind.
+	ObjectReference struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	}
+
+	// Referrer is implemented by the object specs which reference other
+	// objects, e.g. an HTTPServer references its backend pipelines.
+	Referrer interface {
+		References() []*ObjectReference
+	}
 )
 
 func (s *Supervisor) newSpecInternal(meta *MetaSpec, objectSpec interface{}) *Spec {
@@ -139,6 +152,14 @@ func (s *Spec) Name() string { return s.meta.Name }
 // Kind returns kind.
 func (s *Spec) Kind() string { return s.meta.Kind }
 
+// Category returns the category of the kind.
+func (s *Spec) Category() ObjectCategory {
+	if o, ok := objectRegistry[s.meta.Kind]; ok {
+		return o.Category()
+	}
+	return CategoryAll
+}
+
 // Version returns version.
 func (s *Spec) Version() string { return s.meta.Version }
 
@@ -157,6 +178,14 @@ func (s *Spec) ObjectSpec() interface{} {
 	return s.objectSpec
 }
 
+// References returns the objects referenced by the spec.
+func (s *Spec) References() []*ObjectReference {
+	if r, ok := s.objectSpec.(Referrer); ok {
+		return r.References()
+	}
+	return nil
+}
+
 // Equals compares two Specs.
 func (s *Spec) Equals(other *Spec) bool {
 	return reflect.DeepEqual(s.RawSpec(), other.RawSpec())
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	// AttributeMethod is the context attribute of the request method.
+	AttributeMethod = "method"
+	// AttributePath is the context attribute of the request path.
+	AttributePath = "path"
+	// AttributePathTemplate is the context attribute of the path of the
+	// matched route, e.g. "/users/*" for a route with path prefix "/users/".
+	AttributePathTemplate = "pathTemplate"
+	// AttributeClientIP is the context attribute of the real client IP.
+	AttributeClientIP = "clientIP"
+	// AttributeUpstream is the context attribute of the address of the
+	// upstream server.
+	AttributeUpstream = "upstream"
+)
+
+var contextAttributes = map[string]struct{}{
+	AttributeMethod:       {},
+	AttributePath:         {},
+	AttributePathTemplate: {},
+	AttributeClientIP:     {},
+	AttributeUpstream:     {},
+}
+
+// spanAttributes tags spans with request data by the tracing spec.
+type spanAttributes struct {
+	// headers maps header names to tag keys.
+	headers map[string][]string
+	// context maps context attributes to tag keys.
+	context map[string][]string
+}
+
+func validateSpanAttributes(fromHeaders, fromContext map[string]string) error {
+	for tag, header := range fromHeaders {
+		if tag == "" || header == "" {
+			return fmt.Errorf("empty tag key or header name in attributeFromHeaders")
+		}
+	}
+	for tag, attr := range fromContext {
+		if tag == "" {
+			return fmt.Errorf("empty tag key in attributeFromContext")
+		}
+		if _, ok := contextAttributes[attr]; !ok {
+			return fmt.Errorf("unknown context attribute %s of tag %s", attr, tag)
+		}
+	}
+	return nil
+}
+
+// newSpanAttributes creates spanAttributes, it returns nil if there are no
+// attributes.
+func newSpanAttributes(fromHeaders, fromContext map[string]string) *spanAttributes {
+	if len(fromHeaders) == 0 && len(fromContext) == 0 {
+		return nil
+	}
+
+	sa := &spanAttributes{
+		headers: map[string][]string{},
+		context: map[string][]string{},
+	}
+	for tag, header := range fromHeaders {
+		header = http.CanonicalHeaderKey(header)
+		sa.headers[header] = append(sa.headers[header], tag)
+	}
+	for tag, attr := range fromContext {
+		sa.context[attr] = append(sa.context[attr], tag)
+	}
+
+	// sort the tag keys for a stable order of tagging.
+	for _, tags := range sa.headers {
+		sort.Strings(tags)
+	}
+	for _, tags := range sa.context {
+		sort.Strings(tags)
+	}
+	return sa
+}
+
+func (sa *spanAttributes) tagHeaders(s *span, h http.Header) {
+	for header, tags := range sa.headers {
+		values := h.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		v := strings.Join(values, ",")
+		for _, tag := range tags {
+			s.Tag(tag, v)
+		}
+	}
+}
+
+func (sa *spanAttributes) tagContext(s *span, attr, value string) {
+	for _, tag := range sa.context[attr] {
+		s.Tag(tag, value)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanAttributes(t *testing.T) {
+	assert := assert.New(t)
+
+	invalid := newTestSpec("http://localhost:9411/api/v2/spans")
+	invalid.AttributeFromContext = map[string]string{"route": "unknown"}
+	assert.Error(invalid.Validate())
+	invalid.AttributeFromContext = nil
+	invalid.AttributeFromHeaders = map[string]string{"tenant": ""}
+	assert.Error(invalid.Validate())
+
+	spec := newTestSpec("")
+	spec.AttributeFromHeaders = map[string]string{"tenant": "x-tenant-id", "agent": "User-Agent"}
+	spec.AttributeFromContext = map[string]string{
+		"http.method": AttributeMethod,
+		"method":      AttributeMethod,
+		"upstream":    AttributeUpstream,
+	}
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	h := http.Header{}
+	h.Add("X-Tenant-Id", "t1")
+	h.Add("X-Tenant-Id", "t2")
+
+	s := tracer.NewSpan("request")
+	s.TagFromHeaders(h)
+	s.TagFromContext(AttributeMethod, http.MethodGet)
+	s.TagFromContext(AttributePath, "/users")
+	s.Finish()
+
+	tags := reporter.Spans()[0].Tags
+	assert.Equal("t1,t2", tags["tenant"])
+	assert.NotContains(tags, "agent")
+	assert.Equal(http.MethodGet, tags["http.method"])
+	assert.Equal(http.MethodGet, tags["method"])
+	assert.NotContains(tags, "upstream")
+	assert.NotContains(tags, "path")
+
+	// noop spans and tracers without attributes do nothing.
+	NoopSpan.TagFromHeaders(h)
+	NoopSpan.TagFromContext(AttributeMethod, http.MethodGet)
+}
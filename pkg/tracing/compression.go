@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
+)
+
+// gzipDoer compresses the request body with gzip before sending it.
+type gzipDoer struct {
+	client zipkingohttp.HTTPDoer
+	level  int
+}
+
+func newGzipDoer(client zipkingohttp.HTTPDoer, level int) *gzipDoer {
+	// zero is the default value of the spec, it means the user did not
+	// choose a level, not gzip.NoCompression.
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return &gzipDoer{client: client, level: level}
+}
+
+func (gd *gzipDoer) compress(data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+
+	// level has been validated, so there's no error.
+	gw, _ := gzip.NewWriterLevel(buf, gd.level)
+	if _, err := gw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Do implements zipkingohttp.HTTPDoer.
+func (gd *gzipDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		return gd.client.Do(req)
+	}
+
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = gd.compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	return gd.client.Do(req)
+}
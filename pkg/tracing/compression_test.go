@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSpanPayload(n int) []byte {
+	spans := make([]*model.SpanModel, 0, n)
+	for i := 0; i < n; i++ {
+		spans = append(spans, &model.SpanModel{
+			SpanContext: model.SpanContext{
+				TraceID: model.TraceID{Low: uint64(i + 1)},
+				ID:      model.ID(i + 1),
+			},
+			Name:      fmt.Sprintf("span-%d", i),
+			Timestamp: time.Unix(1600000000, 0),
+			Duration:  time.Millisecond,
+			Tags:      map[string]string{"http.path": "/api/v1/orders", "component": "proxy"},
+		})
+	}
+	data, _ := zipkinreporter.JSONSerializer{}.Serialize(spans)
+	return data
+}
+
+func gzipLevel(data []byte, level int) []byte {
+	buf := bytes.Buffer{}
+	gw, _ := gzip.NewWriterLevel(&buf, level)
+	gw.Write(data)
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestGzipDoer(t *testing.T) {
+	assert := assert.New(t)
+
+	var received []byte
+	var encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	payload := testSpanPayload(100)
+
+	for _, level := range []int{gzip.BestSpeed, 5, gzip.BestCompression} {
+		doer := newGzipDoer(&http.Client{}, level)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(payload))
+		resp, err := doer.Do(req)
+		assert.NoError(err)
+		resp.Body.Close()
+
+		assert.Equal("gzip", encoding)
+		assert.Equal(gzipLevel(payload, level), received, "level %d", level)
+
+		gr, err := gzip.NewReader(bytes.NewReader(received))
+		assert.NoError(err)
+		data, _ := io.ReadAll(gr)
+		assert.Equal(payload, data)
+	}
+
+	// zero means the default level.
+	doer := newGzipDoer(&http.Client{}, 0)
+	assert.Equal(gzip.DefaultCompression, doer.level)
+	assert.NotEqual(gzipLevel(payload, gzip.BestSpeed), gzipLevel(payload, gzip.DefaultCompression))
+}
+
+func TestCompressionLevelValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ZipkinSpec{ServerURL: "http://127.0.0.1:9411", SampleRate: 1}
+	for _, level := range []int{-1, 0, 1, 9} {
+		spec.CompressionLevel = level
+		assert.NoError(spec.Validate())
+	}
+	for _, level := range []int{-2, 10} {
+		spec.CompressionLevel = level
+		assert.Error(spec.Validate())
+	}
+}
+
+func BenchmarkGzipLevels(b *testing.B) {
+	payload := testSpanPayload(500)
+
+	for _, level := range []int{gzip.BestSpeed, 3, gzip.DefaultCompression, 7, gzip.BestCompression} {
+		b.Run(fmt.Sprintf("level-%d", level), func(b *testing.B) {
+			doer := newGzipDoer(nil, level)
+			size := 0
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				data, _ := doer.compress(payload)
+				size = len(data)
+			}
+			b.ReportMetric(float64(size), "compressed-bytes")
+		})
+	}
+}
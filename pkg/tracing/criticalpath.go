@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+// tagCriticalPath is a trace complete hook, it tags the root span with the
+// duration of the critical path of the trace in milliseconds.
+func tagCriticalPath(spans []model.SpanModel, root *model.SpanModel) {
+	d := criticalPath(spans, root)
+	tags := make(map[string]string, len(root.Tags)+1)
+	for k, v := range root.Tags {
+		tags[k] = v
+	}
+	tags["critical_path_ms"] = strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	root.Tags = tags
+}
+
+// criticalPath returns the duration of the critical path starting from
+// root, that's the longest dependency chain from root to a leaf span,
+// where the length of a span in the chain is its self duration, i.e. the
+// part of its duration not covered by its children.
+func criticalPath(spans []model.SpanModel, root *model.SpanModel) time.Duration {
+	children := map[model.ID][]*model.SpanModel{}
+	for i := range spans {
+		if p := spans[i].ParentID; p != nil && spans[i].ID != root.ID {
+			children[*p] = append(children[*p], &spans[i])
+		}
+	}
+
+	var walk func(s *model.SpanModel, depth int) time.Duration
+	walk = func(s *model.SpanModel, depth int) time.Duration {
+		kids := children[s.ID]
+		// a malformed trace may contain cycles.
+		if depth > len(spans) {
+			return 0
+		}
+
+		var longest time.Duration
+		for _, kid := range kids {
+			if d := walk(kid, depth+1); d > longest {
+				longest = d
+			}
+		}
+		return selfDuration(s, kids) + longest
+	}
+
+	return walk(root, 0)
+}
+
+// selfDuration returns the part of the duration of s not covered by the
+// union of the durations of its children.
+func selfDuration(s *model.SpanModel, children []*model.SpanModel) time.Duration {
+	start, end := s.Timestamp, s.Timestamp.Add(s.Duration)
+
+	type interval struct{ start, end time.Time }
+	intervals := make([]interval, 0, len(children))
+	for _, c := range children {
+		cs, ce := c.Timestamp, c.Timestamp.Add(c.Duration)
+		if cs.Before(start) {
+			cs = start
+		}
+		if ce.After(end) {
+			ce = end
+		}
+		if ce.After(cs) {
+			intervals = append(intervals, interval{cs, ce})
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].start.Before(intervals[j].start)
+	})
+
+	var covered time.Duration
+	var curStart, curEnd time.Time
+	for i, iv := range intervals {
+		if i == 0 || iv.start.After(curEnd) {
+			covered += curEnd.Sub(curStart)
+			curStart, curEnd = iv.start, iv.end
+		} else if iv.end.After(curEnd) {
+			curEnd = iv.end
+		}
+	}
+	covered += curEnd.Sub(curStart)
+
+	return s.Duration - covered
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const redactedValue = "<redacted>"
+
+type (
+	debugInfo struct {
+		Noop           bool           `json:"noop"`
+		Config         *Spec          `json:"config,omitempty"`
+		Sampling       samplingStats  `json:"sampling"`
+		Reporter       *ReporterStats `json:"reporter,omitempty"`
+		BufferedTraces *int           `json:"bufferedTraces,omitempty"`
+	}
+
+	samplingStats struct {
+		Sampled    uint64 `json:"sampled"`
+		NotSampled uint64 `json:"notSampled"`
+	}
+)
+
+// DebugHandler returns an HTTP handler which renders the configuration and
+// the statistics of the tracer as JSON, it is designed to be mounted under
+// /debug/tracing. Sensitive fields in the configuration are redacted.
+func (t *Tracer) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := codectool.EncodeJSON(w, t.debugInfo()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func (t *Tracer) debugInfo() *debugInfo {
+	info := &debugInfo{
+		Noop: t.IsNoopTracer(),
+		Sampling: samplingStats{
+			Sampled:    atomic.LoadUint64(&t.sampledTraces),
+			NotSampled: atomic.LoadUint64(&t.notSampledTraces),
+		},
+	}
+
+	if t.spec != nil {
+		info.Config = redactSpec(t.spec)
+	}
+	if t.stats != nil {
+		stats := t.stats.Stats()
+		info.Reporter = &stats
+	}
+	if t.buffer != nil {
+		n := t.buffer.len()
+		info.BufferedTraces = &n
+	}
+
+	return info
+}
+
+func redactSpec(spec *Spec) *Spec {
+	result := *spec
+
+	result.Tags = redactMap(spec.Tags)
+
+	if spec.Zipkin != nil {
+		zipkin := *spec.Zipkin
+		zipkin.ServerURL = redactURL(zipkin.ServerURL)
+		result.Zipkin = &zipkin
+	}
+
+	if spec.OTLP != nil {
+		otlp := *spec.OTLP
+		otlp.Endpoint = redactURL(otlp.Endpoint)
+		otlp.Headers = redactMap(otlp.Headers)
+		result.OTLP = &otlp
+	}
+
+	if len(spec.BackendConfig) > 0 {
+		var cfg interface{}
+		if err := json.Unmarshal(spec.BackendConfig, &cfg); err != nil {
+			result.BackendConfig = json.RawMessage(`"` + redactedValue + `"`)
+		} else {
+			result.BackendConfig, _ = json.Marshal(redactValue(cfg))
+		}
+	}
+
+	return &result
+}
+
+// redactMap returns a copy of m with the values of sensitive keys redacted.
+func redactMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		if isSensitiveKey(k) {
+			v = redactedValue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// redactURL redacts the password and the sensitive query parameters of
+// rawURL.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		for k := range query {
+			if isSensitiveKey(k) {
+				query.Set(k, redactedValue)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.Redacted()
+}
+
+// redactValue redacts the values of sensitive keys in v recursively, v
+// is the result of unmarshaling JSON.
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			if isSensitiveKey(k) {
+				v[k] = redactedValue
+			} else {
+				v[k] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return v
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasSuffix(key, "key") {
+		return true
+	}
+	for _, s := range []string{"password", "passwd", "secret", "token", "credential", "auth"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
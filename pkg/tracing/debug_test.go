@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	mc := newMockCollector("")
+	defer mc.Close()
+
+	serverURL := strings.Replace(mc.URL, "http://", "http://admin:s3cret@", 1) + "/api/v2/spans?apiToken=t0ken&region=us"
+	spec := newTestSpec(serverURL)
+	spec.Zipkin.Encoding = EncodingJSON
+	spec.Tags = map[string]string{"env": "prod", "authHeader": "Bearer t0ken"}
+	spec.BackendConfig = json.RawMessage(`{"store": "s1", "tls": {"cert": "c", "key": "PRIVATE"}, "apiKey": "k"}`)
+	tracer, err := New(spec)
+	assert.NoError(err)
+
+	tracer.NewSpan("test").Finish()
+	tracer.NewSpan("test").Finish()
+	assert.NoError(tracer.Close())
+
+	w := httptest.NewRecorder()
+	tracer.DebugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/tracing", nil))
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	for _, secret := range []string{"s3cret", "t0ken", "PRIVATE", `"k"`} {
+		assert.NotContains(body, secret)
+	}
+
+	var info map[string]interface{}
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(false, info["noop"])
+
+	config := info["config"].(map[string]interface{})
+	assert.Equal("test", config["serviceName"])
+	assert.Equal(map[string]interface{}{"env": "prod", "authHeader": redactedValue}, config["tags"])
+	zipkin := config["zipkin"].(map[string]interface{})
+	assert.Contains(zipkin["serverURL"], "region=us")
+	assert.Contains(zipkin["serverURL"], "admin:")
+	backendConfig := config["backendConfig"].(map[string]interface{})
+	assert.Equal("s1", backendConfig["store"])
+	assert.Equal(redactedValue, backendConfig["apiKey"])
+	assert.Equal(map[string]interface{}{"cert": "c", "key": redactedValue}, backendConfig["tls"])
+
+	assert.Equal(map[string]interface{}{"sampled": 2.0, "notSampled": 0.0}, info["sampling"])
+
+	reporter := info["reporter"].(map[string]interface{})
+	assert.Equal(0.0, reporter["queueDepth"])
+	assert.Equal(2.0, reporter["sentSpans"])
+	assert.Equal(0.0, reporter["droppedSpans"])
+	lastExport := reporter["lastExport"].(map[string]interface{})
+	assert.Equal(2.0, lastExport["spans"])
+	assert.Equal(float64(http.StatusAccepted), lastExport["statusCode"])
+	assert.NotContains(lastExport, "error")
+	assert.NotContains(info, "bufferedTraces")
+
+	// the config of the tracer is not modified.
+	assert.Equal(serverURL, spec.Zipkin.ServerURL)
+	assert.Equal("Bearer t0ken", spec.Tags["authHeader"])
+
+	// noop tracer.
+	w = httptest.NewRecorder()
+	NoopTracer.DebugHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/tracing", nil))
+	info = nil
+	assert.NoError(json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(true, info["noop"])
+	assert.NotContains(info, "config")
+}
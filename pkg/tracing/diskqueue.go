@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// DefaultDiskBufferMaxBytes is the default max size of the disk buffer.
+const DefaultDiskBufferMaxBytes = 64 * 1024 * 1024
+
+type (
+	// diskQueue is a bounded FIFO queue of serialized span batches on disk,
+	// every batch is stored in a file named by its sequence number and the
+	// number of spans in it. When the total size exceeds maxBytes, the
+	// oldest batches are dropped.
+	diskQueue struct {
+		dir      string
+		ext      string
+		maxBytes int64
+
+		lock  sync.Mutex
+		files []diskQueueFile
+		size  int64
+		spans int
+		seq   uint64
+	}
+
+	diskQueueFile struct {
+		name  string
+		size  int64
+		spans int
+	}
+)
+
+// newDiskQueue creates a disk queue in dir, batches left by the previous
+// run are loaded. ext is the file extension of the batches, which should
+// be different for different serialization formats.
+func newDiskQueue(dir string, maxBytes int64, ext string) (*diskQueue, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultDiskBufferMaxBytes
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create disk buffer directory %s failed: %v", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read disk buffer directory %s failed: %v", dir, err)
+	}
+
+	q := &diskQueue{dir: dir, ext: ext, maxBytes: maxBytes}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ext {
+			continue
+		}
+
+		var seq uint64
+		var spans int
+		base := strings.TrimSuffix(entry.Name(), ext)
+		if _, err := fmt.Sscanf(base, "%d-%d", &seq, &spans); err != nil {
+			logger.Tracing.Warnf("ignore unknown file %s in disk buffer %s", entry.Name(), dir)
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		q.files = append(q.files, diskQueueFile{name: entry.Name(), size: info.Size(), spans: spans})
+		q.size += info.Size()
+		q.spans += spans
+		if seq >= q.seq {
+			q.seq = seq + 1
+		}
+	}
+
+	// file names are zero padded, so the alphabetical order is the order
+	// of the sequence numbers.
+	sort.Slice(q.files, func(i, j int) bool {
+		return q.files[i].name < q.files[j].name
+	})
+	q.trimLocked()
+
+	return q, nil
+}
+
+// push appends a batch to the queue, it returns the number of spans dropped
+// to enforce the size limit.
+func (q *diskQueue) push(body []byte, spans int) (int, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	name := fmt.Sprintf("%020d-%d%s", q.seq, spans, q.ext)
+	q.seq++
+
+	// write to a temporary file first, so a partially written batch is
+	// never replayed.
+	path := filepath.Join(q.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o640); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	q.files = append(q.files, diskQueueFile{name: name, size: int64(len(body)), spans: spans})
+	q.size += int64(len(body))
+	q.spans += spans
+
+	return q.trimLocked(), nil
+}
+
+// trimLocked drops the oldest batches until the size is not larger than
+// maxBytes, and returns the number of dropped spans.
+func (q *diskQueue) trimLocked() int {
+	dropped := 0
+	for q.size > q.maxBytes && len(q.files) > 0 {
+		dropped += q.files[0].spans
+		q.removeFirstLocked()
+	}
+	return dropped
+}
+
+func (q *diskQueue) removeFirstLocked() {
+	f := q.files[0]
+	if err := os.Remove(filepath.Join(q.dir, f.name)); err != nil && !os.IsNotExist(err) {
+		logger.Tracing.Warnf("remove %s from disk buffer %s failed: %v", f.name, q.dir, err)
+	}
+	q.files = q.files[1:]
+	q.size -= f.size
+	q.spans -= f.spans
+}
+
+// peek returns the oldest batch and the number of spans in it, ok is false
+// if the queue is empty.
+func (q *diskQueue) peek() (body []byte, spans int, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.files) > 0 {
+		f := q.files[0]
+		body, err := os.ReadFile(filepath.Join(q.dir, f.name))
+		if err == nil {
+			return body, f.spans, true
+		}
+		logger.Tracing.Warnf("read %s from disk buffer %s failed, drop it: %v", f.name, q.dir, err)
+		q.removeFirstLocked()
+	}
+
+	return nil, 0, false
+}
+
+// pop removes the oldest batch.
+func (q *diskQueue) pop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if len(q.files) > 0 {
+		q.removeFirstLocked()
+	}
+}
+
+// len returns the number of spans in the queue.
+func (q *diskQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.spans
+}
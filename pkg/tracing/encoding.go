@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	zipkinproto "github.com/openzipkin/zipkin-go/proto/zipkin_proto3"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const (
+	// EncodingJSON encodes spans in Zipkin v2 JSON.
+	EncodingJSON = "json"
+	// EncodingProto encodes spans in Zipkin v2 protobuf (proto3).
+	EncodingProto = "proto"
+	// EncodingAuto probes the collector for the encoding it supports.
+	EncodingAuto = "auto"
+
+	contentTypeJSON  = "application/json"
+	contentTypeProto = "application/x-protobuf"
+
+	probeTimeout = 3 * time.Second
+)
+
+// negotiatedEncodings caches the encoding negotiated with collectors, the key
+// is the server URL, so that reloading an object does not probe again.
+var negotiatedEncodings sync.Map
+
+// probeClient is the client used to probe collectors, it is a variable for
+// testing purpose.
+var probeClient = &http.Client{Timeout: probeTimeout}
+
+func newSerializer(encoding string) zipkinreporter.SpanSerializer {
+	if encoding == EncodingProto {
+		return zipkinproto.SpanSerializer{}
+	}
+	return zipkinreporter.JSONSerializer{}
+}
+
+// resolveEncoding returns the encoding to use for the collector at serverURL.
+func resolveEncoding(encoding, serverURL string) string {
+	if encoding != EncodingAuto {
+		if encoding == "" {
+			return EncodingJSON
+		}
+		return encoding
+	}
+
+	if v, ok := negotiatedEncodings.Load(serverURL); ok {
+		return v.(string)
+	}
+
+	encoding, err := probeEncoding(serverURL)
+	if err != nil {
+		logger.Tracing.Warnf("probe encoding of %s failed, fallback to %s: %v", serverURL, EncodingJSON, err)
+		return EncodingJSON
+	}
+
+	negotiatedEncodings.Store(serverURL, encoding)
+	return encoding
+}
+
+// probeEncoding sends an OPTIONS request to the collector and picks an
+// encoding from the content types it advertises in the Accept-Post or
+// Accept header. Protobuf is preferred for its smaller payload size.
+func probeEncoding(serverURL string) (string, error) {
+	req, err := http.NewRequest(http.MethodOptions, serverURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// Don't trace the probe, see the reporter for the same reason.
+	req.Header.Set("b3", "0")
+
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	accepted := map[string]bool{}
+	for _, key := range []string{"Accept-Post", "Accept"} {
+		for _, v := range resp.Header.Values(key) {
+			for _, ct := range strings.Split(v, ",") {
+				mt, _, err := mime.ParseMediaType(strings.TrimSpace(ct))
+				if err == nil {
+					accepted[mt] = true
+				}
+			}
+		}
+	}
+
+	switch {
+	case accepted[contentTypeProto]:
+		return EncodingProto, nil
+	case accepted[contentTypeJSON]:
+		return EncodingJSON, nil
+	}
+
+	// The collector responds but advertises nothing we know, JSON is
+	// supported by all Zipkin v2 collectors.
+	return EncodingJSON, nil
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+const maxEndpointRetryBackoff = 2 * time.Second
+
+var (
+	// fnNewEndpoint and endpointRetryBackoff are variables for testing.
+	fnNewEndpoint        = zipkingo.NewEndpoint
+	endpointRetryBackoff = 100 * time.Millisecond
+)
+
+// validateHostport checks the format of hostport like zipkingo.NewEndpoint
+// without resolving the host, the port is optional.
+func validateHostport(hostport string) error {
+	if strings.IndexByte(hostport, ':') < 0 {
+		hostport += ":0"
+	}
+	_, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return err
+	}
+	if _, err = strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port %s in hostport %s", port, hostport)
+	}
+	return nil
+}
+
+// newEndpoint creates the local endpoint of the tracer. If staticIP is not
+// empty, it replaces the host of hostport, so no DNS lookup is required.
+// Otherwise, the lookup is retried with exponential backoff for at most
+// retries times on resolution failures.
+func newEndpoint(serviceName, hostport, staticIP string, retries int) (*model.Endpoint, error) {
+	if staticIP != "" {
+		port := "0"
+		if hostport != "" {
+			if strings.IndexByte(hostport, ':') < 0 {
+				hostport += ":0"
+			}
+			_, p, err := net.SplitHostPort(hostport)
+			if err != nil {
+				return nil, err
+			}
+			port = p
+		}
+		hostport = net.JoinHostPort(staticIP, port)
+	}
+
+	backoff := endpointRetryBackoff
+	for i := 0; ; i++ {
+		endpoint, err := fnNewEndpoint(serviceName, hostport)
+		if err == nil {
+			return endpoint, nil
+		}
+
+		var dnsErr *net.DNSError
+		if i >= retries || !errors.As(err, &dnsErr) {
+			return nil, err
+		}
+
+		logger.Tracing.Warnf("resolve endpoint %s failed, retry in %v: %v", hostport, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxEndpointRetryBackoff {
+			backoff = maxEndpointRetryBackoff
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(backoff time.Duration) {
+		fnNewEndpoint = zipkingo.NewEndpoint
+		endpointRetryBackoff = backoff
+	}(endpointRetryBackoff)
+	endpointRetryBackoff = time.Millisecond
+
+	calls := 0
+	fnNewEndpoint = func(serviceName, hostport string) (*model.Endpoint, error) {
+		calls++
+		if calls < 3 {
+			return nil, fmt.Errorf("host lookup failure: %w", &net.DNSError{Err: "server misbehaving", Name: "tracing.local"})
+		}
+		return zipkingo.NewEndpoint(serviceName, "127.0.0.1:8080")
+	}
+
+	// success after retry.
+	spec := newTestSpec("")
+	spec.Zipkin.DisableReport = true
+	spec.Zipkin.Hostport = "tracing.local:8080"
+	spec.Zipkin.EndpointResolveRetries = 2
+	tracer, err := New(spec)
+	assert.NoError(err)
+	assert.Equal(3, calls)
+	tracer.Close()
+
+	// retries exhausted.
+	calls = 0
+	spec.Zipkin.EndpointResolveRetries = 1
+	_, err = New(spec)
+	assert.Error(err)
+	assert.Equal(2, calls)
+
+	// non-resolution errors are not retried.
+	calls = 0
+	fnNewEndpoint = func(serviceName, hostport string) (*model.Endpoint, error) {
+		calls++
+		return nil, fmt.Errorf("invalid port")
+	}
+	_, err = New(spec)
+	assert.Error(err)
+	assert.Equal(1, calls)
+
+	// static IP bypasses DNS.
+	fnNewEndpoint = zipkingo.NewEndpoint
+	endpoint, err := newEndpoint("test", "unresolvable.invalid:8080", "10.0.0.1", 0)
+	assert.NoError(err)
+	assert.Equal("10.0.0.1", endpoint.IPv4.String())
+	assert.Equal(uint16(8080), endpoint.Port)
+
+	endpoint, err = newEndpoint("test", "", "fe80::1", 0)
+	assert.NoError(err)
+	assert.Equal("fe80::1", endpoint.IPv6.String())
+	assert.Equal(uint16(0), endpoint.Port)
+
+	spec.Zipkin.StaticLocalIP = "not-an-ip"
+	assert.Error(spec.Zipkin.Validate())
+	spec.Zipkin.StaticLocalIP = "10.0.0.1"
+	spec.Zipkin.Hostport = "unresolvable.invalid:8080"
+	assert.NoError(spec.Zipkin.Validate())
+
+	// the validation doesn't resolve the host.
+	calls = 0
+	fnNewEndpoint = func(serviceName, hostport string) (*model.Endpoint, error) {
+		calls++
+		return nil, &net.DNSError{Err: "server misbehaving", Name: "tracing.local"}
+	}
+	spec.Zipkin.StaticLocalIP = ""
+	spec.Zipkin.Hostport = "tracing.local:8080"
+	spec.Zipkin.EndpointResolveRetries = 10
+	assert.NoError(spec.Zipkin.Validate())
+	spec.Zipkin.Hostport = "tracing.local"
+	assert.NoError(spec.Zipkin.Validate())
+	assert.Equal(0, calls)
+
+	spec.Zipkin.Hostport = "tracing.local:port"
+	assert.Error(spec.Zipkin.Validate())
+	spec.Zipkin.Hostport = "tracing.local:65536"
+	assert.Error(spec.Zipkin.Validate())
+}
@@ -0,0 +1,405 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+const (
+	// DefaultJaegerMaxPacketSize is the default max size of the UDP packets
+	// sent to the Jaeger agent.
+	DefaultJaegerMaxPacketSize = 65000
+
+	jaegerEmitBatch = "emitBatch"
+)
+
+// Types of the thrift compact protocol.
+const (
+	compactBoolTrue  = 0x01
+	compactBoolFalse = 0x02
+	compactI32       = 0x05
+	compactI64       = 0x06
+	compactBinary    = 0x08
+	compactList      = 0x09
+	compactStruct    = 0x0c
+
+	compactProtocolID   = 0x82
+	compactVersion      = 0x01
+	compactTypeOneway   = 0x04
+	compactTypeShiftAmt = 5
+)
+
+// Tag types and span reference types of jaeger.thrift.
+const (
+	jaegerTagString = 0
+	jaegerTagBool   = 2
+
+	jaegerRefChildOf = 0
+)
+
+type (
+	// JaegerSpec describes the reporter sending spans to a Jaeger agent
+	// over UDP in the compact thrift protocol.
+	JaegerSpec struct {
+		AgentHostPort string `json:"agentHostPort" jsonschema:"required"`
+		// MaxPacketSize is the max size of a UDP packet, spans are split
+		// into multiple packets if they are too large for one packet.
+		MaxPacketSize int    `json:"maxPacketSize" jsonschema:"omitempty,minimum=0,maximum=65507"`
+		BatchSize     int    `json:"batchSize" jsonschema:"omitempty,minimum=0"`
+		BatchInterval string `json:"batchInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// jaegerSerializer serializes spans to an emitBatch call of the
+	// Jaeger agent.
+	jaegerSerializer struct {
+		seq int32
+	}
+
+	// udpSender sends batches to a UDP address.
+	udpSender struct {
+		addr string
+		conn net.Conn
+	}
+
+	// compactWriter writes values in the thrift compact protocol.
+	compactWriter struct {
+		buf bytes.Buffer
+		// lastFields is the stack of the last field IDs of the structs
+		// being written, as field IDs are written as deltas.
+		lastFields []int16
+		lastField  int16
+	}
+)
+
+// Validate validates JaegerSpec.
+func (spec *JaegerSpec) Validate() error {
+	if _, _, err := net.SplitHostPort(spec.AgentHostPort); err != nil {
+		return fmt.Errorf("invalid agent host port %s: %v", spec.AgentHostPort, err)
+	}
+	_, err := spec.batchInterval()
+	return err
+}
+
+func (spec *JaegerSpec) batchInterval() (time.Duration, error) {
+	if spec.BatchInterval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(spec.BatchInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid batch interval %s: %v", spec.BatchInterval, err)
+	}
+	return d, nil
+}
+
+func newJaegerReporter(spec *JaegerSpec) (*batchReporter, error) {
+	interval, err := spec.batchInterval()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", spec.AgentHostPort)
+	if err != nil {
+		return nil, fmt.Errorf("dial jaeger agent %s failed: %v", spec.AgentHostPort, err)
+	}
+
+	maxPacketSize := spec.MaxPacketSize
+	if maxPacketSize <= 0 {
+		maxPacketSize = DefaultJaegerMaxPacketSize
+	}
+
+	sender := &udpSender{addr: spec.AgentHostPort, conn: conn}
+	return newBatchReporter(sender, &jaegerSerializer{}, maxPacketSize, nil,
+		withBatching(interval, spec.BatchSize)), nil
+}
+
+func (us *udpSender) send(ctx stdcontext.Context, body []byte, contentType string) (int, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		us.conn.SetWriteDeadline(deadline)
+	}
+	_, err := us.conn.Write(body)
+	return 0, err
+}
+
+func (us *udpSender) target() string {
+	return us.addr
+}
+
+func (us *udpSender) close() error {
+	return us.conn.Close()
+}
+
+// Serialize implements zipkinreporter.SpanSerializer.
+func (js *jaegerSerializer) Serialize(spans []*model.SpanModel) ([]byte, error) {
+	w := &compactWriter{}
+
+	// the message header of the oneway call.
+	w.buf.WriteByte(compactProtocolID)
+	w.buf.WriteByte(compactVersion | (compactTypeOneway << compactTypeShiftAmt))
+	w.writeVarint(uint64(uint32(atomic.AddInt32(&js.seq, 1))))
+	w.writeString(jaegerEmitBatch)
+
+	// emitBatch_args
+	w.structBegin()
+	w.fieldBegin(1, compactStruct)
+	writeJaegerBatch(w, spans)
+	w.structEnd()
+
+	return w.buf.Bytes(), nil
+}
+
+// ContentType implements zipkinreporter.SpanSerializer.
+func (js *jaegerSerializer) ContentType() string {
+	return "application/vnd.apache.thrift.compact"
+}
+
+func writeJaegerBatch(w *compactWriter, spans []*model.SpanModel) {
+	w.structBegin()
+
+	// process
+	w.fieldBegin(1, compactStruct)
+	w.structBegin()
+	var local *model.Endpoint
+	if len(spans) > 0 {
+		local = spans[0].LocalEndpoint
+	}
+	serviceName := ""
+	if local != nil {
+		serviceName = local.ServiceName
+	}
+	w.fieldBegin(1, compactBinary)
+	w.writeString(serviceName)
+	if local != nil && local.IPv4 != nil {
+		w.fieldBegin(2, compactList)
+		w.listBegin(compactStruct, 1)
+		writeJaegerStringTag(w, "ip", local.IPv4.String())
+	}
+	w.structEnd()
+
+	// spans
+	w.fieldBegin(2, compactList)
+	w.listBegin(compactStruct, len(spans))
+	for _, s := range spans {
+		writeJaegerSpan(w, s)
+	}
+
+	w.structEnd()
+}
+
+func writeJaegerSpan(w *compactWriter, s *model.SpanModel) {
+	w.structBegin()
+
+	w.fieldBegin(1, compactI64)
+	w.writeI64(int64(s.TraceID.Low))
+	w.fieldBegin(2, compactI64)
+	w.writeI64(int64(s.TraceID.High))
+	w.fieldBegin(3, compactI64)
+	w.writeI64(int64(s.ID))
+
+	var parentID int64
+	if s.ParentID != nil {
+		parentID = int64(*s.ParentID)
+	}
+	w.fieldBegin(4, compactI64)
+	w.writeI64(parentID)
+
+	w.fieldBegin(5, compactBinary)
+	w.writeString(s.Name)
+
+	if s.ParentID != nil {
+		w.fieldBegin(6, compactList)
+		w.listBegin(compactStruct, 1)
+		w.structBegin()
+		w.fieldBegin(1, compactI32)
+		w.writeI32(jaegerRefChildOf)
+		w.fieldBegin(2, compactI64)
+		w.writeI64(int64(s.TraceID.Low))
+		w.fieldBegin(3, compactI64)
+		w.writeI64(int64(s.TraceID.High))
+		w.fieldBegin(4, compactI64)
+		w.writeI64(parentID)
+		w.structEnd()
+	}
+
+	var flags int32
+	if s.Sampled != nil && *s.Sampled {
+		flags |= 0x01
+	}
+	if s.Debug {
+		flags |= 0x03
+	}
+	w.fieldBegin(7, compactI32)
+	w.writeI32(flags)
+
+	w.fieldBegin(8, compactI64)
+	w.writeI64(s.Timestamp.UnixNano() / int64(time.Microsecond))
+	w.fieldBegin(9, compactI64)
+	w.writeI64(int64(s.Duration / time.Microsecond))
+
+	writeJaegerTags(w, s)
+
+	if len(s.Annotations) > 0 {
+		w.fieldBegin(11, compactList)
+		w.listBegin(compactStruct, len(s.Annotations))
+		for _, a := range s.Annotations {
+			w.structBegin()
+			w.fieldBegin(1, compactI64)
+			w.writeI64(a.Timestamp.UnixNano() / int64(time.Microsecond))
+			w.fieldBegin(2, compactList)
+			w.listBegin(compactStruct, 1)
+			writeJaegerStringTag(w, "event", a.Value)
+			w.structEnd()
+		}
+	}
+
+	w.structEnd()
+}
+
+// writeJaegerTags writes the tags of s, besides the tags of the Zipkin span,
+// the span kind and the remote service name are converted to the tags of
+// OpenTracing conventions, and the error tag is converted to a boolean tag
+// with the error message in "error.message".
+func writeJaegerTags(w *compactWriter, s *model.SpanModel) {
+	keys := make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type tag struct {
+		key, value string
+		isBool     bool
+	}
+	tags := make([]tag, 0, len(keys)+3)
+	for _, k := range keys {
+		if k == TagError {
+			tags = append(tags, tag{key: TagError, isBool: true})
+			tags = append(tags, tag{key: "error.message", value: s.Tags[k]})
+			continue
+		}
+		tags = append(tags, tag{key: k, value: s.Tags[k]})
+	}
+	if s.Kind != model.Undetermined {
+		tags = append(tags, tag{key: "span.kind", value: strings.ToLower(string(s.Kind))})
+	}
+	if s.RemoteEndpoint != nil && s.RemoteEndpoint.ServiceName != "" {
+		tags = append(tags, tag{key: "peer.service", value: s.RemoteEndpoint.ServiceName})
+	}
+
+	if len(tags) == 0 {
+		return
+	}
+
+	w.fieldBegin(10, compactList)
+	w.listBegin(compactStruct, len(tags))
+	for _, t := range tags {
+		if t.isBool {
+			w.structBegin()
+			w.fieldBegin(1, compactBinary)
+			w.writeString(t.key)
+			w.fieldBegin(2, compactI32)
+			w.writeI32(jaegerTagBool)
+			w.fieldBool(5, true)
+			w.structEnd()
+		} else {
+			writeJaegerStringTag(w, t.key, t.value)
+		}
+	}
+}
+
+func writeJaegerStringTag(w *compactWriter, key, value string) {
+	w.structBegin()
+	w.fieldBegin(1, compactBinary)
+	w.writeString(key)
+	w.fieldBegin(2, compactI32)
+	w.writeI32(jaegerTagString)
+	w.fieldBegin(3, compactBinary)
+	w.writeString(value)
+	w.structEnd()
+}
+
+func (w *compactWriter) structBegin() {
+	w.lastFields = append(w.lastFields, w.lastField)
+	w.lastField = 0
+}
+
+func (w *compactWriter) structEnd() {
+	// field stop
+	w.buf.WriteByte(0)
+	n := len(w.lastFields) - 1
+	w.lastField = w.lastFields[n]
+	w.lastFields = w.lastFields[:n]
+}
+
+func (w *compactWriter) fieldBegin(id int16, typ byte) {
+	if delta := id - w.lastField; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.writeI32(int32(id))
+	}
+	w.lastField = id
+}
+
+// fieldBool writes a boolean field, whose value is encoded in the type of
+// the field header.
+func (w *compactWriter) fieldBool(id int16, v bool) {
+	typ := byte(compactBoolFalse)
+	if v {
+		typ = compactBoolTrue
+	}
+	w.fieldBegin(id, typ)
+}
+
+func (w *compactWriter) listBegin(elemType byte, size int) {
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	w.buf.WriteByte(0xf0 | elemType)
+	w.writeVarint(uint64(size))
+}
+
+func (w *compactWriter) writeVarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf.Write(b[:n])
+}
+
+func (w *compactWriter) writeI32(v int32) {
+	w.writeVarint(uint64(uint32((v << 1) ^ (v >> 31))))
+}
+
+func (w *compactWriter) writeI64(v int64) {
+	w.writeVarint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *compactWriter) writeString(s string) {
+	w.writeVarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
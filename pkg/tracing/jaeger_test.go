@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// compactReader decodes the thrift compact protocol into generic values,
+// structs are decoded to map[int16]interface{}, lists to []interface{}.
+type compactReader struct {
+	r *bytes.Reader
+}
+
+func (cr *compactReader) varint() uint64 {
+	v, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (cr *compactReader) zigzag() int64 {
+	v := cr.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (cr *compactReader) byte() byte {
+	b, err := cr.r.ReadByte()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (cr *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case compactBoolTrue:
+		return true
+	case compactBoolFalse:
+		return false
+	case compactI32, compactI64:
+		return cr.zigzag()
+	case compactBinary:
+		b := make([]byte, cr.varint())
+		cr.r.Read(b)
+		return string(b)
+	case compactList:
+		header := cr.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(cr.varint())
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = cr.value(header & 0x0f)
+		}
+		return list
+	case compactStruct:
+		result := map[int16]interface{}{}
+		var last int16
+		for {
+			header := cr.byte()
+			if header == 0 {
+				return result
+			}
+			id := last + int16(header>>4)
+			if header>>4 == 0 {
+				id = int16(cr.zigzag())
+			}
+			last = id
+			result[id] = cr.value(header & 0x0f)
+		}
+	}
+	panic(fmt.Errorf("unknown type %d", typ))
+}
+
+func decodeEmitBatch(data []byte) (name string, batch map[int16]interface{}) {
+	cr := &compactReader{r: bytes.NewReader(data)}
+	if cr.byte() != compactProtocolID {
+		panic("invalid protocol id")
+	}
+	cr.byte()
+	cr.varint()
+	name = cr.value(compactBinary).(string)
+	args := cr.value(compactStruct).(map[int16]interface{})
+	return name, args[1].(map[int16]interface{})
+}
+
+func jaegerTags(tags []interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, t := range tags {
+		tag := t.(map[int16]interface{})
+		if v, ok := tag[3]; ok {
+			result[tag[1].(string)] = v
+		} else {
+			result[tag[1].(string)] = tag[5]
+		}
+	}
+	return result
+}
+
+func TestJaegerSerializer(t *testing.T) {
+	assert := assert.New(t)
+
+	parent := model.ID(7)
+	sampled := true
+	start := time.Unix(100, 0)
+	body, err := (&jaegerSerializer{}).Serialize([]*model.SpanModel{{
+		SpanContext: model.SpanContext{
+			TraceID:  model.TraceID{High: 1, Low: 2},
+			ID:       8,
+			ParentID: &parent,
+			Sampled:  &sampled,
+		},
+		Name:          "get",
+		Kind:          model.Client,
+		Timestamp:     start,
+		Duration:      1500 * time.Microsecond,
+		LocalEndpoint: &model.Endpoint{ServiceName: "svc", IPv4: net.ParseIP("10.0.0.1")},
+		Tags:          map[string]string{TagError: "boom", "k": "v"},
+		Annotations:   []model.Annotation{{Timestamp: start, Value: "first_byte"}},
+	}})
+	assert.NoError(err)
+
+	name, batch := decodeEmitBatch(body)
+	assert.Equal(jaegerEmitBatch, name)
+
+	process := batch[1].(map[int16]interface{})
+	assert.Equal("svc", process[1])
+	assert.Equal("10.0.0.1", jaegerTags(process[2].([]interface{}))["ip"])
+
+	spans := batch[2].([]interface{})
+	assert.Len(spans, 1)
+	span := spans[0].(map[int16]interface{})
+	assert.Equal(int64(2), span[1])
+	assert.Equal(int64(1), span[2])
+	assert.Equal(int64(8), span[3])
+	assert.Equal(int64(7), span[4])
+	assert.Equal("get", span[5])
+	ref := span[6].([]interface{})[0].(map[int16]interface{})
+	assert.Equal(int64(jaegerRefChildOf), ref[1])
+	assert.Equal(int64(7), ref[4])
+	assert.Equal(int64(1), span[7])
+	assert.Equal(start.UnixNano()/1000, span[8])
+	assert.Equal(int64(1500), span[9])
+
+	tags := jaegerTags(span[10].([]interface{}))
+	assert.Equal(true, tags[TagError])
+	assert.Equal("boom", tags["error.message"])
+	assert.Equal("v", tags["k"])
+	assert.Equal("client", tags["span.kind"])
+
+	log := span[11].([]interface{})[0].(map[int16]interface{})
+	assert.Equal("first_byte", jaegerTags(log[2].([]interface{}))["event"])
+}
+
+func TestJaegerReporter(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer conn.Close()
+
+	spec := newTestSpec("")
+	spec.Backend = BackendJaeger
+	assert.Error(spec.Validate())
+	spec.Jaeger = &JaegerSpec{AgentHostPort: conn.LocalAddr().String(), MaxPacketSize: 1024}
+	assert.NoError(spec.Validate())
+
+	tracer, err := New(spec)
+	assert.NoError(err)
+	for i := 0; i < 10; i++ {
+		s := tracer.NewSpan(fmt.Sprintf("span-%d", i))
+		s.Tag("payload", strings.Repeat("x", 200))
+		s.Finish()
+	}
+	assert.NoError(tracer.Close())
+
+	// spans are split into multiple packets by the max packet size.
+	var names []string
+	buf := make([]byte, 65536)
+	for len(names) < 10 {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(err) {
+			break
+		}
+		assert.LessOrEqual(n, 1024)
+		_, batch := decodeEmitBatch(buf[:n])
+		assert.Equal("test", batch[1].(map[int16]interface{})[1])
+		for _, s := range batch[2].([]interface{}) {
+			names = append(names, s.(map[int16]interface{})[5].(string))
+		}
+	}
+	assert.Len(names, 10)
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// DefaultSlowTraceLabelLimit is the default max number of distinct trace IDs
+// kept in the slow request metric.
+const DefaultSlowTraceLabelLimit = 1000
+
+type (
+	// metricsCollector is the adapter exporting the metrics of a tracer to
+	// Prometheus, it implements prometheus.Collector.
+	metricsCollector struct {
+		collectors []prometheus.Collector
+	}
+
+	// registeredCollector is a collector registered to the default
+	// Prometheus registry for a server.
+	registeredCollector struct {
+		server     string
+		collector  prometheus.Collector
+		registerer prometheus.Registerer
+	}
+
+	// slowRequestCounter counts slow spans by trace ID. To bound the
+	// cardinality, at most limit trace IDs are kept, the least recently
+	// updated ones are evicted.
+	slowRequestCounter struct {
+		threshold time.Duration
+		desc      *prometheus.Desc
+
+		lock   sync.Mutex
+		counts *lru.Cache
+	}
+
+	// sloViolationCounter counts spans exceeding the latency budget of
+	// their operation, the operation of a span is its name.
+	sloViolationCounter struct {
+		budgets       map[string]time.Duration
+		defaultBudget time.Duration
+		counter       *prometheus.CounterVec
+	}
+)
+
+var (
+	// registeredCollectors are the collectors registered to the default
+	// Prometheus registry by the name of the server, at most one for each
+	// server, so that the metrics are not duplicated when the tracer of a
+	// server is replaced.
+	registeredCollectors     = map[string]*registeredCollector{}
+	registeredCollectorsLock sync.Mutex
+
+	_ prometheus.Collector = (*metricsCollector)(nil)
+
+	_ spanProcessor = (*slowRequestCounter)(nil)
+	_ spanProcessor = (*sloViolationCounter)(nil)
+)
+
+// registerCollector registers c to the default Prometheus registry with
+// the label "server", it replaces the collector registered for the server.
+func registerCollector(server string, c prometheus.Collector) *registeredCollector {
+	rc := &registeredCollector{
+		server:     server,
+		collector:  c,
+		registerer: prometheus.WrapRegistererWith(prometheus.Labels{"server": server}, prometheus.DefaultRegisterer),
+	}
+
+	registeredCollectorsLock.Lock()
+	defer registeredCollectorsLock.Unlock()
+
+	if prev := registeredCollectors[server]; prev != nil {
+		prev.registerer.Unregister(prev.collector)
+		delete(registeredCollectors, server)
+	}
+	if err := rc.registerer.Register(rc.collector); err != nil {
+		logger.Tracing.Errorf("register tracing metrics of %s failed: %v", server, err)
+		return nil
+	}
+	registeredCollectors[server] = rc
+	return rc
+}
+
+// unregisterCollector unregisters rc if it has not been replaced.
+func unregisterCollector(rc *registeredCollector) {
+	registeredCollectorsLock.Lock()
+	defer registeredCollectorsLock.Unlock()
+
+	if registeredCollectors[rc.server] == rc {
+		rc.registerer.Unregister(rc.collector)
+		delete(registeredCollectors, rc.server)
+	}
+}
+
+func newSlowRequestCounter(serviceName string, threshold time.Duration, limit int) *slowRequestCounter {
+	if limit <= 0 {
+		limit = DefaultSlowTraceLabelLimit
+	}
+
+	// limit is positive, so there's no error.
+	counts, _ := lru.New(limit)
+
+	return &slowRequestCounter{
+		threshold: threshold,
+		desc: prometheus.NewDesc(
+			"slow_request_total",
+			"The number of spans whose duration exceeds the slow threshold.",
+			[]string{"trace_id"},
+			prometheus.Labels{"service": serviceName},
+		),
+		counts: counts,
+	}
+}
+
+func (src *slowRequestCounter) process(s *span, d time.Duration) {
+	// slow requests are labeled by trace ID, which is useless if the trace
+	// is not sampled.
+	if s.isSampled() {
+		src.observe(s.Context().TraceID.String(), d)
+	}
+}
+
+// observe counts the span if its duration exceeds the threshold.
+func (src *slowRequestCounter) observe(traceID string, d time.Duration) {
+	if d <= src.threshold {
+		return
+	}
+
+	src.lock.Lock()
+	var count uint64
+	if v, ok := src.counts.Get(traceID); ok {
+		count = v.(uint64)
+	}
+	src.counts.Add(traceID, count+1)
+	src.lock.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (src *slowRequestCounter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- src.desc
+}
+
+// Collect implements prometheus.Collector.
+func (src *slowRequestCounter) Collect(ch chan<- prometheus.Metric) {
+	for _, key := range src.counts.Keys() {
+		v, ok := src.counts.Peek(key)
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(src.desc, prometheus.CounterValue,
+			float64(v.(uint64)), key.(string))
+	}
+}
+
+func newSLOViolationCounter(serviceName string, budgets map[string]time.Duration, defaultBudget time.Duration) *sloViolationCounter {
+	return &sloViolationCounter{
+		budgets:       budgets,
+		defaultBudget: defaultBudget,
+		counter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "slo_violations_total",
+			Help:        "The number of spans whose duration exceeds the latency budget of their operation.",
+			ConstLabels: prometheus.Labels{"service": serviceName},
+		}, []string{"operation"}),
+	}
+}
+
+func (svc *sloViolationCounter) process(s *span, d time.Duration) {
+	if svc.observe(s.name, d) {
+		s.Tag("slo.violated", "true")
+	}
+}
+
+// observe returns whether d exceeds the budget of the operation, and counts
+// the violation if it does. Operations without a budget use the default
+// budget, zero default budget means no budget.
+func (svc *sloViolationCounter) observe(operation string, d time.Duration) bool {
+	budget, ok := svc.budgets[operation]
+	if !ok {
+		budget = svc.defaultBudget
+	}
+	if budget <= 0 || d <= budget {
+		return false
+	}
+
+	svc.counter.WithLabelValues(operation).Inc()
+	return true
+}
+
+// Describe implements prometheus.Collector.
+func (svc *sloViolationCounter) Describe(ch chan<- *prometheus.Desc) {
+	svc.counter.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (svc *sloViolationCounter) Collect(ch chan<- prometheus.Metric) {
+	svc.counter.Collect(ch)
+}
+
+// Describe implements prometheus.Collector.
+func (mc *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range mc.collectors {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (mc *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range mc.collectors {
+		c.Collect(ch)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func collectMetrics(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric, 100)
+	c.Collect(ch)
+	close(ch)
+
+	var result []*dto.Metric
+	for m := range ch {
+		pb := &dto.Metric{}
+		m.Write(pb)
+		result = append(result, pb)
+	}
+	return result
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// gatherMetrics returns the metrics of the family name labeled with the
+// server in the default Prometheus registry, which is exposed by the API.
+func gatherMetrics(assert *assert.Assertions, name, server string) []*dto.Metric {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(err)
+
+	var result []*dto.Metric
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.Metric {
+			if labelValue(m, "server") == server {
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+func TestSlowTraceLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("http://127.0.0.1:9411/api/v2/spans")
+	spec.Zipkin.DisableReport = true
+	spec.SlowTraceLabelThreshold = "100ms"
+	spec.SlowTraceLabelLimit = 2
+	tracer, err := New(spec)
+	assert.NoError(err)
+
+	// below the threshold.
+	tracer.NewSpan("fast").Finish()
+	assert.Equal(0, testutil.CollectAndCount(tracer.Collector(), "slow_request_total"))
+
+	// above the threshold.
+	slow := tracer.NewSpanWithStart("slow", fasttime.Now().Add(-time.Second))
+	child := slow.NewChildWithStart("child", fasttime.Now().Add(-time.Second))
+	child.Finish()
+	slow.Finish()
+	// finish twice is counted once.
+	slow.Finish()
+
+	metrics := collectMetrics(tracer.Collector())
+	assert.Len(metrics, 1)
+	assert.Equal(slow.Context().TraceID.String(), labelValue(metrics[0], "trace_id"))
+	assert.Equal("test", labelValue(metrics[0], "service"))
+	assert.Equal(2.0, metrics[0].Counter.GetValue())
+
+	// the number of labels is capped, the oldest is evicted.
+	var traceIDs []string
+	for i := 0; i < 2; i++ {
+		s := tracer.NewSpanWithStart("slow", fasttime.Now().Add(-time.Second))
+		s.FinishedWithDuration(time.Second)
+		traceIDs = append(traceIDs, s.Context().TraceID.String())
+	}
+	metrics = collectMetrics(tracer.Collector())
+	assert.Len(metrics, 2)
+	for _, m := range metrics {
+		assert.Contains(traceIDs, labelValue(m, "trace_id"))
+	}
+
+	// noop tracer has no metrics.
+	assert.Equal(0, testutil.CollectAndCount(NoopTracer.Collector()))
+
+	// the counter is exposed by the default registry after registration.
+	tracer.RegisterMetrics("slow-server")
+	metrics = gatherMetrics(assert, "slow_request_total", "slow-server")
+	assert.Len(metrics, 2)
+	for _, m := range metrics {
+		assert.Contains(traceIDs, labelValue(m, "trace_id"))
+		assert.Equal("test", labelValue(m, "service"))
+	}
+	assert.NoError(tracer.Close())
+	assert.Empty(gatherMetrics(assert, "slow_request_total", "slow-server"))
+}
+
+func TestOperationBudgets(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.OperationBudgets = map[string]string{"checkout": "200ms", "search": "50ms"}
+	spec.DefaultOperationBudget = "1s"
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	finish := func(name string, d time.Duration) {
+		tracer.NewSpanWithStart(name, fasttime.Now().Add(-d)).FinishedWithDuration(d)
+	}
+
+	// per-operation budgets.
+	finish("checkout", 100*time.Millisecond)
+	finish("checkout", 300*time.Millisecond)
+	finish("search", 100*time.Millisecond)
+	finish("search", 60*time.Millisecond)
+	// the default budget.
+	finish("other", 500*time.Millisecond)
+	finish("other", 2*time.Second)
+
+	spans := reporter.Spans()
+	assert.Len(spans, 6)
+	var violated []bool
+	for _, s := range spans {
+		violated = append(violated, s.Tags["slo.violated"] == "true")
+	}
+	assert.Equal([]bool{false, true, true, true, false, true}, violated)
+
+	counts := map[string]float64{}
+	for _, m := range collectMetrics(tracer.Collector()) {
+		assert.Equal("test", labelValue(m, "service"))
+		counts[labelValue(m, "operation")] = m.Counter.GetValue()
+	}
+	assert.Equal(map[string]float64{"checkout": 1, "search": 2, "other": 1}, counts)
+
+	// the counter is exposed by the default registry after registration.
+	tracer.RegisterMetrics("slo-server")
+	counts = map[string]float64{}
+	for _, m := range gatherMetrics(assert, "slo_violations_total", "slo-server") {
+		counts[labelValue(m, "operation")] = m.Counter.GetValue()
+	}
+	assert.Equal(map[string]float64{"checkout": 1, "search": 2, "other": 1}, counts)
+
+	// invalid budget.
+	spec.OperationBudgets["bad"] = "fast"
+	assert.Error(spec.Validate())
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openzipkin/zipkin-go/model"
+	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// OTLPProtocolGRPC is the OTLP/gRPC protocol.
+	OTLPProtocolGRPC = "grpc"
+	// OTLPProtocolHTTP is the OTLP/HTTP protocol with protobuf payloads.
+	OTLPProtocolHTTP = "http"
+
+	otlpTracesPath       = "/v1/traces"
+	otlpExportMethod     = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	otlpInstrumentation  = "easegress"
+	otlpProtoContentType = "application/x-protobuf"
+)
+
+type (
+	// OTLPSpec describes the OpenTelemetry Protocol exporter.
+	OTLPSpec struct {
+		// Endpoint is host:port for gRPC, and host:port or a URL for HTTP,
+		// the path defaults to /v1/traces for HTTP.
+		Endpoint    string            `json:"endpoint" jsonschema:"required"`
+		Protocol    string            `json:"protocol" jsonschema:"omitempty,enum=,enum=grpc,enum=http"`
+		Insecure    bool              `json:"insecure" jsonschema:"omitempty"`
+		Headers     map[string]string `json:"headers" jsonschema:"omitempty"`
+		Compression string            `json:"compression" jsonschema:"omitempty,enum=,enum=none,enum=gzip"`
+	}
+
+	// otlpSerializer serializes spans to an OTLP export request.
+	otlpSerializer struct{}
+
+	// grpcSender sends batches to an OTLP/gRPC collector.
+	grpcSender struct {
+		endpoint string
+		conn     *grpc.ClientConn
+		headers  metadata.MD
+		opts     []grpc.CallOption
+	}
+
+	// rawCodec is a gRPC codec passing serialized messages through, so
+	// that batches serialized by otlpSerializer are sent as is.
+	rawCodec struct{}
+)
+
+// Validate validates OTLPSpec.
+func (spec *OTLPSpec) Validate() error {
+	if spec.protocol() == OTLPProtocolGRPC && strings.Contains(spec.Endpoint, "://") {
+		return fmt.Errorf("endpoint of OTLP/gRPC should be host:port, got %s", spec.Endpoint)
+	}
+	if spec.protocol() == OTLPProtocolHTTP {
+		if _, err := spec.url(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (spec *OTLPSpec) protocol() string {
+	if spec.Protocol == "" {
+		return OTLPProtocolGRPC
+	}
+	return spec.Protocol
+}
+
+// url returns the URL of the OTLP/HTTP collector.
+func (spec *OTLPSpec) url() (string, error) {
+	endpoint := spec.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https://"
+		if spec.Insecure {
+			scheme = "http://"
+		}
+		endpoint = scheme + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid OTLP endpoint %s: %v", spec.Endpoint, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid OTLP endpoint %s: empty host", spec.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpTracesPath
+	}
+	return u.String(), nil
+}
+
+func newOTLPReporter(spec *OTLPSpec) (*batchReporter, error) {
+	var sender batchSender
+	if spec.protocol() == OTLPProtocolHTTP {
+		u, err := spec.url()
+		if err != nil {
+			return nil, err
+		}
+		var client zipkingohttp.HTTPDoer = &http.Client{}
+		if spec.Compression == "gzip" {
+			client = newGzipDoer(client, 0)
+		}
+		sender = &httpSender{url: u, client: client, headers: spec.Headers}
+	} else {
+		s, err := newGRPCSender(spec)
+		if err != nil {
+			return nil, err
+		}
+		sender = s
+	}
+
+	return newBatchReporter(sender, otlpSerializer{}, 0, nil), nil
+}
+
+func newGRPCSender(spec *OTLPSpec) (*grpcSender, error) {
+	creds := insecure.NewCredentials()
+	if !spec.Insecure {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+
+	// grpc.Dial does not block, the connection is established lazily.
+	conn, err := grpc.Dial(spec.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("dial OTLP endpoint %s failed: %v", spec.Endpoint, err)
+	}
+
+	s := &grpcSender{
+		endpoint: spec.Endpoint,
+		conn:     conn,
+		headers:  metadata.New(spec.Headers),
+		opts:     []grpc.CallOption{grpc.ForceCodec(rawCodec{})},
+	}
+	if spec.Compression == "gzip" {
+		s.opts = append(s.opts, grpc.UseCompressor(grpcgzip.Name))
+	}
+	return s, nil
+}
+
+func (gs *grpcSender) send(ctx stdcontext.Context, body []byte, contentType string) (int, error) {
+	ctx = metadata.NewOutgoingContext(ctx, gs.headers)
+	var resp []byte
+	err := gs.conn.Invoke(ctx, otlpExportMethod, body, &resp, gs.opts...)
+	if err == nil {
+		return http.StatusOK, nil
+	}
+	return grpcCodeToHTTP(status.Code(err)), err
+}
+
+func (gs *grpcSender) target() string {
+	return gs.endpoint
+}
+
+func (gs *grpcSender) close() error {
+	return gs.conn.Close()
+}
+
+// grpcCodeToHTTP maps gRPC status codes to HTTP status codes, so that
+// the retry logic of batchReporter works for both protocols.
+func grpcCodeToHTTP(code codes.Code) int {
+	switch code {
+	case codes.Unavailable, codes.Aborted:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Marshal implements encoding.Codec.
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case proto.Message:
+		return proto.Marshal(v)
+	}
+	return nil, fmt.Errorf("unsupported message type %T", v)
+}
+
+// Unmarshal implements encoding.Codec.
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = append((*v)[:0], data...)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, v)
+	}
+	return fmt.Errorf("unsupported message type %T", v)
+}
+
+// Name implements encoding.Codec.
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// Serialize implements zipkinreporter.SpanSerializer.
+func (otlpSerializer) Serialize(spans []*model.SpanModel) ([]byte, error) {
+	return proto.Marshal(toOTLPRequest(spans))
+}
+
+// ContentType implements zipkinreporter.SpanSerializer.
+func (otlpSerializer) ContentType() string {
+	return otlpProtoContentType
+}
+
+// toOTLPRequest converts spans to an OTLP export request, spans are grouped
+// by the service name of their local endpoint.
+func toOTLPRequest(spans []*model.SpanModel) *collectortrace.ExportTraceServiceRequest {
+	req := &collectortrace.ExportTraceServiceRequest{}
+	byService := map[string]*otlptrace.InstrumentationLibrarySpans{}
+
+	for _, s := range spans {
+		service := ""
+		if s.LocalEndpoint != nil {
+			service = s.LocalEndpoint.ServiceName
+		}
+
+		ils := byService[service]
+		if ils == nil {
+			ils = &otlptrace.InstrumentationLibrarySpans{
+				InstrumentationLibrary: &otlpcommon.InstrumentationLibrary{Name: otlpInstrumentation},
+			}
+			byService[service] = ils
+			req.ResourceSpans = append(req.ResourceSpans, &otlptrace.ResourceSpans{
+				Resource: &otlpresource.Resource{
+					Attributes: []*otlpcommon.KeyValue{stringAttribute("service.name", service)},
+				},
+				InstrumentationLibrarySpans: []*otlptrace.InstrumentationLibrarySpans{ils},
+			})
+		}
+		ils.Spans = append(ils.Spans, toOTLPSpan(s))
+	}
+
+	return req
+}
+
+func toOTLPSpan(s *model.SpanModel) *otlptrace.Span {
+	span := &otlptrace.Span{
+		TraceId:           otlpTraceID(s.TraceID),
+		SpanId:            otlpSpanID(s.ID),
+		Name:              s.Name,
+		Kind:              otlpSpanKind(s.Kind),
+		StartTimeUnixNano: uint64(s.Timestamp.UnixNano()),
+		EndTimeUnixNano:   uint64(s.Timestamp.Add(s.Duration).UnixNano()),
+	}
+	if s.ParentID != nil {
+		span.ParentSpanId = otlpSpanID(*s.ParentID)
+	}
+
+	for k, v := range s.Tags {
+		span.Attributes = append(span.Attributes, stringAttribute(k, v))
+	}
+	if s.RemoteEndpoint != nil && s.RemoteEndpoint.ServiceName != "" {
+		span.Attributes = append(span.Attributes, stringAttribute("peer.service", s.RemoteEndpoint.ServiceName))
+	}
+
+	for _, a := range s.Annotations {
+		span.Events = append(span.Events, &otlptrace.Span_Event{
+			TimeUnixNano: uint64(a.Timestamp.UnixNano()),
+			Name:         a.Value,
+		})
+	}
+
+	if msg, ok := s.Tags[TagError]; ok {
+		span.Status = &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: msg}
+	}
+
+	return span
+}
+
+func otlpTraceID(id model.TraceID) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], id.High)
+	binary.BigEndian.PutUint64(b[8:], id.Low)
+	return b
+}
+
+func otlpSpanID(id model.ID) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+func otlpSpanKind(kind model.Kind) otlptrace.Span_SpanKind {
+	switch kind {
+	case model.Client:
+		return otlptrace.Span_SPAN_KIND_CLIENT
+	case model.Server:
+		return otlptrace.Span_SPAN_KIND_SERVER
+	case model.Producer:
+		return otlptrace.Span_SPAN_KIND_PRODUCER
+	case model.Consumer:
+		return otlptrace.Span_SPAN_KIND_CONSUMER
+	default:
+		return otlptrace.Span_SPAN_KIND_INTERNAL
+	}
+}
+
+func stringAttribute(key, value string) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{
+		Key:   key,
+		Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"compress/gzip"
+	stdcontext "context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/megaease/easegress/pkg/v"
+)
+
+type mockTraceService struct {
+	collectortrace.UnimplementedTraceServiceServer
+	lock     sync.Mutex
+	requests []*collectortrace.ExportTraceServiceRequest
+	headers  []string
+}
+
+func (s *mockTraceService) Export(ctx stdcontext.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.lock.Lock()
+	s.requests = append(s.requests, req)
+	s.headers = append(s.headers, md.Get("x-tenant")...)
+	s.lock.Unlock()
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func otlpSpans(requests []*collectortrace.ExportTraceServiceRequest) []*otlptrace.Span {
+	var spans []*otlptrace.Span
+	for _, req := range requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ils := range rs.InstrumentationLibrarySpans {
+				spans = append(spans, ils.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestToOTLPRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Unix(100, 0)
+	parent := model.ID(0x0102030405060708)
+	req := toOTLPRequest([]*model.SpanModel{
+		{
+			SpanContext: model.SpanContext{
+				TraceID:  model.TraceID{High: 1, Low: 2},
+				ID:       3,
+				ParentID: &parent,
+			},
+			Name:          "get",
+			Kind:          model.Server,
+			Timestamp:     start,
+			Duration:      time.Second,
+			LocalEndpoint: &model.Endpoint{ServiceName: "svc-a"},
+			Tags:          map[string]string{TagError: "boom"},
+			Annotations:   []model.Annotation{{Timestamp: start, Value: "first_byte"}},
+		},
+		{
+			SpanContext:   model.SpanContext{TraceID: model.TraceID{Low: 2}, ID: 4},
+			Name:          "put",
+			LocalEndpoint: &model.Endpoint{ServiceName: "svc-b"},
+		},
+	})
+
+	assert.Len(req.ResourceSpans, 2)
+	rs := req.ResourceSpans[0]
+	assert.Equal("service.name", rs.Resource.Attributes[0].Key)
+	assert.Equal("svc-a", rs.Resource.Attributes[0].Value.GetStringValue())
+	assert.Equal(otlpInstrumentation, rs.InstrumentationLibrarySpans[0].InstrumentationLibrary.Name)
+
+	span := rs.InstrumentationLibrarySpans[0].Spans[0]
+	assert.Equal([]byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}, span.TraceId)
+	assert.Equal([]byte{0, 0, 0, 0, 0, 0, 0, 3}, span.SpanId)
+	assert.Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}, span.ParentSpanId)
+	assert.Equal(otlptrace.Span_SPAN_KIND_SERVER, span.Kind)
+	assert.Equal(uint64(start.UnixNano()), span.StartTimeUnixNano)
+	assert.Equal(uint64(start.Add(time.Second).UnixNano()), span.EndTimeUnixNano)
+	assert.Equal(otlptrace.Status_STATUS_CODE_ERROR, span.Status.Code)
+	assert.Equal("boom", span.Status.Message)
+	assert.Equal("first_byte", span.Events[0].Name)
+
+	span = req.ResourceSpans[1].InstrumentationLibrarySpans[0].Spans[0]
+	assert.Equal(otlptrace.Span_SPAN_KIND_INTERNAL, span.Kind)
+	assert.Nil(span.ParentSpanId)
+	assert.Nil(span.Status)
+}
+
+func TestOTLPSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &OTLPSpec{Endpoint: "collector:4317"}
+	assert.NoError(spec.Validate())
+	spec.Endpoint = "http://collector:4317"
+	assert.Error(spec.Validate())
+
+	spec = &OTLPSpec{Endpoint: "collector:4318", Protocol: OTLPProtocolHTTP}
+	assert.NoError(spec.Validate())
+	u, _ := spec.url()
+	assert.Equal("https://collector:4318/v1/traces", u)
+	spec.Insecure = true
+	u, _ = spec.url()
+	assert.Equal("http://collector:4318/v1/traces", u)
+	spec.Endpoint = "https://collector/otlp/traces"
+	u, _ = spec.url()
+	assert.Equal("https://collector/otlp/traces", u)
+
+	tracingSpec := newTestSpec("")
+	tracingSpec.Backend = BackendOTLP
+	assert.Error(tracingSpec.Validate())
+	tracingSpec.OTLP = &OTLPSpec{Endpoint: "collector:4317"}
+	assert.NoError(tracingSpec.Validate())
+
+	// zipkin is only required by the zipkin backend.
+	tracingSpec.Zipkin = nil
+	vr := v.Validate(tracingSpec)
+	assert.True(vr.Valid(), vr.Error())
+	tracingSpec.Backend = BackendZipkin
+	assert.False(v.Validate(tracingSpec).Valid())
+}
+
+func TestOTLPHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	var requests []*collectortrace.ExportTraceServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(otlpTracesPath, r.URL.Path)
+		assert.Equal(otlpProtoContentType, r.Header.Get("Content-Type"))
+		assert.Equal("gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal("tenant-1", r.Header.Get("X-Tenant"))
+
+		zr, err := gzip.NewReader(r.Body)
+		assert.NoError(err)
+		body, _ := io.ReadAll(zr)
+		req := &collectortrace.ExportTraceServiceRequest{}
+		assert.NoError(proto.Unmarshal(body, req))
+
+		lock.Lock()
+		requests = append(requests, req)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	spec := &Spec{ServiceName: "test", Backend: BackendOTLP}
+	spec.OTLP = &OTLPSpec{
+		Endpoint:    server.Listener.Addr().String(),
+		Protocol:    OTLPProtocolHTTP,
+		Insecure:    true,
+		Headers:     map[string]string{"X-Tenant": "tenant-1"},
+		Compression: "gzip",
+	}
+	tracer, err := New(spec)
+	assert.NoError(err)
+	tracer.NewSpan("http-span").Finish()
+	assert.NoError(tracer.Close())
+
+	spans := otlpSpans(requests)
+	assert.Len(spans, 1)
+	assert.Equal("http-span", spans[0].Name)
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	svc := &mockTraceService{}
+	server := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(server, svc)
+	go server.Serve(l)
+	defer server.Stop()
+
+	mc := newMockCollector("")
+	defer mc.Close()
+
+	// spans are exported to both Zipkin and the OTLP collector.
+	spec := newTestSpec(mc.URL)
+	spec.OTLP = &OTLPSpec{
+		Endpoint:    l.Addr().String(),
+		Insecure:    true,
+		Headers:     map[string]string{"x-tenant": "tenant-1"},
+		Compression: "gzip",
+	}
+	tracer, err := New(spec)
+	assert.NoError(err)
+	tracer.NewSpan("grpc-span").Finish()
+	assert.NoError(tracer.Close())
+
+	spans := otlpSpans(svc.requests)
+	assert.Len(spans, 1)
+	assert.Equal("grpc-span", spans[0].Name)
+	assert.Equal([]string{"tenant-1"}, svc.headers)
+	assert.Len(mc.contentTypes, 1)
+}
+
+func TestOTLPGRPCUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	addr := l.Addr().String()
+	l.Close()
+
+	r, err := newOTLPReporter(&OTLPSpec{Endpoint: addr, Insecure: true})
+	assert.NoError(err)
+	r.timeout = 100 * time.Millisecond
+	stat, err := r.post([]byte{}, 1)
+	assert.Error(err)
+	assert.True(isRetryableExport(stat))
+	assert.NoError(r.Close())
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// spanProcessor is a step of the span processing pipeline of a tracer.
+	// The pipeline runs when a span finishes and before the sampling
+	// decision takes effect, that's, processors see all spans including
+	// unsampled ones, while only sampled spans are reported. So metrics
+	// extracted by processors cover all traffic.
+	spanProcessor interface {
+		process(s *span, d time.Duration)
+	}
+
+	// redMetrics is the span processor extracting the RED (rate, errors
+	// and duration) metrics of spans by operation, that's the span name.
+	redMetrics struct {
+		requests *prometheus.CounterVec
+		errors   *prometheus.CounterVec
+		duration *prometheus.HistogramVec
+	}
+)
+
+var _ spanProcessor = (*redMetrics)(nil)
+
+func newREDMetrics(serviceName string) *redMetrics {
+	labels := prometheus.Labels{"service": serviceName}
+	return &redMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "span_requests_total",
+			Help:        "The number of finished spans.",
+			ConstLabels: labels,
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "span_errors_total",
+			Help:        "The number of finished spans tagged as error.",
+			ConstLabels: labels,
+		}, []string{"operation"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "span_duration_seconds",
+			Help:        "The duration of finished spans.",
+			ConstLabels: labels,
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"operation"}),
+	}
+}
+
+func (rm *redMetrics) process(s *span, d time.Duration) {
+	rm.requests.WithLabelValues(s.name).Inc()
+	if s.isFailed() {
+		rm.errors.WithLabelValues(s.name).Inc()
+	}
+	rm.duration.WithLabelValues(s.name).Observe(d.Seconds())
+}
+
+// Describe implements prometheus.Collector.
+func (rm *redMetrics) Describe(ch chan<- *prometheus.Desc) {
+	rm.requests.Describe(ch)
+	rm.errors.Describe(ch)
+	rm.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (rm *redMetrics) Collect(ch chan<- prometheus.Metric) {
+	rm.requests.Collect(ch)
+	rm.errors.Collect(ch)
+	rm.duration.Collect(ch)
+}
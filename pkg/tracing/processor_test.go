@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func TestREDMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.Zipkin.SampleRate = 0
+	spec.REDMetrics = true
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	// unsampled traces.
+	for i := 0; i < 10; i++ {
+		root := tracer.NewSpan("request")
+		child := root.NewChild("backend")
+		if i%2 == 0 {
+			child.Tag(TagError, "connection refused")
+		}
+		child.Finish()
+		root.Finish()
+	}
+
+	// a sampled trace.
+	sampled := true
+	root := tracer.newSpanWithStart("request", fasttime.Now(), nil, &model.SpanContext{Sampled: &sampled})
+	root.NewChild("backend").Finish()
+	root.Finish()
+
+	// the reporter sees only the sampled spans.
+	assert.Len(reporter.Spans(), 2)
+
+	// metrics count all spans.
+	type red struct {
+		requests, errors float64
+		count            uint64
+	}
+	metrics := map[string]*red{}
+	get := func(op string) *red {
+		if metrics[op] == nil {
+			metrics[op] = &red{}
+		}
+		return metrics[op]
+	}
+
+	ch := make(chan prometheus.Metric, 100)
+	tracer.Collector().Collect(ch)
+	close(ch)
+	for m := range ch {
+		pb := &dto.Metric{}
+		assert.NoError(m.Write(pb))
+		assert.Equal("test", labelValue(pb, "service"))
+		r := get(labelValue(pb, "operation"))
+		switch name := m.Desc().String(); {
+		case strings.Contains(name, "span_requests_total"):
+			r.requests = pb.Counter.GetValue()
+		case strings.Contains(name, "span_errors_total"):
+			r.errors = pb.Counter.GetValue()
+		case strings.Contains(name, "span_duration_seconds"):
+			r.count = pb.Histogram.GetSampleCount()
+		}
+	}
+
+	assert.Equal(&red{requests: 11, errors: 0, count: 11}, metrics["request"])
+	assert.Equal(&red{requests: 11, errors: 5, count: 11}, metrics["backend"])
+}
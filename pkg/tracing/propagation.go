@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/openzipkin/zipkin-go/propagation/b3"
+)
+
+const (
+	// PropagationB3 is the B3 propagation format of Zipkin.
+	PropagationB3 = "b3"
+	// PropagationW3C is the W3C Trace Context propagation format, that's
+	// the traceparent and tracestate headers.
+	PropagationW3C = "w3c"
+	// PropagationJaeger is the propagation format of Jaeger, that's the
+	// uber-trace-id header.
+	PropagationJaeger = "jaeger"
+
+	headerTraceParent = "traceparent"
+	headerTraceState  = "tracestate"
+	headerUberTraceID = "uber-trace-id"
+)
+
+type (
+	// propagator extracts and injects span contexts in a propagation
+	// format. traceState is the vendor specific trace state of W3C Trace
+	// Context, other formats ignore it.
+	propagator interface {
+		extract(r *http.Request) (sc model.SpanContext, traceState string, ok bool)
+		inject(r *http.Request, sc model.SpanContext, traceState string)
+	}
+
+	b3Propagator     struct{}
+	w3cPropagator    struct{}
+	jaegerPropagator struct{}
+)
+
+// defaultPropagators are used if no propagation format is configured.
+var defaultPropagators = []propagator{b3Propagator{}}
+
+func newPropagators(formats []string) ([]propagator, error) {
+	if len(formats) == 0 {
+		return defaultPropagators, nil
+	}
+
+	propagators := make([]propagator, 0, len(formats))
+	seen := map[string]struct{}{}
+	for _, format := range formats {
+		if _, ok := seen[format]; ok {
+			return nil, fmt.Errorf("duplicated propagation format %s", format)
+		}
+		seen[format] = struct{}{}
+
+		switch format {
+		case PropagationB3:
+			propagators = append(propagators, b3Propagator{})
+		case PropagationW3C:
+			propagators = append(propagators, w3cPropagator{})
+		case PropagationJaeger:
+			propagators = append(propagators, jaegerPropagator{})
+		default:
+			return nil, fmt.Errorf("unknown propagation format %s", format)
+		}
+	}
+	return propagators, nil
+}
+
+func (b3Propagator) extract(r *http.Request) (model.SpanContext, string, bool) {
+	sc, err := b3.ExtractHTTP(r)()
+	if err != nil || sc == nil {
+		return model.SpanContext{}, "", false
+	}
+	return *sc, "", true
+}
+
+func (b3Propagator) inject(r *http.Request, sc model.SpanContext, traceState string) {
+	b3.InjectHTTP(r, b3.WithSingleHeaderOnly())(sc)
+}
+
+// extract extracts the traceparent header, which is
+// {version}-{trace-id}-{parent-id}-{trace-flags} in hex.
+func (w3cPropagator) extract(r *http.Request) (model.SpanContext, string, bool) {
+	fields := strings.Split(r.Header.Get(headerTraceParent), "-")
+	if len(fields) < 4 {
+		return model.SpanContext{}, "", false
+	}
+
+	version := fields[0]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(fields) != 4) {
+		return model.SpanContext{}, "", false
+	}
+	if _, err := strconv.ParseUint(version, 16, 8); err != nil {
+		return model.SpanContext{}, "", false
+	}
+
+	if len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 {
+		return model.SpanContext{}, "", false
+	}
+	traceID, err := model.TraceIDFromHex(fields[1])
+	if err != nil || traceID.Empty() {
+		return model.SpanContext{}, "", false
+	}
+	id, err := strconv.ParseUint(fields[2], 16, 64)
+	if err != nil || id == 0 {
+		return model.SpanContext{}, "", false
+	}
+	flags, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return model.SpanContext{}, "", false
+	}
+
+	sampled := flags&0x01 == 0x01
+	sc := model.SpanContext{TraceID: traceID, ID: model.ID(id), Sampled: &sampled}
+	return sc, strings.Join(r.Header.Values(headerTraceState), ","), true
+}
+
+func (w3cPropagator) inject(r *http.Request, sc model.SpanContext, traceState string) {
+	if sc.TraceID.Empty() || sc.ID == 0 {
+		return
+	}
+
+	flags := "00"
+	if sc.Debug || (sc.Sampled != nil && *sc.Sampled) {
+		flags = "01"
+	}
+
+	// W3C Trace Context requires 128 bits trace ID.
+	traceID := fmt.Sprintf("%016x%016x", sc.TraceID.High, sc.TraceID.Low)
+	r.Header.Set(headerTraceParent, fmt.Sprintf("00-%s-%016x-%s", traceID, uint64(sc.ID), flags))
+	if traceState != "" {
+		r.Header.Set(headerTraceState, traceState)
+	} else {
+		r.Header.Del(headerTraceState)
+	}
+}
+
+// extract extracts the uber-trace-id header, which is
+// {trace-id}:{span-id}:{parent-span-id}:{flags} in hex.
+func (jaegerPropagator) extract(r *http.Request) (model.SpanContext, string, bool) {
+	fields := strings.Split(r.Header.Get(headerUberTraceID), ":")
+	if len(fields) != 4 {
+		return model.SpanContext{}, "", false
+	}
+
+	if len(fields[0]) == 0 || len(fields[0]) > 32 {
+		return model.SpanContext{}, "", false
+	}
+	traceID, err := model.TraceIDFromHex(fields[0])
+	if err != nil || traceID.Empty() {
+		return model.SpanContext{}, "", false
+	}
+	id, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil || id == 0 {
+		return model.SpanContext{}, "", false
+	}
+	flags, err := strconv.ParseUint(fields[3], 16, 8)
+	if err != nil {
+		return model.SpanContext{}, "", false
+	}
+
+	sampled := flags&0x01 == 0x01
+	sc := model.SpanContext{
+		TraceID: traceID,
+		ID:      model.ID(id),
+		Debug:   flags&0x02 == 0x02,
+	}
+	if !sc.Debug {
+		sc.Sampled = &sampled
+	}
+	return sc, "", true
+}
+
+func (jaegerPropagator) inject(r *http.Request, sc model.SpanContext, traceState string) {
+	if sc.TraceID.Empty() || sc.ID == 0 {
+		return
+	}
+
+	flags := 0
+	if sc.Sampled != nil && *sc.Sampled {
+		flags |= 0x01
+	}
+	if sc.Debug {
+		flags |= 0x03
+	}
+
+	var parentID uint64
+	if sc.ParentID != nil {
+		parentID = uint64(*sc.ParentID)
+	}
+	r.Header.Set(headerUberTraceID, fmt.Sprintf("%s:%016x:%x:%x", sc.TraceID, uint64(sc.ID), parentID, flags))
+}
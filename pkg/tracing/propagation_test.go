@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func TestW3CPropagator(t *testing.T) {
+	assert := assert.New(t)
+
+	p := w3cPropagator{}
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	r.Header.Set(headerTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Add(headerTraceState, "congo=t61rcWkgMzE")
+	r.Header.Add(headerTraceState, "rojo=00f067aa0ba902b7")
+	sc, traceState, ok := p.extract(r)
+	assert.True(ok)
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal("00f067aa0ba902b7", sc.ID.String())
+	assert.True(*sc.Sampled)
+	assert.Equal("congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", traceState)
+
+	for _, tp := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+	} {
+		r.Header.Set(headerTraceParent, tp)
+		_, _, ok = p.extract(r)
+		assert.False(ok, tp)
+	}
+
+	// future versions may have more fields.
+	r.Header.Set(headerTraceParent, "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	sc, _, ok = p.extract(r)
+	assert.True(ok)
+	assert.False(*sc.Sampled)
+
+	out, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	sampled := true
+	p.inject(out, model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: 2, Sampled: &sampled}, "k=v")
+	assert.Equal("00-00000000000000000000000000000001-0000000000000002-01", out.Header.Get(headerTraceParent))
+	assert.Equal("k=v", out.Header.Get(headerTraceState))
+}
+
+func TestJaegerPropagator(t *testing.T) {
+	assert := assert.New(t)
+
+	p := jaegerPropagator{}
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+
+	r.Header.Set(headerUberTraceID, "abc:def:0:1")
+	sc, _, ok := p.extract(r)
+	assert.True(ok)
+	assert.Equal(model.TraceID{Low: 0xabc}, sc.TraceID)
+	assert.Equal(model.ID(0xdef), sc.ID)
+	assert.True(*sc.Sampled)
+
+	r.Header.Set(headerUberTraceID, "abc:def:0:3")
+	sc, _, ok = p.extract(r)
+	assert.True(ok)
+	assert.True(sc.Debug)
+
+	for _, id := range []string{"", "abc:def:0", "0:def:0:1", "abc:0:0:1", "abc:xyz:0:1"} {
+		r.Header.Set(headerUberTraceID, id)
+		_, _, ok = p.extract(r)
+		assert.False(ok, id)
+	}
+
+	out, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	parent := model.ID(3)
+	sampled := true
+	p.inject(out, model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: 2, ParentID: &parent, Sampled: &sampled}, "")
+	assert.Equal("0000000000000001:0000000000000002:3:1", out.Header.Get(headerUberTraceID))
+}
+
+func TestNewSpanFromHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.Propagation = []string{PropagationW3C, PropagationB3, PropagationJaeger}
+	invalid := newTestSpec("http://localhost:9411/api/v2/spans")
+	invalid.Propagation = []string{"unknown"}
+	assert.Error(invalid.Validate())
+	invalid.Propagation = []string{PropagationW3C, PropagationW3C}
+	assert.Error(invalid.Validate())
+	invalid.Propagation = []string{PropagationW3C}
+	assert.NoError(invalid.Validate())
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	r.Header.Set(headerTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set(headerTraceState, "congo=t61rcWkgMzE")
+	r.Header.Set("b3", "1-2-1")
+
+	// the first format found wins.
+	s := tracer.NewSpanFromHTTP("server", fasttime.Now(), r)
+	child := s.NewChild("client")
+	out, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	child.InjectHTTP(out)
+	child.Finish()
+	s.Finish()
+
+	assert.True(strings.HasPrefix(out.Header.Get(headerTraceParent), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+	assert.Equal("congo=t61rcWkgMzE", out.Header.Get(headerTraceState))
+	assert.True(strings.HasPrefix(out.Header.Get("b3"), "4bf92f3577b34da6a3ce929d0e0e4736-"))
+	assert.True(strings.HasPrefix(out.Header.Get(headerUberTraceID), "4bf92f3577b34da6a3ce929d0e0e4736:"))
+
+	spans := reporter.Spans()
+	assert.Len(spans, 2)
+	assert.Equal("00f067aa0ba902b7", spans[1].ParentID.String())
+
+	// a root span if there's no span context.
+	r.Header = http.Header{}
+	s = tracer.NewSpanFromHTTP("server", fasttime.Now(), r)
+	s.Finish()
+	assert.Nil(s.Context().ParentID)
+}
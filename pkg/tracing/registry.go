@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+)
+
+const (
+	// BackendZipkin is the name of the built-in Zipkin backend.
+	BackendZipkin = "zipkin"
+	// BackendOTLP is the name of the built-in OpenTelemetry backend.
+	BackendOTLP = "otlp"
+	// BackendJaeger is the name of the built-in Jaeger agent backend.
+	BackendJaeger = "jaeger"
+)
+
+// ReporterFactory creates a reporter from the backend config.
+type ReporterFactory func(cfg json.RawMessage) (zipkinreporter.Reporter, error)
+
+var (
+	reporterFactoriesLock sync.RWMutex
+	reporterFactories     = map[string]ReporterFactory{}
+)
+
+// RegisterReporter registers a reporter factory for a custom backend, so
+// that spans can be exported in a bespoke wire format by setting the
+// backend of the tracing spec to name. It panics if name is empty, is
+// the name of a built-in backend or has been registered.
+func RegisterReporter(name string, factory ReporterFactory) {
+	if name == "" || name == BackendZipkin || name == BackendOTLP || name == BackendJaeger {
+		panic(fmt.Errorf("invalid reporter name: %q", name))
+	}
+
+	reporterFactoriesLock.Lock()
+	defer reporterFactoriesLock.Unlock()
+
+	if _, ok := reporterFactories[name]; ok {
+		panic(fmt.Errorf("reporter %s has been registered", name))
+	}
+	reporterFactories[name] = factory
+}
+
+// UnregisterReporter unregisters a reporter factory, mainly for testing
+// purpose.
+func UnregisterReporter(name string) {
+	reporterFactoriesLock.Lock()
+	delete(reporterFactories, name)
+	reporterFactoriesLock.Unlock()
+}
+
+func getReporterFactory(name string) ReporterFactory {
+	reporterFactoriesLock.RLock()
+	defer reporterFactoriesLock.RUnlock()
+	return reporterFactories[name]
+}
+
+func isBuiltInBackend(name string) bool {
+	return name == "" || name == BackendZipkin || name == BackendOTLP || name == BackendJaeger
+}
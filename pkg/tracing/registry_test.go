@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// fakeReporter records the spans it receives.
+type fakeReporter struct {
+	lock   sync.Mutex
+	spans  []model.SpanModel
+	closed bool
+}
+
+func (fr *fakeReporter) Send(s model.SpanModel) {
+	fr.lock.Lock()
+	fr.spans = append(fr.spans, s)
+	fr.lock.Unlock()
+}
+
+func (fr *fakeReporter) Close() error {
+	fr.closed = true
+	return nil
+}
+
+func (fr *fakeReporter) Spans() []model.SpanModel {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	return append([]model.SpanModel(nil), fr.spans...)
+}
+
+func TestRegisterReporter(t *testing.T) {
+	assert := assert.New(t)
+
+	type fakeConfig struct {
+		Store string `json:"store"`
+	}
+
+	var reporter *fakeReporter
+	var config fakeConfig
+	RegisterReporter("fake", func(cfg json.RawMessage) (zipkinreporter.Reporter, error) {
+		config = fakeConfig{}
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+		if config.Store == "" {
+			return nil, fmt.Errorf("store is required")
+		}
+		reporter = &fakeReporter{}
+		return reporter, nil
+	})
+	defer UnregisterReporter("fake")
+
+	assert.Panics(func() { RegisterReporter("fake", nil) })
+	assert.Panics(func() { RegisterReporter(BackendZipkin, nil) })
+	assert.Panics(func() { RegisterReporter("", nil) })
+
+	const yamlConfig = `
+serviceName: test
+zipkin:
+  sampleRate: 1
+backend: fake
+backendConfig:
+  store: trace-store:9000
+`
+	spec := &Spec{}
+	assert.NoError(codectool.Unmarshal([]byte(yamlConfig), spec))
+	assert.NoError(spec.Validate())
+
+	tracer, err := New(spec)
+	assert.NoError(err)
+	assert.Equal("trace-store:9000", config.Store)
+
+	tracer.NewSpan("test").Finish()
+	assert.Len(reporter.Spans(), 1)
+	assert.Equal("test", reporter.Spans()[0].Name)
+	assert.NoError(tracer.Close())
+	assert.True(reporter.closed)
+
+	// the factory returns an error.
+	spec.BackendConfig = json.RawMessage(`{}`)
+	_, err = New(spec)
+	assert.Error(err)
+
+	// unregistered backend.
+	spec.Backend = "unknown"
+	assert.Error(spec.Validate())
+	_, err = New(spec)
+	assert.Error(err)
+
+	// the built-in backend requires serverURL.
+	spec.Backend = BackendZipkin
+	assert.Error(spec.Validate())
+	spec.Zipkin.ServerURL = "http://127.0.0.1:9411/api/v2/spans"
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,474 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	defaultReportTimeout       = 5 * time.Second
+	defaultReportBatchInterval = time.Second
+	defaultReportBatchSize     = 100
+	defaultReportMaxBacklog    = 1000
+
+	// maxReplayPerRound is the max number of batches replayed from the
+	// disk buffer in a round, so that new spans are not delayed too much.
+	maxReplayPerRound = 10
+)
+
+type (
+	// batchReporter serializes spans in batches and sends them to a
+	// collector by sender, it is similar to the HTTP reporter of
+	// zipkin-go, but keeps statistics of the reporting.
+	//
+	// If disk is not nil, spans overflowing the in-memory backlog and
+	// batches failed to export are spilled to disk, and replayed when the
+	// collector recovers.
+	batchReporter struct {
+		sender        batchSender
+		serializer    zipkinreporter.SpanSerializer
+		timeout       time.Duration
+		batchInterval time.Duration
+		batchSize     int
+		maxBacklog    int
+		// maxBatchBytes is the max serialized size of a batch, zero means
+		// no limit.
+		maxBatchBytes int
+		disk          *diskQueue
+
+		lock     sync.Mutex
+		batch    []*model.SpanModel
+		overflow []*model.SpanModel
+		stats    ReporterStats
+
+		sendC  chan struct{}
+		spillC chan struct{}
+		done   chan struct{}
+		wg     sync.WaitGroup
+	}
+
+	// ReporterStats is the statistics of a reporter.
+	ReporterStats struct {
+		QueueDepth        int         `json:"queueDepth"`
+		SentSpans         uint64      `json:"sentSpans"`
+		DroppedSpans      uint64      `json:"droppedSpans"`
+		SpilledSpans      uint64      `json:"spilledSpans,omitempty"`
+		DiskBufferedSpans int         `json:"diskBufferedSpans,omitempty"`
+		LastExport        *ExportStat `json:"lastExport,omitempty"`
+	}
+
+	// ExportStat is the status of an export.
+	ExportStat struct {
+		Time       time.Time `json:"time"`
+		Spans      int       `json:"spans"`
+		StatusCode int       `json:"statusCode,omitempty"`
+		Error      string    `json:"error,omitempty"`
+	}
+
+	// batchSender sends a serialized batch to a collector, it returns the
+	// HTTP status code of the response if there is a response, and an
+	// error if the batch is not accepted.
+	batchSender interface {
+		send(ctx stdcontext.Context, body []byte, contentType string) (int, error)
+		// target returns the address of the collector for logging.
+		target() string
+	}
+
+	// httpSender sends batches to an HTTP collector.
+	httpSender struct {
+		url     string
+		client  zipkingohttp.HTTPDoer
+		headers map[string]string
+	}
+
+	// statsReporter is a reporter with statistics.
+	statsReporter interface {
+		zipkinreporter.Reporter
+		Stats() ReporterStats
+	}
+
+	// batchReporterOption is the option of batchReporter.
+	batchReporterOption func(r *batchReporter)
+
+	// multiReporter sends spans to all of its reporters.
+	multiReporter []zipkinreporter.Reporter
+)
+
+// newHTTPReporter creates a reporter sending spans to a Zipkin HTTP
+// collector.
+func newHTTPReporter(url string, serializer zipkinreporter.SpanSerializer, client zipkingohttp.HTTPDoer,
+	maxBatchBytes int, disk *diskQueue) *batchReporter {
+	return newBatchReporter(&httpSender{url: url, client: client}, serializer, maxBatchBytes, disk)
+}
+
+func newBatchReporter(sender batchSender, serializer zipkinreporter.SpanSerializer,
+	maxBatchBytes int, disk *diskQueue, opts ...batchReporterOption) *batchReporter {
+	r := &batchReporter{
+		sender:        sender,
+		serializer:    serializer,
+		timeout:       defaultReportTimeout,
+		batchInterval: defaultReportBatchInterval,
+		batchSize:     defaultReportBatchSize,
+		maxBacklog:    defaultReportMaxBacklog,
+		maxBatchBytes: maxBatchBytes,
+		disk:          disk,
+		sendC:         make(chan struct{}, 1),
+		spillC:        make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	r.wg.Add(1)
+	go r.run()
+
+	if disk != nil {
+		r.wg.Add(1)
+		go r.runSpill()
+	}
+
+	return r
+}
+
+// withBatching sets the batch interval and the batch size, zero values
+// keep the defaults.
+func withBatching(interval time.Duration, size int) batchReporterOption {
+	return func(r *batchReporter) {
+		if interval > 0 {
+			r.batchInterval = interval
+		}
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+func (r *batchReporter) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			r.sendBatch()
+			return
+		case <-ticker.C:
+			r.sendBatch()
+			r.replay()
+		case <-r.sendC:
+			r.sendBatch()
+		}
+	}
+}
+
+func (r *batchReporter) runSpill() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.done:
+			r.spillOverflow()
+			return
+		case <-r.spillC:
+			r.spillOverflow()
+		}
+	}
+}
+
+// Send implements zipkinreporter.Reporter. If there are too many spans
+// waiting to be sent, the oldest spans are spilled to the disk buffer, or
+// dropped if there's no disk buffer.
+func (r *batchReporter) Send(s model.SpanModel) {
+	r.lock.Lock()
+	r.batch = append(r.batch, &s)
+	spill := false
+	if n := len(r.batch) - r.maxBacklog; n > 0 {
+		if r.disk == nil {
+			r.stats.DroppedSpans += uint64(n)
+		} else {
+			r.overflow = append(r.overflow, r.batch[:n]...)
+			if m := len(r.overflow) - r.maxBacklog; m > 0 {
+				r.overflow = r.overflow[m:]
+				r.stats.DroppedSpans += uint64(m)
+			}
+			spill = true
+		}
+		r.batch = r.batch[n:]
+	}
+	full := len(r.batch) >= r.batchSize
+	r.lock.Unlock()
+
+	if full {
+		select {
+		case r.sendC <- struct{}{}:
+		default:
+		}
+	}
+	if spill {
+		select {
+		case r.spillC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *batchReporter) sendBatch() {
+	r.lock.Lock()
+	batch := r.batch
+	r.batch = nil
+	r.lock.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	r.serialize(batch, r.export)
+}
+
+func (r *batchReporter) spillOverflow() {
+	r.lock.Lock()
+	batch := r.overflow
+	r.overflow = nil
+	r.lock.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	r.serialize(batch, r.spill)
+}
+
+// serialize serializes batch and calls fn with the result. If the
+// serialized batch is larger than maxBatchBytes, it is split into smaller
+// sub-batches, and a single span larger than maxBatchBytes is dropped.
+func (r *batchReporter) serialize(batch []*model.SpanModel, fn func(body []byte, spans int)) {
+	body, err := r.serializer.Serialize(batch)
+	if err != nil {
+		logger.Tracing.Errorf("serialize %d spans failed: %v", len(batch), err)
+		r.addDropped(len(batch))
+		return
+	}
+
+	if r.maxBatchBytes <= 0 || len(body) <= r.maxBatchBytes {
+		fn(body, len(batch))
+		return
+	}
+
+	if len(batch) > 1 {
+		mid := len(batch) / 2
+		r.serialize(batch[:mid], fn)
+		r.serialize(batch[mid:], fn)
+		return
+	}
+
+	logger.Tracing.Warnf("span %s of trace %s is dropped, its size %d bytes exceeds the max batch size %d bytes",
+		batch[0].ID, batch[0].TraceID, len(body), r.maxBatchBytes)
+	r.addDropped(1)
+}
+
+// export sends a serialized batch to the collector, the batch is spilled to
+// the disk buffer if the failure is recoverable.
+func (r *batchReporter) export(body []byte, spans int) {
+	stat, err := r.post(body, spans)
+	if err == nil {
+		return
+	}
+
+	logger.Tracing.Warnf("report %d spans to %s failed: %v", spans, r.sender.target(), err)
+	if r.disk != nil && isRetryableExport(stat) {
+		r.spill(body, spans)
+	} else {
+		r.addDropped(spans)
+	}
+}
+
+// replay sends the batches in the disk buffer to the collector, it stops
+// at the first failure.
+func (r *batchReporter) replay() {
+	if r.disk == nil {
+		return
+	}
+
+	for i := 0; i < maxReplayPerRound; i++ {
+		body, spans, ok := r.disk.peek()
+		if !ok {
+			return
+		}
+
+		stat, err := r.post(body, spans)
+		if err != nil && isRetryableExport(stat) {
+			return
+		}
+		if err != nil {
+			logger.Tracing.Warnf("replay %d spans to %s failed, drop them: %v", spans, r.sender.target(), err)
+			r.addDropped(spans)
+		}
+		r.disk.pop()
+	}
+}
+
+func (r *batchReporter) spill(body []byte, spans int) {
+	dropped, err := r.disk.push(body, spans)
+	if err != nil {
+		logger.Tracing.Errorf("spill %d spans to disk buffer failed: %v", spans, err)
+		r.addDropped(spans)
+		return
+	}
+
+	r.lock.Lock()
+	r.stats.SpilledSpans += uint64(spans)
+	r.stats.DroppedSpans += uint64(dropped)
+	r.lock.Unlock()
+}
+
+func (r *batchReporter) addDropped(n int) {
+	r.lock.Lock()
+	r.stats.DroppedSpans += uint64(n)
+	r.lock.Unlock()
+}
+
+// isRetryableExport returns whether a failed export may succeed later,
+// that's a transport error, a server error or being throttled.
+func isRetryableExport(stat *ExportStat) bool {
+	code := stat.StatusCode
+	return code == 0 || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// post posts a serialized batch to the collector and records the result.
+func (r *batchReporter) post(body []byte, spans int) (*ExportStat, error) {
+	stat := &ExportStat{Time: fasttime.Now(), Spans: spans}
+	err := r.doPost(body, stat)
+	if err != nil {
+		stat.Error = err.Error()
+	}
+
+	r.lock.Lock()
+	r.stats.LastExport = stat
+	if err == nil {
+		r.stats.SentSpans += uint64(spans)
+	}
+	r.lock.Unlock()
+
+	return stat, err
+}
+
+func (r *batchReporter) doPost(body []byte, stat *ExportStat) error {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), r.timeout)
+	defer cancel()
+
+	code, err := r.sender.send(ctx, body, r.serializer.ContentType())
+	stat.StatusCode = code
+	return err
+}
+
+func (hs *httpSender) send(ctx stdcontext.Context, body []byte, contentType string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hs.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range hs.headers {
+		req.Header.Set(k, v)
+	}
+	// b3: 0 prevents the sidecar proxies from tracing the reporting.
+	req.Header.Set("b3", "0")
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (hs *httpSender) target() string {
+	return hs.url
+}
+
+// Stats returns the statistics of the reporter.
+func (r *batchReporter) Stats() ReporterStats {
+	r.lock.Lock()
+	stats := r.stats
+	stats.QueueDepth = len(r.batch) + len(r.overflow)
+	if stats.LastExport != nil {
+		last := *stats.LastExport
+		stats.LastExport = &last
+	}
+	r.lock.Unlock()
+
+	if r.disk != nil {
+		stats.DiskBufferedSpans = r.disk.len()
+	}
+	return stats
+}
+
+// Close implements zipkinreporter.Reporter, it sends the remaining spans
+// before returning, the spans in the disk buffer are kept for the next
+// run.
+func (r *batchReporter) Close() error {
+	close(r.done)
+	r.wg.Wait()
+	if c, ok := r.sender.(interface{ close() error }); ok {
+		return c.close()
+	}
+	return nil
+}
+
+func newMultiReporter(reporters ...zipkinreporter.Reporter) multiReporter {
+	return multiReporter(reporters)
+}
+
+// Send implements zipkinreporter.Reporter.
+func (mr multiReporter) Send(s model.SpanModel) {
+	for _, r := range mr {
+		r.Send(s)
+	}
+}
+
+// Close implements zipkinreporter.Reporter.
+func (mr multiReporter) Close() error {
+	var result error
+	for _, r := range mr {
+		if err := r.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
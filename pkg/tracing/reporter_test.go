@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxBatchBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	const maxBatchBytes = 2048
+
+	var lock sync.Mutex
+	var batches [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) > maxBatchBytes {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var spans []model.SpanModel
+		assert.NoError(json.Unmarshal(body, &spans))
+		var names []string
+		for _, s := range spans {
+			names = append(names, s.Name)
+		}
+		lock.Lock()
+		batches = append(batches, names)
+		lock.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	newSpan := func(name string, payloadSize int) model.SpanModel {
+		return model.SpanModel{
+			SpanContext: model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: model.ID(len(name))},
+			Name:        name,
+			Tags:        map[string]string{"payload": strings.Repeat("x", payloadSize)},
+		}
+	}
+
+	r := newHTTPReporter(server.URL, zipkinreporter.JSONSerializer{}, &http.Client{}, maxBatchBytes, nil)
+	names := []string{"a", "bb", "ccc", "dddd", "eeeee", "ffffff"}
+	for i, name := range names {
+		r.Send(newSpan(name, 500))
+		if i == 2 {
+			// a single span exceeding the limit.
+			r.Send(newSpan("oversized", maxBatchBytes))
+		}
+	}
+	assert.NoError(r.Close())
+
+	// the batch is split instead of being rejected.
+	assert.Greater(len(batches), 1)
+	var sent []string
+	for _, b := range batches {
+		sent = append(sent, b...)
+	}
+	assert.Equal(names, sent)
+
+	stats := r.Stats()
+	assert.Equal(uint64(len(names)), stats.SentSpans)
+	assert.Equal(uint64(1), stats.DroppedSpans)
+	assert.Equal(http.StatusAccepted, stats.LastExport.StatusCode)
+}
+
+func TestDiskBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	down := true
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var spans []model.SpanModel
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(json.Unmarshal(body, &spans))
+		for _, s := range spans {
+			received = append(received, s.Name)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	newSpan := func(i int) model.SpanModel {
+		return model.SpanModel{
+			SpanContext: model.SpanContext{TraceID: model.TraceID{Low: 1}, ID: model.ID(i + 1)},
+			Name:        fmt.Sprintf("span-%d", i),
+		}
+	}
+
+	dir := t.TempDir()
+	disk, err := newDiskQueue(dir, 0, ".json")
+	assert.NoError(err)
+	r := newHTTPReporter(server.URL, zipkinreporter.JSONSerializer{}, &http.Client{}, 0, disk)
+	r.maxBacklog = 3
+
+	// spill on outage: the failed batch and the overflowed spans.
+	var names []string
+	for i := 0; i < 5; i++ {
+		r.Send(newSpan(i))
+		names = append(names, fmt.Sprintf("span-%d", i))
+	}
+	assert.Eventually(func() bool { return disk.len() == 2 }, time.Second, 10*time.Millisecond)
+	r.sendBatch()
+	assert.Equal(5, disk.len())
+
+	stats := r.Stats()
+	assert.Equal(uint64(5), stats.SpilledSpans)
+	assert.Equal(5, stats.DiskBufferedSpans)
+	assert.Equal(uint64(0), stats.DroppedSpans)
+	assert.Equal(http.StatusServiceUnavailable, stats.LastExport.StatusCode)
+
+	// replay fails while the collector is down.
+	r.replay()
+	assert.Equal(5, disk.len())
+	assert.Empty(received)
+
+	// replay on recovery.
+	lock.Lock()
+	down = false
+	lock.Unlock()
+	r.replay()
+	assert.Equal(0, disk.len())
+	assert.ElementsMatch(names, received)
+	assert.Equal(uint64(5), r.Stats().SentSpans)
+	assert.NoError(r.Close())
+}
+
+func TestDiskQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	q, err := newDiskQueue(dir, 25, ".json")
+	assert.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		dropped, err := q.push([]byte(fmt.Sprintf("batch-%d", i)), i+1)
+		assert.NoError(err)
+		assert.Equal(0, dropped)
+	}
+	assert.Equal(6, q.len())
+
+	// the size cap is enforced, the oldest batch is dropped.
+	dropped, err := q.push([]byte("batch-3"), 4)
+	assert.NoError(err)
+	assert.Equal(1, dropped)
+	assert.Equal(9, q.len())
+
+	// batches are loaded on restart, other files are ignored.
+	assert.NoError(os.WriteFile(filepath.Join(dir, "unknown.proto"), []byte("x"), 0o640))
+	q, err = newDiskQueue(dir, 25, ".json")
+	assert.NoError(err)
+	assert.Equal(9, q.len())
+
+	var batches []string
+	for {
+		body, _, ok := q.peek()
+		if !ok {
+			break
+		}
+		batches = append(batches, string(body))
+		q.pop()
+	}
+	assert.Equal([]string{"batch-1", "batch-2", "batch-3"}, batches)
+	assert.Equal(0, q.len())
+
+	// new batches are after the loaded ones.
+	_, err = q.push([]byte("batch-4"), 1)
+	assert.NoError(err)
+	entries, _ := os.ReadDir(dir)
+	assert.Len(entries, 2)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// samplingFeedbackLimit is the max number of keys in the feedback
+	// table, the least recently used keys are evicted.
+	samplingFeedbackLimit = 1000
+
+	// samplingFeedbackWeight is the weight of a single feedback.
+	samplingFeedbackWeight = 0.2
+
+	// samplingFeedbackHalfLife is the half life of the deviation from the
+	// base sample rate, so old feedbacks fade out.
+	samplingFeedbackHalfLife = time.Minute
+)
+
+type (
+	// feedbackSampler keeps a keep-probability per key, which is adjusted
+	// by feedbacks and decays to the base sample rate over time.
+	feedbackSampler struct {
+		baseRate float64
+
+		lock    sync.Mutex
+		entries *lru.Cache
+	}
+
+	feedbackEntry struct {
+		probability float64
+		updatedAt   time.Time
+	}
+)
+
+func newFeedbackSampler(baseRate float64) *feedbackSampler {
+	// the limit is positive, so there's no error.
+	entries, _ := lru.New(samplingFeedbackLimit)
+	return &feedbackSampler{baseRate: baseRate, entries: entries}
+}
+
+func (fs *feedbackSampler) probabilityLocked(key string, now time.Time) float64 {
+	v, ok := fs.entries.Get(key)
+	if !ok {
+		return fs.baseRate
+	}
+
+	e := v.(*feedbackEntry)
+	decay := math.Pow(0.5, float64(now.Sub(e.updatedAt))/float64(samplingFeedbackHalfLife))
+	return fs.baseRate + (e.probability-fs.baseRate)*decay
+}
+
+// probability returns the keep-probability of key at now.
+func (fs *feedbackSampler) probability(key string, now time.Time) float64 {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	return fs.probabilityLocked(key, now)
+}
+
+// record moves the keep-probability of key towards 1 if interesting is
+// true, or towards 0 otherwise.
+func (fs *feedbackSampler) record(key string, interesting bool, now time.Time) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	p := fs.probabilityLocked(key, now)
+	target := 0.0
+	if interesting {
+		target = 1
+	}
+	p += (target - p) * samplingFeedbackWeight
+	fs.entries.Add(key, &feedbackEntry{probability: p, updatedAt: now})
+}
+
+// sample returns whether to sample a trace of key.
+func (fs *feedbackSampler) sample(key string, now time.Time) bool {
+	return rand.Float64() < fs.probability(key, now)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func TestFeedbackSampler(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newFeedbackSampler(0.5)
+	now := fasttime.Now()
+
+	// no feedback, the base rate is used.
+	assert.Equal(0.5, fs.probability("checkout", now))
+
+	// interesting feedback increases the probability.
+	fs.record("checkout", true, now)
+	p := fs.probability("checkout", now)
+	assert.InDelta(0.6, p, 1e-9)
+	for i := 0; i < 10; i++ {
+		fs.record("checkout", true, now)
+	}
+	assert.Greater(fs.probability("checkout", now), 0.9)
+
+	// uninteresting feedback decreases the probability.
+	for i := 0; i < 10; i++ {
+		fs.record("search", false, now)
+	}
+	assert.Less(fs.probability("search", now), 0.1)
+
+	// the deviation decays to the base rate over time.
+	p = fs.probability("checkout", now)
+	decayed := fs.probability("checkout", now.Add(samplingFeedbackHalfLife))
+	assert.InDelta(0.5+(p-0.5)/2, decayed, 1e-9)
+	assert.InDelta(0.5, fs.probability("checkout", now.Add(100*samplingFeedbackHalfLife)), 1e-9)
+
+	// the table is bounded.
+	for i := 0; i < samplingFeedbackLimit; i++ {
+		fs.record(fmt.Sprintf("key-%d", i), false, now)
+	}
+	assert.Equal(samplingFeedbackLimit, fs.entries.Len())
+	assert.Equal(0.5, fs.probability("checkout", now))
+}
+
+func TestNewSpanSampledBy(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.Zipkin.SampleRate = 0
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	for i := 0; i < 100; i++ {
+		tracer.NewSpanSampledBy("checkout", "checkout").Finish()
+	}
+	assert.Empty(reporter.Spans())
+
+	for i := 0; i < 50; i++ {
+		tracer.RecordSamplingFeedback("checkout", true)
+	}
+	for i := 0; i < 100; i++ {
+		tracer.NewSpanSampledBy("checkout", "checkout").Finish()
+		tracer.NewSpanSampledBy("search", "search").Finish()
+	}
+	spans := reporter.Spans()
+	assert.Greater(len(spans), 90)
+	for _, s := range spans {
+		assert.Equal("checkout", s.Name)
+		assert.Nil(s.ParentID)
+	}
+
+	// noop tracer.
+	NoopTracer.RecordSamplingFeedback("checkout", true)
+	assert.True(NoopTracer.NewSpanSampledBy("checkout", "checkout").(*span).IsNoop())
+}
@@ -18,16 +18,42 @@
 package tracing
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	zipkingo "github.com/openzipkin/zipkin-go"
-	"github.com/openzipkin/zipkin-go/propagation/b3"
+	"github.com/openzipkin/zipkin-go/model"
 
 	"github.com/megaease/easegress/pkg/util/fasttime"
 )
 
+// TagError is the tag marking a span as failed, its value is the error
+// message.
+const TagError = string(zipkingo.TagError)
+
+// TagRequestID is the tag of the ID of the request, see RequestID of the
+// HTTPServer.
+const TagRequestID = "request.id"
+
+// TagFilterName, TagFilterKind and TagFilterResult are the tags of the
+// spans of the filters, see FilterSpans of Spec.
+const (
+	TagFilterName   = "filter.name"
+	TagFilterKind   = "filter.kind"
+	TagFilterResult = "filter.result"
+)
+
+// MaxBinaryTagSize is the max size of the data of a binary tag.
+const MaxBinaryTagSize = 1024
+
 type (
+	// SpanContext holds the context of a span.
+	SpanContext = model.SpanContext
+
 	// Span is the span of the Tracing.
 	Span interface {
 		zipkingo.Span
@@ -36,21 +62,78 @@ type (
 		Tracer() *Tracer
 
 		// NewChild creates a child span.
-		NewChild(name string) Span
+		NewChild(name string, opts ...SpanOption) Span
 
 		// NewChildWithStart creates a child span with start time.
-		NewChildWithStart(name string, startAt time.Time) Span
+		NewChildWithStart(name string, startAt time.Time, opts ...SpanOption) Span
 
 		// InjectHTTP injects span context into an HTTP request.
 		InjectHTTP(r *http.Request)
+
+		// MarkFirstByte records the time of the first byte of the response,
+		// only the first call takes effect. The time to first byte is added
+		// to the span as a tag and an annotation when the span finishes.
+		MarkFirstByte()
+
+		// SetBinaryTag adds a tag whose value is the base64 encoding of
+		// data, an error is returned if data is larger than
+		// MaxBinaryTagSize.
+		SetBinaryTag(key string, data []byte) error
+
+		// TagFromHeaders adds the tags configured by AttributeFromHeaders of
+		// the tracing spec from h.
+		TagFromHeaders(h http.Header)
+
+		// TagFromContext adds the tags configured by AttributeFromContext
+		// of the tracing spec for the context attribute attr, whose value
+		// is value.
+		TagFromContext(attr, value string)
 	}
 
 	span struct {
 		zipkingo.Span
-		tracer *Tracer
+		name     string
+		tracer   *Tracer
+		startAt  time.Time
+		finished int32
+
+		// firstByteAt is the unix nano time of the first byte, 0 means
+		// MarkFirstByte has not been called.
+		firstByteAt int64
+
+		// failed is 1 if the span is tagged as error.
+		failed int32
+
+		// traceState is the W3C trace state of the trace, it is propagated
+		// to the children and outgoing requests as is.
+		traceState string
+
+		suppressChildren bool
 	}
+
+	// SpanOption is the option for creating a span.
+	SpanOption func(s *span)
 )
 
+// WithSuppressChildren suppresses the children of the span, that's all
+// spans created by NewChild or NewChildWithStart of the span are noop spans,
+// so the span itself is reported while its whole subtree is dropped.
+//
+// The flag is only valid locally, it is not propagated to remote services.
+func WithSuppressChildren() SpanOption {
+	return func(s *span) {
+		s.suppressChildren = true
+	}
+}
+
+func newSpan(t *Tracer, name string, zs zipkingo.Span, startAt time.Time, opts []SpanOption) *span {
+	s := &span{Span: zs, name: name, tracer: t, startAt: startAt}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 // NoopSpan does nothing.
 var NoopSpan *span
 
@@ -65,34 +148,138 @@ func (s *span) Tracer() *Tracer {
 }
 
 // NewChild creates a new child span.
-func (s *span) NewChild(name string) Span {
+func (s *span) NewChild(name string, opts ...SpanOption) Span {
 	if s.IsNoop() {
 		return s
 	}
-	return s.newChildWithStart(name, fasttime.Now())
+	if s.suppressChildren {
+		return NoopSpan
+	}
+	return s.newChildWithStart(name, fasttime.Now(), opts)
 }
 
 // NewChildWithStart creates a new child span with specified start time.
-func (s *span) NewChildWithStart(name string, startAt time.Time) Span {
+func (s *span) NewChildWithStart(name string, startAt time.Time, opts ...SpanOption) Span {
 	if s.IsNoop() {
 		return s
 	}
-	return s.newChildWithStart(name, startAt)
+	if s.suppressChildren {
+		return NoopSpan
+	}
+	return s.newChildWithStart(name, startAt, opts)
 }
 
-func (s *span) newChildWithStart(name string, startAt time.Time) Span {
+func (s *span) newChildWithStart(name string, startAt time.Time, opts []SpanOption) Span {
 	child := s.tracer.tracer.StartSpan(name,
 		zipkingo.Parent(s.Context()),
 		zipkingo.StartTime(startAt))
 
-	return &span{
-		tracer: s.tracer,
-		Span:   child,
+	cs := newSpan(s.tracer, name, child, startAt, opts)
+	cs.traceState = s.traceState
+	return cs
+}
+
+// SetName sets the name of the span.
+func (s *span) SetName(name string) {
+	if !s.IsNoop() {
+		s.name = name
+	}
+	s.Span.SetName(name)
+}
+
+// Finish finishes the span.
+func (s *span) Finish() {
+	if !s.IsNoop() && atomic.CompareAndSwapInt32(&s.finished, 0, 1) {
+		s.beforeFinish(fasttime.Since(s.startAt))
+	}
+	s.Span.Finish()
+}
+
+// FinishedWithDuration finishes the span with duration d.
+func (s *span) FinishedWithDuration(d time.Duration) {
+	if !s.IsNoop() && atomic.CompareAndSwapInt32(&s.finished, 0, 1) {
+		s.beforeFinish(d)
 	}
+	s.Span.FinishedWithDuration(d)
 }
 
-// InjectHTTP injects span context into an HTTP request.
+// Tag sets a tag of the span.
+func (s *span) Tag(key, value string) {
+	if key == TagError && !s.IsNoop() {
+		atomic.StoreInt32(&s.failed, 1)
+	}
+	s.Span.Tag(key, value)
+}
+
+func (s *span) isFailed() bool {
+	return atomic.LoadInt32(&s.failed) == 1
+}
+
+func (s *span) isSampled() bool {
+	sc := s.Context()
+	return sc.Debug || (sc.Sampled != nil && *sc.Sampled)
+}
+
+// MarkFirstByte records the time of the first byte of the response.
+func (s *span) MarkFirstByte() {
+	if s.IsNoop() {
+		return
+	}
+	atomic.CompareAndSwapInt64(&s.firstByteAt, 0, fasttime.NowUnixNano())
+}
+
+// SetBinaryTag adds a tag whose value is the base64 encoding of data.
+func (s *span) SetBinaryTag(key string, data []byte) error {
+	if len(data) > MaxBinaryTagSize {
+		return fmt.Errorf("binary tag %s is too large: %d bytes, the max size is %d bytes", key, len(data), MaxBinaryTagSize)
+	}
+	if s.IsNoop() {
+		return nil
+	}
+	s.Tag(key, base64.StdEncoding.EncodeToString(data))
+	return nil
+}
+
+// TagFromHeaders adds the tags from the headers configured by the tracer.
+func (s *span) TagFromHeaders(h http.Header) {
+	if !s.IsNoop() && s.tracer.attributes != nil {
+		s.tracer.attributes.tagHeaders(s, h)
+	}
+}
+
+// TagFromContext adds the tags of a context attribute configured by the
+// tracer.
+func (s *span) TagFromContext(attr, value string) {
+	if !s.IsNoop() && s.tracer.attributes != nil {
+		s.tracer.attributes.tagContext(s, attr, value)
+	}
+}
+
+// beforeFinish is called exactly once before the span is finished, d is
+// the duration of the span.
+func (s *span) beforeFinish(d time.Duration) {
+	if at := atomic.LoadInt64(&s.firstByteAt); at != 0 {
+		firstByteAt := time.Unix(0, at)
+		ttfb := firstByteAt.Sub(s.startAt)
+		s.Tag("ttfb_ms", strconv.FormatFloat(float64(ttfb)/float64(time.Millisecond), 'f', 3, 64))
+		s.Annotate(firstByteAt, "first_byte")
+	}
+
+	for _, p := range s.tracer.processors {
+		p.process(s, d)
+	}
+}
+
+// InjectHTTP injects span context into an HTTP request in all of the
+// propagation formats of the tracer.
 func (s *span) InjectHTTP(r *http.Request) {
-	inject := b3.InjectHTTP(r, b3.WithSingleHeaderOnly())
-	inject(s.Context())
+	propagators := s.tracer.propagators
+	if len(propagators) == 0 {
+		propagators = defaultPropagators
+	}
+
+	sc := s.Context()
+	for _, p := range propagators {
+		p.inject(r, sc, s.traceState)
+	}
 }
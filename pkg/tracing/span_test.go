@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func newNoReportTracer(t *testing.T) *Tracer {
+	spec := newTestSpec("http://127.0.0.1:9411/api/v2/spans")
+	spec.Zipkin.DisableReport = true
+	tracer, err := New(spec)
+	assert.NoError(t, err)
+	return tracer
+}
+
+func TestSuppressChildren(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer := newNoReportTracer(t)
+	defer tracer.Close()
+
+	root := tracer.NewSpan("root")
+	suppressed := root.NewChild("cache", WithSuppressChildren())
+	assert.False(suppressed.(*span).IsNoop())
+
+	child := suppressed.NewChild("get")
+	assert.True(child.(*span).IsNoop())
+	child = suppressed.NewChildWithStart("set", fasttime.Now())
+	assert.True(child.(*span).IsNoop())
+	assert.True(child.NewChild("grandchild").(*span).IsNoop())
+
+	sibling := root.NewChild("db")
+	assert.False(sibling.(*span).IsNoop())
+	assert.False(sibling.NewChild("query").(*span).IsNoop())
+
+	other := tracer.NewSpan("another", WithSuppressChildren())
+	assert.False(other.(*span).IsNoop())
+	assert.True(other.NewChild("child").(*span).IsNoop())
+}
+
+func newFakeReporterTracer(t *testing.T, spec *Spec) (*Tracer, *fakeReporter) {
+	reporter := &fakeReporter{}
+	RegisterReporter("fake-test", func(cfg json.RawMessage) (zipkinreporter.Reporter, error) {
+		return reporter, nil
+	})
+	defer UnregisterReporter("fake-test")
+
+	if spec == nil {
+		spec = newTestSpec("")
+	}
+	spec.Backend = "fake-test"
+	tracer, err := New(spec)
+	assert.NoError(t, err)
+	return tracer, reporter
+}
+
+func TestMarkFirstByte(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer, reporter := newFakeReporterTracer(t, nil)
+	defer tracer.Close()
+
+	start := fasttime.Now().Add(-50 * time.Millisecond)
+	s := tracer.NewSpanWithStart("marked", start)
+	s.MarkFirstByte()
+	firstByte := fasttime.Now()
+	// only the first call takes effect.
+	time.Sleep(10 * time.Millisecond)
+	s.MarkFirstByte()
+	s.Finish()
+
+	tracer.NewSpan("unmarked").Finish()
+
+	// noop span ignores it.
+	NoopSpan.MarkFirstByte()
+	NoopSpan.Finish()
+
+	spans := reporter.Spans()
+	assert.Len(spans, 2)
+
+	marked := spans[0]
+	ttfb, err := strconv.ParseFloat(marked.Tags["ttfb_ms"], 64)
+	assert.NoError(err)
+	assert.GreaterOrEqual(ttfb, 50.0)
+	assert.Less(ttfb, float64(firstByte.Add(5*time.Millisecond).Sub(start))/float64(time.Millisecond))
+	assert.Len(marked.Annotations, 1)
+	assert.Equal("first_byte", marked.Annotations[0].Value)
+
+	unmarked := spans[1]
+	assert.NotContains(unmarked.Tags, "ttfb_ms")
+	assert.Empty(unmarked.Annotations)
+}
+
+func TestSetBinaryTag(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer, reporter := newFakeReporterTracer(t, nil)
+	defer tracer.Close()
+
+	s := tracer.NewSpan("binary")
+	assert.NoError(s.SetBinaryTag("fingerprint", []byte{0x00, 0xff, 0x10, 0x80}))
+	assert.NoError(s.SetBinaryTag("max", make([]byte, MaxBinaryTagSize)))
+	assert.Error(s.SetBinaryTag("oversized", make([]byte, MaxBinaryTagSize+1)))
+	s.Finish()
+
+	spans := reporter.Spans()
+	assert.Len(spans, 1)
+	assert.Equal("AP8QgA==", spans[0].Tags["fingerprint"])
+	data, err := base64.StdEncoding.DecodeString(spans[0].Tags["max"])
+	assert.NoError(err)
+	assert.Len(data, MaxBinaryTagSize)
+	assert.NotContains(spans[0].Tags, "oversized")
+
+	// noop span ignores it, but still rejects oversized payloads.
+	assert.NoError(NoopSpan.SetBinaryTag("fingerprint", []byte{0x01}))
+	assert.Error(NoopSpan.SetBinaryTag("oversized", make([]byte, MaxBinaryTagSize+1)))
+}
+
+func TestNewSpanLinkedTo(t *testing.T) {
+	assert := assert.New(t)
+
+	tracerA := newNoReportTracer(t)
+	defer tracerA.Close()
+	tracerB, reporter := newFakeReporterTracer(t, nil)
+	defer tracerB.Close()
+
+	external := tracerA.NewSpan("domain-a").Context()
+	s := tracerB.NewSpanLinkedTo("domain-b", external)
+	s.NewChild("child").Finish()
+	s.Finish()
+
+	spans := reporter.Spans()
+	assert.Len(spans, 2)
+
+	linked := spans[1]
+	assert.Equal("domain-b", linked.Name)
+	assert.Nil(linked.ParentID)
+	assert.NotEqual(external.TraceID, linked.TraceID)
+	assert.Equal(external.TraceID.String(), linked.Tags["link.trace_id"])
+	assert.Equal(external.ID.String(), linked.Tags["link.span_id"])
+
+	// links are not inherited by children.
+	assert.Equal(linked.TraceID, spans[0].TraceID)
+	assert.NotContains(spans[0].Tags, "link.trace_id")
+
+	assert.True(NoopTracer.NewSpanLinkedTo("noop", external).(*span).IsNoop())
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+)
+
+// tagSuppressor is a reporter removing the suppressed tags from spans
+// before sending them to the next reporter.
+type tagSuppressor struct {
+	next zipkinreporter.Reporter
+	keys map[string]struct{}
+}
+
+func newTagSuppressor(next zipkinreporter.Reporter, keys []string) *tagSuppressor {
+	ts := &tagSuppressor{next: next, keys: make(map[string]struct{}, len(keys))}
+	for _, k := range keys {
+		ts.keys[k] = struct{}{}
+	}
+	return ts
+}
+
+// Send implements zipkinreporter.Reporter.
+func (ts *tagSuppressor) Send(s model.SpanModel) {
+	suppressed := 0
+	for k := range s.Tags {
+		if _, ok := ts.keys[k]; ok {
+			suppressed++
+		}
+	}
+
+	if suppressed > 0 {
+		tags := make(map[string]string, len(s.Tags)-suppressed)
+		for k, v := range s.Tags {
+			if _, ok := ts.keys[k]; !ok {
+				tags[k] = v
+			}
+		}
+		s.Tags = tags
+	}
+
+	ts.next.Send(s)
+}
+
+// Close implements zipkinreporter.Reporter.
+func (ts *tagSuppressor) Close() error {
+	return ts.next.Close()
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressTags(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.Tags = map[string]string{"env": "prod", "host.name": "gateway-1"}
+	spec.SuppressTags = []string{"host.name", "internal.id"}
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	s := tracer.NewSpan("suppressed")
+	s.Tag("internal.id", "42")
+	s.Tag("user", "alice")
+	s.Finish()
+	tracer.NewSpan("no-tags").Finish()
+
+	spans := reporter.Spans()
+	assert.Len(spans, 2)
+	assert.Equal(map[string]string{"env": "prod", "user": "alice"}, spans[0].Tags)
+	assert.Equal(map[string]string{"env": "prod"}, spans[1].Tags)
+
+	spec = newTestSpec("http://127.0.0.1:9411/api/v2/spans")
+	spec.SuppressTags = []string{"host.name"}
+	assert.NoError(spec.Validate())
+	spec.SuppressTags = []string{"host.name", ""}
+	assert.Error(spec.Validate())
+	spec.SuppressTags = []string{"host.name", "host.name"}
+	assert.Error(spec.Validate())
+}
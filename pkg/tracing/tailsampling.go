@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
+)
+
+const (
+	// TagPipeline is the tag of the name of the pipeline handling the
+	// request, it is used to find the sample rate of the pipeline.
+	TagPipeline = "pipeline"
+
+	// TagHTTPStatusCode is the tag of the HTTP status code of the response.
+	TagHTTPStatusCode = string(zipkingo.TagHTTPStatusCode)
+
+	// TagGRPCStatusCode is the tag of the gRPC status code of the response.
+	TagGRPCStatusCode = "grpc.status_code"
+)
+
+type (
+	// TailSamplingSpec describes tail sampling, traces with failed spans
+	// or a 5xx status code are always sampled, and so are the traces
+	// whose local root is longer than LatencyThreshold if it is not empty.
+	TailSamplingSpec struct {
+		LatencyThreshold string `json:"latencyThreshold" jsonschema:"omitempty,format=duration"`
+	}
+
+	// deferredSampler makes the sampling decision of a trace when its local
+	// root finishes, instead of when the root starts. Traces are sampled
+	// by the sample rate of their pipelines, and by the tail sampling
+	// policy if tail is true.
+	deferredSampler struct {
+		sampleRate       float64
+		pipelineRates    map[string]float64
+		tail             bool
+		latencyThreshold time.Duration
+	}
+)
+
+// Validate validates TailSamplingSpec.
+func (spec *TailSamplingSpec) Validate() error {
+	_, err := spec.latencyThreshold()
+	return err
+}
+
+func (spec *TailSamplingSpec) latencyThreshold() (time.Duration, error) {
+	if spec.LatencyThreshold == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(spec.LatencyThreshold)
+	if err != nil {
+		return 0, fmt.Errorf("invalid latency threshold %s: %v", spec.LatencyThreshold, err)
+	}
+	return d, nil
+}
+
+func validatePipelineSampleRates(rates map[string]float64) error {
+	for pipeline, rate := range rates {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sample rate of pipeline %s must be in [0, 1], got %v", pipeline, rate)
+		}
+	}
+	return nil
+}
+
+// newDeferredSampler creates a deferred sampler, it returns nil if neither
+// pipeline sample rates nor tail sampling is configured.
+func newDeferredSampler(spec *Spec) (*deferredSampler, error) {
+	if len(spec.PipelineSampleRates) == 0 && spec.TailSampling == nil {
+		return nil, nil
+	}
+
+	ds := &deferredSampler{
+		sampleRate:    spec.Zipkin.SampleRate,
+		pipelineRates: spec.PipelineSampleRates,
+	}
+	if spec.TailSampling != nil {
+		threshold, err := spec.TailSampling.latencyThreshold()
+		if err != nil {
+			return nil, err
+		}
+		ds.tail = true
+		ds.latencyThreshold = threshold
+	}
+	return ds, nil
+}
+
+// keep returns whether to keep the spans of a trace, root is nil if the
+// trace is force flushed before its root finishes.
+func (ds *deferredSampler) keep(spans []model.SpanModel, root *model.SpanModel) bool {
+	rate := ds.sampleRate
+	if root != nil {
+		if r, ok := ds.pipelineRates[root.Tags[TagPipeline]]; ok {
+			rate = r
+		}
+	}
+
+	if len(spans) > 0 && sampleByRate(spans[0].TraceID, rate) {
+		return true
+	}
+	if !ds.tail {
+		return false
+	}
+
+	for i := range spans {
+		if isErrorSpan(&spans[i]) {
+			return true
+		}
+	}
+	if root == nil {
+		return false
+	}
+
+	if code, err := strconv.Atoi(root.Tags[TagHTTPStatusCode]); err == nil && code >= http.StatusInternalServerError {
+		return true
+	}
+	return ds.latencyThreshold > 0 && root.Duration >= ds.latencyThreshold
+}
+
+// sampleByRate samples a trace by the low 64 bits of its trace ID, which
+// are random, so that the decision of a trace is consistent.
+func sampleByRate(traceID model.TraceID, rate float64) bool {
+	return traceID.Low%10000 < uint64(rate*10000)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func TestTailSampling(t *testing.T) {
+	assert := assert.New(t)
+
+	invalid := newTestSpec("http://localhost:9411/api/v2/spans")
+	invalid.PipelineSampleRates = map[string]float64{"pipeline": 2}
+	assert.Error(invalid.Validate())
+
+	spec := newTestSpec("")
+	spec.Zipkin.SampleRate = 0
+	spec.PipelineSampleRates = map[string]float64{"sampled-pipeline": 1}
+	spec.TailSampling = &TailSamplingSpec{LatencyThreshold: "50ms"}
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	// dropped by the sample rate.
+	root := tracer.NewSpan("normal")
+	root.NewChild("child").Finish()
+	root.Finish()
+	assert.Empty(reporter.Spans())
+
+	// failed spans.
+	root = tracer.NewSpan("failed")
+	child := root.NewChild("child")
+	child.Tag(TagError, "boom")
+	child.Finish()
+	root.Finish()
+	assert.Len(reporter.Spans(), 2)
+
+	// 5xx status code.
+	root = tracer.NewSpan("5xx")
+	root.Tag(TagHTTPStatusCode, "503")
+	root.Finish()
+	assert.Len(reporter.Spans(), 3)
+
+	// high latency.
+	root = tracer.NewSpan("slow")
+	root.FinishedWithDuration(100 * time.Millisecond)
+	assert.Len(reporter.Spans(), 4)
+
+	// the sample rate of the pipeline.
+	root = tracer.NewSpan("pipeline")
+	root.Tag(TagPipeline, "sampled-pipeline")
+	root.Finish()
+	assert.Len(reporter.Spans(), 5)
+
+	// the decision of the upstream is respected.
+	r, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	r.Header.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1")
+	root = tracer.NewSpanFromHTTP("upstream", fasttime.Now(), r)
+	root.Finish()
+	assert.Len(reporter.Spans(), 6)
+}
+
+func TestSampleByRate(t *testing.T) {
+	assert := assert.New(t)
+
+	sampled := 0
+	for i := uint64(0); i < 10000; i++ {
+		if sampleByRate(model.TraceID{Low: i * 7919}, 0.1) {
+			sampled++
+		}
+	}
+	assert.InDelta(1000, sampled, 50)
+
+	assert.True(sampleByRate(model.TraceID{Low: 12345}, 1))
+	assert.False(sampleByRate(model.TraceID{Low: 12345}, 0))
+}
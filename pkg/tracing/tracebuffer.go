@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/openzipkin/zipkin-go/model"
+	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// DefaultMaxTraceBufferDuration is the default max duration to buffer
+	// the spans of a trace.
+	DefaultMaxTraceBufferDuration = time.Minute
+
+	// DefaultMaxBufferedTraces is the default max number of buffered traces.
+	DefaultMaxBufferedTraces = 10000
+
+	// DefaultMaxSpansPerTrace is the default max number of buffered spans
+	// of a trace.
+	DefaultMaxSpansPerTrace = 1000
+)
+
+type (
+	// traceBuffer is a reporter which buffers spans by trace, and sends
+	// the spans of a trace to the next reporter together when the local
+	// root span of the trace finishes.
+	//
+	// A trace is force flushed if its root does not finish in maxDuration,
+	// if it has maxSpans buffered spans, or if there are too many buffered
+	// traces, the spans of a force flushed trace are tagged with
+	// "incomplete_flush: true".
+	//
+	// If errorsOnly is true, only the failed spans and their ancestors are
+	// sent, other spans are dropped.
+	//
+	// If sampler is not nil, traces whose sampling decision is deferred
+	// are dropped unless the sampler keeps them.
+	traceBuffer struct {
+		next        zipkinreporter.Reporter
+		maxDuration time.Duration
+		maxTraces   int
+		maxSpans    int
+		errorsOnly  bool
+		sampler     *deferredSampler
+		hooks       []traceCompleteHook
+
+		lock   sync.Mutex
+		groups map[model.TraceID]*list.Element
+		// order is the list of *traceGroup ordered by creation time, which
+		// is also the order of expiration.
+		order *list.List
+
+		done chan struct{}
+		wg   sync.WaitGroup
+	}
+
+	// traceCompleteHook is called with the spans of a trace when its local
+	// root finishes, root points to the root span in spans, it is not
+	// called for force flushed traces.
+	traceCompleteHook func(spans []model.SpanModel, root *model.SpanModel)
+
+	traceGroup struct {
+		traceID   model.TraceID
+		rootID    model.ID
+		createdAt time.Time
+		spans     []model.SpanModel
+		// deferred is true if the sampling decision of the trace is
+		// deferred to the sampler of the buffer.
+		deferred bool
+	}
+)
+
+func newTraceBuffer(next zipkinreporter.Reporter, maxDuration time.Duration, maxTraces, maxSpans int, errorsOnly bool,
+	sampler *deferredSampler, hooks ...traceCompleteHook) *traceBuffer {
+	if maxDuration <= 0 {
+		maxDuration = DefaultMaxTraceBufferDuration
+	}
+	if maxTraces <= 0 {
+		maxTraces = DefaultMaxBufferedTraces
+	}
+	if maxSpans <= 0 {
+		maxSpans = DefaultMaxSpansPerTrace
+	}
+
+	tb := &traceBuffer{
+		next:        next,
+		maxDuration: maxDuration,
+		maxTraces:   maxTraces,
+		maxSpans:    maxSpans,
+		errorsOnly:  errorsOnly,
+		sampler:     sampler,
+		hooks:       hooks,
+		groups:      map[model.TraceID]*list.Element{},
+		order:       list.New(),
+		done:        make(chan struct{}),
+	}
+
+	tb.wg.Add(1)
+	go tb.run()
+
+	return tb
+}
+
+func (tb *traceBuffer) run() {
+	defer tb.wg.Done()
+
+	interval := tb.maxDuration / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	} else if interval > time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tb.done:
+			return
+		case <-ticker.C:
+			tb.flushExpired(fasttime.Now())
+		}
+	}
+}
+
+// registerRoot registers a local root span, spans of its trace are buffered
+// until it finishes. deferred is whether the sampling decision of the trace
+// is deferred to the sampler of the buffer.
+func (tb *traceBuffer) registerRoot(sc model.SpanContext, deferred bool) {
+	var evicted *traceGroup
+
+	tb.lock.Lock()
+	if _, ok := tb.groups[sc.TraceID]; !ok {
+		if tb.order.Len() >= tb.maxTraces {
+			evicted = tb.removeLocked(tb.order.Front())
+		}
+		g := &traceGroup{traceID: sc.TraceID, rootID: sc.ID, createdAt: fasttime.Now(), deferred: deferred}
+		tb.groups[sc.TraceID] = tb.order.PushBack(g)
+	}
+	tb.lock.Unlock()
+
+	if evicted != nil {
+		tb.flush(evicted, true)
+	}
+}
+
+func (tb *traceBuffer) removeLocked(e *list.Element) *traceGroup {
+	g := tb.order.Remove(e).(*traceGroup)
+	delete(tb.groups, g.traceID)
+	return g
+}
+
+// Send implements zipkinreporter.Reporter.
+func (tb *traceBuffer) Send(s model.SpanModel) {
+	tb.lock.Lock()
+	e := tb.groups[s.TraceID]
+	if e == nil {
+		tb.lock.Unlock()
+		// the trace is not buffered, or it has been flushed.
+		if !tb.errorsOnly || isErrorSpan(&s) {
+			tb.next.Send(s)
+		}
+		return
+	}
+
+	g := e.Value.(*traceGroup)
+	g.spans = append(g.spans, s)
+	if s.ID != g.rootID {
+		// force flush the trace if it has too many spans, its later spans
+		// are sent without buffering.
+		if len(g.spans) < tb.maxSpans {
+			tb.lock.Unlock()
+			return
+		}
+		tb.removeLocked(e)
+		tb.lock.Unlock()
+		tb.flush(g, true)
+		return
+	}
+
+	tb.removeLocked(e)
+	tb.lock.Unlock()
+
+	root := &g.spans[len(g.spans)-1]
+	if g.deferred && !tb.sampler.keep(g.spans, root) {
+		return
+	}
+	for _, hook := range tb.hooks {
+		hook(g.spans, root)
+	}
+	tb.flush(g, false)
+}
+
+// len returns the number of buffered traces.
+func (tb *traceBuffer) len() int {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+	return tb.order.Len()
+}
+
+func (tb *traceBuffer) flushExpired(now time.Time) {
+	var expired []*traceGroup
+
+	tb.lock.Lock()
+	for e := tb.order.Front(); e != nil; e = tb.order.Front() {
+		g := e.Value.(*traceGroup)
+		if now.Sub(g.createdAt) < tb.maxDuration {
+			break
+		}
+		expired = append(expired, tb.removeLocked(e))
+	}
+	tb.lock.Unlock()
+
+	for _, g := range expired {
+		tb.flush(g, true)
+	}
+}
+
+func (tb *traceBuffer) flush(g *traceGroup, incomplete bool) {
+	if incomplete && g.deferred && !tb.sampler.keep(g.spans, nil) {
+		return
+	}
+
+	spans := g.spans
+	if tb.errorsOnly {
+		spans = errorPaths(spans)
+	}
+
+	for _, s := range spans {
+		if incomplete {
+			tags := make(map[string]string, len(s.Tags)+1)
+			for k, v := range s.Tags {
+				tags[k] = v
+			}
+			tags["incomplete_flush"] = "true"
+			s.Tags = tags
+		}
+		tb.next.Send(s)
+	}
+}
+
+func isErrorSpan(s *model.SpanModel) bool {
+	_, ok := s.Tags[TagError]
+	return ok
+}
+
+// errorPaths returns the failed spans and their ancestors in spans.
+func errorPaths(spans []model.SpanModel) []model.SpanModel {
+	parents := make(map[model.ID]model.ID, len(spans))
+	for i := range spans {
+		if p := spans[i].ParentID; p != nil {
+			parents[spans[i].ID] = *p
+		}
+	}
+
+	keep := map[model.ID]bool{}
+	for i := range spans {
+		if !isErrorSpan(&spans[i]) {
+			continue
+		}
+		for id := spans[i].ID; !keep[id]; {
+			keep[id] = true
+			p, ok := parents[id]
+			if !ok {
+				break
+			}
+			id = p
+		}
+	}
+
+	if len(keep) == 0 {
+		return nil
+	}
+
+	result := make([]model.SpanModel, 0, len(keep))
+	for i := range spans {
+		if keep[spans[i].ID] {
+			result = append(result, spans[i])
+		}
+	}
+	return result
+}
+
+// Close implements zipkinreporter.Reporter, it force flushes all buffered
+// traces and then closes the next reporter.
+func (tb *traceBuffer) Close() error {
+	close(tb.done)
+	tb.wg.Wait()
+
+	tb.lock.Lock()
+	var groups []*traceGroup
+	for e := tb.order.Front(); e != nil; e = tb.order.Front() {
+		groups = append(groups, tb.removeLocked(e))
+	}
+	tb.lock.Unlock()
+
+	for _, g := range groups {
+		tb.flush(g, true)
+	}
+
+	return tb.next.Close()
+}
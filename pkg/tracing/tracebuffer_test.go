@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+func TestGroupByTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.GroupByTrace = true
+	spec.MaxTraceBufferDuration = "100ms"
+	tracer, reporter := newFakeReporterTracer(t, spec)
+
+	// spans are reported together when the root finishes.
+	root := tracer.NewSpan("root")
+	root.NewChild("child").Finish()
+	assert.Empty(reporter.Spans())
+	root.Finish()
+	spans := reporter.Spans()
+	assert.Len(spans, 2)
+	for _, s := range spans {
+		assert.NotContains(s.Tags, "incomplete_flush")
+	}
+
+	// a long-running trace is flushed after the max buffer duration.
+	longRunning := tracer.NewSpan("long-running")
+	longRunning.NewChild("child").Finish()
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(reporter.Spans(), 2)
+
+	assert.Eventually(func() bool {
+		return len(reporter.Spans()) == 3
+	}, time.Second, 10*time.Millisecond)
+	flushed := reporter.Spans()[2]
+	assert.Equal("child", flushed.Name)
+	assert.Equal(longRunning.Context().TraceID, flushed.TraceID)
+	assert.Equal("true", flushed.Tags["incomplete_flush"])
+
+	// spans finishing after the flush are reported directly.
+	longRunning.Finish()
+	assert.Len(reporter.Spans(), 4)
+
+	// buffered traces are flushed on close.
+	tracer.NewSpan("unfinished").NewChild("child").Finish()
+	assert.NoError(tracer.Close())
+	spans = reporter.Spans()
+	assert.Len(spans, 5)
+	assert.Equal("true", spans[4].Tags["incomplete_flush"])
+	assert.True(reporter.closed)
+}
+
+func TestMaxBufferedTraces(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.GroupByTrace = true
+	spec.MaxBufferedTraces = 2
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	first := tracer.NewSpan("first")
+	first.NewChild("child").Finish()
+	tracer.NewSpan("second")
+	assert.Empty(reporter.Spans())
+
+	// the oldest trace is evicted.
+	tracer.NewSpan("third")
+	spans := reporter.Spans()
+	assert.Len(spans, 1)
+	assert.Equal(first.Context().TraceID, spans[0].TraceID)
+	assert.Equal("true", spans[0].Tags["incomplete_flush"])
+}
+
+func TestMaxSpansPerTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.GroupByTrace = true
+	spec.MaxSpansPerTrace = 3
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	root := tracer.NewSpan("root")
+	root.NewChild("child1").Finish()
+	root.NewChild("child2").Finish()
+	assert.Empty(reporter.Spans())
+
+	// the trace is flushed when it has too many spans.
+	root.NewChild("child3").Finish()
+	spans := reporter.Spans()
+	assert.Len(spans, 3)
+	for _, s := range spans {
+		assert.Equal("true", s.Tags["incomplete_flush"])
+	}
+
+	// later spans are reported directly.
+	root.NewChild("child4").Finish()
+	root.Finish()
+	spans = reporter.Spans()
+	assert.Len(spans, 5)
+	assert.NotContains(spans[4].Tags, "incomplete_flush")
+}
+
+func TestErrorsOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("")
+	spec.Mode = ModeErrorsOnly
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	// nothing is reported for an all-success trace.
+	root := tracer.NewSpan("success")
+	root.NewChild("child").Finish()
+	root.Finish()
+	assert.Empty(reporter.Spans())
+
+	// the failed span and its ancestors are reported.
+	root = tracer.NewSpan("root")
+	parent := root.NewChild("parent")
+	failed := parent.NewChild("failed")
+	failed.Tag(TagError, "connection refused")
+	failed.Finish()
+	parent.Finish()
+	root.NewChild("sibling").Finish()
+	root.Finish()
+
+	spans := reporter.Spans()
+	assert.Len(spans, 3)
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	assert.ElementsMatch([]string{"root", "parent", "failed"}, names)
+
+	// spans finishing after the flush are reported only if failed.
+	late := root.NewChild("late")
+	late.Finish()
+	assert.Len(reporter.Spans(), 3)
+	late = root.NewChild("late-failed")
+	late.Tag(TagError, "timeout")
+	late.Finish()
+	assert.Len(reporter.Spans(), 4)
+}
+
+func TestComputeCriticalPath(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := newTestSpec("http://127.0.0.1:9411/api/v2/spans")
+	spec.ComputeCriticalPath = true
+	assert.Error(spec.Validate())
+	spec.GroupByTrace = true
+	assert.NoError(spec.Validate())
+
+	tracer, reporter := newFakeReporterTracer(t, spec)
+	defer tracer.Close()
+
+	// root   [0, 100]
+	// ├── a  [10, 40]
+	// │   └── a1 [15, 35]
+	// └── b  [20, 80]
+	//     ├── b1 [20, 30]
+	//     └── b2 [40, 70]
+	//
+	// the critical path is root(30) -> b(20) -> b2(30).
+	base := fasttime.Now().Add(-time.Second)
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+	root := tracer.NewSpanWithStart("root", at(0))
+	a := root.NewChildWithStart("a", at(10))
+	a.NewChildWithStart("a1", at(15)).FinishedWithDuration(ms(20))
+	a.FinishedWithDuration(ms(30))
+	b := root.NewChildWithStart("b", at(20))
+	b.NewChildWithStart("b1", at(20)).FinishedWithDuration(ms(10))
+	b.NewChildWithStart("b2", at(40)).FinishedWithDuration(ms(30))
+	b.FinishedWithDuration(ms(60))
+	root.FinishedWithDuration(ms(100))
+
+	spans := reporter.Spans()
+	assert.Len(spans, 6)
+	for _, s := range spans {
+		if s.Name == "root" {
+			assert.Equal("80.000", s.Tags["critical_path_ms"])
+		} else {
+			assert.NotContains(s.Tags, "critical_path_ms")
+		}
+	}
+}
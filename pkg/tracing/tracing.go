@@ -18,14 +18,22 @@
 package tracing
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/util/fasttime"
 
 	zipkingo "github.com/openzipkin/zipkin-go"
+	"github.com/openzipkin/zipkin-go/model"
 	zipkinreporter "github.com/openzipkin/zipkin-go/reporter"
 	zipkingohttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type (
@@ -33,38 +41,260 @@ type (
 	Spec struct {
 		ServiceName string            `json:"serviceName" jsonschema:"required"`
 		Tags        map[string]string `json:"tags" jsonschema:"omitempty"`
-		Zipkin      *ZipkinSpec       `json:"zipkin" jsonschema:"required"`
+		Zipkin      *ZipkinSpec       `json:"zipkin,omitempty" jsonschema:"omitempty"`
+
+		// Backend is the name of a reporter registered by RegisterReporter,
+		// spans are exported by the reporter created with BackendConfig.
+		// Empty or "zipkin" means the built-in Zipkin HTTP reporter,
+		// "otlp" means the built-in OTLP exporter only, and "jaeger" means
+		// the built-in Jaeger agent reporter configured by Jaeger.
+		Backend       string          `json:"backend" jsonschema:"omitempty"`
+		BackendConfig json.RawMessage `json:"backendConfig,omitempty" jsonschema:"omitempty"`
+
+		// OTLP exports spans to an OpenTelemetry collector, in addition
+		// to the backend, or instead of it if the backend is "otlp".
+		OTLP *OTLPSpec `json:"otlp,omitempty" jsonschema:"omitempty"`
+
+		Jaeger *JaegerSpec `json:"jaeger,omitempty" jsonschema:"omitempty"`
+
+		// REDMetrics enables the RED (rate, errors and duration) metrics of
+		// all spans by operation, including the unsampled ones.
+		REDMetrics bool `json:"redMetrics" jsonschema:"omitempty"`
+
+		// SlowTraceLabelThreshold enables the slow_request_total metric
+		// labeled by trace ID for spans longer than the threshold.
+		SlowTraceLabelThreshold string `json:"slowTraceLabelThreshold" jsonschema:"omitempty,format=duration"`
+		SlowTraceLabelLimit     int    `json:"slowTraceLabelLimit" jsonschema:"omitempty"`
+
+		// OperationBudgets are the latency budgets of operations, that's the
+		// span names, operations not in the map use DefaultOperationBudget.
+		// Spans exceeding the budget are tagged "slo.violated: true" and
+		// counted by the slo_violations_total metric.
+		OperationBudgets       map[string]string `json:"operationBudgets" jsonschema:"omitempty"`
+		DefaultOperationBudget string            `json:"defaultOperationBudget" jsonschema:"omitempty,format=duration"`
+
+		// GroupByTrace buffers spans until the local root span of their
+		// trace finishes, so that spans of a trace are reported together.
+		// A trace whose root does not finish in MaxTraceBufferDuration, or
+		// which has MaxSpansPerTrace spans, is flushed anyway, and at most
+		// MaxBufferedTraces traces are buffered.
+		GroupByTrace           bool   `json:"groupByTrace" jsonschema:"omitempty"`
+		MaxTraceBufferDuration string `json:"maxTraceBufferDuration" jsonschema:"omitempty,format=duration"`
+		MaxBufferedTraces      int    `json:"maxBufferedTraces" jsonschema:"omitempty"`
+		MaxSpansPerTrace       int    `json:"maxSpansPerTrace" jsonschema:"omitempty,minimum=0"`
+
+		// ComputeCriticalPath tags the local root span with the duration
+		// of the critical path of the trace, it requires GroupByTrace or
+		// the errors-only mode, as the spans of the trace are needed.
+		ComputeCriticalPath bool `json:"computeCriticalPath" jsonschema:"omitempty"`
+
+		// Mode is the report mode, in "errors-only" mode, spans of a trace
+		// are buffered like GroupByTrace, but only the failed spans and
+		// their ancestors are reported.
+		Mode string `json:"mode" jsonschema:"omitempty,enum=,enum=all,enum=errors-only"`
+
+		// PipelineSampleRates overrides the sample rate of the requests
+		// handled by pipelines, the key is the name of the pipeline.
+		// TailSampling samples the traces with errors or high latency
+		// regardless of the sample rate. With either of them, the sampling
+		// decision of a trace started locally is deferred until its local
+		// root finishes, so spans of all requests are recorded and buffered
+		// like GroupByTrace.
+		PipelineSampleRates map[string]float64 `json:"pipelineSampleRates" jsonschema:"omitempty"`
+		TailSampling        *TailSamplingSpec  `json:"tailSampling,omitempty" jsonschema:"omitempty"`
+
+		// AttributeFromHeaders and AttributeFromContext add tags from the
+		// request data to the spans of requests, the keys are the tag keys,
+		// the values are the header names, and the context attributes which
+		// are "method", "path", "pathTemplate", "clientIP" and "upstream".
+		AttributeFromHeaders map[string]string `json:"attributeFromHeaders" jsonschema:"omitempty"`
+		AttributeFromContext map[string]string `json:"attributeFromContext" jsonschema:"omitempty"`
+
+		// SuppressTags are the keys of tags removed from every span before
+		// it is exported.
+		SuppressTags []string `json:"suppressTags" jsonschema:"omitempty,uniqueItems=true"`
+
+		// Propagation are the formats of propagating span contexts across
+		// services, they are "b3", "w3c" and "jaeger". Span contexts are
+		// extracted from the first format found in the incoming request
+		// and injected in all formats into outgoing requests. Default is
+		// ["b3"].
+		Propagation []string `json:"propagation" jsonschema:"omitempty,uniqueItems=true"`
+
+		// FilterSpans creates a child span for every filter executed by
+		// the pipelines, tagged with the name, kind and result of the
+		// filter, so that the latency of each filter is shown in traces.
+		FilterSpans bool `json:"filterSpans" jsonschema:"omitempty"`
 	}
 
 	// ZipkinSpec describes Zipkin.
 	ZipkinSpec struct {
 		Hostport      string  `json:"hostport" jsonschema:"omitempty"`
-		ServerURL     string  `json:"serverURL" jsonschema:"required,format=url"`
+		ServerURL     string  `json:"serverURL" jsonschema:"omitempty,format=url"`
 		DisableReport bool    `json:"disableReport" jsonschema:"omitempty"`
 		SampleRate    float64 `json:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
 		SameSpan      bool    `json:"sameSpan" jsonschema:"omitempty"`
 		ID128Bit      bool    `json:"id128Bit" jsonschema:"omitempty"`
+		Encoding      string  `json:"encoding" jsonschema:"omitempty,enum=,enum=json,enum=proto,enum=auto"`
+
+		Compression      bool `json:"compression" jsonschema:"omitempty"`
+		CompressionLevel int  `json:"compressionLevel" jsonschema:"omitempty,minimum=-1,maximum=9"`
+
+		// StaticLocalIP is the IP of the local endpoint, it skips the DNS
+		// lookup of the host of Hostport. Otherwise, the lookup is retried
+		// EndpointResolveRetries times on resolution failures.
+		StaticLocalIP          string `json:"staticLocalIP" jsonschema:"omitempty"`
+		EndpointResolveRetries int    `json:"endpointResolveRetries" jsonschema:"omitempty,minimum=0"`
+
+		// MaxBatchBytes is the max serialized size of a batch of spans,
+		// larger batches are split into smaller ones, a single span larger
+		// than it is dropped. Zero means no limit.
+		MaxBatchBytes int `json:"maxBatchBytes" jsonschema:"omitempty,minimum=0"`
+
+		DiskBuffer *DiskBufferSpec `json:"diskBuffer,omitempty" jsonschema:"omitempty"`
+	}
+
+	// DiskBufferSpec describes the disk buffer of spans. Spans overflowing
+	// the in-memory backlog, or failed to export because of collector
+	// outages, are spilled to the disk buffer and replayed when the
+	// collector recovers. The oldest spans are dropped if the size of the
+	// buffer exceeds MaxBytes.
+	DiskBufferSpec struct {
+		Directory string `json:"directory" jsonschema:"required"`
+		MaxBytes  int64  `json:"maxBytes" jsonschema:"omitempty,minimum=0"`
 	}
 
 	// Tracer is the tracer.
 	Tracer struct {
-		tracer *zipkingo.Tracer
-		tags   map[string]string
-		closer io.Closer
+		// sampledTraces and notSampledTraces are the number of local root
+		// spans sampled or not, they are the first fields for the 64-bit
+		// alignment required by atomic operations.
+		sampledTraces    uint64
+		notSampledTraces uint64
+
+		spec    *Spec
+		tracer  *zipkingo.Tracer
+		tags    map[string]string
+		closer  io.Closer
+		metrics *metricsCollector
+		// processors is the span processing pipeline, see spanProcessor.
+		processors []spanProcessor
+		buffer     *traceBuffer
+		stats      statsReporter
+
+		feedback    *feedbackSampler
+		propagators []propagator
+		attributes  *spanAttributes
+
+		// registered is the collector registered by RegisterMetrics.
+		registered *registeredCollector
 	}
 
 	noopCloser struct{}
 )
 
+const (
+	// ModeAll reports all sampled spans.
+	ModeAll = "all"
+
+	// ModeErrorsOnly reports only the failed spans and their ancestors.
+	ModeErrorsOnly = "errors-only"
+)
+
 // Validate validates Spec.
+func (spec *Spec) Validate() error {
+	if _, err := spec.operationBudgets(); err != nil {
+		return err
+	}
+
+	if spec.ComputeCriticalPath && !spec.GroupByTrace && spec.Mode != ModeErrorsOnly {
+		return fmt.Errorf("computeCriticalPath requires groupByTrace or the errors-only mode")
+	}
+
+	suppressTags := map[string]struct{}{}
+	for _, k := range spec.SuppressTags {
+		if k == "" {
+			return fmt.Errorf("empty key in suppressTags")
+		}
+		if _, ok := suppressTags[k]; ok {
+			return fmt.Errorf("duplicated key %s in suppressTags", k)
+		}
+		suppressTags[k] = struct{}{}
+	}
+
+	if _, err := newPropagators(spec.Propagation); err != nil {
+		return err
+	}
+
+	if err := validatePipelineSampleRates(spec.PipelineSampleRates); err != nil {
+		return err
+	}
+
+	if err := validateSpanAttributes(spec.AttributeFromHeaders, spec.AttributeFromContext); err != nil {
+		return err
+	}
+
+	if !isBuiltInBackend(spec.Backend) {
+		if getReporterFactory(spec.Backend) == nil {
+			return fmt.Errorf("backend %s is not registered", spec.Backend)
+		}
+		return nil
+	}
+
+	if spec.Backend == BackendOTLP {
+		if spec.OTLP == nil {
+			return fmt.Errorf("otlp is required by the otlp backend")
+		}
+		return nil
+	}
+
+	if spec.Backend == BackendJaeger {
+		if spec.Jaeger == nil {
+			return fmt.Errorf("jaeger is required by the jaeger backend")
+		}
+		return nil
+	}
+
+	if spec.Zipkin == nil {
+		return fmt.Errorf("zipkin is required by the zipkin backend")
+	}
+	if spec.Zipkin.ServerURL == "" {
+		return fmt.Errorf("serverURL is required by the zipkin backend")
+	}
+
+	return nil
+}
+
+func (spec *Spec) operationBudgets() (map[string]time.Duration, error) {
+	budgets := make(map[string]time.Duration, len(spec.OperationBudgets))
+	for op, budget := range spec.OperationBudgets {
+		d, err := time.ParseDuration(budget)
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget of operation %s: %v", op, err)
+		}
+		budgets[op] = d
+	}
+	return budgets, nil
+}
+
+// Validate validates ZipkinSpec.
 func (spec *ZipkinSpec) Validate() error {
+	if spec.StaticLocalIP != "" && net.ParseIP(spec.StaticLocalIP) == nil {
+		return fmt.Errorf("invalid static local IP %s", spec.StaticLocalIP)
+	}
+
+	// the endpoint is created by New, as the DNS lookup of the host could
+	// be retried and block the validation.
 	if spec.Hostport != "" {
-		_, err := zipkingo.NewEndpoint("", spec.Hostport)
-		if err != nil {
+		if err := validateHostport(spec.Hostport); err != nil {
 			return err
 		}
 	}
 
+	if spec.CompressionLevel < gzip.DefaultCompression || spec.CompressionLevel > gzip.BestCompression {
+		return fmt.Errorf("invalid compression level %d, must be -1 (default) or in [1, 9]", spec.CompressionLevel)
+	}
+
 	return nil
 }
 
@@ -73,7 +303,7 @@ var NoopTracer *Tracer
 
 func init() {
 	tracer, _ := zipkingo.NewTracer(nil)
-	NoopTracer = &Tracer{tracer: tracer, closer: nil}
+	NoopTracer = &Tracer{tracer: tracer, closer: nil, metrics: &metricsCollector{}}
 	NoopSpan = &span{tracer: NoopTracer, Span: NoopTracer.tracer.StartSpan("")}
 }
 
@@ -83,7 +313,16 @@ func New(spec *Spec) (*Tracer, error) {
 		return NoopTracer, nil
 	}
 
-	endpoint, err := zipkingo.NewEndpoint(spec.ServiceName, spec.Zipkin.Hostport)
+	// zipkin is optional for the backends other than zipkin, all traces
+	// are sampled without it.
+	if spec.Zipkin == nil {
+		s := *spec
+		s.Zipkin = &ZipkinSpec{SampleRate: 1}
+		spec = &s
+	}
+
+	endpoint, err := newEndpoint(spec.ServiceName, spec.Zipkin.Hostport,
+		spec.Zipkin.StaticLocalIP, spec.Zipkin.EndpointResolveRetries)
 	if err != nil {
 		return nil, err
 	}
@@ -93,12 +332,97 @@ func New(spec *Spec) (*Tracer, error) {
 		return nil, err
 	}
 
-	var reporter zipkinreporter.Reporter
+	deferred, err := newDeferredSampler(spec)
+	if err != nil {
+		return nil, err
+	}
 	if spec.Zipkin.DisableReport {
-		reporter = zipkinreporter.NewNoopReporter()
-	} else {
-		reporter = zipkingohttp.NewReporter(spec.Zipkin.ServerURL)
+		deferred = nil
+	}
+	if deferred != nil {
+		// all traces are recorded, the decision is made by deferred.
+		sampler = zipkingo.AlwaysSample
+	}
+
+	propagators, err := newPropagators(spec.Propagation)
+	if err != nil {
+		return nil, err
+	}
+
+	var processors []spanProcessor
+	metrics := &metricsCollector{}
+	addProcessor := func(p interface {
+		spanProcessor
+		prometheus.Collector
+	}) {
+		processors = append(processors, p)
+		metrics.collectors = append(metrics.collectors, p)
+	}
+
+	if spec.REDMetrics {
+		addProcessor(newREDMetrics(spec.ServiceName))
+	}
+	if spec.SlowTraceLabelThreshold != "" {
+		threshold, err := time.ParseDuration(spec.SlowTraceLabelThreshold)
+		if err != nil {
+			return nil, err
+		}
+		addProcessor(newSlowRequestCounter(spec.ServiceName, threshold, spec.SlowTraceLabelLimit))
+	}
+	if len(spec.OperationBudgets) > 0 || spec.DefaultOperationBudget != "" {
+		budgets, err := spec.operationBudgets()
+		if err != nil {
+			return nil, err
+		}
+		var defaultBudget time.Duration
+		if spec.DefaultOperationBudget != "" {
+			defaultBudget, err = time.ParseDuration(spec.DefaultOperationBudget)
+			if err != nil {
+				return nil, err
+			}
+		}
+		addProcessor(newSLOViolationCounter(spec.ServiceName, budgets, defaultBudget))
+	}
+
+	reporter, err := newReporter(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, _ := reporter.(statsReporter)
+
+	if spec.OTLP != nil && spec.Backend != BackendOTLP && !spec.Zipkin.DisableReport {
+		otlp, err := newOTLPReporter(spec.OTLP)
+		if err != nil {
+			reporter.Close()
+			return nil, err
+		}
+		reporter = newMultiReporter(reporter, otlp)
+	}
+
+	if len(spec.SuppressTags) > 0 {
+		reporter = newTagSuppressor(reporter, spec.SuppressTags)
+	}
+
+	var buffer *traceBuffer
+	errorsOnly := spec.Mode == ModeErrorsOnly
+	if (spec.GroupByTrace || errorsOnly || deferred != nil) && !spec.Zipkin.DisableReport {
+		var maxDuration time.Duration
+		if spec.MaxTraceBufferDuration != "" {
+			maxDuration, err = time.ParseDuration(spec.MaxTraceBufferDuration)
+			if err != nil {
+				reporter.Close()
+				return nil, err
+			}
+		}
+		var hooks []traceCompleteHook
+		if spec.ComputeCriticalPath {
+			hooks = append(hooks, tagCriticalPath)
+		}
+		buffer = newTraceBuffer(reporter, maxDuration, spec.MaxBufferedTraces, spec.MaxSpansPerTrace, errorsOnly, deferred, hooks...)
+		reporter = buffer
 	}
+
 	tracer, err := zipkingo.NewTracer(
 		reporter,
 		zipkingo.WithLocalEndpoint(endpoint),
@@ -112,18 +436,95 @@ func New(spec *Spec) (*Tracer, error) {
 	}
 
 	return &Tracer{
-		tracer: tracer,
-		closer: reporter,
+		spec:        spec,
+		tracer:      tracer,
+		closer:      reporter,
+		metrics:     metrics,
+		processors:  processors,
+		buffer:      buffer,
+		stats:       stats,
+		feedback:    newFeedbackSampler(spec.Zipkin.SampleRate),
+		propagators: propagators,
+		attributes:  newSpanAttributes(spec.AttributeFromHeaders, spec.AttributeFromContext),
 	}, nil
 }
 
+// Collector returns the Prometheus collector of the metrics of the tracer.
+func (t *Tracer) Collector() prometheus.Collector {
+	return t.metrics
+}
+
+// RegisterMetrics registers the metrics of the tracer to the default
+// Prometheus registry with the label "server", it replaces the metrics
+// registered by the previous tracer of the server, and the metrics are
+// unregistered when the tracer is closed.
+func (t *Tracer) RegisterMetrics(server string) {
+	if t.IsNoopTracer() || len(t.metrics.collectors) == 0 {
+		return
+	}
+	t.registered = registerCollector(server, t.metrics)
+}
+
+func newReporter(spec *Spec) (zipkinreporter.Reporter, error) {
+	if spec.Zipkin.DisableReport {
+		return zipkinreporter.NewNoopReporter(), nil
+	}
+
+	if !isBuiltInBackend(spec.Backend) {
+		factory := getReporterFactory(spec.Backend)
+		if factory == nil {
+			return nil, fmt.Errorf("backend %s is not registered", spec.Backend)
+		}
+		reporter, err := factory(spec.BackendConfig)
+		if err != nil {
+			return nil, fmt.Errorf("create reporter of backend %s failed: %v", spec.Backend, err)
+		}
+		return reporter, nil
+	}
+
+	if spec.Backend == BackendOTLP {
+		return newOTLPReporter(spec.OTLP)
+	}
+
+	if spec.Backend == BackendJaeger {
+		return newJaegerReporter(spec.Jaeger)
+	}
+
+	encoding := resolveEncoding(spec.Zipkin.Encoding, spec.Zipkin.ServerURL)
+	var client zipkingohttp.HTTPDoer = &http.Client{}
+	if spec.Zipkin.Compression {
+		client = newGzipDoer(client, spec.Zipkin.CompressionLevel)
+	}
+
+	var disk *diskQueue
+	if ds := spec.Zipkin.DiskBuffer; ds != nil {
+		var err error
+		// batches of different encodings are stored in different files.
+		disk, err = newDiskQueue(ds.Directory, ds.MaxBytes, "."+encoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newHTTPReporter(spec.Zipkin.ServerURL, newSerializer(encoding), client, spec.Zipkin.MaxBatchBytes, disk), nil
+}
+
 // IsNoopTracer checks whether tracer is noop tracer.
 func (t *Tracer) IsNoopTracer() bool {
 	return t == NoopTracer
 }
 
+// FilterSpansEnabled returns whether the spans of the filters are enabled.
+func (t *Tracer) FilterSpansEnabled() bool {
+	return t.spec != nil && t.spec.FilterSpans
+}
+
 // Close closes Tracing.
 func (t *Tracer) Close() error {
+	if t.registered != nil {
+		unregisterCollector(t.registered)
+	}
+
 	if t.closer != nil {
 		return t.closer.Close()
 	}
@@ -132,22 +533,101 @@ func (t *Tracer) Close() error {
 }
 
 // NewSpan creates a span.
-func (t *Tracer) NewSpan(name string) Span {
+func (t *Tracer) NewSpan(name string, opts ...SpanOption) Span {
 	if t.IsNoopTracer() {
 		return NoopSpan
 	}
-	return t.newSpanWithStart(name, fasttime.Now())
+	return t.newSpanWithStart(name, fasttime.Now(), opts, nil)
 }
 
 // NewSpanWithStart creates a span with specify start time.
-func (t *Tracer) NewSpanWithStart(name string, startAt time.Time) Span {
+func (t *Tracer) NewSpanWithStart(name string, startAt time.Time, opts ...SpanOption) Span {
+	if t.IsNoopTracer() {
+		return NoopSpan
+	}
+	return t.newSpanWithStart(name, startAt, opts, nil)
+}
+
+// NewSpanFromHTTP creates a span with start time, whose parent is the
+// span context extracted from r by the propagation formats, it is a root
+// span if there's no span context in r.
+func (t *Tracer) NewSpanFromHTTP(name string, startAt time.Time, r *http.Request, opts ...SpanOption) Span {
+	if t.IsNoopTracer() {
+		return NoopSpan
+	}
+
+	for _, p := range t.propagators {
+		if sc, traceState, ok := p.extract(r); ok {
+			s := t.newSpanWithStart(name, startAt, opts, &sc)
+			s.traceState = traceState
+			return s
+		}
+	}
+	return t.newSpanWithStart(name, startAt, opts, nil)
+}
+
+// NewSpanLinkedTo creates a local root span linked to external, which is
+// usually the span context of a span from another tracer. The span and
+// external belong to separate traces, they are joined by the link tags
+// "link.trace_id" and "link.span_id" for cross-domain correlation.
+func (t *Tracer) NewSpanLinkedTo(name string, external SpanContext, opts ...SpanOption) Span {
+	if t.IsNoopTracer() {
+		return NoopSpan
+	}
+
+	s := t.newSpanWithStart(name, fasttime.Now(), opts, nil)
+	s.Tag("link.trace_id", external.TraceID.String())
+	s.Tag("link.span_id", external.ID.String())
+	return s
+}
+
+// RecordSamplingFeedback records whether a trace of key was interesting,
+// which is usually reported by downstream services. The feedback adjusts
+// the keep-probability of key used by NewSpanSampledBy, and its effect
+// decays over time.
+//
+// This is experimental.
+func (t *Tracer) RecordSamplingFeedback(key string, interesting bool) {
+	if t.IsNoopTracer() {
+		return
+	}
+	t.feedback.record(key, interesting, fasttime.Now())
+}
+
+// NewSpanSampledBy creates a local root span, whose sampling decision is
+// made by the keep-probability of key instead of the sample rate. The
+// probability is the sample rate if there's no feedback of key.
+//
+// This is experimental.
+func (t *Tracer) NewSpanSampledBy(name string, key string, opts ...SpanOption) Span {
 	if t.IsNoopTracer() {
 		return NoopSpan
 	}
-	return t.newSpanWithStart(name, startAt)
+
+	now := fasttime.Now()
+	sampled := t.feedback.sample(key, now)
+	return t.newSpanWithStart(name, now, opts, &model.SpanContext{Sampled: &sampled})
 }
 
-func (t *Tracer) newSpanWithStart(name string, startAt time.Time) Span {
-	s := t.tracer.StartSpan(name, zipkingo.StartTime(startAt))
-	return &span{Span: s, tracer: t}
+// newSpanWithStart creates a local root span, parent is the remote parent
+// or carries a forced sampling decision, it could be nil.
+func (t *Tracer) newSpanWithStart(name string, startAt time.Time, opts []SpanOption, parent *model.SpanContext) *span {
+	zipkinOpts := []zipkingo.SpanOption{zipkingo.StartTime(startAt)}
+	if parent != nil {
+		zipkinOpts = append(zipkinOpts, zipkingo.Parent(*parent))
+	}
+
+	s := newSpan(t, name, t.tracer.StartSpan(name, zipkinOpts...), startAt, opts)
+	if !s.isSampled() {
+		atomic.AddUint64(&t.notSampledTraces, 1)
+		return s
+	}
+
+	atomic.AddUint64(&t.sampledTraces, 1)
+	if t.buffer != nil {
+		// the decision is deferred only if it is made locally.
+		deferred := t.buffer.sampler != nil && (parent == nil || (parent.Sampled == nil && !parent.Debug))
+		t.buffer.registerRoot(s.Context(), deferred)
+	}
+	return s
 }
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+// mockCollector is a Zipkin collector advertising acceptTypes in response
+// to OPTIONS requests and recording the content type of received spans.
+type mockCollector struct {
+	*httptest.Server
+	lock         sync.Mutex
+	probes       int
+	contentTypes []string
+}
+
+func newMockCollector(acceptTypes string) *mockCollector {
+	mc := &mockCollector{}
+	mc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mc.lock.Lock()
+		defer mc.lock.Unlock()
+		if r.Method == http.MethodOptions {
+			mc.probes++
+			if acceptTypes != "" {
+				w.Header().Set("Accept-Post", acceptTypes)
+			}
+			return
+		}
+		mc.contentTypes = append(mc.contentTypes, r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return mc
+}
+
+func newTestSpec(serverURL string) *Spec {
+	return &Spec{
+		ServiceName: "test",
+		Zipkin: &ZipkinSpec{
+			ServerURL:  serverURL,
+			SampleRate: 1,
+		},
+	}
+}
+
+func TestEncodingNegotiation(t *testing.T) {
+	assert := assert.New(t)
+
+	mc := newMockCollector("application/json, application/x-protobuf")
+	defer mc.Close()
+
+	spec := newTestSpec(mc.URL)
+	spec.Zipkin.Encoding = EncodingAuto
+	tracer, err := New(spec)
+	assert.NoError(err)
+	tracer.NewSpan("test").Finish()
+	assert.NoError(tracer.Close())
+
+	assert.Equal(1, mc.probes)
+	assert.Equal([]string{contentTypeProto}, mc.contentTypes)
+
+	// the negotiated encoding is cached.
+	tracer, err = New(spec)
+	assert.NoError(err)
+	assert.NoError(tracer.Close())
+	assert.Equal(1, mc.probes)
+
+	// the collector advertises JSON only.
+	mc2 := newMockCollector("application/json")
+	assert.Equal(EncodingJSON, resolveEncoding(EncodingAuto, mc2.URL))
+
+	// fallback to JSON if probing fails.
+	mc2.Close()
+	negotiatedEncodings.Delete(mc2.URL)
+	assert.Equal(EncodingJSON, resolveEncoding(EncodingAuto, mc2.URL))
+	_, cached := negotiatedEncodings.Load(mc2.URL)
+	assert.False(cached)
+
+	// explicit encodings never probe.
+	assert.Equal(EncodingProto, resolveEncoding(EncodingProto, "http://127.0.0.1:1"))
+	assert.Equal(EncodingJSON, resolveEncoding("", "http://127.0.0.1:1"))
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tryout
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// har is the part of an HTTP Archive needed to build the requests and
+	// compare the responses, see
+	// http://www.softwareishard.com/blog/har-12-spec/.
+	har struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+
+	harEntry struct {
+		Request  harRequest  `json:"request"`
+		Response harResponse `json:"response"`
+	}
+
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	harRequest struct {
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Headers  []harNameValue `json:"headers"`
+		BodySize int64          `json:"bodySize"`
+		PostData *struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Comment  string `json:"comment"`
+		} `json:"postData"`
+	}
+
+	harResponse struct {
+		Status  int            `json:"status"`
+		Headers []harNameValue `json:"headers"`
+		Content struct {
+			Size     int64  `json:"size"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+			Comment  string `json:"comment"`
+		} `json:"content"`
+	}
+)
+
+// The comments of the bodies in the HAR files of the TrafficCapture.
+const (
+	harCommentBase64      = "base64 encoded"
+	harCommentNotCaptured = "body is not captured"
+)
+
+func readHAR(data []byte) (*har, error) {
+	h := &har{}
+	if err := codectool.UnmarshalJSON(data, h); err != nil {
+		return nil, fmt.Errorf("unmarshal HAR failed: %v", err)
+	}
+	return h, nil
+}
+
+// ReadHAR builds the request of the index-th entry of an HTTP Archive.
+func ReadHAR(data []byte, index int) (*http.Request, error) {
+	h, err := readHAR(data)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := h.Log.Entries
+	if index < 0 || index >= len(entries) {
+		return nil, fmt.Errorf("entry %d not found, the HAR has %d entries", index, len(entries))
+	}
+
+	req, err := entries[index].Request.build()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request of entry %d: %v", index, err)
+	}
+	return req, nil
+}
+
+// body returns the body of the request. The TrafficCapture base64 encodes
+// binary bodies and notes it in the comment, as HAR has no encoding field
+// for the post data.
+func (hr *harRequest) body() ([]byte, error) {
+	if hr.PostData == nil {
+		return nil, nil
+	}
+	if strings.Contains(hr.PostData.Comment, harCommentBase64) {
+		return base64.StdEncoding.DecodeString(hr.PostData.Text)
+	}
+	return []byte(hr.PostData.Text), nil
+}
+
+// truncated returns whether the body of the request is not recorded
+// completely.
+func (hr *harRequest) truncated() bool {
+	body, err := hr.body()
+	return err == nil && int64(len(body)) < hr.BodySize
+}
+
+func (hr *harRequest) build() (*http.Request, error) {
+	body, err := hr.body()
+	if err != nil {
+		return nil, fmt.Errorf("decode body failed: %v", err)
+	}
+	req, err := http.NewRequest(hr.Method, hr.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, header := range hr.Headers {
+		switch {
+		// the pseudo headers of HTTP/2, like ":authority".
+		case strings.HasPrefix(header.Name, ":"):
+		case strings.EqualFold(header.Name, "Content-Length"):
+		case strings.EqualFold(header.Name, "Host"):
+			req.Host = header.Value
+		default:
+			req.Header.Add(header.Name, header.Value)
+		}
+	}
+	if hr.PostData != nil && hr.PostData.MimeType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", hr.PostData.MimeType)
+	}
+	return req, nil
+}
+
+// header returns the first value of the response header, the name is case
+// insensitive.
+func (hr *harResponse) header(name string) (string, bool) {
+	for _, h := range hr.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// body returns the body of the response, and whether it is recorded
+// completely. It returns nil if the body is not recorded.
+func (hr *harResponse) body() ([]byte, bool, error) {
+	content := &hr.Content
+	if strings.Contains(content.Comment, harCommentNotCaptured) {
+		return nil, false, nil
+	}
+
+	body := []byte(content.Text)
+	if content.Encoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(content.Text); err != nil {
+			return nil, false, fmt.Errorf("decode body failed: %v", err)
+		}
+	}
+	return body, int64(len(body)) >= content.Size, nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tryout
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// proxyKind is the kind of the filters whose servers are replaced by the
+// mock backend.
+const proxyKind = "Proxy"
+
+// MockBackend is a local HTTP server which returns the same response for
+// all requests.
+type MockBackend struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ServeHTTP implements http.Handler.
+func (m *MockBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+
+	for k, v := range m.Header {
+		w.Header()[k] = v
+	}
+	code := m.StatusCode
+	if code == 0 {
+		code = http.StatusOK
+	}
+	w.WriteHeader(code)
+	w.Write(m.Body)
+}
+
+// start starts the mock backend, and returns its URL and a function to
+// close it.
+func (m *MockBackend) start() (string, func(), error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("start mock backend failed: %v", err)
+	}
+
+	srv := &http.Server{Handler: m}
+	go srv.Serve(l)
+	return "http://" + l.Addr().String(), func() { srv.Close() }, nil
+}
+
+// mockProxies replaces the servers of all pools of the Proxy filters in the
+// raw pipeline spec with the mock backend at url.
+func mockProxies(raw map[string]interface{}, url string) {
+	filters, _ := raw["filters"].([]interface{})
+	for _, f := range filters {
+		filter, ok := f.(map[string]interface{})
+		if !ok || filter["kind"] != proxyKind {
+			continue
+		}
+
+		pools, _ := filter["pools"].([]interface{})
+		for _, p := range pools {
+			if pool, ok := p.(map[string]interface{}); ok {
+				mockPool(pool, url)
+			}
+		}
+		if pool, ok := filter["mirrorPool"].(map[string]interface{}); ok {
+			mockPool(pool, url)
+		}
+	}
+}
+
+func mockPool(pool map[string]interface{}, url string) {
+	pool["servers"] = []interface{}{map[string]interface{}{"url": url}}
+	delete(pool, "serverTags")
+	delete(pool, "serviceRegistry")
+	delete(pool, "serviceName")
+}
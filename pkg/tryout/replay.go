@@ -0,0 +1,481 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tryout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ResultMatched means the response is the same as the recorded one.
+	ResultMatched = "matched"
+	// ResultMismatched means the response differs from the recorded one.
+	ResultMismatched = "mismatched"
+	// ResultFailed means the request could not be replayed.
+	ResultFailed = "failed"
+	// ResultSkipped means the request is not replayed, because it is not
+	// recorded completely.
+	ResultSkipped = "skipped"
+
+	// maxDiffs is the maximum number of differences reported per entry.
+	maxDiffs = 20
+	// maxDiffValueSize is the maximum size of a value in a difference.
+	maxDiffValueSize = 64
+)
+
+var arrayIndexRegexp = regexp.MustCompile(`\[\d+\]`)
+
+type (
+	// ReplayOptions are the options of a replay.
+	ReplayOptions struct {
+		// Target is the base URL the requests are sent to, the scheme and
+		// host of the recorded URLs are replaced by it, and its path is
+		// prepended to the recorded paths.
+		Target string
+		// Pipeline is the spec of a pipeline to run the requests locally,
+		// it is used instead of Target.
+		Pipeline []byte
+		// Host overrides the Host of the requests, the recorded Host is
+		// kept if it is empty.
+		Host string
+		// Rate is the number of requests sent per second, 0 means no
+		// limit.
+		Rate float64
+		// Concurrency is the number of requests in flight at most.
+		Concurrency int
+		// Timeout is the timeout of a request sent to the target.
+		Timeout time.Duration
+		// CompareHeaders are the names of the response headers to compare.
+		CompareHeaders []string
+		// IgnoreBody disables the comparison of the response bodies.
+		IgnoreBody bool
+		// IgnoreFields are the fields of JSON bodies not compared, like
+		// "data.updatedAt" or "items[*].id".
+		IgnoreFields []string
+	}
+
+	// ReplayReport is the report of a replay, only the entries not
+	// matched are listed.
+	ReplayReport struct {
+		Total      int            `json:"total"`
+		Matched    int            `json:"matched"`
+		Mismatched int            `json:"mismatched"`
+		Failed     int            `json:"failed"`
+		Skipped    int            `json:"skipped"`
+		Entries    []*EntryReport `json:"entries,omitempty"`
+	}
+
+	// EntryReport is the report of replaying a HAR entry.
+	EntryReport struct {
+		Index    int    `json:"index"`
+		Method   string `json:"method"`
+		URL      string `json:"url"`
+		Result   string `json:"result"`
+		Duration string `json:"duration,omitempty"`
+		Error    string `json:"error,omitempty"`
+		// Diffs are the differences between the recorded response and the
+		// replayed one, one difference per line.
+		Diffs []string `json:"diffs,omitempty"`
+	}
+
+	// replayResponse is a response of a replayed request.
+	replayResponse struct {
+		statusCode int
+		header     http.Header
+		body       []byte
+		// truncated is true if the body is not complete.
+		truncated bool
+	}
+
+	replayer struct {
+		opt    *ReplayOptions
+		target *url.URL
+		client *http.Client
+		ignore map[string]bool
+	}
+)
+
+// Replay replays the requests of an HTTP Archive, like the ones recorded
+// by the TrafficCapture, against a target or a local pipeline, and compares
+// the responses with the recorded ones.
+func Replay(data []byte, opt *ReplayOptions) (*ReplayReport, error) {
+	if (opt.Target == "") == (opt.Pipeline == nil) {
+		return nil, fmt.Errorf("one and only one of target and pipeline must be specified")
+	}
+	if opt.Rate < 0 {
+		return nil, fmt.Errorf("invalid rate %v", opt.Rate)
+	}
+
+	r := &replayer{opt: opt, ignore: map[string]bool{}}
+	if opt.Target != "" {
+		u, err := url.Parse(opt.Target)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid target %s", opt.Target)
+		}
+		r.target = u
+		r.client = &http.Client{
+			Timeout: opt.Timeout,
+			// the redirections are compared instead of being followed.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	for _, f := range opt.IgnoreFields {
+		r.ignore[f] = true
+	}
+
+	h, err := readHAR(data)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := h.Log.Entries
+	reports := make([]*EntryReport, len(entries))
+	r.run(len(entries), func(i int) {
+		reports[i] = r.replay(i, &entries[i])
+	})
+
+	report := &ReplayReport{Total: len(entries)}
+	for _, er := range reports {
+		switch er.Result {
+		case ResultMatched:
+			report.Matched++
+			continue
+		case ResultMismatched:
+			report.Mismatched++
+		case ResultFailed:
+			report.Failed++
+		case ResultSkipped:
+			report.Skipped++
+		}
+		report.Entries = append(report.Entries, er)
+	}
+	return report, nil
+}
+
+// run calls fn with the indexes from 0 to n-1 at the rate and the
+// concurrency of the options.
+func (r *replayer) run(n int, fn func(i int)) {
+	concurrency := r.opt.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var interval time.Duration
+	if r.opt.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / r.opt.Rate)
+	}
+
+	jobs := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		if d := time.Until(start.Add(time.Duration(i) * interval)); d > 0 {
+			time.Sleep(d)
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (r *replayer) replay(index int, entry *harEntry) *EntryReport {
+	report := &EntryReport{
+		Index:  index,
+		Method: entry.Request.Method,
+		URL:    entry.Request.URL,
+	}
+
+	fail := func(format string, a ...interface{}) *EntryReport {
+		report.Result = ResultFailed
+		report.Error = fmt.Sprintf(format, a...)
+		return report
+	}
+
+	if entry.Request.truncated() {
+		report.Result = ResultSkipped
+		report.Error = "request body is not recorded completely"
+		return report
+	}
+
+	req, err := entry.Request.build()
+	if err != nil {
+		return fail("invalid request: %v", err)
+	}
+	if r.opt.Host != "" {
+		req.Host = r.opt.Host
+	}
+	// the bodies are compared without content encoding, and the HTTP client
+	// decodes gzip responses only if Accept-Encoding is not set.
+	req.Header.Del("Accept-Encoding")
+
+	start := time.Now()
+	var resp *replayResponse
+	if r.target != nil {
+		resp, err = r.send(req)
+	} else {
+		resp, err = r.runPipeline(req)
+	}
+	report.Duration = time.Since(start).String()
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	report.Diffs, err = r.diff(&entry.Response, resp)
+	if err != nil {
+		return fail("invalid recorded response: %v", err)
+	}
+	if len(report.Diffs) > 0 {
+		report.Result = ResultMismatched
+	} else {
+		report.Result = ResultMatched
+	}
+	return report
+}
+
+// send sends the request to the target.
+func (r *replayer) send(req *http.Request) (*replayResponse, error) {
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	if prefix := strings.TrimSuffix(r.target.Path, "/"); prefix != "" {
+		req.URL.Path = prefix + req.URL.Path
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = prefix + req.URL.RawPath
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response body failed: %v", err)
+	}
+	return &replayResponse{
+		statusCode: resp.StatusCode,
+		header:     resp.Header,
+		body:       body,
+	}, nil
+}
+
+// runPipeline runs the pipeline locally with the request.
+func (r *replayer) runPipeline(req *http.Request) (*replayResponse, error) {
+	req.RemoteAddr = "127.0.0.1:0"
+	report, err := Run(r.opt.Pipeline, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if report.Error != "" {
+		return nil, fmt.Errorf("%s", report.Error)
+	}
+	if report.Response == nil {
+		return nil, fmt.Errorf("pipeline returns no response")
+	}
+
+	body := []byte(report.Response.Body)
+	return &replayResponse{
+		statusCode: report.Response.StatusCode,
+		header:     report.Response.Header,
+		body:       body,
+		truncated:  len(body) >= maxResponseBodySize,
+	}, nil
+}
+
+// diff returns the differences between the recorded response and the
+// replayed one. Nothing is compared if there's no recorded response, e.g.
+// the request was aborted when it was recorded.
+func (r *replayer) diff(recorded *harResponse, resp *replayResponse) ([]string, error) {
+	if recorded.Status == 0 {
+		return nil, nil
+	}
+
+	var diffs []string
+	if recorded.Status != resp.statusCode {
+		diffs = append(diffs, fmt.Sprintf("~ status: %d -> %d", recorded.Status, resp.statusCode))
+	}
+
+	for _, name := range r.opt.CompareHeaders {
+		name = http.CanonicalHeaderKey(name)
+		v1, ok1 := recorded.header(name)
+		v2, ok2 := resp.header.Get(name), len(resp.header.Values(name)) > 0
+		switch {
+		case ok1 && !ok2:
+			diffs = append(diffs, fmt.Sprintf("- header.%s: %s", name, v1))
+		case !ok1 && ok2:
+			diffs = append(diffs, fmt.Sprintf("+ header.%s: %s", name, v2))
+		case v1 != v2:
+			diffs = append(diffs, fmt.Sprintf("~ header.%s: %s -> %s", name, v1, v2))
+		}
+	}
+
+	if r.opt.IgnoreBody {
+		return diffs, nil
+	}
+
+	body, complete, err := recorded.body()
+	if err != nil {
+		return nil, err
+	}
+	if body == nil && !complete {
+		return diffs, nil
+	}
+	return append(diffs, r.diffBodies(body, !complete, resp.body, resp.truncated)...), nil
+}
+
+// diffBodies compares the bodies, JSON bodies are compared field by field,
+// and only the common prefix is compared if any body is truncated.
+func (r *replayer) diffBodies(b1 []byte, truncated1 bool, b2 []byte, truncated2 bool) []string {
+	if !truncated1 && !truncated2 && json.Valid(b1) && json.Valid(b2) {
+		var v1, v2 interface{}
+		json.Unmarshal(b1, &v1)
+		json.Unmarshal(b2, &v2)
+		var diffs []string
+		r.diffJSON("", v1, v2, &diffs)
+		return diffs
+	}
+
+	n := len(b1)
+	if len(b2) < n {
+		n = len(b2)
+	}
+	for i := 0; i < n; i++ {
+		if b1[i] != b2[i] {
+			return []string{fmt.Sprintf("~ body: differs at byte %d", i)}
+		}
+	}
+
+	// the bodies are different if the shorter one is complete.
+	if (len(b1) < len(b2) && !truncated1) || (len(b2) < len(b1) && !truncated2) {
+		return []string{fmt.Sprintf("~ body.length: %d -> %d", len(b1), len(b2))}
+	}
+	return nil
+}
+
+// diffJSON compares the JSON values at the path recursively.
+func (r *replayer) diffJSON(path string, v1, v2 interface{}, diffs *[]string) {
+	if len(*diffs) >= maxDiffs || r.ignored(path) {
+		return
+	}
+
+	field := "body"
+	if path != "" {
+		field += "." + path
+	}
+	add := func(format string, a ...interface{}) {
+		*diffs = append(*diffs, fmt.Sprintf(format, a...))
+	}
+
+	switch o1 := v1.(type) {
+	case map[string]interface{}:
+		o2, ok := v2.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(o1)+len(o2))
+		for k := range o1 {
+			keys = append(keys, k)
+		}
+		for k := range o2 {
+			if _, ok := o1[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			c1, ok1 := o1[k]
+			c2, ok2 := o2[k]
+			switch {
+			case r.ignored(child) || len(*diffs) >= maxDiffs:
+			case !ok1:
+				add("+ body.%s: %s", child, jsonString(c2))
+			case !ok2:
+				add("- body.%s: %s", child, jsonString(c1))
+			default:
+				r.diffJSON(child, c1, c2, diffs)
+			}
+		}
+		return
+
+	case []interface{}:
+		a2, ok := v2.([]interface{})
+		if !ok {
+			break
+		}
+		if len(o1) != len(a2) {
+			add("~ %s.length: %d -> %d", field, len(o1), len(a2))
+		}
+		for i := 0; i < len(o1) && i < len(a2); i++ {
+			r.diffJSON(fmt.Sprintf("%s[%d]", path, i), o1[i], a2[i], diffs)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(v1, v2) {
+		add("~ %s: %s -> %s", field, jsonString(v1), jsonString(v2))
+	}
+}
+
+// ignored returns whether the field at the path is ignored, the indexes of
+// arrays could be written as "[*]".
+func (r *replayer) ignored(path string) bool {
+	if len(r.ignore) == 0 || path == "" {
+		return false
+	}
+	return r.ignore[path] || r.ignore[arrayIndexRegexp.ReplaceAllString(path, "[*]")]
+}
+
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	if len(data) > maxDiffValueSize {
+		return string(data[:maxDiffValueSize]) + "..."
+	}
+	return string(data)
+}
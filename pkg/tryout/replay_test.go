@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tryout
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const replayHAR = `{"log": {"entries": [
+{
+	"request": {"method": "GET", "url": "http://example.com/users/1", "headers": []},
+	"response": {"status": 200, "headers": [{"name": "Content-Type", "value": "application/json"}],
+		"content": {"size": 35, "text": "{\"id\": 1, \"name\": \"bob\", \"ts\": 100}"}}
+},
+{
+	"request": {"method": "POST", "url": "http://example.com/echo", "headers": [], "bodySize": 5,
+		"postData": {"mimeType": "text/plain", "text": "aGVsbG8=", "comment": "base64 encoded"}},
+	"response": {"status": 200, "headers": [{"name": "Content-Type", "value": "text/plain"}], "content": {"size": 5, "text": "hello"}}
+},
+{
+	"request": {"method": "POST", "url": "http://example.com/echo", "headers": [], "bodySize": 100,
+		"postData": {"mimeType": "text/plain", "text": "hello", "comment": "truncated to 5 bytes"}},
+	"response": {"status": 200, "headers": [], "content": {"size": 100, "text": "hello"}}
+},
+{
+	"request": {"method": "GET", "url": "http://example.com/users/2", "headers": []},
+	"response": {"status": 200, "headers": [], "content": {"size": 0, "comment": "body is not captured"}}
+},
+{
+	"request": {"method": "GET", "url": "http://example.com/users/3", "headers": []},
+	"response": {"status": 200, "headers": [{"name": "Content-Type", "value": "application/json"}],
+		"content": {"size": 33, "text": "{\"id\": 3, \"name\": \"tom\", \"ts\": 1}"}}
+}
+]}}`
+
+func TestReplayTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	var hosts []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		switch r.URL.Path {
+		case "/v2/users/1":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"name": "bob", "ts": 200, "id": 1}`))
+		case "/v2/users/2":
+		case "/v2/users/3":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(`{"id": 3, "name": "jerry", "ts": 2}`))
+		case "/v2/echo":
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			io.Copy(w, r.Body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	start := time.Now()
+	report, err := Replay([]byte(replayHAR), &ReplayOptions{
+		Target:         svr.URL + "/v2/",
+		Rate:           100,
+		CompareHeaders: []string{"content-type"},
+		IgnoreFields:   []string{"ts"},
+	})
+	assert.NoError(err)
+	assert.GreaterOrEqual(time.Since(start), 40*time.Millisecond)
+
+	assert.Equal(5, report.Total)
+	assert.Equal(3, report.Matched)
+	assert.Equal(1, report.Mismatched)
+	assert.Equal(1, report.Skipped)
+	assert.Len(report.Entries, 2)
+	assert.Equal(2, report.Entries[0].Index)
+	assert.Equal(ResultSkipped, report.Entries[0].Result)
+
+	mismatched := report.Entries[1]
+	assert.Equal(4, mismatched.Index)
+	assert.Equal([]string{
+		"~ header.Content-Type: application/json -> text/plain",
+		`~ body.name: "tom" -> "jerry"`,
+	}, mismatched.Diffs)
+
+	assert.Equal("example.com", hosts[0])
+
+	_, err = Replay([]byte(replayHAR), &ReplayOptions{})
+	assert.Error(err)
+	_, err = Replay([]byte(replayHAR), &ReplayOptions{Target: "localhost"})
+	assert.Error(err)
+}
+
+func TestReplayPipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	// the backend of the pipeline is not available.
+	report, err := Replay([]byte(replayHAR), &ReplayOptions{
+		Pipeline:    []byte(pipelineYAML),
+		Concurrency: 2,
+		IgnoreBody:  true,
+	})
+	assert.NoError(err)
+	assert.Equal(5, report.Total)
+	assert.Equal(4, report.Mismatched)
+	assert.Equal([]string{"~ status: 200 -> 503"}, report.Entries[0].Diffs)
+}
+
+func TestDiffBodies(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &replayer{
+		opt:    &ReplayOptions{},
+		ignore: map[string]bool{"items[*].ts": true},
+	}
+
+	assert.Empty(r.diffBodies([]byte("hello"), false, []byte("hello"), false))
+	assert.Equal([]string{"~ body: differs at byte 1"}, r.diffBodies([]byte("hello"), false, []byte("hallo"), false))
+	assert.Equal([]string{"~ body.length: 5 -> 7"}, r.diffBodies([]byte("hello"), false, []byte("hello!!"), false))
+	assert.Empty(r.diffBodies([]byte("hello"), true, []byte("hello!!"), false))
+	assert.Empty(r.diffBodies([]byte("hello!!"), false, []byte("hel"), true))
+
+	b1 := []byte(`{"items": [{"id": 1, "ts": 1}, {"id": 2, "ts": 2}], "total": 2, "next": "a"}`)
+	b2 := []byte(`{"items": [{"id": 1, "ts": 3}], "total": 1, "prev": "b"}`)
+	assert.Equal([]string{
+		"~ body.items.length: 2 -> 1",
+		`- body.next: "a"`,
+		`+ body.prev: "b"`,
+		"~ body.total: 2 -> 1",
+	}, r.diffBodies(b1, false, b2, false))
+
+	assert.Equal([]string{`~ body: {"id":1} -> [1]`}, r.diffBodies([]byte(`{"id": 1}`), false, []byte(`[1]`), false))
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tryout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+// maxBodySnapshotSize is the maximum size of the bodies in a snapshot.
+const maxBodySnapshotSize = 256
+
+// snapshot is a flat view of the requests and responses of a context, the
+// keys are like "request.header.X-Foo" or "response[ns].status".
+type snapshot map[string]string
+
+func takeSnapshot(ctx *context.Context) snapshot {
+	s := snapshot{}
+
+	for ns, req := range ctx.Requests() {
+		r, ok := req.(*httpprot.Request)
+		if !ok {
+			continue
+		}
+		prefix := keyPrefix("request", ns)
+		s[prefix+"method"] = r.Method()
+		s[prefix+"url"] = r.URL().String()
+		for k, v := range r.HTTPHeader() {
+			s[prefix+"header."+k] = strings.Join(v, ", ")
+		}
+		if body := bodyString(r.IsStream(), r.RawPayload()); body != "" {
+			s[prefix+"body"] = body
+		}
+	}
+
+	for ns, resp := range ctx.Responses() {
+		r, ok := resp.(*httpprot.Response)
+		if !ok {
+			continue
+		}
+		prefix := keyPrefix("response", ns)
+		s[prefix+"status"] = fmt.Sprintf("%d", r.StatusCode())
+		for k, v := range r.HTTPHeader() {
+			s[prefix+"header."+k] = strings.Join(v, ", ")
+		}
+		if body := bodyString(r.IsStream(), r.RawPayload()); body != "" {
+			s[prefix+"body"] = body
+		}
+	}
+
+	return s
+}
+
+func keyPrefix(name, ns string) string {
+	if ns == context.DefaultNamespace {
+		return name + "."
+	}
+	return name + "[" + ns + "]."
+}
+
+func bodyString(stream bool, body []byte) string {
+	switch {
+	case stream:
+		return "<stream>"
+	case len(body) == 0:
+		return ""
+	case !utf8.Valid(body):
+		return fmt.Sprintf("<binary %d bytes>", len(body))
+	case len(body) > maxBodySnapshotSize:
+		return fmt.Sprintf("%s...<%d bytes>", body[:maxBodySnapshotSize], len(body))
+	}
+	return string(body)
+}
+
+// diffSnapshots returns the changes from the old snapshot to the new one,
+// sorted by keys. The lines start with "+" for added values, "-" for
+// removed values and "~" for changed values.
+func diffSnapshots(old, new snapshot) []string {
+	keys := make([]string, 0, len(new))
+	for k := range new {
+		keys = append(keys, k)
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diffs []string
+	for _, k := range keys {
+		ov, inOld := old[k]
+		nv, inNew := new[k]
+		switch {
+		case !inOld:
+			diffs = append(diffs, fmt.Sprintf("+ %s: %s", k, nv))
+		case !inNew:
+			diffs = append(diffs, fmt.Sprintf("- %s: %s", k, ov))
+		case ov != nv:
+			diffs = append(diffs, fmt.Sprintf("~ %s: %s -> %s", k, ov, nv))
+		}
+	}
+	return diffs
+}
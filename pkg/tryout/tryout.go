@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tryout runs a pipeline locally with a sample request, and reports
+// the result and the mutations of every filter, so that the filter chains
+// could be debugged without being deployed.
+package tryout
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// maxResponseBodySize is the maximum size of the response body to report.
+const maxResponseBodySize = 64 << 10
+
+type (
+	// Options are the options of a try out.
+	Options struct {
+		// Mock replaces the servers of the Proxy filters with a local mock
+		// backend, the real backends are used if it is nil.
+		Mock *MockBackend
+	}
+
+	// Report is the report of a try out.
+	Report struct {
+		Pipeline string          `json:"pipeline"`
+		Result   string          `json:"result"`
+		Error    string          `json:"error,omitempty"`
+		Filters  []*FilterReport `json:"filters"`
+		Response *ResponseReport `json:"response,omitempty"`
+	}
+
+	// FilterReport is the report of a filter execution.
+	FilterReport struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind"`
+		Result   string `json:"result,omitempty"`
+		Duration string `json:"duration"`
+		Error    string `json:"error,omitempty"`
+		// Mutations are the changes of the requests and responses made by
+		// the filter, one change per line.
+		Mutations []string `json:"mutations,omitempty"`
+	}
+
+	// ResponseReport is the report of the final response.
+	ResponseReport struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+	}
+
+	// observer records the filter executions to the report.
+	observer struct {
+		report  *Report
+		current *FilterReport
+		before  snapshot
+	}
+)
+
+// BeforeFilter implements pipeline.FilterObserver.
+func (o *observer) BeforeFilter(ctx *context.Context, name, kind string) {
+	o.current = &FilterReport{Name: name, Kind: kind}
+	o.report.Filters = append(o.report.Filters, o.current)
+	o.before = takeSnapshot(ctx)
+}
+
+// AfterFilter implements pipeline.FilterObserver.
+func (o *observer) AfterFilter(ctx *context.Context, stat *pipeline.FilterStat) {
+	o.current.Result = stat.Result
+	o.current.Duration = stat.Duration.String()
+	o.current.Mutations = diffSnapshots(o.before, takeSnapshot(ctx))
+	o.current = nil
+}
+
+// Run runs the pipeline defined by config, a YAML or JSON spec, with the
+// request. An error is returned if the pipeline can not be created, while
+// the errors of the filters are recorded in the report.
+func Run(config []byte, req *http.Request, opt *Options) (*Report, error) {
+	var raw map[string]interface{}
+	if err := codectool.Unmarshal(config, &raw); err != nil {
+		return nil, fmt.Errorf("unmarshal pipeline spec failed: %v", err)
+	}
+	if raw["kind"] != pipeline.Kind {
+		return nil, fmt.Errorf("kind %v is not %s", raw["kind"], pipeline.Kind)
+	}
+
+	if opt != nil && opt.Mock != nil {
+		url, closeFn, err := opt.Mock.start()
+		if err != nil {
+			return nil, err
+		}
+		defer closeFn()
+		mockProxies(raw, url)
+	}
+
+	spec, err := supervisor.NewSpec(string(codectool.MustMarshalJSON(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline spec: %v", err)
+	}
+
+	p, err := newPipeline(spec)
+	if err != nil {
+		return nil, fmt.Errorf("create pipeline failed: %v", err)
+	}
+	defer p.Close()
+
+	httpreq, _ := httpprot.NewRequest(req)
+	if err := httpreq.FetchPayload(0); err != nil {
+		return nil, fmt.Errorf("read request body failed: %v", err)
+	}
+
+	report := &Report{Pipeline: spec.Name()}
+	o := &observer{report: report}
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetData(pipeline.FilterObserverKey, o)
+	ctx.SetRequest(context.DefaultNamespace, httpreq)
+	defer ctx.Finish()
+
+	report.Result, report.Error = handle(p, ctx, o)
+	report.Response = reportResponse(ctx)
+	return report, nil
+}
+
+func newPipeline(spec *supervisor.Spec) (p *pipeline.Pipeline, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	p = &pipeline.Pipeline{}
+	p.Init(spec, nil)
+	return p, nil
+}
+
+// handle handles the request, the panic of a filter is recovered and
+// reported as an error.
+func handle(p *pipeline.Pipeline, ctx *context.Context, o *observer) (result string, errMsg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			errMsg = fmt.Sprintf("%v", r)
+			if o.current != nil {
+				o.current.Error = errMsg
+				errMsg = fmt.Sprintf("filter %s panicked: %v", o.current.Name, r)
+			}
+		}
+	}()
+
+	return p.Handle(ctx), ""
+}
+
+func reportResponse(ctx *context.Context) *ResponseReport {
+	resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if !ok || resp == nil {
+		return nil
+	}
+
+	report := &ResponseReport{
+		StatusCode: resp.StatusCode(),
+		Header:     resp.HTTPHeader(),
+	}
+	if resp.IsStream() {
+		body, _ := io.ReadAll(io.LimitReader(resp.GetPayload(), maxResponseBodySize))
+		report.Body = string(body)
+	} else {
+		body := resp.RawPayload()
+		if len(body) > maxResponseBodySize {
+			body = body[:maxResponseBodySize]
+		}
+		report.Body = string(body)
+	}
+	return report
+}
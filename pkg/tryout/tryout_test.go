@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tryout
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/megaease/easegress/pkg/filters/proxy"
+	_ "github.com/megaease/easegress/pkg/filters/requestadaptor"
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const pipelineYAML = `
+kind: Pipeline
+name: demo
+flow:
+- filter: adaptor
+- filter: proxy
+filters:
+- name: adaptor
+  kind: RequestAdaptor
+  path:
+    addPrefix: /api
+  header:
+    set:
+      X-Adapt: "yes"
+- name: proxy
+  kind: Proxy
+  pools:
+  - servers:
+    - url: http://127.0.0.1:1
+`
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/users", nil)
+	mock := &MockBackend{
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"X-Mock": []string{"1"}},
+		Body:       []byte("hello"),
+	}
+	report, err := Run([]byte(pipelineYAML), req, &Options{Mock: mock})
+	assert.NoError(err)
+	assert.Equal("demo", report.Pipeline)
+	assert.Empty(report.Error)
+	assert.Len(report.Filters, 2)
+
+	adaptor := report.Filters[0]
+	assert.Equal("RequestAdaptor", adaptor.Kind)
+	assert.Contains(adaptor.Mutations, "+ request.header.X-Adapt: yes")
+	assert.Contains(adaptor.Mutations, "~ request.url: http://localhost/users -> http://localhost/api/users")
+
+	proxy := report.Filters[1]
+	assert.Contains(proxy.Mutations, "+ response.status: 201")
+	assert.Contains(proxy.Mutations, "+ response.header.X-Mock: 1")
+
+	assert.Equal(http.StatusCreated, report.Response.StatusCode)
+	assert.Equal("hello", report.Response.Body)
+
+	_, err = Run([]byte("kind: HTTPServer\nname: demo"), req, nil)
+	assert.Error(err)
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	assert := assert.New(t)
+
+	old := snapshot{"a": "1", "b": "2", "c": "3"}
+	new := snapshot{"a": "1", "b": "4", "d": "5"}
+	assert.Equal([]string{"~ b: 2 -> 4", "- c: 3", "+ d: 5"}, diffSnapshots(old, new))
+	assert.Nil(diffSnapshots(old, old))
+
+	assert.Equal("<stream>", bodyString(true, nil))
+	assert.Equal("<binary 2 bytes>", bodyString(false, []byte{0xff, 0xfe}))
+	assert.Len(bodyString(false, make([]byte, 1024)), maxBodySnapshotSize+len("...<1024 bytes>"))
+}
+
+func TestReadHAR(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte(`{"log": {"entries": [{"request": {
+		"method": "POST",
+		"url": "https://example.com/users?id=1",
+		"headers": [
+			{"name": ":authority", "value": "example.com"},
+			{"name": "Host", "value": "example.com"},
+			{"name": "Content-Length", "value": "2"},
+			{"name": "X-Foo", "value": "bar"}
+		],
+		"postData": {"mimeType": "application/json", "text": "{}"}
+	}}]}}`)
+
+	req, err := ReadHAR(data, 0)
+	assert.NoError(err)
+	assert.Equal(http.MethodPost, req.Method)
+	assert.Equal("/users", req.URL.Path)
+	assert.Equal("example.com", req.Host)
+	assert.Equal("bar", req.Header.Get("X-Foo"))
+	assert.Equal("application/json", req.Header.Get("Content-Type"))
+	assert.Empty(req.Header.Get(":authority"))
+	assert.Equal(int64(2), req.ContentLength)
+
+	_, err = ReadHAR(data, 1)
+	assert.Error(err)
+}
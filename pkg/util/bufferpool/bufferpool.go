@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bufferpool provides pooled byte buffers, to reduce the allocations
+// of the temporary buffers when handling requests.
+package bufferpool
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledSize is the max capacity of the buffers put back to the pool,
+// larger buffers are dropped so that they don't pin too much memory.
+const maxPooledSize = 1 << 20
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// Get returns an empty buffer from the pool.
+func Get() *bytes.Buffer {
+	return pool.Get().(*bytes.Buffer)
+}
+
+// Put resets buf and puts it back to the pool, buf must not be used after
+// that.
+func Put(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledSize {
+		return
+	}
+	buf.Reset()
+	pool.Put(buf)
+}
+
+// ReadAll reads from r until an error or EOF like io.ReadAll. The data is
+// read into a pooled buffer and copied to a slice of the exact size, so
+// growing the buffer doesn't allocate.
+func ReadAll(r io.Reader) ([]byte, error) {
+	buf := Get()
+	defer Put(buf)
+
+	_, err := buf.ReadFrom(r)
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+	return data, err
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bufferpool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAll(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := ReadAll(strings.NewReader("hello world"))
+	assert.NoError(err)
+	assert.Equal("hello world", string(data))
+	assert.Equal(len(data), cap(data))
+
+	// the returned data is not shared with the pooled buffer.
+	data2, err := ReadAll(strings.NewReader("HELLO"))
+	assert.NoError(err)
+	assert.Equal("hello world", string(data))
+	assert.Equal("HELLO", string(data2))
+
+	data, err = ReadAll(strings.NewReader(""))
+	assert.NoError(err)
+	assert.NotNil(data)
+	assert.Empty(data)
+
+	r := io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(fmt.Errorf("dummy")))
+	data, err = ReadAll(r)
+	assert.Error(err)
+	assert.Equal("abc", string(data))
+}
+
+func TestPut(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := Get()
+	buf.WriteString("abc")
+	Put(buf)
+	assert.Equal(0, buf.Len())
+
+	// too large buffers are not reset or pooled.
+	buf = bytes.NewBuffer(make([]byte, maxPooledSize+1))
+	Put(buf)
+	assert.Equal(maxPooledSize+1, buf.Len())
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	data := strings.Repeat("a", 64*1024)
+
+	b.Run("io.ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			io.ReadAll(strings.NewReader(data))
+		}
+	})
+
+	b.Run("bufferpool.ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ReadAll(strings.NewReader(data))
+		}
+	})
+}
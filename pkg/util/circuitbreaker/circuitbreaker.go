@@ -266,6 +266,9 @@ type (
 		OldState string
 		NewState string
 		Reason   string
+		// Forced is true if the transition is caused by SetState or Reset
+		// instead of the results of the calls.
+		Forced bool
 	}
 
 	// EventListenerFunc is a listener function to listen state transit event
@@ -336,11 +339,45 @@ func New(policy *Policy) *CircuitBreaker {
 	return cb
 }
 
+// String returns the name of the state.
+func (s State) String() string {
+	if int(s) < len(stateStrings) {
+		return stateStrings[s]
+	}
+	return "Unknown"
+}
+
+// ParseState returns the state of the name, it returns false if the name
+// is unknown.
+func ParseState(name string) (State, bool) {
+	for i, s := range stateStrings {
+		if s == name {
+			return State(i), true
+		}
+	}
+	return StateDisabled, false
+}
+
 // SetState sets the state of the circuit breaker to `state`
 func (cb *CircuitBreaker) SetState(state State) {
 	cb.lock.Lock()
 	defer cb.lock.Unlock()
-	cb.transitTo(state, "force transition")
+	cb.transit(state, "force transition", true)
+}
+
+// Reset transits the circuit breaker to closed and discards the recorded
+// results, even if it is already closed.
+func (cb *CircuitBreaker) Reset() {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if cb.state != StateClosed {
+		cb.transit(StateClosed, "reset", true)
+		return
+	}
+	// the state doesn't change, so there's no event.
+	cb.transitTime = nowFunc()
+	cb.stateID++
+	cb.resetWindow()
 }
 
 // SetStateListener sets an event listener for the CircuitBreaker
@@ -352,6 +389,10 @@ func (cb *CircuitBreaker) SetStateListener(listener EventListenerFunc) {
 
 // transitTo sets the state of the CircuitBreaker to `state`
 func (cb *CircuitBreaker) transitTo(state State, reason string) {
+	cb.transit(state, reason, false)
+}
+
+func (cb *CircuitBreaker) transit(state State, reason string, forced bool) {
 	oldState := cb.state
 	if state == oldState {
 		return
@@ -362,12 +403,7 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 	cb.stateID++
 
 	if state == StateClosed {
-		// recreate the window to remove all existing results to avoid jitter
-		if cb.policy.SlidingWindowType == CountBased {
-			cb.window = NewCountBasedWindow(cb.policy.SlidingWindowSize)
-		} else {
-			cb.window = NewTimeBasedWindow(cb.policy.SlidingWindowSize)
-		}
+		cb.resetWindow()
 	} else if state == StateHalfOpen {
 		// always use count based window in half open state to avoid results being evicted
 		cb.window = NewCountBasedWindow(cb.policy.PermittedNumberOfCallsInHalfOpen)
@@ -380,6 +416,7 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 			OldState: stateStrings[oldState],
 			NewState: stateStrings[state],
 			Reason:   reason,
+			Forced:   forced,
 		}
 		// create a new goroutine as current function is called inside a lock
 		// and we don't know how much time the listener function will cost
@@ -387,11 +424,35 @@ func (cb *CircuitBreaker) transitTo(state State, reason string) {
 	}
 }
 
+// resetWindow recreates the window to remove all existing results to avoid
+// jitter.
+func (cb *CircuitBreaker) resetWindow() {
+	if cb.policy.SlidingWindowType == CountBased {
+		cb.window = NewCountBasedWindow(cb.policy.SlidingWindowSize)
+	} else {
+		cb.window = NewTimeBasedWindow(cb.policy.SlidingWindowSize)
+	}
+}
+
 // State returns the state of the circuit breaker
 func (cb *CircuitBreaker) State() State {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
 	return cb.state
 }
 
+// Metrics returns the time of the last state transition, and the failure
+// rate, the slow call rate and the number of the calls recorded in the
+// window of current state.
+func (cb *CircuitBreaker) Metrics() (transitTime time.Time, failureRate, slowCallRate uint8, numOfCalls uint32) {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+	if numOfCalls = cb.window.Total(); numOfCalls > 0 {
+		failureRate, slowCallRate = cb.window.FailureRate(), cb.window.SlowRate()
+	}
+	return cb.transitTime, failureRate, slowCallRate, numOfCalls
+}
+
 // AcquirePermission acquires a permission from the circuit breaker
 // returns true & stateID if the request is permitted
 // returns false & stateID if the request is rejected
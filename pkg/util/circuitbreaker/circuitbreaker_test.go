@@ -222,3 +222,50 @@ func TestTimeBased(t *testing.T) {
 		t.Errorf("circuit breaker state should be Open")
 	}
 }
+
+func TestResetAndMetrics(t *testing.T) {
+	policy := NewPolicy(50, 60, CountBased, 20, 5, 10,
+		10*time.Millisecond, 5*time.Second, 5*time.Second)
+	cb := New(policy)
+
+	events := make(chan *Event, 10)
+	cb.SetStateListener(func(e *Event) { events <- e })
+
+	for i := 0; i < 4; i++ {
+		_, stateID := cb.AcquirePermission()
+		cb.RecordResult(stateID, i%2 == 0, time.Millisecond)
+	}
+	_, failureRate, slowCallRate, numOfCalls := cb.Metrics()
+	if failureRate != 50 || slowCallRate != 0 || numOfCalls != 4 {
+		t.Errorf("unexpected metrics: %d, %d, %d", failureRate, slowCallRate, numOfCalls)
+	}
+
+	// reset a closed circuit breaker clears the window without events.
+	cb.Reset()
+	if _, _, _, numOfCalls = cb.Metrics(); numOfCalls != 0 {
+		t.Errorf("the window should be cleared")
+	}
+
+	cb.SetState(StateForceOpen)
+	if e := <-events; !e.Forced || e.NewState != "ForceOpen" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if permitted, _ := cb.AcquirePermission(); permitted {
+		t.Errorf("acquire permission should fail")
+	}
+
+	cb.Reset()
+	if e := <-events; !e.Forced || e.NewState != "Closed" {
+		t.Errorf("unexpected event %+v", e)
+	}
+	if cb.State() != StateClosed {
+		t.Errorf("circuit breaker state should be Closed")
+	}
+
+	if s, ok := ParseState("HalfOpen"); !ok || s != StateHalfOpen || s.String() != "HalfOpen" {
+		t.Errorf("failed to parse state")
+	}
+	if _, ok := ParseState("unknown"); ok {
+		t.Errorf("unknown state should not be parsed")
+	}
+}
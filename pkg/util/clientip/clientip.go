@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package clientip resolves the IP addresses of the clients behind trusted
+// proxies.
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/yl2chen/cidranger"
+
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+const (
+	// HeaderXForwardedFor is the X-Forwarded-For header.
+	HeaderXForwardedFor = "X-Forwarded-For"
+	// HeaderXRealIP is the X-Real-IP header.
+	HeaderXRealIP = "X-Real-IP"
+	// HeaderForwarded is the Forwarded header defined by RFC 7239.
+	HeaderForwarded = "Forwarded"
+	// HeaderCFConnectingIP is the CF-Connecting-IP header of Cloudflare.
+	HeaderCFConnectingIP = "CF-Connecting-IP"
+)
+
+var defaultHeaders = []string{HeaderXForwardedFor, HeaderXRealIP}
+
+type (
+	// Spec describes how to resolve the client IP.
+	Spec struct {
+		// TrustedCIDRs are the proxies whose headers are trusted.
+		TrustedCIDRs []string `json:"trustedCIDRs" jsonschema:"required,minItems=1,uniqueItems=true,format=ipcidr-array"`
+		// Headers are checked in order, the first one which has a valid
+		// client IP wins.
+		Headers []string `json:"headers,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Resolver resolves the client IP of the requests.
+	Resolver struct {
+		trusted cidranger.Ranger
+		headers []string
+	}
+)
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	for _, h := range spec.Headers {
+		if strings.TrimSpace(h) == "" {
+			return fmt.Errorf("empty header name")
+		}
+	}
+	return nil
+}
+
+// NewResolver creates a Resolver, the spec must be valid.
+func NewResolver(spec *Spec) *Resolver {
+	r := &Resolver{
+		trusted: ipfilter.NewRanger(spec.TrustedCIDRs),
+		headers: defaultHeaders,
+	}
+	if len(spec.Headers) > 0 {
+		r.headers = nil
+		for _, h := range spec.Headers {
+			r.headers = append(r.headers, textproto.CanonicalMIMEHeaderKey(h))
+		}
+	}
+	return r
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	ok, err := r.trusted.Contains(ip)
+	return err == nil && ok
+}
+
+// Resolve returns the client IP of the request. The headers are only
+// used if the request is from a trusted proxy, otherwise, the IP of the
+// remote address is returned.
+func (r *Resolver) Resolve(req *http.Request) string {
+	remote, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remote = req.RemoteAddr
+	}
+	remoteIP := net.ParseIP(remote)
+	if remoteIP == nil || !r.isTrusted(remoteIP) {
+		return remote
+	}
+
+	for _, h := range r.headers {
+		values := req.Header.Values(h)
+		if len(values) == 0 {
+			continue
+		}
+
+		var ip net.IP
+		switch h {
+		case HeaderXForwardedFor:
+			ip = r.fromList(splitList(values))
+		case HeaderForwarded:
+			ip = r.fromList(forwardedFor(values))
+		default:
+			ip = parseIP(values[len(values)-1])
+		}
+		if ip != nil {
+			return ip.String()
+		}
+	}
+	return remote
+}
+
+// fromList returns the rightmost untrusted IP of the list, which is
+// appended by the proxies, or the leftmost one if all of them are
+// trusted.
+func (r *Resolver) fromList(list []string) net.IP {
+	var ip net.IP
+	for i := len(list) - 1; i >= 0; i-- {
+		ip = parseIP(list[i])
+		if ip == nil {
+			// the left part is forged or corrupted.
+			return nil
+		}
+		if !r.isTrusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			list = append(list, strings.TrimSpace(s))
+		}
+	}
+	return list
+}
+
+// forwardedFor returns the "for" parameters of the Forwarded headers.
+func forwardedFor(values []string) []string {
+	var list []string
+	for _, elem := range splitList(values) {
+		for _, pair := range strings.Split(elem, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(k, "for") {
+				list = append(list, strings.Trim(v, `"`))
+			}
+		}
+	}
+	return list
+}
+
+// parseIP parses an IP which may have a port, and IPv6 addresses may be
+// in brackets.
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	return net.ParseIP(s)
+}
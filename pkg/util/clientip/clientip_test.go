@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientip
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{TrustedCIDRs: []string{"10.0.0.0/8"}, Headers: []string{" "}}).Validate())
+
+	resolve := func(r *Resolver, remoteAddr string, headers map[string]string) string {
+		req, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Add(k, v)
+		}
+		return r.Resolve(req)
+	}
+
+	r := NewResolver(&Spec{TrustedCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"}})
+
+	// the headers of untrusted peers are ignored.
+	assert.Equal("1.1.1.1", resolve(r, "1.1.1.1:80", map[string]string{"X-Forwarded-For": "2.2.2.2"}))
+	// the rightmost untrusted IP is the client IP.
+	assert.Equal("3.3.3.3", resolve(r, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "2.2.2.2, 3.3.3.3, 10.0.0.2"}))
+	// all IPs are trusted.
+	assert.Equal("10.0.0.3", resolve(r, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}))
+	// forged values.
+	assert.Equal("10.0.0.1", resolve(r, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "unknown, 10.0.0.2"}))
+	// X-Real-IP is the fallback by default.
+	assert.Equal("4.4.4.4", resolve(r, "[2001:db8::1]:80", map[string]string{"X-Real-Ip": "4.4.4.4"}))
+	// Forwarded is not used by default.
+	assert.Equal("10.0.0.1", resolve(r, "10.0.0.1:80", map[string]string{"Forwarded": "for=5.5.5.5"}))
+
+	r = NewResolver(&Spec{
+		TrustedCIDRs: []string{"10.0.0.1"},
+		Headers:      []string{"cf-connecting-ip", "forwarded"},
+	})
+	assert.Equal("6.6.6.6", resolve(r, "10.0.0.1:80", map[string]string{
+		"CF-Connecting-IP": "6.6.6.6",
+		"Forwarded":        "for=5.5.5.5",
+	}))
+	assert.Equal("2001:db8::1", resolve(r, "10.0.0.1:80", map[string]string{
+		"Forwarded": `for=5.5.5.5, for="[2001:db8::1]:4711";proto=https`,
+	}))
+	assert.Equal("10.0.0.1", resolve(r, "10.0.0.1:80", map[string]string{"X-Forwarded-For": "5.5.5.5"}))
+}
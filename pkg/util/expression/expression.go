@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package expression provides the boolean expressions on the requests in
+// the Common Expression Language (CEL), e.g.
+//
+//	request.header["x-debug"] == "1" && request.method == "POST"
+//
+// The expressions are compiled when the specs are validated, so that the
+// syntax and type errors are reported before the specs are applied.
+package expression
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+// Expression is a compiled boolean expression.
+type Expression struct {
+	src string
+	prg cel.Program
+}
+
+var env *cel.Env
+
+func init() {
+	var err error
+	env, err = cel.NewEnv(cel.Declarations(
+		decls.NewVar("request", decls.NewMapType(decls.String, decls.Dyn)),
+	))
+	if err != nil {
+		panic(fmt.Errorf("create CEL environment failed: %v", err))
+	}
+}
+
+// Compile compiles src, it returns an error if src is not a valid
+// expression or its result is not a boolean.
+func Compile(src string) (*Expression, error) {
+	ast, iss := env.Compile(src)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+
+	switch t := ast.ResultType(); {
+	case t.GetPrimitive() == exprpb.Type_BOOL:
+	case t.GetDyn() != nil:
+	default:
+		return nil, fmt.Errorf("result of %q is %s, not bool", src, cel.FormatType(t))
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{src: src, prg: prg}, nil
+}
+
+// MustCompile is like Compile but panics if src is invalid, it is for the
+// expressions which have been validated.
+func MustCompile(src string) *Expression {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expression) String() string {
+	return e.src
+}
+
+// Eval evaluates the expression with the variables.
+func (e *Expression) Eval(vars map[string]interface{}) (bool, error) {
+	v, _, err := e.prg.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("result of %q is %s, not bool", e.src, v.Type().TypeName())
+	}
+	return bool(b), nil
+}
+
+// Match evaluates the expression against req, an evaluation error, e.g.
+// a missing header in the map, is treated as a mismatch.
+func (e *Expression) Match(req *httpprot.Request) bool {
+	b, err := e.Eval(map[string]interface{}{"request": RequestVars(req)})
+	return err == nil && b
+}
+
+// RequestVars returns the variables of req, the names of the headers are
+// in lower case, and only the first values of the headers and the query
+// parameters are included.
+func RequestVars(req *httpprot.Request) map[string]interface{} {
+	header := make(map[string]string, len(req.HTTPHeader()))
+	for k, v := range req.HTTPHeader() {
+		if len(v) > 0 {
+			header[strings.ToLower(k)] = v[0]
+		}
+	}
+
+	values := req.Std().URL.Query()
+	query := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) > 0 {
+			query[k] = v[0]
+		}
+	}
+
+	return map[string]interface{}{
+		"method": req.Method(),
+		"scheme": req.Scheme(),
+		"host":   req.Host(),
+		"path":   req.Path(),
+		"proto":  req.Proto(),
+		"realIP": req.RealIP(),
+		"header": header,
+		"query":  query,
+	}
+}
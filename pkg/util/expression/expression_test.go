@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package expression
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+func TestCompile(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Compile(`request.header["x-debug"] == "1" && request.method == "POST"`)
+	assert.NoError(err)
+	_, err = Compile(`request.path.startsWith("/api")`)
+	assert.NoError(err)
+
+	// syntax error.
+	_, err = Compile(`request.method ==`)
+	assert.Error(err)
+	// undeclared variable.
+	_, err = Compile(`response.status == 200`)
+	assert.Error(err)
+	// not a boolean.
+	_, err = Compile(`"abc"`)
+	assert.Error(err)
+
+	assert.Panics(func() { MustCompile(`1 + 1`) })
+}
+
+func TestMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com/api/v1?user=alice", nil)
+	stdr.Header.Set("X-Debug", "1")
+	req, _ := httpprot.NewRequest(stdr)
+
+	cases := []struct {
+		src   string
+		match bool
+	}{
+		{`request.header["x-debug"] == "1" && request.method == "POST"`, true},
+		{`request.header["x-debug"] == "1" && request.method == "GET"`, false},
+		{`request.path.startsWith("/api/") && request.host == "www.megaease.com"`, true},
+		{`request.query["user"] in ["alice", "bob"]`, true},
+		{`"x-trace" in request.header`, false},
+		// missing key is a mismatch.
+		{`request.header["x-trace"] == "1"`, false},
+		{`request.path.matches("^/api/v[0-9]+$")`, true},
+		{`request.scheme == "http"`, true},
+		// dynamic result which is not a boolean.
+		{`request.method`, false},
+	}
+
+	for _, c := range cases {
+		e, err := Compile(c.src)
+		if !assert.NoError(err, c.src) {
+			continue
+		}
+		assert.Equal(c.src, e.String())
+		assert.Equal(c.match, e.Match(req), c.src)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extproc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// fileDescriptor builds the descriptor of extproc.proto, to check that the
+// encoding is compatible with the generated code of other languages.
+func fileDescriptor(t *testing.T) protoreflect.FileDescriptor {
+	field := func(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(num),
+			Type:   typ.Enum(),
+			Label:  label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		str   = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		bytes = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+		b     = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+		i32   = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		msg   = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("extproc.proto"),
+		Package: proto.String("easegress.extproc.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Header"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, str, false, ""), field("value", 2, str, false, "")},
+			},
+			{
+				Name: proto.String("ProcessingRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("phase", 1, str, false, ""),
+					field("method", 2, str, false, ""),
+					field("url", 3, str, false, ""),
+					field("host", 4, str, false, ""),
+					field("headers", 5, msg, true, ".easegress.extproc.v1.Header"),
+					field("body", 6, bytes, false, ""),
+					field("has_body", 7, b, false, ""),
+					field("status_code", 8, i32, false, ""),
+					field("attributes", 9, msg, true, ".easegress.extproc.v1.ProcessingRequest.AttributesEntry"),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name:    proto.String("AttributesEntry"),
+					Field:   []*descriptorpb.FieldDescriptorProto{field("key", 1, str, false, ""), field("value", 2, str, false, "")},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+			},
+			{
+				Name: proto.String("ProcessingResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("set_headers", 1, msg, true, ".easegress.extproc.v1.Header"),
+					field("remove_headers", 2, str, true, ""),
+					field("replace_body", 3, b, false, ""),
+					field("body", 4, bytes, false, ""),
+					field("immediate_response", 5, msg, false, ".easegress.extproc.v1.ImmediateResponse"),
+				},
+			},
+			{
+				Name: proto.String("ImmediateResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("status_code", 1, i32, false, ""),
+					field("headers", 2, msg, true, ".easegress.extproc.v1.Header"),
+					field("body", 3, bytes, false, ""),
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fdp, nil)
+	assert.NoError(t, err)
+	return fd
+}
+
+func TestWireCompatibility(t *testing.T) {
+	assert := assert.New(t)
+	fd := fileDescriptor(t)
+
+	req := &ProcessingRequest{
+		Phase:      PhaseResponse,
+		Method:     "POST",
+		URL:        "/pets?limit=1",
+		Host:       "example.com",
+		Headers:    []*Header{{Name: "A", Value: "1"}, {Name: "A", Value: "2"}},
+		Body:       []byte("body"),
+		HasBody:    true,
+		StatusCode: 201,
+		Attributes: map[string]string{"route": "pets", "request_id": "1"},
+	}
+
+	m := dynamicpb.NewMessage(fd.Messages().ByName("ProcessingRequest"))
+	assert.NoError(proto.Unmarshal(req.marshal(), m))
+	fields := m.Descriptor().Fields()
+	assert.Equal("/pets?limit=1", m.Get(fields.ByName("url")).String())
+	assert.Equal(2, m.Get(fields.ByName("headers")).List().Len())
+	assert.Equal(int32(201), int32(m.Get(fields.ByName("status_code")).Int()))
+	assert.Equal("pets", m.Get(fields.ByName("attributes")).Map().Get(protoreflect.ValueOfString("route").MapKey()).String())
+
+	data, err := proto.Marshal(m)
+	assert.NoError(err)
+	decoded := &ProcessingRequest{}
+	assert.NoError(decoded.unmarshal(data))
+	assert.Equal(req, decoded)
+
+	resp := &ProcessingResponse{
+		SetHeaders:        []*Header{{Name: "B", Value: "1"}},
+		RemoveHeaders:     []string{"C", "D"},
+		ReplaceBody:       true,
+		ImmediateResponse: &ImmediateResponse{StatusCode: 403, Body: []byte("denied")},
+	}
+	m = dynamicpb.NewMessage(fd.Messages().ByName("ProcessingResponse"))
+	assert.NoError(proto.Unmarshal(resp.marshal(), m))
+	fields = m.Descriptor().Fields()
+	assert.True(m.Get(fields.ByName("replace_body")).Bool())
+	assert.Equal(2, m.Get(fields.ByName("remove_headers")).List().Len())
+	assert.True(m.Has(fields.ByName("immediate_response")))
+
+	data, err = proto.Marshal(m)
+	assert.NoError(err)
+	decodedResp := &ProcessingResponse{}
+	assert.NoError(decodedResp.unmarshal(data))
+	assert.Equal(resp, decodedResp)
+
+	// the unknown fields are skipped.
+	data = append(data, 0x78, 0x01) // field 15, varint 1
+	assert.NoError((&ProcessingResponse{}).unmarshal(data))
+
+	assert.Error((&ProcessingResponse{}).unmarshal([]byte{0x0a}))
+	// an unexpected wire type.
+	assert.Error((&ProcessingResponse{}).unmarshal([]byte{0x18, 0x01, 0x20, 0x01}))
+}
+
+type echoProcessor struct{}
+
+func (echoProcessor) Process(ctx context.Context, req *ProcessingRequest) (*ProcessingResponse, error) {
+	if req.Method == "DELETE" {
+		return nil, fmt.Errorf("denied")
+	}
+	return &ProcessingResponse{
+		SetHeaders:  []*Header{{Name: "X-Phase", Value: req.Phase}},
+		ReplaceBody: req.HasBody,
+		Body:        append([]byte("echo: "), req.Body...),
+	}, nil
+}
+
+func TestClientServer(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	s := NewServer(echoProcessor{})
+	go s.Serve(l)
+	defer s.Stop()
+
+	c, err := Dial(l.Addr().String(), false)
+	assert.NoError(err)
+	defer c.Close()
+
+	resp, err := c.Process(context.Background(), &ProcessingRequest{Phase: PhaseRequest, Body: []byte("hi"), HasBody: true})
+	assert.NoError(err)
+	assert.Equal("request", resp.SetHeaders[0].Value)
+	assert.True(resp.ReplaceBody)
+	assert.Equal("echo: hi", string(resp.Body))
+
+	_, err = c.Process(context.Background(), &ProcessingRequest{Method: "DELETE"})
+	assert.Error(err)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package extproc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// Version is the version of the protocol.
+	Version = "v1"
+
+	// ServiceName is the full name of the service.
+	ServiceName = "easegress.extproc." + Version + ".ExternalProcessor"
+
+	processMethod = "/" + ServiceName + "/Process"
+)
+
+type (
+	// Processor is the interface implemented by the plugins.
+	Processor interface {
+		// Process processes the request or the response, an error fails
+		// the processing, and the filter handles it by its failure policy.
+		Process(ctx context.Context, req *ProcessingRequest) (*ProcessingResponse, error)
+	}
+
+	// Client calls a plugin.
+	Client struct {
+		conn *grpc.ClientConn
+	}
+
+	// codec encodes the messages in the protobuf wire format, it is forced
+	// on the calls of the protocol only, so the proto codec of gRPC is not
+	// replaced.
+	codec struct{}
+)
+
+// Marshal marshals the message.
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return m.marshal(), nil
+}
+
+// Unmarshal unmarshals the message.
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+// Name returns the name of the codec, which is the content subtype.
+func (codec) Name() string {
+	return "proto"
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Processor)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Process",
+			Handler:    processHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "extproc.proto",
+}
+
+func processHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := &ProcessingRequest{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(Processor).Process(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: processMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(Processor).Process(ctx, req.(*ProcessingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// NewServer creates a gRPC server serving the processor, the options are
+// passed to grpc.NewServer.
+func NewServer(p Processor, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ForceServerCodec(codec{}))
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&serviceDesc, p)
+	return s
+}
+
+// Dial creates a client of the plugin at the address, the connection is
+// established in the background and reconnected automatically.
+func Dial(address string, useTLS bool) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Process calls the plugin to process the request or the response.
+func (c *Client) Process(ctx context.Context, req *ProcessingRequest) (*ProcessingResponse, error) {
+	resp := &ProcessingResponse{}
+	if err := c.conn.Invoke(ctx, processMethod, req, resp, grpc.ForceCodec(codec{})); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Close closes the client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package extproc implements the protocol between the ExternalProcessor
+// filter and the out-of-process plugins, which is defined in extproc.proto,
+// and provides the SDK to write the plugins in Go.
+package extproc
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// PhaseRequest is the phase to process the request.
+	PhaseRequest = "request"
+	// PhaseResponse is the phase to process the response.
+	PhaseResponse = "response"
+)
+
+type (
+	// Header is a header of a request or a response.
+	Header struct {
+		Name  string
+		Value string
+	}
+
+	// ProcessingRequest is sent to the plugin to process a request or a
+	// response.
+	ProcessingRequest struct {
+		Phase  string
+		Method string
+		// URL is the path and the query of the request.
+		URL  string
+		Host string
+		// Headers are the headers of the request in the request phase, and
+		// the headers of the response in the response phase.
+		Headers []*Header
+		// Body is the body of the phase, it is sent only if HasBody is true.
+		Body    []byte
+		HasBody bool
+		// StatusCode is the status code of the response in the response
+		// phase.
+		StatusCode int32
+		Attributes map[string]string
+	}
+
+	// ProcessingResponse is the result of processing a request or a
+	// response.
+	ProcessingResponse struct {
+		// SetHeaders are the headers to set, the headers with the same name
+		// are all kept.
+		SetHeaders    []*Header
+		RemoveHeaders []string
+		// ReplaceBody is whether to replace the body by Body.
+		ReplaceBody bool
+		Body        []byte
+		// ImmediateResponse is returned to the client immediately if it is
+		// not nil, the rest of the pipeline is skipped.
+		ImmediateResponse *ImmediateResponse
+	}
+
+	// ImmediateResponse is a response returned to the client by the plugin.
+	ImmediateResponse struct {
+		StatusCode int32
+		Headers    []*Header
+		Body       []byte
+	}
+
+	// message is a message of the protocol.
+	message interface {
+		marshal() []byte
+		unmarshal(data []byte) error
+	}
+)
+
+// The encoding follows the protobuf wire format of the messages in
+// extproc.proto, and the unknown fields are skipped, so that the plugins
+// could be generated from extproc.proto in any language.
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendInt32(b []byte, num protowire.Number, v int32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(v)))
+}
+
+func appendHeaders(b []byte, num protowire.Number, headers []*Header) []byte {
+	for _, h := range headers {
+		b = appendMessage(b, num, h.marshal())
+	}
+	return b
+}
+
+// field is a field consumed from the wire.
+type field struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+// consumeFields calls fn with the fields in data one by one.
+func consumeFields(data []byte, fn func(f *field) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		f := &field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check checks the wire type of the field, the fields of the unexpected
+// types are rejected.
+func (f *field) check(typ protowire.Type) error {
+	if f.typ != typ {
+		return fmt.Errorf("field %d: unexpected wire type %d", f.num, f.typ)
+	}
+	return nil
+}
+
+func (f *field) string() (string, error) {
+	return string(f.bytes), f.check(protowire.BytesType)
+}
+
+func (f *field) bool() (bool, error) {
+	return f.varint != 0, f.check(protowire.VarintType)
+}
+
+func (f *field) int32() (int32, error) {
+	return int32(f.varint), f.check(protowire.VarintType)
+}
+
+func (f *field) bytesCopy() ([]byte, error) {
+	return append([]byte(nil), f.bytes...), f.check(protowire.BytesType)
+}
+
+func (f *field) header() (*Header, error) {
+	if err := f.check(protowire.BytesType); err != nil {
+		return nil, err
+	}
+	h := &Header{}
+	return h, h.unmarshal(f.bytes)
+}
+
+func (h *Header) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, h.Name)
+	return appendString(b, 2, h.Value)
+}
+
+func (h *Header) unmarshal(data []byte) error {
+	return consumeFields(data, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			h.Name, err = f.string()
+		case 2:
+			h.Value, err = f.string()
+		}
+		return
+	})
+}
+
+func (r *ProcessingRequest) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, r.Phase)
+	b = appendString(b, 2, r.Method)
+	b = appendString(b, 3, r.URL)
+	b = appendString(b, 4, r.Host)
+	b = appendHeaders(b, 5, r.Headers)
+	b = appendBytes(b, 6, r.Body)
+	b = appendBool(b, 7, r.HasBody)
+	b = appendInt32(b, 8, r.StatusCode)
+	for k, v := range r.Attributes {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, v)
+		b = appendMessage(b, 9, entry)
+	}
+	return b
+}
+
+func (r *ProcessingRequest) unmarshal(data []byte) error {
+	return consumeFields(data, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			r.Phase, err = f.string()
+		case 2:
+			r.Method, err = f.string()
+		case 3:
+			r.URL, err = f.string()
+		case 4:
+			r.Host, err = f.string()
+		case 5:
+			var h *Header
+			if h, err = f.header(); err == nil {
+				r.Headers = append(r.Headers, h)
+			}
+		case 6:
+			r.Body, err = f.bytesCopy()
+		case 7:
+			r.HasBody, err = f.bool()
+		case 8:
+			r.StatusCode, err = f.int32()
+		case 9:
+			if err = f.check(protowire.BytesType); err != nil {
+				return
+			}
+			// a map entry is the same as a header on the wire.
+			entry := &Header{}
+			if err = entry.unmarshal(f.bytes); err != nil {
+				return
+			}
+			if r.Attributes == nil {
+				r.Attributes = map[string]string{}
+			}
+			r.Attributes[entry.Name] = entry.Value
+		}
+		return
+	})
+}
+
+func (r *ProcessingResponse) marshal() []byte {
+	var b []byte
+	b = appendHeaders(b, 1, r.SetHeaders)
+	for _, name := range r.RemoveHeaders {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, name)
+	}
+	b = appendBool(b, 3, r.ReplaceBody)
+	b = appendBytes(b, 4, r.Body)
+	if r.ImmediateResponse != nil {
+		b = appendMessage(b, 5, r.ImmediateResponse.marshal())
+	}
+	return b
+}
+
+func (r *ProcessingResponse) unmarshal(data []byte) error {
+	return consumeFields(data, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			var h *Header
+			if h, err = f.header(); err == nil {
+				r.SetHeaders = append(r.SetHeaders, h)
+			}
+		case 2:
+			var name string
+			if name, err = f.string(); err == nil {
+				r.RemoveHeaders = append(r.RemoveHeaders, name)
+			}
+		case 3:
+			r.ReplaceBody, err = f.bool()
+		case 4:
+			r.Body, err = f.bytesCopy()
+		case 5:
+			if err = f.check(protowire.BytesType); err != nil {
+				return
+			}
+			r.ImmediateResponse = &ImmediateResponse{}
+			err = r.ImmediateResponse.unmarshal(f.bytes)
+		}
+		return
+	})
+}
+
+func (r *ImmediateResponse) marshal() []byte {
+	var b []byte
+	b = appendInt32(b, 1, r.StatusCode)
+	b = appendHeaders(b, 2, r.Headers)
+	return appendBytes(b, 3, r.Body)
+}
+
+func (r *ImmediateResponse) unmarshal(data []byte) error {
+	return consumeFields(data, func(f *field) (err error) {
+		switch f.num {
+		case 1:
+			r.StatusCode, err = f.int32()
+		case 2:
+			var h *Header
+			if h, err = f.header(); err == nil {
+				r.Headers = append(r.Headers, h)
+			}
+		case 3:
+			r.Body, err = f.bytesCopy()
+		}
+		return
+	})
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package geoip resolves the locations and the autonomous systems of the IP
+// addresses by the MaxMind DBs, and filters the IP addresses by them.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/mmdb"
+)
+
+const defaultReloadInterval = time.Minute
+
+type (
+	// Spec describes the GeoIP databases.
+	Spec struct {
+		// Databases are the files of the MaxMind DBs, e.g. a GeoLite2
+		// Country database and a GeoLite2 ASN database, the fields of the
+		// location are merged from them in order.
+		Databases []string `json:"databases" jsonschema:"required,minItems=1"`
+		// ReloadInterval is the interval to check the databases, which are
+		// reloaded once they are modified.
+		ReloadInterval string `json:"reloadInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Location is the location and the autonomous system of an IP address,
+	// the fields are empty if they are unknown.
+	Location struct {
+		// Country is the ISO 3166-1 code of the country, e.g. US.
+		Country string
+		// Continent is the code of the continent, e.g. NA.
+		Continent string
+		// Subdivision is the ISO 3166-2 code of the first level
+		// subdivision, e.g. CA.
+		Subdivision string
+		// City is the English name of the city.
+		City  string
+		ASN   uint64
+		ASOrg string
+	}
+
+	// Resolver resolves the locations of the IP addresses, it is safe for
+	// concurrent use.
+	Resolver struct {
+		spec *Spec
+		done chan struct{}
+
+		mutex     sync.RWMutex
+		databases []*database
+	}
+
+	database struct {
+		path    string
+		reader  *mmdb.Reader
+		modTime time.Time
+		size    int64
+		loaded  time.Time
+	}
+
+	// DatabaseStatus is the status of a database.
+	DatabaseStatus struct {
+		Path         string    `json:"path"`
+		DatabaseType string    `json:"databaseType"`
+		BuildEpoch   uint64    `json:"buildEpoch"`
+		LastLoaded   time.Time `json:"lastLoaded"`
+	}
+)
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	if spec.ReloadInterval != "" {
+		if d, err := time.ParseDuration(spec.ReloadInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid reload interval %s", spec.ReloadInterval)
+		}
+	}
+	return nil
+}
+
+// NewResolver creates a resolver, the databases failed to load are
+// ignored and retried later.
+func NewResolver(spec *Spec) *Resolver {
+	r := &Resolver{
+		spec:      spec,
+		done:      make(chan struct{}),
+		databases: make([]*database, len(spec.Databases)),
+	}
+	for i, path := range spec.Databases {
+		r.databases[i] = &database{path: path}
+	}
+	r.reload()
+
+	go r.run()
+	return r
+}
+
+func (r *Resolver) run() {
+	interval := defaultReloadInterval
+	if r.spec.ReloadInterval != "" {
+		interval, _ = time.ParseDuration(r.spec.ReloadInterval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.reload()
+		}
+	}
+}
+
+// reload reloads the modified databases, the old ones are kept if they
+// fail to load.
+func (r *Resolver) reload() {
+	r.mutex.RLock()
+	old := r.databases
+	r.mutex.RUnlock()
+
+	databases := make([]*database, len(old))
+	changed := false
+	for i, db := range old {
+		databases[i] = db
+
+		fi, err := os.Stat(db.path)
+		if err != nil {
+			logger.Errorf("stat GeoIP database %s failed: %v", db.path, err)
+			continue
+		}
+		if db.reader != nil && fi.ModTime().Equal(db.modTime) && fi.Size() == db.size {
+			continue
+		}
+
+		reader, err := mmdb.Open(db.path)
+		if err != nil {
+			logger.Errorf("load GeoIP database %s failed: %v", db.path, err)
+			continue
+		}
+		databases[i] = &database{
+			path:    db.path,
+			reader:  reader,
+			modTime: fi.ModTime(),
+			size:    fi.Size(),
+			loaded:  time.Now(),
+		}
+		changed = true
+	}
+
+	if changed {
+		r.mutex.Lock()
+		r.databases = databases
+		r.mutex.Unlock()
+	}
+}
+
+func stringAt(v interface{}, keys ...string) string {
+	s, _ := mmdb.Path(v, keys...).(string)
+	return s
+}
+
+// Lookup returns the location of the IP address, it returns nil if the
+// address is invalid or not found in any database.
+func (r *Resolver) Lookup(ip string) *Location {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+
+	r.mutex.RLock()
+	databases := r.databases
+	r.mutex.RUnlock()
+
+	var loc *Location
+	for _, db := range databases {
+		if db.reader == nil {
+			continue
+		}
+		v, err := db.reader.Lookup(addr)
+		if err != nil || v == nil {
+			continue
+		}
+		if loc == nil {
+			loc = &Location{}
+		}
+		loc.merge(v)
+	}
+	return loc
+}
+
+// merge merges the fields of the data of a GeoIP2 or GeoLite2 database,
+// the existing fields are not overridden.
+func (loc *Location) merge(v interface{}) {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	country := stringAt(v, "country", "iso_code")
+	if country == "" {
+		country = stringAt(v, "registered_country", "iso_code")
+	}
+	fill(&loc.Country, country)
+	fill(&loc.Continent, stringAt(v, "continent", "code"))
+	fill(&loc.City, stringAt(v, "city", "names", "en"))
+	if subdivisions, ok := mmdb.Path(v, "subdivisions").([]interface{}); ok && len(subdivisions) > 0 {
+		fill(&loc.Subdivision, stringAt(subdivisions[0], "iso_code"))
+	}
+	fill(&loc.ASOrg, stringAt(v, "autonomous_system_organization"))
+	if loc.ASN == 0 {
+		loc.ASN, _ = mmdb.Path(v, "autonomous_system_number").(uint64)
+	}
+}
+
+// Status returns the status of the loaded databases.
+func (r *Resolver) Status() []*DatabaseStatus {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var s []*DatabaseStatus
+	for _, db := range r.databases {
+		if db.reader == nil {
+			continue
+		}
+		s = append(s, &DatabaseStatus{
+			Path:         db.path,
+			DatabaseType: db.reader.Metadata.DatabaseType,
+			BuildEpoch:   db.reader.Metadata.BuildEpoch,
+			LastLoaded:   db.loaded,
+		})
+	}
+	return s
+}
+
+// Close closes the resolver.
+func (r *Resolver) Close() {
+	close(r.done)
+}
+
+type (
+	// FilterSpec describes the filter of the IP addresses by the countries
+	// and the autonomous systems, it works like the IP filter, the
+	// addresses both allowed and blocked, or neither, are allowed unless
+	// BlockByDefault.
+	FilterSpec struct {
+		BlockByDefault bool `json:"blockByDefault" jsonschema:"omitempty"`
+
+		AllowCountries []string `json:"allowCountries" jsonschema:"omitempty,uniqueItems=true"`
+		BlockCountries []string `json:"blockCountries" jsonschema:"omitempty,uniqueItems=true"`
+		AllowASNs      []uint64 `json:"allowASNs" jsonschema:"omitempty,uniqueItems=true"`
+		BlockASNs      []uint64 `json:"blockASNs" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Filter filters the IP addresses by their locations.
+	Filter struct {
+		spec           *FilterSpec
+		allowCountries map[string]struct{}
+		blockCountries map[string]struct{}
+		allowASNs      map[uint64]struct{}
+		blockASNs      map[uint64]struct{}
+	}
+)
+
+func countrySet(countries []string) map[string]struct{} {
+	m := make(map[string]struct{}, len(countries))
+	for _, c := range countries {
+		m[strings.ToUpper(c)] = struct{}{}
+	}
+	return m
+}
+
+func asnSet(asns []uint64) map[uint64]struct{} {
+	m := make(map[uint64]struct{}, len(asns))
+	for _, a := range asns {
+		m[a] = struct{}{}
+	}
+	return m
+}
+
+// NewFilter creates a filter.
+func NewFilter(spec *FilterSpec) *Filter {
+	return &Filter{
+		spec:           spec,
+		allowCountries: countrySet(spec.AllowCountries),
+		blockCountries: countrySet(spec.BlockCountries),
+		allowASNs:      asnSet(spec.AllowASNs),
+		blockASNs:      asnSet(spec.BlockASNs),
+	}
+}
+
+// Allow returns whether the filter allows the location, the unknown
+// locations are allowed unless BlockByDefault.
+func (f *Filter) Allow(loc *Location) bool {
+	defaultResult := !f.spec.BlockByDefault
+	if loc == nil {
+		return defaultResult
+	}
+
+	_, allowCountry := f.allowCountries[loc.Country]
+	_, allowASN := f.allowASNs[loc.ASN]
+	_, blockCountry := f.blockCountries[loc.Country]
+	_, blockASN := f.blockASNs[loc.ASN]
+	allowed := (loc.Country != "" && allowCountry) || (loc.ASN != 0 && allowASN)
+	blocked := (loc.Country != "" && blockCountry) || (loc.ASN != 0 && blockASN)
+
+	switch {
+	case allowed && blocked:
+		return defaultResult
+	case allowed:
+		return true
+	case blocked:
+		return false
+	default:
+		return defaultResult
+	}
+}
+
+// MatchCountry returns whether the country of the location is one of the
+// countries.
+func MatchCountry(loc *Location, countries []string) bool {
+	if loc == nil || loc.Country == "" {
+		return false
+	}
+	for _, c := range countries {
+		if strings.EqualFold(c, loc.Country) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/util/mmdb/mmdbtest"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func writeDatabase(t *testing.T, path string, networks map[string]interface{}) {
+	buf, err := mmdbtest.Build(6, 24, networks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	cityDB := filepath.Join(dir, "city.mmdb")
+	asnDB := filepath.Join(dir, "asn.mmdb")
+	writeDatabase(t, cityDB, map[string]interface{}{
+		"192.0.2.0/24": map[string]interface{}{
+			"country":      map[string]interface{}{"iso_code": "US"},
+			"continent":    map[string]interface{}{"code": "NA"},
+			"city":         map[string]interface{}{"names": map[string]interface{}{"en": "Mountain View"}},
+			"subdivisions": []interface{}{map[string]interface{}{"iso_code": "CA"}},
+		},
+		"198.51.100.0/24": map[string]interface{}{
+			"registered_country": map[string]interface{}{"iso_code": "DE"},
+		},
+	})
+	writeDatabase(t, asnDB, map[string]interface{}{
+		"192.0.2.0/24": map[string]interface{}{
+			"autonomous_system_number":       uint64(64500),
+			"autonomous_system_organization": "Example",
+		},
+	})
+
+	spec := &Spec{Databases: []string{cityDB, asnDB, filepath.Join(dir, "none.mmdb")}, ReloadInterval: "10ms"}
+	assert.NoError(spec.Validate())
+	r := NewResolver(spec)
+	defer r.Close()
+
+	assert.Equal(&Location{
+		Country:     "US",
+		Continent:   "NA",
+		Subdivision: "CA",
+		City:        "Mountain View",
+		ASN:         64500,
+		ASOrg:       "Example",
+	}, r.Lookup("192.0.2.1"))
+	assert.Equal(&Location{Country: "DE"}, r.Lookup("198.51.100.1"))
+	assert.Nil(r.Lookup("203.0.113.1"))
+	assert.Nil(r.Lookup("invalid"))
+	assert.Len(r.Status(), 2)
+
+	// the modified database is reloaded.
+	writeDatabase(t, cityDB, map[string]interface{}{
+		"203.0.113.0/24": map[string]interface{}{"country": map[string]interface{}{"iso_code": "JP"}},
+	})
+	future := time.Now().Add(time.Hour)
+	assert.NoError(os.Chtimes(cityDB, future, future))
+	for i := 0; i < 100 && r.Lookup("203.0.113.1") == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal("JP", r.Lookup("203.0.113.1").Country)
+
+	// the old database is kept if the new one is invalid.
+	assert.NoError(os.WriteFile(cityDB, []byte("invalid"), 0o644))
+	r.reload()
+	assert.Equal("JP", r.Lookup("203.0.113.1").Country)
+
+	spec = &Spec{Databases: []string{cityDB}, ReloadInterval: "0s"}
+	assert.Error(spec.Validate())
+}
+
+func TestFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	f := NewFilter(&FilterSpec{
+		AllowCountries: []string{"us"},
+		BlockCountries: []string{"CN", "US"},
+		BlockASNs:      []uint64{64500},
+	})
+	assert.True(f.Allow(&Location{Country: "US"}))
+	assert.False(f.Allow(&Location{Country: "CN"}))
+	assert.False(f.Allow(&Location{Country: "DE", ASN: 64500}))
+	assert.True(f.Allow(&Location{Country: "DE", ASN: 64501}))
+	assert.True(f.Allow(nil))
+
+	f = NewFilter(&FilterSpec{BlockByDefault: true, AllowCountries: []string{"US"}, AllowASNs: []uint64{64500}})
+	assert.True(f.Allow(&Location{Country: "US"}))
+	assert.True(f.Allow(&Location{ASN: 64500}))
+	assert.False(f.Allow(&Location{Country: "DE"}))
+	assert.False(f.Allow(nil))
+
+	assert.True(MatchCountry(&Location{Country: "US"}, []string{"de", "us"}))
+	assert.False(MatchCountry(&Location{Country: "US"}, []string{"DE"}))
+	assert.False(MatchCountry(nil, []string{"DE"}))
+}
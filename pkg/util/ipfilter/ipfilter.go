@@ -38,11 +38,27 @@ type (
 
 		AllowIPs []string `json:"allowIPs" jsonschema:"omitempty,uniqueItems=true,format=ipcidr-array"`
 		BlockIPs []string `json:"blockIPs" jsonschema:"omitempty,uniqueItems=true,format=ipcidr-array"`
+
+		// AllowSets and BlockSets are the names of the IP sets, which are
+		// looked up on every request, so that the changes of the sets
+		// take effect without updating the spec.
+		AllowSets []string `json:"allowSets" jsonschema:"omitempty,uniqueItems=true"`
+		BlockSets []string `json:"blockSets" jsonschema:"omitempty,uniqueItems=true"`
+	}
+
+	// Set is a named set of IP addresses, e.g. the IPSet object.
+	Set interface {
+		Contains(ip net.IP) bool
 	}
 
+	// SetGetter returns the IP set of the name, it returns nil if the set
+	// doesn't exist.
+	SetGetter func(name string) Set
+
 	// IPFilter is the IP filter.
 	IPFilter struct {
-		spec *Spec
+		spec   *Spec
+		getSet SetGetter
 
 		allowRanger cidranger.Ranger
 		blockRanger cidranger.Ranger
@@ -54,40 +70,63 @@ type (
 	}
 )
 
-// New creates an IPFilter.
-func New(spec *Spec) *IPFilter {
-	rangerFromIPCIDRs := func(ipcidrs []string) cidranger.Ranger {
-		ranger := cidranger.NewPCTrieRanger()
-		for _, ipcidr := range ipcidrs {
-			ip := net.ParseIP(ipcidr)
-			if ip != nil {
-				mask := allOnesIPv4Mask
-				// https://stackoverflow.com/a/48519490/1705845
-				if strings.Count(ipcidr, ":") >= 2 {
-					mask = allOnesIPv6Mask
-				}
-				ipNet := net.IPNet{IP: ip, Mask: mask}
-				ranger.Insert(cidranger.NewBasicRangerEntry(ipNet))
-				continue
-			}
-
-			_, ipNet, err := net.ParseCIDR(ipcidr)
-			if err != nil {
-				logger.Errorf("BUG: %s is an invalid ip or cidr", ipcidr)
-				continue
+// NewRanger creates a ranger of the IPs and CIDRs, which are validated
+// already. The ranger is a path-compressed trie, so the lookup is fast
+// even if there are lots of CIDRs.
+func NewRanger(ipcidrs []string) cidranger.Ranger {
+	ranger := cidranger.NewPCTrieRanger()
+	for _, ipcidr := range ipcidrs {
+		ip := net.ParseIP(ipcidr)
+		if ip != nil {
+			mask := allOnesIPv4Mask
+			// https://stackoverflow.com/a/48519490/1705845
+			if strings.Count(ipcidr, ":") >= 2 {
+				mask = allOnesIPv6Mask
 			}
-			ranger.Insert(cidranger.NewBasicRangerEntry(*ipNet))
+			ipNet := net.IPNet{IP: ip, Mask: mask}
+			ranger.Insert(cidranger.NewBasicRangerEntry(ipNet))
+			continue
 		}
 
-		return ranger
+		_, ipNet, err := net.ParseCIDR(ipcidr)
+		if err != nil {
+			logger.Errorf("BUG: %s is an invalid ip or cidr", ipcidr)
+			continue
+		}
+		ranger.Insert(cidranger.NewBasicRangerEntry(*ipNet))
 	}
 
+	return ranger
+}
+
+// New creates an IPFilter, the IP sets of the spec are ignored.
+func New(spec *Spec) *IPFilter {
+	return NewWithSets(spec, nil)
+}
+
+// NewWithSets creates an IPFilter which gets the IP sets by getSet.
+func NewWithSets(spec *Spec, getSet SetGetter) *IPFilter {
 	return &IPFilter{
-		spec: spec,
+		spec:   spec,
+		getSet: getSet,
+
+		allowRanger: NewRanger(spec.AllowIPs),
+		blockRanger: NewRanger(spec.BlockIPs),
+	}
+}
 
-		allowRanger: rangerFromIPCIDRs(spec.AllowIPs),
-		blockRanger: rangerFromIPCIDRs(spec.BlockIPs),
+// inSets returns whether any of the sets contains the ip, the sets don't
+// exist contain nothing.
+func (f *IPFilter) inSets(names []string, ip net.IP) bool {
+	if f.getSet == nil {
+		return false
 	}
+	for _, name := range names {
+		if set := f.getSet(name); set != nil && set.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 // Allow return if IPFilter allows the incoming ip.
@@ -109,6 +148,9 @@ func (f *IPFilter) Allow(ipstr string) bool {
 		return defaultResult
 	}
 
+	allowed = allowed || f.inSets(f.spec.AllowSets, ip)
+	blocked = blocked || f.inSets(f.spec.BlockSets, ip)
+
 	switch {
 	case allowed && blocked:
 		return defaultResult
@@ -0,0 +1,252 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ja3 computes the JA3 fingerprints of the TLS clients, see
+// https://github.com/salesforce/ja3 for the details.
+package ja3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	recordTypeHandshake      = 22
+	handshakeTypeClientHello = 1
+	recordHeaderSize         = 5
+	maxRecordSize            = 16384 + 2048
+
+	extensionSupportedGroups = 10
+	extensionECPointFormats  = 11
+)
+
+type (
+	// Fingerprint is the JA3 fingerprint of a TLS client.
+	Fingerprint struct {
+		// String is the JA3 string, which is the TLS version, the cipher
+		// suites, the extensions, the elliptic curves and the elliptic
+		// curve point formats of the ClientHello.
+		String string
+		// Hash is the MD5 hash of the JA3 string in hex.
+		Hash string
+	}
+
+	// Listener is a listener recording the ClientHello of the accepted
+	// connections.
+	Listener struct {
+		net.Listener
+	}
+
+	// Conn is a connection recording its ClientHello.
+	Conn struct {
+		net.Conn
+
+		mutex sync.Mutex
+		buf   []byte
+		done  bool
+		fp    *Fingerprint
+	}
+
+	connKey struct{}
+
+	reader struct {
+		buf []byte
+		err bool
+	}
+)
+
+// NewListener wraps the listener to record the ClientHello of the
+// accepted connections.
+func NewListener(l net.Listener) *Listener {
+	return &Listener{Listener: l}
+}
+
+// Accept accepts one connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c}, nil
+}
+
+// Read reads data from the connection, and records the first TLS record.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.done || n == 0 {
+		return n, err
+	}
+
+	c.buf = append(c.buf, b[:n]...)
+	if len(c.buf) < recordHeaderSize {
+		return n, err
+	}
+	size := recordHeaderSize + (int(c.buf[3])<<8 | int(c.buf[4]))
+	if c.buf[0] != recordTypeHandshake || size > maxRecordSize {
+		c.done, c.buf = true, nil
+		return n, err
+	}
+	if len(c.buf) >= size {
+		c.fp, _ = Parse(c.buf[:size])
+		c.done, c.buf = true, nil
+	}
+	return n, err
+}
+
+// Fingerprint returns the fingerprint of the connection, it returns nil if
+// the ClientHello is not received or invalid.
+func (c *Conn) Fingerprint() *Fingerprint {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.fp
+}
+
+// WithConn returns a copy of ctx carrying the connection, it is designed
+// for the ConnContext hook of http.Server. Nothing is carried if the
+// connection is not a TLS connection over a Conn.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		c = tc.NetConn()
+	}
+	if jc, ok := c.(*Conn); ok {
+		return context.WithValue(ctx, connKey{}, jc)
+	}
+	return ctx
+}
+
+// FromContext returns the fingerprint of the connection carried by ctx, it
+// returns nil if there is none.
+func FromContext(ctx context.Context) *Fingerprint {
+	c, ok := ctx.Value(connKey{}).(*Conn)
+	if !ok {
+		return nil
+	}
+	return c.Fingerprint()
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err || n > len(r.buf) {
+		r.err = true
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) uint(n int) int {
+	v := 0
+	for _, c := range r.bytes(n) {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// vector reads a vector with a length of n bytes.
+func (r *reader) vector(n int) *reader {
+	b := r.bytes(r.uint(n))
+	return &reader{buf: b, err: r.err}
+}
+
+// isGREASE returns whether v is a GREASE value (RFC 8701), which are
+// ignored by JA3.
+func isGREASE(v int) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func join(values []int) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		s = append(s, strconv.Itoa(v))
+	}
+	return strings.Join(s, "-")
+}
+
+func readUint16s(r *reader) []int {
+	var values []int
+	for len(r.buf) >= 2 {
+		if v := r.uint(2); !isGREASE(v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Parse parses the TLS record of ClientHello and computes the fingerprint.
+func Parse(record []byte) (*Fingerprint, error) {
+	r := &reader{buf: record}
+	if r.uint(1) != recordTypeHandshake {
+		return nil, fmt.Errorf("not a handshake record")
+	}
+	r.bytes(2)
+	r = r.vector(2)
+
+	if r.uint(1) != handshakeTypeClientHello {
+		return nil, fmt.Errorf("not a ClientHello")
+	}
+	r = r.vector(3)
+
+	version := r.uint(2)
+	r.bytes(32) // random
+	r.vector(1) // session id
+	ciphers := readUint16s(r.vector(2))
+	r.vector(1) // compression methods
+
+	var extensions, curves, pointFormats []int
+	if len(r.buf) > 0 {
+		exts := r.vector(2)
+		for len(exts.buf) > 0 && !exts.err {
+			typ := exts.uint(2)
+			data := exts.vector(2)
+			if !isGREASE(typ) {
+				extensions = append(extensions, typ)
+			}
+			switch typ {
+			case extensionSupportedGroups:
+				curves = readUint16s(data.vector(2))
+			case extensionECPointFormats:
+				for _, f := range data.vector(1).buf {
+					pointFormats = append(pointFormats, int(f))
+				}
+			}
+			r.err = r.err || exts.err || data.err
+		}
+	}
+	if r.err {
+		return nil, fmt.Errorf("malformed ClientHello")
+	}
+
+	s := strings.Join([]string{
+		strconv.Itoa(version),
+		join(ciphers),
+		join(extensions),
+		join(curves),
+		join(pointFormats),
+	}, ",")
+	sum := md5.Sum([]byte(s))
+	return &Fingerprint{String: s, Hash: hex.EncodeToString(sum[:])}, nil
+}
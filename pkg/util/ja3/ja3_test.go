@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ja3
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func clientHello(body []byte) []byte {
+	hs := append([]byte{handshakeTypeClientHello, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{recordTypeHandshake, 3, 1, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte{3, 3}                                          // version
+	body = append(body, make([]byte, 32)...)                      // random
+	body = append(body, 0)                                        // session id
+	body = append(body, 0, 6, 0x0a, 0x0a, 0x13, 0x01, 0xc0, 0x2b) // ciphers with GREASE
+	body = append(body, 1, 0)                                     // compression methods
+	exts := []byte{
+		0x1a, 0x1a, 0, 0, // GREASE
+		0, 0, 0, 0, // server name
+		0, 10, 0, 8, 0, 6, 0x2a, 0x2a, 0, 29, 0, 23, // supported groups
+		0, 11, 0, 2, 1, 0, // point formats
+	}
+	body = append(body, 0, byte(len(exts)))
+	body = append(body, exts...)
+
+	fp, err := Parse(clientHello(body))
+	assert.NoError(err)
+	assert.Equal("771,4865-49195,0-10-11,29-23,0", fp.String)
+	assert.Len(fp.Hash, 32)
+
+	// without extensions.
+	fp, err = Parse(clientHello(body[:len(body)-len(exts)-2]))
+	assert.NoError(err)
+	assert.Equal("771,4865-49195,,,", fp.String)
+
+	_, err = Parse(clientHello(body[:40]))
+	assert.Error(err)
+	_, err = Parse([]byte{23, 3, 3, 0, 0})
+	assert.Error(err)
+	_, err = Parse(nil)
+	assert.Error(err)
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	ln := NewListener(l)
+	defer ln.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		// the handshake fails as the server never responds.
+		tls.Client(c, &tls.Config{ServerName: "example.com"}).Handshake()
+	}()
+
+	c, err := ln.Accept()
+	assert.NoError(err)
+	defer c.Close()
+
+	ctx := WithConn(context.Background(), tls.Server(c, &tls.Config{}))
+	buf := make([]byte, 1024)
+	for FromContext(ctx) == nil {
+		_, err := c.Read(buf)
+		if !assert.NoError(err) {
+			return
+		}
+	}
+	fp := FromContext(ctx)
+	assert.True(strings.HasPrefix(fp.String, "771,"), fp.String)
+
+	assert.Nil(FromContext(context.Background()))
+	assert.Equal(context.Background(), WithConn(context.Background(), c.(*Conn).Conn))
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loadbalance provides the load balance policies shared by the
+// servers and the proxies of the different protocols.
+package loadbalance
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	// PolicyRoundRobin is the load balance policy of round robin.
+	PolicyRoundRobin = "roundRobin"
+	// PolicyRandom is the load balance policy of random.
+	PolicyRandom = "random"
+	// PolicyWeightedRandom is the load balance policy of weighted random.
+	PolicyWeightedRandom = "weightedRandom"
+	// PolicyIPHash is the load balance policy of IP hash, the requests
+	// from the same client IP go to the same server.
+	PolicyIPHash = "ipHash"
+	// PolicyHeaderHash is the load balance policy of header hash.
+	PolicyHeaderHash = "headerHash"
+	// PolicyLeastConnections is the load balance policy of least
+	// connections.
+	PolicyLeastConnections = "leastConnections"
+)
+
+// Weighted chooses the servers by their weights, the servers have the same
+// chance to be chosen if none of them has a weight.
+type Weighted struct {
+	weights []int
+	total   int
+	counter uint64
+}
+
+// NewWeighted creates a Weighted for the servers of the weights.
+func NewWeighted(weights []int) *Weighted {
+	w := &Weighted{weights: weights}
+	for _, weight := range weights {
+		w.total += weight
+	}
+	return w
+}
+
+// sum returns the sum of the weights, or the number of the servers if
+// they have no weight.
+func (w *Weighted) sum() int {
+	if w.total > 0 {
+		return w.total
+	}
+	return len(w.weights)
+}
+
+// index returns the index of the server the nth of sum falls in.
+func (w *Weighted) index(n int) int {
+	if w.total == 0 {
+		return n
+	}
+	for i, weight := range w.weights {
+		if n < weight {
+			return i
+		}
+		n -= weight
+	}
+	return len(w.weights) - 1
+}
+
+// RoundRobin returns the index of the next server in turn, it returns -1
+// if there is no server.
+func (w *Weighted) RoundRobin() int {
+	if len(w.weights) == 0 {
+		return -1
+	}
+	n := atomic.AddUint64(&w.counter, 1) - 1
+	return w.index(int(n % uint64(w.sum())))
+}
+
+// Random returns the index of a random server, it returns -1 if there is
+// no server.
+func (w *Weighted) Random() int {
+	if len(w.weights) == 0 {
+		return -1
+	}
+	return w.index(rand.Intn(w.sum()))
+}
+
+// Hash returns the index of the server of the key, the same key always
+// gets the same server. It returns -1 if there is no server.
+func (w *Weighted) Hash(key string) int {
+	if len(w.weights) == 0 {
+		return -1
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return w.index(int(h.Sum32() % uint32(w.sum())))
+}
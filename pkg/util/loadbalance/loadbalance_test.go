@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadbalance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeighted(t *testing.T) {
+	assert := assert.New(t)
+
+	w := NewWeighted(nil)
+	assert.Equal(-1, w.RoundRobin())
+	assert.Equal(-1, w.Random())
+	assert.Equal(-1, w.Hash("key"))
+
+	// the servers have no weight.
+	w = NewWeighted(make([]int, 3))
+	for i := 0; i < 6; i++ {
+		assert.Equal(i%3, w.RoundRobin())
+	}
+
+	w = NewWeighted([]int{1, 0, 2})
+	var result []int
+	for i := 0; i < 6; i++ {
+		result = append(result, w.RoundRobin())
+	}
+	assert.Equal([]int{0, 2, 2, 0, 2, 2}, result)
+
+	n := w.Hash("10.0.0.1")
+	for i := 0; i < 10; i++ {
+		assert.Equal(n, w.Hash("10.0.0.1"))
+	}
+
+	w = NewWeighted([]int{1, 3})
+	counts := make([]int, 2)
+	for i := 0; i < 1000; i++ {
+		counts[w.Random()]++
+	}
+	assert.InDelta(750, counts[1], 100)
+}
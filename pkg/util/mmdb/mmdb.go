@@ -0,0 +1,422 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mmdb reads the MaxMind DB files, like the GeoIP2 and GeoLite2
+// databases, see https://maxmind.github.io/MaxMind-DB/ for the format.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// metadataMarker is the marker before the metadata at the end of the file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	typeExtended = 0
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBool     = 14
+	typeFloat    = 15
+
+	// dataSectionSeparatorSize is the size of the zeros between the search
+	// tree and the data section.
+	dataSectionSeparatorSize = 16
+
+	// maxDepth limits the nesting of the data, to avoid stack overflow on
+	// malformed files.
+	maxDepth = 64
+)
+
+type (
+	// Metadata is the metadata of a database.
+	Metadata struct {
+		DatabaseType string
+		IPVersion    int
+		RecordSize   int
+		NodeCount    int
+		BuildEpoch   uint64
+		Languages    []string
+		Description  map[string]string
+	}
+
+	// Reader reads a database, it is safe for concurrent use.
+	Reader struct {
+		Metadata Metadata
+
+		buf       []byte
+		data      []byte
+		nodeSize  int
+		ipv4Start int
+	}
+
+	decoder struct {
+		buf []byte
+	}
+)
+
+// Open opens the database file.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New creates a reader of the database in buf.
+func New(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("invalid MaxMind DB: metadata not found")
+	}
+
+	d := &decoder{buf: buf[i+len(metadataMarker):]}
+	v, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: %v", err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: not a map")
+	}
+
+	r := &Reader{buf: buf}
+	md := &r.Metadata
+	md.DatabaseType, _ = m["database_type"].(string)
+	md.IPVersion = int(toUint64(m["ip_version"]))
+	md.RecordSize = int(toUint64(m["record_size"]))
+	md.NodeCount = int(toUint64(m["node_count"]))
+	md.BuildEpoch = toUint64(m["build_epoch"])
+	if langs, ok := m["languages"].([]interface{}); ok {
+		for _, l := range langs {
+			if s, ok := l.(string); ok {
+				md.Languages = append(md.Languages, s)
+			}
+		}
+	}
+	if desc, ok := m["description"].(map[string]interface{}); ok {
+		md.Description = map[string]string{}
+		for k, v := range desc {
+			md.Description[k], _ = v.(string)
+		}
+	}
+
+	switch md.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("invalid MaxMind DB: unsupported record size %d", md.RecordSize)
+	}
+	if md.IPVersion != 4 && md.IPVersion != 6 {
+		return nil, fmt.Errorf("invalid MaxMind DB: unsupported ip version %d", md.IPVersion)
+	}
+
+	r.nodeSize = md.RecordSize / 4
+	treeSize := md.NodeCount * r.nodeSize
+	if treeSize+dataSectionSeparatorSize > i {
+		return nil, fmt.Errorf("invalid MaxMind DB: search tree exceeds the file")
+	}
+	r.data = buf[treeSize+dataSectionSeparatorSize : i]
+	if md.IPVersion == 6 {
+		r.ipv4Start = r.ipv4StartNode()
+	}
+	return r, nil
+}
+
+func toUint64(v interface{}) uint64 {
+	switch v := v.(type) {
+	case uint64:
+		return v
+	case int32:
+		return uint64(v)
+	case *big.Int:
+		return v.Uint64()
+	}
+	return 0
+}
+
+// readNode reads the left (bit 0) or right (bit 1) record of the node.
+func (r *Reader) readNode(node, bit int) int {
+	b := r.buf[node*r.nodeSize:]
+	switch r.Metadata.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		if bit == 0 {
+			return int(b[3]&0xF0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0F)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	default:
+		return int(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// ipv4StartNode returns the node of ::/96 in an IPv6 tree, under which
+// are the IPv4 networks.
+func (r *Reader) ipv4StartNode() int {
+	node := 0
+	for i := 0; i < 96 && node < r.Metadata.NodeCount; i++ {
+		node = r.readNode(node, 0)
+	}
+	return node
+}
+
+// Lookup looks up the data of the ip, it returns nil if the ip is not
+// found. The maps are decoded as map[string]interface{}, the arrays are
+// decoded as []interface{}, and the integers are decoded as uint64, int32
+// or *big.Int.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if r.Metadata.IPVersion == 4 {
+		return nil, fmt.Errorf("IPv6 address %s in an IPv4 database", ip)
+	}
+
+	node := 0
+	if len(ip) == net.IPv4len && r.Metadata.IPVersion == 6 {
+		node = r.ipv4Start
+	}
+
+	nodeCount := r.Metadata.NodeCount
+	for i := 0; i < len(ip)*8 && node < nodeCount; i++ {
+		bit := int(ip[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+
+	if node == nodeCount {
+		return nil, nil
+	}
+	if node < nodeCount {
+		return nil, fmt.Errorf("invalid MaxMind DB: search tree is too deep")
+	}
+
+	offset := node - nodeCount - dataSectionSeparatorSize
+	if offset < 0 || offset >= len(r.data) {
+		return nil, fmt.Errorf("invalid MaxMind DB: data pointer out of range")
+	}
+	d := &decoder{buf: r.data}
+	v, _, err := d.decode(offset, 0)
+	return v, err
+}
+
+// LookupMap looks up the data of the ip, which must be a map.
+func (r *Reader) LookupMap(ip net.IP) (map[string]interface{}, error) {
+	v, err := r.Lookup(ip)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("data of %s is not a map", ip)
+	}
+	return m, nil
+}
+
+// Path returns the value at the path of keys in the data, e.g. "country",
+// "iso_code", or nil if it doesn't exist.
+func Path(v interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+func (d *decoder) bytes(offset, n int) ([]byte, error) {
+	if offset+n > len(d.buf) || n < 0 {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+func (d *decoder) uint(offset, n int) (uint64, error) {
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decodeControl decodes the control byte and the size of the field at the
+// offset, and returns the type, the size and the offset of the payload.
+func (d *decoder) decodeControl(offset int) (typ, size, next int, err error) {
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	offset++
+
+	typ = int(ctrl[0] >> 5)
+	if typ == typePointer {
+		return typ, int(ctrl[0] & 0x1f), offset, nil
+	}
+	if typ == typeExtended {
+		b, err := d.bytes(offset, 1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		typ = 7 + int(b[0])
+		offset++
+	}
+
+	size = int(ctrl[0] & 0x1f)
+	switch size {
+	case 29, 30, 31:
+		n := size - 28
+		v, err := d.uint(offset, n)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		offset += n
+		size = []int{29, 285, 65821}[n-1] + int(v)
+	}
+	return typ, size, offset, nil
+}
+
+// capacity limits the capacity to allocate for the size, which could be
+// huge in malformed files.
+func capacity(size int) int {
+	if size > 64 {
+		return 64
+	}
+	return size
+}
+
+// decode decodes the field at the offset, and returns the value and the
+// offset after the field.
+func (d *decoder) decode(offset, depth int) (interface{}, int, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("data is nested too deeply")
+	}
+
+	typ, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typePointer:
+		n := (size>>3)&0x3 + 1
+		v, err := d.uint(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		pointer := int(v)
+		switch n {
+		case 1:
+			pointer |= (size & 0x7) << 8
+		case 2:
+			pointer = pointer | (size&0x7)<<16 + 2048
+		case 3:
+			pointer = pointer | (size&0x7)<<24 + 526336
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, offset + n, err
+	case typeString:
+		b, err := d.bytes(offset, size)
+		return string(b), offset + size, err
+	case typeBytes:
+		b, err := d.bytes(offset, size)
+		return append([]byte(nil), b...), offset + size, err
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid size %d of double", size)
+		}
+		v, err := d.uint(offset, 8)
+		return math.Float64frombits(v), offset + 8, err
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid size %d of float", size)
+		}
+		v, err := d.uint(offset, 4)
+		return float64(math.Float32frombits(uint32(v))), offset + 4, err
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid size %d of unsigned integer", size)
+		}
+		v, err := d.uint(offset, size)
+		return v, offset + size, err
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid size %d of int32", size)
+		}
+		v, err := d.uint(offset, size)
+		return int32(uint32(v)), offset + size, err
+	case typeUint128:
+		b, err := d.bytes(offset, size)
+		if err != nil {
+			return nil, 0, err
+		}
+		return new(big.Int).SetBytes(b), offset + size, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeMap:
+		m := make(map[string]interface{}, capacity(size))
+		for i := 0; i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("key of map is not a string")
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, capacity(size))
+		for i := 0; i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mmdb
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/pkg/util/mmdb/mmdbtest"
+)
+
+var testNetworks = map[string]interface{}{
+	"1.2.0.0/16": map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": "US"},
+		"asn":     uint64(64500),
+	},
+	"1.2.3.0/24": map[string]interface{}{
+		"country":   map[string]interface{}{"iso_code": "CA"},
+		"latitude":  45.5,
+		"offset":    int32(-5),
+		"anonymous": true,
+		"tags":      []interface{}{"a", "b"},
+	},
+	"10.0.0.1/32": "single",
+}
+
+func TestLookup(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			networks := map[string]interface{}{}
+			for k, v := range testNetworks {
+				networks[k] = v
+			}
+			if ipVersion == 6 {
+				networks["2001:db8::/32"] = map[string]interface{}{"country": map[string]interface{}{"iso_code": "JP"}}
+			}
+
+			buf, err := mmdbtest.Build(ipVersion, recordSize, networks)
+			assert.NoError(err)
+			r, err := New(buf)
+			assert.NoError(err)
+			assert.Equal("Test", r.Metadata.DatabaseType)
+			assert.Equal(ipVersion, r.Metadata.IPVersion)
+			assert.Equal(recordSize, r.Metadata.RecordSize)
+			assert.Equal([]string{"en"}, r.Metadata.Languages)
+
+			m, err := r.LookupMap(net.ParseIP("1.2.200.1"))
+			assert.NoError(err)
+			assert.Equal("US", Path(m, "country", "iso_code"))
+			assert.Equal(uint64(64500), m["asn"])
+
+			m, err = r.LookupMap(net.ParseIP("1.2.3.4"))
+			assert.NoError(err)
+			assert.Equal("CA", Path(m, "country", "iso_code"))
+			assert.Equal(45.5, m["latitude"])
+			assert.Equal(int32(-5), m["offset"])
+			assert.Equal(true, m["anonymous"])
+			assert.Equal([]interface{}{"a", "b"}, m["tags"])
+			assert.Nil(Path(m, "country", "iso_code", "unknown"))
+
+			v, err := r.Lookup(net.ParseIP("10.0.0.1"))
+			assert.NoError(err)
+			assert.Equal("single", v)
+			_, err = r.LookupMap(net.ParseIP("10.0.0.1"))
+			assert.Error(err)
+
+			v, err = r.Lookup(net.ParseIP("10.0.0.2"))
+			assert.NoError(err)
+			assert.Nil(v)
+
+			if ipVersion == 6 {
+				m, err = r.LookupMap(net.ParseIP("2001:db8::1"))
+				assert.NoError(err)
+				assert.Equal("JP", Path(m, "country", "iso_code"))
+			} else {
+				_, err = r.Lookup(net.ParseIP("2001:db8::1"))
+				assert.Error(err)
+			}
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	buf, err := mmdbtest.Build(4, 24, testNetworks)
+	assert.NoError(err)
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	assert.NoError(os.WriteFile(path, buf, 0o644))
+
+	r, err := Open(path)
+	assert.NoError(err)
+	m, err := r.LookupMap(net.ParseIP("1.2.3.4"))
+	assert.NoError(err)
+	assert.Equal("CA", Path(m, "country", "iso_code"))
+
+	_, err = Open(filepath.Join(t.TempDir(), "none.mmdb"))
+	assert.Error(err)
+}
+
+func TestInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New([]byte("not a database"))
+	assert.Error(err)
+
+	buf, err := mmdbtest.Build(4, 24, testNetworks)
+	assert.NoError(err)
+
+	// truncate the search tree.
+	i := len(buf) - 200
+	_, err = New(append([]byte(nil), buf[i:]...))
+	assert.Error(err)
+
+	// a pointer pointing to itself.
+	d := &decoder{buf: []byte{0x20, 0x00}}
+	_, _, err = d.decode(0, 0)
+	assert.Error(err)
+
+	// a map larger than the data.
+	d = &decoder{buf: []byte{0xFF, 0xFF, 0xFF, 0xFF}}
+	_, _, err = d.decode(0, 0)
+	assert.Error(err)
+}
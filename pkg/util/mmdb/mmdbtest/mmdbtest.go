@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package mmdbtest builds MaxMind DB files for tests.
+package mmdbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+)
+
+type (
+	trieNode struct {
+		children [2]interface{} // nil, *trieNode or dataRef
+		index    int
+	}
+
+	dataRef int
+
+	network struct {
+		ipnet *net.IPNet
+		ones  int
+		data  interface{}
+	}
+)
+
+// Build builds a database of the networks in CIDR notation with the record
+// size 24, 28 or 32. In IPv6 databases, IPv4 networks are put under
+// ::/96. The data could be maps of string keys, arrays, strings, bools,
+// float64, int32, uint64 or int.
+func Build(ipVersion, recordSize int, networks map[string]interface{}) ([]byte, error) {
+	var nets []*network
+	for cidr, data := range networks {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := ipnet.Mask.Size()
+		ip := ipnet.IP
+		if bits == 32 && ipVersion == 6 {
+			ip = make(net.IP, net.IPv6len)
+			copy(ip[12:], ipnet.IP.To4())
+			ones += 96
+		} else if bits == 128 && ipVersion == 4 {
+			return nil, fmt.Errorf("IPv6 network %s in an IPv4 database", cidr)
+		}
+		nets = append(nets, &network{ipnet: &net.IPNet{IP: ip}, ones: ones, data: data})
+	}
+	// the more specific networks override the less specific ones.
+	sort.Slice(nets, func(i, j int) bool {
+		return nets[i].ones < nets[j].ones
+	})
+
+	dataSection := &bytes.Buffer{}
+	root := &trieNode{}
+	for _, n := range nets {
+		ref := dataRef(dataSection.Len())
+		if err := encode(dataSection, n.data); err != nil {
+			return nil, err
+		}
+		insert(root, n.ipnet.IP, n.ones, ref)
+	}
+
+	// number the nodes in breadth first order.
+	nodes := []*trieNode{root}
+	for i := 0; i < len(nodes); i++ {
+		nodes[i].index = i
+		for _, c := range nodes[i].children {
+			if child, ok := c.(*trieNode); ok {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+
+	nodeCount := len(nodes)
+	buf := &bytes.Buffer{}
+	for _, n := range nodes {
+		var records [2]uint32
+		for i, c := range n.children {
+			switch c := c.(type) {
+			case nil:
+				records[i] = uint32(nodeCount)
+			case *trieNode:
+				records[i] = uint32(c.index)
+			case dataRef:
+				records[i] = uint32(nodeCount + 16 + int(c))
+			}
+		}
+		writeNode(buf, recordSize, records)
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(dataSection.Bytes())
+
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	err := encode(buf, map[string]interface{}{
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"build_epoch":                 uint64(1600000000),
+		"database_type":               "Test",
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint64(ipVersion),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint64(nodeCount),
+		"record_size":                 uint64(recordSize),
+	})
+	return buf.Bytes(), err
+}
+
+func insert(root *trieNode, ip net.IP, ones int, ref dataRef) {
+	if ip4 := ip.To4(); ip4 != nil && len(ip) == net.IPv4len {
+		ip = ip4
+	}
+
+	node := root
+	for i := 0; i < ones; i++ {
+		bit := int(ip[i>>3]>>(7-uint(i&7))) & 1
+		if i == ones-1 {
+			node.children[bit] = ref
+			return
+		}
+
+		switch c := node.children[bit].(type) {
+		case *trieNode:
+			node = c
+		case dataRef:
+			// split the less specific network.
+			child := &trieNode{children: [2]interface{}{c, c}}
+			node.children[bit] = child
+			node = child
+		default:
+			child := &trieNode{}
+			node.children[bit] = child
+			node = child
+		}
+	}
+}
+
+func writeNode(buf *bytes.Buffer, recordSize int, records [2]uint32) {
+	switch recordSize {
+	case 24:
+		for _, r := range records {
+			buf.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	case 28:
+		l, r := records[0], records[1]
+		buf.Write([]byte{
+			byte(l >> 16), byte(l >> 8), byte(l),
+			byte((l>>24)&0x0F)<<4 | byte((r>>24)&0x0F),
+			byte(r >> 16), byte(r >> 8), byte(r),
+		})
+	default:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b, records[0])
+		binary.BigEndian.PutUint32(b[4:], records[1])
+		buf.Write(b)
+	}
+}
+
+func writeControl(buf *bytes.Buffer, typ, size int) {
+	var ctrl byte
+	if typ <= 7 {
+		ctrl = byte(typ << 5)
+	}
+
+	var ext []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		ext = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		s := size - 285
+		ext = []byte{byte(s >> 8), byte(s)}
+	default:
+		ctrl |= 31
+		s := size - 65821
+		ext = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+	}
+
+	buf.WriteByte(ctrl)
+	if typ > 7 {
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(ext)
+}
+
+func writeUint(buf *bytes.Buffer, typ int, v uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	b = bytes.TrimLeft(b, "\x00")
+	writeControl(buf, typ, len(b))
+	buf.Write(b)
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		writeControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		writeControl(buf, 3, 8)
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(v))
+		buf.Write(b)
+	case uint64:
+		writeUint(buf, 9, v)
+	case int:
+		if v < 0 {
+			return fmt.Errorf("negative int %d, use int32 instead", v)
+		}
+		writeUint(buf, 6, uint64(v))
+	case int32:
+		writeControl(buf, 8, 4)
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(v))
+		buf.Write(b)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		writeControl(buf, 14, size)
+	case []interface{}:
+		writeControl(buf, 11, len(v))
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeControl(buf, 7, len(v))
+		for _, k := range keys {
+			encode(buf, k)
+			if err := encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package oidc provides the OpenID Connect providers.
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+// refreshKeysInterval is the min interval to refresh the keys of the
+// provider when a token is signed by an unknown key.
+const refreshKeysInterval = time.Minute
+
+type (
+	// Metadata is the metadata of an OpenID provider, returned by its
+	// discovery endpoint.
+	Metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+		EndSessionEndpoint    string `json:"end_session_endpoint"`
+	}
+
+	jsonWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	// Provider is an OpenID provider, its metadata and keys are fetched
+	// lazily, so that the users could be created when the provider is
+	// not available.
+	Provider struct {
+		discoveryURL string
+		client       *http.Client
+
+		lock        sync.Mutex
+		metadata    *Metadata
+		keys        map[string]interface{}
+		keysFetched time.Time
+	}
+)
+
+// NewProvider creates a Provider of the discovery URL.
+func NewProvider(discoveryURL string, client *http.Client) *Provider {
+	return &Provider{discoveryURL: discoveryURL, client: client}
+}
+
+// Client returns the HTTP client to access the provider.
+func (p *Provider) Client() *http.Client {
+	return p.client
+}
+
+func (p *Provider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get %s: unexpected status code %d", url, resp.StatusCode)
+	}
+	return codectool.DecodeJSON(resp.Body, v)
+}
+
+// Metadata returns the metadata of the provider, it is fetched from the
+// discovery endpoint on the first call.
+func (p *Provider) Metadata() (*Metadata, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	md := &Metadata{}
+	if err := p.getJSON(p.discoveryURL, md); err != nil {
+		return nil, fmt.Errorf("failed to discover the provider: %v", err)
+	}
+	if md.Issuer == "" || md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, fmt.Errorf("failed to discover the provider: missing endpoints")
+	}
+	p.metadata = md
+	return md, nil
+}
+
+// getKey returns the key of kid, the keys are refreshed if there is no
+// such key, as the provider may have rotated its keys.
+func (p *Provider) getKey(kid string) (interface{}, error) {
+	md, err := p.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < refreshKeysInterval {
+		return nil, fmt.Errorf("key %q not found", kid)
+	}
+
+	var jwks struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(md.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to get keys: %v", err)
+	}
+	p.keysFetched = time.Now()
+
+	p.keys = map[string]interface{}{}
+	for _, k := range jwks.Keys {
+		if key, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = key
+		}
+	}
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key %q not found", kid)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns the RSA or ECDSA public key of the JSON web key.
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// VerifyIDToken verifies the signature and the claims of the ID token,
+// and returns the claims. The nonce is not checked if it is empty.
+func (p *Provider) VerifyIDToken(rawToken, clientID, nonce string) (jwt.MapClaims, error) {
+	md, err := p.Metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if iss, _ := claims["iss"].(string); iss != md.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !hasAudience(claims, clientID) {
+		return nil, fmt.Errorf("client %q is not in the audience", clientID)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("no expiration time")
+	}
+	if nonce != "" {
+		if n, _ := claims["nonce"].(string); n != nonce {
+			return nil, fmt.Errorf("unexpected nonce")
+		}
+	}
+	return claims, nil
+}
+
+// hasAudience returns whether the audience of the claims includes aud,
+// the audience could be a string or an array of strings.
+func hasAudience(claims jwt.MapClaims, aud string) bool {
+	switch v := claims["aud"].(type) {
+	case string:
+		return v == aud
+	case []interface{}:
+		for _, a := range v {
+			if s, _ := a.(string); s == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseClaims parses the claims of a token without verification, it is
+// used for the tokens which have been verified.
+func ParseClaims(rawToken string) jwt.MapClaims {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(rawToken, claims); err != nil {
+		return nil
+	}
+	return claims
+}
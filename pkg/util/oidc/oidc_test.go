@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+
+	var url string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 url,
+			"authorization_endpoint": url + "/auth",
+			"token_endpoint":         url + "/token",
+			"jwks_uri":               url + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url = server.URL
+
+	idToken := func(nonce string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   url,
+			"aud":   []string{"easegress"},
+			"sub":   "alice",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": nonce,
+		})
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString(key)
+		assert.NoError(err)
+		return s
+	}
+
+	p := NewProvider(url+"/.well-known/openid-configuration", http.DefaultClient)
+
+	claims, err := p.VerifyIDToken(idToken("n1"), "easegress", "n1")
+	assert.NoError(err)
+	assert.Equal("alice", claims["sub"])
+	assert.Equal("alice", ParseClaims(idToken(""))["sub"])
+
+	_, err = p.VerifyIDToken(idToken("n1"), "other", "n1")
+	assert.Error(err)
+	_, err = p.VerifyIDToken(idToken("n1"), "easegress", "n2")
+	assert.Error(err)
+	_, err = p.VerifyIDToken(idToken("n1"), "easegress", "")
+	assert.NoError(err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": url, "aud": "easegress"})
+	raw, _ := token.SignedString([]byte("secret"))
+	_, err = p.VerifyIDToken(raw, "easegress", "")
+	assert.Error(err)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxNameLength is the max length of the names of the objects.
+const maxNameLength = 253
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9\-_.~]+`)
+
+// GenerateOptions are the options to generate the objects of a document.
+type GenerateOptions struct {
+	// Name is the name of the HTTPServer, and the prefix of the names of
+	// the pipelines.
+	Name string
+	// Port is the port of the HTTPServer.
+	Port uint16
+	// Servers are the URLs of the upstream servers, the servers of the
+	// document are used if it is empty.
+	Servers []string
+}
+
+// PipelineName returns the name of the pipeline of the operation.
+func PipelineName(name, operationID string) string {
+	id := strings.Trim(invalidNameChars.ReplaceAllString(operationID, "-"), "-")
+	result := name + "-" + id
+	if len(result) > maxNameLength {
+		result = result[:maxNameLength]
+	}
+	return result
+}
+
+// upstreams returns the scheme and host of the absolute server URLs of
+// the document, and the base path of the API, which is the path of the
+// first server.
+func (d *Document) upstreams() ([]string, string) {
+	var servers []string
+	basePath := ""
+	for i, s := range d.Servers {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			continue
+		}
+		if i == 0 {
+			basePath = strings.TrimSuffix(u.Path, "/")
+		}
+		if u.Scheme != "" && u.Host != "" {
+			servers = append(servers, u.Scheme+"://"+u.Host)
+		}
+	}
+	return servers, basePath
+}
+
+// Generate generates the specs of an HTTPServer and the pipelines of the
+// operations of the document, each pipeline validates the requests of its
+// operation and proxies them to the upstream servers. The pipelines are
+// in the front of the HTTPServer in the result.
+func Generate(doc *Document, opt *GenerateOptions) ([]map[string]interface{}, error) {
+	if opt.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if opt.Port == 0 {
+		return nil, fmt.Errorf("port is required")
+	}
+
+	servers, basePath := doc.upstreams()
+	if len(opt.Servers) > 0 {
+		servers = opt.Servers
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no upstream servers, the servers of the document must be absolute URLs if they are not specified")
+	}
+
+	ops, err := doc.Operations()
+	if err != nil {
+		return nil, err
+	}
+
+	poolServers := make([]interface{}, len(servers))
+	for i, s := range servers {
+		poolServers[i] = map[string]interface{}{"url": s}
+	}
+
+	var result []map[string]interface{}
+	var staticPaths, regexpPaths []interface{}
+	names := map[string]string{}
+	for _, op := range ops {
+		name := PipelineName(opt.Name, op.ID)
+		if prev, ok := names[name]; ok {
+			return nil, fmt.Errorf("operations %s and %s have the same pipeline name %s", prev, op.ID, name)
+		}
+		names[name] = op.ID
+
+		spec := *op.Spec
+		spec.Path = basePath + op.Path
+
+		result = append(result, map[string]interface{}{
+			"name": name,
+			"kind": "Pipeline",
+			"filters": []interface{}{
+				map[string]interface{}{
+					"kind":    "Validator",
+					"name":    "validator",
+					"openAPI": &spec,
+				},
+				map[string]interface{}{
+					"kind":  "Proxy",
+					"name":  "proxy",
+					"pools": []interface{}{map[string]interface{}{"servers": poolServers}},
+				},
+			},
+		})
+
+		path := map[string]interface{}{
+			"methods": []string{op.Method},
+			"backend": name,
+		}
+		re, params := PathRegexp(spec.Path)
+		if len(params) == 0 {
+			path["path"] = spec.Path
+			staticPaths = append(staticPaths, path)
+		} else {
+			path["pathRegexp"] = re
+			regexpPaths = append(regexpPaths, path)
+		}
+	}
+
+	// the static paths are in the front, so that /pets/mine is not
+	// matched by /pets/{petId}.
+	result = append(result, map[string]interface{}{
+		"name":      opt.Name,
+		"kind":      "HTTPServer",
+		"port":      opt.Port,
+		"https":     false,
+		"keepAlive": true,
+		"rules": []interface{}{
+			map[string]interface{}{"paths": append(staticPaths, regexpPaths...)},
+		},
+	})
+	return result, nil
+}
+
+// Backends returns the backends of the rules of the HTTPServer spec, in
+// the form of the spec generated by Generate.
+func Backends(spec map[string]interface{}) []string {
+	var result []string
+	rules, _ := spec["rules"].([]interface{})
+	for _, rule := range rules {
+		r, _ := rule.(map[string]interface{})
+		paths, _ := r["paths"].([]interface{})
+		for _, path := range paths {
+			p, _ := path.(map[string]interface{})
+			if backend, ok := p["backend"].(string); ok {
+				result = append(result, backend)
+			}
+		}
+	}
+	return result
+}
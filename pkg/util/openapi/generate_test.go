@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipelineName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("api-listPets", PipelineName("api", "listPets"))
+	assert.Equal("api-get-pets-petId", PipelineName("api", "get/pets/{petId}"))
+	assert.Len(PipelineName("api", strings.Repeat("a", 300)), maxNameLength)
+}
+
+func TestGenerate(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := Parse([]byte(petstore))
+	assert.NoError(err)
+
+	_, err = Generate(doc, &GenerateOptions{Port: 8080})
+	assert.Error(err)
+	_, err = Generate(doc, &GenerateOptions{Name: "petstore"})
+	assert.Error(err)
+
+	objects, err := Generate(doc, &GenerateOptions{Name: "petstore", Port: 8080})
+	assert.NoError(err)
+	assert.Len(objects, 6)
+
+	p := objects[0]
+	assert.Equal("petstore-listPets", p["name"])
+	assert.Equal("Pipeline", p["kind"])
+	filters := p["filters"].([]interface{})
+	validator := filters[0].(map[string]interface{})
+	assert.Equal("/v1/pets", validator["openAPI"].(*OperationSpec).Path)
+	proxy := filters[1].(map[string]interface{})
+	servers := proxy["pools"].([]interface{})[0].(map[string]interface{})["servers"].([]interface{})
+	assert.Equal("http://petstore.example.com", servers[0].(map[string]interface{})["url"])
+
+	server := objects[5]
+	assert.Equal("petstore", server["name"])
+	assert.Equal("HTTPServer", server["kind"])
+	paths := server["rules"].([]interface{})[0].(map[string]interface{})["paths"].([]interface{})
+	assert.Len(paths, 5)
+	// the static paths are in the front.
+	assert.Equal("/v1/pets/mine", paths[2].(map[string]interface{})["path"])
+	assert.Equal(`^/v1/pets/([^/]+)$`, paths[3].(map[string]interface{})["pathRegexp"])
+	assert.Equal([]string{"DELETE"}, paths[4].(map[string]interface{})["methods"])
+
+	assert.Equal([]string{
+		"petstore-listPets", "petstore-createPet", "petstore-listMyPets",
+		"petstore-showPetById", "petstore-delete-pets-petId",
+	}, Backends(server))
+
+	// the upstream servers are specified.
+	objects, err = Generate(doc, &GenerateOptions{Name: "petstore", Port: 8080, Servers: []string{"http://127.0.0.1:9095"}})
+	assert.NoError(err)
+	proxy = objects[0]["filters"].([]interface{})[1].(map[string]interface{})
+	servers = proxy["pools"].([]interface{})[0].(map[string]interface{})["servers"].([]interface{})
+	assert.Equal("http://127.0.0.1:9095", servers[0].(map[string]interface{})["url"])
+
+	// no upstream servers.
+	doc, err = Parse([]byte(`{"openapi": "3.0.0", "servers": [{"url": "/v1"}], "paths": {"/a": {"get": {}}}}`))
+	assert.NoError(err)
+	_, err = Generate(doc, &GenerateOptions{Name: "api", Port: 8080})
+	assert.Error(err)
+
+	// duplicated names.
+	doc, err = Parse([]byte(`{"openapi": "3.0.0", "paths": {"/a": {"get": {"operationId": "x"}, "put": {"operationId": "x"}}}}`))
+	assert.NoError(err)
+	_, err = Generate(doc, &GenerateOptions{Name: "api", Port: 8080, Servers: []string{"http://127.0.0.1"}})
+	assert.Error(err)
+}
@@ -0,0 +1,350 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package openapi parses OpenAPI 3 documents, generates the routes and
+// pipelines of their operations, and validates the requests against the
+// operations.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// Document is an OpenAPI 3 document, only the parts to route and
+	// validate the requests are parsed.
+	Document struct {
+		OpenAPI string               `json:"openapi"`
+		Servers []*Server            `json:"servers"`
+		Paths   map[string]*PathItem `json:"paths"`
+
+		// raw is the whole document to resolve the references.
+		raw map[string]interface{}
+	}
+
+	// Server is a server of the API.
+	Server struct {
+		URL string `json:"url"`
+	}
+
+	// PathItem describes the operations of a path.
+	PathItem struct {
+		Ref        string       `json:"$ref"`
+		Parameters []*Parameter `json:"parameters"`
+		Get        *Operation   `json:"get"`
+		Put        *Operation   `json:"put"`
+		Post       *Operation   `json:"post"`
+		Delete     *Operation   `json:"delete"`
+		Options    *Operation   `json:"options"`
+		Head       *Operation   `json:"head"`
+		Patch      *Operation   `json:"patch"`
+		Trace      *Operation   `json:"trace"`
+	}
+
+	// Operation is an operation of a path.
+	Operation struct {
+		OperationID string       `json:"operationId"`
+		Parameters  []*Parameter `json:"parameters"`
+		RequestBody *RequestBody `json:"requestBody"`
+	}
+
+	// Parameter is a parameter of an operation.
+	Parameter struct {
+		Ref      string                 `json:"$ref,omitempty" jsonschema:"omitempty"`
+		Name     string                 `json:"name" jsonschema:"required"`
+		In       string                 `json:"in" jsonschema:"required,enum=path,enum=query,enum=header,enum=cookie"`
+		Required bool                   `json:"required,omitempty" jsonschema:"omitempty"`
+		Schema   map[string]interface{} `json:"schema,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RequestBody is the body of the requests of an operation.
+	RequestBody struct {
+		Ref      string                `json:"$ref,omitempty" jsonschema:"omitempty"`
+		Required bool                  `json:"required,omitempty" jsonschema:"omitempty"`
+		Content  map[string]*MediaType `json:"content,omitempty" jsonschema:"omitempty"`
+	}
+
+	// MediaType is a media type of the body.
+	MediaType struct {
+		Schema map[string]interface{} `json:"schema,omitempty" jsonschema:"omitempty"`
+	}
+
+	// OperationInfo is an operation with its references resolved.
+	OperationInfo struct {
+		// ID is the operationId, or derived from the method and the path
+		// if it is empty.
+		ID     string
+		Method string
+		Path   string
+		Spec   *OperationSpec
+	}
+)
+
+// Parse parses an OpenAPI 3 document in YAML or JSON.
+func Parse(data []byte) (*Document, error) {
+	raw := map[string]interface{}{}
+	if err := codectool.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unmarshal document failed: %v", err)
+	}
+
+	doc := &Document{}
+	if err := remarshal(raw, doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q, only 3.x is supported", doc.OpenAPI)
+	}
+	if len(doc.Paths) == 0 {
+		return nil, fmt.Errorf("no paths")
+	}
+	doc.raw = raw
+	return doc, nil
+}
+
+// remarshal converts the value from and to a JSON document into v.
+func remarshal(from interface{}, v interface{}) error {
+	data, err := codectool.MarshalJSON(from)
+	if err != nil {
+		return err
+	}
+	return codectool.UnmarshalJSON(data, v)
+}
+
+// resolve returns the value referenced by the local reference ref, e.g.
+// #/components/schemas/Pet.
+func (d *Document) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %s, only the local ones are supported", ref)
+	}
+
+	var v interface{} = d.raw
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("reference %s not found", ref)
+		}
+		if v, ok = m[token]; !ok {
+			return nil, fmt.Errorf("reference %s not found", ref)
+		}
+	}
+	return v, nil
+}
+
+// inlineSchema returns a copy of the schema with the references replaced
+// by the schemas they reference. A recursive reference is replaced by an
+// empty schema, which accepts anything. The nullable of OpenAPI 3.0 is
+// converted to the null type of JSON Schema.
+func (d *Document) inlineSchema(schema interface{}, refs []string) (interface{}, error) {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		if ref, ok := s["$ref"].(string); ok {
+			for _, r := range refs {
+				if r == ref {
+					return map[string]interface{}{}, nil
+				}
+			}
+			v, err := d.resolve(ref)
+			if err != nil {
+				return nil, err
+			}
+			return d.inlineSchema(v, append(refs, ref))
+		}
+
+		result := make(map[string]interface{}, len(s))
+		for k, v := range s {
+			v, err := d.inlineSchema(v, refs)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = v
+		}
+		if nullable, _ := result["nullable"].(bool); nullable {
+			if t, ok := result["type"].(string); ok {
+				result["type"] = []interface{}{t, "null"}
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(s))
+		for i, v := range s {
+			v, err := d.inlineSchema(v, refs)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = v
+		}
+		return result, nil
+	}
+	return schema, nil
+}
+
+func (d *Document) inlineSchemaMap(schema map[string]interface{}) (map[string]interface{}, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	v, err := d.inlineSchema(schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// resolveParameter returns the parameter with its references resolved.
+func (d *Document) resolveParameter(p *Parameter) (*Parameter, error) {
+	if p.Ref != "" {
+		v, err := d.resolve(p.Ref)
+		if err != nil {
+			return nil, err
+		}
+		resolved := &Parameter{}
+		if err := remarshal(v, resolved); err != nil {
+			return nil, fmt.Errorf("invalid parameter %s: %v", p.Ref, err)
+		}
+		p = resolved
+	}
+
+	schema, err := d.inlineSchemaMap(p.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %s: %v", p.Name, err)
+	}
+	return &Parameter{Name: p.Name, In: p.In, Required: p.Required || p.In == "path", Schema: schema}, nil
+}
+
+// resolveRequestBody returns the body with its references resolved.
+func (d *Document) resolveRequestBody(b *RequestBody) (*RequestBody, error) {
+	if b.Ref != "" {
+		v, err := d.resolve(b.Ref)
+		if err != nil {
+			return nil, err
+		}
+		resolved := &RequestBody{}
+		if err := remarshal(v, resolved); err != nil {
+			return nil, fmt.Errorf("invalid request body %s: %v", b.Ref, err)
+		}
+		b = resolved
+	}
+
+	result := &RequestBody{Required: b.Required, Content: map[string]*MediaType{}}
+	for name, mt := range b.Content {
+		if mt == nil {
+			mt = &MediaType{}
+		}
+		schema, err := d.inlineSchemaMap(mt.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("request body %s: %v", name, err)
+		}
+		result.Content[name] = &MediaType{Schema: schema}
+	}
+	return result, nil
+}
+
+// Operations returns the operations of the document sorted by their paths
+// and methods, with the references resolved.
+func (d *Document) Operations() ([]*OperationInfo, error) {
+	paths := make([]string, 0, len(d.Paths))
+	for p := range d.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var result []*OperationInfo
+	for _, path := range paths {
+		item := d.Paths[path]
+		if item == nil {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %s must start with /", path)
+		}
+		if item.Ref != "" {
+			return nil, fmt.Errorf("path %s: references of path items are not supported", path)
+		}
+
+		for _, mo := range []struct {
+			method string
+			op     *Operation
+		}{
+			{http.MethodGet, item.Get},
+			{http.MethodPut, item.Put},
+			{http.MethodPost, item.Post},
+			{http.MethodDelete, item.Delete},
+			{http.MethodOptions, item.Options},
+			{http.MethodHead, item.Head},
+			{http.MethodPatch, item.Patch},
+			{http.MethodTrace, item.Trace},
+		} {
+			if mo.op == nil {
+				continue
+			}
+			info, err := d.operation(path, mo.method, item, mo.op)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %v", mo.method, path, err)
+			}
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+func (d *Document) operation(path, method string, item *PathItem, op *Operation) (*OperationInfo, error) {
+	spec := &OperationSpec{Path: path}
+
+	// the parameters of the operation override the ones of the path with
+	// the same name and location.
+	var params []*Parameter
+	index := map[string]int{}
+	for _, list := range [][]*Parameter{item.Parameters, op.Parameters} {
+		for _, p := range list {
+			p, err := d.resolveParameter(p)
+			if err != nil {
+				return nil, err
+			}
+			key := p.In + ":" + p.Name
+			if i, ok := index[key]; ok {
+				params[i] = p
+				continue
+			}
+			index[key] = len(params)
+			params = append(params, p)
+		}
+	}
+	spec.Parameters = params
+
+	if op.RequestBody != nil {
+		body, err := d.resolveRequestBody(op.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		spec.RequestBody = body
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	id := op.OperationID
+	if id == "" {
+		id = strings.ToLower(method) + path
+	}
+	return &OperationInfo{ID: id, Method: method, Path: path, Spec: spec}, nil
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const petstore = `
+openapi: 3.0.3
+servers:
+- url: http://petstore.example.com/v1
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+      - name: limit
+        in: query
+        schema:
+          type: integer
+          maximum: 100
+      - name: tags
+        in: query
+        schema:
+          type: array
+          items:
+            type: string
+    post:
+      operationId: createPet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+  /pets/mine:
+    get:
+      operationId: listMyPets
+  /pets/{petId}:
+    parameters:
+    - $ref: '#/components/parameters/petId'
+    get:
+      operationId: showPetById
+    delete:
+      parameters:
+      - name: petId
+        in: path
+        schema:
+          type: string
+          pattern: '^[a-z]+$'
+      - name: X-Token
+        in: header
+        required: true
+        schema:
+          type: string
+components:
+  parameters:
+    petId:
+      name: petId
+      in: path
+      required: true
+      schema:
+        type: integer
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+        tag:
+          type: string
+          nullable: true
+        parent:
+          $ref: '#/components/schemas/Pet'
+`
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Parse([]byte("not: [valid"))
+	assert.Error(err)
+	_, err = Parse([]byte(`{"swagger": "2.0", "paths": {"/a": {}}}`))
+	assert.Error(err)
+	_, err = Parse([]byte(`{"openapi": "3.0.0"}`))
+	assert.Error(err)
+
+	doc, err := Parse([]byte(petstore))
+	assert.NoError(err)
+	assert.Equal("3.0.3", doc.OpenAPI)
+	assert.Len(doc.Paths, 3)
+}
+
+func TestOperations(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := Parse([]byte(petstore))
+	assert.NoError(err)
+	ops, err := doc.Operations()
+	assert.NoError(err)
+
+	var ids []string
+	for _, op := range ops {
+		ids = append(ids, op.ID)
+	}
+	assert.Equal([]string{"listPets", "createPet", "listMyPets", "showPetById", "delete/pets/{petId}"}, ids)
+
+	// references are resolved, and the recursive one is replaced.
+	schema := ops[1].Spec.RequestBody.Content["application/json"].Schema
+	props := schema["properties"].(map[string]interface{})
+	assert.Equal(map[string]interface{}{}, props["parent"])
+	assert.Equal([]interface{}{"string", "null"}, props["tag"].(map[string]interface{})["type"])
+
+	// the path parameter is inherited from the path.
+	show := ops[3].Spec
+	assert.Len(show.Parameters, 1)
+	assert.Equal("integer", show.Parameters[0].Schema["type"])
+	assert.True(show.Parameters[0].Required)
+
+	// and overridden by the operation.
+	del := ops[4].Spec
+	assert.Len(del.Parameters, 2)
+	assert.Equal("string", del.Parameters[0].Schema["type"])
+	assert.True(del.Parameters[0].Required)
+	assert.Equal("X-Token", del.Parameters[1].Name)
+
+	for _, bad := range []string{
+		`{"openapi": "3.0.0", "paths": {"pets": {"get": {}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"$ref": "#/a"}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"parameters": [{"$ref": "#/missing"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"parameters": [{"$ref": "other.yaml#/a"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"parameters": [{"name": "id", "in": "path"}]}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/pets": {"get": {"parameters": [{"name": "id", "in": "body"}]}}}}`,
+	} {
+		doc, err := Parse([]byte(bad))
+		assert.NoError(err)
+		_, err = doc.Operations()
+		assert.Error(err, bad)
+	}
+}
+
+func TestResolveEscaped(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := Parse([]byte(`{"openapi": "3.1.0", "paths": {"/a/b": {"get": {}}}, "x": {"c~d": 1}}`))
+	assert.NoError(err)
+	v, err := doc.resolve("#/paths/~1a~1b/get")
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{}, v)
+	v, err = doc.resolve("#/x/c~0d")
+	assert.NoError(err)
+	assert.EqualValues(1, v)
+	_, err = doc.resolve("#/x/c~0d/e")
+	assert.Error(err)
+}
@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ErrUnsupportedMediaType means the media type of the body is not one of
+// the operation.
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// maxSchemaErrors is the max number of the schema errors in an error.
+const maxSchemaErrors = 3
+
+var pathParamRegexp = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+type (
+	// OperationSpec describes the requests of an operation, the references
+	// must have been resolved.
+	OperationSpec struct {
+		// Path is the path template of the operation, e.g. /pets/{petId},
+		// to extract the path parameters.
+		Path        string       `json:"path" jsonschema:"required,pattern=^/"`
+		Parameters  []*Parameter `json:"parameters,omitempty" jsonschema:"omitempty"`
+		RequestBody *RequestBody `json:"requestBody,omitempty" jsonschema:"omitempty"`
+	}
+
+	// RequestValidator validates the requests against an operation.
+	RequestValidator struct {
+		pathRE     *regexp.Regexp
+		pathParams []string
+		params     []*parameter
+		body       *RequestBody
+		// bodySchemas are the schemas of the JSON media types.
+		bodySchemas map[string]*gojsonschema.Schema
+	}
+
+	parameter struct {
+		*Parameter
+		// schema is nil if the parameter is not validated.
+		schema *gojsonschema.Schema
+	}
+)
+
+// Validate validates the OperationSpec.
+func (spec *OperationSpec) Validate() error {
+	_, err := NewRequestValidator(spec)
+	return err
+}
+
+// PathRegexp returns the regular expression matching the path template,
+// each path parameter is a group, the names of which are returned too.
+func PathRegexp(path string) (string, []string) {
+	var sb strings.Builder
+	var names []string
+	sb.WriteByte('^')
+	last := 0
+	for _, m := range pathParamRegexp.FindAllStringSubmatchIndex(path, -1) {
+		sb.WriteString(regexp.QuoteMeta(path[last:m[0]]))
+		sb.WriteString(`([^/]+)`)
+		names = append(names, path[m[2]:m[3]])
+		last = m[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(path[last:]))
+	sb.WriteByte('$')
+	return sb.String(), names
+}
+
+// isJSONMediaType returns whether the bodies of the media type are JSON.
+func isJSONMediaType(name string) bool {
+	return name == "application/json" || strings.HasSuffix(name, "+json")
+}
+
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// NewRequestValidator creates a RequestValidator.
+func NewRequestValidator(spec *OperationSpec) (*RequestValidator, error) {
+	v := &RequestValidator{body: spec.RequestBody}
+
+	re, names := PathRegexp(spec.Path)
+	if len(names) > 0 {
+		v.pathRE = regexp.MustCompile(re)
+		v.pathParams = names
+	}
+
+	for _, p := range spec.Parameters {
+		switch p.In {
+		case "path":
+			found := false
+			for _, name := range names {
+				found = found || name == p.Name
+			}
+			if !found {
+				return nil, fmt.Errorf("path parameter %s is not in path %s", p.Name, spec.Path)
+			}
+		case "query", "header", "cookie":
+		default:
+			return nil, fmt.Errorf("parameter %s: invalid location %q", p.Name, p.In)
+		}
+
+		param := &parameter{Parameter: p}
+		// the values of the object parameters are not validated, as
+		// there are too many styles to serialize them.
+		if p.Schema != nil && schemaType(p.Schema) != "object" {
+			schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(p.Schema))
+			if err != nil {
+				return nil, fmt.Errorf("%s parameter %s: invalid schema: %v", p.In, p.Name, err)
+			}
+			param.schema = schema
+		}
+		v.params = append(v.params, param)
+	}
+
+	if spec.RequestBody != nil {
+		v.bodySchemas = map[string]*gojsonschema.Schema{}
+		for name, mt := range spec.RequestBody.Content {
+			if mt == nil || mt.Schema == nil || !isJSONMediaType(strings.ToLower(name)) {
+				continue
+			}
+			schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(mt.Schema))
+			if err != nil {
+				return nil, fmt.Errorf("request body %s: invalid schema: %v", name, err)
+			}
+			v.bodySchemas[name] = schema
+		}
+	}
+	return v, nil
+}
+
+// Validate validates the parameters and the body of the request. The
+// error wraps ErrUnsupportedMediaType if the media type of the body is not
+// one of the operation.
+func (v *RequestValidator) Validate(r *http.Request, body []byte) error {
+	var pathValues []string
+	if v.pathRE != nil {
+		if m := v.pathRE.FindStringSubmatch(r.URL.Path); m != nil {
+			pathValues = m[1:]
+		}
+	}
+	query := r.URL.Query()
+
+	for _, p := range v.params {
+		var values []string
+		switch p.In {
+		case "path":
+			for i, name := range v.pathParams {
+				if name == p.Name && i < len(pathValues) {
+					values = []string{pathValues[i]}
+				}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+
+		if len(values) == 0 {
+			if p.Required {
+				return fmt.Errorf("%s parameter %s is required", p.In, p.Name)
+			}
+			continue
+		}
+		if p.schema == nil {
+			continue
+		}
+		result, err := p.schema.Validate(gojsonschema.NewGoLoader(coerce(values, p.Schema)))
+		if err != nil {
+			return fmt.Errorf("%s parameter %s: %v", p.In, p.Name, err)
+		}
+		if !result.Valid() {
+			return fmt.Errorf("%s parameter %s: %s", p.In, p.Name, schemaErrors(result))
+		}
+	}
+
+	return v.validateBody(r.Header.Get("Content-Type"), body)
+}
+
+func (v *RequestValidator) validateBody(contentType string, body []byte) error {
+	if v.body == nil {
+		return nil
+	}
+	if len(body) == 0 {
+		if v.body.Required {
+			return fmt.Errorf("request body is required")
+		}
+		return nil
+	}
+	if len(v.body.Content) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrUnsupportedMediaType, contentType)
+	}
+	name, ok := matchMediaType(v.body.Content, mediaType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+
+	schema := v.bodySchemas[name]
+	if schema == nil {
+		return nil
+	}
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	if !result.Valid() {
+		return fmt.Errorf("request body: %s", schemaErrors(result))
+	}
+	return nil
+}
+
+// matchMediaType returns the name of the media type in content matching
+// mediaType, the exact ones are preferred to the ranges like text/*.
+func matchMediaType(content map[string]*MediaType, mediaType string) (string, bool) {
+	candidates := []string{mediaType}
+	if i := strings.IndexByte(mediaType, '/'); i > 0 {
+		candidates = append(candidates, mediaType[:i]+"/*")
+	}
+	candidates = append(candidates, "*/*")
+
+	for _, c := range candidates {
+		for name := range content {
+			if strings.EqualFold(name, c) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// coerce converts the string values of a parameter to the type of its
+// schema. The arrays are in the repeated form, e.g. id=1&id=2, or the
+// comma separated form, e.g. id=1,2. The values failing to convert are
+// kept as strings, so that they fail the validation.
+func coerce(values []string, schema map[string]interface{}) interface{} {
+	if schemaType(schema) != "array" {
+		return coerceValue(values[0], schemaType(schema))
+	}
+
+	if len(values) == 1 {
+		values = strings.Split(values[0], ",")
+	}
+	items, _ := schema["items"].(map[string]interface{})
+	t := schemaType(items)
+	result := make([]interface{}, len(values))
+	for i, s := range values {
+		result[i] = coerceValue(s, t)
+	}
+	return result
+}
+
+func coerceValue(s, t string) interface{} {
+	switch t {
+	case "integer":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+func schemaErrors(result *gojsonschema.Result) string {
+	var msgs []string
+	for i, e := range result.Errors() {
+		if i == maxSchemaErrors {
+			msgs = append(msgs, "...")
+			break
+		}
+		msgs = append(msgs, e.String())
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestValidator(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := Parse([]byte(petstore))
+	assert.NoError(err)
+	ops, err := doc.Operations()
+	assert.NoError(err)
+
+	newValidator := func(i int) *RequestValidator {
+		v, err := NewRequestValidator(ops[i].Spec)
+		assert.NoError(err)
+		return v
+	}
+
+	// parameters
+	v := newValidator(0)
+	assert.NoError(v.Validate(httptest.NewRequest("GET", "/pets", nil), nil))
+	assert.NoError(v.Validate(httptest.NewRequest("GET", "/pets?limit=10&tags=a,b", nil), nil))
+	assert.NoError(v.Validate(httptest.NewRequest("GET", "/pets?tags=a&tags=b", nil), nil))
+	assert.Error(v.Validate(httptest.NewRequest("GET", "/pets?limit=1000", nil), nil))
+	assert.Error(v.Validate(httptest.NewRequest("GET", "/pets?limit=abc", nil), nil))
+
+	v = newValidator(3)
+	assert.NoError(v.Validate(httptest.NewRequest("GET", "/pets/1", nil), nil))
+	assert.Error(v.Validate(httptest.NewRequest("GET", "/pets/abc", nil), nil))
+
+	v = newValidator(4)
+	req := httptest.NewRequest("DELETE", "/pets/abc", nil)
+	assert.Error(v.Validate(req, nil))
+	req.Header.Set("X-Token", "token")
+	assert.NoError(v.Validate(req, nil))
+
+	// body
+	v = newValidator(1)
+	newReq := func(contentType string) *http.Request {
+		req := httptest.NewRequest("POST", "/pets", nil)
+		req.Header.Set("Content-Type", contentType)
+		return req
+	}
+	assert.NoError(v.Validate(newReq("application/json"), []byte(`{"name": "kitty", "tag": null}`)))
+	assert.NoError(v.Validate(newReq("application/json; charset=utf-8"), []byte(`{"name": "kitty", "parent": 1}`)))
+	err = v.Validate(newReq("application/json"), []byte(`{"tag": 1}`))
+	assert.Error(err)
+	assert.True(strings.HasPrefix(err.Error(), "request body: "))
+	assert.Error(v.Validate(newReq("application/json"), []byte(`{`)))
+	assert.Error(v.Validate(newReq("application/json"), nil))
+	err = v.Validate(newReq("text/plain"), []byte(`kitty`))
+	assert.True(errors.Is(err, ErrUnsupportedMediaType))
+	err = v.Validate(newReq(""), []byte(`kitty`))
+	assert.True(errors.Is(err, ErrUnsupportedMediaType))
+}
+
+func TestMatchMediaType(t *testing.T) {
+	assert := assert.New(t)
+
+	content := map[string]*MediaType{
+		"application/json": {},
+		"text/*":           {},
+	}
+	name, ok := matchMediaType(content, "application/json")
+	assert.True(ok)
+	assert.Equal("application/json", name)
+	name, ok = matchMediaType(content, "text/plain")
+	assert.True(ok)
+	assert.Equal("text/*", name)
+	_, ok = matchMediaType(content, "image/png")
+	assert.False(ok)
+
+	content["*/*"] = &MediaType{}
+	name, ok = matchMediaType(content, "image/png")
+	assert.True(ok)
+	assert.Equal("*/*", name)
+}
+
+func TestPathRegexp(t *testing.T) {
+	assert := assert.New(t)
+
+	re, names := PathRegexp("/pets")
+	assert.Equal(`^/pets$`, re)
+	assert.Empty(names)
+
+	re, names = PathRegexp("/v1.0/pets/{petId}/toys/{toyId}")
+	assert.Equal(`^/v1\.0/pets/([^/]+)/toys/([^/]+)$`, re)
+	assert.Equal([]string{"petId", "toyId"}, names)
+}
+
+func TestCoerce(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(int64(1), coerce([]string{"1"}, map[string]interface{}{"type": "integer"}))
+	assert.Equal(1.5, coerce([]string{"1.5"}, map[string]interface{}{"type": "number"}))
+	assert.Equal(true, coerce([]string{"true"}, map[string]interface{}{"type": []interface{}{"null", "boolean"}}))
+	assert.Equal("x", coerce([]string{"x"}, map[string]interface{}{"type": "integer"}))
+	assert.Equal([]interface{}{int64(1), int64(2)}, coerce([]string{"1,2"}, map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "integer"},
+	}))
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package prometheushelper provides helpers to register the Prometheus
+// metrics exposed by the metrics API.
+package prometheushelper
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DurationBuckets are the buckets in seconds of the duration histograms, from
+// 100 microseconds to about 26 seconds, which covers both the fast filters
+// and the slow backends.
+var DurationBuckets = prometheus.ExponentialBuckets(0.0001, 4, 10)
+
+// register registers the collector to the default registry, if an
+// equal collector has been registered, the registered one is returned.
+func register(c prometheus.Collector) prometheus.Collector {
+	err := prometheus.Register(c)
+	if err == nil {
+		return c
+	}
+
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return are.ExistingCollector
+	}
+	panic(err)
+}
+
+// NewCounter creates and registers a counter vector, it returns the
+// registered one if it exists.
+func NewCounter(name, help string, labels []string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	return register(c).(*prometheus.CounterVec)
+}
+
+// NewHistogram creates and registers a histogram vector, it returns the
+// registered one if it exists.
+func NewHistogram(name, help string, buckets []float64, labels []string) *prometheus.HistogramVec {
+	opts := prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}
+	h := prometheus.NewHistogramVec(opts, labels)
+	return register(h).(*prometheus.HistogramVec)
+}
+
+// NewGauge creates and registers a gauge vector, it returns the registered
+// one if it exists.
+func NewGauge(name, help string, labels []string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	return register(g).(*prometheus.GaugeVec)
+}
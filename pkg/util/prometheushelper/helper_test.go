@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package prometheushelper
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCounter(t *testing.T) {
+	assert := assert.New(t)
+
+	c1 := NewCounter("helper_test_total", "test counter", []string{"a"})
+	c2 := NewCounter("helper_test_total", "test counter", []string{"a"})
+	assert.Same(c1, c2)
+
+	c1.WithLabelValues("x").Inc()
+	assert.Equal(1.0, testutil.ToFloat64(c2.WithLabelValues("x")))
+
+	assert.Panics(func() {
+		NewCounter("helper_test_total", "test counter", []string{"b"})
+	})
+}
+
+func TestNewHistogram(t *testing.T) {
+	assert := assert.New(t)
+
+	h1 := NewHistogram("helper_test_seconds", "test histogram", DurationBuckets, []string{"a"})
+	h2 := NewHistogram("helper_test_seconds", "test histogram", DurationBuckets, []string{"a"})
+	assert.Same(h1, h2)
+	assert.Len(DurationBuckets, 10)
+}
+
+func TestNewGauge(t *testing.T) {
+	assert := assert.New(t)
+
+	g1 := NewGauge("helper_test_depth", "test gauge", []string{"a"})
+	g2 := NewGauge("helper_test_depth", "test gauge", []string{"a"})
+	assert.Same(g1, g2)
+
+	g1.WithLabelValues("x").Set(3)
+	assert.Equal(3.0, testutil.ToFloat64(g2.WithLabelValues("x")))
+}
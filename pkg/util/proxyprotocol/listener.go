@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHeaderTimeout = 5 * time.Second
+
+type (
+	// Spec describes how to accept the PROXY protocol on a listener.
+	Spec struct {
+		// TrustedCIDRs are the addresses of the proxies, e.g. the L4 load
+		// balancers, the headers are only read from the connections of
+		// them, empty means all.
+		TrustedCIDRs []string `json:"trustedCIDRs,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// Optional accepts the connections without a header from the
+		// trusted proxies, they are rejected by default.
+		Optional      bool   `json:"optional,omitempty" jsonschema:"omitempty"`
+		HeaderTimeout string `json:"headerTimeout,omitempty" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Policy reads the headers of the connections by a Spec.
+	Policy struct {
+		trusted  []*net.IPNet
+		optional bool
+		timeout  time.Duration
+	}
+
+	// Listener is a listener accepting the PROXY protocol.
+	Listener struct {
+		net.Listener
+		policy *Policy
+	}
+
+	// Conn is a connection whose header is read on the first read or the
+	// first query of its addresses, so that the header is not read by the
+	// goroutine accepting the connections.
+	Conn struct {
+		net.Conn
+		policy *Policy
+
+		once   sync.Once
+		br     *bufio.Reader
+		header *Header
+		err    error
+	}
+)
+
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip %s", s)
+		}
+		if ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+// Validate validates Spec.
+func (spec *Spec) Validate() error {
+	for _, s := range spec.TrustedCIDRs {
+		if _, err := parseCIDR(s); err != nil {
+			return fmt.Errorf("invalid trusted cidr %s: %v", s, err)
+		}
+	}
+	if spec.HeaderTimeout != "" {
+		if _, err := time.ParseDuration(spec.HeaderTimeout); err != nil {
+			return fmt.Errorf("invalid headerTimeout %s: %v", spec.HeaderTimeout, err)
+		}
+	}
+	return nil
+}
+
+// NewPolicy creates a Policy, the spec must be valid.
+func NewPolicy(spec *Spec) *Policy {
+	p := &Policy{optional: spec.Optional, timeout: defaultHeaderTimeout}
+	for _, s := range spec.TrustedCIDRs {
+		ipNet, _ := parseCIDR(s)
+		p.trusted = append(p.trusted, ipNet)
+	}
+	if spec.HeaderTimeout != "" {
+		p.timeout, _ = time.ParseDuration(spec.HeaderTimeout)
+	}
+	return p
+}
+
+func (p *Policy) isTrusted(addr net.Addr) bool {
+	if len(p.trusted) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range p.trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewConn wraps the connection to read its header.
+func (p *Policy) NewConn(c net.Conn) *Conn {
+	return &Conn{Conn: c, policy: p}
+}
+
+// NewListener wraps the listener to accept the PROXY protocol.
+func NewListener(l net.Listener, spec *Spec) *Listener {
+	return &Listener{Listener: l, policy: NewPolicy(spec)}
+}
+
+// Accept accepts one connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.policy.NewConn(c), nil
+}
+
+func (c *Conn) init() {
+	c.br = bufio.NewReader(c.Conn)
+	if !c.policy.isTrusted(c.Conn.RemoteAddr()) {
+		return
+	}
+
+	c.Conn.SetReadDeadline(time.Now().Add(c.policy.timeout))
+	c.header, c.err = ReadHeader(c.br)
+	c.Conn.SetReadDeadline(time.Time{})
+
+	if c.err == ErrNoHeader && c.policy.optional {
+		c.err = nil
+	}
+	if c.err != nil {
+		c.err = fmt.Errorf("failed to read PROXY protocol header from %s: %w", c.Conn.RemoteAddr(), c.err)
+		c.Conn.Close()
+	}
+}
+
+// Header reads and returns the header of the connection, the header is
+// nil if the connection is not from a trusted proxy, or it has no header.
+func (c *Conn) Header() (*Header, error) {
+	c.once.Do(c.init)
+	return c.header, c.err
+}
+
+// Read reads data from the connection after the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	if _, err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the remote
+// address of the connection if the source address is unknown.
+func (c *Conn) RemoteAddr() net.Addr {
+	if h, _ := c.Header(); h != nil && h.Src != nil {
+		return h.Src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, or the local
+// address of the connection if the destination address is unknown.
+func (c *Conn) LocalAddr() net.Addr {
+	if h, _ := c.Header(); h != nil && h.Dst != nil {
+		return h.Dst
+	}
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package proxyprotocol implements the version 1 and 2 of the PROXY protocol,
+// see https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt for the
+// details.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Version1 is the human-readable version of the PROXY protocol.
+	Version1 = "v1"
+	// Version2 is the binary version of the PROXY protocol.
+	Version2 = "v2"
+
+	// maxV1HeaderSize is the max size of a v1 header, including the CRLF.
+	maxV1HeaderSize = 107
+	v2HeaderSize    = 16
+
+	v2CmdLocal = 0x20
+	v2CmdProxy = 0x21
+
+	v2FamilyUnspec = 0x00
+	v2FamilyTCP4   = 0x11
+	v2FamilyTCP6   = 0x21
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// ErrNoHeader means the connection doesn't start with a PROXY protocol
+	// header.
+	ErrNoHeader = errors.New("no PROXY protocol header")
+)
+
+type (
+	// Header is a PROXY protocol header, Src and Dst are nil if the
+	// addresses are unknown, e.g. the connection is established by the
+	// proxy itself for health checks.
+	Header struct {
+		Src *net.TCPAddr
+		Dst *net.TCPAddr
+	}
+
+	headerKey struct{}
+)
+
+// ReadHeader reads the PROXY protocol header from r, it returns
+// ErrNoHeader if the data doesn't start with a header, and nothing is
+// consumed in this case.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b[0] {
+	case v1Prefix[0]:
+		b, err = r.Peek(len(v1Prefix))
+		if err != nil || !bytes.Equal(b, v1Prefix) {
+			return nil, ErrNoHeader
+		}
+		return readV1(r)
+	case v2Signature[0]:
+		b, err = r.Peek(len(v2Signature))
+		if err != nil || !bytes.Equal(b, v2Signature) {
+			return nil, ErrNoHeader
+		}
+		return readV2(r)
+	}
+	return nil, ErrNoHeader
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) >= maxV1HeaderSize {
+			return nil, fmt.Errorf("v1 header is too long")
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("v1 header doesn't end with CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid v1 header %q", line)
+	}
+
+	src, err := parseAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	return &Header{Src: src, Dst: dst}, nil
+}
+
+func parseAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, fmt.Errorf("invalid ip %s", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %s", port)
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	buf := make([]byte, v2HeaderSize)
+	if _, err := readFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	cmd, family := buf[12], buf[13]
+	payload := make([]byte, binary.BigEndian.Uint16(buf[14:]))
+	if _, err := readFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	switch cmd {
+	case v2CmdLocal:
+		return &Header{}, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("invalid v2 version and command 0x%x", cmd)
+	}
+
+	// the addresses of other families are ignored, as well as the TLVs.
+	var ipLen int
+	switch family {
+	case v2FamilyTCP4:
+		ipLen = net.IPv4len
+	case v2FamilyTCP6:
+		ipLen = net.IPv6len
+	default:
+		return &Header{}, nil
+	}
+	if len(payload) < ipLen*2+4 {
+		return nil, fmt.Errorf("v2 addresses are truncated")
+	}
+
+	h := &Header{
+		Src: &net.TCPAddr{IP: net.IP(payload[:ipLen])},
+		Dst: &net.TCPAddr{IP: net.IP(payload[ipLen : ipLen*2])},
+	}
+	h.Src.Port = int(binary.BigEndian.Uint16(payload[ipLen*2:]))
+	h.Dst.Port = int(binary.BigEndian.Uint16(payload[ipLen*2+2:]))
+	return h, nil
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Format formats the header in the version, the addresses are unknown if
+// h is nil.
+func (h *Header) Format(version string) []byte {
+	var src, dst *net.TCPAddr
+	if h != nil && h.Src != nil && h.Dst != nil {
+		src, dst = h.Src, h.Dst
+	}
+
+	// the addresses must be of the same family.
+	ipv4 := src != nil && src.IP.To4() != nil && dst.IP.To4() != nil
+
+	if version == Version1 {
+		if src == nil {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		// the IPv4 addresses are mapped to IPv6 ones if the other is IPv6.
+		proto, srcIP, dstIP := "TCP6", ipv6String(src.IP), ipv6String(dst.IP)
+		if ipv4 {
+			proto, srcIP, dstIP = "TCP4", src.IP.String(), dst.IP.String()
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, src.Port, dst.Port))
+	}
+
+	buf := append([]byte{}, v2Signature...)
+	if src == nil {
+		return append(buf, v2CmdLocal, v2FamilyUnspec, 0, 0)
+	}
+
+	family, srcIP, dstIP := byte(v2FamilyTCP6), src.IP.To16(), dst.IP.To16()
+	if ipv4 {
+		family, srcIP, dstIP = v2FamilyTCP4, src.IP.To4(), dst.IP.To4()
+	}
+	buf = append(buf, v2CmdProxy, family)
+	buf = appendUint16(buf, uint16(len(srcIP)*2+4))
+	buf = append(buf, srcIP...)
+	buf = append(buf, dstIP...)
+	buf = appendUint16(buf, uint16(src.Port))
+	return appendUint16(buf, uint16(dst.Port))
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+// ipv6String formats the IP in IPv6, an IPv4 address is formatted as an
+// IPv4-mapped IPv6 address.
+func ipv6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// WithHeader returns a copy of ctx with the header, which is sent by the
+// dialers of the upstream connections.
+func WithHeader(ctx context.Context, h *Header) context.Context {
+	return context.WithValue(ctx, headerKey{}, h)
+}
+
+// HeaderFromContext returns the header of ctx, it returns nil if there
+// isn't one.
+func HeaderFromContext(ctx context.Context) *Header {
+	h, _ := ctx.Value(headerKey{}).(*Header)
+	return h
+}
+
+// HeaderOfRequest returns the header describing the client connection of
+// the request received by an http.Server.
+func HeaderOfRequest(r *http.Request) *Header {
+	src, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	dst, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	return &Header{Src: src, Dst: dst}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readHeader(data []byte) (*Header, string, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	h, err := ReadHeader(r)
+	rest, _ := io.ReadAll(r)
+	return h, string(rest), err
+}
+
+func TestFormatAndRead(t *testing.T) {
+	assert := assert.New(t)
+
+	h4 := &Header{
+		Src: &net.TCPAddr{IP: net.ParseIP("192.168.1.1").To4(), Port: 56324},
+		Dst: &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 443},
+	}
+	h6 := &Header{
+		Src: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+		Dst: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+	}
+
+	assert.Equal("PROXY TCP4 192.168.1.1 10.0.0.1 56324 443\r\n", string(h4.Format(Version1)))
+	assert.Equal("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", string(h6.Format(Version1)))
+
+	for _, version := range []string{Version1, Version2} {
+		for _, h := range []*Header{h4, h6} {
+			got, rest, err := readHeader(append(h.Format(version), "hello"...))
+			assert.NoError(err)
+			assert.Equal("hello", rest)
+			assert.True(h.Src.IP.Equal(got.Src.IP))
+			assert.Equal(h.Src.Port, got.Src.Port)
+			assert.True(h.Dst.IP.Equal(got.Dst.IP))
+			assert.Equal(h.Dst.Port, got.Dst.Port)
+		}
+
+		// UNKNOWN and LOCAL headers have no addresses.
+		var h *Header
+		got, rest, err := readHeader(append(h.Format(version), "hello"...))
+		assert.NoError(err)
+		assert.Equal("hello", rest)
+		assert.Nil(got.Src)
+		assert.Nil(got.Dst)
+	}
+
+	// data without a header is not consumed.
+	_, rest, err := readHeader([]byte("GET / HTTP/1.1\r\n"))
+	assert.Equal(ErrNoHeader, err)
+	assert.Equal("GET / HTTP/1.1\r\n", rest)
+
+	_, _, err = readHeader([]byte("PROXY TCP4 192.168.1.1 10.0.0.1 56324\r\n"))
+	assert.Error(err)
+	_, _, err = readHeader([]byte("PROXY TCP4 192.168.1.1 10.0.0.1 56324 443\n"))
+	assert.Error(err)
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{TrustedCIDRs: []string{"127.0.0.1/32"}, Optional: true, HeaderTimeout: "1s"}
+	assert.NoError(spec.Validate())
+	assert.Error((&Spec{TrustedCIDRs: []string{"abc"}}).Validate())
+	assert.Error((&Spec{HeaderTimeout: "1"}).Validate())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pl := NewListener(l, spec)
+	defer pl.Close()
+
+	type result struct {
+		remote string
+		data   string
+	}
+	results := make(chan result, 2)
+	go func() {
+		for {
+			conn, err := pl.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				results <- result{conn.RemoteAddr().String(), line}
+			}()
+		}
+	}()
+
+	send := func(data string) result {
+		conn, err := net.DialTimeout("tcp", l.Addr().String(), time.Second)
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.Write([]byte(data))
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+			return result{}
+		}
+	}
+
+	r := send("PROXY TCP4 192.168.1.1 10.0.0.1 56324 443\r\nhello\n")
+	assert.Equal("192.168.1.1:56324", r.remote)
+	assert.Equal("hello\n", r.data)
+
+	// the header is optional.
+	r = send("hello\n")
+	assert.Contains(r.remote, "127.0.0.1:")
+	assert.Equal("hello\n", r.data)
+
+	// the header is required if it is not optional.
+	p := NewPolicy(&Spec{})
+	client, server := net.Pipe()
+	defer client.Close()
+	go client.Write([]byte("hello\n"))
+	_, err = p.NewConn(server).Header()
+	assert.Error(err)
+}
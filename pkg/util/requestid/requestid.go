@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package requestid generates the IDs of the requests, or honors the ones
+// of the incoming requests, to correlate the filters, spans and logs of a
+// request.
+package requestid
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderXRequestID is the default header of the request IDs.
+	HeaderXRequestID = "X-Request-ID"
+
+	// GeneratorUUIDv7 generates time ordered UUIDs defined by RFC 9562.
+	GeneratorUUIDv7 = "uuidv7"
+	// GeneratorSnowflake generates 64 bits integers composed of the time,
+	// the node ID and a sequence number.
+	GeneratorSnowflake = "snowflake"
+
+	// maxIncomingLength is the max length of an incoming ID.
+	maxIncomingLength = 128
+
+	// snowflakeEpoch is 2020-01-01T00:00:00Z in milliseconds.
+	snowflakeEpoch = 1577836800000
+	maxNodeID      = 1023
+)
+
+type (
+	// Spec describes how to generate the request IDs.
+	Spec struct {
+		// Generator is uuidv7 or snowflake, default is uuidv7.
+		Generator string `json:"generator,omitempty" jsonschema:"omitempty,enum=,enum=uuidv7,enum=snowflake"`
+		// Header is the header carrying the IDs, default is X-Request-ID.
+		Header string `json:"header,omitempty" jsonschema:"omitempty"`
+		// IgnoreIncoming generates new IDs even if the requests have
+		// them, e.g. when the clients are not trusted.
+		IgnoreIncoming bool `json:"ignoreIncoming,omitempty" jsonschema:"omitempty"`
+		// ResponseHeader returns the IDs in the header of the responses.
+		ResponseHeader bool `json:"responseHeader,omitempty" jsonschema:"omitempty"`
+		// NodeID is the node ID of the snowflake generator, which must be
+		// unique in the cluster. Zero means deriving it from the name of
+		// the member, which may collide with others.
+		NodeID uint16 `json:"nodeID,omitempty" jsonschema:"omitempty,minimum=0,maximum=1023"`
+	}
+
+	// Generator generates the request IDs.
+	Generator struct {
+		header         string
+		ignoreIncoming bool
+		responseHeader bool
+		node           int64
+		generate       func(g *Generator) string
+	}
+)
+
+// snowflake is shared by all the snowflake generators, so that the IDs
+// are unique in the process even if the generators are recreated.
+var snowflake struct {
+	sync.Mutex
+	last int64
+	seq  int64
+}
+
+// NewGenerator creates a Generator, member is the name of the member to
+// derive the snowflake node ID from.
+func NewGenerator(spec *Spec, member string) *Generator {
+	g := &Generator{
+		header:         HeaderXRequestID,
+		ignoreIncoming: spec.IgnoreIncoming,
+		responseHeader: spec.ResponseHeader,
+		generate:       (*Generator).uuidv7,
+	}
+	if spec.Header != "" {
+		g.header = textproto.CanonicalMIMEHeaderKey(spec.Header)
+	}
+	if spec.Generator == GeneratorSnowflake {
+		g.generate = (*Generator).snowflake
+		g.node = int64(spec.NodeID)
+		if g.node == 0 {
+			h := fnv.New32a()
+			h.Write([]byte(member))
+			g.node = int64(h.Sum32() % (maxNodeID + 1))
+		}
+	}
+	return g
+}
+
+// Header returns the header carrying the IDs.
+func (g *Generator) Header() string {
+	return g.header
+}
+
+// ResponseHeader returns whether to return the IDs in the responses.
+func (g *Generator) ResponseHeader() bool {
+	return g.responseHeader
+}
+
+// Generate generates a new ID.
+func (g *Generator) Generate() string {
+	return g.generate(g)
+}
+
+// Resolve returns the ID of the request whose header is h, which is the
+// incoming one if it is honored and valid, or a new one. The ID is set to
+// h, so that it is forwarded to the backends.
+func (g *Generator) Resolve(h http.Header) string {
+	if !g.ignoreIncoming {
+		if id := h.Get(g.header); validIncoming(id) {
+			return id
+		}
+	}
+	id := g.Generate()
+	h.Set(g.header, id)
+	return id
+}
+
+// validIncoming returns whether the incoming ID is valid, only the visible
+// ASCII characters are allowed, so that it can't forge the logs.
+func validIncoming(id string) bool {
+	if id == "" || len(id) > maxIncomingLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Generator) uuidv7() string {
+	// a random UUID with the leading 48 bits replaced by the timestamp in
+	// milliseconds, and the version changed to 7.
+	u := uuid.New()
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixMilli()))
+	copy(u[:6], ts[2:])
+	u[6] = u[6]&0x0f | 0x70
+	return u.String()
+}
+
+func (g *Generator) snowflake() string {
+	snowflake.Lock()
+	now := time.Now().UnixMilli() - snowflakeEpoch
+	if now < snowflake.last {
+		// the clock moved backwards.
+		now = snowflake.last
+	}
+	if now == snowflake.last {
+		snowflake.seq = (snowflake.seq + 1) & 0xfff
+		if snowflake.seq == 0 {
+			// borrow the next millisecond instead of waiting for it.
+			now++
+		}
+	} else {
+		snowflake.seq = 0
+	}
+	snowflake.last = now
+	id := now<<22 | g.node<<12 | snowflake.seq
+	snowflake.Unlock()
+
+	return strconv.FormatInt(id, 10)
+}
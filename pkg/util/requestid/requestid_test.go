@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package requestid
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDv7(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGenerator(&Spec{}, "member-1")
+	now := time.Now().UnixMilli()
+	u, err := uuid.Parse(g.Generate())
+	assert.NoError(err)
+	assert.Equal(uuid.Version(7), u.Version())
+	assert.Equal(uuid.RFC4122, u.Variant())
+
+	var ms int64
+	for _, b := range u[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	assert.InDelta(now, ms, 1000)
+	assert.NotEqual(g.Generate(), g.Generate())
+}
+
+func TestSnowflake(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGenerator(&Spec{Generator: GeneratorSnowflake, NodeID: 5}, "member-1")
+	ids := map[string]bool{}
+	var last int64
+	for i := 0; i < 10000; i++ {
+		s := g.Generate()
+		id, err := strconv.ParseInt(s, 10, 64)
+		assert.NoError(err)
+		assert.Greater(id, last)
+		assert.Equal(int64(5), id>>12&maxNodeID)
+		last = id
+		ids[s] = true
+	}
+	assert.Len(ids, 10000)
+
+	g1 := NewGenerator(&Spec{Generator: GeneratorSnowflake}, "member-1")
+	g2 := NewGenerator(&Spec{Generator: GeneratorSnowflake}, "member-1")
+	assert.Equal(g1.node, g2.node)
+	assert.LessOrEqual(g1.node, int64(maxNodeID))
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	g := NewGenerator(&Spec{}, "")
+	assert.Equal(HeaderXRequestID, g.Header())
+
+	h := http.Header{}
+	id := g.Resolve(h)
+	assert.NotEmpty(id)
+	assert.Equal(id, h.Get(HeaderXRequestID))
+
+	h = http.Header{}
+	h.Set(HeaderXRequestID, "abc-123")
+	assert.Equal("abc-123", g.Resolve(h))
+
+	for _, invalid := range []string{"a b", "a\nb", strings.Repeat("a", 129)} {
+		h = http.Header{}
+		h.Set(HeaderXRequestID, invalid)
+		id = g.Resolve(h)
+		assert.NotEqual(invalid, id)
+		assert.Equal(id, h.Get(HeaderXRequestID))
+	}
+
+	g = NewGenerator(&Spec{Header: "x-correlation-id", IgnoreIncoming: true, ResponseHeader: true}, "")
+	assert.Equal("X-Correlation-Id", g.Header())
+	assert.True(g.ResponseHeader())
+	h = http.Header{"X-Correlation-Id": []string{"abc-123"}}
+	id = g.Resolve(h)
+	assert.NotEqual("abc-123", id)
+	assert.Equal(id, h.Get("X-Correlation-Id"))
+}
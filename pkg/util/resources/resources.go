@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package resources accounts the resources used by an object, e.g. a
+// pipeline or a server, and enforces the hard limits of them, so that a
+// single object can't exhaust the whole process.
+package resources
+
+import (
+	"sync/atomic"
+)
+
+type (
+	// Limits are the hard limits of the resources of an object, zero
+	// means no limit.
+	Limits struct {
+		// MaxInFlightRequests is the number of the requests being handled
+		// at the same time.
+		MaxInFlightRequests int64 `json:"maxInFlightRequests" jsonschema:"omitempty,minimum=0"`
+		// MaxBufferedBodyBytes is the total size of the bodies buffered in
+		// memory by the in-flight requests.
+		MaxBufferedBodyBytes int64 `json:"maxBufferedBodyBytes" jsonschema:"omitempty,minimum=0"`
+		// MaxGoroutines is the number of the goroutines started by the
+		// object to handle the requests, e.g. for parallel branches.
+		MaxGoroutines int64 `json:"maxGoroutines" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Usage is the current usage of the resources of an object.
+	Usage struct {
+		InFlightRequests  int64 `json:"inFlightRequests"`
+		BufferedBodyBytes int64 `json:"bufferedBodyBytes"`
+		Goroutines        int64 `json:"goroutines"`
+		// RejectedRequests is the number of the requests rejected by the
+		// limits since the object is created.
+		RejectedRequests uint64 `json:"rejectedRequests"`
+	}
+
+	// Tracker tracks the resources of an object, it is shared by all the
+	// generations of the object, so that the in-flight requests of the
+	// previous generations are counted.
+	Tracker struct {
+		limits atomic.Value // *Limits
+
+		inFlightRequests  int64
+		bufferedBodyBytes int64
+		goroutines        int64
+		rejectedRequests  uint64
+	}
+)
+
+// NewTracker creates a Tracker, limits could be nil.
+func NewTracker(limits *Limits) *Tracker {
+	t := &Tracker{}
+	t.SetLimits(limits)
+	return t
+}
+
+// SetLimits updates the limits, limits could be nil.
+func (t *Tracker) SetLimits(limits *Limits) {
+	if limits == nil {
+		limits = &Limits{}
+	}
+	t.limits.Store(limits)
+}
+
+func (t *Tracker) getLimits() *Limits {
+	return t.limits.Load().(*Limits)
+}
+
+// acquire adds n to v, and returns false without adding if the result
+// exceeds max, zero max means no limit.
+func acquire(v *int64, n, max int64) bool {
+	if atomic.AddInt64(v, n) <= max || max <= 0 || n <= 0 {
+		return true
+	}
+	atomic.AddInt64(v, -n)
+	return false
+}
+
+// BeginRequest counts a request with its body of bodyBytes buffered in
+// memory, it returns false if any limit is exceeded, and the request must
+// be rejected. EndRequest must be called with the same bodyBytes if it
+// returns true.
+func (t *Tracker) BeginRequest(bodyBytes int64) bool {
+	limits := t.getLimits()
+	if !acquire(&t.inFlightRequests, 1, limits.MaxInFlightRequests) {
+		atomic.AddUint64(&t.rejectedRequests, 1)
+		return false
+	}
+	if !acquire(&t.bufferedBodyBytes, bodyBytes, limits.MaxBufferedBodyBytes) {
+		atomic.AddInt64(&t.inFlightRequests, -1)
+		atomic.AddUint64(&t.rejectedRequests, 1)
+		return false
+	}
+	return true
+}
+
+// EndRequest finishes a request counted by BeginRequest.
+func (t *Tracker) EndRequest(bodyBytes int64) {
+	atomic.AddInt64(&t.bufferedBodyBytes, -bodyBytes)
+	atomic.AddInt64(&t.inFlightRequests, -1)
+}
+
+// AddBufferedBodyBytes adds n to the buffered bodies without checking the
+// limit, it is for the bodies whose sizes are only known after reading.
+func (t *Tracker) AddBufferedBodyBytes(n int64) {
+	atomic.AddInt64(&t.bufferedBodyBytes, n)
+}
+
+// AcquireGoroutines counts n goroutines, it returns false if the limit is
+// exceeded, and the goroutines must not be started. ReleaseGoroutines
+// must be called after the goroutines exit if it returns true.
+func (t *Tracker) AcquireGoroutines(n int64) bool {
+	return acquire(&t.goroutines, n, t.getLimits().MaxGoroutines)
+}
+
+// ReleaseGoroutines releases n goroutines counted by AcquireGoroutines.
+func (t *Tracker) ReleaseGoroutines(n int64) {
+	atomic.AddInt64(&t.goroutines, -n)
+}
+
+// Usage returns the current usage of the resources.
+func (t *Tracker) Usage() *Usage {
+	return &Usage{
+		InFlightRequests:  atomic.LoadInt64(&t.inFlightRequests),
+		BufferedBodyBytes: atomic.LoadInt64(&t.bufferedBodyBytes),
+		Goroutines:        atomic.LoadInt64(&t.goroutines),
+		RejectedRequests:  atomic.LoadUint64(&t.rejectedRequests),
+	}
+}
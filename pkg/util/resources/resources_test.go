@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	// nil limits means no limit.
+	tr := NewTracker(nil)
+	for i := 0; i < 100; i++ {
+		assert.True(tr.BeginRequest(1024))
+	}
+	assert.True(tr.AcquireGoroutines(100))
+	usage := tr.Usage()
+	assert.Equal(int64(100), usage.InFlightRequests)
+	assert.Equal(int64(100*1024), usage.BufferedBodyBytes)
+	assert.Equal(int64(100), usage.Goroutines)
+	for i := 0; i < 100; i++ {
+		tr.EndRequest(1024)
+	}
+	tr.ReleaseGoroutines(100)
+	assert.Equal(&Usage{}, tr.Usage())
+
+	tr.SetLimits(&Limits{
+		MaxInFlightRequests:  2,
+		MaxBufferedBodyBytes: 100,
+		MaxGoroutines:        3,
+	})
+
+	assert.True(tr.BeginRequest(60))
+	// exceeds the buffered body bytes.
+	assert.False(tr.BeginRequest(60))
+	assert.True(tr.BeginRequest(40))
+	// exceeds the in-flight requests.
+	assert.False(tr.BeginRequest(0))
+	usage = tr.Usage()
+	assert.Equal(int64(2), usage.InFlightRequests)
+	assert.Equal(int64(100), usage.BufferedBodyBytes)
+	assert.Equal(uint64(2), usage.RejectedRequests)
+
+	// the bodies known after reading are counted even beyond the limit.
+	tr.AddBufferedBodyBytes(10)
+	assert.Equal(int64(110), tr.Usage().BufferedBodyBytes)
+	tr.AddBufferedBodyBytes(-10)
+
+	tr.EndRequest(60)
+	assert.True(tr.BeginRequest(0))
+	tr.EndRequest(0)
+	tr.EndRequest(40)
+
+	assert.True(tr.AcquireGoroutines(2))
+	assert.False(tr.AcquireGoroutines(2))
+	assert.True(tr.AcquireGoroutines(1))
+	tr.ReleaseGoroutines(3)
+
+	usage = tr.Usage()
+	assert.Equal(int64(0), usage.InFlightRequests)
+	assert.Equal(int64(0), usage.BufferedBodyBytes)
+	assert.Equal(int64(0), usage.Goroutines)
+	assert.Equal(uint64(2), usage.RejectedRequests)
+}
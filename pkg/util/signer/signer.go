@@ -802,7 +802,7 @@ func (ctx *Context) Verify(req *http.Request, getBody func() io.Reader) error {
 	}
 
 	ctx.sign(req)
-	if sig != ctx.Signature {
+	if !hmac.Equal([]byte(sig), []byte(ctx.Signature)) {
 		return fmt.Errorf("signature verification failed")
 	}
 
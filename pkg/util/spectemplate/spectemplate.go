@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package spectemplate resolves the templated values in the specs of the
+// filters. The environment variables referenced by ${env:NAME} are resolved
+// when the specs are created, and the request data referenced by templates
+// like ${req.header.X-Id} are rendered per request by the filters
+// supporting them. A reference is escaped by doubling the $, e.g.
+// $${env:NAME} is the literal string ${env:NAME}.
+package spectemplate
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+type (
+	// Template is a string with references to the request data.
+	Template struct {
+		src   string
+		parts []part
+	}
+
+	// part is either a literal or a reference, a reference is the field
+	// of the request and the key of the field if the field is a map.
+	part struct {
+		literal string
+		field   string
+		key     string
+	}
+)
+
+var (
+	// envRegexp matches the environment variable references and their
+	// escaped forms.
+	envRegexp = regexp.MustCompile(`\$?\$\{env:([^{}]*)\}`)
+	envName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// reqRegexp matches the request references and their escaped forms.
+	reqRegexp = regexp.MustCompile(`\$?\$\{req\.([^{}]*)\}`)
+
+	// fields are the fields of the request, true means the field is a map
+	// and requires a key.
+	fields = map[string]bool{
+		"method": false,
+		"scheme": false,
+		"host":   false,
+		"path":   false,
+		"realIP": false,
+		"id":     false,
+		"header": true,
+		"query":  true,
+	}
+)
+
+// ResolveEnvJSON replaces the environment variable references in the
+// strings of the JSON document with their values, it returns an error if
+// any of the variables is not set.
+func ResolveEnvJSON(data []byte) ([]byte, error) {
+	if !envRegexp.Match(data) {
+		return data, nil
+	}
+
+	var err error
+	result := envRegexp.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if err != nil {
+			return ref
+		}
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+
+		name := string(envRegexp.FindSubmatch(ref)[1])
+		if !envName.MatchString(name) {
+			err = fmt.Errorf("invalid environment variable name %q", name)
+			return ref
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			err = fmt.Errorf("environment variable %s not set", name)
+			return ref
+		}
+
+		buf := codectool.MustMarshalJSON(value)
+		// remove the quotes, as the references are in JSON strings.
+		return buf[1 : len(buf)-1]
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Compile compiles src into a Template, it returns an error if src
+// references an unknown field of the request.
+func Compile(src string) (*Template, error) {
+	t := &Template{src: src}
+
+	start := 0
+	for _, loc := range reqRegexp.FindAllStringSubmatchIndex(src, -1) {
+		literal := src[start:loc[0]]
+		start = loc[1]
+
+		if src[loc[0]+1] == '$' {
+			t.appendLiteral(literal + src[loc[0]+1:loc[1]])
+			continue
+		}
+		t.appendLiteral(literal)
+
+		ref := src[loc[2]:loc[3]]
+		field, key := ref, ""
+		if i := strings.IndexByte(ref, '.'); i >= 0 {
+			field, key = ref[:i], ref[i+1:]
+		}
+
+		isMap, ok := fields[field]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("unknown field %s of request in %q", field, src)
+		case isMap && key == "":
+			return nil, fmt.Errorf("no key of the %s of request in %q", field, src)
+		case !isMap && key != "":
+			return nil, fmt.Errorf("field %s of request has no key in %q", field, src)
+		}
+		t.parts = append(t.parts, part{field: field, key: key})
+	}
+	t.appendLiteral(src[start:])
+
+	return t, nil
+}
+
+// MustCompile is like Compile but panics if src is invalid, it is for the
+// templates which have been validated.
+func MustCompile(src string) *Template {
+	t, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// CompileMap compiles the values of m, the keys of the result are the
+// keys of m.
+func CompileMap(m map[string]string) (map[string]*Template, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string]*Template, len(m))
+	for k, v := range m {
+		t, err := Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		result[k] = t
+	}
+	return result, nil
+}
+
+func (t *Template) appendLiteral(s string) {
+	if s == "" {
+		return
+	}
+	if n := len(t.parts); n > 0 && t.parts[n-1].field == "" {
+		t.parts[n-1].literal += s
+		return
+	}
+	t.parts = append(t.parts, part{literal: s})
+}
+
+// String returns the source of the template.
+func (t *Template) String() string {
+	return t.src
+}
+
+// IsStatic returns whether the template references no request data.
+func (t *Template) IsStatic() bool {
+	for _, p := range t.parts {
+		if p.field != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Render renders the template with the data of req, the request data are
+// escaped by escape, and the missing ones are empty strings. req could be
+// nil, in which case all the request data are missing.
+func (t *Template) Render(req *httpprot.Request, escape func(string) string) string {
+	if len(t.parts) == 1 && t.parts[0].field == "" {
+		return t.parts[0].literal
+	}
+
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+		sb.WriteString(escape(fieldValue(req, p.field, p.key)))
+	}
+	return sb.String()
+}
+
+func fieldValue(req *httpprot.Request, field, key string) string {
+	if req == nil {
+		return ""
+	}
+
+	switch field {
+	case "method":
+		return req.Method()
+	case "scheme":
+		return req.Scheme()
+	case "host":
+		return req.Host()
+	case "path":
+		return req.Path()
+	case "realIP":
+		return req.RealIP()
+	case "id":
+		return req.RequestID()
+	case "header":
+		return req.HTTPHeader().Get(key)
+	case "query":
+		return req.Std().URL.Query().Get(key)
+	}
+	return ""
+}
+
+// EscapeHeaderValue removes the control characters from v, so that it
+// can't inject headers.
+func EscapeHeaderValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		if (r < 0x20 && r != '\t') || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+}
+
+// EscapeHost removes the characters which are invalid in a host from v,
+// so that it can't change the port, the user info or the path.
+func EscapeHost(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '.' || r == '-' || r == '_':
+			return r
+		}
+		return -1
+	}, v)
+}
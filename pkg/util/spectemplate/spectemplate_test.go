@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spectemplate
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveEnvJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("EG_TEST_TOKEN", `a"b`)
+
+	data := []byte(`{"a": "Bearer ${env:EG_TEST_TOKEN}", "b": "$${env:EG_TEST_TOKEN}"}`)
+	result, err := ResolveEnvJSON(data)
+	assert.NoError(err)
+	assert.Equal(`{"a": "Bearer a\"b", "b": "${env:EG_TEST_TOKEN}"}`, string(result))
+
+	data = []byte(`{"a": "${something}"}`)
+	result, err = ResolveEnvJSON(data)
+	assert.NoError(err)
+	assert.Equal(string(data), string(result))
+
+	_, err = ResolveEnvJSON([]byte(`{"a": "${env:EG_TEST_NOT_EXIST}"}`))
+	assert.Error(err)
+
+	_, err = ResolveEnvJSON([]byte(`{"a": "${env:1-A}"}`))
+	assert.Error(err)
+}
+
+func TestCompile(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, src := range []string{
+		"${req.unknown}",
+		"${req.header}",
+		"${req.query}",
+		"${req.path.x}",
+	} {
+		_, err := Compile(src)
+		assert.Error(err, src)
+		assert.Panics(func() { MustCompile(src) })
+	}
+
+	tmpl := MustCompile("static")
+	assert.True(tmpl.IsStatic())
+	assert.Equal("static", tmpl.String())
+
+	tmpl = MustCompile("$${req.path}")
+	assert.True(tmpl.IsStatic())
+	assert.Equal("${req.path}", tmpl.Render(nil, EscapeHost))
+
+	tmpl = MustCompile("id-${req.header.X-Id}")
+	assert.False(tmpl.IsStatic())
+	assert.Equal("id-", tmpl.Render(nil, EscapeHeaderValue))
+
+	m, err := CompileMap(map[string]string{"X-A": "${req.method}"})
+	assert.NoError(err)
+	assert.Len(m, 1)
+	_, err = CompileMap(map[string]string{"X-A": "${req.header}"})
+	assert.Error(err)
+	m, err = CompileMap(nil)
+	assert.NoError(err)
+	assert.Nil(m)
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com/abc?tenant=t1", nil)
+	stdr.Header.Set("X-Id", "123\r\nX-Evil: 1")
+	stdr.Header.Set("X-Host", "backend.local:8080/x@y")
+	req, _ := httpprot.NewRequest(stdr)
+
+	tmpl := MustCompile("${req.method} ${req.scheme}://${req.host}${req.path} ${req.query.tenant}")
+	assert.Equal("POST http://www.megaease.com/abc t1", tmpl.Render(req, EscapeHeaderValue))
+
+	tmpl = MustCompile("id-${req.header.X-Id}")
+	assert.Equal("id-123X-Evil: 1", tmpl.Render(req, EscapeHeaderValue))
+
+	tmpl = MustCompile("${req.header.X-Host}")
+	assert.Equal("backend.local8080xy", tmpl.Render(req, EscapeHost))
+
+	tmpl = MustCompile("${req.header.X-Missing}")
+	assert.Equal("", tmpl.Render(req, EscapeHost))
+
+	req.SetRequestID("0190d5f2-7c3e-7a4b-9b1e-3f2a1c4d5e6f")
+	tmpl = MustCompile("trace-${req.id}")
+	assert.Equal("trace-0190d5f2-7c3e-7a4b-9b1e-3f2a1c4d5e6f", tmpl.Render(req, EscapeHeaderValue))
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timetool
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	// ScheduleSpec describes a schedule, which is a set of time windows.
+	ScheduleSpec struct {
+		// TimeZone is the IANA name of the time zone of the windows, the
+		// default is UTC.
+		TimeZone string        `json:"timeZone,omitempty" jsonschema:"omitempty"`
+		Windows  []*TimeWindow `json:"windows" jsonschema:"required"`
+	}
+
+	// TimeWindow is a daily window from Start to End on the Days, or an
+	// one-off window from From to To.
+	TimeWindow struct {
+		// Days are the days of the week, mon to sun, empty means every
+		// day.
+		Days []string `json:"days,omitempty" jsonschema:"omitempty,uniqueItems=true"`
+		// Start and End are in the format of HH:MM, the window spans
+		// midnight if End is not after Start.
+		Start string `json:"start,omitempty" jsonschema:"omitempty"`
+		End   string `json:"end,omitempty" jsonschema:"omitempty"`
+
+		// From and To are in the format of RFC3339.
+		From string `json:"from,omitempty" jsonschema:"omitempty"`
+		To   string `json:"to,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Schedule matches time against the windows of a ScheduleSpec.
+	Schedule struct {
+		location *time.Location
+		windows  []*timeWindow
+	}
+
+	timeWindow struct {
+		days  [7]bool
+		start int // minutes of the day
+		end   int
+		from  time.Time
+		to    time.Time
+	}
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Validate validates ScheduleSpec.
+func (spec *ScheduleSpec) Validate() error {
+	_, err := NewSchedule(spec)
+	return err
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %s, must be HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func newTimeWindow(w *TimeWindow) (*timeWindow, error) {
+	tw := &timeWindow{}
+
+	if w.From != "" || w.To != "" {
+		if w.Start != "" || w.End != "" || len(w.Days) > 0 {
+			return nil, fmt.Errorf("from/to can't be used with days and start/end")
+		}
+		var err error
+		if tw.from, err = time.Parse(time.RFC3339, w.From); err != nil {
+			return nil, fmt.Errorf("invalid from %s: %v", w.From, err)
+		}
+		if tw.to, err = time.Parse(time.RFC3339, w.To); err != nil {
+			return nil, fmt.Errorf("invalid to %s: %v", w.To, err)
+		}
+		if !tw.to.After(tw.from) {
+			return nil, fmt.Errorf("to must be after from")
+		}
+		return tw, nil
+	}
+
+	var err error
+	if tw.start, err = parseClock(w.Start); err != nil {
+		return nil, err
+	}
+	if tw.end, err = parseClock(w.End); err != nil {
+		return nil, err
+	}
+
+	if len(w.Days) == 0 {
+		for i := range tw.days {
+			tw.days[i] = true
+		}
+	}
+	for _, d := range w.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %s", d)
+		}
+		tw.days[wd] = true
+	}
+	return tw, nil
+}
+
+// NewSchedule creates a Schedule.
+func NewSchedule(spec *ScheduleSpec) (*Schedule, error) {
+	if len(spec.Windows) == 0 {
+		return nil, fmt.Errorf("windows is empty")
+	}
+
+	s := &Schedule{location: time.UTC}
+	if spec.TimeZone != "" {
+		loc, err := time.LoadLocation(spec.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %s: %v", spec.TimeZone, err)
+		}
+		s.location = loc
+	}
+
+	for _, w := range spec.Windows {
+		tw, err := newTimeWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, tw)
+	}
+	return s, nil
+}
+
+func (tw *timeWindow) match(t time.Time) bool {
+	if !tw.from.IsZero() {
+		return !t.Before(tw.from) && t.Before(tw.to)
+	}
+
+	minutes := t.Hour()*60 + t.Minute()
+	if tw.start < tw.end {
+		return tw.days[t.Weekday()] && minutes >= tw.start && minutes < tw.end
+	}
+
+	// the window spans midnight, the part after midnight belongs to the
+	// window starting on the previous day.
+	if minutes >= tw.start {
+		return tw.days[t.Weekday()]
+	}
+	if minutes < tw.end {
+		return tw.days[(t.Weekday()+6)%7]
+	}
+	return false
+}
+
+// Match returns whether the time is in any window of the schedule.
+func (s *Schedule) Match(t time.Time) bool {
+	t = t.In(s.location)
+	for _, w := range s.windows {
+		if w.match(t) {
+			return true
+		}
+	}
+	return false
+}
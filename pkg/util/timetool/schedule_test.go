@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package timetool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewSchedule(&ScheduleSpec{
+		Windows: []*TimeWindow{
+			{Days: []string{"sat", "sun"}, Start: "09:00", End: "17:00"},
+			{Days: []string{"mon"}, Start: "22:00", End: "02:00"},
+			{From: "2023-01-02T10:00:00Z", To: "2023-01-02T11:00:00Z"},
+		},
+	})
+	assert.NoError(err)
+
+	at := func(s string) time.Time {
+		t, _ := time.Parse(time.RFC3339, s)
+		return t
+	}
+
+	// 2022-12-31 is a Saturday.
+	assert.True(s.Match(at("2022-12-31T09:00:00Z")))
+	assert.False(s.Match(at("2022-12-31T17:00:00Z")))
+	assert.False(s.Match(at("2022-12-30T10:00:00Z")))
+
+	// the window of Monday spans midnight.
+	assert.True(s.Match(at("2023-01-02T23:00:00Z")))
+	assert.True(s.Match(at("2023-01-03T01:59:00Z")))
+	assert.False(s.Match(at("2023-01-03T02:00:00Z")))
+	assert.False(s.Match(at("2023-01-02T01:00:00Z")))
+
+	// the one-off window.
+	assert.True(s.Match(at("2023-01-02T10:30:00Z")))
+	assert.False(s.Match(at("2023-01-02T11:00:00Z")))
+
+	// the time zone.
+	s, err = NewSchedule(&ScheduleSpec{
+		TimeZone: "UTC",
+		Windows:  []*TimeWindow{{Start: "09:00", End: "10:00"}},
+	})
+	assert.NoError(err)
+	assert.True(s.Match(at("2023-01-02T17:30:00+08:00")))
+	assert.False(s.Match(at("2023-01-02T09:30:00+08:00")))
+}
+
+func TestScheduleValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	invalid := []*ScheduleSpec{
+		{},
+		{TimeZone: "Invalid/Zone", Windows: []*TimeWindow{{Start: "09:00", End: "10:00"}}},
+		{Windows: []*TimeWindow{{Start: "9", End: "10:00"}}},
+		{Windows: []*TimeWindow{{Days: []string{"day"}, Start: "09:00", End: "10:00"}}},
+		{Windows: []*TimeWindow{{From: "2023-01-02T10:00:00Z", To: "2023-01-02T09:00:00Z"}}},
+		{Windows: []*TimeWindow{{From: "2023-01-02T10:00:00Z", To: "2023-01-02T11:00:00Z", Start: "09:00"}}},
+	}
+	for _, spec := range invalid {
+		assert.Error(spec.Validate())
+	}
+}
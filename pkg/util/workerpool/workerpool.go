@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package workerpool provides a bounded pool of goroutines to run tasks,
+// it is for sharing goroutines among a large number of connections instead
+// of starting goroutines per connection.
+package workerpool
+
+import (
+	"sync"
+)
+
+// Pool is a pool of workers running the submitted tasks.
+type Pool struct {
+	tasks chan func()
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// New creates a Pool with the number of workers, and a queue of queueSize
+// tasks waiting for the workers. Submit blocks if the queue is full, which
+// applies the backpressure to the submitters.
+func New(workers, queueSize int) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	p := &Pool{
+		tasks: make(chan func(), queueSize),
+		done:  make(chan struct{}),
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *Pool) run() {
+	defer p.wg.Done()
+	for {
+		select {
+		case task := <-p.tasks:
+			task()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Submit submits task to the pool, it blocks until the task is queued, and
+// returns false if the pool is closed.
+func (p *Pool) Submit(task func()) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+
+	select {
+	case p.tasks <- task:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// TrySubmit submits task to the pool without blocking, it returns false if
+// the queue is full or the pool is closed.
+func (p *Pool) TrySubmit(task func()) bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Pending returns the number of the tasks waiting for the workers.
+func (p *Pool) Pending() int {
+	return len(p.tasks)
+}
+
+// Close stops the workers after their running tasks finish, the queued
+// tasks are dropped.
+func (p *Pool) Close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+}
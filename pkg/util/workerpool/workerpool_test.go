@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workerpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+
+	p := New(4, 10)
+	var count int32
+	wg := &sync.WaitGroup{}
+	wg.Add(100)
+	for i := 0; i < 100; i++ {
+		assert.True(p.Submit(func() {
+			atomic.AddInt32(&count, 1)
+			wg.Done()
+		}))
+	}
+	wg.Wait()
+	assert.Equal(int32(100), atomic.LoadInt32(&count))
+
+	p.Close()
+	assert.False(p.Submit(func() {}))
+	assert.False(p.TrySubmit(func() {}))
+	// closing again is fine.
+	p.Close()
+}
+
+func TestBackpressure(t *testing.T) {
+	assert := assert.New(t)
+
+	p := New(1, 1)
+	defer p.Close()
+
+	block, started := make(chan struct{}), make(chan struct{})
+	assert.True(p.Submit(func() {
+		close(started)
+		<-block
+	}))
+	<-started
+
+	// the worker is busy, so only one task could be queued.
+	assert.True(p.TrySubmit(func() {}))
+	assert.False(p.TrySubmit(func() {}))
+	assert.Equal(1, p.Pending())
+
+	close(block)
+	assert.True(p.Submit(func() {}))
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package xmltool provides the parsing of XML documents, the conversion
+// between XML and JSON, and subsets of XPath and XML Schema.
+package xmltool
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// AttrPrefix is the prefix of the keys of attributes in the JSON
+	// converted from XML.
+	AttrPrefix = "@"
+	// TextKey is the key of the text of elements with attributes or child
+	// elements in the JSON converted from XML.
+	TextKey = "#text"
+
+	xmlnsSpace = "http://www.w3.org/2000/xmlns/"
+	xsiSpace   = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// Node is an element of an XML document.
+type Node struct {
+	// Space is the namespace URI of the element.
+	Space    string
+	Name     string
+	Attrs    []xml.Attr
+	Children []*Node
+	// Text is the character data directly in the element.
+	Text   string
+	Parent *Node
+}
+
+// Parse parses an XML document and returns its root element.
+func Parse(data []byte) (*Node, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *Node
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &Node{Space: t.Name.Space, Name: t.Name.Local, Attrs: t.Attr, Parent: current}
+			if current != nil {
+				current.Children = append(current.Children, n)
+			} else if root != nil {
+				return nil, fmt.Errorf("multiple root elements")
+			} else {
+				root = n
+			}
+			current = n
+		case xml.EndElement:
+			current = current.Parent
+		case xml.CharData:
+			if current != nil {
+				current.Text += string(t)
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("text out of the root element")
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// Attr returns the value of the attribute of the local name, the namespace
+// of the attribute is ignored.
+func (n *Node) Attr(name string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name && !isNamespaceDecl(a) {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// InnerText returns the text of the element and all of its descendants.
+func (n *Node) InnerText() string {
+	if len(n.Children) == 0 {
+		return n.Text
+	}
+	var sb strings.Builder
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		// the text of an element is not interleaved with its children
+		// in Node, so the order of mixed content is not kept.
+		sb.WriteString(n.Text)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// isNamespaceDecl returns whether the attribute is a namespace declaration.
+func isNamespaceDecl(a xml.Attr) bool {
+	return a.Name.Space == "xmlns" || a.Name.Space == xmlnsSpace ||
+		(a.Name.Space == "" && a.Name.Local == "xmlns")
+}
+
+// ToMap converts the element to a JSON object whose only key is the name
+// of the element. An element without attributes and child elements is
+// converted to its text, otherwise, it is converted to an object, whose
+// attributes are keyed by their names prefixed with AttrPrefix, the text is
+// keyed by TextKey, and the child elements are keyed by their names, the
+// elements of the same name are converted to an array. The namespaces are
+// dropped, and so are the namespace declarations.
+func (n *Node) ToMap() map[string]interface{} {
+	return map[string]interface{}{n.Name: n.value()}
+}
+
+func (n *Node) value() interface{} {
+	text := strings.TrimSpace(n.Text)
+
+	m := map[string]interface{}{}
+	for _, a := range n.Attrs {
+		if !isNamespaceDecl(a) {
+			m[AttrPrefix+a.Name.Local] = a.Value
+		}
+	}
+	if len(m) == 0 && len(n.Children) == 0 {
+		return text
+	}
+
+	for _, c := range n.Children {
+		v := c.value()
+		switch old := m[c.Name].(type) {
+		case nil:
+			m[c.Name] = v
+		case []interface{}:
+			m[c.Name] = append(old, v)
+		default:
+			m[c.Name] = []interface{}{old, v}
+		}
+	}
+	if text != "" {
+		m[TextKey] = text
+	}
+	return m
+}
+
+// Marshal converts JSON data to XML, it's the reverse of ToMap. If data is
+// an object with only one key, the key is the name of the root element,
+// otherwise, data is wrapped into a root element named by root. Objects are
+// converted with their keys sorted, the keys prefixed with AttrPrefix are
+// converted to attributes, and the value of TextKey is the text.
+func Marshal(data interface{}, root string) ([]byte, error) {
+	var buf bytes.Buffer
+	if m, ok := data.(map[string]interface{}); ok && len(m) == 1 {
+		for k, v := range m {
+			root, data = k, v
+		}
+	}
+	if err := encode(&buf, root, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, name string, data interface{}) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid element name %q", name)
+	}
+
+	if list, ok := data.([]interface{}); ok {
+		for _, item := range list {
+			if _, ok := item.([]interface{}); ok {
+				return fmt.Errorf("nested array of %s can't be converted", name)
+			}
+			if err := encode(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	buf.WriteString("<" + name)
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		buf.WriteString(">")
+		if data != nil {
+			xml.EscapeText(buf, []byte(fmt.Sprint(data)))
+		}
+		buf.WriteString("</" + name + ">")
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !strings.HasPrefix(k, AttrPrefix) {
+			continue
+		}
+		attr := k[len(AttrPrefix):]
+		if !isValidName(attr) {
+			return fmt.Errorf("invalid attribute name %q", attr)
+		}
+		buf.WriteString(" " + attr + `="`)
+		xml.EscapeText(buf, []byte(fmt.Sprint(m[k])))
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+
+	if text, ok := m[TextKey]; ok && text != nil {
+		xml.EscapeText(buf, []byte(fmt.Sprint(text)))
+	}
+	for _, k := range keys {
+		if k == TextKey || strings.HasPrefix(k, AttrPrefix) {
+			continue
+		}
+		if err := encode(buf, k, m[k]); err != nil {
+			return err
+		}
+	}
+
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// isValidName returns whether name is a valid XML name, it is stricter
+// than the specification, only ASCII names are allowed.
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case i > 0 && (c >= '0' && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
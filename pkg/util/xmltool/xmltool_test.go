@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xmltool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const soapRequest = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:m="http://example.com/stock">
+  <soap:Header/>
+  <soap:Body>
+    <m:GetPrice currency="USD">
+      <m:Item id="1">Apple</m:Item>
+      <m:Item id="2">Banana</m:Item>
+      <m:Region>EU</m:Region>
+    </m:GetPrice>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := Parse([]byte(soapRequest))
+	assert.NoError(err)
+	assert.Equal("Envelope", root.Name)
+	assert.Equal("http://schemas.xmlsoap.org/soap/envelope/", root.Space)
+	assert.Len(root.Children, 2)
+
+	price := root.Children[1].Children[0]
+	assert.Equal("GetPrice", price.Name)
+	assert.Equal(root.Children[1], price.Parent)
+	v, ok := price.Attr("currency")
+	assert.True(ok)
+	assert.Equal("USD", v)
+	_, ok = root.Attr("m")
+	assert.False(ok)
+
+	for _, doc := range []string{``, `<a>`, `<a></b>`, `<a/><b/>`, `text<a/>`} {
+		_, err = Parse([]byte(doc))
+		assert.Error(err, doc)
+	}
+}
+
+func TestToMap(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := Parse([]byte(soapRequest))
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"Envelope": map[string]interface{}{
+			"Header": "",
+			"Body": map[string]interface{}{
+				"GetPrice": map[string]interface{}{
+					"@currency": "USD",
+					"Item": []interface{}{
+						map[string]interface{}{"@id": "1", "#text": "Apple"},
+						map[string]interface{}{"@id": "2", "#text": "Banana"},
+					},
+					"Region": "EU",
+				},
+			},
+		},
+	}, root.ToMap())
+}
+
+func TestMarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := Marshal(map[string]interface{}{
+		"order": map[string]interface{}{
+			"@id":   1,
+			"items": []interface{}{"a<b", "c"},
+			"note":  map[string]interface{}{"@lang": "en", "#text": "hi"},
+			"empty": nil,
+		},
+	}, "root")
+	assert.NoError(err)
+	assert.Equal(`<order id="1"><empty></empty><items>a&lt;b</items><items>c</items><note lang="en">hi</note></order>`, string(data))
+
+	data, err = Marshal(map[string]interface{}{"a": 1, "b": true}, "root")
+	assert.NoError(err)
+	assert.Equal(`<root><a>1</a><b>true</b></root>`, string(data))
+
+	data, err = Marshal("text", "root")
+	assert.NoError(err)
+	assert.Equal(`<root>text</root>`, string(data))
+
+	// round trip.
+	root, err := Parse([]byte(soapRequest))
+	assert.NoError(err)
+	data, err = Marshal(root.ToMap(), "root")
+	assert.NoError(err)
+	root2, err := Parse(data)
+	assert.NoError(err)
+	assert.Equal(root.ToMap(), root2.ToMap())
+
+	_, err = Marshal(map[string]interface{}{"a b": 1, "c": 2}, "root")
+	assert.Error(err)
+	_, err = Marshal(map[string]interface{}{"a": []interface{}{[]interface{}{1}}}, "root")
+	assert.Error(err)
+	_, err = Marshal([]interface{}{1, 2}, "")
+	assert.Error(err)
+}
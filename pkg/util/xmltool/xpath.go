@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xmltool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// XPath is a compiled XPath expression. Only a subset of XPath is
+	// supported: absolute and relative location paths of the child and
+	// descendant (//) axes, the name tests (*, names and text()), the
+	// attribute (@name) and the abbreviated steps (. and ..), and the
+	// predicates of positions, e.g. [1], of existences, e.g. [@id] and
+	// [name], and of equalities, e.g. [@id='1'], [name="x"] and
+	// [text()='x']. The namespace prefixes of names are ignored, the names
+	// match the local names of the nodes.
+	XPath struct {
+		expr  string
+		steps []*step
+	}
+
+	step struct {
+		descendant bool
+		// kind is one of element, attr, text, self and parent.
+		kind       string
+		name       string
+		predicates []*predicate
+	}
+
+	predicate struct {
+		position int
+		// kind is one of attr, element and text.
+		kind     string
+		name     string
+		hasValue bool
+		value    string
+	}
+)
+
+// CompileXPath compiles an XPath expression.
+func CompileXPath(expr string) (*XPath, error) {
+	x := &XPath{expr: expr}
+
+	rest := strings.TrimSpace(expr)
+	if rest == "" {
+		return nil, fmt.Errorf("empty xpath")
+	}
+	// relative paths are evaluated from the document, so they are the
+	// same as the absolute ones.
+	if strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, "//") {
+		rest = rest[1:]
+	}
+
+	for rest != "" {
+		s := &step{}
+		if strings.HasPrefix(rest, "//") {
+			s.descendant = true
+			rest = rest[2:]
+		} else if strings.HasPrefix(rest, "/") {
+			rest = rest[1:]
+		}
+
+		var token string
+		var err error
+		token, rest, err = nextStep(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xpath %s: %v", expr, err)
+		}
+		if err = s.parse(token); err != nil {
+			return nil, fmt.Errorf("invalid xpath %s: %v", expr, err)
+		}
+		if n := len(x.steps); n > 0 && (x.steps[n-1].kind == "attr" || x.steps[n-1].kind == "text") {
+			return nil, fmt.Errorf("invalid xpath %s: step after %s", expr, token)
+		}
+		x.steps = append(x.steps, s)
+	}
+
+	return x, nil
+}
+
+// nextStep splits the first step from the path, the slashes in the
+// predicates are not separators.
+func nextStep(path string) (string, string, error) {
+	depth, quote := 0, rune(0)
+	for i, c := range path {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '/' && depth == 0:
+			if i == 0 {
+				return "", "", fmt.Errorf("empty step")
+			}
+			return path[:i], path[i:], nil
+		}
+	}
+	if quote != 0 || depth != 0 {
+		return "", "", fmt.Errorf("unbalanced quotes or brackets")
+	}
+	return path, "", nil
+}
+
+// localName removes the namespace prefix of a name.
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func (s *step) parse(token string) error {
+	token = strings.TrimSpace(token)
+	name := token
+	if i := strings.IndexByte(token, '['); i >= 0 {
+		name = strings.TrimSpace(token[:i])
+		preds := token[i:]
+		for preds != "" {
+			if preds[0] != '[' {
+				return fmt.Errorf("invalid predicate %s", preds)
+			}
+			end := strings.IndexByte(preds, ']')
+			// brackets in quotes.
+			for end > 0 && strings.Count(preds[:end], "'")%2+strings.Count(preds[:end], `"`)%2 != 0 {
+				next := strings.IndexByte(preds[end+1:], ']')
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += next + 1
+			}
+			if end < 0 {
+				return fmt.Errorf("unbalanced brackets")
+			}
+			p, err := parsePredicate(preds[1:end])
+			if err != nil {
+				return err
+			}
+			s.predicates = append(s.predicates, p)
+			preds = strings.TrimSpace(preds[end+1:])
+		}
+	}
+
+	switch {
+	case name == "":
+		return fmt.Errorf("empty step")
+	case name == ".":
+		s.kind = "self"
+	case name == "..":
+		s.kind = "parent"
+	case name == "text()":
+		s.kind = "text"
+	case strings.HasPrefix(name, "@"):
+		s.kind, s.name = "attr", localName(name[1:])
+	default:
+		s.kind, s.name = "element", localName(name)
+	}
+
+	if s.kind != "element" && len(s.predicates) > 0 {
+		return fmt.Errorf("predicates of %s are not supported", name)
+	}
+	if s.name == "" && (s.kind == "attr" || s.kind == "element") {
+		return fmt.Errorf("empty name")
+	}
+	return nil
+}
+
+func parsePredicate(expr string) (*predicate, error) {
+	expr = strings.TrimSpace(expr)
+	if n, err := strconv.Atoi(expr); err == nil {
+		if n < 1 {
+			return nil, fmt.Errorf("invalid position %d", n)
+		}
+		return &predicate{position: n}, nil
+	}
+
+	p := &predicate{}
+	name := expr
+	if i := strings.IndexByte(expr, '='); i >= 0 {
+		name = strings.TrimSpace(expr[:i])
+		value := strings.TrimSpace(expr[i+1:])
+		if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+			return nil, fmt.Errorf("invalid value in predicate %s", expr)
+		}
+		p.hasValue, p.value = true, value[1:len(value)-1]
+	}
+
+	switch {
+	case name == "text()":
+		p.kind = "text"
+	case strings.HasPrefix(name, "@"):
+		p.kind, p.name = "attr", localName(name[1:])
+	default:
+		p.kind, p.name = "element", localName(name)
+	}
+	if p.kind != "text" && (p.name == "" || strings.ContainsAny(p.name, "[]()/@ ")) {
+		return nil, fmt.Errorf("invalid predicate %s", expr)
+	}
+	if p.kind == "text" && !p.hasValue {
+		return nil, fmt.Errorf("invalid predicate %s", expr)
+	}
+	return p, nil
+}
+
+// String returns the expression of the XPath.
+func (x *XPath) String() string {
+	return x.expr
+}
+
+// SelectNodes returns the elements selected by the XPath from the document
+// of the root element, it returns nil if the XPath selects attributes or
+// texts.
+func (x *XPath) SelectNodes(root *Node) []*Node {
+	if last := x.steps[len(x.steps)-1]; last.kind == "attr" || last.kind == "text" {
+		return nil
+	}
+	return x.selectNodes(root, x.steps)
+}
+
+func (x *XPath) selectNodes(root *Node, steps []*step) []*Node {
+	// the document node, it's not the parent of the root element as it
+	// is not part of the document.
+	doc := &Node{Children: []*Node{root}}
+	nodes := []*Node{doc}
+	for _, s := range steps {
+		nodes = s.apply(nodes, doc)
+	}
+	return nodes
+}
+
+// Select returns the string values of the nodes selected by the XPath
+// from the document of the root element, the value of an element is its
+// inner text.
+func (x *XPath) Select(root *Node) []string {
+	steps := x.steps
+	last := steps[len(steps)-1]
+	if last.kind == "attr" || last.kind == "text" {
+		steps = steps[:len(steps)-1]
+	}
+
+	nodes := x.selectNodes(root, steps)
+	if steps := len(steps); steps < len(x.steps) && last.descendant {
+		var descendants []*Node
+		for _, n := range nodes {
+			walk(n, func(d *Node) { descendants = append(descendants, d) })
+		}
+		nodes = descendants
+	}
+
+	var values []string
+	for _, n := range nodes {
+		switch last.kind {
+		case "attr":
+			if v, ok := n.Attr(last.name); ok {
+				values = append(values, v)
+			}
+		case "text":
+			if n.Text != "" {
+				values = append(values, n.Text)
+			}
+		default:
+			values = append(values, n.InnerText())
+		}
+	}
+	return values
+}
+
+// SelectFirst returns the value of the first node selected by the XPath,
+// it returns false if no nodes are selected.
+func (x *XPath) SelectFirst(root *Node) (string, bool) {
+	values := x.Select(root)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+func walk(n *Node, fn func(n *Node)) {
+	fn(n)
+	for _, c := range n.Children {
+		walk(c, fn)
+	}
+}
+
+func (s *step) apply(nodes []*Node, doc *Node) []*Node {
+	var result []*Node
+	seen := map[*Node]struct{}{}
+	add := func(n *Node) {
+		if _, ok := seen[n]; !ok {
+			seen[n] = struct{}{}
+			result = append(result, n)
+		}
+	}
+
+	for _, n := range nodes {
+		var candidates []*Node
+		if s.descendant {
+			walk(n, func(d *Node) { candidates = append(candidates, d) })
+		} else {
+			candidates = []*Node{n}
+		}
+
+		switch s.kind {
+		case "self", "attr", "text":
+			// attributes and texts are handled by Select.
+			for _, c := range candidates {
+				add(c)
+			}
+		case "parent":
+			for _, c := range candidates {
+				if c.Parent != nil {
+					add(c.Parent)
+				} else if c != doc {
+					add(doc)
+				}
+			}
+		case "element":
+			for _, c := range candidates {
+				var matched []*Node
+				for _, child := range c.Children {
+					if s.name == "*" || s.name == child.Name {
+						matched = append(matched, child)
+					}
+				}
+				for _, p := range s.predicates {
+					matched = p.filter(matched)
+				}
+				for _, m := range matched {
+					add(m)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func (p *predicate) filter(nodes []*Node) []*Node {
+	if p.position > 0 {
+		if p.position > len(nodes) {
+			return nil
+		}
+		return nodes[p.position-1 : p.position]
+	}
+
+	var result []*Node
+	for _, n := range nodes {
+		if p.match(n) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func (p *predicate) match(n *Node) bool {
+	switch p.kind {
+	case "attr":
+		v, ok := n.Attr(p.name)
+		return ok && (!p.hasValue || v == p.value)
+	case "text":
+		return n.Text == p.value
+	default:
+		for _, c := range n.Children {
+			if (p.name == "*" || c.Name == p.name) && (!p.hasValue || c.InnerText() == p.value) {
+				return true
+			}
+		}
+		return false
+	}
+}
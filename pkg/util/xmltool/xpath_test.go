@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xmltool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXPath(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := Parse([]byte(soapRequest))
+	assert.NoError(err)
+
+	cases := []struct {
+		expr   string
+		values []string
+	}{
+		{"/soap:Envelope/soap:Body/m:GetPrice/m:Region", []string{"EU"}},
+		{"Envelope/Body/GetPrice/Region/text()", []string{"EU"}},
+		{"/Envelope/Body/*/@currency", []string{"USD"}},
+		{"//Item", []string{"Apple", "Banana"}},
+		{"//Item[2]", []string{"Banana"}},
+		{"//Item[@id='1']", []string{"Apple"}},
+		{`//Item[text()="Banana"]/@id`, []string{"2"}},
+		{"//Item/@id", []string{"1", "2"}},
+		{"//@id", []string{"1", "2"}},
+		{"//GetPrice[Region='EU']/@currency", []string{"USD"}},
+		{"//GetPrice[Region='US']/@currency", nil},
+		{"//GetPrice[@currency]/Item[1]/../Region", []string{"EU"}},
+		{"//Region/.", []string{"EU"}},
+		{"/Body", nil},
+		{"//Missing", nil},
+	}
+	for _, c := range cases {
+		x, err := CompileXPath(c.expr)
+		assert.NoError(err, c.expr)
+		assert.Equal(c.values, x.Select(root), c.expr)
+	}
+
+	x, _ := CompileXPath("//Item")
+	assert.Len(x.SelectNodes(root), 2)
+	v, ok := x.SelectFirst(root)
+	assert.True(ok)
+	assert.Equal("Apple", v)
+
+	x, _ = CompileXPath("//Item/@id")
+	assert.Nil(x.SelectNodes(root))
+
+	for _, expr := range []string{"", "/a//", "a[", "a[0]", "a[@]", "a[b=c]", "@id/a", "a/text()/b", "..[1]"} {
+		_, err := CompileXPath(expr)
+		assert.Error(err, expr)
+	}
+}
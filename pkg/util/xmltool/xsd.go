@@ -0,0 +1,929 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xmltool
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const xsdSpace = "http://www.w3.org/2001/XMLSchema"
+
+type (
+	// Schema is a compiled XML Schema. Only a subset of XML Schema is
+	// supported: the global and local elements and element references, the
+	// named and anonymous complex and simple types, the sequence, choice,
+	// all and any particles with their occurrences, the attributes, the
+	// simple contents, the restrictions of simple types by facets, and the
+	// common built-in types. Elements and attributes are matched by their
+	// local names, and only the namespace of the root element is checked
+	// against the target namespace of the schema.
+	Schema struct {
+		targetNamespace string
+		elements        map[string]*elementDecl
+		types           map[string]*xsdType
+
+		// pending are the resolutions of the references, which are done
+		// after all of the global declarations are parsed.
+		pending []func() error
+	}
+
+	elementDecl struct {
+		name string
+		typ  *xsdType
+		// ref is the referenced global element.
+		ref *elementDecl
+	}
+
+	xsdType struct {
+		// builtin is the name of the built-in type, it is empty for the
+		// types defined by the schema.
+		builtin string
+		simple  *simpleType
+		complex *complexType
+	}
+
+	simpleType struct {
+		base        *xsdType
+		enumeration []string
+		patterns    []*regexp.Regexp
+		length      int
+		minLength   int
+		maxLength   int
+		minInc      *float64
+		maxInc      *float64
+		minExc      *float64
+		maxExc      *float64
+		totalDigits int
+		fracDigits  int
+	}
+
+	complexType struct {
+		mixed        bool
+		model        *particle
+		attributes   []*attributeDecl
+		anyAttribute bool
+		// simpleContent is the type of the text of the element if the
+		// element has a simple content.
+		simpleContent *xsdType
+	}
+
+	particle struct {
+		// kind is one of element, sequence, choice, all and any.
+		kind     string
+		element  *elementDecl
+		children []*particle
+		min      int
+		// max is -1 if it's unbounded.
+		max int
+	}
+
+	attributeDecl struct {
+		name     string
+		typ      *xsdType
+		required bool
+	}
+
+	// missingError means the required content is not found, a particle
+	// failing with it without consuming any elements matches nothing.
+	missingError struct {
+		path     string
+		expected string
+	}
+)
+
+var builtinTypes = map[string]struct{}{
+	"anyType": {}, "anySimpleType": {}, "string": {}, "normalizedString": {},
+	"token": {}, "language": {}, "Name": {}, "NCName": {}, "ID": {},
+	"IDREF": {}, "QName": {}, "anyURI": {}, "boolean": {}, "decimal": {},
+	"float": {}, "double": {}, "integer": {}, "nonPositiveInteger": {},
+	"negativeInteger": {}, "nonNegativeInteger": {}, "positiveInteger": {},
+	"long": {}, "int": {}, "short": {}, "byte": {}, "unsignedLong": {},
+	"unsignedInt": {}, "unsignedShort": {}, "unsignedByte": {},
+	"date": {}, "dateTime": {}, "time": {}, "duration": {},
+	"base64Binary": {}, "hexBinary": {},
+}
+
+var (
+	dateRegexp     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(Z|[+-]\d{2}:\d{2})?$`)
+	timeRegexp     = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+	durationRegexp = regexp.MustCompile(`^-?P(\d+Y)?(\d+M)?(\d+D)?(T(\d+H)?(\d+M)?(\d+(\.\d+)?S)?)?$`)
+	nameRegexp     = regexp.MustCompile(`^[A-Za-z_:][-A-Za-z0-9_:.]*$`)
+	decimalRegexp  = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+)
+
+func (e *missingError) Error() string {
+	return fmt.Sprintf("%s: missing element %s", e.path, e.expected)
+}
+
+// ParseSchema parses an XML Schema document.
+func ParseSchema(data []byte) (*Schema, error) {
+	root, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.Space != xsdSpace || root.Name != "schema" {
+		return nil, fmt.Errorf("root element is not xs:schema")
+	}
+
+	s := &Schema{
+		elements: map[string]*elementDecl{},
+		types:    map[string]*xsdType{},
+	}
+	s.targetNamespace, _ = root.Attr("targetNamespace")
+
+	for _, c := range xsdChildren(root) {
+		name, _ := c.Attr("name")
+		switch c.Name {
+		case "element":
+			decl, err := s.parseElement(c, true)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := s.elements[decl.name]; ok {
+				return nil, fmt.Errorf("duplicated element %s", decl.name)
+			}
+			s.elements[decl.name] = decl
+		case "complexType", "simpleType":
+			if name == "" {
+				return nil, fmt.Errorf("global %s without name", c.Name)
+			}
+			if _, ok := s.types[name]; ok {
+				return nil, fmt.Errorf("duplicated type %s", name)
+			}
+			var t *xsdType
+			if c.Name == "complexType" {
+				t, err = s.parseComplexType(c)
+			} else {
+				t, err = s.parseSimpleType(c)
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.types[name] = t
+		default:
+			return nil, fmt.Errorf("xs:%s is not supported", c.Name)
+		}
+	}
+
+	for _, fn := range s.pending {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+	}
+	s.pending = nil
+
+	if len(s.elements) == 0 {
+		return nil, fmt.Errorf("no global elements")
+	}
+	return s, nil
+}
+
+// xsdChildren returns the child elements of XML Schema, the annotations
+// are skipped.
+func xsdChildren(n *Node) []*Node {
+	var children []*Node
+	for _, c := range n.Children {
+		if c.Space == xsdSpace && c.Name != "annotation" {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// lookupNamespace returns the namespace URI of the prefix in the scope of
+// the element, the default namespace is returned if prefix is empty.
+func lookupNamespace(n *Node, prefix string) string {
+	for ; n != nil; n = n.Parent {
+		for _, a := range n.Attrs {
+			if prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns" {
+				return a.Value
+			}
+			if prefix != "" && a.Name.Space == "xmlns" && a.Name.Local == prefix {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// resolveType resolves the type of the qualified name in the scope of n
+// after the global declarations are parsed.
+func (s *Schema) resolveType(n *Node, qname string, target **xsdType) {
+	prefix, local := "", qname
+	if i := strings.IndexByte(qname, ':'); i >= 0 {
+		prefix, local = qname[:i], qname[i+1:]
+	}
+	ns := lookupNamespace(n, prefix)
+
+	s.pending = append(s.pending, func() error {
+		if ns == xsdSpace {
+			if _, ok := builtinTypes[local]; !ok {
+				return fmt.Errorf("built-in type %s is not supported", qname)
+			}
+			*target = &xsdType{builtin: local}
+			return nil
+		}
+		t := s.types[local]
+		if t == nil {
+			return fmt.Errorf("type %s not found", qname)
+		}
+		*target = t
+		return nil
+	})
+}
+
+func parseOccurs(n *Node) (int, int, error) {
+	min, max := 1, 1
+	if v, ok := n.Attr("minOccurs"); ok {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			return 0, 0, fmt.Errorf("invalid minOccurs %s", v)
+		}
+		min = i
+	}
+	if v, ok := n.Attr("maxOccurs"); ok {
+		if v == "unbounded" {
+			max = -1
+		} else {
+			i, err := strconv.Atoi(v)
+			if err != nil || i < 0 {
+				return 0, 0, fmt.Errorf("invalid maxOccurs %s", v)
+			}
+			max = i
+		}
+	}
+	if max >= 0 && max < min {
+		return 0, 0, fmt.Errorf("maxOccurs is less than minOccurs")
+	}
+	return min, max, nil
+}
+
+func (s *Schema) parseElement(n *Node, global bool) (*elementDecl, error) {
+	decl := &elementDecl{}
+
+	if ref, ok := n.Attr("ref"); ok {
+		if global {
+			return nil, fmt.Errorf("global element with ref %s", ref)
+		}
+		local := ref[strings.IndexByte(ref, ':')+1:]
+		decl.name = local
+		s.pending = append(s.pending, func() error {
+			if decl.ref = s.elements[local]; decl.ref == nil {
+				return fmt.Errorf("element %s not found", ref)
+			}
+			return nil
+		})
+		return decl, nil
+	}
+
+	decl.name, _ = n.Attr("name")
+	if decl.name == "" {
+		return nil, fmt.Errorf("element without name")
+	}
+
+	if typeName, ok := n.Attr("type"); ok {
+		s.resolveType(n, typeName, &decl.typ)
+		return decl, nil
+	}
+
+	decl.typ = &xsdType{builtin: "anyType"}
+	for _, c := range xsdChildren(n) {
+		var err error
+		switch c.Name {
+		case "complexType":
+			decl.typ, err = s.parseComplexType(c)
+		case "simpleType":
+			decl.typ, err = s.parseSimpleType(c)
+		default:
+			err = fmt.Errorf("xs:%s is not supported", c.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("element %s: %v", decl.name, err)
+		}
+	}
+	return decl, nil
+}
+
+func (s *Schema) parseParticle(n *Node) (*particle, error) {
+	p := &particle{kind: n.Name}
+	var err error
+	if p.min, p.max, err = parseOccurs(n); err != nil {
+		return nil, err
+	}
+
+	switch n.Name {
+	case "element":
+		p.element, err = s.parseElement(n, false)
+		return p, err
+	case "any":
+		return p, nil
+	case "sequence", "choice", "all":
+		for _, c := range xsdChildren(n) {
+			if n.Name == "all" && c.Name != "element" {
+				return nil, fmt.Errorf("xs:%s in xs:all", c.Name)
+			}
+			child, err := s.parseParticle(c)
+			if err != nil {
+				return nil, err
+			}
+			if n.Name == "all" && child.max != 1 {
+				return nil, fmt.Errorf("maxOccurs of elements in xs:all must be 1")
+			}
+			p.children = append(p.children, child)
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("xs:%s is not supported", n.Name)
+}
+
+func (s *Schema) parseAttribute(n *Node) (*attributeDecl, error) {
+	a := &attributeDecl{}
+	a.name, _ = n.Attr("name")
+	if a.name == "" {
+		return nil, fmt.Errorf("attribute without name")
+	}
+	use, _ := n.Attr("use")
+	a.required = use == "required"
+
+	if typeName, ok := n.Attr("type"); ok {
+		s.resolveType(n, typeName, &a.typ)
+		return a, nil
+	}
+
+	a.typ = &xsdType{builtin: "anySimpleType"}
+	for _, c := range xsdChildren(n) {
+		if c.Name != "simpleType" {
+			return nil, fmt.Errorf("xs:%s is not supported", c.Name)
+		}
+		t, err := s.parseSimpleType(c)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", a.name, err)
+		}
+		a.typ = t
+	}
+	return a, nil
+}
+
+func (s *Schema) parseComplexType(n *Node) (*xsdType, error) {
+	ct := &complexType{}
+	ct.mixed = attrBool(n, "mixed")
+
+	parseAttributes := func(c *Node) (bool, error) {
+		switch c.Name {
+		case "attribute":
+			a, err := s.parseAttribute(c)
+			if err != nil {
+				return true, err
+			}
+			ct.attributes = append(ct.attributes, a)
+			return true, nil
+		case "anyAttribute":
+			ct.anyAttribute = true
+			return true, nil
+		}
+		return false, nil
+	}
+
+	for _, c := range xsdChildren(n) {
+		if ok, err := parseAttributes(c); ok {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch c.Name {
+		case "sequence", "choice", "all":
+			if ct.model != nil {
+				return nil, fmt.Errorf("multiple content models")
+			}
+			p, err := s.parseParticle(c)
+			if err != nil {
+				return nil, err
+			}
+			ct.model = p
+		case "simpleContent":
+			children := xsdChildren(c)
+			if len(children) != 1 || children[0].Name != "extension" {
+				return nil, fmt.Errorf("only xs:extension is supported in xs:simpleContent")
+			}
+			ext := children[0]
+			base, _ := ext.Attr("base")
+			if base == "" {
+				return nil, fmt.Errorf("xs:extension without base")
+			}
+			s.resolveType(ext, base, &ct.simpleContent)
+			for _, a := range xsdChildren(ext) {
+				ok, err := parseAttributes(a)
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					return nil, fmt.Errorf("xs:%s is not supported in xs:extension", a.Name)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("xs:%s is not supported", c.Name)
+		}
+	}
+
+	return &xsdType{complex: ct}, nil
+}
+
+func (s *Schema) parseSimpleType(n *Node) (*xsdType, error) {
+	children := xsdChildren(n)
+	if len(children) != 1 || children[0].Name != "restriction" {
+		return nil, fmt.Errorf("only xs:restriction is supported in xs:simpleType")
+	}
+	r := children[0]
+
+	st := &simpleType{length: -1, minLength: -1, maxLength: -1, totalDigits: -1, fracDigits: -1}
+	if base, ok := r.Attr("base"); ok {
+		s.resolveType(r, base, &st.base)
+	}
+
+	for _, f := range xsdChildren(r) {
+		value, _ := f.Attr("value")
+
+		var err error
+		switch f.Name {
+		case "simpleType":
+			st.base, err = s.parseSimpleType(f)
+		case "enumeration":
+			st.enumeration = append(st.enumeration, value)
+		case "pattern":
+			var re *regexp.Regexp
+			if re, err = regexp.Compile("^(?:" + value + ")$"); err == nil {
+				st.patterns = append(st.patterns, re)
+			}
+		case "length":
+			st.length, err = strconv.Atoi(value)
+		case "minLength":
+			st.minLength, err = strconv.Atoi(value)
+		case "maxLength":
+			st.maxLength, err = strconv.Atoi(value)
+		case "totalDigits":
+			st.totalDigits, err = strconv.Atoi(value)
+		case "fractionDigits":
+			st.fracDigits, err = strconv.Atoi(value)
+		case "minInclusive":
+			st.minInc, err = parseFacetNumber(value)
+		case "maxInclusive":
+			st.maxInc, err = parseFacetNumber(value)
+		case "minExclusive":
+			st.minExc, err = parseFacetNumber(value)
+		case "maxExclusive":
+			st.maxExc, err = parseFacetNumber(value)
+		case "whiteSpace":
+		default:
+			err = fmt.Errorf("xs:%s is not supported", f.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid facet %s: %v", f.Name, err)
+		}
+	}
+
+	if st.base == nil {
+		s.pending = append(s.pending, func() error {
+			if st.base == nil {
+				return fmt.Errorf("xs:restriction without base")
+			}
+			return nil
+		})
+	}
+	s.pending = append(s.pending, func() error {
+		if st.base != nil && st.base.complex != nil {
+			return fmt.Errorf("base of simple type is a complex type")
+		}
+		return nil
+	})
+	return &xsdType{simple: st}, nil
+}
+
+func parseFacetNumber(value string) (*float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func attrBool(n *Node, name string) bool {
+	v, _ := n.Attr(name)
+	return v == "true" || v == "1"
+}
+
+// Validate validates the element against the schema.
+func (s *Schema) Validate(root *Node) error {
+	decl := s.elements[root.Name]
+	if decl == nil {
+		return fmt.Errorf("element %s is not declared", root.Name)
+	}
+	if s.targetNamespace != root.Space {
+		return fmt.Errorf("namespace of element %s is %q, but %q is expected", root.Name, root.Space, s.targetNamespace)
+	}
+	return s.validateElement(root, decl, "/"+root.Name)
+}
+
+func (s *Schema) validateElement(n *Node, decl *elementDecl, path string) error {
+	if decl.ref != nil {
+		decl = decl.ref
+	}
+	t := decl.typ
+
+	if t.builtin == "anyType" {
+		return nil
+	}
+
+	if t.complex == nil {
+		for _, a := range n.Attrs {
+			if !isNamespaceDecl(a) && a.Name.Space != xsiSpace {
+				return fmt.Errorf("%s: attribute %s is not allowed", path, a.Name.Local)
+			}
+		}
+		if len(n.Children) > 0 {
+			return fmt.Errorf("%s: element %s is not allowed", path, n.Children[0].Name)
+		}
+		if err := checkSimple(t, n.Text); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	}
+
+	ct := t.complex
+	if err := checkAttributes(n, ct, path); err != nil {
+		return err
+	}
+
+	if ct.simpleContent != nil {
+		if len(n.Children) > 0 {
+			return fmt.Errorf("%s: element %s is not allowed", path, n.Children[0].Name)
+		}
+		if err := checkSimple(ct.simpleContent, n.Text); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return nil
+	}
+
+	if !ct.mixed && strings.TrimSpace(n.Text) != "" {
+		return fmt.Errorf("%s: text is not allowed", path)
+	}
+
+	i := 0
+	if ct.model != nil {
+		var err error
+		if i, err = s.matchOccurs(ct.model, n.Children, 0, path); err != nil {
+			return err
+		}
+	}
+	if i < len(n.Children) {
+		return fmt.Errorf("%s: element %s is not allowed", path, n.Children[i].Name)
+	}
+	return nil
+}
+
+func checkAttributes(n *Node, ct *complexType, path string) error {
+	declared := make(map[string]*attributeDecl, len(ct.attributes))
+	for _, a := range ct.attributes {
+		declared[a.name] = a
+		v, ok := n.Attr(a.name)
+		if !ok {
+			if a.required {
+				return fmt.Errorf("%s: missing attribute %s", path, a.name)
+			}
+			continue
+		}
+		if err := checkSimple(a.typ, v); err != nil {
+			return fmt.Errorf("%s: attribute %s: %v", path, a.name, err)
+		}
+	}
+
+	if ct.anyAttribute {
+		return nil
+	}
+	for _, a := range n.Attrs {
+		if isNamespaceDecl(a) || a.Name.Space == xsiSpace {
+			continue
+		}
+		if _, ok := declared[a.Name.Local]; !ok {
+			return fmt.Errorf("%s: attribute %s is not allowed", path, a.Name.Local)
+		}
+	}
+	return nil
+}
+
+// matchOccurs matches the particle repeatedly from the i-th child,
+// greedily, and returns the index of the first child not matched.
+func (s *Schema) matchOccurs(p *particle, children []*Node, i int, path string) (int, error) {
+	count := 0
+	for p.max < 0 || count < p.max {
+		next, matched, err := s.matchOnce(p, children, i, path)
+		if err != nil {
+			return next, err
+		}
+		if !matched {
+			break
+		}
+		if next == i {
+			// matches nothing, which satisfies any occurrences.
+			return i, nil
+		}
+		i = next
+		count++
+	}
+
+	if count < p.min {
+		return i, &missingError{path: path, expected: p.expected()}
+	}
+	return i, nil
+}
+
+// matchOnce matches the particle once from the i-th child.
+func (s *Schema) matchOnce(p *particle, children []*Node, i int, path string) (int, bool, error) {
+	switch p.kind {
+	case "any":
+		if i < len(children) {
+			return i + 1, true, nil
+		}
+		return i, false, nil
+
+	case "element":
+		if i >= len(children) || children[i].Name != p.element.name {
+			return i, false, nil
+		}
+		c := children[i]
+		return i + 1, true, s.validateElement(c, p.element, path+"/"+c.Name)
+
+	case "sequence":
+		start := i
+		for _, child := range p.children {
+			next, err := s.matchOccurs(child, children, i, path)
+			if err != nil {
+				if _, ok := err.(*missingError); ok && next == start {
+					return start, false, nil
+				}
+				return next, false, err
+			}
+			i = next
+		}
+		return i, true, nil
+
+	case "choice":
+		matchEmpty := false
+		for _, child := range p.children {
+			next, err := s.matchOccurs(child, children, i, path)
+			if err != nil {
+				if _, ok := err.(*missingError); ok && next == i {
+					continue
+				}
+				return next, false, err
+			}
+			if next > i {
+				return next, true, nil
+			}
+			matchEmpty = true
+		}
+		return i, matchEmpty, nil
+
+	case "all":
+		start := i
+		used := map[*particle]bool{}
+	loop:
+		for i < len(children) {
+			for _, child := range p.children {
+				if !used[child] && child.element.name == children[i].Name {
+					used[child] = true
+					c := children[i]
+					if err := s.validateElement(c, child.element, path+"/"+c.Name); err != nil {
+						return i, false, err
+					}
+					i++
+					continue loop
+				}
+			}
+			break
+		}
+		for _, child := range p.children {
+			if !used[child] && child.min > 0 {
+				if i == start {
+					return start, false, nil
+				}
+				return i, false, &missingError{path: path, expected: child.element.name}
+			}
+		}
+		return i, true, nil
+	}
+
+	return i, false, fmt.Errorf("BUG: unknown particle %s", p.kind)
+}
+
+// expected returns the description of the first element expected by the
+// particle.
+func (p *particle) expected() string {
+	switch p.kind {
+	case "element":
+		return p.element.name
+	case "any":
+		return "any"
+	}
+	names := make([]string, 0, len(p.children))
+	for _, c := range p.children {
+		names = append(names, c.expected())
+	}
+	if p.kind == "sequence" && len(names) > 0 {
+		return names[0]
+	}
+	return strings.Join(names, " or ")
+}
+
+// checkSimple checks the value against the simple type.
+func checkSimple(t *xsdType, value string) error {
+	if t.complex != nil {
+		return fmt.Errorf("BUG: complex type in simple value")
+	}
+	if t.builtin != "" {
+		return checkBuiltin(t.builtin, value)
+	}
+
+	st := t.simple
+	if err := checkSimple(st.base, value); err != nil {
+		return err
+	}
+	if !isStringType(st.base) {
+		value = strings.TrimSpace(value)
+	}
+
+	if len(st.enumeration) > 0 {
+		found := false
+		for _, e := range st.enumeration {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%q is not one of %s", value, strings.Join(st.enumeration, ", "))
+		}
+	}
+	for _, re := range st.patterns {
+		if !re.MatchString(value) {
+			return fmt.Errorf("%q doesn't match pattern %s", value, re.String())
+		}
+	}
+
+	n := utf8.RuneCountInString(value)
+	if st.length >= 0 && n != st.length {
+		return fmt.Errorf("length of %q is not %d", value, st.length)
+	}
+	if st.minLength >= 0 && n < st.minLength {
+		return fmt.Errorf("length of %q is less than %d", value, st.minLength)
+	}
+	if st.maxLength >= 0 && n > st.maxLength {
+		return fmt.Errorf("length of %q is greater than %d", value, st.maxLength)
+	}
+
+	if st.minInc != nil || st.maxInc != nil || st.minExc != nil || st.maxExc != nil {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		switch {
+		case st.minInc != nil && f < *st.minInc,
+			st.maxInc != nil && f > *st.maxInc,
+			st.minExc != nil && f <= *st.minExc,
+			st.maxExc != nil && f >= *st.maxExc:
+			return fmt.Errorf("%q is out of range", value)
+		}
+	}
+
+	if st.totalDigits >= 0 || st.fracDigits >= 0 {
+		if !decimalRegexp.MatchString(value) {
+			return fmt.Errorf("%q is not a decimal", value)
+		}
+		digits := strings.TrimLeft(value, "+-")
+		frac := ""
+		if i := strings.IndexByte(digits, '.'); i >= 0 {
+			digits, frac = digits[:i], strings.TrimRight(digits[i+1:], "0")
+		}
+		digits = strings.TrimLeft(digits, "0")
+		if st.fracDigits >= 0 && len(frac) > st.fracDigits {
+			return fmt.Errorf("%q has more than %d fraction digits", value, st.fracDigits)
+		}
+		if st.totalDigits >= 0 && len(digits)+len(frac) > st.totalDigits {
+			return fmt.Errorf("%q has more than %d digits", value, st.totalDigits)
+		}
+	}
+
+	return nil
+}
+
+// isStringType returns whether the whitespaces of the values of the type
+// are preserved.
+func isStringType(t *xsdType) bool {
+	for t.simple != nil {
+		t = t.simple.base
+	}
+	return t.builtin == "string" || t.builtin == "anySimpleType"
+}
+
+var integerRanges = map[string][2]*big.Int{
+	"nonPositiveInteger": {nil, big.NewInt(0)},
+	"negativeInteger":    {nil, big.NewInt(-1)},
+	"nonNegativeInteger": {big.NewInt(0), nil},
+	"positiveInteger":    {big.NewInt(1), nil},
+	"long":               {big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64)},
+	"int":                {big.NewInt(math.MinInt32), big.NewInt(math.MaxInt32)},
+	"short":              {big.NewInt(math.MinInt16), big.NewInt(math.MaxInt16)},
+	"byte":               {big.NewInt(math.MinInt8), big.NewInt(math.MaxInt8)},
+	"unsignedLong":       {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64)},
+	"unsignedInt":        {big.NewInt(0), big.NewInt(math.MaxUint32)},
+	"unsignedShort":      {big.NewInt(0), big.NewInt(math.MaxUint16)},
+	"unsignedByte":       {big.NewInt(0), big.NewInt(math.MaxUint8)},
+	"integer":            {nil, nil},
+}
+
+func checkBuiltin(name string, value string) error {
+	if name == "string" || name == "anySimpleType" || name == "anyType" {
+		return nil
+	}
+
+	value = strings.TrimSpace(value)
+	invalid := fmt.Errorf("invalid %s %q", name, value)
+
+	if r, ok := integerRanges[name]; ok {
+		i, ok := new(big.Int).SetString(strings.TrimPrefix(value, "+"), 10)
+		if !ok || (r[0] != nil && i.Cmp(r[0]) < 0) || (r[1] != nil && i.Cmp(r[1]) > 0) {
+			return invalid
+		}
+		return nil
+	}
+
+	var ok bool
+	switch name {
+	case "normalizedString", "token", "language", "anyURI":
+		ok = true
+	case "Name", "ID", "IDREF", "QName", "NCName":
+		ok = nameRegexp.MatchString(value) && (name != "NCName" && name != "ID" && name != "IDREF" || !strings.Contains(value, ":"))
+	case "boolean":
+		ok = value == "true" || value == "false" || value == "1" || value == "0"
+	case "decimal":
+		ok = decimalRegexp.MatchString(value)
+	case "float", "double":
+		_, err := strconv.ParseFloat(value, 64)
+		ok = err == nil || value == "INF" || value == "-INF" || value == "NaN"
+		ok = ok && !strings.ContainsAny(value, "xXpP_") && !strings.EqualFold(value, "infinity") && !strings.EqualFold(value, "inf")
+	case "date":
+		if ok = dateRegexp.MatchString(value); ok {
+			_, err := time.Parse("2006-01-02", value[:10])
+			ok = err == nil
+		}
+	case "dateTime":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			// the time zone is optional.
+			_, err = time.Parse("2006-01-02T15:04:05.999999999", value)
+		}
+		ok = err == nil
+	case "time":
+		ok = timeRegexp.MatchString(value)
+	case "duration":
+		ok = durationRegexp.MatchString(value) && value != "P" && value != "-P" && !strings.HasSuffix(value, "T")
+	case "base64Binary":
+		_, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		ok = err == nil
+	case "hexBinary":
+		_, err := hex.DecodeString(value)
+		ok = err == nil
+	default:
+		return fmt.Errorf("BUG: unknown built-in type %s", name)
+	}
+
+	if !ok {
+		return invalid
+	}
+	return nil
+}
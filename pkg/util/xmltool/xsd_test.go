@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xmltool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const orderSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"
+    xmlns:tns="http://example.com/order"
+    targetNamespace="http://example.com/order">
+  <xs:annotation><xs:documentation>orders</xs:documentation></xs:annotation>
+  <xs:element name="order" type="tns:Order"/>
+  <xs:element name="note" type="xs:string"/>
+
+  <xs:complexType name="Order">
+    <xs:sequence>
+      <xs:element name="customer" type="tns:Email"/>
+      <xs:element name="item" minOccurs="1" maxOccurs="unbounded">
+        <xs:complexType>
+          <xs:simpleContent>
+            <xs:extension base="xs:string">
+              <xs:attribute name="quantity" type="xs:positiveInteger" use="required"/>
+            </xs:extension>
+          </xs:simpleContent>
+        </xs:complexType>
+      </xs:element>
+      <xs:choice minOccurs="0">
+        <xs:element name="express" type="xs:boolean"/>
+        <xs:element name="pickup" type="xs:date"/>
+      </xs:choice>
+      <xs:element ref="tns:note" minOccurs="0"/>
+      <xs:element name="amount">
+        <xs:simpleType>
+          <xs:restriction base="xs:decimal">
+            <xs:minExclusive value="0"/>
+            <xs:fractionDigits value="2"/>
+          </xs:restriction>
+        </xs:simpleType>
+      </xs:element>
+    </xs:sequence>
+    <xs:attribute name="status" type="tns:Status"/>
+  </xs:complexType>
+
+  <xs:simpleType name="Status">
+    <xs:restriction base="xs:string">
+      <xs:enumeration value="new"/>
+      <xs:enumeration value="paid"/>
+    </xs:restriction>
+  </xs:simpleType>
+
+  <xs:simpleType name="Email">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[^@]+@[^@]+"/>
+      <xs:maxLength value="20"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`
+
+func TestSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := ParseSchema([]byte(orderSchema))
+	assert.NoError(err)
+
+	validate := func(doc string) error {
+		root, err := Parse([]byte(doc))
+		assert.NoError(err, doc)
+		return s.Validate(root)
+	}
+
+	valid := []string{
+		`<order xmlns="http://example.com/order" status="new">
+  <customer>a@b.com</customer>
+  <item quantity="2">apple</item>
+  <item quantity="1">banana</item>
+  <express>true</express>
+  <note>leave at the door</note>
+  <amount>10.50</amount>
+</order>`,
+		`<o:order xmlns:o="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><pickup>2022-10-01</pickup><amount>1</amount></o:order>`,
+		`<note xmlns="http://example.com/order">hello</note>`,
+	}
+	for _, doc := range valid {
+		assert.NoError(validate(doc), doc)
+	}
+
+	invalid := []string{
+		// namespace
+		`<order><customer>a@b.com</customer><item quantity="1">x</item><amount>1</amount></order>`,
+		// undeclared element
+		`<item xmlns="http://example.com/order"/>`,
+		// pattern
+		`<order xmlns="http://example.com/order"><customer>a</customer><item quantity="1">x</item><amount>1</amount></order>`,
+		// missing item
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><amount>1</amount></order>`,
+		// missing attribute
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item>x</item><amount>1</amount></order>`,
+		// invalid attribute
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="0">x</item><amount>1</amount></order>`,
+		// both choices
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><express>1</express><pickup>2022-10-01</pickup><amount>1</amount></order>`,
+		// invalid date
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><pickup>2022-13-01</pickup><amount>1</amount></order>`,
+		// fraction digits
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><amount>1.005</amount></order>`,
+		// out of range
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><amount>0</amount></order>`,
+		// enumeration
+		`<order xmlns="http://example.com/order" status="old"><customer>a@b.com</customer><item quantity="1">x</item><amount>1</amount></order>`,
+		// undeclared attribute
+		`<order xmlns="http://example.com/order" id="1"><customer>a@b.com</customer><item quantity="1">x</item><amount>1</amount></order>`,
+		// wrong order
+		`<order xmlns="http://example.com/order"><item quantity="1">x</item><customer>a@b.com</customer><amount>1</amount></order>`,
+		// unexpected element
+		`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><amount>1</amount><extra/></order>`,
+		// text in element-only content
+		`<order xmlns="http://example.com/order">text<customer>a@b.com</customer><item quantity="1">x</item><amount>1</amount></order>`,
+		// child of simple type
+		`<note xmlns="http://example.com/order"><b>hello</b></note>`,
+	}
+	for _, doc := range invalid {
+		assert.Error(validate(doc), doc)
+	}
+
+	err = validate(`<order xmlns="http://example.com/order"><customer>a@b.com</customer><item quantity="1">x</item><amount>abc</amount></order>`)
+	assert.EqualError(err, `/order/amount: invalid decimal "abc"`)
+}
+
+func TestSchemaAll(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := ParseSchema([]byte(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="user">
+    <xs:complexType>
+      <xs:all>
+        <xs:element name="name" type="xs:string"/>
+        <xs:element name="age" type="xs:int" minOccurs="0"/>
+      </xs:all>
+    </xs:complexType>
+  </xs:element>
+  <xs:element name="any">
+    <xs:complexType>
+      <xs:sequence><xs:any minOccurs="0" maxOccurs="unbounded"/></xs:sequence>
+      <xs:anyAttribute/>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`))
+	assert.NoError(err)
+
+	for doc, valid := range map[string]bool{
+		`<user><age>3</age><name>a</name></user>`:          true,
+		`<user><name>a</name></user>`:                      true,
+		`<user><age>3</age></user>`:                        false,
+		`<user><name>a</name><name>b</name></user>`:        false,
+		`<user><name>a</name><age>9999999999</age></user>`: false,
+		`<any a="1"><x><y/></x><z/></any>`:                 true,
+	} {
+		root, err := Parse([]byte(doc))
+		assert.NoError(err)
+		if valid {
+			assert.NoError(s.Validate(root), doc)
+		} else {
+			assert.Error(s.Validate(root), doc)
+		}
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, schema := range []string{
+		`<schema/>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"/>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="b"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="xs:gYear"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"/><xs:element name="a"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:import namespace="x"/></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"><xs:complexType><xs:sequence><xs:element ref="b"/></xs:sequence></xs:complexType></xs:element></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"><xs:complexType><xs:complexContent/></xs:complexType></xs:element></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"><xs:simpleType><xs:restriction base="xs:string"><xs:pattern value="("/></xs:restriction></xs:simpleType></xs:element></xs:schema>`,
+		`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"><xs:complexType><xs:sequence><xs:element name="b" minOccurs="2" maxOccurs="1"/></xs:sequence></xs:complexType></xs:element></xs:schema>`,
+	} {
+		_, err := ParseSchema([]byte(schema))
+		assert.Error(err, schema)
+	}
+}